@@ -0,0 +1,25 @@
+package api
+
+// ChannelVersionConfigItem is the config item pinning a cluster to a version
+// of its channel, e.g. a commit of a Git channel or the digest of an OCI
+// channel.
+const ChannelVersionConfigItem = "channel_version"
+
+// RolloutWaveConfigItem is the config item assigning a cluster to a wave of
+// the rollout of new channel versions. Wave 0 are the canary clusters.
+const RolloutWaveConfigItem = "rollout_wave"
+
+// ChannelRef returns what the configuration of the cluster is fetched with
+// from the channel source: the channel version the cluster is pinned to by
+// the ChannelVersionConfigItem or else by a rollback, or its channel.
+func (cluster *Cluster) ChannelRef() string {
+	if version := cluster.ConfigItems[ChannelVersionConfigItem]; version != "" {
+		return version
+	}
+
+	if cluster.Status != nil && cluster.Status.PinnedChannelVersion != "" {
+		return cluster.Status.PinnedChannelVersion
+	}
+
+	return cluster.Channel
+}
@@ -0,0 +1,37 @@
+package api
+
+import "testing"
+
+func TestChannelRef(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		cluster  *Cluster
+		expected string
+	}{
+		{
+			msg:      "channel",
+			cluster:  &Cluster{Channel: "stable"},
+			expected: "stable",
+		},
+		{
+			msg:      "pinned by a rollback",
+			cluster:  &Cluster{Channel: "stable", Status: &ClusterStatus{PinnedChannelVersion: "abc123"}},
+			expected: "abc123",
+		},
+		{
+			msg: "pinned by the config item",
+			cluster: &Cluster{
+				Channel:     "stable",
+				ConfigItems: map[string]string{ChannelVersionConfigItem: "def456"},
+				Status:      &ClusterStatus{PinnedChannelVersion: "abc123"},
+			},
+			expected: "def456",
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			if ref := tc.cluster.ChannelRef(); ref != tc.expected {
+				t.Errorf("expected %s, got %s", tc.expected, ref)
+			}
+		})
+	}
+}
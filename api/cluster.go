@@ -18,4 +18,7 @@ type Cluster struct {
 	Status                *ClusterStatus    `json:"status"                 yaml:"status"`
 	Outputs               map[string]string `json:"outputs"                yaml:"outputs"`
 	Owner                 string            `json:"owner"                  yaml:"owner"`
+	// ConfigValues are the typed values of the config items loaded from
+	// the values files of the channel. They aren't part of the registry.
+	ConfigValues map[string]interface{} `json:"-" yaml:"-"`
 }
@@ -1,9 +1,84 @@
 package api
 
+import "time"
+
 // ClusterStatus describes the status of a cluster.
 type ClusterStatus struct {
 	CurrentVersion string     `json:"current_version" yaml:"current_version"`
 	LastVersion    string     `json:"last_version"    yaml:"last_version"`
 	NextVersion    string     `json:"next_version"    yaml:"next_version"`
 	Problems       []*Problem `json:"problems"        yaml:"problems"`
+	// Progress is the current step of the cluster provisioning, if the
+	// cluster is being provisioned.
+	Progress *Progress `json:"progress" yaml:"progress"`
+	// NodePools is the status of the last successful provisioning of
+	// each node pool.
+	NodePools []*NodePoolStatus `json:"node_pools" yaml:"node_pools"`
+	// LastUpdate summarizes the last provisioning of the cluster.
+	LastUpdate *UpdateSummary `json:"last_update" yaml:"last_update"`
+	// PinnedChannelVersion is the channel version a cluster was rolled
+	// back to. The cluster is provisioned with it instead of the latest
+	// version of its channel until the pin is cleared.
+	PinnedChannelVersion string `json:"pinned_channel_version" yaml:"pinned_channel_version"`
+	// Drift lists the properties of the cluster's stacks which were
+	// found changed outside of cloudformation by the last provisioning.
+	Drift []string `json:"drift,omitempty" yaml:"drift,omitempty"`
+}
+
+// NodePoolStatus describes the last successful provisioning of a node pool.
+type NodePoolStatus struct {
+	Name string `json:"name" yaml:"name"`
+	// TemplateHash identifies the userdata or instance template the node
+	// pool was provisioned with.
+	TemplateHash string `json:"template_hash" yaml:"template_hash"`
+	// StackStatus is the status of the stack containing the node pool,
+	// if the provider uses stacks.
+	StackStatus   string    `json:"stack_status"   yaml:"stack_status"`
+	ProvisionedAt time.Time `json:"provisioned_at" yaml:"provisioned_at"`
+	// Nodes is the number of nodes of the node pool, UpToDateNodes the
+	// number of them launched from its current launch configuration.
+	Nodes         int `json:"nodes"            yaml:"nodes"`
+	UpToDateNodes int `json:"up_to_date_nodes" yaml:"up_to_date_nodes"`
+	// Scaling is the size the node pool was scaled to since it was
+	// provisioned, if any. The next provisioning restores the size
+	// defined in the registry.
+	Scaling *NodePoolScaling `json:"scaling,omitempty" yaml:"scaling,omitempty"`
+}
+
+// NodePoolScaling describes a change of the size of a node pool made without
+// provisioning its cluster.
+type NodePoolScaling struct {
+	MinSize  int64     `json:"min_size"  yaml:"min_size"`
+	MaxSize  int64     `json:"max_size"  yaml:"max_size"`
+	ScaledAt time.Time `json:"scaled_at" yaml:"scaled_at"`
+	Actor    string    `json:"actor"     yaml:"actor"`
+}
+
+// SetNodePoolStatus replaces the status of a node pool, statuses of node
+// pools not in nodePools are removed.
+func (status *ClusterStatus) SetNodePoolStatus(nodePoolStatus *NodePoolStatus, nodePools []*NodePool) {
+	names := make(map[string]bool, len(nodePools))
+	for _, nodePool := range nodePools {
+		names[nodePool.Name] = true
+	}
+
+	statuses := make([]*NodePoolStatus, 0, len(nodePools))
+	for _, existing := range status.NodePools {
+		if names[existing.Name] && existing.Name != nodePoolStatus.Name {
+			statuses = append(statuses, existing)
+		}
+	}
+	status.NodePools = append(statuses, nodePoolStatus)
+}
+
+// SetNodePoolScaling records the scaling of a node pool in its status. A node
+// pool without a status gets one only containing the scaling.
+func (status *ClusterStatus) SetNodePoolScaling(nodePool string, scaling *NodePoolScaling) {
+	for _, existing := range status.NodePools {
+		if existing.Name == nodePool {
+			existing.Scaling = scaling
+			return
+		}
+	}
+	status.NodePools = append(status.NodePools, &NodePoolStatus{Name: nodePool, Scaling: scaling})
 }
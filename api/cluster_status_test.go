@@ -0,0 +1,50 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestSetNodePoolStatus(t *testing.T) {
+	status := &ClusterStatus{
+		NodePools: []*NodePoolStatus{
+			{Name: "pool-1", TemplateHash: "a"},
+			{Name: "pool-2", TemplateHash: "b"},
+			{Name: "removed", TemplateHash: "c"},
+		},
+	}
+	nodePools := []*NodePool{{Name: "pool-1"}, {Name: "pool-2"}}
+
+	status.SetNodePoolStatus(&NodePoolStatus{Name: "pool-1", TemplateHash: "d"}, nodePools)
+
+	hashes := make(map[string]string)
+	for _, nodePoolStatus := range status.NodePools {
+		hashes[nodePoolStatus.Name] = nodePoolStatus.TemplateHash
+	}
+	if len(hashes) != 2 || len(status.NodePools) != 2 {
+		t.Fatalf("expected the status of 2 node pools, got %v", hashes)
+	}
+	if hashes["pool-1"] != "d" || hashes["pool-2"] != "b" {
+		t.Errorf("unexpected node pool statuses %v", hashes)
+	}
+}
+
+func TestSetNodePoolScaling(t *testing.T) {
+	status := &ClusterStatus{
+		NodePools: []*NodePoolStatus{
+			{Name: "pool-1", TemplateHash: "a"},
+		},
+	}
+
+	status.SetNodePoolScaling("pool-1", &NodePoolScaling{MinSize: 3, MaxSize: 20})
+	status.SetNodePoolScaling("pool-2", &NodePoolScaling{MinSize: 1, MaxSize: 5})
+
+	if len(status.NodePools) != 2 {
+		t.Fatalf("expected the status of 2 node pools, got %d", len(status.NodePools))
+	}
+	if status.NodePools[0].TemplateHash != "a" || status.NodePools[0].Scaling.MaxSize != 20 {
+		t.Errorf("unexpected status of pool-1: %+v", status.NodePools[0])
+	}
+	if status.NodePools[1].Name != "pool-2" || status.NodePools[1].Scaling.MinSize != 1 {
+		t.Errorf("unexpected status of pool-2: %+v", status.NodePools[1])
+	}
+}
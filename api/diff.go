@@ -0,0 +1,231 @@
+package api
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+// Difference describes a setting which differs between two clusters. An
+// empty value means the setting is not defined for the cluster.
+type Difference struct {
+	Field string
+	A     string
+	B     string
+}
+
+// String returns a human readable representation of the difference.
+func (d *Difference) String() string {
+	return fmt.Sprintf("%s: %q != %q", d.Field, d.A, d.B)
+}
+
+// Diff compares the configuration of the cluster with another cluster and
+// returns the differences in the channel, config items and node pools. Node
+// pools are matched by name. Identity related fields like the ID or the
+// account are not compared. Config items may hold secrets, so their values
+// are represented by a hash.
+func (c *Cluster) Diff(other *Cluster) []*Difference {
+	var diffs []*Difference
+
+	add := func(field, a, b string) {
+		if a != b {
+			diffs = append(diffs, &Difference{Field: field, A: a, B: b})
+		}
+	}
+
+	add("channel", c.Channel, other.Channel)
+	add("environment", c.Environment, other.Environment)
+	add("provider", c.Provider, other.Provider)
+
+	for _, key := range unionKeys(c.ConfigItems, other.ConfigItems) {
+		add(fmt.Sprintf("config_items.%s", key), configItemHash(c.ConfigItems, key), configItemHash(other.ConfigItems, key))
+	}
+
+	pools := make(map[string]*NodePool, len(c.NodePools))
+	for _, pool := range c.NodePools {
+		pools[pool.Name] = pool
+	}
+
+	otherPools := make(map[string]*NodePool, len(other.NodePools))
+	for _, pool := range other.NodePools {
+		otherPools[pool.Name] = pool
+	}
+
+	names := make(map[string]string, len(pools)+len(otherPools))
+	for name := range pools {
+		names[name] = ""
+	}
+	for name := range otherPools {
+		names[name] = ""
+	}
+
+	for _, name := range unionKeys(names, nil) {
+		a, b := pools[name], otherPools[name]
+		if a == nil || b == nil {
+			add(fmt.Sprintf("node_pools.%s", name), nodePoolSummary(a), nodePoolSummary(b))
+			continue
+		}
+
+		prefix := fmt.Sprintf("node_pools.%s.", name)
+		add(prefix+"profile", a.Profile, b.Profile)
+		add(prefix+"instance_type", a.InstanceType, b.InstanceType)
+		add(prefix+"discount_strategy", a.DiscountStrategy, b.DiscountStrategy)
+		add(prefix+"min_size", fmt.Sprintf("%d", a.MinSize), fmt.Sprintf("%d", b.MinSize))
+		add(prefix+"max_size", fmt.Sprintf("%d", a.MaxSize), fmt.Sprintf("%d", b.MaxSize))
+		add(prefix+"require_imdsv2", fmt.Sprintf("%t", a.RequireIMDSv2), fmt.Sprintf("%t", b.RequireIMDSv2))
+		add(prefix+"imds_hop_limit", fmt.Sprintf("%d", a.IMDSHopLimit), fmt.Sprintf("%d", b.IMDSHopLimit))
+		add(prefix+"architecture", a.Architecture, b.Architecture)
+		add(prefix+"os", a.OS, b.OS)
+		add(prefix+"update_surge", a.UpdateSurge, b.UpdateSurge)
+		add(prefix+"update_canary", a.UpdateCanary, b.UpdateCanary)
+		add(prefix+"update_max_unavailable", a.UpdateMaxUnavailable, b.UpdateMaxUnavailable)
+		add(prefix+"update_mode", a.UpdateMode, b.UpdateMode)
+		add(prefix+"update_strategy", a.UpdateStrategy, b.UpdateStrategy)
+		add(prefix+"decommission_protection", fmt.Sprintf("%t", a.DecommissionProtection), fmt.Sprintf("%t", b.DecommissionProtection))
+		add(prefix+"scale_down_protection", a.ScaleDownProtection, b.ScaleDownProtection)
+		add(prefix+"root_volume_type", a.RootVolumeType, b.RootVolumeType)
+		add(prefix+"root_volume_size", fmt.Sprintf("%d", a.RootVolumeSize), fmt.Sprintf("%d", b.RootVolumeSize))
+		add(prefix+"root_volume_iops", fmt.Sprintf("%d", a.RootVolumeIOPS), fmt.Sprintf("%d", b.RootVolumeIOPS))
+		add(prefix+"root_volume_encrypted", fmt.Sprintf("%t", a.RootVolumeEncrypted), fmt.Sprintf("%t", b.RootVolumeEncrypted))
+		add(prefix+"root_volume_kms_key", a.RootVolumeKMSKey, b.RootVolumeKMSKey)
+		add(prefix+"availability_zones", strings.Join(a.AvailabilityZones, ","), strings.Join(b.AvailabilityZones, ","))
+		for _, key := range unionKeys(a.SubnetTags, b.SubnetTags) {
+			add(prefix+"subnet_tags."+key, a.SubnetTags[key], b.SubnetTags[key])
+		}
+		for _, key := range unionKeys(a.Labels, b.Labels) {
+			add(prefix+"labels."+key, a.Labels[key], b.Labels[key])
+		}
+		for _, key := range unionKeys(a.Taints, b.Taints) {
+			add(prefix+"taints."+key, a.Taints[key], b.Taints[key])
+		}
+		add(prefix+"scaling_schedules", scalingSchedulesSummary(a.ScalingSchedules), scalingSchedulesSummary(b.ScalingSchedules))
+		add(prefix+"warm_pool", warmPoolSummary(a.WarmPool), warmPoolSummary(b.WarmPool))
+		add(prefix+"image", imageSummary(a.Image), imageSummary(b.Image))
+		add(prefix+"storage", storageSummary(a.Storage), storageSummary(b.Storage))
+		add(prefix+"kubelet_config", kubeletConfigSummary(a.KubeletConfig), kubeletConfigSummary(b.KubeletConfig))
+		add(prefix+"monitoring", monitoringSummary(a.Monitoring), monitoringSummary(b.Monitoring))
+		add(prefix+"lifecycle_hooks", lifecycleHooksSummary(a.LifecycleHooks), lifecycleHooksSummary(b.LifecycleHooks))
+		add(prefix+"adopt_asgs", strings.Join(a.AdoptASGs, ","), strings.Join(b.AdoptASGs, ","))
+		add(prefix+"previous_name", a.PreviousName, b.PreviousName)
+		add(prefix+"capacity_reservation_id", a.CapacityReservationID, b.CapacityReservationID)
+		add(prefix+"capacity_reservation_group_arn", a.CapacityReservationGroupARN, b.CapacityReservationGroupARN)
+		add(prefix+"tenancy", a.Tenancy, b.Tenancy)
+		add(prefix+"host_resource_group_arn", a.HostResourceGroupARN, b.HostResourceGroupARN)
+		for _, key := range unionKeys(a.Tags, b.Tags) {
+			add(prefix+"tags."+key, a.Tags[key], b.Tags[key])
+		}
+	}
+
+	return diffs
+}
+
+// configItemHash returns a short hash of the value of a config item or an
+// empty string if the config item isn't defined.
+func configItemHash(configItems map[string]string, key string) string {
+	value, ok := configItems[key]
+	if !ok {
+		return ""
+	}
+	return fmt.Sprintf("sha256:%x", sha256.Sum256([]byte(value)))[:15]
+}
+
+// nodePoolSummary returns a short description of a node pool or an empty
+// string if the node pool is nil.
+func nodePoolSummary(pool *NodePool) string {
+	if pool == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s %s %d-%d", pool.Profile, pool.InstanceType, pool.MinSize, pool.MaxSize)
+}
+
+// scalingSchedulesSummary returns a short description of scaling schedules.
+func scalingSchedulesSummary(schedules []*ScalingSchedule) string {
+	summaries := make([]string, 0, len(schedules))
+	for _, schedule := range schedules {
+		summaries = append(summaries, fmt.Sprintf("%s(%s) %d-%d/%d", schedule.Name, schedule.Recurrence, schedule.MinSize, schedule.MaxSize, schedule.DesiredCapacity))
+	}
+	return strings.Join(summaries, ", ")
+}
+
+// warmPoolSummary returns a short description of a warm pool or an empty
+// string if the node pool has no warm pool.
+func warmPoolSummary(warmPool *WarmPool) string {
+	if warmPool == nil {
+		return ""
+	}
+	return fmt.Sprintf("%s %d-%d reuse=%t", warmPool.State, warmPool.MinSize, warmPool.MaxPreparedCapacity, warmPool.ReuseOnScaleIn)
+}
+
+// imageSummary returns a short description of the image source of a node
+// pool or an empty string if it has none.
+func imageSummary(image *Image) string {
+	if image == nil {
+		return ""
+	}
+	if image.SSMParameter != "" {
+		return "ssm:" + image.SSMParameter
+	}
+	return fmt.Sprintf("%s/%s %s", image.Owner, image.Name, image.Architecture)
+}
+
+// storageSummary returns a short description of the storage of a node pool
+// or an empty string if it has none.
+func storageSummary(storage *NodeStorage) string {
+	if storage == nil {
+		return ""
+	}
+	return fmt.Sprintf("sticky=%t %s raid=%t %s %s", storage.StickyVolumes, storage.Device, storage.InstanceStoreRAID, storage.Filesystem, storage.MountPath)
+}
+
+// kubeletConfigSummary returns a short description of the kubelet config of
+// a node pool or an empty string if it has none.
+func kubeletConfigSummary(config *KubeletConfig) string {
+	if config == nil {
+		return ""
+	}
+	return fmt.Sprintf("max_pods=%d eviction_hard=%s kube_reserved=%s system_reserved=%s", config.MaxPods, mapSummary(config.EvictionHard), mapSummary(config.KubeReserved), mapSummary(config.SystemReserved))
+}
+
+// monitoringSummary returns a short description of the monitoring of a node
+// pool or an empty string if it has none. The CloudWatch agent config is
+// summarized by its length.
+func monitoringSummary(monitoring *NodePoolMonitoring) string {
+	if monitoring == nil {
+		return ""
+	}
+	return fmt.Sprintf("asg_metrics=%t detailed_monitoring=%t cloudwatch_agent_config=%d bytes", monitoring.ASGMetrics, monitoring.DetailedMonitoring, len(monitoring.CloudWatchAgentConfig))
+}
+
+// mapSummary returns the key=value pairs of a map sorted by key.
+func mapSummary(values map[string]string) string {
+	pairs := make([]string, 0, len(values))
+	for _, key := range unionKeys(values, nil) {
+		pairs = append(pairs, key+"="+values[key])
+	}
+	return strings.Join(pairs, ",")
+}
+
+// lifecycleHooksSummary returns a short description of lifecycle hooks.
+func lifecycleHooksSummary(hooks []*LifecycleHook) string {
+	summaries := make([]string, 0, len(hooks))
+	for _, hook := range hooks {
+		summaries = append(summaries, fmt.Sprintf("%s(%s) %ds %s %s", hook.Name, hook.Transition, hook.HeartbeatTimeout, hook.DefaultResult, hook.NotificationTargetARN))
+	}
+	return strings.Join(summaries, ", ")
+}
+
+// unionKeys returns the sorted union of the keys of two maps.
+func unionKeys(a, b map[string]string) []string {
+	keys := make([]string, 0, len(a)+len(b))
+	for key := range a {
+		keys = append(keys, key)
+	}
+	for key := range b {
+		if _, ok := a[key]; !ok {
+			keys = append(keys, key)
+		}
+	}
+	sort.Strings(keys)
+	return keys
+}
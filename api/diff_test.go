@@ -0,0 +1,58 @@
+package api
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestClusterDiff(t *testing.T) {
+	a := &Cluster{
+		Channel: "stable",
+		ConfigItems: map[string]string{
+			"foo": "bar",
+			"baz": "qux",
+		},
+		NodePools: []*NodePool{
+			{Name: "master-default", Profile: "master/default", InstanceType: "m4.large", MinSize: 1, MaxSize: 1},
+			{Name: "worker-default", Profile: "worker/default", InstanceType: "m4.large", MinSize: 3, MaxSize: 20},
+		},
+	}
+
+	b := &Cluster{
+		Channel: "beta",
+		ConfigItems: map[string]string{
+			"foo":   "bar",
+			"extra": "value",
+		},
+		NodePools: []*NodePool{
+			{Name: "master-default", Profile: "master/default", InstanceType: "m4.large", MinSize: 1, MaxSize: 1},
+			{Name: "worker-default", Profile: "worker/default", InstanceType: "m4.xlarge", MinSize: 3, MaxSize: 10, Labels: map[string]string{"team": "teapot"}},
+			{Name: "worker-gpu", Profile: "worker/gpu", InstanceType: "p2.xlarge", MinSize: 0, MaxSize: 2},
+		},
+	}
+
+	expected := []*Difference{
+		{Field: "channel", A: "stable", B: "beta"},
+		{Field: "config_items.baz", A: configItemHash(a.ConfigItems, "baz"), B: ""},
+		{Field: "config_items.extra", A: "", B: configItemHash(b.ConfigItems, "extra")},
+		{Field: "node_pools.worker-default.instance_type", A: "m4.large", B: "m4.xlarge"},
+		{Field: "node_pools.worker-default.max_size", A: "20", B: "10"},
+		{Field: "node_pools.worker-default.labels.team", A: "", B: "teapot"},
+		{Field: "node_pools.worker-gpu", A: "", B: "worker/gpu p2.xlarge 0-2"},
+	}
+
+	diffs := a.Diff(b)
+	if !reflect.DeepEqual(diffs, expected) {
+		t.Errorf("expected %v, got %v", expected, diffs)
+	}
+
+	for _, diff := range diffs {
+		if diff.A == "qux" || diff.B == "value" {
+			t.Errorf("expected config item values to be hashed, got %v", diff)
+		}
+	}
+
+	if diffs := a.Diff(a); len(diffs) != 0 {
+		t.Errorf("expected no differences, got %v", diffs)
+	}
+}
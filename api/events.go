@@ -0,0 +1,51 @@
+package api
+
+import (
+	"context"
+	"time"
+)
+
+// Events of the cluster lifecycle reported to the notification sinks.
+const (
+	EventUpdateStarted          = "update-started"
+	EventUpdateSucceeded        = "update-succeeded"
+	EventUpdateFailed           = "update-failed"
+	EventNodePoolDecommissioned = "node-pool-decommissioned"
+	EventStackRolledBack        = "stack-rolled-back"
+)
+
+// Event describes something that happened to a cluster while it was
+// processed.
+type Event struct {
+	Type     string    `json:"type"      yaml:"type"`
+	NodePool string    `json:"node_pool" yaml:"node_pool"`
+	Message  string    `json:"message"   yaml:"message"`
+	Time     time.Time `json:"time"      yaml:"time"`
+}
+
+// EventFunc is called with every event of a cluster.
+type EventFunc func(event *Event)
+
+type eventKey struct{}
+
+// WithEvents returns a context reporting the events of the operations it's
+// passed to to fn.
+func WithEvents(ctx context.Context, fn EventFunc) context.Context {
+	return context.WithValue(ctx, eventKey{}, fn)
+}
+
+// ReportEvent reports an event of the operation of ctx. It's a no-op if the
+// context doesn't report events.
+func ReportEvent(ctx context.Context, eventType, nodePool, message string) {
+	fn, ok := ctx.Value(eventKey{}).(EventFunc)
+	if !ok || fn == nil {
+		return
+	}
+
+	fn(&Event{
+		Type:     eventType,
+		NodePool: nodePool,
+		Message:  message,
+		Time:     time.Now().UTC(),
+	})
+}
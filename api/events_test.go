@@ -0,0 +1,27 @@
+package api
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReportEvent(t *testing.T) {
+	// contexts without an event func are ignored.
+	ReportEvent(context.Background(), EventStackRolledBack, "", "Rolled back")
+
+	var reported []*Event
+	ctx := WithEvents(context.Background(), func(event *Event) {
+		reported = append(reported, event)
+	})
+
+	ReportEvent(ctx, EventNodePoolDecommissioned, "pool-1", "Decommissioned node pool pool-1")
+
+	if len(reported) != 1 {
+		t.Fatalf("expected 1 event, got %d", len(reported))
+	}
+
+	event := reported[0]
+	if event.Type != EventNodePoolDecommissioned || event.NodePool != "pool-1" || event.Time.IsZero() {
+		t.Errorf("unexpected event %v", event)
+	}
+}
@@ -0,0 +1,213 @@
+package api
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	// MaintenanceWindowsConfigItem is the config item with the maintenance
+	// windows of a cluster separated by ';'. Each window is the cron
+	// expression of its start followed by its duration e.g.
+	// "0 2 * * 1-5 4h". Node-disruptive operations of clusters with
+	// maintenance windows are deferred until a window is open.
+	MaintenanceWindowsConfigItem = "maintenance_windows"
+	// MaintenanceTimezoneConfigItem is the config item with the IANA time
+	// zone of the maintenance windows, UTC by default.
+	MaintenanceTimezoneConfigItem = "maintenance_timezone"
+	// MaintenanceOverrideConfigItem is the config item allowing
+	// node-disruptive operations outside of the maintenance windows if set
+	// to "true" e.g. to roll out an emergency fix.
+	MaintenanceOverrideConfigItem = "maintenance_override"
+
+	// maxMaintenanceWindowDuration bounds the duration of a window and
+	// thereby how far back the start of an open window is looked for.
+	maxMaintenanceWindowDuration = 7 * 24 * time.Hour
+)
+
+// MaintenanceWindow is a recurring period of time starting whenever its cron
+// expression matches.
+type MaintenanceWindow struct {
+	minutes     uint64
+	hours       uint64
+	daysOfMonth uint64
+	months      uint64
+	daysOfWeek  uint64
+	// anyDayOfMonth and anyDayOfWeek are set if the respective field is
+	// '*'. Like in cron a window starts on days matching either field if
+	// both are restricted.
+	anyDayOfMonth bool
+	anyDayOfWeek  bool
+	duration      time.Duration
+	location      *time.Location
+}
+
+// MaintenanceWindows are the maintenance windows of a cluster.
+type MaintenanceWindows []*MaintenanceWindow
+
+// ParseMaintenanceWindows parses the ';' separated maintenance windows
+// starting in the specified time zone, or UTC if it's empty.
+func ParseMaintenanceWindows(windows, timezone string) (MaintenanceWindows, error) {
+	location := time.UTC
+	if timezone != "" {
+		var err error
+		location, err = time.LoadLocation(timezone)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window time zone %s: %v", timezone, err)
+		}
+	}
+
+	var result MaintenanceWindows
+	for _, window := range strings.Split(windows, ";") {
+		window = strings.TrimSpace(window)
+		if window == "" {
+			continue
+		}
+
+		parsed, err := parseMaintenanceWindow(window, location)
+		if err != nil {
+			return nil, fmt.Errorf("invalid maintenance window '%s': %v", window, err)
+		}
+		result = append(result, parsed)
+	}
+	return result, nil
+}
+
+func parseMaintenanceWindow(window string, location *time.Location) (*MaintenanceWindow, error) {
+	fields := strings.Fields(window)
+	if len(fields) != 6 {
+		return nil, fmt.Errorf("expected 5 cron fields and a duration, got %d fields", len(fields))
+	}
+
+	duration, err := time.ParseDuration(fields[5])
+	if err != nil {
+		return nil, err
+	}
+	if duration < time.Minute || duration > maxMaintenanceWindowDuration {
+		return nil, fmt.Errorf("duration must be between %s and %s", time.Minute, maxMaintenanceWindowDuration)
+	}
+
+	result := &MaintenanceWindow{
+		anyDayOfMonth: fields[2] == "*",
+		anyDayOfWeek:  fields[4] == "*",
+		duration:      duration,
+		location:      location,
+	}
+
+	for _, field := range []struct {
+		value    string
+		min, max int
+		bits     *uint64
+	}{
+		{value: fields[0], min: 0, max: 59, bits: &result.minutes},
+		{value: fields[1], min: 0, max: 23, bits: &result.hours},
+		{value: fields[2], min: 1, max: 31, bits: &result.daysOfMonth},
+		{value: fields[3], min: 1, max: 12, bits: &result.months},
+		{value: fields[4], min: 0, max: 7, bits: &result.daysOfWeek},
+	} {
+		*field.bits, err = parseCronField(field.value, field.min, field.max)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// both 0 and 7 are Sunday.
+	if result.daysOfWeek&(1<<7) != 0 {
+		result.daysOfWeek |= 1
+	}
+
+	return result, nil
+}
+
+// parseCronField parses a comma separated list of values, ranges ('1-5'),
+// '*' and steps ('*/15', '10-50/20' or '5/15' starting at 5) to the set of
+// matching values.
+func parseCronField(field string, min, max int) (uint64, error) {
+	var bits uint64
+	for _, part := range strings.Split(field, ",") {
+		step := 1
+		stepped := false
+		if i := strings.Index(part, "/"); i >= 0 {
+			var err error
+			step, err = strconv.Atoi(part[i+1:])
+			if err != nil || step < 1 {
+				return 0, fmt.Errorf("invalid step in '%s'", part)
+			}
+			part = part[:i]
+			stepped = true
+		}
+
+		start, end := min, max
+		switch {
+		case part == "*":
+		case strings.Contains(part, "-"):
+			bounds := strings.SplitN(part, "-", 2)
+			var err error
+			start, err = strconv.Atoi(bounds[0])
+			if err != nil {
+				return 0, fmt.Errorf("invalid range '%s'", part)
+			}
+			end, err = strconv.Atoi(bounds[1])
+			if err != nil {
+				return 0, fmt.Errorf("invalid range '%s'", part)
+			}
+		default:
+			value, err := strconv.Atoi(part)
+			if err != nil {
+				return 0, fmt.Errorf("invalid value '%s'", part)
+			}
+			start, end = value, value
+			if stepped {
+				end = max
+			}
+		}
+
+		if start < min || end > max || start > end {
+			return 0, fmt.Errorf("'%s' is out of range %d-%d", part, min, max)
+		}
+
+		for value := start; value <= end; value += step {
+			bits |= 1 << uint(value)
+		}
+	}
+	return bits, nil
+}
+
+// starts returns true if the window starts at the minute of t.
+func (w *MaintenanceWindow) starts(t time.Time) bool {
+	t = t.In(w.location)
+
+	if w.minutes&(1<<uint(t.Minute())) == 0 || w.hours&(1<<uint(t.Hour())) == 0 || w.months&(1<<uint(t.Month())) == 0 {
+		return false
+	}
+
+	dayOfMonth := w.daysOfMonth&(1<<uint(t.Day())) != 0
+	dayOfWeek := w.daysOfWeek&(1<<uint(t.Weekday())) != 0
+	if w.anyDayOfMonth || w.anyDayOfWeek {
+		return dayOfMonth && dayOfWeek
+	}
+	return dayOfMonth || dayOfWeek
+}
+
+// Open returns true if the window is open at t i.e. it started within its
+// duration before t.
+func (w *MaintenanceWindow) Open(t time.Time) bool {
+	for start := t.Truncate(time.Minute); t.Sub(start) < w.duration; start = start.Add(-time.Minute) {
+		if w.starts(start) {
+			return true
+		}
+	}
+	return false
+}
+
+// Open returns true if any of the windows is open at t.
+func (w MaintenanceWindows) Open(t time.Time) bool {
+	for _, window := range w {
+		if window.Open(t) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,96 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestParseMaintenanceWindows(t *testing.T) {
+	for _, tc := range []struct {
+		windows  string
+		timezone string
+		count    int
+		success  bool
+	}{
+		{windows: "", count: 0, success: true},
+		{windows: "0 2 * * 1-5 4h", count: 1, success: true},
+		{windows: "0 2 * * 1-5 4h; */30 22 1,15 * * 30m;", timezone: "Europe/Berlin", count: 2, success: true},
+		{windows: "0 2 * * 7 1h", count: 1, success: true},
+		{windows: "0 2 * * 1-5", success: false},
+		{windows: "0 2 * * 1-5 4", success: false},
+		{windows: "0 2 * * 1-5 30s", success: false},
+		{windows: "0 2 * * 1-5 200h", success: false},
+		{windows: "60 2 * * * 1h", success: false},
+		{windows: "0 2 0 * * 1h", success: false},
+		{windows: "0 5-2 * * * 1h", success: false},
+		{windows: "*/0 2 * * * 1h", success: false},
+		{windows: "0 2 * * mon 1h", success: false},
+		{windows: "0 2 * * * 1h", timezone: "Mars/Olympus_Mons", success: false},
+	} {
+		t.Run(tc.windows, func(t *testing.T) {
+			windows, err := ParseMaintenanceWindows(tc.windows, tc.timezone)
+			if !tc.success {
+				if err == nil {
+					t.Errorf("expected an error")
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+			if len(windows) != tc.count {
+				t.Errorf("expected %d windows, got %d", tc.count, len(windows))
+			}
+		})
+	}
+}
+
+func TestMaintenanceWindowsOpen(t *testing.T) {
+	// 2018-03-05 is a Monday.
+	for _, tc := range []struct {
+		windows  string
+		timezone string
+		time     string
+		open     bool
+	}{
+		{windows: "0 2 * * 1-5 4h", time: "2018-03-05T02:00:00Z", open: true},
+		{windows: "0 2 * * 1-5 4h", time: "2018-03-05T05:59:59Z", open: true},
+		{windows: "0 2 * * 1-5 4h", time: "2018-03-05T06:00:00Z", open: false},
+		{windows: "0 2 * * 1-5 4h", time: "2018-03-05T01:59:00Z", open: false},
+		{windows: "0 2 * * 1-5 4h", time: "2018-03-04T03:00:00Z", open: false},
+		// windows may extend into the next day.
+		{windows: "0 22 * * 0 4h", time: "2018-03-05T01:00:00Z", open: true},
+		// Sunday is both 0 and 7.
+		{windows: "0 22 * * 7 4h", time: "2018-03-04T23:00:00Z", open: true},
+		{windows: "*/30 * * * * 10m", time: "2018-03-05T10:35:00Z", open: true},
+		{windows: "*/30 * * * * 10m", time: "2018-03-05T10:45:00Z", open: false},
+		{windows: "15/30 * * * * 10m", time: "2018-03-05T10:50:00Z", open: true},
+		{windows: "15/30 * * * * 10m", time: "2018-03-05T10:05:00Z", open: false},
+		// restricted days of month and week match either.
+		{windows: "0 0 1 * 1 1h", time: "2018-03-05T00:30:00Z", open: true},
+		{windows: "0 0 1 * 1 1h", time: "2018-03-01T00:30:00Z", open: true},
+		{windows: "0 0 1 * 1 1h", time: "2018-03-02T00:30:00Z", open: false},
+		{windows: "0 0 1 * * 1h", time: "2018-03-05T00:30:00Z", open: false},
+		{windows: "0 0 * 4 * 1h", time: "2018-03-05T00:30:00Z", open: false},
+		{windows: "0 2 * * 1-5 1h", timezone: "Europe/Berlin", time: "2018-03-05T01:30:00Z", open: true},
+		{windows: "0 2 * * 1-5 1h", timezone: "Europe/Berlin", time: "2018-03-05T02:30:00Z", open: false},
+		{windows: "0 2 * * 6 1h; 0 2 * * 1 1h", time: "2018-03-05T02:30:00Z", open: true},
+		{windows: "", time: "2018-03-05T02:30:00Z", open: false},
+	} {
+		t.Run(tc.windows+" "+tc.time, func(t *testing.T) {
+			windows, err := ParseMaintenanceWindows(tc.windows, tc.timezone)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			now, err := time.Parse(time.RFC3339, tc.time)
+			if err != nil {
+				t.Fatalf("unexpected error: %v", err)
+			}
+
+			if open := windows.Open(now); open != tc.open {
+				t.Errorf("expected open to be %t, got %t", tc.open, open)
+			}
+		})
+	}
+}
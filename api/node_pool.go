@@ -10,6 +10,206 @@ type NodePool struct {
 	Profile          string `json:"profile"           yaml:"profile"`
 	MinSize          int64  `json:"min_size"          yaml:"min_size"`
 	MaxSize          int64  `json:"max_size"          yaml:"max_size"`
+	RequireIMDSv2    bool   `json:"require_imdsv2"    yaml:"require_imdsv2"`
+	IMDSHopLimit     int64  `json:"imds_hop_limit"    yaml:"imds_hop_limit"`
+	Architecture     string `json:"architecture"      yaml:"architecture"`
+	// OS is the operating system of the nodes: 'linux' (default) or
+	// 'windows'. Windows nodes are configured by a PowerShell script
+	// instead of ignition and can only run worker node pools.
+	OS string `json:"os" yaml:"os"`
+	// Labels are the Kubernetes labels of the nodes.
+	Labels map[string]string `json:"labels" yaml:"labels"`
+	// Taints are the Kubernetes taints of the nodes by key defined as
+	// value:effect or just effect e.g. 'dedicated: teapot:NoSchedule'.
+	Taints map[string]string `json:"taints" yaml:"taints"`
+	// ScalingSchedules change the size of the node pool at recurring
+	// times, e.g. to scale down outside business hours.
+	ScalingSchedules []*ScalingSchedule `json:"scaling_schedules" yaml:"scaling_schedules"`
+	// UpdateSurge is the number of nodes, e.g. '2', or the percentage of
+	// the desired nodes, e.g. '25%', added to the node pool before old
+	// nodes are replaced during an update.
+	UpdateSurge string `json:"update_surge" yaml:"update_surge"`
+	// UpdateCanary is the number of nodes, e.g. '1', or the percentage of
+	// the desired nodes, e.g. '10%', replaced first during an update. The
+	// update only continues once the canary nodes stayed healthy for the
+	// soak period.
+	UpdateCanary string `json:"update_canary" yaml:"update_canary"`
+	// UpdateMaxUnavailable is the number of nodes, e.g. '1', or the
+	// percentage of the desired nodes, e.g. '10%', drained at the same
+	// time during an update. It overrides the limit of the cluster.
+	UpdateMaxUnavailable string `json:"update_max_unavailable" yaml:"update_max_unavailable"`
+	// UpdateMode is how the nodes are replaced during an update:
+	// 'rolling' (default) replaces them batch by batch, 'blue-green'
+	// first launches a new node for every old one and only drains the
+	// old nodes once all new nodes are ready.
+	UpdateMode string `json:"update_mode" yaml:"update_mode"`
+	// UpdateStrategy overrides the update strategy of the cluster for the
+	// node pool: 'rolling', 'blue-green' (rolling in the blue/green update
+	// mode) or 'instance-refresh'.
+	UpdateStrategy string `json:"update_strategy" yaml:"update_strategy"`
+	// DecommissionProtection prevents the node pool from being
+	// decommissioned, also when it's removed from the cluster by mistake.
+	// It has to be disabled before the node pool can be removed.
+	DecommissionProtection bool `json:"decommission_protection" yaml:"decommission_protection"`
+	// ScaleDownProtection is the maximum time, e.g. '12h', the replacement
+	// of nodes running pods of Jobs is deferred during an update, such
+	// that long-running batch jobs can finish.
+	ScaleDownProtection string `json:"scale_down_protection" yaml:"scale_down_protection"`
+	// RootVolumeType is the EBS volume type of the root volume of the
+	// nodes, e.g. 'gp3'. The default of the profile is used if empty.
+	RootVolumeType string `json:"root_volume_type" yaml:"root_volume_type"`
+	// RootVolumeSize is the size of the root volume in GiB, the default
+	// of the profile is used if 0.
+	RootVolumeSize int64 `json:"root_volume_size" yaml:"root_volume_size"`
+	// RootVolumeIOPS are the provisioned IOPS of io1, io2 and gp3 root
+	// volumes.
+	RootVolumeIOPS int64 `json:"root_volume_iops" yaml:"root_volume_iops"`
+	// RootVolumeEncrypted encrypts the root volume with the default EBS
+	// key of the account, unless RootVolumeKMSKey is set.
+	RootVolumeEncrypted bool `json:"root_volume_encrypted" yaml:"root_volume_encrypted"`
+	// RootVolumeKMSKey is the ID or ARN of the KMS key encrypting the root
+	// volume. It implies RootVolumeEncrypted.
+	RootVolumeKMSKey string `json:"root_volume_kms_key" yaml:"root_volume_kms_key"`
+	// AvailabilityZones pin the nodes to the subnets in these availability
+	// zones, e.g. 'eu-central-1a'. The node pool spans all subnets of the
+	// cluster if empty.
+	AvailabilityZones []string `json:"availability_zones" yaml:"availability_zones"`
+	// SubnetTags pin the nodes to the subnets having all of these tags.
+	// It can be combined with AvailabilityZones.
+	SubnetTags map[string]string `json:"subnet_tags" yaml:"subnet_tags"`
+	// WarmPool keeps pre-initialized instances next to the node pool,
+	// such that it scales up faster.
+	WarmPool *WarmPool `json:"warm_pool" yaml:"warm_pool"`
+	// AdoptASGs are the names of existing ASGs, e.g. created manually or
+	// by another tool, brought under the node pool. Their nodes are
+	// replaced by the nodes of the node pool like outdated nodes.
+	AdoptASGs []string `json:"adopt_asgs" yaml:"adopt_asgs"`
+	// PreviousName is the name of the node pool before it was renamed.
+	// The node pool keeps the ASG of the previous node pool and replaces
+	// its nodes instead of decommissioning it.
+	PreviousName string `json:"previous_name" yaml:"previous_name"`
+	// CapacityReservationID is the ID of an On-Demand Capacity
+	// Reservation the nodes are launched into, such that the node pool
+	// can scale up during capacity shortages of its availability zone.
+	CapacityReservationID string `json:"capacity_reservation_id" yaml:"capacity_reservation_id"`
+	// CapacityReservationGroupARN is the ARN of a resource group of
+	// capacity reservations the nodes are launched into. It can't be
+	// combined with CapacityReservationID.
+	CapacityReservationGroupARN string `json:"capacity_reservation_group_arn" yaml:"capacity_reservation_group_arn"`
+	// Tenancy is the tenancy of the instances of the node pool: 'default',
+	// 'dedicated' for dedicated instances or 'host' for dedicated hosts.
+	Tenancy string `json:"tenancy" yaml:"tenancy"`
+	// HostResourceGroupARN is the ARN of a host resource group the
+	// instances are launched into. It requires the 'host' tenancy.
+	HostResourceGroupARN string `json:"host_resource_group_arn" yaml:"host_resource_group_arn"`
+	// Tags are added to the ASG of the node pool and propagated to its
+	// instances, e.g. to attribute costs to a team.
+	Tags map[string]string `json:"tags" yaml:"tags"`
+	// LifecycleHooks pause the launch or termination of the instances of
+	// the node pool and notify a target, e.g. such that node shutdown
+	// tooling can flush logs before an instance is terminated.
+	LifecycleHooks []*LifecycleHook `json:"lifecycle_hooks" yaml:"lifecycle_hooks"`
+	// Image selects the AMI of the nodes when the node pool is
+	// provisioned, instead of the AMI of the stack template.
+	Image *Image `json:"image" yaml:"image"`
+	// Storage configures the sticky EBS volumes or the instance store of
+	// the nodes of stateful node pools.
+	Storage *NodeStorage `json:"storage" yaml:"storage"`
+	// KubeletConfig overrides settings of the kubelet config of the nodes.
+	KubeletConfig *KubeletConfig `json:"kubelet_config" yaml:"kubelet_config"`
+	// Monitoring enables the collection of additional metrics of the node
+	// pool, e.g. for capacity planning.
+	Monitoring *NodePoolMonitoring `json:"monitoring" yaml:"monitoring"`
+}
+
+// ScalingSchedule sets the size of a node pool at the times defined by the
+// recurrence, a cron expression in UTC.
+type ScalingSchedule struct {
+	Name            string `json:"name"             yaml:"name"`
+	Recurrence      string `json:"recurrence"       yaml:"recurrence"`
+	MinSize         int64  `json:"min_size"         yaml:"min_size"`
+	MaxSize         int64  `json:"max_size"         yaml:"max_size"`
+	DesiredCapacity int64  `json:"desired_capacity" yaml:"desired_capacity"`
+}
+
+// WarmPool defines the warm pool of a node pool: the instances launched and
+// initialized ahead of a scale up, which are kept in the State 'Stopped',
+// 'Running' or 'Hibernated'. At least MinSize instances are kept warm and at
+// most MaxPreparedCapacity instances are prepared, including the instances of
+// the node pool. If ReuseOnScaleIn is true, instances are returned to the
+// warm pool on scale in instead of being terminated.
+type WarmPool struct {
+	MinSize             int64  `json:"min_size"              yaml:"min_size"`
+	MaxPreparedCapacity int64  `json:"max_prepared_capacity" yaml:"max_prepared_capacity"`
+	State               string `json:"state"                 yaml:"state"`
+	ReuseOnScaleIn      bool   `json:"reuse_on_scale_in"     yaml:"reuse_on_scale_in"`
+}
+
+// Image defines how the AMI of a node pool is resolved: from the SSM
+// parameter SSMParameter, e.g. a public parameter of the OS vendor, or as the
+// most recent AMI of the Owner whose name matches the Name pattern, e.g.
+// 'flatcar-stable-*', and which has the Architecture, by default the one of
+// the node pool.
+type Image struct {
+	SSMParameter string `json:"ssm_parameter" yaml:"ssm_parameter"`
+	Owner        string `json:"owner"         yaml:"owner"`
+	Name         string `json:"name"          yaml:"name"`
+	Architecture string `json:"architecture"  yaml:"architecture"`
+}
+
+// NodeStorage defines the storage of the nodes of a stateful node pool. With
+// StickyVolumes every node attaches an available EBS volume of its
+// availability zone tagged as sticky volume of the node pool as Device, e.g.
+// '/dev/xvdf', and the volume of a node replaced during an update is moved
+// to its replacement. With InstanceStoreRAID the instance store volumes of
+// the nodes are combined into a RAID 0 array instead. The volume or array is
+// formatted with the Filesystem, e.g. 'ext4' or 'xfs', unless it's formatted
+// already, and mounted at MountPath.
+type NodeStorage struct {
+	StickyVolumes     bool   `json:"sticky_volumes"      yaml:"sticky_volumes"`
+	Device            string `json:"device"              yaml:"device"`
+	InstanceStoreRAID bool   `json:"instance_store_raid" yaml:"instance_store_raid"`
+	Filesystem        string `json:"filesystem"          yaml:"filesystem"`
+	MountPath         string `json:"mount_path"          yaml:"mount_path"`
+}
+
+// KubeletConfig defines the kubelet settings of the nodes of a node pool:
+// MaxPods is the maximum number of pods per node, EvictionHard the hard
+// eviction thresholds by eviction signal, e.g. 'memory.available: 500Mi', and
+// KubeReserved and SystemReserved the resources reserved for the Kubernetes
+// and system daemons, e.g. 'cpu: 100m'. Unset settings keep the values of the
+// kubelet config of the profile.
+type KubeletConfig struct {
+	MaxPods        int64             `json:"max_pods"        yaml:"max_pods"`
+	EvictionHard   map[string]string `json:"eviction_hard"   yaml:"eviction_hard"`
+	KubeReserved   map[string]string `json:"kube_reserved"   yaml:"kube_reserved"`
+	SystemReserved map[string]string `json:"system_reserved" yaml:"system_reserved"`
+}
+
+// NodePoolMonitoring defines the metrics collected for a node pool:
+// ASGMetrics enables the CloudWatch group metrics of its ASG and
+// DetailedMonitoring the 1 minute EC2 metrics of its instances. If
+// CloudWatchAgentConfig is set, it's written to the nodes as the JSON config
+// of the CloudWatch agent.
+type NodePoolMonitoring struct {
+	ASGMetrics            bool   `json:"asg_metrics"             yaml:"asg_metrics"`
+	DetailedMonitoring    bool   `json:"detailed_monitoring"     yaml:"detailed_monitoring"`
+	CloudWatchAgentConfig string `json:"cloudwatch_agent_config" yaml:"cloudwatch_agent_config"`
+}
+
+// LifecycleHook defines a lifecycle hook of the ASG of a node pool. Instances
+// wait in the Transition 'launch' or 'terminate' until the hook is completed
+// or the HeartbeatTimeout in seconds passed, then the DefaultResult
+// 'CONTINUE' or 'ABANDON' applies. The notifications of the hook are sent to
+// the SNS topic or SQS queue NotificationTargetARN using the IAM role
+// RoleARN.
+type LifecycleHook struct {
+	Name                  string `json:"name"                    yaml:"name"`
+	Transition            string `json:"transition"              yaml:"transition"`
+	HeartbeatTimeout      int64  `json:"heartbeat_timeout"       yaml:"heartbeat_timeout"`
+	DefaultResult         string `json:"default_result"          yaml:"default_result"`
+	NotificationTargetARN string `json:"notification_target_arn" yaml:"notification_target_arn"`
+	RoleARN               string `json:"role_arn"                yaml:"role_arn"`
 }
 
 // NodePools is a slice of *NodePool which implements the sort interface to
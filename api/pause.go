@@ -0,0 +1,28 @@
+package api
+
+import "context"
+
+// UpdatePausedConfigItem is the config item pausing the node pool updates of
+// a cluster if set to "true".
+const UpdatePausedConfigItem = "update_paused"
+
+// PauseFunc returns true if the updates of a cluster are paused.
+type PauseFunc func() (bool, error)
+
+type pauseKey struct{}
+
+// WithPauseCheck returns a context whose operations check fn to find out if
+// they are paused.
+func WithPauseCheck(ctx context.Context, fn PauseFunc) context.Context {
+	return context.WithValue(ctx, pauseKey{}, fn)
+}
+
+// UpdatesPaused returns true if the updates of the operation of ctx are
+// paused. Operations of contexts without a pause check are never paused.
+func UpdatesPaused(ctx context.Context) (bool, error) {
+	fn, ok := ctx.Value(pauseKey{}).(PauseFunc)
+	if !ok || fn == nil {
+		return false, nil
+	}
+	return fn()
+}
@@ -0,0 +1,26 @@
+package api
+
+import (
+	"context"
+	"errors"
+	"testing"
+)
+
+func TestUpdatesPaused(t *testing.T) {
+	paused, err := UpdatesPaused(context.Background())
+	if err != nil || paused {
+		t.Errorf("expected contexts without a pause check not to be paused, got %t: %v", paused, err)
+	}
+
+	ctx := WithPauseCheck(context.Background(), func() (bool, error) { return true, nil })
+	paused, err = UpdatesPaused(ctx)
+	if err != nil || !paused {
+		t.Errorf("expected the updates to be paused, got %t: %v", paused, err)
+	}
+
+	ctx = WithPauseCheck(context.Background(), func() (bool, error) { return false, errors.New("failed") })
+	_, err = UpdatesPaused(ctx)
+	if err == nil {
+		t.Errorf("expected the error of the pause check")
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"context"
+	"fmt"
+	"time"
+)
+
+// Steps of provisioning a cluster reported as progress.
+const (
+	ProgressStepRendering            = "rendering"
+	ProgressStepStackUpdate          = "stack-update"
+	ProgressStepWaitingForAPIServer  = "waiting-for-api-server"
+	ProgressStepNodePoolUpdate       = "node-pool-update"
+	ProgressStepWaitingForNodesReady = "waiting-for-nodes-ready"
+	ProgressStepCanarySoak           = "canary-soak"
+	ProgressStepPaused               = "paused"
+	ProgressStepApplyingManifests    = "applying-manifests"
+	ProgressStepSmokeTests           = "smoke-tests"
+)
+
+// Steps of decommissioning a cluster reported as progress, in the order
+// they're run.
+const (
+	ProgressStepScalingDownWorkloads  = "scaling-down-workloads"
+	ProgressStepDeletingLoadBalancers = "deleting-load-balancers"
+	ProgressStepDeletingStacks        = "deleting-stacks"
+	ProgressStepCleaningUp            = "cleaning-up"
+)
+
+// Progress describes the step a cluster provisioning is currently at.
+// NodesReplaced and NodesTotal are only set for the rollout of a node pool.
+type Progress struct {
+	Step          string    `json:"step"                     yaml:"step"`
+	NodePool      string    `json:"node_pool"                yaml:"node_pool"`
+	Message       string    `json:"message"                  yaml:"message"`
+	StartedAt     time.Time `json:"started_at"               yaml:"started_at"`
+	NodesReplaced int       `json:"nodes_replaced,omitempty" yaml:"nodes_replaced,omitempty"`
+	NodesTotal    int       `json:"nodes_total,omitempty"    yaml:"nodes_total,omitempty"`
+}
+
+// ProgressFunc is called with every step of a cluster provisioning.
+type ProgressFunc func(progress *Progress)
+
+type progressKey struct{}
+
+// WithProgress returns a context reporting the progress of the operations
+// it's passed to to fn.
+func WithProgress(ctx context.Context, fn ProgressFunc) context.Context {
+	return context.WithValue(ctx, progressKey{}, fn)
+}
+
+// ReportProgress reports that the operation of ctx started a new step. It's a
+// no-op if the context doesn't report progress.
+func ReportProgress(ctx context.Context, step, nodePool, message string) {
+	fn, ok := ctx.Value(progressKey{}).(ProgressFunc)
+	if !ok || fn == nil {
+		return
+	}
+
+	fn(&Progress{
+		Step:      step,
+		NodePool:  nodePool,
+		Message:   message,
+		StartedAt: time.Now().UTC(),
+	})
+}
+
+// ReportRolloutProgress reports the number of nodes of a node pool replaced
+// so far by the operation of ctx. It's a no-op if the context doesn't report
+// progress.
+func ReportRolloutProgress(ctx context.Context, nodePool string, replaced, total int) {
+	fn, ok := ctx.Value(progressKey{}).(ProgressFunc)
+	if !ok || fn == nil {
+		return
+	}
+
+	fn(&Progress{
+		Step:          ProgressStepNodePoolUpdate,
+		NodePool:      nodePool,
+		Message:       fmt.Sprintf("Replaced %d of %d nodes of node pool %s", replaced, total, nodePool),
+		StartedAt:     time.Now().UTC(),
+		NodesReplaced: replaced,
+		NodesTotal:    total,
+	})
+}
@@ -0,0 +1,55 @@
+package api
+
+import (
+	"context"
+	"testing"
+)
+
+func TestReportProgress(t *testing.T) {
+	// contexts without a progress func are ignored.
+	ReportProgress(context.Background(), ProgressStepRendering, "pool-1", "Rendering")
+
+	var reported []*Progress
+	ctx := WithProgress(context.Background(), func(progress *Progress) {
+		reported = append(reported, progress)
+	})
+
+	ReportProgress(ctx, ProgressStepRendering, "pool-1", "Rendering userdata of node pool pool-1")
+	ReportProgress(ctx, ProgressStepApplyingManifests, "", "Applying manifests")
+
+	if len(reported) != 2 {
+		t.Fatalf("expected 2 steps, got %d", len(reported))
+	}
+
+	first := reported[0]
+	if first.Step != ProgressStepRendering || first.NodePool != "pool-1" || first.StartedAt.IsZero() {
+		t.Errorf("unexpected progress %v", first)
+	}
+
+	if reported[1].Step != ProgressStepApplyingManifests {
+		t.Errorf("expected step %s, got %s", ProgressStepApplyingManifests, reported[1].Step)
+	}
+}
+
+func TestReportRolloutProgress(t *testing.T) {
+	// contexts without a progress func are ignored.
+	ReportRolloutProgress(context.Background(), "pool-1", 1, 3)
+
+	var reported *Progress
+	ctx := WithProgress(context.Background(), func(progress *Progress) {
+		reported = progress
+	})
+
+	ReportRolloutProgress(ctx, "pool-1", 2, 5)
+	if reported == nil {
+		t.Fatalf("expected the rollout progress to be reported")
+	}
+
+	if reported.Step != ProgressStepNodePoolUpdate || reported.NodePool != "pool-1" || reported.NodesReplaced != 2 || reported.NodesTotal != 5 {
+		t.Errorf("unexpected progress %v", reported)
+	}
+
+	if reported.Message != "Replaced 2 of 5 nodes of node pool pool-1" {
+		t.Errorf("unexpected message %q", reported.Message)
+	}
+}
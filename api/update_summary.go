@@ -0,0 +1,297 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+// Outcomes of an update and of its node pools.
+const (
+	UpdateOutcomeSucceeded = "succeeded"
+	UpdateOutcomeFailed    = "failed"
+	// UpdateOutcomeIncomplete is the outcome of node pool updates
+	// continuing in a later update, because they were time-sliced or
+	// paused.
+	UpdateOutcomeIncomplete = "incomplete"
+	UpdateOutcomeSkipped    = "skipped"
+)
+
+// UpdateSummary records what happened during the provisioning of a cluster:
+// the outcome of every node pool, the time it took, the retries and the
+// warnings logged on the way. It's reported in the status of the cluster
+// next to the problems of a failed update.
+type UpdateSummary struct {
+	mutex sync.Mutex
+
+	Outcome    string    `json:"outcome"     yaml:"outcome"`
+	Error      string    `json:"error"       yaml:"error"`
+	StartedAt  time.Time `json:"started_at"  yaml:"started_at"`
+	FinishedAt time.Time `json:"finished_at" yaml:"finished_at"`
+	// DurationSeconds is the time between start and finish of the
+	// update.
+	DurationSeconds float64 `json:"duration_seconds" yaml:"duration_seconds"`
+	// AWSRetries is the number of AWS API calls retried because they
+	// were throttled.
+	AWSRetries int                `json:"aws_retries" yaml:"aws_retries"`
+	NodePools  []*NodePoolSummary `json:"node_pools"  yaml:"node_pools"`
+	Warnings   []string           `json:"warnings"    yaml:"warnings"`
+	// SmokeTests are the outcomes of the smoke tests run after the
+	// update.
+	SmokeTests []*SmokeTestSummary `json:"smoke_tests" yaml:"smoke_tests"`
+}
+
+// NodePoolSummary records the outcome of the update of a single node pool.
+type NodePoolSummary struct {
+	Name    string `json:"name"    yaml:"name"`
+	Outcome string `json:"outcome" yaml:"outcome"`
+	// Reason explains why a node pool was skipped.
+	Reason string `json:"reason" yaml:"reason"`
+	Error  string `json:"error"  yaml:"error"`
+	// ErrorCategory classifies the error of a failed or incomplete node
+	// pool.
+	ErrorCategory   string    `json:"error_category"   yaml:"error_category"`
+	StartedAt       time.Time `json:"started_at"       yaml:"started_at"`
+	DurationSeconds float64   `json:"duration_seconds" yaml:"duration_seconds"`
+	// Retries is the number of updates in a row, before this one, in
+	// which the node pool failed or was incomplete.
+	Retries int `json:"retries" yaml:"retries"`
+	// QuarantinedNodes are the nodes which couldn't be drained and were
+	// left out of the update, sorted by name.
+	QuarantinedNodes []string `json:"quarantined_nodes,omitempty" yaml:"quarantined_nodes,omitempty"`
+}
+
+// SmokeTestSummary records the outcome of a smoke test run after the update
+// of a cluster.
+type SmokeTestSummary struct {
+	Name            string  `json:"name"             yaml:"name"`
+	Outcome         string  `json:"outcome"          yaml:"outcome"`
+	Error           string  `json:"error"            yaml:"error"`
+	DurationSeconds float64 `json:"duration_seconds" yaml:"duration_seconds"`
+}
+
+// NewUpdateSummary starts the summary of an update. The outcomes of the node
+// pools in the previous summary are used to count their retries.
+func NewUpdateSummary(previous *UpdateSummary) *UpdateSummary {
+	summary := &UpdateSummary{
+		StartedAt:  time.Now().UTC(),
+		NodePools:  []*NodePoolSummary{},
+		Warnings:   []string{},
+		SmokeTests: []*SmokeTestSummary{},
+	}
+
+	if previous != nil {
+		for _, nodePool := range previous.NodePools {
+			if nodePool.Outcome != UpdateOutcomeFailed && nodePool.Outcome != UpdateOutcomeIncomplete {
+				continue
+			}
+			summary.NodePools = append(summary.NodePools, &NodePoolSummary{
+				Name:    nodePool.Name,
+				Retries: nodePool.Retries + 1,
+			})
+		}
+	}
+	return summary
+}
+
+// nodePool returns the summary of the named node pool, adding it if
+// necessary. The caller must hold the mutex.
+func (s *UpdateSummary) nodePool(name string) *NodePoolSummary {
+	for _, nodePool := range s.NodePools {
+		if nodePool.Name == name {
+			return nodePool
+		}
+	}
+
+	nodePool := &NodePoolSummary{Name: name}
+	s.NodePools = append(s.NodePools, nodePool)
+	return nodePool
+}
+
+// StartNodePool records the start of the update of a node pool.
+func (s *UpdateSummary) StartNodePool(name string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.nodePool(name).StartedAt = time.Now().UTC()
+}
+
+// FinishNodePool records the outcome of the update of a node pool. The error
+// and its category are only recorded for failed or incomplete updates.
+func (s *UpdateSummary) FinishNodePool(name, outcome string, err error, category string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	nodePool := s.nodePool(name)
+	nodePool.Outcome = outcome
+	if !nodePool.StartedAt.IsZero() {
+		nodePool.DurationSeconds = time.Since(nodePool.StartedAt).Seconds()
+	}
+	if err != nil {
+		nodePool.Error = err.Error()
+		nodePool.ErrorCategory = category
+	}
+	if outcome == UpdateOutcomeSucceeded {
+		nodePool.Retries = 0
+	}
+}
+
+// SkipNodePool records that a node pool wasn't updated and why.
+func (s *UpdateSummary) SkipNodePool(name, reason string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	nodePool := s.nodePool(name)
+	nodePool.Outcome = UpdateOutcomeSkipped
+	nodePool.Reason = reason
+}
+
+// AddWarning records a warning logged during the update.
+func (s *UpdateSummary) AddWarning(format string, args ...interface{}) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.Warnings = append(s.Warnings, fmt.Sprintf(format, args...))
+}
+
+// AddQuarantinedNodes records nodes of a node pool which couldn't be drained
+// and were left out of the update.
+func (s *UpdateSummary) AddQuarantinedNodes(nodePool string, nodes ...string) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	summary := s.nodePool(nodePool)
+	for _, node := range nodes {
+		known := false
+		for _, existing := range summary.QuarantinedNodes {
+			if existing == node {
+				known = true
+				break
+			}
+		}
+		if !known {
+			summary.QuarantinedNodes = append(summary.QuarantinedNodes, node)
+		}
+	}
+	sort.Strings(summary.QuarantinedNodes)
+}
+
+// QuarantinedNodes returns the quarantined nodes of a node pool.
+func (s *UpdateSummary) QuarantinedNodes(nodePool string) []string {
+	if s == nil {
+		return nil
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	for _, summary := range s.NodePools {
+		if summary.Name == nodePool {
+			return append([]string(nil), summary.QuarantinedNodes...)
+		}
+	}
+	return nil
+}
+
+// AddSmokeTest records the outcome of a smoke test which ran for duration.
+func (s *UpdateSummary) AddSmokeTest(name string, duration time.Duration, err error) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	smokeTest := &SmokeTestSummary{
+		Name:            name,
+		Outcome:         UpdateOutcomeSucceeded,
+		DurationSeconds: duration.Seconds(),
+	}
+	if err != nil {
+		smokeTest.Outcome = UpdateOutcomeFailed
+		smokeTest.Error = err.Error()
+	}
+	s.SmokeTests = append(s.SmokeTests, smokeTest)
+}
+
+// AddAWSRetry counts an AWS API call retried because it was throttled.
+func (s *UpdateSummary) AddAWSRetry() {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	s.AWSRetries++
+}
+
+// Finish records the outcome of the update. Node pools whose outcome isn't
+// known, e.g. because the update failed before reaching them, are dropped.
+// Finishing a summary again doesn't change it.
+func (s *UpdateSummary) Finish(err error) {
+	if s == nil {
+		return
+	}
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	if !s.FinishedAt.IsZero() {
+		return
+	}
+
+	s.FinishedAt = time.Now().UTC()
+	s.DurationSeconds = s.FinishedAt.Sub(s.StartedAt).Seconds()
+	s.Outcome = UpdateOutcomeSucceeded
+	if err != nil {
+		s.Outcome = UpdateOutcomeFailed
+		s.Error = err.Error()
+	}
+
+	nodePools := make([]*NodePoolSummary, 0, len(s.NodePools))
+	for _, nodePool := range s.NodePools {
+		if nodePool.Outcome != "" {
+			nodePools = append(nodePools, nodePool)
+		}
+	}
+	s.NodePools = nodePools
+}
+
+// JSON returns the summary encoded as JSON.
+func (s *UpdateSummary) JSON() ([]byte, error) {
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	return json.Marshal(s)
+}
+
+type updateSummaryKey struct{}
+
+// WithUpdateSummary returns a context recording the update of the operations
+// it's passed to in summary.
+func WithUpdateSummary(ctx context.Context, summary *UpdateSummary) context.Context {
+	return context.WithValue(ctx, updateSummaryKey{}, summary)
+}
+
+// UpdateSummaryFromContext returns the summary recording the update of the
+// operation of ctx. The result is nil if the update isn't recorded, which
+// is safe to call all methods of the summary on.
+func UpdateSummaryFromContext(ctx context.Context) *UpdateSummary {
+	summary, _ := ctx.Value(updateSummaryKey{}).(*UpdateSummary)
+	return summary
+}
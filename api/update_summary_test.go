@@ -0,0 +1,108 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+func TestUpdateSummary(t *testing.T) {
+	// summaries missing from the context are ignored.
+	UpdateSummaryFromContext(context.Background()).StartNodePool("pool-1")
+
+	previous := &UpdateSummary{
+		NodePools: []*NodePoolSummary{
+			{Name: "pool-1", Outcome: UpdateOutcomeFailed, Retries: 1},
+			{Name: "pool-2", Outcome: UpdateOutcomeSucceeded},
+			{Name: "pool-3", Outcome: UpdateOutcomeIncomplete},
+			{Name: "removed", Outcome: UpdateOutcomeFailed},
+		},
+	}
+
+	ctx := WithUpdateSummary(context.Background(), NewUpdateSummary(previous))
+	summary := UpdateSummaryFromContext(ctx)
+
+	summary.StartNodePool("pool-1")
+	summary.FinishNodePool("pool-1", UpdateOutcomeFailed, errors.New("nodes not ready"), "bootstrap")
+	summary.StartNodePool("pool-2")
+	summary.FinishNodePool("pool-2", UpdateOutcomeSucceeded, nil, "")
+	summary.StartNodePool("pool-3")
+	summary.FinishNodePool("pool-3", UpdateOutcomeSucceeded, nil, "")
+	summary.SkipNodePool("pool-4", "apply only")
+	summary.AddWarning("Stack %s drifted", "kube-1")
+	summary.AddAWSRetry()
+	summary.AddSmokeTest("dns", 0, nil)
+	summary.AddSmokeTest("networking", 0, errors.New("job timed out"))
+	summary.Finish(errors.New("node pool pool-1 failed"))
+
+	// finishing again doesn't change the outcome.
+	summary.Finish(nil)
+
+	if summary.Outcome != UpdateOutcomeFailed || summary.Error != "node pool pool-1 failed" || summary.FinishedAt.IsZero() {
+		t.Errorf("unexpected outcome %s: %s", summary.Outcome, summary.Error)
+	}
+
+	expected := map[string]NodePoolSummary{
+		"pool-1": {Outcome: UpdateOutcomeFailed, Error: "nodes not ready", ErrorCategory: "bootstrap", Retries: 2},
+		"pool-2": {Outcome: UpdateOutcomeSucceeded},
+		"pool-3": {Outcome: UpdateOutcomeSucceeded},
+		"pool-4": {Outcome: UpdateOutcomeSkipped, Reason: "apply only"},
+	}
+	if len(summary.NodePools) != len(expected) {
+		t.Fatalf("expected %d node pools, got %d", len(expected), len(summary.NodePools))
+	}
+	for _, nodePool := range summary.NodePools {
+		e, ok := expected[nodePool.Name]
+		if !ok {
+			t.Errorf("unexpected node pool %s", nodePool.Name)
+			continue
+		}
+		if nodePool.Outcome != e.Outcome || nodePool.Error != e.Error || nodePool.ErrorCategory != e.ErrorCategory || nodePool.Reason != e.Reason || nodePool.Retries != e.Retries {
+			t.Errorf("unexpected summary of node pool %s: %+v", nodePool.Name, nodePool)
+		}
+	}
+
+	if len(summary.Warnings) != 1 || summary.Warnings[0] != "Stack kube-1 drifted" {
+		t.Errorf("unexpected warnings %v", summary.Warnings)
+	}
+	if summary.AWSRetries != 1 {
+		t.Errorf("expected 1 AWS retry, got %d", summary.AWSRetries)
+	}
+	if len(summary.SmokeTests) != 2 || summary.SmokeTests[0].Outcome != UpdateOutcomeSucceeded || summary.SmokeTests[1].Outcome != UpdateOutcomeFailed || summary.SmokeTests[1].Error != "job timed out" {
+		t.Errorf("unexpected smoke tests %+v", summary.SmokeTests)
+	}
+
+	data, err := summary.JSON()
+	if err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+	var decoded UpdateSummary
+	err = json.Unmarshal(data, &decoded)
+	if err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+	if decoded.Outcome != UpdateOutcomeFailed || len(decoded.NodePools) != 4 {
+		t.Errorf("unexpected decoded summary %s", data)
+	}
+}
+
+func TestUpdateSummaryQuarantinedNodes(t *testing.T) {
+	var missing *UpdateSummary
+	missing.AddQuarantinedNodes("pool-1", "node-1")
+	if nodes := missing.QuarantinedNodes("pool-1"); nodes != nil {
+		t.Errorf("expected no quarantined nodes, got %v", nodes)
+	}
+
+	summary := NewUpdateSummary(nil)
+	summary.AddQuarantinedNodes("pool-1", "node-2")
+	summary.AddQuarantinedNodes("pool-1", "node-1", "node-2")
+
+	nodes := summary.QuarantinedNodes("pool-1")
+	if len(nodes) != 2 || nodes[0] != "node-1" || nodes[1] != "node-2" {
+		t.Errorf("unexpected quarantined nodes %v", nodes)
+	}
+	if nodes := summary.QuarantinedNodes("pool-2"); len(nodes) != 0 {
+		t.Errorf("expected no quarantined nodes in pool-2, got %v", nodes)
+	}
+}
@@ -0,0 +1,122 @@
+package channel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/coreos/go-semver/semver"
+	"gopkg.in/yaml.v2"
+)
+
+// compatibilityFile is the file in the root of a channel declaring the CLM
+// versions able to apply the channel.
+const compatibilityFile = "clm.yaml"
+
+// compatibility defines the range of CLM versions a channel is compatible
+// with. Both bounds are inclusive and optional.
+type compatibility struct {
+	MinVersion string `yaml:"min_version"`
+	MaxVersion string `yaml:"max_version"`
+}
+
+// IncompatibleVersionError is returned when the running CLM version is outside
+// of the range of versions supported by a channel.
+type IncompatibleVersionError struct {
+	Channel    string
+	Version    string
+	Constraint string
+	Hint       string
+}
+
+func (e *IncompatibleVersionError) Error() string {
+	return fmt.Sprintf("channel %s requires CLM version %s, running %s: %s", e.Channel, e.Constraint, e.Version, e.Hint)
+}
+
+// CheckCompatibility verifies that the CLM version is within the range of
+// versions declared by the channel in clm.yaml. Channels without clm.yaml are
+// compatible with every version. Development builds whose version isn't a
+// semantic version (e.g. "unknown" or a commit hash) are not checked.
+func (c *Config) CheckCompatibility(clmVersion string) error {
+	data, err := ioutil.ReadFile(path.Join(c.Path, compatibilityFile))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil
+		}
+		return err
+	}
+
+	var compat compatibility
+	err = yaml.Unmarshal(data, &compat)
+	if err != nil {
+		return fmt.Errorf("invalid %s in channel %s: %v", compatibilityFile, c.Version, err)
+	}
+
+	current, err := parseVersion(clmVersion)
+	if err != nil {
+		return nil
+	}
+
+	if compat.MinVersion != "" {
+		min, err := parseVersion(compat.MinVersion)
+		if err != nil {
+			return fmt.Errorf("invalid min_version '%s' in channel %s", compat.MinVersion, c.Version)
+		}
+
+		if current.LessThan(*min) {
+			return &IncompatibleVersionError{
+				Channel:    c.Version,
+				Version:    clmVersion,
+				Constraint: ">= " + compat.MinVersion,
+				Hint:       "upgrade CLM",
+			}
+		}
+	}
+
+	if compat.MaxVersion != "" {
+		max, err := parseVersion(compat.MaxVersion)
+		if err != nil {
+			return fmt.Errorf("invalid max_version '%s' in channel %s", compat.MaxVersion, c.Version)
+		}
+
+		if max.LessThan(*current) {
+			return &IncompatibleVersionError{
+				Channel:    c.Version,
+				Version:    clmVersion,
+				Constraint: "<= " + compat.MaxVersion,
+				Hint:       "downgrade CLM or update the channel",
+			}
+		}
+	}
+
+	return nil
+}
+
+// OlderThan returns true if the release of the CLM version is older than
+// minVersion. Development builds whose version isn't a semantic version are
+// never older.
+func OlderThan(clmVersion, minVersion string) (bool, error) {
+	min, err := parseVersion(minVersion)
+	if err != nil {
+		return false, fmt.Errorf("invalid version '%s'", minVersion)
+	}
+
+	current, err := parseVersion(clmVersion)
+	if err != nil {
+		return false, nil
+	}
+
+	return current.LessThan(*min), nil
+}
+
+// parseVersion parses the release of a version as produced by
+// `git describe --tags`, e.g. v0.5.1-3-g1a2b3c4-dirty is parsed as 0.5.1.
+func parseVersion(version string) (*semver.Version, error) {
+	version = strings.TrimPrefix(version, "v")
+	if i := strings.IndexAny(version, "-+"); i != -1 {
+		version = version[:i]
+	}
+	return semver.NewVersion(version)
+}
@@ -0,0 +1,66 @@
+package channel
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+)
+
+func TestCheckCompatibility(t *testing.T) {
+	dir, err := ioutil.TempDir("", "channel")
+	if err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+	defer os.RemoveAll(dir)
+
+	config := &Config{Version: "stable", Path: dir}
+
+	err = config.CheckCompatibility("v0.1.0")
+	if err != nil {
+		t.Errorf("channel without %s should be compatible: %s", compatibilityFile, err)
+	}
+
+	err = ioutil.WriteFile(path.Join(dir, compatibilityFile), []byte("min_version: 0.5.0\nmax_version: 0.9.2\n"), 0644)
+	if err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+
+	for _, tc := range []struct {
+		version    string
+		compatible bool
+	}{
+		{version: "v0.5.0", compatible: true},
+		{version: "v0.9.2-3-g1a2b3c4-dirty", compatible: true},
+		{version: "unknown", compatible: true},
+		{version: "1a2b3c4", compatible: true},
+		{version: "v0.4.9", compatible: false},
+		{version: "v0.10.0", compatible: false},
+	} {
+		err := config.CheckCompatibility(tc.version)
+		if tc.compatible && err != nil {
+			t.Errorf("expected %s to be compatible, got: %s", tc.version, err)
+		}
+		if !tc.compatible {
+			if _, ok := err.(*IncompatibleVersionError); !ok {
+				t.Errorf("expected %s to be incompatible, got: %v", tc.version, err)
+			}
+		}
+	}
+
+	expected := "channel stable requires CLM version >= 0.5.0, running v0.4.9: upgrade CLM"
+	err = config.CheckCompatibility("v0.4.9")
+	if err == nil || err.Error() != expected {
+		t.Errorf("expected %s, got %v", expected, err)
+	}
+
+	err = ioutil.WriteFile(path.Join(dir, compatibilityFile), []byte("min_version: latest\n"), 0644)
+	if err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+
+	err = config.CheckCompatibility("v0.5.0")
+	if err == nil {
+		t.Errorf("expected an invalid min_version to fail")
+	}
+}
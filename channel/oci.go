@@ -0,0 +1,369 @@
+package channel
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"time"
+)
+
+const (
+	ociManifestMediaType     = "application/vnd.oci.image.manifest.v1+json"
+	ociLayerTarMediaType     = "application/vnd.oci.image.layer.v1.tar"
+	ociLayerTarGzipMediaType = "application/vnd.oci.image.layer.v1.tar+gzip"
+	ociTitleAnnotation       = "org.opencontainers.image.title"
+	ociDigestPrefix          = "sha256:"
+	ociDefaultScheme         = "https://"
+	ociMaxBlobSize           = 256 << 20
+)
+
+var ociUnsafeChars = regexp.MustCompile(`[^\w.-]`)
+
+// OCI defines a channel source where the channels are OCI artifacts stored in
+// a repository of a container registry. A channel is either a tag or, to pin
+// the configuration, the digest of the artifact manifest. The version of a
+// channel is always the digest of its manifest and all the content pulled is
+// verified against the digests of the manifest.
+type OCI struct {
+	workdir    string
+	baseURL    string
+	repository string
+	username   string
+	password   string
+	client     *http.Client
+}
+
+type ociManifest struct {
+	MediaType string          `json:"mediaType"`
+	Layers    []ociDescriptor `json:"layers"`
+}
+
+type ociDescriptor struct {
+	MediaType   string            `json:"mediaType"`
+	Digest      string            `json:"digest"`
+	Size        int64             `json:"size"`
+	Annotations map[string]string `json:"annotations"`
+}
+
+// NewOCI initializes a new OCI artifact based ChannelSource. The repository
+// is given as registry host and repository name, e.g.
+// registry.example.org/kubernetes/channels. Registries are reached via
+// https unless the repository is prefixed with another scheme. The username
+// and password are only used to request tokens if the registry asks for
+// them.
+func NewOCI(workdir, repository, username, password string) (ConfigSource, error) {
+	absWorkdir, err := filepath.Abs(workdir)
+	if err != nil {
+		return nil, err
+	}
+
+	if !strings.Contains(repository, "://") {
+		repository = ociDefaultScheme + repository
+	}
+
+	u, err := url.Parse(repository)
+	if err != nil {
+		return nil, fmt.Errorf("invalid OCI repository %s: %v", repository, err)
+	}
+
+	name := strings.Trim(u.Path, "/")
+	if u.Host == "" || name == "" {
+		return nil, fmt.Errorf("invalid OCI repository %s: expected <registry>/<repository>", repository)
+	}
+
+	return &OCI{
+		workdir:    absWorkdir,
+		baseURL:    fmt.Sprintf("%s://%s", u.Scheme, u.Host),
+		repository: name,
+		username:   username,
+		password:   password,
+		client:     &http.Client{Timeout: 5 * time.Minute},
+	}, nil
+}
+
+// Update is a no-op for the OCI channel source, the artifacts are pulled
+// when the channels are requested.
+func (o *OCI) Update() error {
+	return nil
+}
+
+// Get pulls the artifact of the channel into a new directory.
+func (o *OCI) Get(channel string) (*Config, error) {
+	manifestData, err := o.fetch(fmt.Sprintf("manifests/%s", channel), ociManifestMediaType)
+	if err != nil {
+		return nil, err
+	}
+
+	digest := ociDigest(manifestData)
+	if strings.HasPrefix(channel, ociDigestPrefix) && channel != digest {
+		return nil, fmt.Errorf("manifest of %s has digest %s", channel, digest)
+	}
+
+	var manifest ociManifest
+	err = json.Unmarshal(manifestData, &manifest)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest of %s: %v", channel, err)
+	}
+
+	dir := path.Join(o.workdir, fmt.Sprintf("%s_%s_%d", ociUnsafeChars.ReplaceAllString(o.repository, "_"), ociUnsafeChars.ReplaceAllString(channel, "_"), time.Now().UTC().UnixNano()))
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, layer := range manifest.Layers {
+		err = o.pullLayer(dir, layer)
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("failed to pull layer %s of %s: %v", layer.Digest, channel, err)
+		}
+	}
+
+	return &Config{
+		Version: digest,
+		Path:    dir,
+	}, nil
+}
+
+// Delete deletes the directory the artifact was pulled to.
+func (o *OCI) Delete(config *Config) error {
+	return os.RemoveAll(config.Path)
+}
+
+// pullLayer fetches a layer, verifies its digest and extracts it to dir.
+// Tar layers are extracted, other layers are stored as the file named by
+// their title annotation.
+func (o *OCI) pullLayer(dir string, layer ociDescriptor) error {
+	if !strings.HasPrefix(layer.Digest, ociDigestPrefix) {
+		return fmt.Errorf("unsupported digest %s", layer.Digest)
+	}
+
+	if layer.Size > ociMaxBlobSize {
+		return fmt.Errorf("layer size %d exceeds the maximum of %d bytes", layer.Size, ociMaxBlobSize)
+	}
+
+	data, err := o.fetch(fmt.Sprintf("blobs/%s", layer.Digest), "")
+	if err != nil {
+		return err
+	}
+
+	digest := ociDigest(data)
+	if digest != layer.Digest {
+		return fmt.Errorf("content has digest %s", digest)
+	}
+
+	switch layer.MediaType {
+	case ociLayerTarGzipMediaType:
+		reader, err := gzip.NewReader(bytes.NewReader(data))
+		if err != nil {
+			return err
+		}
+		defer reader.Close()
+		return extractTar(dir, reader)
+	case ociLayerTarMediaType:
+		return extractTar(dir, bytes.NewReader(data))
+	}
+
+	title := layer.Annotations[ociTitleAnnotation]
+	if title == "" {
+		return fmt.Errorf("layer of media type %s has no %s annotation", layer.MediaType, ociTitleAnnotation)
+	}
+
+	target, err := safePath(dir, title)
+	if err != nil {
+		return err
+	}
+
+	err = os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+	return ioutil.WriteFile(target, data, 0644)
+}
+
+// fetch gets a manifest or blob of the repository, requesting a token if
+// the registry asks for one.
+func (o *OCI) fetch(resource, accept string) ([]byte, error) {
+	endpoint := fmt.Sprintf("%s/v2/%s/%s", o.baseURL, o.repository, resource)
+
+	resp, err := o.get(endpoint, accept, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if resp.StatusCode == http.StatusUnauthorized {
+		challenge := resp.Header.Get("WWW-Authenticate")
+		resp.Body.Close()
+
+		token, err := o.token(challenge)
+		if err != nil {
+			return nil, err
+		}
+
+		resp, err = o.get(endpoint, accept, "Bearer "+token)
+		if err != nil {
+			return nil, err
+		}
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: unexpected status %d", endpoint, resp.StatusCode)
+	}
+
+	return ioutil.ReadAll(io.LimitReader(resp.Body, ociMaxBlobSize))
+}
+
+func (o *OCI) get(endpoint, accept, authorization string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, endpoint, nil)
+	if err != nil {
+		return nil, err
+	}
+	if accept != "" {
+		req.Header.Set("Accept", accept)
+	}
+	if authorization != "" {
+		req.Header.Set("Authorization", authorization)
+	}
+	return o.client.Do(req)
+}
+
+// token requests a bearer token for the challenge of the registry.
+func (o *OCI) token(challenge string) (string, error) {
+	params, ok := parseBearerChallenge(challenge)
+	if !ok || params["realm"] == "" {
+		return "", fmt.Errorf("unsupported authentication challenge %q", challenge)
+	}
+
+	query := url.Values{}
+	for _, key := range []string{"service", "scope"} {
+		if params[key] != "" {
+			query.Set(key, params[key])
+		}
+	}
+
+	req, err := http.NewRequest(http.MethodGet, params["realm"]+"?"+query.Encode(), nil)
+	if err != nil {
+		return "", err
+	}
+	if o.username != "" {
+		req.SetBasicAuth(o.username, o.password)
+	}
+
+	resp, err := o.client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("failed to get token from %s: unexpected status %d", params["realm"], resp.StatusCode)
+	}
+
+	var token struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	err = json.NewDecoder(resp.Body).Decode(&token)
+	if err != nil {
+		return "", err
+	}
+
+	if token.Token != "" {
+		return token.Token, nil
+	}
+	return token.AccessToken, nil
+}
+
+var bearerParamRE = regexp.MustCompile(`(\w+)="([^"]*)"`)
+
+// parseBearerChallenge parses the parameters of a Bearer WWW-Authenticate
+// challenge.
+func parseBearerChallenge(challenge string) (map[string]string, bool) {
+	if !strings.HasPrefix(challenge, "Bearer ") {
+		return nil, false
+	}
+
+	params := make(map[string]string)
+	for _, match := range bearerParamRE.FindAllStringSubmatch(challenge, -1) {
+		params[match[1]] = match[2]
+	}
+	return params, true
+}
+
+// extractTar extracts the directories and regular files of a tar archive to
+// dir.
+func extractTar(dir string, reader io.Reader) error {
+	archive := tar.NewReader(reader)
+	for {
+		header, err := archive.Next()
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+
+		target, err := safePath(dir, header.Name)
+		if err != nil {
+			return err
+		}
+
+		switch header.Typeflag {
+		case tar.TypeDir:
+			err = os.MkdirAll(target, 0755)
+		case tar.TypeReg, tar.TypeRegA:
+			err = extractFile(target, archive, os.FileMode(header.Mode).Perm())
+		default:
+			err = fmt.Errorf("unsupported entry %s of type %c", header.Name, header.Typeflag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+func extractFile(target string, reader io.Reader, mode os.FileMode) error {
+	err := os.MkdirAll(filepath.Dir(target), 0755)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(target, os.O_CREATE|os.O_TRUNC|os.O_WRONLY, mode)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	_, err = io.Copy(file, reader)
+	return err
+}
+
+// safePath returns the path of name within dir, failing if it would be
+// outside of dir.
+func safePath(dir, name string) (string, error) {
+	target := filepath.Join(dir, name)
+	if target != dir && !strings.HasPrefix(target, dir+string(filepath.Separator)) {
+		return "", fmt.Errorf("path %s is outside of the artifact", name)
+	}
+	return target, nil
+}
+
+// ociDigest returns the sha256 digest of data.
+func ociDigest(data []byte) string {
+	sum := sha256.Sum256(data)
+	return ociDigestPrefix + hex.EncodeToString(sum[:])
+}
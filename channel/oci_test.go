@@ -0,0 +1,165 @@
+package channel
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+)
+
+// helper function to build a gzipped tar archive of files.
+func createTarGzip(t *testing.T, files map[string]string) []byte {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	archive := tar.NewWriter(gz)
+	for name, content := range files {
+		err := archive.WriteHeader(&tar.Header{Name: name, Mode: 0644, Size: int64(len(content)), Typeflag: tar.TypeReg})
+		if err != nil {
+			t.Fatalf("should not fail: %s", err)
+		}
+		_, err = archive.Write([]byte(content))
+		if err != nil {
+			t.Fatalf("should not fail: %s", err)
+		}
+	}
+	if err := archive.Close(); err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+	if err := gz.Close(); err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+	return buf.Bytes()
+}
+
+// helper function to serve an artifact of a bundle layer and a single file
+// layer behind a token challenge.
+func createOCIRegistry(t *testing.T, bundle []byte) (*httptest.Server, string) {
+	file := []byte("stack: template\n")
+	manifest, err := json.Marshal(ociManifest{
+		MediaType: ociManifestMediaType,
+		Layers: []ociDescriptor{
+			{MediaType: ociLayerTarGzipMediaType, Digest: ociDigest(bundle), Size: int64(len(bundle))},
+			{MediaType: "application/yaml", Digest: ociDigest(file), Size: int64(len(file)), Annotations: map[string]string{ociTitleAnnotation: "cluster/stack.yaml"}},
+		},
+	})
+	if err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+
+	blobs := map[string][]byte{
+		ociDigest(bundle): bundle,
+		ociDigest(file):   file,
+	}
+
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/token" {
+			if user, _, _ := r.BasicAuth(); user != "clm" || r.URL.Query().Get("scope") != "repository:kubernetes/channels:pull" {
+				w.WriteHeader(http.StatusForbidden)
+				return
+			}
+			fmt.Fprint(w, `{"token": "secret"}`)
+			return
+		}
+
+		if r.Header.Get("Authorization") != "Bearer secret" {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf(`Bearer realm="%s/token",service="registry",scope="repository:kubernetes/channels:pull"`, server.URL))
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+
+		switch {
+		case r.URL.Path == "/v2/kubernetes/channels/manifests/stable", r.URL.Path == "/v2/kubernetes/channels/manifests/"+ociDigest(manifest):
+			w.Write(manifest)
+		case strings.HasPrefix(r.URL.Path, "/v2/kubernetes/channels/blobs/"):
+			blob, ok := blobs[path.Base(r.URL.Path)]
+			if !ok {
+				w.WriteHeader(http.StatusNotFound)
+				return
+			}
+			w.Write(blob)
+		default:
+			w.WriteHeader(http.StatusNotFound)
+		}
+	}))
+
+	return server, ociDigest(manifest)
+}
+
+func TestOCIChannel(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "oci")
+	if err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+	defer os.RemoveAll(workdir)
+
+	bundle := createTarGzip(t, map[string]string{"cluster/node-pools/worker-default/userdata.clc.yaml": "userdata"})
+	server, digest := createOCIRegistry(t, bundle)
+	defer server.Close()
+
+	source, err := NewOCI(workdir, server.URL+"/kubernetes/channels", "clm", "password")
+	if err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+
+	for _, channel := range []string{"stable", digest} {
+		config, err := source.Get(channel)
+		if err != nil {
+			t.Fatalf("should not fail: %s", err)
+		}
+
+		if config.Version != digest {
+			t.Errorf("expected version %s, got %s", digest, config.Version)
+		}
+
+		userData, err := ioutil.ReadFile(path.Join(config.Path, "cluster/node-pools/worker-default/userdata.clc.yaml"))
+		if err != nil || string(userData) != "userdata" {
+			t.Errorf("expected the bundle to be extracted, got %q: %v", userData, err)
+		}
+
+		stack, err := ioutil.ReadFile(path.Join(config.Path, "cluster/stack.yaml"))
+		if err != nil || string(stack) != "stack: template\n" {
+			t.Errorf("expected the file layer to be stored, got %q: %v", stack, err)
+		}
+
+		err = source.Delete(config)
+		if err != nil {
+			t.Errorf("should not fail: %s", err)
+		}
+	}
+
+	// a pinned digest not matching the manifest is rejected.
+	_, err = source.Get(ociDigestPrefix + strings.Repeat("0", 64))
+	if err == nil {
+		t.Errorf("expected failure for unknown digest")
+	}
+
+	// archives can't write outside of the artifact directory.
+	evil, digest := createOCIRegistry(t, createTarGzip(t, map[string]string{"../escaped": "evil"}))
+	defer evil.Close()
+	source, err = NewOCI(workdir, evil.URL+"/kubernetes/channels", "clm", "")
+	if err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+	_, err = source.Get(digest)
+	if err == nil {
+		t.Errorf("expected failure for path outside of the artifact")
+	}
+}
+
+func TestNewOCIInvalidRepository(t *testing.T) {
+	for _, repository := range []string{"registry.example.org", "https://"} {
+		_, err := NewOCI("/tmp", repository, "", "")
+		if err == nil {
+			t.Errorf("expected failure for %s", repository)
+		}
+	}
+}
@@ -0,0 +1,190 @@
+package channel
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// s3PinSeparator separates a channel from the digest of its version, e.g.
+// stable@3f2a...
+const s3PinSeparator = "@"
+
+type s3API interface {
+	ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error
+	GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+}
+
+// S3 defines a channel source where the channels are prefixes in an S3
+// bucket, e.g. the files of the channel stable of s3://bucket/channels are
+// the objects below s3://bucket/channels/stable/. The version of a channel is
+// <channel>@<digest>, where the digest covers the keys and ETags of its
+// objects. Getting a version pins the channel to it, which fails if the
+// objects changed.
+type S3 struct {
+	workdir string
+	bucket  string
+	prefix  string
+	client  s3API
+}
+
+// NewS3 initializes a new S3 based ChannelSource. The location is given as
+// s3://<bucket>/<prefix>.
+func NewS3(workdir, location string, sess *session.Session) (ConfigSource, error) {
+	absWorkdir, err := filepath.Abs(workdir)
+	if err != nil {
+		return nil, err
+	}
+
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 location %s: %v", location, err)
+	}
+
+	if u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 location %s: expected s3://<bucket>/<prefix>", location)
+	}
+
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &S3{
+		workdir: absWorkdir,
+		bucket:  u.Host,
+		prefix:  prefix,
+		client:  s3.New(sess),
+	}, nil
+}
+
+// Update is a no-op for the S3 channel source, the objects are downloaded
+// when the channels are requested.
+func (s *S3) Update() error {
+	return nil
+}
+
+// Get downloads the objects of the channel into a new directory.
+func (s *S3) Get(channel string) (*Config, error) {
+	name, pinned := channel, ""
+	if i := strings.Index(channel, s3PinSeparator); i >= 0 {
+		name, pinned = channel[:i], channel[i+len(s3PinSeparator):]
+	}
+
+	if name == "" || strings.Contains(name, "..") || strings.HasPrefix(name, "/") {
+		return nil, fmt.Errorf("invalid channel %s", channel)
+	}
+
+	channelPrefix := s.prefix + strings.Trim(name, "/") + "/"
+
+	var objects []*s3.Object
+	err := s.client.ListObjectsV2Pages(&s3.ListObjectsV2Input{
+		Bucket: aws.String(s.bucket),
+		Prefix: aws.String(channelPrefix),
+	}, func(resp *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range resp.Contents {
+			// skip the markers of empty directories.
+			if strings.HasSuffix(aws.StringValue(object.Key), "/") {
+				continue
+			}
+			objects = append(objects, object)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to list channel %s: %v", channel, err)
+	}
+
+	if len(objects) == 0 {
+		return nil, fmt.Errorf("channel %s not found in s3://%s/%s", channel, s.bucket, channelPrefix)
+	}
+
+	sort.Slice(objects, func(i, j int) bool {
+		return aws.StringValue(objects[i].Key) < aws.StringValue(objects[j].Key)
+	})
+
+	digest := s3Digest(objects, channelPrefix)
+	if pinned != "" && pinned != digest {
+		return nil, fmt.Errorf("channel %s has version %s%s%s", channel, name, s3PinSeparator, digest)
+	}
+
+	dir := path.Join(s.workdir, fmt.Sprintf("s3_%s_%d", ociUnsafeChars.ReplaceAllString(name, "_"), time.Now().UTC().UnixNano()))
+	err = os.MkdirAll(dir, 0755)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, object := range objects {
+		err = s.download(dir, channelPrefix, object)
+		if err != nil {
+			os.RemoveAll(dir)
+			return nil, fmt.Errorf("failed to download %s of channel %s: %v", aws.StringValue(object.Key), channel, err)
+		}
+	}
+
+	return &Config{
+		Version: name + s3PinSeparator + digest,
+		Path:    dir,
+	}, nil
+}
+
+// Delete deletes the downloaded channel specified by the config Path.
+func (s *S3) Delete(config *Config) error {
+	return os.RemoveAll(config.Path)
+}
+
+// s3Digest returns the digest of the keys relative to the channel prefix
+// and the ETags of the objects of a channel.
+func s3Digest(objects []*s3.Object, channelPrefix string) string {
+	hash := sha256.New()
+	for _, object := range objects {
+		fmt.Fprintf(hash, "%s\x00%s\n", strings.TrimPrefix(aws.StringValue(object.Key), channelPrefix), aws.StringValue(object.ETag))
+	}
+	return hex.EncodeToString(hash.Sum(nil))
+}
+
+// download stores the object as the file at its key relative to the channel
+// prefix in dir. The object is only downloaded if it still has the ETag it
+// was listed with, such that the files match the version of the channel.
+func (s *S3) download(dir, channelPrefix string, object *s3.Object) error {
+	file, err := safePath(dir, strings.TrimPrefix(aws.StringValue(object.Key), channelPrefix))
+	if err != nil {
+		return err
+	}
+
+	resp, err := s.client.GetObject(&s3.GetObjectInput{
+		Bucket:  aws.String(s.bucket),
+		Key:     object.Key,
+		IfMatch: object.ETag,
+	})
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	err = os.MkdirAll(path.Dir(file), 0755)
+	if err != nil {
+		return err
+	}
+
+	f, err := os.OpenFile(file, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0644)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, resp.Body)
+	return err
+}
@@ -0,0 +1,118 @@
+package channel
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+type s3APIStub struct {
+	objects map[string]string
+	etags   map[string]string
+}
+
+func (s *s3APIStub) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	var contents []*s3.Object
+	for key := range s.objects {
+		if strings.HasPrefix(key, aws.StringValue(input.Prefix)) {
+			contents = append(contents, &s3.Object{Key: aws.String(key), ETag: aws.String(s.etags[key])})
+		}
+	}
+	fn(&s3.ListObjectsV2Output{Contents: contents}, true)
+	return nil
+}
+
+func (s *s3APIStub) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	key := aws.StringValue(input.Key)
+	content, ok := s.objects[key]
+	if !ok {
+		return nil, fmt.Errorf("object %s not found", key)
+	}
+	if aws.StringValue(input.IfMatch) != s.etags[key] {
+		return nil, fmt.Errorf("precondition failed")
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader(content))}, nil
+}
+
+func TestS3Get(t *testing.T) {
+	workdir, err := ioutil.TempDir("", "s3-channels")
+	if err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+	defer os.RemoveAll(workdir)
+
+	client := &s3APIStub{
+		objects: map[string]string{
+			"channels/stable/cluster/stack.yaml":         "stack: template\n",
+			"channels/stable/cluster/manifests/":         "",
+			"channels/stable/cluster/manifests/dns.yaml": "kind: Deployment\n",
+			"channels/stable-2/cluster/stack.yaml":       "stack: other\n",
+		},
+		etags: map[string]string{
+			"channels/stable/cluster/stack.yaml":         `"1"`,
+			"channels/stable/cluster/manifests/dns.yaml": `"2"`,
+			"channels/stable-2/cluster/stack.yaml":       `"3"`,
+		},
+	}
+	source := &S3{workdir: workdir, bucket: "bucket", prefix: "channels/", client: client}
+
+	config, err := source.Get("stable")
+	if err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+	defer source.Delete(config)
+
+	content, err := ioutil.ReadFile(path.Join(config.Path, "cluster", "manifests", "dns.yaml"))
+	if err != nil || string(content) != "kind: Deployment\n" {
+		t.Errorf("expected the manifest to be downloaded, got %q: %v", content, err)
+	}
+
+	// the objects of channels sharing the prefix aren't part of the
+	// channel.
+	_, err = os.Stat(path.Join(config.Path, "stable-2"))
+	if !os.IsNotExist(err) {
+		t.Errorf("expected only the objects of the channel to be downloaded")
+	}
+
+	if !strings.HasPrefix(config.Version, "stable@") {
+		t.Errorf("expected the version to pin the channel, got %s", config.Version)
+	}
+
+	pinned, err := source.Get(config.Version)
+	if err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+	defer source.Delete(pinned)
+
+	if pinned.Version != config.Version {
+		t.Errorf("expected version %s, got %s", config.Version, pinned.Version)
+	}
+
+	client.etags["channels/stable/cluster/stack.yaml"] = `"4"`
+	_, err = source.Get(config.Version)
+	if err == nil {
+		t.Errorf("expected the pinned channel to fail after the objects changed")
+	}
+
+	for _, channel := range []string{"missing", "../stable", "/stable", ""} {
+		_, err = source.Get(channel)
+		if err == nil {
+			t.Errorf("expected channel %q to fail", channel)
+		}
+	}
+}
+
+func TestNewS3(t *testing.T) {
+	for _, location := range []string{"bucket/channels", "s3:///channels", "https://bucket/channels"} {
+		_, err := NewS3("workdir", location, nil)
+		if err == nil {
+			t.Errorf("expected location %s to be invalid", location)
+		}
+	}
+}
@@ -2,21 +2,33 @@ package main
 
 import (
 	"context"
+	"fmt"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
+	"text/tabwriter"
+	"time"
 
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	log "github.com/sirupsen/logrus"
 	"golang.org/x/oauth2"
 	"gopkg.in/alecthomas/kingpin.v2"
 
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/controller"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/credentials-loader/platformiam"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/decrypter"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/gce"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/notifier"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/templates"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/tracing"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/provisioner"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/registry"
 )
@@ -25,6 +37,40 @@ var (
 	provisionCmd    = kingpin.Command("provision", "Provision a cluster.")
 	decommissionCmd = kingpin.Command("decommission", "Decommission a cluster.")
 	controllerCmd   = kingpin.Command("controller", "Run controller loop.")
+	exportCAPICmd   = kingpin.Command("export-capi", "Export the node pools of a cluster as Cluster API manifests.")
+	exportTFCmd     = kingpin.Command("export-terraform", "Export the stacks of a cluster as Terraform configuration with instructions for importing them, to manage the cluster without the Cluster Lifecycle Manager.")
+	exportTFCluster = exportTFCmd.Flag("cluster", "ID or alias of the cluster to export.").Required().String()
+	exportTFDir     = exportTFCmd.Flag("output-dir", "Directory the Terraform configuration, the stack templates and the import instructions are written to.").Required().String()
+	diffCmd         = kingpin.Command("diff", "Show the configuration differences between two clusters, or the differences of the stacks and userdata of the node pools of a cluster between two channel versions.")
+	diffClusterA    = diffCmd.Arg("cluster-a", "ID or alias of the first cluster.").String()
+	diffClusterB    = diffCmd.Arg("cluster-b", "ID or alias of the second cluster.").String()
+	diffCluster     = diffCmd.Flag("cluster", "ID or alias of the cluster whose node pools are rendered from the channel versions given by --from and --to.").String()
+	diffFrom        = diffCmd.Flag("from", "Channel version the node pools are rendered from before the change.").String()
+	diffTo          = diffCmd.Flag("to", "Channel version the node pools are rendered from after the change.").String()
+	fleetCmd        = kingpin.Command("fleet", "Inspect all registered clusters.")
+	fleetQueryCmd   = fleetCmd.Command("query", "List the node pools of all clusters matching all of the given criteria.")
+	fleetInstance   = fleetQueryCmd.Flag("instance-type", "Match node pools using the instance type.").String()
+	fleetDiscount   = fleetQueryCmd.Flag("discount-strategy", "Match node pools using the discount strategy, e.g. spot_max_price.").String()
+	fleetAMIAge     = fleetQueryCmd.Flag("ami-older-than-days", "Match node pools whose AMI was created more than the number of days ago.").Int()
+	drCmd           = kingpin.Command("dr", "Disaster recovery of clusters.")
+	drRebuildCmd    = drCmd.Command("rebuild", "Re-apply all stacks and manifests of a cluster from the last successfully provisioned channel version.")
+	drCluster       = drRebuildCmd.Flag("cluster", "ID or alias of the cluster to rebuild.").Required().String()
+	rollbackCmd     = kingpin.Command("rollback", "Pin a cluster to the channel version it was provisioned with before its current version.")
+	rollbackCluster = rollbackCmd.Flag("cluster", "ID or alias of the cluster to roll back.").Required().String()
+	rollbackClear   = rollbackCmd.Flag("clear", "Remove the pinned channel version of the cluster instead.").Bool()
+	renderCmd       = kingpin.Command("render", "Render the templates of a channel locally.")
+	renderPoolCmd   = renderCmd.Command("node-pool", "Render the stack and userdata of the node pools of a cluster using a profile, without cloud provider credentials.")
+	renderProfile   = renderPoolCmd.Flag("profile", "Profile of the node pools to render.").Required().String()
+	renderCluster   = renderPoolCmd.Flag("cluster", "Path of a YAML file defining the cluster in the format of the clusters in a clusters.yaml.").Required().String()
+	renderValues    = renderPoolCmd.Flag("values", "Path of a YAML file with config items overriding the ones of the cluster.").String()
+	scaleCmd        = kingpin.Command("scale-node-pool", "Set the min and max size of a node pool without provisioning its cluster. The next provisioning restores the size from the registry.")
+	scaleCluster    = scaleCmd.Flag("cluster", "ID or alias of the cluster of the node pool.").Required().String()
+	scaleNodePool   = scaleCmd.Flag("node-pool", "Name of the node pool to scale.").Required().String()
+	scaleMinSize    = scaleCmd.Flag("min-size", "Min size of the node pool.").Required().Int64()
+	scaleMaxSize    = scaleCmd.Flag("max-size", "Max size of the node pool.").Required().Int64()
+	auditCmd        = kingpin.Command("audit", "Inspect the audit log of the actions changing the resources of the clusters.")
+	auditVerifyCmd  = auditCmd.Command("verify", "Verify that no records of an audit log file were modified or removed.")
+	auditVerifyFile = auditVerifyCmd.Arg("file", "Path of the audit log file.").Required().String()
 	version         = "unknown"
 )
 
@@ -33,6 +79,15 @@ func main() {
 
 	command := cfg.ParseFlags()
 
+	// verifying an audit log only needs the file.
+	if command == auditVerifyCmd.FullCommand() {
+		err := verifyAuditLog(*auditVerifyFile)
+		if err != nil {
+			log.Fatalf("Fail to verify the audit log: %v", err)
+		}
+		os.Exit(0)
+	}
+
 	if err := cfg.ValidateFlags(); err != nil {
 		log.Fatalf("Incorrectly configured flag: %v", err)
 	}
@@ -41,6 +96,21 @@ func main() {
 		log.SetLevel(log.DebugLevel)
 	}
 
+	shutdownTracing, err := tracing.Setup(context.Background(), tracing.Config(cfg.Tracing), version)
+	if err != nil {
+		log.Fatalf("Failed to setup tracing: %v", err)
+	}
+	// flushTraces exports the pending spans, it's called before exiting
+	// as os.Exit doesn't run deferred functions.
+	flushTraces := func() {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		defer cancel()
+		if err := shutdownTracing(ctx); err != nil {
+			log.Warnf("Failed to export traces: %v", err)
+		}
+	}
+	defer flushTraces()
+
 	var registryTokenSource, clusterTokenSource oauth2.TokenSource
 
 	if cfg.Token != "" {
@@ -53,7 +123,11 @@ func main() {
 		clusterTokenSource = platformiam.NewTokenSource(cfg.ClusterTokenName, cfg.CredentialsDir)
 	}
 
-	clusterRegistry := registry.NewRegistry(cfg.Registry, registryTokenSource, &registry.Options{Debug: cfg.DumpRequest})
+	clusterRegistry := registry.NewRegistry(cfg.Registry, registryTokenSource, &registry.Options{
+		Debug:             cfg.DumpRequest,
+		Workdir:           cfg.Workdir,
+		SSHPrivateKeyFile: cfg.SSHPrivateKeyFile,
+	})
 
 	awsConfig := aws.Config(cfg.AwsMaxRetries, cfg.AwsMaxRetryInterval)
 
@@ -62,21 +136,131 @@ func main() {
 	if err != nil {
 		log.Fatalf("Failed to setup AWS session: %v", err)
 	}
+	if cfg.ReadOnly {
+		aws.ReadOnly(sess)
+	}
 	secretDecrypter := decrypter.SecretDecrypter(map[string]decrypter.Decrypter{
 		decrypter.AWSKMSSecretPrefix: decrypter.NewAWSKMSDescrypter(sess),
 	})
 
-	p := provisioner.NewClusterpyProvisioner(clusterTokenSource, cfg.AssumedRole, awsConfig, &provisioner.Options{
-		DryRun:         cfg.DryRun,
-		ApplyOnly:      cfg.ApplyOnly,
-		UpdateStrategy: cfg.UpdateStrategy,
-		RemoveVolumes:  cfg.RemoveVolumes,
-	})
+	var kubeconfigProvider kubernetes.KubeconfigProvider
+	switch cfg.Kubeconfig.Provider {
+	case kubernetes.KubeconfigProviderStatic:
+		kubeconfigProvider = kubernetes.NewStaticKubeconfigProvider(cfg.Kubeconfig.File, cfg.Kubeconfig.TTL)
+	case kubernetes.KubeconfigProviderSSM:
+		kubeconfigProvider = kubernetes.NewSSMKubeconfigProvider(cfg.Kubeconfig.SSMParameterFormat, cfg.Kubeconfig.TTL)
+	default:
+		kubeconfigProvider = kubernetes.NewRegistryKubeconfigProvider(clusterTokenSource)
+	}
+
+	var priceSource aws.PriceSource
+	if cfg.Pricing.APIFallback {
+		priceSource = aws.NewPricingAPISource(sess, cfg.Pricing.CacheFile, cfg.Pricing.CacheTTL)
+	}
+
+	policies := make([]provisioner.Policy, 0, len(cfg.ProvisionerPolicies))
+	for _, name := range cfg.ProvisionerPolicies {
+		policy, err := provisioner.NewPolicy(name)
+		if err != nil {
+			log.Fatalf("Incorrectly configured policy: %v", err)
+		}
+		policies = append(policies, policy)
+	}
+
+	// read-only instances don't change any resources, so there's nothing
+	// to audit.
+	var auditor *audit.Auditor
+	if !cfg.ReadOnly {
+		auditConfig := audit.Config(cfg.Audit)
+		if auditConfig.Actor == "" {
+			auditConfig.Actor = instanceIdentity()
+		}
+
+		auditor, err = audit.New(auditConfig, sess)
+		if err != nil {
+			log.Fatalf("Failed to setup the audit log: %v", err)
+		}
+	}
+
+	provisionerOptions := &provisioner.Options{
+		DryRun:             cfg.DryRun,
+		ApplyOnly:          cfg.ApplyOnly,
+		UpdateStrategy:     cfg.UpdateStrategy,
+		RemoveVolumes:      cfg.RemoveVolumes,
+		KubeconfigProvider: kubeconfigProvider,
+		PriceSource:        priceSource,
+		PriceOracleURL:     cfg.Pricing.OracleURL,
+		DisasterRecovery:   command == drRebuildCmd.FullCommand(),
+		Initiator:          command,
+		Hooks:              cfg.ProvisionerHooks,
+		Policies:           policies,
+		ReadOnly:           cfg.ReadOnly,
+		ThrottleRetry:      cfg.ThrottleRetry,
+		Auditor:            auditor,
+		RateLimiter:        aws.NewAPIRateLimiter(cfg.APIRateLimit.Rate, cfg.APIRateLimit.Burst),
+		Version:            version,
+	}
+
+	provisioners := []provisioner.Provisioner{
+		provisioner.NewClusterpyProvisioner(clusterTokenSource, cfg.AssumedRole, awsConfig, provisionerOptions),
+	}
+	if cfg.Azure.ClientID != "" {
+		azureTokenSource := provisioner.NewAzureTokenSource(cfg.Azure.TenantID, cfg.Azure.ClientID, cfg.Azure.ClientSecret)
+		provisioners = append(provisioners, provisioner.NewAzureProvisioner(azureTokenSource, provisionerOptions))
+	}
+	if cfg.GCP.ServiceAccountKeyFile != "" {
+		if cfg.Kubeconfig.Provider == kubernetes.KubeconfigProviderSSM {
+			log.Fatalf("The %s kubeconfig provider doesn't support GCP clusters", kubernetes.KubeconfigProviderSSM)
+		}
+
+		computeTokenSource, err := gce.NewTokenSource(cfg.GCP.ServiceAccountKeyFile)
+		if err != nil {
+			log.Fatalf("Failed to load the GCP service account key: %v", err)
+		}
+		provisioners = append(provisioners, provisioner.NewGCEProvisioner(computeTokenSource, clusterTokenSource, provisionerOptions))
+	}
+
+	// the fake provisioner simulates all clusters regardless of their
+	// provider.
+	if cfg.Provider == provisioner.FakeProvider {
+		log.Warnf("Using the %s provider, the clusters are only simulated", provisioner.FakeProvider)
+		provisioners = []provisioner.Provisioner{provisioner.NewFakeProvisioner(provisionerOptions)}
+	}
+	p := provisioner.NewProviderProvisioner(provisioners...)
+
+	// read-only instances don't change the clusters, so they don't need
+	// to lock them.
+	var locker provisioner.ClusterLocker
+	if cfg.Lock.Table != "" && !cfg.ReadOnly {
+		if command == controllerCmd.FullCommand() && cfg.Lock.ForceUnlock {
+			log.Fatalf("--force-unlock can't be used with the controller")
+		}
+
+		holder := cfg.Lock.Holder
+		if holder == "" {
+			holder = instanceIdentity()
+		}
+
+		locker = aws.NewDynamoDBLocker(sess, cfg.Lock.Table, holder, cfg.Lock.TTL)
+		p = provisioner.NewLockingProvisioner(p, locker, cfg.Lock.TTL/3, cfg.Lock.ForceUnlock)
+	}
 
 	var configSource channel.ConfigSource
 
 	if cfg.Directory != "" {
 		configSource = channel.NewDirectory(cfg.Directory)
+	} else if cfg.OCI.Repository != "" {
+		var err error
+		configSource, err = channel.NewOCI(cfg.Workdir, cfg.OCI.Repository, cfg.OCI.Username, cfg.OCI.Password)
+		if err != nil {
+			log.Fatalf("Failed to setup OCI channel config source: %v", err)
+		}
+	} else if cfg.S3ChannelLocation != "" {
+		var err error
+		configSource, err = channel.NewS3(cfg.Workdir, cfg.S3ChannelLocation, sess)
+		if err != nil {
+			log.Fatalf("Failed to setup S3 channel config source: %v", err)
+		}
 	} else {
 		var err error
 		configSource, err = channel.NewGit(cfg.Workdir, cfg.GitRepositoryURL, cfg.SSHPrivateKeyFile)
@@ -85,25 +269,56 @@ func main() {
 		}
 	}
 
+	// rendering only needs the channel, not the registry or any cloud
+	// provider.
+	if command == renderPoolCmd.FullCommand() {
+		err := renderNodePools(configSource, *renderCluster, *renderValues, *renderProfile)
+		if err != nil {
+			log.Fatalf("Fail to render: %v", err)
+		}
+		os.Exit(0)
+	}
+
 	if command == controllerCmd.FullCommand() {
 		log.Info("Running control loop")
 
-		go serveHealthCheck(cfg.Listen)
+		err := provisioner.RegisterMetrics(prometheus.DefaultRegisterer)
+		if err != nil {
+			log.Fatalf("Failed to register metrics: %v", err)
+		}
+
+		clusterNotifier, err := notifier.New(notifier.Config(cfg.Notifications), sess)
+		if err != nil {
+			log.Fatalf("Failed to setup notifications: %v", err)
+		}
 
 		opts := &controller.Options{
-			AccountFilter:     cfg.AccountFilter,
-			Interval:          cfg.Interval,
-			DryRun:            cfg.DryRun,
-			SecretDecrypter:   secretDecrypter,
-			ConcurrentUpdates: cfg.ConcurrentUpdates,
+			AccountFilter:      cfg.AccountFilter,
+			Interval:           cfg.Interval,
+			DryRun:             cfg.DryRun,
+			ReadOnly:           cfg.ReadOnly,
+			SecretDecrypter:    secretDecrypter,
+			ConcurrentUpdates:  cfg.ConcurrentUpdates,
+			Version:            version,
+			Notifier:           clusterNotifier,
+			RolloutBakeTime:    cfg.Rollout.BakeTime,
+			RolloutMaxFailures: cfg.Rollout.MaxFailures,
+			ShutdownTimeout:    cfg.ShutdownTimeout,
+			Locker:             locker,
 		}
 
 		ctrl := controller.New(clusterRegistry, p, configSource, opts)
+		var scale http.Handler
+		if cfg.ScaleAPIToken != "" {
+			scale = ctrl.ScaleHandler(provisioner.NewNodePoolScaler(cfg.AssumedRole, awsConfig, provisionerOptions), cfg.ScaleAPIToken)
+		}
+		go serveHTTP(cfg.Listen, ctrl.StatusHandler(), scale)
 
 		ctx, cancel := context.WithCancel(context.Background())
 		go handleSigterm(cancel)
 		ctrl.Run(ctx)
 
+		flushTraces()
 		os.Exit(0)
 	}
 
@@ -112,6 +327,126 @@ func main() {
 		log.Fatalf("%+v", err)
 	}
 
+	if command == diffCmd.FullCommand() {
+		if *diffCluster != "" {
+			err = diffChannelVersions(configSource, clusters, *diffCluster, *diffFrom, *diffTo)
+		} else {
+			err = diffClusters(clusters, *diffClusterA, *diffClusterB)
+		}
+		if err != nil {
+			log.Fatalf("Fail to diff: %v", err)
+		}
+		os.Exit(0)
+	}
+
+	if command == fleetQueryCmd.FullCommand() {
+		var allowed []*api.Cluster
+		for _, cluster := range clusters {
+			if cfg.AccountFilter.Allowed(cluster.InfrastructureAccount) {
+				allowed = append(allowed, cluster)
+			}
+		}
+
+		query := &provisioner.FleetQuery{
+			InstanceType:     *fleetInstance,
+			DiscountStrategy: *fleetDiscount,
+			AMIOlderThan:     time.Duration(*fleetAMIAge) * 24 * time.Hour,
+		}
+		printFleetMatches(provisioner.QueryFleet(allowed, query, provisioner.NewFleetInventory(cfg.AssumedRole, awsConfig)))
+		os.Exit(0)
+	}
+
+	if command == rollbackCmd.FullCommand() {
+		err = pinRollbackVersion(configSource, clusterRegistry, clusters, cfg)
+		if err != nil {
+			log.Fatalf("Fail to roll back: %v", err)
+		}
+		os.Exit(0)
+	}
+
+	if command == exportTFCmd.FullCommand() {
+		cluster, err := findCluster(clusters, *exportTFCluster)
+		if err != nil {
+			log.Fatalf("Fail to export: %v", err)
+		}
+
+		if !cfg.AccountFilter.Allowed(cluster.InfrastructureAccount) {
+			log.Fatalf("Fail to export: infrastructure account of cluster %s does not match provided filter", cluster.ID)
+		}
+
+		err = provisioner.NewTerraformExporter(cfg.AssumedRole, awsConfig).ExportTerraform(cluster, *exportTFDir)
+		if err != nil {
+			log.Fatalf("Fail to export: %v", err)
+		}
+		log.Infof("Exported the stacks of cluster %s to %s, see %s/IMPORT.md for importing them", cluster.ID, *exportTFDir, *exportTFDir)
+		os.Exit(0)
+	}
+
+	if command == scaleCmd.FullCommand() {
+		err = scaleClusterNodePool(clusterRegistry, clusters, cfg, provisioner.NewNodePoolScaler(cfg.AssumedRole, awsConfig, provisionerOptions))
+		if err != nil {
+			log.Fatalf("Fail to scale: %v", err)
+		}
+		flushTraces()
+		os.Exit(0)
+	}
+
+	// a SIGTERM aborts waiting for stack operations and node pool
+	// updates of the cluster being provisioned.
+	ctx, cancel := context.WithCancel(context.Background())
+	go handleSigterm(cancel)
+
+	if command == drRebuildCmd.FullCommand() {
+		cluster, err := findCluster(clusters, *drCluster)
+		if err != nil {
+			log.Fatalf("Fail to rebuild: %v", err)
+		}
+
+		if !cfg.AccountFilter.Allowed(cluster.InfrastructureAccount) {
+			log.Fatalf("Fail to rebuild: infrastructure account of cluster %s does not match provided filter", cluster.ID)
+		}
+
+		// rebuild from the last known-good channel version instead
+		// of the latest one.
+		channelVersion, err := provisioner.RecoveryChannelVersion(cluster)
+		if err != nil {
+			log.Fatalf("Fail to rebuild: %v", err)
+		}
+
+		err = configSource.Update()
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+
+		config, err := configSource.Get(channelVersion)
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+
+		err = config.CheckCompatibility(version)
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+
+		for key, value := range cluster.ConfigItems {
+			decryptedValue, err := secretDecrypter.Decrypt(value)
+			if err != nil {
+				log.Fatalf("%+v", err)
+			}
+
+			cluster.ConfigItems[key] = decryptedValue
+		}
+
+		log.Infof("Rebuilding cluster %s from channel version %s", cluster.ID, channelVersion)
+		err = p.Provision(ctx, cluster, config)
+		if err != nil {
+			log.Fatalf("Fail to rebuild: %v", err)
+		}
+		log.Infof("Rebuilding done for cluster %s", cluster.ID)
+		flushTraces()
+		os.Exit(0)
+	}
+
 	for _, cluster := range clusters {
 		if !cfg.AccountFilter.Allowed(cluster.InfrastructureAccount) {
 			log.Debugf("Skipping %s cluster, infrastructure account does not match provided filter.", cluster.ID)
@@ -123,7 +458,12 @@ func main() {
 			log.Fatalf("%+v", err)
 		}
 
-		config, err := configSource.Get(cluster.Channel)
+		config, err := configSource.Get(cluster.ChannelRef())
+		if err != nil {
+			log.Fatalf("%+v", err)
+		}
+
+		err = config.CheckCompatibility(version)
 		if err != nil {
 			log.Fatalf("%+v", err)
 		}
@@ -140,28 +480,306 @@ func main() {
 		switch command {
 		case provisionCmd.FullCommand():
 			log.Infof("Provisioning cluster %s", cluster.ID)
-			err = p.Provision(cluster, config)
+			summary := api.NewUpdateSummary(nil)
+			err = p.Provision(api.WithUpdateSummary(ctx, summary), cluster, config)
+			summary.Finish(err)
+			data, jsonErr := summary.JSON()
+			if jsonErr == nil {
+				log.Infof("Update summary: %s", data)
+			}
 			if err != nil {
 				log.Fatalf("Fail to provision: %v", err)
 			}
 			log.Infof("Provisioning done for cluster %s", cluster.ID)
 		case decommissionCmd.FullCommand():
+			if cfg.ReadOnly {
+				log.Fatalf("Fail to decommission: not supported in read-only mode")
+			}
 			log.Infof("Decommissioning cluster %s", cluster.ID)
-			err = p.Decommission(cluster, config)
+			err = p.Decommission(ctx, cluster, config)
 			if err != nil {
 				log.Fatalf("Fail to decommission: %v", err)
 			}
 			log.Infof("Decommissioning done for cluster %s", cluster.ID)
+		case exportCAPICmd.FullCommand():
+			err = provisioner.ExportClusterAPI(cluster, config, os.Stdout)
+			if err != nil {
+				log.Fatalf("Fail to export: %v", err)
+			}
 		default:
 			log.Fatalf("unknown command: %s", command)
 		}
 	}
 }
 
-func serveHealthCheck(listen string) {
+// instanceIdentity identifies the running instance by its hostname and
+// process ID.
+func instanceIdentity() string {
+	hostname, err := os.Hostname()
+	if err != nil {
+		log.Fatalf("Failed to get the hostname: %v", err)
+	}
+	return fmt.Sprintf("%s/%d", hostname, os.Getpid())
+}
+
+// verifyAuditLog verifies the chain of the records of an audit log file.
+func verifyAuditLog(path string) error {
+	records, err := audit.ReadLog(path)
+	if err != nil {
+		return err
+	}
+
+	err = audit.Verify(records)
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("%d records verified\n", len(records))
+	return nil
+}
+
+// findCluster returns the cluster identified by the ID or alias.
+func findCluster(clusters []*api.Cluster, idOrAlias string) (*api.Cluster, error) {
+	for _, cluster := range clusters {
+		if cluster.ID == idOrAlias || cluster.Alias == idOrAlias {
+			return cluster, nil
+		}
+	}
+	return nil, fmt.Errorf("cluster %s not found", idOrAlias)
+}
+
+// diffClusters prints the configuration differences between the clusters
+// identified by the IDs or aliases a and b.
+func diffClusters(clusters []*api.Cluster, a, b string) error {
+	if a == "" || b == "" {
+		return fmt.Errorf("two clusters or --cluster with --from and --to are required")
+	}
+
+	clusterA, err := findCluster(clusters, a)
+	if err != nil {
+		return err
+	}
+
+	clusterB, err := findCluster(clusters, b)
+	if err != nil {
+		return err
+	}
+
+	for _, diff := range clusterA.Diff(clusterB) {
+		fmt.Println(diff)
+	}
+
+	return nil
+}
+
+// diffChannelVersions prints the unified diffs of the stacks and userdata of
+// the node pools of the cluster rendered from the channel versions from and
+// to. The config items are used as stored in the registry, secrets aren't
+// decrypted such that they don't end up in the output.
+func diffChannelVersions(configSource channel.ConfigSource, clusters []*api.Cluster, clusterID, from, to string) error {
+	if from == "" || to == "" {
+		return fmt.Errorf("--from and --to are required with --cluster")
+	}
+
+	cluster, err := findCluster(clusters, clusterID)
+	if err != nil {
+		return err
+	}
+
+	err = configSource.Update()
+	if err != nil {
+		return err
+	}
+
+	fromConfig, err := configSource.Get(from)
+	if err != nil {
+		return err
+	}
+	defer configSource.Delete(fromConfig)
+
+	toConfig, err := configSource.Get(to)
+	if err != nil {
+		return err
+	}
+	defer configSource.Delete(toConfig)
+
+	diffs, err := templates.DiffNodePools(cluster, fromConfig, toConfig)
+	if err != nil {
+		return err
+	}
+
+	if len(diffs) == 0 {
+		log.Infof("No changes to the node pools of cluster %s between channel versions %s and %s", cluster.ID, from, to)
+		return nil
+	}
+
+	for _, diff := range diffs {
+		fmt.Printf("### node pool %s\n%s", diff.NodePool, diff.Diff)
+	}
+	return nil
+}
+
+// pinRollbackVersion pins the cluster given by the rollback flags to the channel
+// version it was provisioned with before its current version, or removes the
+// pinned version. The controller provisions the cluster with the pinned
+// version on its next run.
+func pinRollbackVersion(configSource channel.ConfigSource, clusterRegistry registry.Registry, clusters []*api.Cluster, cfg *config.LifecycleManagerConfig) error {
+	cluster, err := findCluster(clusters, *rollbackCluster)
+	if err != nil {
+		return err
+	}
+
+	if !cfg.AccountFilter.Allowed(cluster.InfrastructureAccount) {
+		return fmt.Errorf("infrastructure account of cluster %s does not match provided filter", cluster.ID)
+	}
+
+	if cfg.ReadOnly {
+		return fmt.Errorf("not supported in read-only mode")
+	}
+
+	channelVersion := ""
+	if !*rollbackClear {
+		channelVersion, err = provisioner.RollbackChannelVersion(cluster)
+		if err != nil {
+			return err
+		}
+
+		// make sure the version can still be checked out before
+		// pinning the cluster to it.
+		err = configSource.Update()
+		if err != nil {
+			return err
+		}
+
+		config, err := configSource.Get(channelVersion)
+		if err != nil {
+			return err
+		}
+		configSource.Delete(config)
+	}
+
+	if cfg.DryRun {
+		log.Infof("Dry run: not pinning cluster %s to channel version '%s'", cluster.ID, channelVersion)
+		return nil
+	}
+
+	if cluster.Status == nil {
+		cluster.Status = &api.ClusterStatus{}
+	}
+	cluster.Status.PinnedChannelVersion = channelVersion
+	err = clusterRegistry.UpdateCluster(cluster)
+	if err != nil {
+		return err
+	}
+
+	if channelVersion == "" {
+		log.Infof("Removed the pinned channel version of cluster %s", cluster.ID)
+	} else {
+		log.Infof("Pinned cluster %s to channel version %s", cluster.ID, channelVersion)
+	}
+	return nil
+}
+
+// scaleClusterNodePool sets the min and max size of the node pool given by the
+// scale flags and records the scaling in the status of its cluster in the
+// registry.
+func scaleClusterNodePool(clusterRegistry registry.Registry, clusters []*api.Cluster, cfg *config.LifecycleManagerConfig, scaler provisioner.NodePoolScaler) error {
+	cluster, err := findCluster(clusters, *scaleCluster)
+	if err != nil {
+		return err
+	}
+
+	if !cfg.AccountFilter.Allowed(cluster.InfrastructureAccount) {
+		return fmt.Errorf("infrastructure account of cluster %s does not match provided filter", cluster.ID)
+	}
+
+	if cfg.ReadOnly {
+		return fmt.Errorf("not supported in read-only mode")
+	}
+
+	actor := cfg.Audit.Actor
+	if actor == "" {
+		actor = instanceIdentity()
+	}
+
+	scaling, err := scaler.ScaleNodePool(context.Background(), cluster, *scaleNodePool, *scaleMinSize, *scaleMaxSize, actor)
+	if err != nil {
+		return err
+	}
+
+	if cfg.DryRun {
+		log.Infof("Dry run: not recording the scaling of node pool %s of cluster %s", *scaleNodePool, cluster.ID)
+		return nil
+	}
+
+	err = clusterRegistry.UpdateCluster(cluster)
+	if err != nil {
+		return err
+	}
+
+	log.Infof("Scaled node pool %s of cluster %s to %d/%d", *scaleNodePool, cluster.ID, scaling.MinSize, scaling.MaxSize)
+	return nil
+}
+
+// renderNodePools prints the stacks and userdata of the node pools of the
+// cluster defined in clusterFile using the profile, rendered from the
+// channel of the cluster.
+func renderNodePools(configSource channel.ConfigSource, clusterFile, valuesFile, profile string) error {
+	cluster, err := templates.LoadCluster(clusterFile, valuesFile)
+	if err != nil {
+		return err
+	}
+
+	err = configSource.Update()
+	if err != nil {
+		return err
+	}
+
+	config, err := configSource.Get(cluster.ChannelRef())
+	if err != nil {
+		return err
+	}
+	defer configSource.Delete(config)
+
+	err = config.CheckCompatibility(version)
+	if err != nil {
+		return err
+	}
+
+	rendered, err := templates.RenderNodePools(config.Path, cluster, profile)
+	if err != nil {
+		return err
+	}
+
+	for _, nodePool := range rendered {
+		fmt.Printf("--- # stack of node pool %s\n%s\n", nodePool.NodePool, nodePool.Stack)
+		fmt.Printf("--- # userdata of node pool %s (%s)\n%s\n", nodePool.NodePool, nodePool.UserDataFormat, nodePool.UserData)
+	}
+
+	return nil
+}
+
+// printFleetMatches prints the node pools matching a fleet query as a table.
+func printFleetMatches(matches []*provisioner.FleetMatch) {
+	w := tabwriter.NewWriter(os.Stdout, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(w, "CLUSTER\tNODE POOL\tINSTANCE TYPE\tDISCOUNT STRATEGY\tAMI\tAMI CREATED")
+	for _, match := range matches {
+		fmt.Fprintln(w, match)
+	}
+	w.Flush()
+}
+
+// serveHTTP serves the health check, metrics and status of the controller.
+// The scale endpoint is only served if its handler is set.
+func serveHTTP(listen string, status, scale http.Handler) {
 	http.HandleFunc("/healthz", func(w http.ResponseWriter, _ *http.Request) {
 		w.WriteHeader(http.StatusOK)
 	})
+	http.Handle("/metrics", promhttp.Handler())
+	http.Handle("/status", status)
+	if scale != nil {
+		http.Handle("/scale", scale)
+	}
 	http.ListenAndServe(listen, nil)
 }
 
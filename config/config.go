@@ -10,20 +10,47 @@ import (
 )
 
 const (
-	defaultInterval              = "10m"
-	defaultListener              = ":9090"
-	defaultCredentialsDir        = "/meta/credentials"
-	defaultRegistryTokenName     = "cluster-registry-rw"
-	defaultClusterTokenName      = "cluster-rw"
-	defaultRegistry              = "file://clusters.yaml"
-	defaultConcurrentUpdates     = "1"
-	defaultAwsMaxRetries         = "50"
-	defaultAwsMaxRetryInterval   = "10s"
-	defaultUpdateMaxEvictTimeout = "10m"
-	defaultUpdateStrategy        = "rolling"
+	defaultInterval                        = "10m"
+	defaultListener                        = ":9090"
+	defaultCredentialsDir                  = "/meta/credentials"
+	defaultRegistryTokenName               = "cluster-registry-rw"
+	defaultClusterTokenName                = "cluster-rw"
+	defaultRegistry                        = "file://clusters.yaml"
+	defaultConcurrentUpdates               = "1"
+	defaultAwsMaxRetries                   = "50"
+	defaultAwsMaxRetryInterval             = "10s"
+	defaultUpdateMaxEvictTimeout           = "10m"
+	defaultUpdateNamespaceEvictionInterval = "0s"
+	defaultUpdateCanarySoakPeriod          = "10m"
+	defaultUpdateMaxNodesPerIteration      = "0"
+	defaultUpdateNodeHealthTimeout         = "10m"
+	defaultUpdateMaxUnavailable            = "0"
+	defaultUpdateMaxEvictionsPerMinute     = "0"
+	defaultUpdateStrategy                  = "rolling"
+	defaultInstanceRefreshMinHealthy       = "90"
+	defaultInstanceRefreshCheckpointDelay  = "10m"
+	defaultInstanceRefreshInstanceWarmup   = "0s"
+	defaultKubeconfigProvider              = "registry"
+	defaultKubeconfigTTL                   = "5m"
+	defaultKubeconfigSSMFormat             = "/cluster-lifecycle-manager/%s/token"
+	defaultPricingCacheTTL                 = "24h"
+	defaultLockTTL                         = "5m"
+	defaultThrottleRetryInitialInterval    = "1s"
+	defaultThrottleRetryMaxInterval        = "1m"
+	defaultThrottleRetryMaxElapsedTime     = "10m"
+	defaultThrottleRetryJitter             = "0.5"
+	defaultAPIRateLimit                    = "0"
+	defaultAPIRateLimitBurst               = "20"
+	defaultRolloutBakeTime                 = "1h"
+	defaultRolloutMaxFailures              = "0"
+	defaultShutdownTimeout                 = "1m"
+	defaultTracingSampleRatio              = "1"
 )
 
-var defaultWorkdir = path.Join(os.TempDir(), "clm-workdir")
+var (
+	defaultWorkdir          = path.Join(os.TempDir(), "clm-workdir")
+	defaultPricingCacheFile = path.Join(os.TempDir(), "clm-pricing-cache.json")
+)
 
 // LifecycleManagerConfig stores the configuration for app
 type LifecycleManagerConfig struct {
@@ -34,30 +61,171 @@ type LifecycleManagerConfig struct {
 	ClusterTokenName    string
 	AssumedRole         string
 	Interval            time.Duration
+	ShutdownTimeout     time.Duration
 	Debug               bool
 	DumpRequest         bool
 	DryRun              bool
+	ReadOnly            bool
+	Provider            string
 	ConcurrentUpdates   uint
 	Listen              string
+	ScaleAPIToken       string
 	Workdir             string
 	Directory           string
 	GitRepositoryURL    string
+	OCI                 OCI
+	S3ChannelLocation   string
 	SSHPrivateKeyFile   string
 	CredentialsDir      string
 	ApplyOnly           bool
 	AwsMaxRetries       int
 	AwsMaxRetryInterval time.Duration
+	ThrottleRetry       ThrottleRetry
+	APIRateLimit        APIRateLimit
 	UpdateStrategy      UpdateStrategy
 	RemoveVolumes       bool
+	ProvisionerHooks    []string
+	ProvisionerPolicies []string
+	Kubeconfig          Kubeconfig
+	Pricing             Pricing
+	Azure               Azure
+	GCP                 GCP
+	Lock                Lock
+	Notifications       Notifications
+	Audit               Audit
+	Rollout             Rollout
+	Tracing             Tracing
+}
+
+// Tracing defines the OTLP collector the traces of the cluster updates are
+// exported to. Nothing is exported unless an endpoint is configured.
+type Tracing struct {
+	OTLPEndpoint string
+	Insecure     bool
+	SampleRatio  float64
+}
+
+// Rollout defines how new channel versions are rolled out to the clusters of
+// a channel, wave by wave as defined by their rollout_wave config item.
+type Rollout struct {
+	BakeTime    time.Duration
+	MaxFailures uint
+}
+
+// Notifications defines the sinks the controller notifies about the
+// lifecycle events of the clusters and the template of the messages.
+type Notifications struct {
+	SlackWebhooks []string
+	Webhooks      []string
+	SNSTopics     []string
+	Template      string
+}
+
+// Audit defines the sinks recording the actions changing the resources of
+// the clusters and the actor recorded in them. Nothing is recorded unless a
+// sink is configured.
+type Audit struct {
+	File               string
+	S3Location         string
+	CloudWatchLogGroup string
+	Actor              string
+}
+
+// Lock defines the DynamoDB table holding the locks of the clusters, which
+// prevent concurrent instances from provisioning the same cluster. Clusters
+// aren't locked unless a table is configured.
+type Lock struct {
+	Table       string
+	Holder      string
+	TTL         time.Duration
+	ForceUnlock bool
+}
+
+// ThrottleRetry defines how CloudFormation and S3 calls failing because of
+// API rate limits are retried, on top of the retries of the AWS SDK. The
+// intervals grow exponentially from the initial to the max interval and are
+// randomized by the jitter factor. A max elapsed time of 0 disables the
+// retries.
+type ThrottleRetry struct {
+	InitialInterval time.Duration
+	MaxInterval     time.Duration
+	MaxElapsedTime  time.Duration
+	Jitter          float64
+}
+
+// APIRateLimit defines the rate of AWS API requests sent per account, region
+// and service, shared by all clusters updated at the same time. A rate of 0
+// disables the limit.
+type APIRateLimit struct {
+	Rate  float64
+	Burst int64
+}
+
+// OCI defines the repository of OCI artifacts used as channel config source
+// and the credentials to pull them.
+type OCI struct {
+	Repository string
+	Username   string
+	Password   string
+}
+
+// GCP defines the service account used to provision clusters on GCP. GCP
+// clusters are only provisioned if a service account key file is configured.
+type GCP struct {
+	ServiceAccountKeyFile string
+}
+
+// Azure defines the service principal used to provision clusters on Azure.
+// Azure clusters are only provisioned if a client ID is configured.
+type Azure struct {
+	TenantID     string
+	ClientID     string
+	ClientSecret string
+}
+
+// Pricing defines how on-demand prices missing from the bundled instance info
+// are looked up.
+type Pricing struct {
+	APIFallback bool
+	CacheFile   string
+	CacheTTL    time.Duration
+	OracleURL   string
+}
+
+// Kubeconfig defines how the Cluster Lifecycle Manager reaches the API
+// servers of the clusters.
+type Kubeconfig struct {
+	Provider           string
+	File               string
+	SSMParameterFormat string
+	TTL                time.Duration
 }
 
 // UpdateStrategy defines the default update strategy configured for the
-// Cluster Lifecycle Manager. It includes a named strategy and a max evict
-// timeout. The default strategy can be overwritten with a config item per
-// cluster.
+// Cluster Lifecycle Manager. It includes a named strategy, a max evict
+// timeout, the minimum interval between evictions of pods without a
+// PodDisruptionBudget in the same namespace, the time canary nodes must stay
+// healthy, the maximum number of nodes replaced per iteration, the time new
+// nodes may take to become healthy, the maximum number of nodes drained at
+// the same time and the maximum number of pod evictions per minute. The
+// instance refresh strategy is configured with the minimum percentage of
+// healthy nodes, the checkpoints at which the refresh waits for the
+// checkpoint delay and the warmup time of new instances. The defaults can be
+// overwritten with config items per cluster.
 type UpdateStrategy struct {
-	Strategy        string
-	MaxEvictTimeout time.Duration
+	Strategy                  string
+	MaxEvictTimeout           time.Duration
+	NamespaceEvictionInterval time.Duration
+	CanarySoakPeriod          time.Duration
+	MaxNodesPerIteration      int
+	NodeHealthTimeout         time.Duration
+	MaxUnavailable            int
+	MaxEvictionsPerMinute     int
+
+	InstanceRefreshMinHealthyPercentage int
+	InstanceRefreshCheckpoints          string
+	InstanceRefreshCheckpointDelay      time.Duration
+	InstanceRefreshInstanceWarmup       time.Duration
 }
 
 // New returns the app wide configuration file
@@ -68,37 +236,116 @@ func New(version string) *LifecycleManagerConfig {
 
 // ValidateFlags for custom flag validation, e.g. check for the interval being not too short
 func (cfg *LifecycleManagerConfig) ValidateFlags() error {
-	if cfg.GitRepositoryURL == "" && cfg.Directory == "" {
-		return fmt.Errorf("Either --git-repository-url or --directory must be specified")
+	if cfg.GitRepositoryURL == "" && cfg.Directory == "" && cfg.OCI.Repository == "" && cfg.S3ChannelLocation == "" {
+		return fmt.Errorf("Either --git-repository-url, --oci-repository, --s3-channels or --directory must be specified")
+	}
+	if cfg.Kubeconfig.Provider == "static" && cfg.Kubeconfig.File == "" {
+		return fmt.Errorf("--kubeconfig-file must be specified for the static kubeconfig provider")
+	}
+	if cfg.Lock.Table != "" && cfg.Lock.TTL <= 0 {
+		return fmt.Errorf("--lock-ttl must be positive")
+	}
+	if cfg.Tracing.SampleRatio < 0 || cfg.Tracing.SampleRatio > 1 {
+		return fmt.Errorf("--tracing-sample-ratio must be between 0 and 1")
+	}
+	if cfg.ThrottleRetry.Jitter < 0 || cfg.ThrottleRetry.Jitter > 1 {
+		return fmt.Errorf("--aws-throttle-retry-jitter must be between 0 and 1")
+	}
+	if cfg.ThrottleRetry.MaxElapsedTime > 0 && (cfg.ThrottleRetry.InitialInterval <= 0 || cfg.ThrottleRetry.MaxInterval < cfg.ThrottleRetry.InitialInterval) {
+		return fmt.Errorf("--aws-throttle-retry-initial-interval must be positive and not exceed --aws-throttle-retry-max-interval")
+	}
+	if cfg.APIRateLimit.Rate < 0 {
+		return fmt.Errorf("--aws-api-rate-limit must not be negative")
+	}
+	if cfg.APIRateLimit.Rate > 0 && cfg.APIRateLimit.Burst < 1 {
+		return fmt.Errorf("--aws-api-rate-limit-burst must be positive")
+	}
+	if cfg.UpdateStrategy.InstanceRefreshMinHealthyPercentage < 0 || cfg.UpdateStrategy.InstanceRefreshMinHealthyPercentage > 100 {
+		return fmt.Errorf("--update-instance-refresh-min-healthy-percentage must be between 0 and 100")
 	}
 	return nil
 }
 
 // ParseFlags calls flag parsing. Might call termination handler in case if the kingpin internal validations are enabled.
 func (cfg *LifecycleManagerConfig) ParseFlags() string {
-	kingpin.Flag("registry", "The location of a cluster registry. This can either be a filepath to a clusters.yaml or an URL for a cluster registry.").Default(defaultRegistry).Short('f').StringVar(&cfg.Registry)
+	kingpin.Flag("registry", "The location of a cluster registry. This can either be a filepath to a clusters.yaml, an URL for a cluster registry, a dir:// URL of a directory of cluster files or a git+https://, git+ssh:// or git+file:// URL of a Git repository with the cluster files in the directory given by the fragment.").Default(defaultRegistry).Short('f').StringVar(&cfg.Registry)
 	kingpin.Flag("include", "Specify a regular expression to include accounts for provisioning.").Default(DefaultInclude).RegexpVar(&cfg.AccountFilter.Include)
 	kingpin.Flag("exclude", "Specify a regular expression to exclude accounts for provisioning.").Default(DefaultExclude).RegexpVar(&cfg.AccountFilter.Exclude)
 	kingpin.Flag("token", "The token to authenticate with.").StringVar(&cfg.Token)
 	kingpin.Flag("registry-token-name", "Name of the token used when authenticating with a cluster registry.").Default(defaultRegistryTokenName).StringVar(&cfg.RegistryTokenName)
 	kingpin.Flag("cluster-token-name", "Name of the token used when authenticating with a cluster.").Default(defaultClusterTokenName).StringVar(&cfg.ClusterTokenName)
-	kingpin.Flag("assumed-role", "The role ARN to assume in target accounts.").StringVar(&cfg.AssumedRole)
+	kingpin.Flag("assumed-role", "Name of the role to assume in the accounts of the clusters, unless the cluster defines the ARN of the role in the assumed_role_arn config item.").StringVar(&cfg.AssumedRole)
 	kingpin.Flag("interval", "The interval between iterations in Duration format, e.g. 60s.").Default(defaultInterval).DurationVar(&cfg.Interval)
 	kingpin.Flag("debug", "Enable debug logging.").BoolVar(&cfg.Debug)
 	kingpin.Flag("dump-request", "Enable logging http requests.").BoolVar(&cfg.DumpRequest)
 	kingpin.Flag("dry-run", "Don't make any changes, just print.").BoolVar(&cfg.DryRun)
+	kingpin.Flag("read-only", "Render, validate and diff the clusters and report drift without calling any AWS or Kubernetes API which could change resources. Implies --dry-run.").BoolVar(&cfg.ReadOnly)
+	kingpin.Flag("provider", "Provision all clusters with the given provider instead of the provider of each cluster. The fake provider simulates the stacks and node pools in memory without calling any cloud provider or cluster API, e.g. to validate channels locally or in CI.").EnumVar(&cfg.Provider, "fake")
 	kingpin.Flag("listen", "Address to listen at, e.g. :9090 or 0.0.0.0:9090").Default(defaultListener).StringVar(&cfg.Listen)
+	kingpin.Flag("scale-api-token", "Bearer token authenticating the requests to the /scale endpoint of the controller, which scales node pools without provisioning their clusters. The endpoint is disabled if empty.").Envar("SCALE_API_TOKEN").StringVar(&cfg.ScaleAPIToken)
 	kingpin.Flag("workdir", "Path to working directory used for storing channel configurations.").Default(defaultWorkdir).StringVar(&cfg.Workdir)
 	kingpin.Flag("directory", "Path of a directory to use as channel config source.").StringVar(&cfg.Directory)
 	kingpin.Flag("git-repository-url", "URL of the git repository to use as channel config source.").StringVar(&cfg.GitRepositoryURL)
+	kingpin.Flag("oci-repository", "Repository of OCI artifacts to use as channel config source, e.g. registry.example.org/kubernetes/channels. Channels are tags or digests of the artifacts.").StringVar(&cfg.OCI.Repository)
+	kingpin.Flag("oci-username", "Username used when requesting tokens to pull from the OCI repository.").Envar("OCI_USERNAME").StringVar(&cfg.OCI.Username)
+	kingpin.Flag("oci-password", "Password used when requesting tokens to pull from the OCI repository.").Envar("OCI_PASSWORD").StringVar(&cfg.OCI.Password)
+	kingpin.Flag("s3-channels", "S3 location of the channels to use as channel config source, e.g. s3://bucket/channels. Channels are the prefixes below the location, optionally pinned to a version as <channel>@<version>.").StringVar(&cfg.S3ChannelLocation)
 	kingpin.Flag("concurrent-updates", "Number of updates allowed to run in parallel.").Default(defaultConcurrentUpdates).UintVar(&cfg.ConcurrentUpdates)
 	kingpin.Flag("ssh-private-key-path", "Path to SSH private key used when pulling from a private git repository.").Envar("SSH_PRIVATE_KEY_PATH").StringVar(&cfg.SSHPrivateKeyFile)
 	kingpin.Flag("credentials-dir", "Path to OAuth credentials").Envar("CREDENTIALS_DIR").Default(defaultCredentialsDir).StringVar(&cfg.CredentialsDir)
 	kingpin.Flag("apply-only", "Enable apply only mode which will only apply CloudFormation stacks and manifests, but not do any rolling of nodes.").BoolVar(&cfg.ApplyOnly)
 	kingpin.Flag("aws-max-retries", "Maximum number of retries for AWS SDK requests.").Default(defaultAwsMaxRetries).IntVar(&cfg.AwsMaxRetries)
 	kingpin.Flag("aws-max-retry-interval", "Maximum interval between retries for AWS SDK requests.").Default(defaultAwsMaxRetryInterval).DurationVar(&cfg.AwsMaxRetryInterval)
+	kingpin.Flag("aws-throttle-retry-initial-interval", "Initial interval between retries of CloudFormation and S3 calls which were throttled by AWS.").Default(defaultThrottleRetryInitialInterval).DurationVar(&cfg.ThrottleRetry.InitialInterval)
+	kingpin.Flag("aws-throttle-retry-max-interval", "Maximum interval between retries of CloudFormation and S3 calls which were throttled by AWS.").Default(defaultThrottleRetryMaxInterval).DurationVar(&cfg.ThrottleRetry.MaxInterval)
+	kingpin.Flag("aws-throttle-retry-max-elapsed-time", "Time after which throttled CloudFormation and S3 calls are no longer retried. 0 disables the retries.").Default(defaultThrottleRetryMaxElapsedTime).DurationVar(&cfg.ThrottleRetry.MaxElapsedTime)
+	kingpin.Flag("aws-throttle-retry-jitter", "Factor between 0 and 1 by which the intervals between retries of throttled calls are randomized.").Default(defaultThrottleRetryJitter).Float64Var(&cfg.ThrottleRetry.Jitter)
+	kingpin.Flag("aws-api-rate-limit", "Maximum rate of AWS API requests per second and account, region and service, shared by all clusters updated in parallel. 0 disables the limit.").Default(defaultAPIRateLimit).Float64Var(&cfg.APIRateLimit.Rate)
+	kingpin.Flag("aws-api-rate-limit-burst", "Number of AWS API requests per account, region and service which can be sent at once before --aws-api-rate-limit applies.").Default(defaultAPIRateLimitBurst).Int64Var(&cfg.APIRateLimit.Burst)
 	kingpin.Flag("update-max-evict-timeout", "Maximum timeout for evicting pods during update.").Default(defaultUpdateMaxEvictTimeout).DurationVar(&cfg.UpdateStrategy.MaxEvictTimeout)
-	kingpin.Flag("update-strategy", "Update strategy to use when updating node pools.").Default(defaultUpdateStrategy).EnumVar(&cfg.UpdateStrategy.Strategy, "rolling")
+	kingpin.Flag("update-namespace-eviction-interval", "Minimum interval between evictions of pods without a PodDisruptionBudget in the same namespace during update. 0 disables the limit.").Default(defaultUpdateNamespaceEvictionInterval).DurationVar(&cfg.UpdateStrategy.NamespaceEvictionInterval)
+	kingpin.Flag("update-canary-soak-period", "Time the canary nodes of node pools defining update_canary must stay healthy before the old nodes are replaced.").Default(defaultUpdateCanarySoakPeriod).DurationVar(&cfg.UpdateStrategy.CanarySoakPeriod)
+	kingpin.Flag("update-max-nodes-per-iteration", "Maximum number of nodes replaced per node pool and iteration, the update of larger node pools continues in the next iterations. 0 disables the limit.").Default(defaultUpdateMaxNodesPerIteration).IntVar(&cfg.UpdateStrategy.MaxNodesPerIteration)
+	kingpin.Flag("update-node-health-timeout", "Time the new nodes of a node pool may take to become ready, schedulable and run their DaemonSet pods before the update stops instead of terminating more old nodes. 0 disables the check.").Default(defaultUpdateNodeHealthTimeout).DurationVar(&cfg.UpdateStrategy.NodeHealthTimeout)
+	kingpin.Flag("update-max-unavailable", "Maximum number of nodes per node pool drained at the same time during update, limiting the surge. Node pools can override it with update_max_unavailable. 0 disables the limit.").Default(defaultUpdateMaxUnavailable).IntVar(&cfg.UpdateStrategy.MaxUnavailable)
+	kingpin.Flag("update-max-evictions-per-minute", "Maximum number of pods evicted per minute during the update of a cluster. 0 disables the limit.").Default(defaultUpdateMaxEvictionsPerMinute).IntVar(&cfg.UpdateStrategy.MaxEvictionsPerMinute)
+	kingpin.Flag("update-strategy", "Update strategy to use when updating node pools.").Default(defaultUpdateStrategy).EnumVar(&cfg.UpdateStrategy.Strategy, "rolling", "instance-refresh")
+	kingpin.Flag("update-instance-refresh-min-healthy-percentage", "Percentage of the nodes of a node pool which must stay in service during an instance refresh.").Default(defaultInstanceRefreshMinHealthy).IntVar(&cfg.UpdateStrategy.InstanceRefreshMinHealthyPercentage)
+	kingpin.Flag("update-instance-refresh-checkpoints", "Comma separated percentages of replaced nodes after which an instance refresh waits for the checkpoint delay, e.g. 20,50. Empty disables the checkpoints.").StringVar(&cfg.UpdateStrategy.InstanceRefreshCheckpoints)
+	kingpin.Flag("update-instance-refresh-checkpoint-delay", "Time an instance refresh waits at every checkpoint.").Default(defaultInstanceRefreshCheckpointDelay).DurationVar(&cfg.UpdateStrategy.InstanceRefreshCheckpointDelay)
+	kingpin.Flag("update-instance-refresh-instance-warmup", "Time after which a new instance is considered in service during an instance refresh. 0 uses the health check grace period of the node pool.").Default(defaultInstanceRefreshInstanceWarmup).DurationVar(&cfg.UpdateStrategy.InstanceRefreshInstanceWarmup)
 	kingpin.Flag("remove-volumes", "Remove EBS volumes when decommissioning").BoolVar(&cfg.RemoveVolumes)
+	kingpin.Flag("provisioner-hook", "Path of an executable run with the rendered stack templates and userdata of the AWS clusters, which can change them or veto the update. Can be repeated, the hooks are run in order.").StringsVar(&cfg.ProvisionerHooks)
+	kingpin.Flag("provisioner-policy", "Name of a built-in policy checking the rendered stack templates and userdata of the AWS clusters after the hooks: encrypted-volumes or no-public-ips. Can be repeated.").StringsVar(&cfg.ProvisionerPolicies)
+	kingpin.Flag("kubeconfig-provider", "How to reach the API servers of the clusters: registry URL and IAM token, a static kubeconfig file or a token stored in SSM.").Default(defaultKubeconfigProvider).EnumVar(&cfg.Kubeconfig.Provider, "registry", "static", "ssm")
+	kingpin.Flag("kubeconfig-file", "Path to the kubeconfig file used by the static kubeconfig provider. Contexts must be named after the cluster ID or alias.").StringVar(&cfg.Kubeconfig.File)
+	kingpin.Flag("kubeconfig-ssm-parameter", "Format of the SSM parameter name holding the cluster token, formatted with the local ID of the cluster.").Default(defaultKubeconfigSSMFormat).StringVar(&cfg.Kubeconfig.SSMParameterFormat)
+	kingpin.Flag("kubeconfig-ttl", "Duration after which tokens of the static and ssm kubeconfig providers are re-read to pick up rotated tokens.").Default(defaultKubeconfigTTL).DurationVar(&cfg.Kubeconfig.TTL)
+	kingpin.Flag("pricing-api-fallback", "Look up on-demand prices missing from the bundled instance info in the AWS Pricing API.").Default("true").BoolVar(&cfg.Pricing.APIFallback)
+	kingpin.Flag("pricing-cache-file", "Path to the file caching the prices looked up in the AWS Pricing API.").Default(defaultPricingCacheFile).StringVar(&cfg.Pricing.CacheFile)
+	kingpin.Flag("pricing-cache-ttl", "Duration for which prices looked up in the AWS Pricing API are cached.").Default(defaultPricingCacheTTL).DurationVar(&cfg.Pricing.CacheTTL)
+	kingpin.Flag("price-oracle-url", "URL of the price oracle returning the max price of the spot node pools with the price_oracle discount strategy. The node pool is posted as JSON.").StringVar(&cfg.Pricing.OracleURL)
+	kingpin.Flag("azure-tenant-id", "Azure AD tenant of the service principal used to provision Azure clusters.").Envar("AZURE_TENANT_ID").StringVar(&cfg.Azure.TenantID)
+	kingpin.Flag("azure-client-id", "Client ID of the service principal used to provision Azure clusters.").Envar("AZURE_CLIENT_ID").StringVar(&cfg.Azure.ClientID)
+	kingpin.Flag("gcp-service-account-key-file", "JSON key file of the service account used to provision GCP clusters.").Envar("GOOGLE_APPLICATION_CREDENTIALS").StringVar(&cfg.GCP.ServiceAccountKeyFile)
+	kingpin.Flag("azure-client-secret", "Client secret of the service principal used to provision Azure clusters.").Envar("AZURE_CLIENT_SECRET").StringVar(&cfg.Azure.ClientSecret)
+	kingpin.Flag("lock-table", "DynamoDB table with the string partition key cluster_id holding the locks of the clusters, such that concurrent instances don't provision the same cluster. Clusters aren't locked if empty.").StringVar(&cfg.Lock.Table)
+	kingpin.Flag("lock-holder", "Identity of the instance in the locks it holds. Defaults to the hostname and process ID.").StringVar(&cfg.Lock.Holder)
+	kingpin.Flag("lock-ttl", "Duration after which the lock of a cluster expires unless it's renewed by its holder.").Default(defaultLockTTL).DurationVar(&cfg.Lock.TTL)
+	kingpin.Flag("force-unlock", "Release the locks of the clusters before provisioning them, regardless of their holder. Only use it if the holder is known to be gone.").BoolVar(&cfg.Lock.ForceUnlock)
+	kingpin.Flag("notification-slack-webhook", "URL of a Slack incoming webhook the controller posts the lifecycle events of the clusters to. Can be repeated.").StringsVar(&cfg.Notifications.SlackWebhooks)
+	kingpin.Flag("notification-webhook", "URL the controller posts the lifecycle events of the clusters to as JSON. Can be repeated.").StringsVar(&cfg.Notifications.Webhooks)
+	kingpin.Flag("notification-sns-topic", "ARN of an SNS topic the controller publishes the lifecycle events of the clusters to. Can be repeated.").StringsVar(&cfg.Notifications.SNSTopics)
+	kingpin.Flag("notification-template", "Go template of the notification messages, with the fields Type, ClusterID, ClusterAlias, Channel, ChannelVersion, NodePool, Message and Time. Defaults to a summary of all fields.").StringVar(&cfg.Notifications.Template)
+	kingpin.Flag("audit-log-file", "Path of a file the actions changing the resources of the clusters are appended to as JSON lines. An existing file is continued.").StringVar(&cfg.Audit.File)
+	kingpin.Flag("audit-s3-location", "S3 location the actions changing the resources of the clusters are written to as JSON objects, e.g. s3://bucket/audit.").StringVar(&cfg.Audit.S3Location)
+	kingpin.Flag("audit-cloudwatch-log-group", "CloudWatch Logs log group the actions changing the resources of the clusters are written to as JSON events.").StringVar(&cfg.Audit.CloudWatchLogGroup)
+	kingpin.Flag("audit-actor", "Actor recorded in the audit records. Defaults to the hostname and process ID.").StringVar(&cfg.Audit.Actor)
+	kingpin.Flag("rollout-bake-time", "Time the clusters of a rollout wave must run a new channel version without problems before the clusters of the next wave are updated to it.").Default(defaultRolloutBakeTime).DurationVar(&cfg.Rollout.BakeTime)
+	kingpin.Flag("rollout-max-failures", "Number of clusters failing to update to a channel version which halts its rollout to the remaining clusters. 0 never halts it.").Default(defaultRolloutMaxFailures).UintVar(&cfg.Rollout.MaxFailures)
+	kingpin.Flag("shutdown-timeout", "Time the controller waits on shutdown for the running updates to checkpoint their progress and stop. Interrupted updates resume from their last checkpoint after the restart.").Default(defaultShutdownTimeout).DurationVar(&cfg.ShutdownTimeout)
+	kingpin.Flag("tracing-otlp-endpoint", "Host and port of an OTLP/HTTP collector the traces of the cluster updates, node pool updates, stack operations and AWS API calls are exported to. Traces aren't exported if empty.").StringVar(&cfg.Tracing.OTLPEndpoint)
+	kingpin.Flag("tracing-insecure", "Connect to the OTLP collector without TLS.").BoolVar(&cfg.Tracing.Insecure)
+	kingpin.Flag("tracing-sample-ratio", "Ratio of the cluster updates traced, between 0 and 1.").Default(defaultTracingSampleRatio).Float64Var(&cfg.Tracing.SampleRatio)
 	return kingpin.Parse()
 }
@@ -1,6 +1,10 @@
 package controller
 
 import (
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"fmt"
 	"sync"
 	"time"
 
@@ -12,30 +16,64 @@ import (
 
 const (
 	updatePriorityNormal = iota
+	updatePriorityUpdate
 	updatePriorityDecommissionRequested
-	updatePriorityAlreadyUpdating
 )
 
 type clusterInfo struct {
 	lastProcessed time.Time
 	processing    bool
 	cluster       *api.Cluster
+	// spec is the fingerprint of the cluster in the registry, excluding
+	// its status, and processedSpec the one it had when it was last
+	// processed, such that changes made in the registry since then can be
+	// prioritized.
+	spec          string
+	processedSpec string
 }
 
-// ClusterList maintains the state of all active clusters
+// ClusterList maintains the state of all active clusters. It's the work
+// queue of the controller: clusters are processed by priority, a cluster is
+// never processed by multiple workers at the same time and clusters without
+// changes in the registry are processed at most once per interval.
 type ClusterList struct {
 	sync.Mutex
 	accountFilter config.IncludeExcludeFilter
+	interval      time.Duration
 	clusters      map[string]*clusterInfo
+	// changed is closed and replaced whenever clusters are added, updated
+	// or finished processing, waking up the workers waiting for clusters.
+	changed chan struct{}
 }
 
-func NewClusterList(accountFilter config.IncludeExcludeFilter) *ClusterList {
+func NewClusterList(accountFilter config.IncludeExcludeFilter, interval time.Duration) *ClusterList {
 	return &ClusterList{
 		accountFilter: accountFilter,
+		interval:      interval,
 		clusters:      make(map[string]*clusterInfo),
+		changed:       make(chan struct{}),
 	}
 }
 
+// clusterSpec returns the fingerprint of a cluster excluding its status,
+// which the controller updates itself.
+func clusterSpec(cluster *api.Cluster) string {
+	spec := *cluster
+	spec.Status = nil
+
+	data, err := json.Marshal(&spec)
+	if err != nil {
+		return ""
+	}
+	return fmt.Sprintf("%x", sha256.Sum256(data))
+}
+
+// notify wakes up the workers waiting for clusters. The list must be locked.
+func (clusterList *ClusterList) notify() {
+	close(clusterList.changed)
+	clusterList.changed = make(chan struct{})
+}
+
 // UpdateAvailable adds new clusters to the list, updates the cluster data for existing ones and removes clusters
 // that are no longer active
 func (clusterList *ClusterList) UpdateAvailable(availableClusters []*api.Cluster) {
@@ -60,12 +98,14 @@ func (clusterList *ClusterList) UpdateAvailable(availableClusters []*api.Cluster
 		if existing, ok := clusterList.clusters[cluster.ID]; ok {
 			if !existing.processing {
 				existing.cluster = cluster
+				existing.spec = clusterSpec(cluster)
 			}
 		} else {
 			clusterList.clusters[cluster.ID] = &clusterInfo{
 				lastProcessed: time.Unix(0, 0),
 				processing:    false,
 				cluster:       cluster,
+				spec:          clusterSpec(cluster),
 			}
 		}
 	}
@@ -81,54 +121,122 @@ func (clusterList *ClusterList) UpdateAvailable(availableClusters []*api.Cluster
 			delete(clusterList.clusters, id)
 		}
 	}
+
+	clusterList.notify()
 }
 
 // updatePriority returns the update priority of the clusters. Clusters with higher priority will always be selected
-// for update before clusters with lower priority.
-func updatePriority(cluster *api.Cluster) uint32 {
-	if cluster.Status.NextVersion != "" && cluster.Status.NextVersion != cluster.Status.CurrentVersion {
-		return updatePriorityAlreadyUpdating
-	}
-	if cluster.LifecycleStatus == statusDecommissionRequested {
+// for update before clusters with lower priority: clusters requested to be decommissioned first, then clusters with
+// a pending update, a requested lifecycle change or changes in the registry since they were last processed, and
+// finally all other clusters.
+func updatePriority(cluster *clusterInfo) uint32 {
+	switch cluster.cluster.LifecycleStatus {
+	case statusDecommissionRequested:
 		return updatePriorityDecommissionRequested
+	case statusRequested, statusSuspendRequested, statusResumeRequested:
+		return updatePriorityUpdate
+	}
+
+	status := cluster.cluster.Status
+	if status != nil && status.NextVersion != "" && status.NextVersion != status.CurrentVersion {
+		return updatePriorityUpdate
+	}
+
+	if cluster.processedSpec != "" && cluster.spec != cluster.processedSpec {
+		return updatePriorityUpdate
 	}
 	return updatePriorityNormal
 }
 
 // SelectNext returns the next cluster of update, if any, and marks it as being processed. A cluster with higher
 // priority will be selected first, in case of ties it'll select a cluster that hasn't been updated for the longest
-// time.
+// time. Clusters are only selected if they weren't processed within the interval or were changed in the registry since.
 func (clusterList *ClusterList) SelectNext() *api.Cluster {
 	clusterList.Lock()
 	defer clusterList.Unlock()
 
+	next, _ := clusterList.selectNext(time.Now())
+	return next
+}
+
+// Next waits until a cluster can be processed and returns it like
+// SelectNext. It returns nil once the context is done.
+func (clusterList *ClusterList) Next(ctx context.Context) *api.Cluster {
+	for {
+		clusterList.Lock()
+		next, wait := clusterList.selectNext(time.Now())
+		changed := clusterList.changed
+		clusterList.Unlock()
+
+		if next != nil {
+			return next
+		}
+
+		// wait until a cluster becomes due or the list changes.
+		var due <-chan time.Time
+		var timer *time.Timer
+		if wait > 0 {
+			timer = time.NewTimer(wait)
+			due = timer.C
+		}
+
+		select {
+		case <-changed:
+		case <-due:
+		case <-ctx.Done():
+		}
+
+		if timer != nil {
+			timer.Stop()
+		}
+
+		if ctx.Err() != nil {
+			return nil
+		}
+	}
+}
+
+// selectNext selects the next cluster at the specified time and marks it as
+// being processed. If none of the clusters can be processed, the time until
+// the next cluster becomes due is returned, or 0 if no cluster becomes due
+// before the list changes. The list must be locked.
+func (clusterList *ClusterList) selectNext(now time.Time) (*api.Cluster, time.Duration) {
 	var nextCluster *clusterInfo
 	var nextClusterPriority uint32
+	var wait time.Duration
 
 	for _, cluster := range clusterList.clusters {
 		if cluster.processing {
 			continue
 		}
 
-		if nextCluster == nil {
-			nextCluster = cluster
-			nextClusterPriority = updatePriority(cluster.cluster)
-		} else {
-			priority := updatePriority(cluster.cluster)
-
-			if priority > nextClusterPriority || (priority == nextClusterPriority && cluster.lastProcessed.Before(nextCluster.lastProcessed)) {
-				nextCluster = cluster
-				nextClusterPriority = priority
+		// clusters are processed at most once per interval, unless they
+		// were changed in the registry since, such that clusters failing
+		// to update aren't retried continuously.
+		priority := updatePriority(cluster)
+		changed := cluster.processedSpec != "" && cluster.spec != cluster.processedSpec
+		if !changed {
+			due := cluster.lastProcessed.Add(clusterList.interval).Sub(now)
+			if due > 0 {
+				if wait == 0 || due < wait {
+					wait = due
+				}
+				continue
 			}
 		}
+
+		if nextCluster == nil || priority > nextClusterPriority || (priority == nextClusterPriority && cluster.lastProcessed.Before(nextCluster.lastProcessed)) {
+			nextCluster = cluster
+			nextClusterPriority = priority
+		}
 	}
 
 	if nextCluster == nil {
-		return nil
+		return nil, wait
 	}
 
 	nextCluster.processing = true
-	return nextCluster.cluster
+	return nextCluster.cluster, 0
 }
 
 // ClusterProcessed marks a cluster as no longer being processed.
@@ -139,5 +247,50 @@ func (clusterList *ClusterList) ClusterProcessed(id string) {
 	if cluster, ok := clusterList.clusters[id]; ok {
 		cluster.processing = false
 		cluster.lastProcessed = time.Now()
+		cluster.processedSpec = cluster.spec
 	}
+
+	clusterList.notify()
+}
+
+// Acquire marks the cluster with the ID or alias as being processed outside
+// of the workers, such that no worker selects it until it's released. It
+// returns nil if the cluster isn't in the list and false if it's already
+// being processed.
+func (clusterList *ClusterList) Acquire(idOrAlias string) (*api.Cluster, bool) {
+	clusterList.Lock()
+	defer clusterList.Unlock()
+
+	cluster, ok := clusterList.clusters[idOrAlias]
+	if !ok {
+		for _, info := range clusterList.clusters {
+			if info.cluster.Alias == idOrAlias {
+				cluster = info
+				break
+			}
+		}
+	}
+	if cluster == nil {
+		return nil, false
+	}
+	if cluster.processing {
+		return cluster.cluster, false
+	}
+
+	cluster.processing = true
+	return cluster.cluster, true
+}
+
+// Release marks a cluster acquired with Acquire as no longer being
+// processed. Unlike ClusterProcessed, it doesn't count as processing the
+// cluster, so it doesn't delay its next update.
+func (clusterList *ClusterList) Release(id string) {
+	clusterList.Lock()
+	defer clusterList.Unlock()
+
+	if cluster, ok := clusterList.clusters[id]; ok {
+		cluster.processing = false
+	}
+
+	clusterList.notify()
 }
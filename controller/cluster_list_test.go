@@ -1,9 +1,11 @@
 package controller
 
 import (
+	"context"
 	"regexp"
 	"sort"
 	"testing"
+	"time"
 
 	"github.com/stretchr/testify/assert"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
@@ -80,7 +82,7 @@ func TestUpdateIgnoresClusters(t *testing.T) {
 			ignored: true,
 		},
 	} {
-		clusterList := NewClusterList(filter)
+		clusterList := NewClusterList(filter, 0)
 		clusterList.UpdateAvailable([]*api.Cluster{ti.cluster})
 		nextCluster := clusterList.SelectNext()
 		if ti.ignored {
@@ -120,7 +122,7 @@ func TestUpdateAddsNewClusters(t *testing.T) {
 		Status:                mockStatus,
 	}
 
-	clusterList := NewClusterList(config.DefaultFilter)
+	clusterList := NewClusterList(config.DefaultFilter, 0)
 
 	// No clusters yet
 	assert.Nil(t, clusterList.SelectNext())
@@ -142,7 +144,7 @@ func TestUpdateUpdatesExistingClusters(t *testing.T) {
 		Status:                mockStatus,
 	}
 
-	clusterList := NewClusterList(config.DefaultFilter)
+	clusterList := NewClusterList(config.DefaultFilter, 0)
 
 	clusterList.UpdateAvailable([]*api.Cluster{cluster})
 	assert.Equal(t, cluster.LifecycleStatus, clusterList.SelectNext().LifecycleStatus)
@@ -180,7 +182,7 @@ func TestUpdateDeletesUnusedClusters(t *testing.T) {
 		Status:                mockStatus,
 	}
 
-	clusterList := NewClusterList(config.DefaultFilter)
+	clusterList := NewClusterList(config.DefaultFilter, 0)
 
 	clusterList.UpdateAvailable([]*api.Cluster{cluster1, cluster2})
 	assert.Equal(t, []string{cluster1.ID, cluster2.ID}, sortedStrings(allClusterIds(clusterList)))
@@ -226,19 +228,19 @@ func TestClusterPriority(t *testing.T) {
 		{pendingUpdate, normal, decommissionRequested},
 		{pendingUpdate, decommissionRequested, normal},
 	} {
-		clusterList := NewClusterList(config.DefaultFilter)
+		clusterList := NewClusterList(config.DefaultFilter, 0)
 
 		clusterList.UpdateAvailable(clusters)
-		assert.Equal(t, []string{pendingUpdate.ID, decommissionRequested.ID, normal.ID}, allClusterIds(clusterList))
+		assert.Equal(t, []string{decommissionRequested.ID, pendingUpdate.ID, normal.ID}, allClusterIds(clusterList))
 
 		// add normal2, it should now be updated before normal1
 		clusterList.UpdateAvailable(append(clusters, normal2))
-		assert.Equal(t, []string{pendingUpdate.ID, decommissionRequested.ID, normal2.ID, normal.ID}, allClusterIds(clusterList))
+		assert.Equal(t, []string{decommissionRequested.ID, pendingUpdate.ID, normal2.ID, normal.ID}, allClusterIds(clusterList))
 	}
 }
 
 func TestClusterLastUpdated(t *testing.T) {
-	clusterList := NewClusterList(config.DefaultFilter)
+	clusterList := NewClusterList(config.DefaultFilter, 0)
 	clusterList.UpdateAvailable([]*api.Cluster{
 		{
 			ID: "aws:123456789011:eu-central-1:cluster1",
@@ -282,7 +284,7 @@ func TestProcessingClusterNotDeleted(t *testing.T) {
 		Status:                mockStatus,
 	}
 
-	clusterList := NewClusterList(config.DefaultFilter)
+	clusterList := NewClusterList(config.DefaultFilter, 0)
 	clusterList.UpdateAvailable([]*api.Cluster{cluster})
 	assert.Equal(t, cluster.ID, clusterList.SelectNext().ID)
 
@@ -306,7 +308,7 @@ func TestProcessingClusterNotUpdated(t *testing.T) {
 		Status:                mockStatus,
 	}
 
-	clusterList := NewClusterList(config.DefaultFilter)
+	clusterList := NewClusterList(config.DefaultFilter, 0)
 	clusterList.UpdateAvailable([]*api.Cluster{cluster})
 	assert.Equal(t, cluster.ID, clusterList.SelectNext().ID)
 
@@ -323,3 +325,64 @@ func TestProcessingClusterNotUpdated(t *testing.T) {
 	// cluster should not be overwritten
 	assert.Equal(t, cluster.LifecycleStatus, clusterList.SelectNext().LifecycleStatus)
 }
+
+func TestClusterInterval(t *testing.T) {
+	normal := &api.Cluster{
+		ID:                    "aws:123456789011:eu-central-1:normal",
+		InfrastructureAccount: "aws:123456789011",
+		LifecycleStatus:       "ready",
+		Status:                mockStatus,
+	}
+	requested := &api.Cluster{
+		ID:                    "aws:123456789012:eu-central-1:requested",
+		InfrastructureAccount: "aws:123456789012",
+		LifecycleStatus:       "requested",
+		Status:                mockStatus,
+	}
+
+	clusterList := NewClusterList(config.DefaultFilter, time.Hour)
+	clusterList.UpdateAvailable([]*api.Cluster{normal, requested})
+	assert.Equal(t, []string{requested.ID, normal.ID}, allClusterIds(clusterList))
+
+	// clusters aren't processed again within the interval, even if their
+	// update is still pending.
+	assert.Empty(t, allClusterIds(clusterList))
+
+	// unless they were changed in the registry since they were processed.
+	changed := *normal
+	changed.ConfigItems = map[string]string{"foo": "bar"}
+	clusterList.UpdateAvailable([]*api.Cluster{&changed, requested})
+	assert.Equal(t, []string{changed.ID}, allClusterIds(clusterList))
+	assert.Empty(t, allClusterIds(clusterList))
+}
+
+func TestClusterNext(t *testing.T) {
+	cluster := &api.Cluster{
+		ID:                    "aws:123456789011:eu-central-1:cluster1",
+		InfrastructureAccount: "aws:123456789011",
+		LifecycleStatus:       "ready",
+		Status:                mockStatus,
+	}
+
+	clusterList := NewClusterList(config.DefaultFilter, time.Hour)
+
+	// workers are woken up when clusters are added.
+	next := make(chan *api.Cluster)
+	go func() {
+		next <- clusterList.Next(context.Background())
+	}()
+	clusterList.UpdateAvailable([]*api.Cluster{cluster})
+
+	select {
+	case selected := <-next:
+		assert.Equal(t, cluster.ID, selected.ID)
+	case <-time.After(5 * time.Second):
+		t.Fatal("cluster wasn't selected")
+	}
+	clusterList.ClusterProcessed(cluster.ID)
+
+	// the cluster isn't due again within the interval.
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	assert.Nil(t, clusterList.Next(ctx))
+}
@@ -2,6 +2,8 @@ package controller
 
 import (
 	"context"
+	"fmt"
+	"sync"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -9,13 +11,18 @@ import (
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/decrypter"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/notifier"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/tracing"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/provisioner"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/registry"
 )
 
 const (
-	errTypeGeneral = "https://cluster-lifecycle-manager.zalando.org/problems/general-error"
+	errTypeGeneral   = "https://cluster-lifecycle-manager.zalando.org/problems/general-error"
+	errTypeNodePool  = "https://cluster-lifecycle-manager.zalando.org/problems/node-pool-error"
+	errTypePreflight = "https://cluster-lifecycle-manager.zalando.org/problems/preflight-error"
 )
 
 var (
@@ -23,6 +30,9 @@ var (
 	statusReady                 = "ready"
 	statusDecommissionRequested = "decommission-requested"
 	statusDecommissioned        = "decommissioned"
+	statusSuspendRequested      = "suspend-requested"
+	statusSuspended             = "suspended"
+	statusResumeRequested       = "resume-requested"
 )
 
 // Options are options which can be used to configure the controller when it is
@@ -31,8 +41,28 @@ type Options struct {
 	Interval          time.Duration
 	AccountFilter     config.IncludeExcludeFilter
 	DryRun            bool
+	ReadOnly          bool
 	SecretDecrypter   decrypter.SecretDecrypter
 	ConcurrentUpdates uint
+	// Version is the version of the CLM checked against the CLM versions
+	// supported by the channels.
+	Version string
+	// Notifier is notified about the lifecycle events of the clusters.
+	// Events aren't sent if it's nil.
+	Notifier *notifier.Notifier
+	// RolloutBakeTime is how long the clusters of a rollout wave must run
+	// a new channel version before the next wave is updated to it.
+	RolloutBakeTime time.Duration
+	// RolloutMaxFailures is the number of clusters failing to update to a
+	// channel version which halts its rollout. 0 never halts it.
+	RolloutMaxFailures uint
+	// ShutdownTimeout is how long Run waits for the running updates to
+	// checkpoint their progress and stop once its context is canceled.
+	ShutdownTimeout time.Duration
+	// Locker locks the clusters scaled by the scale handler, such that
+	// other instances don't update them concurrently. Clusters aren't
+	// locked if it's nil.
+	Locker provisioner.ClusterLocker
 }
 
 // Controller defines the main control loop for the cluster-lifecycle-manager.
@@ -43,8 +73,16 @@ type Controller struct {
 	secretDecrypter      decrypter.SecretDecrypter
 	interval             time.Duration
 	dryRun               bool
+	readOnly             bool
 	clusterList          *ClusterList
 	concurrentUpdates    uint
+	version              string
+	notifier             *notifier.Notifier
+	status               *statusTracker
+	rollout              *rollout
+	shutdownTimeout      time.Duration
+	locker               provisioner.ClusterLocker
+	workers              sync.WaitGroup
 }
 
 // New initializes a new controller.
@@ -55,19 +93,33 @@ func New(registry registry.Registry, provisioner provisioner.Provisioner, channe
 		channelConfigSourcer: channelConfigSourcer,
 		secretDecrypter:      options.SecretDecrypter,
 		interval:             options.Interval,
-		dryRun:               options.DryRun,
-		clusterList:          NewClusterList(options.AccountFilter),
+		dryRun:               options.DryRun || options.ReadOnly,
+		readOnly:             options.ReadOnly,
+		clusterList:          NewClusterList(options.AccountFilter, options.Interval),
 		concurrentUpdates:    options.ConcurrentUpdates,
+		version:              options.Version,
+		notifier:             options.Notifier,
+		status:               newStatusTracker(),
+		rollout:              newRollout(options.RolloutBakeTime, options.RolloutMaxFailures),
+		shutdownTimeout:      options.ShutdownTimeout,
+		locker:               options.Locker,
 	}
 }
 
-// Run the main controller loop.
+// Run the main controller loop. Once ctx is canceled it waits up to the
+// shutdown timeout for the running updates to stop, such that they resume
+// from their last checkpoint after a restart.
 func (c *Controller) Run(ctx context.Context) {
 	log.Info("Starting main control loop.")
 
-	// Start the update workers
+	// Start the update workers, which process the clusters of the list
+	// as they become due.
 	for i := uint(0); i < c.concurrentUpdates; i++ {
-		go c.processWorkerLoop(ctx, i+1)
+		c.workers.Add(1)
+		go func(workerNum uint) {
+			defer c.workers.Done()
+			c.processWorkerLoop(ctx, workerNum)
+		}(i + 1)
 	}
 
 	var interval time.Duration
@@ -84,22 +136,36 @@ func (c *Controller) Run(ctx context.Context) {
 			log.Infof("Sleeping (%s) until next check", c.interval)
 		case <-ctx.Done():
 			log.Info("Terminating main controller loop.")
+			c.waitForWorkers()
 			return
 		}
 	}
 }
 
+// waitForWorkers waits up to the shutdown timeout for the update workers to
+// stop.
+func (c *Controller) waitForWorkers() {
+	done := make(chan struct{})
+	go func() {
+		c.workers.Wait()
+		close(done)
+	}()
+
+	select {
+	case <-done:
+		log.Info("All update workers stopped.")
+	case <-time.After(c.shutdownTimeout):
+		log.Warnf("Update workers didn't stop within %s, the interrupted updates are resumed after the restart.", c.shutdownTimeout)
+	}
+}
+
 func (c *Controller) processWorkerLoop(ctx context.Context, workerNum uint) {
 	for {
-		select {
-		case <-time.After(c.interval):
-			nextCluster := c.clusterList.SelectNext()
-			if nextCluster != nil {
-				c.processCluster(workerNum, nextCluster)
-			}
-		case <-ctx.Done():
+		nextCluster := c.clusterList.Next(ctx)
+		if nextCluster == nil {
 			return
 		}
+		c.processCluster(ctx, workerNum, nextCluster)
 	}
 }
 
@@ -115,23 +181,33 @@ func (c *Controller) refresh() error {
 		return err
 	}
 
+	c.rollout.update(clusters)
 	c.clusterList.UpdateAvailable(clusters)
 	return nil
 }
 
 // doProcessCluster checks if an action needs to be taken depending on the
 // cluster state and triggers the provisioner accordingly.
-func (c *Controller) doProcessCluster(cluster *api.Cluster) error {
+func (c *Controller) doProcessCluster(ctx context.Context, cluster *api.Cluster) error {
 	if cluster.Status == nil {
 		cluster.Status = &api.ClusterStatus{}
 	}
 
-	config, err := c.channelConfigSourcer.Get(cluster.Channel)
+	// pinned clusters are provisioned with the pinned version instead of
+	// the latest version of their channel.
+	config, err := c.channelConfigSourcer.Get(cluster.ChannelRef())
 	if err != nil {
 		return err
 	}
 	defer c.channelConfigSourcer.Delete(config)
 
+	// fail before rendering anything if the channel requires a different
+	// CLM version.
+	err = config.CheckCompatibility(c.version)
+	if err != nil {
+		return err
+	}
+
 	// decrypt any encrypted config items.
 	err = c.decryptConfigItems(cluster)
 	if err != nil {
@@ -147,11 +223,40 @@ func (c *Controller) doProcessCluster(cluster *api.Cluster) error {
 		}
 
 		// don't continue if the status is ready and the version is
-		// already the latest.
+		// already the latest, but reconcile the state which changes
+		// without an update, e.g. the startup taint of new nodes.
 		if cluster.LifecycleStatus == statusReady && cluster.Status.CurrentVersion == nextVersion {
+			err = c.provisioner.Reconcile(ctx, cluster, config)
 			break
 		}
 
+		// new channel versions are rolled out to the clusters of a
+		// channel wave by wave.
+		if cluster.LifecycleStatus == statusReady {
+			var reason string
+			reason, err = c.rollout.blocked(cluster, config.Version, time.Now())
+			if err != nil {
+				return err
+			}
+			if reason != "" {
+				log.WithField("cluster", cluster.Alias).Infof("Deferring update to version %s: %s", nextVersion, reason)
+				err = c.provisioner.Reconcile(ctx, cluster, config)
+				break
+			}
+		}
+
+		// fail before changing anything if the cluster can't be
+		// provisioned.
+		var report *provisioner.PreflightReport
+		report, err = c.provisioner.Preflight(cluster, config)
+		if err != nil {
+			return err
+		}
+		err = report.Err()
+		if err != nil {
+			return err
+		}
+
 		cluster.Status.NextVersion = nextVersion
 		if !c.dryRun {
 			err = c.registry.UpdateCluster(cluster)
@@ -160,17 +265,44 @@ func (c *Controller) doProcessCluster(cluster *api.Cluster) error {
 			}
 		}
 
-		err = c.provisioner.Provision(cluster, config)
+		eventCtx := api.WithEvents(ctx, c.reportEvent(cluster, config))
+		api.ReportEvent(eventCtx, api.EventUpdateStarted, "", fmt.Sprintf("Updating cluster to version %s", nextVersion))
+
+		summary := api.NewUpdateSummary(cluster.Status.LastUpdate)
+		provisionCtx := api.WithPauseCheck(api.WithProgress(eventCtx, c.reportProgress(cluster)), c.updatesPaused(cluster))
+		err = c.provisioner.Provision(api.WithUpdateSummary(provisionCtx, summary), cluster, config)
+		cluster.Status.Progress = nil
+		summary.Finish(err)
+		cluster.Status.LastUpdate = summary
+		logUpdateSummary(log.WithField("cluster", cluster.Alias), summary)
 		if err == nil {
+			api.ReportEvent(eventCtx, api.EventUpdateSucceeded, "", fmt.Sprintf("Updated cluster to version %s", nextVersion))
+
 			cluster.LifecycleStatus = statusReady
 
 			cluster.Status.LastVersion = cluster.Status.CurrentVersion
 			cluster.Status.CurrentVersion = cluster.Status.NextVersion
 			cluster.Status.NextVersion = ""
 			cluster.Status.Problems = []*api.Problem{}
+		} else {
+			api.ReportEvent(eventCtx, api.EventUpdateFailed, "", fmt.Sprintf("Failed to update cluster to version %s: %v", nextVersion, err))
 		}
 	case statusDecommissionRequested:
-		err = c.provisioner.Decommission(cluster, config)
+		if c.readOnly {
+			log.WithField("cluster", cluster.Alias).Info("Read-only mode, skipping decommission")
+			break
+		}
+		var allowed bool
+		allowed, err = maintenanceAllowed(cluster.ConfigItems, time.Now())
+		if err != nil {
+			return err
+		}
+		if !allowed {
+			log.WithField("cluster", cluster.Alias).Info("Outside of the maintenance windows, deferring decommission")
+			break
+		}
+		err = c.provisioner.Decommission(api.WithProgress(ctx, c.reportProgress(cluster)), cluster, config)
+		cluster.Status.Progress = nil
 		if err == nil {
 			cluster.Status.LastVersion = cluster.Status.CurrentVersion
 			cluster.Status.CurrentVersion = ""
@@ -178,19 +310,154 @@ func (c *Controller) doProcessCluster(cluster *api.Cluster) error {
 			cluster.Status.Problems = []*api.Problem{}
 			cluster.LifecycleStatus = statusDecommissioned
 		}
+	case statusSuspendRequested:
+		if c.readOnly {
+			log.WithField("cluster", cluster.Alias).Info("Read-only mode, skipping suspension")
+			break
+		}
+		err = c.provisioner.Suspend(ctx, cluster, config)
+		if err == nil {
+			cluster.LifecycleStatus = statusSuspended
+		}
+	case statusResumeRequested:
+		if c.readOnly {
+			log.WithField("cluster", cluster.Alias).Info("Read-only mode, skipping resumption")
+			break
+		}
+		// the cluster is updated to the latest version in the next
+		// iteration if the channel changed while it was suspended.
+		err = c.provisioner.Resume(ctx, cluster, config)
+		if err == nil {
+			cluster.LifecycleStatus = statusReady
+		}
 	}
 
 	return err
 }
 
+// reportProgress returns a function storing the provisioning progress in the
+// status of the cluster and pushing it to the registry.
+func (c *Controller) reportProgress(cluster *api.Cluster) api.ProgressFunc {
+	return func(progress *api.Progress) {
+		log.WithField("cluster", cluster.Alias).Debugf("Provisioning step %s: %s", progress.Step, progress.Message)
+
+		cluster.Status.Progress = progress
+		c.status.progress(cluster, progress)
+		if c.dryRun {
+			return
+		}
+
+		err := c.registry.UpdateCluster(cluster)
+		if err != nil {
+			log.WithField("cluster", cluster.Alias).Warnf("Unable to report provisioning progress: %v", err)
+		}
+	}
+}
+
+// reportEvent returns a function sending the lifecycle events of the cluster
+// to the notifier, along with the channel and its version the cluster is
+// processed with. Events aren't sent in dry run mode.
+func (c *Controller) reportEvent(cluster *api.Cluster, channelConfig *channel.Config) api.EventFunc {
+	return func(event *api.Event) {
+		log.WithField("cluster", cluster.Alias).Infof("Lifecycle event %s: %s", event.Type, event.Message)
+		if c.dryRun {
+			return
+		}
+
+		c.notifier.Notify(&notifier.Notification{
+			Type:           event.Type,
+			ClusterID:      cluster.ID,
+			ClusterAlias:   cluster.Alias,
+			Channel:        cluster.Channel,
+			ChannelVersion: channelConfig.Version,
+			NodePool:       event.NodePool,
+			Message:        event.Message,
+			Time:           event.Time,
+		})
+	}
+}
+
+// updatesPaused returns a function checking whether the updates of the
+// cluster were paused in the registry since it started processing, such that
+// node churn can be stopped during an ongoing update.
+func (c *Controller) updatesPaused(cluster *api.Cluster) api.PauseFunc {
+	return func() (bool, error) {
+		current, err := c.registry.GetCluster(cluster.ID)
+		if err != nil {
+			if err == registry.ErrClusterNotFound {
+				return false, nil
+			}
+			return false, err
+		}
+
+		paused, err := c.secretDecrypter.Decrypt(current.ConfigItems[api.UpdatePausedConfigItem])
+		if err != nil {
+			return false, err
+		}
+		if paused == "true" {
+			return true, nil
+		}
+
+		// node pools are only rolled within the maintenance windows.
+		configItems := make(map[string]string)
+		for _, key := range []string{api.MaintenanceWindowsConfigItem, api.MaintenanceTimezoneConfigItem, api.MaintenanceOverrideConfigItem} {
+			configItems[key], err = c.secretDecrypter.Decrypt(current.ConfigItems[key])
+			if err != nil {
+				return false, err
+			}
+		}
+
+		allowed, err := maintenanceAllowed(configItems, time.Now())
+		if err != nil {
+			return false, err
+		}
+		return !allowed, nil
+	}
+}
+
+// maintenanceAllowed returns true if node-disruptive operations of a cluster
+// with the specified decrypted config items are allowed at the specified
+// time. They're allowed at any time for clusters without maintenance windows
+// or with the maintenance override.
+func maintenanceAllowed(configItems map[string]string, now time.Time) (bool, error) {
+	if configItems[api.MaintenanceOverrideConfigItem] == "true" {
+		return true, nil
+	}
+
+	windows, err := api.ParseMaintenanceWindows(configItems[api.MaintenanceWindowsConfigItem], configItems[api.MaintenanceTimezoneConfigItem])
+	if err != nil {
+		return false, err
+	}
+	return len(windows) == 0 || windows.Open(now), nil
+}
+
 // processCluster calls doProcessCluster and handles logging and reporting
-func (c *Controller) processCluster(workerNum uint, cluster *api.Cluster) {
+func (c *Controller) processCluster(ctx context.Context, workerNum uint, cluster *api.Cluster) {
 	defer c.clusterList.ClusterProcessed(cluster.ID)
 	clusterLog := log.WithField("cluster", cluster.Alias).WithField("worker", workerNum)
 
 	clusterLog.Infof("Processing cluster (%s)", cluster.LifecycleStatus)
 
-	err := c.doProcessCluster(cluster)
+	c.status.start(workerNum, cluster)
+
+	// the cluster is the root span of the trace of an update, the
+	// provisioner adds the node pools, stacks and node replacements.
+	spanCtx, span := tracing.Start(ctx, "cluster.process",
+		tracing.String("cluster.id", cluster.ID),
+		tracing.String("cluster.alias", cluster.Alias),
+		tracing.String("cluster.lifecycle_status", cluster.LifecycleStatus),
+		tracing.String("cluster.channel", cluster.Channel),
+	)
+	err := c.doProcessCluster(spanCtx, cluster)
+
+	// a cluster locked by another instance is being processed by it, so
+	// its state in the registry is left to the lock holder.
+	if _, ok := err.(*awsExt.LockHeldError); ok {
+		clusterLog.Infof("Skipping cluster: %v", err)
+		tracing.End(span, nil)
+		c.status.finish(cluster, nil)
+		return
+	}
 
 	// log the error and resolve the special error cases
 	if err != nil {
@@ -203,6 +470,15 @@ func (c *Controller) processCluster(workerNum uint, cluster *api.Cluster) {
 	} else {
 		clusterLog.Infof("Finished processing cluster")
 	}
+	tracing.End(span, err)
+	c.status.finish(cluster, err)
+
+	// updates interrupted by the shutdown aren't problems of the
+	// cluster, they're resumed after the restart.
+	if err != nil && ctx.Err() != nil {
+		clusterLog.Infof("Update interrupted by shutdown, resuming it after the restart")
+		return
+	}
 
 	// update the cluster state in the registry
 	if !c.dryRun {
@@ -210,10 +486,7 @@ func (c *Controller) processCluster(workerNum uint, cluster *api.Cluster) {
 			if cluster.Status.Problems == nil {
 				cluster.Status.Problems = make([]*api.Problem, 0, 1)
 			}
-			cluster.Status.Problems = append(cluster.Status.Problems, &api.Problem{
-				Title: err.Error(),
-				Type:  errTypeGeneral,
-			})
+			cluster.Status.Problems = append(cluster.Status.Problems, problems(err)...)
 		} else {
 			cluster.Status.Problems = []*api.Problem{}
 		}
@@ -224,6 +497,53 @@ func (c *Controller) processCluster(workerNum uint, cluster *api.Cluster) {
 	}
 }
 
+// problems converts an error into a list of problems. Node pool errors are
+// reported as a problem per failed node pool, preflight errors as a problem
+// per failed check.
+func problems(err error) []*api.Problem {
+	if preflightErr, ok := err.(*provisioner.PreflightError); ok {
+		problems := make([]*api.Problem, 0, len(preflightErr.Failed))
+		for _, check := range preflightErr.Failed {
+			problems = append(problems, &api.Problem{
+				Title:    check.Err.Error(),
+				Instance: check.Name,
+				Type:     errTypePreflight,
+			})
+		}
+		return problems
+	}
+
+	if nodePoolErrs, ok := err.(provisioner.NodePoolErrors); ok {
+		problems := make([]*api.Problem, 0, len(nodePoolErrs))
+		for _, nodePoolErr := range nodePoolErrs {
+			problems = append(problems, &api.Problem{
+				Title:    nodePoolErr.Err.Error(),
+				Detail:   string(nodePoolErr.Category),
+				Instance: nodePoolErr.NodePool,
+				Type:     errTypeNodePool,
+			})
+		}
+		return problems
+	}
+
+	return []*api.Problem{
+		{
+			Title: err.Error(),
+			Type:  errTypeGeneral,
+		},
+	}
+}
+
+// logUpdateSummary logs the summary of a provisioning as JSON.
+func logUpdateSummary(logger *log.Entry, summary *api.UpdateSummary) {
+	data, err := summary.JSON()
+	if err != nil {
+		logger.Warnf("Failed to encode the update summary: %v", err)
+		return
+	}
+	logger.Infof("Update summary: %s", data)
+}
+
 // decryptConfigItems tries to decrypt encrypted config items in the cluster
 // config and modifies the passed cluster config so encrypted items has been
 // decrypted.
@@ -1,12 +1,18 @@
 package controller
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"reflect"
 	"testing"
+	"time"
 
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/notifier"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/provisioner"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/registry"
 )
@@ -19,11 +25,27 @@ func (p *mockProvisioner) Version(cluster *api.Cluster, config *channel.Config)
 	return nextVersion, nil
 }
 
-func (p *mockProvisioner) Provision(cluster *api.Cluster, config *channel.Config) error {
+func (p *mockProvisioner) Provision(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
 	return nil
 }
 
-func (p *mockProvisioner) Decommission(cluster *api.Cluster, config *channel.Config) error {
+func (p *mockProvisioner) Decommission(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
+	return nil
+}
+
+func (p *mockProvisioner) Suspend(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
+	return nil
+}
+
+func (p *mockProvisioner) Resume(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
+	return nil
+}
+
+func (p *mockProvisioner) Preflight(cluster *api.Cluster, config *channel.Config) (*provisioner.PreflightReport, error) {
+	return &provisioner.PreflightReport{}, nil
+}
+
+func (p *mockProvisioner) Reconcile(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
 	return nil
 }
 
@@ -33,25 +55,68 @@ func (p *mockErrProvisioner) Version(cluster *api.Cluster, config *channel.Confi
 	return "", fmt.Errorf("failed getting version")
 }
 
-func (p *mockErrProvisioner) Provision(cluster *api.Cluster, config *channel.Config) error {
+func (p *mockErrProvisioner) Provision(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
 	return fmt.Errorf("failed to provision")
 }
 
-func (p *mockErrProvisioner) Decommission(cluster *api.Cluster, config *channel.Config) error {
+func (p *mockErrProvisioner) Decommission(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
 	return fmt.Errorf("failed to decommission")
 }
 
+func (p *mockErrProvisioner) Suspend(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
+	return fmt.Errorf("failed to suspend")
+}
+
+func (p *mockErrProvisioner) Resume(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
+	return fmt.Errorf("failed to resume")
+}
+
+func (p *mockErrProvisioner) Preflight(cluster *api.Cluster, config *channel.Config) (*provisioner.PreflightReport, error) {
+	return nil, fmt.Errorf("failed preflight checks")
+}
+
+func (p *mockErrProvisioner) Reconcile(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
+	return fmt.Errorf("failed to reconcile")
+}
+
 type mockErrCreateProvisioner struct{ *mockProvisioner }
 
-func (p *mockErrCreateProvisioner) Provision(cluster *api.Cluster, config *channel.Config) error {
+func (p *mockErrCreateProvisioner) Provision(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
 	return fmt.Errorf("failed to provision")
 }
 
+type mockPreflightProvisioner struct{ *mockProvisioner }
+
+func (p *mockPreflightProvisioner) Preflight(cluster *api.Cluster, config *channel.Config) (*provisioner.PreflightReport, error) {
+	return &provisioner.PreflightReport{
+		Checks: []*provisioner.PreflightCheck{{Name: "credentials", Err: fmt.Errorf("expired")}},
+	}, nil
+}
+
+func (p *mockPreflightProvisioner) Provision(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
+	return fmt.Errorf("provisioned despite failed preflight checks")
+}
+
+type mockProgressProvisioner struct{ *mockProvisioner }
+
+func (p *mockProgressProvisioner) Provision(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
+	api.ReportProgress(ctx, api.ProgressStepNodePoolUpdate, "pool-1", "Updating node pool pool-1")
+	return nil
+}
+
+func (p *mockProgressProvisioner) Decommission(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
+	api.ReportProgress(ctx, api.ProgressStepDeletingStacks, "", "Deleting the node pools and stacks of the cluster")
+	return nil
+}
+
 type mockRegistry struct{}
 
 func (r *mockRegistry) ListClusters(filter registry.Filter) ([]*api.Cluster, error) {
 	return nil, nil
 }
+func (r *mockRegistry) GetCluster(id string) (*api.Cluster, error) {
+	return nil, registry.ErrClusterNotFound
+}
 func (r *mockRegistry) UpdateCluster(cluster *api.Cluster) error { return nil }
 
 type mockChannelSource struct{}
@@ -161,6 +226,15 @@ func TestProcessCluster(t *testing.T) {
 			options:         defaultOptions,
 			success:         false,
 		},
+		// test when preflight checks fail
+		{
+			registry:        &mockRegistry{},
+			provisioner:     &mockPreflightProvisioner{},
+			channelSource:   &mockChannelSource{},
+			lifecycleStatus: statusRequested,
+			options:         defaultOptions,
+			success:         false,
+		},
 		// test when lifecyclestatus is ready and version is up to date
 		// fails
 		{
@@ -195,7 +269,7 @@ func TestProcessCluster(t *testing.T) {
 		controller := New(ti.registry, ti.provisioner, ti.channelSource, ti.options)
 		cluster.LifecycleStatus = ti.lifecycleStatus
 		cluster.Status = ti.clusterStatus
-		err := controller.doProcessCluster(cluster)
+		err := controller.doProcessCluster(context.Background(), cluster)
 		if err != nil && ti.success {
 			t.Errorf("should not fail: %s", err)
 		}
@@ -205,3 +279,561 @@ func TestProcessCluster(t *testing.T) {
 		}
 	}
 }
+
+type mockRecordingRegistry struct {
+	mockRegistry
+	progress []*api.Progress
+}
+
+func (r *mockRecordingRegistry) UpdateCluster(cluster *api.Cluster) error {
+	if cluster.Status.Progress != nil {
+		r.progress = append(r.progress, cluster.Status.Progress)
+	}
+	return nil
+}
+
+func TestProcessClusterReportsProgress(t *testing.T) {
+	cluster := &api.Cluster{
+		ID: "aws:123456789012:eu-central-1:kube-1",
+		InfrastructureAccount: "aws:123456789012",
+		Channel:               "alpha",
+		LifecycleStatus:       statusReady,
+	}
+
+	registry := &mockRecordingRegistry{}
+	controller := New(registry, &mockProgressProvisioner{}, &mockChannelSource{}, defaultOptions)
+	err := controller.doProcessCluster(context.Background(), cluster)
+	if err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+
+	if len(registry.progress) != 1 || registry.progress[0].Step != api.ProgressStepNodePoolUpdate || registry.progress[0].NodePool != "pool-1" {
+		t.Errorf("expected the node pool update to be reported, got %v", registry.progress)
+	}
+
+	if cluster.Status.Progress != nil {
+		t.Errorf("expected the progress to be cleared after provisioning, got %v", cluster.Status.Progress)
+	}
+
+	cluster.LifecycleStatus = statusDecommissionRequested
+	registry = &mockRecordingRegistry{}
+	controller = New(registry, &mockProgressProvisioner{}, &mockChannelSource{}, defaultOptions)
+	err = controller.doProcessCluster(context.Background(), cluster)
+	if err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+
+	if len(registry.progress) != 1 || registry.progress[0].Step != api.ProgressStepDeletingStacks {
+		t.Errorf("expected the decommission to be reported, got %v", registry.progress)
+	}
+
+	if cluster.Status.Progress != nil {
+		t.Errorf("expected the progress to be cleared after decommissioning, got %v", cluster.Status.Progress)
+	}
+}
+
+type mockEventProvisioner struct{ *mockProvisioner }
+
+func (p *mockEventProvisioner) Provision(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
+	api.ReportEvent(ctx, api.EventNodePoolDecommissioned, "pool-1", "Decommissioned node pool pool-1")
+	return nil
+}
+
+type mockRecordingSink struct {
+	messages []string
+}
+
+func (s *mockRecordingSink) Send(message string, notification *notifier.Notification) error {
+	s.messages = append(s.messages, message)
+	return nil
+}
+
+func TestProcessClusterNotifies(t *testing.T) {
+	for _, ti := range []struct {
+		provisioner provisioner.Provisioner
+		dryRun      bool
+		expected    []string
+	}{
+		{
+			provisioner: &mockEventProvisioner{},
+			expected: []string{
+				"update-started kube-1 version",
+				"node-pool-decommissioned kube-1 version pool-1",
+				"update-succeeded kube-1 version",
+			},
+		},
+		{
+			provisioner: &mockErrCreateProvisioner{},
+			expected: []string{
+				"update-started kube-1 version",
+				"update-failed kube-1 version",
+			},
+		},
+		{
+			provisioner: &mockEventProvisioner{},
+			dryRun:      true,
+		},
+	} {
+		cluster := &api.Cluster{
+			ID:                    "aws:123456789012:eu-central-1:kube-1",
+			Alias:                 "kube-1",
+			InfrastructureAccount: "aws:123456789012",
+			Channel:               "alpha",
+			LifecycleStatus:       statusReady,
+		}
+
+		sink := &mockRecordingSink{}
+		n, err := notifier.NewWithSinks("{{.Type}} {{.ClusterAlias}} {{.ChannelVersion}}{{if .NodePool}} {{.NodePool}}{{end}}", sink)
+		if err != nil {
+			t.Fatalf("should not fail: %s", err)
+		}
+
+		controller := New(&mockRegistry{}, ti.provisioner, &mockChannelSource{}, &Options{
+			AccountFilter: config.DefaultFilter,
+			DryRun:        ti.dryRun,
+			Notifier:      n,
+		})
+		controller.doProcessCluster(context.Background(), cluster)
+
+		if !reflect.DeepEqual(sink.messages, ti.expected) {
+			t.Errorf("expected notifications %v, got %v", ti.expected, sink.messages)
+		}
+	}
+}
+
+type mockSummaryProvisioner struct{ *mockProvisioner }
+
+func (p *mockSummaryProvisioner) Provision(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
+	summary := api.UpdateSummaryFromContext(ctx)
+	summary.StartNodePool("pool-1")
+	summary.FinishNodePool("pool-1", api.UpdateOutcomeFailed, fmt.Errorf("nodes not ready"), "bootstrap")
+	return fmt.Errorf("failed to provision")
+}
+
+func TestProcessClusterSummarizesUpdate(t *testing.T) {
+	cluster := &api.Cluster{
+		ID:                    "aws:123456789012:eu-central-1:kube-1",
+		InfrastructureAccount: "aws:123456789012",
+		Channel:               "alpha",
+		LifecycleStatus:       statusReady,
+	}
+
+	controller := New(&mockRegistry{}, &mockSummaryProvisioner{}, &mockChannelSource{}, defaultOptions)
+	for i := 0; i < 2; i++ {
+		err := controller.doProcessCluster(context.Background(), cluster)
+		if err == nil {
+			t.Fatalf("expected an error")
+		}
+	}
+
+	summary := cluster.Status.LastUpdate
+	if summary == nil || summary.Outcome != api.UpdateOutcomeFailed || summary.Error != "failed to provision" {
+		t.Fatalf("expected a failed update summary, got %v", summary)
+	}
+	if len(summary.NodePools) != 1 || summary.NodePools[0].Retries != 1 {
+		t.Errorf("expected the failed node pool to be retried once, got %v", summary.NodePools)
+	}
+}
+
+type mockPausingProvisioner struct {
+	*mockProvisioner
+	paused bool
+}
+
+func (p *mockPausingProvisioner) Provision(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
+	paused, err := api.UpdatesPaused(ctx)
+	p.paused = paused
+	return err
+}
+
+type mockPausedRegistry struct {
+	mockRegistry
+	clusters []*api.Cluster
+}
+
+func (r *mockPausedRegistry) ListClusters(filter registry.Filter) ([]*api.Cluster, error) {
+	return nil, errors.New("the clusters must not be listed to check for paused updates")
+}
+
+func (r *mockPausedRegistry) GetCluster(id string) (*api.Cluster, error) {
+	for _, cluster := range r.clusters {
+		if cluster.ID == id {
+			return cluster, nil
+		}
+	}
+	return nil, registry.ErrClusterNotFound
+}
+
+func TestProcessClusterChecksPausedUpdates(t *testing.T) {
+	cluster := &api.Cluster{
+		ID: "aws:123456789012:eu-central-1:kube-1",
+		InfrastructureAccount: "aws:123456789012",
+		Channel:               "alpha",
+		LifecycleStatus:       statusReady,
+	}
+
+	// the updates were paused in the registry after the cluster was
+	// listed.
+	registry := &mockPausedRegistry{
+		clusters: []*api.Cluster{
+			{ID: cluster.ID, ConfigItems: map[string]string{api.UpdatePausedConfigItem: "true"}},
+		},
+	}
+	provisioner := &mockPausingProvisioner{}
+	controller := New(registry, provisioner, &mockChannelSource{}, defaultOptions)
+	err := controller.doProcessCluster(context.Background(), cluster)
+	if err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+
+	if !provisioner.paused {
+		t.Errorf("expected the updates to be paused")
+	}
+}
+
+func TestMaintenanceAllowed(t *testing.T) {
+	// 2018-03-05 is a Monday.
+	now := time.Date(2018, 3, 5, 12, 0, 0, 0, time.UTC)
+
+	for _, ti := range []struct {
+		msg         string
+		configItems map[string]string
+		allowed     bool
+		success     bool
+	}{
+		{
+			msg:     "no maintenance windows",
+			allowed: true,
+			success: true,
+		},
+		{
+			msg:         "open maintenance window",
+			configItems: map[string]string{api.MaintenanceWindowsConfigItem: "0 10 * * 1-5 4h"},
+			allowed:     true,
+			success:     true,
+		},
+		{
+			msg:         "closed maintenance window",
+			configItems: map[string]string{api.MaintenanceWindowsConfigItem: "0 2 * * 1-5 4h"},
+			allowed:     false,
+			success:     true,
+		},
+		{
+			msg: "maintenance window in another time zone",
+			configItems: map[string]string{
+				api.MaintenanceWindowsConfigItem:  "0 2 * * 1-5 4h",
+				api.MaintenanceTimezoneConfigItem: "America/Los_Angeles",
+			},
+			allowed: true,
+			success: true,
+		},
+		{
+			msg: "maintenance override",
+			configItems: map[string]string{
+				api.MaintenanceWindowsConfigItem:  "0 2 * * 1-5 4h",
+				api.MaintenanceOverrideConfigItem: "true",
+			},
+			allowed: true,
+			success: true,
+		},
+		{
+			msg:         "invalid maintenance window",
+			configItems: map[string]string{api.MaintenanceWindowsConfigItem: "0 2 * * mon 4h"},
+			success:     false,
+		},
+	} {
+		t.Run(ti.msg, func(t *testing.T) {
+			allowed, err := maintenanceAllowed(ti.configItems, now)
+			if err != nil && ti.success {
+				t.Fatalf("should not fail: %s", err)
+			}
+
+			if err == nil && !ti.success {
+				t.Fatalf("expected failure")
+			}
+
+			if allowed != ti.allowed {
+				t.Errorf("expected allowed to be %t, got %t", ti.allowed, allowed)
+			}
+		})
+	}
+}
+
+// closedMaintenanceWindow returns a maintenance window which isn't open for
+// the next hour.
+func closedMaintenanceWindow() string {
+	return fmt.Sprintf("0 %d * * * 1h", time.Now().UTC().Add(2*time.Hour).Hour())
+}
+
+func TestProcessClusterPausesOutsideMaintenanceWindows(t *testing.T) {
+	for _, ti := range []struct {
+		msg         string
+		configItems map[string]string
+		paused      bool
+	}{
+		{
+			msg:         "outside of the maintenance windows",
+			configItems: map[string]string{api.MaintenanceWindowsConfigItem: closedMaintenanceWindow()},
+			paused:      true,
+		},
+		{
+			msg: "maintenance override",
+			configItems: map[string]string{
+				api.MaintenanceWindowsConfigItem:  closedMaintenanceWindow(),
+				api.MaintenanceOverrideConfigItem: "true",
+			},
+			paused: false,
+		},
+	} {
+		t.Run(ti.msg, func(t *testing.T) {
+			cluster := &api.Cluster{
+				ID:                    "aws:123456789012:eu-central-1:kube-1",
+				InfrastructureAccount: "aws:123456789012",
+				Channel:               "alpha",
+				LifecycleStatus:       statusReady,
+			}
+
+			// the maintenance windows are checked in the registry like
+			// paused updates.
+			registry := &mockPausedRegistry{
+				clusters: []*api.Cluster{{ID: cluster.ID, ConfigItems: ti.configItems}},
+			}
+			provisioner := &mockPausingProvisioner{}
+			controller := New(registry, provisioner, &mockChannelSource{}, defaultOptions)
+			err := controller.doProcessCluster(context.Background(), cluster)
+			if err != nil {
+				t.Fatalf("should not fail: %s", err)
+			}
+
+			if provisioner.paused != ti.paused {
+				t.Errorf("expected paused to be %t, got %t", ti.paused, provisioner.paused)
+			}
+		})
+	}
+}
+
+func TestProcessClusterDefersDecommission(t *testing.T) {
+	for _, ti := range []struct {
+		msg            string
+		configItems    map[string]string
+		expectedStatus string
+	}{
+		{
+			msg:            "outside of the maintenance windows",
+			configItems:    map[string]string{api.MaintenanceWindowsConfigItem: closedMaintenanceWindow()},
+			expectedStatus: statusDecommissionRequested,
+		},
+		{
+			msg: "maintenance override",
+			configItems: map[string]string{
+				api.MaintenanceWindowsConfigItem:  closedMaintenanceWindow(),
+				api.MaintenanceOverrideConfigItem: "true",
+			},
+			expectedStatus: statusDecommissioned,
+		},
+	} {
+		t.Run(ti.msg, func(t *testing.T) {
+			cluster := &api.Cluster{
+				ID:                    "aws:123456789012:eu-central-1:kube-1",
+				InfrastructureAccount: "aws:123456789012",
+				Channel:               "alpha",
+				LifecycleStatus:       statusDecommissionRequested,
+				ConfigItems:           ti.configItems,
+			}
+
+			controller := New(&mockRegistry{}, &mockProvisioner{}, &mockChannelSource{}, defaultOptions)
+			err := controller.doProcessCluster(context.Background(), cluster)
+			if err != nil {
+				t.Fatalf("should not fail: %s", err)
+			}
+
+			if cluster.LifecycleStatus != ti.expectedStatus {
+				t.Errorf("expected lifecycle status %s, got %s", ti.expectedStatus, cluster.LifecycleStatus)
+			}
+		})
+	}
+}
+
+func TestProcessClusterSuspendResume(t *testing.T) {
+	for _, ti := range []struct {
+		provisioner     provisioner.Provisioner
+		lifecycleStatus string
+		expectedStatus  string
+		success         bool
+	}{
+		{
+			provisioner:     &mockProvisioner{},
+			lifecycleStatus: statusSuspendRequested,
+			expectedStatus:  statusSuspended,
+			success:         true,
+		},
+		{
+			provisioner:     &mockProvisioner{},
+			lifecycleStatus: statusSuspended,
+			expectedStatus:  statusSuspended,
+			success:         true,
+		},
+		{
+			provisioner:     &mockProvisioner{},
+			lifecycleStatus: statusResumeRequested,
+			expectedStatus:  statusReady,
+			success:         true,
+		},
+		{
+			provisioner:     &mockErrProvisioner{},
+			lifecycleStatus: statusSuspendRequested,
+			expectedStatus:  statusSuspendRequested,
+			success:         false,
+		},
+		{
+			provisioner:     &mockErrProvisioner{},
+			lifecycleStatus: statusResumeRequested,
+			expectedStatus:  statusResumeRequested,
+			success:         false,
+		},
+	} {
+		cluster := &api.Cluster{
+			ID:                    "aws:123456789012:eu-central-1:kube-1",
+			InfrastructureAccount: "aws:123456789012",
+			Channel:               "alpha",
+			LifecycleStatus:       ti.lifecycleStatus,
+		}
+
+		controller := New(&mockRegistry{}, ti.provisioner, &mockChannelSource{}, defaultOptions)
+		err := controller.doProcessCluster(context.Background(), cluster)
+		if err != nil && ti.success {
+			t.Errorf("should not fail: %s", err)
+		}
+
+		if err == nil && !ti.success {
+			t.Errorf("expected failure")
+		}
+
+		if cluster.LifecycleStatus != ti.expectedStatus {
+			t.Errorf("expected lifecycle status %s, got %s", ti.expectedStatus, cluster.LifecycleStatus)
+		}
+	}
+}
+
+// mockTaintingProvisioner simulates the nodes of a cluster registering with
+// the startup taint, which is removed from the tainted nodes on reconcile.
+type mockTaintingProvisioner struct {
+	*mockProvisioner
+	provisioned int
+	tainted     []string
+}
+
+func (p *mockTaintingProvisioner) Provision(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
+	p.provisioned++
+	return nil
+}
+
+func (p *mockTaintingProvisioner) Reconcile(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
+	p.tainted = nil
+	return nil
+}
+
+func TestProcessClusterReconcilesUpToDateCluster(t *testing.T) {
+	cluster := &api.Cluster{
+		ID:                    "aws:123456789012:eu-central-1:kube-1",
+		InfrastructureAccount: "aws:123456789012",
+		Channel:               "alpha",
+		LifecycleStatus:       statusReady,
+	}
+
+	provisioner := &mockTaintingProvisioner{}
+	controller := New(&mockRegistry{}, provisioner, &mockChannelSource{}, defaultOptions)
+	err := controller.doProcessCluster(context.Background(), cluster)
+	if err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+	if cluster.Status.CurrentVersion != nextVersion {
+		t.Fatalf("expected version %s, got %s", nextVersion, cluster.Status.CurrentVersion)
+	}
+
+	// a node launched by the autoscaler after the update registers with
+	// the startup taint.
+	provisioner.tainted = []string{"autoscaled"}
+	err = controller.doProcessCluster(context.Background(), cluster)
+	if err != nil {
+		t.Fatalf("should not fail: %s", err)
+	}
+
+	if provisioner.provisioned != 1 {
+		t.Errorf("expected the cluster to be provisioned once, got %d", provisioner.provisioned)
+	}
+	if len(provisioner.tainted) != 0 {
+		t.Errorf("expected the startup taint to be removed from %v", provisioner.tainted)
+	}
+}
+
+func TestProblems(t *testing.T) {
+	result := problems(fmt.Errorf("failed"))
+	if len(result) != 1 || result[0].Type != errTypeGeneral {
+		t.Errorf("expected a single general problem, got %v", result)
+	}
+
+	result = problems(provisioner.NodePoolErrors{
+		{NodePool: "master-default", Category: provisioner.ErrorCategoryQuota, Err: fmt.Errorf("limit")},
+		{NodePool: "worker-default", Category: provisioner.ErrorCategoryUnknown, Err: fmt.Errorf("failed")},
+	})
+	if len(result) != 2 {
+		t.Fatalf("expected 2 problems, got %d", len(result))
+	}
+	if result[0].Type != errTypeNodePool || result[0].Instance != "master-default" || result[0].Detail != "quota" {
+		t.Errorf("unexpected problem %v", result[0])
+	}
+}
+
+func TestPreflightProblems(t *testing.T) {
+	result := problems(&provisioner.PreflightError{
+		Failed: []*provisioner.PreflightCheck{
+			{Name: "credentials", Err: fmt.Errorf("expired")},
+			{Name: "asg-quota", Err: fmt.Errorf("limit")},
+		},
+	})
+	if len(result) != 2 {
+		t.Fatalf("expected 2 problems, got %d", len(result))
+	}
+	if result[1].Type != errTypePreflight || result[1].Instance != "asg-quota" || result[1].Title != "limit" {
+		t.Errorf("unexpected problem %v", result[1])
+	}
+}
+
+type mockLockedProvisioner struct{ *mockProvisioner }
+
+func (p *mockLockedProvisioner) Decommission(ctx context.Context, cluster *api.Cluster, config *channel.Config) error {
+	return &awsExt.LockHeldError{ClusterID: cluster.ID, Holder: "other"}
+}
+
+func TestProcessClusterSkipsLockedCluster(t *testing.T) {
+	cluster := &api.Cluster{
+		ID:                    "aws:123456789012:eu-central-1:kube-1",
+		InfrastructureAccount: "aws:123456789012",
+		Channel:               "alpha",
+		LifecycleStatus:       statusDecommissionRequested,
+		Status:                &api.ClusterStatus{},
+	}
+
+	// the lock holder reports the state of the cluster.
+	registry := &mockCountingRegistry{}
+	controller := New(registry, &mockLockedProvisioner{}, &mockChannelSource{}, defaultOptions)
+	controller.processCluster(context.Background(), 0, cluster)
+
+	if registry.updates != 0 {
+		t.Errorf("expected the registry not to be updated, got %d updates", registry.updates)
+	}
+
+	if len(cluster.Status.Problems) != 0 {
+		t.Errorf("expected no problems, got %v", cluster.Status.Problems)
+	}
+
+	// other errors are reported as problems of the cluster.
+	registry = &mockCountingRegistry{}
+	controller = New(registry, &mockErrProvisioner{}, &mockChannelSource{}, defaultOptions)
+	controller.processCluster(context.Background(), 0, cluster)
+
+	if registry.updates != 1 || len(cluster.Status.Problems) != 1 {
+		t.Errorf("expected the problem to be reported, got %d updates and problems %v", registry.updates, cluster.Status.Problems)
+	}
+}
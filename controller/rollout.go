@@ -0,0 +1,161 @@
+package controller
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// lastRolloutWave is the wave of the clusters without a rollout wave, which
+// are updated after all other clusters of their channel.
+const lastRolloutWave = math.MaxInt32
+
+// rolloutCluster is the state of a cluster relevant to the rollout of
+// channel versions, taken when the clusters are refreshed.
+type rolloutCluster struct {
+	id                    string
+	alias                 string
+	channel               string
+	wave                  int
+	ready                 bool
+	failed                bool
+	currentChannelVersion string
+	nextChannelVersion    string
+	updatedAt             time.Time
+}
+
+// rollout stages the updates of the clusters to new channel versions. The
+// clusters of a channel are updated wave by wave: a cluster is only updated
+// to a channel version once all ready clusters of the earlier waves run it
+// without problems for the bake time. The rollout of a channel version is
+// halted once the configured number of clusters failed to update to it.
+type rollout struct {
+	sync.Mutex
+	bakeTime    time.Duration
+	maxFailures uint
+	clusters    []*rolloutCluster
+}
+
+func newRollout(bakeTime time.Duration, maxFailures uint) *rollout {
+	return &rollout{
+		bakeTime:    bakeTime,
+		maxFailures: maxFailures,
+	}
+}
+
+// channelVersion returns the channel version part of a cluster version.
+func channelVersion(version string) string {
+	return strings.SplitN(version, "#", 2)[0]
+}
+
+// rolloutWave returns the rollout wave of the cluster.
+func rolloutWave(cluster *api.Cluster) (int, error) {
+	value, ok := cluster.ConfigItems[api.RolloutWaveConfigItem]
+	if !ok || value == "" {
+		return lastRolloutWave, nil
+	}
+
+	wave, err := strconv.Atoi(value)
+	if err != nil || wave < 0 {
+		return 0, fmt.Errorf("invalid rollout wave '%s' of cluster %s", value, cluster.ID)
+	}
+	return wave, nil
+}
+
+// update replaces the state of the clusters with the state of the refreshed
+// clusters. Pinned clusters don't take part in the rollout.
+func (r *rollout) update(clusters []*api.Cluster) {
+	rolloutClusters := make([]*rolloutCluster, 0, len(clusters))
+	for _, cluster := range clusters {
+		if cluster.ChannelRef() != cluster.Channel {
+			continue
+		}
+
+		wave, err := rolloutWave(cluster)
+		if err != nil {
+			log.Warnf("Ignoring cluster %s in the rollout: %v", cluster.ID, err)
+			continue
+		}
+
+		state := &rolloutCluster{
+			id:      cluster.ID,
+			alias:   cluster.Alias,
+			channel: cluster.Channel,
+			wave:    wave,
+			ready:   cluster.LifecycleStatus == statusReady,
+		}
+
+		if cluster.Status != nil {
+			state.failed = len(cluster.Status.Problems) > 0
+			state.currentChannelVersion = channelVersion(cluster.Status.CurrentVersion)
+			state.nextChannelVersion = channelVersion(cluster.Status.NextVersion)
+			if cluster.Status.LastUpdate != nil {
+				state.updatedAt = cluster.Status.LastUpdate.FinishedAt
+			}
+		}
+		rolloutClusters = append(rolloutClusters, state)
+	}
+
+	r.Lock()
+	defer r.Unlock()
+	r.clusters = rolloutClusters
+}
+
+// blocked returns why the cluster can't be updated to the channel version
+// yet, or an empty string if it can. Only updates of ready clusters to new
+// versions of their channel are staged, such that new clusters, changes of
+// the cluster configuration and pinned versions are applied right away.
+func (r *rollout) blocked(cluster *api.Cluster, version string, now time.Time) (string, error) {
+	if cluster.ChannelRef() != cluster.Channel || cluster.Status == nil || cluster.Status.CurrentVersion == "" {
+		return "", nil
+	}
+
+	if channelVersion(cluster.Status.CurrentVersion) == version {
+		return "", nil
+	}
+
+	wave, err := rolloutWave(cluster)
+	if err != nil {
+		return "", err
+	}
+
+	r.Lock()
+	defer r.Unlock()
+
+	// clusters which already tried to update to the version are retried
+	// even if the rollout is halted.
+	if r.maxFailures > 0 && channelVersion(cluster.Status.NextVersion) != version {
+		var failures uint
+		for _, other := range r.clusters {
+			if other.channel == cluster.Channel && other.nextChannelVersion == version && other.failed {
+				failures++
+			}
+		}
+		if failures >= r.maxFailures {
+			return fmt.Sprintf("rollout of channel version %s halted after %d clusters failed to update", version, failures), nil
+		}
+	}
+
+	for _, other := range r.clusters {
+		if other.id == cluster.ID || other.channel != cluster.Channel || other.wave >= wave || !other.ready {
+			continue
+		}
+
+		if other.currentChannelVersion != version || other.failed {
+			return fmt.Sprintf("waiting for cluster %s of wave %d to update", other.alias, other.wave), nil
+		}
+
+		if baked := other.updatedAt.Add(r.bakeTime); baked.After(now) {
+			return fmt.Sprintf("waiting for cluster %s of wave %d to bake until %s", other.alias, other.wave, baked.Format(time.RFC3339)), nil
+		}
+	}
+
+	return "", nil
+}
@@ -0,0 +1,155 @@
+package controller
+
+import (
+	"testing"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func rolloutTestCluster(id, wave, currentVersion string, updatedAt time.Time, problems int) *api.Cluster {
+	cluster := &api.Cluster{
+		ID:              id,
+		Alias:           id,
+		Channel:         "stable",
+		LifecycleStatus: statusReady,
+		ConfigItems:     map[string]string{},
+		Status: &api.ClusterStatus{
+			CurrentVersion: currentVersion,
+			LastUpdate:     &api.UpdateSummary{FinishedAt: updatedAt},
+		},
+	}
+	if wave != "" {
+		cluster.ConfigItems[api.RolloutWaveConfigItem] = wave
+	}
+	for i := 0; i < problems; i++ {
+		cluster.Status.Problems = append(cluster.Status.Problems, &api.Problem{Title: "failed"})
+	}
+	return cluster
+}
+
+func TestRolloutBlocked(t *testing.T) {
+	now := time.Now()
+	baked := now.Add(-2 * time.Hour)
+
+	for _, tc := range []struct {
+		msg      string
+		clusters []*api.Cluster
+		cluster  *api.Cluster
+		blocked  bool
+	}{
+		{
+			msg:     "canaries are updated right away",
+			cluster: rolloutTestCluster("canary", "0", "old#a", baked, 0),
+			clusters: []*api.Cluster{
+				rolloutTestCluster("other", "1", "old#a", baked, 0),
+			},
+		},
+		{
+			msg:     "earlier wave not updated",
+			cluster: rolloutTestCluster("kube-1", "1", "old#a", baked, 0),
+			clusters: []*api.Cluster{
+				rolloutTestCluster("canary", "0", "old#a", baked, 0),
+			},
+			blocked: true,
+		},
+		{
+			msg:     "earlier wave baking",
+			cluster: rolloutTestCluster("kube-1", "1", "old#a", baked, 0),
+			clusters: []*api.Cluster{
+				rolloutTestCluster("canary", "0", "new#a", now.Add(-time.Minute), 0),
+			},
+			blocked: true,
+		},
+		{
+			msg:     "earlier wave failing",
+			cluster: rolloutTestCluster("kube-1", "1", "old#a", baked, 0),
+			clusters: []*api.Cluster{
+				rolloutTestCluster("canary", "0", "new#a", baked, 1),
+			},
+			blocked: true,
+		},
+		{
+			msg:     "earlier wave baked",
+			cluster: rolloutTestCluster("kube-1", "", "old#a", baked, 0),
+			clusters: []*api.Cluster{
+				rolloutTestCluster("canary", "0", "new#a", baked, 0),
+				rolloutTestCluster("kube-2", "1", "new#a", baked, 0),
+			},
+		},
+		{
+			msg:     "configuration changes aren't staged",
+			cluster: rolloutTestCluster("kube-1", "1", "new#a", baked, 0),
+			clusters: []*api.Cluster{
+				rolloutTestCluster("canary", "0", "old#a", baked, 0),
+			},
+		},
+		{
+			msg: "other channels are ignored",
+			cluster: func() *api.Cluster {
+				cluster := rolloutTestCluster("kube-1", "1", "old#a", baked, 0)
+				cluster.Channel = "beta"
+				return cluster
+			}(),
+			clusters: []*api.Cluster{
+				rolloutTestCluster("canary", "0", "old#a", baked, 0),
+			},
+		},
+		{
+			msg: "pinned clusters are ignored",
+			cluster: func() *api.Cluster {
+				cluster := rolloutTestCluster("kube-1", "1", "old#a", baked, 0)
+				cluster.ConfigItems[api.ChannelVersionConfigItem] = "new"
+				return cluster
+			}(),
+			clusters: []*api.Cluster{
+				rolloutTestCluster("canary", "0", "old#a", baked, 0),
+			},
+		},
+		{
+			msg:     "halted after failures",
+			cluster: rolloutTestCluster("kube-1", "0", "old#a", baked, 0),
+			clusters: []*api.Cluster{
+				func() *api.Cluster {
+					cluster := rolloutTestCluster("canary", "0", "old#a", baked, 1)
+					cluster.Status.NextVersion = "new#a"
+					return cluster
+				}(),
+			},
+			blocked: true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			rollout := newRollout(time.Hour, 1)
+			rollout.update(tc.clusters)
+
+			reason, err := rollout.blocked(tc.cluster, "new", now)
+			if err != nil {
+				t.Fatalf("should not fail: %v", err)
+			}
+
+			if tc.blocked && reason == "" {
+				t.Errorf("expected the update to be blocked")
+			}
+			if !tc.blocked && reason != "" {
+				t.Errorf("expected the update not to be blocked, got: %s", reason)
+			}
+		})
+	}
+}
+
+func TestRolloutWave(t *testing.T) {
+	for value, expected := range map[string]int{"": lastRolloutWave, "0": 0, "3": 3} {
+		wave, err := rolloutWave(&api.Cluster{ConfigItems: map[string]string{api.RolloutWaveConfigItem: value}})
+		if err != nil || wave != expected {
+			t.Errorf("expected wave %d for '%s', got %d: %v", expected, value, wave, err)
+		}
+	}
+
+	for _, value := range []string{"-1", "first"} {
+		_, err := rolloutWave(&api.Cluster{ConfigItems: map[string]string{api.RolloutWaveConfigItem: value}})
+		if err == nil {
+			t.Errorf("expected wave '%s' to be invalid", value)
+		}
+	}
+}
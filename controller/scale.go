@@ -0,0 +1,146 @@
+package controller
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/provisioner"
+)
+
+// defaultScaleActor is recorded as the actor of scaling requests which don't
+// specify one.
+const defaultScaleActor = "scale-api"
+
+// ScaleRequest is the body of a request to the scale handler, setting the
+// min and max size of a node pool without provisioning its cluster.
+type ScaleRequest struct {
+	// Cluster is the ID or alias of the cluster.
+	Cluster  string `json:"cluster"`
+	NodePool string `json:"node_pool"`
+	MinSize  int64  `json:"min_size"`
+	MaxSize  int64  `json:"max_size"`
+	// Actor identifies who requested the scaling in the status of the
+	// node pool.
+	Actor string `json:"actor"`
+}
+
+// ScaleHandler returns a handler scaling node pools of the clusters of the
+// controller as requested by POSTing a ScaleRequest as JSON. Requests must
+// authenticate with the token as bearer token. Clusters currently processed
+// by a worker or locked by another instance are refused with 409 Conflict,
+// the scaling is recorded in the status of the node pool in the registry.
+func (c *Controller) ScaleHandler(scaler provisioner.NodePoolScaler, token string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPost {
+			w.Header().Set("Allow", http.MethodPost)
+			http.Error(w, "method not allowed", http.StatusMethodNotAllowed)
+			return
+		}
+
+		if !validBearerToken(r, token) {
+			http.Error(w, "unauthorized", http.StatusUnauthorized)
+			return
+		}
+
+		var request ScaleRequest
+		err := json.NewDecoder(r.Body).Decode(&request)
+		if err != nil {
+			http.Error(w, fmt.Sprintf("invalid request: %v", err), http.StatusBadRequest)
+			return
+		}
+		if request.Cluster == "" || request.NodePool == "" {
+			http.Error(w, "invalid request: cluster and node_pool are required", http.StatusBadRequest)
+			return
+		}
+		if request.Actor == "" {
+			request.Actor = defaultScaleActor
+		}
+
+		listed, ok := c.clusterList.Acquire(request.Cluster)
+		if listed == nil {
+			http.Error(w, fmt.Sprintf("cluster %s not found", request.Cluster), http.StatusNotFound)
+			return
+		}
+		if !ok {
+			http.Error(w, fmt.Sprintf("cluster %s is being processed, retry later", request.Cluster), http.StatusConflict)
+			return
+		}
+		defer c.clusterList.Release(listed.ID)
+
+		clusterLog := log.WithField("cluster", listed.Alias)
+
+		if c.locker != nil {
+			err = c.locker.Lock(listed.ID)
+			if _, ok := err.(*awsExt.LockHeldError); ok {
+				http.Error(w, fmt.Sprintf("%v, retry later", err), http.StatusConflict)
+				return
+			}
+			if err != nil {
+				clusterLog.Errorf("Failed to lock cluster %s: %v", listed.ID, err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+			defer func() {
+				if err := c.locker.Unlock(listed.ID); err != nil {
+					clusterLog.Warnf("Failed to release the lock of cluster %s: %v", listed.ID, err)
+				}
+			}()
+		}
+
+		// the listed cluster is only refreshed in the controller's
+		// interval, the scaling is recorded in the current status of the
+		// cluster such that the registry update doesn't revert newer
+		// changes.
+		cluster, err := c.registry.GetCluster(listed.ID)
+		if err != nil {
+			clusterLog.Errorf("Failed to get cluster %s from the registry: %v", listed.ID, err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+
+		clusterLog.Infof("Scaling node pool %s to %d/%d as requested by %s", request.NodePool, request.MinSize, request.MaxSize, request.Actor)
+
+		scaling, err := scaler.ScaleNodePool(r.Context(), cluster, request.NodePool, request.MinSize, request.MaxSize, request.Actor)
+		if err != nil {
+			clusterLog.Errorf("Failed to scale node pool %s: %v", request.NodePool, err)
+			http.Error(w, err.Error(), http.StatusUnprocessableEntity)
+			return
+		}
+
+		if !c.dryRun {
+			err = c.registry.UpdateCluster(cluster)
+			if err != nil {
+				clusterLog.Errorf("Unable to record the scaling of node pool %s: %s", request.NodePool, err)
+				http.Error(w, err.Error(), http.StatusInternalServerError)
+				return
+			}
+		}
+
+		w.Header().Set("Content-Type", "application/json")
+		err = json.NewEncoder(w).Encode(scaling)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
+
+// validBearerToken returns true if the request authenticates with the token
+// as bearer token. An empty token never matches.
+func validBearerToken(r *http.Request, token string) bool {
+	if token == "" {
+		return false
+	}
+
+	const prefix = "Bearer "
+	header := r.Header.Get("Authorization")
+	if !strings.HasPrefix(header, prefix) {
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(strings.TrimPrefix(header, prefix)), []byte(token)) == 1
+}
@@ -0,0 +1,259 @@
+package controller
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+)
+
+type mockScaler struct {
+	err error
+}
+
+func (s *mockScaler) ScaleNodePool(ctx context.Context, cluster *api.Cluster, nodePool string, minSize, maxSize int64, actor string) (*api.NodePoolScaling, error) {
+	if s.err != nil {
+		return nil, s.err
+	}
+
+	scaling := &api.NodePoolScaling{MinSize: minSize, MaxSize: maxSize, Actor: actor}
+	if cluster.Status == nil {
+		cluster.Status = &api.ClusterStatus{}
+	}
+	cluster.Status.SetNodePoolScaling(nodePool, scaling)
+	return scaling, nil
+}
+
+type mockCountingRegistry struct {
+	mockRegistry
+	clusters []*api.Cluster
+	updates  int
+	updated  *api.Cluster
+}
+
+func (r *mockCountingRegistry) GetCluster(id string) (*api.Cluster, error) {
+	for _, cluster := range r.clusters {
+		if cluster.ID == id {
+			return cluster, nil
+		}
+	}
+	return r.mockRegistry.GetCluster(id)
+}
+
+func (r *mockCountingRegistry) UpdateCluster(cluster *api.Cluster) error {
+	r.updates++
+	r.updated = cluster
+	return nil
+}
+
+type mockLocker struct {
+	held     map[string]bool
+	unlocked []string
+}
+
+func (l *mockLocker) Lock(clusterID string) error {
+	if l.held[clusterID] {
+		return &awsExt.LockHeldError{ClusterID: clusterID, Holder: "other"}
+	}
+	return nil
+}
+
+func (l *mockLocker) Unlock(clusterID string) error {
+	l.unlocked = append(l.unlocked, clusterID)
+	return nil
+}
+
+func (l *mockLocker) ForceUnlock(clusterID string) error { return nil }
+
+func scaleRequest(token, body string) *http.Request {
+	request := httptest.NewRequest(http.MethodPost, "/scale", strings.NewReader(body))
+	if token != "" {
+		request.Header.Set("Authorization", "Bearer "+token)
+	}
+	return request
+}
+
+func TestScaleHandler(t *testing.T) {
+	registry := &mockCountingRegistry{
+		clusters: []*api.Cluster{
+			{ID: "kube-1", Alias: "alias-1", LifecycleStatus: statusReady, Status: &api.ClusterStatus{CurrentVersion: "current"}},
+			{ID: "kube-2", Alias: "alias-2", LifecycleStatus: statusReady, Status: &api.ClusterStatus{CurrentVersion: "current"}},
+		},
+	}
+	controller := New(registry, &mockProvisioner{}, &mockChannelSource{}, defaultOptions)
+	listed := []*api.Cluster{
+		{ID: "kube-1", Alias: "alias-1", LifecycleStatus: statusReady, Status: &api.ClusterStatus{CurrentVersion: "outdated"}},
+		{ID: "kube-2", Alias: "alias-2", LifecycleStatus: statusReady, Status: &api.ClusterStatus{CurrentVersion: "outdated"}},
+	}
+	controller.clusterList.UpdateAvailable(listed)
+	handler := controller.ScaleHandler(&mockScaler{}, "secret")
+
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, scaleRequest("secret", `{"cluster": "alias-1", "node_pool": "worker-default", "min_size": 3, "max_size": 30, "actor": "jdoe"}`))
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+
+	var scaling api.NodePoolScaling
+	err := json.Unmarshal(recorder.Body.Bytes(), &scaling)
+	if err != nil {
+		t.Fatalf("invalid response: %v", err)
+	}
+	if scaling.MinSize != 3 || scaling.MaxSize != 30 || scaling.Actor != "jdoe" {
+		t.Errorf("unexpected scaling %s", recorder.Body.String())
+	}
+	if registry.updates != 1 {
+		t.Errorf("expected the scaling to be recorded in the registry, got %d updates", registry.updates)
+	}
+
+	// the scaling is recorded in the current status of the cluster in the
+	// registry, not in the outdated one of the listed cluster.
+	if registry.updated.Status.CurrentVersion != "current" || len(registry.updated.Status.NodePools) != 1 || registry.updated.Status.NodePools[0].Scaling == nil {
+		t.Errorf("expected the scaling to be recorded in the current status, got %+v", registry.updated.Status)
+	}
+	if len(listed[0].Status.NodePools) != 0 {
+		t.Errorf("expected the listed cluster not to be modified, got %+v", listed[0].Status)
+	}
+
+	// the cluster is released after scaling. It stays acquired for the
+	// conflict case below.
+	if _, ok := controller.clusterList.Acquire("kube-1"); !ok {
+		t.Errorf("expected kube-1 to be released")
+	}
+
+	for _, tc := range []struct {
+		msg      string
+		method   string
+		token    string
+		body     string
+		scaler   *mockScaler
+		expected int
+	}{
+		{
+			msg:      "get",
+			method:   http.MethodGet,
+			token:    "secret",
+			expected: http.StatusMethodNotAllowed,
+		},
+		{
+			msg:      "no token",
+			body:     `{"cluster": "kube-2", "node_pool": "worker-default", "min_size": 3, "max_size": 30}`,
+			expected: http.StatusUnauthorized,
+		},
+		{
+			msg:      "wrong token",
+			token:    "other",
+			body:     `{"cluster": "kube-2", "node_pool": "worker-default", "min_size": 3, "max_size": 30}`,
+			expected: http.StatusUnauthorized,
+		},
+		{
+			msg:      "invalid body",
+			token:    "secret",
+			body:     `{`,
+			expected: http.StatusBadRequest,
+		},
+		{
+			msg:      "missing node pool",
+			token:    "secret",
+			body:     `{"cluster": "kube-2", "min_size": 3, "max_size": 30}`,
+			expected: http.StatusBadRequest,
+		},
+		{
+			msg:      "unknown cluster",
+			token:    "secret",
+			body:     `{"cluster": "kube-3", "node_pool": "worker-default", "min_size": 3, "max_size": 30}`,
+			expected: http.StatusNotFound,
+		},
+		{
+			msg:      "cluster being processed",
+			token:    "secret",
+			body:     `{"cluster": "kube-1", "node_pool": "worker-default", "min_size": 3, "max_size": 30}`,
+			expected: http.StatusConflict,
+		},
+		{
+			msg:      "scaling fails",
+			token:    "secret",
+			body:     `{"cluster": "kube-2", "node_pool": "worker-default", "min_size": 30, "max_size": 3}`,
+			scaler:   &mockScaler{err: errors.New("invalid size")},
+			expected: http.StatusUnprocessableEntity,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			scaler := tc.scaler
+			if scaler == nil {
+				scaler = &mockScaler{}
+			}
+
+			request := scaleRequest(tc.token, tc.body)
+			if tc.method != "" {
+				request.Method = tc.method
+			}
+
+			recorder := httptest.NewRecorder()
+			controller.ScaleHandler(scaler, "secret").ServeHTTP(recorder, request)
+			if recorder.Code != tc.expected {
+				t.Errorf("expected status %d, got %d: %s", tc.expected, recorder.Code, recorder.Body.String())
+			}
+		})
+	}
+
+	if registry.updates != 1 {
+		t.Errorf("expected no further updates of the registry, got %d", registry.updates)
+	}
+}
+
+func TestScaleHandlerLockedCluster(t *testing.T) {
+	registry := &mockCountingRegistry{
+		clusters: []*api.Cluster{
+			{ID: "kube-1", LifecycleStatus: statusReady},
+			{ID: "kube-2", LifecycleStatus: statusReady},
+		},
+	}
+	locker := &mockLocker{held: map[string]bool{"kube-1": true}}
+	controller := New(registry, &mockProvisioner{}, &mockChannelSource{}, &Options{AccountFilter: defaultOptions.AccountFilter, Locker: locker})
+	controller.clusterList.UpdateAvailable([]*api.Cluster{
+		{ID: "kube-1", LifecycleStatus: statusReady},
+		{ID: "kube-2", LifecycleStatus: statusReady},
+	})
+	handler := controller.ScaleHandler(&mockScaler{}, "secret")
+
+	// clusters locked by another instance are refused.
+	recorder := httptest.NewRecorder()
+	handler.ServeHTTP(recorder, scaleRequest("secret", `{"cluster": "kube-1", "node_pool": "worker-default", "min_size": 3, "max_size": 30}`))
+	if recorder.Code != http.StatusConflict {
+		t.Errorf("expected status 409, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if registry.updates != 0 {
+		t.Errorf("expected the registry not to be updated, got %d updates", registry.updates)
+	}
+
+	// other clusters are locked while they're scaled.
+	recorder = httptest.NewRecorder()
+	handler.ServeHTTP(recorder, scaleRequest("secret", `{"cluster": "kube-2", "node_pool": "worker-default", "min_size": 3, "max_size": 30}`))
+	if recorder.Code != http.StatusOK {
+		t.Errorf("expected status 200, got %d: %s", recorder.Code, recorder.Body.String())
+	}
+	if registry.updates != 1 {
+		t.Errorf("expected the scaling to be recorded in the registry, got %d updates", registry.updates)
+	}
+	if len(locker.unlocked) != 1 || locker.unlocked[0] != "kube-2" {
+		t.Errorf("expected the lock of kube-2 to be released, got %v", locker.unlocked)
+	}
+}
+
+func TestScaleHandlerWithoutToken(t *testing.T) {
+	controller := New(&mockRegistry{}, &mockProvisioner{}, &mockChannelSource{}, defaultOptions)
+	controller.clusterList.UpdateAvailable([]*api.Cluster{{ID: "kube-1", LifecycleStatus: statusReady}})
+
+	recorder := httptest.NewRecorder()
+	controller.ScaleHandler(&mockScaler{}, "").ServeHTTP(recorder, scaleRequest("", `{"cluster": "kube-1", "node_pool": "worker-default", "min_size": 3, "max_size": 30}`))
+	if recorder.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401, got %d", recorder.Code)
+	}
+}
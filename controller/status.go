@@ -0,0 +1,154 @@
+package controller
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// maxRecentErrors is the number of errors of processing clusters kept for
+// the status of the controller.
+const maxRecentErrors = 50
+
+// Status is the state of the controller served as JSON by the status
+// handler.
+type Status struct {
+	Operations   []*Operation   `json:"operations"`
+	RecentErrors []*RecentError `json:"recent_errors"`
+}
+
+// Operation is a cluster currently processed by a worker of the controller.
+type Operation struct {
+	ClusterID       string        `json:"cluster_id"`
+	ClusterAlias    string        `json:"cluster_alias"`
+	LifecycleStatus string        `json:"lifecycle_status"`
+	Worker          uint          `json:"worker"`
+	StartedAt       time.Time     `json:"started_at"`
+	Progress        *api.Progress `json:"progress,omitempty"`
+	// Rollouts is the latest rollout progress of every node pool of the
+	// cluster updated by the operation so far.
+	Rollouts map[string]*api.Progress `json:"rollouts,omitempty"`
+}
+
+// RecentError is an error of processing a cluster.
+type RecentError struct {
+	ClusterID    string    `json:"cluster_id"`
+	ClusterAlias string    `json:"cluster_alias"`
+	Error        string    `json:"error"`
+	Time         time.Time `json:"time"`
+}
+
+// statusTracker tracks the operations of the workers of the controller and
+// their recent errors.
+type statusTracker struct {
+	sync.Mutex
+	operations   map[string]*Operation
+	recentErrors []*RecentError
+}
+
+func newStatusTracker() *statusTracker {
+	return &statusTracker{operations: make(map[string]*Operation)}
+}
+
+// start records that a worker started processing the cluster.
+func (t *statusTracker) start(workerNum uint, cluster *api.Cluster) {
+	t.Lock()
+	defer t.Unlock()
+
+	t.operations[cluster.ID] = &Operation{
+		ClusterID:       cluster.ID,
+		ClusterAlias:    cluster.Alias,
+		LifecycleStatus: cluster.LifecycleStatus,
+		Worker:          workerNum,
+		StartedAt:       time.Now().UTC(),
+	}
+}
+
+// progress records the progress of the operation of the cluster.
+func (t *statusTracker) progress(cluster *api.Cluster, progress *api.Progress) {
+	t.Lock()
+	defer t.Unlock()
+
+	operation, ok := t.operations[cluster.ID]
+	if !ok {
+		return
+	}
+
+	operation.Progress = progress
+	if progress != nil && progress.NodesTotal > 0 {
+		if operation.Rollouts == nil {
+			operation.Rollouts = make(map[string]*api.Progress)
+		}
+		operation.Rollouts[progress.NodePool] = progress
+	}
+}
+
+// finish records that the operation of the cluster finished, keeping the
+// error if it failed.
+func (t *statusTracker) finish(cluster *api.Cluster, err error) {
+	t.Lock()
+	defer t.Unlock()
+
+	delete(t.operations, cluster.ID)
+	if err == nil {
+		return
+	}
+
+	t.recentErrors = append(t.recentErrors, &RecentError{
+		ClusterID:    cluster.ID,
+		ClusterAlias: cluster.Alias,
+		Error:        err.Error(),
+		Time:         time.Now().UTC(),
+	})
+	if len(t.recentErrors) > maxRecentErrors {
+		t.recentErrors = t.recentErrors[len(t.recentErrors)-maxRecentErrors:]
+	}
+}
+
+// status returns a copy of the current status, with the operations sorted
+// by cluster ID and the most recent errors first.
+func (t *statusTracker) status() *Status {
+	t.Lock()
+	defer t.Unlock()
+
+	status := &Status{
+		Operations:   make([]*Operation, 0, len(t.operations)),
+		RecentErrors: make([]*RecentError, 0, len(t.recentErrors)),
+	}
+
+	for _, operation := range t.operations {
+		op := *operation
+		if operation.Rollouts != nil {
+			op.Rollouts = make(map[string]*api.Progress, len(operation.Rollouts))
+			for nodePool, progress := range operation.Rollouts {
+				op.Rollouts[nodePool] = progress
+			}
+		}
+		status.Operations = append(status.Operations, &op)
+	}
+	sort.Slice(status.Operations, func(i, j int) bool {
+		return status.Operations[i].ClusterID < status.Operations[j].ClusterID
+	})
+
+	for i := len(t.recentErrors) - 1; i >= 0; i-- {
+		status.RecentErrors = append(status.RecentErrors, t.recentErrors[i])
+	}
+	return status
+}
+
+// StatusHandler returns a handler serving the clusters currently processed
+// by the controller, the rollout progress of their node pools and the recent
+// errors as JSON.
+func (c *Controller) StatusHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, _ *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		err := json.NewEncoder(w).Encode(c.status.status())
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+		}
+	})
+}
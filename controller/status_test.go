@@ -0,0 +1,93 @@
+package controller
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestStatusTracker(t *testing.T) {
+	tracker := newStatusTracker()
+	cluster1 := &api.Cluster{ID: "kube-1", Alias: "alias-1", LifecycleStatus: statusReady}
+	cluster2 := &api.Cluster{ID: "kube-2", Alias: "alias-2", LifecycleStatus: statusDecommissionRequested}
+
+	tracker.start(2, cluster2)
+	tracker.start(1, cluster1)
+	tracker.progress(cluster1, &api.Progress{Step: api.ProgressStepNodePoolUpdate, NodePool: "pool-1", NodesReplaced: 1, NodesTotal: 3})
+	tracker.progress(cluster1, &api.Progress{Step: api.ProgressStepWaitingForNodesReady, NodePool: "pool-1"})
+
+	status := tracker.status()
+	if len(status.Operations) != 2 || status.Operations[0].ClusterID != "kube-1" || status.Operations[1].ClusterID != "kube-2" {
+		t.Fatalf("expected the operations of both clusters, got %v", status.Operations)
+	}
+
+	operation := status.Operations[0]
+	if operation.Worker != 1 || operation.Progress.Step != api.ProgressStepWaitingForNodesReady {
+		t.Errorf("unexpected operation %v", operation)
+	}
+
+	rollout, ok := operation.Rollouts["pool-1"]
+	if !ok || rollout.NodesReplaced != 1 || rollout.NodesTotal != 3 {
+		t.Errorf("expected the rollout progress of pool-1, got %v", operation.Rollouts)
+	}
+
+	tracker.finish(cluster1, nil)
+	tracker.finish(cluster2, errors.New("failed"))
+
+	status = tracker.status()
+	if len(status.Operations) != 0 {
+		t.Errorf("expected no operations, got %v", status.Operations)
+	}
+
+	if len(status.RecentErrors) != 1 || status.RecentErrors[0].ClusterID != "kube-2" || status.RecentErrors[0].Error != "failed" {
+		t.Errorf("expected the error of kube-2, got %v", status.RecentErrors)
+	}
+}
+
+func TestStatusTrackerRecentErrors(t *testing.T) {
+	tracker := newStatusTracker()
+	cluster := &api.Cluster{ID: "kube-1"}
+
+	for i := 0; i < maxRecentErrors+10; i++ {
+		tracker.start(1, cluster)
+		tracker.finish(cluster, fmt.Errorf("error %d", i))
+	}
+
+	status := tracker.status()
+	if len(status.RecentErrors) != maxRecentErrors {
+		t.Fatalf("expected %d errors, got %d", maxRecentErrors, len(status.RecentErrors))
+	}
+
+	if status.RecentErrors[0].Error != fmt.Sprintf("error %d", maxRecentErrors+9) {
+		t.Errorf("expected the most recent error first, got %s", status.RecentErrors[0].Error)
+	}
+}
+
+func TestStatusHandler(t *testing.T) {
+	controller := New(&mockRegistry{}, &mockProvisioner{}, &mockChannelSource{}, defaultOptions)
+	cluster := &api.Cluster{ID: "kube-1", Alias: "alias-1", LifecycleStatus: statusReady}
+	controller.status.start(1, cluster)
+	controller.status.progress(cluster, &api.Progress{Step: api.ProgressStepNodePoolUpdate, NodePool: "pool-1", NodesReplaced: 2, NodesTotal: 4})
+
+	recorder := httptest.NewRecorder()
+	controller.StatusHandler().ServeHTTP(recorder, httptest.NewRequest(http.MethodGet, "/status", nil))
+
+	if recorder.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", recorder.Code)
+	}
+
+	var status Status
+	err := json.Unmarshal(recorder.Body.Bytes(), &status)
+	if err != nil {
+		t.Fatalf("invalid status: %v", err)
+	}
+
+	if len(status.Operations) != 1 || status.Operations[0].Rollouts["pool-1"].NodesReplaced != 2 {
+		t.Errorf("unexpected status %s", recorder.Body.String())
+	}
+}
@@ -0,0 +1,235 @@
+package audit
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	log "github.com/sirupsen/logrus"
+
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+)
+
+const (
+	// OutcomeSucceeded is the outcome of actions which succeeded.
+	OutcomeSucceeded = "succeeded"
+	// OutcomeFailed is the outcome of actions which failed.
+	OutcomeFailed = "failed"
+
+	auditHandlerName = "clm.AuditHandler"
+)
+
+// resourceFields are the fields of the inputs of the AWS API operations
+// identifying the resource changed, in order of precedence.
+var resourceFields = []string{
+	"StackName",
+	"AutoScalingGroupName",
+	"InstanceId",
+	"LaunchTemplateName",
+	"Key",
+	"Bucket",
+}
+
+// Record is an action changing the resources of a cluster. The records are
+// chained by their hashes: each record contains the hash of the previous one,
+// so removing or changing a record breaks the chain.
+type Record struct {
+	Sequence     uint64    `json:"sequence"`
+	Time         time.Time `json:"time"`
+	ClusterID    string    `json:"cluster_id"`
+	Actor        string    `json:"actor"`
+	Action       string    `json:"action"`
+	Resource     string    `json:"resource,omitempty"`
+	InputsHash   string    `json:"inputs_hash"`
+	Outcome      string    `json:"outcome"`
+	Error        string    `json:"error,omitempty"`
+	PreviousHash string    `json:"previous_hash"`
+	Hash         string    `json:"hash"`
+}
+
+// computeHash returns the hash of the record, covering all fields but the
+// hash itself.
+func (r *Record) computeHash() (string, error) {
+	record := *r
+	record.Hash = ""
+
+	data, err := json.Marshal(&record)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// Sink writes the audit records.
+type Sink interface {
+	Write(record *Record) error
+}
+
+// Auditor records the actions changing the resources of the clusters and
+// writes them to all sinks.
+type Auditor struct {
+	sinks []Sink
+	actor string
+	mutex sync.Mutex
+	// sequence and lastHash are the sequence number and hash of the last
+	// record, which the next record is chained to.
+	sequence uint64
+	lastHash string
+}
+
+// NewWithSinks initializes an Auditor writing the records of the actor to the
+// sinks. The records are chained to the last record if it's not nil, e.g. the
+// last record of an existing audit log.
+func NewWithSinks(actor string, last *Record, sinks ...Sink) *Auditor {
+	auditor := &Auditor{sinks: sinks, actor: actor}
+	if last != nil {
+		auditor.sequence = last.Sequence + 1
+		auditor.lastHash = last.Hash
+	}
+	return auditor
+}
+
+// Record writes a record of the action to all sinks. Failing sinks are only
+// logged, because the action already happened. It's a no-op for a nil
+// Auditor.
+func (a *Auditor) Record(clusterID, action, resource string, inputs interface{}, actionErr error) {
+	if a == nil {
+		return
+	}
+
+	logger := log.WithField("cluster", clusterID)
+
+	inputsHash, err := hashInputs(inputs)
+	if err != nil {
+		logger.Errorf("Failed to hash the inputs of %s for the audit log: %v", action, err)
+	}
+
+	record := &Record{
+		Time:       time.Now().UTC(),
+		ClusterID:  clusterID,
+		Actor:      a.actor,
+		Action:     action,
+		Resource:   resource,
+		InputsHash: inputsHash,
+		Outcome:    OutcomeSucceeded,
+	}
+	if actionErr != nil {
+		record.Outcome = OutcomeFailed
+		record.Error = actionErr.Error()
+	}
+
+	// the records are written in the order of the chain.
+	a.mutex.Lock()
+	defer a.mutex.Unlock()
+
+	record.Sequence = a.sequence
+	record.PreviousHash = a.lastHash
+	record.Hash, err = record.computeHash()
+	if err != nil {
+		logger.Errorf("Failed to hash the audit record of %s: %v", action, err)
+		return
+	}
+	a.sequence++
+	a.lastHash = record.Hash
+
+	for _, sink := range a.sinks {
+		err := sink.Write(record)
+		if err != nil {
+			logger.Errorf("Failed to write the audit record of %s: %v", action, err)
+		}
+	}
+}
+
+// Instrument records all API operations of the clients created from the
+// session which could change resources, with the input and the outcome of
+// each operation. It's a no-op for a nil Auditor.
+func (a *Auditor) Instrument(sess *session.Session, clusterID string) {
+	if a == nil {
+		return
+	}
+
+	sess.Handlers.Complete.PushBackNamed(request.NamedHandler{
+		Name: auditHandlerName,
+		Fn: func(r *request.Request) {
+			if awsExt.IsReadOnlyOperation(r.Operation.Name) {
+				return
+			}
+			action := fmt.Sprintf("%s:%s", r.ClientInfo.ServiceName, r.Operation.Name)
+			a.Record(clusterID, action, inputResource(r.Params), r.Params, r.Error)
+		},
+	})
+}
+
+// hashInputs returns the SHA-256 hash of the JSON encoded inputs.
+func hashInputs(inputs interface{}) (string, error) {
+	data, err := json.Marshal(inputs)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]), nil
+}
+
+// inputResource returns the resource changed by the input of an AWS API
+// operation, or an empty string if it's not known.
+func inputResource(input interface{}) string {
+	value := reflect.Indirect(reflect.ValueOf(input))
+	if value.Kind() != reflect.Struct {
+		return ""
+	}
+
+	for _, name := range resourceFields {
+		field := value.FieldByName(name)
+		if !field.IsValid() {
+			continue
+		}
+
+		resource, ok := field.Interface().(*string)
+		if !ok || aws.StringValue(resource) == "" {
+			continue
+		}
+
+		// objects are identified by their bucket and key.
+		if bucket := value.FieldByName("Bucket"); name == "Key" && bucket.IsValid() {
+			if bucketName, ok := bucket.Interface().(*string); ok {
+				return fmt.Sprintf("s3://%s/%s", aws.StringValue(bucketName), aws.StringValue(resource))
+			}
+		}
+		return aws.StringValue(resource)
+	}
+	return ""
+}
+
+// Verify checks that the records form an unbroken chain: the hash of every
+// record must match its content and the previous hash of every record must
+// be the hash of the record before it.
+func Verify(records []*Record) error {
+	for i, record := range records {
+		hash, err := record.computeHash()
+		if err != nil {
+			return err
+		}
+
+		if hash != record.Hash {
+			return fmt.Errorf("record %d was modified: hash %s doesn't match its content", record.Sequence, record.Hash)
+		}
+
+		if i == 0 {
+			continue
+		}
+
+		previous := records[i-1]
+		if record.Sequence != previous.Sequence+1 || record.PreviousHash != previous.Hash {
+			return fmt.Errorf("records missing between record %d and %d", previous.Sequence, record.Sequence)
+		}
+	}
+	return nil
+}
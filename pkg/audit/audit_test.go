@@ -0,0 +1,192 @@
+package audit
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	records []*Record
+	err     error
+}
+
+func (s *recordingSink) Write(record *Record) error {
+	s.records = append(s.records, record)
+	return s.err
+}
+
+type s3APIStub struct {
+	input *s3.PutObjectInput
+}
+
+func (s *s3APIStub) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	s.input = input
+	return &s3.PutObjectOutput{}, nil
+}
+
+type cloudWatchLogsAPIStub struct {
+	inputs []*cloudwatchlogs.PutLogEventsInput
+}
+
+func (c *cloudWatchLogsAPIStub) CreateLogStream(input *cloudwatchlogs.CreateLogStreamInput) (*cloudwatchlogs.CreateLogStreamOutput, error) {
+	return &cloudwatchlogs.CreateLogStreamOutput{}, nil
+}
+
+func (c *cloudWatchLogsAPIStub) PutLogEvents(input *cloudwatchlogs.PutLogEventsInput) (*cloudwatchlogs.PutLogEventsOutput, error) {
+	c.inputs = append(c.inputs, input)
+	return &cloudwatchlogs.PutLogEventsOutput{NextSequenceToken: aws.String(fmt.Sprintf("token-%d", len(c.inputs)))}, nil
+}
+
+func TestRecordChain(t *testing.T) {
+	failing := &recordingSink{err: fmt.Errorf("failed")}
+	sink := &recordingSink{}
+	auditor := NewWithSinks("clm", nil, failing, sink)
+
+	input := &cloudformation.UpdateStackInput{StackName: aws.String("kube-1")}
+	auditor.Record("kube-1", "cloudformation:UpdateStack", "kube-1", input, nil)
+	auditor.Record("kube-1", "autoscaling:TerminateInstanceInAutoScalingGroup", "i-1", nil, fmt.Errorf("throttled"))
+	auditor.Record("kube-1", "s3:PutObject", "s3://bucket/userdata", nil, nil)
+
+	// failing sinks don't prevent the other sinks from being written to.
+	require.Len(t, sink.records, 3)
+	assert.Len(t, failing.records, 3)
+
+	first := sink.records[0]
+	assert.Equal(t, uint64(0), first.Sequence)
+	assert.Equal(t, "clm", first.Actor)
+	assert.Equal(t, OutcomeSucceeded, first.Outcome)
+	assert.Empty(t, first.PreviousHash)
+	inputsHash, err := hashInputs(input)
+	require.NoError(t, err)
+	assert.Equal(t, inputsHash, first.InputsHash)
+
+	assert.Equal(t, OutcomeFailed, sink.records[1].Outcome)
+	assert.Equal(t, "throttled", sink.records[1].Error)
+	assert.Equal(t, first.Hash, sink.records[1].PreviousHash)
+	require.NoError(t, Verify(sink.records))
+
+	// modified records break the chain.
+	modified := *sink.records[1]
+	modified.Outcome = OutcomeSucceeded
+	assert.Error(t, Verify([]*Record{first, &modified, sink.records[2]}))
+
+	// so do removed ones.
+	assert.Error(t, Verify([]*Record{first, sink.records[2]}))
+
+	// nil auditors are no-ops.
+	var disabled *Auditor
+	disabled.Record("kube-1", "s3:PutObject", "", nil, nil)
+}
+
+func TestInputResource(t *testing.T) {
+	for _, tc := range []struct {
+		input    interface{}
+		resource string
+	}{
+		{input: &cloudformation.DeleteStackInput{StackName: aws.String("kube-1")}, resource: "kube-1"},
+		{input: &s3.PutObjectInput{Bucket: aws.String("bucket"), Key: aws.String("userdata/worker")}, resource: "s3://bucket/userdata/worker"},
+		{input: &s3.CreateBucketInput{Bucket: aws.String("bucket")}, resource: "bucket"},
+		{input: &cloudformation.DeleteStackInput{}, resource: ""},
+		{input: nil, resource: ""},
+	} {
+		assert.Equal(t, tc.resource, inputResource(tc.input))
+	}
+}
+
+func TestInstrument(t *testing.T) {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("eu-central-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:    aws.String("http://127.0.0.1:1"),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+
+	sink := &recordingSink{}
+	NewWithSinks("clm", nil, sink).Instrument(sess, "aws:123456789012:eu-central-1:kube-1")
+
+	// read-only operations aren't recorded.
+	_, err = cloudformation.New(sess).DescribeStacks(&cloudformation.DescribeStacksInput{StackName: aws.String("kube-1")})
+	require.Error(t, err)
+	assert.Empty(t, sink.records)
+
+	_, err = cloudformation.New(sess).DeleteStack(&cloudformation.DeleteStackInput{StackName: aws.String("kube-1")})
+	require.Error(t, err)
+	require.Len(t, sink.records, 1)
+	assert.Equal(t, "aws:123456789012:eu-central-1:kube-1", sink.records[0].ClusterID)
+	assert.Equal(t, "cloudformation:DeleteStack", sink.records[0].Action)
+	assert.Equal(t, "kube-1", sink.records[0].Resource)
+	assert.Equal(t, OutcomeFailed, sink.records[0].Outcome)
+}
+
+func TestFileSink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "audit")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	config := Config{File: path.Join(dir, "audit.log"), Actor: "clm"}
+	auditor, err := New(config, nil)
+	require.NoError(t, err)
+	auditor.Record("kube-1", "cloudformation:UpdateStack", "kube-1", nil, nil)
+
+	// a new auditor continues the chain of the file.
+	auditor, err = New(config, nil)
+	require.NoError(t, err)
+	auditor.Record("kube-1", "cloudformation:DeleteStack", "kube-1", nil, nil)
+
+	records, err := ReadLog(config.File)
+	require.NoError(t, err)
+	require.Len(t, records, 2)
+	assert.Equal(t, uint64(1), records[1].Sequence)
+	assert.NoError(t, Verify(records))
+
+	auditor, err = New(Config{}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, auditor)
+}
+
+func TestS3Sink(t *testing.T) {
+	client := &s3APIStub{}
+	sink, err := newS3Sink(client, "s3://bucket/audit/")
+	require.NoError(t, err)
+
+	NewWithSinks("clm", nil, sink).Record("kube-1", "cloudformation:UpdateStack", "kube-1", nil, nil)
+	assert.Equal(t, "bucket", aws.StringValue(client.input.Bucket))
+	assert.True(t, strings.HasPrefix(aws.StringValue(client.input.Key), "audit/"))
+	assert.True(t, strings.HasSuffix(aws.StringValue(client.input.Key), ".json"))
+
+	for _, location := range []string{"bucket/audit", "s3:///audit", "https://bucket/audit"} {
+		_, err := newS3Sink(client, location)
+		assert.Error(t, err, location)
+	}
+}
+
+func TestCloudWatchLogsSink(t *testing.T) {
+	client := &cloudWatchLogsAPIStub{}
+	sink, err := newCloudWatchLogsSink(client, "clm-audit", "host:1/42")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(sink.logStream, "host-1/42-"))
+
+	auditor := NewWithSinks("clm", nil, sink)
+	auditor.Record("kube-1", "cloudformation:UpdateStack", "kube-1", nil, nil)
+	auditor.Record("kube-1", "cloudformation:DeleteStack", "kube-1", nil, nil)
+
+	// the events are put with the sequence token of the previous call.
+	require.Len(t, client.inputs, 2)
+	assert.Nil(t, client.inputs[0].SequenceToken)
+	assert.Equal(t, "token-1", aws.StringValue(client.inputs[1].SequenceToken))
+	assert.Contains(t, aws.StringValue(client.inputs[1].LogEvents[0].Message), `"action":"cloudformation:DeleteStack"`)
+}
@@ -0,0 +1,244 @@
+package audit
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/cloudwatchlogs"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// Config defines the sinks the audit records are written to and the actor
+// recorded in them.
+type Config struct {
+	File               string
+	S3Location         string
+	CloudWatchLogGroup string
+	Actor              string
+}
+
+// New initializes an Auditor writing to the sinks of the config. It returns
+// nil if no sinks are configured. The records continue the chain of the
+// audit log file if it exists. S3 and CloudWatch Logs are written to with the
+// session.
+func New(config Config, sess *session.Session) (*Auditor, error) {
+	var (
+		sinks []Sink
+		last  *Record
+	)
+
+	if config.File != "" {
+		records, err := ReadLog(config.File)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+		if len(records) > 0 {
+			last = records[len(records)-1]
+		}
+		sinks = append(sinks, &fileSink{path: config.File})
+	}
+
+	if config.S3Location != "" {
+		sink, err := newS3Sink(s3.New(sess), config.S3Location)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if config.CloudWatchLogGroup != "" {
+		sink, err := newCloudWatchLogsSink(cloudwatchlogs.New(sess), config.CloudWatchLogGroup, config.Actor)
+		if err != nil {
+			return nil, err
+		}
+		sinks = append(sinks, sink)
+	}
+
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+
+	return NewWithSinks(config.Actor, last, sinks...), nil
+}
+
+// ReadLog reads the records of an audit log file written by the file sink.
+func ReadLog(path string) ([]*Record, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []*Record
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		var record Record
+		err := json.Unmarshal(line, &record)
+		if err != nil {
+			return nil, fmt.Errorf("invalid record in %s after %d records: %v", path, len(records), err)
+		}
+		records = append(records, &record)
+	}
+	return records, scanner.Err()
+}
+
+// fileSink appends the records as JSON lines to a file.
+type fileSink struct {
+	path string
+}
+
+func (s *fileSink) Write(record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	file, err := os.OpenFile(s.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0640)
+	if err != nil {
+		return err
+	}
+
+	_, err = file.Write(append(data, '\n'))
+	if err != nil {
+		file.Close()
+		return err
+	}
+
+	err = file.Sync()
+	if err != nil {
+		file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// s3API is the minimal interface containing the S3 operations used.
+type s3API interface {
+	PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error)
+}
+
+// s3Sink writes every record as an object of its own below the prefix, so
+// the bucket can protect them with object lock.
+type s3Sink struct {
+	client s3API
+	bucket string
+	prefix string
+}
+
+// newS3Sink initializes a sink writing to the location given as
+// s3://<bucket>/<prefix>.
+func newS3Sink(client s3API, location string) (*s3Sink, error) {
+	u, err := url.Parse(location)
+	if err != nil {
+		return nil, fmt.Errorf("invalid S3 location %s: %v", location, err)
+	}
+
+	if u.Scheme != "s3" || u.Host == "" {
+		return nil, fmt.Errorf("invalid S3 location %s: expected s3://<bucket>/<prefix>", location)
+	}
+
+	prefix := strings.Trim(u.Path, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+
+	return &s3Sink{client: client, bucket: u.Host, prefix: prefix}, nil
+}
+
+func (s *s3Sink) Write(record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	// the keys sort by time, the hash keeps the records of concurrent
+	// instances apart.
+	key := fmt.Sprintf("%s%s/%s-%s.json", s.prefix, record.Time.Format("2006/01/02"), record.Time.Format("150405.000000000"), record.Hash)
+
+	_, err = s.client.PutObject(&s3.PutObjectInput{
+		Bucket:      aws.String(s.bucket),
+		Key:         aws.String(key),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+	})
+	return err
+}
+
+// cloudWatchLogsAPI is the minimal interface containing the CloudWatch Logs
+// operations used.
+type cloudWatchLogsAPI interface {
+	CreateLogStream(input *cloudwatchlogs.CreateLogStreamInput) (*cloudwatchlogs.CreateLogStreamOutput, error)
+	PutLogEvents(input *cloudwatchlogs.PutLogEventsInput) (*cloudwatchlogs.PutLogEventsOutput, error)
+}
+
+// cloudWatchLogsSink writes the records as events to a log stream of its own
+// in the log group.
+type cloudWatchLogsSink struct {
+	client        cloudWatchLogsAPI
+	logGroup      string
+	logStream     string
+	mutex         sync.Mutex
+	sequenceToken *string
+}
+
+// newCloudWatchLogsSink creates the log stream of the sink, named after the
+// actor and the current time.
+func newCloudWatchLogsSink(client cloudWatchLogsAPI, logGroup, actor string) (*cloudWatchLogsSink, error) {
+	// ':' and '*' aren't allowed in the names of log streams.
+	name := strings.NewReplacer(":", "-", "*", "-").Replace(actor)
+	logStream := fmt.Sprintf("%s-%s", name, time.Now().UTC().Format("20060102T150405Z"))
+
+	_, err := client.CreateLogStream(&cloudwatchlogs.CreateLogStreamInput{
+		LogGroupName:  aws.String(logGroup),
+		LogStreamName: aws.String(logStream),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != cloudwatchlogs.ErrCodeResourceAlreadyExistsException {
+			return nil, fmt.Errorf("failed to create log stream %s in %s: %v", logStream, logGroup, err)
+		}
+	}
+
+	return &cloudWatchLogsSink{client: client, logGroup: logGroup, logStream: logStream}, nil
+}
+
+func (s *cloudWatchLogsSink) Write(record *Record) error {
+	data, err := json.Marshal(record)
+	if err != nil {
+		return err
+	}
+
+	s.mutex.Lock()
+	defer s.mutex.Unlock()
+
+	resp, err := s.client.PutLogEvents(&cloudwatchlogs.PutLogEventsInput{
+		LogGroupName:  aws.String(s.logGroup),
+		LogStreamName: aws.String(s.logStream),
+		SequenceToken: s.sequenceToken,
+		LogEvents: []*cloudwatchlogs.InputLogEvent{
+			{
+				Message:   aws.String(string(data)),
+				Timestamp: aws.Int64(record.Time.UnixNano() / int64(time.Millisecond)),
+			},
+		},
+	})
+	if err != nil {
+		return err
+	}
+	s.sequenceToken = resp.NextSequenceToken
+	return nil
+}
@@ -9,21 +9,36 @@ import (
 	"github.com/aws/aws-sdk-go/service/sts"
 )
 
+// DefaultExpiryWindow is the time before their expiration credentials of
+// assumed roles are refreshed, such that they don't expire during long
+// running operations.
+const DefaultExpiryWindow = 5 * time.Minute
+
+// assumeRoleAPI is the minimal interface containing only the methods we use
+// from the AWS SDK for STS.
+type assumeRoleAPI interface {
+	AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error)
+}
+
 // AssumeRoleProvider is an AWS SDK credentials provider which retrieve
 // credentials by assuming the defined role.
 type AssumeRoleProvider struct {
+	credentials.Expiry
 	role        string
 	sessionName string
-	creds       *sts.Credentials
-	sts         *sts.STS
+	sts         assumeRoleAPI
+	// ExpiryWindow is the time before their expiration the credentials
+	// are considered expired.
+	ExpiryWindow time.Duration
 }
 
 // NewAssumeRoleProvider initializes a new AssumeRoleProvider.
 func NewAssumeRoleProvider(role, sessionName string, sess *session.Session) *AssumeRoleProvider {
 	return &AssumeRoleProvider{
-		role:        role,
-		sessionName: sessionName,
-		sts:         sts.New(sess),
+		role:         role,
+		sessionName:  sessionName,
+		sts:          sts.New(sess),
+		ExpiryWindow: DefaultExpiryWindow,
 	}
 }
 
@@ -39,7 +54,7 @@ func (a *AssumeRoleProvider) Retrieve() (credentials.Value, error) {
 		return credentials.Value{}, err
 	}
 
-	a.creds = resp.Credentials
+	a.SetExpiration(aws.TimeValue(resp.Credentials.Expiration), a.ExpiryWindow)
 
 	return credentials.Value{
 		AccessKeyID:     *resp.Credentials.AccessKeyId,
@@ -48,12 +63,3 @@ func (a *AssumeRoleProvider) Retrieve() (credentials.Value, error) {
 		ProviderName:    "assumeRoleProvider",
 	}, nil
 }
-
-// IsExpired is true when the credentials has expired and must be retrieved
-// again.
-func (a *AssumeRoleProvider) IsExpired() bool {
-	if a.creds != nil && a.creds.Expiration != nil {
-		return time.Now().UTC().After(*a.creds.Expiration)
-	}
-	return true
-}
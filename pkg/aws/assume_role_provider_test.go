@@ -0,0 +1,71 @@
+package aws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sts"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type assumeRoleAPIStub struct {
+	expiration time.Time
+	calls      int
+}
+
+func (s *assumeRoleAPIStub) AssumeRole(input *sts.AssumeRoleInput) (*sts.AssumeRoleOutput, error) {
+	s.calls++
+	return &sts.AssumeRoleOutput{
+		Credentials: &sts.Credentials{
+			AccessKeyId:     aws.String("id"),
+			SecretAccessKey: aws.String("secret"),
+			SessionToken:    aws.String("token"),
+			Expiration:      aws.Time(s.expiration),
+		},
+	}, nil
+}
+
+func TestAssumeRoleProviderExpiryWindow(t *testing.T) {
+	stub := &assumeRoleAPIStub{expiration: time.Now().Add(10 * time.Minute)}
+	provider := &AssumeRoleProvider{
+		role:         "arn:aws:iam::123456789012:role/cluster-lifecycle-manager",
+		sessionName:  awsSessionName,
+		sts:          stub,
+		ExpiryWindow: DefaultExpiryWindow,
+	}
+	assert.True(t, provider.IsExpired())
+
+	creds := credentials.NewCredentials(provider)
+	value, err := creds.Get()
+	require.NoError(t, err)
+	assert.Equal(t, "id", value.AccessKeyID)
+	assert.False(t, provider.IsExpired())
+
+	// the credentials are reused until they're about to expire.
+	_, err = creds.Get()
+	require.NoError(t, err)
+	assert.Equal(t, 1, stub.calls)
+
+	stub.expiration = time.Now().Add(time.Minute)
+	creds.Expire()
+	_, err = creds.Get()
+	require.NoError(t, err)
+	assert.True(t, provider.IsExpired())
+	_, err = creds.Get()
+	require.NoError(t, err)
+	assert.Equal(t, 3, stub.calls)
+}
+
+func TestCredentialsCache(t *testing.T) {
+	sess, err := session.NewSession(&aws.Config{Region: aws.String("eu-central-1")})
+	require.NoError(t, err)
+
+	cache := NewCredentialsCache()
+	first := cache.roleCredentials("arn:aws:iam::123456789012:role/clm", sess)
+	assert.True(t, first == cache.roleCredentials("arn:aws:iam::123456789012:role/clm", sess))
+	assert.False(t, first == cache.roleCredentials("arn:aws:iam::210987654321:role/clm", sess))
+}
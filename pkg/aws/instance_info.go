@@ -4,6 +4,7 @@ import (
 	"encoding/json"
 	"reflect"
 	"strconv"
+	"strings"
 	"sync"
 
 	log "github.com/sirupsen/logrus"
@@ -11,12 +12,94 @@ import (
 
 const (
 	gigabyte = 1024 * 1024 * 1024
+	// ipsPerPrefix is the number of IPs of the /28 prefix assigned to an
+	// ENI slot with prefix delegation.
+	ipsPerPrefix = 16
+	// maxPodsSmallInstance and maxPodsLargeInstance are the max pods
+	// recommended with prefix delegation for instance types with less
+	// and at least largeInstanceVCPU vCPUs.
+	maxPodsSmallInstance = 110
+	maxPodsLargeInstance = 250
+	largeInstanceVCPU    = 30
 )
 
+// gpuTypes maps instance families to the type of GPUs of the instances,
+// which is not part of the instance data.
+var gpuTypes = map[string]string{
+	"g2": "nvidia-grid-k520",
+	"g3": "nvidia-tesla-m60",
+	"p2": "nvidia-tesla-k80",
+	"p3": "nvidia-tesla-v100",
+}
+
+// architectures maps the architecture names of the instance data to the
+// names used by Go and Kubernetes.
+var architectures = map[string]string{
+	"x86_64": "amd64",
+	"i386":   "386",
+	"arm64":  "arm64",
+}
+
 type Instance struct {
-	VCPU    int64
-	Memory  int64
+	VCPU          int64
+	Memory        int64
+	GPU           int64
+	GPUType       string
+	Architectures []string
+	// EBSOptimized is true if the instance has dedicated bandwidth to
+	// EBS, which provisioned IOPS volumes depend on.
+	EBSOptimized bool
+	// EBSMaxIOPS is the maximum number of IOPS the instance can drive to
+	// its EBS volumes, 0 if unknown.
+	EBSMaxIOPS int64
+	// PreviousGeneration is true if the instance type is superseded by a
+	// current generation instance type.
+	PreviousGeneration bool
+	// Pricing maps the regions the instance type is available in to the
+	// on-demand price.
 	Pricing map[string]string
+	// MaxENIs is the maximum number of network interfaces and IPsPerENI
+	// the number of private IPv4 addresses per interface, 0 if unknown.
+	MaxENIs   int64
+	IPsPerENI int64
+}
+
+// AvailableIn returns true if the instance type is available in the region.
+// Instance types without any pricing are assumed to be available everywhere.
+func (i Instance) AvailableIn(region string) bool {
+	if len(i.Pricing) == 0 {
+		return true
+	}
+	_, ok := i.Pricing[region]
+	return ok
+}
+
+// MaxPods returns the maximum number of pods of the instance type with the
+// AWS VPC CNI, which assigns every pod an IP of the ENIs of the node. With
+// prefix delegation every secondary IP slot holds a /28 prefix instead, and
+// the number of pods is capped at the recommended limit of the instance
+// size. It returns 0 if the ENI limits of the instance type are unknown.
+func (i Instance) MaxPods(prefixDelegation bool) int64 {
+	if i.MaxENIs == 0 || i.IPsPerENI == 0 {
+		return 0
+	}
+
+	// the primary IP of every ENI isn't available for pods, the two host
+	// network pods of the CNI and kube-proxy don't need an IP.
+	if !prefixDelegation {
+		return i.MaxENIs*(i.IPsPerENI-1) + 2
+	}
+
+	limit := int64(maxPodsSmallInstance)
+	if i.VCPU >= largeInstanceVCPU {
+		limit = maxPodsLargeInstance
+	}
+
+	maxPods := i.MaxENIs*(i.IPsPerENI-1)*ipsPerPrefix + 2
+	if maxPods > limit {
+		return limit
+	}
+	return maxPods
 }
 
 type pricing struct {
@@ -31,7 +114,18 @@ type instanceInfo struct {
 	InstanceType string               `json:"instance_type"`
 	VCPU         interface{}          `json:"vCPU"`
 	Memory       float64              `json:"memory"`
+	GPU          int64                `json:"GPU"`
+	Arch         []string             `json:"arch"`
+	EBSOptimized bool                 `json:"ebs_optimized"`
+	EBSIOPS      float64              `json:"ebs_iops"`
+	Generation   string               `json:"generation"`
 	Pricing      map[string]osPricing `json:"pricing"`
+	VPC          vpcInfo              `json:"vpc"`
+}
+
+type vpcInfo struct {
+	MaxENIs   int64 `json:"max_enis"`
+	IPsPerENI int64 `json:"ips_per_eni"`
 }
 
 var loadedInstances struct {
@@ -79,10 +173,30 @@ func loadInstanceInfo() map[string]Instance {
 			pricing[az] = azPricing.Linux.OnDemand
 		}
 
+		var gpuType string
+		if instance.GPU > 0 {
+			gpuType = gpuTypes[strings.SplitN(instance.InstanceType, ".", 2)[0]]
+		}
+
+		archs := make([]string, 0, len(instance.Arch))
+		for _, arch := range instance.Arch {
+			if name, ok := architectures[arch]; ok {
+				archs = append(archs, name)
+			}
+		}
+
 		result[instance.InstanceType] = Instance{
-			VCPU:    vCPU,
-			Memory:  int64(instance.Memory * gigabyte),
-			Pricing: pricing,
+			VCPU:               vCPU,
+			Memory:             int64(instance.Memory * gigabyte),
+			GPU:                instance.GPU,
+			GPUType:            gpuType,
+			Architectures:      archs,
+			EBSOptimized:       instance.EBSOptimized,
+			EBSMaxIOPS:         int64(instance.EBSIOPS),
+			PreviousGeneration: instance.Generation == "previous",
+			Pricing:            pricing,
+			MaxENIs:            instance.VPC.MaxENIs,
+			IPsPerENI:          instance.VPC.IPsPerENI,
 		}
 	}
 
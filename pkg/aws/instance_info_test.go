@@ -0,0 +1,56 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestInstanceMaxPods(t *testing.T) {
+	for _, tc := range []struct {
+		msg              string
+		instance         Instance
+		prefixDelegation bool
+		expected         int64
+	}{
+		{
+			msg:      "secondary IPs",
+			instance: Instance{VCPU: 2, MaxENIs: 2, IPsPerENI: 10},
+			expected: 20,
+		},
+		{
+			msg:              "prefix delegation",
+			instance:         Instance{VCPU: 1, MaxENIs: 2, IPsPerENI: 2},
+			prefixDelegation: true,
+			expected:         34,
+		},
+		{
+			msg:              "prefix delegation capped for small instances",
+			instance:         Instance{VCPU: 2, MaxENIs: 2, IPsPerENI: 10},
+			prefixDelegation: true,
+			expected:         110,
+		},
+		{
+			msg:              "prefix delegation capped for large instances",
+			instance:         Instance{VCPU: 40, MaxENIs: 8, IPsPerENI: 30},
+			prefixDelegation: true,
+			expected:         250,
+		},
+		{
+			msg:      "unknown ENI limits",
+			instance: Instance{VCPU: 2},
+			expected: 0,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.instance.MaxPods(tc.prefixDelegation))
+		})
+	}
+}
+
+func TestInstanceInfoENILimits(t *testing.T) {
+	instance, ok := InstanceInfo()["m4.large"]
+	assert.True(t, ok)
+	assert.EqualValues(t, 2, instance.MaxENIs)
+	assert.EqualValues(t, 10, instance.IPsPerENI)
+}
@@ -0,0 +1,156 @@
+package aws
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+)
+
+const (
+	lockKeyAttribute     = "cluster_id"
+	lockHolderAttribute  = "holder"
+	lockExpiresAttribute = "expires"
+)
+
+// LockHeldError is returned when the lock of a cluster is held by another
+// holder whose lease didn't expire yet.
+type LockHeldError struct {
+	ClusterID string
+	Holder    string
+	Expires   time.Time
+}
+
+func (e *LockHeldError) Error() string {
+	if e.Holder == "" {
+		return fmt.Sprintf("cluster %s is locked by another holder", e.ClusterID)
+	}
+	return fmt.Sprintf("cluster %s is locked by %s until %s", e.ClusterID, e.Holder, e.Expires.UTC().Format(time.RFC3339))
+}
+
+// dynamoDBAPI is a minimal interface containing only the methods we use from
+// the DynamoDB API.
+type dynamoDBAPI interface {
+	GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error)
+	PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error)
+	DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error)
+}
+
+// DynamoDBLocker leases the locks of clusters stored as items of a DynamoDB
+// table with the string partition key cluster_id. A lease expires after the
+// TTL unless it's renewed by its holder. The expires attribute holds the Unix
+// time of the expiry, such that it can be used as TTL attribute of the table
+// to clean up abandoned leases.
+type DynamoDBLocker struct {
+	client dynamoDBAPI
+	table  string
+	holder string
+	ttl    time.Duration
+	now    func() time.Time
+}
+
+// NewDynamoDBLocker initializes a new DynamoDBLocker leasing the locks in the
+// table for the holder.
+func NewDynamoDBLocker(sess *session.Session, table, holder string, ttl time.Duration) *DynamoDBLocker {
+	return &DynamoDBLocker{
+		client: dynamodb.New(sess),
+		table:  table,
+		holder: holder,
+		ttl:    ttl,
+		now:    time.Now,
+	}
+}
+
+// Lock acquires or renews the lease of the lock of a cluster. A
+// LockHeldError is returned if the lock is held by another holder.
+func (l *DynamoDBLocker) Lock(clusterID string) error {
+	now := l.now()
+
+	_, err := l.client.PutItem(&dynamodb.PutItemInput{
+		TableName: aws.String(l.table),
+		Item: map[string]*dynamodb.AttributeValue{
+			lockKeyAttribute:     {S: aws.String(clusterID)},
+			lockHolderAttribute:  {S: aws.String(l.holder)},
+			lockExpiresAttribute: {N: aws.String(strconv.FormatInt(now.Add(l.ttl).Unix(), 10))},
+		},
+		ConditionExpression: aws.String(fmt.Sprintf("attribute_not_exists(%s) OR %s = :holder OR %s < :now", lockKeyAttribute, lockHolderAttribute, lockExpiresAttribute)),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":holder": {S: aws.String(l.holder)},
+			":now":    {N: aws.String(strconv.FormatInt(now.Unix(), 10))},
+		},
+	})
+	if isConditionalCheckFailed(err) {
+		return l.heldError(clusterID)
+	}
+	return err
+}
+
+// Unlock releases the lease of the lock of a cluster. Locks held by other
+// holders, e.g. because the lease expired in between, are left untouched.
+func (l *DynamoDBLocker) Unlock(clusterID string) error {
+	_, err := l.client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName:           aws.String(l.table),
+		Key:                 lockKey(clusterID),
+		ConditionExpression: aws.String(fmt.Sprintf("%s = :holder", lockHolderAttribute)),
+		ExpressionAttributeValues: map[string]*dynamodb.AttributeValue{
+			":holder": {S: aws.String(l.holder)},
+		},
+	})
+	if isConditionalCheckFailed(err) {
+		return nil
+	}
+	return err
+}
+
+// ForceUnlock releases the lock of a cluster regardless of its holder.
+func (l *DynamoDBLocker) ForceUnlock(clusterID string) error {
+	_, err := l.client.DeleteItem(&dynamodb.DeleteItemInput{
+		TableName: aws.String(l.table),
+		Key:       lockKey(clusterID),
+	})
+	return err
+}
+
+// heldError returns a LockHeldError describing the current lease of the lock
+// of a cluster. The holder is left empty if the lease can't be read.
+func (l *DynamoDBLocker) heldError(clusterID string) error {
+	heldErr := &LockHeldError{ClusterID: clusterID}
+
+	resp, err := l.client.GetItem(&dynamodb.GetItemInput{
+		TableName:      aws.String(l.table),
+		Key:            lockKey(clusterID),
+		ConsistentRead: aws.Bool(true),
+	})
+	if err != nil || resp.Item == nil {
+		return heldErr
+	}
+
+	if holder, ok := resp.Item[lockHolderAttribute]; ok {
+		heldErr.Holder = aws.StringValue(holder.S)
+	}
+	if expires, ok := resp.Item[lockExpiresAttribute]; ok {
+		seconds, err := strconv.ParseInt(aws.StringValue(expires.N), 10, 64)
+		if err == nil {
+			heldErr.Expires = time.Unix(seconds, 0)
+		}
+	}
+	return heldErr
+}
+
+// lockKey returns the key of the lock item of a cluster.
+func lockKey(clusterID string) map[string]*dynamodb.AttributeValue {
+	return map[string]*dynamodb.AttributeValue{
+		lockKeyAttribute: {S: aws.String(clusterID)},
+	}
+}
+
+// isConditionalCheckFailed returns true if the error is caused by a failed
+// condition of a DynamoDB write.
+func isConditionalCheckFailed(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == dynamodb.ErrCodeConditionalCheckFailedException
+}
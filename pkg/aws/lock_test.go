@@ -0,0 +1,92 @@
+package aws
+
+import (
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/dynamodb"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+// dynamoDBLockStub stores the lock items in memory, evaluating the
+// conditions of the writes like the lock expressions would.
+type dynamoDBLockStub struct {
+	items map[string]map[string]*dynamodb.AttributeValue
+}
+
+func (d *dynamoDBLockStub) GetItem(input *dynamodb.GetItemInput) (*dynamodb.GetItemOutput, error) {
+	return &dynamodb.GetItemOutput{Item: d.items[aws.StringValue(input.Key[lockKeyAttribute].S)]}, nil
+}
+
+func (d *dynamoDBLockStub) PutItem(input *dynamodb.PutItemInput) (*dynamodb.PutItemOutput, error) {
+	key := aws.StringValue(input.Item[lockKeyAttribute].S)
+	if current, ok := d.items[key]; ok && input.ConditionExpression != nil {
+		expires, _ := strconv.ParseInt(aws.StringValue(current[lockExpiresAttribute].N), 10, 64)
+		now, _ := strconv.ParseInt(aws.StringValue(input.ExpressionAttributeValues[":now"].N), 10, 64)
+		if aws.StringValue(current[lockHolderAttribute].S) != aws.StringValue(input.ExpressionAttributeValues[":holder"].S) && expires >= now {
+			return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "conditional request failed", nil)
+		}
+	}
+	d.items[key] = input.Item
+	return &dynamodb.PutItemOutput{}, nil
+}
+
+func (d *dynamoDBLockStub) DeleteItem(input *dynamodb.DeleteItemInput) (*dynamodb.DeleteItemOutput, error) {
+	key := aws.StringValue(input.Key[lockKeyAttribute].S)
+	if current, ok := d.items[key]; ok && input.ConditionExpression != nil {
+		if aws.StringValue(current[lockHolderAttribute].S) != aws.StringValue(input.ExpressionAttributeValues[":holder"].S) {
+			return nil, awserr.New(dynamodb.ErrCodeConditionalCheckFailedException, "conditional request failed", nil)
+		}
+	}
+	delete(d.items, key)
+	return &dynamodb.DeleteItemOutput{}, nil
+}
+
+func TestDynamoDBLocker(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	stub := &dynamoDBLockStub{items: make(map[string]map[string]*dynamodb.AttributeValue)}
+
+	newLocker := func(holder string) *DynamoDBLocker {
+		return &DynamoDBLocker{
+			client: stub,
+			table:  "locks",
+			holder: holder,
+			ttl:    5 * time.Minute,
+			now:    func() time.Time { return now },
+		}
+	}
+	a := newLocker("a")
+	b := newLocker("b")
+
+	require.NoError(t, a.Lock("kube-1"))
+	// the holder renews its lease.
+	require.NoError(t, a.Lock("kube-1"))
+
+	err := b.Lock("kube-1")
+	require.Error(t, err)
+	heldErr, ok := err.(*LockHeldError)
+	require.True(t, ok)
+	assert.Equal(t, "a", heldErr.Holder)
+	assert.True(t, now.Add(5*time.Minute).Equal(heldErr.Expires))
+
+	// other clusters aren't affected.
+	require.NoError(t, b.Lock("kube-2"))
+
+	// releasing the lock of another holder is a no-op.
+	require.NoError(t, b.Unlock("kube-1"))
+	assert.Error(t, b.Lock("kube-1"))
+
+	// expired leases can be taken over.
+	now = now.Add(6 * time.Minute)
+	require.NoError(t, b.Lock("kube-1"))
+	assert.Error(t, a.Lock("kube-1"))
+
+	require.NoError(t, a.ForceUnlock("kube-1"))
+	require.NoError(t, a.Lock("kube-1"))
+	require.NoError(t, a.Unlock("kube-1"))
+	require.NoError(t, b.Lock("kube-1"))
+}
@@ -0,0 +1,216 @@
+package aws
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	awspricing "github.com/aws/aws-sdk-go/service/pricing"
+	log "github.com/sirupsen/logrus"
+)
+
+// pricingAPIRegion is the region of the AWS Pricing API endpoint.
+const pricingAPIRegion = "us-east-1"
+
+// PriceSource looks up the Linux on-demand price of an instance type in a
+// region.
+type PriceSource interface {
+	OnDemandPrice(instanceType, region string) (string, error)
+}
+
+// OnDemandPrice returns the Linux on-demand price of an instance type in a
+// region from the instance info. If the instance info has no price for the
+// instance type and region, the price is looked up from the fallback source
+// unless it's nil.
+func OnDemandPrice(instanceType, region string, fallback PriceSource) (string, error) {
+	if instanceInfo, ok := InstanceInfo()[instanceType]; ok {
+		if price, ok := instanceInfo.Pricing[region]; ok {
+			return price, nil
+		}
+	}
+
+	if fallback == nil {
+		return "", fmt.Errorf("no price data for region %s, instance type %s", region, instanceType)
+	}
+
+	price, err := fallback.OnDemandPrice(instanceType, region)
+	if err != nil {
+		return "", fmt.Errorf("no price data for region %s, instance type %s: %v", region, instanceType, err)
+	}
+	return price, nil
+}
+
+// pricingAPI is a minimal interface containing only the methods we use from
+// the AWS Pricing API.
+type pricingAPI interface {
+	GetProducts(input *awspricing.GetProductsInput) (*awspricing.GetProductsOutput, error)
+}
+
+// cachedPrice is a price cached on disk.
+type cachedPrice struct {
+	Price     string    `json:"price"`
+	FetchedAt time.Time `json:"fetched_at"`
+}
+
+// PricingAPISource is a PriceSource querying the AWS Pricing API. Prices are
+// cached in a file for the configured TTL, such that they survive restarts.
+type PricingAPISource struct {
+	sync.Mutex
+	client    pricingAPI
+	cacheFile string
+	ttl       time.Duration
+	now       func() time.Time
+}
+
+// NewPricingAPISource initializes a new PricingAPISource caching the prices in
+// cacheFile.
+func NewPricingAPISource(sess *session.Session, cacheFile string, ttl time.Duration) *PricingAPISource {
+	return &PricingAPISource{
+		client:    awspricing.New(sess, aws.NewConfig().WithRegion(pricingAPIRegion)),
+		cacheFile: cacheFile,
+		ttl:       ttl,
+		now:       time.Now,
+	}
+}
+
+// OnDemandPrice returns the Linux on-demand price of an instance type in a
+// region, either from the cache or from the AWS Pricing API.
+func (s *PricingAPISource) OnDemandPrice(instanceType, region string) (string, error) {
+	s.Lock()
+	defer s.Unlock()
+
+	key := fmt.Sprintf("%s/%s", region, instanceType)
+
+	cache := s.loadCache()
+	if cached, ok := cache[key]; ok && s.now().Sub(cached.FetchedAt) < s.ttl {
+		return cached.Price, nil
+	}
+
+	price, err := s.queryPrice(instanceType, region)
+	if err != nil {
+		return "", err
+	}
+
+	cache[key] = cachedPrice{Price: price, FetchedAt: s.now()}
+	err = s.saveCache(cache)
+	if err != nil {
+		log.Warnf("Failed to save pricing cache %s: %v", s.cacheFile, err)
+	}
+
+	return price, nil
+}
+
+// queryPrice queries the Linux on-demand price of an instance type in a
+// region from the AWS Pricing API. The products are filtered by the region
+// code, such that new regions don't need to be mapped to their location
+// names.
+func (s *PricingAPISource) queryPrice(instanceType, region string) (string, error) {
+	filters := map[string]string{
+		"instanceType":    instanceType,
+		"regionCode":      region,
+		"operatingSystem": "Linux",
+		"tenancy":         "Shared",
+		"preInstalledSw":  "NA",
+	}
+
+	params := &awspricing.GetProductsInput{
+		ServiceCode: aws.String("AmazonEC2"),
+	}
+	for field, value := range filters {
+		params.Filters = append(params.Filters, &awspricing.Filter{
+			Type:  aws.String(awspricing.FilterTypeTermMatch),
+			Field: aws.String(field),
+			Value: aws.String(value),
+		})
+	}
+
+	resp, err := s.client.GetProducts(params)
+	if err != nil {
+		return "", err
+	}
+
+	for _, product := range resp.PriceList {
+		price, ok := onDemandProductPrice(product)
+		if ok {
+			return price, nil
+		}
+	}
+
+	return "", fmt.Errorf("no on-demand price found in the AWS Pricing API")
+}
+
+// onDemandProductPrice returns the hourly on-demand price in USD of a product
+// of the AWS Pricing API. Products of capacity reservations are ignored.
+func onDemandProductPrice(product aws.JSONValue) (string, bool) {
+	attributes := jsonObject(jsonObject(product["product"])["attributes"])
+	if status, ok := attributes["capacitystatus"].(string); ok && status != "Used" {
+		return "", false
+	}
+
+	for _, term := range jsonObject(jsonObject(product["terms"])["OnDemand"]) {
+		for _, dimension := range jsonObject(jsonObject(term)["priceDimensions"]) {
+			usd, ok := jsonObject(jsonObject(dimension)["pricePerUnit"])["USD"].(string)
+			if !ok {
+				continue
+			}
+
+			price, err := strconv.ParseFloat(usd, 64)
+			if err != nil || price == 0 {
+				continue
+			}
+			return strconv.FormatFloat(price, 'f', -1, 64), true
+		}
+	}
+
+	return "", false
+}
+
+// jsonObject returns value as a JSON object or an empty object if it isn't
+// one.
+func jsonObject(value interface{}) map[string]interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		return v
+	case aws.JSONValue:
+		return v
+	}
+	return map[string]interface{}{}
+}
+
+// loadCache loads the cached prices. A missing or invalid cache file results
+// in an empty cache.
+func (s *PricingAPISource) loadCache() map[string]cachedPrice {
+	cache := make(map[string]cachedPrice)
+
+	data, err := ioutil.ReadFile(s.cacheFile)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			log.Warnf("Failed to read pricing cache %s: %v", s.cacheFile, err)
+		}
+		return cache
+	}
+
+	err = json.Unmarshal(data, &cache)
+	if err != nil {
+		log.Warnf("Ignoring invalid pricing cache %s: %v", s.cacheFile, err)
+		return make(map[string]cachedPrice)
+	}
+
+	return cache
+}
+
+// saveCache writes the cached prices to the cache file.
+func (s *PricingAPISource) saveCache(cache map[string]cachedPrice) error {
+	data, err := json.Marshal(cache)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(s.cacheFile, data, 0644)
+}
@@ -0,0 +1,136 @@
+package aws
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	awspricing "github.com/aws/aws-sdk-go/service/pricing"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type pricingAPIStub struct {
+	calls     int
+	filters   map[string]string
+	priceList []aws.JSONValue
+	err       error
+}
+
+func (p *pricingAPIStub) GetProducts(input *awspricing.GetProductsInput) (*awspricing.GetProductsOutput, error) {
+	p.calls++
+	p.filters = make(map[string]string, len(input.Filters))
+	for _, filter := range input.Filters {
+		p.filters[aws.StringValue(filter.Field)] = aws.StringValue(filter.Value)
+	}
+	return &awspricing.GetProductsOutput{PriceList: p.priceList}, p.err
+}
+
+type priceSourceStub map[string]string
+
+func (p priceSourceStub) OnDemandPrice(instanceType, region string) (string, error) {
+	price, ok := p[region+"/"+instanceType]
+	if !ok {
+		return "", errors.New("not found")
+	}
+	return price, nil
+}
+
+func testProduct(capacityStatus, price string) aws.JSONValue {
+	return aws.JSONValue{
+		"product": map[string]interface{}{
+			"attributes": map[string]interface{}{"capacitystatus": capacityStatus},
+		},
+		"terms": map[string]interface{}{
+			"OnDemand": map[string]interface{}{
+				"offer": map[string]interface{}{
+					"priceDimensions": map[string]interface{}{
+						"dimension": map[string]interface{}{
+							"pricePerUnit": map[string]interface{}{"USD": price},
+						},
+					},
+				},
+			},
+		},
+	}
+}
+
+func TestOnDemandPrice(t *testing.T) {
+	price, err := OnDemandPrice("m4.large", "eu-central-1", nil)
+	require.NoError(t, err)
+	assert.Equal(t, InstanceInfo()["m4.large"].Pricing["eu-central-1"], price)
+
+	_, err = OnDemandPrice("m9.large", "eu-central-1", nil)
+	assert.Error(t, err)
+
+	price, err = OnDemandPrice("m9.large", "eu-central-1", priceSourceStub{"eu-central-1/m9.large": "0.2"})
+	require.NoError(t, err)
+	assert.Equal(t, "0.2", price)
+
+	_, err = OnDemandPrice("m9.large", "eu-west-1", priceSourceStub{"eu-central-1/m9.large": "0.2"})
+	assert.Error(t, err)
+}
+
+func TestPricingAPISource(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pricing")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	client := &pricingAPIStub{
+		priceList: []aws.JSONValue{
+			testProduct("AllocatedCapacityReservation", "0.0000000000"),
+			testProduct("Used", "0.1150000000"),
+		},
+	}
+	source := &PricingAPISource{
+		client:    client,
+		cacheFile: path.Join(dir, "cache.json"),
+		ttl:       time.Hour,
+		now:       func() time.Time { return now },
+	}
+
+	price, err := source.OnDemandPrice("m9.large", "eu-central-1")
+	require.NoError(t, err)
+	assert.Equal(t, "0.115", price)
+	assert.Equal(t, 1, client.calls)
+	assert.Equal(t, map[string]string{
+		"instanceType":    "m9.large",
+		"regionCode":      "eu-central-1",
+		"operatingSystem": "Linux",
+		"tenancy":         "Shared",
+		"preInstalledSw":  "NA",
+	}, client.filters)
+
+	// cached prices survive restarts
+	source = &PricingAPISource{client: client, cacheFile: source.cacheFile, ttl: time.Hour, now: source.now}
+	price, err = source.OnDemandPrice("m9.large", "eu-central-1")
+	require.NoError(t, err)
+	assert.Equal(t, "0.115", price)
+	assert.Equal(t, 1, client.calls)
+
+	// expired prices are looked up again
+	now = now.Add(time.Hour)
+	client.priceList = []aws.JSONValue{testProduct("Used", "0.12")}
+	price, err = source.OnDemandPrice("m9.large", "eu-central-1")
+	require.NoError(t, err)
+	assert.Equal(t, "0.12", price)
+	assert.Equal(t, 2, client.calls)
+
+	// regions are looked up by their code
+	price, err = source.OnDemandPrice("m9.large", "ap-east-1")
+	require.NoError(t, err)
+	assert.Equal(t, "0.12", price)
+	assert.Equal(t, "ap-east-1", client.filters["regionCode"])
+
+	client.priceList = nil
+	_, err = source.OnDemandPrice("m9.xlarge", "eu-central-1")
+	assert.Error(t, err)
+
+	_, err = source.OnDemandPrice("m9.large", "mars-north-1")
+	assert.Error(t, err)
+}
@@ -0,0 +1,90 @@
+package aws
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/juju/ratelimit"
+)
+
+const rateLimitHandlerName = "clm.RateLimitHandler"
+
+// APIRateLimiter limits the rate of the AWS API requests sent per account,
+// region and service with token buckets shared by all sessions it's applied
+// to, such that concurrent updates of clusters in the same account don't
+// exhaust the API limits of the account and fail each other. It's safe for
+// concurrent use.
+type APIRateLimiter struct {
+	rate    float64
+	burst   int64
+	mutex   sync.Mutex
+	buckets map[string]*ratelimit.Bucket
+}
+
+// NewAPIRateLimiter returns an APIRateLimiter allowing rate requests per
+// second with bursts of up to burst requests per account, region and
+// service. It returns nil if rate isn't positive, which doesn't limit any
+// requests.
+func NewAPIRateLimiter(rate float64, burst int64) *APIRateLimiter {
+	if rate <= 0 {
+		return nil
+	}
+	if burst < 1 {
+		burst = 1
+	}
+
+	return &APIRateLimiter{
+		rate:    rate,
+		burst:   burst,
+		buckets: make(map[string]*ratelimit.Bucket),
+	}
+}
+
+// bucket returns the token bucket of the account, region and service,
+// creating it if necessary.
+func (l *APIRateLimiter) bucket(account, region, service string) *ratelimit.Bucket {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	key := fmt.Sprintf("%s/%s/%s", account, region, service)
+	bucket, ok := l.buckets[key]
+	if !ok {
+		bucket = ratelimit.NewBucketWithRate(l.rate, l.burst)
+		l.buckets[key] = bucket
+	}
+	return bucket
+}
+
+// Limit makes every request sent by the clients created from the session,
+// including retries, wait for a token of the bucket of the account and the
+// region and service of the request. Requests whose context is canceled
+// stop waiting and fail. It's a no-op for a nil APIRateLimiter.
+func (l *APIRateLimiter) Limit(sess *session.Session, account string) {
+	if l == nil {
+		return
+	}
+
+	sess.Handlers.Send.PushFrontNamed(request.NamedHandler{
+		Name: rateLimitHandlerName,
+		Fn: func(r *request.Request) {
+			wait := l.bucket(account, aws.StringValue(r.Config.Region), r.ClientInfo.ServiceName).Take(1)
+			if wait <= 0 {
+				return
+			}
+
+			timer := time.NewTimer(wait)
+			defer timer.Stop()
+
+			// requests canceled while waiting are failed by the
+			// HTTP client sending them.
+			select {
+			case <-timer.C:
+			case <-r.Context().Done():
+			}
+		},
+	})
+}
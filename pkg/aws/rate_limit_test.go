@@ -0,0 +1,54 @@
+package aws
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func limitedEC2Client(t *testing.T, limiter *APIRateLimiter, account string) *ec2.EC2 {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("eu-central-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:    aws.String("http://127.0.0.1:1"),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+	limiter.Limit(sess, account)
+	return ec2.New(sess)
+}
+
+func TestAPIRateLimiter(t *testing.T) {
+	assert.Nil(t, NewAPIRateLimiter(0, 10))
+
+	limiter := NewAPIRateLimiter(10, 1)
+	first := limitedEC2Client(t, limiter, "aws:123456789012")
+	second := limitedEC2Client(t, limiter, "aws:123456789012")
+	other := limitedEC2Client(t, limiter, "aws:210987654321")
+
+	// the sessions of the same account share the bucket.
+	start := time.Now()
+	for _, client := range []*ec2.EC2{first, second, first} {
+		client.DescribeSubnets(&ec2.DescribeSubnetsInput{})
+	}
+	assert.True(t, time.Since(start) >= 150*time.Millisecond, "requests of the same account weren't limited")
+
+	start = time.Now()
+	other.DescribeSubnets(&ec2.DescribeSubnetsInput{})
+	assert.True(t, time.Since(start) < 100*time.Millisecond, "requests of another account were limited")
+
+	// a nil limiter doesn't limit anything.
+	var unlimited *APIRateLimiter
+	client := limitedEC2Client(t, unlimited, "aws:123456789012")
+	start = time.Now()
+	for i := 0; i < 3; i++ {
+		client.DescribeSubnets(&ec2.DescribeSubnetsInput{})
+	}
+	assert.True(t, time.Since(start) < 100*time.Millisecond, "requests without limiter were limited")
+}
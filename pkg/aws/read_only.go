@@ -0,0 +1,57 @@
+package aws
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+)
+
+const (
+	// ErrCodeReadOnly is the error code of requests rejected by read-only
+	// sessions.
+	ErrCodeReadOnly = "ReadOnly"
+
+	readOnlyHandlerName = "clm.ReadOnlyHandler"
+)
+
+// readOnlyOperationPrefixes are the prefixes of the names of the API
+// operations which don't change any resources.
+var readOnlyOperationPrefixes = []string{
+	"Describe",
+	"Get",
+	"List",
+	"Lookup",
+	"Search",
+	"Validate",
+	"Estimate",
+	"Head",
+	"AssumeRole",
+	"Decrypt",
+}
+
+// IsReadOnlyOperation returns true if the API operation doesn't change any
+// resources.
+func IsReadOnlyOperation(name string) bool {
+	for _, prefix := range readOnlyOperationPrefixes {
+		if strings.HasPrefix(name, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+// ReadOnly makes all clients created from the session reject the API
+// operations which could change resources before they're sent.
+func ReadOnly(sess *session.Session) {
+	sess.Handlers.Validate.PushFrontNamed(request.NamedHandler{
+		Name: readOnlyHandlerName,
+		Fn: func(r *request.Request) {
+			if !IsReadOnlyOperation(r.Operation.Name) {
+				r.Error = awserr.New(ErrCodeReadOnly, fmt.Sprintf("%s is not allowed in read-only mode", r.Operation.Name), nil)
+			}
+		},
+	})
+}
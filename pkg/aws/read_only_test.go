@@ -0,0 +1,63 @@
+package aws
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestIsReadOnlyOperation(t *testing.T) {
+	for name, expected := range map[string]bool{
+		"DescribeStacks":      true,
+		"GetTemplate":         true,
+		"ListObjects":         true,
+		"ValidateTemplate":    true,
+		"AssumeRole":          true,
+		"Decrypt":             true,
+		"UpdateStack":         false,
+		"CreateTags":          false,
+		"PutObject":           false,
+		"TerminateInstances":  false,
+		"SetDesiredCapacity":  false,
+		"CreateOrUpdateTags":  false,
+		"DeleteBucketPolicy":  false,
+		"SuspendProcesses":    false,
+		"ResumeProcesses":     false,
+		"PutBucketEncryption": false,
+	} {
+		assert.Equal(t, expected, IsReadOnlyOperation(name), name)
+	}
+}
+
+func TestReadOnly(t *testing.T) {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("eu-central-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:    aws.String("http://127.0.0.1:1"),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+	ReadOnly(sess)
+
+	_, err = ec2.New(sess).CreateTags(&ec2.CreateTagsInput{
+		Resources: []*string{aws.String("subnet-1")},
+		Tags:      []*ec2.Tag{{Key: aws.String("key"), Value: aws.String("value")}},
+	})
+	require.Error(t, err)
+	aerr, ok := err.(awserr.Error)
+	require.True(t, ok)
+	assert.Equal(t, ErrCodeReadOnly, aerr.Code())
+
+	// read-only operations are sent, failing to reach the endpoint.
+	_, err = ec2.New(sess).DescribeSubnets(&ec2.DescribeSubnetsInput{})
+	require.Error(t, err)
+	aerr, ok = err.(awserr.Error)
+	require.True(t, ok)
+	assert.NotEqual(t, ErrCodeReadOnly, aerr.Code())
+}
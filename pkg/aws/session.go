@@ -1,11 +1,13 @@
 package aws
 
 import (
+	"sync"
+	"time"
+
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/credentials"
 	"github.com/aws/aws-sdk-go/aws/ec2metadata"
 	"github.com/aws/aws-sdk-go/aws/session"
-	"time"
 )
 
 const (
@@ -44,5 +46,53 @@ func Session(config *aws.Config, assumedRole string) (*session.Session, error) {
 		sess.Config.WithCredentials(credentials.NewCredentials(NewAssumeRoleProvider(assumedRole, awsSessionName, sess)))
 	}
 
+	Trace(sess)
+
 	return sess, nil
 }
+
+// CredentialsCache shares the credentials of assumed roles between the
+// sessions created for them, such that a role is only assumed again shortly
+// before its credentials expire instead of once per session. It's safe for
+// concurrent use.
+type CredentialsCache struct {
+	mutex       sync.Mutex
+	credentials map[string]*credentials.Credentials
+}
+
+// NewCredentialsCache initializes a new CredentialsCache.
+func NewCredentialsCache() *CredentialsCache {
+	return &CredentialsCache{
+		credentials: make(map[string]*credentials.Credentials),
+	}
+}
+
+// Session sets up an AWS session like Session, using the cached credentials
+// of the assumed role. The role is assumed with the credentials of the first
+// session created for it.
+func (c *CredentialsCache) Session(config *aws.Config, assumedRole string) (*session.Session, error) {
+	sess, err := Session(config, "")
+	if err != nil {
+		return nil, err
+	}
+
+	if assumedRole != "" {
+		sess.Config.WithCredentials(c.roleCredentials(assumedRole, sess))
+	}
+
+	return sess, nil
+}
+
+// roleCredentials returns the cached credentials of the role, creating them
+// with sess if necessary.
+func (c *CredentialsCache) roleCredentials(role string, sess *session.Session) *credentials.Credentials {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	creds, ok := c.credentials[role]
+	if !ok {
+		creds = credentials.NewCredentials(NewAssumeRoleProvider(role, awsSessionName, sess))
+		c.credentials[role] = creds
+	}
+	return creds
+}
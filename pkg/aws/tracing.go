@@ -0,0 +1,63 @@
+package aws
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/tracing"
+)
+
+const (
+	tracingStartHandlerName = "clm.TracingStartHandler"
+	tracingEndHandlerName   = "clm.TracingEndHandler"
+)
+
+// tracingParentKey holds the context of a request before its span was
+// started, such that retries aren't children of the previous attempt.
+type tracingParentKey struct{}
+
+// Trace records a span for every attempt of the requests sent by the clients
+// created from the session with a context which is part of a sampled trace,
+// e.g. the ones waiting for a stack, such that the latency of the AWS APIs
+// shows up in the traces of the cluster updates. Requests sent without such
+// a context aren't recorded.
+func Trace(sess *session.Session) {
+	sess.Handlers.Send.PushFrontNamed(request.NamedHandler{
+		Name: tracingStartHandlerName,
+		Fn: func(r *request.Request) {
+			parent := r.Context()
+			if !tracing.Recording(parent) {
+				return
+			}
+
+			ctx, _ := tracing.Start(parent, r.ClientInfo.ServiceName+"."+r.Operation.Name,
+				tracing.String("rpc.system", "aws-api"),
+				tracing.String("rpc.service", r.ClientInfo.ServiceName),
+				tracing.String("rpc.method", r.Operation.Name),
+				tracing.String("aws.region", aws.StringValue(r.Config.Region)),
+				tracing.Int("aws.retry_count", r.RetryCount),
+			)
+			r.SetContext(context.WithValue(ctx, tracingParentKey{}, parent))
+		},
+	})
+
+	sess.Handlers.Send.PushBackNamed(request.NamedHandler{
+		Name: tracingEndHandlerName,
+		Fn: func(r *request.Request) {
+			parent, ok := r.Context().Value(tracingParentKey{}).(context.Context)
+			if !ok {
+				return
+			}
+
+			span := tracing.SpanFromContext(r.Context())
+			if r.HTTPResponse != nil {
+				span.SetAttributes(tracing.Int("http.status_code", r.HTTPResponse.StatusCode))
+			}
+			tracing.End(span, r.Error)
+			r.SetContext(parent)
+		},
+	})
+}
@@ -0,0 +1,45 @@
+package aws
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/tracing"
+)
+
+func TestTrace(t *testing.T) {
+	recorder := &tracing.SpanRecorder{}
+	tracing.Register(recorder, 1)
+	defer tracing.Register(nil, 0)
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("eu-central-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:    aws.String("http://127.0.0.1:1"),
+		MaxRetries:  aws.Int(0),
+	})
+	require.NoError(t, err)
+	Trace(sess)
+	client := ec2.New(sess)
+
+	// requests outside of a trace aren't recorded.
+	client.DescribeSubnets(&ec2.DescribeSubnetsInput{})
+	assert.Empty(t, recorder.Ended())
+
+	ctx, span := tracing.Start(context.Background(), "stack.wait")
+	client.DescribeSubnetsWithContext(ctx, &ec2.DescribeSubnetsInput{})
+	span.End()
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "ec2.DescribeSubnets", spans[0].Name())
+	assert.Error(t, spans[0].Err())
+	assert.Equal(t, span.SpanID(), spans[0].ParentSpanID())
+}
@@ -0,0 +1,450 @@
+package gce
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/jwt"
+)
+
+const (
+	computeEndpoint = "https://compute.googleapis.com/compute/v1"
+	computeScope    = "https://www.googleapis.com/auth/compute"
+	defaultTokenURL = "https://oauth2.googleapis.com/token"
+
+	operationDone = "DONE"
+
+	// InstanceStatusRunning is the status of running instances.
+	InstanceStatusRunning = "RUNNING"
+	// InstanceActionNone is the current action of managed instances which
+	// are neither being created, recreated nor deleted.
+	InstanceActionNone = "NONE"
+)
+
+// InstanceTemplate is a global instance template. The properties are kept as
+// is, such that profiles can define any instance property.
+type InstanceTemplate struct {
+	Name       string                 `json:"name"`
+	SelfLink   string                 `json:"selfLink,omitempty"`
+	Properties map[string]interface{} `json:"properties"`
+}
+
+// InstanceGroupManager is a regional managed instance group.
+type InstanceGroupManager struct {
+	Name             string `json:"name"`
+	BaseInstanceName string `json:"baseInstanceName,omitempty"`
+	InstanceTemplate string `json:"instanceTemplate"`
+	TargetSize       int64  `json:"targetSize"`
+}
+
+// ManagedInstance is an instance of a managed instance group.
+type ManagedInstance struct {
+	// Instance is the URL of the instance.
+	Instance       string `json:"instance"`
+	InstanceStatus string `json:"instanceStatus"`
+	CurrentAction  string `json:"currentAction"`
+	Version        struct {
+		// InstanceTemplate is the URL of the instance template the
+		// instance was created from.
+		InstanceTemplate string `json:"instanceTemplate"`
+	} `json:"version"`
+}
+
+// Zone returns the zone of the instance.
+func (i *ManagedInstance) Zone() string {
+	return urlSegmentAfter(i.Instance, "zones")
+}
+
+// Name returns the name of the instance.
+func (i *ManagedInstance) Name() string {
+	return urlSegmentAfter(i.Instance, "instances")
+}
+
+// Metadata is the common instance metadata of a project. The fingerprint
+// has to be passed when setting the metadata, such that concurrent changes
+// aren't overwritten.
+type Metadata struct {
+	Fingerprint string          `json:"fingerprint,omitempty"`
+	Items       []*MetadataItem `json:"items,omitempty"`
+}
+
+// MetadataItem is a key/value pair of the metadata.
+type MetadataItem struct {
+	Key   string `json:"key"`
+	Value string `json:"value"`
+}
+
+// Value returns the value of a metadata item and whether it exists.
+func (m *Metadata) Value(key string) (string, bool) {
+	for _, item := range m.Items {
+		if item.Key == key {
+			return item.Value, true
+		}
+	}
+	return "", false
+}
+
+// Operation is an asynchronous operation of the Compute Engine API.
+type Operation struct {
+	Name     string          `json:"name"`
+	SelfLink string          `json:"selfLink"`
+	Status   string          `json:"status"`
+	Error    *OperationError `json:"error,omitempty"`
+}
+
+// OperationError contains the errors of a failed operation.
+type OperationError struct {
+	Errors []OperationErrorDetail `json:"errors"`
+}
+
+// OperationErrorDetail is a single error of a failed operation.
+type OperationErrorDetail struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+// Error is an error response of the Compute Engine API.
+type Error struct {
+	Code    int    `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *Error) Error() string {
+	return fmt.Sprintf("compute API error %d: %s", e.Code, e.Message)
+}
+
+// IsNotFound returns true if the error is a not found error response.
+func IsNotFound(err error) bool {
+	apiErr, ok := err.(*Error)
+	return ok && apiErr.Code == http.StatusNotFound
+}
+
+// IsPreconditionFailed returns true if the error is returned for a change
+// based on an outdated fingerprint.
+func IsPreconditionFailed(err error) bool {
+	apiErr, ok := err.(*Error)
+	return ok && apiErr.Code == http.StatusPreconditionFailed
+}
+
+// ComputeAPI is a minimal interface containing only the methods we use from
+// the Compute Engine API. All instance group managers are regional.
+type ComputeAPI interface {
+	GetInstanceTemplate(ctx context.Context, project, name string) (*InstanceTemplate, error)
+	InsertInstanceTemplate(ctx context.Context, project string, template *InstanceTemplate) (*Operation, error)
+	ListInstanceTemplates(ctx context.Context, project, prefix string) ([]string, error)
+	DeleteInstanceTemplate(ctx context.Context, project, name string) (*Operation, error)
+	GetInstanceGroupManager(ctx context.Context, project, region, name string) (*InstanceGroupManager, error)
+	InsertInstanceGroupManager(ctx context.Context, project, region string, manager *InstanceGroupManager) (*Operation, error)
+	DeleteInstanceGroupManager(ctx context.Context, project, region, name string) (*Operation, error)
+	SetInstanceTemplate(ctx context.Context, project, region, name, instanceTemplate string) (*Operation, error)
+	Resize(ctx context.Context, project, region, name string, size int64) (*Operation, error)
+	ListManagedInstances(ctx context.Context, project, region, name string) ([]*ManagedInstance, error)
+	DeleteInstances(ctx context.Context, project, region, name string, instances []string) (*Operation, error)
+	GetProjectMetadata(ctx context.Context, project string) (*Metadata, error)
+	SetProjectMetadata(ctx context.Context, project string, metadata *Metadata) (*Operation, error)
+	WaitOperation(ctx context.Context, operation *Operation) error
+}
+
+// InstanceGroupManagerName returns the name of the managed instance group of
+// a node pool.
+func InstanceGroupManagerName(localID, nodePool string) string {
+	return fmt.Sprintf("%s-%s", localID, nodePool)
+}
+
+// InstanceTemplateURL returns the partial URL of an instance template as
+// referenced by instance group managers.
+func InstanceTemplateURL(project, name string) string {
+	return fmt.Sprintf("projects/%s/global/instanceTemplates/%s", project, name)
+}
+
+// SameInstanceTemplate returns true if both instance template URLs refer to
+// the same template. The API returns full URLs while partial URLs are
+// accepted as input.
+func SameInstanceTemplate(a, b string) bool {
+	return a[strings.LastIndex(a, "/")+1:] == b[strings.LastIndex(b, "/")+1:]
+}
+
+// NewTokenSource returns a token source for the Compute Engine API
+// authenticating with the JSON key file of a service account.
+func NewTokenSource(keyFile string) (oauth2.TokenSource, error) {
+	data, err := ioutil.ReadFile(keyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var key struct {
+		ClientEmail  string `json:"client_email"`
+		PrivateKey   string `json:"private_key"`
+		PrivateKeyID string `json:"private_key_id"`
+		TokenURI     string `json:"token_uri"`
+	}
+	err = json.Unmarshal(data, &key)
+	if err != nil {
+		return nil, fmt.Errorf("invalid service account key %s: %v", keyFile, err)
+	}
+
+	config := &jwt.Config{
+		Email:        key.ClientEmail,
+		PrivateKey:   []byte(key.PrivateKey),
+		PrivateKeyID: key.PrivateKeyID,
+		Scopes:       []string{computeScope},
+		TokenURL:     key.TokenURI,
+	}
+	if config.TokenURL == "" {
+		config.TokenURL = defaultTokenURL
+	}
+
+	return config.TokenSource(context.Background()), nil
+}
+
+// client is a client of the Compute Engine REST API.
+type client struct {
+	client   *http.Client
+	endpoint string
+}
+
+// NewComputeAPI returns a client of the Compute Engine API authenticating
+// with the token source.
+func NewComputeAPI(tokenSource oauth2.TokenSource) ComputeAPI {
+	return &client{
+		client:   oauth2.NewClient(context.Background(), tokenSource),
+		endpoint: computeEndpoint,
+	}
+}
+
+func (c *client) managerURL(project, region, name string) string {
+	return fmt.Sprintf("%s/projects/%s/regions/%s/instanceGroupManagers/%s", c.endpoint, url.PathEscape(project), url.PathEscape(region), url.PathEscape(name))
+}
+
+// GetInstanceTemplate gets an instance template by name.
+func (c *client) GetInstanceTemplate(ctx context.Context, project, name string) (*InstanceTemplate, error) {
+	var template InstanceTemplate
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/projects/%s/global/instanceTemplates/%s", c.endpoint, url.PathEscape(project), url.PathEscape(name)), nil, &template)
+	if err != nil {
+		return nil, err
+	}
+	return &template, nil
+}
+
+// InsertInstanceTemplate creates an instance template.
+func (c *client) InsertInstanceTemplate(ctx context.Context, project string, template *InstanceTemplate) (*Operation, error) {
+	return c.operation(ctx, http.MethodPost, fmt.Sprintf("%s/projects/%s/global/instanceTemplates", c.endpoint, url.PathEscape(project)), template)
+}
+
+// ListInstanceTemplates lists the names of all instance templates starting
+// with the prefix.
+func (c *client) ListInstanceTemplates(ctx context.Context, project, prefix string) ([]string, error) {
+	var names []string
+	pageToken := ""
+	for {
+		endpoint := fmt.Sprintf("%s/projects/%s/global/instanceTemplates", c.endpoint, url.PathEscape(project))
+		if pageToken != "" {
+			endpoint += "?pageToken=" + url.QueryEscape(pageToken)
+		}
+
+		var page struct {
+			Items         []*InstanceTemplate `json:"items"`
+			NextPageToken string              `json:"nextPageToken"`
+		}
+		err := c.do(ctx, http.MethodGet, endpoint, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, template := range page.Items {
+			if strings.HasPrefix(template.Name, prefix) {
+				names = append(names, template.Name)
+			}
+		}
+		if page.NextPageToken == "" {
+			return names, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// DeleteInstanceTemplate deletes an instance template by name.
+func (c *client) DeleteInstanceTemplate(ctx context.Context, project, name string) (*Operation, error) {
+	return c.operation(ctx, http.MethodDelete, fmt.Sprintf("%s/projects/%s/global/instanceTemplates/%s", c.endpoint, url.PathEscape(project), url.PathEscape(name)), nil)
+}
+
+// GetInstanceGroupManager gets a regional instance group manager by name.
+func (c *client) GetInstanceGroupManager(ctx context.Context, project, region, name string) (*InstanceGroupManager, error) {
+	var manager InstanceGroupManager
+	err := c.do(ctx, http.MethodGet, c.managerURL(project, region, name), nil, &manager)
+	if err != nil {
+		return nil, err
+	}
+	return &manager, nil
+}
+
+// InsertInstanceGroupManager creates a regional instance group manager.
+func (c *client) InsertInstanceGroupManager(ctx context.Context, project, region string, manager *InstanceGroupManager) (*Operation, error) {
+	return c.operation(ctx, http.MethodPost, fmt.Sprintf("%s/projects/%s/regions/%s/instanceGroupManagers", c.endpoint, url.PathEscape(project), url.PathEscape(region)), manager)
+}
+
+// DeleteInstanceGroupManager deletes a regional instance group manager and
+// all of its instances.
+func (c *client) DeleteInstanceGroupManager(ctx context.Context, project, region, name string) (*Operation, error) {
+	return c.operation(ctx, http.MethodDelete, c.managerURL(project, region, name), nil)
+}
+
+// SetInstanceTemplate sets the instance template used for new instances of
+// the instance group manager. Existing instances are not changed.
+func (c *client) SetInstanceTemplate(ctx context.Context, project, region, name, instanceTemplate string) (*Operation, error) {
+	body := map[string]string{"instanceTemplate": instanceTemplate}
+	return c.operation(ctx, http.MethodPost, c.managerURL(project, region, name)+"/setInstanceTemplate", body)
+}
+
+// Resize sets the target size of the instance group manager.
+func (c *client) Resize(ctx context.Context, project, region, name string, size int64) (*Operation, error) {
+	return c.operation(ctx, http.MethodPost, fmt.Sprintf("%s/resize?size=%d", c.managerURL(project, region, name), size), nil)
+}
+
+// ListManagedInstances lists all instances of the instance group manager.
+func (c *client) ListManagedInstances(ctx context.Context, project, region, name string) ([]*ManagedInstance, error) {
+	var instances []*ManagedInstance
+	pageToken := ""
+	for {
+		endpoint := c.managerURL(project, region, name) + "/listManagedInstances"
+		if pageToken != "" {
+			endpoint += "?pageToken=" + url.QueryEscape(pageToken)
+		}
+
+		var page struct {
+			ManagedInstances []*ManagedInstance `json:"managedInstances"`
+			NextPageToken    string             `json:"nextPageToken"`
+		}
+		err := c.do(ctx, http.MethodPost, endpoint, nil, &page)
+		if err != nil {
+			return nil, err
+		}
+
+		instances = append(instances, page.ManagedInstances...)
+		if page.NextPageToken == "" {
+			return instances, nil
+		}
+		pageToken = page.NextPageToken
+	}
+}
+
+// DeleteInstances deletes the instances identified by their URLs from the
+// instance group manager and decreases its target size accordingly.
+func (c *client) DeleteInstances(ctx context.Context, project, region, name string, instances []string) (*Operation, error) {
+	body := map[string][]string{"instances": instances}
+	return c.operation(ctx, http.MethodPost, c.managerURL(project, region, name)+"/deleteInstances", body)
+}
+
+// GetProjectMetadata gets the common instance metadata of a project.
+func (c *client) GetProjectMetadata(ctx context.Context, project string) (*Metadata, error) {
+	var result struct {
+		CommonInstanceMetadata Metadata `json:"commonInstanceMetadata"`
+	}
+	err := c.do(ctx, http.MethodGet, fmt.Sprintf("%s/projects/%s", c.endpoint, url.PathEscape(project)), nil, &result)
+	if err != nil {
+		return nil, err
+	}
+	return &result.CommonInstanceMetadata, nil
+}
+
+// SetProjectMetadata replaces the common instance metadata of a project. It
+// fails with a precondition failed error if the fingerprint of the metadata
+// is outdated.
+func (c *client) SetProjectMetadata(ctx context.Context, project string, metadata *Metadata) (*Operation, error) {
+	return c.operation(ctx, http.MethodPost, fmt.Sprintf("%s/projects/%s/setCommonInstanceMetadata", c.endpoint, url.PathEscape(project)), metadata)
+}
+
+// WaitOperation waits until the operation is done and returns the error of
+// the operation if it failed.
+func (c *client) WaitOperation(ctx context.Context, operation *Operation) error {
+	for operation.Status != operationDone {
+		var err error
+		operation, err = c.operation(ctx, http.MethodPost, operation.SelfLink+"/wait", nil)
+		if err != nil {
+			return err
+		}
+	}
+
+	if operation.Error != nil && len(operation.Error.Errors) > 0 {
+		messages := make([]string, 0, len(operation.Error.Errors))
+		for _, opErr := range operation.Error.Errors {
+			messages = append(messages, fmt.Sprintf("%s: %s", opErr.Code, opErr.Message))
+		}
+		return fmt.Errorf("operation %s failed: %s", operation.Name, strings.Join(messages, ", "))
+	}
+
+	return nil
+}
+
+func (c *client) operation(ctx context.Context, method, endpoint string, body interface{}) (*Operation, error) {
+	var operation Operation
+	err := c.do(ctx, method, endpoint, body, &operation)
+	if err != nil {
+		return nil, err
+	}
+	return &operation, nil
+}
+
+// do sends the request with body encoded as JSON unless it's nil and decodes
+// the response into result. Error responses are returned as *Error.
+func (c *client) do(ctx context.Context, method, endpoint string, body, result interface{}) error {
+	var reqBody []byte
+	if body != nil {
+		var err error
+		reqBody, err = json.Marshal(body)
+		if err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, endpoint, bytes.NewReader(reqBody))
+	if err != nil {
+		return err
+	}
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	resp, err := c.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	data, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errResp struct {
+			Error *Error `json:"error"`
+		}
+		if json.Unmarshal(data, &errResp) == nil && errResp.Error != nil {
+			errResp.Error.Code = resp.StatusCode
+			return errResp.Error
+		}
+		return &Error{Code: resp.StatusCode, Message: string(data)}
+	}
+
+	return json.Unmarshal(data, result)
+}
+
+// urlSegmentAfter returns the path segment following the segment key of a
+// resource URL e.g. the zone of .../zones/europe-west1-b/instances/foo.
+func urlSegmentAfter(resourceURL, key string) string {
+	segments := strings.Split(resourceURL, "/")
+	for i := 0; i < len(segments)-1; i++ {
+		if segments[i] == key {
+			return segments[i+1]
+		}
+	}
+	return ""
+}
@@ -0,0 +1,160 @@
+package gce
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestManagedInstance(t *testing.T) {
+	instance := &ManagedInstance{Instance: "https://www.googleapis.com/compute/v1/projects/foo/zones/europe-west1-b/instances/kube-1-default-x1z2"}
+	assert.Equal(t, "europe-west1-b", instance.Zone())
+	assert.Equal(t, "kube-1-default-x1z2", instance.Name())
+}
+
+func TestSameInstanceTemplate(t *testing.T) {
+	assert.True(t, SameInstanceTemplate("https://www.googleapis.com/compute/v1/projects/foo/global/instanceTemplates/a", InstanceTemplateURL("foo", "a")))
+	assert.False(t, SameInstanceTemplate(InstanceTemplateURL("foo", "a"), InstanceTemplateURL("foo", "b")))
+}
+
+func TestClient(t *testing.T) {
+	waits := 0
+	var server *httptest.Server
+	server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/projects/foo/global/instanceTemplates/missing":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": 404, "message": "not found"}}`))
+		case "/projects/foo/regions/europe-west1/instanceGroupManagers/kube-1-default/listManagedInstances":
+			if r.URL.Query().Get("pageToken") == "" {
+				json.NewEncoder(w).Encode(map[string]interface{}{
+					"managedInstances": []map[string]string{{"instance": "a"}},
+					"nextPageToken":    "next",
+				})
+				return
+			}
+			json.NewEncoder(w).Encode(map[string]interface{}{
+				"managedInstances": []map[string]string{{"instance": "b"}},
+			})
+		case "/projects/foo/regions/europe-west1/instanceGroupManagers/kube-1-default/resize":
+			assert.Equal(t, "3", r.URL.Query().Get("size"))
+			json.NewEncoder(w).Encode(Operation{Name: "resize", SelfLink: server.URL + "/operations/resize", Status: "RUNNING"})
+		case "/operations/resize/wait":
+			waits++
+			operation := Operation{Name: "resize", SelfLink: server.URL + "/operations/resize", Status: "RUNNING"}
+			if waits > 1 {
+				operation.Status = operationDone
+			}
+			json.NewEncoder(w).Encode(operation)
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	c := &client{client: server.Client(), endpoint: server.URL}
+
+	_, err := c.GetInstanceTemplate(context.Background(), "foo", "missing")
+	assert.True(t, IsNotFound(err))
+
+	instances, err := c.ListManagedInstances(context.Background(), "foo", "europe-west1", "kube-1-default")
+	require.NoError(t, err)
+	require.Len(t, instances, 2)
+	assert.Equal(t, "b", instances[1].Instance)
+
+	operation, err := c.Resize(context.Background(), "foo", "europe-west1", "kube-1-default", 3)
+	require.NoError(t, err)
+	require.NoError(t, c.WaitOperation(context.Background(), operation))
+	assert.Equal(t, 2, waits)
+}
+
+func TestWaitOperationFailed(t *testing.T) {
+	operation := &Operation{
+		Name:   "insert",
+		Status: operationDone,
+		Error: &OperationError{
+			Errors: []OperationErrorDetail{{Code: "QUOTA_EXCEEDED", Message: "not enough CPUs"}},
+		},
+	}
+
+	err := (&client{}).WaitOperation(context.Background(), operation)
+	require.Error(t, err)
+	assert.Equal(t, "operation insert failed: QUOTA_EXCEEDED: not enough CPUs", err.Error())
+}
+
+func TestClientProjectMetadata(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/projects/foo":
+			w.Write([]byte(`{"name": "foo", "commonInstanceMetadata": {"fingerprint": "abc", "items": [{"key": "a", "value": "1"}]}}`))
+		case r.Method == http.MethodPost && r.URL.Path == "/projects/foo/setCommonInstanceMetadata":
+			var metadata Metadata
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&metadata))
+			if metadata.Fingerprint != "abc" {
+				w.WriteHeader(http.StatusPreconditionFailed)
+				w.Write([]byte(`{"error": {"code": 412, "message": "fingerprint mismatch"}}`))
+				return
+			}
+			json.NewEncoder(w).Encode(Operation{Name: "set", Status: operationDone})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	c := &client{client: server.Client(), endpoint: server.URL}
+
+	metadata, err := c.GetProjectMetadata(context.Background(), "foo")
+	require.NoError(t, err)
+	value, ok := metadata.Value("a")
+	assert.True(t, ok)
+	assert.Equal(t, "1", value)
+	_, ok = metadata.Value("b")
+	assert.False(t, ok)
+
+	_, err = c.SetProjectMetadata(context.Background(), "foo", metadata)
+	require.NoError(t, err)
+
+	_, err = c.SetProjectMetadata(context.Background(), "foo", &Metadata{Fingerprint: "old"})
+	assert.True(t, IsPreconditionFailed(err))
+}
+
+func TestClientInstanceTemplates(t *testing.T) {
+	var deleted []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch {
+		case r.Method == http.MethodGet && r.URL.Path == "/projects/foo/global/instanceTemplates":
+			if r.URL.Query().Get("pageToken") == "" {
+				w.Write([]byte(`{"items": [{"name": "kube-1-default-a"}, {"name": "kube-2-default-a"}], "nextPageToken": "next"}`))
+				return
+			}
+			w.Write([]byte(`{"items": [{"name": "kube-1-default-b"}]}`))
+		case r.Method == http.MethodDelete:
+			deleted = append(deleted, r.URL.Path)
+			json.NewEncoder(w).Encode(Operation{Name: "delete", Status: operationDone})
+		default:
+			t.Errorf("unexpected request %s %s", r.Method, r.URL.Path)
+		}
+	}))
+	defer server.Close()
+
+	c := &client{client: server.Client(), endpoint: server.URL}
+
+	names, err := c.ListInstanceTemplates(context.Background(), "foo", "kube-1-default-")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kube-1-default-a", "kube-1-default-b"}, names)
+
+	_, err = c.DeleteInstanceTemplate(context.Background(), "foo", "kube-1-default-a")
+	require.NoError(t, err)
+	_, err = c.DeleteInstanceGroupManager(context.Background(), "foo", "europe-west1", "kube-1-default")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"/projects/foo/global/instanceTemplates/kube-1-default-a",
+		"/projects/foo/regions/europe-west1/instanceGroupManagers/kube-1-default",
+	}, deleted)
+}
@@ -0,0 +1,110 @@
+package gce
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strings"
+)
+
+const (
+	// nodePoolMetadataPrefix is the prefix of the project metadata items
+	// storing the state of node pools. Managed instance groups can't be
+	// labeled, so the project metadata is the only place to keep it.
+	nodePoolMetadataPrefix = "cluster-lifecycle-manager"
+
+	// maxMetadataUpdates is the number of attempts to update the project
+	// metadata while it's changed concurrently, e.g. by the provisioning of
+	// another cluster in the same project.
+	maxMetadataUpdates = 5
+)
+
+// NodePoolMetadataKey returns the key of the project metadata item storing
+// the state name of a node pool of a cluster. The parts are separated by
+// underscores, which neither local IDs nor node pool names contain.
+func NodePoolMetadataKey(localID, nodePool, name string) string {
+	return fmt.Sprintf("%s_%s_%s_%s", nodePoolMetadataPrefix, localID, nodePool, name)
+}
+
+// UpdateProjectMetadata applies update to the items of the project metadata
+// and stores them if they changed, update removes items by deleting their
+// keys. The update is retried if the metadata was changed concurrently.
+func UpdateProjectMetadata(ctx context.Context, compute ComputeAPI, project string, update func(items map[string]string)) error {
+	for attempt := 1; ; attempt++ {
+		metadata, err := compute.GetProjectMetadata(ctx, project)
+		if err != nil {
+			return err
+		}
+
+		items := make(map[string]string, len(metadata.Items))
+		for _, item := range metadata.Items {
+			items[item.Key] = item.Value
+		}
+		update(items)
+
+		updated := &Metadata{Fingerprint: metadata.Fingerprint}
+		changed := false
+		for _, item := range metadata.Items {
+			value, ok := items[item.Key]
+			if !ok {
+				changed = true
+				continue
+			}
+			if value != item.Value {
+				changed = true
+			}
+			updated.Items = append(updated.Items, &MetadataItem{Key: item.Key, Value: value})
+			delete(items, item.Key)
+		}
+
+		// the remaining items are new, they're added in a stable order.
+		keys := make([]string, 0, len(items))
+		for key := range items {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		for _, key := range keys {
+			updated.Items = append(updated.Items, &MetadataItem{Key: key, Value: items[key]})
+			changed = true
+		}
+
+		if !changed {
+			return nil
+		}
+
+		operation, err := compute.SetProjectMetadata(ctx, project, updated)
+		if IsPreconditionFailed(err) && attempt < maxMetadataUpdates {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+		return compute.WaitOperation(ctx, operation)
+	}
+}
+
+// PruneNodePoolMetadata removes the project metadata items of all node pools
+// of a cluster except for the ones in nodePools.
+func PruneNodePoolMetadata(ctx context.Context, compute ComputeAPI, project, localID string, nodePools []string) error {
+	keep := make(map[string]bool, len(nodePools))
+	for _, nodePool := range nodePools {
+		keep[nodePool] = true
+	}
+
+	prefix := fmt.Sprintf("%s_%s_", nodePoolMetadataPrefix, localID)
+	return UpdateProjectMetadata(ctx, compute, project, func(items map[string]string) {
+		for key := range items {
+			if !strings.HasPrefix(key, prefix) {
+				continue
+			}
+
+			nodePool := strings.TrimPrefix(key, prefix)
+			if split := strings.LastIndex(nodePool, "_"); split != -1 {
+				nodePool = nodePool[:split]
+			}
+			if !keep[nodePool] {
+				delete(items, key)
+			}
+		}
+	})
+}
@@ -0,0 +1,97 @@
+package gce
+
+import (
+	"context"
+	"net/http"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type metadataComputeAPI struct {
+	ComputeAPI
+	metadata  *Metadata
+	conflicts int
+	updates   int
+}
+
+func (c *metadataComputeAPI) GetProjectMetadata(ctx context.Context, project string) (*Metadata, error) {
+	copied := *c.metadata
+	return &copied, nil
+}
+
+func (c *metadataComputeAPI) SetProjectMetadata(ctx context.Context, project string, metadata *Metadata) (*Operation, error) {
+	if c.conflicts > 0 {
+		c.conflicts--
+		return nil, &Error{Code: http.StatusPreconditionFailed, Message: "fingerprint mismatch"}
+	}
+	c.updates++
+	c.metadata = metadata
+	return &Operation{}, nil
+}
+
+func (c *metadataComputeAPI) WaitOperation(ctx context.Context, operation *Operation) error {
+	return nil
+}
+
+func TestNodePoolMetadataKey(t *testing.T) {
+	assert.Equal(t, "cluster-lifecycle-manager_kube-1_default_drain-stats", NodePoolMetadataKey("kube-1", "default", "drain-stats"))
+}
+
+func TestUpdateProjectMetadata(t *testing.T) {
+	compute := &metadataComputeAPI{
+		metadata: &Metadata{Items: []*MetadataItem{{Key: "ssh-keys", Value: "foo"}, {Key: "a", Value: "1"}}},
+	}
+
+	err := UpdateProjectMetadata(context.Background(), compute, "foo", func(items map[string]string) {
+		items["c"] = "3"
+		items["b"] = "2"
+		delete(items, "a")
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []*MetadataItem{{Key: "ssh-keys", Value: "foo"}, {Key: "b", Value: "2"}, {Key: "c", Value: "3"}}, compute.metadata.Items)
+	assert.Equal(t, 1, compute.updates)
+
+	// unchanged metadata isn't stored.
+	err = UpdateProjectMetadata(context.Background(), compute, "foo", func(items map[string]string) {
+		items["b"] = "2"
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 1, compute.updates)
+
+	// concurrent changes are retried.
+	compute.conflicts = 2
+	err = UpdateProjectMetadata(context.Background(), compute, "foo", func(items map[string]string) {
+		items["b"] = "4"
+	})
+	require.NoError(t, err)
+	assert.Equal(t, 2, compute.updates)
+
+	compute.conflicts = maxMetadataUpdates
+	err = UpdateProjectMetadata(context.Background(), compute, "foo", func(items map[string]string) {
+		items["b"] = "5"
+	})
+	assert.True(t, IsPreconditionFailed(err))
+}
+
+func TestPruneNodePoolMetadata(t *testing.T) {
+	compute := &metadataComputeAPI{
+		metadata: &Metadata{Items: []*MetadataItem{
+			{Key: NodePoolMetadataKey("kube-1", "default", "drain-stats"), Value: "1/1s"},
+			{Key: NodePoolMetadataKey("kube-1", "removed", "drain-stats"), Value: "1/1s"},
+			{Key: NodePoolMetadataKey("kube-10", "removed", "drain-stats"), Value: "1/1s"},
+			{Key: "ssh-keys", Value: "foo"},
+		}},
+	}
+
+	require.NoError(t, PruneNodePoolMetadata(context.Background(), compute, "foo", "kube-1", []string{"default"}))
+	assert.Equal(t, []*MetadataItem{
+		{Key: NodePoolMetadataKey("kube-1", "default", "drain-stats"), Value: "1/1s"},
+		{Key: NodePoolMetadataKey("kube-10", "removed", "drain-stats"), Value: "1/1s"},
+		{Key: "ssh-keys", Value: "foo"},
+	}, compute.metadata.Items)
+
+	require.NoError(t, PruneNodePoolMetadata(context.Background(), compute, "foo", "kube-1", nil))
+	assert.Len(t, compute.metadata.Items, 2)
+}
@@ -0,0 +1,250 @@
+package kubernetes
+
+import (
+	"fmt"
+	"io/ioutil"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"golang.org/x/oauth2"
+	"gopkg.in/yaml.v2"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// KubeconfigProviderRegistry names the provider using the API server
+	// URL from the cluster registry and the platform IAM token.
+	KubeconfigProviderRegistry = "registry"
+	// KubeconfigProviderStatic names the provider reading the API server
+	// and token from a kubeconfig file.
+	KubeconfigProviderStatic = "static"
+	// KubeconfigProviderSSM names the provider using the API server URL
+	// from the cluster registry and a token stored in SSM.
+	KubeconfigProviderSSM = "ssm"
+)
+
+// Kubeconfig describes how to reach the API server of a cluster.
+type Kubeconfig struct {
+	Server      string
+	TokenSource oauth2.TokenSource
+}
+
+// KubeconfigProvider provides the Kubeconfig for a cluster. sess is a session
+// for the infrastructure account of the cluster.
+type KubeconfigProvider interface {
+	Kubeconfig(cluster *api.Cluster, sess *session.Session) (*Kubeconfig, error)
+}
+
+// ttlTokenSource is a token source which fetches a token that is considered
+// valid for ttl. Wrapped in a oauth2.ReuseTokenSource this caches the token
+// and picks up rotated tokens once the ttl has passed.
+type ttlTokenSource struct {
+	ttl   time.Duration
+	fetch func() (string, error)
+}
+
+// Token fetches a new token.
+func (s *ttlTokenSource) Token() (*oauth2.Token, error) {
+	token, err := s.fetch()
+	if err != nil {
+		return nil, err
+	}
+
+	return &oauth2.Token{
+		AccessToken: token,
+		Expiry:      time.Now().Add(s.ttl),
+	}, nil
+}
+
+// tokenSourceCache caches a token source per cluster, such that tokens are
+// reused across provisioning runs.
+type tokenSourceCache struct {
+	sync.Mutex
+	sources map[string]oauth2.TokenSource
+}
+
+// get returns the cached token source of a cluster or creates a new one.
+func (c *tokenSourceCache) get(clusterID string, ttl time.Duration, fetch func() (string, error)) oauth2.TokenSource {
+	c.Lock()
+	defer c.Unlock()
+
+	if c.sources == nil {
+		c.sources = make(map[string]oauth2.TokenSource)
+	}
+
+	source, ok := c.sources[clusterID]
+	if !ok {
+		source = oauth2.ReuseTokenSource(nil, &ttlTokenSource{ttl: ttl, fetch: fetch})
+		c.sources[clusterID] = source
+	}
+	return source
+}
+
+type registryKubeconfigProvider struct {
+	tokenSource oauth2.TokenSource
+}
+
+// NewRegistryKubeconfigProvider returns a KubeconfigProvider which uses the
+// API server URL from the cluster registry and authenticates with the
+// specified token source.
+func NewRegistryKubeconfigProvider(tokenSource oauth2.TokenSource) KubeconfigProvider {
+	return &registryKubeconfigProvider{tokenSource: tokenSource}
+}
+
+// Kubeconfig returns the Kubeconfig for a cluster.
+func (p *registryKubeconfigProvider) Kubeconfig(cluster *api.Cluster, _ *session.Session) (*Kubeconfig, error) {
+	return &Kubeconfig{
+		Server:      cluster.APIServerURL,
+		TokenSource: p.tokenSource,
+	}, nil
+}
+
+// kubeconfigFile defines the subset of a kubeconfig file needed to reach a
+// cluster with token authentication.
+type kubeconfigFile struct {
+	Clusters []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server string `yaml:"server"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Users []struct {
+		Name string `yaml:"name"`
+		User struct {
+			Token string `yaml:"token"`
+		} `yaml:"user"`
+	} `yaml:"users"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+}
+
+type staticKubeconfigProvider struct {
+	file  string
+	ttl   time.Duration
+	cache tokenSourceCache
+}
+
+// NewStaticKubeconfigProvider returns a KubeconfigProvider which reads the
+// API server and token of a cluster from the kubeconfig file. The context
+// of a cluster must be named after its ID or alias. The token is re-read
+// from the file after ttl to pick up rotated tokens.
+func NewStaticKubeconfigProvider(file string, ttl time.Duration) KubeconfigProvider {
+	return &staticKubeconfigProvider{file: file, ttl: ttl}
+}
+
+// Kubeconfig returns the Kubeconfig for a cluster.
+func (p *staticKubeconfigProvider) Kubeconfig(cluster *api.Cluster, _ *session.Session) (*Kubeconfig, error) {
+	server, _, err := p.read(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	fetch := func() (string, error) {
+		_, token, err := p.read(cluster)
+		return token, err
+	}
+
+	return &Kubeconfig{
+		Server:      server,
+		TokenSource: p.cache.get(cluster.ID, p.ttl, fetch),
+	}, nil
+}
+
+// read reads the server and token of the cluster from the kubeconfig file.
+func (p *staticKubeconfigProvider) read(cluster *api.Cluster) (string, string, error) {
+	d, err := ioutil.ReadFile(p.file)
+	if err != nil {
+		return "", "", err
+	}
+
+	var config kubeconfigFile
+	err = yaml.Unmarshal(d, &config)
+	if err != nil {
+		return "", "", err
+	}
+
+	var clusterName, userName string
+	found := false
+	for _, context := range config.Contexts {
+		if context.Name == cluster.ID || context.Name == cluster.Alias {
+			clusterName, userName = context.Context.Cluster, context.Context.User
+			found = true
+			break
+		}
+	}
+	if !found {
+		return "", "", fmt.Errorf("no context for cluster %s in kubeconfig %s", cluster.ID, p.file)
+	}
+
+	var server, token string
+	for _, c := range config.Clusters {
+		if c.Name == clusterName {
+			server = c.Cluster.Server
+		}
+	}
+	for _, u := range config.Users {
+		if u.Name == userName {
+			token = u.User.Token
+		}
+	}
+
+	if server == "" || token == "" {
+		return "", "", fmt.Errorf("incomplete context for cluster %s in kubeconfig %s", cluster.ID, p.file)
+	}
+
+	return server, token, nil
+}
+
+type ssmKubeconfigProvider struct {
+	parameterFormat string
+	ttl             time.Duration
+	newClient       func(sess *session.Session) ssmiface.SSMAPI
+	cache           tokenSourceCache
+}
+
+// NewSSMKubeconfigProvider returns a KubeconfigProvider which uses the API
+// server URL from the cluster registry and reads the token from the SSM
+// parameter in the cluster's account. The parameter name is formatted from
+// parameterFormat and the local ID of the cluster. The token is re-read
+// after ttl to pick up rotated tokens.
+func NewSSMKubeconfigProvider(parameterFormat string, ttl time.Duration) KubeconfigProvider {
+	return &ssmKubeconfigProvider{
+		parameterFormat: parameterFormat,
+		ttl:             ttl,
+		newClient: func(sess *session.Session) ssmiface.SSMAPI {
+			return ssm.New(sess)
+		},
+	}
+}
+
+// Kubeconfig returns the Kubeconfig for a cluster.
+func (p *ssmKubeconfigProvider) Kubeconfig(cluster *api.Cluster, sess *session.Session) (*Kubeconfig, error) {
+	client := p.newClient(sess)
+	name := fmt.Sprintf(p.parameterFormat, cluster.LocalID)
+
+	fetch := func() (string, error) {
+		resp, err := client.GetParameter(&ssm.GetParameterInput{
+			Name:           aws.String(name),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return "", err
+		}
+		return aws.StringValue(resp.Parameter.Value), nil
+	}
+
+	return &Kubeconfig{
+		Server:      cluster.APIServerURL,
+		TokenSource: p.cache.get(cluster.ID, p.ttl, fetch),
+	}, nil
+}
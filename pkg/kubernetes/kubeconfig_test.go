@@ -0,0 +1,125 @@
+package kubernetes
+
+import (
+	"io/ioutil"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/aws/aws-sdk-go/service/ssm/ssmiface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/oauth2"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const testKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- name: kube-1
+  cluster:
+    server: https://kube-1.example.org
+users:
+- name: clm
+  user:
+    token: %s
+contexts:
+- name: kube-1-alias
+  context:
+    cluster: kube-1
+    user: clm
+`
+
+var testCluster = &api.Cluster{
+	ID:           "aws:123456789012:eu-central-1:kube-1",
+	Alias:        "kube-1-alias",
+	LocalID:      "kube-1",
+	APIServerURL: "https://kube-1.registry.example.org",
+}
+
+func TestRegistryKubeconfigProvider(t *testing.T) {
+	tokenSource := oauth2.StaticTokenSource(&oauth2.Token{AccessToken: "foo"})
+	kubeconfig, err := NewRegistryKubeconfigProvider(tokenSource).Kubeconfig(testCluster, nil)
+	require.NoError(t, err)
+	assert.Equal(t, testCluster.APIServerURL, kubeconfig.Server)
+	assert.Equal(t, tokenSource, kubeconfig.TokenSource)
+}
+
+func TestStaticKubeconfigProvider(t *testing.T) {
+	file, err := ioutil.TempFile("", "kubeconfig")
+	require.NoError(t, err)
+	defer os.Remove(file.Name())
+	file.Close()
+
+	writeToken := func(token string) {
+		require.NoError(t, ioutil.WriteFile(file.Name(), []byte(strings.Replace(testKubeconfig, "%s", token, 1)), 0600))
+	}
+
+	writeToken("first")
+	provider := &staticKubeconfigProvider{file: file.Name(), ttl: time.Hour}
+	kubeconfig, err := provider.Kubeconfig(testCluster, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "https://kube-1.example.org", kubeconfig.Server)
+
+	token, err := kubeconfig.TokenSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "first", token.AccessToken)
+
+	// the token is cached until the ttl passed.
+	writeToken("second")
+	kubeconfig, err = provider.Kubeconfig(testCluster, nil)
+	require.NoError(t, err)
+	token, err = kubeconfig.TokenSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "first", token.AccessToken)
+
+	// rotated tokens are picked up once the cached one expired.
+	provider = &staticKubeconfigProvider{file: file.Name(), ttl: 0}
+	kubeconfig, err = provider.Kubeconfig(testCluster, nil)
+	require.NoError(t, err)
+	_, err = kubeconfig.TokenSource.Token()
+	require.NoError(t, err)
+	writeToken("third")
+	token, err = kubeconfig.TokenSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "third", token.AccessToken)
+
+	// clusters without a context are rejected.
+	_, err = provider.Kubeconfig(&api.Cluster{ID: "aws:123456789012:eu-central-1:kube-2"}, nil)
+	assert.Error(t, err)
+}
+
+type ssmAPIStub struct {
+	ssmiface.SSMAPI
+	parameters map[string]string
+}
+
+func (s *ssmAPIStub) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	return &ssm.GetParameterOutput{
+		Parameter: &ssm.Parameter{Value: aws.String(s.parameters[aws.StringValue(input.Name)])},
+	}, nil
+}
+
+func TestSSMKubeconfigProvider(t *testing.T) {
+	client := &ssmAPIStub{parameters: map[string]string{"/clm/kube-1/token": "secret"}}
+	provider := &ssmKubeconfigProvider{
+		parameterFormat: "/clm/%s/token",
+		ttl:             time.Hour,
+		newClient: func(sess *session.Session) ssmiface.SSMAPI {
+			return client
+		},
+	}
+
+	kubeconfig, err := provider.Kubeconfig(testCluster, nil)
+	require.NoError(t, err)
+	assert.Equal(t, testCluster.APIServerURL, kubeconfig.Server)
+
+	token, err := kubeconfig.TokenSource.Token()
+	require.NoError(t, err)
+	assert.Equal(t, "secret", token.AccessToken)
+}
@@ -1,6 +1,7 @@
 package kubernetes
 
 import (
+	"fmt"
 	"net/http"
 
 	"golang.org/x/oauth2"
@@ -23,3 +24,37 @@ func NewKubeClientWithTokenSource(host string, tokenSrc oauth2.TokenSource) (kub
 
 	return kubernetes.NewForConfig(cfg)
 }
+
+// NewReadOnlyKubeClientWithTokenSource initializes a Kubernetes client with
+// the specified token source, which rejects all requests that could change
+// resources before they're sent.
+func NewReadOnlyKubeClientWithTokenSource(host string, tokenSrc oauth2.TokenSource) (kubernetes.Interface, error) {
+	cfg := &rest.Config{
+		Host: host,
+		WrapTransport: func(rt http.RoundTripper) http.RoundTripper {
+			return &readOnlyTransport{
+				base: &oauth2.Transport{
+					Source: tokenSrc,
+					Base:   rt,
+				},
+			}
+		},
+	}
+
+	return kubernetes.NewForConfig(cfg)
+}
+
+// readOnlyTransport only passes requests reading resources on to the base
+// transport.
+type readOnlyTransport struct {
+	base http.RoundTripper
+}
+
+// RoundTrip rejects all requests whose method could change resources.
+func (t *readOnlyTransport) RoundTrip(req *http.Request) (*http.Response, error) {
+	switch req.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return t.base.RoundTrip(req)
+	}
+	return nil, fmt.Errorf("%s %s is not allowed in read-only mode", req.Method, req.URL.Path)
+}
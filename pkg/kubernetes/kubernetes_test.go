@@ -0,0 +1,35 @@
+package kubernetes
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestReadOnlyTransport(t *testing.T) {
+	var methods []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		methods = append(methods, r.Method)
+	}))
+	defer server.Close()
+
+	transport := &readOnlyTransport{base: http.DefaultTransport}
+
+	for _, method := range []string{http.MethodGet, http.MethodPost, http.MethodPatch, http.MethodDelete} {
+		req, err := http.NewRequest(method, server.URL+"/api/v1/nodes", nil)
+		require.NoError(t, err)
+
+		resp, err := transport.RoundTrip(req)
+		if method == http.MethodGet {
+			require.NoError(t, err)
+			resp.Body.Close()
+		} else {
+			assert.Error(t, err, method)
+		}
+	}
+
+	assert.Equal(t, []string{http.MethodGet}, methods)
+}
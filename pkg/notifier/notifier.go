@@ -0,0 +1,209 @@
+package notifier
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"text/template"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/sns"
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// DefaultTemplate is the template of the messages unless another one
+	// is configured.
+	DefaultTemplate = `[{{.Type}}] cluster {{.ClusterAlias}} ({{.ClusterID}}){{if .NodePool}} node pool {{.NodePool}}{{end}}, channel {{.Channel}} version {{.ChannelVersion}}: {{.Message}}`
+
+	// sendTimeout limits the time a notification may take to be sent,
+	// such that unavailable sinks don't block the provisioning.
+	sendTimeout = 10 * time.Second
+	// maxSNSSubjectLength is the maximum length of the subject of SNS
+	// messages.
+	maxSNSSubjectLength = 100
+)
+
+// Notification is a lifecycle event of a cluster sent to the sinks. Its
+// fields are available in the message template.
+type Notification struct {
+	Type           string    `json:"type"`
+	ClusterID      string    `json:"cluster_id"`
+	ClusterAlias   string    `json:"cluster_alias"`
+	Channel        string    `json:"channel"`
+	ChannelVersion string    `json:"channel_version"`
+	NodePool       string    `json:"node_pool,omitempty"`
+	Message        string    `json:"message"`
+	Time           time.Time `json:"time"`
+}
+
+// Sink sends the rendered message of a notification.
+type Sink interface {
+	Send(message string, notification *Notification) error
+}
+
+// Config defines the sinks notified about the lifecycle events of the
+// clusters and the template of the messages.
+type Config struct {
+	SlackWebhooks []string
+	Webhooks      []string
+	SNSTopics     []string
+	Template      string
+}
+
+// Notifier renders the lifecycle events of the clusters with a template and
+// sends them to all sinks.
+type Notifier struct {
+	sinks    []Sink
+	template *template.Template
+}
+
+// New initializes a Notifier sending to the sinks of the config. It returns
+// nil if no sinks are configured. SNS topics are published to with the
+// session.
+func New(config Config, sess *session.Session) (*Notifier, error) {
+	client := &http.Client{Timeout: sendTimeout}
+
+	var sinks []Sink
+	for _, url := range config.SlackWebhooks {
+		sinks = append(sinks, &slackSink{client: client, url: url})
+	}
+	for _, url := range config.Webhooks {
+		sinks = append(sinks, &webhookSink{client: client, url: url})
+	}
+	for _, topic := range config.SNSTopics {
+		sinks = append(sinks, &snsSink{client: sns.New(sess), topicARN: topic})
+	}
+
+	if len(sinks) == 0 {
+		return nil, nil
+	}
+
+	return NewWithSinks(config.Template, sinks...)
+}
+
+// NewWithSinks initializes a Notifier sending messages rendered with the
+// template to the sinks. The DefaultTemplate is used if the template is
+// empty.
+func NewWithSinks(messageTemplate string, sinks ...Sink) (*Notifier, error) {
+	if messageTemplate == "" {
+		messageTemplate = DefaultTemplate
+	}
+
+	tmpl, err := template.New("notification").Parse(messageTemplate)
+	if err != nil {
+		return nil, fmt.Errorf("invalid notification template: %v", err)
+	}
+
+	return &Notifier{sinks: sinks, template: tmpl}, nil
+}
+
+// Notify sends the notification to all sinks. Failing sinks are only logged,
+// such that notifications never fail the provisioning of a cluster. It's a
+// no-op for a nil Notifier.
+func (n *Notifier) Notify(notification *Notification) {
+	if n == nil {
+		return
+	}
+
+	logger := log.WithField("cluster", notification.ClusterAlias)
+
+	var message bytes.Buffer
+	err := n.template.Execute(&message, notification)
+	if err != nil {
+		logger.Errorf("Failed to render %s notification: %v", notification.Type, err)
+		return
+	}
+
+	for _, sink := range n.sinks {
+		err := sink.Send(message.String(), notification)
+		if err != nil {
+			logger.Warnf("Failed to send %s notification: %v", notification.Type, err)
+		}
+	}
+}
+
+// postJSON posts the JSON encoded body to the URL.
+func postJSON(client *http.Client, url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+
+	resp, err := client.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code %d from %s", resp.StatusCode, resp.Request.URL.Host)
+	}
+	return nil
+}
+
+// slackSink posts the messages to a Slack incoming webhook.
+type slackSink struct {
+	client *http.Client
+	url    string
+}
+
+func (s *slackSink) Send(message string, notification *Notification) error {
+	return postJSON(s.client, s.url, map[string]string{"text": message})
+}
+
+// webhookSink posts the notifications as JSON, including the rendered
+// message, to a generic HTTP endpoint.
+type webhookSink struct {
+	client *http.Client
+	url    string
+}
+
+type webhookBody struct {
+	*Notification
+	Text string `json:"text"`
+}
+
+func (s *webhookSink) Send(message string, notification *Notification) error {
+	return postJSON(s.client, s.url, &webhookBody{Notification: notification, Text: message})
+}
+
+// snsAPI is the minimal interface containing the SNS operations used.
+type snsAPI interface {
+	Publish(input *sns.PublishInput) (*sns.PublishOutput, error)
+}
+
+// snsSink publishes the messages to an SNS topic. The type of the event and
+// the cluster are added as message attributes, such that subscriptions can
+// filter them.
+type snsSink struct {
+	client   snsAPI
+	topicARN string
+}
+
+func (s *snsSink) Send(message string, notification *Notification) error {
+	subject := fmt.Sprintf("%s: %s", notification.Type, notification.ClusterAlias)
+	if len(subject) > maxSNSSubjectLength {
+		subject = subject[:maxSNSSubjectLength]
+	}
+
+	_, err := s.client.Publish(&sns.PublishInput{
+		TopicArn: aws.String(s.topicARN),
+		Subject:  aws.String(subject),
+		Message:  aws.String(message),
+		MessageAttributes: map[string]*sns.MessageAttributeValue{
+			"type": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(notification.Type),
+			},
+			"cluster_id": {
+				DataType:    aws.String("String"),
+				StringValue: aws.String(notification.ClusterID),
+			},
+		},
+	})
+	return err
+}
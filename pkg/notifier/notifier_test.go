@@ -0,0 +1,111 @@
+package notifier
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/sns"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type recordingSink struct {
+	messages []string
+	err      error
+}
+
+func (s *recordingSink) Send(message string, notification *Notification) error {
+	s.messages = append(s.messages, message)
+	return s.err
+}
+
+type snsAPIStub struct {
+	input *sns.PublishInput
+}
+
+func (s *snsAPIStub) Publish(input *sns.PublishInput) (*sns.PublishOutput, error) {
+	s.input = input
+	return &sns.PublishOutput{}, nil
+}
+
+var testNotification = &Notification{
+	Type:           "update-started",
+	ClusterID:      "aws:123456789012:eu-central-1:kube-1",
+	ClusterAlias:   "kube-1",
+	Channel:        "stable",
+	ChannelVersion: "abc123",
+	Message:        "Updating cluster",
+	Time:           time.Date(2018, 1, 1, 0, 0, 0, 0, time.UTC),
+}
+
+func TestNotify(t *testing.T) {
+	failing := &recordingSink{err: fmt.Errorf("failed")}
+	sink := &recordingSink{}
+
+	notifier, err := NewWithSinks("", failing, sink)
+	require.NoError(t, err)
+
+	// failing sinks don't prevent the other sinks from being notified.
+	notifier.Notify(testNotification)
+	assert.Equal(t, []string{"[update-started] cluster kube-1 (aws:123456789012:eu-central-1:kube-1), channel stable version abc123: Updating cluster"}, sink.messages)
+	assert.Len(t, failing.messages, 1)
+
+	notifier, err = NewWithSinks("{{.ClusterAlias}} {{.Type}}", sink)
+	require.NoError(t, err)
+	notifier.Notify(testNotification)
+	assert.Equal(t, "kube-1 update-started", sink.messages[1])
+
+	_, err = NewWithSinks("{{.ClusterAlias", sink)
+	assert.Error(t, err)
+
+	// nil notifiers are no-ops.
+	var disabled *Notifier
+	disabled.Notify(testNotification)
+}
+
+func TestNewWithoutSinks(t *testing.T) {
+	notifier, err := New(Config{}, nil)
+	require.NoError(t, err)
+	assert.Nil(t, notifier)
+}
+
+func TestHTTPSinks(t *testing.T) {
+	var received map[string]interface{}
+	status := http.StatusOK
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received = nil
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		w.WriteHeader(status)
+	}))
+	defer server.Close()
+
+	slack := &slackSink{client: server.Client(), url: server.URL}
+	require.NoError(t, slack.Send("message", testNotification))
+	assert.Equal(t, map[string]interface{}{"text": "message"}, received)
+
+	webhook := &webhookSink{client: server.Client(), url: server.URL}
+	require.NoError(t, webhook.Send("message", testNotification))
+	assert.Equal(t, "message", received["text"])
+	assert.Equal(t, "update-started", received["type"])
+	assert.Equal(t, "aws:123456789012:eu-central-1:kube-1", received["cluster_id"])
+	assert.Equal(t, "abc123", received["channel_version"])
+
+	status = http.StatusInternalServerError
+	assert.Error(t, slack.Send("message", testNotification))
+}
+
+func TestSNSSink(t *testing.T) {
+	client := &snsAPIStub{}
+	sink := &snsSink{client: client, topicARN: "arn:aws:sns:eu-central-1:123456789012:clm"}
+
+	require.NoError(t, sink.Send("message", testNotification))
+	assert.Equal(t, "arn:aws:sns:eu-central-1:123456789012:clm", aws.StringValue(client.input.TopicArn))
+	assert.Equal(t, "update-started: kube-1", aws.StringValue(client.input.Subject))
+	assert.Equal(t, "message", aws.StringValue(client.input.Message))
+	assert.Equal(t, "update-started", aws.StringValue(client.input.MessageAttributes["type"].StringValue))
+}
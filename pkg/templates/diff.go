@@ -0,0 +1,74 @@
+package templates
+
+import (
+	"fmt"
+
+	"github.com/pmezard/go-difflib/difflib"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/provisioner"
+)
+
+// diffContext is the number of unchanged lines around the changes in the
+// diffs.
+const diffContext = 3
+
+// NodePoolDiff is the unified diff of the stack and userdata of a node pool
+// rendered from two channel versions.
+type NodePoolDiff struct {
+	NodePool string
+	Diff     string
+}
+
+// DiffNodePools renders the stacks and userdata of all node pools of the
+// cluster from the channel versions from and to and returns the unified
+// diffs of the node pools whose stack or userdata changed, in the order of
+// the node pools of the cluster.
+func DiffNodePools(cluster *api.Cluster, from, to *channel.Config) ([]*NodePoolDiff, error) {
+	var diffs []*NodePoolDiff
+	for _, nodePool := range cluster.NodePools {
+		fromRendered, err := provisioner.RenderNodePool(cluster, nodePool, from)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render node pool %s from channel version %s: %v", nodePool.Name, from.Version, err)
+		}
+
+		toRendered, err := provisioner.RenderNodePool(cluster, nodePool, to)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render node pool %s from channel version %s: %v", nodePool.Name, to.Version, err)
+		}
+
+		stackDiff, err := unifiedDiff(nodePool.Name+"/stack", from.Version, to.Version, fromRendered.Stack, toRendered.Stack)
+		if err != nil {
+			return nil, err
+		}
+
+		userDataDiff, err := unifiedDiff(nodePool.Name+"/userdata", from.Version, to.Version, fromRendered.UserData, toRendered.UserData)
+		if err != nil {
+			return nil, err
+		}
+
+		if stackDiff == "" && userDataDiff == "" {
+			continue
+		}
+		diffs = append(diffs, &NodePoolDiff{NodePool: nodePool.Name, Diff: stackDiff + userDataDiff})
+	}
+
+	return diffs, nil
+}
+
+// unifiedDiff returns the unified diff of a rendered file between the
+// channel versions, or an empty string if it didn't change.
+func unifiedDiff(name, fromVersion, toVersion, a, b string) (string, error) {
+	if a == b {
+		return "", nil
+	}
+
+	return difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        difflib.SplitLines(a),
+		B:        difflib.SplitLines(b),
+		FromFile: fmt.Sprintf("%s@%s", name, fromVersion),
+		ToFile:   fmt.Sprintf("%s@%s", name, toVersion),
+		Context:  diffContext,
+	})
+}
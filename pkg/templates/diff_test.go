@@ -0,0 +1,60 @@
+package templates
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+func writeChannel(t *testing.T, userData string) string {
+	dir, err := ioutil.TempDir("", "templates")
+	require.NoError(t, err)
+
+	clusterDir := path.Join(dir, "cluster")
+	require.NoError(t, os.Mkdir(clusterDir, 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(clusterDir, "userdata-worker.yaml"), []byte(userData), 0644))
+	return dir
+}
+
+func TestDiffNodePools(t *testing.T) {
+	from := writeChannel(t, "#cloud-config\nteam: {{TEAM}}\nkubelet: v1\n")
+	defer os.RemoveAll(from)
+	to := writeChannel(t, "#cloud-config\nteam: {{TEAM}}\nkubelet: v2\n")
+	defer os.RemoveAll(to)
+
+	cluster := &api.Cluster{
+		ID:          "aws:123456789012:eu-central-1:kube-1",
+		LocalID:     "kube-1",
+		Provider:    "zalando-aws",
+		Region:      "eu-central-1",
+		ConfigItems: map[string]string{"worker_shared_secret": "secret", "team": "teapot"},
+		NodePools: []*api.NodePool{
+			{Name: "worker-default", Profile: "worker-default", InstanceType: "m5.large"},
+		},
+	}
+
+	diffs, err := DiffNodePools(cluster, &channel.Config{Version: "a1", Path: from}, &channel.Config{Version: "b2", Path: to})
+	require.NoError(t, err)
+	require.Len(t, diffs, 1)
+	assert.Equal(t, "worker-default", diffs[0].NodePool)
+	assert.Equal(t, `--- worker-default/userdata@a1
++++ worker-default/userdata@b2
+@@ -1,3 +1,3 @@
+ #cloud-config
+ team: teapot
+-kubelet: v1
++kubelet: v2
+`, diffs[0].Diff)
+
+	// unchanged node pools are left out.
+	diffs, err = DiffNodePools(cluster, &channel.Config{Version: "a1", Path: from}, &channel.Config{Version: "a1", Path: from})
+	require.NoError(t, err)
+	assert.Empty(t, diffs)
+}
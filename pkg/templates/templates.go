@@ -0,0 +1,80 @@
+package templates
+
+import (
+	"fmt"
+	"io/ioutil"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/provisioner"
+)
+
+// LoadCluster reads a cluster definition in the format of the clusters in a
+// clusters.yaml from clusterFile. The config items in valuesFile, a flat map
+// of config item names to values, are added to the config items of the
+// cluster and override them. valuesFile is optional.
+func LoadCluster(clusterFile, valuesFile string) (*api.Cluster, error) {
+	data, err := ioutil.ReadFile(clusterFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var cluster api.Cluster
+	err = yaml.Unmarshal(data, &cluster)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster %s: %v", clusterFile, err)
+	}
+
+	if cluster.ConfigItems == nil {
+		cluster.ConfigItems = make(map[string]string)
+	}
+
+	if valuesFile == "" {
+		return &cluster, nil
+	}
+
+	data, err = ioutil.ReadFile(valuesFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var values map[string]string
+	err = yaml.Unmarshal(data, &values)
+	if err != nil {
+		return nil, fmt.Errorf("invalid values %s: %v", valuesFile, err)
+	}
+
+	for key, value := range values {
+		cluster.ConfigItems[key] = value
+	}
+
+	return &cluster, nil
+}
+
+// RenderNodePools renders the stacks and userdata of all node pools of the
+// cluster using the profile from the channel in channelDir. It fails if the
+// cluster has no node pool with the profile.
+func RenderNodePools(channelDir string, cluster *api.Cluster, profile string) ([]*provisioner.RenderedNodePool, error) {
+	channelConfig := &channel.Config{Path: channelDir}
+
+	var rendered []*provisioner.RenderedNodePool
+	for _, nodePool := range cluster.NodePools {
+		if nodePool.Profile != profile {
+			continue
+		}
+
+		nodePoolRendered, err := provisioner.RenderNodePool(cluster, nodePool, channelConfig)
+		if err != nil {
+			return nil, fmt.Errorf("failed to render node pool %s: %v", nodePool.Name, err)
+		}
+		rendered = append(rendered, nodePoolRendered)
+	}
+
+	if len(rendered) == 0 {
+		return nil, fmt.Errorf("cluster %s has no node pool with profile %s", cluster.ID, profile)
+	}
+
+	return rendered, nil
+}
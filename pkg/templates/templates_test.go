@@ -0,0 +1,70 @@
+package templates
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const testCluster = `id: aws:123456789012:eu-central-1:kube-1
+local_id: kube-1
+api_server_url: https://kube-1.foo.example.org/
+provider: zalando-aws
+region: eu-central-1
+channel: alpha
+config_items:
+  worker_shared_secret: secret
+  team: foo
+node_pools:
+- name: master-default
+  profile: master-default
+  instance_type: m5.large
+- name: worker-default
+  profile: worker-default
+  instance_type: m5.large
+`
+
+func TestRenderNodePools(t *testing.T) {
+	dir, err := ioutil.TempDir("", "templates")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	clusterDir := path.Join(dir, "cluster")
+	require.NoError(t, os.Mkdir(clusterDir, 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(clusterDir, "userdata-worker.yaml"), []byte("#cloud-config\nteam: {{TEAM}}\n"), 0644))
+
+	clusterFile := path.Join(dir, "cluster.yaml")
+	require.NoError(t, ioutil.WriteFile(clusterFile, []byte(testCluster), 0644))
+	valuesFile := path.Join(dir, "values.yaml")
+	require.NoError(t, ioutil.WriteFile(valuesFile, []byte("team: teapot\n"), 0644))
+
+	cluster, err := LoadCluster(clusterFile, "")
+	require.NoError(t, err)
+	assert.Equal(t, "foo", cluster.ConfigItems["team"])
+
+	// the values override the config items of the cluster.
+	cluster, err = LoadCluster(clusterFile, valuesFile)
+	require.NoError(t, err)
+	assert.Equal(t, "teapot", cluster.ConfigItems["team"])
+	assert.Equal(t, "secret", cluster.ConfigItems["worker_shared_secret"])
+
+	rendered, err := RenderNodePools(dir, cluster, "worker-default")
+	require.NoError(t, err)
+	require.Len(t, rendered, 1)
+	assert.Equal(t, "worker-default", rendered[0].NodePool)
+	assert.Equal(t, "#cloud-config\nteam: teapot\n", rendered[0].UserData)
+
+	_, err = RenderNodePools(dir, cluster, "worker-unknown")
+	assert.Error(t, err)
+
+	// the master profile has no userdata in the channel.
+	_, err = RenderNodePools(dir, cluster, "master-default")
+	assert.Error(t, err)
+
+	_, err = LoadCluster(path.Join(dir, "missing.yaml"), "")
+	assert.Error(t, err)
+}
@@ -0,0 +1,269 @@
+package tracing
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+)
+
+const (
+	// otlpTracesPath is the path of the OTLP/HTTP traces endpoint.
+	otlpTracesPath = "/v1/traces"
+	// otlpQueueSize is the number of ended spans waiting to be exported,
+	// further spans are dropped until the queue drains.
+	otlpQueueSize = 2048
+	// otlpBatchSize is the maximum number of spans exported at once.
+	otlpBatchSize = 512
+	// otlpExportInterval is the interval the pending spans are exported
+	// in, unless a batch is full before.
+	otlpExportInterval = 5 * time.Second
+	// otlpExportTimeout limits the time an export may take.
+	otlpExportTimeout = 10 * time.Second
+
+	otlpSpanKindInternal = 1
+	otlpStatusCodeError  = 2
+)
+
+// otlpExporter exports the ended spans in batches to an OTLP collector via
+// HTTP with the JSON encoding.
+type otlpExporter struct {
+	client   *http.Client
+	url      string
+	resource []otlpKeyValue
+	spans    chan *Span
+	done     chan struct{}
+	stopped  chan struct{}
+	once     sync.Once
+	err      error
+}
+
+func newOTLPExporter(config Config, resource []Attribute) *otlpExporter {
+	scheme := "https"
+	if config.Insecure {
+		scheme = "http"
+	}
+	return &otlpExporter{
+		client:   &http.Client{Timeout: otlpExportTimeout},
+		url:      scheme + "://" + config.OTLPEndpoint + otlpTracesPath,
+		resource: otlpAttributes(resource),
+		spans:    make(chan *Span, otlpQueueSize),
+		done:     make(chan struct{}),
+		stopped:  make(chan struct{}),
+	}
+}
+
+// OnEnd queues the span for the export.
+func (e *otlpExporter) OnEnd(span *Span) {
+	select {
+	case e.spans <- span:
+	default:
+		log.Debugf("Dropping span %s, the export queue is full", span)
+	}
+}
+
+// run exports the queued spans until the exporter is shut down.
+func (e *otlpExporter) run() {
+	defer close(e.stopped)
+
+	ticker := time.NewTicker(otlpExportInterval)
+	defer ticker.Stop()
+
+	var batch []*Span
+	flush := func() error {
+		if len(batch) == 0 {
+			return nil
+		}
+		err := e.export(batch)
+		if err != nil {
+			log.Warnf("Failed to export %d spans: %v", len(batch), err)
+		}
+		batch = nil
+		return err
+	}
+
+	for {
+		select {
+		case span := <-e.spans:
+			batch = append(batch, span)
+			if len(batch) >= otlpBatchSize {
+				flush()
+			}
+		case <-ticker.C:
+			flush()
+		case <-e.done:
+		drain:
+			for {
+				select {
+				case span := <-e.spans:
+					batch = append(batch, span)
+				default:
+					break drain
+				}
+			}
+			e.err = flush()
+			return
+		}
+	}
+}
+
+// Shutdown exports the pending spans and stops the exporter.
+func (e *otlpExporter) Shutdown(ctx context.Context) error {
+	e.once.Do(func() { close(e.done) })
+	select {
+	case <-e.stopped:
+		return e.err
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (e *otlpExporter) export(spans []*Span) error {
+	request := otlpTraces{
+		ResourceSpans: []otlpResourceSpans{
+			{
+				Resource: otlpResource{Attributes: e.resource},
+				ScopeSpans: []otlpScopeSpans{
+					{
+						Scope: otlpScope{Name: tracerName},
+						Spans: make([]otlpSpan, 0, len(spans)),
+					},
+				},
+			},
+		},
+	}
+	scopeSpans := &request.ResourceSpans[0].ScopeSpans[0]
+	for _, span := range spans {
+		scopeSpans.Spans = append(scopeSpans.Spans, newOTLPSpan(span))
+	}
+
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+
+	resp, err := e.client.Post(e.url, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status code from %s: %d", e.url, resp.StatusCode)
+	}
+	return nil
+}
+
+// otlpTraces is the ExportTraceServiceRequest of the OTLP protocol in its
+// JSON encoding.
+type otlpTraces struct {
+	ResourceSpans []otlpResourceSpans `json:"resourceSpans"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code,omitempty"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+// otlpAnyValue is the value of an attribute, 64 bit integers are encoded as
+// strings.
+type otlpAnyValue struct {
+	StringValue *string `json:"stringValue,omitempty"`
+	IntValue    *string `json:"intValue,omitempty"`
+	BoolValue   *bool   `json:"boolValue,omitempty"`
+}
+
+// newOTLPSpan converts the span, its error is recorded as an exception
+// event and sets the status of the span to error.
+func newOTLPSpan(span *Span) otlpSpan {
+	result := otlpSpan{
+		TraceID:           span.TraceID(),
+		SpanID:            span.SpanID(),
+		ParentSpanID:      span.ParentSpanID(),
+		Name:              span.name,
+		Kind:              otlpSpanKindInternal,
+		StartTimeUnixNano: strconv.FormatInt(span.start.UnixNano(), 10),
+		EndTimeUnixNano:   strconv.FormatInt(span.end.UnixNano(), 10),
+		Attributes:        otlpAttributes(span.attributes),
+	}
+	if span.err != nil {
+		result.Events = []otlpEvent{
+			{
+				TimeUnixNano: result.EndTimeUnixNano,
+				Name:         "exception",
+				Attributes:   otlpAttributes([]Attribute{String("exception.message", span.err.Error())}),
+			},
+		}
+		result.Status = otlpStatus{Code: otlpStatusCodeError, Message: span.err.Error()}
+	}
+	return result
+}
+
+func otlpAttributes(attributes []Attribute) []otlpKeyValue {
+	result := make([]otlpKeyValue, 0, len(attributes))
+	for _, attribute := range attributes {
+		var value otlpAnyValue
+		switch v := attribute.Value.(type) {
+		case string:
+			value.StringValue = &v
+		case int64:
+			s := strconv.FormatInt(v, 10)
+			value.IntValue = &s
+		case bool:
+			value.BoolValue = &v
+		default:
+			s := fmt.Sprint(v)
+			value.StringValue = &s
+		}
+		result = append(result, otlpKeyValue{Key: attribute.Key, Value: value})
+	}
+	return result
+}
@@ -0,0 +1,231 @@
+package tracing
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	mathrand "math/rand"
+	"sync"
+	"time"
+)
+
+const (
+	serviceName = "cluster-lifecycle-manager"
+	tracerName  = "github.com/zalando-incubator/cluster-lifecycle-manager"
+)
+
+// Config defines the OTLP collector the spans are exported to. Nothing is
+// exported unless an endpoint is configured.
+type Config struct {
+	OTLPEndpoint string
+	Insecure     bool
+	SampleRatio  float64
+}
+
+// Attribute is a key value pair describing a span.
+type Attribute struct {
+	Key   string
+	Value interface{}
+}
+
+// String returns a string attribute.
+func String(key, value string) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Int returns an integer attribute.
+func Int(key string, value int) Attribute {
+	return Attribute{Key: key, Value: int64(value)}
+}
+
+// Bool returns a boolean attribute.
+func Bool(key string, value bool) Attribute {
+	return Attribute{Key: key, Value: value}
+}
+
+// Processor receives the spans of the sampled traces once they ended.
+type Processor interface {
+	OnEnd(span *Span)
+}
+
+var (
+	mu          sync.RWMutex
+	processor   Processor
+	sampleRatio float64
+)
+
+// Register makes the processor receive the spans of the share of traces
+// given by the sample ratio. Without a processor no spans are recorded.
+func Register(p Processor, ratio float64) {
+	mu.Lock()
+	defer mu.Unlock()
+	processor = p
+	sampleRatio = ratio
+}
+
+// Setup registers a processor exporting the spans to the OTLP collector of
+// the config via HTTP. The returned function flushes the pending spans and
+// stops the exporter. Without an endpoint the spans are discarded and the
+// returned function does nothing.
+func Setup(ctx context.Context, config Config, version string) (func(context.Context) error, error) {
+	if config.OTLPEndpoint == "" {
+		return func(context.Context) error { return nil }, nil
+	}
+
+	exporter := newOTLPExporter(config, []Attribute{
+		String("service.name", serviceName),
+		String("service.version", version),
+	})
+	go exporter.run()
+	Register(exporter, config.SampleRatio)
+
+	return exporter.Shutdown, nil
+}
+
+type spanKey struct{}
+
+// Span is an operation of a trace. Spans of traces which aren't sampled
+// aren't recording, they only pass on the decision to their children.
+type Span struct {
+	traceID      [16]byte
+	spanID       [8]byte
+	parentSpanID [8]byte
+	name         string
+	start        time.Time
+	end          time.Time
+	attributes   []Attribute
+	err          error
+	recording    bool
+	ended        bool
+	processor    Processor
+}
+
+// Start starts a span with the attributes as a child of the span of ctx and
+// returns the context of the new span.
+func Start(ctx context.Context, name string, attributes ...Attribute) (context.Context, *Span) {
+	mu.RLock()
+	p, ratio := processor, sampleRatio
+	mu.RUnlock()
+
+	span := &Span{name: name, start: time.Now(), attributes: attributes, processor: p}
+	if parent := SpanFromContext(ctx); parent != nil {
+		span.traceID = parent.traceID
+		span.parentSpanID = parent.spanID
+		span.recording = parent.recording && p != nil
+	} else {
+		randomID(span.traceID[:])
+		span.recording = p != nil && mathrand.Float64() < ratio
+	}
+	randomID(span.spanID[:])
+
+	return context.WithValue(ctx, spanKey{}, span), span
+}
+
+// End records err in the span, if any, and ends it.
+func End(span *Span, err error) {
+	if err != nil {
+		span.err = err
+	}
+	span.End()
+}
+
+// Recording returns true if ctx carries a span which records its
+// children, i.e. the operation is part of a sampled trace.
+func Recording(ctx context.Context) bool {
+	return SpanFromContext(ctx).IsRecording()
+}
+
+// SpanFromContext returns the span of ctx or nil if it doesn't carry one.
+func SpanFromContext(ctx context.Context) *Span {
+	span, _ := ctx.Value(spanKey{}).(*Span)
+	return span
+}
+
+// IsRecording returns true if the span is part of a sampled trace and
+// hasn't ended yet.
+func (s *Span) IsRecording() bool {
+	return s != nil && s.recording && !s.ended
+}
+
+// SetAttributes adds the attributes to the span.
+func (s *Span) SetAttributes(attributes ...Attribute) {
+	if s.IsRecording() {
+		s.attributes = append(s.attributes, attributes...)
+	}
+}
+
+// End ends the span and passes it to the processor if it's recording.
+func (s *Span) End() {
+	if !s.IsRecording() {
+		return
+	}
+	s.end = time.Now()
+	s.ended = true
+	s.processor.OnEnd(s)
+}
+
+// Name returns the name of the span.
+func (s *Span) Name() string {
+	return s.name
+}
+
+// TraceID returns the hex encoded ID of the trace of the span.
+func (s *Span) TraceID() string {
+	return hex.EncodeToString(s.traceID[:])
+}
+
+// SpanID returns the hex encoded ID of the span.
+func (s *Span) SpanID() string {
+	return hex.EncodeToString(s.spanID[:])
+}
+
+// ParentSpanID returns the hex encoded ID of the parent of the span or an
+// empty string for the root span of a trace.
+func (s *Span) ParentSpanID() string {
+	if s.parentSpanID == [8]byte{} {
+		return ""
+	}
+	return hex.EncodeToString(s.parentSpanID[:])
+}
+
+// Attributes returns the attributes of the span.
+func (s *Span) Attributes() []Attribute {
+	return s.attributes
+}
+
+// Err returns the error the operation of the span failed with, if any.
+func (s *Span) Err() error {
+	return s.err
+}
+
+func (s *Span) String() string {
+	return fmt.Sprintf("%s (trace %s, span %s)", s.name, s.TraceID(), s.SpanID())
+}
+
+// randomID fills id with random bytes. crypto/rand doesn't fail on the
+// supported platforms, so its error is ignored.
+func randomID(id []byte) {
+	_, _ = rand.Read(id)
+}
+
+// SpanRecorder is a processor keeping the ended spans in memory, e.g. to
+// verify the instrumentation in tests.
+type SpanRecorder struct {
+	mu    sync.Mutex
+	spans []*Span
+}
+
+// OnEnd records the span.
+func (r *SpanRecorder) OnEnd(span *Span) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.spans = append(r.spans, span)
+}
+
+// Ended returns the recorded spans in the order they ended.
+func (r *SpanRecorder) Ended() []*Span {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	return append([]*Span(nil), r.spans...)
+}
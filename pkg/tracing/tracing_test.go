@@ -0,0 +1,105 @@
+package tracing
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestSetupWithoutEndpoint(t *testing.T) {
+	shutdown, err := Setup(context.Background(), Config{}, "v1")
+	require.NoError(t, err)
+	assert.NoError(t, shutdown(context.Background()))
+}
+
+func TestStartEnd(t *testing.T) {
+	recorder := &SpanRecorder{}
+	Register(recorder, 1)
+	defer Register(nil, 0)
+
+	assert.False(t, Recording(context.Background()))
+
+	ctx, parent := Start(context.Background(), "cluster.provision", String("cluster.id", "kube-1"))
+	assert.True(t, Recording(ctx))
+
+	_, child := Start(ctx, "stack.wait")
+	End(child, errors.New("stack failed"))
+	End(parent, nil)
+	assert.False(t, Recording(ctx))
+
+	spans := recorder.Ended()
+	require.Len(t, spans, 2)
+	assert.Equal(t, "stack.wait", spans[0].Name())
+	assert.EqualError(t, spans[0].Err(), "stack failed")
+	assert.Equal(t, parent.TraceID(), spans[0].TraceID())
+	assert.Equal(t, parent.SpanID(), spans[0].ParentSpanID())
+	assert.Equal(t, "cluster.provision", spans[1].Name())
+	assert.NoError(t, spans[1].Err())
+	assert.Empty(t, spans[1].ParentSpanID())
+	assert.Contains(t, spans[1].Attributes(), String("cluster.id", "kube-1"))
+}
+
+func TestStartUnsampled(t *testing.T) {
+	recorder := &SpanRecorder{}
+	Register(recorder, 0)
+	defer Register(nil, 0)
+
+	ctx, parent := Start(context.Background(), "cluster.process")
+	assert.False(t, Recording(ctx))
+
+	// children of traces which aren't sampled aren't recorded either.
+	_, child := Start(ctx, "cluster.provision")
+	End(child, nil)
+	End(parent, nil)
+	assert.Empty(t, recorder.Ended())
+}
+
+func TestSetupExportsSpans(t *testing.T) {
+	var received otlpTraces
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, otlpTracesPath, r.URL.Path)
+		assert.Equal(t, "application/json", r.Header.Get("Content-Type"))
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+	}))
+	defer server.Close()
+
+	shutdown, err := Setup(context.Background(), Config{OTLPEndpoint: strings.TrimPrefix(server.URL, "http://"), Insecure: true, SampleRatio: 1}, "v1")
+	require.NoError(t, err)
+	defer Register(nil, 0)
+
+	ctx, parent := Start(context.Background(), "cluster.process", String("cluster.id", "kube-1"), Int("retries", 3), Bool("scale_down", true))
+	_, child := Start(ctx, "stack.wait")
+	End(child, errors.New("stack failed"))
+	End(parent, nil)
+	require.NoError(t, shutdown(context.Background()))
+
+	require.Len(t, received.ResourceSpans, 1)
+	resource := received.ResourceSpans[0]
+	assert.Contains(t, resource.Resource.Attributes, otlpAttributes([]Attribute{String("service.version", "v1")})[0])
+	require.Len(t, resource.ScopeSpans, 1)
+	assert.Equal(t, tracerName, resource.ScopeSpans[0].Scope.Name)
+
+	spans := resource.ScopeSpans[0].Spans
+	require.Len(t, spans, 2)
+	assert.Equal(t, "stack.wait", spans[0].Name)
+	assert.Equal(t, parent.SpanID(), spans[0].ParentSpanID)
+	assert.Equal(t, otlpStatus{Code: otlpStatusCodeError, Message: "stack failed"}, spans[0].Status)
+	require.Len(t, spans[0].Events, 1)
+	assert.Equal(t, "exception", spans[0].Events[0].Name)
+
+	assert.Equal(t, "cluster.process", spans[1].Name)
+	assert.Equal(t, parent.TraceID(), spans[1].TraceID)
+	assert.Empty(t, spans[1].ParentSpanID)
+	assert.Equal(t, otlpStatus{}, spans[1].Status)
+	require.Len(t, spans[1].Attributes, 3)
+	assert.Equal(t, "kube-1", *spans[1].Attributes[0].Value.StringValue)
+	assert.Equal(t, "3", *spans[1].Attributes[1].Value.IntValue)
+	assert.True(t, *spans[1].Attributes[2].Value.BoolValue)
+}
@@ -5,6 +5,7 @@ import (
 	"math"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/session"
@@ -18,15 +19,37 @@ import (
 )
 
 const (
-	clusterIDTagPrefix          = "kubernetes.io/cluster/"
-	resourceLifecycleOwned      = "owned"
-	nodePoolTag                 = "NodePool"
-	userDataAttribute           = "userData"
-	instanceTypeAttribute       = "instanceType"
-	instanceIdFilter            = "instance-id"
-	instanceHealthStatusHealthy = "Healthy"
+	clusterIDTagPrefix           = "kubernetes.io/cluster/"
+	resourceLifecycleOwned       = "owned"
+	nodePoolTag                  = "NodePool"
+	userDataAttribute            = "userData"
+	instanceTypeAttribute        = "instanceType"
+	instanceIdFilter             = "instance-id"
+	instanceHealthStatusHealthy  = "Healthy"
+	drainStatsTag                = "cluster-lifecycle-manager.zalando.org/drain-stats"
+	bootstrapFailuresTag         = "cluster-lifecycle-manager.zalando.org/bootstrap-failures"
+	rolloutProgressTag           = "cluster-lifecycle-manager.zalando.org/rollout-progress"
+	maxASGTagValueLength         = 256
+	asgResourceType              = "auto-scaling-group"
+	launchTemplateVersionDefault = "$Default"
 )
 
+// PreScaleDesiredCapacityTag is the ASG tag used to remember the desired
+// capacity of a node pool before it was scaled to zero.
+const PreScaleDesiredCapacityTag = "cluster-lifecycle-manager.zalando.org/pre-scale-desired-capacity"
+
+// AdoptedASGTag is the ASG tag marking an ASG which wasn't created by CLM as
+// adopted by the node pool named by its value. The instances of adopted ASGs
+// are outdated nodes of the node pool, such that they are gradually replaced
+// by the nodes of the ASG of the node pool.
+const AdoptedASGTag = "cluster-lifecycle-manager.zalando.org/adopted-by"
+
+// ProfileChangedTag is the ASG tag recording when the profile of the node
+// pool of the ASG was last changed, as an RFC 3339 timestamp. The instances
+// launched before are outdated, even if the launch configuration or launch
+// template stayed the same.
+const ProfileChangedTag = "cluster-lifecycle-manager.zalando.org/profile-changed"
+
 const (
 	outdatedNodeGeneration int = iota
 	currentNodeGeneration
@@ -34,43 +57,79 @@ const (
 
 // ASGNodePoolsBackend defines a node pool backed by an AWS Auto Scaling Group.
 type ASGNodePoolsBackend struct {
-	asgClient autoscalingiface.AutoScalingAPI
-	ec2Client ec2iface.EC2API
-	elbClient elbiface.ELBAPI
-	clusterID string
+	asgClient             autoscalingiface.AutoScalingAPI
+	instanceRefreshClient instanceRefreshAPI
+	warmPoolClient        warmPoolAPI
+	ec2Client             ec2iface.EC2API
+	elbClient             elbiface.ELBAPI
+	clusterID             string
 }
 
 // NewASGNodePoolsBackend initializes a new ASGNodePoolsBackend for the given clusterID and AWS
 // session and.
 func NewASGNodePoolsBackend(clusterID string, sess *session.Session) *ASGNodePoolsBackend {
+	asgClient := autoscaling.New(sess)
+	queryClient := &autoscalingQueryClient{client: asgClient}
 	return &ASGNodePoolsBackend{
-		asgClient: autoscaling.New(sess),
-		ec2Client: ec2.New(sess),
-		elbClient: elb.New(sess),
-		clusterID: clusterID,
+		asgClient:             asgClient,
+		instanceRefreshClient: queryClient,
+		warmPoolClient:        queryClient,
+		ec2Client:             ec2.New(sess),
+		elbClient:             elb.New(sess),
+		clusterID:             clusterID,
 	}
 }
 
 // Get gets the ASG matching to the node pool and gets all instances from the
 // ASG. The node generation is set to 'current' for nodes with the latest
-// launch configuration and 'outdated' for nodes with an older launch
-// configuration.
+// launch configuration or launch template version and 'outdated' for nodes
+// with an older one. The instances of ASGs adopted by the node pool are
+// always outdated.
 func (n *ASGNodePoolsBackend) Get(nodePool *api.NodePool) (*NodePool, error) {
 	asg, err := n.getNodePoolASG(nodePool)
 	if err != nil {
 		return nil, err
 	}
 
+	adopted, err := n.getAdoptedASGs(nodePool)
+	if err != nil {
+		return nil, err
+	}
+
 	oldInstances, err := n.getInstancesToUpdate(asg)
 	if err != nil {
 		return nil, err
 	}
 
+	// a changed profile is a different node pool configuration, even if
+	// the launch configuration happens to be the same.
+	profileOutdated, err := n.getProfileOutdatedInstances(asg)
+	if err != nil {
+		return nil, err
+	}
+	for instanceID := range profileOutdated {
+		oldInstances[instanceID] = true
+	}
+
 	lbInstances, err := n.getLoadBalancerAttachedInstancesReadiness(asg)
 	if err != nil {
 		return nil, err
 	}
 
+	stoppedInstances, err := n.getStoppedInstances(asg)
+	if err != nil {
+		return nil, err
+	}
+
+	// the sticky volumes are moved to the replacements of their nodes.
+	var stickyVolumes map[string]string
+	if hasStickyVolumes(nodePool) {
+		stickyVolumes, err = n.getStickyVolumes(nodePool)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	// TODO: also lookup target groups for ALBs attached to the ASG (for Ingress)
 
 	nodes := make([]*Node, 0, len(asg.Instances))
@@ -95,13 +154,34 @@ func (n *ASGNodePoolsBackend) Get(nodePool *api.NodePool) (*NodePool, error) {
 			node.Ready = ready
 		}
 
+		if stoppedInstances[instanceID] {
+			node.Stopped = true
+			node.Ready = false
+		}
+
+		node.StickyVolume = stickyVolumes[instanceID]
+
 		nodes = append(nodes, node)
 	}
 
+	desired := int(aws.Int64Value(asg.DesiredCapacity))
+	for _, adoptedASG := range adopted {
+		desired += int(aws.Int64Value(adoptedASG.DesiredCapacity))
+		for _, instance := range adoptedASG.Instances {
+			nodes = append(nodes, &Node{
+				ProviderID:    fmt.Sprintf("aws:///%s/%s", aws.StringValue(instance.AvailabilityZone), aws.StringValue(instance.InstanceId)),
+				FailureDomain: aws.StringValue(instance.AvailabilityZone),
+				Generation:    outdatedNodeGeneration,
+				Ready:         aws.StringValue(instance.HealthStatus) == instanceHealthStatusHealthy && aws.StringValue(instance.LifecycleState) == autoscaling.LifecycleStateInService,
+				Adopted:       true,
+			})
+		}
+	}
+
 	return &NodePool{
 		Min:        int(aws.Int64Value(asg.MinSize)),
 		Max:        int(aws.Int64Value(asg.MaxSize)),
-		Desired:    int(aws.Int64Value(asg.DesiredCapacity)),
+		Desired:    desired,
 		Current:    len(nodes),
 		Generation: currentNodeGeneration,
 		Nodes:      nodes,
@@ -109,12 +189,38 @@ func (n *ASGNodePoolsBackend) Get(nodePool *api.NodePool) (*NodePool, error) {
 }
 
 // Scale sets the desired capacity of the ASG to the number of replicas.
+// Before scaling to zero the current desired capacity is stored as a tag on
+// the ASG such that the node pool can be restored to its prior size if the
+// scale down is interrupted or rolled back. The tag is removed again once the
+// pool is scaled up. The desired capacity of adopted ASGs counts towards the
+// replicas, but only the ASG of the node pool is scaled.
 func (n *ASGNodePoolsBackend) Scale(nodePool *api.NodePool, replicas int) error {
 	asg, err := n.getNodePoolASG(nodePool)
 	if err != nil {
 		return err
 	}
 
+	adopted, err := n.getAdoptedASGs(nodePool)
+	if err != nil {
+		return err
+	}
+
+	for _, adoptedASG := range adopted {
+		replicas -= int(aws.Int64Value(adoptedASG.DesiredCapacity))
+	}
+	if replicas < 0 {
+		replicas = 0
+	}
+
+	// only store the desired capacity if the ASG isn't already scaled
+	// down to not overwrite it when the scale down is retried.
+	if replicas == 0 && aws.Int64Value(asg.DesiredCapacity) > 0 {
+		err := n.setASGTag(asg, PreScaleDesiredCapacityTag, strconv.FormatInt(aws.Int64Value(asg.DesiredCapacity), 10))
+		if err != nil {
+			return err
+		}
+	}
+
 	min := int64(math.Min(float64(replicas), float64(aws.Int64Value(asg.MinSize))))
 	max := int64(math.Max(float64(replicas), float64(aws.Int64Value(asg.MaxSize))))
 
@@ -126,17 +232,29 @@ func (n *ASGNodePoolsBackend) Scale(nodePool *api.NodePool, replicas int) error
 	}
 
 	_, err = n.asgClient.UpdateAutoScalingGroup(params)
-	return err
+	if err != nil {
+		return err
+	}
+
+	if replicas > 0 && asgHasTag(asg, PreScaleDesiredCapacityTag) {
+		return n.deleteASGTag(asg, PreScaleDesiredCapacityTag)
+	}
+
+	return nil
 }
 
 // Terminate terminates a node from the ASG and optionally decrements the
-// DesiredCapacity. By default the desired capacity will not be decremented.
+// DesiredCapacity. By default the desired capacity will not be decremented,
+// except for nodes of adopted ASGs which must not be replaced. Stopped
+// instances which can't be terminated via the ASG are terminated explicitly,
+// as they would otherwise be kept forever. The terminate lifecycle hooks of
+// the ASG are completed, as the node was drained before.
 func (n *ASGNodePoolsBackend) Terminate(node *Node, decrementDesired bool) error {
 	instanceId := aws.String(instanceIDFromProviderID(node.ProviderID, node.FailureDomain))
 
 	params := &autoscaling.TerminateInstanceInAutoScalingGroupInput{
 		InstanceId:                     instanceId,
-		ShouldDecrementDesiredCapacity: aws.Bool(decrementDesired),
+		ShouldDecrementDesiredCapacity: aws.Bool(decrementDesired || node.Adopted),
 	}
 
 	_, err := n.asgClient.TerminateInstanceInAutoScalingGroup(params)
@@ -153,14 +271,240 @@ func (n *ASGNodePoolsBackend) Terminate(node *Node, decrementDesired bool) error
 		}
 
 		switch aws.StringValue(status.InstanceStatuses[0].InstanceState.Name) {
-		case ec2.InstanceStateNameShuttingDown, ec2.InstanceStateNameStopping, ec2.InstanceStateNameTerminated, ec2.InstanceStateNameStopped:
+		case ec2.InstanceStateNameShuttingDown, ec2.InstanceStateNameTerminated:
 			return nil
+		case ec2.InstanceStateNameStopping, ec2.InstanceStateNameStopped:
+			_, err := n.ec2Client.TerminateInstances(&ec2.TerminateInstancesInput{
+				InstanceIds: []*string{instanceId},
+			})
+			return err
 		default:
 			return err
 		}
 	}
 
-	return nil
+	return n.completeTerminationHooks(aws.StringValue(instanceId))
+}
+
+// GetDrainStats gets the drain statistics of a node pool stored as a tag on
+// the ASG. Empty stats are returned if the ASG has no drain statistics yet.
+func (n *ASGNodePoolsBackend) GetDrainStats(nodePool *api.NodePool) (*DrainStats, error) {
+	asg, err := n.getNodePoolASG(nodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tag := range asg.Tags {
+		if aws.StringValue(tag.Key) == drainStatsTag {
+			return parseDrainStats(aws.StringValue(tag.Value))
+		}
+	}
+
+	return &DrainStats{}, nil
+}
+
+// SetDrainStats stores the drain statistics of a node pool as a tag on the
+// ASG.
+func (n *ASGNodePoolsBackend) SetDrainStats(nodePool *api.NodePool, stats *DrainStats) error {
+	asg, err := n.getNodePoolASG(nodePool)
+	if err != nil {
+		return err
+	}
+
+	return n.setASGTag(asg, drainStatsTag, stats.String())
+}
+
+// GetBootstrapFailures gets the number of consecutive bootstrap failures of a
+// node pool stored as a tag on the ASG. The failures are only returned if
+// they were recorded for the launch configuration or launch template version
+// currently used by the ASG, such that a node pool is unfrozen by changing
+// its configuration.
+func (n *ASGNodePoolsBackend) GetBootstrapFailures(nodePool *api.NodePool) (int, error) {
+	asg, err := n.getNodePoolASG(nodePool)
+	if err != nil {
+		return 0, err
+	}
+
+	for _, tag := range asg.Tags {
+		if aws.StringValue(tag.Key) != bootstrapFailuresTag {
+			continue
+		}
+
+		value := aws.StringValue(tag.Value)
+		parts := strings.SplitN(value, "/", 2)
+		if len(parts) != 2 {
+			return 0, fmt.Errorf("invalid bootstrap failures '%s'", value)
+		}
+
+		failures, err := strconv.Atoi(parts[0])
+		if err != nil {
+			return 0, fmt.Errorf("invalid bootstrap failures '%s': %v", value, err)
+		}
+
+		launchID, err := n.getLaunchID(asg)
+		if err != nil {
+			return 0, err
+		}
+
+		if parts[1] != launchID {
+			return 0, nil
+		}
+
+		return failures, nil
+	}
+
+	return 0, nil
+}
+
+// SetBootstrapFailures stores the number of consecutive bootstrap failures
+// of a node pool as a tag on the ASG. The tag is removed if there are no
+// failures.
+func (n *ASGNodePoolsBackend) SetBootstrapFailures(nodePool *api.NodePool, failures int) error {
+	asg, err := n.getNodePoolASG(nodePool)
+	if err != nil {
+		return err
+	}
+
+	if failures == 0 {
+		if asgHasTag(asg, bootstrapFailuresTag) {
+			return n.deleteASGTag(asg, bootstrapFailuresTag)
+		}
+		return nil
+	}
+
+	launchID, err := n.getLaunchID(asg)
+	if err != nil {
+		return err
+	}
+
+	return n.setASGTag(asg, bootstrapFailuresTag, fmt.Sprintf("%d/%s", failures, launchID))
+}
+
+// GetRolloutProgress gets the progress of the update of a node pool stored as
+// a tag on the ASG. Like the bootstrap failures the progress is only returned
+// if it was recorded for the current configuration of the ASG.
+func (n *ASGNodePoolsBackend) GetRolloutProgress(nodePool *api.NodePool) (*RolloutProgress, error) {
+	asg, err := n.getNodePoolASG(nodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, tag := range asg.Tags {
+		if aws.StringValue(tag.Key) != rolloutProgressTag {
+			continue
+		}
+
+		value := aws.StringValue(tag.Value)
+		parts := strings.SplitN(value, "/", 3)
+		if len(parts) != 3 {
+			return nil, fmt.Errorf("invalid rollout progress '%s'", value)
+		}
+
+		launchID, err := n.getLaunchID(asg)
+		if err != nil {
+			return nil, err
+		}
+
+		if parts[2] != launchID {
+			return &RolloutProgress{}, nil
+		}
+
+		return parseRolloutProgress(parts[0] + "/" + parts[1])
+	}
+
+	return &RolloutProgress{}, nil
+}
+
+// SetRolloutProgress stores the progress of the update of a node pool as a
+// tag on the ASG. The tag is removed if nothing was checkpointed. The nodes
+// being replaced which don't fit into the tag are left out, they're cordoned
+// already and so terminated first anyway.
+func (n *ASGNodePoolsBackend) SetRolloutProgress(nodePool *api.NodePool, progress *RolloutProgress) error {
+	asg, err := n.getNodePoolASG(nodePool)
+	if err != nil {
+		return err
+	}
+
+	if progress.empty() {
+		if asgHasTag(asg, rolloutProgressTag) {
+			return n.deleteASGTag(asg, rolloutProgressTag)
+		}
+		return nil
+	}
+
+	launchID, err := n.getLaunchID(asg)
+	if err != nil {
+		return err
+	}
+
+	checkpoint := *progress
+	value := fmt.Sprintf("%s/%s", &checkpoint, launchID)
+	for len(value) > maxASGTagValueLength && len(checkpoint.Replacing) > 0 {
+		checkpoint.Replacing = checkpoint.Replacing[:len(checkpoint.Replacing)-1]
+		value = fmt.Sprintf("%s/%s", &checkpoint, launchID)
+	}
+
+	return n.setASGTag(asg, rolloutProgressTag, value)
+}
+
+// getLaunchID returns the name of the launch configuration or the ID and
+// version of the launch template used by the ASG to launch new instances.
+func (n *ASGNodePoolsBackend) getLaunchID(asg *autoscaling.Group) (string, error) {
+	if asg.LaunchTemplate == nil {
+		return aws.StringValue(asg.LaunchConfigurationName), nil
+	}
+
+	version, err := n.getLaunchTemplateVersion(asg.LaunchTemplate)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%s:%d", aws.StringValue(version.LaunchTemplateId), aws.Int64Value(version.VersionNumber)), nil
+}
+
+// setASGTag adds or updates a tag on the ASG. The tag is not propagated to
+// the instances.
+func (n *ASGNodePoolsBackend) setASGTag(asg *autoscaling.Group, key, value string) error {
+	params := &autoscaling.CreateOrUpdateTagsInput{
+		Tags: []*autoscaling.Tag{
+			{
+				Key:               aws.String(key),
+				Value:             aws.String(value),
+				ResourceId:        asg.AutoScalingGroupName,
+				ResourceType:      aws.String(asgResourceType),
+				PropagateAtLaunch: aws.Bool(false),
+			},
+		},
+	}
+
+	_, err := n.asgClient.CreateOrUpdateTags(params)
+	return err
+}
+
+// deleteASGTag deletes a tag from the ASG.
+func (n *ASGNodePoolsBackend) deleteASGTag(asg *autoscaling.Group, key string) error {
+	params := &autoscaling.DeleteTagsInput{
+		Tags: []*autoscaling.Tag{
+			{
+				Key:          aws.String(key),
+				ResourceId:   asg.AutoScalingGroupName,
+				ResourceType: aws.String(asgResourceType),
+			},
+		},
+	}
+
+	_, err := n.asgClient.DeleteTags(params)
+	return err
+}
+
+// asgHasTag returns true if the ASG has a tag with the specified key.
+func asgHasTag(asg *autoscaling.Group, key string) bool {
+	for _, tag := range asg.Tags {
+		if aws.StringValue(tag.Key) == key {
+			return true
+		}
+	}
+	return false
 }
 
 // instanceIDFromProviderID extracts the EC2 instanceID from a Kubernetes
@@ -207,6 +551,128 @@ func (n *ASGNodePoolsBackend) getNodePoolASG(nodePool *api.NodePool) (*autoscali
 	return asg, nil
 }
 
+// getAdoptedASGs returns the ASGs of the cluster adopted by the node pool.
+func (n *ASGNodePoolsBackend) getAdoptedASGs(nodePool *api.NodePool) ([]*autoscaling.Group, error) {
+	params := &autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{},
+	}
+
+	expectedTags := []*autoscaling.TagDescription{
+		{
+			Key:   aws.String(clusterIDTagPrefix + n.clusterID),
+			Value: aws.String(resourceLifecycleOwned),
+		},
+		{
+			Key:   aws.String(AdoptedASGTag),
+			Value: aws.String(nodePool.Name),
+		},
+	}
+
+	var asgs []*autoscaling.Group
+	err := n.asgClient.DescribeAutoScalingGroupsPages(params, func(resp *autoscaling.DescribeAutoScalingGroupsOutput, lastPage bool) bool {
+		for _, group := range resp.AutoScalingGroups {
+			if asgHasAllTags(expectedTags, group.Tags) {
+				asgs = append(asgs, group)
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return asgs, nil
+}
+
+// getProfileOutdatedInstances returns the instances of the ASG which were
+// launched before the profile of its node pool was changed, as recorded by
+// the ProfileChangedTag of the ASG.
+func (n *ASGNodePoolsBackend) getProfileOutdatedInstances(asg *autoscaling.Group) (map[string]bool, error) {
+	outdated := make(map[string]bool)
+
+	var changed time.Time
+	for _, tag := range asg.Tags {
+		if aws.StringValue(tag.Key) != ProfileChangedTag {
+			continue
+		}
+
+		value := aws.StringValue(tag.Value)
+		var err error
+		changed, err = time.Parse(time.RFC3339, value)
+		if err != nil {
+			return nil, fmt.Errorf("invalid profile change time '%s': %v", value, err)
+		}
+	}
+
+	if changed.IsZero() || len(asg.Instances) == 0 {
+		return outdated, nil
+	}
+
+	instanceIds := make([]*string, 0, len(asg.Instances))
+	for _, instance := range asg.Instances {
+		instanceIds = append(instanceIds, instance.InstanceId)
+	}
+
+	params := &ec2.DescribeInstancesInput{
+		InstanceIds: instanceIds,
+	}
+
+	err := n.ec2Client.DescribeInstancesPages(params, func(resp *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, reservation := range resp.Reservations {
+			for _, instance := range reservation.Instances {
+				if instance.LaunchTime != nil && instance.LaunchTime.Before(changed) {
+					outdated[aws.StringValue(instance.InstanceId)] = true
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return outdated, nil
+}
+
+// getStoppedInstances returns the instances of the ASG which are stopped or
+// being stopped, e.g. by manual experiments.
+func (n *ASGNodePoolsBackend) getStoppedInstances(asg *autoscaling.Group) (map[string]bool, error) {
+	stopped := make(map[string]bool)
+	if len(asg.Instances) == 0 {
+		return stopped, nil
+	}
+
+	instanceIds := make([]*string, 0, len(asg.Instances))
+	for _, instance := range asg.Instances {
+		instanceIds = append(instanceIds, instance.InstanceId)
+	}
+
+	params := &ec2.DescribeInstancesInput{
+		InstanceIds: instanceIds,
+	}
+
+	err := n.ec2Client.DescribeInstancesPages(params, func(resp *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, reservation := range resp.Reservations {
+			for _, instance := range reservation.Instances {
+				if instance.State == nil {
+					continue
+				}
+
+				switch aws.StringValue(instance.State.Name) {
+				case ec2.InstanceStateNameStopping, ec2.InstanceStateNameStopped:
+					stopped[aws.StringValue(instance.InstanceId)] = true
+				}
+			}
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return stopped, nil
+}
+
 // getLaunchConfiguration gets the launch configuration of an ASG.
 func (n *ASGNodePoolsBackend) getLaunchConfiguration(asg *autoscaling.Group) (*autoscaling.LaunchConfiguration, error) {
 	params := &autoscaling.DescribeLaunchConfigurationsInput{
@@ -231,6 +697,10 @@ func (n *ASGNodePoolsBackend) getLaunchConfiguration(asg *autoscaling.Group) (*a
 
 // getInstancesToUpdate returns a list of instances with outdated userData.
 func (n *ASGNodePoolsBackend) getInstancesToUpdate(asg *autoscaling.Group) (map[string]bool, error) {
+	if asg.LaunchTemplate != nil {
+		return n.getLaunchTemplateInstancesToUpdate(asg)
+	}
+
 	launchConfig, err := n.getLaunchConfiguration(asg)
 	if err != nil {
 		return nil, err
@@ -293,18 +763,106 @@ func (n *ASGNodePoolsBackend) getInstancesToUpdate(asg *autoscaling.Group) (map[
 			instanceSpotPrice = spotPriceResp.SpotInstanceRequests[0].SpotPrice
 		}
 
-		spotPricesMatch, err := compareSpotPrices(launchConfig.SpotPrice, instanceSpotPrice)
+		spotPriceChange, err := classifySpotPriceChange(instanceSpotPrice, launchConfig.SpotPrice)
 		if err != nil {
 			return nil, err
 		}
 
 		// an instance is considered old when userdata, instance type
 		// or AMI does not match what is in the Launch Configuration
-		// for the ASG.
+		// for the ASG, or it switches between spot and on-demand. A
+		// different max price doesn't affect running spot instances.
 		if aws.StringValue(userDataResp.UserData.Value) != aws.StringValue(launchConfig.UserData) ||
 			aws.StringValue(instanceTypeResp.InstanceType.Value) != aws.StringValue(launchConfig.InstanceType) ||
 			instancesAMIs[aws.StringValue(instance.InstanceId)] != aws.StringValue(launchConfig.ImageId) ||
-			!spotPricesMatch {
+			spotPriceChange == changeDisruptive {
+			oldInstances[aws.StringValue(instance.InstanceId)] = true
+		}
+	}
+
+	return oldInstances, nil
+}
+
+// launchTemplateVersionsInput returns the input describing the versions of the
+// launch template of a launch template specification. The specifications of
+// ASGs include both the ID and the name of the launch template, while EC2 only
+// accepts one of them, so the name is only used without an ID.
+func launchTemplateVersionsInput(spec *autoscaling.LaunchTemplateSpecification) *ec2.DescribeLaunchTemplateVersionsInput {
+	if aws.StringValue(spec.LaunchTemplateId) != "" {
+		return &ec2.DescribeLaunchTemplateVersionsInput{LaunchTemplateId: spec.LaunchTemplateId}
+	}
+	return &ec2.DescribeLaunchTemplateVersionsInput{LaunchTemplateName: spec.LaunchTemplateName}
+}
+
+// getLaunchTemplateVersion gets the launch template version referenced by a
+// launch template specification. Versions like '$Latest' or '$Default' are
+// resolved to the actual version.
+func (n *ASGNodePoolsBackend) getLaunchTemplateVersion(spec *autoscaling.LaunchTemplateSpecification) (*ec2.LaunchTemplateVersion, error) {
+	version := aws.StringValue(spec.Version)
+	if version == "" {
+		version = launchTemplateVersionDefault
+	}
+
+	params := launchTemplateVersionsInput(spec)
+	params.Versions = []*string{aws.String(version)}
+
+	resp, err := n.ec2Client.DescribeLaunchTemplateVersions(params)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.LaunchTemplateVersions) != 1 {
+		return nil, fmt.Errorf("expected 1 launch template version, got %d", len(resp.LaunchTemplateVersions))
+	}
+
+	return resp.LaunchTemplateVersions[0], nil
+}
+
+// getLaunchTemplateInstancesToUpdate returns a list of instances which were
+// not launched from the launch template version currently configured for the
+// ASG. Instances launched from another version of the launch template are
+// only returned if the versions differ in a disruptive way.
+func (n *ASGNodePoolsBackend) getLaunchTemplateInstancesToUpdate(asg *autoscaling.Group) (map[string]bool, error) {
+	launchTemplateVersion, err := n.getLaunchTemplateVersion(asg.LaunchTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	version := strconv.FormatInt(aws.Int64Value(launchTemplateVersion.VersionNumber), 10)
+
+	oldInstances := make(map[string]bool)
+	changes := make(map[string]changeClass)
+
+	for _, instance := range asg.Instances {
+		// an instance is considered old when it was launched from a
+		// launch configuration or a different launch template.
+		launchTemplate := instance.LaunchTemplate
+		if launchTemplate == nil ||
+			aws.StringValue(launchTemplate.LaunchTemplateId) != aws.StringValue(launchTemplateVersion.LaunchTemplateId) {
+			oldInstances[aws.StringValue(instance.InstanceId)] = true
+			continue
+		}
+
+		instanceVersion := aws.StringValue(launchTemplate.Version)
+		if instanceVersion == version {
+			continue
+		}
+
+		// the versions are only described once per version.
+		change, ok := changes[instanceVersion]
+		if !ok {
+			oldVersion, err := n.getLaunchTemplateVersion(launchTemplate)
+			if err != nil {
+				return nil, err
+			}
+			change, err = classifyLaunchTemplateChange(oldVersion.LaunchTemplateData, launchTemplateVersion.LaunchTemplateData)
+			if err != nil {
+				return nil, err
+			}
+			changes[instanceVersion] = change
+		}
+
+		if change == changeDisruptive {
 			oldInstances[aws.StringValue(instance.InstanceId)] = true
 		}
 	}
@@ -2,7 +2,10 @@ package updatestrategy
 
 import (
 	"errors"
+	"fmt"
+	"strings"
 	"testing"
+	"time"
 
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 
@@ -18,10 +21,17 @@ import (
 
 type mockASGAPI struct {
 	autoscalingiface.AutoScalingAPI
-	err    error
-	asgs   []*autoscaling.Group
-	descLC *autoscaling.DescribeLaunchConfigurationsOutput
-	descLB *autoscaling.DescribeLoadBalancersOutput
+	err         error
+	asgs        []*autoscaling.Group
+	descLC      *autoscaling.DescribeLaunchConfigurationsOutput
+	descLB      *autoscaling.DescribeLoadBalancersOutput
+	tagsSet     []*autoscaling.Tag
+	tagsDeleted []*autoscaling.Tag
+	updated     *autoscaling.UpdateAutoScalingGroupInput
+	terminated  *autoscaling.TerminateInstanceInAutoScalingGroupInput
+	instances   []*autoscaling.InstanceDetails
+	hooks       []*autoscaling.LifecycleHook
+	completed   []*autoscaling.CompleteLifecycleActionInput
 }
 
 func (a *mockASGAPI) DescribeAutoScalingGroupsPages(input *autoscaling.DescribeAutoScalingGroupsInput, fn func(*autoscaling.DescribeAutoScalingGroupsOutput, bool) bool) error {
@@ -35,10 +45,22 @@ func (a *mockASGAPI) DescribeLaunchConfigurations(input *autoscaling.DescribeLau
 }
 
 func (a *mockASGAPI) UpdateAutoScalingGroup(input *autoscaling.UpdateAutoScalingGroupInput) (*autoscaling.UpdateAutoScalingGroupOutput, error) {
+	a.updated = input
 	return nil, a.err
 }
 
-func (a *mockASGAPI) TerminateInstanceInAutoScalingGroup(*autoscaling.TerminateInstanceInAutoScalingGroupInput) (*autoscaling.TerminateInstanceInAutoScalingGroupOutput, error) {
+func (a *mockASGAPI) TerminateInstanceInAutoScalingGroup(input *autoscaling.TerminateInstanceInAutoScalingGroupInput) (*autoscaling.TerminateInstanceInAutoScalingGroupOutput, error) {
+	a.terminated = input
+	return nil, a.err
+}
+
+func (a *mockASGAPI) CreateOrUpdateTags(input *autoscaling.CreateOrUpdateTagsInput) (*autoscaling.CreateOrUpdateTagsOutput, error) {
+	a.tagsSet = input.Tags
+	return nil, a.err
+}
+
+func (a *mockASGAPI) DeleteTags(input *autoscaling.DeleteTagsInput) (*autoscaling.DeleteTagsOutput, error) {
+	a.tagsDeleted = input.Tags
 	return nil, a.err
 }
 
@@ -46,6 +68,19 @@ func (a *mockASGAPI) DescribeLoadBalancers(input *autoscaling.DescribeLoadBalanc
 	return a.descLB, a.err
 }
 
+func (a *mockASGAPI) DescribeAutoScalingInstances(input *autoscaling.DescribeAutoScalingInstancesInput) (*autoscaling.DescribeAutoScalingInstancesOutput, error) {
+	return &autoscaling.DescribeAutoScalingInstancesOutput{AutoScalingInstances: a.instances}, nil
+}
+
+func (a *mockASGAPI) DescribeLifecycleHooks(input *autoscaling.DescribeLifecycleHooksInput) (*autoscaling.DescribeLifecycleHooksOutput, error) {
+	return &autoscaling.DescribeLifecycleHooksOutput{LifecycleHooks: a.hooks}, nil
+}
+
+func (a *mockASGAPI) CompleteLifecycleAction(input *autoscaling.CompleteLifecycleActionInput) (*autoscaling.CompleteLifecycleActionOutput, error) {
+	a.completed = append(a.completed, input)
+	return &autoscaling.CompleteLifecycleActionOutput{}, nil
+}
+
 type mockEC2API struct {
 	ec2iface.EC2API
 	err        error
@@ -53,6 +88,11 @@ type mockEC2API struct {
 	descStatus *ec2.DescribeInstanceStatusOutput
 	descSpot   *ec2.DescribeSpotInstanceRequestsOutput
 	descInsts  *ec2.DescribeInstancesOutput
+	descLTV    *ec2.DescribeLaunchTemplateVersionsOutput
+	// descLTVs are returned instead of descLTV for the versions they
+	// contain.
+	descLTVs   map[string]*ec2.DescribeLaunchTemplateVersionsOutput
+	terminated []string
 }
 
 func (e *mockEC2API) DescribeInstanceAttribute(input *ec2.DescribeInstanceAttributeInput) (*ec2.DescribeInstanceAttributeOutput, error) {
@@ -68,6 +108,23 @@ func (e *mockEC2API) DescribeInstancesPages(input *ec2.DescribeInstancesInput, f
 	return e.err
 }
 
+func (e *mockEC2API) DescribeLaunchTemplateVersions(input *ec2.DescribeLaunchTemplateVersionsInput) (*ec2.DescribeLaunchTemplateVersionsOutput, error) {
+	if input.LaunchTemplateId != nil && input.LaunchTemplateName != nil {
+		return nil, errors.New("either the launch template ID or name must be specified")
+	}
+	if len(input.Versions) == 1 {
+		if output, ok := e.descLTVs[aws.StringValue(input.Versions[0])]; ok {
+			return output, e.err
+		}
+	}
+	return e.descLTV, e.err
+}
+
+func (e *mockEC2API) TerminateInstances(input *ec2.TerminateInstancesInput) (*ec2.TerminateInstancesOutput, error) {
+	e.terminated = append(e.terminated, aws.StringValueSlice(input.InstanceIds)...)
+	return &ec2.TerminateInstancesOutput{}, e.err
+}
+
 func (e *mockEC2API) DescribeInstanceStatus(input *ec2.DescribeInstanceStatusInput) (*ec2.DescribeInstanceStatusOutput, error) {
 	return e.descStatus, e.err
 }
@@ -307,6 +364,40 @@ func TestScale(t *testing.T) {
 	assert.Error(t, err)
 }
 
+func TestScaleToZero(t *testing.T) {
+	asg := &autoscaling.Group{
+		AutoScalingGroupName: aws.String("asg"),
+		DesiredCapacity:      aws.Int64(3),
+		Tags: []*autoscaling.TagDescription{
+			{Key: aws.String(clusterIDTagPrefix), Value: aws.String(resourceLifecycleOwned)},
+			{Key: aws.String(nodePoolTag), Value: aws.String("test")},
+		},
+	}
+	asgClient := &mockASGAPI{asgs: []*autoscaling.Group{asg}}
+	backend := &ASGNodePoolsBackend{asgClient: asgClient}
+
+	// test desired capacity is stored before scaling to zero
+	err := backend.Scale(&api.NodePool{Name: "test"}, 0)
+	assert.NoError(t, err)
+	assert.Len(t, asgClient.tagsSet, 1)
+	assert.Equal(t, PreScaleDesiredCapacityTag, aws.StringValue(asgClient.tagsSet[0].Key))
+	assert.Equal(t, "3", aws.StringValue(asgClient.tagsSet[0].Value))
+
+	// test stored desired capacity is not overwritten when retried
+	asgClient.tagsSet = nil
+	asg.DesiredCapacity = aws.Int64(0)
+	asg.Tags = append(asg.Tags, &autoscaling.TagDescription{Key: aws.String(PreScaleDesiredCapacityTag), Value: aws.String("3")})
+	err = backend.Scale(&api.NodePool{Name: "test"}, 0)
+	assert.NoError(t, err)
+	assert.Nil(t, asgClient.tagsSet)
+
+	// test stored desired capacity is removed when scaling up
+	err = backend.Scale(&api.NodePool{Name: "test"}, 3)
+	assert.NoError(t, err)
+	assert.Len(t, asgClient.tagsDeleted, 1)
+	assert.Equal(t, PreScaleDesiredCapacityTag, aws.StringValue(asgClient.tagsDeleted[0].Key))
+}
+
 func TestTerminate(t *testing.T) {
 	// test success
 	backend := &ASGNodePoolsBackend{
@@ -339,6 +430,166 @@ func TestTerminate(t *testing.T) {
 	}
 	err = backend.Terminate(&Node{}, true)
 	assert.NoError(t, err)
+
+	// test stopped instances are terminated explicitly
+	ec2Client := &mockEC2API{descStatus: &ec2.DescribeInstanceStatusOutput{
+		InstanceStatuses: []*ec2.InstanceStatus{
+			{
+				InstanceState: &ec2.InstanceState{
+					Code: aws.Int64(80),
+					Name: aws.String(ec2.InstanceStateNameStopped),
+				},
+			},
+		},
+	}}
+	backend = &ASGNodePoolsBackend{
+		asgClient: &mockASGAPI{err: errors.New("stopped")},
+		ec2Client: ec2Client,
+	}
+	err = backend.Terminate(&Node{ProviderID: "aws:///eu-central-1a/i-abc", FailureDomain: "eu-central-1a"}, true)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"i-abc"}, ec2Client.terminated)
+}
+
+func TestTerminateCompletesLifecycleHooks(t *testing.T) {
+	node := &Node{ProviderID: "aws:///eu-central-1a/i-abc", FailureDomain: "eu-central-1a"}
+	asgClient := &mockASGAPI{
+		instances: []*autoscaling.InstanceDetails{
+			{
+				AutoScalingGroupName: aws.String("asg"),
+				InstanceId:           aws.String("i-abc"),
+				LifecycleState:       aws.String(autoscaling.LifecycleStateTerminatingWait),
+			},
+		},
+		hooks: []*autoscaling.LifecycleHook{
+			{LifecycleHookName: aws.String("launch"), LifecycleTransition: aws.String("autoscaling:EC2_INSTANCE_LAUNCHING")},
+			{LifecycleHookName: aws.String("flush-logs"), LifecycleTransition: aws.String(lifecycleTransitionTerminating)},
+		},
+	}
+	backend := &ASGNodePoolsBackend{asgClient: asgClient}
+
+	err := backend.Terminate(node, false)
+	assert.NoError(t, err)
+	assert.Len(t, asgClient.completed, 1)
+	assert.Equal(t, "asg", aws.StringValue(asgClient.completed[0].AutoScalingGroupName))
+	assert.Equal(t, "i-abc", aws.StringValue(asgClient.completed[0].InstanceId))
+	assert.Equal(t, "flush-logs", aws.StringValue(asgClient.completed[0].LifecycleHookName))
+	assert.Equal(t, lifecycleActionResultContinue, aws.StringValue(asgClient.completed[0].LifecycleActionResult))
+
+	// hooks already completed by the shutdown tooling are left alone.
+	asgClient.completed = nil
+	asgClient.instances[0].LifecycleState = aws.String(autoscaling.LifecycleStateTerminatingProceed)
+	err = backend.Terminate(node, false)
+	assert.NoError(t, err)
+	assert.Empty(t, asgClient.completed)
+
+	// ASGs without terminate hooks don't wait for the instance.
+	asgClient.hooks = asgClient.hooks[:1]
+	asgClient.instances[0].LifecycleState = aws.String(autoscaling.LifecycleStateInService)
+	err = backend.Terminate(node, false)
+	assert.NoError(t, err)
+	assert.Empty(t, asgClient.completed)
+}
+
+func TestAdoptedASGs(t *testing.T) {
+	asgClient := &mockASGAPI{
+		asgs: []*autoscaling.Group{
+			{
+				AutoScalingGroupName: aws.String("node-pool"),
+				DesiredCapacity:      aws.Int64(2),
+				Tags: []*autoscaling.TagDescription{
+					{Key: aws.String(clusterIDTagPrefix), Value: aws.String(resourceLifecycleOwned)},
+					{Key: aws.String(nodePoolTag), Value: aws.String("test")},
+				},
+			},
+			{
+				AutoScalingGroupName: aws.String("legacy"),
+				DesiredCapacity:      aws.Int64(3),
+				Tags: []*autoscaling.TagDescription{
+					{Key: aws.String(clusterIDTagPrefix), Value: aws.String(resourceLifecycleOwned)},
+					{Key: aws.String(AdoptedASGTag), Value: aws.String("test")},
+				},
+				Instances: []*autoscaling.Instance{
+					{
+						InstanceId:       aws.String("i-legacy"),
+						AvailabilityZone: aws.String("eu-central-1a"),
+						HealthStatus:     aws.String(instanceHealthStatusHealthy),
+						LifecycleState:   aws.String(autoscaling.LifecycleStateInService),
+					},
+				},
+			},
+			{
+				AutoScalingGroupName: aws.String("other"),
+				DesiredCapacity:      aws.Int64(5),
+				Tags: []*autoscaling.TagDescription{
+					{Key: aws.String(clusterIDTagPrefix), Value: aws.String(resourceLifecycleOwned)},
+					{Key: aws.String(AdoptedASGTag), Value: aws.String("other")},
+				},
+			},
+		},
+		descLC: &autoscaling.DescribeLaunchConfigurationsOutput{
+			LaunchConfigurations: []*autoscaling.LaunchConfiguration{{}},
+		},
+		descLB: &autoscaling.DescribeLoadBalancersOutput{},
+	}
+	backend := &ASGNodePoolsBackend{
+		asgClient: asgClient,
+		ec2Client: &mockEC2API{descInsts: &ec2.DescribeInstancesOutput{}},
+	}
+	nodePool := &api.NodePool{Name: "test"}
+
+	// the nodes of adopted ASGs are outdated nodes of the node pool.
+	pool, err := backend.Get(nodePool)
+	assert.NoError(t, err)
+	assert.Equal(t, 5, pool.Desired)
+	assert.Len(t, pool.Nodes, 1)
+	assert.Equal(t, "aws:///eu-central-1a/i-legacy", pool.Nodes[0].ProviderID)
+	assert.Equal(t, outdatedNodeGeneration, pool.Nodes[0].Generation)
+	assert.True(t, pool.Nodes[0].Ready)
+	assert.True(t, pool.Nodes[0].Adopted)
+
+	// only the ASG of the node pool is scaled.
+	err = backend.Scale(nodePool, 6)
+	assert.NoError(t, err)
+	assert.Equal(t, "node-pool", aws.StringValue(asgClient.updated.AutoScalingGroupName))
+	assert.EqualValues(t, 3, aws.Int64Value(asgClient.updated.DesiredCapacity))
+
+	// adopted nodes are never replaced.
+	err = backend.Terminate(pool.Nodes[0], false)
+	assert.NoError(t, err)
+	assert.Equal(t, "i-legacy", aws.StringValue(asgClient.terminated.InstanceId))
+	assert.True(t, aws.BoolValue(asgClient.terminated.ShouldDecrementDesiredCapacity))
+}
+
+func TestDrainStats(t *testing.T) {
+	asg := &autoscaling.Group{
+		AutoScalingGroupName: aws.String("asg"),
+		Tags: []*autoscaling.TagDescription{
+			{Key: aws.String(clusterIDTagPrefix), Value: aws.String(resourceLifecycleOwned)},
+			{Key: aws.String(nodePoolTag), Value: aws.String("test")},
+		},
+	}
+	asgClient := &mockASGAPI{asgs: []*autoscaling.Group{asg}}
+	backend := &ASGNodePoolsBackend{asgClient: asgClient}
+
+	// test empty stats when the ASG has no drain stats tag
+	stats, err := backend.GetDrainStats(&api.NodePool{Name: "test"})
+	assert.NoError(t, err)
+	assert.Equal(t, &DrainStats{}, stats)
+
+	// test storing stats as tag
+	err = backend.SetDrainStats(&api.NodePool{Name: "test"}, &DrainStats{Samples: 2, Average: time.Minute})
+	assert.NoError(t, err)
+	assert.Len(t, asgClient.tagsSet, 1)
+	assert.Equal(t, drainStatsTag, aws.StringValue(asgClient.tagsSet[0].Key))
+	assert.Equal(t, "2/1m0s", aws.StringValue(asgClient.tagsSet[0].Value))
+	assert.Equal(t, "asg", aws.StringValue(asgClient.tagsSet[0].ResourceId))
+
+	// test reading stats from tag
+	asg.Tags = append(asg.Tags, &autoscaling.TagDescription{Key: asgClient.tagsSet[0].Key, Value: asgClient.tagsSet[0].Value})
+	stats, err = backend.GetDrainStats(&api.NodePool{Name: "test"})
+	assert.NoError(t, err)
+	assert.Equal(t, &DrainStats{Samples: 2, Average: time.Minute}, stats)
 }
 
 func TestAsgHasAllTags(t *testing.T) {
@@ -378,3 +629,286 @@ func TestInstanceIDFromProviderID(t *testing.T) {
 	invalidFormat := "aws:///i-abc"
 	assert.Equal(t, invalidFormat, instanceIDFromProviderID(invalidFormat, az))
 }
+
+func TestGetLaunchTemplateInstancesToUpdate(t *testing.T) {
+	asg := &autoscaling.Group{
+		LaunchTemplate: &autoscaling.LaunchTemplateSpecification{
+			LaunchTemplateId:   aws.String("lt-1"),
+			LaunchTemplateName: aws.String("stack-1"),
+			Version:            aws.String("$Latest"),
+		},
+		Instances: []*autoscaling.Instance{
+			{
+				InstanceId: aws.String("current"),
+				LaunchTemplate: &autoscaling.LaunchTemplateSpecification{
+					LaunchTemplateId: aws.String("lt-1"),
+					Version:          aws.String("2"),
+				},
+			},
+			{
+				InstanceId: aws.String("old-version"),
+				LaunchTemplate: &autoscaling.LaunchTemplateSpecification{
+					LaunchTemplateId: aws.String("lt-1"),
+					Version:          aws.String("1"),
+				},
+			},
+			{
+				InstanceId: aws.String("max-price"),
+				LaunchTemplate: &autoscaling.LaunchTemplateSpecification{
+					LaunchTemplateId: aws.String("lt-1"),
+					Version:          aws.String("3"),
+				},
+			},
+			{
+				InstanceId: aws.String("other-template"),
+				LaunchTemplate: &autoscaling.LaunchTemplateSpecification{
+					LaunchTemplateId: aws.String("lt-2"),
+					Version:          aws.String("2"),
+				},
+			},
+			{
+				InstanceId: aws.String("launch-configuration"),
+			},
+		},
+	}
+
+	spotData := func(imageID, maxPrice string) *ec2.ResponseLaunchTemplateData {
+		return &ec2.ResponseLaunchTemplateData{
+			ImageId: aws.String(imageID),
+			InstanceMarketOptions: &ec2.LaunchTemplateInstanceMarketOptions{
+				MarketType:  aws.String(ec2.MarketTypeSpot),
+				SpotOptions: &ec2.LaunchTemplateSpotMarketOptions{MaxPrice: aws.String(maxPrice)},
+			},
+		}
+	}
+	launchTemplateVersion := func(version int64, data *ec2.ResponseLaunchTemplateData) *ec2.DescribeLaunchTemplateVersionsOutput {
+		return &ec2.DescribeLaunchTemplateVersionsOutput{
+			LaunchTemplateVersions: []*ec2.LaunchTemplateVersion{
+				{
+					LaunchTemplateId:   aws.String("lt-1"),
+					VersionNumber:      aws.Int64(version),
+					LaunchTemplateData: data,
+				},
+			},
+		}
+	}
+
+	backend := &ASGNodePoolsBackend{
+		ec2Client: &mockEC2API{
+			descLTV: launchTemplateVersion(2, spotData("ami-2", "0.2")),
+			descLTVs: map[string]*ec2.DescribeLaunchTemplateVersionsOutput{
+				"1": launchTemplateVersion(1, spotData("ami-1", "0.2")),
+				"3": launchTemplateVersion(3, spotData("ami-2", "0.1")),
+			},
+		},
+	}
+
+	oldInstances, err := backend.getInstancesToUpdate(asg)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{
+		"old-version":          true,
+		"other-template":       true,
+		"launch-configuration": true,
+	}, oldInstances)
+
+	backend.ec2Client = &mockEC2API{descLTV: &ec2.DescribeLaunchTemplateVersionsOutput{}}
+	_, err = backend.getInstancesToUpdate(asg)
+	assert.Error(t, err)
+}
+
+func TestLaunchTemplateVersionsInput(t *testing.T) {
+	input := launchTemplateVersionsInput(&autoscaling.LaunchTemplateSpecification{
+		LaunchTemplateId:   aws.String("lt-1"),
+		LaunchTemplateName: aws.String("stack-1"),
+	})
+	assert.Equal(t, "lt-1", aws.StringValue(input.LaunchTemplateId))
+	assert.Nil(t, input.LaunchTemplateName)
+
+	input = launchTemplateVersionsInput(&autoscaling.LaunchTemplateSpecification{
+		LaunchTemplateName: aws.String("stack-1"),
+	})
+	assert.Nil(t, input.LaunchTemplateId)
+	assert.Equal(t, "stack-1", aws.StringValue(input.LaunchTemplateName))
+}
+
+func TestGetProfileOutdatedInstances(t *testing.T) {
+	changed := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	asg := &autoscaling.Group{
+		Instances: []*autoscaling.Instance{
+			{InstanceId: aws.String("old")},
+			{InstanceId: aws.String("new")},
+		},
+	}
+
+	backend := &ASGNodePoolsBackend{
+		ec2Client: &mockEC2API{
+			descInsts: &ec2.DescribeInstancesOutput{
+				Reservations: []*ec2.Reservation{
+					{
+						Instances: []*ec2.Instance{
+							{
+								InstanceId: aws.String("old"),
+								LaunchTime: aws.Time(changed.Add(-time.Hour)),
+							},
+							{
+								InstanceId: aws.String("new"),
+								LaunchTime: aws.Time(changed.Add(time.Minute)),
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	// without a profile change no instances are outdated
+	outdated, err := backend.getProfileOutdatedInstances(asg)
+	assert.NoError(t, err)
+	assert.Empty(t, outdated)
+
+	asg.Tags = []*autoscaling.TagDescription{
+		{Key: aws.String(ProfileChangedTag), Value: aws.String(changed.Format(time.RFC3339))},
+	}
+	outdated, err = backend.getProfileOutdatedInstances(asg)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"old": true}, outdated)
+
+	asg.Tags[0].Value = aws.String("invalid")
+	_, err = backend.getProfileOutdatedInstances(asg)
+	assert.Error(t, err)
+}
+
+func TestBootstrapFailuresTag(t *testing.T) {
+	asg := &autoscaling.Group{
+		AutoScalingGroupName:    aws.String("asg"),
+		LaunchConfigurationName: aws.String("lc-1"),
+		Tags: []*autoscaling.TagDescription{
+			{Key: aws.String(clusterIDTagPrefix), Value: aws.String(resourceLifecycleOwned)},
+			{Key: aws.String(nodePoolTag), Value: aws.String("test")},
+		},
+	}
+	asgClient := &mockASGAPI{asgs: []*autoscaling.Group{asg}}
+	backend := &ASGNodePoolsBackend{asgClient: asgClient}
+	nodePool := &api.NodePool{Name: "test"}
+
+	failures, err := backend.GetBootstrapFailures(nodePool)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, failures)
+
+	err = backend.SetBootstrapFailures(nodePool, 2)
+	assert.NoError(t, err)
+	assert.Len(t, asgClient.tagsSet, 1)
+	assert.Equal(t, bootstrapFailuresTag, aws.StringValue(asgClient.tagsSet[0].Key))
+	assert.Equal(t, "2/lc-1", aws.StringValue(asgClient.tagsSet[0].Value))
+
+	asg.Tags = append(asg.Tags, &autoscaling.TagDescription{Key: asgClient.tagsSet[0].Key, Value: asgClient.tagsSet[0].Value})
+	failures, err = backend.GetBootstrapFailures(nodePool)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, failures)
+
+	// failures of a previous launch configuration are ignored
+	asg.LaunchConfigurationName = aws.String("lc-2")
+	failures, err = backend.GetBootstrapFailures(nodePool)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, failures)
+
+	// resetting the failures removes the tag
+	err = backend.SetBootstrapFailures(nodePool, 0)
+	assert.NoError(t, err)
+	assert.Len(t, asgClient.tagsDeleted, 1)
+	assert.Equal(t, bootstrapFailuresTag, aws.StringValue(asgClient.tagsDeleted[0].Key))
+}
+
+func TestRolloutProgressTag(t *testing.T) {
+	asg := &autoscaling.Group{
+		AutoScalingGroupName:    aws.String("asg"),
+		LaunchConfigurationName: aws.String("lc-1"),
+		Tags: []*autoscaling.TagDescription{
+			{Key: aws.String(clusterIDTagPrefix), Value: aws.String(resourceLifecycleOwned)},
+			{Key: aws.String(nodePoolTag), Value: aws.String("test")},
+		},
+	}
+	asgClient := &mockASGAPI{asgs: []*autoscaling.Group{asg}}
+	backend := &ASGNodePoolsBackend{asgClient: asgClient}
+	nodePool := &api.NodePool{Name: "test"}
+
+	progress, err := backend.GetRolloutProgress(nodePool)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, progress.Replaced)
+
+	startedAt := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	err = backend.SetRolloutProgress(nodePool, &RolloutProgress{Replaced: 10, StartedAt: startedAt})
+	assert.NoError(t, err)
+	assert.Len(t, asgClient.tagsSet, 1)
+	assert.Equal(t, rolloutProgressTag, aws.StringValue(asgClient.tagsSet[0].Key))
+	assert.Equal(t, "10/2018-06-01T12:00:00Z/lc-1", aws.StringValue(asgClient.tagsSet[0].Value))
+
+	asg.Tags = append(asg.Tags, &autoscaling.TagDescription{Key: asgClient.tagsSet[0].Key, Value: asgClient.tagsSet[0].Value})
+	progress, err = backend.GetRolloutProgress(nodePool)
+	assert.NoError(t, err)
+	assert.Equal(t, &RolloutProgress{Replaced: 10, StartedAt: startedAt}, progress)
+
+	// nodes being replaced which don't fit into the tag are left out
+	replacing := make([]string, 20)
+	for i := range replacing {
+		replacing[i] = fmt.Sprintf("i-%017d", i)
+	}
+	err = backend.SetRolloutProgress(nodePool, &RolloutProgress{Replaced: 10, StartedAt: startedAt, CanaryPassed: true, Replacing: replacing})
+	assert.NoError(t, err)
+	assert.Len(t, asgClient.tagsSet, 1)
+	value := aws.StringValue(asgClient.tagsSet[0].Value)
+	assert.True(t, len(value) <= maxASGTagValueLength, value)
+	assert.True(t, strings.HasPrefix(value, "10/2018-06-01T12:00:00Z canary replacing=i-00000000000000000,"), value)
+	assert.True(t, strings.HasSuffix(value, "/lc-1"), value)
+
+	// the progress of a previous launch configuration is ignored
+	asg.LaunchConfigurationName = aws.String("lc-2")
+	progress, err = backend.GetRolloutProgress(nodePool)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, progress.Replaced)
+
+	// resetting the progress removes the tag
+	err = backend.SetRolloutProgress(nodePool, &RolloutProgress{})
+	assert.NoError(t, err)
+	assert.Len(t, asgClient.tagsDeleted, 1)
+	assert.Equal(t, rolloutProgressTag, aws.StringValue(asgClient.tagsDeleted[0].Key))
+}
+
+func TestGetStoppedInstances(t *testing.T) {
+	asg := &autoscaling.Group{
+		Instances: []*autoscaling.Instance{
+			{InstanceId: aws.String("running")},
+			{InstanceId: aws.String("stopped")},
+			{InstanceId: aws.String("stopping")},
+		},
+	}
+
+	backend := &ASGNodePoolsBackend{
+		ec2Client: &mockEC2API{
+			descInsts: &ec2.DescribeInstancesOutput{
+				Reservations: []*ec2.Reservation{
+					{
+						Instances: []*ec2.Instance{
+							{
+								InstanceId: aws.String("running"),
+								State:      &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameRunning)},
+							},
+							{
+								InstanceId: aws.String("stopped"),
+								State:      &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameStopped)},
+							},
+							{
+								InstanceId: aws.String("stopping"),
+								State:      &ec2.InstanceState{Name: aws.String(ec2.InstanceStateNameStopping)},
+							},
+						},
+					},
+				},
+			},
+		},
+	}
+
+	stopped, err := backend.getStoppedInstances(asg)
+	assert.NoError(t, err)
+	assert.Equal(t, map[string]bool{"stopped": true, "stopping": true}, stopped)
+}
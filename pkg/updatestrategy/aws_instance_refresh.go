@@ -0,0 +1,175 @@
+package updatestrategy
+
+import (
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// The operations of the Instance Refresh API are missing from the vendored
+// AWS SDK, so they're defined here and sent with the autoscalingQueryClient.
+// The shapes only contain the fields used.
+
+type instanceRefreshPreferences struct {
+	_                     struct{} `type:"structure"`
+	CheckpointDelay       *int64   `type:"integer"`
+	CheckpointPercentages []*int64 `type:"list"`
+	InstanceWarmup        *int64   `type:"integer"`
+	MinHealthyPercentage  *int64   `type:"integer"`
+}
+
+type startInstanceRefreshInput struct {
+	_                    struct{}                    `type:"structure"`
+	AutoScalingGroupName *string                     `min:"1" type:"string" required:"true"`
+	Preferences          *instanceRefreshPreferences `type:"structure"`
+	Strategy             *string                     `type:"string"`
+}
+
+type startInstanceRefreshOutput struct {
+	_                 struct{} `type:"structure"`
+	InstanceRefreshId *string  `min:"1" type:"string"`
+}
+
+type describeInstanceRefreshesInput struct {
+	_                    struct{} `type:"structure"`
+	AutoScalingGroupName *string  `min:"1" type:"string" required:"true"`
+	MaxRecords           *int64   `type:"integer"`
+}
+
+type instanceRefreshDescription struct {
+	_                  struct{} `type:"structure"`
+	InstanceRefreshId  *string  `min:"1" type:"string"`
+	Status             *string  `type:"string"`
+	StatusReason       *string  `type:"string"`
+	PercentageComplete *int64   `type:"integer"`
+	InstancesToUpdate  *int64   `type:"integer"`
+}
+
+type describeInstanceRefreshesOutput struct {
+	_                 struct{}                      `type:"structure"`
+	InstanceRefreshes []*instanceRefreshDescription `type:"list"`
+}
+
+type cancelInstanceRefreshInput struct {
+	_                    struct{} `type:"structure"`
+	AutoScalingGroupName *string  `min:"1" type:"string" required:"true"`
+}
+
+type cancelInstanceRefreshOutput struct {
+	_                 struct{} `type:"structure"`
+	InstanceRefreshId *string  `min:"1" type:"string"`
+}
+
+// instanceRefreshAPI is the minimal interface containing the Instance Refresh
+// operations of the autoscaling API.
+type instanceRefreshAPI interface {
+	StartInstanceRefresh(input *startInstanceRefreshInput) (*startInstanceRefreshOutput, error)
+	DescribeInstanceRefreshes(input *describeInstanceRefreshesInput) (*describeInstanceRefreshesOutput, error)
+	CancelInstanceRefresh(input *cancelInstanceRefreshInput) (*cancelInstanceRefreshOutput, error)
+}
+
+// autoscalingQueryClient sends the operations of the autoscaling API missing
+// from the vendored AWS SDK with the query protocol client of the service.
+type autoscalingQueryClient struct {
+	client *autoscaling.AutoScaling
+}
+
+func (c *autoscalingQueryClient) send(name string, input, output interface{}) error {
+	op := &request.Operation{
+		Name:       name,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+	return c.client.NewRequest(op, input, output).Send()
+}
+
+func (c *autoscalingQueryClient) StartInstanceRefresh(input *startInstanceRefreshInput) (*startInstanceRefreshOutput, error) {
+	output := &startInstanceRefreshOutput{}
+	return output, c.send("StartInstanceRefresh", input, output)
+}
+
+func (c *autoscalingQueryClient) DescribeInstanceRefreshes(input *describeInstanceRefreshesInput) (*describeInstanceRefreshesOutput, error) {
+	output := &describeInstanceRefreshesOutput{}
+	return output, c.send("DescribeInstanceRefreshes", input, output)
+}
+
+func (c *autoscalingQueryClient) CancelInstanceRefresh(input *cancelInstanceRefreshInput) (*cancelInstanceRefreshOutput, error) {
+	output := &cancelInstanceRefreshOutput{}
+	return output, c.send("CancelInstanceRefresh", input, output)
+}
+
+// StartInstanceRefresh starts an Instance Refresh of the ASG of the node pool
+// and returns its ID.
+func (n *ASGNodePoolsBackend) StartInstanceRefresh(nodePool *api.NodePool, preferences *InstanceRefreshPreferences) (string, error) {
+	asg, err := n.getNodePoolASG(nodePool)
+	if err != nil {
+		return "", err
+	}
+
+	prefs := &instanceRefreshPreferences{
+		MinHealthyPercentage: aws.Int64(int64(preferences.MinHealthyPercentage)),
+	}
+	if preferences.InstanceWarmup > 0 {
+		prefs.InstanceWarmup = aws.Int64(int64(preferences.InstanceWarmup.Seconds()))
+	}
+	if len(preferences.Checkpoints) > 0 {
+		for _, checkpoint := range preferences.Checkpoints {
+			prefs.CheckpointPercentages = append(prefs.CheckpointPercentages, aws.Int64(int64(checkpoint)))
+		}
+		prefs.CheckpointDelay = aws.Int64(int64(preferences.CheckpointDelay.Seconds()))
+	}
+
+	resp, err := n.instanceRefreshClient.StartInstanceRefresh(&startInstanceRefreshInput{
+		AutoScalingGroupName: asg.AutoScalingGroupName,
+		Preferences:          prefs,
+		Strategy:             aws.String("Rolling"),
+	})
+	if err != nil {
+		return "", err
+	}
+	return aws.StringValue(resp.InstanceRefreshId), nil
+}
+
+// GetInstanceRefresh returns the latest Instance Refresh of the ASG of the
+// node pool, or nil if it was never refreshed.
+func (n *ASGNodePoolsBackend) GetInstanceRefresh(nodePool *api.NodePool) (*InstanceRefresh, error) {
+	asg, err := n.getNodePoolASG(nodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := n.instanceRefreshClient.DescribeInstanceRefreshes(&describeInstanceRefreshesInput{
+		AutoScalingGroupName: asg.AutoScalingGroupName,
+		MaxRecords:           aws.Int64(1),
+	})
+	if err != nil {
+		return nil, err
+	}
+	if len(resp.InstanceRefreshes) == 0 {
+		return nil, nil
+	}
+
+	refresh := resp.InstanceRefreshes[0]
+	return &InstanceRefresh{
+		ID:                 aws.StringValue(refresh.InstanceRefreshId),
+		Status:             aws.StringValue(refresh.Status),
+		StatusReason:       aws.StringValue(refresh.StatusReason),
+		PercentageComplete: int(aws.Int64Value(refresh.PercentageComplete)),
+		InstancesToUpdate:  int(aws.Int64Value(refresh.InstancesToUpdate)),
+	}, nil
+}
+
+// CancelInstanceRefresh cancels the active Instance Refresh of the ASG of the
+// node pool. Instances already replaced aren't rolled back.
+func (n *ASGNodePoolsBackend) CancelInstanceRefresh(nodePool *api.NodePool) error {
+	asg, err := n.getNodePoolASG(nodePool)
+	if err != nil {
+		return err
+	}
+
+	_, err = n.instanceRefreshClient.CancelInstanceRefresh(&cancelInstanceRefreshInput{
+		AutoScalingGroupName: asg.AutoScalingGroupName,
+	})
+	return err
+}
@@ -0,0 +1,107 @@
+package updatestrategy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/cenkalti/backoff"
+)
+
+const (
+	lifecycleTransitionTerminating = "autoscaling:EC2_INSTANCE_TERMINATING"
+	lifecycleActionResultContinue  = "CONTINUE"
+	lifecycleHookCheckInterval     = 2 * time.Second
+	lifecycleHookMaxChecks         = 30
+)
+
+// completeTerminationHooks completes the terminate lifecycle hooks of the ASG
+// of an instance terminated after its node was drained. The notifications of
+// the hooks are sent once the instance is waiting for them, afterwards the
+// instance is terminated without waiting for the heartbeat timeout of the
+// hooks. Instances which aren't part of an ASG or whose ASG has no terminate
+// hooks are ignored.
+func (n *ASGNodePoolsBackend) completeTerminationHooks(instanceID string) error {
+	instance, err := n.describeASGInstance(instanceID)
+	if err != nil || instance == nil {
+		return err
+	}
+
+	resp, err := n.asgClient.DescribeLifecycleHooks(&autoscaling.DescribeLifecycleHooksInput{
+		AutoScalingGroupName: instance.AutoScalingGroupName,
+	})
+	if err != nil {
+		return err
+	}
+
+	var hooks []string
+	for _, hook := range resp.LifecycleHooks {
+		if aws.StringValue(hook.LifecycleTransition) == lifecycleTransitionTerminating {
+			hooks = append(hooks, aws.StringValue(hook.LifecycleHookName))
+		}
+	}
+
+	if len(hooks) == 0 {
+		return nil
+	}
+
+	// the hooks may already be completed, e.g. by the node shutdown tooling
+	// once it's done, in which case the instance isn't waiting anymore.
+	waiting := false
+	waitForHooks := func() error {
+		instance, err := n.describeASGInstance(instanceID)
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+		if instance == nil {
+			return nil
+		}
+
+		switch aws.StringValue(instance.LifecycleState) {
+		case autoscaling.LifecycleStateTerminatingWait:
+			waiting = true
+			return nil
+		case autoscaling.LifecycleStateInService, autoscaling.LifecycleStateTerminating:
+			return fmt.Errorf("instance %s is not waiting for its terminate hooks yet", instanceID)
+		default:
+			return nil
+		}
+	}
+
+	backoffCfg := backoff.WithMaxTries(backoff.NewConstantBackOff(lifecycleHookCheckInterval), lifecycleHookMaxChecks)
+	err = backoff.Retry(waitForHooks, backoffCfg)
+	if err != nil || !waiting {
+		return err
+	}
+
+	for _, hook := range hooks {
+		_, err := n.asgClient.CompleteLifecycleAction(&autoscaling.CompleteLifecycleActionInput{
+			AutoScalingGroupName:  instance.AutoScalingGroupName,
+			InstanceId:            aws.String(instanceID),
+			LifecycleHookName:     aws.String(hook),
+			LifecycleActionResult: aws.String(lifecycleActionResultContinue),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to complete lifecycle hook %s of instance %s: %v", hook, instanceID, err)
+		}
+	}
+
+	return nil
+}
+
+// describeASGInstance returns the ASG instance with the instance ID or nil if
+// the instance isn't part of an ASG.
+func (n *ASGNodePoolsBackend) describeASGInstance(instanceID string) (*autoscaling.InstanceDetails, error) {
+	resp, err := n.asgClient.DescribeAutoScalingInstances(&autoscaling.DescribeAutoScalingInstancesInput{
+		InstanceIds: []*string{aws.String(instanceID)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.AutoScalingInstances) == 0 {
+		return nil, nil
+	}
+	return resp.AutoScalingInstances[0], nil
+}
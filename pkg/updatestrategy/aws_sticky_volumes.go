@@ -0,0 +1,120 @@
+package updatestrategy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// getStickyVolumes returns the IDs of the sticky volumes of the node pool by
+// the ID of the instance they're attached to.
+func (n *ASGNodePoolsBackend) getStickyVolumes(nodePool *api.NodePool) (map[string]string, error) {
+	volumes := make(map[string]string)
+	input := &ec2.DescribeVolumesInput{
+		Filters: []*ec2.Filter{
+			{
+				Name:   aws.String("tag:" + StickyVolumeTag),
+				Values: []*string{aws.String(nodePool.Name)},
+			},
+			{
+				Name:   aws.String("tag-key"),
+				Values: []*string{aws.String(clusterIDTagPrefix + n.clusterID)},
+			},
+			{
+				Name:   aws.String("attachment.status"),
+				Values: []*string{aws.String(ec2.VolumeAttachmentStateAttached), aws.String(ec2.VolumeAttachmentStateAttaching)},
+			},
+		},
+	}
+
+	for {
+		resp, err := n.ec2Client.DescribeVolumes(input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, volume := range resp.Volumes {
+			for _, attachment := range volume.Attachments {
+				volumes[aws.StringValue(attachment.InstanceId)] = aws.StringValue(volume.VolumeId)
+			}
+		}
+
+		if aws.StringValue(resp.NextToken) == "" {
+			return volumes, nil
+		}
+		input.NextToken = resp.NextToken
+	}
+}
+
+// MoveStickyVolume waits for the sticky volume of the terminated node to be
+// detached and attaches it to the node to as device. If another node
+// attached the volume in the meantime, e.g. a node launched in the same
+// availability zone which attached it while booting, the volume is left
+// there.
+func (n *ASGNodePoolsBackend) MoveStickyVolume(ctx context.Context, from, to *Node, device string) error {
+	ctx, cancel := context.WithTimeout(ctx, operationMaxTimeout)
+	defer cancel()
+
+	fromInstanceID := instanceIDFromProviderID(from.ProviderID, from.FailureDomain)
+	toInstanceID := instanceIDFromProviderID(to.ProviderID, to.FailureDomain)
+
+	for {
+		volume, err := n.describeVolume(from.StickyVolume)
+		if err != nil {
+			return err
+		}
+
+		switch aws.StringValue(volume.State) {
+		case ec2.VolumeStateAvailable:
+			_, err := n.ec2Client.AttachVolume(&ec2.AttachVolumeInput{
+				VolumeId:   volume.VolumeId,
+				InstanceId: aws.String(toInstanceID),
+				Device:     aws.String(device),
+			})
+			if err == nil {
+				return nil
+			}
+
+			// the volume could have been attached by another node
+			// just now.
+			volume, derr := n.describeVolume(from.StickyVolume)
+			if derr != nil || aws.StringValue(volume.State) == ec2.VolumeStateAvailable {
+				return err
+			}
+			return nil
+		case ec2.VolumeStateInUse:
+			// the volume is detached once the terminated node is
+			// shut down.
+			if len(volume.Attachments) > 0 && aws.StringValue(volume.Attachments[0].InstanceId) != fromInstanceID {
+				return nil
+			}
+		default:
+			return fmt.Errorf("sticky volume %s is %s", from.StickyVolume, aws.StringValue(volume.State))
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("timeout exceeded waiting for sticky volume %s to be detached from %s", from.StickyVolume, fromInstanceID)
+		case <-time.After(operationCheckInterval):
+		}
+	}
+}
+
+// describeVolume returns the EBS volume with the ID.
+func (n *ASGNodePoolsBackend) describeVolume(volumeID string) (*ec2.Volume, error) {
+	resp, err := n.ec2Client.DescribeVolumes(&ec2.DescribeVolumesInput{
+		VolumeIds: []*string{aws.String(volumeID)},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(resp.Volumes) == 0 {
+		return nil, fmt.Errorf("sticky volume %s not found", volumeID)
+	}
+	return resp.Volumes[0], nil
+}
@@ -0,0 +1,90 @@
+package updatestrategy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ec2/ec2iface"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type stickyVolumesEC2API struct {
+	ec2iface.EC2API
+	// volumes are returned by the subsequent DescribeVolumes calls, the
+	// last one is repeated.
+	volumes  []*ec2.Volume
+	filters  []*ec2.Filter
+	attached *ec2.AttachVolumeInput
+}
+
+func (e *stickyVolumesEC2API) DescribeVolumes(input *ec2.DescribeVolumesInput) (*ec2.DescribeVolumesOutput, error) {
+	e.filters = input.Filters
+	volume := e.volumes[0]
+	if len(e.volumes) > 1 {
+		e.volumes = e.volumes[1:]
+	}
+	return &ec2.DescribeVolumesOutput{Volumes: []*ec2.Volume{volume}}, nil
+}
+
+func (e *stickyVolumesEC2API) AttachVolume(input *ec2.AttachVolumeInput) (*ec2.VolumeAttachment, error) {
+	e.attached = input
+	return &ec2.VolumeAttachment{}, nil
+}
+
+func stickyVolume(state string, instanceID string) *ec2.Volume {
+	volume := &ec2.Volume{VolumeId: aws.String("vol-1"), State: aws.String(state)}
+	if instanceID != "" {
+		volume.Attachments = []*ec2.VolumeAttachment{{InstanceId: aws.String(instanceID)}}
+	}
+	return volume
+}
+
+func TestGetStickyVolumes(t *testing.T) {
+	ec2Client := &stickyVolumesEC2API{volumes: []*ec2.Volume{stickyVolume(ec2.VolumeStateInUse, "i-abc")}}
+	backend := &ASGNodePoolsBackend{ec2Client: ec2Client, clusterID: "kube-1"}
+
+	volumes, err := backend.getStickyVolumes(&api.NodePool{Name: "worker-stateful"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"i-abc": "vol-1"}, volumes)
+	assert.Equal(t, "tag:"+StickyVolumeTag, aws.StringValue(ec2Client.filters[0].Name))
+	assert.Equal(t, []string{"worker-stateful"}, aws.StringValueSlice(ec2Client.filters[0].Values))
+}
+
+func TestMoveStickyVolume(t *testing.T) {
+	defer func(interval time.Duration) { operationCheckInterval = interval }(operationCheckInterval)
+	operationCheckInterval = 10 * time.Millisecond
+
+	from := &Node{ProviderID: "aws:///eu-central-1a/i-old", FailureDomain: "eu-central-1a", StickyVolume: "vol-1"}
+	to := &Node{ProviderID: "aws:///eu-central-1a/i-new", FailureDomain: "eu-central-1a"}
+
+	// the volume is attached once it's detached from the old node.
+	ec2Client := &stickyVolumesEC2API{volumes: []*ec2.Volume{
+		stickyVolume(ec2.VolumeStateInUse, "i-old"),
+		stickyVolume(ec2.VolumeStateAvailable, ""),
+	}}
+	backend := &ASGNodePoolsBackend{ec2Client: ec2Client}
+	err := backend.MoveStickyVolume(context.Background(), from, to, "/dev/xvdf")
+	require.NoError(t, err)
+	require.NotNil(t, ec2Client.attached)
+	assert.Equal(t, "i-new", aws.StringValue(ec2Client.attached.InstanceId))
+	assert.Equal(t, "/dev/xvdf", aws.StringValue(ec2Client.attached.Device))
+
+	// volumes attached by another node in the meantime are left there.
+	ec2Client = &stickyVolumesEC2API{volumes: []*ec2.Volume{stickyVolume(ec2.VolumeStateInUse, "i-other")}}
+	backend = &ASGNodePoolsBackend{ec2Client: ec2Client}
+	err = backend.MoveStickyVolume(context.Background(), from, to, "/dev/xvdf")
+	require.NoError(t, err)
+	assert.Nil(t, ec2Client.attached)
+
+	// deleted volumes can't be moved.
+	ec2Client = &stickyVolumesEC2API{volumes: []*ec2.Volume{stickyVolume(ec2.VolumeStateDeleted, "")}}
+	backend = &ASGNodePoolsBackend{ec2Client: ec2Client}
+	err = backend.MoveStickyVolume(context.Background(), from, to, "/dev/xvdf")
+	assert.Error(t, err)
+}
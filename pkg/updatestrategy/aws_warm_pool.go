@@ -0,0 +1,124 @@
+package updatestrategy
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// Like the Instance Refresh API, DescribeWarmPool is missing from the
+// vendored AWS SDK. The instances of a warm pool have the same shape as the
+// instances of an ASG.
+
+type describeWarmPoolInput struct {
+	_                    struct{} `type:"structure"`
+	AutoScalingGroupName *string  `min:"1" type:"string" required:"true"`
+	NextToken            *string  `type:"string"`
+}
+
+type describeWarmPoolOutput struct {
+	_         struct{}                `type:"structure"`
+	Instances []*autoscaling.Instance `type:"list"`
+	NextToken *string                 `type:"string"`
+}
+
+// warmPoolAPI is the minimal interface containing the warm pool operations
+// of the autoscaling API.
+type warmPoolAPI interface {
+	DescribeWarmPool(input *describeWarmPoolInput) (*describeWarmPoolOutput, error)
+}
+
+func (c *autoscalingQueryClient) DescribeWarmPool(input *describeWarmPoolInput) (*describeWarmPoolOutput, error) {
+	output := &describeWarmPoolOutput{}
+	return output, c.send("DescribeWarmPool", input, output)
+}
+
+// getWarmPoolInstances returns the instances in the warm pool of the ASG
+// which aren't being terminated.
+func (n *ASGNodePoolsBackend) getWarmPoolInstances(asg *autoscaling.Group) ([]*autoscaling.Instance, error) {
+	var instances []*autoscaling.Instance
+	input := &describeWarmPoolInput{
+		AutoScalingGroupName: asg.AutoScalingGroupName,
+	}
+
+	for {
+		resp, err := n.warmPoolClient.DescribeWarmPool(input)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, instance := range resp.Instances {
+			// e.g. 'Warmed:Terminating:Wait'
+			if strings.Contains(aws.StringValue(instance.LifecycleState), "Terminat") {
+				continue
+			}
+			instances = append(instances, instance)
+		}
+
+		if aws.StringValue(resp.NextToken) == "" {
+			return instances, nil
+		}
+		input.NextToken = resp.NextToken
+	}
+}
+
+// RecycleWarmPool terminates the instances in the warm pool of the ASG of the
+// node pool which weren't launched from its current launch configuration or
+// launch template version, or before the profile of the node pool changed,
+// and returns their number. The ASG replaces them with up to date instances,
+// such that scaling up the node pool doesn't bring back outdated nodes.
+func (n *ASGNodePoolsBackend) RecycleWarmPool(nodePool *api.NodePool) (int, error) {
+	asg, err := n.getNodePoolASG(nodePool)
+	if err != nil {
+		return 0, err
+	}
+
+	instances, err := n.getWarmPoolInstances(asg)
+	if err != nil {
+		return 0, err
+	}
+
+	if len(instances) == 0 {
+		return 0, nil
+	}
+
+	// the warm instances are checked like the instances of the ASG.
+	warmPool := *asg
+	warmPool.Instances = instances
+
+	outdated, err := n.getInstancesToUpdate(&warmPool)
+	if err != nil {
+		return 0, err
+	}
+
+	profileOutdated, err := n.getProfileOutdatedInstances(&warmPool)
+	if err != nil {
+		return 0, err
+	}
+	for instanceID := range profileOutdated {
+		outdated[instanceID] = true
+	}
+
+	if len(outdated) == 0 {
+		return 0, nil
+	}
+
+	instanceIDs := make([]string, 0, len(outdated))
+	for instanceID := range outdated {
+		instanceIDs = append(instanceIDs, instanceID)
+	}
+	sort.Strings(instanceIDs)
+
+	_, err = n.ec2Client.TerminateInstances(&ec2.TerminateInstancesInput{
+		InstanceIds: aws.StringSlice(instanceIDs),
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	return len(instanceIDs), nil
+}
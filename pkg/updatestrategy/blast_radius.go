@@ -0,0 +1,85 @@
+package updatestrategy
+
+import (
+	"fmt"
+	"sort"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// BlastRadius estimates the impact of replacing a set of nodes on the
+// cluster.
+type BlastRadius struct {
+	// Nodes is the number of nodes being replaced.
+	Nodes int
+	// ClusterNodes is the number of nodes in the cluster.
+	ClusterNodes int
+	// CapacityPercent is the share of the allocatable CPU of the cluster
+	// provided by the replaced nodes.
+	CapacityPercent float64
+	// Namespaces are the namespaces of the pods evicted from the replaced
+	// nodes, sorted by name.
+	Namespaces []string
+}
+
+// String returns a human readable representation of the blast radius.
+func (b *BlastRadius) String() string {
+	return fmt.Sprintf("%d of %d cluster nodes, %.1f%% of the cluster capacity, %d namespaces", b.Nodes, b.ClusterNodes, b.CapacityPercent, len(b.Namespaces))
+}
+
+// BlastRadius estimates the blast radius of replacing the nodes based on the
+// allocatable CPU of all nodes in the cluster and the evictable pods on the
+// replaced nodes. Nodes which are not registered in the cluster don't
+// contribute any capacity or namespaces.
+func (m *KubernetesNodePoolManager) BlastRadius(nodes []*Node) (*BlastRadius, error) {
+	clusterNodes, err := m.kube.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var total int64
+	allocatable := make(map[string]int64, len(clusterNodes.Items))
+	for _, node := range clusterNodes.Items {
+		cpu := node.Status.Allocatable[v1.ResourceCPU]
+		allocatable[node.Name] = cpu.MilliValue()
+		total += cpu.MilliValue()
+	}
+
+	var replaced int64
+	namespaces := make(map[string]bool)
+	for _, node := range nodes {
+		if node.Name == "" {
+			continue
+		}
+		replaced += allocatable[node.Name]
+
+		pods, err := m.getPodsByNode(node.Name)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, pod := range pods.Items {
+			if m.isEvictablePod(pod) {
+				namespaces[pod.Namespace] = true
+			}
+		}
+	}
+
+	radius := &BlastRadius{
+		Nodes:        len(nodes),
+		ClusterNodes: len(clusterNodes.Items),
+		Namespaces:   make([]string, 0, len(namespaces)),
+	}
+
+	if total > 0 {
+		radius.CapacityPercent = float64(replaced) * 100 / float64(total)
+	}
+
+	for namespace := range namespaces {
+		radius.Namespaces = append(radius.Namespaces, namespace)
+	}
+	sort.Strings(radius.Namespaces)
+
+	return radius, nil
+}
@@ -0,0 +1,56 @@
+package updatestrategy
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"k8s.io/apimachinery/pkg/api/resource"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+func TestBlastRadius(t *testing.T) {
+	node := func(name, cpu string) *v1.Node {
+		return &v1.Node{
+			ObjectMeta: metav1.ObjectMeta{Name: name},
+			Status: v1.NodeStatus{
+				Allocatable: v1.ResourceList{v1.ResourceCPU: resource.MustParse(cpu)},
+			},
+		}
+	}
+
+	pod := func(name, namespace, ownerKind string) *v1.Pod {
+		pod := &v1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: namespace},
+			Spec:       v1.PodSpec{NodeName: "a"},
+		}
+		if ownerKind != "" {
+			pod.OwnerReferences = []metav1.OwnerReference{{Kind: ownerKind, Name: name}}
+		}
+		return pod
+	}
+
+	client := setupMockKubernetes(t,
+		[]*v1.Node{node("a", "2"), node("b", "2"), node("c", "4")},
+		[]*v1.Pod{
+			pod("app-1", "teapot", "ReplicaSet"),
+			pod("app-2", "teapot", "ReplicaSet"),
+			pod("db-0", "storage", "StatefulSet"),
+			pod("flannel", "kube-system", "DaemonSet"),
+		},
+	)
+	mgr := &KubernetesNodePoolManager{
+		kube:   client,
+		logger: log.WithField("test", true),
+	}
+
+	radius, err := mgr.BlastRadius([]*Node{{Name: "a"}, {ProviderID: "unregistered"}})
+	require.NoError(t, err)
+	assert.Equal(t, 2, radius.Nodes)
+	assert.Equal(t, 3, radius.ClusterNodes)
+	assert.Equal(t, 25.0, radius.CapacityPercent)
+	assert.Equal(t, []string{"storage", "teapot"}, radius.Namespaces)
+	assert.Equal(t, "2 of 3 cluster nodes, 25.0% of the cluster capacity, 2 namespaces", radius.String())
+}
@@ -0,0 +1,157 @@
+package updatestrategy
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// UpdateModeRolling replaces the old nodes of a node pool batch by
+	// batch, surging new nodes before every batch.
+	UpdateModeRolling = "rolling"
+	// UpdateModeBlueGreen first launches a complete set of new (green)
+	// nodes next to the old (blue) ones and only drains the blue nodes
+	// once all green nodes are ready and healthy.
+	UpdateModeBlueGreen = "blue-green"
+)
+
+// ValidateUpdateMode returns an error if the update mode of a node pool is
+// unknown.
+func ValidateUpdateMode(mode string) error {
+	switch mode {
+	case "", UpdateModeRolling, UpdateModeBlueGreen:
+		return nil
+	default:
+		return fmt.Errorf("invalid update mode %s: expected %s or %s", mode, UpdateModeRolling, UpdateModeBlueGreen)
+	}
+}
+
+// isBlueGreen returns true if the node pool is updated in the blue/green
+// mode, either by its update mode or its update strategy.
+func isBlueGreen(nodePoolDesc *api.NodePool) bool {
+	return nodePoolDesc.UpdateMode == UpdateModeBlueGreen || nodePoolDesc.UpdateStrategy == UpdateStrategyBlueGreen
+}
+
+// updateBlueGreen performs a blue/green update of a single node pool: a
+// green node is launched for every blue node and all of them must become
+// ready and healthy before the blue nodes are cordoned at once, shifting the
+// workloads to the green nodes as they're drained. The blue nodes are left
+// untouched if the green nodes fail, so the node pool keeps running the old
+// configuration next to the failed green nodes until the next update. The
+// surge, canary and max unavailable nodes of the node pool don't apply.
+func (r *RollingUpdateStrategy) updateBlueGreen(ctx context.Context, nodePoolDesc *api.NodePool, nodePool *NodePool) error {
+	blue := len(withoutQuarantined(outdatedNodes(nodePool)))
+
+	progress := r.getRolloutProgress(nodePoolDesc)
+	if !progress.empty() && blue > 0 {
+		r.logger.Infof("Resuming blue/green update of node pool '%s' started at %s, %d blue nodes replaced so far", nodePoolDesc.Name, progress.StartedAt, progress.Replaced)
+
+		err := r.resumeReplacing(nodePoolDesc, nodePool, progress)
+		if err != nil {
+			return err
+		}
+	}
+
+	if blue > 0 {
+		r.logger.Infof("Launching %d green nodes in node pool '%s'", blue, nodePoolDesc.Name)
+		api.ReportProgress(ctx, api.ProgressStepWaitingForNodesReady, nodePoolDesc.Name, fmt.Sprintf("Launching %d green nodes in node pool %s", blue, nodePoolDesc.Name))
+	}
+
+	for {
+		err := r.checkPaused(ctx, nodePoolDesc)
+		if err != nil {
+			return err
+		}
+
+		// all green nodes must be ready before any blue node is
+		// drained.
+		nodePool, err := r.scaleOutAndWaitForNodesToBeReady(ctx, nodePoolDesc, blue)
+		if err != nil {
+			return r.recordBootstrapFailure(ctx, nodePoolDesc, err)
+		}
+
+		err = r.labelNodes(nodePool)
+		if err != nil {
+			return err
+		}
+
+		err = r.taintOldNodes(nodePool)
+		if err != nil {
+			return err
+		}
+
+		err = r.protectNodes(nodePool, nodePoolDesc)
+		if err != nil {
+			return err
+		}
+
+		if r.isUpdateDone(nodePool) {
+			break
+		}
+
+		err = r.waitForHealthyNodes(ctx, nodePoolDesc)
+		if err != nil {
+			return r.recordBootstrapFailure(ctx, nodePoolDesc, err)
+		}
+
+		// shift the workloads by cordoning all blue nodes at once,
+		// they're drained when they're terminated.
+		oldNodes, _ := r.splitOldNewNodes(nodePool)
+		_, cordon := splitDeferredNodes(oldNodes)
+		err = r.cordonNodes(cordon)
+		if err != nil {
+			return err
+		}
+		for _, node := range cordon {
+			node.Cordoned = true
+		}
+
+		drainTimes, err := r.terminateCordonedNodes(ctx, nodePoolDesc, nodePool, len(oldNodes), progress)
+		if err != nil {
+			return err
+		}
+
+		start := time.Now()
+		nodePool, err = r.waitForDesiredNodes(ctx, nodePoolDesc)
+		if err != nil {
+			return r.recordBootstrapFailure(ctx, nodePoolDesc, err)
+		}
+
+		if len(drainTimes) > 0 {
+			oldNodes, _ := r.splitOldNewNodes(nodePool)
+			err = r.recordDrainTimes(nodePoolDesc, drainTimes, time.Since(start), len(oldNodes))
+			if err != nil {
+				r.logger.Warnf("Failed to record drain time: %v", err)
+			}
+			api.ReportRolloutProgress(ctx, nodePoolDesc.Name, progress.Replaced, progress.Replaced+len(oldNodes))
+			continue
+		}
+
+		// only blue nodes deferring their termination are left, wait
+		// for their deadlines before checking again.
+		r.logger.Infof("Waiting for blue nodes of node pool '%s' deferring their termination", nodePoolDesc.Name)
+		select {
+		case <-ctx.Done():
+			return errTimeoutExceeded
+		case <-time.After(operationCheckInterval):
+		}
+	}
+
+	if r.bootstrapFailures != nil {
+		err := r.bootstrapFailures.SetBootstrapFailures(nodePoolDesc, 0)
+		if err != nil {
+			r.logger.Warnf("Failed to reset bootstrap failures: %v", err)
+		}
+	}
+
+	if !progress.empty() {
+		r.logger.Infof("Replaced %d blue nodes of node pool '%s' since %s", progress.Replaced, nodePoolDesc.Name, progress.StartedAt)
+		r.setRolloutProgress(nodePoolDesc, &RolloutProgress{})
+	}
+
+	r.logger.Infof("Node pool '%s' successfully updated", nodePoolDesc.Name)
+	return nil
+}
@@ -0,0 +1,79 @@
+package updatestrategy
+
+import (
+	"context"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// blueGreenNodePoolManager records the number of new nodes when the first
+// old node is terminated.
+type blueGreenNodePoolManager struct {
+	*mockNodePoolManager
+	greenAtFirstTermination int
+	terminated              int
+}
+
+func (m *blueGreenNodePoolManager) TerminateNode(ctx context.Context, node *Node, decrementDesired bool) error {
+	if m.terminated == 0 {
+		m.greenAtFirstTermination = len(m.nodePool.Nodes) - len(outdatedNodes(m.nodePool))
+	}
+	m.terminated++
+	return m.mockNodePoolManager.TerminateNode(ctx, node, decrementDesired)
+}
+
+func TestValidateUpdateMode(t *testing.T) {
+	for _, mode := range []string{"", UpdateModeRolling, UpdateModeBlueGreen} {
+		if err := ValidateUpdateMode(mode); err != nil {
+			t.Errorf("expected update mode '%s' to be valid: %v", mode, err)
+		}
+	}
+
+	if err := ValidateUpdateMode("recreate"); err == nil {
+		t.Errorf("expected unknown update modes to be invalid")
+	}
+}
+
+func TestUpdateBlueGreen(t *testing.T) {
+	logger := log.WithField("test", true)
+	np := &api.NodePool{Name: "test", MaxSize: 20, UpdateMode: UpdateModeBlueGreen}
+
+	store := &mockRolloutStore{}
+	manager := &blueGreenNodePoolManager{mockNodePoolManager: &mockNodePoolManager{nodePool: mockLargeNodePool(4)}}
+	strategy := NewRollingUpdateStrategy(logger, manager, nil, nil, store, 1, 0, 0, 0, 0)
+
+	err := strategy.Update(context.Background(), np)
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+
+	if manager.greenAtFirstTermination != 4 {
+		t.Errorf("expected 4 green nodes before the first blue node is terminated, got %d", manager.greenAtFirstTermination)
+	}
+
+	oldNodes, newNodes := strategy.splitOldNewNodes(manager.nodePool)
+	if len(oldNodes) != 0 || len(newNodes) != 4 {
+		t.Errorf("expected 4 green nodes, got %d old and %d new nodes", len(oldNodes), len(newNodes))
+	}
+
+	if !store.progress.empty() {
+		t.Errorf("expected the progress of the finished update to be reset, got %s", &store.progress)
+	}
+}
+
+func TestPlanBlueGreen(t *testing.T) {
+	logger := log.WithField("test", true)
+	np := &api.NodePool{Name: "test", MaxSize: 20, UpdateMode: UpdateModeBlueGreen, UpdateCanary: "1"}
+
+	strategy := NewRollingUpdateStrategy(logger, &mockNodePoolManager{nodePool: mockLargeNodePool(5)}, nil, nil, nil, 1, 0, 0, 0, 0)
+	plan, err := strategy.Plan(context.Background(), np)
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+
+	if len(plan.Batches) != 1 || len(plan.Batches[0]) != 5 || plan.Surge != 5 || plan.Canary != 0 {
+		t.Errorf("expected a single batch of 5 nodes without canary, got %d batches, surge %d and canary %d", len(plan.Batches), plan.Surge, plan.Canary)
+	}
+}
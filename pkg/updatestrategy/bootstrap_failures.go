@@ -0,0 +1,25 @@
+package updatestrategy
+
+import (
+	"errors"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// maxBootstrapFailures is the number of consecutive times new nodes of a node
+// pool may fail to become ready before the node pool is frozen.
+const maxBootstrapFailures = 3
+
+// ErrNodePoolFrozen is returned when updating a node pool whose new nodes
+// repeatedly failed to become ready. Frozen node pools are not updated until
+// their configuration changes, such that the old nodes keep serving instead
+// of being replaced by broken ones.
+var ErrNodePoolFrozen = errors.New("node pool frozen after repeated bootstrap failures")
+
+// BootstrapFailureStore persists the number of consecutive bootstrap failures
+// per node pool. Implementations must reset the failures when the
+// configuration of the node pool's nodes changes.
+type BootstrapFailureStore interface {
+	GetBootstrapFailures(nodePool *api.NodePool) (int, error)
+	SetBootstrapFailures(nodePool *api.NodePool, failures int) error
+}
@@ -0,0 +1,128 @@
+package updatestrategy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// ErrCanaryFailed is returned when the canary nodes of a node pool update
+// didn't become ready or reported problems during the soak period. The
+// canary nodes are removed again and the old nodes are left untouched.
+var ErrCanaryFailed = errors.New("canary nodes failed")
+
+// poolCanary returns the number of canary nodes of the node pool, limited to
+// its max size. Zero means the node pool is updated without canary nodes.
+func (r *RollingUpdateStrategy) poolCanary(nodePoolDesc *api.NodePool, desired int) (int, error) {
+	if nodePoolDesc.UpdateCanary == "" {
+		return 0, nil
+	}
+
+	canary, err := ParseCanary(nodePoolDesc.UpdateCanary, desired)
+	if err != nil {
+		return 0, err
+	}
+
+	if int64(canary) > nodePoolDesc.MaxSize {
+		return int(nodePoolDesc.MaxSize), nil
+	}
+	return canary, nil
+}
+
+// updateCanary adds canary nodes of the new generation to the node pool and
+// waits for the soak period while checking their health. Unhealthy canary
+// nodes abort the update: the nodes added for the canary are terminated and
+// ErrCanaryFailed is returned. The old nodes aren't drained before the
+// canary passed.
+func (r *RollingUpdateStrategy) updateCanary(ctx context.Context, nodePoolDesc *api.NodePool, desired, canary int) error {
+	r.logger.Infof("Adding %d canary nodes to node pool '%s'", canary, nodePoolDesc.Name)
+
+	_, err := r.scaleOutAndWaitForNodesToBeReady(ctx, nodePoolDesc, canary)
+	if err == errTimeoutExceeded && ctx.Err() == nil {
+		r.logger.Errorf("Canary nodes of node pool '%s' failed to become ready", nodePoolDesc.Name)
+		return r.rollbackCanary(ctx, nodePoolDesc, desired)
+	}
+	if err != nil {
+		return err
+	}
+
+	api.ReportProgress(ctx, api.ProgressStepCanarySoak, nodePoolDesc.Name, fmt.Sprintf("Soaking %d canary nodes of node pool %s for %s", canary, nodePoolDesc.Name, r.canarySoakPeriod))
+
+	deadline := time.After(r.canarySoakPeriod)
+	for {
+		nodePool, err := r.nodePoolManager.GetPool(nodePoolDesc)
+		if err != nil {
+			return err
+		}
+
+		_, newNodes := r.splitOldNewNodes(nodePool)
+		if unhealthy := unhealthyNodes(newNodes); len(unhealthy) > 0 {
+			r.logger.Errorf("Canary nodes of node pool '%s' are unhealthy: %s", nodePoolDesc.Name, strings.Join(unhealthy, ", "))
+			return r.rollbackCanary(ctx, nodePoolDesc, desired)
+		}
+
+		select {
+		case <-ctx.Done():
+			return errTimeoutExceeded
+		case <-deadline:
+			r.logger.Infof("Canary nodes of node pool '%s' are healthy, continuing the update", nodePoolDesc.Name)
+			return nil
+		case <-time.After(operationCheckInterval):
+		}
+	}
+}
+
+// rollbackCanary scales the node pool back to the desired number of nodes it
+// had before the canary by terminating the nodes of the new generation,
+// unhealthy ones first.
+func (r *RollingUpdateStrategy) rollbackCanary(ctx context.Context, nodePoolDesc *api.NodePool, desired int) error {
+	nodePool, err := r.nodePoolManager.GetPool(nodePoolDesc)
+	if err != nil {
+		return err
+	}
+
+	_, newNodes := r.splitOldNewNodes(nodePool)
+	sort.SliceStable(newNodes, func(i, j int) bool {
+		return !nodeHealthy(newNodes[i]) && nodeHealthy(newNodes[j])
+	})
+
+	remove := nodePool.Desired - desired
+	if remove > len(newNodes) {
+		remove = len(newNodes)
+	}
+
+	r.logger.Warnf("Rolling back canary of node pool '%s': terminating %d nodes", nodePoolDesc.Name, remove)
+	for _, node := range newNodes[:remove] {
+		err := r.nodePoolManager.TerminateNode(ctx, node, true)
+		if err != nil {
+			return err
+		}
+	}
+
+	return ErrCanaryFailed
+}
+
+// nodeHealthy returns true if the node is ready and its kubelet doesn't
+// report any problems.
+func nodeHealthy(node *Node) bool {
+	return node.Ready && len(node.Problems) == 0
+}
+
+// unhealthyNodes returns a description of the unhealthy nodes.
+func unhealthyNodes(nodes []*Node) []string {
+	var unhealthy []string
+	for _, node := range nodes {
+		switch {
+		case !node.Ready:
+			unhealthy = append(unhealthy, fmt.Sprintf("%s (not ready)", node.Name))
+		case len(node.Problems) > 0:
+			unhealthy = append(unhealthy, fmt.Sprintf("%s (%s)", node.Name, strings.Join(node.Problems, ", ")))
+		}
+	}
+	return unhealthy
+}
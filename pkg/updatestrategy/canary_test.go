@@ -0,0 +1,97 @@
+package updatestrategy
+
+import (
+	"context"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// unhealthyNodePoolManager is a mockNodePoolManager whose new nodes report
+// kubelet problems.
+type unhealthyNodePoolManager struct {
+	*mockNodePoolManager
+}
+
+func (m *unhealthyNodePoolManager) ScalePool(ctx context.Context, nodePool *api.NodePool, replicas int) error {
+	err := m.mockNodePoolManager.ScalePool(ctx, nodePool, replicas)
+	for _, node := range m.nodePool.Nodes {
+		if node.Generation == m.nodePool.Generation {
+			node.Problems = []string{"DiskPressure: KubeletHasDiskPressure"}
+		}
+	}
+	return err
+}
+
+func mockOutdatedNodePool() *NodePool {
+	return &NodePool{
+		Min:        2,
+		Max:        2,
+		Current:    2,
+		Desired:    2,
+		Generation: 2,
+		Nodes: []*Node{
+			mockNode("a", 1, false, false),
+			mockNode("b", 1, false, false),
+		},
+	}
+}
+
+func TestUpdateCanary(t *testing.T) {
+	logger := log.WithField("test", true)
+	np := &api.NodePool{Name: "test", MaxSize: 20, UpdateCanary: "1"}
+
+	manager := &mockNodePoolManager{nodePool: mockOutdatedNodePool()}
+	strategy := NewRollingUpdateStrategy(logger, manager, nil, nil, nil, 2, 0, 0, 0, 0)
+	err := strategy.Update(context.Background(), np)
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+
+	oldNodes, newNodes := strategy.splitOldNewNodes(manager.nodePool)
+	if len(oldNodes) != 0 || len(newNodes) != 2 {
+		t.Errorf("expected 2 new nodes after a healthy canary, got %d old and %d new nodes", len(oldNodes), len(newNodes))
+	}
+}
+
+func TestUpdateCanaryRollback(t *testing.T) {
+	logger := log.WithField("test", true)
+	np := &api.NodePool{Name: "test", MaxSize: 20, UpdateCanary: "50%"}
+
+	store := &mockBootstrapFailureStore{}
+	manager := &unhealthyNodePoolManager{&mockNodePoolManager{nodePool: mockOutdatedNodePool()}}
+	strategy := NewRollingUpdateStrategy(logger, manager, nil, store, nil, 3, 0, 0, 0, 0)
+	err := strategy.Update(context.Background(), np)
+	if err != ErrCanaryFailed {
+		t.Fatalf("expected %v, got %v", ErrCanaryFailed, err)
+	}
+
+	oldNodes, newNodes := strategy.splitOldNewNodes(manager.nodePool)
+	if len(oldNodes) != 2 || len(newNodes) != 0 {
+		t.Errorf("expected the old nodes to be kept, got %d old and %d new nodes", len(oldNodes), len(newNodes))
+	}
+
+	if store.failures != 1 {
+		t.Errorf("expected the failed canary to be recorded, got %d failures", store.failures)
+	}
+}
+
+func TestPlanCanary(t *testing.T) {
+	logger := log.WithField("test", true)
+	np := &api.NodePool{Name: "test", MaxSize: 20, UpdateCanary: "10%"}
+
+	strategy := NewRollingUpdateStrategy(logger, &mockNodePoolManager{nodePool: mockOutdatedNodePool()}, nil, nil, nil, 3, defaultBatchDuration, 0, 0, 0)
+	plan, err := strategy.Plan(context.Background(), np)
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+
+	if plan.Canary != 1 {
+		t.Errorf("expected 1 canary node, got %d", plan.Canary)
+	}
+
+	if plan.EstimatedDuration != 2*defaultBatchDuration {
+		t.Errorf("expected the soak period to be part of the estimate, got %s", plan.EstimatedDuration)
+	}
+}
@@ -0,0 +1,114 @@
+package updatestrategy
+
+import (
+	"encoding/json"
+	"reflect"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+// changeClass classifies the differences between the launch configuration or
+// launch template version of an instance and the current one of its ASG.
+type changeClass int
+
+const (
+	// changeNone means the instance was launched with the current
+	// configuration.
+	changeNone changeClass = iota
+	// changeNonDisruptive means the configuration changed, but not in a way
+	// which affects the running instance, so it isn't replaced.
+	changeNonDisruptive
+	// changeDisruptive means the instance must be replaced to pick up the
+	// changes.
+	changeDisruptive
+)
+
+// nonDisruptiveLaunchTemplateFields are the paths of the fields of the
+// launch template data which only apply to new instances. The max price of
+// spot instances is only checked when an instance is launched, running spot
+// instances keep running until they're interrupted.
+var nonDisruptiveLaunchTemplateFields = [][]string{
+	{"InstanceMarketOptions", "SpotOptions", "MaxPrice"},
+}
+
+// classifyLaunchTemplateChange classifies the differences between the data
+// of two launch template versions. Changes of the non-disruptive fields are
+// non-disruptive, all other changes are disruptive.
+func classifyLaunchTemplateChange(old, current *ec2.ResponseLaunchTemplateData) (changeClass, error) {
+	oldData, err := launchTemplateDataFields(old)
+	if err != nil {
+		return changeDisruptive, err
+	}
+	currentData, err := launchTemplateDataFields(current)
+	if err != nil {
+		return changeDisruptive, err
+	}
+
+	if reflect.DeepEqual(oldData, currentData) {
+		return changeNone, nil
+	}
+
+	for _, field := range nonDisruptiveLaunchTemplateFields {
+		deleteField(oldData, field)
+		deleteField(currentData, field)
+	}
+
+	if reflect.DeepEqual(oldData, currentData) {
+		return changeNonDisruptive, nil
+	}
+	return changeDisruptive, nil
+}
+
+// classifySpotPriceChange classifies the change from the spot price of an
+// instance to the spot price of the launch configuration of its ASG. An
+// empty price means on-demand instances, so switching between spot and
+// on-demand is disruptive while a different max price isn't.
+func classifySpotPriceChange(instancePrice, launchConfigPrice *string) (changeClass, error) {
+	if aws.StringValue(instancePrice) == "" || aws.StringValue(launchConfigPrice) == "" {
+		if aws.StringValue(instancePrice) == aws.StringValue(launchConfigPrice) {
+			return changeNone, nil
+		}
+		return changeDisruptive, nil
+	}
+
+	match, err := compareSpotPrices(instancePrice, launchConfigPrice)
+	if err != nil {
+		return changeDisruptive, err
+	}
+	if match {
+		return changeNone, nil
+	}
+	return changeNonDisruptive, nil
+}
+
+// launchTemplateDataFields converts the launch template data to nested maps
+// keyed by the field names.
+func launchTemplateDataFields(data *ec2.ResponseLaunchTemplateData) (map[string]interface{}, error) {
+	if data == nil {
+		data = &ec2.ResponseLaunchTemplateData{}
+	}
+
+	encoded, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	var fields map[string]interface{}
+	err = json.Unmarshal(encoded, &fields)
+	if err != nil {
+		return nil, err
+	}
+	return fields, nil
+}
+
+// deleteField deletes the field at path from the nested maps, if it exists.
+func deleteField(fields map[string]interface{}, path []string) {
+	for _, key := range path[:len(path)-1] {
+		nested, ok := fields[key].(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields = nested
+	}
+	delete(fields, path[len(path)-1])
+}
@@ -0,0 +1,108 @@
+package updatestrategy
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestClassifyLaunchTemplateChange(t *testing.T) {
+	spot := func(maxPrice string) *ec2.LaunchTemplateInstanceMarketOptions {
+		return &ec2.LaunchTemplateInstanceMarketOptions{
+			MarketType:  aws.String(ec2.MarketTypeSpot),
+			SpotOptions: &ec2.LaunchTemplateSpotMarketOptions{MaxPrice: aws.String(maxPrice)},
+		}
+	}
+
+	for _, tc := range []struct {
+		msg      string
+		old      *ec2.ResponseLaunchTemplateData
+		current  *ec2.ResponseLaunchTemplateData
+		expected changeClass
+	}{
+		{
+			msg:      "unchanged",
+			old:      &ec2.ResponseLaunchTemplateData{ImageId: aws.String("ami-1"), InstanceMarketOptions: spot("0.1")},
+			current:  &ec2.ResponseLaunchTemplateData{ImageId: aws.String("ami-1"), InstanceMarketOptions: spot("0.1")},
+			expected: changeNone,
+		},
+		{
+			msg:      "no data",
+			current:  &ec2.ResponseLaunchTemplateData{},
+			expected: changeNone,
+		},
+		{
+			msg:      "max price",
+			old:      &ec2.ResponseLaunchTemplateData{ImageId: aws.String("ami-1"), InstanceMarketOptions: spot("0.1")},
+			current:  &ec2.ResponseLaunchTemplateData{ImageId: aws.String("ami-1"), InstanceMarketOptions: spot("0.2")},
+			expected: changeNonDisruptive,
+		},
+		{
+			msg:      "max price and image",
+			old:      &ec2.ResponseLaunchTemplateData{ImageId: aws.String("ami-1"), InstanceMarketOptions: spot("0.1")},
+			current:  &ec2.ResponseLaunchTemplateData{ImageId: aws.String("ami-2"), InstanceMarketOptions: spot("0.2")},
+			expected: changeDisruptive,
+		},
+		{
+			msg:      "on-demand to spot",
+			old:      &ec2.ResponseLaunchTemplateData{ImageId: aws.String("ami-1")},
+			current:  &ec2.ResponseLaunchTemplateData{ImageId: aws.String("ami-1"), InstanceMarketOptions: spot("0.2")},
+			expected: changeDisruptive,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			change, err := classifyLaunchTemplateChange(tc.old, tc.current)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, change)
+		})
+	}
+}
+
+func TestClassifySpotPriceChange(t *testing.T) {
+	for _, tc := range []struct {
+		msg          string
+		instance     *string
+		launchConfig *string
+		expected     changeClass
+	}{
+		{
+			msg:      "on-demand",
+			expected: changeNone,
+		},
+		{
+			msg:          "same max price",
+			instance:     aws.String("0.12"),
+			launchConfig: aws.String("0.1200000"),
+			expected:     changeNone,
+		},
+		{
+			msg:          "different max price",
+			instance:     aws.String("0.12"),
+			launchConfig: aws.String("0.2"),
+			expected:     changeNonDisruptive,
+		},
+		{
+			msg:          "spot to on-demand",
+			instance:     aws.String("0.12"),
+			launchConfig: aws.String(""),
+			expected:     changeDisruptive,
+		},
+		{
+			msg:          "on-demand to spot",
+			launchConfig: aws.String("0.12"),
+			expected:     changeDisruptive,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			change, err := classifySpotPriceChange(tc.instance, tc.launchConfig)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, change)
+		})
+	}
+
+	_, err := classifySpotPriceChange(aws.String("invalid"), aws.String("0.1"))
+	assert.Error(t, err)
+}
@@ -0,0 +1,78 @@
+package updatestrategy
+
+import (
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// DeferTerminationAnnotation is the annotation workloads can set on a node to
+// postpone its termination during an update until the RFC 3339 timestamp
+// given as value, e.g. '2018-06-01T12:00:00Z'. The node is neither cordoned
+// nor drained before the deadline passed or the annotation is removed.
+const DeferTerminationAnnotation = "clm.zalando.org/defer-termination-until"
+
+// terminationDeferredUntil returns the deadline of the defer termination
+// annotation of the node. The zero time is returned if the node isn't
+// annotated or the annotation is invalid.
+func terminationDeferredUntil(logger *log.Entry, node *v1.Node) time.Time {
+	return deadlineAnnotation(logger, node, DeferTerminationAnnotation)
+}
+
+// deadlineAnnotation returns the RFC 3339 deadline of the annotation of the
+// node. The zero time is returned if the node isn't annotated or the
+// annotation is invalid.
+func deadlineAnnotation(logger *log.Entry, node *v1.Node, annotation string) time.Time {
+	value, ok := node.Annotations[annotation]
+	if !ok {
+		return time.Time{}
+	}
+
+	deadline, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		logger.Warnf("Ignoring invalid %s annotation of node %s: %v", annotation, node.Name, err)
+		return time.Time{}
+	}
+
+	return deadline
+}
+
+// TerminationDeferred returns true if the termination of the node is
+// deferred beyond now. The termination of nodes protected from scale down is
+// deferred until the deadline of their protection, which is unknown until
+// the protection started.
+func (n *Node) TerminationDeferred(now time.Time) bool {
+	if n.ScaleDownProtected && (n.ScaleDownProtectionDeadline.IsZero() || now.Before(n.ScaleDownProtectionDeadline)) {
+		return true
+	}
+	return now.Before(n.TerminationDeferredUntil)
+}
+
+// TerminationDeadline returns the time until which the termination of the
+// node is deferred.
+func (n *Node) TerminationDeadline() time.Time {
+	if n.ScaleDownProtected && n.ScaleDownProtectionDeadline.After(n.TerminationDeferredUntil) {
+		return n.ScaleDownProtectionDeadline
+	}
+	return n.TerminationDeferredUntil
+}
+
+// splitDeferredNodes splits a slice of nodes into two slices of nodes whose
+// termination is currently deferred and nodes which can be terminated.
+func splitDeferredNodes(nodes []*Node) ([]*Node, []*Node) {
+	now := time.Now()
+
+	deferred := make([]*Node, 0)
+	other := make([]*Node, 0, len(nodes))
+
+	for _, node := range nodes {
+		if node.TerminationDeferred(now) {
+			deferred = append(deferred, node)
+		} else {
+			other = append(other, node)
+		}
+	}
+
+	return deferred, other
+}
@@ -0,0 +1,69 @@
+package updatestrategy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+func TestTerminationDeferredUntil(t *testing.T) {
+	logger := log.WithField("test", true)
+	deadline := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		msg         string
+		annotations map[string]string
+		expected    time.Time
+	}{
+		{
+			msg:         "test deadline",
+			annotations: map[string]string{DeferTerminationAnnotation: "2018-06-01T12:00:00Z"},
+			expected:    deadline,
+		},
+		{
+			msg: "test no annotation",
+		},
+		{
+			msg:         "test invalid deadline",
+			annotations: map[string]string{DeferTerminationAnnotation: "tomorrow"},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Name: "test", Annotations: tc.annotations}}
+			assert.True(t, terminationDeferredUntil(logger, node).Equal(tc.expected))
+		})
+	}
+}
+
+func TestUpdateDeferredTermination(t *testing.T) {
+	defer func(interval time.Duration) { operationCheckInterval = interval }(operationCheckInterval)
+	operationCheckInterval = 10 * time.Millisecond
+
+	logger := log.WithField("test", true)
+	np := &api.NodePool{Name: "test", MaxSize: 20}
+
+	nodePool := mockLargeNodePool(2)
+	deferred := nodePool.Nodes[0]
+	deferred.TerminationDeferredUntil = time.Now().Add(100 * time.Millisecond)
+
+	manager := &mockNodePoolManager{nodePool: nodePool}
+	strategy := NewRollingUpdateStrategy(logger, manager, nil, nil, nil, 1, 0, 0, 0, 0)
+
+	// the deferred node is left out while its deadline didn't pass.
+	toCordon, _ := strategy.computeNodesList(nodePool, 2)
+	assert.Len(t, toCordon, 1)
+	assert.NotEqual(t, deferred.ProviderID, toCordon[0].ProviderID)
+
+	err := strategy.Update(context.Background(), np)
+	assert.NoError(t, err)
+	assert.False(t, time.Now().Before(deferred.TerminationDeferredUntil))
+
+	oldNodes, _ := strategy.splitOldNewNodes(manager.nodePool)
+	assert.Len(t, oldNodes, 0)
+}
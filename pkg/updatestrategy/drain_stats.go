@@ -0,0 +1,75 @@
+package updatestrategy
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// maxDrainStatsSamples limits the weight of the history when
+	// aggregating drain times such that the average follows recent
+	// changes.
+	maxDrainStatsSamples = 20
+	// minDrainStatsSamples is the number of samples needed before a drain
+	// time can be considered a regression.
+	minDrainStatsSamples = 3
+	// drainRegressionFactor defines how much slower than the average a
+	// drain must be to be considered a regression.
+	drainRegressionFactor = 2
+)
+
+// DrainStats are the aggregated times it took to drain a node and boot its
+// replacement for a node pool.
+type DrainStats struct {
+	Samples int
+	Average time.Duration
+}
+
+// DrainStatsStore persists drain statistics per node pool.
+type DrainStatsStore interface {
+	GetDrainStats(nodePool *api.NodePool) (*DrainStats, error)
+	SetDrainStats(nodePool *api.NodePool, stats *DrainStats) error
+}
+
+// Add adds a drain time sample to the aggregated stats.
+func (s *DrainStats) Add(duration time.Duration) {
+	if s.Samples < maxDrainStatsSamples {
+		s.Samples++
+	}
+	s.Average += (duration - s.Average) / time.Duration(s.Samples)
+}
+
+// IsRegression returns true if the drain time is significantly slower than the
+// average of the previous drains.
+func (s *DrainStats) IsRegression(duration time.Duration) bool {
+	return s.Samples >= minDrainStatsSamples && duration > drainRegressionFactor*s.Average
+}
+
+// String encodes the stats as '<samples>/<average>'.
+func (s *DrainStats) String() string {
+	return fmt.Sprintf("%d/%s", s.Samples, s.Average)
+}
+
+// parseDrainStats parses drain stats encoded as '<samples>/<average>'.
+func parseDrainStats(value string) (*DrainStats, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid drain stats '%s'", value)
+	}
+
+	samples, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid drain stats '%s': %v", value, err)
+	}
+
+	average, err := time.ParseDuration(parts[1])
+	if err != nil {
+		return nil, fmt.Errorf("invalid drain stats '%s': %v", value, err)
+	}
+
+	return &DrainStats{Samples: samples, Average: average}, nil
+}
@@ -0,0 +1,65 @@
+package updatestrategy
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDrainStatsAdd(t *testing.T) {
+	stats := &DrainStats{}
+	stats.Add(2 * time.Minute)
+	stats.Add(4 * time.Minute)
+	assert.Equal(t, 2, stats.Samples)
+	assert.Equal(t, 3*time.Minute, stats.Average)
+
+	// samples are capped so the average follows recent drain times
+	stats = &DrainStats{Samples: maxDrainStatsSamples, Average: time.Minute}
+	stats.Add(21 * time.Minute)
+	assert.Equal(t, maxDrainStatsSamples, stats.Samples)
+	assert.Equal(t, 2*time.Minute, stats.Average)
+}
+
+func TestDrainStatsIsRegression(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		stats    *DrainStats
+		duration time.Duration
+		expected bool
+	}{
+		{
+			msg:      "test not enough samples",
+			stats:    &DrainStats{Samples: 1, Average: time.Minute},
+			duration: time.Hour,
+			expected: false,
+		},
+		{
+			msg:      "test drain time within the average",
+			stats:    &DrainStats{Samples: 5, Average: time.Minute},
+			duration: 90 * time.Second,
+			expected: false,
+		},
+		{
+			msg:      "test drain time regressed",
+			stats:    &DrainStats{Samples: 5, Average: time.Minute},
+			duration: 3 * time.Minute,
+			expected: true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			assert.Equal(t, tc.expected, tc.stats.IsRegression(tc.duration))
+		})
+	}
+}
+
+func TestParseDrainStats(t *testing.T) {
+	stats, err := parseDrainStats((&DrainStats{Samples: 3, Average: 90 * time.Second}).String())
+	assert.NoError(t, err)
+	assert.Equal(t, &DrainStats{Samples: 3, Average: 90 * time.Second}, stats)
+
+	for _, value := range []string{"", "3", "a/1m", "3/b"} {
+		_, err := parseDrainStats(value)
+		assert.Error(t, err)
+	}
+}
@@ -0,0 +1,172 @@
+package updatestrategy
+
+import (
+	"fmt"
+	"sync"
+	"time"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// evictionRateLimitedError is returned when a pod isn't evicted because a pod
+// of the same namespace was evicted too recently.
+type evictionRateLimitedError struct {
+	namespace string
+}
+
+func (e *evictionRateLimitedError) Error() string {
+	return fmt.Sprintf("eviction rate limit of namespace %s exceeded", e.namespace)
+}
+
+// isEvictionRateLimitedErr returns true if the error is caused by the
+// namespace eviction rate limit.
+func isEvictionRateLimitedErr(err error) bool {
+	_, ok := err.(*evictionRateLimitedError)
+	return ok
+}
+
+// namespaceEvictionLimiter limits the evictions of pods not covered by a
+// PodDisruptionBudget to one per namespace and interval, such that draining
+// nodes doesn't evict all replicas of a small namespace at once. The
+// evictions are tracked across the drained nodes.
+type namespaceEvictionLimiter struct {
+	sync.Mutex
+	interval      time.Duration
+	now           func() time.Time
+	lastEvictions map[string]time.Time
+}
+
+// newNamespaceEvictionLimiter initializes a new namespace eviction limiter.
+// An interval of zero disables the limit.
+func newNamespaceEvictionLimiter(interval time.Duration) *namespaceEvictionLimiter {
+	return &namespaceEvictionLimiter{
+		interval:      interval,
+		now:           time.Now,
+		lastEvictions: make(map[string]time.Time),
+	}
+}
+
+// enabled returns true if the evictions are limited.
+func (l *namespaceEvictionLimiter) enabled() bool {
+	return l != nil && l.interval > 0
+}
+
+// allow returns true and records the eviction if a pod of the namespace can
+// be evicted.
+func (l *namespaceEvictionLimiter) allow(namespace string) bool {
+	if !l.enabled() {
+		return true
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	now := l.now()
+	if last, ok := l.lastEvictions[namespace]; ok && now.Sub(last) < l.interval {
+		return false
+	}
+
+	l.lastEvictions[namespace] = now
+	return true
+}
+
+// limitEviction returns an evictionRateLimitedError if the pod is not
+// covered by a PodDisruptionBudget and another pod of its namespace was
+// evicted within the interval of the limiter.
+func (m *KubernetesNodePoolManager) limitEviction(pod *v1.Pod) error {
+	if !m.evictionLimiter.enabled() {
+		return nil
+	}
+
+	covered, err := m.hasPodDisruptionBudget(pod)
+	if err != nil {
+		return err
+	}
+
+	if covered || m.evictionLimiter.allow(pod.Namespace) {
+		return nil
+	}
+
+	return &evictionRateLimitedError{namespace: pod.Namespace}
+}
+
+// hasPodDisruptionBudget returns true if the pod is selected by a
+// PodDisruptionBudget.
+func (m *KubernetesNodePoolManager) hasPodDisruptionBudget(pod *v1.Pod) (bool, error) {
+	pdbs, err := m.kube.PolicyV1beta1().PodDisruptionBudgets(pod.Namespace).List(metav1.ListOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	for _, pdb := range pdbs.Items {
+		selector, err := metav1.LabelSelectorAsSelector(pdb.Spec.Selector)
+		if err != nil {
+			return false, err
+		}
+
+		// an empty selector doesn't select any pods.
+		if selector.Empty() {
+			continue
+		}
+
+		if selector.Matches(labels.Set(pod.Labels)) {
+			return true, nil
+		}
+	}
+
+	return false, nil
+}
+
+// evictionRateLimiter limits the pod evictions of an update to a maximum per
+// minute, such that large clusters don't overload their API server and
+// don't shift too many pods at once. The evictions are tracked across the
+// drained nodes of all node pools.
+type evictionRateLimiter struct {
+	sync.Mutex
+	perMinute int
+	now       func() time.Time
+	sleep     func(time.Duration)
+	evictions []time.Time
+}
+
+// newEvictionRateLimiter initializes a new eviction rate limiter. A limit of
+// zero disables the limiter.
+func newEvictionRateLimiter(perMinute int) *evictionRateLimiter {
+	return &evictionRateLimiter{
+		perMinute: perMinute,
+		now:       time.Now,
+		sleep:     time.Sleep,
+	}
+}
+
+// wait blocks until another pod can be evicted and records the eviction.
+func (l *evictionRateLimiter) wait() {
+	if l == nil || l.perMinute <= 0 {
+		return
+	}
+
+	l.Lock()
+	defer l.Unlock()
+
+	for {
+		now := l.now()
+
+		// forget the evictions older than a minute.
+		recent := l.evictions[:0]
+		for _, eviction := range l.evictions {
+			if now.Sub(eviction) < time.Minute {
+				recent = append(recent, eviction)
+			}
+		}
+		l.evictions = recent
+
+		if len(l.evictions) < l.perMinute {
+			l.evictions = append(l.evictions, now)
+			return
+		}
+
+		l.sleep(l.evictions[0].Add(time.Minute).Sub(now))
+	}
+}
@@ -0,0 +1,91 @@
+package updatestrategy
+
+import (
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+	policy "k8s.io/client-go/pkg/apis/policy/v1beta1"
+)
+
+func TestNamespaceEvictionLimiter(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	limiter := newNamespaceEvictionLimiter(time.Minute)
+	limiter.now = func() time.Time { return now }
+
+	assert.True(t, limiter.allow("teapot"))
+	assert.False(t, limiter.allow("teapot"))
+	assert.True(t, limiter.allow("kube-system"))
+
+	now = now.Add(time.Minute)
+	assert.True(t, limiter.allow("teapot"))
+
+	// a zero interval disables the limit.
+	limiter = newNamespaceEvictionLimiter(0)
+	assert.True(t, limiter.allow("teapot"))
+	assert.True(t, limiter.allow("teapot"))
+}
+
+func TestLimitEviction(t *testing.T) {
+	pod := func(name string, labels map[string]string) *v1.Pod {
+		return &v1.Pod{ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "teapot", Labels: labels}}
+	}
+
+	client := setupMockKubernetes(t, nil, nil)
+	_, err := client.PolicyV1beta1().PodDisruptionBudgets("teapot").Create(&policy.PodDisruptionBudget{
+		ObjectMeta: metav1.ObjectMeta{Name: "api", Namespace: "teapot"},
+		Spec: policy.PodDisruptionBudgetSpec{
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"application": "api"}},
+		},
+	})
+	require.NoError(t, err)
+
+	mgr := &KubernetesNodePoolManager{
+		kube:            client,
+		logger:          log.WithField("test", true),
+		evictionLimiter: newNamespaceEvictionLimiter(time.Hour),
+	}
+
+	assert.NoError(t, mgr.limitEviction(pod("worker-1", map[string]string{"application": "worker"})))
+
+	err = mgr.limitEviction(pod("worker-2", map[string]string{"application": "worker"}))
+	assert.True(t, isEvictionRateLimitedErr(err))
+
+	// pods covered by a PDB are not limited.
+	assert.NoError(t, mgr.limitEviction(pod("api-1", map[string]string{"application": "api"})))
+	assert.NoError(t, mgr.limitEviction(pod("api-2", map[string]string{"application": "api"})))
+
+	// without a limiter evictions are not limited.
+	mgr.evictionLimiter = nil
+	assert.NoError(t, mgr.limitEviction(pod("worker-3", map[string]string{"application": "worker"})))
+}
+
+func TestEvictionRateLimiter(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	var slept []time.Duration
+
+	limiter := newEvictionRateLimiter(2)
+	limiter.now = func() time.Time { return now }
+	limiter.sleep = func(d time.Duration) {
+		slept = append(slept, d)
+		now = now.Add(d)
+	}
+
+	limiter.wait()
+	now = now.Add(20 * time.Second)
+	limiter.wait()
+	assert.Empty(t, slept)
+
+	// the third eviction has to wait for the first one to leave the window.
+	limiter.wait()
+	assert.Equal(t, []time.Duration{40 * time.Second}, slept)
+
+	// a zero limit and a nil limiter don't block.
+	newEvictionRateLimiter(0).wait()
+	var nilLimiter *evictionRateLimiter
+	nilLimiter.wait()
+}
@@ -0,0 +1,65 @@
+package updatestrategy
+
+import "sort"
+
+// availableNodes returns the number of ready and schedulable nodes per
+// failure domain.
+func availableNodes(nodes []*Node) map[string]int {
+	available := make(map[string]int)
+	for _, node := range nodes {
+		if node.Ready && !node.Cordoned {
+			available[node.FailureDomain]++
+		}
+	}
+	return available
+}
+
+// spreadFailureDomains orders the nodes to replace such that the batches
+// are spread across the failure domains: the nodes are taken round-robin
+// from their failure domains, starting with the domain with the most nodes.
+// Nodes which are the last available node of their failure domain, counting
+// the nodes ordered before them, are moved to the end, such that a batch
+// only takes down all capacity of a failure domain if no other nodes are
+// left. available is updated with the nodes ordered. The order of the nodes
+// within a failure domain is kept.
+func spreadFailureDomains(nodes []*Node, available map[string]int) []*Node {
+	byDomain := make(map[string][]*Node)
+	var domains []string
+	for _, node := range nodes {
+		if _, ok := byDomain[node.FailureDomain]; !ok {
+			domains = append(domains, node.FailureDomain)
+		}
+		byDomain[node.FailureDomain] = append(byDomain[node.FailureDomain], node)
+	}
+
+	sort.SliceStable(domains, func(i, j int) bool {
+		if len(byDomain[domains[i]]) != len(byDomain[domains[j]]) {
+			return len(byDomain[domains[i]]) > len(byDomain[domains[j]])
+		}
+		return domains[i] < domains[j]
+	})
+
+	spread := make([]*Node, 0, len(nodes))
+	var last []*Node
+	for len(spread)+len(last) < len(nodes) {
+		for _, domain := range domains {
+			if len(byDomain[domain]) == 0 {
+				continue
+			}
+
+			node := byDomain[domain][0]
+			byDomain[domain] = byDomain[domain][1:]
+
+			if node.Ready && !node.Cordoned {
+				if available[domain] <= 1 {
+					last = append(last, node)
+					continue
+				}
+				available[domain]--
+			}
+			spread = append(spread, node)
+		}
+	}
+
+	return append(spread, last...)
+}
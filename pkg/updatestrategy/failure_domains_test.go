@@ -0,0 +1,91 @@
+package updatestrategy
+
+import (
+	"strings"
+	"testing"
+)
+
+func failureDomains(nodes []*Node) string {
+	domains := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		domains = append(domains, node.FailureDomain)
+	}
+	return strings.Join(domains, ",")
+}
+
+func TestSpreadFailureDomains(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		nodes    []*Node
+		newNodes []*Node
+		expected string
+	}{
+		{
+			msg: "nodes are taken round-robin from the failure domains",
+			nodes: []*Node{
+				mockNode("a", 1, false, false),
+				mockNode("a", 1, false, false),
+				mockNode("a", 1, false, false),
+				mockNode("b", 1, false, false),
+				mockNode("b", 1, false, false),
+				mockNode("c", 1, false, false),
+			},
+			newNodes: []*Node{
+				mockNode("b", 2, false, false),
+				mockNode("c", 2, false, false),
+			},
+			expected: "a,b,c,a,b,a",
+		},
+		{
+			msg: "the last available node of a failure domain is replaced last",
+			nodes: []*Node{
+				mockNode("a", 1, false, false),
+				mockNode("b", 1, false, false),
+				mockNode("b", 1, false, false),
+			},
+			expected: "b,a,b",
+		},
+		{
+			msg: "cordoned nodes don't count as available",
+			nodes: []*Node{
+				mockNode("a", 1, true, false),
+				mockNode("a", 1, false, false),
+				mockNode("b", 1, false, false),
+			},
+			newNodes: []*Node{
+				mockNode("b", 2, false, false),
+			},
+			expected: "a,b,a",
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			available := availableNodes(append(tc.nodes, tc.newNodes...))
+			spread := spreadFailureDomains(tc.nodes, available)
+			if len(spread) != len(tc.nodes) {
+				t.Fatalf("expected %d nodes, got %d", len(tc.nodes), len(spread))
+			}
+			if domains := failureDomains(spread); domains != tc.expected {
+				t.Errorf("expected failure domains %s, got %s", tc.expected, domains)
+			}
+		})
+	}
+}
+
+func TestComputeNodesListSpreadsFailureDomains(t *testing.T) {
+	nodePool := &NodePool{
+		Generation: 2,
+		Desired:    4,
+		Nodes: []*Node{
+			mockNode("a", 1, false, false),
+			mockNode("a", 1, false, false),
+			mockNode("b", 1, false, false),
+			mockNode("b", 1, false, false),
+		},
+	}
+
+	strategy := NewRollingUpdateStrategy(nil, &mockNodePoolManager{nodePool: nodePool}, nil, nil, nil, 2, 0, 0, 0, 0)
+	toCordon, _ := strategy.computeNodesList(nodePool, 2)
+	if domains := failureDomains(toCordon); domains != "a,b" {
+		t.Errorf("expected a batch spanning both failure domains, got %s", domains)
+	}
+}
@@ -0,0 +1,295 @@
+package updatestrategy
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/gce"
+)
+
+const (
+	// the names of the project metadata items storing the state of node
+	// pools, encoded like the corresponding ASG tags.
+	migDrainStatsMetadata        = "drain-stats"
+	migBootstrapFailuresMetadata = "bootstrap-failures"
+	migRolloutProgressMetadata   = "rollout-progress"
+)
+
+// MIGNodePoolsBackend defines a node pool backed by a regional GCE managed
+// instance group. Managed instance groups can't be labeled, so the drain
+// statistics, bootstrap failures and rollout progress are stored in the
+// project metadata instead, such that they survive a restart.
+type MIGNodePoolsBackend struct {
+	compute gce.ComputeAPI
+	project string
+	region  string
+	localID string
+}
+
+// NewMIGNodePoolsBackend initializes a new MIGNodePoolsBackend for the
+// cluster in the project and region.
+func NewMIGNodePoolsBackend(compute gce.ComputeAPI, project, region, localID string) *MIGNodePoolsBackend {
+	return &MIGNodePoolsBackend{
+		compute: compute,
+		project: project,
+		region:  region,
+		localID: localID,
+	}
+}
+
+// Get gets the managed instance group of the node pool and all its
+// instances. The node generation is set to 'current' for instances created
+// from the instance template of the group and 'outdated' for all others.
+func (n *MIGNodePoolsBackend) Get(nodePool *api.NodePool) (*NodePool, error) {
+	name := gce.InstanceGroupManagerName(n.localID, nodePool.Name)
+	manager, err := n.compute.GetInstanceGroupManager(context.Background(), n.project, n.region, name)
+	if err != nil {
+		return nil, err
+	}
+
+	instances, err := n.compute.ListManagedInstances(context.Background(), n.project, n.region, name)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*Node, 0, len(instances))
+	for _, instance := range instances {
+		node := &Node{
+			ProviderID:    fmt.Sprintf("gce://%s/%s/%s", n.project, instance.Zone(), instance.Name()),
+			FailureDomain: instance.Zone(),
+			Generation:    currentNodeGeneration,
+			Ready:         instance.InstanceStatus == gce.InstanceStatusRunning && instance.CurrentAction == gce.InstanceActionNone,
+		}
+
+		if !gce.SameInstanceTemplate(instance.Version.InstanceTemplate, manager.InstanceTemplate) {
+			node.Generation = outdatedNodeGeneration
+		}
+
+		nodes = append(nodes, node)
+	}
+
+	// managed instance groups don't have a min and max size, the target
+	// size is kept within the limits of the node pool instead.
+	return &NodePool{
+		Min:        int(nodePool.MinSize),
+		Max:        int(nodePool.MaxSize),
+		Desired:    int(manager.TargetSize),
+		Current:    len(nodes),
+		Generation: currentNodeGeneration,
+		Nodes:      nodes,
+	}, nil
+}
+
+// Scale sets the target size of the managed instance group to the number of
+// replicas.
+func (n *MIGNodePoolsBackend) Scale(nodePool *api.NodePool, replicas int) error {
+	name := gce.InstanceGroupManagerName(n.localID, nodePool.Name)
+	operation, err := n.compute.Resize(context.Background(), n.project, n.region, name, int64(replicas))
+	if err != nil {
+		return err
+	}
+
+	return n.compute.WaitOperation(context.Background(), operation)
+}
+
+// Terminate deletes the instance of a node from its managed instance group.
+// Unless decrementDesired is set, the target size is restored afterwards
+// such that the group creates a replacement instance.
+func (n *MIGNodePoolsBackend) Terminate(node *Node, decrementDesired bool) error {
+	project, zone, instance, err := parseGCEProviderID(node.ProviderID)
+	if err != nil {
+		return err
+	}
+
+	// instances are named after the managed instance group with a random
+	// suffix.
+	split := strings.LastIndex(instance, "-")
+	if split == -1 {
+		return fmt.Errorf("instance %s is not part of a managed instance group", instance)
+	}
+	name := instance[:split]
+
+	manager, err := n.compute.GetInstanceGroupManager(context.Background(), n.project, n.region, name)
+	if err != nil {
+		return err
+	}
+
+	instanceURL := fmt.Sprintf("projects/%s/zones/%s/instances/%s", project, zone, instance)
+	operation, err := n.compute.DeleteInstances(context.Background(), n.project, n.region, name, []string{instanceURL})
+	if err != nil {
+		return err
+	}
+
+	err = n.compute.WaitOperation(context.Background(), operation)
+	if err != nil {
+		return err
+	}
+
+	if decrementDesired {
+		return nil
+	}
+
+	operation, err = n.compute.Resize(context.Background(), n.project, n.region, name, manager.TargetSize)
+	if err != nil {
+		return err
+	}
+
+	return n.compute.WaitOperation(context.Background(), operation)
+}
+
+// GetDrainStats gets the drain statistics of a node pool. Empty stats are
+// returned if the node pool wasn't drained yet.
+func (n *MIGNodePoolsBackend) GetDrainStats(nodePool *api.NodePool) (*DrainStats, error) {
+	value, ok, err := n.getMetadata(nodePool, migDrainStatsMetadata)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return &DrainStats{}, nil
+	}
+	return parseDrainStats(value)
+}
+
+// SetDrainStats stores the drain statistics of a node pool.
+func (n *MIGNodePoolsBackend) SetDrainStats(nodePool *api.NodePool, stats *DrainStats) error {
+	return n.setMetadata(nodePool, migDrainStatsMetadata, stats.String())
+}
+
+// GetBootstrapFailures gets the number of consecutive bootstrap failures of a
+// node pool. The failures are only returned if they were recorded for the
+// instance template currently used by the managed instance group.
+func (n *MIGNodePoolsBackend) GetBootstrapFailures(nodePool *api.NodePool) (int, error) {
+	value, ok, err := n.getMetadata(nodePool, migBootstrapFailuresMetadata)
+	if err != nil || !ok {
+		return 0, err
+	}
+
+	parts := strings.SplitN(value, "/", 2)
+	if len(parts) != 2 {
+		return 0, fmt.Errorf("invalid bootstrap failures '%s'", value)
+	}
+
+	failures, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return 0, fmt.Errorf("invalid bootstrap failures '%s': %v", value, err)
+	}
+
+	current, err := n.currentInstanceTemplate(nodePool)
+	if err != nil {
+		return 0, err
+	}
+
+	if !gce.SameInstanceTemplate(parts[1], current) {
+		return 0, nil
+	}
+
+	return failures, nil
+}
+
+// SetBootstrapFailures stores the number of consecutive bootstrap failures
+// of a node pool for the current instance template of its managed instance
+// group. The failures are removed if there are none.
+func (n *MIGNodePoolsBackend) SetBootstrapFailures(nodePool *api.NodePool, failures int) error {
+	if failures == 0 {
+		return n.setMetadata(nodePool, migBootstrapFailuresMetadata, "")
+	}
+
+	current, err := n.currentInstanceTemplate(nodePool)
+	if err != nil {
+		return err
+	}
+
+	return n.setMetadata(nodePool, migBootstrapFailuresMetadata, fmt.Sprintf("%d/%s", failures, current))
+}
+
+// GetRolloutProgress gets the progress of the update of a node pool. The
+// progress is only returned if it was recorded for the instance template
+// currently used by the managed instance group.
+func (n *MIGNodePoolsBackend) GetRolloutProgress(nodePool *api.NodePool) (*RolloutProgress, error) {
+	value, ok, err := n.getMetadata(nodePool, migRolloutProgressMetadata)
+	if err != nil {
+		return nil, err
+	}
+	if !ok {
+		return &RolloutProgress{}, nil
+	}
+
+	parts := strings.SplitN(value, "/", 3)
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid rollout progress '%s'", value)
+	}
+
+	current, err := n.currentInstanceTemplate(nodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	if !gce.SameInstanceTemplate(parts[2], current) {
+		return &RolloutProgress{}, nil
+	}
+
+	return parseRolloutProgress(parts[0] + "/" + parts[1])
+}
+
+// SetRolloutProgress stores the progress of the update of a node pool for
+// the current instance template of its managed instance group. The progress
+// is removed if nothing was checkpointed.
+func (n *MIGNodePoolsBackend) SetRolloutProgress(nodePool *api.NodePool, progress *RolloutProgress) error {
+	if progress.empty() {
+		return n.setMetadata(nodePool, migRolloutProgressMetadata, "")
+	}
+
+	current, err := n.currentInstanceTemplate(nodePool)
+	if err != nil {
+		return err
+	}
+
+	return n.setMetadata(nodePool, migRolloutProgressMetadata, fmt.Sprintf("%s/%s", progress, current))
+}
+
+// currentInstanceTemplate returns the name of the instance template used by
+// the managed instance group of the node pool.
+func (n *MIGNodePoolsBackend) currentInstanceTemplate(nodePool *api.NodePool) (string, error) {
+	manager, err := n.compute.GetInstanceGroupManager(context.Background(), n.project, n.region, gce.InstanceGroupManagerName(n.localID, nodePool.Name))
+	if err != nil {
+		return "", err
+	}
+	return manager.InstanceTemplate[strings.LastIndex(manager.InstanceTemplate, "/")+1:], nil
+}
+
+// getMetadata gets the value of a project metadata item of the node pool.
+func (n *MIGNodePoolsBackend) getMetadata(nodePool *api.NodePool, name string) (string, bool, error) {
+	metadata, err := n.compute.GetProjectMetadata(context.Background(), n.project)
+	if err != nil {
+		return "", false, err
+	}
+
+	value, ok := metadata.Value(gce.NodePoolMetadataKey(n.localID, nodePool.Name, name))
+	return value, ok, nil
+}
+
+// setMetadata sets the value of a project metadata item of the node pool,
+// the item is removed if the value is empty.
+func (n *MIGNodePoolsBackend) setMetadata(nodePool *api.NodePool, name, value string) error {
+	key := gce.NodePoolMetadataKey(n.localID, nodePool.Name, name)
+	return gce.UpdateProjectMetadata(context.Background(), n.compute, n.project, func(items map[string]string) {
+		if value == "" {
+			delete(items, key)
+			return
+		}
+		items[key] = value
+	})
+}
+
+// parseGCEProviderID parses the project, zone and instance name from a
+// provider ID of the format gce://<project>/<zone>/<instance>.
+func parseGCEProviderID(providerID string) (string, string, string, error) {
+	parts := strings.Split(strings.TrimPrefix(providerID, "gce://"), "/")
+	if !strings.HasPrefix(providerID, "gce://") || len(parts) != 3 {
+		return "", "", "", fmt.Errorf("invalid GCE provider ID '%s'", providerID)
+	}
+	return parts[0], parts[1], parts[2], nil
+}
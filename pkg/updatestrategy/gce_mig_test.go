@@ -0,0 +1,176 @@
+package updatestrategy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/gce"
+)
+
+type mockComputeAPI struct {
+	gce.ComputeAPI
+	manager   *gce.InstanceGroupManager
+	instances []*gce.ManagedInstance
+	deleted   []string
+	resized   []int64
+	metadata  gce.Metadata
+}
+
+func (c *mockComputeAPI) GetInstanceGroupManager(ctx context.Context, project, region, name string) (*gce.InstanceGroupManager, error) {
+	if c.manager == nil || c.manager.Name != name {
+		return nil, &gce.Error{Code: 404, Message: "not found"}
+	}
+	return c.manager, nil
+}
+
+func (c *mockComputeAPI) ListManagedInstances(ctx context.Context, project, region, name string) ([]*gce.ManagedInstance, error) {
+	return c.instances, nil
+}
+
+func (c *mockComputeAPI) Resize(ctx context.Context, project, region, name string, size int64) (*gce.Operation, error) {
+	c.resized = append(c.resized, size)
+	return &gce.Operation{}, nil
+}
+
+func (c *mockComputeAPI) DeleteInstances(ctx context.Context, project, region, name string, instances []string) (*gce.Operation, error) {
+	c.deleted = append(c.deleted, instances...)
+	return &gce.Operation{}, nil
+}
+
+func (c *mockComputeAPI) GetProjectMetadata(ctx context.Context, project string) (*gce.Metadata, error) {
+	metadata := c.metadata
+	return &metadata, nil
+}
+
+func (c *mockComputeAPI) SetProjectMetadata(ctx context.Context, project string, metadata *gce.Metadata) (*gce.Operation, error) {
+	c.metadata = *metadata
+	return &gce.Operation{}, nil
+}
+
+func (c *mockComputeAPI) WaitOperation(ctx context.Context, operation *gce.Operation) error {
+	return nil
+}
+
+func managedInstance(name, status, action, template string) *gce.ManagedInstance {
+	instance := &gce.ManagedInstance{
+		Instance:       "https://www.googleapis.com/compute/v1/projects/foo/zones/europe-west1-b/instances/" + name,
+		InstanceStatus: status,
+		CurrentAction:  action,
+	}
+	instance.Version.InstanceTemplate = "https://www.googleapis.com/compute/v1/projects/foo/global/instanceTemplates/" + template
+	return instance
+}
+
+func TestMIGNodePoolsBackendGet(t *testing.T) {
+	compute := &mockComputeAPI{
+		manager: &gce.InstanceGroupManager{
+			Name:             "kube-1-default",
+			InstanceTemplate: gce.InstanceTemplateURL("foo", "kube-1-default-new"),
+			TargetSize:       3,
+		},
+		instances: []*gce.ManagedInstance{
+			managedInstance("kube-1-default-a", gce.InstanceStatusRunning, gce.InstanceActionNone, "kube-1-default-new"),
+			managedInstance("kube-1-default-b", gce.InstanceStatusRunning, gce.InstanceActionNone, "kube-1-default-old"),
+			managedInstance("kube-1-default-c", "STAGING", "CREATING", "kube-1-default-new"),
+		},
+	}
+	backend := NewMIGNodePoolsBackend(compute, "foo", "europe-west1", "kube-1")
+
+	pool, err := backend.Get(&api.NodePool{Name: "default", MinSize: 1, MaxSize: 10})
+	require.NoError(t, err)
+	assert.Equal(t, 1, pool.Min)
+	assert.Equal(t, 10, pool.Max)
+	assert.Equal(t, 3, pool.Desired)
+	require.Len(t, pool.Nodes, 3)
+
+	assert.Equal(t, "gce://foo/europe-west1-b/kube-1-default-a", pool.Nodes[0].ProviderID)
+	assert.Equal(t, "europe-west1-b", pool.Nodes[0].FailureDomain)
+	assert.Equal(t, currentNodeGeneration, pool.Nodes[0].Generation)
+	assert.True(t, pool.Nodes[0].Ready)
+	assert.Equal(t, outdatedNodeGeneration, pool.Nodes[1].Generation)
+	assert.False(t, pool.Nodes[2].Ready)
+
+	_, err = backend.Get(&api.NodePool{Name: "missing"})
+	assert.True(t, gce.IsNotFound(err))
+}
+
+func TestMIGNodePoolsBackendTerminate(t *testing.T) {
+	compute := &mockComputeAPI{
+		manager: &gce.InstanceGroupManager{Name: "kube-1-default", TargetSize: 3},
+	}
+	backend := NewMIGNodePoolsBackend(compute, "foo", "europe-west1", "kube-1")
+	node := &Node{ProviderID: "gce://foo/europe-west1-b/kube-1-default-a"}
+
+	require.NoError(t, backend.Terminate(node, true))
+	assert.Equal(t, []string{"projects/foo/zones/europe-west1-b/instances/kube-1-default-a"}, compute.deleted)
+	assert.Empty(t, compute.resized)
+
+	// the target size is restored to replace the instance.
+	require.NoError(t, backend.Terminate(node, false))
+	assert.Equal(t, []int64{3}, compute.resized)
+
+	assert.Error(t, backend.Terminate(&Node{ProviderID: "aws:///eu-central-1a/i-123"}, true))
+}
+
+func TestMIGNodePoolsBackendBootstrapFailures(t *testing.T) {
+	compute := &mockComputeAPI{
+		manager: &gce.InstanceGroupManager{Name: "kube-1-default", InstanceTemplate: gce.InstanceTemplateURL("foo", "a")},
+	}
+	backend := NewMIGNodePoolsBackend(compute, "foo", "europe-west1", "kube-1")
+	nodePool := &api.NodePool{Name: "default"}
+
+	require.NoError(t, backend.SetBootstrapFailures(nodePool, 2))
+	failures, err := backend.GetBootstrapFailures(nodePool)
+	require.NoError(t, err)
+	assert.Equal(t, 2, failures)
+
+	// a new instance template unfreezes the node pool.
+	compute.manager.InstanceTemplate = gce.InstanceTemplateURL("foo", "b")
+	failures, err = backend.GetBootstrapFailures(nodePool)
+	require.NoError(t, err)
+	assert.Equal(t, 0, failures)
+}
+
+func TestMIGNodePoolsBackendState(t *testing.T) {
+	compute := &mockComputeAPI{
+		manager: &gce.InstanceGroupManager{Name: "kube-1-default", InstanceTemplate: gce.InstanceTemplateURL("foo", "a")},
+	}
+	nodePool := &api.NodePool{Name: "default"}
+
+	backend := NewMIGNodePoolsBackend(compute, "foo", "europe-west1", "kube-1")
+	require.NoError(t, backend.SetDrainStats(nodePool, &DrainStats{Samples: 2, Average: time.Minute}))
+	require.NoError(t, backend.SetBootstrapFailures(nodePool, 1))
+	progress := &RolloutProgress{Replaced: 2, StartedAt: time.Date(2026, 1, 2, 3, 4, 5, 0, time.UTC), Replacing: []string{"kube-1-default-a"}}
+	require.NoError(t, backend.SetRolloutProgress(nodePool, progress))
+
+	// the state is kept in the project metadata and survives a restart.
+	value, ok := compute.metadata.Value(gce.NodePoolMetadataKey("kube-1", "default", migBootstrapFailuresMetadata))
+	require.True(t, ok)
+	assert.Equal(t, "1/a", value)
+
+	backend = NewMIGNodePoolsBackend(compute, "foo", "europe-west1", "kube-1")
+	stats, err := backend.GetDrainStats(nodePool)
+	require.NoError(t, err)
+	assert.Equal(t, &DrainStats{Samples: 2, Average: time.Minute}, stats)
+	failures, err := backend.GetBootstrapFailures(nodePool)
+	require.NoError(t, err)
+	assert.Equal(t, 1, failures)
+	stored, err := backend.GetRolloutProgress(nodePool)
+	require.NoError(t, err)
+	assert.Equal(t, progress, stored)
+
+	// the progress of a previous instance template is ignored.
+	compute.manager.InstanceTemplate = gce.InstanceTemplateURL("foo", "b")
+	stored, err = backend.GetRolloutProgress(nodePool)
+	require.NoError(t, err)
+	assert.Equal(t, &RolloutProgress{}, stored)
+
+	// resetting the state removes the metadata items.
+	require.NoError(t, backend.SetBootstrapFailures(nodePool, 0))
+	require.NoError(t, backend.SetRolloutProgress(nodePool, &RolloutProgress{}))
+	assert.Len(t, compute.metadata.Items, 1)
+}
@@ -0,0 +1,102 @@
+package updatestrategy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+// ErrUnhealthyNodes is returned when the new nodes of a node pool didn't
+// become healthy within the node health timeout. The remaining old nodes are
+// left untouched.
+var ErrUnhealthyNodes = errors.New("new nodes are unhealthy")
+
+// CheckNodeHealth returns the problems preventing the node from running
+// workloads: the node isn't ready, is unschedulable, is still uninitialized,
+// reports kubelet problems or the pods of the DaemonSets which should run on
+// it aren't ready.
+func (m *KubernetesNodePoolManager) CheckNodeHealth(node *Node) ([]string, error) {
+	kubeNode, err := m.kube.CoreV1().Nodes().Get(node.Name, metav1.GetOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	var problems []string
+	if !v1.IsNodeReady(kubeNode) {
+		problems = append(problems, "not ready")
+	}
+	if kubeNode.Spec.Unschedulable {
+		problems = append(problems, "unschedulable")
+	}
+	if hasStartupTaint(node) {
+		problems = append(problems, "uninitialized")
+	}
+	problems = append(problems, nodeProblems(kubeNode)...)
+
+	daemonSets, err := m.unreadyDaemonSets(kubeNode)
+	if err != nil {
+		return nil, err
+	}
+	for _, ds := range daemonSets {
+		problems = append(problems, fmt.Sprintf("DaemonSet %s not ready", ds))
+	}
+
+	return problems, nil
+}
+
+// waitForHealthyNodes waits for the new nodes of the node pool to be healthy
+// before more old nodes are terminated, such that a broken node configuration
+// doesn't replace all nodes of the pool. It returns ErrUnhealthyNodes if the
+// nodes aren't healthy within the node health timeout. The check is disabled
+// if the timeout is zero.
+func (r *RollingUpdateStrategy) waitForHealthyNodes(ctx context.Context, nodePoolDesc *api.NodePool) error {
+	if r.nodeHealthTimeout <= 0 {
+		return nil
+	}
+
+	healthCtx, cancel := context.WithTimeout(ctx, r.nodeHealthTimeout)
+	defer cancel()
+
+	for {
+		nodePool, err := r.nodePoolManager.GetPool(nodePoolDesc)
+		if err != nil {
+			return err
+		}
+
+		var unhealthy []string
+		_, newNodes := r.splitOldNewNodes(nodePool)
+		for _, node := range newNodes {
+			problems, err := r.nodePoolManager.CheckNodeHealth(node)
+			if err != nil {
+				return err
+			}
+
+			if len(problems) > 0 {
+				unhealthy = append(unhealthy, fmt.Sprintf("%s (%s)", node.Name, strings.Join(problems, ", ")))
+			}
+		}
+
+		if len(unhealthy) == 0 {
+			return nil
+		}
+
+		api.ReportProgress(ctx, api.ProgressStepWaitingForNodesReady, nodePoolDesc.Name, fmt.Sprintf("Waiting for new nodes of node pool %s to be healthy", nodePoolDesc.Name))
+		r.logger.Infof("Waiting for new nodes of node pool '%s' to be healthy: %s", nodePoolDesc.Name, strings.Join(unhealthy, ", "))
+
+		select {
+		case <-healthCtx.Done():
+			if ctx.Err() != nil {
+				return errTimeoutExceeded
+			}
+			r.logger.Errorf("New nodes of node pool '%s' didn't become healthy within %s, stopping the update", nodePoolDesc.Name, r.nodeHealthTimeout)
+			return ErrUnhealthyNodes
+		case <-time.After(operationCheckInterval):
+		}
+	}
+}
@@ -0,0 +1,102 @@
+package updatestrategy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+func TestCheckNodeHealth(t *testing.T) {
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{Name: "test"},
+		Spec:       v1.NodeSpec{Unschedulable: true},
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionFalse, Reason: "KubeletNotReady"}},
+		},
+	}
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "flannel-abcde",
+			Namespace:       "kube-system",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "DaemonSet", Name: "flannel"}},
+		},
+		Spec: v1.PodSpec{NodeName: node.Name},
+		Status: v1.PodStatus{
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionFalse}},
+		},
+	}
+
+	client := setupMockKubernetes(t, []*v1.Node{node}, []*v1.Pod{pod})
+	mgr := &KubernetesNodePoolManager{
+		kube:   client,
+		logger: log.WithField("test", true),
+	}
+
+	_, err := client.ExtensionsV1beta1().DaemonSets("kube-system").Create(&extensions.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "flannel", Namespace: "kube-system"},
+	})
+	require.NoError(t, err)
+
+	// DaemonSets restricted to other nodes by their node affinity don't
+	// make the node unhealthy.
+	_, err = client.ExtensionsV1beta1().DaemonSets("kube-system").Create(&extensions.DaemonSet{
+		ObjectMeta: metav1.ObjectMeta{Name: "ebs-csi-controller", Namespace: "kube-system"},
+		Spec: extensions.DaemonSetSpec{
+			Template: v1.PodTemplateSpec{
+				Spec: v1.PodSpec{
+					Affinity: nodeAffinity(v1.NodeSelectorRequirement{Key: "role", Operator: v1.NodeSelectorOpIn, Values: []string{"master"}}),
+				},
+			},
+		},
+	})
+	require.NoError(t, err)
+
+	problems, err := mgr.CheckNodeHealth(&Node{Name: node.Name, Taints: []v1.Taint{{Key: StartupTaintKey}}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"not ready", "unschedulable", "uninitialized", "Ready: KubeletNotReady", "DaemonSet kube-system/flannel not ready"}, problems)
+
+	node.Spec.Unschedulable = false
+	node.Status.Conditions[0].Status = v1.ConditionTrue
+	_, err = client.CoreV1().Nodes().Update(node)
+	require.NoError(t, err)
+
+	pod.Status.Conditions[0].Status = v1.ConditionTrue
+	_, err = client.CoreV1().Pods(pod.Namespace).Update(pod)
+	require.NoError(t, err)
+
+	problems, err = mgr.CheckNodeHealth(&Node{Name: node.Name})
+	require.NoError(t, err)
+	assert.Empty(t, problems)
+}
+
+func TestUpdateNodeHealthGate(t *testing.T) {
+	logger := log.WithField("test", true)
+	np := &api.NodePool{Name: "test", MaxSize: 20}
+
+	store := &mockBootstrapFailureStore{}
+	manager := &unhealthyNodePoolManager{&mockNodePoolManager{nodePool: mockOutdatedNodePool()}}
+	strategy := NewRollingUpdateStrategy(logger, manager, nil, store, nil, 1, 0, 0, time.Millisecond, 0)
+	err := strategy.Update(context.Background(), np)
+	assert.Equal(t, ErrUnhealthyNodes, err)
+
+	oldNodes, _ := strategy.splitOldNewNodes(manager.nodePool)
+	assert.Len(t, oldNodes, 2, "the old nodes should be kept")
+	assert.Equal(t, 1, store.failures)
+
+	// the gate is disabled without a timeout
+	manager = &unhealthyNodePoolManager{&mockNodePoolManager{nodePool: mockOutdatedNodePool()}}
+	strategy = NewRollingUpdateStrategy(logger, manager, nil, nil, nil, 1, 0, 0, 0, 0)
+	require.NoError(t, strategy.Update(context.Background(), np))
+
+	oldNodes, _ = strategy.splitOldNewNodes(manager.nodePool)
+	assert.Empty(t, oldNodes)
+}
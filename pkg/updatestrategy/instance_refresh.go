@@ -0,0 +1,234 @@
+package updatestrategy
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// Statuses of an Instance Refresh.
+const (
+	InstanceRefreshStatusPending    = "Pending"
+	InstanceRefreshStatusInProgress = "InProgress"
+	InstanceRefreshStatusSuccessful = "Successful"
+	InstanceRefreshStatusFailed     = "Failed"
+	InstanceRefreshStatusCancelling = "Cancelling"
+	InstanceRefreshStatusCancelled  = "Cancelled"
+)
+
+// InstanceRefreshPreferences define how the provider replaces the nodes of a
+// node pool. At least MinHealthyPercentage of the nodes stay in service
+// during the refresh. The refresh waits for CheckpointDelay after it replaced
+// each of the Checkpoints percentages of the nodes. New instances are
+// considered in service after InstanceWarmup, or the health check grace
+// period of the node pool if zero.
+type InstanceRefreshPreferences struct {
+	MinHealthyPercentage int
+	Checkpoints          []int
+	CheckpointDelay      time.Duration
+	InstanceWarmup       time.Duration
+}
+
+// InstanceRefresh describes the refresh of the nodes of a node pool by the
+// provider.
+type InstanceRefresh struct {
+	ID                 string
+	Status             string
+	StatusReason       string
+	PercentageComplete int
+	InstancesToUpdate  int
+}
+
+// Active returns true if the refresh didn't finish yet.
+func (r *InstanceRefresh) Active() bool {
+	switch r.Status {
+	case InstanceRefreshStatusPending, InstanceRefreshStatusInProgress, InstanceRefreshStatusCancelling:
+		return true
+	}
+	return false
+}
+
+// InstanceRefreshBackend is a node pools provider backend which can replace
+// the nodes of a node pool itself, e.g. AWS Auto Scaling Groups with
+// Instance Refresh.
+type InstanceRefreshBackend interface {
+	ProviderNodePoolsBackend
+	StartInstanceRefresh(nodePool *api.NodePool, preferences *InstanceRefreshPreferences) (string, error)
+	GetInstanceRefresh(nodePool *api.NodePool) (*InstanceRefresh, error)
+	CancelInstanceRefresh(nodePool *api.NodePool) error
+}
+
+// ParseInstanceRefreshCheckpoints parses comma separated checkpoint
+// percentages, e.g. '20,50', in ascending order. The last checkpoint must be
+// 100 for the refresh to finish, so it's added if missing.
+func ParseInstanceRefreshCheckpoints(checkpoints string) ([]int, error) {
+	if checkpoints == "" {
+		return nil, nil
+	}
+
+	var result []int
+	for _, value := range strings.Split(checkpoints, ",") {
+		percentage, err := strconv.Atoi(strings.TrimSpace(value))
+		if err != nil || percentage < 1 || percentage > 100 {
+			return nil, fmt.Errorf("invalid instance refresh checkpoint '%s': must be a percentage between 1 and 100", value)
+		}
+		result = append(result, percentage)
+	}
+
+	sort.Ints(result)
+	if result[len(result)-1] != 100 {
+		result = append(result, 100)
+	}
+	return result, nil
+}
+
+// InstanceRefreshStrategy is a node update strategy which delegates the
+// replacement of the outdated nodes of a node pool to the provider. Unlike
+// the RollingUpdateStrategy it doesn't drain the nodes itself, they must be
+// drained on termination, e.g. by a lifecycle hook.
+type InstanceRefreshStrategy struct {
+	backend       InstanceRefreshBackend
+	preferences   InstanceRefreshPreferences
+	checkInterval time.Duration
+	logger        *log.Entry
+}
+
+// NewInstanceRefreshStrategy initializes a new InstanceRefreshStrategy
+// refreshing the node pools of the backend with the preferences.
+func NewInstanceRefreshStrategy(logger *log.Entry, backend InstanceRefreshBackend, preferences InstanceRefreshPreferences) *InstanceRefreshStrategy {
+	return &InstanceRefreshStrategy{
+		backend:       backend,
+		preferences:   preferences,
+		checkInterval: operationCheckInterval,
+		logger:        logger.WithField("strategy", "instance-refresh"),
+	}
+}
+
+// Plan returns the batches in which the outdated nodes are expected to be
+// replaced, as limited by the minimum healthy percentage.
+func (s *InstanceRefreshStrategy) Plan(ctx context.Context, nodePoolDesc *api.NodePool) (*UpdatePlan, error) {
+	plan := &UpdatePlan{
+		NodePool: nodePoolDesc.Name,
+	}
+
+	if nodePoolDesc.MaxSize < 1 {
+		return plan, nil
+	}
+
+	nodePool, err := s.backend.Get(nodePoolDesc)
+	if err != nil {
+		return nil, err
+	}
+
+	outdated := outdatedNodes(nodePool)
+	batch := int(math.Floor(float64(len(nodePool.Nodes)*(100-s.preferences.MinHealthyPercentage)) / 100))
+	if batch < 1 {
+		batch = 1
+	}
+
+	for len(outdated) > 0 {
+		size := int(math.Min(float64(batch), float64(len(outdated))))
+		plan.Batches = append(plan.Batches, outdated[:size])
+		outdated = outdated[size:]
+	}
+
+	if len(plan.Batches) > 0 {
+		plan.EstimatedDuration = time.Duration(len(plan.Batches)) * (defaultBatchDuration + s.preferences.InstanceWarmup)
+		// the refresh doesn't wait after the last checkpoint.
+		if len(s.preferences.Checkpoints) > 1 {
+			plan.EstimatedDuration += time.Duration(len(s.preferences.Checkpoints)-1) * s.preferences.CheckpointDelay
+		}
+	}
+	return plan, nil
+}
+
+// Update starts an Instance Refresh of the node pool if it has outdated nodes
+// and waits for it to finish, reporting its progress. A refresh started
+// earlier is waited for instead of starting a new one. If the updates of the
+// cluster are paused the refresh is cancelled and ErrUpdatePaused is
+// returned.
+func (s *InstanceRefreshStrategy) Update(ctx context.Context, nodePoolDesc *api.NodePool) error {
+	if nodePoolDesc.MaxSize < 1 {
+		return nil
+	}
+
+	// the instance refresh replaces the instances in place.
+	if isBlueGreen(nodePoolDesc) {
+		return fmt.Errorf("update mode %s of node pool %s isn't supported by instance refreshes", UpdateModeBlueGreen, nodePoolDesc.Name)
+	}
+
+	refresh, err := s.backend.GetInstanceRefresh(nodePoolDesc)
+	if err != nil {
+		return err
+	}
+
+	if refresh == nil || !refresh.Active() {
+		nodePool, err := s.backend.Get(nodePoolDesc)
+		if err != nil {
+			return err
+		}
+
+		outdated := len(outdatedNodes(nodePool))
+		if outdated == 0 {
+			return nil
+		}
+
+		s.logger.Infof("Starting instance refresh of node pool %s with %d outdated nodes", nodePoolDesc.Name, outdated)
+		_, err = s.backend.StartInstanceRefresh(nodePoolDesc, &s.preferences)
+		if err != nil {
+			return err
+		}
+	} else {
+		s.logger.Infof("Waiting for instance refresh %s of node pool %s", refresh.ID, nodePoolDesc.Name)
+	}
+
+	for {
+		refresh, err = s.backend.GetInstanceRefresh(nodePoolDesc)
+		if err != nil {
+			return err
+		}
+		if refresh == nil {
+			return fmt.Errorf("instance refresh of node pool %s not found", nodePoolDesc.Name)
+		}
+
+		switch refresh.Status {
+		case InstanceRefreshStatusSuccessful:
+			s.logger.Infof("Instance refresh %s of node pool %s succeeded", refresh.ID, nodePoolDesc.Name)
+			return nil
+		case InstanceRefreshStatusFailed, InstanceRefreshStatusCancelled:
+			return fmt.Errorf("instance refresh %s of node pool %s %s: %s", refresh.ID, nodePoolDesc.Name, strings.ToLower(refresh.Status), refresh.StatusReason)
+		}
+
+		api.ReportProgress(ctx, api.ProgressStepNodePoolUpdate, nodePoolDesc.Name, fmt.Sprintf("Instance refresh %s: %d%% complete, %d instances to update", refresh.ID, refresh.PercentageComplete, refresh.InstancesToUpdate))
+
+		paused, err := api.UpdatesPaused(ctx)
+		if err != nil {
+			return fmt.Errorf("failed to check if updates are paused: %v", err)
+		}
+		if paused {
+			s.logger.Warnf("Updates are paused, cancelling instance refresh %s of node pool '%s'", refresh.ID, nodePoolDesc.Name)
+			api.ReportProgress(ctx, api.ProgressStepPaused, nodePoolDesc.Name, fmt.Sprintf("Update of node pool %s paused", nodePoolDesc.Name))
+			if refresh.Status != InstanceRefreshStatusCancelling {
+				err := s.backend.CancelInstanceRefresh(nodePoolDesc)
+				if err != nil {
+					return err
+				}
+			}
+			return ErrUpdatePaused
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(s.checkInterval):
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package updatestrategy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// mockInstanceRefreshBackend implements the InstanceRefreshBackend interface
+// for testing. Every started refresh goes through the statuses, one per
+// check.
+type mockInstanceRefreshBackend struct {
+	mockProviderNodePoolsBackend
+	statuses    []string
+	refresh     *InstanceRefresh
+	started     int
+	cancelled   int
+	preferences *InstanceRefreshPreferences
+}
+
+func (m *mockInstanceRefreshBackend) StartInstanceRefresh(nodePool *api.NodePool, preferences *InstanceRefreshPreferences) (string, error) {
+	m.started++
+	m.preferences = preferences
+	m.refresh = &InstanceRefresh{ID: "refresh", Status: InstanceRefreshStatusPending}
+	return m.refresh.ID, nil
+}
+
+func (m *mockInstanceRefreshBackend) GetInstanceRefresh(nodePool *api.NodePool) (*InstanceRefresh, error) {
+	if m.refresh == nil {
+		return nil, nil
+	}
+	refresh := *m.refresh
+	if len(m.statuses) > 0 {
+		m.refresh.Status = m.statuses[0]
+		m.statuses = m.statuses[1:]
+	}
+	return &refresh, nil
+}
+
+func (m *mockInstanceRefreshBackend) CancelInstanceRefresh(nodePool *api.NodePool) error {
+	m.cancelled++
+	m.refresh.Status = InstanceRefreshStatusCancelling
+	return nil
+}
+
+func newTestInstanceRefreshStrategy(backend InstanceRefreshBackend, preferences InstanceRefreshPreferences) *InstanceRefreshStrategy {
+	strategy := NewInstanceRefreshStrategy(log.WithField("test", true), backend, preferences)
+	strategy.checkInterval = time.Millisecond
+	return strategy
+}
+
+func TestParseInstanceRefreshCheckpoints(t *testing.T) {
+	for _, tc := range []struct {
+		checkpoints string
+		expected    []int
+		valid       bool
+	}{
+		{checkpoints: "", expected: nil, valid: true},
+		{checkpoints: "50,20", expected: []int{20, 50, 100}, valid: true},
+		{checkpoints: "20, 100", expected: []int{20, 100}, valid: true},
+		{checkpoints: "0", valid: false},
+		{checkpoints: "20,abc", valid: false},
+	} {
+		t.Run(tc.checkpoints, func(t *testing.T) {
+			checkpoints, err := ParseInstanceRefreshCheckpoints(tc.checkpoints)
+			if !tc.valid {
+				if err == nil {
+					t.Fatalf("expected an error for %s", tc.checkpoints)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("should not fail: %v", err)
+			}
+			if !reflect.DeepEqual(checkpoints, tc.expected) {
+				t.Errorf("expected %v, got %v", tc.expected, checkpoints)
+			}
+		})
+	}
+}
+
+func TestInstanceRefreshPlan(t *testing.T) {
+	backend := &mockInstanceRefreshBackend{
+		mockProviderNodePoolsBackend: mockProviderNodePoolsBackend{nodePool: mockLargeNodePool(10)},
+	}
+	strategy := newTestInstanceRefreshStrategy(backend, InstanceRefreshPreferences{MinHealthyPercentage: 70})
+
+	plan, err := strategy.Plan(context.Background(), &api.NodePool{Name: "test", MaxSize: 20})
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+
+	expected := []int{3, 3, 3, 1}
+	if len(plan.Batches) != len(expected) {
+		t.Fatalf("expected %d batches, got %d", len(expected), len(plan.Batches))
+	}
+	for i, batch := range plan.Batches {
+		if len(batch) != expected[i] {
+			t.Errorf("expected batch %d to have %d nodes, got %d", i+1, expected[i], len(batch))
+		}
+	}
+}
+
+func TestInstanceRefreshUpdate(t *testing.T) {
+	np := &api.NodePool{Name: "test", MaxSize: 20}
+	preferences := InstanceRefreshPreferences{MinHealthyPercentage: 90, Checkpoints: []int{50, 100}, CheckpointDelay: time.Minute}
+
+	// a refresh is started for the outdated nodes and waited for.
+	backend := &mockInstanceRefreshBackend{
+		mockProviderNodePoolsBackend: mockProviderNodePoolsBackend{nodePool: mockLargeNodePool(2)},
+		statuses:                     []string{InstanceRefreshStatusInProgress, InstanceRefreshStatusSuccessful},
+	}
+	strategy := newTestInstanceRefreshStrategy(backend, preferences)
+	err := strategy.Update(context.Background(), np)
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+	if backend.started != 1 {
+		t.Errorf("expected 1 started refresh, got %d", backend.started)
+	}
+	if !reflect.DeepEqual(*backend.preferences, preferences) {
+		t.Errorf("expected preferences %v, got %v", preferences, *backend.preferences)
+	}
+
+	// an active refresh is waited for instead of starting a new one.
+	backend.refresh.Status = InstanceRefreshStatusInProgress
+	backend.statuses = []string{InstanceRefreshStatusSuccessful}
+	err = strategy.Update(context.Background(), np)
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+	if backend.started != 1 {
+		t.Errorf("expected the active refresh to be waited for, got %d started refreshes", backend.started)
+	}
+
+	// failed refreshes fail the update.
+	backend.statuses = []string{InstanceRefreshStatusFailed}
+	err = strategy.Update(context.Background(), np)
+	if err == nil {
+		t.Fatalf("expected the failed refresh to fail the update")
+	}
+
+	// node pools without outdated nodes aren't refreshed.
+	backend = &mockInstanceRefreshBackend{
+		mockProviderNodePoolsBackend: mockProviderNodePoolsBackend{nodePool: &NodePool{Generation: 1}},
+	}
+	strategy = newTestInstanceRefreshStrategy(backend, preferences)
+	err = strategy.Update(context.Background(), np)
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+	if backend.started != 0 {
+		t.Errorf("expected no refresh to be started, got %d", backend.started)
+	}
+}
+
+func TestInstanceRefreshUpdatePaused(t *testing.T) {
+	np := &api.NodePool{Name: "test", MaxSize: 20}
+	ctx := api.WithPauseCheck(context.Background(), func() (bool, error) { return true, nil })
+
+	backend := &mockInstanceRefreshBackend{
+		mockProviderNodePoolsBackend: mockProviderNodePoolsBackend{nodePool: mockLargeNodePool(2)},
+		statuses:                     []string{InstanceRefreshStatusInProgress},
+	}
+	strategy := newTestInstanceRefreshStrategy(backend, InstanceRefreshPreferences{MinHealthyPercentage: 90})
+	err := strategy.Update(ctx, np)
+	if err != ErrUpdatePaused {
+		t.Fatalf("expected %v, got %v", ErrUpdatePaused, err)
+	}
+	if backend.cancelled != 1 {
+		t.Errorf("expected the refresh to be cancelled, got %d cancellations", backend.cancelled)
+	}
+}
@@ -1,6 +1,7 @@
 package updatestrategy
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -28,10 +29,15 @@ const (
 type NodePoolManager interface {
 	GetPool(nodePool *api.NodePool) (*NodePool, error)
 	LabelNode(node *Node, labelKey, labelValue string) error
+	AnnotateNode(node *Node, annotationKey, annotationValue string) error
 	TaintNode(node *Node, taintKey, taintValue string, effect v1.TaintEffect) error
-	ScalePool(nodePool *api.NodePool, replicas int) error
-	TerminateNode(node *Node, decrementDesired bool) error
+	ScalePool(ctx context.Context, nodePool *api.NodePool, replicas int) error
+	TerminateNode(ctx context.Context, node *Node, decrementDesired bool) error
 	CordonNode(node *Node) error
+	InitializeNode(node *Node) (bool, error)
+	BlastRadius(nodes []*Node) (*BlastRadius, error)
+	CheckNodeHealth(node *Node) ([]string, error)
+	MoveStickyVolume(ctx context.Context, from, to *Node, device string) error
 }
 
 // KubernetesNodePoolManager defines a node pool manager which uses the
@@ -41,18 +47,25 @@ type KubernetesNodePoolManager struct {
 	backend         ProviderNodePoolsBackend
 	logger          *log.Entry
 	maxEvictTimeout time.Duration
+	evictionLimiter *namespaceEvictionLimiter
+	evictionRate    *evictionRateLimiter
 }
 
 // NewKubernetesNodePoolManager initializes a new Kubernetes NodePool manager
 // which can manage single node pools based on the nodes registered in the
 // Kubernetes API and the related NodePoolBackend for those nodes e.g.
-// ASGNodePool.
-func NewKubernetesNodePoolManager(logger *log.Entry, kubeClient kubernetes.Interface, poolBackend ProviderNodePoolsBackend, maxEvictTimeout time.Duration) *KubernetesNodePoolManager {
+// ASGNodePool. Evictions of pods not covered by a PodDisruptionBudget are
+// limited to one per namespace and namespaceEvictionInterval, unless the
+// interval is zero. All evictions are limited to maxEvictionsPerMinute,
+// unless it's zero.
+func NewKubernetesNodePoolManager(logger *log.Entry, kubeClient kubernetes.Interface, poolBackend ProviderNodePoolsBackend, maxEvictTimeout, namespaceEvictionInterval time.Duration, maxEvictionsPerMinute int) *KubernetesNodePoolManager {
 	return &KubernetesNodePoolManager{
 		kube:            kubeClient,
 		backend:         poolBackend,
 		logger:          logger,
 		maxEvictTimeout: maxEvictTimeout,
+		evictionLimiter: newNamespaceEvictionLimiter(namespaceEvictionInterval),
+		evictionRate:    newEvictionRateLimiter(maxEvictionsPerMinute),
 	}
 }
 
@@ -71,6 +84,20 @@ func (m *KubernetesNodePoolManager) GetPool(nodePoolDesc *api.NodePool) (*NodePo
 		return nil, err
 	}
 
+	// only node pools with scale down protection protect the nodes
+	// running Jobs.
+	var runningJobs map[string]bool
+	protection, err := ParseScaleDownProtection(nodePoolDesc.ScaleDownProtection)
+	if err != nil {
+		return nil, err
+	}
+	if protection > 0 {
+		runningJobs, err = m.nodesRunningJobs()
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	instanceIDMap := make(map[string]v1.Node)
 	for _, node := range kubeNodes.Items {
 		instanceIDMap[node.Spec.ProviderID] = node
@@ -85,11 +112,22 @@ func (m *KubernetesNodePoolManager) GetPool(nodePoolDesc *api.NodePool) (*NodePo
 				FailureDomain:   npNode.FailureDomain,
 				Generation:      npNode.Generation,
 				Ready:           npNode.Ready,
+				Stopped:         npNode.Stopped,
 				Name:            node.Name,
 				Labels:          node.Labels,
+				Annotations:     node.Annotations,
 				Taints:          node.Spec.Taints,
 				Cordoned:        node.Spec.Unschedulable,
-				VolumesAttached: len(node.Status.VolumesAttached) > 0,
+				VolumesAttached: len(node.Status.VolumesAttached) > 0 || npNode.StickyVolume != "",
+				Problems:        nodeProblems(&node),
+
+				TerminationDeferredUntil:    terminationDeferredUntil(m.logger, &node),
+				ScaleDownProtected:          node.Annotations[ScaleDownProtectedAnnotation] == "true" || runningJobs[node.Name],
+				ScaleDownProtectionDeadline: deadlineAnnotation(m.logger, &node, ScaleDownProtectionDeadlineAnnotation),
+				Adopted:                     npNode.Adopted,
+				ReplaceRequested:            node.Annotations[ReplaceNodeAnnotation] == "true",
+				StickyVolume:                npNode.StickyVolume,
+				QuarantinedAt:               deadlineAnnotation(m.logger, &node, QuarantinedAnnotation),
 			}
 
 			// TODO(mlarsen): Think about how this could be
@@ -112,6 +150,24 @@ func (m *KubernetesNodePoolManager) GetPool(nodePoolDesc *api.NodePool) (*NodePo
 	return nodePool, nil
 }
 
+// nodeProblems returns the conditions of a node reporting a problem. The
+// Ready condition reports a problem unless it's true, all other conditions,
+// e.g. MemoryPressure, report a problem if they're true.
+func nodeProblems(node *v1.Node) []string {
+	var problems []string
+	for _, condition := range node.Status.Conditions {
+		healthy := v1.ConditionFalse
+		if condition.Type == v1.NodeReady {
+			healthy = v1.ConditionTrue
+		}
+
+		if condition.Status != healthy {
+			problems = append(problems, fmt.Sprintf("%s: %s", condition.Type, condition.Reason))
+		}
+	}
+	return problems
+}
+
 // LabelNode labels a Kubernetes node object in case the label is not already
 // defined.
 func (m *KubernetesNodePoolManager) LabelNode(node *Node, labelKey, labelValue string) error {
@@ -184,26 +240,51 @@ func (m *KubernetesNodePoolManager) TaintNode(node *Node, taintKey, taintValue s
 	return backoff.Retry(taintNode, backoffCfg)
 }
 
+// DrainError is returned by TerminateNode if the pods of the node couldn't be
+// evicted within the eviction timeout because of their pod disruption budgets
+// or the namespace eviction rate limit. The node isn't terminated in that case.
+type DrainError struct {
+	Node string
+	Err  error
+}
+
+func (e *DrainError) Error() string {
+	return fmt.Sprintf("failed to drain node %s: %v", e.Node, e.Err)
+}
+
 // TerminateNode terminates a node and optionally decrement the desired size of
 // the node pool. Before a node is terminated it's drained to ensure that pods
-// running on the nodes are gracefully terminated.
-func (m *KubernetesNodePoolManager) TerminateNode(node *Node, decrementDesired bool) error {
-	err := m.drain(node)
+// running on the nodes are gracefully terminated. A *DrainError is returned
+// if the evictions are still blocked after the eviction timeout, any other
+// error is returned as is. The node isn't terminated if ctx is canceled
+// while it's drained.
+func (m *KubernetesNodePoolManager) TerminateNode(ctx context.Context, node *Node, decrementDesired bool) error {
+	err := m.drain(ctx, node)
 	if err != nil {
 		return err
 	}
 
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	return m.backend.Terminate(node, decrementDesired)
 }
 
-// ScalePool scales a nodePool to the specified number of replicas.
-func (m *KubernetesNodePoolManager) ScalePool(nodePool *api.NodePool, replicas int) error {
+// ScalePool scales a nodePool to the specified number of replicas, unless
+// ctx is canceled.
+func (m *KubernetesNodePoolManager) ScalePool(ctx context.Context, nodePool *api.NodePool, replicas int) error {
+	if err := ctx.Err(); err != nil {
+		return err
+	}
+
 	return m.backend.Scale(nodePool, replicas)
 }
 
-// drain tries to evict all of the pods on a node.
+// drain tries to evict all of the pods on a node. Retrying the evictions
+// stops when ctx is canceled.
 // TODO: optimization: concurrent pod eviction.
-func (m *KubernetesNodePoolManager) drain(node *Node) error {
+func (m *KubernetesNodePoolManager) drain(ctx context.Context, node *Node) error {
 	m.logger.WithField("nodeName", node.Name).Info("Draining node", node.Name)
 
 	// mark node as draining
@@ -211,10 +292,17 @@ func (m *KubernetesNodePoolManager) drain(node *Node) error {
 		return err
 	}
 
+	// the pods of a stopped node can't terminate gracefully, so waiting
+	// for evictions would only block until maxEvictTimeout.
+	if node.Stopped {
+		return m.deleteStoppedNodePods(node)
+	}
+
 	// evictAll is a function that tries to evict all evictable pods from a particular node exactly
-	// once in order of appearance. If it encounters errors due to pod disruption budget violation it
-	// ignores this pod and continues with the next. The function returns any error encountered,
-	// including the most recent error produced by a pod disruption budget violation.
+	// once in order of appearance. If it encounters errors due to pod disruption budget violation or
+	// the namespace eviction rate limit it ignores this pod and continues with the next. The function
+	// returns any error encountered, including the most recent error produced by a pod disruption
+	// budget violation or the rate limit.
 	evictAll := func() error {
 		pods, err := m.getPodsByNode(node.Name)
 		if err != nil {
@@ -228,6 +316,21 @@ func (m *KubernetesNodePoolManager) drain(node *Node) error {
 				continue
 			}
 
+			err = m.limitEviction(&pod)
+			if err != nil {
+				if isEvictionRateLimitedErr(err) {
+					m.logger.WithFields(log.Fields{
+						"ns":   pod.Namespace,
+						"pod":  pod.Name,
+						"node": pod.Spec.NodeName,
+					}).Info("Namespace eviction rate limit exceeded")
+					lastPDBViolationErr = err
+					continue
+				}
+				return err
+			}
+
+			m.evictionRate.wait()
 			err = evictPod(m.kube, m.logger, &pod)
 			if err != nil {
 				if errors.IsTooManyRequests(err) || isMultiplePDBsErr(err) {
@@ -248,34 +351,43 @@ func (m *KubernetesNodePoolManager) drain(node *Node) error {
 
 	// We try to evict all pods of a node by calling evict on all of them once. If we encounter an
 	// error we will backoff and try again for as long as `maxEvictTimeout`. If after `maxEvictTimeout`
-	// we still receive an error related to pod disruption budget violations we will continue and
-	// forcefully shutdown the pod in the next step.
+	// we still receive an error related to pod disruption budget violations or the namespace eviction
+	// rate limit the node can't be drained and is left to be quarantined by the update strategy.
 	backoffCfg := backoff.NewExponentialBackOff()
 	backoffCfg.MaxElapsedTime = m.maxEvictTimeout
-	err := backoff.Retry(evictAll, backoffCfg)
+	err := backoff.Retry(evictAll, backoff.WithContext(backoffCfg, ctx))
 	if err != nil {
-		if !errors.IsTooManyRequests(err) && !isMultiplePDBsErr(err) {
-			return err
+		// a canceled drain isn't a node which can't be drained.
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		if errors.IsTooManyRequests(err) || isMultiplePDBsErr(err) || isEvictionRateLimitedErr(err) {
+			return &DrainError{Node: node.Name, Err: err}
 		}
+		return err
 	}
 
+	return nil
+}
+
+// deleteStoppedNodePods force deletes the evictable pods of a stopped node,
+// such that they're rescheduled without waiting for the node.
+func (m *KubernetesNodePoolManager) deleteStoppedNodePods(node *Node) error {
 	pods, err := m.getPodsByNode(node.Name)
 	if err != nil {
 		return err
 	}
 
-	// Delete all remaining evictable pods disregarding their pod disruption budgets. It's necessary
-	// in case a pod disruption budget must be violated in order to proceed with a cluster update.
+	gracePeriod := int64(0)
 	for _, pod := range pods.Items {
-		// Don't bother with this pod if it's not evictable.
 		if !m.isEvictablePod(pod) {
 			continue
 		}
 
 		err := m.kube.CoreV1().Pods(pod.Namespace).Delete(pod.Name, &metav1.DeleteOptions{
-			GracePeriodSeconds: pod.Spec.TerminationGracePeriodSeconds,
+			GracePeriodSeconds: &gracePeriod,
 		})
-		if err != nil {
+		if err != nil && !errors.IsNotFound(err) {
 			return err
 		}
 
@@ -283,7 +395,7 @@ func (m *KubernetesNodePoolManager) drain(node *Node) error {
 			"ns":   pod.Namespace,
 			"pod":  pod.Name,
 			"node": pod.Spec.NodeName,
-		}).Info("Pod deleted")
+		}).Info("Pod of stopped node deleted")
 	}
 
 	return nil
@@ -1,6 +1,7 @@
 package updatestrategy
 
 import (
+	"context"
 	"net/http"
 	"testing"
 	"time"
@@ -76,6 +77,8 @@ func TestGetPool(t *testing.T) {
 		setupMockKubernetes(t, []*v1.Node{node}, nil),
 		backend,
 		0,
+		0,
+		0,
 	)
 
 	// test getting nodes successfully
@@ -94,6 +97,24 @@ func TestGetPool(t *testing.T) {
 	assert.Equal(t, nodePool.Nodes[0].Labels[lifecycleStatusLabel], lifecycleStatusDraining)
 }
 
+func TestNodeProblems(t *testing.T) {
+	node := &v1.Node{
+		Status: v1.NodeStatus{
+			Conditions: []v1.NodeCondition{
+				{Type: v1.NodeReady, Status: v1.ConditionTrue, Reason: "KubeletReady"},
+				{Type: v1.NodeMemoryPressure, Status: v1.ConditionFalse, Reason: "KubeletHasSufficientMemory"},
+			},
+		},
+	}
+	assert.Empty(t, nodeProblems(node))
+
+	node.Status.Conditions[0].Status = v1.ConditionUnknown
+	node.Status.Conditions[0].Reason = "NodeStatusUnknown"
+	node.Status.Conditions[1].Status = v1.ConditionTrue
+	node.Status.Conditions[1].Reason = "KubeletHasInsufficientMemory"
+	assert.Equal(t, []string{"Ready: NodeStatusUnknown", "MemoryPressure: KubeletHasInsufficientMemory"}, nodeProblems(node))
+}
+
 func TestLabelNodes(t *testing.T) {
 	node := &v1.Node{
 		ObjectMeta: metav1.ObjectMeta{
@@ -210,7 +231,11 @@ func TestScalePool(t *testing.T) {
 			},
 		},
 	}
-	assert.NoError(t, mgr.ScalePool(&api.NodePool{Name: "test"}, 1))
+	assert.NoError(t, mgr.ScalePool(context.Background(), &api.NodePool{Name: "test"}, 1))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	assert.Equal(t, context.Canceled, mgr.ScalePool(ctx, &api.NodePool{Name: "test"}, 1))
 }
 
 func TestTerminateNode(t *testing.T) {
@@ -283,7 +308,7 @@ func TestTerminateNode(t *testing.T) {
 		maxEvictTimeout: 1 * time.Nanosecond,
 	}
 
-	err := mgr.TerminateNode(&Node{Name: node.Name}, false)
+	err := mgr.TerminateNode(context.Background(), &Node{Name: node.Name}, false)
 	assert.NoError(t, err)
 
 	// test when evictPod returns 429
@@ -296,6 +321,50 @@ func TestTerminateNode(t *testing.T) {
 	}
 
 	mgr.kube = setupMockKubernetes(t, []*v1.Node{node}, pods)
-	err = mgr.TerminateNode(&Node{Name: node.Name}, false)
+	err = mgr.TerminateNode(context.Background(), &Node{Name: node.Name}, false)
+	assert.IsType(t, &DrainError{}, err)
+
+	// test that canceling the context stops the drain without
+	// terminating the node
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	mgr.kube = setupMockKubernetes(t, []*v1.Node{node}, pods)
+	mgr.maxEvictTimeout = time.Hour
+	err = mgr.TerminateNode(ctx, &Node{Name: node.Name}, false)
+	assert.Equal(t, context.Canceled, err)
+	mgr.maxEvictTimeout = 1 * time.Nanosecond
+
+	remaining, err := mgr.kube.CoreV1().Pods("default").List(metav1.ListOptions{})
+	assert.NoError(t, err)
+	assert.Len(t, remaining.Items, 3)
+
+	// test that other eviction errors aren't drain errors
+	evictPod = func(client kubernetes.Interface, logger *log.Entry, pod *v1.Pod) error {
+		return &errors.StatusError{
+			ErrStatus: metav1.Status{
+				Code: http.StatusInternalServerError,
+			},
+		}
+	}
+
+	mgr.kube = setupMockKubernetes(t, []*v1.Node{node}, pods)
+	err = mgr.TerminateNode(context.Background(), &Node{Name: node.Name}, false)
+	assert.Error(t, err)
+	_, ok := err.(*DrainError)
+	assert.False(t, ok)
+
+	// test that stopped nodes don't wait for evictions
+	evictPod = func(client kubernetes.Interface, logger *log.Entry, pod *v1.Pod) error {
+		t.Fatalf("unexpected eviction of pod %s", pod.Name)
+		return nil
+	}
+
+	mgr.kube = setupMockKubernetes(t, []*v1.Node{node}, pods)
+	mgr.maxEvictTimeout = time.Hour
+	err = mgr.TerminateNode(context.Background(), &Node{Name: node.Name, Stopped: true}, false)
+	assert.NoError(t, err)
+
+	remaining, err = mgr.kube.CoreV1().Pods("default").List(metav1.ListOptions{})
 	assert.NoError(t, err)
+	assert.Len(t, remaining.Items, 2)
 }
@@ -0,0 +1,95 @@
+package updatestrategy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// UpdateStrategyRolling replaces the nodes with the
+	// RollingUpdateStrategy in the update mode of the node pool.
+	UpdateStrategyRolling = "rolling"
+	// UpdateStrategyBlueGreen replaces the nodes with the
+	// RollingUpdateStrategy in the blue/green update mode.
+	UpdateStrategyBlueGreen = "blue-green"
+	// UpdateStrategyInstanceRefresh replaces the nodes with the
+	// InstanceRefreshStrategy.
+	UpdateStrategyInstanceRefresh = "instance-refresh"
+)
+
+// ValidateUpdateStrategy returns an error if the update strategy of a node
+// pool is unknown or conflicts with its update mode.
+func ValidateUpdateStrategy(nodePool *api.NodePool) error {
+	switch nodePool.UpdateStrategy {
+	case "", UpdateStrategyRolling, UpdateStrategyBlueGreen:
+		return nil
+	case UpdateStrategyInstanceRefresh:
+		if nodePool.UpdateMode == UpdateModeBlueGreen {
+			return fmt.Errorf("update mode %s isn't supported by update strategy %s", UpdateModeBlueGreen, UpdateStrategyInstanceRefresh)
+		}
+		return nil
+	default:
+		return fmt.Errorf("invalid update strategy %s: expected %s, %s or %s", nodePool.UpdateStrategy, UpdateStrategyRolling, UpdateStrategyBlueGreen, UpdateStrategyInstanceRefresh)
+	}
+}
+
+// NodePoolStrategies dispatches the update of every node pool to the
+// strategy selected by the node pool, or the default strategy of the cluster
+// if the node pool doesn't select one. This way a cluster can e.g. replace
+// the nodes of stateful node pools blue/green and refresh the instances of
+// stateless node pools.
+type NodePoolStrategies struct {
+	strategies      map[string]UpdateStrategy
+	defaultStrategy string
+}
+
+// NewNodePoolStrategies initializes a new NodePoolStrategies with the update
+// strategies supported by the node pool backend, keyed by their name.
+func NewNodePoolStrategies(defaultStrategy string, strategies map[string]UpdateStrategy) (*NodePoolStrategies, error) {
+	if _, ok := strategies[defaultStrategy]; !ok {
+		return nil, fmt.Errorf("update strategy %s isn't supported by the node pool backend", defaultStrategy)
+	}
+
+	return &NodePoolStrategies{
+		strategies:      strategies,
+		defaultStrategy: defaultStrategy,
+	}, nil
+}
+
+// strategy returns the update strategy of the node pool. The blue/green
+// update mode is implemented by the rolling update strategy.
+func (s *NodePoolStrategies) strategy(nodePool *api.NodePool) (UpdateStrategy, error) {
+	name := nodePool.UpdateStrategy
+	switch name {
+	case "":
+		name = s.defaultStrategy
+	case UpdateStrategyBlueGreen:
+		name = UpdateStrategyRolling
+	}
+
+	strategy, ok := s.strategies[name]
+	if !ok {
+		return nil, fmt.Errorf("update strategy %s of node pool %s isn't supported by the node pool backend", name, nodePool.Name)
+	}
+	return strategy, nil
+}
+
+// Update updates the node pool with its update strategy.
+func (s *NodePoolStrategies) Update(ctx context.Context, nodePool *api.NodePool) error {
+	strategy, err := s.strategy(nodePool)
+	if err != nil {
+		return err
+	}
+	return strategy.Update(ctx, nodePool)
+}
+
+// Plan plans the update of the node pool with its update strategy.
+func (s *NodePoolStrategies) Plan(ctx context.Context, nodePool *api.NodePool) (*UpdatePlan, error) {
+	strategy, err := s.strategy(nodePool)
+	if err != nil {
+		return nil, err
+	}
+	return strategy.Plan(ctx, nodePool)
+}
@@ -0,0 +1,47 @@
+package updatestrategy
+
+import (
+	"context"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestValidateUpdateStrategy(t *testing.T) {
+	for _, strategy := range []string{"", UpdateStrategyRolling, UpdateStrategyBlueGreen, UpdateStrategyInstanceRefresh} {
+		assert.NoError(t, ValidateUpdateStrategy(&api.NodePool{UpdateStrategy: strategy}), strategy)
+	}
+
+	assert.Error(t, ValidateUpdateStrategy(&api.NodePool{UpdateStrategy: "surge"}))
+	assert.Error(t, ValidateUpdateStrategy(&api.NodePool{UpdateStrategy: UpdateStrategyInstanceRefresh, UpdateMode: UpdateModeBlueGreen}))
+}
+
+func TestNodePoolStrategies(t *testing.T) {
+	rolling := &mockUpdateStrategy{}
+	refresh := &mockUpdateStrategy{}
+
+	_, err := NewNodePoolStrategies(UpdateStrategyInstanceRefresh, map[string]UpdateStrategy{UpdateStrategyRolling: rolling})
+	assert.Error(t, err)
+
+	strategies, err := NewNodePoolStrategies(UpdateStrategyRolling, map[string]UpdateStrategy{
+		UpdateStrategyRolling:         rolling,
+		UpdateStrategyInstanceRefresh: refresh,
+	})
+	require.NoError(t, err)
+
+	for _, nodePool := range []*api.NodePool{
+		{Name: "default"},
+		{Name: "rolling", UpdateStrategy: UpdateStrategyRolling},
+		{Name: "blue-green", UpdateStrategy: UpdateStrategyBlueGreen},
+	} {
+		require.NoError(t, strategies.Update(context.Background(), nodePool))
+	}
+	require.NoError(t, strategies.Update(context.Background(), &api.NodePool{Name: "refresh", UpdateStrategy: UpdateStrategyInstanceRefresh}))
+	assert.Equal(t, 3, rolling.updated)
+	assert.Equal(t, 1, refresh.updated)
+
+	_, err = strategies.Plan(context.Background(), &api.NodePool{Name: "unknown", UpdateStrategy: "surge"})
+	assert.Error(t, err)
+}
@@ -0,0 +1,70 @@
+package updatestrategy
+
+import (
+	"context"
+	"strings"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// QuarantinedAnnotation marks nodes which couldn't be drained during an
+// update, e.g. because of pods which can't be deleted, with the RFC 3339
+// time they were quarantined. Quarantined nodes are left out of the update,
+// such that the remaining nodes are still replaced. They stay cordoned until
+// they're drained and terminated by hand or the annotation is removed, which
+// has the next update retry to drain them.
+const QuarantinedAnnotation = "clm.zalando.org/quarantined"
+
+// Quarantined returns true if the node couldn't be drained during a previous
+// update and is left out of updates.
+func (n *Node) Quarantined() bool {
+	return !n.QuarantinedAt.IsZero()
+}
+
+// withoutQuarantined returns the nodes which aren't quarantined.
+func withoutQuarantined(nodes []*Node) []*Node {
+	result := make([]*Node, 0, len(nodes))
+	for _, node := range nodes {
+		if !node.Quarantined() {
+			result = append(result, node)
+		}
+	}
+	return result
+}
+
+// quarantineNode quarantines a node which couldn't be drained, such that the
+// update continues with the remaining nodes. The node is recorded in the
+// update summary of ctx.
+func (r *RollingUpdateStrategy) quarantineNode(ctx context.Context, nodePoolDesc *api.NodePool, node *Node, drainErr error) error {
+	r.logger.Warnf("Quarantining node %s of node pool '%s': %v", node.Name, nodePoolDesc.Name, drainErr)
+
+	now := time.Now().UTC()
+	err := r.nodePoolManager.AnnotateNode(node, QuarantinedAnnotation, now.Format(time.RFC3339))
+	if err != nil {
+		return err
+	}
+	node.QuarantinedAt = now
+
+	summary := api.UpdateSummaryFromContext(ctx)
+	summary.AddWarning("Quarantined node %s of node pool %s: %v", node.Name, nodePoolDesc.Name, drainErr)
+	summary.AddQuarantinedNodes(nodePoolDesc.Name, node.Name)
+	return nil
+}
+
+// reportQuarantinedNodes records the nodes of the node pool quarantined by
+// previous updates in the update summary of ctx.
+func (r *RollingUpdateStrategy) reportQuarantinedNodes(ctx context.Context, nodePoolDesc *api.NodePool, nodePool *NodePool) {
+	var quarantined []string
+	for _, node := range nodePool.Nodes {
+		if node.Quarantined() {
+			quarantined = append(quarantined, node.Name)
+		}
+	}
+	if len(quarantined) == 0 {
+		return
+	}
+
+	r.logger.Warnf("Node pool '%s' has %d quarantined nodes which couldn't be drained: %s", nodePoolDesc.Name, len(quarantined), strings.Join(quarantined, ", "))
+	api.UpdateSummaryFromContext(ctx).AddQuarantinedNodes(nodePoolDesc.Name, quarantined...)
+}
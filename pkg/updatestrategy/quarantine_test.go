@@ -0,0 +1,97 @@
+package updatestrategy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// undrainableNodePoolManager fails to drain one of the nodes of the mocked
+// node pool.
+type undrainableNodePoolManager struct {
+	*mockNodePoolManager
+	undrainable string
+	annotations map[string]string
+}
+
+func (m *undrainableNodePoolManager) AnnotateNode(node *Node, annotationKey, annotationValue string) error {
+	m.annotations[node.Name+"/"+annotationKey] = annotationValue
+	return nil
+}
+
+func (m *undrainableNodePoolManager) TerminateNode(ctx context.Context, node *Node, decrementDesired bool) error {
+	if node.Name == m.undrainable {
+		return &DrainError{Node: node.Name, Err: errors.New("cannot evict pod")}
+	}
+	return m.mockNodePoolManager.TerminateNode(ctx, node, decrementDesired)
+}
+
+func TestUpdateQuarantinesUndrainableNode(t *testing.T) {
+	logger := log.WithField("test", true)
+	np := &api.NodePool{Name: "test", MaxSize: 20}
+
+	nodePool := mockLargeNodePool(3)
+	for i, node := range nodePool.Nodes {
+		node.Name = fmt.Sprintf("node-%d", i+1)
+	}
+	undrainable := nodePool.Nodes[0]
+
+	manager := &undrainableNodePoolManager{
+		mockNodePoolManager: &mockNodePoolManager{nodePool: nodePool},
+		undrainable:         undrainable.Name,
+		annotations:         make(map[string]string),
+	}
+	strategy := NewRollingUpdateStrategy(logger, manager, nil, nil, nil, 1, 0, 0, 0, 0)
+
+	summary := api.NewUpdateSummary(nil)
+	err := strategy.Update(api.WithUpdateSummary(context.Background(), summary), np)
+	require.NoError(t, err)
+
+	// the undrainable node is kept and quarantined, the others are
+	// replaced.
+	assert.True(t, undrainable.Quarantined())
+	assert.Contains(t, manager.annotations, "node-1/"+QuarantinedAnnotation)
+	assert.Contains(t, manager.nodePool.Nodes, undrainable)
+	for _, node := range manager.nodePool.Nodes {
+		if node != undrainable {
+			assert.Equal(t, manager.nodePool.Generation, node.Generation)
+		}
+	}
+
+	assert.Equal(t, []string{"node-1"}, summary.QuarantinedNodes("test"))
+	assert.NotEmpty(t, summary.Warnings)
+}
+
+func TestSplitOldNewNodesSkipsQuarantined(t *testing.T) {
+	logger := log.WithField("test", true)
+
+	nodePool := mockLargeNodePool(2)
+	nodePool.Nodes = append(nodePool.Nodes, mockNode(getFailureDomain(nodePool.Nodes), nodePool.Generation, false, false))
+	nodePool.Nodes[0].QuarantinedAt = time.Now()
+
+	strategy := NewRollingUpdateStrategy(logger, &mockNodePoolManager{nodePool: nodePool}, nil, nil, nil, 1, 0, 0, 0, 0)
+	oldNodes, newNodes := strategy.splitOldNewNodes(nodePool)
+	assert.Equal(t, []*Node{nodePool.Nodes[1]}, oldNodes)
+	assert.Equal(t, []*Node{nodePool.Nodes[2]}, newNodes)
+}
+
+func TestReportQuarantinedNodes(t *testing.T) {
+	logger := log.WithField("test", true)
+	np := &api.NodePool{Name: "test"}
+
+	nodePool := mockLargeNodePool(2)
+	nodePool.Nodes[1].Name = "node-2"
+	nodePool.Nodes[1].QuarantinedAt = time.Now()
+
+	strategy := NewRollingUpdateStrategy(logger, &mockNodePoolManager{nodePool: nodePool}, nil, nil, nil, 1, 0, 0, 0, 0)
+	summary := api.NewUpdateSummary(nil)
+	strategy.reportQuarantinedNodes(api.WithUpdateSummary(context.Background(), summary), np, nodePool)
+	assert.Equal(t, []string{"node-2"}, summary.QuarantinedNodes("test"))
+}
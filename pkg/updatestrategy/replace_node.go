@@ -0,0 +1,27 @@
+package updatestrategy
+
+// ReplaceNodeAnnotation is the annotation operators can set to 'true' on a
+// single node to have it replaced by the next update of its node pool, e.g.
+// when its instance is suspected to have a hardware issue. The node is
+// cordoned, drained and terminated like an outdated node, respecting the
+// PodDisruptionBudgets and the health gates of the node pool, while the
+// other nodes are left alone.
+const ReplaceNodeAnnotation = "clm.zalando.org/replace"
+
+// replaceRequested returns true if the node must be replaced although it's of
+// the current generation of the node pool.
+func (n *NodePool) replaceRequested(node *Node) bool {
+	return node.ReplaceRequested && node.Generation == n.Generation
+}
+
+// outdatedNodes returns the nodes of the node pool which aren't of the
+// current generation.
+func outdatedNodes(nodePool *NodePool) []*Node {
+	var nodes []*Node
+	for _, node := range nodePool.Nodes {
+		if node.Generation != nodePool.Generation {
+			nodes = append(nodes, node)
+		}
+	}
+	return nodes
+}
@@ -3,10 +3,12 @@ package updatestrategy
 import (
 	"context"
 	"errors"
+	"fmt"
 	"math"
 	"time"
 
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/tracing"
 
 	log "github.com/sirupsen/logrus"
 	"k8s.io/client-go/pkg/api/v1"
@@ -18,6 +20,13 @@ const (
 	lifecycleStatusDraining            = "draining"
 	lifecycleStatusDecommissionPending = "decommission-pending"
 
+	// NodeGenerationLabel marks whether a node was launched from the
+	// current launch configuration of its node pool or from an outdated
+	// one which is replaced by the update.
+	NodeGenerationLabel    = "cluster-lifecycle-manager.zalando.org/generation"
+	NodeGenerationCurrent  = "current"
+	NodeGenerationOutdated = "outdated"
+
 	decommissionPendingTaintKey   = "decommission-pending"
 	decommissionPendingTaintValue = "rolling-upgrade"
 )
@@ -26,22 +35,50 @@ var (
 	errTimeoutExceeded     = errors.New("timeout exceeded")
 	operationMaxTimeout    = 15 * time.Minute
 	operationCheckInterval = 15 * time.Second
+
+	// defaultBatchDuration is the estimated time it takes to drain a batch
+	// of nodes and boot their replacements.
+	defaultBatchDuration = 10 * time.Minute
 )
 
 // RollingUpdateStrategy is a cluster node update strategy which will roll the
 // nodes with a specified surge.
 type RollingUpdateStrategy struct {
-	nodePoolManager NodePoolManager
-	surge           int
-	logger          *log.Entry
+	nodePoolManager      NodePoolManager
+	drainStats           DrainStatsStore
+	bootstrapFailures    BootstrapFailureStore
+	rollouts             RolloutStore
+	surge                int
+	canarySoakPeriod     time.Duration
+	maxNodesPerIteration int
+	nodeHealthTimeout    time.Duration
+	maxUnavailable       int
+	logger               *log.Entry
 }
 
-// NewRollingUpdateStrategy initializes a new RollingUpdateStrategy.
-func NewRollingUpdateStrategy(logger *log.Entry, nodePoolManager NodePoolManager, surge int) *RollingUpdateStrategy {
+// NewRollingUpdateStrategy initializes a new RollingUpdateStrategy. If
+// drainStats is nil no drain statistics will be recorded. If
+// bootstrapFailures is nil node pools are never frozen. The canary nodes of
+// node pools defining a canary must stay healthy for canarySoakPeriod before
+// the old nodes are replaced. If maxNodesPerIteration is positive an update
+// replaces at most that many nodes and returns ErrRolloutIncomplete, the
+// progress is kept in rollouts unless it's nil. If nodeHealthTimeout is
+// positive the new nodes must become healthy within the timeout before more
+// old nodes are terminated. If maxUnavailable is positive at most that many
+// old nodes of a node pool are drained at the same time, unless the node pool
+// defines its own limit.
+func NewRollingUpdateStrategy(logger *log.Entry, nodePoolManager NodePoolManager, drainStats DrainStatsStore, bootstrapFailures BootstrapFailureStore, rollouts RolloutStore, surge int, canarySoakPeriod time.Duration, maxNodesPerIteration int, nodeHealthTimeout time.Duration, maxUnavailable int) *RollingUpdateStrategy {
 	return &RollingUpdateStrategy{
-		nodePoolManager: nodePoolManager,
-		surge:           surge,
-		logger:          logger.WithField("strategy", "rolling"),
+		nodePoolManager:      nodePoolManager,
+		drainStats:           drainStats,
+		bootstrapFailures:    bootstrapFailures,
+		rollouts:             rollouts,
+		surge:                surge,
+		canarySoakPeriod:     canarySoakPeriod,
+		maxNodesPerIteration: maxNodesPerIteration,
+		nodeHealthTimeout:    nodeHealthTimeout,
+		maxUnavailable:       maxUnavailable,
+		logger:               logger.WithField("strategy", "rolling"),
 	}
 }
 
@@ -49,7 +86,11 @@ func NewRollingUpdateStrategy(logger *log.Entry, nodePoolManager NodePoolManager
 func (r *RollingUpdateStrategy) labelNodes(nodePool *NodePool) error {
 	for _, node := range nodePool.Nodes {
 		lifecycleStatus := lifecycleStatusReady
+		generation := NodeGenerationCurrent
 		if node.Generation != nodePool.Generation {
+			generation = NodeGenerationOutdated
+		}
+		if node.Generation != nodePool.Generation || nodePool.replaceRequested(node) {
 			lifecycleStatus = lifecycleStatusDecommissionPending
 			if node.Labels[lifecycleStatusLabel] == lifecycleStatusDraining {
 				lifecycleStatus = lifecycleStatusDraining
@@ -61,13 +102,18 @@ func (r *RollingUpdateStrategy) labelNodes(nodePool *NodePool) error {
 		if err != nil {
 			return err
 		}
+
+		err = r.nodePoolManager.LabelNode(node, NodeGenerationLabel, generation)
+		if err != nil {
+			return err
+		}
 	}
 	return nil
 }
 
 func (r *RollingUpdateStrategy) taintOldNodes(nodePool *NodePool) error {
 	for _, node := range nodePool.Nodes {
-		if node.Generation != nodePool.Generation {
+		if node.Generation != nodePool.Generation || nodePool.replaceRequested(node) {
 			err := r.nodePoolManager.TaintNode(node, decommissionPendingTaintKey, decommissionPendingTaintValue, v1.TaintEffectPreferNoSchedule)
 			if err != nil {
 				return err
@@ -85,30 +131,169 @@ func (r *RollingUpdateStrategy) isUpdateDone(nodePool *NodePool) bool {
 
 // terminateCordonedNodes filters for nodes to be terminated and terminates the
 // nodes one by one. It will conditionally scale down the node pool in case
-// there is less than surge old nodes left.
-func (r *RollingUpdateStrategy) terminateCordonedNodes(nodePool *NodePool, surge int) error {
+// there is less than surge old nodes left. The sticky volumes of the
+// terminated nodes are moved to new nodes in the same failure domain. Nodes
+// which can't be drained are quarantined instead of failing the update. The
+// time it took to drain and terminate each of the terminated nodes is
+// returned. The nodes being terminated and the replaced ones are checkpointed
+// in the progress after every node.
+func (r *RollingUpdateStrategy) terminateCordonedNodes(ctx context.Context, nodePoolDesc *api.NodePool, nodePool *NodePool, surge int, progress *RolloutProgress) ([]time.Duration, error) {
 	oldNodes, _ := r.splitOldNewNodes(nodePool)
 	nodesToTerminate := r.filterNodesToTerminate(oldNodes)
 	r.logger.Debugf("Found %d nodes to be terminated", len(nodesToTerminate))
 
-	numOldNodes := len(oldNodes)
+	if len(nodesToTerminate) > 0 {
+		progress.Replacing = make([]string, 0, len(nodesToTerminate))
+		for _, node := range nodesToTerminate {
+			progress.Replacing = append(progress.Replacing, instanceID(node))
+		}
+		r.setRolloutProgress(nodePoolDesc, progress)
+	}
+
+	numOldNodes := len(withoutQuarantined(outdatedNodes(nodePool)))
+	assigned := make(map[string]bool)
+	var drainTimes []time.Duration
 
 	for _, node := range nodesToTerminate {
-		// if we only have surge or less old nodes left, then just
-		// scale when terminating node.
-		scaleDown := numOldNodes <= surge
+		// stop replacing nodes in case the context is canceled
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		// the node pool isn't scaled out for nodes replaced on
+		// request, they're replaced after their termination.
+		scaleDown := false
+		if !nodePool.replaceRequested(node) {
+			// if we only have surge or less old nodes left, then
+			// just scale when terminating node.
+			scaleDown = numOldNodes <= surge
+			numOldNodes--
+		}
+
+		_, span := tracing.Start(ctx, "node.replace",
+			tracing.String("node.name", node.Name),
+			tracing.String("node.instance_id", instanceID(node)),
+			tracing.String("node.failure_domain", node.FailureDomain),
+			tracing.Bool("node_pool.scale_down", scaleDown),
+		)
+		start := time.Now()
+		err := r.nodePoolManager.TerminateNode(ctx, node, scaleDown)
+		tracing.End(span, err)
+		if drainErr, ok := err.(*DrainError); ok {
+			// a node which can't be drained doesn't block the
+			// replacement of the remaining nodes.
+			err = r.quarantineNode(ctx, nodePoolDesc, node, drainErr)
+			if err != nil {
+				return nil, err
+			}
 
-		err := r.nodePoolManager.TerminateNode(node, scaleDown)
+			progress.Replacing = progress.Replacing[1:]
+			r.setRolloutProgress(nodePoolDesc, progress)
+			continue
+		}
 		if err != nil {
-			return err
+			return nil, err
+		}
+
+		drainTimes = append(drainTimes, time.Since(start))
+		progress.Replaced++
+		progress.Replacing = progress.Replacing[1:]
+		r.setRolloutProgress(nodePoolDesc, progress)
+
+		if node.StickyVolume != "" && hasStickyVolumes(nodePoolDesc) {
+			err = r.moveStickyVolume(ctx, nodePoolDesc, nodePool, node, assigned)
+			if err != nil {
+				return nil, err
+			}
 		}
+	}
+
+	return drainTimes, nil
+}
+
+// recordDrainTimes records the time it took to drain each of the terminated
+// nodes and boot its replacement. The replacements of a batch boot at the
+// same time, so the boot time is the time waited for them after the last
+// node was terminated. It warns if the drain time of a node regressed
+// compared to previous drains and logs the estimated time left for the
+// remaining old nodes.
+func (r *RollingUpdateStrategy) recordDrainTimes(nodePoolDesc *api.NodePool, drainTimes []time.Duration, bootTime time.Duration, remaining int) error {
+	if r.drainStats == nil {
+		return nil
+	}
+
+	stats, err := r.drainStats.GetDrainStats(nodePoolDesc)
+	if err != nil {
+		return err
+	}
+
+	for _, drainTime := range drainTimes {
+		duration := drainTime + bootTime
+		if stats.IsRegression(duration) {
+			r.logger.Warnf("Drain time regression in node pool '%s': %s per node, average %s", nodePoolDesc.Name, duration, stats.Average)
+		}
+
+		stats.Add(duration)
+	}
+
+	r.logger.Infof("Node pool '%s': %d old nodes left, estimated time remaining %s", nodePoolDesc.Name, remaining, time.Duration(remaining)*stats.Average)
+
+	return r.drainStats.SetDrainStats(nodePoolDesc, stats)
+}
+
+// checkFrozen returns ErrNodePoolFrozen if the new nodes of the node pool
+// failed to become ready too many times in a row.
+func (r *RollingUpdateStrategy) checkFrozen(nodePoolDesc *api.NodePool) error {
+	if r.bootstrapFailures == nil {
+		return nil
+	}
+
+	failures, err := r.bootstrapFailures.GetBootstrapFailures(nodePoolDesc)
+	if err != nil {
+		return err
+	}
 
-		numOldNodes--
+	if failures >= maxBootstrapFailures {
+		r.logger.Errorf("Node pool '%s' is frozen after %d consecutive bootstrap failures, fix the node pool configuration to resume updates", nodePoolDesc.Name, failures)
+		return ErrNodePoolFrozen
 	}
 
 	return nil
 }
 
+// recordBootstrapFailure records that new nodes didn't become ready in time
+// and returns ErrNodePoolFrozen once the maximum number of consecutive
+// failures is reached. Otherwise err is returned. Errors other than a timeout
+// of the node pool, failed canary nodes or unhealthy new nodes, e.g. because
+// ctx was canceled, are not recorded.
+func (r *RollingUpdateStrategy) recordBootstrapFailure(ctx context.Context, nodePoolDesc *api.NodePool, err error) error {
+	if r.bootstrapFailures == nil || (err != errTimeoutExceeded && err != ErrCanaryFailed && err != ErrUnhealthyNodes) || ctx.Err() != nil {
+		return err
+	}
+
+	failures, getErr := r.bootstrapFailures.GetBootstrapFailures(nodePoolDesc)
+	if getErr != nil {
+		r.logger.Warnf("Failed to get bootstrap failures: %v", getErr)
+		return err
+	}
+
+	failures++
+
+	setErr := r.bootstrapFailures.SetBootstrapFailures(nodePoolDesc, failures)
+	if setErr != nil {
+		r.logger.Warnf("Failed to record bootstrap failure: %v", setErr)
+		return err
+	}
+
+	if failures >= maxBootstrapFailures {
+		r.logger.Errorf("New nodes of node pool '%s' failed to become ready %d times in a row, freezing the node pool", nodePoolDesc.Name, failures)
+		return ErrNodePoolFrozen
+	}
+
+	r.logger.Warnf("New nodes of node pool '%s' failed to become ready (%d/%d)", nodePoolDesc.Name, failures, maxBootstrapFailures)
+	return err
+}
+
 // cordonNodes cordons a list of nodes.
 func (r *RollingUpdateStrategy) cordonNodes(nodes []*Node) error {
 	r.logger.Debugf("Found %d nodes to cordon", len(nodes))
@@ -123,11 +308,11 @@ func (r *RollingUpdateStrategy) cordonNodes(nodes []*Node) error {
 
 // increaseByUnmatchedNodes increases the Node Pool by the number of nodes
 // where the failure domain was unmatched by new nodes.
-func (r *RollingUpdateStrategy) increaseByUnmatchedNodes(nodePool *NodePool, nodePoolDesc *api.NodePool, unmatchedNodes []*Node) error {
+func (r *RollingUpdateStrategy) increaseByUnmatchedNodes(ctx context.Context, nodePool *NodePool, nodePoolDesc *api.NodePool, unmatchedNodes []*Node) error {
 	if len(unmatchedNodes) > 0 {
 		r.logger.Debugf("Found %d nodes with unmatched failure domain", len(unmatchedNodes))
 		newDesired := nodePool.Desired + len(unmatchedNodes)
-		err := r.nodePoolManager.ScalePool(nodePoolDesc, newDesired)
+		err := r.nodePoolManager.ScalePool(ctx, nodePoolDesc, newDesired)
 		if err != nil {
 			return err
 		}
@@ -144,14 +329,91 @@ func (r *RollingUpdateStrategy) Update(ctx context.Context, nodePoolDesc *api.No
 		return nil
 	}
 
-	// limit surge to max size of the node pool
-	surge := int(math.Min(float64(nodePoolDesc.MaxSize), float64(r.surge)))
+	// don't replace the old nodes if the new ones keep failing.
+	err := r.checkFrozen(nodePoolDesc)
+	if err != nil {
+		return err
+	}
 
+	err = r.checkPaused(ctx, nodePoolDesc)
+	if err != nil {
+		return err
+	}
+
+	nodePool, err := r.nodePoolManager.GetPool(nodePoolDesc)
+	if err != nil {
+		return err
+	}
+	r.reportQuarantinedNodes(ctx, nodePoolDesc, nodePool)
+
+	// nodes launched since the last update, e.g. by the autoscaler, are
+	// initialized even if none of the nodes need to be replaced.
+	r.initializeNodes(nodePool)
+
+	// a node pool scaled to zero has no nodes to replace. Surging would
+	// scale it up just to have the new nodes scaled down again by the
+	// autoscaler, its nodes are launched with the new configuration
+	// anyway.
+	if nodePool.Desired == 0 && len(nodePool.Nodes) == 0 {
+		r.logger.Infof("Node pool '%s' is scaled to zero, nothing to update", nodePoolDesc.Name)
+		return nil
+	}
+
+	if isBlueGreen(nodePoolDesc) {
+		return r.updateBlueGreen(ctx, nodePoolDesc, nodePool)
+	}
+
+	surge, err := r.poolSurge(nodePoolDesc, nodePool.Desired)
+	if err != nil {
+		return err
+	}
+
+	canary, err := r.poolCanary(nodePoolDesc, nodePool.Desired)
+	if err != nil {
+		return err
+	}
+
+	batch, err := r.poolBatch(nodePoolDesc, nodePool.Desired, surge)
+	if err != nil {
+		return err
+	}
+
+	progress := r.getRolloutProgress(nodePoolDesc)
+	if !progress.empty() && !r.isUpdateDone(nodePool) {
+		r.logger.Infof("Resuming update of node pool '%s' started at %s, %d nodes replaced so far", nodePoolDesc.Name, progress.StartedAt, progress.Replaced)
+
+		err = r.resumeReplacing(nodePoolDesc, nodePool, progress)
+		if err != nil {
+			return err
+		}
+	}
+
+	// only replace the old nodes once the canary nodes proved healthy. A
+	// resumed update already passed its canary, nodes replaced on request
+	// don't need one.
+	if canary > 0 && progress.Replaced == 0 && !progress.CanaryPassed && len(withoutQuarantined(outdatedNodes(nodePool))) > 0 {
+		err = r.updateCanary(ctx, nodePoolDesc, nodePool.Desired, canary)
+		if err != nil {
+			return r.recordBootstrapFailure(ctx, nodePoolDesc, err)
+		}
+
+		progress.CanaryPassed = true
+		r.setRolloutProgress(nodePoolDesc, progress)
+	}
+
+	replaced := 0
 	for {
+		// stop between the batches if the updates were paused, the
+		// remaining old nodes are replaced once they're resumed.
+		err = r.checkPaused(ctx, nodePoolDesc)
+		if err != nil {
+			return err
+		}
+
 		// wait/scale to ensure that we have at least 'surge' new nodes in the node pool
 		nodePool, err := r.scaleOutAndWaitForNodesToBeReady(ctx, nodePoolDesc, surge)
 		if err != nil {
-			return err
+			return r.recordBootstrapFailure(ctx, nodePoolDesc, err)
 		}
 
 		// label nodes with correct lifecycle-status
@@ -166,27 +428,71 @@ func (r *RollingUpdateStrategy) Update(ctx context.Context, nodePoolDesc *api.No
 			return err
 		}
 
+		// start the protection of old nodes running batch jobs
+		err = r.protectNodes(nodePool, nodePoolDesc)
+		if err != nil {
+			return err
+		}
+
 		// check if there are no old nodes left to update
 		if r.isUpdateDone(nodePool) {
 			break
 		}
 
+		// don't terminate more old nodes before the new ones are
+		// healthy.
+		err = r.waitForHealthyNodes(ctx, nodePoolDesc)
+		if err != nil {
+			return r.recordBootstrapFailure(ctx, nodePoolDesc, err)
+		}
+
 		// terminate all cordoned nodes and conditionally scale
 		// down the node pool in case there are less than surge old
 		// nodes left to update
-		err = r.terminateCordonedNodes(nodePool, surge)
+		drainTimes, err := r.terminateCordonedNodes(ctx, nodePoolDesc, nodePool, surge, progress)
 		if err != nil {
 			return err
 		}
 
 		// wait for current number of nodes equal to the desired number of nodes
+		start := time.Now()
 		nodePool, err = r.waitForDesiredNodes(ctx, nodePoolDesc)
 		if err != nil {
-			return err
+			return r.recordBootstrapFailure(ctx, nodePoolDesc, err)
+		}
+
+		if len(drainTimes) > 0 {
+			oldNodes, _ := r.splitOldNewNodes(nodePool)
+			err = r.recordDrainTimes(nodePoolDesc, drainTimes, time.Since(start), len(oldNodes))
+			if err != nil {
+				r.logger.Warnf("Failed to record drain time: %v", err)
+			}
+
+			replaced += len(drainTimes)
+			api.ReportRolloutProgress(ctx, nodePoolDesc.Name, progress.Replaced, progress.Replaced+len(oldNodes))
+		}
+
+		// leave the remaining old nodes to the next iteration once the
+		// maximum number of nodes was replaced.
+		if r.maxNodesPerIteration > 0 && replaced >= r.maxNodesPerIteration && !r.isUpdateDone(nodePool) {
+			r.logger.Infof("Replaced %d nodes of node pool '%s', continuing the update in the next iteration", replaced, nodePoolDesc.Name)
+			return ErrRolloutIncomplete
 		}
 
 		// compute nodes to cordon and unmatched nodes
-		toCordon, unmatchedNodes := r.computeNodesList(nodePool, surge)
+		toCordon, unmatchedNodes := r.computeNodesList(nodePool, r.batchSize(batch, replaced))
+
+		// only old nodes deferring their termination are left, wait
+		// for their deadlines before checking again.
+		if terminated == 0 && len(toCordon) == 0 && len(unmatchedNodes) == 0 {
+			r.logger.Infof("Waiting for old nodes of node pool '%s' deferring their termination", nodePoolDesc.Name)
+			select {
+			case <-ctx.Done():
+				return errTimeoutExceeded
+			case <-time.After(operationCheckInterval):
+			}
+			continue
+		}
 
 		// cordon the selected nodes
 		err = r.cordonNodes(toCordon)
@@ -196,7 +502,7 @@ func (r *RollingUpdateStrategy) Update(ctx context.Context, nodePoolDesc *api.No
 
 		// increase node pool size by unmatched nodes in order to
 		// get new nodes in a matching failure domain
-		err = r.increaseByUnmatchedNodes(nodePool, nodePoolDesc, unmatchedNodes)
+		err = r.increaseByUnmatchedNodes(ctx, nodePool, nodePoolDesc, unmatchedNodes)
 		if err != nil {
 			return err
 		}
@@ -208,10 +514,146 @@ func (r *RollingUpdateStrategy) Update(ctx context.Context, nodePoolDesc *api.No
 		default:
 		}
 	}
+
+	if r.bootstrapFailures != nil {
+		err = r.bootstrapFailures.SetBootstrapFailures(nodePoolDesc, 0)
+		if err != nil {
+			r.logger.Warnf("Failed to reset bootstrap failures: %v", err)
+		}
+	}
+
+	if progress.Replaced > 0 {
+		r.logger.Infof("Replaced %d nodes of node pool '%s' since %s", progress.Replaced, nodePoolDesc.Name, progress.StartedAt)
+	}
+	if !progress.empty() {
+		r.setRolloutProgress(nodePoolDesc, &RolloutProgress{})
+	}
+
 	r.logger.Infof("Node pool '%s' successfully updated", nodePoolDesc.Name)
 	return nil
 }
 
+// Plan computes the planned sequence of a rolling update of a single node
+// pool without changing anything. Old nodes with volumes attached are planned
+// first and spread across the failure domains, matching the order used by
+// Update. Batches don't span the iterations of updates limited to a maximum
+// number of nodes per iteration.
+func (r *RollingUpdateStrategy) Plan(ctx context.Context, nodePoolDesc *api.NodePool) (*UpdatePlan, error) {
+	plan := &UpdatePlan{
+		NodePool: nodePoolDesc.Name,
+	}
+
+	if nodePoolDesc.MaxSize < 1 {
+		return plan, nil
+	}
+
+	nodePool, err := r.nodePoolManager.GetPool(nodePoolDesc)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.Surge, err = r.poolSurge(nodePoolDesc, nodePool.Desired)
+	if err != nil {
+		return nil, err
+	}
+
+	plan.Canary, err = r.poolCanary(nodePoolDesc, nodePool.Desired)
+	if err != nil {
+		return nil, err
+	}
+
+	batch, err := r.poolBatch(nodePoolDesc, nodePool.Desired, plan.Surge)
+	if err != nil {
+		return nil, err
+	}
+
+	oldNodes, _ := r.splitOldNewNodes(nodePool)
+	volumesAttached, noVolumesAttached := r.splitVolumeNoVolumeAttachedNodes(oldNodes)
+	available := availableNodes(nodePool.Nodes)
+	ordered := append(spreadFailureDomains(volumesAttached, available), spreadFailureDomains(noVolumesAttached, available)...)
+
+	if len(ordered) > 0 {
+		plan.BlastRadius, err = r.nodePoolManager.BlastRadius(ordered)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// blue/green updates replace all old nodes in a single batch.
+	if isBlueGreen(nodePoolDesc) {
+		plan.Surge = len(ordered)
+		plan.Canary = 0
+		if len(ordered) > 0 {
+			plan.Batches = [][]*Node{ordered}
+		}
+		plan.EstimatedDuration = time.Duration(len(plan.Batches)) * defaultBatchDuration
+		return plan, nil
+	}
+
+	replaced := 0
+	for len(ordered) > 0 {
+		if replaced == r.maxNodesPerIteration {
+			replaced = 0
+		}
+		size := int(math.Min(float64(r.batchSize(batch, replaced)), float64(len(ordered))))
+		plan.Batches = append(plan.Batches, ordered[:size])
+		ordered = ordered[size:]
+		replaced += size
+	}
+
+	plan.EstimatedDuration = time.Duration(len(plan.Batches)) * defaultBatchDuration
+	if plan.Canary > 0 && len(plan.Batches) > 0 {
+		plan.EstimatedDuration += r.canarySoakPeriod
+	}
+
+	// prefer the historical drain times for the estimate if available
+	if r.drainStats != nil {
+		stats, err := r.drainStats.GetDrainStats(nodePoolDesc)
+		if err != nil {
+			return nil, err
+		}
+		if stats.Samples > 0 {
+			plan.EstimatedDuration = time.Duration(plan.Nodes()) * stats.Average
+		}
+	}
+
+	return plan, nil
+}
+
+// poolSurge returns the surge of the node pool, limited to its max size. The
+// surge of the strategy is used unless the node pool defines its own.
+func (r *RollingUpdateStrategy) poolSurge(nodePoolDesc *api.NodePool, desired int) (int, error) {
+	surge := r.surge
+	if nodePoolDesc.UpdateSurge != "" {
+		var err error
+		surge, err = ParseSurge(nodePoolDesc.UpdateSurge, desired)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return int(math.Min(float64(nodePoolDesc.MaxSize), float64(surge))), nil
+}
+
+// poolBatch returns the number of old nodes of the node pool drained at the
+// same time: the surge, limited by the max unavailable nodes of the node pool
+// or the strategy.
+func (r *RollingUpdateStrategy) poolBatch(nodePoolDesc *api.NodePool, desired, surge int) (int, error) {
+	maxUnavailable := r.maxUnavailable
+	if nodePoolDesc.UpdateMaxUnavailable != "" {
+		var err error
+		maxUnavailable, err = ParseMaxUnavailable(nodePoolDesc.UpdateMaxUnavailable, desired)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	if maxUnavailable > 0 && maxUnavailable < surge {
+		return maxUnavailable, nil
+	}
+	return surge, nil
+}
+
 // computeNodesList computes what old nodes to be cordoned and for which nodes
 // the failure domain is unmatched by new nodes. It will at most return surge
 // nodes. It will return a list of nodes to be cordoned as the first value and
@@ -220,9 +662,12 @@ func (r *RollingUpdateStrategy) Update(ctx context.Context, nodePoolDesc *api.No
 // Only for nodes which has the VolumesAttached flag set will it attempt to
 // find new nodes with a matching failure domain. The failure domain is not
 // considered when the node doesn't have any volumes attached as it is not
-// necessary.
+// necessary. Old nodes deferring their termination are left out. The nodes
+// are spread across the failure domains, such that a batch avoids taking
+// down all capacity of a failure domain.
 func (r *RollingUpdateStrategy) computeNodesList(nodePool *NodePool, surge int) ([]*Node, []*Node) {
 	oldNodes, newNodes := r.splitOldNewNodes(nodePool)
+	_, oldNodes = splitDeferredNodes(oldNodes)
 
 	newNodesMap := make(map[string]*Node, len(newNodes))
 
@@ -231,6 +676,9 @@ func (r *RollingUpdateStrategy) computeNodesList(nodePool *NodePool, surge int)
 	}
 
 	volumesAttached, noVolumesAttached := r.splitVolumeNoVolumeAttachedNodes(oldNodes)
+	available := availableNodes(nodePool.Nodes)
+	volumesAttached = spreadFailureDomains(volumesAttached, available)
+	noVolumesAttached = spreadFailureDomains(noVolumesAttached, available)
 
 	toCordon := make([]*Node, 0, len(oldNodes))
 	unmatchedNodes := []*Node{}
@@ -278,13 +726,15 @@ func (r *RollingUpdateStrategy) scaleOutAndWaitForNodesToBeReady(ctx context.Con
 			return nil, err
 		}
 
-		// separate old and new nodes
-		_, newNodes := r.splitOldNewNodes(nodePool)
-		if len(newNodes) >= surge {
+		// nodes replaced on request count as new nodes, as they're
+		// only replaced after their termination. Quarantined nodes
+		// don't count at all.
+		newNodes := len(withoutQuarantined(nodePool.Nodes)) - len(withoutQuarantined(outdatedNodes(nodePool)))
+		if newNodes >= surge {
 			break
 		}
-		newDesired := nodePool.Desired + surge - len(newNodes)
-		err = r.nodePoolManager.ScalePool(nodePoolDesc, newDesired)
+		newDesired := nodePool.Desired + surge - newNodes
+		err = r.nodePoolManager.ScalePool(ctx, nodePoolDesc, newDesired)
 		if err != nil {
 			return nil, err
 		}
@@ -295,12 +745,16 @@ func (r *RollingUpdateStrategy) scaleOutAndWaitForNodesToBeReady(ctx context.Con
 
 // waitForDesiredNodes waits for the current number of nodes to match the
 // desired number. The final node pool will be returned.
-func (r *RollingUpdateStrategy) waitForDesiredNodes(ctx context.Context, nodePoolDesc *api.NodePool) (*NodePool, error) {
+func (r *RollingUpdateStrategy) waitForDesiredNodes(ctx context.Context, nodePoolDesc *api.NodePool) (nodePool *NodePool, err error) {
+	ctx, span := tracing.Start(ctx, "node_pool.wait_for_nodes", tracing.String("node_pool.name", nodePoolDesc.Name))
+	defer func() {
+		tracing.End(span, err)
+	}()
+
 	ctx, cancel := context.WithTimeout(ctx, operationMaxTimeout)
 	defer cancel()
 
-	var err error
-	var nodePool *NodePool
+	api.ReportProgress(ctx, api.ProgressStepWaitingForNodesReady, nodePoolDesc.Name, fmt.Sprintf("Waiting for nodes of node pool %s to be ready", nodePoolDesc.Name))
 
 	for {
 		nodePool, err = r.nodePoolManager.GetPool(nodePoolDesc)
@@ -308,6 +762,8 @@ func (r *RollingUpdateStrategy) waitForDesiredNodes(ctx context.Context, nodePoo
 			return nil, err
 		}
 
+		r.initializeNodes(nodePool)
+
 		readyNodes := len(nodePool.ReadyNodes())
 
 		if readyNodes == nodePool.Desired {
@@ -326,16 +782,37 @@ func (r *RollingUpdateStrategy) waitForDesiredNodes(ctx context.Context, nodePoo
 	return nodePool, nil
 }
 
+// initializeNodes tries to initialize the nodes of the node pool which still
+// have the startup taint. Nodes which can't be initialized yet are considered
+// not ready.
+func (r *RollingUpdateStrategy) initializeNodes(nodePool *NodePool) {
+	for _, node := range nodePool.Nodes {
+		if !node.Ready || !hasStartupTaint(node) {
+			continue
+		}
+
+		initialized, err := r.nodePoolManager.InitializeNode(node)
+		if err != nil {
+			r.logger.Warnf("Failed to initialize node %s: %v", node.Name, err)
+		}
+		node.Ready = initialized
+	}
+}
+
 // splitOldNewNodes splits a slice of nodes into two slices of old and new
 // nodes.  Whether a node is old or new is determined by the Generation of the
 // node. If it matches the Generation of the NodePool it's considered new,
-// otherwise it's considered old.
+// otherwise it's considered old. Nodes whose replacement was requested are
+// old as well. Quarantined nodes are neither.
 func (r *RollingUpdateStrategy) splitOldNewNodes(nodePool *NodePool) ([]*Node, []*Node) {
 	oldNodes := make([]*Node, 0)
 	newNodes := make([]*Node, 0)
 
 	for _, node := range nodePool.Nodes {
-		if node.Generation != nodePool.Generation {
+		if node.Quarantined() {
+			continue
+		}
+		if node.Generation != nodePool.Generation || nodePool.replaceRequested(node) {
 			oldNodes = append(oldNodes, node)
 		} else {
 			newNodes = append(newNodes, node)
@@ -363,8 +840,16 @@ func (r *RollingUpdateStrategy) splitVolumeNoVolumeAttachedNodes(nodes []*Node)
 }
 
 // filterNodesToTerminate filters for nodes that are cordoned (unschedulable) and
-// wasn't already marked for draining.
+// wasn't already marked for draining. Nodes deferring their termination are
+// skipped until their deadline passed.
 func (r *RollingUpdateStrategy) filterNodesToTerminate(nodes []*Node) []*Node {
+	deferred, nodes := splitDeferredNodes(nodes)
+	for _, node := range deferred {
+		if node.Cordoned {
+			r.logger.Infof("Deferring termination of node %s until %s", node.Name, node.TerminationDeadline())
+		}
+	}
+
 	cordoned := make([]*Node, 0)
 	for _, node := range nodes {
 		if node.Cordoned {
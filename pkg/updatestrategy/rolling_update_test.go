@@ -2,7 +2,9 @@ package updatestrategy
 
 import (
 	"context"
+	"fmt"
 	"math/rand"
+	"reflect"
 	"testing"
 	"time"
 
@@ -41,7 +43,8 @@ func mockNode(failureDomain string, generation int, cordoned, volumesAttached bo
 // mockNodePoolManager implements the NodePoolManager interface for testing. It
 // works by maintaining a NodePool.
 type mockNodePoolManager struct {
-	nodePool *NodePool
+	nodePool     *NodePool
+	movedVolumes []string
 }
 
 func (m *mockNodePoolManager) GetPool(nodePool *api.NodePool) (*NodePool, error) {
@@ -52,11 +55,15 @@ func (m *mockNodePoolManager) LabelNode(node *Node, labelKey, labelValue string)
 	return nil
 }
 
+func (m *mockNodePoolManager) AnnotateNode(node *Node, annotationKey, annotationValue string) error {
+	return nil
+}
+
 func (m *mockNodePoolManager) TaintNode(node *Node, taintKey, taintValue string, effect v1.TaintEffect) error {
 	return nil
 }
 
-func (m *mockNodePoolManager) ScalePool(nodePool *api.NodePool, replicas int) error {
+func (m *mockNodePoolManager) ScalePool(ctx context.Context, nodePool *api.NodePool, replicas int) error {
 	if replicas > m.nodePool.Current {
 		delta := replicas - m.nodePool.Current
 		for i := 0; i < delta; i++ {
@@ -73,7 +80,7 @@ func (m *mockNodePoolManager) ScalePool(nodePool *api.NodePool, replicas int) er
 	return nil
 }
 
-func (m *mockNodePoolManager) TerminateNode(node *Node, decrementDesired bool) error {
+func (m *mockNodePoolManager) TerminateNode(ctx context.Context, node *Node, decrementDesired bool) error {
 	newNodes := make([]*Node, 0, len(m.nodePool.Nodes))
 	for _, n := range m.nodePool.Nodes {
 		if n.ProviderID != node.ProviderID {
@@ -91,7 +98,7 @@ func (m *mockNodePoolManager) TerminateNode(node *Node, decrementDesired bool) e
 
 	if !decrementDesired {
 		// rescale pool to replace 'terminated' nodes
-		return m.ScalePool(nil, replicas)
+		return m.ScalePool(ctx, nil, replicas)
 	}
 
 	return nil
@@ -106,6 +113,23 @@ func (m *mockNodePoolManager) CordonNode(node *Node) error {
 	return nil
 }
 
+func (m *mockNodePoolManager) InitializeNode(node *Node) (bool, error) {
+	return true, nil
+}
+
+func (m *mockNodePoolManager) BlastRadius(nodes []*Node) (*BlastRadius, error) {
+	return &BlastRadius{Nodes: len(nodes), ClusterNodes: len(m.nodePool.Nodes)}, nil
+}
+
+func (m *mockNodePoolManager) CheckNodeHealth(node *Node) ([]string, error) {
+	return node.Problems, nil
+}
+
+func (m *mockNodePoolManager) MoveStickyVolume(ctx context.Context, from, to *Node, device string) error {
+	m.movedVolumes = append(m.movedVolumes, fmt.Sprintf("%s->%s", from.StickyVolume, to.FailureDomain))
+	return nil
+}
+
 // get the failure domain used by the least amount of nodes in a nodes list.
 // if two failure domains both has the least amount of nodes, then the failure
 // domain strings are ordered and the first one is favoured in order to produce
@@ -274,11 +298,27 @@ func TestUpdate(tt *testing.T) {
 			},
 			success: true,
 		},
+		{
+			msg: "test node pool scaled to zero isn't scaled up",
+			nodePoolManager: &mockNodePoolManager{
+				nodePool: &NodePool{
+					Max:        20,
+					Generation: 2,
+				},
+			},
+			surge:           3,
+			nodePoolMaxSize: 20,
+			expected: &NodePool{
+				Max:        20,
+				Generation: 2,
+			},
+			success: true,
+		},
 	} {
 		tt.Run(tc.msg, func(t *testing.T) {
 			logger := log.WithField("test", true)
 			np := &api.NodePool{Name: "test", MaxSize: tc.nodePoolMaxSize}
-			strategy := NewRollingUpdateStrategy(logger, tc.nodePoolManager, tc.surge)
+			strategy := NewRollingUpdateStrategy(logger, tc.nodePoolManager, nil, nil, nil, tc.surge, 0, 0, 0, 0)
 			err := strategy.Update(context.Background(), np)
 			if err != nil && tc.success {
 				t.Errorf("should not fail: %v", err)
@@ -295,6 +335,86 @@ func TestUpdate(tt *testing.T) {
 	}
 }
 
+func TestUpdateReplacesRequestedNode(t *testing.T) {
+	requested := mockNode("b", 1, false, false)
+	requested.ReplaceRequested = true
+
+	nodes := []*Node{
+		mockNode("a", 1, false, false),
+		requested,
+		mockNode("c", 1, false, false),
+		mockNode("a", 1, false, false),
+	}
+	manager := &mockNodePoolManager{
+		nodePool: &NodePool{
+			Min:        4,
+			Max:        4,
+			Current:    4,
+			Desired:    4,
+			Generation: 1,
+			Nodes:      append([]*Node(nil), nodes...),
+		},
+	}
+
+	np := &api.NodePool{Name: "test", MaxSize: 20}
+	strategy := NewRollingUpdateStrategy(log.WithField("test", true), manager, nil, nil, nil, 1, 0, 0, 0, 0)
+	err := strategy.Update(context.Background(), np)
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+
+	// only the requested node is replaced, without changing the size of
+	// the node pool.
+	if manager.nodePool.Desired != 4 || len(manager.nodePool.Nodes) != 4 {
+		t.Errorf("expected 4 nodes, got %d (desired %d)", len(manager.nodePool.Nodes), manager.nodePool.Desired)
+	}
+	remaining := make(map[string]bool)
+	for _, node := range manager.nodePool.Nodes {
+		remaining[node.ProviderID] = true
+	}
+	for _, node := range nodes {
+		if remaining[node.ProviderID] == node.ReplaceRequested {
+			t.Errorf("unexpected replacement state of node %s (replace requested: %t)", node.ProviderID, node.ReplaceRequested)
+		}
+	}
+}
+
+func TestUpdateMovesStickyVolumes(t *testing.T) {
+	nodeA := mockNode("a", 0, false, true)
+	nodeA.StickyVolume = "vol-a"
+	nodeB := mockNode("b", 0, false, true)
+	nodeB.StickyVolume = "vol-b"
+
+	manager := &mockNodePoolManager{
+		nodePool: &NodePool{
+			Min:        2,
+			Max:        2,
+			Current:    2,
+			Desired:    2,
+			Generation: 1,
+			Nodes:      []*Node{nodeA, nodeB},
+		},
+	}
+
+	np := &api.NodePool{
+		Name:    "test",
+		MaxSize: 20,
+		Storage: &api.NodeStorage{StickyVolumes: true, MountPath: "/data"},
+	}
+	strategy := NewRollingUpdateStrategy(log.WithField("test", true), manager, nil, nil, nil, 1, 0, 0, 0, 0)
+	err := strategy.Update(context.Background(), np)
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+
+	// the volumes are moved to new nodes in the failure domain of the
+	// replaced nodes.
+	expected := []string{"vol-a->a", "vol-b->b"}
+	if !reflect.DeepEqual(manager.movedVolumes, expected) {
+		t.Errorf("expected moved volumes %v, got %v", expected, manager.movedVolumes)
+	}
+}
+
 func equalNodePool(a, b *NodePool) bool {
 	if a.Current != b.Current {
 		return false
@@ -325,3 +445,220 @@ func equalNodePool(a, b *NodePool) bool {
 
 	return true
 }
+
+func TestPlan(tt *testing.T) {
+	for _, tc := range []struct {
+		msg             string
+		nodePool        *NodePool
+		surge           int
+		poolSurge       string
+		maxUnavailable  int
+		poolUnavailable string
+		nodePoolMaxSize int64
+		batches         []int
+	}{
+		{
+			msg: "test no batches when all nodes are up to date",
+			nodePool: &NodePool{
+				Generation: 1,
+				Nodes: []*Node{
+					mockNode("a", 1, false, false),
+					mockNode("b", 1, false, false),
+				},
+			},
+			surge:           3,
+			nodePoolMaxSize: 20,
+			batches:         nil,
+		},
+		{
+			msg: "test old nodes are split into batches of surge",
+			nodePool: &NodePool{
+				Generation: 2,
+				Nodes: []*Node{
+					mockNode("a", 1, false, false),
+					mockNode("b", 1, false, false),
+					mockNode("c", 1, false, false),
+					mockNode("a", 1, false, false),
+					mockNode("b", 2, false, false),
+				},
+			},
+			surge:           3,
+			nodePoolMaxSize: 20,
+			batches:         []int{3, 1},
+		},
+		{
+			msg: "test surge is limited by the node pool max size",
+			nodePool: &NodePool{
+				Generation: 2,
+				Nodes: []*Node{
+					mockNode("a", 1, false, false),
+					mockNode("b", 1, false, false),
+				},
+			},
+			surge:           3,
+			nodePoolMaxSize: 1,
+			batches:         []int{1, 1},
+		},
+		{
+			msg: "test the surge of the node pool is a percentage of the desired nodes",
+			nodePool: &NodePool{
+				Generation: 2,
+				Desired:    4,
+				Nodes: []*Node{
+					mockNode("a", 1, false, false),
+					mockNode("b", 1, false, false),
+					mockNode("c", 1, false, false),
+					mockNode("d", 1, false, false),
+				},
+			},
+			surge:           3,
+			poolSurge:       "50%",
+			nodePoolMaxSize: 20,
+			batches:         []int{2, 2},
+		},
+		{
+			msg: "test batches are limited by the max unavailable nodes",
+			nodePool: &NodePool{
+				Generation: 2,
+				Nodes: []*Node{
+					mockNode("a", 1, false, false),
+					mockNode("b", 1, false, false),
+					mockNode("c", 1, false, false),
+				},
+			},
+			surge:           3,
+			maxUnavailable:  1,
+			nodePoolMaxSize: 20,
+			batches:         []int{1, 1, 1},
+		},
+		{
+			msg: "test the max unavailable nodes of the node pool override the strategy",
+			nodePool: &NodePool{
+				Generation: 2,
+				Desired:    4,
+				Nodes: []*Node{
+					mockNode("a", 1, false, false),
+					mockNode("b", 1, false, false),
+					mockNode("c", 1, false, false),
+					mockNode("d", 1, false, false),
+				},
+			},
+			surge:           3,
+			maxUnavailable:  1,
+			poolUnavailable: "50%",
+			nodePoolMaxSize: 20,
+			batches:         []int{2, 2},
+		},
+	} {
+		tt.Run(tc.msg, func(t *testing.T) {
+			logger := log.WithField("test", true)
+			np := &api.NodePool{Name: "test", MaxSize: tc.nodePoolMaxSize, UpdateSurge: tc.poolSurge, UpdateMaxUnavailable: tc.poolUnavailable}
+			strategy := NewRollingUpdateStrategy(logger, &mockNodePoolManager{nodePool: tc.nodePool}, nil, nil, nil, tc.surge, 0, 0, 0, tc.maxUnavailable)
+			plan, err := strategy.Plan(context.Background(), np)
+			if err != nil {
+				t.Errorf("should not fail: %v", err)
+			}
+
+			if len(plan.Batches) != len(tc.batches) {
+				t.Fatalf("expected %d batches, got %d", len(tc.batches), len(plan.Batches))
+			}
+
+			for i, batch := range plan.Batches {
+				if len(batch) != tc.batches[i] {
+					t.Errorf("expected batch %d to have %d nodes, got %d", i, tc.batches[i], len(batch))
+				}
+			}
+
+			if plan.EstimatedDuration != time.Duration(len(tc.batches))*defaultBatchDuration {
+				t.Errorf("unexpected estimated duration %s", plan.EstimatedDuration)
+			}
+
+			if len(tc.batches) > 0 && (plan.BlastRadius == nil || plan.BlastRadius.Nodes != plan.Nodes()) {
+				t.Errorf("expected blast radius of %d nodes, got %v", plan.Nodes(), plan.BlastRadius)
+			}
+		})
+	}
+}
+
+// mockBootstrapFailureStore implements the BootstrapFailureStore interface
+// for testing.
+type mockBootstrapFailureStore struct {
+	failures int
+}
+
+func (m *mockBootstrapFailureStore) GetBootstrapFailures(nodePool *api.NodePool) (int, error) {
+	return m.failures, nil
+}
+
+func (m *mockBootstrapFailureStore) SetBootstrapFailures(nodePool *api.NodePool, failures int) error {
+	m.failures = failures
+	return nil
+}
+
+func TestBootstrapFailures(t *testing.T) {
+	logger := log.WithField("test", true)
+	nodePoolDesc := &api.NodePool{Name: "test", MinSize: 1, MaxSize: 1}
+	store := &mockBootstrapFailureStore{}
+	strategy := NewRollingUpdateStrategy(logger, &mockNodePoolManager{}, nil, store, nil, 1, 0, 0, 0, 0)
+
+	// canceled updates are not counted as bootstrap failures
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	err := strategy.recordBootstrapFailure(ctx, nodePoolDesc, errTimeoutExceeded)
+	if err != errTimeoutExceeded || store.failures != 0 {
+		t.Errorf("expected failure not to be recorded, got %v (%d failures)", err, store.failures)
+	}
+
+	for i := 1; i < maxBootstrapFailures; i++ {
+		err := strategy.recordBootstrapFailure(context.Background(), nodePoolDesc, errTimeoutExceeded)
+		if err != errTimeoutExceeded {
+			t.Errorf("expected %v, got %v", errTimeoutExceeded, err)
+		}
+	}
+
+	err = strategy.recordBootstrapFailure(context.Background(), nodePoolDesc, errTimeoutExceeded)
+	if err != ErrNodePoolFrozen {
+		t.Errorf("expected %v, got %v", ErrNodePoolFrozen, err)
+	}
+
+	// a frozen node pool is not updated, the mock node pool manager would
+	// panic if it was used.
+	err = strategy.Update(context.Background(), nodePoolDesc)
+	if err != ErrNodePoolFrozen {
+		t.Errorf("expected %v, got %v", ErrNodePoolFrozen, err)
+	}
+}
+
+// mockDrainStatsStore implements the DrainStatsStore interface for testing.
+type mockDrainStatsStore struct {
+	stats DrainStats
+}
+
+func (m *mockDrainStatsStore) GetDrainStats(nodePool *api.NodePool) (*DrainStats, error) {
+	stats := m.stats
+	return &stats, nil
+}
+
+func (m *mockDrainStatsStore) SetDrainStats(nodePool *api.NodePool, stats *DrainStats) error {
+	m.stats = *stats
+	return nil
+}
+
+func TestRecordDrainTimes(t *testing.T) {
+	logger := log.WithField("test", true)
+	nodePoolDesc := &api.NodePool{Name: "test", MinSize: 1, MaxSize: 3}
+	store := &mockDrainStatsStore{}
+	strategy := NewRollingUpdateStrategy(logger, &mockNodePoolManager{}, store, nil, nil, 1, 0, 0, 0, 0)
+
+	// every node is a sample of its own drain time and the boot time of
+	// the replacements.
+	err := strategy.recordDrainTimes(nodePoolDesc, []time.Duration{time.Minute, 5 * time.Minute}, time.Minute, 1)
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+
+	expected := DrainStats{Samples: 2, Average: 4 * time.Minute}
+	if store.stats != expected {
+		t.Errorf("expected %v, got %v", expected, store.stats)
+	}
+}
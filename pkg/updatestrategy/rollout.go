@@ -0,0 +1,188 @@
+package updatestrategy
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// ErrRolloutIncomplete is returned when a node pool update replaced the
+// maximum number of nodes per iteration. The update is resumed by the next
+// update of the node pool.
+var ErrRolloutIncomplete = errors.New("node pool update continues in the next iteration")
+
+// ErrUpdatePaused is returned when the updates of the cluster were paused.
+// The update is resumed by the first update of the node pool after the
+// updates are unpaused.
+var ErrUpdatePaused = errors.New("node pool update paused")
+
+const (
+	rolloutCanaryPassed    = "canary"
+	rolloutReplacingPrefix = "replacing="
+)
+
+// RolloutProgress is the progress of a node pool update spanning multiple
+// iterations. It's checkpointed during the update such that an update
+// interrupted by a restart of CLM resumes where it stopped: CanaryPassed
+// records that the canary nodes proved healthy and Replacing holds the
+// instance IDs of the old nodes being terminated.
+type RolloutProgress struct {
+	Replaced     int
+	StartedAt    time.Time
+	CanaryPassed bool
+	Replacing    []string
+}
+
+// RolloutStore persists the rollout progress per node pool. Implementations
+// must reset the progress when the configuration of the node pool's nodes
+// changes.
+type RolloutStore interface {
+	GetRolloutProgress(nodePool *api.NodePool) (*RolloutProgress, error)
+	SetRolloutProgress(nodePool *api.NodePool, progress *RolloutProgress) error
+}
+
+// empty returns true if nothing of the update was checkpointed yet.
+func (p *RolloutProgress) empty() bool {
+	return p.Replaced == 0 && !p.CanaryPassed && len(p.Replacing) == 0
+}
+
+// String encodes the progress as '<replaced>/<started at>', followed by
+// ' canary' if the canary passed and ' replacing=<id>,<id>' if old nodes are
+// being terminated.
+func (p *RolloutProgress) String() string {
+	value := fmt.Sprintf("%d/%s", p.Replaced, p.StartedAt.UTC().Format(time.RFC3339))
+	if p.CanaryPassed {
+		value += " " + rolloutCanaryPassed
+	}
+	if len(p.Replacing) > 0 {
+		value += " " + rolloutReplacingPrefix + strings.Join(p.Replacing, ",")
+	}
+	return value
+}
+
+// parseRolloutProgress parses progress encoded by RolloutProgress.String.
+func parseRolloutProgress(value string) (*RolloutProgress, error) {
+	parts := strings.Split(value, "/")
+	if len(parts) != 2 {
+		return nil, fmt.Errorf("invalid rollout progress '%s'", value)
+	}
+
+	replaced, err := strconv.Atoi(parts[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid rollout progress '%s': %v", value, err)
+	}
+
+	fields := strings.Fields(parts[1])
+	if len(fields) == 0 {
+		return nil, fmt.Errorf("invalid rollout progress '%s'", value)
+	}
+
+	startedAt, err := time.Parse(time.RFC3339, fields[0])
+	if err != nil {
+		return nil, fmt.Errorf("invalid rollout progress '%s': %v", value, err)
+	}
+
+	progress := &RolloutProgress{Replaced: replaced, StartedAt: startedAt}
+	for _, field := range fields[1:] {
+		switch {
+		case field == rolloutCanaryPassed:
+			progress.CanaryPassed = true
+		case strings.HasPrefix(field, rolloutReplacingPrefix):
+			progress.Replacing = strings.Split(strings.TrimPrefix(field, rolloutReplacingPrefix), ",")
+		default:
+			return nil, fmt.Errorf("invalid rollout progress '%s': unknown field '%s'", value, field)
+		}
+	}
+
+	return progress, nil
+}
+
+// instanceID returns the ID of the instance of a node, the last segment of
+// its provider ID.
+func instanceID(node *Node) string {
+	return node.ProviderID[strings.LastIndex(node.ProviderID, "/")+1:]
+}
+
+// getRolloutProgress returns the stored progress of the node pool update or
+// a new progress if nothing was stored yet.
+func (r *RollingUpdateStrategy) getRolloutProgress(nodePoolDesc *api.NodePool) *RolloutProgress {
+	if r.rollouts != nil {
+		progress, err := r.rollouts.GetRolloutProgress(nodePoolDesc)
+		if err != nil {
+			r.logger.Warnf("Failed to get rollout progress: %v", err)
+		} else if !progress.empty() {
+			return progress
+		}
+	}
+	return &RolloutProgress{StartedAt: time.Now().UTC()}
+}
+
+// setRolloutProgress stores the progress of the node pool update.
+func (r *RollingUpdateStrategy) setRolloutProgress(nodePoolDesc *api.NodePool, progress *RolloutProgress) {
+	if r.rollouts == nil {
+		return
+	}
+
+	err := r.rollouts.SetRolloutProgress(nodePoolDesc, progress)
+	if err != nil {
+		r.logger.Warnf("Failed to record rollout progress: %v", err)
+	}
+}
+
+// checkPaused returns ErrUpdatePaused if the updates of ctx are paused.
+func (r *RollingUpdateStrategy) checkPaused(ctx context.Context, nodePoolDesc *api.NodePool) error {
+	paused, err := api.UpdatesPaused(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to check if updates are paused: %v", err)
+	}
+
+	if paused {
+		r.logger.Warnf("Updates are paused, stopping the update of node pool '%s'", nodePoolDesc.Name)
+		api.ReportProgress(ctx, api.ProgressStepPaused, nodePoolDesc.Name, fmt.Sprintf("Update of node pool %s paused", nodePoolDesc.Name))
+		return ErrUpdatePaused
+	}
+	return nil
+}
+
+// batchSize returns the number of old nodes to replace next. It's limited by
+// the surge and by the nodes left to replace in this iteration.
+func (r *RollingUpdateStrategy) batchSize(surge, replaced int) int {
+	if r.maxNodesPerIteration > 0 && r.maxNodesPerIteration-replaced < surge {
+		return r.maxNodesPerIteration - replaced
+	}
+	return surge
+}
+
+// resumeReplacing cordons the old nodes which were being terminated when the
+// update was interrupted, e.g. by a restart of CLM, such that they're
+// terminated first instead of draining another batch of old nodes.
+func (r *RollingUpdateStrategy) resumeReplacing(nodePoolDesc *api.NodePool, nodePool *NodePool, progress *RolloutProgress) error {
+	if len(progress.Replacing) == 0 {
+		return nil
+	}
+
+	replacing := make(map[string]bool, len(progress.Replacing))
+	for _, id := range progress.Replacing {
+		replacing[id] = true
+	}
+
+	oldNodes, _ := r.splitOldNewNodes(nodePool)
+	for _, node := range oldNodes {
+		if !replacing[instanceID(node)] || node.Cordoned {
+			continue
+		}
+
+		r.logger.Infof("Resuming the termination of node %s of node pool '%s'", node.Name, nodePoolDesc.Name)
+		err := r.nodePoolManager.CordonNode(node)
+		if err != nil {
+			return err
+		}
+		node.Cordoned = true
+	}
+	return nil
+}
@@ -0,0 +1,198 @@
+package updatestrategy
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// mockRolloutStore implements the RolloutStore interface for testing.
+type mockRolloutStore struct {
+	progress RolloutProgress
+}
+
+func (m *mockRolloutStore) GetRolloutProgress(nodePool *api.NodePool) (*RolloutProgress, error) {
+	progress := m.progress
+	return &progress, nil
+}
+
+func (m *mockRolloutStore) SetRolloutProgress(nodePool *api.NodePool, progress *RolloutProgress) error {
+	m.progress = *progress
+	return nil
+}
+
+func mockLargeNodePool(nodes int) *NodePool {
+	nodePool := &NodePool{
+		Min:        nodes,
+		Max:        nodes,
+		Current:    nodes,
+		Desired:    nodes,
+		Generation: 2,
+	}
+	for i := 0; i < nodes; i++ {
+		nodePool.Nodes = append(nodePool.Nodes, mockNode(getFailureDomain(nodePool.Nodes), 1, false, false))
+	}
+	return nodePool
+}
+
+func TestUpdateMaxNodesPerIteration(t *testing.T) {
+	logger := log.WithField("test", true)
+	np := &api.NodePool{Name: "test", MaxSize: 20}
+
+	store := &mockRolloutStore{}
+	manager := &mockNodePoolManager{nodePool: mockLargeNodePool(4)}
+	strategy := NewRollingUpdateStrategy(logger, manager, nil, nil, store, 1, 0, 2, 0, 0)
+
+	err := strategy.Update(context.Background(), np)
+	if err != ErrRolloutIncomplete {
+		t.Fatalf("expected %v, got %v", ErrRolloutIncomplete, err)
+	}
+
+	oldNodes, _ := strategy.splitOldNewNodes(manager.nodePool)
+	if len(oldNodes) != 2 || store.progress.Replaced != 2 {
+		t.Errorf("expected 2 replaced and 2 old nodes, got %d replaced and %d old nodes", store.progress.Replaced, len(oldNodes))
+	}
+	startedAt := store.progress.StartedAt
+
+	// the next iteration resumes the update.
+	err = strategy.Update(context.Background(), np)
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+
+	oldNodes, newNodes := strategy.splitOldNewNodes(manager.nodePool)
+	if len(oldNodes) != 0 || len(newNodes) != 4 {
+		t.Errorf("expected 4 new nodes, got %d old and %d new nodes", len(oldNodes), len(newNodes))
+	}
+
+	if store.progress.Replaced != 0 {
+		t.Errorf("expected the progress of the finished update to be reset, got %s", &store.progress)
+	}
+
+	if startedAt.IsZero() {
+		t.Errorf("expected the start of the update to be recorded")
+	}
+}
+
+func TestPlanMaxNodesPerIteration(t *testing.T) {
+	logger := log.WithField("test", true)
+	np := &api.NodePool{Name: "test", MaxSize: 20}
+
+	strategy := NewRollingUpdateStrategy(logger, &mockNodePoolManager{nodePool: mockLargeNodePool(5)}, nil, nil, nil, 3, 0, 4, 0, 0)
+	plan, err := strategy.Plan(context.Background(), np)
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+
+	expected := []int{3, 1, 1}
+	if len(plan.Batches) != len(expected) {
+		t.Fatalf("expected %d batches, got %d", len(expected), len(plan.Batches))
+	}
+	for i, batch := range plan.Batches {
+		if len(batch) != expected[i] {
+			t.Errorf("expected batch %d to have %d nodes, got %d", i+1, expected[i], len(batch))
+		}
+	}
+}
+
+func TestUpdatePaused(t *testing.T) {
+	logger := log.WithField("test", true)
+	np := &api.NodePool{Name: "test", MaxSize: 20}
+
+	paused := true
+	ctx := api.WithPauseCheck(context.Background(), func() (bool, error) { return paused, nil })
+
+	manager := &mockNodePoolManager{nodePool: mockLargeNodePool(2)}
+	strategy := NewRollingUpdateStrategy(logger, manager, nil, nil, nil, 1, 0, 0, 0, 0)
+	err := strategy.Update(ctx, np)
+	if err != ErrUpdatePaused {
+		t.Fatalf("expected %v, got %v", ErrUpdatePaused, err)
+	}
+
+	oldNodes, _ := strategy.splitOldNewNodes(manager.nodePool)
+	if len(oldNodes) != 2 || len(manager.nodePool.Nodes) != 2 {
+		t.Errorf("expected a paused update not to change the node pool, got %d nodes", len(manager.nodePool.Nodes))
+	}
+
+	// resuming the updates replaces the old nodes.
+	paused = false
+	err = strategy.Update(ctx, np)
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+
+	oldNodes, _ = strategy.splitOldNewNodes(manager.nodePool)
+	if len(oldNodes) != 0 {
+		t.Errorf("expected all nodes to be replaced, got %d old nodes", len(oldNodes))
+	}
+}
+
+func TestRolloutProgressString(t *testing.T) {
+	startedAt := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	for _, tc := range []struct {
+		progress RolloutProgress
+		expected string
+	}{
+		{
+			progress: RolloutProgress{Replaced: 3, StartedAt: startedAt},
+			expected: "3/2018-06-01T12:00:00Z",
+		},
+		{
+			progress: RolloutProgress{StartedAt: startedAt, CanaryPassed: true},
+			expected: "0/2018-06-01T12:00:00Z canary",
+		},
+		{
+			progress: RolloutProgress{Replaced: 1, StartedAt: startedAt, CanaryPassed: true, Replacing: []string{"i-1", "i-2"}},
+			expected: "1/2018-06-01T12:00:00Z canary replacing=i-1,i-2",
+		},
+	} {
+		value := tc.progress.String()
+		if value != tc.expected {
+			t.Errorf("expected %s, got %s", tc.expected, value)
+		}
+
+		parsed, err := parseRolloutProgress(value)
+		if err != nil {
+			t.Fatalf("should not fail: %v", err)
+		}
+		if !reflect.DeepEqual(parsed, &tc.progress) {
+			t.Errorf("expected %s to be parsed as %#v, got %#v", value, tc.progress, parsed)
+		}
+	}
+
+	_, err := parseRolloutProgress("1/2018-06-01T12:00:00Z unknown")
+	if err == nil {
+		t.Errorf("expected unknown fields to fail")
+	}
+}
+
+func TestResumeReplacing(t *testing.T) {
+	logger := log.WithField("test", true)
+	np := &api.NodePool{Name: "test", MaxSize: 20}
+
+	manager := &mockNodePoolManager{nodePool: mockLargeNodePool(3)}
+	strategy := NewRollingUpdateStrategy(logger, manager, nil, nil, nil, 1, 0, 0, 0, 0)
+
+	interrupted := manager.nodePool.Nodes[1]
+	progress := &RolloutProgress{Replaced: 1, CanaryPassed: true, Replacing: []string{instanceID(interrupted), "i-terminated"}}
+	err := strategy.resumeReplacing(np, manager.nodePool, progress)
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+
+	for _, node := range manager.nodePool.Nodes {
+		if node.Cordoned != (node == interrupted) {
+			t.Errorf("expected only the node being replaced to be cordoned, node %s cordoned: %t", node.Name, node.Cordoned)
+		}
+	}
+
+	terminate := strategy.filterNodesToTerminate(manager.nodePool.Nodes)
+	if len(terminate) != 1 || terminate[0] != interrupted {
+		t.Errorf("expected the node being replaced to be terminated first, got %d nodes", len(terminate))
+	}
+}
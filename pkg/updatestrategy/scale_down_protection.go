@@ -0,0 +1,110 @@
+package updatestrategy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// ScaleDownProtectedAnnotation protects a node from being replaced
+	// during an update while its value is 'true', e.g. while it runs a
+	// long-running batch job. The protection ends when the annotation is
+	// removed or its deadline passed.
+	ScaleDownProtectedAnnotation = "clm.zalando.org/scale-down-protected"
+	// ScaleDownProtectionDeadlineAnnotation is set by the update to the RFC
+	// 3339 deadline of the protection when it first finds a protected
+	// node. Once the deadline passed the node is replaced regardless.
+	ScaleDownProtectionDeadlineAnnotation = "clm.zalando.org/scale-down-protection-deadline"
+	// DefaultScaleDownProtectionTimeout is the time annotated nodes of node
+	// pools without scale_down_protection are protected for.
+	DefaultScaleDownProtectionTimeout = 24 * time.Hour
+
+	jobOwnerKind = "Job"
+)
+
+// ParseScaleDownProtection returns the time the nodes of a node pool running
+// unfinished Jobs are protected for, given as a duration e.g. '12h'. Zero is
+// returned if the node pool isn't protected.
+func ParseScaleDownProtection(scaleDownProtection string) (time.Duration, error) {
+	if scaleDownProtection == "" {
+		return 0, nil
+	}
+
+	timeout, err := time.ParseDuration(scaleDownProtection)
+	if err != nil {
+		return 0, fmt.Errorf("invalid scale_down_protection '%s': %v", scaleDownProtection, err)
+	}
+	if timeout <= 0 {
+		return 0, fmt.Errorf("invalid scale_down_protection '%s': must be positive", scaleDownProtection)
+	}
+	return timeout, nil
+}
+
+// scaleDownProtectionTimeout returns the time the protected nodes of the node
+// pool are protected for.
+func scaleDownProtectionTimeout(nodePoolDesc *api.NodePool) time.Duration {
+	timeout, err := ParseScaleDownProtection(nodePoolDesc.ScaleDownProtection)
+	if err != nil || timeout == 0 {
+		return DefaultScaleDownProtectionTimeout
+	}
+	return timeout
+}
+
+// nodesRunningJobs returns the names of the nodes running pods of Jobs.
+func (m *KubernetesNodePoolManager) nodesRunningJobs() (map[string]bool, error) {
+	pods, err := m.kube.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{
+		FieldSelector: fmt.Sprintf("status.phase=%s", v1.PodRunning),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make(map[string]bool)
+	for _, pod := range pods.Items {
+		for _, owner := range pod.OwnerReferences {
+			if owner.Kind == jobOwnerKind {
+				nodes[pod.Spec.NodeName] = true
+			}
+		}
+	}
+	return nodes, nil
+}
+
+// AnnotateNode annotates a Kubernetes node object in case the annotation is
+// not already defined.
+func (m *KubernetesNodePoolManager) AnnotateNode(node *Node, annotationKey, annotationValue string) error {
+	if value, ok := node.Annotations[annotationKey]; !ok || value != annotationValue {
+		annotation := []byte(fmt.Sprintf(`{"metadata": {"annotations": {"%s": "%s"}}}`, annotationKey, annotationValue))
+		_, err := m.kube.CoreV1().Nodes().Patch(node.Name, types.StrategicMergePatchType, annotation)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// protectNodes starts the scale down protection of the protected old nodes
+// of the node pool whose protection didn't start yet, by annotating them with
+// the deadline of the protection.
+func (r *RollingUpdateStrategy) protectNodes(nodePool *NodePool, nodePoolDesc *api.NodePool) error {
+	oldNodes, _ := r.splitOldNewNodes(nodePool)
+	for _, node := range oldNodes {
+		if !node.ScaleDownProtected || !node.ScaleDownProtectionDeadline.IsZero() {
+			continue
+		}
+
+		deadline := time.Now().Add(scaleDownProtectionTimeout(nodePoolDesc)).UTC()
+		r.logger.Infof("Node %s is protected from scale down until %s", node.Name, deadline)
+		err := r.nodePoolManager.AnnotateNode(node, ScaleDownProtectionDeadlineAnnotation, deadline.Format(time.RFC3339))
+		if err != nil {
+			return err
+		}
+		node.ScaleDownProtectionDeadline = deadline
+	}
+	return nil
+}
@@ -0,0 +1,122 @@
+package updatestrategy
+
+import (
+	"context"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+func TestParseScaleDownProtection(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		expected time.Duration
+		valid    bool
+	}{
+		{value: "", expected: 0, valid: true},
+		{value: "12h", expected: 12 * time.Hour, valid: true},
+		{value: "0s", valid: false},
+		{value: "-1h", valid: false},
+		{value: "forever", valid: false},
+	} {
+		t.Run(tc.value, func(t *testing.T) {
+			timeout, err := ParseScaleDownProtection(tc.value)
+			if !tc.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, timeout)
+		})
+	}
+}
+
+func TestGetPoolScaleDownProtection(t *testing.T) {
+	nodes := []*v1.Node{
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "job"},
+			Spec:       v1.NodeSpec{ProviderID: "job"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "annotated", Annotations: map[string]string{
+				ScaleDownProtectedAnnotation:          "true",
+				ScaleDownProtectionDeadlineAnnotation: "2018-06-01T12:00:00Z",
+			}},
+			Spec: v1.NodeSpec{ProviderID: "annotated"},
+		},
+		{
+			ObjectMeta: metav1.ObjectMeta{Name: "other"},
+			Spec:       v1.NodeSpec{ProviderID: "other"},
+		},
+	}
+	pods := []*v1.Pod{
+		{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:            "batch",
+				Namespace:       "default",
+				OwnerReferences: []metav1.OwnerReference{{Kind: "Job", Name: "batch"}},
+			},
+			Spec:   v1.PodSpec{NodeName: "job"},
+			Status: v1.PodStatus{Phase: v1.PodRunning},
+		},
+	}
+
+	backend := &mockProviderNodePoolsBackend{
+		nodePool: &NodePool{
+			Nodes: []*Node{{ProviderID: "job"}, {ProviderID: "annotated"}, {ProviderID: "other"}},
+		},
+	}
+	mgr := NewKubernetesNodePoolManager(log.WithField("test", true), setupMockKubernetes(t, nodes, pods), backend, 0, 0, 0)
+
+	protected := func(nodePool *NodePool) map[string]bool {
+		result := make(map[string]bool)
+		for _, node := range nodePool.Nodes {
+			result[node.Name] = node.ScaleDownProtected
+		}
+		return result
+	}
+
+	// nodes running Jobs are only protected in protected node pools.
+	nodePool, err := mgr.GetPool(&api.NodePool{Name: "test"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"job": false, "annotated": true, "other": false}, protected(nodePool))
+	assert.True(t, time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC).Equal(nodePool.Nodes[1].ScaleDownProtectionDeadline))
+
+	backend.nodePool.Nodes = []*Node{{ProviderID: "job"}, {ProviderID: "annotated"}, {ProviderID: "other"}}
+	nodePool, err = mgr.GetPool(&api.NodePool{Name: "test", ScaleDownProtection: "12h"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]bool{"job": true, "annotated": true, "other": false}, protected(nodePool))
+}
+
+func TestUpdateScaleDownProtection(t *testing.T) {
+	defer func(interval time.Duration) { operationCheckInterval = interval }(operationCheckInterval)
+	operationCheckInterval = 10 * time.Millisecond
+
+	logger := log.WithField("test", true)
+	np := &api.NodePool{Name: "test", MaxSize: 20, ScaleDownProtection: "100ms"}
+
+	nodePool := mockLargeNodePool(2)
+	protected := nodePool.Nodes[0]
+	protected.ScaleDownProtected = true
+
+	// protected nodes are deferred until their protection started.
+	assert.True(t, protected.TerminationDeferred(time.Now().Add(time.Hour)))
+
+	manager := &mockNodePoolManager{nodePool: nodePool}
+	strategy := NewRollingUpdateStrategy(logger, manager, nil, nil, nil, 1, 0, 0, 0, 0)
+
+	start := time.Now()
+	err := strategy.Update(context.Background(), np)
+	assert.NoError(t, err)
+	assert.False(t, protected.ScaleDownProtectionDeadline.IsZero())
+	assert.True(t, time.Since(start) >= 100*time.Millisecond)
+
+	oldNodes, _ := strategy.splitOldNewNodes(manager.nodePool)
+	assert.Len(t, oldNodes, 0)
+}
@@ -0,0 +1,228 @@
+package updatestrategy
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/cenkalti/backoff"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+	"k8s.io/client-go/pkg/api/v1"
+)
+
+const (
+	// StartupTaintKey is the key of the taint new nodes can register
+	// with to prevent workloads from being scheduled before the node is
+	// fully bootstrapped. The taint is removed by the update strategy
+	// once the node is ready and all its DaemonSet pods are ready.
+	StartupTaintKey    = "node.clm/uninitialized"
+	startupTaintValue  = "true"
+	startupTaintEffect = v1.TaintEffectNoSchedule
+)
+
+// StartupTaint is the startup taint in the key=value:effect format of the
+// kubelet --register-with-taints flag.
+var StartupTaint = fmt.Sprintf("%s=%s:%s", StartupTaintKey, startupTaintValue, startupTaintEffect)
+
+// hasStartupTaint returns true if the node has the startup taint.
+func hasStartupTaint(node *Node) bool {
+	for _, taint := range node.Taints {
+		if taint.Key == StartupTaintKey {
+			return true
+		}
+	}
+	return false
+}
+
+// InitializeNodes removes the startup taint from the ready nodes of a node
+// pool, no matter if they were launched by an update, by the autoscaler or to
+// replace unhealthy instances. Nodes which can't be initialized yet are
+// skipped with a warning and initialized by a later call.
+func InitializeNodes(logger *log.Entry, manager NodePoolManager, nodePoolDesc *api.NodePool) error {
+	nodePool, err := manager.GetPool(nodePoolDesc)
+	if err != nil {
+		return err
+	}
+
+	for _, node := range nodePool.Nodes {
+		if !node.Ready || !hasStartupTaint(node) {
+			continue
+		}
+
+		_, err := manager.InitializeNode(node)
+		if err != nil {
+			logger.Warnf("Failed to initialize node %s: %v", node.Name, err)
+		}
+	}
+	return nil
+}
+
+// InitializeNode removes the startup taint from a node once the node is ready
+// and the pods of all DaemonSets which should run on the node are ready. It
+// returns true if the node is initialized.
+func (m *KubernetesNodePoolManager) InitializeNode(node *Node) (bool, error) {
+	kubeNode, err := m.kube.CoreV1().Nodes().Get(node.Name, metav1.GetOptions{})
+	if err != nil {
+		return false, err
+	}
+
+	if !v1.IsNodeReady(kubeNode) {
+		return false, nil
+	}
+
+	ready, err := m.daemonSetPodsReady(kubeNode)
+	if err != nil || !ready {
+		return false, err
+	}
+
+	untaintNode := func() error {
+		// re-fetch the node since we're going to do an update
+		updatedNode, err := m.kube.CoreV1().Nodes().Get(node.Name, metav1.GetOptions{})
+		if err != nil {
+			return backoff.Permanent(err)
+		}
+
+		if removeTaint(updatedNode, StartupTaintKey) {
+			_, err := m.kube.CoreV1().Nodes().Update(updatedNode)
+			if err != nil {
+				// automatically retry if there was a conflicting update.
+				serr, ok := err.(*errors.StatusError)
+				if ok && serr.Status().Reason == metav1.StatusReasonConflict {
+					return err
+				}
+
+				return backoff.Permanent(err)
+			}
+		}
+
+		return nil
+	}
+
+	backoffCfg := backoff.WithMaxTries(backoff.NewConstantBackOff(1*time.Second), maxConflictRetries)
+	err = backoff.Retry(untaintNode, backoffCfg)
+	if err != nil {
+		return false, err
+	}
+
+	m.logger.Infof("Removed startup taint from node %s", node.Name)
+	return true, nil
+}
+
+// daemonSetPodsReady returns true if every DaemonSet which should run on the
+// node has a ready pod on the node.
+func (m *KubernetesNodePoolManager) daemonSetPodsReady(node *v1.Node) (bool, error) {
+	unready, err := m.unreadyDaemonSets(node)
+	if err != nil {
+		return false, err
+	}
+	return len(unready) == 0, nil
+}
+
+// unreadyDaemonSets returns the DaemonSets which should run on the node but
+// don't have a ready pod on the node. A DaemonSet should run on the node if
+// its node selector and node affinity match the node and it tolerates the
+// taints of the node.
+func (m *KubernetesNodePoolManager) unreadyDaemonSets(node *v1.Node) ([]string, error) {
+	daemonSets, err := m.kube.ExtensionsV1beta1().DaemonSets(v1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	pods, err := m.getPodsByNode(node.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	readyPods := make(map[string]bool)
+	for _, pod := range pods.Items {
+		if !v1.IsPodReady(&pod) {
+			continue
+		}
+
+		for _, owner := range pod.GetOwnerReferences() {
+			if owner.Kind == "DaemonSet" {
+				readyPods[pod.Namespace+"/"+owner.Name] = true
+			}
+		}
+	}
+
+	var unready []string
+	for _, ds := range daemonSets.Items {
+		if !shouldRunOnNode(&ds.Spec.Template.Spec, node) {
+			continue
+		}
+
+		name := ds.Namespace + "/" + ds.Name
+		if !readyPods[name] {
+			m.logger.Debugf("DaemonSet %s not ready on node %s", name, node.Name)
+			unready = append(unready, name)
+		}
+	}
+
+	return unready, nil
+}
+
+// shouldRunOnNode returns true if pods with the spec can be scheduled on the
+// node based on the node selector, the node affinity required during
+// scheduling and the taints of the node.
+func shouldRunOnNode(spec *v1.PodSpec, node *v1.Node) bool {
+	for key, value := range spec.NodeSelector {
+		if node.Labels[key] != value {
+			return false
+		}
+	}
+
+	if !matchesNodeAffinity(spec.Affinity, node) {
+		return false
+	}
+
+	for i := range node.Spec.Taints {
+		taint := &node.Spec.Taints[i]
+		if taint.Effect == v1.TaintEffectPreferNoSchedule {
+			continue
+		}
+
+		if !v1.TolerationsTolerateTaint(spec.Tolerations, taint) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// matchesNodeAffinity returns true if the labels of the node match the node
+// affinity required during scheduling. Like for the scheduler the node
+// selector terms are ORed, the expressions of a term are ANDed and terms
+// without or with invalid expressions match no node.
+func matchesNodeAffinity(affinity *v1.Affinity, node *v1.Node) bool {
+	if affinity == nil || affinity.NodeAffinity == nil || affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution == nil {
+		return true
+	}
+
+	for _, term := range affinity.NodeAffinity.RequiredDuringSchedulingIgnoredDuringExecution.NodeSelectorTerms {
+		selector, err := v1.NodeSelectorRequirementsAsSelector(term.MatchExpressions)
+		if err != nil {
+			continue
+		}
+
+		if selector.Matches(labels.Set(node.Labels)) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeTaint removes the taint with the provided key from the node. Returns
+// true if the taint was removed.
+func removeTaint(node *v1.Node, taintKey string) bool {
+	for i, taint := range node.Spec.Taints {
+		if taint.Key == taintKey {
+			node.Spec.Taints = append(node.Spec.Taints[:i], node.Spec.Taints[i+1:]...)
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,186 @@
+package updatestrategy
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/pkg/api/v1"
+	extensions "k8s.io/client-go/pkg/apis/extensions/v1beta1"
+)
+
+func TestInitializeNode(t *testing.T) {
+	startupTaint := v1.Taint{Key: StartupTaintKey, Value: startupTaintValue, Effect: startupTaintEffect}
+
+	node := &v1.Node{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:   "test",
+			Labels: map[string]string{"role": "worker"},
+		},
+		Spec: v1.NodeSpec{
+			Taints: []v1.Taint{startupTaint, {Key: "dedicated", Value: "ingress", Effect: v1.TaintEffectNoSchedule}},
+		},
+	}
+
+	daemonSet := func(name string, nodeSelector map[string]string) *extensions.DaemonSet {
+		return &extensions.DaemonSet{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "kube-system"},
+			Spec: extensions.DaemonSetSpec{
+				Template: v1.PodTemplateSpec{
+					Spec: v1.PodSpec{
+						NodeSelector: nodeSelector,
+						Tolerations:  []v1.Toleration{{Operator: v1.TolerationOpExists}},
+					},
+				},
+			},
+		}
+	}
+
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:            "flannel-abcde",
+			Namespace:       "kube-system",
+			OwnerReferences: []metav1.OwnerReference{{Kind: "DaemonSet", Name: "flannel"}},
+		},
+		Spec: v1.PodSpec{NodeName: node.Name},
+		Status: v1.PodStatus{
+			Conditions: []v1.PodCondition{{Type: v1.PodReady, Status: v1.ConditionFalse}},
+		},
+	}
+
+	client := setupMockKubernetes(t, []*v1.Node{node}, []*v1.Pod{pod})
+	mgr := &KubernetesNodePoolManager{
+		kube:   client,
+		logger: log.WithField("test", true),
+	}
+
+	// DaemonSets which don't tolerate the node taints or don't match
+	// the node labels or affinity don't block the initialization.
+	intolerant := daemonSet("intolerant", nil)
+	intolerant.Spec.Template.Spec.Tolerations = nil
+	affine := daemonSet("ebs-csi", nil)
+	affine.Spec.Template.Spec.Affinity = nodeAffinity(v1.NodeSelectorRequirement{Key: "role", Operator: v1.NodeSelectorOpIn, Values: []string{"master"}})
+	for _, ds := range []*extensions.DaemonSet{daemonSet("flannel", nil), daemonSet("gpu", map[string]string{"role": "gpu"}), intolerant, affine} {
+		_, err := client.ExtensionsV1beta1().DaemonSets(ds.Namespace).Create(ds)
+		require.NoError(t, err)
+	}
+
+	// node not ready
+	initialized, err := mgr.InitializeNode(&Node{Name: node.Name})
+	require.NoError(t, err)
+	assert.False(t, initialized)
+
+	node.Status.Conditions = []v1.NodeCondition{{Type: v1.NodeReady, Status: v1.ConditionTrue}}
+	_, err = client.CoreV1().Nodes().Update(node)
+	require.NoError(t, err)
+
+	// DaemonSet pod not ready
+	initialized, err = mgr.InitializeNode(&Node{Name: node.Name})
+	require.NoError(t, err)
+	assert.False(t, initialized)
+
+	pod.Status.Conditions[0].Status = v1.ConditionTrue
+	_, err = client.CoreV1().Pods(pod.Namespace).Update(pod)
+	require.NoError(t, err)
+
+	initialized, err = mgr.InitializeNode(&Node{Name: node.Name})
+	require.NoError(t, err)
+	assert.True(t, initialized)
+
+	updated, err := client.CoreV1().Nodes().Get(node.Name, metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.Equal(t, []v1.Taint{{Key: "dedicated", Value: "ingress", Effect: v1.TaintEffectNoSchedule}}, updated.Spec.Taints)
+}
+
+// nodeAffinity returns an affinity requiring a node matching any of the
+// requirements.
+func nodeAffinity(requirements ...v1.NodeSelectorRequirement) *v1.Affinity {
+	selector := &v1.NodeSelector{}
+	for _, requirement := range requirements {
+		selector.NodeSelectorTerms = append(selector.NodeSelectorTerms, v1.NodeSelectorTerm{MatchExpressions: []v1.NodeSelectorRequirement{requirement}})
+	}
+	return &v1.Affinity{NodeAffinity: &v1.NodeAffinity{RequiredDuringSchedulingIgnoredDuringExecution: selector}}
+}
+
+func TestShouldRunOnNode(t *testing.T) {
+	node := &v1.Node{ObjectMeta: metav1.ObjectMeta{Labels: map[string]string{"role": "worker", "lifecycle": "spot"}}}
+
+	for _, tc := range []struct {
+		msg      string
+		affinity *v1.Affinity
+		expected bool
+	}{
+		{
+			msg:      "test no affinity",
+			expected: true,
+		},
+		{
+			msg:      "test matching affinity",
+			affinity: nodeAffinity(v1.NodeSelectorRequirement{Key: "role", Operator: v1.NodeSelectorOpIn, Values: []string{"worker"}}),
+			expected: true,
+		},
+		{
+			msg:      "test not matching affinity",
+			affinity: nodeAffinity(v1.NodeSelectorRequirement{Key: "lifecycle", Operator: v1.NodeSelectorOpNotIn, Values: []string{"spot"}}),
+		},
+		{
+			msg: "test any matching term",
+			affinity: nodeAffinity(
+				v1.NodeSelectorRequirement{Key: "gpu", Operator: v1.NodeSelectorOpExists},
+				v1.NodeSelectorRequirement{Key: "role", Operator: v1.NodeSelectorOpExists},
+			),
+			expected: true,
+		},
+		{
+			msg:      "test no terms",
+			affinity: nodeAffinity(),
+		},
+		{
+			msg:      "test invalid operator",
+			affinity: nodeAffinity(v1.NodeSelectorRequirement{Key: "role", Operator: "Matches"}),
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			assert.Equal(t, tc.expected, shouldRunOnNode(&v1.PodSpec{Affinity: tc.affinity}, node))
+		})
+	}
+}
+
+// initializingNodePoolManager records the nodes initialized.
+type initializingNodePoolManager struct {
+	*mockNodePoolManager
+	initialized []string
+}
+
+func (m *initializingNodePoolManager) InitializeNode(node *Node) (bool, error) {
+	m.initialized = append(m.initialized, node.Name)
+	return true, nil
+}
+
+func TestInitializeNodes(t *testing.T) {
+	startupTaint := []v1.Taint{{Key: StartupTaintKey}}
+	manager := &initializingNodePoolManager{
+		mockNodePoolManager: &mockNodePoolManager{
+			nodePool: &NodePool{
+				Nodes: []*Node{
+					{Name: "initialized", Ready: true},
+					{Name: "not-ready", Taints: startupTaint},
+					{Name: "autoscaled", Ready: true, Taints: startupTaint},
+				},
+			},
+		},
+	}
+
+	err := InitializeNodes(log.WithField("test", true), manager, &api.NodePool{Name: "test"})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"autoscaled"}, manager.initialized)
+}
+
+func TestHasStartupTaint(t *testing.T) {
+	assert.Equal(t, "node.clm/uninitialized=true:NoSchedule", StartupTaint)
+	assert.True(t, hasStartupTaint(&Node{Taints: []v1.Taint{{Key: StartupTaintKey}}}))
+	assert.False(t, hasStartupTaint(&Node{Taints: []v1.Taint{{Key: "dedicated"}}}))
+}
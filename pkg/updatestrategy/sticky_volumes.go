@@ -0,0 +1,77 @@
+package updatestrategy
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// StickyVolumeTag is the tag of the EBS volumes attached to the nodes
+	// of node pools with sticky volumes, its value is the name of the
+	// node pool. The volumes must also have the cluster tag
+	// 'kubernetes.io/cluster/<cluster ID>'.
+	StickyVolumeTag = "cluster-lifecycle-manager.zalando.org/sticky-volume"
+
+	// DefaultStickyVolumeDevice is the device name sticky volumes are
+	// attached as, unless the node pool defines another one.
+	DefaultStickyVolumeDevice = "/dev/xvdf"
+)
+
+// StickyVolumeBackend is a node pools provider backend which moves the sticky
+// volumes of the replaced nodes of stateful node pools to their
+// replacements.
+type StickyVolumeBackend interface {
+	MoveStickyVolume(ctx context.Context, from, to *Node, device string) error
+}
+
+// MoveStickyVolume moves the sticky volume of a terminated node to another
+// node if the node pool backend supports sticky volumes.
+func (m *KubernetesNodePoolManager) MoveStickyVolume(ctx context.Context, from, to *Node, device string) error {
+	backend, ok := m.backend.(StickyVolumeBackend)
+	if !ok {
+		return fmt.Errorf("sticky volumes aren't supported by the node pool backend")
+	}
+	return backend.MoveStickyVolume(ctx, from, to, device)
+}
+
+// stickyVolumeDevice returns the device name the sticky volumes of the node
+// pool are attached as.
+func stickyVolumeDevice(nodePoolDesc *api.NodePool) string {
+	if nodePoolDesc.Storage == nil || nodePoolDesc.Storage.Device == "" {
+		return DefaultStickyVolumeDevice
+	}
+	return nodePoolDesc.Storage.Device
+}
+
+// hasStickyVolumes returns true if the nodes of the node pool attach sticky
+// volumes.
+func hasStickyVolumes(nodePoolDesc *api.NodePool) bool {
+	return nodePoolDesc.Storage != nil && nodePoolDesc.Storage.StickyVolumes
+}
+
+// moveStickyVolume attaches the sticky volume of a terminated node to a new
+// node in the same failure domain which has none yet. The nodes in
+// assigned already got a volume. If there's no such node the volume is left
+// available for the next node launched in the failure domain, which attaches
+// it while booting.
+func (r *RollingUpdateStrategy) moveStickyVolume(ctx context.Context, nodePoolDesc *api.NodePool, nodePool *NodePool, terminated *Node, assigned map[string]bool) error {
+	_, newNodes := r.splitOldNewNodes(nodePool)
+	for _, node := range newNodes {
+		if node.FailureDomain != terminated.FailureDomain || node.StickyVolume != "" || assigned[node.ProviderID] {
+			continue
+		}
+
+		r.logger.Infof("Moving sticky volume %s from node %s to node %s", terminated.StickyVolume, terminated.Name, node.Name)
+		err := r.nodePoolManager.MoveStickyVolume(ctx, terminated, node, stickyVolumeDevice(nodePoolDesc))
+		if err != nil {
+			return fmt.Errorf("failed to move sticky volume %s of node %s: %v", terminated.StickyVolume, terminated.Name, err)
+		}
+		assigned[node.ProviderID] = true
+		return nil
+	}
+
+	r.logger.Infof("No node in %s to move sticky volume %s of node %s to, leaving it to the next node", terminated.FailureDomain, terminated.StickyVolume, terminated.Name)
+	return nil
+}
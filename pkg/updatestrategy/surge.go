@@ -0,0 +1,46 @@
+package updatestrategy
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// ParseSurge returns the number of nodes a node pool of desired nodes is
+// surged by during an update. The surge is either an absolute number of
+// nodes or a percentage of the desired nodes, e.g. '25%', which is rounded up
+// to at least one node.
+func ParseSurge(surge string, desired int) (int, error) {
+	return parseNodeCount("surge", surge, desired)
+}
+
+// ParseCanary returns the number of canary nodes of a node pool of desired
+// nodes. Like the surge it's either an absolute number of nodes or a
+// percentage of the desired nodes.
+func ParseCanary(canary string, desired int) (int, error) {
+	return parseNodeCount("canary", canary, desired)
+}
+
+// ParseMaxUnavailable returns the number of nodes of a node pool of desired
+// nodes which can be drained at the same time. Like the surge it's either an
+// absolute number of nodes or a percentage of the desired nodes.
+func ParseMaxUnavailable(maxUnavailable string, desired int) (int, error) {
+	return parseNodeCount("max unavailable", maxUnavailable, desired)
+}
+
+func parseNodeCount(kind, value string, desired int) (int, error) {
+	if strings.HasSuffix(value, "%") {
+		percent, err := strconv.ParseFloat(strings.TrimSuffix(value, "%"), 64)
+		if err != nil || percent <= 0 {
+			return 0, fmt.Errorf("invalid %s %s: expected a positive percentage", kind, value)
+		}
+		return int(math.Max(1, math.Ceil(percent*float64(desired)/100))), nil
+	}
+
+	nodes, err := strconv.Atoi(value)
+	if err != nil || nodes < 1 {
+		return 0, fmt.Errorf("invalid %s %s: expected a positive number of nodes or a percentage", kind, value)
+	}
+	return nodes, nil
+}
@@ -0,0 +1,58 @@
+package updatestrategy
+
+import "testing"
+
+func TestParseSurge(t *testing.T) {
+	for _, tc := range []struct {
+		surge   string
+		desired int
+		nodes   int
+		valid   bool
+	}{
+		{surge: "2", desired: 10, nodes: 2, valid: true},
+		{surge: "25%", desired: 10, nodes: 3, valid: true},
+		{surge: "10%", desired: 0, nodes: 1, valid: true},
+		{surge: "0", desired: 10},
+		{surge: "-5%", desired: 10},
+		{surge: "many", desired: 10},
+	} {
+		nodes, err := ParseSurge(tc.surge, tc.desired)
+		if !tc.valid {
+			if err == nil {
+				t.Errorf("expected surge %s to be invalid", tc.surge)
+			}
+			continue
+		}
+
+		if err != nil {
+			t.Errorf("should not fail for surge %s: %v", tc.surge, err)
+		}
+		if nodes != tc.nodes {
+			t.Errorf("expected surge %s of %d nodes to be %d nodes, got %d", tc.surge, tc.desired, tc.nodes, nodes)
+		}
+	}
+}
+
+func TestParseCanary(t *testing.T) {
+	nodes, err := ParseCanary("10%", 25)
+	if err != nil || nodes != 3 {
+		t.Errorf("expected 3 canary nodes, got %d: %v", nodes, err)
+	}
+
+	_, err = ParseCanary("0%", 25)
+	if err == nil || err.Error() != "invalid canary 0%: expected a positive percentage" {
+		t.Errorf("expected invalid canary, got %v", err)
+	}
+}
+
+func TestParseMaxUnavailable(t *testing.T) {
+	nodes, err := ParseMaxUnavailable("1", 25)
+	if err != nil || nodes != 1 {
+		t.Errorf("expected 1 unavailable node, got %d: %v", nodes, err)
+	}
+
+	_, err = ParseMaxUnavailable("none", 25)
+	if err == nil {
+		t.Errorf("expected invalid max unavailable")
+	}
+}
@@ -1,7 +1,10 @@
 package updatestrategy
 
 import (
+	"bytes"
 	"context"
+	"fmt"
+	"time"
 
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 	"k8s.io/client-go/pkg/api/v1"
@@ -10,6 +13,52 @@ import (
 // UpdateStrategy defines an interface for performing cluster node updates.
 type UpdateStrategy interface {
 	Update(ctx context.Context, nodePool *api.NodePool) error
+	Plan(ctx context.Context, nodePool *api.NodePool) (*UpdatePlan, error)
+}
+
+// UpdatePlan describes the planned sequence of a node pool update. Nodes are
+// replaced batch by batch where each batch contains at most Surge nodes. If
+// Canary is set, that many new nodes are added and soaked before the first
+// batch is replaced.
+type UpdatePlan struct {
+	NodePool          string
+	Surge             int
+	Canary            int
+	Batches           [][]*Node
+	EstimatedDuration time.Duration
+	BlastRadius       *BlastRadius
+}
+
+// Nodes returns the total number of nodes to be replaced by the update.
+func (p *UpdatePlan) Nodes() int {
+	nodes := 0
+	for _, batch := range p.Batches {
+		nodes += len(batch)
+	}
+	return nodes
+}
+
+// String returns a human readable representation of the plan.
+func (p *UpdatePlan) String() string {
+	if len(p.Batches) == 0 {
+		return fmt.Sprintf("node pool '%s' is up to date", p.NodePool)
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "node pool '%s': replacing %d nodes in %d batches (surge %d, estimated duration %s)", p.NodePool, p.Nodes(), len(p.Batches), p.Surge, p.EstimatedDuration)
+	if p.Canary > 0 {
+		fmt.Fprintf(&buf, "\n  canary: %d nodes", p.Canary)
+	}
+	if p.BlastRadius != nil {
+		fmt.Fprintf(&buf, "\n  blast radius: %s", p.BlastRadius)
+	}
+	for i, batch := range p.Batches {
+		fmt.Fprintf(&buf, "\n  batch %d:", i+1)
+		for _, node := range batch {
+			fmt.Fprintf(&buf, " %s (%s)", node.Name, node.FailureDomain)
+		}
+	}
+	return buf.String()
 }
 
 // ProviderNodePoolsBackend is an interface for describing a node pools
@@ -42,11 +91,25 @@ func (n *NodePool) ReadyNodes() []*Node {
 	return nodes
 }
 
+// UpToDateNodes returns the nodes of the current generation of the node pool,
+// i.e. the nodes which don't need to be replaced by an update.
+func (n *NodePool) UpToDateNodes() []*Node {
+	nodes := make([]*Node, 0, len(n.Nodes))
+	for _, node := range n.Nodes {
+		if node.Generation == n.Generation {
+			nodes = append(nodes, node)
+		}
+	}
+
+	return nodes
+}
+
 // Node is an abstract node object which combines the node information from the
 // node pool backend along with the corresponding Kubernetes node object.
 type Node struct {
 	Name            string
 	Labels          map[string]string
+	Annotations     map[string]string
 	Taints          []v1.Taint
 	Cordoned        bool
 	ProviderID      string
@@ -54,4 +117,33 @@ type Node struct {
 	Generation      int
 	VolumesAttached bool
 	Ready           bool
+	// Problems are the conditions of the node reporting a problem of its
+	// kubelet, e.g. 'Ready: KubeletNotReady'.
+	Problems []string
+	// Stopped is true if the instance of the node is stopped and thus
+	// can't run any pods.
+	Stopped bool
+	// TerminationDeferredUntil is the deadline set by the
+	// DeferTerminationAnnotation of the node, before which it's neither
+	// cordoned nor drained.
+	TerminationDeferredUntil time.Time
+	// ScaleDownProtected is true if the node is annotated with the
+	// ScaleDownProtectedAnnotation or runs pods of Jobs in a node pool
+	// with scale down protection.
+	ScaleDownProtected bool
+	// ScaleDownProtectionDeadline is the deadline of the scale down
+	// protection of the node, zero until the protection started.
+	ScaleDownProtectionDeadline time.Time
+	// Adopted is true if the node belongs to an ASG adopted by the node
+	// pool instead of the ASG of the node pool.
+	Adopted bool
+	// ReplaceRequested is true if the node is annotated with the
+	// ReplaceNodeAnnotation.
+	ReplaceRequested bool
+	// StickyVolume is the ID of the sticky volume attached to the node,
+	// which is moved to its replacement.
+	StickyVolume string
+	// QuarantinedAt is the time set by the QuarantinedAnnotation of the
+	// node, zero unless the node is quarantined.
+	QuarantinedAt time.Time
 }
@@ -18,3 +18,17 @@ func TestReadyNodes(t *testing.T) {
 	nodes := nodePool.ReadyNodes()
 	assert.Len(t, nodes, 1)
 }
+
+func TestUpToDateNodes(t *testing.T) {
+	nodePool := &NodePool{
+		Generation: currentNodeGeneration,
+		Nodes: []*Node{
+			{Name: "new", Generation: currentNodeGeneration},
+			{Name: "old", Generation: outdatedNodeGeneration},
+		},
+	}
+
+	nodes := nodePool.UpToDateNodes()
+	assert.Len(t, nodes, 1)
+	assert.Equal(t, "new", nodes[0].Name)
+}
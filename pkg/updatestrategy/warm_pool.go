@@ -0,0 +1,51 @@
+package updatestrategy
+
+import (
+	"context"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// WarmPoolBackend is a node pools provider backend which keeps warm
+// instances next to the node pools.
+type WarmPoolBackend interface {
+	RecycleWarmPool(nodePool *api.NodePool) (int, error)
+}
+
+// WarmPoolStrategy wraps an update strategy such that the outdated instances
+// in the warm pool of a node pool are recycled before the node pool is
+// updated. Otherwise the update would scale up the node pool with outdated
+// warm instances, which it would have to replace again.
+type WarmPoolStrategy struct {
+	UpdateStrategy
+	backend WarmPoolBackend
+	logger  *log.Entry
+}
+
+// NewWarmPoolStrategy initializes a new WarmPoolStrategy recycling the warm
+// pools of the backend before updating the node pools with strategy.
+func NewWarmPoolStrategy(logger *log.Entry, strategy UpdateStrategy, backend WarmPoolBackend) *WarmPoolStrategy {
+	return &WarmPoolStrategy{
+		UpdateStrategy: strategy,
+		backend:        backend,
+		logger:         logger,
+	}
+}
+
+// Update recycles the warm pool of the node pool if it has one and updates
+// the node pool.
+func (s *WarmPoolStrategy) Update(ctx context.Context, nodePoolDesc *api.NodePool) error {
+	if nodePoolDesc.WarmPool != nil {
+		recycled, err := s.backend.RecycleWarmPool(nodePoolDesc)
+		if err != nil {
+			return err
+		}
+		if recycled > 0 {
+			s.logger.Infof("Recycled %d outdated warm instances of node pool '%s'", recycled, nodePoolDesc.Name)
+		}
+	}
+
+	return s.UpdateStrategy.Update(ctx, nodePoolDesc)
+}
@@ -0,0 +1,132 @@
+package updatestrategy
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type mockWarmPoolBackend struct {
+	err      error
+	recycled int
+}
+
+func (m *mockWarmPoolBackend) RecycleWarmPool(nodePool *api.NodePool) (int, error) {
+	m.recycled++
+	return 1, m.err
+}
+
+type mockUpdateStrategy struct {
+	err     error
+	updated int
+}
+
+func (m *mockUpdateStrategy) Update(ctx context.Context, nodePool *api.NodePool) error {
+	m.updated++
+	return m.err
+}
+
+func (m *mockUpdateStrategy) Plan(ctx context.Context, nodePool *api.NodePool) (*UpdatePlan, error) {
+	return &UpdatePlan{}, m.err
+}
+
+type mockWarmPoolAPI struct {
+	err       error
+	instances []*autoscaling.Instance
+}
+
+func (m *mockWarmPoolAPI) DescribeWarmPool(input *describeWarmPoolInput) (*describeWarmPoolOutput, error) {
+	return &describeWarmPoolOutput{Instances: m.instances}, m.err
+}
+
+func TestWarmPoolStrategyUpdate(t *testing.T) {
+	logger := log.WithField("test", true)
+
+	// node pools without a warm pool are only updated.
+	backend := &mockWarmPoolBackend{}
+	strategy := &mockUpdateStrategy{}
+	err := NewWarmPoolStrategy(logger, strategy, backend).Update(context.Background(), &api.NodePool{Name: "worker-default"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, backend.recycled)
+	assert.Equal(t, 1, strategy.updated)
+
+	nodePool := &api.NodePool{Name: "worker-default", WarmPool: &api.WarmPool{MinSize: 1}}
+	err = NewWarmPoolStrategy(logger, strategy, backend).Update(context.Background(), nodePool)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, backend.recycled)
+	assert.Equal(t, 2, strategy.updated)
+
+	// the node pool isn't updated if the warm pool can't be recycled.
+	backend.err = errors.New("failed")
+	err = NewWarmPoolStrategy(logger, strategy, backend).Update(context.Background(), nodePool)
+	assert.Error(t, err)
+	assert.Equal(t, 2, strategy.updated)
+}
+
+func TestRecycleWarmPool(t *testing.T) {
+	launchTemplate := func(version string) *autoscaling.LaunchTemplateSpecification {
+		return &autoscaling.LaunchTemplateSpecification{
+			LaunchTemplateId: aws.String("lt-1"),
+			Version:          aws.String(version),
+		}
+	}
+
+	ec2Client := &mockEC2API{
+		descLTV: &ec2.DescribeLaunchTemplateVersionsOutput{
+			LaunchTemplateVersions: []*ec2.LaunchTemplateVersion{
+				{
+					LaunchTemplateId: aws.String("lt-1"),
+					VersionNumber:    aws.Int64(2),
+				},
+			},
+		},
+	}
+	warmPoolClient := &mockWarmPoolAPI{
+		instances: []*autoscaling.Instance{
+			{InstanceId: aws.String("current"), LaunchTemplate: launchTemplate("2"), LifecycleState: aws.String("Warmed:Stopped")},
+			{InstanceId: aws.String("outdated"), LaunchTemplate: launchTemplate("1"), LifecycleState: aws.String("Warmed:Stopped")},
+			{InstanceId: aws.String("terminating"), LaunchTemplate: launchTemplate("1"), LifecycleState: aws.String("Warmed:Terminating")},
+		},
+	}
+
+	backend := &ASGNodePoolsBackend{
+		asgClient: &mockASGAPI{
+			asgs: []*autoscaling.Group{
+				{
+					AutoScalingGroupName: aws.String("asg"),
+					LaunchTemplate:       launchTemplate("$Latest"),
+					Tags: []*autoscaling.TagDescription{
+						{Key: aws.String(clusterIDTagPrefix + "cluster"), Value: aws.String(resourceLifecycleOwned)},
+						{Key: aws.String(nodePoolTag), Value: aws.String("worker-default")},
+					},
+				},
+			},
+		},
+		ec2Client:      ec2Client,
+		warmPoolClient: warmPoolClient,
+		clusterID:      "cluster",
+	}
+
+	recycled, err := backend.RecycleWarmPool(&api.NodePool{Name: "worker-default"})
+	assert.NoError(t, err)
+	assert.Equal(t, 1, recycled)
+	assert.Equal(t, []string{"outdated"}, ec2Client.terminated)
+
+	warmPoolClient.instances = warmPoolClient.instances[:1]
+	ec2Client.terminated = nil
+	recycled, err = backend.RecycleWarmPool(&api.NodePool{Name: "worker-default"})
+	assert.NoError(t, err)
+	assert.Equal(t, 0, recycled)
+	assert.Empty(t, ec2Client.terminated)
+
+	warmPoolClient.err = errors.New("failed")
+	_, err = backend.RecycleWarmPool(&api.NodePool{Name: "worker-default"})
+	assert.Error(t, err)
+}
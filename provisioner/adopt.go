@@ -0,0 +1,75 @@
+package provisioner
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+// adoptASGs brings the ASGs listed by the node pools of the cluster under the
+// node pools. Adopted ASGs are tagged as owned by the cluster and adopted by
+// the node pool, such that the update strategy replaces their nodes with the
+// nodes of the node pool. Their min size is set to zero and their scaling
+// processes are suspended to not launch new nodes in the meantime.
+func (a *awsAdapter) adoptASGs(cluster *api.Cluster) error {
+	for _, nodePool := range cluster.NodePools {
+		for _, asgName := range nodePool.AdoptASGs {
+			err := a.adoptASG(cluster, nodePool, asgName)
+			if err != nil {
+				return fmt.Errorf("failed to adopt ASG %s into node pool %s: %v", asgName, nodePool.Name, err)
+			}
+		}
+	}
+	return nil
+}
+
+// adoptASG adopts a single ASG into the node pool. ASGs already adopted by
+// the node pool are left untouched. ASGs of CLM node pools and ASGs adopted
+// by another node pool can't be adopted.
+func (a *awsAdapter) adoptASG(cluster *api.Cluster, nodePool *api.NodePool, asgName string) error {
+	resp, err := a.autoscalingClient.DescribeAutoScalingGroups(&autoscaling.DescribeAutoScalingGroupsInput{
+		AutoScalingGroupNames: []*string{aws.String(asgName)},
+	})
+	if err != nil {
+		return err
+	}
+
+	if len(resp.AutoScalingGroups) == 0 {
+		return errors.New("ASG not found")
+	}
+	asg := resp.AutoScalingGroups[0]
+
+	if owner := asgTagValue(asg, "NodePool"); owner != "" {
+		return fmt.Errorf("ASG belongs to node pool %s", owner)
+	}
+
+	switch adoptedBy := asgTagValue(asg, updatestrategy.AdoptedASGTag); adoptedBy {
+	case nodePool.Name:
+		return nil
+	case "":
+	default:
+		return fmt.Errorf("ASG is already adopted by node pool %s", adoptedBy)
+	}
+
+	a.logger.Infof("Adopting ASG %s into node pool %s", asgName, nodePool.Name)
+
+	err = a.suspendScaling(asgName)
+	if err != nil {
+		return err
+	}
+
+	err = a.resizeASG(asgName, 0, aws.Int64Value(asg.MaxSize), aws.Int64Value(asg.DesiredCapacity))
+	if err != nil {
+		return err
+	}
+
+	return a.tagASG(asgName, map[string]string{
+		fmt.Sprintf("kubernetes.io/cluster/%s", cluster.ID): "owned",
+		updatestrategy.AdoptedASGTag:                        nodePool.Name,
+	})
+}
@@ -0,0 +1,84 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+func TestAdoptASG(t *testing.T) {
+	nodePool := &api.NodePool{Name: "worker-default", AdoptASGs: []string{"legacy"}}
+
+	for _, tc := range []struct {
+		msg     string
+		asgs    []*autoscaling.Group
+		adopted bool
+		success bool
+	}{
+		{
+			msg:     "unmanaged ASGs are adopted",
+			asgs:    []*autoscaling.Group{suspendTestASG("legacy", nil, 3, 10, 5)},
+			adopted: true,
+			success: true,
+		},
+		{
+			msg:     "ASGs adopted by the node pool are left untouched",
+			asgs:    []*autoscaling.Group{suspendTestASG("legacy", map[string]string{updatestrategy.AdoptedASGTag: "worker-default"}, 0, 10, 5)},
+			success: true,
+		},
+		{
+			msg:     "ASGs adopted by another node pool can't be adopted",
+			asgs:    []*autoscaling.Group{suspendTestASG("legacy", map[string]string{updatestrategy.AdoptedASGTag: "worker-other"}, 0, 10, 5)},
+			success: false,
+		},
+		{
+			msg:     "ASGs of node pools can't be adopted",
+			asgs:    []*autoscaling.Group{suspendTestASG("legacy", map[string]string{"NodePool": "worker-other"}, 3, 10, 5)},
+			success: false,
+		},
+		{
+			msg:     "missing ASGs can't be adopted",
+			success: false,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			asgClient := &suspendAutoscalingAPIStub{groups: tc.asgs}
+			a := &awsAdapter{autoscalingClient: asgClient, logger: log.WithField("cluster", "kube-1")}
+
+			err := a.adoptASGs(&api.Cluster{ID: "kube-1", NodePools: []*api.NodePool{nodePool}})
+			if !tc.success {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			if !tc.adopted {
+				assert.Empty(t, asgClient.updates)
+				assert.Empty(t, asgClient.tags)
+				return
+			}
+
+			assert.Equal(t, 1, asgClient.suspended)
+			require.Len(t, asgClient.updates, 1)
+			assert.EqualValues(t, 0, aws.Int64Value(asgClient.updates[0].MinSize))
+			assert.EqualValues(t, 10, aws.Int64Value(asgClient.updates[0].MaxSize))
+			assert.EqualValues(t, 5, aws.Int64Value(asgClient.updates[0].DesiredCapacity))
+
+			tags := make(map[string]string)
+			for _, tag := range asgClient.tags {
+				tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+			assert.Equal(t, map[string]string{
+				"kubernetes.io/cluster/kube-1": "owned",
+				updatestrategy.AdoptedASGTag:   "worker-default",
+			}, tags)
+		})
+	}
+}
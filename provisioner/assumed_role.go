@@ -0,0 +1,37 @@
+package provisioner
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// assumedRoleConfigItemKey is the config item defining the ARN of the IAM
+// role assumed to provision the cluster, overriding --assumed-role.
+const assumedRoleConfigItemKey = "assumed_role_arn"
+
+// roleArnPattern matches IAM role ARNs, capturing the account ID.
+var roleArnPattern = regexp.MustCompile(`^arn:aws[a-z-]*:iam::([0-9]{12}):role/[\w+=,.@/-]+$`)
+
+// clusterRoleArn returns the ARN of the role assumed to provision the cluster
+// in its account, or an empty string if no role is assumed. A role defined by
+// the cluster must be in the account of the cluster, such that a typo in the
+// ARN can't change the resources of another cluster.
+func clusterRoleArn(cluster *api.Cluster, accountID, assumedRole string) (string, error) {
+	if roleArn, ok := cluster.ConfigItems[assumedRoleConfigItemKey]; ok && roleArn != "" {
+		match := roleArnPattern.FindStringSubmatch(roleArn)
+		if match == nil {
+			return "", fmt.Errorf("invalid %s '%s': not an IAM role ARN", assumedRoleConfigItemKey, roleArn)
+		}
+		if match[1] != accountID {
+			return "", fmt.Errorf("invalid %s '%s': role isn't in account %s of the cluster", assumedRoleConfigItemKey, roleArn, accountID)
+		}
+		return roleArn, nil
+	}
+
+	if assumedRole == "" {
+		return "", nil
+	}
+	return fmt.Sprintf("arn:aws:iam::%s:role/%s", accountID, assumedRole), nil
+}
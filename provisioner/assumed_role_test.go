@@ -0,0 +1,41 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestClusterRoleArn(t *testing.T) {
+	for _, tc := range []struct {
+		name        string
+		roleArn     string
+		assumedRole string
+		expected    string
+		valid       bool
+	}{
+		{name: "no role", valid: true},
+		{name: "assumed role", assumedRole: "clm", expected: "arn:aws:iam::123456789012:role/clm", valid: true},
+		{name: "cluster role", roleArn: "arn:aws:iam::123456789012:role/path/clm-kube-1", assumedRole: "clm", expected: "arn:aws:iam::123456789012:role/path/clm-kube-1", valid: true},
+		{name: "role in other account", roleArn: "arn:aws:iam::210987654321:role/clm", valid: false},
+		{name: "invalid arn", roleArn: "clm", valid: false},
+	} {
+		t.Run(tc.name, func(t *testing.T) {
+			cluster := &api.Cluster{ConfigItems: map[string]string{}}
+			if tc.roleArn != "" {
+				cluster.ConfigItems[assumedRoleConfigItemKey] = tc.roleArn
+			}
+
+			roleArn, err := clusterRoleArn(cluster, "123456789012", tc.assumedRole)
+			if !tc.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, roleArn)
+		})
+	}
+}
@@ -0,0 +1,174 @@
+package provisioner
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+const (
+	autoscalerTagPrefix          = "k8s.io/cluster-autoscaler/"
+	autoscalerEnabledTag         = autoscalerTagPrefix + "enabled"
+	autoscalerNodeTemplatePrefix = autoscalerTagPrefix + "node-template/"
+	autoscalerLabelTagPrefix     = autoscalerNodeTemplatePrefix + "label/"
+	autoscalerTaintTagPrefix     = autoscalerNodeTemplatePrefix + "taint/"
+	autoscalerResourcePrefix     = autoscalerNodeTemplatePrefix + "resources/"
+	resourceLifecycleOwned       = "owned"
+
+	instanceTypeLabel = "node.kubernetes.io/instance-type"
+	archLabel         = "kubernetes.io/arch"
+	osLabel           = "kubernetes.io/os"
+	gpuResource       = "nvidia.com/gpu"
+	ephemeralStorage  = "ephemeral-storage"
+)
+
+// autoscalerTags returns the ASG tags used by the cluster autoscaler to
+// discover a node pool. The node template tags describe the labels and
+// taints of the nodes from the userdata config as well as the instance type,
+// architecture, operating system, GPUs and root volume of the node pool, such
+// that the autoscaler can scale the node pool up from zero. Master pools get
+// the node template tags but aren't discovered, they're never autoscaled.
+func autoscalerTags(clusterID string, nodePool *api.NodePool, config map[string]string) (map[string]string, error) {
+	tags := make(map[string]string)
+	if !strings.HasPrefix(nodePool.Profile, "master") {
+		tags[autoscalerEnabledTag] = "true"
+		tags[autoscalerTagPrefix+clusterID] = resourceLifecycleOwned
+	}
+
+	// labels of the userdata config take precedence.
+	tags[autoscalerLabelTagPrefix+instanceTypeLabel] = nodePool.InstanceType
+
+	instance, known := awsExt.InstanceInfo()[nodePool.InstanceType]
+	switch {
+	case nodePool.Architecture != "":
+		tags[autoscalerLabelTagPrefix+archLabel] = nodePool.Architecture
+	case known && len(instance.Architectures) == 1:
+		tags[autoscalerLabelTagPrefix+archLabel] = instance.Architectures[0]
+	}
+
+	tags[autoscalerLabelTagPrefix+osLabel] = nodePoolOS(nodePool)
+
+	if known && instance.GPU > 0 {
+		tags[autoscalerResourcePrefix+gpuResource] = strconv.FormatInt(instance.GPU, 10)
+	}
+
+	if nodePool.RootVolumeSize > 0 {
+		tags[autoscalerResourcePrefix+ephemeralStorage] = fmt.Sprintf("%dGi", nodePool.RootVolumeSize)
+	}
+
+	labels, err := parseNodeLabels(config["NODE_LABELS"])
+	if err != nil {
+		return nil, err
+	}
+
+	for key, value := range labels {
+		tags[autoscalerLabelTagPrefix+key] = value
+	}
+
+	for _, taint := range strings.Split(config["NODE_TAINTS"], ",") {
+		if taint == "" {
+			continue
+		}
+
+		// taints are specified as <key>=<value>:<effect> or
+		// <key>:<effect>.
+		effectSep := strings.LastIndex(taint, ":")
+		if effectSep == -1 {
+			return nil, fmt.Errorf("invalid node taint '%s'", taint)
+		}
+
+		key, value := taint[:effectSep], ""
+		if valueSep := strings.Index(key, "="); valueSep != -1 {
+			key, value = key[:valueSep], key[valueSep+1:]
+		}
+
+		if key == "" {
+			return nil, fmt.Errorf("invalid node taint '%s'", taint)
+		}
+
+		// the startup taint is removed once the nodes are initialized,
+		// so it's not part of the node template.
+		if key == updatestrategy.StartupTaintKey {
+			continue
+		}
+
+		tags[autoscalerTaintTagPrefix+key] = value + taint[effectSep:]
+	}
+
+	return tags, nil
+}
+
+// addAutoscalerTags adds the autoscaler tags of the node pools to their ASGs
+// in the stack template. As cloudformation owns the tags, the tags of labels
+// and taints removed from a node pool are removed from its ASG.
+func addAutoscalerTags(stackTemplate []byte, nodePoolTags map[*api.NodePool]map[string]string) ([]byte, error) {
+	return modifyStackResources(stackTemplate, func(resources map[string]interface{}) error {
+		for nodePool, tags := range nodePoolTags {
+			asgLogicalID, err := nodePoolASGLogicalID(resources, nodePool)
+			if err != nil {
+				return err
+			}
+
+			properties := resources[asgLogicalID].(map[string]interface{})["Properties"].(map[string]interface{})
+			properties["Tags"] = mergeASGTags(properties["Tags"], tags, false)
+		}
+		return nil
+	})
+}
+
+// deleteStaleAutoscalerTags deletes the node template tags of an ASG which
+// aren't part of the current autoscaler tags of its node pool. These are left
+// over from before cloudformation owned the tags.
+func (a *awsAdapter) deleteStaleAutoscalerTags(asg *autoscaling.Group, tags map[string]string) error {
+	for _, tag := range asg.Tags {
+		key := aws.StringValue(tag.Key)
+		if !strings.HasPrefix(key, autoscalerNodeTemplatePrefix) {
+			continue
+		}
+		if _, ok := tags[key]; ok {
+			continue
+		}
+
+		err := a.deleteASGTag(aws.StringValue(asg.AutoScalingGroupName), key)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// tagASG adds or updates tags of an ASG. The tags are not propagated to the
+// instances.
+func (a *awsAdapter) tagASG(asgName string, tags map[string]string) error {
+	if a.skipReadOnly("tagging ASG %s", asgName) {
+		return nil
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	params := &autoscaling.CreateOrUpdateTagsInput{}
+	for _, key := range keys {
+		params.Tags = append(params.Tags, &autoscaling.Tag{
+			Key:               aws.String(key),
+			Value:             aws.String(tags[key]),
+			ResourceId:        aws.String(asgName),
+			ResourceType:      aws.String("auto-scaling-group"),
+			PropagateAtLaunch: aws.Bool(false),
+		})
+	}
+
+	_, err := a.autoscalingClient.CreateOrUpdateTags(params)
+	return err
+}
@@ -11,9 +11,12 @@ import (
 	"fmt"
 	"io/ioutil"
 	"math"
+	"os"
 	"os/exec"
 	"path"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	"github.com/cbroglie/mustache"
@@ -22,41 +25,48 @@ import (
 	log "github.com/sirupsen/logrus"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/tracing"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
 	"golang.org/x/oauth2"
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
 	"github.com/aws/aws-sdk-go/service/iam"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
 )
 
 const (
 	waitTime                        = 15 * time.Second
 	stackMaxSize                    = 51200
+	maxEmbeddedUserDataSize         = 16384
 	cloudformationValidationErr     = "ValidationError"
 	cloudformationNoUpdateMsg       = "No updates are to be performed."
-	clmCFBucketPattern              = "cluster-lifecycle-manager-%s-%s"
+	cloudformationNoChangesMsg      = "didn't contain changes"
+	changeSetPollInterval           = 5 * time.Second
 	lifecycleStatusReady            = "ready"
 	etcdInstanceTypeKey             = "etcd_instance_type"
 	etcdS3BackupBucketKey           = "etcd_s3_backup_bucket"
 	workerSharedSecretConfigItemKey = "worker_shared_secret"
-	discountStrategyNone            = "none"
-	discountStrategySpotMaxPrice    = "spot_max_price"
-	ignitionBaseTemplate            = `{
-  "ignition": {
-    "version": "2.1.0",
-    "config": {
-      "replace": {
-        "source": "%s"
-      }
-    }
-  }
-}`
+	userDataKMSKeyConfigItemKey     = "userdata_kms_key"
+	launchTemplateConfigItemKey     = "launch_template"
+	startupTaintConfigItemKey       = "startup_taint"
+	defaultIMDSHopLimit             = 2
+	maxIMDSHopLimit                 = 64
+	gpuCountLabel                   = "aws.amazon.com/gpu-count"
+	gpuTypeLabel                    = "aws.amazon.com/gpu-type"
+	gpuTaint                        = "nvidia.com/gpu=present:NoSchedule"
+	defaultArchitecture             = "amd64"
+	templateHashTag                 = "cluster-lifecycle-manager.zalando.org/template-hash"
 )
 
 var (
@@ -73,16 +83,35 @@ var (
 // cloudFormationAPI is a minimal interface containing only the methods we use from the AWS SDK for cloudformation
 type cloudFormationAPI interface {
 	DescribeStacks(input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error)
-	CreateStack(input *cloudformation.CreateStackInput) (*cloudformation.CreateStackOutput, error)
-	UpdateStack(input *cloudformation.UpdateStackInput) (*cloudformation.UpdateStackOutput, error)
+	CreateStackWithContext(ctx aws.Context, input *cloudformation.CreateStackInput, opts ...request.Option) (*cloudformation.CreateStackOutput, error)
+	CreateChangeSetWithContext(ctx aws.Context, input *cloudformation.CreateChangeSetInput, opts ...request.Option) (*cloudformation.CreateChangeSetOutput, error)
+	DescribeChangeSetWithContext(ctx aws.Context, input *cloudformation.DescribeChangeSetInput, opts ...request.Option) (*cloudformation.DescribeChangeSetOutput, error)
+	ExecuteChangeSetWithContext(ctx aws.Context, input *cloudformation.ExecuteChangeSetInput, opts ...request.Option) (*cloudformation.ExecuteChangeSetOutput, error)
+	DeleteChangeSet(input *cloudformation.DeleteChangeSetInput) (*cloudformation.DeleteChangeSetOutput, error)
 	DeleteStack(input *cloudformation.DeleteStackInput) (*cloudformation.DeleteStackOutput, error)
 	UpdateTerminationProtection(intput *cloudformation.UpdateTerminationProtectionInput) (*cloudformation.UpdateTerminationProtectionOutput, error)
 	DescribeStacksPages(input *cloudformation.DescribeStacksInput, fn func(resp *cloudformation.DescribeStacksOutput, lastPage bool) bool) error
+	GetTemplate(input *cloudformation.GetTemplateInput) (*cloudformation.GetTemplateOutput, error)
+	DescribeStackResources(input *cloudformation.DescribeStackResourcesInput) (*cloudformation.DescribeStackResourcesOutput, error)
+	DescribeStackEvents(input *cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error)
+	ValidateTemplate(input *cloudformation.ValidateTemplateInput) (*cloudformation.ValidateTemplateOutput, error)
 }
 
 // s3API is a minimal interface containing only the methods we use from the S3 API
 type s3API interface {
 	CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error)
+	PutBucketEncryption(input *s3.PutBucketEncryptionInput) (*s3.PutBucketEncryptionOutput, error)
+	GetBucketPolicy(input *s3.GetBucketPolicyInput) (*s3.GetBucketPolicyOutput, error)
+	PutBucketPolicy(input *s3.PutBucketPolicyInput) (*s3.PutBucketPolicyOutput, error)
+	HeadBucket(input *s3.HeadBucketInput) (*s3.HeadBucketOutput, error)
+	HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error)
+	PutBucketVersioning(input *s3.PutBucketVersioningInput) (*s3.PutBucketVersioningOutput, error)
+	PutBucketReplication(input *s3.PutBucketReplicationInput) (*s3.PutBucketReplicationOutput, error)
+	ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error
+	DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error)
+	GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error)
+	GetObjectRequest(input *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput)
+	PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error)
 }
 
 type autoscalingAPI interface {
@@ -92,6 +121,11 @@ type autoscalingAPI interface {
 	SuspendProcesses(input *autoscaling.ScalingProcessQuery) (*autoscaling.SuspendProcessesOutput, error)
 	ResumeProcesses(*autoscaling.ScalingProcessQuery) (*autoscaling.ResumeProcessesOutput, error)
 	TerminateInstanceInAutoScalingGroup(*autoscaling.TerminateInstanceInAutoScalingGroupInput) (*autoscaling.TerminateInstanceInAutoScalingGroupOutput, error)
+	DeleteTags(input *autoscaling.DeleteTagsInput) (*autoscaling.DeleteTagsOutput, error)
+	CreateOrUpdateTags(input *autoscaling.CreateOrUpdateTagsInput) (*autoscaling.CreateOrUpdateTagsOutput, error)
+	DeleteLaunchConfiguration(input *autoscaling.DeleteLaunchConfigurationInput) (*autoscaling.DeleteLaunchConfigurationOutput, error)
+	DescribeScalingActivities(input *autoscaling.DescribeScalingActivitiesInput) (*autoscaling.DescribeScalingActivitiesOutput, error)
+	DescribeAccountLimits(input *autoscaling.DescribeAccountLimitsInput) (*autoscaling.DescribeAccountLimitsOutput, error)
 }
 
 type iamAPI interface {
@@ -104,15 +138,50 @@ type ec2API interface {
 	DescribeVpcs(input *ec2.DescribeVpcsInput) (*ec2.DescribeVpcsOutput, error)
 	DescribeVolumes(input *ec2.DescribeVolumesInput) (*ec2.DescribeVolumesOutput, error)
 	DescribeSubnets(input *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error)
+	DescribeLaunchTemplateVersions(input *ec2.DescribeLaunchTemplateVersionsInput) (*ec2.DescribeLaunchTemplateVersionsOutput, error)
+	DescribeImages(input *ec2.DescribeImagesInput) (*ec2.DescribeImagesOutput, error)
+	DescribeInstancesPages(input *ec2.DescribeInstancesInput, fn func(*ec2.DescribeInstancesOutput, bool) bool) error
+	DescribeNetworkInterfaces(input *ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error)
+	DescribeSecurityGroups(input *ec2.DescribeSecurityGroupsInput) (*ec2.DescribeSecurityGroupsOutput, error)
+	DescribeRouteTables(input *ec2.DescribeRouteTablesInput) (*ec2.DescribeRouteTablesOutput, error)
+	DescribeAccountAttributes(input *ec2.DescribeAccountAttributesInput) (*ec2.DescribeAccountAttributesOutput, error)
+	DescribeLaunchTemplates(input *ec2.DescribeLaunchTemplatesInput) (*ec2.DescribeLaunchTemplatesOutput, error)
 
 	CreateTags(input *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error)
 	DeleteTags(input *ec2.DeleteTagsInput) (*ec2.DeleteTagsOutput, error)
 
 	DeleteVolume(input *ec2.DeleteVolumeInput) (*ec2.DeleteVolumeOutput, error)
+	DeleteLaunchTemplateVersions(input *ec2.DeleteLaunchTemplateVersionsInput) (*ec2.DeleteLaunchTemplateVersionsOutput, error)
+	TerminateInstances(input *ec2.TerminateInstancesInput) (*ec2.TerminateInstancesOutput, error)
+	DeleteNetworkInterface(input *ec2.DeleteNetworkInterfaceInput) (*ec2.DeleteNetworkInterfaceOutput, error)
+	RevokeSecurityGroupIngress(input *ec2.RevokeSecurityGroupIngressInput) (*ec2.RevokeSecurityGroupIngressOutput, error)
+}
+
+type elbAPI interface {
+	DescribeLoadBalancersPages(input *elb.DescribeLoadBalancersInput, fn func(*elb.DescribeLoadBalancersOutput, bool) bool) error
+	DescribeTags(input *elb.DescribeTagsInput) (*elb.DescribeTagsOutput, error)
+	DeleteLoadBalancer(input *elb.DeleteLoadBalancerInput) (*elb.DeleteLoadBalancerOutput, error)
+}
+
+type elbv2API interface {
+	DescribeLoadBalancersPages(input *elbv2.DescribeLoadBalancersInput, fn func(*elbv2.DescribeLoadBalancersOutput, bool) bool) error
+	DescribeTargetGroupsPages(input *elbv2.DescribeTargetGroupsInput, fn func(*elbv2.DescribeTargetGroupsOutput, bool) bool) error
+	DescribeTags(input *elbv2.DescribeTagsInput) (*elbv2.DescribeTagsOutput, error)
+	DeleteLoadBalancer(input *elbv2.DeleteLoadBalancerInput) (*elbv2.DeleteLoadBalancerOutput, error)
+	DeleteTargetGroup(input *elbv2.DeleteTargetGroupInput) (*elbv2.DeleteTargetGroupOutput, error)
+}
+
+type secretsManagerAPI interface {
+	GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error)
+}
+
+type ssmAPI interface {
+	GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error)
+	PutParameter(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error)
 }
 
 type s3UploaderAPI interface {
-	Upload(input *s3manager.UploadInput, options ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error)
+	UploadWithContext(ctx aws.Context, input *s3manager.UploadInput, options ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error)
 }
 
 type awsAdapter struct {
@@ -123,45 +192,105 @@ type awsAdapter struct {
 	autoscalingClient    autoscalingAPI
 	iamClient            iamAPI
 	ec2Client            ec2API
+	elbClient            elbAPI
+	elbv2Client          elbv2API
+	secretsManagerClient secretsManagerAPI
+	ssmClient            ssmAPI
 	region               string
 	apiServer            string
 	tokenSrc             oauth2.TokenSource
 	dryRun               bool
 	logger               *log.Entry
+	// capacityReservationClient describes the capacity reservations
+	// targeted by node pools.
+	capacityReservationClient capacityReservationAPI
+	// publicAccessBlockClient blocks public access to the buckets created
+	// by the adapter.
+	publicAccessBlockClient publicAccessBlockAPI
+	// serviceQuotasClient looks up the vCPU quotas of the account.
+	serviceQuotasClient serviceQuotasAPI
+	// priceSource is used to look up on-demand prices missing from the
+	// instance info.
+	priceSource awsExt.PriceSource
+	// priceOracle returns the max price of spot node pools using the
+	// price_oracle discount strategy.
+	priceOracle *priceOracle
+	// networkTags identify the subnets, route tables and security groups
+	// of clusters provisioned into an existing network. The default VPC
+	// is used if it's nil.
+	networkTags map[string]string
+	// stackPoller polls the status of the stacks waited for, it's set up
+	// on the first wait.
+	stackPoller     *stackPoller
+	stackPollerOnce sync.Once
+	// costTags are added to the stacks and S3 objects to attribute their
+	// costs to the provisioning.
+	costTags map[string]string
+	// templateHashes are the hashes of the userdata rendered for the node
+	// pools by name.
+	templateHashes map[string]string
+	// imageTags record the AMIs resolved for the node pools as stack tags.
+	imageTags map[string]string
+	// hooks can change the rendered stack templates and userdata.
+	hooks provisionerHooks
+	// policies check the rendered stack templates and userdata after the
+	// hooks.
+	policies provisionerPolicies
+	// checkChangedNodePools is called with the node pools whose nodes are
+	// replaced by an update of the cluster stack before the stack is
+	// updated. The update is refused if it returns an error.
+	checkChangedNodePools func(nodePools []*api.NodePool) error
+	// previousTemplateURLs are the S3 URLs of the templates the stacks
+	// had before they were updated by stack name.
+	previousTemplateURLs map[string]string
+	// updatedStacks are the stacks created or changed by the adapter by
+	// name.
+	updatedStacks map[string]bool
+	// readOnly skips all changes of resources, logging them instead.
+	readOnly bool
+	// summary records the outcome of the provisioning, it's nil unless
+	// the provisioning is summarized.
+	summary *api.UpdateSummary
+	// roleArn is the ARN of the role assumed to provision the cluster, it's
+	// empty if no role is assumed.
+	roleArn string
 }
 
 // newAWSAdapter initializes a new awsAdapter.
 func newAWSAdapter(logger *log.Entry, apiServer string, region string, sess *session.Session, tokenSrc oauth2.TokenSource, dryRun bool) (*awsAdapter, error) {
+	ec2Client := ec2.New(sess)
+	s3Client := s3.New(sess)
 	return &awsAdapter{
-		session:              sess,
-		cloudformationClient: cloudformation.New(sess),
-		iamClient:            iam.New(sess),
-		s3Client:             s3.New(sess),
-		s3Uploader:           s3manager.NewUploader(sess),
-		autoscalingClient:    autoscaling.New(sess),
-		ec2Client:            ec2.New(sess),
-		region:               region,
-		apiServer:            apiServer,
-		tokenSrc:             tokenSrc,
-		dryRun:               dryRun,
-		logger:               logger,
+		session:                   sess,
+		cloudformationClient:      cloudformation.New(sess),
+		iamClient:                 iam.New(sess),
+		s3Client:                  s3Client,
+		s3Uploader:                s3manager.NewUploader(sess),
+		autoscalingClient:         autoscaling.New(sess),
+		ec2Client:                 ec2Client,
+		elbClient:                 elb.New(sess),
+		elbv2Client:               elbv2.New(sess),
+		secretsManagerClient:      secretsmanager.New(sess),
+		ssmClient:                 ssm.New(sess),
+		capacityReservationClient: &ec2QueryClient{client: ec2Client},
+		publicAccessBlockClient:   &s3RestClient{client: s3Client},
+		serviceQuotasClient:       newServiceQuotasClient(sess),
+		region:                    region,
+		apiServer:                 apiServer,
+		tokenSrc:                  tokenSrc,
+		dryRun:                    dryRun,
+		logger:                    logger,
 	}, nil
 }
 
 // encodeUserData gzip compresses and base64 encodes a userData string.
 func encodeUserData(userData string) (string, error) {
-	var buf bytes.Buffer
-	gz := gzip.NewWriter(&buf)
-	_, err := gz.Write([]byte(userData))
-	if err != nil {
-		return "", err
-	}
-	err = gz.Close()
+	compressed, err := gzipData([]byte(userData))
 	if err != nil {
 		return "", err
 	}
 
-	return base64.StdEncoding.EncodeToString(buf.Bytes()), nil
+	return base64.StdEncoding.EncodeToString(compressed), nil
 }
 
 // decodeUserData decodes base64 encoded + gzip compressed data.
@@ -187,7 +316,7 @@ func decodeUserData(encodedUserData string) (string, error) {
 
 // CreateOrUpdateClusterStack creates or updates a cluster cloudformation
 // stack. This function is idempotent.
-func (a *awsAdapter) CreateOrUpdateClusterStack(stackName, stackDefinitionPath string, cluster *api.Cluster) (map[string]string, error) {
+func (a *awsAdapter) CreateOrUpdateClusterStack(ctx context.Context, stackName, stackDefinitionPath string, cluster *api.Cluster) (map[string]string, error) {
 	masterPool, workerPool, err := getNodePools(cluster) //FIXME this only works on one node pool for workers
 	if err != nil {
 		return nil, err
@@ -204,18 +333,20 @@ func (a *awsAdapter) CreateOrUpdateClusterStack(stackName, stackDefinitionPath s
 	}
 
 	workerNodes := workerPool.MinSize
+	minWorkerNodes, maxWorkerNodes := workerPool.MinSize, workerPool.MaxSize
+	var workerASG *autoscaling.Group
 
 	// if stack already exists use the already generated secret and current
 	// desired worker nodes.
 	if stack != nil {
 		// get desired worker nodes
-		asg, err := a.getNodePoolASG(stackName, workerPool.Name)
+		workerASG, err = a.getNodePoolASG(stackName, workerPool.Name)
 		if err != nil {
 			return nil, err
 		}
 
 		// reduce the desired size if necessary
-		workerNodes = int64(math.Min(float64(*asg.DesiredCapacity), float64(workerPool.MaxSize)))
+		workerNodes = int64(math.Min(float64(desiredCapacity(workerASG)), float64(maxWorkerNodes)))
 	}
 
 	// we currently don't support scaling for master pools
@@ -223,6 +354,47 @@ func (a *awsAdapter) CreateOrUpdateClusterStack(stackName, stackDefinitionPath s
 		return nil, fmt.Errorf("master pool must have the same min_size and max_size")
 	}
 
+	if masterPool.WarmPool != nil {
+		return nil, fmt.Errorf("warm pools are not supported for master pools")
+	}
+
+	err = validateWarmPool(workerPool)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, nodePool := range []*api.NodePool{masterPool, workerPool} {
+		err = validateScalingSchedules(nodePool)
+		if err != nil {
+			return nil, err
+		}
+
+		err = validateLifecycleHooks(nodePool)
+		if err != nil {
+			return nil, err
+		}
+
+		err = validateStorage(nodePool)
+		if err != nil {
+			return nil, err
+		}
+
+		err = validateKubeletConfig(nodePool)
+		if err != nil {
+			return nil, err
+		}
+
+		err = validateMonitoring(nodePool)
+		if err != nil {
+			return nil, err
+		}
+
+		err = validateOS(nodePool)
+		if err != nil {
+			return nil, err
+		}
+	}
+
 	name, version, err := splitStackName(stackName)
 	if err != nil {
 		return nil, err
@@ -233,30 +405,125 @@ func (a *awsAdapter) CreateOrUpdateClusterStack(stackName, stackDefinitionPath s
 		return nil, err
 	}
 
-	// create bucket name with aws account ID to ensure uniqueness across
-	// accounts.
-	s3BucketName := fmt.Sprintf(clmCFBucketPattern, strings.TrimPrefix(cluster.InfrastructureAccount, "aws:"), cluster.Region)
+	// fail before updating the stack if the nodes couldn't run on the
+	// instance type.
+	for _, pool := range []*api.NodePool{masterPool, workerPool} {
+		err := validateArchitecture(pool)
+		if err != nil {
+			return nil, err
+		}
+
+		err = validateLabelsAndTaints(pool)
+		if err != nil {
+			return nil, err
+		}
+
+		err = validateAvailabilityZones(cluster, pool)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	masterConfig := nodePoolUserDataConfig(config, masterPool)
+	workerConfig := nodePoolUserDataConfig(config, workerPool)
+
+	// new worker nodes register with the startup taint which is removed
+	// by the update strategy once the nodes are initialized.
+	if cluster.ConfigItems[startupTaintConfigItemKey] == "true" {
+		workerConfig["NODE_TAINTS"] = appendList(workerConfig["NODE_TAINTS"], updatestrategy.StartupTaint)
+	}
+
+	// the node termination handler of spot pools drains the nodes based
+	// on the interruption events delivered to the queue.
+	var spotQueue *spotInterruptionQueue
+	if isSpotNodePool(workerPool) {
+		spotQueue = newSpotInterruptionQueue(name, cluster, workerPool)
+		workerConfig["SPOT_INTERRUPTION_QUEUE_ARN"] = spotQueue.ARN
+		workerConfig["SPOT_INTERRUPTION_QUEUE_URL"] = spotQueue.URL
+	}
+
+	// the bucket name includes the account ID and region to ensure
+	// uniqueness across accounts and regions.
+	s3BucketName, err := clmBucketName(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	// the userdata is uploaded to the same bucket unless another bucket
+	// is configured.
+	userDataBucket, err := newUserDataBucket(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.ensureUserDataReplication(userDataBucket)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.ensureCLMBucketReadPolicy(userDataBucket, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	// the userdata may contain secrets, so it's encrypted with the
+	// cluster specific KMS key if one is configured.
+	userDataKMSKey := cluster.ConfigItems[userDataKMSKeyConfigItemKey]
+
+	compress, err := userDataCompression(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	masterObject := newUserDataObject(cluster, masterPool, now)
+	workerObject := newUserDataObject(cluster, workerPool, now)
 
 	// First try to get userdata from Container Linux Config, then from
 	// cloud-config.
-	userDataMaster, userDataWorker, err := a.getUserDataCLC(path.Dir(stackDefinitionPath), config, s3BucketName)
+	userDataMaster, userDataWorker, err := a.getUserDataCLC(ctx, path.Dir(stackDefinitionPath), cluster, masterPool, workerPool, masterConfig, workerConfig, userDataBucket, userDataKMSKey, masterObject, workerObject, compress)
 	if err != nil {
+		// Windows node pools don't have a cloud-config to fall back to.
+		if nodePoolOS(workerPool) == osWindows {
+			return nil, err
+		}
+
 		log.Warnf("Failed to get userdata from CLC: %v", err)
 
-		userDataMaster, userDataWorker, err = getUserData(path.Dir(stackDefinitionPath), config)
+		userDataMaster, userDataWorker, err = getUserData(path.Dir(stackDefinitionPath), masterPool, workerPool, masterConfig, workerConfig, cluster.ConfigValues)
 		if err != nil {
 			return nil, err
 		}
 	}
 
+	err = checkUserDataSize(masterPool, userDataMaster)
+	if err != nil {
+		return nil, err
+	}
+
+	err = checkUserDataSize(workerPool, userDataWorker)
+	if err != nil {
+		return nil, err
+	}
+
 	hostedZone, err := getHostedZone(cluster.APIServerURL)
 	if err != nil {
 		return nil, err
 	}
 
+	// stack definition templates can range over the subnets of the
+	// cluster, e.g. to define an ASG per availability zone.
+	definitionPath, err := a.renderStackDefinition(stackDefinitionPath, cluster, masterPool, workerPool)
+	if err != nil {
+		return nil, err
+	}
+	if definitionPath != stackDefinitionPath {
+		defer os.Remove(definitionPath)
+	}
+
 	args := []string{
 		"print",
-		stackDefinitionPath,
+		definitionPath,
 		version,
 		"KmsKey=*",
 		fmt.Sprintf("StackName=%s", name),
@@ -266,8 +533,8 @@ func (a *awsAdapter) CreateOrUpdateClusterStack(stackName, stackDefinitionPath s
 		fmt.Sprintf("WorkerNodePoolName=%s", workerPool.Name),
 		fmt.Sprintf("MasterNodes=%d", masterPool.MaxSize),
 		fmt.Sprintf("WorkerNodes=%d", workerNodes),
-		fmt.Sprintf("MinimumWorkerNodes=%d", workerPool.MinSize),
-		fmt.Sprintf("MaximumWorkerNodes=%d", workerPool.MaxSize),
+		fmt.Sprintf("MinimumWorkerNodes=%d", minWorkerNodes),
+		fmt.Sprintf("MaximumWorkerNodes=%d", maxWorkerNodes),
 		fmt.Sprintf("HostedZone=%s", hostedZone),
 		fmt.Sprintf("MasterInstanceType=%s", masterPool.InstanceType),
 		fmt.Sprintf("InstanceType=%s", workerPool.InstanceType),
@@ -278,30 +545,158 @@ func (a *awsAdapter) CreateOrUpdateClusterStack(stackName, stackDefinitionPath s
 		args = append(args, fmt.Sprintf("EtcdS3BackupBucket=%s", bucket))
 	}
 
-	switch masterPool.DiscountStrategy {
-	case discountStrategyNone:
-		break
-	default:
-		return nil, fmt.Errorf("unsupported master pool discount_strategy %s", workerPool.DiscountStrategy)
+	// the instance roles need access to the key in order to fetch the
+	// userdata from S3.
+	if userDataKMSKey != "" {
+		args = append(args, fmt.Sprintf("UserDataKMSKey=%s", userDataKMSKey))
 	}
 
-	switch workerPool.DiscountStrategy {
-	case discountStrategyNone:
-		break
-	case discountStrategySpotMaxPrice:
-		instanceInfo, ok := awsExt.InstanceInfo()[workerPool.InstanceType]
-		if !ok {
-			return nil, fmt.Errorf("unknown instance type %s", workerPool.InstanceType)
+	// the instance roles need access to an external userdata bucket and
+	// its replica.
+	if userDataBucket.external {
+		args = append(args, fmt.Sprintf("UserDataBucket=%s", userDataBucket.name))
+	}
+	if userDataBucket.replica != nil {
+		args = append(args, fmt.Sprintf("UserDataReplicaBucket=%s", userDataBucket.replica.bucket))
+	}
+
+	if cluster.ConfigItems[launchTemplateConfigItemKey] == "true" {
+		args = append(args, launchTemplateArgs(name, masterPool, workerPool)...)
+	}
+
+	// the stack template selects the AMI matching the architecture.
+	if masterPool.Architecture != "" {
+		args = append(args, fmt.Sprintf("MasterArchitecture=%s", masterPool.Architecture))
+	}
+	if workerPool.Architecture != "" {
+		args = append(args, fmt.Sprintf("WorkerArchitecture=%s", workerPool.Architecture))
+	}
+
+	// clusters in an existing network get the IDs of its resources
+	// instead of creating their own.
+	if a.networkTags != nil {
+		network, err := a.discoverNetwork()
+		if err != nil {
+			return nil, err
 		}
 
-		onDemandPrice, ok := instanceInfo.Pricing[cluster.Region]
-		if !ok {
-			return nil, fmt.Errorf("no price data for region %s, instance type %s", cluster.Region, workerPool.InstanceType)
+		err = network.validate()
+		if err != nil {
+			return nil, err
 		}
+		args = append(args, network.args()...)
+	}
 
-		args = append(args, fmt.Sprintf("WorkerSpotPrice=%s", onDemandPrice))
-	default:
-		return nil, fmt.Errorf("unsupported worker pool discount_strategy %s", workerPool.DiscountStrategy)
+	// the stack template selects the Windows AMI and skips the Linux
+	// specific resources of Windows node pools.
+	if workerPool.OS != "" {
+		args = append(args, fmt.Sprintf("WorkerOS=%s", workerPool.OS))
+	}
+
+	masterIMDSArgs, err := imdsArgs("Master", masterPool)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, masterIMDSArgs...)
+
+	workerIMDSArgs, err := imdsArgs("Worker", workerPool)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, workerIMDSArgs...)
+
+	masterVolumeArgs, err := rootVolumeArgs("Master", masterPool)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, masterVolumeArgs...)
+
+	workerVolumeArgs, err := rootVolumeArgs("Worker", workerPool)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, workerVolumeArgs...)
+
+	launchTemplate := cluster.ConfigItems[launchTemplateConfigItemKey] == "true"
+
+	masterReservationArgs, err := a.capacityReservationArgs("Master", masterPool, launchTemplate)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, masterReservationArgs...)
+
+	workerReservationArgs, err := a.capacityReservationArgs("Worker", workerPool, launchTemplate)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, workerReservationArgs...)
+
+	masterTenancyArgs, err := tenancyArgs("Master", masterPool, launchTemplate)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, masterTenancyArgs...)
+
+	workerTenancyArgs, err := tenancyArgs("Worker", workerPool, launchTemplate)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, workerTenancyArgs...)
+
+	// node pools with an image source get the resolved AMI, the others
+	// the AMI selected by the stack template.
+	masterImageArgs, err := a.imageArgs("Master", masterPool)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, masterImageArgs...)
+
+	workerImageArgs, err := a.imageArgs("Worker", workerPool)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, workerImageArgs...)
+
+	// node pools pinned to a subset of the subnets get the IDs of the
+	// matching subnets, the others span all subnets of the stack.
+	if hasSubnetSelector(masterPool) || hasSubnetSelector(workerPool) {
+		subnets, err := a.GetSubnets()
+		if err != nil {
+			return nil, err
+		}
+
+		masterSubnetArgs, err := subnetArgs("Master", subnets, masterPool)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, masterSubnetArgs...)
+
+		workerSubnetArgs, err := subnetArgs("Worker", subnets, workerPool)
+		if err != nil {
+			return nil, err
+		}
+		args = append(args, workerSubnetArgs...)
+	}
+
+	masterStrategy, err := nodePoolDiscountStrategy(masterPool)
+	if err != nil {
+		return nil, fmt.Errorf("master pool: %v", err)
+	}
+	if masterStrategy.spot() {
+		return nil, fmt.Errorf("unsupported master pool discount_strategy %s", masterPool.DiscountStrategy)
+	}
+
+	workerStrategy, err := nodePoolDiscountStrategy(workerPool)
+	if err != nil {
+		return nil, fmt.Errorf("worker pool: %v", err)
+	}
+	if workerStrategy.spot() {
+		maxPrice, err := workerStrategy.maxPrice(cluster, workerPool, &priceLookup{source: a.priceSource, oracle: a.priceOracle})
+		if err != nil {
+			return nil, err
+		}
+
+		args = append(args, fmt.Sprintf("WorkerSpotPrice=%s", maxPrice))
 	}
 
 	cmd := exec.Command("senza", args...)
@@ -325,18 +720,161 @@ func (a *awsAdapter) CreateOrUpdateClusterStack(stackName, stackDefinitionPath s
 		return nil, err
 	}
 
-	err = a.applyClusterStack(stackName, output, cluster, s3BucketName)
+	output, err = addScheduledActions(output, masterPool, workerPool)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err = addWarmPool(output, workerPool)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err = addLifecycleHooks(output, masterPool, workerPool)
+	if err != nil {
+		return nil, err
+	}
+
+	// node pools whose profile has a policy template get their own IAM
+	// role instead of sharing the role of the stack.
+	for prefix, nodePool := range map[string]*api.NodePool{"Master": masterPool, "Worker": workerPool} {
+		policy, err := renderNodePoolIAMPolicy(path.Dir(stackDefinitionPath), cluster, nodePool)
+		if err != nil {
+			return nil, err
+		}
+		if policy == nil {
+			continue
+		}
+
+		output, err = addNodePoolIAMRole(output, prefix, nodePool, policy)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	output, err = addNodePoolTags(output, name, cluster.ConfigItems[launchTemplateConfigItemKey] == "true", masterPool, workerPool)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err = addNodePoolProfileTags(output, masterPool, workerPool)
 	if err != nil {
 		return nil, err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), maxWaitTimeout)
+	nodePoolAutoscalerTags := make(map[*api.NodePool]map[string]string, 2)
+	for nodePool, config := range map[*api.NodePool]map[string]string{masterPool: masterConfig, workerPool: workerConfig} {
+		tags, err := autoscalerTags(cluster.ID, nodePool, config)
+		if err != nil {
+			return nil, fmt.Errorf("node pool %s: %v", nodePool.Name, err)
+		}
+		nodePoolAutoscalerTags[nodePool] = tags
+	}
+
+	output, err = addAutoscalerTags(output, nodePoolAutoscalerTags)
+	if err != nil {
+		return nil, err
+	}
+
+	output, err = addNodePoolMonitoring(output, masterPool, workerPool)
+	if err != nil {
+		return nil, err
+	}
+
+	if spotQueue != nil {
+		output, err = addSpotInterruptionResources(output, spotQueue, workerPool)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// launch configurations can't tag volumes and network interfaces.
+	if cluster.ConfigItems[launchTemplateConfigItemKey] == "true" {
+		output, err = addLaunchTemplateTagSpecifications(output, name, cluster, masterPool, workerPool)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(a.hooks) > 0 {
+		template, err := a.hooks.mutate(ctx, hookPhaseStackTemplate, cluster, "", string(output))
+		if err != nil {
+			return nil, err
+		}
+		output = []byte(template)
+	}
+
+	if len(a.policies) > 0 {
+		template, err := a.policies.check(hookPhaseStackTemplate, cluster, "", string(output))
+		if err != nil {
+			return nil, err
+		}
+		output = []byte(template)
+	}
+
+	// the ASGs use the new userdata right after the stack update, so
+	// changes replacing too many nodes are refused before.
+	if stack != nil && a.checkChangedNodePools != nil {
+		err = a.checkChangedNodePools(changedNodePools(cluster, a.templateHashes))
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the stack update records the new profiles of the node pools, so
+	// the changed ones are marked for replacement before.
+	if stack != nil && !a.dryRun {
+		for _, nodePool := range []*api.NodePool{masterPool, workerPool} {
+			asg, err := a.getRenamedNodePoolASG(stackName, nodePool)
+			if err != nil {
+				return nil, err
+			}
+
+			err = a.markProfileChange(asg, nodePool, time.Now())
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	err = a.applyClusterStack(ctx, stackName, output, cluster, s3BucketName)
+	if err != nil {
+		return nil, err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, maxWaitTimeout)
 	defer cancel()
-	outputs, err := a.waitForStack(ctx, waitTime, stackName)
+	outputs, err := a.waitForStack(waitCtx, waitTime, stackName)
 	if err != nil {
 		return nil, err
 	}
 
+	// the worker pool was restored to its size from before it was scaled
+	// to zero, so the stored size is no longer needed.
+	if workerASG != nil && aws.Int64Value(workerASG.DesiredCapacity) == 0 && desiredCapacity(workerASG) > 0 {
+		err = a.deleteASGTag(aws.StringValue(workerASG.AutoScalingGroupName), updatestrategy.PreScaleDesiredCapacityTag)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the autoscaler tags used to be added to the ASGs after the stack
+	// update, cloudformation doesn't remove the ones which became stale
+	// since.
+	if !a.dryRun {
+		for nodePool, tags := range nodePoolAutoscalerTags {
+			asg, err := a.getNodePoolASG(stackName, nodePool.Name)
+			if err != nil {
+				return nil, err
+			}
+
+			err = a.deleteStaleAutoscalerTags(asg, tags)
+			if err != nil {
+				return nil, err
+			}
+		}
+	}
+
 	// convert AWS struct to plain map[string]string
 	out := make(map[string]string, len(outputs))
 	for _, o := range outputs {
@@ -349,13 +887,45 @@ func (a *awsAdapter) CreateOrUpdateClusterStack(stackName, stackDefinitionPath s
 // stackTemplate.
 // If the stackTemplate exceeds the max size, it will automatically upload it
 // to S3 before creating or updating the stack.
-func (a *awsAdapter) applyClusterStack(stackName string, stackTemplate []byte, cluster *api.Cluster, s3BucketName string) error {
+func (a *awsAdapter) applyClusterStack(ctx context.Context, stackName string, stackTemplate []byte, cluster *api.Cluster, s3BucketName string) error {
+	// report mistakes in the stack definition with their location in
+	// the template before creating or updating the stack.
+	err := checkStackTemplate(stackTemplate)
+	if err != nil {
+		return err
+	}
+
+	// the template includes the rendered userdata, so a stack last applied
+	// with the same template doesn't need to be updated.
+	hash := templateHash(string(stackTemplate))
+	stack, err := a.getStackByName(stackName)
+	if err != nil && !isDoesNotExistsErr(err) {
+		return err
+	}
+	if stackUpToDate(stack, hash) {
+		a.logger.Infof("Stack %s is up to date with template hash %s, skipping update", stackName, hash)
+		return nil
+	}
+
+	if a.readOnly {
+		return a.reportStackUpdate(stackName, stackTemplate, hash)
+	}
+
+	// keep the current template to roll back to if the new nodes fail.
+	if stack != nil && stackRollbackEnabled(cluster) {
+		err = a.savePreviousTemplate(ctx, stack, cluster, s3BucketName)
+		if err != nil {
+			return err
+		}
+	}
+
 	var stackBuffer bytes.Buffer
 	// save as many bytes as possible
-	err := json.Compact(&stackBuffer, stackTemplate)
+	err = json.Compact(&stackBuffer, stackTemplate)
 	if err != nil {
 		return err
 	}
+	stackBody := stackBuffer.String()
 
 	var templateURL string
 	if stackBuffer.Len() > stackMaxSize {
@@ -366,10 +936,12 @@ func (a *awsAdapter) applyClusterStack(stackName string, stackTemplate []byte, c
 		}
 
 		// Upload the stack template to S3
-		result, err := a.s3Uploader.Upload(&s3manager.UploadInput{
-			Bucket: aws.String(s3BucketName),
-			Key:    aws.String(fmt.Sprintf("%s.template", cluster.ID)),
-			Body:   &stackBuffer,
+		result, err := a.s3Uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+			Bucket:               aws.String(s3BucketName),
+			Key:                  aws.String(fmt.Sprintf("%s.template", cluster.ID)),
+			Body:                 strings.NewReader(stackBody),
+			ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+			Tagging:              s3Tagging(a.costTags),
 		})
 		if err != nil {
 			return err
@@ -377,16 +949,53 @@ func (a *awsAdapter) applyClusterStack(stackName string, stackTemplate []byte, c
 		templateURL = result.Location
 	}
 
-	return a.applyStack(stackName, stackBuffer.String(), templateURL, true)
+	err = a.validateStackTemplate(stackName, stackBody, templateURL)
+	if err != nil {
+		return err
+	}
+
+	_, err = a.applyStack(ctx, stackName, stackBody, templateURL, hash, true)
+	return err
 }
 
-// applyStack applies a cloudformation stack.
-func (a *awsAdapter) applyStack(stackName string, stackTemplate string, stackTemplateURL string, updateStack bool) error {
+// stackUpToDate returns true if the stack was successfully created or updated
+// with the template of the hash.
+func stackUpToDate(stack *cloudformation.Stack, hash string) bool {
+	if stack == nil {
+		return false
+	}
+
+	switch aws.StringValue(stack.StackStatus) {
+	case cloudformation.StackStatusCreateComplete, cloudformation.StackStatusUpdateComplete:
+	default:
+		return false
+	}
+
+	for _, tag := range stack.Tags {
+		if aws.StringValue(tag.Key) == templateHashTag {
+			return aws.StringValue(tag.Value) == hash
+		}
+	}
+	return false
+}
+
+// applyStack applies a cloudformation stack. The stack is tagged with the
+// templateHash unless it's empty. Existing stacks are updated with a change
+// set, such that templates without changes are a no-op instead of a failed
+// update. It returns true if the stack was created or updated.
+func (a *awsAdapter) applyStack(ctx context.Context, stackName string, stackTemplate string, stackTemplateURL string, templateHash string, updateStack bool) (bool, error) {
+	api.ReportProgress(ctx, api.ProgressStepStackUpdate, "", fmt.Sprintf("Applying stack %s", stackName))
+
+	if a.skipReadOnly("applying stack %s", stackName) {
+		return false, nil
+	}
+
 	createParams := &cloudformation.CreateStackInput{
 		StackName:                   aws.String(stackName),
 		OnFailure:                   aws.String(cloudformation.OnFailureDelete),
 		Capabilities:                []*string{aws.String(cloudformation.CapabilityCapabilityNamedIam)},
 		EnableTerminationProtection: aws.Bool(true),
+		Tags:                        cloudformationTags(a.stackTags(templateHash)),
 	}
 
 	if stackTemplateURL != "" {
@@ -395,77 +1004,190 @@ func (a *awsAdapter) applyStack(stackName string, stackTemplate string, stackTem
 		createParams.TemplateBody = aws.String(stackTemplate)
 	}
 
-	_, err := a.cloudformationClient.CreateStack(createParams)
+	_, err := a.cloudformationClient.CreateStackWithContext(ctx, createParams)
+	if isAlreadyExistsErr(err) {
+		err = a.recreateRolledBackStack(ctx, createParams, err)
+	}
 	if err != nil {
-		if aerr, ok := err.(awserr.Error); ok {
-			switch aerr.Code() {
-			case cloudformation.ErrCodeAlreadyExistsException:
-				// if create failed because the stack already
-				// exists, update instead
-
-				// ensure stack termination protection is enabled.
-				terminationParams := &cloudformation.UpdateTerminationProtectionInput{
-					StackName:                   aws.String(stackName),
-					EnableTerminationProtection: aws.Bool(true),
-				}
-
-				_, err := a.cloudformationClient.UpdateTerminationProtection(terminationParams)
-				if err != nil {
-					return err
-				}
-
-				if updateStack {
-					// update the stack
-					updateParams := &cloudformation.UpdateStackInput{
-						StackName:    createParams.StackName,
-						Capabilities: createParams.Capabilities,
-					}
-
-					if stackTemplateURL != "" {
-						updateParams.TemplateURL = aws.String(stackTemplateURL)
-					} else {
-						updateParams.TemplateBody = aws.String(stackTemplate)
-					}
-
-					_, err = a.cloudformationClient.UpdateStack(updateParams)
-					if err != nil {
-						if aerr, ok := err.(awserr.Error); ok {
-							// if no update was needed
-							// treat it as success
-							if aerr.Code() == cloudformationValidationErr && aerr.Message() == cloudformationNoUpdateMsg {
-								return nil
-							}
-						}
-						return err
-					}
-				}
-				return nil
-			}
+		// if create failed because the stack already exists, update
+		// instead.
+		if !isAlreadyExistsErr(err) {
+			return false, err
+		}
+
+		// ensure stack termination protection is enabled.
+		terminationParams := &cloudformation.UpdateTerminationProtectionInput{
+			StackName:                   aws.String(stackName),
+			EnableTerminationProtection: aws.Bool(true),
 		}
+
+		_, err := a.cloudformationClient.UpdateTerminationProtection(terminationParams)
+		if err != nil {
+			return false, err
+		}
+
+		if !updateStack {
+			return false, nil
+		}
+
+		changeSetParams := &cloudformation.CreateChangeSetInput{
+			StackName:     createParams.StackName,
+			ChangeSetName: aws.String(fmt.Sprintf("clm-%d", time.Now().UnixNano())),
+			ChangeSetType: aws.String(cloudformation.ChangeSetTypeUpdate),
+			Capabilities:  createParams.Capabilities,
+			Tags:          createParams.Tags,
+			TemplateBody:  createParams.TemplateBody,
+			TemplateURL:   createParams.TemplateURL,
+		}
+
+		updated, err := a.applyChangeSet(ctx, changeSetParams)
+		if err != nil {
+			return false, err
+		}
+		if !updated {
+			return false, nil
+		}
+	}
+
+	if a.updatedStacks == nil {
+		a.updatedStacks = make(map[string]bool)
+	}
+	a.updatedStacks[stackName] = true
+	return true, nil
+}
+
+// recreateRolledBackStack deletes the stack and creates it again if its
+// creation failed and was rolled back, as stacks in ROLLBACK_COMPLETE can't
+// be updated. For stacks in any other status createErr is returned, such
+// that they're updated instead.
+func (a *awsAdapter) recreateRolledBackStack(ctx context.Context, createParams *cloudformation.CreateStackInput, createErr error) error {
+	stackName := aws.StringValue(createParams.StackName)
+
+	stack, err := a.getStackByName(stackName)
+	if err != nil {
 		return err
 	}
 
-	return nil
+	if aws.StringValue(stack.StackStatus) != cloudformation.StackStatusRollbackComplete {
+		return createErr
+	}
+
+	a.logger.Warnf("Creation of stack '%s' was rolled back, deleting and creating it again", stackName)
+	err = a.DeleteStack(ctx, stackName)
+	if err != nil {
+		return fmt.Errorf("failed to delete rolled back stack %s: %v", stackName, err)
+	}
+
+	_, err = a.cloudformationClient.CreateStackWithContext(ctx, createParams)
+	return err
 }
 
-func (a *awsAdapter) getStackByName(stackName string) (*cloudformation.Stack, error) {
-	params := &cloudformation.DescribeStacksInput{
-		StackName: aws.String(stackName),
+// applyChangeSet creates a change set and executes it once it's created. It
+// returns false without executing the change set if it doesn't contain any
+// changes.
+func (a *awsAdapter) applyChangeSet(ctx context.Context, input *cloudformation.CreateChangeSetInput) (bool, error) {
+	stackName := aws.StringValue(input.StackName)
+
+	resp, err := a.cloudformationClient.CreateChangeSetWithContext(ctx, input)
+	if err != nil {
+		return false, err
 	}
-	resp, err := a.cloudformationClient.DescribeStacks(params)
+
+	changeSet, err := a.waitForChangeSet(ctx, aws.StringValue(resp.Id))
 	if err != nil {
-		return nil, err
+		return false, err
+	}
+
+	if aws.StringValue(changeSet.Status) == cloudformation.ChangeSetStatusFailed {
+		// failed change sets aren't deleted automatically.
+		_, deleteErr := a.cloudformationClient.DeleteChangeSet(&cloudformation.DeleteChangeSetInput{ChangeSetName: resp.Id})
+		if deleteErr != nil {
+			a.logger.Warnf("Failed to delete change set %s of stack %s: %v", aws.StringValue(input.ChangeSetName), stackName, deleteErr)
+		}
+
+		reason := aws.StringValue(changeSet.StatusReason)
+		if len(changeSet.Changes) == 0 && (strings.Contains(reason, cloudformationNoChangesMsg) || strings.Contains(reason, cloudformationNoUpdateMsg)) {
+			a.logger.Infof("Stack %s has no changes, skipping update", stackName)
+			return false, nil
+		}
+		return false, fmt.Errorf("failed to create change set for stack %s: %s", stackName, reason)
+	}
+
+	for _, change := range changeSet.Changes {
+		if change.ResourceChange != nil {
+			a.logger.Infof("Stack %s: %s %s (%s)", stackName, aws.StringValue(change.ResourceChange.Action), aws.StringValue(change.ResourceChange.LogicalResourceId), aws.StringValue(change.ResourceChange.ResourceType))
+		}
 	}
-	//we expect only one stack
-	if len(resp.Stacks) != 1 {
-		return nil, fmt.Errorf("unexpected response, got %d, expected 1 stack", len(resp.Stacks))
+
+	_, err = a.cloudformationClient.ExecuteChangeSetWithContext(ctx, &cloudformation.ExecuteChangeSetInput{ChangeSetName: resp.Id})
+	if err != nil {
+		return false, err
 	}
-	return resp.Stacks[0], nil
+	return true, nil
+}
+
+// waitForChangeSet waits until the change set was created or failed to be
+// created.
+func (a *awsAdapter) waitForChangeSet(ctx context.Context, changeSetID string) (*cloudformation.DescribeChangeSetOutput, error) {
+	for {
+		changeSet, err := a.cloudformationClient.DescribeChangeSetWithContext(ctx, &cloudformation.DescribeChangeSetInput{ChangeSetName: aws.String(changeSetID)})
+		if err != nil {
+			return nil, err
+		}
+
+		switch aws.StringValue(changeSet.Status) {
+		case cloudformation.ChangeSetStatusCreateComplete, cloudformation.ChangeSetStatusFailed:
+			return changeSet, nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(changeSetPollInterval):
+		}
+	}
+}
+
+// stackTags returns the tags of the stacks applied by the adapter. The
+// update ID is left out, as a tag changing with every provisioning would
+// update every stack on every provisioning.
+func (a *awsAdapter) stackTags(templateHash string) map[string]string {
+	tags := make(map[string]string, len(a.costTags)+len(a.imageTags)+1)
+	for key, value := range a.costTags {
+		if key != updateIDTag {
+			tags[key] = value
+		}
+	}
+	for key, value := range a.imageTags {
+		tags[key] = value
+	}
+	if templateHash != "" {
+		tags[templateHashTag] = templateHash
+	}
+	return tags
+}
+
+func (a *awsAdapter) getStackByName(stackName string) (*cloudformation.Stack, error) {
+	return describeStack(a.cloudformationClient, stackName)
 }
 
-func (a *awsAdapter) waitForStack(ctx context.Context, waitTime time.Duration, stackName string) ([]*cloudformation.Output, error) {
+// waitForStack waits until the stack reached a final status. The status of
+// all stacks waited for by the adapter is polled by a shared poller which is
+// set up with the waitTime of the first wait.
+func (a *awsAdapter) waitForStack(ctx context.Context, waitTime time.Duration, stackName string) (outputs []*cloudformation.Output, err error) {
+	a.stackPollerOnce.Do(func() {
+		a.stackPoller = newStackPoller(a.cloudformationClient, waitTime)
+	})
+
+	ctx, span := tracing.Start(ctx, "stack.wait", tracing.String("stack.name", stackName))
+	start := time.Now()
+	defer func() {
+		observeDuration(stackWaitDuration, start, metricResult(err))
+		tracing.End(span, err)
+	}()
+
 	for {
-		stack, err := a.getStackByName(stackName)
+		stack, err := a.stackPoller.describe(ctx, stackName)
 		if err != nil {
 			return nil, err
 		}
@@ -477,25 +1199,19 @@ func (a *awsAdapter) waitForStack(ctx context.Context, waitTime time.Duration, s
 		case cloudformation.StackStatusDeleteComplete:
 			return stack.Outputs, nil
 		case cloudformation.StackStatusCreateFailed:
-			return nil, errCreateFailed
+			return nil, a.stackFailed(stackName, errCreateFailed)
 		case cloudformation.StackStatusDeleteFailed:
-			return nil, errDeleteFailed
+			return nil, a.stackFailed(stackName, errDeleteFailed)
 		case cloudformation.StackStatusRollbackComplete:
-			return nil, errRollbackComplete
+			return nil, a.stackFailed(stackName, errRollbackComplete)
 		case cloudformation.StackStatusRollbackFailed:
-			return nil, errRollbackFailed
+			return nil, a.stackFailed(stackName, errRollbackFailed)
 		case cloudformation.StackStatusUpdateRollbackComplete:
-			return nil, errUpdateRollbackComplete
+			return nil, a.stackFailed(stackName, errUpdateRollbackComplete)
 		case cloudformation.StackStatusUpdateRollbackFailed:
-			return nil, errUpdateRollbackFailed
+			return nil, a.stackFailed(stackName, errUpdateRollbackFailed)
 		}
 		a.logger.Debugf("Stack '%s' - [%s]", stackName, *stack.StackStatus)
-
-		select {
-		case <-ctx.Done():
-			return nil, errTimeoutExceeded
-		case <-time.After(waitTime):
-		}
 	}
 }
 
@@ -541,8 +1257,16 @@ func cloudformationHasTags(expected map[string]string, tags []*cloudformation.Ta
 
 }
 
-// DeleteStack deletes a cloudformation stack.
-func (a *awsAdapter) DeleteStack(stackName string) error {
+// DeleteStack deletes a cloudformation stack. If the deletion fails, the
+// dependencies blocking the deletion of the stack resources are removed and
+// the deletion is retried once. If it still fails, the deletion is retried
+// a last time retaining the resources which couldn't be deleted, such that
+// the stack doesn't stay in DELETE_FAILED.
+func (a *awsAdapter) DeleteStack(ctx context.Context, stackName string) error {
+	if a.skipReadOnly("deleting stack %s", stackName) {
+		return nil
+	}
+
 	a.logger.Infof("Deleting stack '%s'", stackName)
 
 	// disable termination protection on stack before deleting
@@ -559,11 +1283,40 @@ func (a *awsAdapter) DeleteStack(stackName string) error {
 		return err
 	}
 
+	err = a.deleteStackAndWait(ctx, stackName, nil)
+	if !isDeleteFailedErr(err) {
+		return err
+	}
+
+	// the deletion commonly fails because of network interfaces or
+	// security group rules created outside of the stack, which are removed
+	// before the deletion is retried once.
+	removed, removeErr := a.removeDeletionBlockers(stackName)
+	if removeErr != nil {
+		a.logger.Warnf("Failed to remove the dependencies blocking the deletion of stack '%s': %v", stackName, removeErr)
+	} else if removed > 0 {
+		a.logger.Infof("Removed %d dependencies blocking the deletion of stack '%s', retrying", removed, stackName)
+		err = a.deleteStackAndWait(ctx, stackName, nil)
+		if !isDeleteFailedErr(err) {
+			return err
+		}
+	}
+
+	return a.deleteStackRetainingFailed(ctx, stackName, err)
+}
+
+// deleteStackAndWait deletes a cloudformation stack and waits for the deletion
+// to finish. The retained resources are left behind, which is only allowed
+// for stacks in DELETE_FAILED.
+func (a *awsAdapter) deleteStackAndWait(ctx context.Context, stackName string, retainResources []string) error {
 	deleteParams := &cloudformation.DeleteStackInput{
 		StackName: aws.String(stackName),
 	}
+	if len(retainResources) > 0 {
+		deleteParams.RetainResources = aws.StringSlice(retainResources)
+	}
 
-	_, err = a.cloudformationClient.DeleteStack(deleteParams)
+	_, err := a.cloudformationClient.DeleteStack(deleteParams)
 	if err != nil {
 		if isDoesNotExistsErr(err) {
 			return nil
@@ -571,9 +1324,9 @@ func (a *awsAdapter) DeleteStack(stackName string) error {
 		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), maxWaitTimeout)
+	waitCtx, cancel := context.WithTimeout(ctx, maxWaitTimeout)
 	defer cancel()
-	_, err = a.waitForStack(ctx, waitTime, stackName)
+	_, err = a.waitForStack(waitCtx, waitTime, stackName)
 	if err != nil {
 		if isDoesNotExistsErr(err) {
 			return nil
@@ -584,7 +1337,7 @@ func (a *awsAdapter) DeleteStack(stackName string) error {
 }
 
 // CreateOrUpdateEtcdStack creates or updates an etcd stack.
-func (a *awsAdapter) CreateOrUpdateEtcdStack(stackName string, stackDefinitionPath string, cluster *api.Cluster) error {
+func (a *awsAdapter) CreateOrUpdateEtcdStack(ctx context.Context, stackName string, stackDefinitionPath string, cluster *api.Cluster) error {
 	bucketName := fmt.Sprintf("zalando-kubernetes-etcd-%s-%s", getAWSAccountID(cluster.InfrastructureAccount), cluster.Region)
 
 	if bucket, ok := cluster.ConfigItems[etcdS3BackupBucketKey]; ok {
@@ -632,14 +1385,19 @@ func (a *awsAdapter) CreateOrUpdateEtcdStack(stackName string, stackDefinitionPa
 		return err
 	}
 
-	err = a.applyStack(stackName, string(output), "", false)
+	template, err := a.policies.check(hookPhaseEtcdStackTemplate, cluster, "", string(output))
+	if err != nil {
+		return err
+	}
+
+	_, err = a.applyStack(ctx, stackName, template, "", "", false)
 	if err != nil {
 		return err
 	}
 
-	ctx, cancel := context.WithTimeout(context.Background(), maxWaitTimeout)
+	waitCtx, cancel := context.WithTimeout(ctx, maxWaitTimeout)
 	defer cancel()
-	_, err = a.waitForStack(ctx, waitTime, stackName)
+	_, err = a.waitForStack(waitCtx, waitTime, stackName)
 	if err != nil {
 		return err
 	}
@@ -647,8 +1405,14 @@ func (a *awsAdapter) CreateOrUpdateEtcdStack(stackName string, stackDefinitionPa
 	return nil
 }
 
-// createS3Bucket creates an s3 bucket if it doesn't exist.
+// createS3Bucket creates an s3 bucket if it doesn't exist and ensures that
+// objects in the bucket are encrypted with SSE-KMS by default and that public
+// access to the bucket is blocked.
 func (a *awsAdapter) createS3Bucket(bucket string) error {
+	if a.skipReadOnly("creating S3 bucket %s", bucket) {
+		return nil
+	}
+
 	params := &s3.CreateBucketInput{
 		Bucket: aws.String(bucket),
 		CreateBucketConfiguration: &s3.CreateBucketConfiguration{
@@ -663,13 +1427,87 @@ func (a *awsAdapter) createS3Bucket(bucket string) error {
 			// if the bucket already exists and is owned by us, we
 			// don't treat it as an error.
 			case s3.ErrCodeBucketAlreadyOwnedByYou:
-				return nil
+				err = nil
 			}
 		}
+		if err != nil {
+			return err
+		}
+	}
+
+	encryptionParams := &s3.PutBucketEncryptionInput{
+		Bucket: aws.String(bucket),
+		ServerSideEncryptionConfiguration: &s3.ServerSideEncryptionConfiguration{
+			Rules: []*s3.ServerSideEncryptionRule{
+				{
+					ApplyServerSideEncryptionByDefault: &s3.ServerSideEncryptionByDefault{
+						SSEAlgorithm: aws.String(s3.ServerSideEncryptionAwsKms),
+					},
+				},
+			},
+		},
+	}
+
+	_, err = a.s3Client.PutBucketEncryption(encryptionParams)
+	if err != nil {
+		return err
 	}
+
+	_, err = a.publicAccessBlockClient.PutPublicAccessBlock(&putPublicAccessBlockInput{
+		Bucket: aws.String(bucket),
+		PublicAccessBlockConfiguration: &publicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	})
 	return err
 }
 
+// launchTemplateArgs returns the stack parameters for node pools using
+// Launch Templates instead of Launch Configurations. The template names are
+// derived from the stack and node pool names such that they are stable
+// across stack versions.
+func launchTemplateArgs(stackName string, masterPool, workerPool *api.NodePool) []string {
+	return []string{
+		"LaunchTemplate=true",
+		fmt.Sprintf("MasterLaunchTemplateName=%s", launchTemplateName(stackName, masterPool)),
+		fmt.Sprintf("WorkerLaunchTemplateName=%s", launchTemplateName(stackName, workerPool)),
+	}
+}
+
+// launchTemplateName returns the name of the launch template of a node pool.
+func launchTemplateName(stackName string, nodePool *api.NodePool) string {
+	return fmt.Sprintf("%s-%s", stackName, nodePool.Name)
+}
+
+// imdsArgs returns the stack parameters making the instance metadata service
+// of a node pool token-only (IMDSv2). The parameters are prefixed with the
+// given prefix e.g. 'Master' or 'Worker'. No parameters are returned if the
+// node pool doesn't require IMDSv2.
+func imdsArgs(prefix string, nodePool *api.NodePool) ([]string, error) {
+	if !nodePool.RequireIMDSv2 {
+		return nil, nil
+	}
+
+	// the default allows containers, which are one hop further away
+	// than the node, to reach the metadata service.
+	hopLimit := nodePool.IMDSHopLimit
+	if hopLimit == 0 {
+		hopLimit = defaultIMDSHopLimit
+	}
+
+	if hopLimit < 1 || hopLimit > maxIMDSHopLimit {
+		return nil, fmt.Errorf("invalid imds_hop_limit %d for node pool %s, must be between 1 and %d", nodePool.IMDSHopLimit, nodePool.Name, maxIMDSHopLimit)
+	}
+
+	return []string{
+		fmt.Sprintf("%sMetadataHttpTokens=required", prefix),
+		fmt.Sprintf("%sMetadataHttpPutResponseHopLimit=%d", prefix, hopLimit),
+	}, nil
+}
+
 // userDataConfig generates userData config map.
 func userDataConfig(stackName, stackVersion, kubeletSecret string, cluster *api.Cluster) (map[string]string, error) {
 	webhookID, err := parseWebhookID(cluster.ID)
@@ -698,6 +1536,12 @@ func userDataConfig(stackName, stackVersion, kubeletSecret string, cluster *api.
 		"APISERVER_STORAGE_MEDIA_TYPE": "application/json",
 	}
 
+	// invalid registry mirrors would break the userdata of every node pool.
+	_, err = parseRegistryMirrors(cluster.ConfigItems[registryMirrorsConfigItemKey])
+	if err != nil {
+		return nil, err
+	}
+
 	// add config_items to config map.
 	// Default config values can be overwritten by providing a config item
 	// with an identical key (lowercased).
@@ -708,20 +1552,100 @@ func userDataConfig(stackName, stackVersion, kubeletSecret string, cluster *api.
 	return config, nil
 }
 
+// nodePoolUserDataConfig returns a copy of the userData config map extended
+// with the labels, taints and kubelet config of the node pool and values
+// derived from its instance type. The max pods of the nodes are computed from
+// the ENI limits of the instance type unless the kubelet config sets them. For
+// GPU instances the GPU count and type are added and the nodes are labeled and
+// tainted for the GPU device plugin, such that GPU pools don't need
+// dedicated userdata.
+func nodePoolUserDataConfig(config map[string]string, nodePool *api.NodePool) map[string]string {
+	poolConfig := make(map[string]string, len(config))
+	for key, value := range config {
+		poolConfig[key] = value
+	}
+
+	poolConfig["NODE_POOL"] = nodePool.Name
+	poolConfig["INSTANCE_TYPE"] = nodePool.InstanceType
+	poolConfig["ARCHITECTURE"] = nodePoolArchitecture(nodePool)
+	poolConfig["OS"] = nodePoolOS(nodePool)
+	storageUserDataConfig(poolConfig, nodePool)
+	poolConfig[kubeletConfigValue] = kubeletConfigDropIn(nodePool.KubeletConfig)
+	if maxPods := nodePoolMaxPods(nodePool, prefixDelegation(config)); maxPods > 0 {
+		poolConfig[maxPodsValue] = strconv.FormatInt(maxPods, 10)
+	}
+	poolConfig[cloudWatchAgentConfigValue] = cloudWatchAgentConfig(nodePool)
+	if len(nodePool.Labels) > 0 {
+		poolConfig["NODE_LABELS"] = appendList(poolConfig["NODE_LABELS"], nodePoolLabels(nodePool)...)
+	}
+	if len(nodePool.Taints) > 0 {
+		poolConfig["NODE_TAINTS"] = appendList(poolConfig["NODE_TAINTS"], nodePoolTaints(nodePool)...)
+	}
+
+	instanceInfo, ok := awsExt.InstanceInfo()[nodePool.InstanceType]
+	if !ok || instanceInfo.GPU == 0 {
+		return poolConfig
+	}
+
+	poolConfig["GPU_COUNT"] = strconv.FormatInt(instanceInfo.GPU, 10)
+	poolConfig["GPU_TYPE"] = instanceInfo.GPUType
+
+	labels := []string{fmt.Sprintf("%s=%d", gpuCountLabel, instanceInfo.GPU)}
+	if instanceInfo.GPUType != "" {
+		labels = append(labels, fmt.Sprintf("%s=%s", gpuTypeLabel, instanceInfo.GPUType))
+	}
+	poolConfig["NODE_LABELS"] = appendList(poolConfig["NODE_LABELS"], labels...)
+	poolConfig["NODE_TAINTS"] = appendList(poolConfig["NODE_TAINTS"], gpuTaint)
+
+	return poolConfig
+}
+
+// nodePoolArchitecture returns the CPU architecture of a node pool.
+func nodePoolArchitecture(nodePool *api.NodePool) string {
+	if nodePool.Architecture == "" {
+		return defaultArchitecture
+	}
+	return nodePool.Architecture
+}
+
+// validateArchitecture returns an error if the architecture of the node pool
+// isn't supported by its instance type. Instance types without instance
+// info are not validated.
+func validateArchitecture(nodePool *api.NodePool) error {
+	instanceInfo, ok := awsExt.InstanceInfo()[nodePool.InstanceType]
+	if !ok {
+		return nil
+	}
+
+	arch := nodePoolArchitecture(nodePool)
+	for _, supported := range instanceInfo.Architectures {
+		if supported == arch {
+			return nil
+		}
+	}
+
+	return fmt.Errorf("instance type %s of node pool %s doesn't support architecture %s, supported: %s", nodePool.InstanceType, nodePool.Name, arch, strings.Join(instanceInfo.Architectures, ", "))
+}
+
+// appendList appends values to a comma separated list.
+func appendList(list string, values ...string) string {
+	if list == "" {
+		return strings.Join(values, ",")
+	}
+	return strings.Join(append([]string{list}, values...), ",")
+}
+
 // getUserData reads userdata and encodes it.
-func getUserData(basePath string, config map[string]string) (string, string, error) {
+func getUserData(basePath string, masterPool, workerPool *api.NodePool, masterConfig, workerConfig map[string]string, typed Values) (string, string, error) {
 	userDataMasterPath := path.Join(basePath, "userdata-master.yaml")
 	userDataWorkerPath := path.Join(basePath, "userdata-worker.yaml")
 
-	// fail if variables are missing
-	mustache.AllowMissingVariables = false
-
-	m, err := mustache.RenderFile(userDataMasterPath, config)
+	m, err := renderProfileUserData(userDataMasterPath, masterPool.Profile, masterConfig, typed)
 	if err != nil {
 		return "", "", err
 	}
 
-	w, err := mustache.RenderFile(userDataWorkerPath, config)
+	w, err := renderProfileUserData(userDataWorkerPath, workerPool.Profile, workerConfig, typed)
 	if err != nil {
 		return "", "", err
 	}
@@ -739,93 +1663,273 @@ func getUserData(basePath string, config map[string]string) (string, string, err
 	return master, worker, nil
 }
 
-// getUserDataCLC reads userdata from clc files and uploads the userdata to S3.
-func (a *awsAdapter) getUserDataCLC(basePath string, config map[string]string, bucketName string) (string, string, error) {
-	userDataMasterPath := path.Join(basePath, "master.clc.yaml")
-	userDataWorkerPath := path.Join(basePath, "worker.clc.yaml")
+// getUserDataCLC reads userdata from clc files, or the Butane configs of the
+// node pool profiles, and uploads the userdata to S3. The userdata of Windows
+// node pools is read from their PowerShell scripts instead.
+func (a *awsAdapter) getUserDataCLC(ctx context.Context, basePath string, cluster *api.Cluster, masterPool, workerPool *api.NodePool, masterConfig, workerConfig map[string]string, bucket *userDataBucket, kmsKey string, masterObject, workerObject *userDataObject, compress func([]byte) ([]byte, error)) (string, string, error) {
+	userDataMasterPath, err := nodePoolUserDataFile(basePath, "master", masterPool)
+	if err != nil {
+		return "", "", err
+	}
+
+	userDataWorkerPath, err := nodePoolUserDataFile(basePath, "worker", workerPool)
+	if err != nil {
+		return "", "", err
+	}
+
+	masterPointerPath, err := ignitionPointerPath(basePath, masterPool.Profile, bucket.source)
+	if err != nil {
+		return "", "", err
+	}
+
+	workerPointerPath, err := ignitionPointerPath(basePath, workerPool.Profile, bucket.source)
+	if err != nil {
+		return "", "", err
+	}
 
-	master, err := a.prepareUserData(userDataMasterPath, config, bucketName)
+	api.ReportProgress(ctx, api.ProgressStepRendering, masterPool.Name, fmt.Sprintf("Rendering userdata of node pool %s", masterPool.Name))
+	master, err := a.prepareUserData(ctx, cluster, masterPool, userDataMasterPath, masterPointerPath, masterConfig, bucket, kmsKey, masterObject, compress)
 	if err != nil {
 		return "", "", err
 	}
 
-	worker, err := a.prepareUserData(userDataWorkerPath, config, bucketName)
+	api.ReportProgress(ctx, api.ProgressStepRendering, workerPool.Name, fmt.Sprintf("Rendering userdata of node pool %s", workerPool.Name))
+	worker, err := a.prepareUserData(ctx, cluster, workerPool, userDataWorkerPath, workerPointerPath, workerConfig, bucket, kmsKey, workerObject, compress)
 	if err != nil {
 		return "", "", err
 	}
 
+	a.templateHashes = map[string]string{
+		masterPool.Name: templateHash(master),
+		workerPool.Name: templateHash(worker),
+	}
+
 	return master, worker, nil
 }
 
-// prepareUserData prepares the user data by rendering the mustache template
-// and uploading the User Data to S3. A EC2 UserData ready base64 string will
-// be returned.
-func (a *awsAdapter) prepareUserData(clcPath string, config map[string]string, bucketName string) (string, error) {
+// prepareUserData prepares the user data by rendering the mustache template,
+// converting it to ignition and uploading the User Data to S3. A EC2 UserData
+// ready base64 string will be returned.
+// If the ignition config fits into the EC2 UserData it is embedded directly
+// instead of being uploaded to S3, unless a KMS key for encrypting the
+// userdata is configured. The embedded user data is compressed with compress.
+// The ignition pointer config pulling the uploaded config from the userdata
+// source of the bucket is extended with the settings in pointerPath if it
+// exists and uses the same ignition spec as the uploaded config. The rendered
+// template is passed through the provisioner hooks and policies before it's
+// converted.
+// PowerShell scripts of Windows node pools are embedded as they are, because
+// EC2Launch neither supports ignition nor compressed userdata.
+func (a *awsAdapter) prepareUserData(ctx context.Context, cluster *api.Cluster, nodePool *api.NodePool, userDataPath, pointerPath string, config map[string]string, bucket *userDataBucket, kmsKey string, object *userDataObject, compress func([]byte) ([]byte, error)) (string, error) {
+	var profile string
+	if nodePool != nil {
+		profile = nodePool.Profile
+	}
+
+	rendered, err := renderProfileUserData(userDataPath, profile, config, cluster.ConfigValues)
+	if err != nil {
+		templateRenderErrors.WithLabelValues(templateKindUserData).Inc()
+		return "", err
+	}
+
+	if len(a.hooks) > 0 {
+		rendered, err = a.hooks.mutate(ctx, hookPhaseUserData, cluster, nodePool.Name, rendered)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if len(a.policies) > 0 {
+		rendered, err = a.policies.check(hookPhaseUserData, cluster, nodePool.Name, rendered)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	if isPowerShellUserData(userDataPath) {
+		return base64.StdEncoding.EncodeToString([]byte(ec2LaunchUserData(rendered))), nil
+	}
+
+	// convert to ignition
+	ignCfg, err := convertUserData(userDataPath, []byte(rendered), platform.EC2)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse config %s: %v", userDataPath, err)
+	}
+
+	compressed, err := compress(ignCfg)
+	if err != nil {
+		return "", err
+	}
+
+	if kmsKey == "" && len(compressed) <= maxEmbeddedUserDataSize {
+		return base64.StdEncoding.EncodeToString(compressed), nil
+	}
+
+	// upload to s3
+	uri, err := a.uploadUserDataToS3(ctx, ignCfg, bucket, kmsKey, object)
+	if err != nil {
+		return "", err
+	}
+
+	// nodes without access to S3 pull the userdata via HTTPS.
+	if bucket.source != nil {
+		uri, err = a.userDataSourceURL(bucket, strings.TrimPrefix(uri, fmt.Sprintf("s3://%s/", bucket.name)))
+		if err != nil {
+			return "", err
+		}
+	}
+
+	specVersion, err := ignitionSpecVersion(ignCfg)
+	if err != nil {
+		return "", err
+	}
+
+	// create ignition config pulling from the userdata source
+	pointerConfig, err := ignitionPointerConfig(pointerPath, config, cluster.ConfigValues, uri, specVersion)
+	if err != nil {
+		return "", err
+	}
+
+	compressed, err = compress(pointerConfig)
+	if err != nil {
+		return "", err
+	}
+
+	return base64.StdEncoding.EncodeToString(compressed), nil
+}
+
+// renderUserData renders a mustache userdata template with the config, its
+// typed values and its escaped values. Partials are resolved relative to the
+// directory of the template and must not be outside of it.
+func renderUserData(file string, config map[string]string, typed Values) (string, error) {
+	return renderProfileUserData(file, "", config, typed)
+}
+
+// renderProfileUserData renders a mustache userdata template like
+// renderUserData for a node pool profile. Partials are resolved in the
+// directories of the profile and its base profiles before the directory of
+// the template. The fragments in the userdata.d directories of the profile
+// are merged into rendered Container Linux Configs.
+func renderProfileUserData(file, profile string, config map[string]string, typed Values) (string, error) {
 	// fail if variables are missing
 	mustache.AllowMissingVariables = false
 
-	rendered, err := mustache.RenderFile(clcPath, config)
+	dirs, err := profileDirs(path.Dir(file), profile)
 	if err != nil {
 		return "", err
 	}
 
-	// convert to ignition
-	ignCfg, err := clcToIgnition([]byte(rendered))
+	partials := &profilePartialProvider{dirs: dirs, baseDir: path.Dir(file)}
+	tmpl, err := mustache.ParseFilePartials(file, partials)
 	if err != nil {
-		return "", fmt.Errorf("failed to parse config %s: %v", clcPath, err)
+		return "", err
 	}
 
-	// upload to s3
-	uri, err := a.uploadUserDataToS3(ignCfg, bucketName)
+	values := userDataValues(config, typed)
+
+	rendered, err := tmpl.Render(values)
 	if err != nil {
 		return "", err
 	}
 
-	// create ignition config pulling from s3
-	ignCfg = []byte(fmt.Sprintf(ignitionBaseTemplate, uri))
+	butane := path.Base(file) == butaneUserDataFile
+	if !strings.HasSuffix(file, clcFileSuffix) && !butane {
+		return rendered, nil
+	}
+
+	if !butane {
+		rendered, err = mergeUserDataFragments(rendered, dirs, partials, values)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	files, err := registryMirrorFiles(config[registryMirrorsValue])
+	if err != nil {
+		return "", err
+	}
+	if kubeletConfig := config[kubeletConfigValue]; kubeletConfig != "" {
+		files = append(files, &generatedFile{Path: kubeletConfigDropInFile, Contents: kubeletConfig})
+	}
+	if agentConfig := config[cloudWatchAgentConfigValue]; agentConfig != "" {
+		files = append(files, &generatedFile{Path: cloudWatchAgentConfigFile, Contents: agentConfig})
+	}
 
-	return base64.StdEncoding.EncodeToString(ignCfg), nil
+	return addGeneratedFiles(rendered, butane, files)
 }
 
 // uploadUserDataToS3 uploads the provided userData to the specified S3 bucket.
-// The S3 object will be named by the sha512 hash of the data.
-func (a *awsAdapter) uploadUserDataToS3(userData []byte, bucketName string) (string, error) {
+// The S3 object will be named by the sha512 hash of the data, prefixed and
+// annotated with the metadata described by object, and is encrypted with
+// SSE-KMS using kmsKey. If kmsKey is empty the default AWS managed key is
+// used. Objects uploaded to external buckets are owned by the bucket owner.
+// If the bucket is replicated, the upload only finishes once the object was
+// replicated.
+func (a *awsAdapter) uploadUserDataToS3(ctx context.Context, userData []byte, bucket *userDataBucket, kmsKey string, object *userDataObject) (string, error) {
 	// create S3 bucket if it doesn't exist
-	err := a.createS3Bucket(bucketName)
-	if err != nil {
-		return "", err
+	if !bucket.external {
+		err := a.createS3Bucket(bucket.name)
+		if err != nil {
+			return "", err
+		}
 	}
 
 	// sha1 hash the userData to use as object name
 	hasher := sha512.New()
-	_, err = hasher.Write(userData)
+	_, err := hasher.Write(userData)
 	if err != nil {
 		return "", err
 	}
 	sha := hex.EncodeToString(hasher.Sum(nil))
 
-	objectName := fmt.Sprintf("%s.userdata", sha)
+	objectName := object.key(sha)
+	if a.skipReadOnly("uploading userdata to s3://%s/%s", bucket.name, objectName) {
+		return fmt.Sprintf("s3://%s/%s", bucket.name, objectName), nil
+	}
 
-	// Upload the stack template to S3
-	_, err = a.s3Uploader.Upload(&s3manager.UploadInput{
-		Bucket: aws.String(bucketName),
-		Key:    aws.String(objectName),
-		Body:   bytes.NewReader(userData),
-	})
+	input := &s3manager.UploadInput{
+		Bucket:               aws.String(bucket.name),
+		Key:                  aws.String(objectName),
+		Body:                 bytes.NewReader(userData),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+		Tagging:              s3Tagging(a.costTags),
+	}
+
+	if object != nil {
+		input.Metadata = object.metadata
+	}
+
+	if kmsKey != "" {
+		input.SSEKMSKeyId = aws.String(kmsKey)
+	}
+
+	if bucket.external {
+		input.ACL = aws.String(s3.ObjectCannedACLBucketOwnerFullControl)
+	}
+
+	// Upload the userdata to S3
+	result, err := a.s3Uploader.UploadWithContext(ctx, input, a.userDataUploadOptions(bucket)...)
+	if err != nil {
+		return "", err
+	}
+
+	err = a.waitForUserDataReplication(ctx, bucket, objectName, aws.StringValue(result.VersionID))
 	if err != nil {
 		return "", err
 	}
 
-	return fmt.Sprintf("s3://%s/%s", bucketName, objectName), nil
+	return fmt.Sprintf("s3://%s/%s", bucket.name, objectName), nil
 }
 
-func clcToIgnition(data []byte) ([]byte, error) {
+// clcToIgnition converts a Container Linux Config to an ignition config for
+// the specified platform.
+func clcToIgnition(data []byte, platformID string) ([]byte, error) {
 	cfg, ast, report := config.Parse(data)
 	if len(report.Entries) > 0 {
 		return nil, fmt.Errorf(report.String())
 	}
 
-	ignCfg, report := config.Convert(cfg, platform.EC2, ast)
+	ignCfg, report := config.Convert(cfg, platformID, ast)
 	if len(report.Entries) > 0 {
 		return nil, fmt.Errorf("failed to convert to ignition: %s", report.String())
 	}
@@ -897,6 +2001,17 @@ func (a *awsAdapter) getNodePoolASG(stackName, nodePool string) (*autoscaling.Gr
 	return asg, nil
 }
 
+// getRenamedNodePoolASG returns the ASG of the node pool. The ASG of a
+// renamed node pool is still tagged with its previous name until the stack
+// is updated.
+func (a *awsAdapter) getRenamedNodePoolASG(stackName string, nodePool *api.NodePool) (*autoscaling.Group, error) {
+	asg, err := a.getNodePoolASG(stackName, nodePool.Name)
+	if err != nil && nodePool.PreviousName != "" {
+		return a.getNodePoolASG(stackName, nodePool.PreviousName)
+	}
+	return asg, err
+}
+
 // describeASG gets a single ASG by name.
 func (a *awsAdapter) describeASG(asgName string) (*autoscaling.Group, error) {
 	params := &autoscaling.DescribeAutoScalingGroupsInput{
@@ -916,8 +2031,53 @@ func (a *awsAdapter) describeASG(asgName string) (*autoscaling.Group, error) {
 	return resp.AutoScalingGroups[0], nil
 }
 
+// desiredCapacity returns the desired capacity of an ASG. If the ASG was
+// scaled to zero by the update strategy, the desired capacity from before the
+// scale down is returned.
+func desiredCapacity(asg *autoscaling.Group) int64 {
+	desired := aws.Int64Value(asg.DesiredCapacity)
+	if desired > 0 {
+		return desired
+	}
+
+	for _, tag := range asg.Tags {
+		if aws.StringValue(tag.Key) == updatestrategy.PreScaleDesiredCapacityTag {
+			value, err := strconv.ParseInt(aws.StringValue(tag.Value), 10, 64)
+			if err == nil {
+				return value
+			}
+		}
+	}
+
+	return desired
+}
+
+// deleteASGTag deletes a tag from an ASG.
+func (a *awsAdapter) deleteASGTag(asgName, key string) error {
+	if a.skipReadOnly("deleting tag %s of ASG %s", key, asgName) {
+		return nil
+	}
+
+	params := &autoscaling.DeleteTagsInput{
+		Tags: []*autoscaling.Tag{
+			{
+				Key:          aws.String(key),
+				ResourceId:   aws.String(asgName),
+				ResourceType: aws.String("auto-scaling-group"),
+			},
+		},
+	}
+
+	_, err := a.autoscalingClient.DeleteTags(params)
+	return err
+}
+
 // suspendScaling suspends the scaling processes of an ASG.
 func (a *awsAdapter) suspendScaling(asgName string) error {
+	if a.skipReadOnly("suspending scaling for %s", asgName) {
+		return nil
+	}
+
 	a.logger.Debug("Suspending scaling for ", asgName)
 	params := &autoscaling.ScalingProcessQuery{
 		AutoScalingGroupName: aws.String(asgName),
@@ -934,6 +2094,10 @@ func (a *awsAdapter) suspendScaling(asgName string) error {
 
 // resumeScaling resumes the scaling processes of an ASG.
 func (a *awsAdapter) resumeScaling(asgName string) error {
+	if a.skipReadOnly("resuming scaling for %s", asgName) {
+		return nil
+	}
+
 	a.logger.Debug("Resuming scaling for ", asgName)
 	params := &autoscaling.ScalingProcessQuery{
 		AutoScalingGroupName: aws.String(asgName),
@@ -985,6 +2149,48 @@ func (a *awsAdapter) GetVolumes(tags map[string]string) ([]*ec2.Volume, error) {
 	return result.Volumes, nil
 }
 
+// GetStoppedInstances gets all stopped or stopping instances matching the
+// tags.
+func (a *awsAdapter) GetStoppedInstances(tags map[string]string) ([]*ec2.Instance, error) {
+	filters := []*ec2.Filter{
+		{
+			Name:   aws.String("instance-state-name"),
+			Values: aws.StringSlice([]string{ec2.InstanceStateNameStopping, ec2.InstanceStateNameStopped}),
+		},
+	}
+
+	for tagKey, tagValue := range tags {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String(fmt.Sprintf("tag:%s", tagKey)),
+			Values: []*string{aws.String(tagValue)},
+		})
+	}
+
+	var instances []*ec2.Instance
+	err := a.ec2Client.DescribeInstancesPages(&ec2.DescribeInstancesInput{Filters: filters}, func(resp *ec2.DescribeInstancesOutput, lastPage bool) bool {
+		for _, reservation := range resp.Reservations {
+			instances = append(instances, reservation.Instances...)
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+	return instances, nil
+}
+
+// TerminateInstances terminates the instances.
+func (a *awsAdapter) TerminateInstances(instanceIDs []string) error {
+	if len(instanceIDs) == 0 {
+		return nil
+	}
+
+	_, err := a.ec2Client.TerminateInstances(&ec2.TerminateInstancesInput{
+		InstanceIds: aws.StringSlice(instanceIDs),
+	})
+	return err
+}
+
 func (a *awsAdapter) DeleteVolume(id string) error {
 	_, err := a.ec2Client.DeleteVolume(&ec2.DeleteVolumeInput{
 		VolumeId: aws.String(id),
@@ -992,8 +2198,17 @@ func (a *awsAdapter) DeleteVolume(id string) error {
 	return err
 }
 
-// GetSubnets gets all subnets of the default VPC in the target account.
+// GetSubnets gets all subnets of the default VPC in the target account, or
+// the subnets of the existing network of the cluster.
 func (a *awsAdapter) GetSubnets() ([]*ec2.Subnet, error) {
+	if a.networkTags != nil {
+		network, err := a.discoverNetwork()
+		if err != nil {
+			return nil, err
+		}
+		return network.Subnets, nil
+	}
+
 	// find default VPC
 	vpcResp, err := a.ec2Client.DescribeVpcs(&ec2.DescribeVpcsInput{})
 	if err != nil {
@@ -1031,6 +2246,10 @@ func (a *awsAdapter) GetSubnets() ([]*ec2.Subnet, error) {
 
 // CreateTags adds or updates tags of a resource.
 func (a *awsAdapter) CreateTags(resource string, tags []*ec2.Tag) error {
+	if a.skipReadOnly("tagging %s", resource) {
+		return nil
+	}
+
 	params := &ec2.CreateTagsInput{
 		Resources: []*string{aws.String(resource)},
 		Tags:      tags,
@@ -1042,6 +2261,10 @@ func (a *awsAdapter) CreateTags(resource string, tags []*ec2.Tag) error {
 
 // DeleteTags deletes tags from a resource.
 func (a *awsAdapter) DeleteTags(resource string, tags []*ec2.Tag) error {
+	if a.skipReadOnly("deleting tags of %s", resource) {
+		return nil
+	}
+
 	params := &ec2.DeleteTagsInput{
 		Resources: []*string{aws.String(resource)},
 		Tags:      tags,
@@ -1051,6 +2274,15 @@ func (a *awsAdapter) DeleteTags(resource string, tags []*ec2.Tag) error {
 	return err
 }
 
+// isAlreadyExistsErr returns true if the error is of type awserr.Error and
+// describes a failure because the stack to create already exists.
+func isAlreadyExistsErr(err error) bool {
+	if awsErr, ok := err.(awserr.Error); ok {
+		return awsErr.Code() == cloudformation.ErrCodeAlreadyExistsException
+	}
+	return false
+}
+
 func isDoesNotExistsErr(err error) bool {
 	if awsErr, ok := err.(awserr.Error); ok {
 		if awsErr.Code() == "ValidationError" && strings.Contains(awsErr.Message(), "does not exist") {
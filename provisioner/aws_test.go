@@ -2,8 +2,13 @@ package provisioner
 
 import (
 	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
 	"strings"
 	"sync"
 	"testing"
@@ -11,47 +16,138 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/cloudformation"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/aws/aws-sdk-go/service/s3/s3manager"
 	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
 
 	log "github.com/sirupsen/logrus"
 )
 
-type s3APIStub struct{}
+type s3APIStub struct {
+	encryptionInput *s3.PutBucketEncryptionInput
+}
 
 func (s *s3APIStub) CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
 	return nil, nil
 }
 
+func (s *s3APIStub) PutBucketEncryption(input *s3.PutBucketEncryptionInput) (*s3.PutBucketEncryptionOutput, error) {
+	s.encryptionInput = input
+	return nil, nil
+}
+
+func (s *s3APIStub) GetBucketPolicy(input *s3.GetBucketPolicyInput) (*s3.GetBucketPolicyOutput, error) {
+	return nil, awserr.New(errCodeNoSuchBucketPolicy, "no policy", nil)
+}
+
+func (s *s3APIStub) PutBucketPolicy(input *s3.PutBucketPolicyInput) (*s3.PutBucketPolicyOutput, error) {
+	return nil, nil
+}
+
+func (s *s3APIStub) HeadBucket(input *s3.HeadBucketInput) (*s3.HeadBucketOutput, error) {
+	return nil, nil
+}
+
+func (s *s3APIStub) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	return &s3.HeadObjectOutput{}, nil
+}
+
+func (s *s3APIStub) PutBucketVersioning(input *s3.PutBucketVersioningInput) (*s3.PutBucketVersioningOutput, error) {
+	return nil, nil
+}
+
+func (s *s3APIStub) PutBucketReplication(input *s3.PutBucketReplicationInput) (*s3.PutBucketReplicationOutput, error) {
+	return nil, nil
+}
+
+func (s *s3APIStub) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	fn(&s3.ListObjectsV2Output{}, true)
+	return nil
+}
+
+func (s *s3APIStub) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	return &s3.DeleteObjectOutput{}, nil
+}
+
+func (s *s3APIStub) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	return nil, awserr.New(s3.ErrCodeNoSuchKey, "key doesn't exist", nil)
+}
+
+func (s *s3APIStub) GetObjectRequest(input *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput) {
+	return s3.New(session.Must(session.NewSession(aws.NewConfig().WithRegion("eu-central-1")))).GetObjectRequest(input)
+}
+
+func (s *s3APIStub) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	return &s3.PutObjectOutput{}, nil
+}
+
 type cloudFormationAPIStub struct {
 	statusMutex         *sync.Mutex
 	status              *string
 	onDescribeStackChan chan struct{}
 	createErr           error
-	updateErr           error
+	changeSetErr        error
+	changeSetStatus     string
+	changeSetReason     string
+	changeSetChanges    []*cloudformation.Change
+	executed            bool
 	deleteErr           error
+	templateBody        string
+	stackResources      []*cloudformation.StackResource
+	validateErr         error
+	templateParameters  []*cloudformation.TemplateParameter
+	stackEvents         []*cloudformation.StackEvent
+	stackEventsPageSize int
+	stackTags           []*cloudformation.Tag
+	stackLastUpdated    *time.Time
 }
 
 func (c *cloudFormationAPIStub) DescribeStacks(input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
 	name := "foobar"
-	s := cloudformation.Stack{StackName: aws.String(name), StackStatus: c.getStatus()}
+	s := cloudformation.Stack{StackName: aws.String(name), StackStatus: c.getStatus(), Tags: c.stackTags, LastUpdatedTime: c.stackLastUpdated}
 	if c.onDescribeStackChan != nil {
 		c.onDescribeStackChan <- struct{}{}
 	}
 	return &cloudformation.DescribeStacksOutput{Stacks: []*cloudformation.Stack{&s}}, nil
 }
 
-func (c *cloudFormationAPIStub) CreateStack(input *cloudformation.CreateStackInput) (*cloudformation.CreateStackOutput, error) {
+func (c *cloudFormationAPIStub) CreateStackWithContext(ctx aws.Context, input *cloudformation.CreateStackInput, opts ...request.Option) (*cloudformation.CreateStackOutput, error) {
 	return nil, c.createErr
 }
 
-func (c *cloudFormationAPIStub) UpdateStack(input *cloudformation.UpdateStackInput) (*cloudformation.UpdateStackOutput, error) {
-	return nil, c.updateErr
+func (c *cloudFormationAPIStub) CreateChangeSetWithContext(ctx aws.Context, input *cloudformation.CreateChangeSetInput, opts ...request.Option) (*cloudformation.CreateChangeSetOutput, error) {
+	if c.changeSetErr != nil {
+		return nil, c.changeSetErr
+	}
+	return &cloudformation.CreateChangeSetOutput{Id: aws.String("change-set-id")}, nil
+}
+
+func (c *cloudFormationAPIStub) DescribeChangeSetWithContext(ctx aws.Context, input *cloudformation.DescribeChangeSetInput, opts ...request.Option) (*cloudformation.DescribeChangeSetOutput, error) {
+	status := c.changeSetStatus
+	if status == "" {
+		status = cloudformation.ChangeSetStatusCreateComplete
+	}
+	return &cloudformation.DescribeChangeSetOutput{
+		Status:       aws.String(status),
+		StatusReason: aws.String(c.changeSetReason),
+		Changes:      c.changeSetChanges,
+	}, nil
+}
+
+func (c *cloudFormationAPIStub) ExecuteChangeSetWithContext(ctx aws.Context, input *cloudformation.ExecuteChangeSetInput, opts ...request.Option) (*cloudformation.ExecuteChangeSetOutput, error) {
+	c.executed = true
+	return nil, nil
+}
+
+func (c *cloudFormationAPIStub) DeleteChangeSet(input *cloudformation.DeleteChangeSetInput) (*cloudformation.DeleteChangeSetOutput, error) {
+	return nil, nil
 }
 
 func (c *cloudFormationAPIStub) DeleteStack(input *cloudformation.DeleteStackInput) (*cloudformation.DeleteStackOutput, error) {
@@ -66,6 +162,34 @@ func (c *cloudFormationAPIStub) DescribeStacksPages(input *cloudformation.Descri
 	return nil
 }
 
+func (c *cloudFormationAPIStub) GetTemplate(input *cloudformation.GetTemplateInput) (*cloudformation.GetTemplateOutput, error) {
+	return &cloudformation.GetTemplateOutput{TemplateBody: aws.String(c.templateBody)}, nil
+}
+
+func (c *cloudFormationAPIStub) DescribeStackResources(input *cloudformation.DescribeStackResourcesInput) (*cloudformation.DescribeStackResourcesOutput, error) {
+	return &cloudformation.DescribeStackResourcesOutput{StackResources: c.stackResources}, nil
+}
+
+func (c *cloudFormationAPIStub) ValidateTemplate(input *cloudformation.ValidateTemplateInput) (*cloudformation.ValidateTemplateOutput, error) {
+	if c.validateErr != nil {
+		return nil, c.validateErr
+	}
+	return &cloudformation.ValidateTemplateOutput{Parameters: c.templateParameters}, nil
+}
+
+func (c *cloudFormationAPIStub) DescribeStackEvents(input *cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error) {
+	if c.stackEventsPageSize == 0 {
+		return &cloudformation.DescribeStackEventsOutput{StackEvents: c.stackEvents}, nil
+	}
+
+	start, _ := strconv.Atoi(aws.StringValue(input.NextToken))
+	end := start + c.stackEventsPageSize
+	if end >= len(c.stackEvents) {
+		return &cloudformation.DescribeStackEventsOutput{StackEvents: c.stackEvents[start:]}, nil
+	}
+	return &cloudformation.DescribeStackEventsOutput{StackEvents: c.stackEvents[start:end], NextToken: aws.String(strconv.Itoa(end))}, nil
+}
+
 func (c *cloudFormationAPIStub) setStatus(status string) {
 	c.statusMutex.Lock()
 	c.status = &status
@@ -79,11 +203,17 @@ func (c *cloudFormationAPIStub) getStatus() *string {
 }
 
 type autoscalingAPIStub struct {
-	groupName string
+	groupName   string
+	group       *autoscaling.Group
+	updateInput *autoscaling.UpdateAutoScalingGroupInput
+	tagsInput   *autoscaling.CreateOrUpdateTagsInput
 }
 
 func (a *autoscalingAPIStub) DescribeAutoScalingGroups(input *autoscaling.DescribeAutoScalingGroupsInput) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
-	group := &autoscaling.Group{AutoScalingGroupName: aws.String(a.groupName)}
+	group := a.group
+	if group == nil {
+		group = &autoscaling.Group{AutoScalingGroupName: aws.String(a.groupName)}
+	}
 	return &autoscaling.DescribeAutoScalingGroupsOutput{AutoScalingGroups: []*autoscaling.Group{group}}, nil
 }
 
@@ -91,6 +221,7 @@ func (a *autoscalingAPIStub) DescribeLaunchConfigurations(input *autoscaling.Des
 	return nil, nil
 }
 func (a *autoscalingAPIStub) UpdateAutoScalingGroup(input *autoscaling.UpdateAutoScalingGroupInput) (*autoscaling.UpdateAutoScalingGroupOutput, error) {
+	a.updateInput = input
 	return nil, nil
 }
 func (a *autoscalingAPIStub) SuspendProcesses(input *autoscaling.ScalingProcessQuery) (*autoscaling.SuspendProcessesOutput, error) {
@@ -102,12 +233,30 @@ func (a *autoscalingAPIStub) ResumeProcesses(*autoscaling.ScalingProcessQuery) (
 func (a *autoscalingAPIStub) TerminateInstanceInAutoScalingGroup(*autoscaling.TerminateInstanceInAutoScalingGroupInput) (*autoscaling.TerminateInstanceInAutoScalingGroupOutput, error) {
 	return nil, nil
 }
+func (a *autoscalingAPIStub) DeleteTags(*autoscaling.DeleteTagsInput) (*autoscaling.DeleteTagsOutput, error) {
+	return nil, nil
+}
+func (a *autoscalingAPIStub) CreateOrUpdateTags(input *autoscaling.CreateOrUpdateTagsInput) (*autoscaling.CreateOrUpdateTagsOutput, error) {
+	a.tagsInput = input
+	return nil, nil
+}
+func (a *autoscalingAPIStub) DeleteLaunchConfiguration(*autoscaling.DeleteLaunchConfigurationInput) (*autoscaling.DeleteLaunchConfigurationOutput, error) {
+	return nil, nil
+}
+func (a *autoscalingAPIStub) DescribeScalingActivities(*autoscaling.DescribeScalingActivitiesInput) (*autoscaling.DescribeScalingActivitiesOutput, error) {
+	return &autoscaling.DescribeScalingActivitiesOutput{}, nil
+}
+func (a *autoscalingAPIStub) DescribeAccountLimits(*autoscaling.DescribeAccountLimitsInput) (*autoscaling.DescribeAccountLimitsOutput, error) {
+	return &autoscaling.DescribeAccountLimitsOutput{}, nil
+}
 
 type s3UploaderAPIStub struct {
-	err error
+	err   error
+	input *s3manager.UploadInput
 }
 
-func (s *s3UploaderAPIStub) Upload(input *s3manager.UploadInput, options ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+func (s *s3UploaderAPIStub) UploadWithContext(ctx aws.Context, input *s3manager.UploadInput, options ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+	s.input = input
 	return &s3manager.UploadOutput{Location: "url"}, s.err
 }
 
@@ -115,13 +264,14 @@ func newAWSAdapterWithStubs(status string, groupName string) *awsAdapter {
 	logger := log.WithField("cluster", "foobar")
 
 	return &awsAdapter{
-		session:              &session.Session{Config: &aws.Config{Region: aws.String("")}},
-		cloudformationClient: &cloudFormationAPIStub{statusMutex: &sync.Mutex{}, status: aws.String(status)},
-		s3Client:             &s3APIStub{},
-		autoscalingClient:    &autoscalingAPIStub{groupName: groupName},
-		apiServer:            "",
-		dryRun:               false,
-		logger:               logger,
+		session:                 &session.Session{Config: &aws.Config{Region: aws.String("")}},
+		cloudformationClient:    &cloudFormationAPIStub{statusMutex: &sync.Mutex{}, status: aws.String(status)},
+		s3Client:                &s3APIStub{},
+		publicAccessBlockClient: &publicAccessBlockAPIStub{},
+		autoscalingClient:       &autoscalingAPIStub{groupName: groupName},
+		apiServer:               "",
+		dryRun:                  false,
+		logger:                  logger,
 	}
 }
 
@@ -191,7 +341,7 @@ func testWaitForStackWithRollback(t *testing.T) {
 	}()
 
 	_, err := awsMock.waitForStack(ctx, 100*time.Millisecond, "foobar")
-	if err != errRollbackComplete {
+	if failedErr, ok := err.(*stackFailedError); !ok || failedErr.Cause() != errRollbackComplete {
 		t.Errorf("should return rollback complete, got: %v", err)
 	}
 	if counter != 2 {
@@ -227,6 +377,132 @@ func TestCreateS3Client(t *testing.T) {
 	if err != nil {
 		t.Fatalf("fail: %v", err)
 	}
+
+	encryption := a.s3Client.(*s3APIStub).encryptionInput
+	assert.NotNil(t, encryption)
+	rules := encryption.ServerSideEncryptionConfiguration.Rules
+	assert.Len(t, rules, 1)
+	assert.Equal(t, s3.ServerSideEncryptionAwsKms, aws.StringValue(rules[0].ApplyServerSideEncryptionByDefault.SSEAlgorithm))
+
+	publicAccessBlock := a.publicAccessBlockClient.(*publicAccessBlockAPIStub).input
+	require.NotNil(t, publicAccessBlock)
+	assert.True(t, aws.BoolValue(publicAccessBlock.PublicAccessBlockConfiguration.BlockPublicAcls))
+	assert.True(t, aws.BoolValue(publicAccessBlock.PublicAccessBlockConfiguration.BlockPublicPolicy))
+	assert.True(t, aws.BoolValue(publicAccessBlock.PublicAccessBlockConfiguration.IgnorePublicAcls))
+	assert.True(t, aws.BoolValue(publicAccessBlock.PublicAccessBlockConfiguration.RestrictPublicBuckets))
+}
+
+func TestUploadUserDataToS3(t *testing.T) {
+	for _, tc := range []struct {
+		msg    string
+		kmsKey string
+	}{
+		{
+			msg:    "test userdata is encrypted with the cluster key",
+			kmsKey: "arn:aws:kms:eu-central-1:123456789012:key/foo",
+		},
+		{
+			msg:    "test userdata is encrypted with the default key",
+			kmsKey: "",
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			a := newAWSAdapterWithStubs("", "GroupName")
+			uploader := &s3UploaderAPIStub{}
+			a.s3Uploader = uploader
+
+			uri, err := a.uploadUserDataToS3(context.Background(), []byte("userdata"), &userDataBucket{name: "bucket"}, tc.kmsKey, nil)
+			assert.NoError(t, err)
+			assert.True(t, strings.HasPrefix(uri, "s3://bucket/"))
+			assert.Equal(t, s3.ServerSideEncryptionAwsKms, aws.StringValue(uploader.input.ServerSideEncryption))
+			if tc.kmsKey != "" {
+				assert.Equal(t, tc.kmsKey, aws.StringValue(uploader.input.SSEKMSKeyId))
+			} else {
+				assert.Nil(t, uploader.input.SSEKMSKeyId)
+			}
+		})
+	}
+}
+
+const testUserDataCLC = `storage:
+  files:
+  - path: /etc/foo
+    filesystem: root
+    mode: 0644
+    contents:
+      inline: {{CONTENT}}
+`
+
+func TestPrepareUserData(t *testing.T) {
+	dir, err := ioutil.TempDir("", "userdata")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	clcPath := path.Join(dir, "worker.clc.yaml")
+	require.NoError(t, ioutil.WriteFile(clcPath, []byte(testUserDataCLC), 0644))
+
+	for _, tc := range []struct {
+		msg      string
+		content  string
+		kmsKey   string
+		compress func([]byte) ([]byte, error)
+		uploaded bool
+	}{
+		{
+			msg:      "test small userdata is embedded",
+			content:  "foo",
+			uploaded: false,
+		},
+		{
+			msg:      "test large userdata is uploaded to S3",
+			content:  strings.Repeat("x", maxEmbeddedUserDataSize),
+			uploaded: true,
+		},
+		{
+			msg:      "test large compressed userdata is embedded",
+			content:  strings.Repeat("x", maxEmbeddedUserDataSize),
+			compress: gzipData,
+			uploaded: false,
+		},
+		{
+			msg:      "test encrypted userdata is always uploaded to S3",
+			content:  "foo",
+			kmsKey:   "key",
+			uploaded: true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			a := newAWSAdapterWithStubs("", "GroupName")
+			uploader := &s3UploaderAPIStub{}
+			a.s3Uploader = uploader
+
+			compress := userDataCompressions[userDataCompressionNone]
+			if tc.compress != nil {
+				compress = tc.compress
+			}
+
+			userData, err := a.prepareUserData(context.Background(), nil, nil, clcPath, "", map[string]string{"CONTENT": tc.content}, &userDataBucket{name: "bucket"}, tc.kmsKey, nil, compress)
+			require.NoError(t, err)
+
+			var decoded []byte
+			if tc.compress != nil {
+				uncompressed, err := decodeUserData(userData)
+				require.NoError(t, err)
+				decoded = []byte(uncompressed)
+			} else {
+				decoded, err = base64.StdEncoding.DecodeString(userData)
+				require.NoError(t, err)
+			}
+
+			if tc.uploaded {
+				assert.NotNil(t, uploader.input)
+				assert.Contains(t, string(decoded), "s3://bucket/")
+			} else {
+				assert.Nil(t, uploader.input)
+				assert.Contains(t, string(decoded), "/etc/foo")
+			}
+		})
+	}
 }
 
 func TestDescribeCorrectASG(t *testing.T) {
@@ -240,6 +516,44 @@ func TestDescribeCorrectASG(t *testing.T) {
 	}
 }
 
+func TestDesiredCapacity(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		asg      *autoscaling.Group
+		expected int64
+	}{
+		{
+			msg:      "test desired capacity of a running pool",
+			asg:      &autoscaling.Group{DesiredCapacity: aws.Int64(3)},
+			expected: 3,
+		},
+		{
+			msg: "test desired capacity from before scaling to zero",
+			asg: &autoscaling.Group{
+				DesiredCapacity: aws.Int64(0),
+				Tags: []*autoscaling.TagDescription{
+					{Key: aws.String(updatestrategy.PreScaleDesiredCapacityTag), Value: aws.String("5")},
+				},
+			},
+			expected: 5,
+		},
+		{
+			msg: "test invalid stored desired capacity",
+			asg: &autoscaling.Group{
+				DesiredCapacity: aws.Int64(0),
+				Tags: []*autoscaling.TagDescription{
+					{Key: aws.String(updatestrategy.PreScaleDesiredCapacityTag), Value: aws.String("foo")},
+				},
+			},
+			expected: 0,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			assert.Equal(t, tc.expected, desiredCapacity(tc.asg))
+		})
+	}
+}
+
 func TestAsgHasTags(t *testing.T) {
 	expected := []*autoscaling.TagDescription{{Key: aws.String("key-1"), Value: aws.String("value-1")},
 		{Key: aws.String("key-2"), Value: aws.String("value-2")}}
@@ -270,12 +584,18 @@ func TestCreateOrUpdateClusterStack(t *testing.T) {
 	s3Bucket := "s3-bucket"
 
 	// test creating stack with small stack template
-	err := awsAdapter.applyClusterStack("stack-name", []byte(`{"stack": "template"}`), cluster, s3Bucket)
+	err := awsAdapter.applyClusterStack(context.Background(), "stack-name", []byte(`{"stack": "template"}`), cluster, s3Bucket)
 	assert.NoError(t, err)
 
 	// test invalid stack template data
-	err = awsAdapter.applyClusterStack("stack-name", []byte(`{"stack": "template"`), cluster, s3Bucket)
+	err = awsAdapter.applyClusterStack(context.Background(), "stack-name", []byte(`{"stack": "template"`), cluster, s3Bucket)
+	assert.Error(t, err)
+
+	// test template rejected by the cloudformation validation
+	awsAdapter.cloudformationClient.(*cloudFormationAPIStub).validateErr = errors.New("Template format error")
+	err = awsAdapter.applyClusterStack(context.Background(), "stack-name", []byte(`{"stack": "template"}`), cluster, s3Bucket)
 	assert.Error(t, err)
+	awsAdapter.cloudformationClient.(*cloudFormationAPIStub).validateErr = nil
 
 	templateValue := make([]string, stackMaxSize+1)
 	for i := range templateValue {
@@ -285,12 +605,12 @@ func TestCreateOrUpdateClusterStack(t *testing.T) {
 
 	// test create when template is too big and must be uploaded to s3
 	awsAdapter.s3Uploader = &s3UploaderAPIStub{}
-	err = awsAdapter.applyClusterStack("stack-name", hugeTemplate, cluster, s3Bucket)
+	err = awsAdapter.applyClusterStack(context.Background(), "stack-name", hugeTemplate, cluster, s3Bucket)
 	assert.NoError(t, err)
 
 	// test create bucket failing when s3 upload fails
-	awsAdapter.s3Uploader = &s3UploaderAPIStub{errors.New("error")}
-	err = awsAdapter.applyClusterStack("stack-name", hugeTemplate, cluster, s3Bucket)
+	awsAdapter.s3Uploader = &s3UploaderAPIStub{err: errors.New("error")}
+	err = awsAdapter.applyClusterStack(context.Background(), "stack-name", hugeTemplate, cluster, s3Bucket)
 	assert.Error(t, err)
 
 	// test updating existing stack
@@ -301,19 +621,26 @@ func TestCreateOrUpdateClusterStack(t *testing.T) {
 			"",
 			errors.New("base error"),
 		),
+		changeSetChanges: []*cloudformation.Change{
+			{ResourceChange: &cloudformation.ResourceChange{Action: aws.String("Modify"), LogicalResourceId: aws.String("WorkerLaunchConfiguration")}},
+		},
 	}
-	err = awsAdapter.applyClusterStack("stack-name", []byte(`{"stack": "template"}`), cluster, s3Bucket)
+	awsAdapter.updatedStacks = nil
+	err = awsAdapter.applyClusterStack(context.Background(), "stack-name", []byte(`{"stack": "template"}`), cluster, s3Bucket)
 	assert.NoError(t, err)
+	assert.True(t, awsAdapter.cloudformationClient.(*cloudFormationAPIStub).executed)
+	assert.True(t, awsAdapter.updatedStacks["stack-name"])
 
 	// test create failing
 	awsAdapter.cloudformationClient = &cloudFormationAPIStub{
 		statusMutex: &sync.Mutex{},
 		createErr:   errors.New("error"),
 	}
-	err = awsAdapter.applyClusterStack("stack-name", []byte(`{"stack": "template"}`), cluster, s3Bucket)
+	err = awsAdapter.applyClusterStack(context.Background(), "stack-name", []byte(`{"stack": "template"}`), cluster, s3Bucket)
 	assert.Error(t, err)
 
-	// test updating when stack is already up to date
+	// test updating when stack is already up to date, the change set
+	// without changes isn't executed.
 	awsAdapter.cloudformationClient = &cloudFormationAPIStub{
 		statusMutex: &sync.Mutex{},
 		createErr: awserr.New(
@@ -321,14 +648,28 @@ func TestCreateOrUpdateClusterStack(t *testing.T) {
 			"",
 			errors.New("base error"),
 		),
-		updateErr: awserr.New(
-			cloudformationValidationErr,
-			cloudformationNoUpdateMsg,
+		changeSetStatus: cloudformation.ChangeSetStatusFailed,
+		changeSetReason: "The submitted information didn't contain changes. Submit different information to create a change set.",
+	}
+	awsAdapter.updatedStacks = nil
+	err = awsAdapter.applyClusterStack(context.Background(), "stack-name", []byte(`{"stack": "template"}`), cluster, s3Bucket)
+	assert.NoError(t, err)
+	assert.False(t, awsAdapter.cloudformationClient.(*cloudFormationAPIStub).executed)
+	assert.False(t, awsAdapter.updatedStacks["stack-name"])
+
+	// test change set failing for other reasons
+	awsAdapter.cloudformationClient = &cloudFormationAPIStub{
+		statusMutex: &sync.Mutex{},
+		createErr: awserr.New(
+			cloudformation.ErrCodeAlreadyExistsException,
+			"",
 			errors.New("base error"),
 		),
+		changeSetStatus: cloudformation.ChangeSetStatusFailed,
+		changeSetReason: "Template error: unresolved resource dependencies",
 	}
-	err = awsAdapter.applyClusterStack("stack-name", []byte(`{"stack": "template"}`), cluster, s3Bucket)
-	assert.NoError(t, err)
+	err = awsAdapter.applyClusterStack(context.Background(), "stack-name", []byte(`{"stack": "template"}`), cluster, s3Bucket)
+	assert.Error(t, err)
 
 	// test update failing
 	awsAdapter.cloudformationClient = &cloudFormationAPIStub{
@@ -338,8 +679,245 @@ func TestCreateOrUpdateClusterStack(t *testing.T) {
 			"",
 			errors.New("base error"),
 		),
-		updateErr: errors.New("error"),
+		changeSetErr: errors.New("error"),
+	}
+	err = awsAdapter.applyClusterStack(context.Background(), "stack-name", []byte(`{"stack": "template"}`), cluster, s3Bucket)
+	assert.Error(t, err)
+
+	// test skipping stacks last applied with the same template, failing
+	// creates and updates show the stack isn't applied.
+	upToDate := []*cloudformation.Tag{{Key: aws.String(templateHashTag), Value: aws.String(templateHash(`{"stack": "template"}`))}}
+	awsAdapter.cloudformationClient = &cloudFormationAPIStub{
+		statusMutex: &sync.Mutex{},
+		status:      aws.String(cloudformation.StackStatusUpdateComplete),
+		stackTags:   upToDate,
+		createErr:   errors.New("error"),
 	}
-	err = awsAdapter.applyClusterStack("stack-name", []byte(`{"stack": "template"}`), cluster, s3Bucket)
+	err = awsAdapter.applyClusterStack(context.Background(), "stack-name", []byte(`{"stack": "template"}`), cluster, s3Bucket)
+	assert.NoError(t, err)
+
+	// test changed templates are applied
+	err = awsAdapter.applyClusterStack(context.Background(), "stack-name", []byte(`{"stack": "changed"}`), cluster, s3Bucket)
+	assert.Error(t, err)
+
+	// test stacks rolled back are applied again
+	awsAdapter.cloudformationClient.(*cloudFormationAPIStub).setStatus(cloudformation.StackStatusUpdateRollbackComplete)
+	err = awsAdapter.applyClusterStack(context.Background(), "stack-name", []byte(`{"stack": "template"}`), cluster, s3Bucket)
+	assert.Error(t, err)
+}
+
+func TestLaunchTemplateArgs(t *testing.T) {
+	args := launchTemplateArgs("kube-1", &api.NodePool{Name: "master-default"}, &api.NodePool{Name: "worker-default"})
+	assert.Equal(t, []string{
+		"LaunchTemplate=true",
+		"MasterLaunchTemplateName=kube-1-master-default",
+		"WorkerLaunchTemplateName=kube-1-worker-default",
+	}, args)
+}
+
+func TestIMDSArgs(t *testing.T) {
+	args, err := imdsArgs("Worker", &api.NodePool{Name: "worker-default"})
+	require.NoError(t, err)
+	assert.Empty(t, args)
+
+	args, err = imdsArgs("Worker", &api.NodePool{Name: "worker-default", RequireIMDSv2: true})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"WorkerMetadataHttpTokens=required",
+		"WorkerMetadataHttpPutResponseHopLimit=2",
+	}, args)
+
+	args, err = imdsArgs("Master", &api.NodePool{Name: "master-default", RequireIMDSv2: true, IMDSHopLimit: 1})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"MasterMetadataHttpTokens=required",
+		"MasterMetadataHttpPutResponseHopLimit=1",
+	}, args)
+
+	_, err = imdsArgs("Worker", &api.NodePool{Name: "worker-default", RequireIMDSv2: true, IMDSHopLimit: 65})
+	assert.Error(t, err)
+}
+
+func TestNodePoolUserDataConfig(t *testing.T) {
+	config := map[string]string{"NODE_LABELS": "lifecycle-status=ready"}
+
+	workerConfig := nodePoolUserDataConfig(config, &api.NodePool{Name: "worker-default", InstanceType: "m4.large"})
+	assert.Equal(t, "worker-default", workerConfig["NODE_POOL"])
+	assert.Equal(t, "m4.large", workerConfig["INSTANCE_TYPE"])
+	assert.Equal(t, "amd64", workerConfig["ARCHITECTURE"])
+	assert.Equal(t, "lifecycle-status=ready", workerConfig["NODE_LABELS"])
+	assert.NotContains(t, workerConfig, "NODE_TAINTS")
+
+	gpuConfig := nodePoolUserDataConfig(config, &api.NodePool{Name: "worker-gpu", InstanceType: "p2.xlarge"})
+	assert.Equal(t, "1", gpuConfig["GPU_COUNT"])
+	assert.Equal(t, "nvidia-tesla-k80", gpuConfig["GPU_TYPE"])
+	assert.Equal(t, "lifecycle-status=ready,aws.amazon.com/gpu-count=1,aws.amazon.com/gpu-type=nvidia-tesla-k80", gpuConfig["NODE_LABELS"])
+	assert.Equal(t, gpuTaint, gpuConfig["NODE_TAINTS"])
+
+	labeledConfig := nodePoolUserDataConfig(config, &api.NodePool{
+		Name:         "worker-teapot",
+		InstanceType: "m4.large",
+		Labels:       map[string]string{"team": "teapot", "dedicated": "teapot"},
+		Taints:       map[string]string{"dedicated": "teapot:NoSchedule", "critical": "NoExecute"},
+	})
+	assert.Equal(t, "lifecycle-status=ready,dedicated=teapot,team=teapot", labeledConfig["NODE_LABELS"])
+	assert.Equal(t, "critical:NoExecute,dedicated=teapot:NoSchedule", labeledConfig["NODE_TAINTS"])
+
+	// the shared config must not be modified
+	assert.Equal(t, map[string]string{"NODE_LABELS": "lifecycle-status=ready"}, config)
+}
+
+func TestValidateLabelsAndTaints(t *testing.T) {
+	for _, tc := range []struct {
+		msg    string
+		labels map[string]string
+		taints map[string]string
+		valid  bool
+	}{
+		{
+			msg:    "valid labels and taints",
+			labels: map[string]string{"team": "teapot", "example.org/role": ""},
+			taints: map[string]string{"dedicated": "teapot:NoSchedule", "example.org/critical": "NoExecute"},
+			valid:  true,
+		},
+		{
+			msg:    "invalid label key",
+			labels: map[string]string{"-team": "teapot"},
+		},
+		{
+			msg:    "invalid label value",
+			labels: map[string]string{"team": "tea pot"},
+		},
+		{
+			msg:    "invalid taint effect",
+			taints: map[string]string{"dedicated": "teapot:NoRun"},
+		},
+		{
+			msg:    "invalid taint value",
+			taints: map[string]string{"dedicated": "tea/pot:NoSchedule"},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := validateLabelsAndTaints(&api.NodePool{Name: "worker-default", Labels: tc.labels, Taints: tc.taints})
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestValidateArchitecture(t *testing.T) {
+	assert.NoError(t, validateArchitecture(&api.NodePool{Name: "worker-default", InstanceType: "m4.large"}))
+	assert.NoError(t, validateArchitecture(&api.NodePool{Name: "worker-default", InstanceType: "m4.large", Architecture: "amd64"}))
+	assert.Error(t, validateArchitecture(&api.NodePool{Name: "worker-default", InstanceType: "m4.large", Architecture: "arm64"}))
+	assert.NoError(t, validateArchitecture(&api.NodePool{Name: "worker-default", InstanceType: "unknown.large", Architecture: "arm64"}))
+}
+
+func TestAutoscalerTags(t *testing.T) {
+	nodePool := &api.NodePool{Name: "worker-gpu", InstanceType: "p3.2xlarge", MinSize: 0, RootVolumeSize: 100}
+	tags, err := autoscalerTags("cluster-id", nodePool, map[string]string{
+		"NODE_LABELS": "lifecycle-status=ready,aws.amazon.com/gpu-count=1",
+		"NODE_TAINTS": "nvidia.com/gpu=present:NoSchedule,dedicated:NoExecute,node.clm/uninitialized=true:NoSchedule",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{
+		"k8s.io/cluster-autoscaler/enabled":                                              "true",
+		"k8s.io/cluster-autoscaler/cluster-id":                                           "owned",
+		"k8s.io/cluster-autoscaler/node-template/label/lifecycle-status":                 "ready",
+		"k8s.io/cluster-autoscaler/node-template/label/aws.amazon.com/gpu-count":         "1",
+		"k8s.io/cluster-autoscaler/node-template/label/node.kubernetes.io/instance-type": "p3.2xlarge",
+		"k8s.io/cluster-autoscaler/node-template/label/kubernetes.io/arch":               "amd64",
+		"k8s.io/cluster-autoscaler/node-template/label/kubernetes.io/os":                 "linux",
+		"k8s.io/cluster-autoscaler/node-template/resources/nvidia.com/gpu":               "1",
+		"k8s.io/cluster-autoscaler/node-template/resources/ephemeral-storage":            "100Gi",
+		"k8s.io/cluster-autoscaler/node-template/taint/nvidia.com/gpu":                   "present:NoSchedule",
+		"k8s.io/cluster-autoscaler/node-template/taint/dedicated":                        ":NoExecute",
+	}, tags)
+
+	// the architecture of the node pool and the labels of the userdata
+	// config take precedence.
+	tags, err = autoscalerTags("cluster-id", &api.NodePool{InstanceType: "unknown.large", Architecture: "arm64"}, map[string]string{
+		"NODE_LABELS": "node.kubernetes.io/instance-type=custom",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "custom", tags["k8s.io/cluster-autoscaler/node-template/label/node.kubernetes.io/instance-type"])
+	assert.Equal(t, "arm64", tags["k8s.io/cluster-autoscaler/node-template/label/kubernetes.io/arch"])
+	assert.NotContains(t, tags, "k8s.io/cluster-autoscaler/node-template/resources/nvidia.com/gpu")
+
+	_, err = autoscalerTags("cluster-id", nodePool, map[string]string{"NODE_TAINTS": "invalid"})
+	assert.Error(t, err)
+
+	// master pools aren't discovered by the autoscaler.
+	tags, err = autoscalerTags("cluster-id", &api.NodePool{Profile: "master-default", InstanceType: "m4.large"}, map[string]string{})
+	require.NoError(t, err)
+	assert.NotContains(t, tags, "k8s.io/cluster-autoscaler/enabled")
+	assert.NotContains(t, tags, "k8s.io/cluster-autoscaler/cluster-id")
+	assert.Equal(t, "m4.large", tags["k8s.io/cluster-autoscaler/node-template/label/node.kubernetes.io/instance-type"])
+}
+
+func TestAddAutoscalerTags(t *testing.T) {
+	worker := &api.NodePool{Name: "worker-default"}
+	output, err := addAutoscalerTags([]byte(testNodePoolTagsStackTemplate), map[*api.NodePool]map[string]string{
+		worker: {
+			"k8s.io/cluster-autoscaler/enabled":                  "true",
+			"k8s.io/cluster-autoscaler/node-template/label/team": "teapot",
+		},
+	})
+	require.NoError(t, err)
+
+	var template struct {
+		Resources map[string]struct {
+			Properties struct {
+				Tags []map[string]interface{}
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(output, &template))
+	assert.Equal(t, []map[string]interface{}{
+		{"Key": "NodePool", "Value": "worker-default", "PropagateAtLaunch": true},
+		{"Key": "team", "Value": "teapot", "PropagateAtLaunch": true},
+		{"Key": "k8s.io/cluster-autoscaler/enabled", "Value": "true", "PropagateAtLaunch": false},
+		{"Key": "k8s.io/cluster-autoscaler/node-template/label/team", "Value": "teapot", "PropagateAtLaunch": false},
+	}, template.Resources["WorkerAutoScalingGroup"].Properties.Tags)
+
+	_, err = addAutoscalerTags([]byte(testNodePoolTagsStackTemplate), map[*api.NodePool]map[string]string{
+		{Name: "missing"}: {},
+	})
 	assert.Error(t, err)
 }
+
+func TestDeleteStaleAutoscalerTags(t *testing.T) {
+	asgClient := &suspendAutoscalingAPIStub{}
+	a := &awsAdapter{autoscalingClient: asgClient, logger: log.WithField("test", true)}
+
+	err := a.deleteStaleAutoscalerTags(&autoscaling.Group{
+		AutoScalingGroupName: aws.String("asg"),
+		Tags: []*autoscaling.TagDescription{
+			{Key: aws.String("k8s.io/cluster-autoscaler/enabled"), Value: aws.String("true")},
+			{Key: aws.String("k8s.io/cluster-autoscaler/node-template/label/team"), Value: aws.String("teapot")},
+			{Key: aws.String("k8s.io/cluster-autoscaler/node-template/taint/dedicated"), Value: aws.String(":NoSchedule")},
+			{Key: aws.String("team"), Value: aws.String("teapot")},
+		},
+	}, map[string]string{
+		"k8s.io/cluster-autoscaler/enabled":                  "true",
+		"k8s.io/cluster-autoscaler/node-template/label/team": "teapot",
+	})
+	require.NoError(t, err)
+	require.Len(t, asgClient.deletedTags, 1)
+	assert.Equal(t, "k8s.io/cluster-autoscaler/node-template/taint/dedicated", aws.StringValue(asgClient.deletedTags[0].Key))
+	assert.Equal(t, "asg", aws.StringValue(asgClient.deletedTags[0].ResourceId))
+}
+
+func TestTagASG(t *testing.T) {
+	a := newAWSAdapterWithStubs("", "asg")
+	err := a.tagASG("asg", map[string]string{"b": "2", "a": "1"})
+	require.NoError(t, err)
+
+	tagsInput := a.autoscalingClient.(*autoscalingAPIStub).tagsInput
+	require.Len(t, tagsInput.Tags, 2)
+	assert.Equal(t, "a", aws.StringValue(tagsInput.Tags[0].Key))
+	assert.Equal(t, "asg", aws.StringValue(tagsInput.Tags[0].ResourceId))
+	assert.False(t, aws.BoolValue(tagsInput.Tags[0].PropagateAtLaunch))
+}
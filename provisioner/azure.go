@@ -0,0 +1,815 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/coreos/container-linux-config-transpiler/config/platform"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"golang.org/x/oauth2"
+	"golang.org/x/oauth2/clientcredentials"
+)
+
+const (
+	azureProviderID                 = "zalando-azure"
+	azureAccountPrefix              = "azure:"
+	azureManagementEndpoint         = "https://management.azure.com"
+	azureLoginEndpoint              = "https://login.microsoftonline.com"
+	azureDeploymentsAPIVersion      = "2019-10-01"
+	azureResourceGroupsAPIVersion   = "2019-10-01"
+	azureScaleSetsAPIVersion        = "2019-12-01"
+	azureScaleSetResourceType       = "Microsoft.Compute/virtualMachineScaleSets"
+	azureResourceGroupConfigItemKey = "azure_resource_group"
+	azureTemplateFile               = "vmss.json"
+	azurePriorityRegular            = "Regular"
+	azurePrioritySpot               = "Spot"
+	azureSecureString               = "secureString"
+	azureResourceNotFound           = "ResourceNotFound"
+	azureResourceGroupNotFound      = "ResourceGroupNotFound"
+	azureDeploymentNotFound         = "DeploymentNotFound"
+
+	azureDeploymentSucceeded = "Succeeded"
+	azureDeploymentFailed    = "Failed"
+	azureDeploymentCanceled  = "Canceled"
+)
+
+// azureUpgradeModes are the upgrade policies of scale sets which update
+// their instances to the latest model of the scale set.
+var azureUpgradeModes = []string{"Automatic", "Rolling"}
+
+// azureDeployment is an Azure Resource Manager deployment of a template.
+type azureDeployment struct {
+	Properties azureDeploymentProperties `json:"properties"`
+}
+
+type azureDeploymentProperties struct {
+	Mode              string                          `json:"mode,omitempty"`
+	Template          json.RawMessage                 `json:"template,omitempty"`
+	Parameters        map[string]azureDeploymentValue `json:"parameters,omitempty"`
+	ProvisioningState string                          `json:"provisioningState,omitempty"`
+	Error             *azureErrorDetails              `json:"error,omitempty"`
+}
+
+type azureDeploymentValue struct {
+	Value interface{} `json:"value"`
+}
+
+type azureErrorDetails struct {
+	Code    string `json:"code"`
+	Message string `json:"message"`
+}
+
+func (e *azureErrorDetails) Error() string {
+	return fmt.Sprintf("%s: %s", e.Code, e.Message)
+}
+
+// azureDeploymentsAPI is a minimal interface containing only the methods we
+// use from the Azure Resource Manager deployments API.
+type azureDeploymentsAPI interface {
+	CreateOrUpdate(ctx context.Context, subscriptionID, resourceGroup, name string, deployment *azureDeployment) error
+	Get(ctx context.Context, subscriptionID, resourceGroup, name string) (*azureDeployment, error)
+	Delete(ctx context.Context, subscriptionID, resourceGroup, name string) error
+}
+
+// azureScaleSetsAPI is a minimal interface containing only the methods we
+// use from the Azure Virtual Machine Scale Sets API.
+type azureScaleSetsAPI interface {
+	// Capacity returns the current capacity of the scale set and whether it
+	// exists.
+	Capacity(ctx context.Context, subscriptionID, resourceGroup, name string) (int64, bool, error)
+	// Deallocate stops the instances of the scale set, keeping their
+	// disks.
+	Deallocate(ctx context.Context, subscriptionID, resourceGroup, name string) error
+	// Start starts the deallocated instances of the scale set.
+	Start(ctx context.Context, subscriptionID, resourceGroup, name string) error
+	Delete(ctx context.Context, subscriptionID, resourceGroup, name string) error
+}
+
+// azureResourceGroupsAPI is a minimal interface containing only the methods we
+// use from the Azure Resource Manager resource groups API.
+type azureResourceGroupsAPI interface {
+	Exists(ctx context.Context, subscriptionID, name string) (bool, error)
+	Delete(ctx context.Context, subscriptionID, name string) error
+}
+
+// azureDeploymentsClient is a client of the Azure Resource Manager
+// deployments REST API.
+type azureDeploymentsClient struct {
+	client   *http.Client
+	endpoint string
+}
+
+// azureScaleSetsClient is a client of the Azure Virtual Machine Scale Sets
+// REST API.
+type azureScaleSetsClient struct {
+	client   *http.Client
+	endpoint string
+}
+
+// azureResourceGroupsClient is a client of the Azure Resource Manager
+// resource groups REST API.
+type azureResourceGroupsClient struct {
+	client   *http.Client
+	endpoint string
+}
+
+// NewAzureTokenSource returns a token source for the Azure Resource Manager
+// API authenticating with the credentials of a service principal.
+func NewAzureTokenSource(tenantID, clientID, clientSecret string) oauth2.TokenSource {
+	config := &clientcredentials.Config{
+		ClientID:       clientID,
+		ClientSecret:   clientSecret,
+		TokenURL:       fmt.Sprintf("%s/%s/oauth2/token", azureLoginEndpoint, tenantID),
+		EndpointParams: url.Values{"resource": []string{azureManagementEndpoint + "/"}},
+	}
+	return config.TokenSource(context.Background())
+}
+
+func (c *azureDeploymentsClient) deploymentURL(subscriptionID, resourceGroup, name string) string {
+	return fmt.Sprintf("%s/subscriptions/%s/resourcegroups/%s/providers/Microsoft.Resources/deployments/%s?api-version=%s",
+		c.endpoint, url.PathEscape(subscriptionID), url.PathEscape(resourceGroup), url.PathEscape(name), azureDeploymentsAPIVersion)
+}
+
+// CreateOrUpdate starts the deployment of a template.
+func (c *azureDeploymentsClient) CreateOrUpdate(ctx context.Context, subscriptionID, resourceGroup, name string, deployment *azureDeployment) error {
+	body, err := json.Marshal(deployment)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPut, c.deploymentURL(subscriptionID, resourceGroup, name), bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	return azureDo(ctx, c.client, req, nil)
+}
+
+// Get gets a deployment including its provisioning state.
+func (c *azureDeploymentsClient) Get(ctx context.Context, subscriptionID, resourceGroup, name string) (*azureDeployment, error) {
+	req, err := http.NewRequest(http.MethodGet, c.deploymentURL(subscriptionID, resourceGroup, name), nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var deployment azureDeployment
+	err = azureDo(ctx, c.client, req, &deployment)
+	if err != nil {
+		return nil, err
+	}
+	return &deployment, nil
+}
+
+// Delete deletes a deployment from the deployment history of the resource
+// group. The deployed resources are kept.
+func (c *azureDeploymentsClient) Delete(ctx context.Context, subscriptionID, resourceGroup, name string) error {
+	req, err := http.NewRequest(http.MethodDelete, c.deploymentURL(subscriptionID, resourceGroup, name), nil)
+	if err != nil {
+		return err
+	}
+
+	return azureDo(ctx, c.client, req, nil)
+}
+
+func (c *azureScaleSetsClient) scaleSetURL(subscriptionID, resourceGroup, name, action string) string {
+	return fmt.Sprintf("%s/subscriptions/%s/resourceGroups/%s/providers/Microsoft.Compute/virtualMachineScaleSets/%s%s?api-version=%s",
+		c.endpoint, url.PathEscape(subscriptionID), url.PathEscape(resourceGroup), url.PathEscape(name), action, azureScaleSetsAPIVersion)
+}
+
+// Capacity gets the current capacity of a scale set. Scale sets which don't
+// exist yet are reported as such instead of as an error.
+func (c *azureScaleSetsClient) Capacity(ctx context.Context, subscriptionID, resourceGroup, name string) (int64, bool, error) {
+	req, err := http.NewRequest(http.MethodGet, c.scaleSetURL(subscriptionID, resourceGroup, name, ""), nil)
+	if err != nil {
+		return 0, false, err
+	}
+
+	var scaleSet struct {
+		Sku struct {
+			Capacity int64 `json:"capacity"`
+		} `json:"sku"`
+	}
+	err = azureDo(ctx, c.client, req, &scaleSet)
+	if err != nil {
+		if isAzureNotFound(err) {
+			return 0, false, nil
+		}
+		return 0, false, err
+	}
+	return scaleSet.Sku.Capacity, true, nil
+}
+
+// Deallocate starts deallocating the instances of a scale set.
+func (c *azureScaleSetsClient) Deallocate(ctx context.Context, subscriptionID, resourceGroup, name string) error {
+	req, err := http.NewRequest(http.MethodPost, c.scaleSetURL(subscriptionID, resourceGroup, name, "/deallocate"), nil)
+	if err != nil {
+		return err
+	}
+
+	return azureDo(ctx, c.client, req, nil)
+}
+
+// Start starts the instances of a scale set.
+func (c *azureScaleSetsClient) Start(ctx context.Context, subscriptionID, resourceGroup, name string) error {
+	req, err := http.NewRequest(http.MethodPost, c.scaleSetURL(subscriptionID, resourceGroup, name, "/start"), nil)
+	if err != nil {
+		return err
+	}
+
+	return azureDo(ctx, c.client, req, nil)
+}
+
+// Delete starts deleting a scale set and its instances.
+func (c *azureScaleSetsClient) Delete(ctx context.Context, subscriptionID, resourceGroup, name string) error {
+	req, err := http.NewRequest(http.MethodDelete, c.scaleSetURL(subscriptionID, resourceGroup, name, ""), nil)
+	if err != nil {
+		return err
+	}
+
+	return azureDo(ctx, c.client, req, nil)
+}
+
+func (c *azureResourceGroupsClient) resourceGroupURL(subscriptionID, name string) string {
+	return fmt.Sprintf("%s/subscriptions/%s/resourcegroups/%s?api-version=%s",
+		c.endpoint, url.PathEscape(subscriptionID), url.PathEscape(name), azureResourceGroupsAPIVersion)
+}
+
+// Exists returns true if the resource group exists, including while it's
+// being deleted.
+func (c *azureResourceGroupsClient) Exists(ctx context.Context, subscriptionID, name string) (bool, error) {
+	req, err := http.NewRequest(http.MethodGet, c.resourceGroupURL(subscriptionID, name), nil)
+	if err != nil {
+		return false, err
+	}
+
+	err = azureDo(ctx, c.client, req, nil)
+	if err != nil {
+		if isAzureNotFound(err) {
+			return false, nil
+		}
+		return false, err
+	}
+	return true, nil
+}
+
+// Delete starts deleting a resource group and all of its resources.
+func (c *azureResourceGroupsClient) Delete(ctx context.Context, subscriptionID, name string) error {
+	req, err := http.NewRequest(http.MethodDelete, c.resourceGroupURL(subscriptionID, name), nil)
+	if err != nil {
+		return err
+	}
+
+	return azureDo(ctx, c.client, req, nil)
+}
+
+// isAzureNotFound returns true if the error is returned for a resource which
+// doesn't exist.
+func isAzureNotFound(err error) bool {
+	details, ok := err.(*azureErrorDetails)
+	if !ok {
+		return false
+	}
+
+	switch details.Code {
+	case azureResourceNotFound, azureResourceGroupNotFound, azureDeploymentNotFound:
+		return true
+	}
+	return false
+}
+
+// azureDo sends the request and decodes the response into result unless it's
+// nil. Error responses are returned as errors.
+func azureDo(ctx context.Context, client *http.Client, req *http.Request, result interface{}) error {
+	resp, err := client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		var errResp struct {
+			Error *azureErrorDetails `json:"error"`
+		}
+		if json.Unmarshal(body, &errResp) == nil && errResp.Error != nil {
+			return errResp.Error
+		}
+		return fmt.Errorf("unexpected status %d from %s: %s", resp.StatusCode, req.URL.Path, string(body))
+	}
+
+	if result == nil {
+		return nil
+	}
+	return json.Unmarshal(body, result)
+}
+
+// azureProvisioner provisions the node pools of clusters as Azure Virtual
+// Machine Scale Sets. Every node pool is an ARM deployment of the template of
+// its profile, using the same userdata as the node pools on AWS.
+type azureProvisioner struct {
+	deployments    azureDeploymentsAPI
+	scaleSets      azureScaleSetsAPI
+	resourceGroups azureResourceGroupsAPI
+	dryRun         bool
+	waitTime       time.Duration
+}
+
+// NewAzureProvisioner returns a new provisioner of Azure clusters
+// authenticating with the token source.
+func NewAzureProvisioner(tokenSource oauth2.TokenSource, options *Options) Provisioner {
+	client := oauth2.NewClient(context.Background(), tokenSource)
+	provisioner := &azureProvisioner{
+		deployments: &azureDeploymentsClient{
+			client:   client,
+			endpoint: azureManagementEndpoint,
+		},
+		scaleSets: &azureScaleSetsClient{
+			client:   client,
+			endpoint: azureManagementEndpoint,
+		},
+		resourceGroups: &azureResourceGroupsClient{
+			client:   client,
+			endpoint: azureManagementEndpoint,
+		},
+		waitTime: waitTime,
+	}
+
+	if options != nil {
+		provisioner.dryRun = options.DryRun || options.ReadOnly
+	}
+
+	return provisioner
+}
+
+// Version returns the version derived from a sha1 hash of the cluster struct
+// and the channel config version.
+func (p *azureProvisioner) Version(cluster *api.Cluster, channelConfig *channel.Config) (string, error) {
+	if cluster.Provider != azureProviderID {
+		return "", ErrProviderNotSupported
+	}
+
+	cluster, err := withValuesFiles(cluster, channelConfig)
+	if err != nil {
+		return "", err
+	}
+
+	return clusterVersion(cluster, channelConfig)
+}
+
+// Preflight checks the node pool profiles of the cluster.
+func (p *azureProvisioner) Preflight(cluster *api.Cluster, channelConfig *channel.Config) (*PreflightReport, error) {
+	if cluster.Provider != azureProviderID {
+		return nil, ErrProviderNotSupported
+	}
+
+	report := &PreflightReport{}
+	report.add(preflightCheckProfiles, checkProfiles(path.Join(channelConfig.Path, "cluster"), cluster))
+	return report, nil
+}
+
+// Provision deploys the Virtual Machine Scale Sets of all node pools of the
+// cluster. A failing node pool doesn't prevent the remaining node pools from
+// being deployed.
+func (p *azureProvisioner) Provision(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	if cluster.Provider != azureProviderID {
+		return ErrProviderNotSupported
+	}
+
+	cluster, err := withValuesFiles(cluster, channelConfig)
+	if err != nil {
+		return err
+	}
+
+	err = validateConfigItems(cluster, channelConfig)
+	if err != nil {
+		return err
+	}
+
+	logger := log.WithField("cluster", cluster.Alias)
+
+	subscriptionID, resourceGroup, err := azureClusterLocation(cluster)
+	if err != nil {
+		return err
+	}
+
+	kubeletSecret, ok := cluster.ConfigItems[workerSharedSecretConfigItemKey]
+	if !ok {
+		return fmt.Errorf("'%s' config item is missing, must be defined", workerSharedSecretConfigItemKey)
+	}
+
+	_, version, err := splitStackName(cluster.LocalID)
+	if err != nil {
+		return err
+	}
+
+	config, err := userDataConfig(cluster.LocalID, version, kubeletSecret, cluster)
+	if err != nil {
+		return err
+	}
+
+	var nodePoolErrs NodePoolErrors
+	for _, nodePool := range cluster.NodePools {
+		err := p.provisionNodePool(ctx, logger, cluster, nodePool, channelConfig, config, subscriptionID, resourceGroup)
+		if err != nil {
+			logger.Errorf("Failed to provision node pool %s: %v", nodePool.Name, err)
+			nodePoolErrs = append(nodePoolErrs, newNodePoolError(nodePool.Name, err))
+		}
+	}
+
+	if len(nodePoolErrs) > 0 {
+		return nodePoolErrs
+	}
+
+	return nil
+}
+
+// azureClusterLocation returns the subscription and the resource group of the
+// cluster.
+func azureClusterLocation(cluster *api.Cluster) (string, string, error) {
+	subscriptionID := strings.TrimPrefix(cluster.InfrastructureAccount, azureAccountPrefix)
+	if subscriptionID == cluster.InfrastructureAccount || subscriptionID == "" {
+		return "", "", fmt.Errorf("invalid Azure infrastructure account '%s'", cluster.InfrastructureAccount)
+	}
+
+	resourceGroup, ok := cluster.ConfigItems[azureResourceGroupConfigItemKey]
+	if !ok {
+		resourceGroup = cluster.LocalID
+	}
+
+	return subscriptionID, resourceGroup, nil
+}
+
+// azureScaleSetName returns the name of the scale set and the deployment of
+// the node pool.
+func azureScaleSetName(cluster *api.Cluster, nodePool *api.NodePool) string {
+	return fmt.Sprintf("%s-%s", cluster.LocalID, nodePool.Name)
+}
+
+// provisionNodePool deploys the template of the node pool's profile and waits
+// for the deployment to finish. The current capacity of an existing scale set
+// is preserved within the limits of the node pool, so that provisioning
+// doesn't undo the scaling done by the autoscaler.
+func (p *azureProvisioner) provisionNodePool(ctx context.Context, logger *log.Entry, cluster *api.Cluster, nodePool *api.NodePool, channelConfig *channel.Config, config map[string]string, subscriptionID, resourceGroup string) error {
+	basePath := path.Join(channelConfig.Path, "cluster")
+	name := azureScaleSetName(cluster, nodePool)
+
+	if p.dryRun {
+		_, err := azureNodePoolDeployment(cluster, nodePool, basePath, config, nodePool.MinSize)
+		if err != nil {
+			return err
+		}
+		logger.Infof("Dry run: skipping deployment %s of node pool %s", name, nodePool.Name)
+		return nil
+	}
+
+	capacity, exists, err := p.scaleSets.Capacity(ctx, subscriptionID, resourceGroup, name)
+	if err != nil {
+		return err
+	}
+	if !exists || capacity < nodePool.MinSize {
+		capacity = nodePool.MinSize
+	}
+	if capacity > nodePool.MaxSize {
+		capacity = nodePool.MaxSize
+	}
+
+	deployment, err := azureNodePoolDeployment(cluster, nodePool, basePath, config, capacity)
+	if err != nil {
+		return err
+	}
+
+	logger.Infof("Deploying node pool %s as %s in resource group %s", nodePool.Name, name, resourceGroup)
+	err = p.deployments.CreateOrUpdate(ctx, subscriptionID, resourceGroup, name, deployment)
+	if err != nil {
+		return err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, maxWaitTimeout)
+	defer cancel()
+	err = p.waitForDeployment(waitCtx, subscriptionID, resourceGroup, name)
+	if err != nil {
+		return err
+	}
+
+	hash, err := azureDeploymentHash(deployment)
+	if err != nil {
+		return err
+	}
+	setNodePoolStatus(cluster, nodePool, hash, azureDeploymentSucceeded)
+	return nil
+}
+
+// azureDeploymentHash returns the hash of the deployment without its
+// capacity, which changes with the scaling of the node pool rather than with
+// its configuration.
+func azureDeploymentHash(deployment *azureDeployment) (string, error) {
+	hashed := *deployment
+	hashed.Properties.Parameters = make(map[string]azureDeploymentValue, len(deployment.Properties.Parameters))
+	for key, value := range deployment.Properties.Parameters {
+		if key != "capacity" {
+			hashed.Properties.Parameters[key] = value
+		}
+	}
+
+	data, err := json.Marshal(&hashed)
+	if err != nil {
+		return "", err
+	}
+	return templateHash(string(data)), nil
+}
+
+// waitForDeployment waits until the deployment succeeded or failed.
+func (p *azureProvisioner) waitForDeployment(ctx context.Context, subscriptionID, resourceGroup, name string) error {
+	for {
+		deployment, err := p.deployments.Get(ctx, subscriptionID, resourceGroup, name)
+		if err != nil {
+			return err
+		}
+
+		switch deployment.Properties.ProvisioningState {
+		case azureDeploymentSucceeded:
+			return nil
+		case azureDeploymentFailed, azureDeploymentCanceled:
+			if deployment.Properties.Error != nil {
+				return fmt.Errorf("deployment %s %s: %v", name, strings.ToLower(deployment.Properties.ProvisioningState), deployment.Properties.Error)
+			}
+			return fmt.Errorf("deployment %s %s", name, strings.ToLower(deployment.Properties.ProvisioningState))
+		}
+
+		select {
+		case <-ctx.Done():
+			return errTimeoutExceeded
+		case <-time.After(p.waitTime):
+		}
+	}
+}
+
+// azureNodePoolDeployment returns the deployment of the template of the node
+// pool's profile with the given capacity. Only the parameters declared by the
+// template are passed. The userdata contains secrets, so the template has to
+// declare `customData` as a secureString to keep it out of the deployment
+// history.
+func azureNodePoolDeployment(cluster *api.Cluster, nodePool *api.NodePool, basePath string, config map[string]string, capacity int64) (*azureDeployment, error) {
+	role := "worker"
+	if strings.HasPrefix(nodePool.Profile, "master") {
+		role = "master"
+	}
+
+	userData, _, err := renderNodePoolUserData(basePath, role, nodePool, nodePoolUserDataConfig(config, nodePool), cluster.ConfigValues, platform.Azure)
+	if err != nil {
+		return nil, err
+	}
+
+	templatePath := path.Join(basePath, "node-pools", nodePool.Profile, azureTemplateFile)
+	template, err := readProfileJSON(basePath, nodePool.Profile, azureTemplateFile)
+	if err != nil {
+		return nil, err
+	}
+
+	var declared struct {
+		Parameters map[string]struct {
+			Type string `json:"type"`
+		} `json:"parameters"`
+		Resources []struct {
+			Type       string `json:"type"`
+			Properties struct {
+				UpgradePolicy struct {
+					Mode string `json:"mode"`
+				} `json:"upgradePolicy"`
+			} `json:"properties"`
+		} `json:"resources"`
+	}
+	err = json.Unmarshal(template, &declared)
+	if err != nil {
+		return nil, fmt.Errorf("invalid template %s: %v", templatePath, err)
+	}
+
+	// the instances of the scale sets aren't replaced by CLM, so the scale
+	// sets have to update them to a changed model themselves. Template
+	// expressions can't be checked.
+	for _, resource := range declared.Resources {
+		mode := resource.Properties.UpgradePolicy.Mode
+		if !strings.EqualFold(resource.Type, azureScaleSetResourceType) || strings.HasPrefix(mode, "[") {
+			continue
+		}
+
+		supported := false
+		for _, upgradeMode := range azureUpgradeModes {
+			if strings.EqualFold(mode, upgradeMode) {
+				supported = true
+			}
+		}
+		if !supported {
+			return nil, fmt.Errorf("template %s must set the upgrade policy of scale sets to one of %s", templatePath, strings.Join(azureUpgradeModes, ", "))
+		}
+	}
+
+	if customData, ok := declared.Parameters["customData"]; ok && !strings.EqualFold(customData.Type, azureSecureString) {
+		return nil, fmt.Errorf("template %s must declare the customData parameter as %s", templatePath, azureSecureString)
+	}
+
+	strategy, err := nodePoolDiscountStrategy(nodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	priority := azurePriorityRegular
+	if strategy.spot() {
+		priority = azurePrioritySpot
+	}
+
+	values := map[string]interface{}{
+		"name":       azureScaleSetName(cluster, nodePool),
+		"location":   cluster.Region,
+		"vmSize":     nodePool.InstanceType,
+		"capacity":   capacity,
+		"customData": base64.StdEncoding.EncodeToString([]byte(userData)),
+		"priority":   priority,
+		"tags": map[string]string{
+			"kubernetes.io/cluster/" + cluster.ID: resourceLifecycleOwned,
+			nodePoolTagKey:                        nodePool.Name,
+			"Profile":                             nodePool.Profile,
+		},
+	}
+
+	// spot instances must not silently be launched as regular instances.
+	if _, ok := declared.Parameters["priority"]; !ok && priority == azurePrioritySpot {
+		return nil, fmt.Errorf("template %s doesn't support the %s discount strategy", templatePath, nodePool.DiscountStrategy)
+	}
+
+	parameters := make(map[string]azureDeploymentValue, len(declared.Parameters))
+	for key := range declared.Parameters {
+		if value, ok := values[key]; ok {
+			parameters[key] = azureDeploymentValue{Value: value}
+		}
+	}
+
+	return &azureDeployment{
+		Properties: azureDeploymentProperties{
+			Mode:       "Incremental",
+			Template:   json.RawMessage(template),
+			Parameters: parameters,
+		},
+	}, nil
+}
+
+// Decommission deletes the resource group of the cluster along with all of
+// its resources. If the resource group is set by the azure_resource_group
+// config item it may be shared with other clusters, so only the scale sets and
+// deployments of the node pools are deleted. Resources which are already gone
+// are skipped, so a failed decommission continues where it stopped when it's
+// retried.
+func (p *azureProvisioner) Decommission(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	if cluster.Provider != azureProviderID {
+		return ErrProviderNotSupported
+	}
+
+	subscriptionID, resourceGroup, err := azureClusterLocation(cluster)
+	if err != nil {
+		return err
+	}
+
+	logger := log.WithField("cluster", cluster.Alias)
+	_, shared := cluster.ConfigItems[azureResourceGroupConfigItemKey]
+
+	if p.dryRun {
+		logger.Infof("Dry run: skipping decommission of the node pools in resource group %s", resourceGroup)
+		return nil
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, maxWaitTimeout)
+	defer cancel()
+
+	if !shared {
+		logger.Infof("Deleting resource group %s", resourceGroup)
+		err = p.resourceGroups.Delete(ctx, subscriptionID, resourceGroup)
+		if err != nil && !isAzureNotFound(err) {
+			return err
+		}
+
+		return p.waitForDeletion(waitCtx, func() (bool, error) {
+			return p.resourceGroups.Exists(waitCtx, subscriptionID, resourceGroup)
+		})
+	}
+
+	for _, nodePool := range cluster.NodePools {
+		name := azureScaleSetName(cluster, nodePool)
+
+		logger.Infof("Deleting scale set %s of node pool %s", name, nodePool.Name)
+		err = p.scaleSets.Delete(ctx, subscriptionID, resourceGroup, name)
+		if err != nil && !isAzureNotFound(err) {
+			return err
+		}
+
+		err = p.waitForDeletion(waitCtx, func() (bool, error) {
+			_, exists, err := p.scaleSets.Capacity(waitCtx, subscriptionID, resourceGroup, name)
+			return exists, err
+		})
+		if err != nil {
+			return err
+		}
+
+		err = p.deployments.Delete(ctx, subscriptionID, resourceGroup, name)
+		if err != nil && !isAzureNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// waitForDeletion waits until exists reports a deleted resource as gone.
+func (p *azureProvisioner) waitForDeletion(ctx context.Context, exists func() (bool, error)) error {
+	for {
+		found, err := exists()
+		if err != nil {
+			return err
+		}
+		if !found {
+			return nil
+		}
+
+		select {
+		case <-ctx.Done():
+			return errTimeoutExceeded
+		case <-time.After(p.waitTime):
+		}
+	}
+}
+
+// Suspend deallocates the instances of the scale sets of all node pools of
+// the cluster. The disks of the instances are kept, such that Resume starts
+// the same instances again. Scale sets which don't exist are skipped.
+func (p *azureProvisioner) Suspend(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	if cluster.Provider != azureProviderID {
+		return ErrProviderNotSupported
+	}
+
+	return p.forEachScaleSet(cluster, "Deallocating", func(subscriptionID, resourceGroup, name string) error {
+		return p.scaleSets.Deallocate(ctx, subscriptionID, resourceGroup, name)
+	})
+}
+
+// Resume starts the deallocated instances of the scale sets of all node pools
+// of a suspended cluster.
+func (p *azureProvisioner) Resume(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	if cluster.Provider != azureProviderID {
+		return ErrProviderNotSupported
+	}
+
+	return p.forEachScaleSet(cluster, "Starting", func(subscriptionID, resourceGroup, name string) error {
+		return p.scaleSets.Start(ctx, subscriptionID, resourceGroup, name)
+	})
+}
+
+// forEachScaleSet calls fn with the scale sets of all node pools of the
+// cluster, logging the action. Scale sets which don't exist are skipped.
+func (p *azureProvisioner) forEachScaleSet(cluster *api.Cluster, action string, fn func(subscriptionID, resourceGroup, name string) error) error {
+	subscriptionID, resourceGroup, err := azureClusterLocation(cluster)
+	if err != nil {
+		return err
+	}
+
+	logger := log.WithField("cluster", cluster.Alias)
+	for _, nodePool := range cluster.NodePools {
+		name := azureScaleSetName(cluster, nodePool)
+		if p.dryRun {
+			logger.Infof("Dry run: skipping %s the instances of scale set %s", strings.ToLower(action), name)
+			continue
+		}
+
+		logger.Infof("%s the instances of scale set %s of node pool %s", action, name, nodePool.Name)
+		err := fn(subscriptionID, resourceGroup, name)
+		if err != nil && !isAzureNotFound(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reconcile does nothing for Azure clusters, the startup taint is only
+// removed from the nodes of AWS clusters.
+func (p *azureProvisioner) Reconcile(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	if cluster.Provider != azureProviderID {
+		return ErrProviderNotSupported
+	}
+
+	return nil
+}
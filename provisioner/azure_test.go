@@ -0,0 +1,455 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+const testAzureTemplate = `{
+  "parameters": {
+    "name": {"type": "string"},
+    "vmSize": {"type": "string"},
+    "capacity": {"type": "int"},
+    "customData": {"type": "secureString"},
+    "tags": {"type": "object"}
+  },
+  "resources": []
+}`
+
+type azureDeploymentsAPIStub struct {
+	deployments map[string]*azureDeployment
+	state       string
+	deleted     []string
+}
+
+func (a *azureDeploymentsAPIStub) CreateOrUpdate(ctx context.Context, subscriptionID, resourceGroup, name string, deployment *azureDeployment) error {
+	a.deployments[subscriptionID+"/"+resourceGroup+"/"+name] = deployment
+	return nil
+}
+
+func (a *azureDeploymentsAPIStub) Get(ctx context.Context, subscriptionID, resourceGroup, name string) (*azureDeployment, error) {
+	deployment := &azureDeployment{}
+	deployment.Properties.ProvisioningState = a.state
+	if a.state == azureDeploymentFailed {
+		deployment.Properties.Error = &azureErrorDetails{Code: "QuotaExceeded", Message: "not enough cores"}
+	}
+	return deployment, nil
+}
+
+func (a *azureDeploymentsAPIStub) Delete(ctx context.Context, subscriptionID, resourceGroup, name string) error {
+	a.deleted = append(a.deleted, subscriptionID+"/"+resourceGroup+"/"+name)
+	return nil
+}
+
+type azureScaleSetsAPIStub struct {
+	capacities  map[string]int64
+	deallocated []string
+	started     []string
+}
+
+func (a *azureScaleSetsAPIStub) Capacity(ctx context.Context, subscriptionID, resourceGroup, name string) (int64, bool, error) {
+	capacity, ok := a.capacities[subscriptionID+"/"+resourceGroup+"/"+name]
+	return capacity, ok, nil
+}
+
+func (a *azureScaleSetsAPIStub) Deallocate(ctx context.Context, subscriptionID, resourceGroup, name string) error {
+	a.deallocated = append(a.deallocated, subscriptionID+"/"+resourceGroup+"/"+name)
+	return nil
+}
+
+func (a *azureScaleSetsAPIStub) Start(ctx context.Context, subscriptionID, resourceGroup, name string) error {
+	a.started = append(a.started, subscriptionID+"/"+resourceGroup+"/"+name)
+	return nil
+}
+
+func (a *azureScaleSetsAPIStub) Delete(ctx context.Context, subscriptionID, resourceGroup, name string) error {
+	key := subscriptionID + "/" + resourceGroup + "/" + name
+	if _, ok := a.capacities[key]; !ok {
+		return &azureErrorDetails{Code: azureResourceNotFound, Message: "not found"}
+	}
+	delete(a.capacities, key)
+	return nil
+}
+
+type azureResourceGroupsAPIStub struct {
+	groups map[string]bool
+}
+
+func (a *azureResourceGroupsAPIStub) Exists(ctx context.Context, subscriptionID, name string) (bool, error) {
+	return a.groups[subscriptionID+"/"+name], nil
+}
+
+func (a *azureResourceGroupsAPIStub) Delete(ctx context.Context, subscriptionID, name string) error {
+	delete(a.groups, subscriptionID+"/"+name)
+	return nil
+}
+
+func testAzureChannel(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "azure")
+	require.NoError(t, err)
+
+	profileDir := path.Join(dir, "cluster", "node-pools", "worker-default")
+	require.NoError(t, os.MkdirAll(profileDir, 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "cluster", "userdata-worker.yaml"), []byte("#cloud-config\npool: {{NODE_POOL}}\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(profileDir, azureTemplateFile), []byte(testAzureTemplate), 0644))
+	return dir
+}
+
+func testAzureCluster() *api.Cluster {
+	return &api.Cluster{
+		ID:                    "azure:8b1c0b5a:westeurope:kube-1",
+		LocalID:               "kube-1",
+		InfrastructureAccount: "azure:8b1c0b5a",
+		APIServerURL:          "https://kube-1.foo.example.org/",
+		Provider:              azureProviderID,
+		Region:                "westeurope",
+		ConfigItems: map[string]string{
+			"worker_shared_secret": "secret",
+			"azure_resource_group": "kubernetes",
+		},
+		NodePools: []*api.NodePool{
+			{
+				Name:         "default",
+				Profile:      "worker-default",
+				InstanceType: "Standard_D4s_v3",
+				MinSize:      3,
+				MaxSize:      20,
+			},
+		},
+	}
+}
+
+func TestAzureProvision(t *testing.T) {
+	dir := testAzureChannel(t)
+	defer os.RemoveAll(dir)
+
+	stub := &azureDeploymentsAPIStub{deployments: make(map[string]*azureDeployment), state: azureDeploymentSucceeded}
+	p := &azureProvisioner{deployments: stub, scaleSets: &azureScaleSetsAPIStub{}}
+
+	cluster := testAzureCluster()
+	err := p.Provision(context.Background(), cluster, &channel.Config{Path: dir})
+	require.NoError(t, err)
+	require.Len(t, cluster.Status.NodePools, 1)
+	assert.Equal(t, "default", cluster.Status.NodePools[0].Name)
+	assert.Equal(t, azureDeploymentSucceeded, cluster.Status.NodePools[0].StackStatus)
+	assert.NotEmpty(t, cluster.Status.NodePools[0].TemplateHash)
+
+	deployment, ok := stub.deployments["8b1c0b5a/kubernetes/kube-1-default"]
+	require.True(t, ok)
+	assert.Equal(t, "Incremental", deployment.Properties.Mode)
+	assert.Len(t, deployment.Properties.Parameters, 5)
+	assert.Equal(t, "Standard_D4s_v3", deployment.Properties.Parameters["vmSize"].Value)
+	assert.Equal(t, int64(3), deployment.Properties.Parameters["capacity"].Value)
+	userData, err := base64.StdEncoding.DecodeString(deployment.Properties.Parameters["customData"].Value.(string))
+	require.NoError(t, err)
+	assert.Equal(t, "#cloud-config\npool: default\n", string(userData))
+
+	stub.state = azureDeploymentFailed
+	err = p.Provision(context.Background(), testAzureCluster(), &channel.Config{Path: dir})
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "QuotaExceeded: not enough cores")
+}
+
+func TestAzureProvisionPreservesCapacity(t *testing.T) {
+	dir := testAzureChannel(t)
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		msg      string
+		current  map[string]int64
+		expected int64
+	}{
+		{
+			msg:      "new scale sets start with the minimum size",
+			expected: 3,
+		},
+		{
+			msg:      "the current capacity is preserved",
+			current:  map[string]int64{"8b1c0b5a/kubernetes/kube-1-default": 12},
+			expected: 12,
+		},
+		{
+			msg:      "the capacity is raised to the minimum size",
+			current:  map[string]int64{"8b1c0b5a/kubernetes/kube-1-default": 1},
+			expected: 3,
+		},
+		{
+			msg:      "the capacity is lowered to the maximum size",
+			current:  map[string]int64{"8b1c0b5a/kubernetes/kube-1-default": 25},
+			expected: 20,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			stub := &azureDeploymentsAPIStub{deployments: make(map[string]*azureDeployment), state: azureDeploymentSucceeded}
+			p := &azureProvisioner{deployments: stub, scaleSets: &azureScaleSetsAPIStub{capacities: tc.current}}
+
+			cluster := testAzureCluster()
+			require.NoError(t, p.Provision(context.Background(), cluster, &channel.Config{Path: dir}))
+
+			deployment, ok := stub.deployments["8b1c0b5a/kubernetes/kube-1-default"]
+			require.True(t, ok)
+			assert.Equal(t, tc.expected, deployment.Properties.Parameters["capacity"].Value)
+		})
+	}
+}
+
+func TestAzureDeploymentHashIgnoresCapacity(t *testing.T) {
+	deployment := func(capacity int64, vmSize string) *azureDeployment {
+		return &azureDeployment{
+			Properties: azureDeploymentProperties{
+				Mode: "Incremental",
+				Parameters: map[string]azureDeploymentValue{
+					"capacity": {Value: capacity},
+					"vmSize":   {Value: vmSize},
+				},
+			},
+		}
+	}
+
+	hash, err := azureDeploymentHash(deployment(3, "Standard_D4s_v3"))
+	require.NoError(t, err)
+	scaled, err := azureDeploymentHash(deployment(10, "Standard_D4s_v3"))
+	require.NoError(t, err)
+	resized, err := azureDeploymentHash(deployment(3, "Standard_D8s_v3"))
+	require.NoError(t, err)
+
+	assert.Equal(t, hash, scaled)
+	assert.NotEqual(t, hash, resized)
+}
+
+func TestAzureProvisionInvalid(t *testing.T) {
+	dir := testAzureChannel(t)
+	defer os.RemoveAll(dir)
+
+	p := &azureProvisioner{deployments: &azureDeploymentsAPIStub{deployments: make(map[string]*azureDeployment)}, scaleSets: &azureScaleSetsAPIStub{}}
+
+	for _, tc := range []struct {
+		msg      string
+		template string
+		modify   func(cluster *api.Cluster)
+	}{
+		{
+			msg: "other providers are not supported",
+			modify: func(cluster *api.Cluster) {
+				cluster.Provider = providerID
+			},
+		},
+		{
+			msg: "infrastructure account must be an Azure subscription",
+			modify: func(cluster *api.Cluster) {
+				cluster.InfrastructureAccount = "aws:123456789012"
+			},
+		},
+		{
+			msg: "spot node pools require a template supporting spot",
+			modify: func(cluster *api.Cluster) {
+				cluster.NodePools[0].DiscountStrategy = discountStrategySpotMaxPrice
+			},
+		},
+		{
+			msg:      "customData must be a secureString",
+			template: strings.Replace(testAzureTemplate, "secureString", "string", 1),
+			modify:   func(cluster *api.Cluster) {},
+		},
+		{
+			msg:      "scale sets must update their instances",
+			template: strings.Replace(testAzureTemplate, `"resources": []`, `"resources": [{"type": "Microsoft.Compute/virtualMachineScaleSets", "properties": {"upgradePolicy": {"mode": "Manual"}}}]`, 1),
+			modify:   func(cluster *api.Cluster) {},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			template := testAzureTemplate
+			if tc.template != "" {
+				template = tc.template
+			}
+			require.NoError(t, ioutil.WriteFile(path.Join(dir, "cluster", "node-pools", "worker-default", azureTemplateFile), []byte(template), 0644))
+
+			cluster := testAzureCluster()
+			tc.modify(cluster)
+			require.Error(t, p.Provision(context.Background(), cluster, &channel.Config{Path: dir}))
+		})
+	}
+}
+
+func TestAzureProvisionUpgradePolicy(t *testing.T) {
+	dir := testAzureChannel(t)
+	defer os.RemoveAll(dir)
+
+	p := &azureProvisioner{deployments: &azureDeploymentsAPIStub{deployments: make(map[string]*azureDeployment), state: azureDeploymentSucceeded}, scaleSets: &azureScaleSetsAPIStub{}}
+
+	for _, mode := range []string{"Rolling", "automatic", "[parameters('upgradeMode')]"} {
+		template := strings.Replace(testAzureTemplate, `"resources": []`, `"resources": [{"type": "Microsoft.Compute/virtualMachineScaleSets", "properties": {"upgradePolicy": {"mode": "`+mode+`"}}}]`, 1)
+		require.NoError(t, ioutil.WriteFile(path.Join(dir, "cluster", "node-pools", "worker-default", azureTemplateFile), []byte(template), 0644))
+		assert.NoError(t, p.Provision(context.Background(), testAzureCluster(), &channel.Config{Path: dir}), mode)
+	}
+}
+
+func TestAzureDecommission(t *testing.T) {
+	deployments := &azureDeploymentsAPIStub{deployments: make(map[string]*azureDeployment)}
+	scaleSets := &azureScaleSetsAPIStub{capacities: map[string]int64{"8b1c0b5a/kubernetes/kube-1-default": 3}}
+	resourceGroups := &azureResourceGroupsAPIStub{groups: map[string]bool{"8b1c0b5a/kubernetes": true, "8b1c0b5a/kube-1": true}}
+	p := &azureProvisioner{deployments: deployments, scaleSets: scaleSets, resourceGroups: resourceGroups}
+
+	// the scale sets of a configured resource group are deleted without
+	// the resource group.
+	cluster := testAzureCluster()
+	require.NoError(t, p.Decommission(context.Background(), cluster, &channel.Config{}))
+	assert.Empty(t, scaleSets.capacities)
+	assert.Equal(t, []string{"8b1c0b5a/kubernetes/kube-1-default"}, deployments.deleted)
+	assert.True(t, resourceGroups.groups["8b1c0b5a/kubernetes"])
+
+	// retrying skips the deleted scale sets.
+	require.NoError(t, p.Decommission(context.Background(), cluster, &channel.Config{}))
+
+	// the resource group of the cluster is deleted with its resources.
+	delete(cluster.ConfigItems, azureResourceGroupConfigItemKey)
+	require.NoError(t, p.Decommission(context.Background(), cluster, &channel.Config{}))
+	assert.Equal(t, map[string]bool{"8b1c0b5a/kubernetes": true}, resourceGroups.groups)
+}
+
+func TestAzureSuspendResume(t *testing.T) {
+	scaleSets := &azureScaleSetsAPIStub{}
+	p := &azureProvisioner{scaleSets: scaleSets}
+
+	cluster := testAzureCluster()
+	require.NoError(t, p.Suspend(context.Background(), cluster, &channel.Config{}))
+	assert.Equal(t, []string{"8b1c0b5a/kubernetes/kube-1-default"}, scaleSets.deallocated)
+	assert.Empty(t, scaleSets.started)
+
+	require.NoError(t, p.Resume(context.Background(), cluster, &channel.Config{}))
+	assert.Equal(t, []string{"8b1c0b5a/kubernetes/kube-1-default"}, scaleSets.started)
+
+	cluster.Provider = providerID
+	assert.Equal(t, ErrProviderNotSupported, p.Suspend(context.Background(), cluster, &channel.Config{}))
+}
+
+func TestAzureDeploymentsClient(t *testing.T) {
+	var created azureDeployment
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, "/subscriptions/sub/resourcegroups/rg/providers/Microsoft.Resources/deployments/kube-1-default", r.URL.Path)
+		assert.Equal(t, azureDeploymentsAPIVersion, r.URL.Query().Get("api-version"))
+
+		switch r.Method {
+		case http.MethodPut:
+			require.NoError(t, json.NewDecoder(r.Body).Decode(&created))
+			w.WriteHeader(http.StatusCreated)
+		case http.MethodGet:
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": "DeploymentNotFound", "message": "not found"}}`))
+		}
+	}))
+	defer server.Close()
+
+	client := &azureDeploymentsClient{client: server.Client(), endpoint: server.URL}
+
+	err := client.CreateOrUpdate(context.Background(), "sub", "rg", "kube-1-default", &azureDeployment{
+		Properties: azureDeploymentProperties{Mode: "Incremental"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "Incremental", created.Properties.Mode)
+
+	_, err = client.Get(context.Background(), "sub", "rg", "kube-1-default")
+	require.Error(t, err)
+	assert.Equal(t, "DeploymentNotFound: not found", err.Error())
+}
+
+func TestAzureScaleSetsClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, azureScaleSetsAPIVersion, r.URL.Query().Get("api-version"))
+
+		switch r.URL.Path {
+		case "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/kube-1-default":
+			w.Write([]byte(`{"name": "kube-1-default", "sku": {"name": "Standard_D4s_v3", "capacity": 7}}`))
+		case "/subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/kube-1-new":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": "ResourceNotFound", "message": "not found"}}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": {"code": "AuthorizationFailed", "message": "forbidden"}}`))
+		}
+	}))
+	defer server.Close()
+
+	client := &azureScaleSetsClient{client: server.Client(), endpoint: server.URL}
+
+	capacity, exists, err := client.Capacity(context.Background(), "sub", "rg", "kube-1-default")
+	require.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, int64(7), capacity)
+
+	_, exists, err = client.Capacity(context.Background(), "sub", "rg", "kube-1-new")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, _, err = client.Capacity(context.Background(), "sub", "rg", "kube-1-other")
+	require.Error(t, err)
+}
+
+func TestAzureScaleSetsClientActions(t *testing.T) {
+	var requests []string
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, azureScaleSetsAPIVersion, r.URL.Query().Get("api-version"))
+		requests = append(requests, r.Method+" "+r.URL.Path)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	defer server.Close()
+
+	client := &azureScaleSetsClient{client: server.Client(), endpoint: server.URL}
+	require.NoError(t, client.Deallocate(context.Background(), "sub", "rg", "kube-1-default"))
+	require.NoError(t, client.Start(context.Background(), "sub", "rg", "kube-1-default"))
+	require.NoError(t, client.Delete(context.Background(), "sub", "rg", "kube-1-default"))
+
+	assert.Equal(t, []string{
+		"POST /subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/kube-1-default/deallocate",
+		"POST /subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/kube-1-default/start",
+		"DELETE /subscriptions/sub/resourceGroups/rg/providers/Microsoft.Compute/virtualMachineScaleSets/kube-1-default",
+	}, requests)
+}
+
+func TestAzureResourceGroupsClient(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, azureResourceGroupsAPIVersion, r.URL.Query().Get("api-version"))
+
+		switch {
+		case r.Method == http.MethodDelete && r.URL.Path == "/subscriptions/sub/resourcegroups/kube-1":
+			w.WriteHeader(http.StatusAccepted)
+		case r.URL.Path == "/subscriptions/sub/resourcegroups/kube-1":
+			w.Write([]byte(`{"name": "kube-1", "properties": {"provisioningState": "Deleting"}}`))
+		case r.URL.Path == "/subscriptions/sub/resourcegroups/kube-2":
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte(`{"error": {"code": "ResourceGroupNotFound", "message": "not found"}}`))
+		default:
+			w.WriteHeader(http.StatusForbidden)
+			w.Write([]byte(`{"error": {"code": "AuthorizationFailed", "message": "forbidden"}}`))
+		}
+	}))
+	defer server.Close()
+
+	client := &azureResourceGroupsClient{client: server.Client(), endpoint: server.URL}
+	require.NoError(t, client.Delete(context.Background(), "sub", "kube-1"))
+
+	exists, err := client.Exists(context.Background(), "sub", "kube-1")
+	require.NoError(t, err)
+	assert.True(t, exists)
+
+	exists, err = client.Exists(context.Background(), "sub", "kube-2")
+	require.NoError(t, err)
+	assert.False(t, exists)
+
+	_, err = client.Exists(context.Background(), "sub", "kube-3")
+	require.Error(t, err)
+}
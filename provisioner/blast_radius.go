@@ -0,0 +1,153 @@
+package provisioner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+const (
+	configKeyMaxReplacedNodes      = "update_max_replaced_nodes"
+	configKeyMaxReplacedCapacity   = "update_max_replaced_capacity_percent"
+	configKeyMaxAffectedNamespaces = "update_max_affected_namespaces"
+	configKeyBlastRadiusOverride   = "update_blast_radius_override"
+)
+
+// blastRadiusPolicy limits the blast radius of the updates of a single node
+// pool. Zero values don't limit the blast radius.
+type blastRadiusPolicy struct {
+	maxNodes      int
+	maxCapacity   float64
+	maxNamespaces int
+	override      bool
+}
+
+// newBlastRadiusPolicy returns the blast radius policy configured by the
+// config items of the cluster.
+func newBlastRadiusPolicy(cluster *api.Cluster) (*blastRadiusPolicy, error) {
+	policy := &blastRadiusPolicy{
+		override: cluster.ConfigItems[configKeyBlastRadiusOverride] == "true",
+	}
+
+	for key, limit := range map[string]*int{
+		configKeyMaxReplacedNodes:      &policy.maxNodes,
+		configKeyMaxAffectedNamespaces: &policy.maxNamespaces,
+	} {
+		if value, ok := cluster.ConfigItems[key]; ok {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 0 {
+				return nil, fmt.Errorf("invalid %s '%s'", key, value)
+			}
+			*limit = parsed
+		}
+	}
+
+	if value, ok := cluster.ConfigItems[configKeyMaxReplacedCapacity]; ok {
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil || parsed < 0 {
+			return nil, fmt.Errorf("invalid %s '%s'", configKeyMaxReplacedCapacity, value)
+		}
+		policy.maxCapacity = parsed
+	}
+
+	return policy, nil
+}
+
+// blastRadiusExceededError is returned when the update of a node pool is
+// blocked because its blast radius exceeds the limits of the cluster.
+type blastRadiusExceededError struct {
+	nodePool   string
+	violations []string
+}
+
+func (e *blastRadiusExceededError) Error() string {
+	return fmt.Sprintf("update of node pool %s exceeds the blast radius limits: %s (set %s to \"true\" to update anyway)", e.nodePool, strings.Join(e.violations, ", "), configKeyBlastRadiusOverride)
+}
+
+// check returns a blastRadiusExceededError if the blast radius of the plan
+// exceeds the limits of the policy, unless the policy is overridden.
+func (p *blastRadiusPolicy) check(plan *updatestrategy.UpdatePlan) error {
+	radius := plan.BlastRadius
+	if p.override || radius == nil {
+		return nil
+	}
+
+	var violations []string
+	if p.maxNodes > 0 && radius.Nodes > p.maxNodes {
+		violations = append(violations, fmt.Sprintf("%d nodes replaced (max %d)", radius.Nodes, p.maxNodes))
+	}
+	if p.maxCapacity > 0 && radius.CapacityPercent > p.maxCapacity {
+		violations = append(violations, fmt.Sprintf("%.1f%% of the cluster capacity replaced (max %g%%)", radius.CapacityPercent, p.maxCapacity))
+	}
+	if p.maxNamespaces > 0 && len(radius.Namespaces) > p.maxNamespaces {
+		violations = append(violations, fmt.Sprintf("%d namespaces affected (max %d)", len(radius.Namespaces), p.maxNamespaces))
+	}
+
+	if len(violations) == 0 {
+		return nil
+	}
+
+	return &blastRadiusExceededError{
+		nodePool:   plan.NodePool,
+		violations: violations,
+	}
+}
+
+// checkNodePools returns a blastRadiusExceededError if replacing all nodes of
+// one of the node pools exceeds the limits of the policy, unless the policy
+// is overridden or doesn't limit the blast radius.
+func (p *blastRadiusPolicy) checkNodePools(manager updatestrategy.NodePoolManager, nodePools []*api.NodePool) error {
+	if p.override || (p.maxNodes == 0 && p.maxCapacity == 0 && p.maxNamespaces == 0) {
+		return nil
+	}
+
+	for _, nodePool := range nodePools {
+		pool, err := manager.GetPool(nodePool)
+		if err != nil {
+			return err
+		}
+
+		radius, err := manager.BlastRadius(pool.Nodes)
+		if err != nil {
+			return err
+		}
+
+		err = p.check(&updatestrategy.UpdatePlan{NodePool: nodePool.Name, BlastRadius: radius})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// changedNodePools returns the node pools of the cluster whose userdata
+// differs from the one recorded in the status of the cluster by their last
+// provisioning, i.e. the node pools whose nodes are all replaced once the new
+// userdata is in use. Node pools without a recorded or a new template hash
+// are skipped.
+func changedNodePools(cluster *api.Cluster, templateHashes map[string]string) []*api.NodePool {
+	if cluster.Status == nil {
+		return nil
+	}
+
+	recorded := make(map[string]string, len(cluster.Status.NodePools))
+	for _, status := range cluster.Status.NodePools {
+		recorded[status.Name] = status.TemplateHash
+	}
+
+	var changed []*api.NodePool
+	for _, nodePool := range cluster.NodePools {
+		hash := templateHashes[nodePool.Name]
+		if hash == "" || recorded[nodePool.Name] == "" {
+			continue
+		}
+		if hash != recorded[nodePool.Name] {
+			changed = append(changed, nodePool)
+		}
+	}
+	return changed
+}
@@ -0,0 +1,127 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+func TestBlastRadiusPolicy(t *testing.T) {
+	plan := &updatestrategy.UpdatePlan{
+		NodePool: "default-worker",
+		BlastRadius: &updatestrategy.BlastRadius{
+			Nodes:           10,
+			ClusterNodes:    20,
+			CapacityPercent: 50,
+			Namespaces:      []string{"default", "kube-system", "teapot"},
+		},
+	}
+
+	for _, tc := range []struct {
+		msg         string
+		configItems map[string]string
+		violations  []string
+	}{
+		{
+			msg:         "test no limits",
+			configItems: map[string]string{},
+		},
+		{
+			msg: "test within limits",
+			configItems: map[string]string{
+				configKeyMaxReplacedNodes:      "10",
+				configKeyMaxReplacedCapacity:   "50",
+				configKeyMaxAffectedNamespaces: "3",
+			},
+		},
+		{
+			msg: "test exceeding limits",
+			configItems: map[string]string{
+				configKeyMaxReplacedNodes:      "5",
+				configKeyMaxReplacedCapacity:   "33.3",
+				configKeyMaxAffectedNamespaces: "3",
+			},
+			violations: []string{
+				"10 nodes replaced (max 5)",
+				"50.0% of the cluster capacity replaced (max 33.3%)",
+			},
+		},
+		{
+			msg: "test override",
+			configItems: map[string]string{
+				configKeyMaxReplacedNodes:    "5",
+				configKeyBlastRadiusOverride: "true",
+			},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			policy, err := newBlastRadiusPolicy(&api.Cluster{ConfigItems: tc.configItems})
+			require.NoError(t, err)
+
+			err = policy.check(plan)
+			if len(tc.violations) == 0 {
+				assert.NoError(t, err)
+				return
+			}
+
+			exceeded, ok := err.(*blastRadiusExceededError)
+			require.True(t, ok, "expected blast radius exceeded error, got %v", err)
+			assert.Equal(t, tc.violations, exceeded.violations)
+		})
+	}
+
+	policy, err := newBlastRadiusPolicy(&api.Cluster{ConfigItems: map[string]string{configKeyMaxReplacedNodes: "3"}})
+	require.NoError(t, err)
+	assert.NoError(t, policy.check(&updatestrategy.UpdatePlan{NodePool: "default-worker"}))
+
+	for _, key := range []string{configKeyMaxReplacedNodes, configKeyMaxReplacedCapacity, configKeyMaxAffectedNamespaces} {
+		_, err := newBlastRadiusPolicy(&api.Cluster{ConfigItems: map[string]string{key: "-1"}})
+		assert.Error(t, err)
+	}
+}
+
+func TestBlastRadiusPolicyCheckNodePools(t *testing.T) {
+	master := &api.NodePool{Name: "master-default", MinSize: 1, MaxSize: 1}
+	worker := &api.NodePool{Name: "worker-default", MinSize: 3, MaxSize: 3}
+	cluster := &api.Cluster{ID: "cluster-id", NodePools: []*api.NodePool{master, worker}}
+
+	pools := newFakeNodePools()
+	pools.sync(cluster, map[string]string{})
+	manager := &fakeNodePoolManager{pools: pools, clusterID: cluster.ID}
+
+	policy, err := newBlastRadiusPolicy(&api.Cluster{ConfigItems: map[string]string{configKeyMaxReplacedNodes: "2"}})
+	require.NoError(t, err)
+	assert.NoError(t, policy.checkNodePools(manager, []*api.NodePool{master}))
+
+	err = policy.checkNodePools(manager, []*api.NodePool{master, worker})
+	exceeded, ok := err.(*blastRadiusExceededError)
+	require.True(t, ok, "expected blast radius exceeded error, got %v", err)
+	assert.Equal(t, "worker-default", exceeded.nodePool)
+	assert.Equal(t, []string{"3 nodes replaced (max 2)"}, exceeded.violations)
+
+	policy.override = true
+	assert.NoError(t, policy.checkNodePools(manager, []*api.NodePool{worker}))
+}
+
+func TestChangedNodePools(t *testing.T) {
+	cluster := &api.Cluster{
+		NodePools: []*api.NodePool{
+			{Name: "master-default"},
+			{Name: "worker-default"},
+			{Name: "worker-new"},
+		},
+	}
+	hashes := map[string]string{"master-default": "a", "worker-default": "b", "worker-new": "c"}
+	assert.Empty(t, changedNodePools(cluster, hashes))
+
+	cluster.Status = &api.ClusterStatus{
+		NodePools: []*api.NodePoolStatus{
+			{Name: "master-default", TemplateHash: "a"},
+			{Name: "worker-default", TemplateHash: "old"},
+		},
+	}
+	assert.Equal(t, []*api.NodePool{cluster.NodePools[1]}, changedNodePools(cluster, hashes))
+}
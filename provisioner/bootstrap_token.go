@@ -0,0 +1,258 @@
+package provisioner
+
+import (
+	"crypto/rand"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	log "github.com/sirupsen/logrus"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// configKeyBootstrapTokenRotationInterval enables the rotation of the
+	// kubelet bootstrap token of the cluster, a new token is generated
+	// once the current token is older than the interval.
+	configKeyBootstrapTokenRotationInterval = "bootstrap_token_rotation_interval"
+	// configKeyBootstrapTokenKMSKey is the KMS key encrypting the SSM
+	// parameter of the bootstrap token, the account's default key for SSM
+	// if empty.
+	configKeyBootstrapTokenKMSKey = "bootstrap_token_kms_key"
+	// bootstrapTokenConfigItemKey is the config item with the current
+	// bootstrap token, BOOTSTRAP_TOKEN in the userdata templates.
+	bootstrapTokenConfigItemKey = "bootstrap_token"
+	// bootstrapTokenParameterFormat is the SSM parameter of the bootstrap
+	// token of a cluster, formatted with the local ID of the cluster.
+	bootstrapTokenParameterFormat = "/cluster-lifecycle-manager/%s/bootstrap-token"
+	// bootstrapTokenLabel labels the bootstrap token secrets created by CLM,
+	// such that only those are revoked.
+	bootstrapTokenLabel = "cluster-lifecycle-manager.zalando.org/bootstrap-token"
+	// bootstrapTokenSecretType is the type of the bootstrap token secrets.
+	bootstrapTokenSecretType = "bootstrap.kubernetes.io/token"
+	// bootstrapTokenSecretPrefix is the prefix of the names of the
+	// bootstrap token secrets, followed by the token ID.
+	bootstrapTokenSecretPrefix = "bootstrap-token-"
+	// bootstrapTokenCharset are the characters of the bootstrap tokens.
+	bootstrapTokenCharset = "abcdefghijklmnopqrstuvwxyz0123456789"
+)
+
+// bootstrapToken is a kubelet bootstrap token of the form <id>.<secret>.
+type bootstrapToken struct {
+	id     string
+	secret string
+}
+
+func (t *bootstrapToken) String() string {
+	return t.id + "." + t.secret
+}
+
+// secretName returns the name of the secret of the token in kube-system.
+func (t *bootstrapToken) secretName() string {
+	return bootstrapTokenSecretPrefix + t.id
+}
+
+// newBootstrapToken generates a random bootstrap token with a 6 character ID
+// and a 16 character secret.
+func newBootstrapToken() (*bootstrapToken, error) {
+	id, err := randomBootstrapTokenString(6)
+	if err != nil {
+		return nil, err
+	}
+	secret, err := randomBootstrapTokenString(16)
+	if err != nil {
+		return nil, err
+	}
+	return &bootstrapToken{id: id, secret: secret}, nil
+}
+
+func randomBootstrapTokenString(length int) (string, error) {
+	max := big.NewInt(int64(len(bootstrapTokenCharset)))
+	result := make([]byte, length)
+	for i := range result {
+		n, err := rand.Int(rand.Reader, max)
+		if err != nil {
+			return "", err
+		}
+		result[i] = bootstrapTokenCharset[n.Int64()]
+	}
+	return string(result), nil
+}
+
+// parseBootstrapToken parses a bootstrap token of the form <id>.<secret>.
+func parseBootstrapToken(value string) (*bootstrapToken, error) {
+	parts := strings.Split(value, ".")
+	if len(parts) != 2 || len(parts[0]) != 6 || len(parts[1]) != 16 {
+		return nil, fmt.Errorf("invalid bootstrap token, must be <6 characters>.<16 characters>")
+	}
+	for _, c := range value {
+		if c != '.' && !strings.ContainsRune(bootstrapTokenCharset, c) {
+			return nil, fmt.Errorf("invalid bootstrap token, must only contain [a-z0-9]")
+		}
+	}
+	return &bootstrapToken{id: parts[0], secret: parts[1]}, nil
+}
+
+// bootstrapTokenParameterValue returns the value of the SSM parameter of the
+// token, the token followed by the time it was created, because the SSM
+// parameters returned by GetParameter don't include their modification time.
+func bootstrapTokenParameterValue(token *bootstrapToken, created time.Time) string {
+	return token.String() + " " + created.UTC().Format(time.RFC3339)
+}
+
+// parseBootstrapTokenParameter parses the value of the SSM parameter of the
+// token into the token and the time it was created.
+func parseBootstrapTokenParameter(value string) (*bootstrapToken, time.Time, error) {
+	parts := strings.Split(value, " ")
+	if len(parts) != 2 {
+		return nil, time.Time{}, fmt.Errorf("invalid value, must be <token> <creation time>")
+	}
+	token, err := parseBootstrapToken(parts[0])
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	created, err := time.Parse(time.RFC3339, parts[1])
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("invalid creation time: %v", err)
+	}
+	return token, created, nil
+}
+
+// rotateBootstrapToken returns a copy of the cluster with the bootstrap token
+// in its config items and the token, or the cluster as it is if the rotation
+// isn't enabled. The token is stored with its creation time in a KMS
+// encrypted SSM parameter and replaced by a new token once it's older than the rotation interval. The
+// new token changes the userdata, which replaces all nodes. In dry run mode
+// a new token isn't stored.
+func (a *awsAdapter) rotateBootstrapToken(cluster *api.Cluster) (*api.Cluster, *bootstrapToken, error) {
+	value, ok := cluster.ConfigItems[configKeyBootstrapTokenRotationInterval]
+	if !ok {
+		return cluster, nil, nil
+	}
+
+	interval, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid %s: %v", configKeyBootstrapTokenRotationInterval, err)
+	}
+
+	name := fmt.Sprintf(bootstrapTokenParameterFormat, cluster.LocalID)
+	var token *bootstrapToken
+	resp, err := a.ssmClient.GetParameter(&ssm.GetParameterInput{
+		Name:           aws.String(name),
+		WithDecryption: aws.Bool(true),
+	})
+	if err != nil {
+		if awsErr, ok := err.(awserr.Error); !ok || awsErr.Code() != ssm.ErrCodeParameterNotFound {
+			return nil, nil, fmt.Errorf("failed to get SSM parameter %s: %v", name, err)
+		}
+	} else {
+		var created time.Time
+		token, created, err = parseBootstrapTokenParameter(aws.StringValue(resp.Parameter.Value))
+		if err != nil {
+			return nil, nil, fmt.Errorf("SSM parameter %s: %v", name, err)
+		}
+		if time.Since(created) >= interval {
+			a.logger.Infof("Bootstrap token %s is older than %s, rotating it", token.id, interval)
+			token = nil
+		}
+	}
+
+	if token == nil {
+		token, err = newBootstrapToken()
+		if err != nil {
+			return nil, nil, err
+		}
+
+		if a.dryRun {
+			a.logger.Infof("[DRY RUN] Would store bootstrap token %s in SSM parameter %s", token.id, name)
+		} else {
+			input := &ssm.PutParameterInput{
+				Name:        aws.String(name),
+				Description: aws.String(fmt.Sprintf("Kubelet bootstrap token of cluster %s", cluster.ID)),
+				Type:        aws.String(ssm.ParameterTypeSecureString),
+				Value:       aws.String(bootstrapTokenParameterValue(token, time.Now())),
+				Overwrite:   aws.Bool(true),
+			}
+			if key := cluster.ConfigItems[configKeyBootstrapTokenKMSKey]; key != "" {
+				input.KeyId = aws.String(key)
+			}
+			_, err = a.ssmClient.PutParameter(input)
+			if err != nil {
+				return nil, nil, fmt.Errorf("failed to store bootstrap token in SSM parameter %s: %v", name, err)
+			}
+			a.logger.Infof("Stored new bootstrap token %s in SSM parameter %s", token.id, name)
+		}
+	}
+
+	configItems := make(map[string]string, len(cluster.ConfigItems)+1)
+	for key, value := range cluster.ConfigItems {
+		configItems[key] = value
+	}
+	configItems[bootstrapTokenConfigItemKey] = token.String()
+
+	rotated := *cluster
+	rotated.ConfigItems = configItems
+	return &rotated, token, nil
+}
+
+// ensureBootstrapTokenSecret creates the secret of the bootstrap token in
+// kube-system, such that nodes can register with it.
+func ensureBootstrapTokenSecret(client kubernetes.Interface, token *bootstrapToken) error {
+	_, err := client.CoreV1().Secrets(metav1.NamespaceSystem).Get(token.secretName(), metav1.GetOptions{})
+	if err == nil {
+		return nil
+	}
+	if !apierrors.IsNotFound(err) {
+		return err
+	}
+
+	_, err = client.CoreV1().Secrets(metav1.NamespaceSystem).Create(&v1.Secret{
+		ObjectMeta: metav1.ObjectMeta{
+			Name:      token.secretName(),
+			Namespace: metav1.NamespaceSystem,
+			Labels:    map[string]string{bootstrapTokenLabel: "true"},
+		},
+		Type: v1.SecretType(bootstrapTokenSecretType),
+		Data: map[string][]byte{
+			"token-id":                       []byte(token.id),
+			"token-secret":                   []byte(token.secret),
+			"usage-bootstrap-authentication": []byte("true"),
+			"usage-bootstrap-signing":        []byte("true"),
+		},
+	})
+	return err
+}
+
+// revokeBootstrapTokens deletes the bootstrap token secrets created by CLM
+// except the one of the current token. It must only be called once all nodes
+// were replaced by nodes registered with the current token.
+func revokeBootstrapTokens(logger *log.Entry, client kubernetes.Interface, token *bootstrapToken) error {
+	secrets, err := client.CoreV1().Secrets(metav1.NamespaceSystem).List(metav1.ListOptions{
+		LabelSelector: bootstrapTokenLabel + "=true",
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, secret := range secrets.Items {
+		if secret.Name == token.secretName() {
+			continue
+		}
+
+		err := client.CoreV1().Secrets(metav1.NamespaceSystem).Delete(secret.Name, &metav1.DeleteOptions{})
+		if err != nil && !apierrors.IsNotFound(err) {
+			return fmt.Errorf("failed to revoke bootstrap token %s: %v", strings.TrimPrefix(secret.Name, bootstrapTokenSecretPrefix), err)
+		}
+		logger.Infof("Revoked bootstrap token %s", strings.TrimPrefix(secret.Name, bootstrapTokenSecretPrefix))
+	}
+	return nil
+}
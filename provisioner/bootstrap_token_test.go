@@ -0,0 +1,177 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type bootstrapTokenSSMAPIStub struct {
+	ssmAPI
+	parameters map[string]*ssm.Parameter
+	put        *ssm.PutParameterInput
+}
+
+func (s *bootstrapTokenSSMAPIStub) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	parameter, ok := s.parameters[aws.StringValue(input.Name)]
+	if !ok {
+		return nil, awserr.New(ssm.ErrCodeParameterNotFound, "parameter not found", nil)
+	}
+	return &ssm.GetParameterOutput{Parameter: parameter}, nil
+}
+
+func (s *bootstrapTokenSSMAPIStub) PutParameter(input *ssm.PutParameterInput) (*ssm.PutParameterOutput, error) {
+	s.put = input
+	return &ssm.PutParameterOutput{}, nil
+}
+
+func TestParseBootstrapToken(t *testing.T) {
+	token, err := newBootstrapToken()
+	require.NoError(t, err)
+
+	parsed, err := parseBootstrapToken(token.String())
+	require.NoError(t, err)
+	assert.Equal(t, token, parsed)
+
+	for _, invalid := range []string{"", "abcdef", "abcdef.0123456789abcde", "ABCDEF.0123456789abcdef", "abcdef.0123456789abcdef.x"} {
+		_, err := parseBootstrapToken(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestParseBootstrapTokenParameter(t *testing.T) {
+	token := &bootstrapToken{id: "abcdef", secret: "0123456789abcdef"}
+	created := time.Date(2018, 4, 1, 12, 0, 0, 0, time.UTC)
+
+	value := bootstrapTokenParameterValue(token, created)
+	assert.Equal(t, "abcdef.0123456789abcdef 2018-04-01T12:00:00Z", value)
+
+	parsedToken, parsedCreated, err := parseBootstrapTokenParameter(value)
+	require.NoError(t, err)
+	assert.Equal(t, token, parsedToken)
+	assert.Equal(t, created, parsedCreated)
+
+	for _, invalid := range []string{"", "abcdef.0123456789abcdef", "abcdef.0123456789abcdef yesterday", "abcdef 2018-04-01T12:00:00Z"} {
+		_, _, err := parseBootstrapTokenParameter(invalid)
+		assert.Error(t, err, invalid)
+	}
+}
+
+func TestRotateBootstrapToken(t *testing.T) {
+	const parameter = "/cluster-lifecycle-manager/kube-1/bootstrap-token"
+	existing := &bootstrapToken{id: "abcdef", secret: "0123456789abcdef"}
+
+	for _, tc := range []struct {
+		msg       string
+		interval  string
+		parameter *ssm.Parameter
+		dryRun    bool
+		rotated   bool
+		stored    bool
+	}{
+		{
+			msg: "rotation disabled",
+		},
+		{
+			msg:       "current token",
+			interval:  "720h",
+			parameter: &ssm.Parameter{Value: aws.String(bootstrapTokenParameterValue(existing, time.Now().Add(-time.Hour)))},
+			rotated:   false,
+			stored:    false,
+		},
+		{
+			msg:       "expired token",
+			interval:  "720h",
+			parameter: &ssm.Parameter{Value: aws.String(bootstrapTokenParameterValue(existing, time.Now().Add(-800*time.Hour)))},
+			rotated:   true,
+			stored:    true,
+		},
+		{
+			msg:      "missing token",
+			interval: "720h",
+			rotated:  true,
+			stored:   true,
+		},
+		{
+			msg:       "expired token in dry run",
+			interval:  "720h",
+			parameter: &ssm.Parameter{Value: aws.String(bootstrapTokenParameterValue(existing, time.Now().Add(-800*time.Hour)))},
+			dryRun:    true,
+			rotated:   true,
+			stored:    false,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			stub := &bootstrapTokenSSMAPIStub{parameters: map[string]*ssm.Parameter{}}
+			if tc.parameter != nil {
+				stub.parameters[parameter] = tc.parameter
+			}
+			adapter := &awsAdapter{ssmClient: stub, dryRun: tc.dryRun, logger: log.WithField("test", tc.msg)}
+
+			cluster := &api.Cluster{ID: "aws:123456789012:eu-central-1:kube-1", LocalID: "kube-1", ConfigItems: map[string]string{configKeyBootstrapTokenKMSKey: "alias/kube-1"}}
+			if tc.interval != "" {
+				cluster.ConfigItems[configKeyBootstrapTokenRotationInterval] = tc.interval
+			}
+
+			result, token, err := adapter.rotateBootstrapToken(cluster)
+			require.NoError(t, err)
+
+			if tc.interval == "" {
+				assert.Nil(t, token)
+				assert.Equal(t, cluster, result)
+				return
+			}
+
+			require.NotNil(t, token)
+			assert.Equal(t, token.String(), result.ConfigItems[bootstrapTokenConfigItemKey])
+			assert.NotContains(t, cluster.ConfigItems, bootstrapTokenConfigItemKey)
+			assert.Equal(t, tc.rotated, token.id != "abcdef")
+
+			if !tc.stored {
+				assert.Nil(t, stub.put)
+				return
+			}
+			require.NotNil(t, stub.put)
+			assert.Equal(t, parameter, aws.StringValue(stub.put.Name))
+			assert.Equal(t, ssm.ParameterTypeSecureString, aws.StringValue(stub.put.Type))
+			assert.Equal(t, "alias/kube-1", aws.StringValue(stub.put.KeyId))
+			storedToken, created, err := parseBootstrapTokenParameter(aws.StringValue(stub.put.Value))
+			require.NoError(t, err)
+			assert.Equal(t, token, storedToken)
+			assert.WithinDuration(t, time.Now(), created, time.Minute)
+		})
+	}
+}
+
+func TestRevokeBootstrapTokens(t *testing.T) {
+	client := fake.NewSimpleClientset()
+	previous := &bootstrapToken{id: "abcdef", secret: "0123456789abcdef"}
+	current := &bootstrapToken{id: "ghijkl", secret: "0123456789abcdef"}
+
+	require.NoError(t, ensureBootstrapTokenSecret(client, previous))
+	require.NoError(t, ensureBootstrapTokenSecret(client, current))
+	// creating the secret of an existing token is a no-op.
+	require.NoError(t, ensureBootstrapTokenSecret(client, current))
+
+	secret, err := client.CoreV1().Secrets(metav1.NamespaceSystem).Get("bootstrap-token-ghijkl", metav1.GetOptions{})
+	require.NoError(t, err)
+	assert.EqualValues(t, bootstrapTokenSecretType, secret.Type)
+	assert.Equal(t, "ghijkl", string(secret.Data["token-id"]))
+
+	require.NoError(t, revokeBootstrapTokens(log.WithField("test", "revoke"), client, current))
+
+	_, err = client.CoreV1().Secrets(metav1.NamespaceSystem).Get("bootstrap-token-abcdef", metav1.GetOptions{})
+	assert.Error(t, err)
+	_, err = client.CoreV1().Secrets(metav1.NamespaceSystem).Get("bootstrap-token-ghijkl", metav1.GetOptions{})
+	assert.NoError(t, err)
+}
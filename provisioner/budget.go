@@ -0,0 +1,141 @@
+package provisioner
+
+import (
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+)
+
+const (
+	configKeyCostBudget       = "cost_budget_monthly"
+	configKeyCostBudgetAction = "cost_budget_action"
+	costBudgetActionRefuse    = "refuse"
+	costBudgetActionWarn      = "warn"
+	// hoursPerMonth is the average number of hours of a month.
+	hoursPerMonth = 730
+)
+
+// costEstimate is the estimated monthly on-demand cost in USD of the node
+// pools of a cluster at their maximum size.
+type costEstimate struct {
+	// current is the cost of the node pools as currently deployed.
+	current float64
+	// estimated is the cost of the node pools after the update.
+	estimated float64
+}
+
+// delta returns the change of the monthly cost by the update.
+func (e *costEstimate) delta() float64 {
+	return e.estimated - e.current
+}
+
+// costBudgetExceededError is returned when an update would increase the
+// estimated monthly cost of a cluster beyond its budget.
+type costBudgetExceededError struct {
+	cluster  string
+	estimate *costEstimate
+	budget   float64
+}
+
+func (e *costBudgetExceededError) Error() string {
+	return fmt.Sprintf("estimated monthly cost of cluster %s of $%.2f (%+.2f) exceeds its budget of $%.2f (raise %s or set %s to \"%s\" to update anyway)", e.cluster, e.estimate.estimated, e.estimate.delta(), e.budget, configKeyCostBudget, configKeyCostBudgetAction, costBudgetActionWarn)
+}
+
+// nodePoolHourlyPrice returns the hourly on-demand price in USD of a node of
+// the node pool. Spot node pools are estimated at the on-demand price, which
+// is the most they can cost.
+func (a *awsAdapter) nodePoolHourlyPrice(cluster *api.Cluster, nodePool *api.NodePool) (float64, error) {
+	price, err := awsExt.OnDemandPrice(nodePool.InstanceType, cluster.Region, a.priceSource)
+	if err != nil {
+		return 0, err
+	}
+
+	parsed, err := strconv.ParseFloat(price, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price %s of instance type %s: %v", price, nodePool.InstanceType, err)
+	}
+	return parsed, nil
+}
+
+// estimateCost estimates the monthly cost of the node pools of the cluster
+// before and after the update. The current cost is based on the maximum
+// size of the existing ASGs of the node pools, node pools without an ASG
+// yet don't cost anything before the update.
+func (a *awsAdapter) estimateCost(cluster *api.Cluster, stackExists bool) (*costEstimate, error) {
+	estimate := &costEstimate{}
+	for _, nodePool := range cluster.NodePools {
+		price, err := a.nodePoolHourlyPrice(cluster, nodePool)
+		if err != nil {
+			return nil, err
+		}
+		monthly := price * hoursPerMonth
+
+		estimate.estimated += monthly * float64(nodePool.MaxSize)
+
+		if !stackExists {
+			continue
+		}
+
+		asg, err := a.getRenamedNodePoolASG(cluster.LocalID, nodePool)
+		if err != nil {
+			continue
+		}
+		estimate.current += monthly * float64(aws.Int64Value(asg.MaxSize))
+	}
+	return estimate, nil
+}
+
+// checkCostBudget refuses updates increasing the estimated monthly cost of
+// the node pools of the cluster beyond the budget configured in the config
+// items of the cluster, or only warns about them if configured. Clusters
+// without a budget aren't checked.
+func (a *awsAdapter) checkCostBudget(logger *log.Entry, cluster *api.Cluster, stackExists bool) error {
+	value, ok := cluster.ConfigItems[configKeyCostBudget]
+	if !ok {
+		return nil
+	}
+
+	budget, err := strconv.ParseFloat(value, 64)
+	if err != nil || budget < 0 {
+		return fmt.Errorf("invalid %s '%s'", configKeyCostBudget, value)
+	}
+
+	action := costBudgetActionRefuse
+	if value, ok := cluster.ConfigItems[configKeyCostBudgetAction]; ok {
+		action = value
+	}
+	if action != costBudgetActionRefuse && action != costBudgetActionWarn {
+		return fmt.Errorf("invalid %s '%s'", configKeyCostBudgetAction, action)
+	}
+
+	estimate, err := a.estimateCost(cluster, stackExists)
+	if err != nil {
+		return fmt.Errorf("failed to estimate the cost of cluster %s: %v", cluster.ID, err)
+	}
+
+	logger.Infof("Estimated monthly cost of the node pools: $%.2f (%+.2f), budget $%.2f", estimate.estimated, estimate.delta(), budget)
+
+	// updates reducing the cost of a cluster already over its budget
+	// aren't blocked.
+	if estimate.estimated <= budget || estimate.delta() <= 0 {
+		return nil
+	}
+
+	exceeded := &costBudgetExceededError{
+		cluster:  cluster.ID,
+		estimate: estimate,
+		budget:   budget,
+	}
+
+	if action == costBudgetActionWarn {
+		logger.Warn(exceeded.Error())
+		a.summary.AddWarning("%s", exceeded.Error())
+		return nil
+	}
+	return exceeded
+}
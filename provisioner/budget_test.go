@@ -0,0 +1,129 @@
+package provisioner
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type staticPriceSource map[string]string
+
+func (s staticPriceSource) OnDemandPrice(instanceType, region string) (string, error) {
+	price, ok := s[instanceType]
+	if !ok {
+		return "", fmt.Errorf("unknown instance type %s", instanceType)
+	}
+	return price, nil
+}
+
+type nodePoolASGsStub struct {
+	autoscalingAPI
+	maxSizes map[string]int64
+}
+
+func (a *nodePoolASGsStub) DescribeAutoScalingGroups(input *autoscaling.DescribeAutoScalingGroupsInput) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	var groups []*autoscaling.Group
+	for nodePool, maxSize := range a.maxSizes {
+		groups = append(groups, &autoscaling.Group{
+			AutoScalingGroupName: aws.String(nodePool),
+			MaxSize:              aws.Int64(maxSize),
+			Tags: []*autoscaling.TagDescription{
+				{Key: aws.String("aws:cloudformation:stack-name"), Value: aws.String("kube-1")},
+				{Key: aws.String("NodePool"), Value: aws.String(nodePool)},
+			},
+		})
+	}
+	return &autoscaling.DescribeAutoScalingGroupsOutput{AutoScalingGroups: groups}, nil
+}
+
+func budgetTestCluster(budget string, maxSize int64) *api.Cluster {
+	return &api.Cluster{
+		ID:          "aws:123456789012:eu-central-1:kube-1",
+		LocalID:     "kube-1",
+		Region:      "eu-central-1",
+		ConfigItems: map[string]string{configKeyCostBudget: budget},
+		NodePools: []*api.NodePool{
+			{Name: "master-default", InstanceType: "test.large", MaxSize: 2},
+			{Name: "worker-default", InstanceType: "test.xlarge", MaxSize: maxSize},
+		},
+	}
+}
+
+func TestEstimateCost(t *testing.T) {
+	adapter := &awsAdapter{
+		priceSource:       staticPriceSource{"test.large": "0.1", "test.xlarge": "0.2"},
+		autoscalingClient: &nodePoolASGsStub{maxSizes: map[string]int64{"master-default": 2, "worker-default": 10}},
+		logger:            log.WithField("test", true),
+	}
+
+	estimate, err := adapter.estimateCost(budgetTestCluster("0", 20), true)
+	require.NoError(t, err)
+	assert.InDelta(t, 2*0.1*hoursPerMonth+20*0.2*hoursPerMonth, estimate.estimated, 0.001)
+	assert.InDelta(t, 2*0.1*hoursPerMonth+10*0.2*hoursPerMonth, estimate.current, 0.001)
+	assert.InDelta(t, 10*0.2*hoursPerMonth, estimate.delta(), 0.001)
+
+	// node pools of new clusters don't cost anything yet.
+	estimate, err = adapter.estimateCost(budgetTestCluster("0", 20), false)
+	require.NoError(t, err)
+	assert.Equal(t, 0.0, estimate.current)
+
+	adapter.priceSource = staticPriceSource{}
+	_, err = adapter.estimateCost(budgetTestCluster("0", 20), false)
+	assert.Error(t, err)
+}
+
+func TestCheckCostBudget(t *testing.T) {
+	adapter := &awsAdapter{
+		priceSource:       staticPriceSource{"test.large": "0.1", "test.xlarge": "0.2"},
+		autoscalingClient: &nodePoolASGsStub{maxSizes: map[string]int64{"master-default": 2, "worker-default": 10}},
+		logger:            log.WithField("test", true),
+	}
+	logger := log.WithField("test", true)
+
+	// the current node pools cost $1606 a month.
+	for _, tc := range []struct {
+		msg      string
+		budget   string
+		action   string
+		maxSize  int64
+		exceeded bool
+		invalid  bool
+	}{
+		{msg: "within budget", budget: "5000", maxSize: 20},
+		{msg: "increase exceeding budget", budget: "2000", maxSize: 20, exceeded: true},
+		{msg: "increase exceeding budget with warning", budget: "2000", action: costBudgetActionWarn, maxSize: 20},
+		{msg: "decrease over budget", budget: "500", maxSize: 5},
+		{msg: "invalid budget", budget: "lots", maxSize: 20, invalid: true},
+		{msg: "invalid action", budget: "2000", action: "ignore", maxSize: 20, invalid: true},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			cluster := budgetTestCluster(tc.budget, tc.maxSize)
+			if tc.action != "" {
+				cluster.ConfigItems[configKeyCostBudgetAction] = tc.action
+			}
+
+			err := adapter.checkCostBudget(logger, cluster, true)
+			switch {
+			case tc.exceeded:
+				assert.IsType(t, &costBudgetExceededError{}, err)
+			case tc.invalid:
+				assert.Error(t, err)
+			default:
+				assert.NoError(t, err)
+			}
+		})
+	}
+
+	// clusters without a budget aren't checked.
+	adapter.priceSource = staticPriceSource{}
+	cluster := budgetTestCluster("", 20)
+	delete(cluster.ConfigItems, configKeyCostBudget)
+	assert.NoError(t, adapter.checkCostBudget(logger, cluster, true))
+}
@@ -0,0 +1,100 @@
+package provisioner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+)
+
+const (
+	// butaneUserDataFile is the file in the directory of a node pool
+	// profile with the Butane config of its nodes. It takes precedence
+	// over the Container Linux Config of the node pool role.
+	butaneUserDataFile = "userdata.bu.yaml"
+)
+
+// butaneCommand is the Butane CLI translating Butane configs. The Butane
+// library can't be vendored with dep, as it and its dependencies are Go
+// modules with major version import paths.
+var butaneCommand = "butane"
+
+// userDataFile returns the userdata template of a node pool role. The Butane
+// config of the profile, or of its closest base profile having one, is
+// preferred over the Container Linux Config of the role.
+func userDataFile(basePath, role, profile string) (string, error) {
+	if profile != "" {
+		file, err := profileFile(basePath, profile, butaneUserDataFile)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = os.Stat(file)
+		if err == nil {
+			return file, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	return path.Join(basePath, fmt.Sprintf("%s.clc.yaml", role)), nil
+}
+
+// convertUserData converts the rendered userdata template file to an
+// ignition config. Butane configs are translated to the ignition spec
+// selected by their variant and version, Container Linux Configs to ignition
+// v2 for the specified platform.
+func convertUserData(file string, data []byte, platformID string) ([]byte, error) {
+	if path.Base(file) == butaneUserDataFile {
+		return butaneToIgnition(data)
+	}
+	return clcToIgnition(data, platformID)
+}
+
+// butaneToIgnition translates a Butane config to an ignition config. In
+// contrast to Container Linux Configs, the platform is detected by ignition
+// when the node boots.
+func butaneToIgnition(data []byte) ([]byte, error) {
+	var stdout, stderr bytes.Buffer
+	cmd := exec.Command(butaneCommand)
+	cmd.Stdin = bytes.NewReader(data)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err := cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("failed to translate to ignition: %v: %s", err, strings.TrimSpace(stderr.String()))
+	}
+
+	return stdout.Bytes(), nil
+}
+
+// ignitionSpecVersion returns the spec version of an ignition config.
+func ignitionSpecVersion(ignCfg []byte) (string, error) {
+	var cfg struct {
+		Ignition struct {
+			Version string `json:"version"`
+		} `json:"ignition"`
+	}
+
+	err := json.Unmarshal(ignCfg, &cfg)
+	if err != nil {
+		return "", err
+	}
+
+	if cfg.Ignition.Version == "" {
+		return "", fmt.Errorf("ignition config without spec version")
+	}
+
+	return cfg.Ignition.Version, nil
+}
+
+// ignitionMajorVersion returns the major version of an ignition spec
+// version e.g. '3' for '3.3.0'.
+func ignitionMajorVersion(version string) string {
+	return strings.SplitN(version, ".", 2)[0]
+}
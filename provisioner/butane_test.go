@@ -0,0 +1,95 @@
+package provisioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/coreos/container-linux-config-transpiler/config/platform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestUserDataFile(t *testing.T) {
+	basePath, err := ioutil.TempDir("", "profiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(basePath)
+
+	writeProfileFiles(t, basePath, map[string]string{
+		"node-pools/worker-flatcar/userdata.bu.yaml": "variant: flatcar\nversion: 1.0.0\n",
+		"node-pools/worker-gpu/profile.yaml":         "base: worker-flatcar",
+		"node-pools/worker-default/profile.yaml":     "",
+	})
+
+	for _, tc := range []struct {
+		profile  string
+		expected string
+	}{
+		{profile: "worker-flatcar", expected: "node-pools/worker-flatcar/userdata.bu.yaml"},
+		{profile: "worker-gpu", expected: "node-pools/worker-flatcar/userdata.bu.yaml"},
+		{profile: "worker-default", expected: "worker.clc.yaml"},
+		{profile: "", expected: "worker.clc.yaml"},
+	} {
+		t.Run(tc.profile, func(t *testing.T) {
+			file, err := userDataFile(basePath, "worker", tc.profile)
+			require.NoError(t, err)
+			assert.Equal(t, path.Join(basePath, tc.expected), file)
+		})
+	}
+}
+
+func TestConvertUserData(t *testing.T) {
+	for _, tc := range []struct {
+		msg         string
+		file        string
+		data        string
+		specVersion string
+		success     bool
+	}{
+		{
+			msg:         "container linux config",
+			file:        "worker.clc.yaml",
+			data:        "storage:\n  files:\n  - path: /etc/foo\n    filesystem: root\n",
+			specVersion: "2",
+			success:     true,
+		},
+		{
+			msg:         "butane config",
+			file:        "node-pools/worker-flatcar/userdata.bu.yaml",
+			data:        "variant: flatcar\nversion: 1.0.0\nstorage:\n  files:\n  - path: /etc/foo\n",
+			specVersion: "3",
+			success:     true,
+		},
+		{
+			msg:  "butane config of unknown variant",
+			file: "node-pools/worker-flatcar/userdata.bu.yaml",
+			data: "variant: unknown\nversion: 1.0.0\n",
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			ignCfg, err := convertUserData(tc.file, []byte(tc.data), platform.EC2)
+			if !tc.success {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+
+			version, err := ignitionSpecVersion(ignCfg)
+			require.NoError(t, err)
+			assert.Equal(t, tc.specVersion, ignitionMajorVersion(version))
+		})
+	}
+}
+
+func TestIgnitionSpecVersion(t *testing.T) {
+	version, err := ignitionSpecVersion([]byte(`{"ignition": {"version": "3.3.0"}}`))
+	require.NoError(t, err)
+	assert.Equal(t, "3.3.0", version)
+
+	_, err = ignitionSpecVersion([]byte(`{"ignition": {}}`))
+	assert.Error(t, err)
+
+	_, err = ignitionSpecVersion([]byte(`ignition`))
+	assert.Error(t, err)
+}
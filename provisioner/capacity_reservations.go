@@ -0,0 +1,153 @@
+package provisioner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	capacityReservationStateActive = "active"
+	capacityReservationGroupPrefix = "arn:aws:resource-groups:"
+)
+
+// The DescribeCapacityReservations operation is missing from the vendored AWS
+// SDK, so it's defined here and sent with the ec2QueryClient. The shapes only
+// contain the fields used.
+
+type describeCapacityReservationsInput struct {
+	_                      struct{}  `type:"structure"`
+	CapacityReservationIds []*string `locationName:"CapacityReservationId" locationNameList:"item" type:"list"`
+}
+
+type capacityReservation struct {
+	_                      struct{} `type:"structure"`
+	CapacityReservationId  *string  `locationName:"capacityReservationId" type:"string"`
+	InstanceType           *string  `locationName:"instanceType" type:"string"`
+	AvailabilityZone       *string  `locationName:"availabilityZone" type:"string"`
+	State                  *string  `locationName:"state" type:"string"`
+	AvailableInstanceCount *int64   `locationName:"availableInstanceCount" type:"integer"`
+}
+
+type describeCapacityReservationsOutput struct {
+	_                    struct{}               `type:"structure"`
+	CapacityReservations []*capacityReservation `locationName:"capacityReservationSet" locationNameList:"item" type:"list"`
+}
+
+// capacityReservationAPI is the minimal interface containing the capacity
+// reservation operations of the EC2 API.
+type capacityReservationAPI interface {
+	DescribeCapacityReservations(input *describeCapacityReservationsInput) (*describeCapacityReservationsOutput, error)
+}
+
+// ec2QueryClient sends the operations of the EC2 API missing from the
+// vendored AWS SDK with the EC2 query protocol client of the service.
+type ec2QueryClient struct {
+	client *ec2.EC2
+}
+
+func (c *ec2QueryClient) send(name string, input, output interface{}) error {
+	op := &request.Operation{
+		Name:       name,
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+	return c.client.NewRequest(op, input, output).Send()
+}
+
+func (c *ec2QueryClient) DescribeCapacityReservations(input *describeCapacityReservationsInput) (*describeCapacityReservationsOutput, error) {
+	output := &describeCapacityReservationsOutput{}
+	return output, c.send("DescribeCapacityReservations", input, output)
+}
+
+// validateCapacityReservationTarget returns an error if the capacity
+// reservation target of the node pool is invalid. Capacity reservations are
+// only supported for on-demand node pools using launch templates.
+func validateCapacityReservationTarget(nodePool *api.NodePool, launchTemplate bool) error {
+	if nodePool.CapacityReservationID == "" && nodePool.CapacityReservationGroupARN == "" {
+		return nil
+	}
+
+	if nodePool.CapacityReservationID != "" && nodePool.CapacityReservationGroupARN != "" {
+		return fmt.Errorf("capacity_reservation_id and capacity_reservation_group_arn of node pool %s are mutually exclusive", nodePool.Name)
+	}
+
+	if nodePool.CapacityReservationGroupARN != "" && !strings.HasPrefix(nodePool.CapacityReservationGroupARN, capacityReservationGroupPrefix) {
+		return fmt.Errorf("invalid capacity_reservation_group_arn %s for node pool %s, must be the ARN of a resource group", nodePool.CapacityReservationGroupARN, nodePool.Name)
+	}
+
+	if isSpotNodePool(nodePool) {
+		return fmt.Errorf("capacity reservations of node pool %s can't be used by spot instances", nodePool.Name)
+	}
+
+	if !launchTemplate {
+		return fmt.Errorf("capacity reservations of node pool %s require the %s config item", nodePool.Name, launchTemplateConfigItemKey)
+	}
+
+	return nil
+}
+
+// checkCapacityReservation returns an error if the capacity reservation of
+// the node pool doesn't exist, isn't active, is for another instance type or
+// is in an availability zone the node pool isn't pinned to.
+func (a *awsAdapter) checkCapacityReservation(nodePool *api.NodePool) error {
+	resp, err := a.capacityReservationClient.DescribeCapacityReservations(&describeCapacityReservationsInput{
+		CapacityReservationIds: []*string{aws.String(nodePool.CapacityReservationID)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to get capacity reservation %s of node pool %s: %v", nodePool.CapacityReservationID, nodePool.Name, err)
+	}
+
+	if len(resp.CapacityReservations) == 0 {
+		return fmt.Errorf("capacity reservation %s of node pool %s not found", nodePool.CapacityReservationID, nodePool.Name)
+	}
+	reservation := resp.CapacityReservations[0]
+
+	if state := aws.StringValue(reservation.State); state != capacityReservationStateActive {
+		return fmt.Errorf("capacity reservation %s of node pool %s is %s", nodePool.CapacityReservationID, nodePool.Name, state)
+	}
+
+	if instanceType := aws.StringValue(reservation.InstanceType); instanceType != nodePool.InstanceType {
+		return fmt.Errorf("capacity reservation %s of node pool %s is for instance type %s instead of %s", nodePool.CapacityReservationID, nodePool.Name, instanceType, nodePool.InstanceType)
+	}
+
+	if len(nodePool.AvailabilityZones) > 0 {
+		zone := aws.StringValue(reservation.AvailabilityZone)
+		for _, nodePoolZone := range nodePool.AvailabilityZones {
+			if nodePoolZone == zone {
+				return nil
+			}
+		}
+		return fmt.Errorf("capacity reservation %s of node pool %s is in availability zone %s, which the node pool isn't pinned to", nodePool.CapacityReservationID, nodePool.Name, zone)
+	}
+
+	return nil
+}
+
+// capacityReservationArgs validates the capacity reservation target of a node
+// pool and returns its stack parameter prefixed with the given prefix e.g.
+// 'Master' or 'Worker'. No parameter is returned if the node pool doesn't
+// target a capacity reservation.
+func (a *awsAdapter) capacityReservationArgs(prefix string, nodePool *api.NodePool, launchTemplate bool) ([]string, error) {
+	err := validateCapacityReservationTarget(nodePool, launchTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	switch {
+	case nodePool.CapacityReservationID != "":
+		err := a.checkCapacityReservation(nodePool)
+		if err != nil {
+			return nil, err
+		}
+		return []string{fmt.Sprintf("%sCapacityReservationId=%s", prefix, nodePool.CapacityReservationID)}, nil
+	case nodePool.CapacityReservationGroupARN != "":
+		return []string{fmt.Sprintf("%sCapacityReservationResourceGroupArn=%s", prefix, nodePool.CapacityReservationGroupARN)}, nil
+	}
+
+	return nil, nil
+}
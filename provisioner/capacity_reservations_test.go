@@ -0,0 +1,124 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type capacityReservationAPIStub struct {
+	reservations []*capacityReservation
+}
+
+func (c *capacityReservationAPIStub) DescribeCapacityReservations(input *describeCapacityReservationsInput) (*describeCapacityReservationsOutput, error) {
+	output := &describeCapacityReservationsOutput{}
+	for _, reservation := range c.reservations {
+		for _, id := range input.CapacityReservationIds {
+			if aws.StringValue(reservation.CapacityReservationId) == aws.StringValue(id) {
+				output.CapacityReservations = append(output.CapacityReservations, reservation)
+			}
+		}
+	}
+	return output, nil
+}
+
+func TestCapacityReservationArgs(t *testing.T) {
+	reservations := []*capacityReservation{
+		{
+			CapacityReservationId: aws.String("cr-active"),
+			InstanceType:          aws.String("m5.large"),
+			AvailabilityZone:      aws.String("eu-central-1a"),
+			State:                 aws.String("active"),
+		},
+		{
+			CapacityReservationId: aws.String("cr-expired"),
+			InstanceType:          aws.String("m5.large"),
+			AvailabilityZone:      aws.String("eu-central-1a"),
+			State:                 aws.String("expired"),
+		},
+	}
+
+	for _, tc := range []struct {
+		msg            string
+		nodePool       *api.NodePool
+		launchTemplate bool
+		expected       []string
+		success        bool
+	}{
+		{
+			msg:            "no capacity reservation",
+			nodePool:       &api.NodePool{Name: "worker", InstanceType: "m5.large"},
+			launchTemplate: true,
+			success:        true,
+		},
+		{
+			msg:            "active capacity reservation",
+			nodePool:       &api.NodePool{Name: "worker", InstanceType: "m5.large", CapacityReservationID: "cr-active"},
+			launchTemplate: true,
+			expected:       []string{"WorkerCapacityReservationId=cr-active"},
+			success:        true,
+		},
+		{
+			msg:            "capacity reservation group",
+			nodePool:       &api.NodePool{Name: "worker", InstanceType: "m5.large", CapacityReservationGroupARN: "arn:aws:resource-groups:eu-central-1:123456789012:group/critical"},
+			launchTemplate: true,
+			expected:       []string{"WorkerCapacityReservationResourceGroupArn=arn:aws:resource-groups:eu-central-1:123456789012:group/critical"},
+			success:        true,
+		},
+		{
+			msg:            "capacity reservation in a zone the node pool isn't pinned to",
+			nodePool:       &api.NodePool{Name: "worker", InstanceType: "m5.large", CapacityReservationID: "cr-active", AvailabilityZones: []string{"eu-central-1b"}},
+			launchTemplate: true,
+		},
+		{
+			msg:            "capacity reservation for another instance type",
+			nodePool:       &api.NodePool{Name: "worker", InstanceType: "m5.xlarge", CapacityReservationID: "cr-active"},
+			launchTemplate: true,
+		},
+		{
+			msg:            "inactive capacity reservation",
+			nodePool:       &api.NodePool{Name: "worker", InstanceType: "m5.large", CapacityReservationID: "cr-expired"},
+			launchTemplate: true,
+		},
+		{
+			msg:            "missing capacity reservation",
+			nodePool:       &api.NodePool{Name: "worker", InstanceType: "m5.large", CapacityReservationID: "cr-missing"},
+			launchTemplate: true,
+		},
+		{
+			msg:      "capacity reservation without launch templates",
+			nodePool: &api.NodePool{Name: "worker", InstanceType: "m5.large", CapacityReservationID: "cr-active"},
+		},
+		{
+			msg:            "capacity reservation of spot node pools",
+			nodePool:       &api.NodePool{Name: "worker", InstanceType: "m5.large", DiscountStrategy: discountStrategySpotMaxPrice, CapacityReservationID: "cr-active"},
+			launchTemplate: true,
+		},
+		{
+			msg:            "capacity reservation and group",
+			nodePool:       &api.NodePool{Name: "worker", InstanceType: "m5.large", CapacityReservationID: "cr-active", CapacityReservationGroupARN: "arn:aws:resource-groups:eu-central-1:123456789012:group/critical"},
+			launchTemplate: true,
+		},
+		{
+			msg:            "invalid capacity reservation group",
+			nodePool:       &api.NodePool{Name: "worker", InstanceType: "m5.large", CapacityReservationGroupARN: "critical"},
+			launchTemplate: true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			a := &awsAdapter{capacityReservationClient: &capacityReservationAPIStub{reservations: reservations}}
+
+			args, err := a.capacityReservationArgs("Worker", tc.nodePool, tc.launchTemplate)
+			if !tc.success {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, args)
+		})
+	}
+}
@@ -0,0 +1,314 @@
+package provisioner
+
+import (
+	"encoding/base64"
+	"fmt"
+	"io"
+	"path"
+	"strings"
+
+	"github.com/coreos/container-linux-config-transpiler/config/platform"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	capiAPIVersion               = "cluster.x-k8s.io/v1beta1"
+	capiInfrastructureAPIVersion = "infrastructure.cluster.x-k8s.io/v1beta1"
+	capiClusterNameLabel         = "cluster.x-k8s.io/cluster-name"
+	capiAutoscalerMinSize        = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-min-size"
+	capiAutoscalerMaxSize        = "cluster.x-k8s.io/cluster-api-autoscaler-node-group-max-size"
+	capiNodePoolLabel            = "cluster-lifecycle-manager.zalando.org/node-pool"
+	capiNodeTaintsAnnotation     = "cluster-lifecycle-manager.zalando.org/node-taints"
+	userDataFormatIgnition       = "ignition"
+	userDataFormatCloudConfig    = "cloud-config"
+)
+
+type capiObjectMeta struct {
+	Name        string            `yaml:"name,omitempty"`
+	Namespace   string            `yaml:"namespace,omitempty"`
+	Labels      map[string]string `yaml:"labels,omitempty"`
+	Annotations map[string]string `yaml:"annotations,omitempty"`
+}
+
+type capiObjectReference struct {
+	APIVersion string `yaml:"apiVersion,omitempty"`
+	Kind       string `yaml:"kind"`
+	Name       string `yaml:"name"`
+}
+
+type capiSecret struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Metadata   capiObjectMeta    `yaml:"metadata"`
+	Type       string            `yaml:"type"`
+	Data       map[string]string `yaml:"data"`
+}
+
+type capiSpotMarketOptions struct {
+	MaxPrice string `yaml:"maxPrice,omitempty"`
+}
+
+type capiAWSMachineSpec struct {
+	InstanceType      string                 `yaml:"instanceType"`
+	SpotMarketOptions *capiSpotMarketOptions `yaml:"spotMarketOptions,omitempty"`
+}
+
+type capiAWSMachineTemplate struct {
+	APIVersion string         `yaml:"apiVersion"`
+	Kind       string         `yaml:"kind"`
+	Metadata   capiObjectMeta `yaml:"metadata"`
+	Spec       struct {
+		Template struct {
+			Spec capiAWSMachineSpec `yaml:"spec"`
+		} `yaml:"template"`
+	} `yaml:"spec"`
+}
+
+type capiMachineSpec struct {
+	ClusterName string `yaml:"clusterName"`
+	Bootstrap   struct {
+		DataSecretName string `yaml:"dataSecretName"`
+	} `yaml:"bootstrap"`
+	InfrastructureRef capiObjectReference `yaml:"infrastructureRef"`
+}
+
+type capiMachineDeployment struct {
+	APIVersion string         `yaml:"apiVersion"`
+	Kind       string         `yaml:"kind"`
+	Metadata   capiObjectMeta `yaml:"metadata"`
+	Spec       struct {
+		ClusterName string `yaml:"clusterName"`
+		Replicas    int64  `yaml:"replicas"`
+		Selector    struct {
+			MatchLabels map[string]string `yaml:"matchLabels"`
+		} `yaml:"selector"`
+		Template struct {
+			Metadata capiObjectMeta  `yaml:"metadata"`
+			Spec     capiMachineSpec `yaml:"spec"`
+		} `yaml:"template"`
+	} `yaml:"spec"`
+}
+
+// ExportClusterAPI writes the node pools of a cluster as Cluster API
+// manifests to w. Every node pool is exported as a Secret holding the
+// rendered userdata, an AWSMachineTemplate and a MachineDeployment.
+// The exported manifests are meant for evaluating a migration to Cluster API
+// and are not used by the provisioner itself.
+func ExportClusterAPI(cluster *api.Cluster, channelConfig *channel.Config, w io.Writer) error {
+	if cluster.Provider != providerID {
+		return ErrProviderNotSupported
+	}
+
+	kubeletSecret, ok := cluster.ConfigItems[workerSharedSecretConfigItemKey]
+	if !ok {
+		return fmt.Errorf("'%s' config item is missing, must be defined", workerSharedSecretConfigItemKey)
+	}
+
+	_, version, err := splitStackName(cluster.LocalID)
+	if err != nil {
+		return err
+	}
+
+	config, err := userDataConfig(cluster.LocalID, version, kubeletSecret, cluster)
+	if err != nil {
+		return err
+	}
+
+	basePath := path.Join(channelConfig.Path, "cluster")
+
+	for _, nodePool := range cluster.NodePools {
+		objects, err := exportNodePool(cluster, nodePool, basePath, config)
+		if err != nil {
+			return fmt.Errorf("failed to export node pool %s: %v", nodePool.Name, err)
+		}
+
+		for _, object := range objects {
+			data, err := yaml.Marshal(object)
+			if err != nil {
+				return err
+			}
+
+			_, err = fmt.Fprintf(w, "---\n%s", data)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	return nil
+}
+
+// exportNodePool converts a single node pool to the Cluster API objects
+// describing it.
+func exportNodePool(cluster *api.Cluster, nodePool *api.NodePool, basePath string, config map[string]string) ([]interface{}, error) {
+	role := "worker"
+	if strings.HasPrefix(nodePool.Profile, "master") {
+		role = "master"
+	}
+
+	config = nodePoolUserDataConfig(config, nodePool)
+
+	// the Cluster API bootstrap formats don't include PowerShell.
+	if nodePoolOS(nodePool) == osWindows {
+		return nil, fmt.Errorf("%s node pools can't be exported", osWindows)
+	}
+
+	userData, format, err := renderNodePoolUserData(basePath, role, nodePool, config, cluster.ConfigValues, platform.EC2)
+	if err != nil {
+		return nil, err
+	}
+
+	name := fmt.Sprintf("%s-%s", cluster.LocalID, nodePool.Name)
+
+	selector := map[string]string{
+		capiClusterNameLabel: cluster.LocalID,
+		capiNodePoolLabel:    nodePool.Name,
+	}
+
+	nodeLabels, err := parseNodeLabels(config["NODE_LABELS"])
+	if err != nil {
+		return nil, err
+	}
+
+	machineLabels := make(map[string]string, len(selector)+len(nodeLabels))
+	for key, value := range nodeLabels {
+		machineLabels[key] = value
+	}
+	for key, value := range selector {
+		machineLabels[key] = value
+	}
+
+	secret := &capiSecret{
+		APIVersion: "v1",
+		Kind:       "Secret",
+		Metadata: capiObjectMeta{
+			Name:      fmt.Sprintf("%s-userdata", name),
+			Namespace: defaultNamespace,
+			Labels:    map[string]string{capiClusterNameLabel: cluster.LocalID},
+		},
+		Type: "cluster.x-k8s.io/secret",
+		Data: map[string]string{
+			"value":  base64.StdEncoding.EncodeToString([]byte(userData)),
+			"format": base64.StdEncoding.EncodeToString([]byte(format)),
+		},
+	}
+
+	machineTemplate := &capiAWSMachineTemplate{
+		APIVersion: capiInfrastructureAPIVersion,
+		Kind:       "AWSMachineTemplate",
+		Metadata: capiObjectMeta{
+			Name:      name,
+			Namespace: defaultNamespace,
+		},
+	}
+	machineTemplate.Spec.Template.Spec.InstanceType = nodePool.InstanceType
+
+	strategy, err := nodePoolDiscountStrategy(nodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	// the manifests are exported offline, so only the bundled prices
+	// are used.
+	if strategy.spot() {
+		maxPrice, err := strategy.maxPrice(cluster, nodePool, nil)
+		if err != nil {
+			return nil, err
+		}
+
+		machineTemplate.Spec.Template.Spec.SpotMarketOptions = &capiSpotMarketOptions{MaxPrice: maxPrice}
+	}
+
+	machineDeployment := &capiMachineDeployment{
+		APIVersion: capiAPIVersion,
+		Kind:       "MachineDeployment",
+		Metadata: capiObjectMeta{
+			Name:      name,
+			Namespace: defaultNamespace,
+			Labels:    map[string]string{capiClusterNameLabel: cluster.LocalID},
+			Annotations: map[string]string{
+				capiAutoscalerMinSize: fmt.Sprintf("%d", nodePool.MinSize),
+				capiAutoscalerMaxSize: fmt.Sprintf("%d", nodePool.MaxSize),
+			},
+		},
+	}
+	machineDeployment.Spec.ClusterName = cluster.LocalID
+	machineDeployment.Spec.Replicas = nodePool.MinSize
+	machineDeployment.Spec.Selector.MatchLabels = selector
+	machineDeployment.Spec.Template.Metadata.Labels = machineLabels
+	// Cluster API has no notion of taints for machines bootstrapped from
+	// a data secret. The taints are registered by the kubelet configured
+	// in the userdata and only recorded here for reference.
+	if taints := config["NODE_TAINTS"]; taints != "" {
+		machineDeployment.Spec.Template.Metadata.Annotations = map[string]string{
+			capiNodeTaintsAnnotation: taints,
+		}
+	}
+	machineDeployment.Spec.Template.Spec.ClusterName = cluster.LocalID
+	machineDeployment.Spec.Template.Spec.Bootstrap.DataSecretName = secret.Metadata.Name
+	machineDeployment.Spec.Template.Spec.InfrastructureRef = capiObjectReference{
+		APIVersion: capiInfrastructureAPIVersion,
+		Kind:       machineTemplate.Kind,
+		Name:       machineTemplate.Metadata.Name,
+	}
+
+	return []interface{}{secret, machineTemplate, machineDeployment}, nil
+}
+
+// renderNodePoolUserData renders the userdata of a node pool role with the
+// partials of its profile and returns it together with its format. The
+// Butane config of the profile or the Container Linux Config is preferred and
+// converted to ignition for the platform, otherwise the cloud-config is used.
+// The PowerShell script of Windows node pools is returned as it is. In
+// contrast to the provisioner the userdata is never uploaded to S3.
+func renderNodePoolUserData(basePath, role string, nodePool *api.NodePool, config map[string]string, typed Values, platformID string) (string, string, error) {
+	file, err := nodePoolUserDataFile(basePath, role, nodePool)
+	if err != nil {
+		return "", "", err
+	}
+
+	rendered, err := renderProfileUserData(file, nodePool.Profile, config, typed)
+
+	// Windows node pools don't have a cloud-config to fall back to.
+	if isPowerShellUserData(file) {
+		if err != nil {
+			return "", "", err
+		}
+		return rendered, userDataFormatPowerShell, nil
+	}
+
+	if err == nil {
+		ignCfg, err := convertUserData(file, []byte(rendered), platformID)
+		if err != nil {
+			return "", "", err
+		}
+		return string(ignCfg), userDataFormatIgnition, nil
+	}
+
+	rendered, err = renderProfileUserData(path.Join(basePath, fmt.Sprintf("userdata-%s.yaml", role)), nodePool.Profile, config, typed)
+	if err != nil {
+		return "", "", err
+	}
+
+	return rendered, userDataFormatCloudConfig, nil
+}
+
+// parseNodeLabels parses node labels in the format of the kubelet
+// --node-labels flag e.g. 'key1=value1,key2=value2'.
+func parseNodeLabels(value string) (map[string]string, error) {
+	labels := make(map[string]string)
+	for _, label := range strings.Split(value, ",") {
+		if label == "" {
+			continue
+		}
+
+		parts := strings.SplitN(label, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid node label '%s'", label)
+		}
+		labels[parts[0]] = parts[1]
+	}
+	return labels, nil
+}
@@ -0,0 +1,115 @@
+package provisioner
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+func TestExportClusterAPI(t *testing.T) {
+	dir, err := ioutil.TempDir("", "capi")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	clusterDir := path.Join(dir, "cluster")
+	require.NoError(t, os.Mkdir(clusterDir, 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(clusterDir, "master.clc.yaml"), []byte(testUserDataCLC), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(clusterDir, "userdata-worker.yaml"), []byte("#cloud-config\nid: {{LOCAL_ID}}\n"), 0644))
+
+	cluster := &api.Cluster{
+		ID:           "aws:123456789012:eu-central-1:kube-1",
+		LocalID:      "kube-1",
+		APIServerURL: "https://kube-1.foo.example.org/",
+		Provider:     providerID,
+		Region:       "eu-central-1",
+		ConfigItems: map[string]string{
+			"worker_shared_secret": "secret",
+			"content":              "foo",
+			"node_labels":          "lifecycle-status=ready,team=teapot",
+			"node_taints":          "dedicated=teapot:NoSchedule",
+		},
+		NodePools: []*api.NodePool{
+			{
+				Name:             "master-default",
+				Profile:          "master/default",
+				InstanceType:     "m4.large",
+				DiscountStrategy: discountStrategyNone,
+				MinSize:          1,
+				MaxSize:          1,
+			},
+			{
+				Name:             "worker-default",
+				Profile:          "worker/default",
+				InstanceType:     "m4.large",
+				DiscountStrategy: discountStrategySpotMaxPrice,
+				MinSize:          3,
+				MaxSize:          20,
+			},
+		},
+	}
+
+	var out bytes.Buffer
+	err = ExportClusterAPI(cluster, &channel.Config{Path: dir}, &out)
+	require.NoError(t, err)
+
+	documents := strings.Split(strings.TrimPrefix(out.String(), "---\n"), "---\n")
+	require.Len(t, documents, 6)
+
+	var masterSecret capiSecret
+	require.NoError(t, yaml.Unmarshal([]byte(documents[0]), &masterSecret))
+	assert.Equal(t, "kube-1-master-default-userdata", masterSecret.Metadata.Name)
+	format, err := base64.StdEncoding.DecodeString(masterSecret.Data["format"])
+	require.NoError(t, err)
+	assert.Equal(t, userDataFormatIgnition, string(format))
+
+	var workerSecret capiSecret
+	require.NoError(t, yaml.Unmarshal([]byte(documents[3]), &workerSecret))
+	userData, err := base64.StdEncoding.DecodeString(workerSecret.Data["value"])
+	require.NoError(t, err)
+	assert.Equal(t, "#cloud-config\nid: kube-1\n", string(userData))
+	format, err = base64.StdEncoding.DecodeString(workerSecret.Data["format"])
+	require.NoError(t, err)
+	assert.Equal(t, userDataFormatCloudConfig, string(format))
+
+	var workerTemplate capiAWSMachineTemplate
+	require.NoError(t, yaml.Unmarshal([]byte(documents[4]), &workerTemplate))
+	assert.Equal(t, "AWSMachineTemplate", workerTemplate.Kind)
+	assert.Equal(t, "m4.large", workerTemplate.Spec.Template.Spec.InstanceType)
+	require.NotNil(t, workerTemplate.Spec.Template.Spec.SpotMarketOptions)
+	assert.NotEmpty(t, workerTemplate.Spec.Template.Spec.SpotMarketOptions.MaxPrice)
+
+	var workerDeployment capiMachineDeployment
+	require.NoError(t, yaml.Unmarshal([]byte(documents[5]), &workerDeployment))
+	assert.Equal(t, "MachineDeployment", workerDeployment.Kind)
+	assert.EqualValues(t, 3, workerDeployment.Spec.Replicas)
+	assert.Equal(t, "20", workerDeployment.Metadata.Annotations[capiAutoscalerMaxSize])
+	assert.Equal(t, "teapot", workerDeployment.Spec.Template.Metadata.Labels["team"])
+	assert.Equal(t, "worker-default", workerDeployment.Spec.Template.Metadata.Labels[capiNodePoolLabel])
+	assert.Equal(t, "dedicated=teapot:NoSchedule", workerDeployment.Spec.Template.Metadata.Annotations[capiNodeTaintsAnnotation])
+	assert.Equal(t, workerSecret.Metadata.Name, workerDeployment.Spec.Template.Spec.Bootstrap.DataSecretName)
+	assert.Equal(t, workerTemplate.Metadata.Name, workerDeployment.Spec.Template.Spec.InfrastructureRef.Name)
+}
+
+func TestParseNodeLabels(t *testing.T) {
+	labels, err := parseNodeLabels("a=b,c=")
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"a": "b", "c": ""}, labels)
+
+	labels, err = parseNodeLabels("")
+	require.NoError(t, err)
+	assert.Empty(t, labels)
+
+	_, err = parseNodeLabels("a")
+	assert.Error(t, err)
+}
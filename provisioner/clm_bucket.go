@@ -0,0 +1,242 @@
+package provisioner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// clmBucketNameConfigItemKey is the config item defining the template
+	// of the name of the CLM bucket, rendered with the account ID and
+	// region of the cluster.
+	clmBucketNameConfigItemKey = "clm_bucket_name"
+	// clmBucketRestrictReadsConfigItemKey is the config item restricting
+	// the reads of the userdata of the cluster in the CLM bucket to its
+	// node roles and the role of CLM.
+	clmBucketRestrictReadsConfigItemKey = "clm_bucket_restrict_reads"
+	// clmBucketReadersConfigItemKey is the config item listing additional
+	// comma separated principal ARN patterns allowed to read the userdata
+	// of the cluster if reads are restricted.
+	clmBucketReadersConfigItemKey = "clm_bucket_readers"
+
+	defaultCLMBucketNameTemplate = "cluster-lifecycle-manager-{{.AccountID}}-{{.Region}}"
+	clmBucketReadPolicySidPrefix = "ClusterLifecycleManagerRestrictReads"
+	errCodeNoSuchBucketPolicy    = "NoSuchBucketPolicy"
+)
+
+var (
+	bucketNamePattern     = regexp.MustCompile(`^[a-z0-9][a-z0-9.-]{1,61}[a-z0-9]$`)
+	policySidInvalidChars = regexp.MustCompile(`[^a-zA-Z0-9]`)
+)
+
+// clmBucketNameData is the data the template of the CLM bucket name is
+// rendered with.
+type clmBucketNameData struct {
+	AccountID string
+	Region    string
+}
+
+// clmBucketName returns the name of the bucket of CLM in the account and
+// region of the cluster. The bucket stores the userdata, the large stack
+// templates, the previous templates and the update summaries. S3 bucket
+// names are global, so the region is appended to names rendered from
+// templates without it, such that clusters in different regions never use
+// the same bucket.
+func clmBucketName(cluster *api.Cluster) (string, error) {
+	nameTemplate := defaultCLMBucketNameTemplate
+	if value, ok := cluster.ConfigItems[clmBucketNameConfigItemKey]; ok && value != "" {
+		nameTemplate = value
+	}
+
+	t, err := template.New(clmBucketNameConfigItemKey).Option("missingkey=error").Parse(nameTemplate)
+	if err != nil {
+		return "", fmt.Errorf("invalid %s '%s': %v", clmBucketNameConfigItemKey, nameTemplate, err)
+	}
+
+	var out bytes.Buffer
+	err = t.Execute(&out, &clmBucketNameData{
+		AccountID: strings.TrimPrefix(cluster.InfrastructureAccount, "aws:"),
+		Region:    cluster.Region,
+	})
+	if err != nil {
+		return "", fmt.Errorf("invalid %s '%s': %v", clmBucketNameConfigItemKey, nameTemplate, err)
+	}
+
+	name := out.String()
+	if !strings.Contains(name, cluster.Region) {
+		name = fmt.Sprintf("%s-%s", name, cluster.Region)
+	}
+
+	if !bucketNamePattern.MatchString(name) {
+		return "", fmt.Errorf("invalid %s '%s': '%s' isn't a valid S3 bucket name", clmBucketNameConfigItemKey, nameTemplate, name)
+	}
+	return name, nil
+}
+
+// clmBucketRestrictReads returns true if the reads of the userdata of the
+// cluster in the CLM bucket are restricted.
+func clmBucketRestrictReads(cluster *api.Cluster) bool {
+	return cluster.ConfigItems[clmBucketRestrictReadsConfigItemKey] == "true"
+}
+
+// clmBucketReaders returns the patterns of the principal ARNs allowed to read
+// the userdata of the cluster: the roles created by the stack of the cluster,
+// whose names are prefixed by CloudFormation with the stack name, the role
+// assumed by CLM and the configured readers.
+func clmBucketReaders(cluster *api.Cluster, roleArn string) ([]string, error) {
+	readers := []string{
+		fmt.Sprintf("arn:aws:iam::%s:role/%s-*", strings.TrimPrefix(cluster.InfrastructureAccount, "aws:"), cluster.LocalID),
+	}
+	if roleArn != "" {
+		readers = append(readers, roleArn)
+	}
+
+	for _, reader := range strings.Split(cluster.ConfigItems[clmBucketReadersConfigItemKey], ",") {
+		reader = strings.TrimSpace(reader)
+		if reader == "" {
+			continue
+		}
+		if !strings.HasPrefix(reader, "arn:") {
+			return nil, fmt.Errorf("invalid %s '%s': not an ARN", clmBucketReadersConfigItemKey, reader)
+		}
+		readers = append(readers, reader)
+	}
+
+	// the userdata must stay readable by CLM to check its replication
+	// and to pre-sign URLs for it.
+	if roleArn == "" && len(readers) == 1 {
+		return nil, fmt.Errorf("%s requires an assumed role or %s including the principal of CLM", clmBucketRestrictReadsConfigItemKey, clmBucketReadersConfigItemKey)
+	}
+	return readers, nil
+}
+
+// clmBucketReadStatement returns the statement of the bucket policy denying
+// the reads of the userdata of the cluster, stored below its local ID, to
+// all principals except the readers.
+func clmBucketReadStatement(bucket string, cluster *api.Cluster, readers []string) map[string]interface{} {
+	readersList := make([]interface{}, 0, len(readers))
+	for _, reader := range readers {
+		readersList = append(readersList, reader)
+	}
+
+	return map[string]interface{}{
+		"Sid":       clmBucketReadPolicySidPrefix + policySidInvalidChars.ReplaceAllString(cluster.LocalID, ""),
+		"Effect":    "Deny",
+		"Principal": "*",
+		"Action":    "s3:GetObject",
+		"Resource":  fmt.Sprintf("arn:aws:s3:::%s/%s/*", bucket, cluster.LocalID),
+		"Condition": map[string]interface{}{
+			"ArnNotLike": map[string]interface{}{
+				"aws:PrincipalArn": readersList,
+			},
+		},
+	}
+}
+
+// ensureCLMBucketReadPolicy restricts the reads of the userdata of the
+// cluster in the CLM bucket to the readers of the cluster. The statement of
+// the cluster is added to or replaced in the bucket policy, the statements
+// of other clusters and other statements are kept. External userdata
+// buckets are left untouched.
+func (a *awsAdapter) ensureCLMBucketReadPolicy(bucket *userDataBucket, cluster *api.Cluster) error {
+	if bucket.external || !clmBucketRestrictReads(cluster) {
+		return nil
+	}
+
+	readers, err := clmBucketReaders(cluster, a.roleArn)
+	if err != nil {
+		return err
+	}
+
+	if a.skipReadOnly("restricting the reads of s3://%s/%s/", bucket.name, cluster.LocalID) {
+		return nil
+	}
+
+	err = a.createS3Bucket(bucket.name)
+	if err != nil {
+		return err
+	}
+
+	policy := map[string]interface{}{"Version": "2012-10-17"}
+	resp, err := a.s3Client.GetBucketPolicy(&s3.GetBucketPolicyInput{Bucket: aws.String(bucket.name)})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != errCodeNoSuchBucketPolicy {
+			return err
+		}
+	} else {
+		err = json.Unmarshal([]byte(aws.StringValue(resp.Policy)), &policy)
+		if err != nil {
+			return fmt.Errorf("invalid policy of bucket %s: %v", bucket.name, err)
+		}
+	}
+
+	statement := clmBucketReadStatement(bucket.name, cluster, readers)
+
+	var statements []interface{}
+	switch existing := policy["Statement"].(type) {
+	case []interface{}:
+		statements = existing
+	case map[string]interface{}:
+		statements = []interface{}{existing}
+	}
+
+	replaced := false
+	for i, existing := range statements {
+		existingStatement, ok := existing.(map[string]interface{})
+		if !ok || existingStatement["Sid"] != statement["Sid"] {
+			continue
+		}
+		if statementsEqual(existingStatement, statement) {
+			return nil
+		}
+		statements[i] = statement
+		replaced = true
+	}
+	if !replaced {
+		statements = append(statements, statement)
+	}
+	policy["Statement"] = statements
+
+	data, err := json.Marshal(policy)
+	if err != nil {
+		return err
+	}
+
+	a.logger.Infof("Restricting the reads of s3://%s/%s/ to %s", bucket.name, cluster.LocalID, strings.Join(readers, ", "))
+	_, err = a.s3Client.PutBucketPolicy(&s3.PutBucketPolicyInput{
+		Bucket: aws.String(bucket.name),
+		Policy: aws.String(string(data)),
+	})
+	return err
+}
+
+// statementsEqual returns true if the statements are the same once encoded
+// as JSON, such that a statement read from a policy can be compared with a
+// generated one.
+func statementsEqual(a, b map[string]interface{}) bool {
+	encodedA, err := json.Marshal(a)
+	if err != nil {
+		return false
+	}
+	encodedB, err := json.Marshal(b)
+	if err != nil {
+		return false
+	}
+
+	var decodedA, decodedB interface{}
+	if json.Unmarshal(encodedA, &decodedA) != nil || json.Unmarshal(encodedB, &decodedB) != nil {
+		return false
+	}
+	return reflect.DeepEqual(decodedA, decodedB)
+}
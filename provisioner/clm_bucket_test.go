@@ -0,0 +1,207 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type policyS3APIStub struct {
+	s3API
+	policy  string
+	created []string
+	puts    int
+}
+
+func (s *policyS3APIStub) CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
+	s.created = append(s.created, aws.StringValue(input.Bucket))
+	return nil, nil
+}
+
+func (s *policyS3APIStub) PutBucketEncryption(input *s3.PutBucketEncryptionInput) (*s3.PutBucketEncryptionOutput, error) {
+	return nil, nil
+}
+
+func (s *policyS3APIStub) GetBucketPolicy(input *s3.GetBucketPolicyInput) (*s3.GetBucketPolicyOutput, error) {
+	if s.policy == "" {
+		return nil, awserr.New(errCodeNoSuchBucketPolicy, "no policy", nil)
+	}
+	return &s3.GetBucketPolicyOutput{Policy: aws.String(s.policy)}, nil
+}
+
+func (s *policyS3APIStub) PutBucketPolicy(input *s3.PutBucketPolicyInput) (*s3.PutBucketPolicyOutput, error) {
+	s.policy = aws.StringValue(input.Policy)
+	s.puts++
+	return nil, nil
+}
+
+func TestCLMBucketName(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		template string
+		expected string
+		valid    bool
+	}{
+		{
+			msg:      "default",
+			expected: "cluster-lifecycle-manager-123456789012-eu-central-1",
+			valid:    true,
+		},
+		{
+			msg:      "region is appended",
+			template: "clm-{{.AccountID}}",
+			expected: "clm-123456789012-eu-central-1",
+			valid:    true,
+		},
+		{
+			msg:      "region in the template",
+			template: "{{.Region}}-clm-{{.AccountID}}",
+			expected: "eu-central-1-clm-123456789012",
+			valid:    true,
+		},
+		{
+			msg:      "unknown field",
+			template: "clm-{{.Account}}",
+		},
+		{
+			msg:      "invalid template",
+			template: "clm-{{.AccountID",
+		},
+		{
+			msg:      "invalid bucket name",
+			template: "CLM_{{.AccountID}}",
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			cluster := &api.Cluster{
+				InfrastructureAccount: "aws:123456789012",
+				Region:                "eu-central-1",
+				ConfigItems:           map[string]string{},
+			}
+			if tc.template != "" {
+				cluster.ConfigItems[clmBucketNameConfigItemKey] = tc.template
+			}
+
+			name, err := clmBucketName(cluster)
+			if !tc.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, name)
+		})
+	}
+}
+
+func TestCLMBucketReaders(t *testing.T) {
+	cluster := &api.Cluster{
+		InfrastructureAccount: "aws:123456789012",
+		LocalID:               "kube-1",
+		ConfigItems: map[string]string{
+			clmBucketReadersConfigItemKey: "arn:aws:iam::123456789012:role/userdata-reader, ",
+		},
+	}
+
+	readers, err := clmBucketReaders(cluster, "arn:aws:iam::123456789012:role/clm")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"arn:aws:iam::123456789012:role/kube-1-*",
+		"arn:aws:iam::123456789012:role/clm",
+		"arn:aws:iam::123456789012:role/userdata-reader",
+	}, readers)
+
+	_, err = clmBucketReaders(cluster, "")
+	assert.NoError(t, err)
+
+	cluster.ConfigItems[clmBucketReadersConfigItemKey] = ""
+	_, err = clmBucketReaders(cluster, "")
+	assert.Error(t, err)
+
+	cluster.ConfigItems[clmBucketReadersConfigItemKey] = "userdata-reader"
+	_, err = clmBucketReaders(cluster, "arn:aws:iam::123456789012:role/clm")
+	assert.Error(t, err)
+}
+
+func TestEnsureCLMBucketReadPolicy(t *testing.T) {
+	cluster := &api.Cluster{
+		InfrastructureAccount: "aws:123456789012",
+		LocalID:               "kube-1",
+		ConfigItems:           map[string]string{clmBucketRestrictReadsConfigItemKey: "true"},
+	}
+	bucket := &userDataBucket{name: "clm-bucket", region: "eu-central-1"}
+
+	client := &policyS3APIStub{
+		policy: `{"Version": "2012-10-17", "Statement": {"Sid": "Other", "Effect": "Allow", "Principal": {"AWS": "arn:aws:iam::123456789012:root"}, "Action": "s3:ListBucket", "Resource": "arn:aws:s3:::clm-bucket"}}`,
+	}
+	a := &awsAdapter{s3Client: client, publicAccessBlockClient: &publicAccessBlockAPIStub{}, region: "eu-central-1", roleArn: "arn:aws:iam::123456789012:role/clm", logger: log.WithField("cluster", "kube-1")}
+
+	require.NoError(t, a.ensureCLMBucketReadPolicy(bucket, cluster))
+	assert.Equal(t, []string{"clm-bucket"}, client.created)
+	assert.Equal(t, 1, client.puts)
+
+	var policy struct {
+		Statement []map[string]interface{}
+	}
+	require.NoError(t, json.Unmarshal([]byte(client.policy), &policy))
+	require.Len(t, policy.Statement, 2)
+	assert.Equal(t, "Other", policy.Statement[0]["Sid"])
+	assert.Equal(t, "ClusterLifecycleManagerRestrictReadskube1", policy.Statement[1]["Sid"])
+	assert.Equal(t, "Deny", policy.Statement[1]["Effect"])
+	assert.Equal(t, "arn:aws:s3:::clm-bucket/kube-1/*", policy.Statement[1]["Resource"])
+
+	// the policy isn't changed if the statement is up to date.
+	require.NoError(t, a.ensureCLMBucketReadPolicy(bucket, cluster))
+	assert.Equal(t, 1, client.puts)
+
+	// the statement is replaced if the readers change.
+	cluster.ConfigItems[clmBucketReadersConfigItemKey] = "arn:aws:iam::123456789012:role/userdata-reader"
+	require.NoError(t, a.ensureCLMBucketReadPolicy(bucket, cluster))
+	assert.Equal(t, 2, client.puts)
+	require.NoError(t, json.Unmarshal([]byte(client.policy), &policy))
+	require.Len(t, policy.Statement, 2)
+	assert.Contains(t, client.policy, "role/userdata-reader")
+
+	// the statements of other clusters are kept.
+	require.NoError(t, a.ensureCLMBucketReadPolicy(bucket, &api.Cluster{
+		InfrastructureAccount: "aws:123456789012",
+		LocalID:               "kube-2",
+		ConfigItems:           map[string]string{clmBucketRestrictReadsConfigItemKey: "true"},
+	}))
+	require.NoError(t, json.Unmarshal([]byte(client.policy), &policy))
+	assert.Len(t, policy.Statement, 3)
+
+	// external buckets and clusters not restricting reads are skipped.
+	require.NoError(t, a.ensureCLMBucketReadPolicy(&userDataBucket{name: "external", external: true}, cluster))
+	require.NoError(t, a.ensureCLMBucketReadPolicy(bucket, &api.Cluster{LocalID: "kube-3"}))
+	assert.Equal(t, 3, client.puts)
+}
+
+func TestEnsureCLMBucketReadPolicyWithoutPolicy(t *testing.T) {
+	cluster := &api.Cluster{
+		InfrastructureAccount: "aws:123456789012",
+		LocalID:               "kube-1",
+		ConfigItems:           map[string]string{clmBucketRestrictReadsConfigItemKey: "true"},
+	}
+
+	client := &policyS3APIStub{}
+	a := &awsAdapter{s3Client: client, publicAccessBlockClient: &publicAccessBlockAPIStub{}, region: "eu-central-1", roleArn: "arn:aws:iam::123456789012:role/clm", logger: log.WithField("cluster", "kube-1")}
+
+	require.NoError(t, a.ensureCLMBucketReadPolicy(&userDataBucket{name: "clm-bucket"}, cluster))
+
+	var policy map[string]interface{}
+	require.NoError(t, json.Unmarshal([]byte(client.policy), &policy))
+	assert.Equal(t, "2012-10-17", policy["Version"])
+	assert.Len(t, policy["Statement"], 1)
+
+	// reads can't be restricted without the principal of CLM.
+	a.roleArn = ""
+	assert.Error(t, a.ensureCLMBucketReadPolicy(&userDataBucket{name: "clm-bucket"}, cluster))
+}
@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"crypto/sha1"
-	"crypto/sha256"
 	"encoding/base64"
 	"encoding/binary"
 	"fmt"
@@ -13,8 +12,8 @@ import (
 	"os"
 	"os/exec"
 	"path"
-	"path/filepath"
 	"sort"
+	"strconv"
 	"strings"
 	"text/template"
 	"time"
@@ -26,6 +25,8 @@ import (
 	"golang.org/x/oauth2"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
 	"github.com/aws/aws-sdk-go/service/ec2"
 	"github.com/cenkalti/backoff"
 	"github.com/pkg/errors"
@@ -35,57 +36,119 @@ import (
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
 	awsUtils "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/tracing"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/util/command"
 )
 
 const (
-	providerID                     = "zalando-aws"
-	versionFmt                     = "%s#%s"
-	manifestsPath                  = "cluster/manifests"
-	deletionsFile                  = "deletions.yaml"
-	defaultNamespace               = "default"
-	kubectlNotFound                = "(NotFound)"
-	tagNameKubernetesClusterPrefix = "kubernetes.io/cluster/"
-	resourceLifecycleShared        = "shared"
-	maxApplyRetries                = 10
-	configKeyUpdateStrategy        = "update_strategy"
-	configKeyNodeMaxEvictTimeout   = "node_max_evict_timeout"
-	updateStrategyRolling          = "rolling"
-	defaultMaxRetryTime            = 5 * time.Minute
+	providerID                         = "zalando-aws"
+	versionFmt                         = "%s#%s"
+	manifestsPath                      = "cluster/manifests"
+	deletionsFile                      = "deletions.yaml"
+	defaultNamespace                   = "default"
+	kubectlNotFound                    = "(NotFound)"
+	tagNameKubernetesClusterPrefix     = "kubernetes.io/cluster/"
+	resourceLifecycleShared            = "shared"
+	maxApplyRetries                    = 10
+	configKeyUpdateStrategy            = "update_strategy"
+	configKeyNodeMaxEvictTimeout       = "node_max_evict_timeout"
+	configKeyNamespaceEvictionInterval = "namespace_eviction_interval"
+	configKeyCanarySoakPeriod          = "update_canary_soak_period"
+	configKeyMaxNodesPerIteration      = "update_max_nodes_per_iteration"
+	configKeyNodeHealthTimeout         = "update_node_health_timeout"
+	configKeyMaxUnavailable            = "update_max_unavailable"
+	configKeyMaxEvictionsPerMinute     = "update_max_evictions_per_minute"
+	configKeyDriftRemediation          = "drift_remediation"
+	configKeyRefreshMinHealthy         = "update_instance_refresh_min_healthy_percentage"
+	configKeyRefreshCheckpoints        = "update_instance_refresh_checkpoints"
+	configKeyRefreshCheckpointDelay    = "update_instance_refresh_checkpoint_delay"
+	updateStrategyRolling              = updatestrategy.UpdateStrategyRolling
+	updateStrategyInstanceRefresh      = updatestrategy.UpdateStrategyInstanceRefresh
+	defaultMaxRetryTime                = 5 * time.Minute
+	apiServerTimeout                   = 15 * time.Minute
+	disasterRecoveryAPIServerTimeout   = 1 * time.Minute
 )
 
 type clusterpyProvisioner struct {
 	awsConfig      *aws.Config
 	assumedRole    string
+	credentials    *awsUtils.CredentialsCache
 	dryRun         bool
-	tokenSource    oauth2.TokenSource
+	kubeconfigs    kubernetes.KubeconfigProvider
 	applyOnly      bool
 	updateStrategy config.UpdateStrategy
 	removeVolumes  bool
+	priceSource    awsUtils.PriceSource
+	priceOracle    *priceOracle
+	// disasterRecovery skips the health gating of provisioning.
+	disasterRecovery bool
+	// initiator is added to the cost attribution tags.
+	initiator string
+	// hooks can change the rendered templates or veto the update.
+	hooks provisionerHooks
+	// policies check the rendered templates before they're applied.
+	policies provisionerPolicies
+	// activities are the scaling activities counted in the lifecycle
+	// metrics of the node pools.
+	activities *nodePoolActivities
+	// readOnly renders, validates and diffs the clusters without calling
+	// any API which could change resources.
+	readOnly bool
+	// throttleRetry defines the retries of throttled CloudFormation and S3
+	// calls.
+	throttleRetry config.ThrottleRetry
+	// auditor records the API calls changing the resources of the
+	// clusters.
+	auditor *audit.Auditor
+	// rateLimiter limits the rate of the AWS API requests per account,
+	// shared with the other provisioners.
+	rateLimiter *awsUtils.APIRateLimiter
+	// clmVersion is the version of the running CLM.
+	clmVersion string
 }
 
 type applyContext struct {
 	manifestData          map[string]string
 	baseDir               string
 	computingManifestHash bool
+	includeDepth          int
 }
 
 // NewClusterpyProvisioner returns a new ClusterPy provisioner by passing its location and and IAM role to use.
+// Unless a KubeconfigProvider is specified in the options, the API servers
+// are reached via the registry URL authenticated with the token source.
 func NewClusterpyProvisioner(tokenSource oauth2.TokenSource, assumedRole string, awsConfig *aws.Config, options *Options) Provisioner {
 	provisioner := &clusterpyProvisioner{
 		awsConfig:   awsConfig,
 		assumedRole: assumedRole,
-		tokenSource: tokenSource,
+		credentials: awsUtils.NewCredentialsCache(),
+		kubeconfigs: kubernetes.NewRegistryKubeconfigProvider(tokenSource),
+		activities:  newNodePoolActivities(),
 	}
 
 	if options != nil {
-		provisioner.dryRun = options.DryRun
+		provisioner.dryRun = options.DryRun || options.ReadOnly
+		provisioner.readOnly = options.ReadOnly
 		provisioner.applyOnly = options.ApplyOnly
 		provisioner.updateStrategy = options.UpdateStrategy
 		provisioner.removeVolumes = options.RemoveVolumes
+		if options.KubeconfigProvider != nil {
+			provisioner.kubeconfigs = options.KubeconfigProvider
+		}
+		provisioner.priceSource = options.PriceSource
+		provisioner.priceOracle = newPriceOracle(options.PriceOracleURL)
+		provisioner.disasterRecovery = options.DisasterRecovery
+		provisioner.initiator = options.Initiator
+		provisioner.hooks = options.Hooks
+		provisioner.policies = options.Policies
+		provisioner.throttleRetry = options.ThrottleRetry
+		provisioner.auditor = options.Auditor
+		provisioner.rateLimiter = options.RateLimiter
+		provisioner.clmVersion = options.Version
 	}
 
 	return provisioner
@@ -98,6 +161,56 @@ func (p *clusterpyProvisioner) Version(cluster *api.Cluster, channelConfig *chan
 		return "", ErrProviderNotSupported
 	}
 
+	cluster, err := withValuesFiles(cluster, channelConfig)
+	if err != nil {
+		return "", err
+	}
+
+	return clusterVersion(cluster, channelConfig)
+}
+
+// Preflight checks the AWS credentials, the ASG, launch template, instance and
+// vCPU limits of the account, the access to the S3 bucket, the node pool profiles and the price
+// data of the node pools of the cluster without changing anything.
+func (p *clusterpyProvisioner) Preflight(cluster *api.Cluster, channelConfig *channel.Config) (*PreflightReport, error) {
+	if cluster.Provider != providerID {
+		return nil, ErrProviderNotSupported
+	}
+
+	cluster, err := withValuesFiles(cluster, channelConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	logger := log.WithField("cluster", cluster.Alias)
+
+	sess, err := clusterSession(p.awsConfig, p.assumedRole, p.credentials, cluster)
+	if err != nil {
+		return nil, err
+	}
+	if p.readOnly {
+		awsUtils.ReadOnly(sess)
+	}
+	p.rateLimiter.Limit(sess, cluster.InfrastructureAccount)
+
+	adapter, err := newAWSAdapter(logger, "", cluster.Region, sess, nil, p.dryRun)
+	if err != nil {
+		return nil, err
+	}
+	adapter.priceSource = p.priceSource
+	adapter.priceOracle = p.priceOracle
+	adapter.retryThrottled(p.throttleRetry)
+	adapter.networkTags, err = newNetworkTags(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	return adapter.preflight(cluster, path.Join(channelConfig.Path, "cluster")), nil
+}
+
+// clusterVersion returns the version derived from a sha1 hash of the cluster
+// struct and the channel config version.
+func clusterVersion(cluster *api.Cluster, channelConfig *channel.Config) (string, error) {
 	state := new(bytes.Buffer)
 
 	_, err := state.WriteString(cluster.ID)
@@ -185,6 +298,138 @@ func (p *clusterpyProvisioner) Version(cluster *api.Cluster, channelConfig *chan
 		if err != nil {
 			return "", err
 		}
+		// only included when set to keep the version of existing
+		// clusters stable.
+		if nodePool.Architecture != "" {
+			_, err = state.WriteString(nodePool.Architecture)
+			if err != nil {
+				return "", err
+			}
+		}
+		if nodePool.OS != "" {
+			_, err = state.WriteString("os:" + nodePool.OS)
+			if err != nil {
+				return "", err
+			}
+		}
+		if nodePool.Tenancy != "" {
+			_, err = state.WriteString("tenancy:" + nodePool.Tenancy + "/" + nodePool.HostResourceGroupARN)
+			if err != nil {
+				return "", err
+			}
+		}
+		if nodePool.CapacityReservationID != "" || nodePool.CapacityReservationGroupARN != "" {
+			_, err = state.WriteString("reservation:" + nodePool.CapacityReservationID + "/" + nodePool.CapacityReservationGroupARN)
+			if err != nil {
+				return "", err
+			}
+		}
+		if len(nodePool.AdoptASGs) > 0 {
+			_, err = state.WriteString("adopt:" + strings.Join(nodePool.AdoptASGs, ","))
+			if err != nil {
+				return "", err
+			}
+		}
+		if nodePool.RequireIMDSv2 {
+			_, err = state.WriteString("imdsv2")
+			if err != nil {
+				return "", err
+			}
+			err = binary.Write(state, binary.LittleEndian, nodePool.IMDSHopLimit)
+			if err != nil {
+				return "", err
+			}
+		}
+		for _, arg := range rootVolumeParameters("", nodePool) {
+			_, err = state.WriteString(arg)
+			if err != nil {
+				return "", err
+			}
+		}
+		for _, zone := range nodePool.AvailabilityZones {
+			_, err = state.WriteString(zone)
+			if err != nil {
+				return "", err
+			}
+		}
+		for _, key := range sortedKeys(nodePool.SubnetTags) {
+			_, err = state.WriteString("subnet:" + key + "=" + nodePool.SubnetTags[key])
+			if err != nil {
+				return "", err
+			}
+		}
+		for _, key := range sortedKeys(nodePool.Tags) {
+			_, err = state.WriteString("tag:" + key + "=" + nodePool.Tags[key])
+			if err != nil {
+				return "", err
+			}
+		}
+		for _, values := range []map[string]string{nodePool.Labels, nodePool.Taints} {
+			for _, key := range sortedKeys(values) {
+				_, err = state.WriteString(key + "=" + values[key])
+				if err != nil {
+					return "", err
+				}
+			}
+		}
+		if nodePool.WarmPool != nil {
+			_, err = state.WriteString(fmt.Sprintf("warmpool:%s/%t", nodePool.WarmPool.State, nodePool.WarmPool.ReuseOnScaleIn))
+			if err != nil {
+				return "", err
+			}
+			for _, size := range []int64{nodePool.WarmPool.MinSize, nodePool.WarmPool.MaxPreparedCapacity} {
+				err = binary.Write(state, binary.LittleEndian, size)
+				if err != nil {
+					return "", err
+				}
+			}
+		}
+		if image := nodePool.Image; image != nil {
+			_, err = state.WriteString(fmt.Sprintf("image:%s/%s/%s/%s", image.SSMParameter, image.Owner, image.Name, image.Architecture))
+			if err != nil {
+				return "", err
+			}
+		}
+		if storage := nodePool.Storage; storage != nil {
+			_, err = state.WriteString(fmt.Sprintf("storage:%t/%s/%t/%s/%s", storage.StickyVolumes, storage.Device, storage.InstanceStoreRAID, storage.Filesystem, storage.MountPath))
+			if err != nil {
+				return "", err
+			}
+		}
+		if nodePool.KubeletConfig != nil {
+			_, err = state.WriteString("kubelet:" + kubeletConfigDropIn(nodePool.KubeletConfig))
+			if err != nil {
+				return "", err
+			}
+		}
+		if monitoring := nodePool.Monitoring; monitoring != nil {
+			_, err = state.WriteString(fmt.Sprintf("monitoring:%t/%t/%s", monitoring.ASGMetrics, monitoring.DetailedMonitoring, monitoring.CloudWatchAgentConfig))
+			if err != nil {
+				return "", err
+			}
+		}
+		for _, hook := range nodePool.LifecycleHooks {
+			_, err = state.WriteString(fmt.Sprintf("hook:%s/%s/%d/%s/%s/%s", hook.Name, hook.Transition, hook.HeartbeatTimeout, hook.DefaultResult, hook.NotificationTargetARN, hook.RoleARN))
+			if err != nil {
+				return "", err
+			}
+		}
+		for _, schedule := range nodePool.ScalingSchedules {
+			_, err = state.WriteString(schedule.Name)
+			if err != nil {
+				return "", err
+			}
+			_, err = state.WriteString(schedule.Recurrence)
+			if err != nil {
+				return "", err
+			}
+			for _, size := range []int64{schedule.MinSize, schedule.MaxSize, schedule.DesiredCapacity} {
+				err = binary.Write(state, binary.LittleEndian, size)
+				if err != nil {
+					return "", err
+				}
+			}
+		}
 	}
 
 	// sha1 hash the cluster content
@@ -200,9 +445,78 @@ func (p *clusterpyProvisioner) Version(cluster *api.Cluster, channelConfig *chan
 
 // Provision provisions/updates a cluster on AWS. Provion is an idempotent
 // operation for the same input.
-func (p *clusterpyProvisioner) Provision(cluster *api.Cluster, channelConfig *channel.Config) error {
+func (p *clusterpyProvisioner) Provision(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) (err error) {
+	ctx, span := tracing.Start(ctx, "cluster.provision",
+		tracing.String("cluster.id", cluster.ID),
+		tracing.String("channel.version", channelConfig.Version),
+	)
+	defer func() {
+		tracing.End(span, err)
+	}()
+
+	cluster, err = withValuesFiles(cluster, channelConfig)
+	if err != nil {
+		return err
+	}
+
 	logger := log.WithField("cluster", cluster.Alias)
-	awsAdapter, updater, err := p.prepareProvision(logger, cluster, channelConfig)
+	awsAdapter, kubeconfig, updater, err := p.prepareProvision(logger, cluster, channelConfig)
+	if err != nil {
+		return err
+	}
+
+	summary := api.UpdateSummaryFromContext(ctx)
+	awsAdapter.summary = summary
+	defer func() {
+		summary.Finish(err)
+		awsAdapter.saveUpdateSummary(ctx, cluster, summary)
+	}()
+
+	err = validateStackName(cluster.LocalID)
+	if err != nil {
+		return err
+	}
+
+	err = validateConfigItems(cluster, channelConfig)
+	if err != nil {
+		return err
+	}
+
+	err = checkProfileCompatibility(path.Join(channelConfig.Path, "cluster"), cluster, p.clmVersion)
+	if err != nil {
+		return err
+	}
+
+	// secrets are resolved after the validation, such that they're never
+	// part of the reported problems.
+	cluster, err = awsAdapter.resolveSecretReferences(cluster)
+	if err != nil {
+		return err
+	}
+
+	// the rotated bootstrap token is rendered into the userdata, such that
+	// a new token replaces all nodes.
+	cluster, bootstrapToken, err := awsAdapter.rotateBootstrapToken(cluster)
+	if err != nil {
+		return err
+	}
+
+	err = checkNodePools(logger, cluster)
+	if err != nil {
+		return err
+	}
+
+	err = checkSchedulableNodePools(cluster)
+	if err != nil {
+		return err
+	}
+
+	err = checkKubeletVersionSkew(cluster)
+	if err != nil {
+		return err
+	}
+
+	err = p.hooks.veto(ctx, cluster)
 	if err != nil {
 		return err
 	}
@@ -210,7 +524,7 @@ func (p *clusterpyProvisioner) Provision(cluster *api.Cluster, channelConfig *ch
 	// create etcd stack if needed.
 	etcdStackDefinitionPath := path.Join(channelConfig.Path, "cluster", "etcd-cluster.yaml")
 
-	err = awsAdapter.CreateOrUpdateEtcdStack("etcd-cluster-etcd", etcdStackDefinitionPath, cluster)
+	err = awsAdapter.CreateOrUpdateEtcdStack(ctx, "etcd-cluster-etcd", etcdStackDefinitionPath, cluster)
 	if err != nil {
 		return err
 	}
@@ -221,16 +535,96 @@ func (p *clusterpyProvisioner) Provision(cluster *api.Cluster, channelConfig *ch
 	}
 
 	stackDefinitionPath := path.Join(channelConfig.Path, "cluster", "senza-definition.yaml")
+	nodePoolHooks := newNodePoolHookRunner(logger, channelConfig, cluster, kubeconfig, p.dryRun)
 
 	// check if stack exists
 	stack, err := awsAdapter.getStackByName(cluster.LocalID)
 	if err != nil && !isDoesNotExistsErr(err) {
 		return err
 	}
+
+	err = awsAdapter.checkCostBudget(logger, cluster, stack != nil)
+	if err != nil {
+		return err
+	}
+
+	err = awsAdapter.checkQuotas(cluster)
+	if err != nil {
+		return err
+	}
+
+	// the ASGs of the node pools removed from the stack by the update.
+	var orphaned []*autoscaling.Group
 	if stack != nil {
+		// refuse to remove protected node pools from the stack.
+		err = awsAdapter.checkDecommissionProtection(cluster)
+		if err != nil {
+			return err
+		}
+
+		// don't decommission node pools which are only missing
+		// momentarily or still run workloads.
+		orphaned, err = awsAdapter.confirmOrphanedNodePools(cluster)
+		if err != nil {
+			return err
+		}
+
+		if len(orphaned) > 0 {
+			// removing node pools is deferred while the updates
+			// are paused e.g. outside of the maintenance windows,
+			// along with the update of the stack.
+			paused, err := api.UpdatesPaused(ctx)
+			if err != nil {
+				return err
+			}
+			if paused {
+				var deferred NodePoolErrors
+				for _, group := range orphaned {
+					nodePool := asgTagValue(group, "NodePool")
+					logger.Infof("Decommissioning of node pool %s continues later: %v", nodePool, updatestrategy.ErrUpdatePaused)
+					deferred = append(deferred, newNodePoolError(nodePool, updatestrategy.ErrUpdatePaused))
+				}
+				return deferred
+			}
+
+			client, err := kubernetes.NewReadOnlyKubeClientWithTokenSource(kubeconfig.Server, kubeconfig.TokenSource)
+			if err != nil {
+				return err
+			}
+
+			err = checkOrphanedPods(client, cluster, orphaned)
+			if err != nil {
+				return err
+			}
+
+			// the orphaned node pools are removed by the same stack
+			// update, so they must not take down a workload or an
+			// availability zone together.
+			if len(orphaned) > 1 {
+				groups, err := awsAdapter.listStackASGs(cluster.LocalID)
+				if err != nil {
+					return err
+				}
+
+				err = checkDecommissionTopology(cluster, groups, orphaned)
+				if err != nil {
+					return err
+				}
+			}
+
+			// the profile of a removed node pool is unknown, so
+			// only the hooks of the cluster are run.
+			for _, group := range orphaned {
+				err = nodePoolHooks.run(ctx, nodePoolHookPhasePreDecommission, &api.NodePool{Name: asgTagValue(group, "NodePool")})
+				if err != nil {
+					return err
+				}
+			}
+		}
+
 		// suspend scaling for all autoscaling worker groups
 		for _, pool := range cluster.NodePools {
-			asg, err := awsAdapter.getNodePoolASG(cluster.LocalID, pool.Name)
+			asg, err := awsAdapter.getRenamedNodePoolASG(cluster.LocalID, pool)
 			if err != nil {
 				return err
 			}
@@ -242,74 +636,451 @@ func (p *clusterpyProvisioner) Provision(cluster *api.Cluster, channelConfig *ch
 		}
 	}
 
-	out, err := awsAdapter.CreateOrUpdateClusterStack(cluster.LocalID, stackDefinitionPath, cluster)
+	policy, err := newBlastRadiusPolicy(cluster)
 	if err != nil {
 		return err
 	}
-	cluster.Outputs = out
 
-	// wait for API server to be ready
-	err = waitForAPIServer(logger, cluster.APIServerURL, 15*time.Minute)
+	// the blast radius of the node pools whose nodes are replaced by the
+	// stack update is checked before the update, as the ASGs launch nodes
+	// with the new configuration right after it.
+	if stack != nil {
+		client, err := kubernetes.NewReadOnlyKubeClientWithTokenSource(kubeconfig.Server, kubeconfig.TokenSource)
+		if err != nil {
+			return err
+		}
+
+		poolBackend := updatestrategy.NewASGNodePoolsBackend(cluster.ID, awsAdapter.session)
+		manager := updatestrategy.NewKubernetesNodePoolManager(logger, client, poolBackend, 0, 0, 0)
+		awsAdapter.checkChangedNodePools = func(nodePools []*api.NodePool) error {
+			return policy.checkNodePools(manager, nodePools)
+		}
+	}
+
+	out, err := awsAdapter.CreateOrUpdateClusterStack(ctx, cluster.LocalID, stackDefinitionPath, cluster)
 	if err != nil {
 		return err
 	}
+	cluster.Outputs = out
+
+	if !p.dryRun {
+		for _, group := range orphaned {
+			nodePool := asgTagValue(group, "NodePool")
+			api.ReportEvent(ctx, api.EventNodePoolDecommissioned, nodePool, fmt.Sprintf("Decommissioned node pool %s", nodePool))
+		}
+
+		err = awsAdapter.updateDecommissionProtection(cluster)
+		if err != nil {
+			return err
+		}
+
+		err = awsAdapter.adoptASGs(cluster)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the node pools are reported with the status of the stack after the
+	// update.
+	var stackStatus string
+	stack, err = awsAdapter.getStackByName(cluster.LocalID)
+	if err != nil && !isDoesNotExistsErr(err) {
+		return err
+	}
+	if stack != nil {
+		stackStatus = aws.StringValue(stack.StackStatus)
+	}
+
+	// wait for API server to be ready. A disaster recovery continues with
+	// a degraded control plane, as re-applying the manifests may be what
+	// recovers it.
+	timeout := apiServerTimeout
+	if p.disasterRecovery {
+		timeout = disasterRecoveryAPIServerTimeout
+	}
+	api.ReportProgress(ctx, api.ProgressStepWaitingForAPIServer, "", fmt.Sprintf("Waiting for API server %s", kubeconfig.Server))
+	err = waitForAPIServer(logger, kubeconfig.Server, timeout)
+	if err != nil {
+		if !p.disasterRecovery {
+			return err
+		}
+		logger.Warnf("Continuing disaster recovery with degraded control plane: %v", err)
+		summary.AddWarning("Continuing disaster recovery with degraded control plane: %v", err)
+	}
+
+	// the nodes of the updated node pools register with the current
+	// bootstrap token.
+	if bootstrapToken != nil && !p.dryRun {
+		client, err := kubernetes.NewKubeClientWithTokenSource(kubeconfig.Server, kubeconfig.TokenSource)
+		if err != nil {
+			return err
+		}
+		err = ensureBootstrapTokenSecret(client, bootstrapToken)
+		if err != nil {
+			return fmt.Errorf("failed to create bootstrap token %s: %v", bootstrapToken.id, err)
+		}
+	}
+
+	// nodes launched outside of rolling updates, e.g. by the autoscaler,
+	// are initialized on every provisioning, even if the node pools
+	// aren't updated.
+	if !p.dryRun && !p.readOnly {
+		p.initializeNodes(logger, awsAdapter, kubeconfig, cluster)
+	}
 
-	if !p.applyOnly {
+	// node pools whose update continues in a later iteration.
+	var incomplete NodePoolErrors
+
+	if p.disasterRecovery {
+		logger.Warn("Disaster recovery, skipping node pool update")
+		skipNodePools(summary, cluster, "disaster recovery")
+	} else if p.applyOnly {
+		skipNodePools(summary, cluster, "apply only")
+	} else {
 		switch cluster.LifecycleStatus {
 		case models.ClusterLifecycleStatusRequested, models.ClusterUpdateLifecycleStatusCreating:
 			log.Warnf("New cluster (%s), skipping node pool update", cluster.LifecycleStatus)
+			skipNodePools(summary, cluster, "new cluster")
+			for _, nodePool := range cluster.NodePools {
+				setNodePoolStatus(cluster, nodePool, awsAdapter.templateHashes[nodePool.Name], stackStatus)
+			}
 		default:
-			// update nodes
+			// update nodes, a failing worker node pool doesn't
+			// prevent the remaining worker node pools from being
+			// updated. The master node pools are updated first and
+			// a failing one aborts the update of all node pools.
+			var nodePoolErrs NodePoolErrors
 			sort.Sort(api.NodePools(cluster.NodePools))
-			for _, nodePool := range cluster.NodePools {
-				err := updater.Update(context.Background(), nodePool)
+			for i, nodePool := range cluster.NodePools {
+				api.ReportProgress(ctx, api.ProgressStepNodePoolUpdate, nodePool.Name, fmt.Sprintf("Updating node pool %s", nodePool.Name))
+				summary.StartNodePool(nodePool.Name)
+				nodePoolCtx, span := tracing.Start(ctx, "node_pool.provision",
+					tracing.String("node_pool.name", nodePool.Name),
+					tracing.String("node_pool.profile", nodePool.Profile),
+				)
+				err := nodePoolHooks.run(nodePoolCtx, nodePoolHookPhasePreProvision, nodePool)
+				if err == nil {
+					err = updateNodePool(nodePoolCtx, logger, updater, policy, nodePool, p.dryRun)
+				}
+				if err == nil {
+					err = nodePoolHooks.run(nodePoolCtx, nodePoolHookPhasePostProvision, nodePool)
+				}
+				tracing.End(span, err)
+				if err == updatestrategy.ErrRolloutIncomplete || err == updatestrategy.ErrUpdatePaused {
+					logger.Infof("Update of node pool %s continues later: %v", nodePool.Name, err)
+					nodePoolErr := newNodePoolError(nodePool.Name, err)
+					incomplete = append(incomplete, nodePoolErr)
+					summary.FinishNodePool(nodePool.Name, api.UpdateOutcomeIncomplete, err, string(nodePoolErr.Category))
+					continue
+				}
+				if err != nil {
+					logger.Errorf("Failed to update node pool %s: %v", nodePool.Name, err)
+					nodePoolErr := newNodePoolError(nodePool.Name, err)
+					nodePoolErrs = append(nodePoolErrs, nodePoolErr)
+					summary.FinishNodePool(nodePool.Name, api.UpdateOutcomeFailed, err, string(nodePoolErr.Category))
+					if abortNodePoolUpdates(summary, nodePool, cluster.NodePools[i+1:]) {
+						break
+					}
+					continue
+				}
+				if p.dryRun {
+					summary.SkipNodePool(nodePool.Name, "dry run")
+				} else {
+					summary.FinishNodePool(nodePool.Name, api.UpdateOutcomeSucceeded, nil, "")
+				}
+				setNodePoolStatus(cluster, nodePool, awsAdapter.templateHashes[nodePool.Name], stackStatus)
+			}
+
+			poolBackend := updatestrategy.NewASGNodePoolsBackend(cluster.ID, awsAdapter.session)
+			awsAdapter.recordLifecycleMetrics(p.activities, cluster, poolBackend)
+			recordNodeGenerations(logger, cluster, poolBackend.Get)
+
+			if len(nodePoolErrs) > 0 {
+				rollbackNodePools(ctx, logger, awsAdapter, cluster, nodePoolErrs)
+				return nodePoolErrs
+			}
+
+			// incomplete updates leave the node pools surged and
+			// their old launch configurations in use.
+			if len(incomplete) == 0 {
+				err = p.detectDrift(logger, awsAdapter, cluster)
 				if err != nil {
 					return err
 				}
+
+				// old launch configurations and launch template
+				// versions are only unused once all nodes are
+				// updated.
+				err = awsAdapter.CollectLaunchGarbage(cluster.LocalID)
+				if err != nil {
+					logger.Warnf("Failed to collect unused launch configurations of stack %s: %v", cluster.LocalID, err)
+					summary.AddWarning("Failed to collect unused launch configurations of stack %s: %v", cluster.LocalID, err)
+				}
+
+				// volumes and network interfaces are only
+				// detached for good once all nodes are updated.
+				err = p.collectOrphanedResources(logger, awsAdapter, kubeconfig, cluster)
+				if err != nil {
+					logger.Warnf("Failed to collect the orphaned resources of cluster %s: %v", cluster.ID, err)
+					summary.AddWarning("Failed to collect the orphaned resources of cluster %s: %v", cluster.ID, err)
+				}
+
+				// the previous bootstrap tokens are only unused
+				// once all nodes registered with the current one.
+				if bootstrapToken != nil && !p.dryRun {
+					err = p.revokeBootstrapTokens(logger, kubeconfig, bootstrapToken)
+					if err != nil {
+						logger.Warnf("Failed to revoke the previous bootstrap tokens of cluster %s: %v", cluster.ID, err)
+						summary.AddWarning("Failed to revoke the previous bootstrap tokens of cluster %s: %v", cluster.ID, err)
+					}
+				}
 			}
 		}
 	}
 
-	return p.apply(logger, cluster, path.Join(channelConfig.Path, manifestsPath))
+	api.ReportProgress(ctx, api.ProgressStepApplyingManifests, "", "Applying manifests")
+	err = p.apply(logger, cluster, kubeconfig, path.Join(channelConfig.Path, manifestsPath))
+	if err != nil {
+		return err
+	}
+
+	// the cluster isn't up to date before all node pools are updated.
+	if len(incomplete) > 0 {
+		return incomplete
+	}
+
+	// failed smoke tests fail the update, which halts the rollout of
+	// the channel version to the later waves.
+	return newSmokeTestRunner(logger, channelConfig, cluster, kubeconfig, p.dryRun).run(ctx)
+}
+
+// detectDrift reports the properties of the node pool ASGs which were changed
+// outside of cloudformation in the logs, the update summary and the cluster
+// status. If the cluster enables drift remediation the properties are
+// changed back to the values of the stack template.
+func (p *clusterpyProvisioner) detectDrift(logger *log.Entry, awsAdapter *awsAdapter, cluster *api.Cluster) error {
+	drifts, err := awsAdapter.DetectDrift(cluster.LocalID)
+	if err != nil {
+		logger.Warnf("Failed to detect drift of stack %s: %v", cluster.LocalID, err)
+		return nil
+	}
+
+	if cluster.Status == nil {
+		cluster.Status = &api.ClusterStatus{}
+	}
+	cluster.Status.Drift = nil
+
+	for _, drift := range drifts {
+		logger.Warnf("Stack %s drifted: %s", cluster.LocalID, drift)
+		awsAdapter.summary.AddWarning("Stack %s drifted: %s", cluster.LocalID, drift)
+		cluster.Status.Drift = append(cluster.Status.Drift, fmt.Sprintf("%s: %s", cluster.LocalID, drift))
+	}
+
+	if len(drifts) == 0 || p.dryRun || cluster.ConfigItems[configKeyDriftRemediation] != "true" {
+		return nil
+	}
+
+	return awsAdapter.RemediateDrift(drifts)
+}
+
+// collectOrphanedResources reports the orphaned resources of the cluster in
+// the logs, the update summary and the metrics. They're deleted if the
+// cluster enables the cleanup.
+func (p *clusterpyProvisioner) collectOrphanedResources(logger *log.Entry, awsAdapter *awsAdapter, kubeconfig *kubernetes.Kubeconfig, cluster *api.Cluster) error {
+	client, err := kubernetes.NewReadOnlyKubeClientWithTokenSource(kubeconfig.Server, kubeconfig.TokenSource)
+	if err != nil {
+		return err
+	}
+
+	resources, err := awsAdapter.findOrphanedResources(client, cluster)
+	if err != nil {
+		return err
+	}
+
+	for _, resource := range resources {
+		orphanedResources.WithLabelValues(resource.kind).Inc()
+		logger.Warnf("Orphaned %s", resource)
+		awsAdapter.summary.AddWarning("Orphaned %s", resource)
+	}
+
+	if p.dryRun || cluster.ConfigItems[configKeyOrphanCleanup] != "true" {
+		return nil
+	}
+
+	for _, resource := range resources {
+		err := awsAdapter.deleteOrphanedResource(resource)
+		if err != nil {
+			return fmt.Errorf("failed to delete orphaned %s: %v", resource, err)
+		}
+	}
+	return nil
+}
+
+// revokeBootstrapTokens revokes the bootstrap tokens of the cluster except
+// the current one.
+func (p *clusterpyProvisioner) revokeBootstrapTokens(logger *log.Entry, kubeconfig *kubernetes.Kubeconfig, token *bootstrapToken) error {
+	client, err := kubernetes.NewKubeClientWithTokenSource(kubeconfig.Server, kubeconfig.TokenSource)
+	if err != nil {
+		return err
+	}
+	return revokeBootstrapTokens(logger, client, token)
+}
+
+// Reconcile removes the startup taint from the ready nodes of an up to date
+// cluster, e.g. of nodes launched by the autoscaler or replacing unhealthy
+// instances after the last update, which would otherwise stay tainted until
+// the cluster is updated again.
+func (p *clusterpyProvisioner) Reconcile(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	if cluster.Provider != providerID {
+		return ErrProviderNotSupported
+	}
+
+	cluster, err := withValuesFiles(cluster, channelConfig)
+	if err != nil {
+		return err
+	}
+
+	if p.dryRun || p.readOnly || cluster.ConfigItems[startupTaintConfigItemKey] != "true" {
+		return nil
+	}
+
+	logger := log.WithField("cluster", cluster.Alias)
+	awsAdapter, kubeconfig, _, err := p.prepareProvision(logger, cluster, channelConfig)
+	if err != nil {
+		return err
+	}
+
+	p.initializeNodes(logger, awsAdapter, kubeconfig, cluster)
+	return nil
+}
+
+// initializeNodes removes the startup taint from the ready nodes of all node
+// pools of the cluster. It's best effort, failures are logged and the nodes
+// are initialized by the next provisioning.
+func (p *clusterpyProvisioner) initializeNodes(logger *log.Entry, awsAdapter *awsAdapter, kubeconfig *kubernetes.Kubeconfig, cluster *api.Cluster) {
+	client, err := kubernetes.NewKubeClientWithTokenSource(kubeconfig.Server, kubeconfig.TokenSource)
+	if err != nil {
+		logger.Warnf("Failed to initialize the nodes of cluster %s: %v", cluster.ID, err)
+		return
+	}
+
+	poolBackend := updatestrategy.NewASGNodePoolsBackend(cluster.ID, awsAdapter.session)
+	manager := updatestrategy.NewKubernetesNodePoolManager(logger, client, poolBackend, 0, 0, 0)
+	for _, nodePool := range cluster.NodePools {
+		err := updatestrategy.InitializeNodes(logger, manager, nodePool)
+		if err != nil {
+			logger.Warnf("Failed to initialize the nodes of node pool %s: %v", nodePool.Name, err)
+		}
+	}
+}
+
+// updateNodePool logs the update plan of a node pool and updates the node
+// pool unless running in dry run mode. Updates exceeding the blast radius
+// policy of the cluster are not started.
+func updateNodePool(ctx context.Context, logger *log.Entry, updater updatestrategy.UpdateStrategy, policy *blastRadiusPolicy, nodePool *api.NodePool, dryRun bool) error {
+	plan, err := updater.Plan(ctx, nodePool)
+	if err != nil {
+		return err
+	}
+	logger.Infof("Update plan for %s", plan)
+
+	err = policy.check(plan)
+	if err != nil {
+		return err
+	}
+
+	if dryRun {
+		return nil
+	}
+
+	start := time.Now()
+	err = updater.Update(ctx, nodePool)
+	observeDuration(nodePoolUpdateDuration, start, nodePool.Profile, metricResult(err))
+	return err
 }
 
 // Decommission decommissions a cluster provisioned in AWS.
-func (p *clusterpyProvisioner) Decommission(cluster *api.Cluster, channelConfig *channel.Config) error {
+func (p *clusterpyProvisioner) Decommission(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	if p.readOnly {
+		return errDecommissionReadOnly
+	}
+
+	cluster, err := withValuesFiles(cluster, channelConfig)
+	if err != nil {
+		return err
+	}
+
 	logger := log.WithField("cluster", cluster.Alias)
-	awsAdapter, _, err := p.prepareProvision(logger, cluster, channelConfig)
+	awsAdapter, kubeconfig, _, err := p.prepareProvision(logger, cluster, channelConfig)
 	if err != nil {
 		return err
 	}
 
+	// The cluster is torn down such that no resource is deleted before
+	// the resources depending on it. Every step skips the resources
+	// which are already gone, so a failed decommission continues where it
+	// stopped when it's retried.
+
 	// scale down kube-system deployments
 	// This is done to ensure controllers stop running so they don't
 	// recreate resources we delete in the next step
+	api.ReportProgress(ctx, api.ProgressStepScalingDownWorkloads, "", "Scaling down the kube-system deployments")
 	err = backoff.Retry(
 		func() error {
-			return p.downscaleDeployments(logger, cluster, "kube-system")
+			return p.downscaleDeployments(logger, kubeconfig, "kube-system")
 		},
 		backoff.WithMaxTries(backoff.NewConstantBackOff(10*time.Second), 5))
 	if err != nil {
 		logger.Error("Unable to downscale the deployments, proceeding anyway: %s", err)
 	}
 
+	// load balancers created for services of the cluster use its
+	// security groups and subnets.
+	api.ReportProgress(ctx, api.ProgressStepDeletingLoadBalancers, "", "Deleting the load balancers of the cluster")
+	backoffCfg := backoff.NewExponentialBackOff()
+	backoffCfg.MaxElapsedTime = defaultMaxRetryTime
+	err = backoff.Retry(
+		func() error {
+			return awsAdapter.deleteLoadBalancers(cluster)
+		},
+		backoff.WithContext(backoffCfg, ctx))
+	if err != nil {
+		return err
+	}
+
+	api.ReportProgress(ctx, api.ProgressStepDeletingStacks, "", "Deleting the node pools and stacks of the cluster")
+
+	// stopped instances aren't terminated by deleting their node pool
+	// stacks and would keep e.g. security groups of the cluster in use.
+	err = p.terminateStoppedInstances(logger, awsAdapter, cluster)
+	if err != nil {
+		return err
+	}
+
 	// delete all cluster infrastructure stacks
-	err = p.deleteClusterStacks(awsAdapter, cluster)
+	err = p.deleteClusterStacks(ctx, awsAdapter, cluster)
 	if err != nil {
 		return err
 	}
 
 	// delete the main cluster stack
-	err = awsAdapter.DeleteStack(cluster.LocalID)
+	err = awsAdapter.DeleteStack(ctx, cluster.LocalID)
 	if err != nil {
 		return err
 	}
 
+	api.ReportProgress(ctx, api.ProgressStepCleaningUp, "", "Deleting the remaining resources of the cluster")
 	err = p.untagSubnets(awsAdapter, cluster)
 	if err != nil {
 		return err
 	}
 
+	// the userdata is only unused once all nodes are terminated.
+	err = awsAdapter.deleteClusterObjects(cluster)
+	if err != nil {
+		return err
+	}
+
 	if p.removeVolumes {
 		backoffCfg := backoff.NewExponentialBackOff()
 		backoffCfg.MaxElapsedTime = defaultMaxRetryTime
@@ -326,6 +1097,27 @@ func (p *clusterpyProvisioner) Decommission(cluster *api.Cluster, channelConfig
 	return nil
 }
 
+// terminateStoppedInstances terminates all stopped instances of the cluster,
+// e.g. left behind by manual experiments.
+func (p *clusterpyProvisioner) terminateStoppedInstances(logger *log.Entry, awsAdapter *awsAdapter, cluster *api.Cluster) error {
+	clusterTag := fmt.Sprintf("kubernetes.io/cluster/%s", cluster.ID)
+	instances, err := awsAdapter.GetStoppedInstances(map[string]string{clusterTag: "owned"})
+	if err != nil {
+		return err
+	}
+
+	instanceIDs := make([]string, 0, len(instances))
+	for _, instance := range instances {
+		instanceIDs = append(instanceIDs, aws.StringValue(instance.InstanceId))
+	}
+
+	if len(instanceIDs) > 0 {
+		logger.Infof("Terminating stopped instances: %s", strings.Join(instanceIDs, ", "))
+	}
+
+	return awsAdapter.TerminateInstances(instanceIDs)
+}
+
 func (p *clusterpyProvisioner) removeEBSVolumes(awsAdapter *awsAdapter, cluster *api.Cluster) error {
 	clusterTag := fmt.Sprintf("kubernetes.io/cluster/%s", cluster.ID)
 	volumes, err := awsAdapter.GetVolumes(map[string]string{clusterTag: "owned"})
@@ -372,78 +1164,245 @@ func waitForAPIServer(logger *log.Entry, server string, maxTimeout time.Duration
 }
 
 // prepareProvision checks that a cluster can be handled by the provisioner and
-// prepares to provision a cluster by initializing the aws adapter.
+// prepares to provision a cluster by initializing the aws adapter and
+// resolving the kubeconfig used to reach the cluster's API server.
 // TODO: this is doing a lot of things to glue everything together, this should
 // be refactored.
-func (p *clusterpyProvisioner) prepareProvision(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (*awsAdapter, updatestrategy.UpdateStrategy, error) {
+func (p *clusterpyProvisioner) prepareProvision(logger *log.Entry, cluster *api.Cluster, channelConfig *channel.Config) (*awsAdapter, *kubernetes.Kubeconfig, updatestrategy.UpdateStrategy, error) {
 	if cluster.Provider != providerID {
-		return nil, nil, ErrProviderNotSupported
+		return nil, nil, nil, ErrProviderNotSupported
 	}
 
 	logger.Infof("clusterpy: Prepare for provisioning cluster %s (%s)..", cluster.ID, cluster.LifecycleStatus)
 
-	infrastructureAccount := strings.Split(cluster.InfrastructureAccount, ":")
-	if len(infrastructureAccount) != 2 {
-		return nil, nil, fmt.Errorf("clusterpy: Unknown format for infrastructure account '%s", cluster.InfrastructureAccount)
+	sess, err := clusterSession(p.awsConfig, p.assumedRole, p.credentials, cluster)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if p.readOnly {
+		awsUtils.ReadOnly(sess)
 	}
+	p.rateLimiter.Limit(sess, cluster.InfrastructureAccount)
+	p.auditor.Instrument(sess, cluster.ID)
 
-	if infrastructureAccount[0] != "aws" {
-		return nil, nil, fmt.Errorf("clusterpy: Cannot work with cloud provider '%s", infrastructureAccount[0])
+	kubeconfig, err := p.kubeconfigs.Kubeconfig(cluster, sess)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
-	roleArn := p.assumedRole
-	if roleArn != "" {
-		roleArn = fmt.Sprintf("arn:aws:iam::%s:role/%s", infrastructureAccount[1], p.assumedRole)
+	adapter, err := newAWSAdapter(logger, kubeconfig.Server, cluster.Region, sess, kubeconfig.TokenSource, p.dryRun)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	adapter.priceSource = p.priceSource
+	adapter.priceOracle = p.priceOracle
+	adapter.hooks = p.hooks
+	adapter.policies = p.policies
+	adapter.readOnly = p.readOnly
+	adapter.roleArn, err = clusterRoleArn(cluster, getAWSAccountID(cluster.InfrastructureAccount), p.assumedRole)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	adapter.retryThrottled(p.throttleRetry)
+	adapter.costTags, err = newCostAttributionTags(p.initiator)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	logger.Infof("Provisioning with update ID %s", adapter.costTags[updateIDTag])
+	adapter.networkTags, err = newNetworkTags(cluster)
+	if err != nil {
+		return nil, nil, nil, err
 	}
 
-	sess, err := awsUtils.Session(p.awsConfig, roleArn)
+	updateStrategy, err := updateStrategyConfig(cluster, p.updateStrategy)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	adapter, err := newAWSAdapter(logger, cluster.APIServerURL, cluster.Region, sess, p.tokenSource, p.dryRun)
+	poolBackend := updatestrategy.NewASGNodePoolsBackend(cluster.ID, sess)
+	updater, err := newNodePoolUpdater(logger, updateStrategy, kubeconfig, poolBackend, p.readOnly)
 	if err != nil {
-		return nil, nil, err
+		return nil, nil, nil, err
 	}
 
-	// allow clusters to override their update strategy.
-	// use global update strategy if cluster doesn't define one.
-	updateStrategy, ok := cluster.ConfigItems[configKeyUpdateStrategy]
-	if !ok {
-		updateStrategy = p.updateStrategy.Strategy
+	// scaling up node pools mustn't bring back outdated warm instances.
+	updater = updatestrategy.NewWarmPoolStrategy(logger, updater, poolBackend)
+
+	return adapter, kubeconfig, updater, nil
+}
+
+// nodePoolsBackend is a node pool provider backend which also stores the
+// drain statistics and bootstrap failures of its node pools.
+type nodePoolsBackend interface {
+	updatestrategy.ProviderNodePoolsBackend
+	updatestrategy.DrainStatsStore
+	updatestrategy.BootstrapFailureStore
+	updatestrategy.RolloutStore
+}
+
+// updateStrategyConfig returns the update strategy of the cluster. Clusters
+// can override the strategy, the max evict timeout, the interval between
+// evictions of pods without a PodDisruptionBudget in the same namespace, the
+// soak period of canary nodes, the maximum number of nodes replaced per
+// iteration, the time new nodes may take to become healthy, the maximum
+// number of nodes drained at the same time, the maximum number of pod
+// evictions per minute and the preferences of instance refreshes, otherwise
+// the global defaults are used.
+func updateStrategyConfig(cluster *api.Cluster, defaults config.UpdateStrategy) (config.UpdateStrategy, error) {
+	updateStrategy := defaults
+
+	if strategy, ok := cluster.ConfigItems[configKeyUpdateStrategy]; ok {
+		updateStrategy.Strategy = strategy
+	}
+
+	if value, ok := cluster.ConfigItems[configKeyNodeMaxEvictTimeout]; ok {
+		maxEvictTimeout, err := time.ParseDuration(value)
+		if err != nil {
+			return updateStrategy, err
+		}
+		updateStrategy.MaxEvictTimeout = maxEvictTimeout
+	}
+
+	if value, ok := cluster.ConfigItems[configKeyNamespaceEvictionInterval]; ok {
+		namespaceEvictionInterval, err := time.ParseDuration(value)
+		if err != nil {
+			return updateStrategy, err
+		}
+		updateStrategy.NamespaceEvictionInterval = namespaceEvictionInterval
+	}
+
+	if value, ok := cluster.ConfigItems[configKeyCanarySoakPeriod]; ok {
+		canarySoakPeriod, err := time.ParseDuration(value)
+		if err != nil {
+			return updateStrategy, err
+		}
+		updateStrategy.CanarySoakPeriod = canarySoakPeriod
+	}
+
+	if value, ok := cluster.ConfigItems[configKeyMaxNodesPerIteration]; ok {
+		maxNodesPerIteration, err := strconv.Atoi(value)
+		if err != nil {
+			return updateStrategy, err
+		}
+		updateStrategy.MaxNodesPerIteration = maxNodesPerIteration
 	}
 
-	// allow clusters to override their max evict timeout
-	// use global max evict timeout if cluster doesn't define one.
-	maxEvictTimeout := p.updateStrategy.MaxEvictTimeout
+	if value, ok := cluster.ConfigItems[configKeyNodeHealthTimeout]; ok {
+		nodeHealthTimeout, err := time.ParseDuration(value)
+		if err != nil {
+			return updateStrategy, err
+		}
+		updateStrategy.NodeHealthTimeout = nodeHealthTimeout
+	}
+
+	if value, ok := cluster.ConfigItems[configKeyMaxUnavailable]; ok {
+		maxUnavailable, err := strconv.Atoi(value)
+		if err != nil {
+			return updateStrategy, err
+		}
+		updateStrategy.MaxUnavailable = maxUnavailable
+	}
 
-	maxEvictTimeoutStr, ok := cluster.ConfigItems[configKeyNodeMaxEvictTimeout]
-	if ok {
-		maxEvictTimeout, err = time.ParseDuration(maxEvictTimeoutStr)
+	if value, ok := cluster.ConfigItems[configKeyMaxEvictionsPerMinute]; ok {
+		maxEvictionsPerMinute, err := strconv.Atoi(value)
 		if err != nil {
-			return nil, nil, err
+			return updateStrategy, err
 		}
+		updateStrategy.MaxEvictionsPerMinute = maxEvictionsPerMinute
 	}
 
-	var updater updatestrategy.UpdateStrategy
-	switch updateStrategy {
-	case updateStrategyRolling:
-		client, err := kubernetes.NewKubeClientWithTokenSource(cluster.APIServerURL, p.tokenSource)
+	if value, ok := cluster.ConfigItems[configKeyRefreshMinHealthy]; ok {
+		minHealthyPercentage, err := strconv.Atoi(value)
 		if err != nil {
-			return nil, nil, err
+			return updateStrategy, err
 		}
+		updateStrategy.InstanceRefreshMinHealthyPercentage = minHealthyPercentage
+	}
 
-		// setup updater
-		poolBackend := updatestrategy.NewASGNodePoolsBackend(cluster.ID, sess)
+	if value, ok := cluster.ConfigItems[configKeyRefreshCheckpoints]; ok {
+		updateStrategy.InstanceRefreshCheckpoints = value
+	}
+
+	if value, ok := cluster.ConfigItems[configKeyRefreshCheckpointDelay]; ok {
+		checkpointDelay, err := time.ParseDuration(value)
+		if err != nil {
+			return updateStrategy, err
+		}
+		updateStrategy.InstanceRefreshCheckpointDelay = checkpointDelay
+	}
 
-		poolManager := updatestrategy.NewKubernetesNodePoolManager(logger, client, poolBackend, maxEvictTimeout)
+	return updateStrategy, nil
+}
 
-		updater = updatestrategy.NewRollingUpdateStrategy(logger, poolManager, 3)
+// newNodePoolUpdater returns the updater of the node pools of a cluster
+// managed by the provider backend. Node pools are updated with the strategy
+// they select, otherwise with the strategy of the cluster. The updater of a
+// read-only provisioning can't change any resources in the cluster.
+func newNodePoolUpdater(logger *log.Entry, updateStrategy config.UpdateStrategy, kubeconfig *kubernetes.Kubeconfig, poolBackend nodePoolsBackend, readOnly bool) (updatestrategy.UpdateStrategy, error) {
+	switch updateStrategy.Strategy {
+	case updateStrategyRolling, updateStrategyInstanceRefresh:
 	default:
-		return nil, nil, fmt.Errorf("unknown update strategy: %s", p.updateStrategy)
+		return nil, fmt.Errorf("unknown update strategy: %s", updateStrategy.Strategy)
+	}
+
+	newKubeClient := kubernetes.NewKubeClientWithTokenSource
+	if readOnly {
+		newKubeClient = kubernetes.NewReadOnlyKubeClientWithTokenSource
+	}
+
+	client, err := newKubeClient(kubeconfig.Server, kubeconfig.TokenSource)
+	if err != nil {
+		return nil, err
+	}
+
+	poolManager := updatestrategy.NewKubernetesNodePoolManager(logger, client, poolBackend, updateStrategy.MaxEvictTimeout, updateStrategy.NamespaceEvictionInterval, updateStrategy.MaxEvictionsPerMinute)
+
+	strategies := map[string]updatestrategy.UpdateStrategy{
+		updateStrategyRolling: updatestrategy.NewRollingUpdateStrategy(logger, poolManager, poolBackend, poolBackend, poolBackend, 3, updateStrategy.CanarySoakPeriod, updateStrategy.MaxNodesPerIteration, updateStrategy.NodeHealthTimeout, updateStrategy.MaxUnavailable),
+	}
+
+	// instance refreshes are only supported by some node pool backends.
+	if refreshBackend, ok := poolBackend.(updatestrategy.InstanceRefreshBackend); ok {
+		checkpoints, err := updatestrategy.ParseInstanceRefreshCheckpoints(updateStrategy.InstanceRefreshCheckpoints)
+		if err != nil {
+			return nil, err
+		}
+
+		strategies[updateStrategyInstanceRefresh] = updatestrategy.NewInstanceRefreshStrategy(logger, refreshBackend, updatestrategy.InstanceRefreshPreferences{
+			MinHealthyPercentage: updateStrategy.InstanceRefreshMinHealthyPercentage,
+			Checkpoints:          checkpoints,
+			CheckpointDelay:      updateStrategy.InstanceRefreshCheckpointDelay,
+			InstanceWarmup:       updateStrategy.InstanceRefreshInstanceWarmup,
+		})
+	}
+
+	updater, err := updatestrategy.NewNodePoolStrategies(updateStrategy.Strategy, strategies)
+	if err != nil {
+		return nil, err
+	}
+	return updater, nil
+}
+
+// clusterSession returns an AWS session for the infrastructure account of the
+// cluster. The role defined in the assumed_role_arn config item of the cluster
+// is assumed, otherwise the role named assumedRole in the account if set. The
+// credentials of the roles are shared via the cache.
+func clusterSession(awsConfig *aws.Config, assumedRole string, credentials *awsUtils.CredentialsCache, cluster *api.Cluster) (*session.Session, error) {
+	infrastructureAccount := strings.Split(cluster.InfrastructureAccount, ":")
+	if len(infrastructureAccount) != 2 {
+		return nil, fmt.Errorf("clusterpy: Unknown format for infrastructure account '%s", cluster.InfrastructureAccount)
+	}
+
+	if infrastructureAccount[0] != "aws" {
+		return nil, fmt.Errorf("clusterpy: Cannot work with cloud provider '%s", infrastructureAccount[0])
 	}
 
-	return adapter, updater, nil
+	roleArn, err := clusterRoleArn(cluster, infrastructureAccount[1], assumedRole)
+	if err != nil {
+		return nil, err
+	}
+
+	return credentials.Session(awsConfig, roleArn)
 }
 
 // tagSubnets tags all subnets in the default VPC with the kubernetes cluster
@@ -504,8 +1463,8 @@ func (p *clusterpyProvisioner) untagSubnets(awsAdapter *awsAdapter, cluster *api
 
 // downscaleDeployments scales down all deployments of a cluster in the
 // specified namespace.
-func (p *clusterpyProvisioner) downscaleDeployments(logger *log.Entry, cluster *api.Cluster, namespace string) error {
-	client, err := kubernetes.NewKubeClientWithTokenSource(cluster.APIServerURL, p.tokenSource)
+func (p *clusterpyProvisioner) downscaleDeployments(logger *log.Entry, kubeconfig *kubernetes.Kubeconfig, namespace string) error {
+	client, err := kubernetes.NewKubeClientWithTokenSource(kubeconfig.Server, kubeconfig.TokenSource)
 	if err != nil {
 		return err
 	}
@@ -532,7 +1491,7 @@ func (p *clusterpyProvisioner) downscaleDeployments(logger *log.Entry, cluster *
 }
 
 // deleteClusterStacks deletes all stacks tagged by the cluster id.
-func (p *clusterpyProvisioner) deleteClusterStacks(adapter *awsAdapter, cluster *api.Cluster) error {
+func (p *clusterpyProvisioner) deleteClusterStacks(ctx context.Context, adapter *awsAdapter, cluster *api.Cluster) error {
 	tags := map[string]string{
 		"kubernetes.io/cluster/" + cluster.ID: "owned",
 	}
@@ -543,7 +1502,7 @@ func (p *clusterpyProvisioner) deleteClusterStacks(adapter *awsAdapter, cluster
 
 	for _, stack := range stacks {
 		deleteStack := func() error {
-			err := adapter.DeleteStack(aws.StringValue(stack.StackName))
+			err := adapter.DeleteStack(ctx, aws.StringValue(stack.StackName))
 			if err != nil {
 				if isWrongStackStatusErr(err) {
 					return err
@@ -555,7 +1514,7 @@ func (p *clusterpyProvisioner) deleteClusterStacks(adapter *awsAdapter, cluster
 
 		backoffCfg := backoff.NewExponentialBackOff()
 		backoffCfg.MaxElapsedTime = defaultMaxRetryTime
-		err := backoff.Retry(deleteStack, backoffCfg)
+		err := backoff.Retry(deleteStack, backoff.WithContext(backoffCfg, ctx))
 		if err != nil {
 			return err
 		}
@@ -627,8 +1586,8 @@ type deletions struct {
 }
 
 // Deletions uses kubectl delete to delete the provided kubernetes resources.
-func (p *clusterpyProvisioner) Deletions(logger *log.Entry, cluster *api.Cluster, deletions []*resource) error {
-	token, err := p.tokenSource.Token()
+func (p *clusterpyProvisioner) Deletions(logger *log.Entry, kubeconfig *kubernetes.Kubeconfig, deletions []*resource) error {
+	token, err := kubeconfig.TokenSource.Token()
 	if err != nil {
 		return errors.Wrapf(err, "no valid token")
 	}
@@ -636,7 +1595,7 @@ func (p *clusterpyProvisioner) Deletions(logger *log.Entry, cluster *api.Cluster
 	for _, deletion := range deletions {
 		args := []string{
 			"kubectl",
-			fmt.Sprintf("--server=%s", cluster.APIServerURL),
+			fmt.Sprintf("--server=%s", kubeconfig.Server),
 			fmt.Sprintf("--token=%s", token.AccessToken),
 			fmt.Sprintf("--namespace=%s", deletion.Namespace),
 			"delete",
@@ -661,6 +1620,11 @@ func (p *clusterpyProvisioner) Deletions(logger *log.Entry, cluster *api.Cluster
 		cmd := exec.Command(args[0], args[1:]...)
 		cmd.Env = []string{}
 
+		if p.dryRun {
+			logger.Debug(cmd)
+			continue
+		}
+
 		err = command.Run(logger, cmd)
 		if err != nil {
 			// if kubectl failed because the resource didn't
@@ -722,7 +1686,7 @@ func newApplyContext(baseDir string) *applyContext {
 }
 
 // apply calls kubectl apply for all the manifests in manifestsPath.
-func (p *clusterpyProvisioner) apply(logger *log.Entry, cluster *api.Cluster, manifestsPath string) error {
+func (p *clusterpyProvisioner) apply(logger *log.Entry, cluster *api.Cluster, kubeconfig *kubernetes.Kubeconfig, manifestsPath string) error {
 	logger.Debugf("Checking for deletions.yaml")
 	deletions, err := parseDeletions(manifestsPath)
 	if err != nil {
@@ -730,7 +1694,7 @@ func (p *clusterpyProvisioner) apply(logger *log.Entry, cluster *api.Cluster, ma
 	}
 
 	logger.Debugf("Running PreApply deletions (%d)", len(deletions.PreApply))
-	err = p.Deletions(logger, cluster, deletions.PreApply)
+	err = p.Deletions(logger, kubeconfig, deletions.PreApply)
 	if err != nil {
 		return err
 	}
@@ -747,7 +1711,7 @@ func (p *clusterpyProvisioner) apply(logger *log.Entry, cluster *api.Cluster, ma
 		return errors.Wrapf(err, "cannot read directory")
 	}
 
-	token, err := p.tokenSource.Token()
+	token, err := kubeconfig.TokenSource.Token()
 	if err != nil {
 		return errors.Wrapf(err, "no valid token")
 	}
@@ -771,6 +1735,12 @@ func (p *clusterpyProvisioner) apply(logger *log.Entry, cluster *api.Cluster, ma
 		}
 
 		for _, f := range files {
+			// files prefixed with an underscore are snippets
+			// which are only included by other templates.
+			if strings.HasPrefix(f.Name(), "_") {
+				continue
+			}
+
 			// Workaround for CRD issue in Kubernetes <v1.8.4
 			// https://github.bus.zalan.do/teapot/issues/issues/772
 			// TODO: Remove after v1.8.4 is rolled out to all
@@ -780,6 +1750,7 @@ func (p *clusterpyProvisioner) apply(logger *log.Entry, cluster *api.Cluster, ma
 			file := path.Join(componentFolder, f.Name())
 			manifest, err := applyTemplate(applyContext, file, cluster)
 			if err != nil {
+				templateRenderErrors.WithLabelValues(templateKindManifest).Inc()
 				logger.Errorf("Error applying template %v", err)
 			}
 
@@ -792,7 +1763,7 @@ func (p *clusterpyProvisioner) apply(logger *log.Entry, cluster *api.Cluster, ma
 			args := []string{
 				"kubectl",
 				"apply",
-				fmt.Sprintf("--server=%s", cluster.APIServerURL),
+				fmt.Sprintf("--server=%s", kubeconfig.Server),
 				fmt.Sprintf("--token=%s", token.AccessToken),
 				"-f",
 				"-",
@@ -822,7 +1793,7 @@ func (p *clusterpyProvisioner) apply(logger *log.Entry, cluster *api.Cluster, ma
 	}
 
 	logger.Debugf("Running PostApply deletions (%d)", len(deletions.PostApply))
-	err = p.Deletions(logger, cluster, deletions.PostApply)
+	err = p.Deletions(logger, kubeconfig, deletions.PostApply)
 	if err != nil {
 		return err
 	}
@@ -857,15 +1828,11 @@ func manifestHash(context *applyContext, file string, template string, cluster *
 	context.computingManifestHash = true
 	defer context.resetComputingManifestHash()
 
-	templateFile, err := filepath.Abs(path.Clean(path.Join(path.Dir(file), template)))
+	templateFile, err := resolveTemplatePath(context, file, template)
 	if err != nil {
 		return "", err
 	}
 
-	if !strings.HasPrefix(templateFile, context.baseDir) {
-		return "", fmt.Errorf("invalid template path: %s", templateFile)
-	}
-
 	templateData, ok := context.manifestData[templateFile]
 	if !ok {
 		applied, err := applyTemplate(context, templateFile, cluster)
@@ -875,18 +1842,12 @@ func manifestHash(context *applyContext, file string, template string, cluster *
 		templateData = applied
 	}
 
-	return fmt.Sprintf("%x", sha256.Sum256([]byte(templateData))), nil
+	return sha256Sum(templateData), nil
 }
 
 // applyTemplate takes a fileName of a template and the model to apply to it.
 // returns the transformed template or an error if not successful
 func applyTemplate(context *applyContext, file string, cluster *api.Cluster) (string, error) {
-	funcMap := template.FuncMap{
-		"getAWSAccountID": getAWSAccountID,
-		"base64":          base64Encode,
-		"manifestHash":    func(template string) (string, error) { return manifestHash(context, file, template, cluster) },
-	}
-
 	f, err := os.Open(file)
 	if err != nil {
 		return "", err
@@ -895,7 +1856,7 @@ func applyTemplate(context *applyContext, file string, cluster *api.Cluster) (st
 	if err != nil {
 		return "", err
 	}
-	t, err := template.New(f.Name()).Option("missingkey=error").Funcs(funcMap).Parse(string(content))
+	t, err := template.New(f.Name()).Option("missingkey=error").Funcs(templateFuncs(context, file, cluster)).Parse(string(content))
 	if err != nil {
 		return "", err
 	}
@@ -6,6 +6,7 @@ import (
 
 	"github.com/aws/aws-sdk-go/aws"
 	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
 	"github.com/stretchr/testify/assert"
 
 	"golang.org/x/oauth2"
@@ -129,3 +130,100 @@ func TestHasTag(t *testing.T) {
 		})
 	}
 }
+
+type stoppedInstancesEC2APIStub struct {
+	ec2API
+	filters    []*ec2.Filter
+	instances  []*ec2.Instance
+	terminated []string
+}
+
+func (e *stoppedInstancesEC2APIStub) DescribeInstancesPages(input *ec2.DescribeInstancesInput, fn func(*ec2.DescribeInstancesOutput, bool) bool) error {
+	e.filters = input.Filters
+	fn(&ec2.DescribeInstancesOutput{Reservations: []*ec2.Reservation{{Instances: e.instances}}}, true)
+	return nil
+}
+
+func (e *stoppedInstancesEC2APIStub) TerminateInstances(input *ec2.TerminateInstancesInput) (*ec2.TerminateInstancesOutput, error) {
+	e.terminated = append(e.terminated, aws.StringValueSlice(input.InstanceIds)...)
+	return &ec2.TerminateInstancesOutput{}, nil
+}
+
+func TestTerminateStoppedInstances(t *testing.T) {
+	ec2Client := &stoppedInstancesEC2APIStub{
+		instances: []*ec2.Instance{
+			{InstanceId: aws.String("i-1")},
+			{InstanceId: aws.String("i-2")},
+		},
+	}
+	adapter := &awsAdapter{ec2Client: ec2Client}
+	cluster := &api.Cluster{ID: "aws:123456789012:eu-central-1:kube-1"}
+	p := &clusterpyProvisioner{}
+
+	err := p.terminateStoppedInstances(log.WithField("test", true), adapter, cluster)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"i-1", "i-2"}, ec2Client.terminated)
+	assert.Contains(t, ec2Client.filters, &ec2.Filter{
+		Name:   aws.String("tag:kubernetes.io/cluster/aws:123456789012:eu-central-1:kube-1"),
+		Values: aws.StringSlice([]string{"owned"}),
+	})
+
+	// nothing is terminated without stopped instances.
+	ec2Client = &stoppedInstancesEC2APIStub{}
+	adapter.ec2Client = ec2Client
+	err = p.terminateStoppedInstances(log.WithField("test", true), adapter, cluster)
+	assert.NoError(t, err)
+	assert.Empty(t, ec2Client.terminated)
+}
+
+func TestClusterVersionNodePoolFields(t *testing.T) {
+	testCluster := func(modify func(nodePool *api.NodePool)) *api.Cluster {
+		nodePool := &api.NodePool{
+			Name:         "worker-default",
+			Profile:      "worker-default",
+			InstanceType: "m5.large",
+			MinSize:      3,
+			MaxSize:      20,
+		}
+		modify(nodePool)
+		return &api.Cluster{ID: "aws:123456789012:eu-central-1:kube-1", NodePools: []*api.NodePool{nodePool}}
+	}
+
+	channelConfig := &channel.Config{Version: "git-commit-hash"}
+	base, err := clusterVersion(testCluster(func(nodePool *api.NodePool) {}), channelConfig)
+	assert.NoError(t, err)
+
+	for _, tc := range []struct {
+		msg     string
+		modify  func(nodePool *api.NodePool)
+		changed bool
+	}{
+		{
+			msg:    "empty adopted ASGs keep the version",
+			modify: func(nodePool *api.NodePool) { nodePool.AdoptASGs = []string{} },
+		},
+		{
+			msg:     "adopted ASGs change the version",
+			modify:  func(nodePool *api.NodePool) { nodePool.AdoptASGs = []string{"legacy-workers"} },
+			changed: true,
+		},
+		{
+			msg:     "a capacity reservation changes the version",
+			modify:  func(nodePool *api.NodePool) { nodePool.CapacityReservationID = "cr-0123456789abcdef0" },
+			changed: true,
+		},
+		{
+			msg: "a capacity reservation group changes the version",
+			modify: func(nodePool *api.NodePool) {
+				nodePool.CapacityReservationGroupARN = "arn:aws:resource-groups:eu-central-1:123456789012:group/critical"
+			},
+			changed: true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			version, err := clusterVersion(testCluster(tc.modify), channelConfig)
+			assert.NoError(t, err)
+			assert.Equal(t, tc.changed, version != base)
+		})
+	}
+}
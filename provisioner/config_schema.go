@@ -0,0 +1,241 @@
+package provisioner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"gopkg.in/yaml.v2"
+)
+
+// configSchemaFile is the file in the cluster directory of a channel
+// declaring the config items used by its templates.
+const configSchemaFile = "config-items-schema.yaml"
+
+const (
+	configTypeString   = "string"
+	configTypeBool     = "bool"
+	configTypeInt      = "int"
+	configTypeNumber   = "number"
+	configTypeDuration = "duration"
+)
+
+// configItemSchema defines the valid values of a config item. Config items
+// are strings by default.
+type configItemSchema struct {
+	Type     string   `yaml:"type"`
+	Required bool     `yaml:"required"`
+	Enum     []string `yaml:"enum"`
+	Pattern  string   `yaml:"pattern"`
+	Minimum  *float64 `yaml:"minimum"`
+	Maximum  *float64 `yaml:"maximum"`
+}
+
+// configSchema maps config item keys to their schema.
+type configSchema map[string]*configItemSchema
+
+func float64Ptr(value float64) *float64 {
+	return &value
+}
+
+// clmConfigSchema is the schema of the config items interpreted by CLM
+// itself.
+var clmConfigSchema = configSchema{
+	launchTemplateConfigItemKey:             {Type: configTypeBool},
+	startupTaintConfigItemKey:               {Type: configTypeBool},
+	configKeyUpdateStrategy:                 {Enum: []string{updateStrategyRolling, updateStrategyInstanceRefresh}},
+	configKeyNodeMaxEvictTimeout:            {Type: configTypeDuration},
+	configKeyNamespaceEvictionInterval:      {Type: configTypeDuration},
+	configKeyCanarySoakPeriod:               {Type: configTypeDuration},
+	configKeyMaxNodesPerIteration:           {Type: configTypeInt, Minimum: float64Ptr(0)},
+	configKeyNodeHealthTimeout:              {Type: configTypeDuration},
+	configKeyMaxUnavailable:                 {Type: configTypeInt, Minimum: float64Ptr(0)},
+	configKeyMaxEvictionsPerMinute:          {Type: configTypeInt, Minimum: float64Ptr(0)},
+	configKeyRefreshMinHealthy:              {Type: configTypeInt, Minimum: float64Ptr(0), Maximum: float64Ptr(100)},
+	configKeyRefreshCheckpoints:             {Pattern: `^\d+(,\d+)*$`},
+	configKeyRefreshCheckpointDelay:         {Type: configTypeDuration},
+	api.UpdatePausedConfigItem:              {Type: configTypeBool},
+	api.MaintenanceOverrideConfigItem:       {Type: configTypeBool},
+	configKeyDriftRemediation:               {Type: configTypeBool},
+	configKeyOrphanCleanup:                  {Type: configTypeBool},
+	configKeyMaxReplacedNodes:               {Type: configTypeInt, Minimum: float64Ptr(0)},
+	configKeyMaxReplacedCapacity:            {Type: configTypeNumber, Minimum: float64Ptr(0), Maximum: float64Ptr(100)},
+	configKeyMaxAffectedNamespaces:          {Type: configTypeInt, Minimum: float64Ptr(0)},
+	configKeyBlastRadiusOverride:            {Type: configTypeBool},
+	configKeyLastNodePoolOverride:           {Type: configTypeBool},
+	configKeyCostBudget:                     {Type: configTypeNumber, Minimum: float64Ptr(0)},
+	configKeyCostBudgetAction:               {Enum: []string{costBudgetActionRefuse, costBudgetActionWarn}},
+	stackRollbackConfigItemKey:              {Type: configTypeBool},
+	userDataCompressionConfigItemKey:        {Enum: []string{userDataCompressionNone, userDataCompressionGzip}},
+	userDataReadableKeysConfigItemKey:       {Type: configTypeBool},
+	userDataSourceConfigItemKey:             {Enum: []string{userDataSourceS3, userDataSourcePresignedURL, userDataSourceConfigService}},
+	userDataConfigServiceURLConfigItemKey:   {Pattern: `^https://`},
+	userDataPresignedURLTTLConfigItemKey:    {Type: configTypeDuration},
+	assumedRoleConfigItemKey:                {Pattern: roleArnPattern.String()},
+	configKeyBootstrapTokenRotationInterval: {Type: configTypeDuration},
+	configKeyDecommissionTopologyOverride:   {Type: configTypeBool},
+}
+
+// configValidationError lists all invalid config items of a cluster.
+type configValidationError struct {
+	problems []string
+}
+
+func (e *configValidationError) Error() string {
+	return fmt.Sprintf("invalid config items: %s", strings.Join(e.problems, ", "))
+}
+
+// loadConfigSchema loads the config item schema of a channel. Channels
+// without a schema don't restrict their config items.
+func loadConfigSchema(channelConfig *channel.Config) (configSchema, error) {
+	schemaPath := path.Join(channelConfig.Path, "cluster", configSchemaFile)
+	data, err := ioutil.ReadFile(schemaPath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return configSchema{}, nil
+		}
+		return nil, err
+	}
+
+	var schema struct {
+		ConfigItems configSchema `yaml:"config_items"`
+	}
+	err = yaml.Unmarshal(data, &schema)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", schemaPath, err)
+	}
+
+	for key, item := range schema.ConfigItems {
+		if item == nil {
+			return nil, fmt.Errorf("invalid %s: empty schema for config item %s", schemaPath, key)
+		}
+
+		switch item.Type {
+		case "", configTypeString, configTypeBool, configTypeInt, configTypeNumber, configTypeDuration:
+		default:
+			return nil, fmt.Errorf("invalid %s: unknown type '%s' of config item %s", schemaPath, item.Type, key)
+		}
+
+		if item.Pattern != "" {
+			_, err := regexp.Compile(item.Pattern)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: invalid pattern of config item %s: %v", schemaPath, key, err)
+			}
+		}
+	}
+
+	return schema.ConfigItems, nil
+}
+
+// validateConfigItems validates the config items of the cluster against the
+// schema of the config items interpreted by CLM and the schema of the
+// channel, such that invalid values are reported before anything is
+// rendered or applied.
+func validateConfigItems(cluster *api.Cluster, channelConfig *channel.Config) error {
+	channelSchema, err := loadConfigSchema(channelConfig)
+	if err != nil {
+		return err
+	}
+
+	problems := clmConfigSchema.validate(cluster.ConfigItems)
+	_, err = api.ParseMaintenanceWindows(cluster.ConfigItems[api.MaintenanceWindowsConfigItem], cluster.ConfigItems[api.MaintenanceTimezoneConfigItem])
+	if err != nil {
+		problems = append(problems, err.Error())
+	}
+	problems = append(problems, channelSchema.validate(cluster.ConfigItems)...)
+	if len(problems) > 0 {
+		return &configValidationError{problems: problems}
+	}
+
+	return nil
+}
+
+// validate returns the problems of the config items, sorted by key.
+func (s configSchema) validate(configItems map[string]string) []string {
+	keys := make([]string, 0, len(s))
+	for key := range s {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	var problems []string
+	for _, key := range keys {
+		value, ok := configItems[key]
+		if !ok {
+			if s[key].Required {
+				problems = append(problems, fmt.Sprintf("%s is required", key))
+			}
+			continue
+		}
+
+		if problem := s[key].validate(value); problem != "" {
+			problems = append(problems, fmt.Sprintf("%s: %s", key, problem))
+		}
+	}
+	return problems
+}
+
+// validate returns the problem of a config item value or an empty string if
+// the value is valid.
+func (s *configItemSchema) validate(value string) string {
+	var number float64
+	switch s.Type {
+	case configTypeBool:
+		if value != "true" && value != "false" {
+			return fmt.Sprintf("'%s' is not a bool", value)
+		}
+	case configTypeInt:
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Sprintf("'%s' is not an int", value)
+		}
+		number = float64(parsed)
+	case configTypeNumber:
+		parsed, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Sprintf("'%s' is not a number", value)
+		}
+		number = parsed
+	case configTypeDuration:
+		_, err := time.ParseDuration(value)
+		if err != nil {
+			return fmt.Sprintf("'%s' is not a duration", value)
+		}
+	}
+
+	if s.Type == configTypeInt || s.Type == configTypeNumber {
+		if s.Minimum != nil && number < *s.Minimum {
+			return fmt.Sprintf("%s is less than the minimum %g", value, *s.Minimum)
+		}
+		if s.Maximum != nil && number > *s.Maximum {
+			return fmt.Sprintf("%s is greater than the maximum %g", value, *s.Maximum)
+		}
+	}
+
+	if len(s.Enum) > 0 {
+		valid := false
+		for _, allowed := range s.Enum {
+			if value == allowed {
+				valid = true
+				break
+			}
+		}
+		if !valid {
+			return fmt.Sprintf("'%s' is not one of %s", value, strings.Join(s.Enum, ", "))
+		}
+	}
+
+	if s.Pattern != "" && !regexp.MustCompile(s.Pattern).MatchString(value) {
+		return fmt.Sprintf("'%s' doesn't match %s", value, s.Pattern)
+	}
+
+	return ""
+}
@@ -0,0 +1,98 @@
+package provisioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+const testConfigSchema = `
+config_items:
+  apiserver_count:
+    type: int
+    minimum: 1
+    required: true
+  cni_provider:
+    enum: [flannel, calico]
+  etcd_client_ca:
+    pattern: "^arn:aws:acm:"
+`
+
+func TestValidateConfigItems(t *testing.T) {
+	dir, err := ioutil.TempDir("", "schema")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+	channelConfig := &channel.Config{Path: dir}
+
+	// channels without a schema only validate the CLM config items.
+	cluster := &api.Cluster{ConfigItems: map[string]string{"cni_provider": "weave"}}
+	require.NoError(t, validateConfigItems(cluster, channelConfig))
+
+	require.NoError(t, os.Mkdir(path.Join(dir, "cluster"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "cluster", configSchemaFile), []byte(testConfigSchema), 0644))
+
+	for _, tc := range []struct {
+		msg         string
+		configItems map[string]string
+		err         string
+	}{
+		{
+			msg:         "valid config items",
+			configItems: map[string]string{"apiserver_count": "2", "cni_provider": "calico", "launch_template": "true"},
+		},
+		{
+			msg:         "missing required config item",
+			configItems: map[string]string{},
+			err:         "invalid config items: apiserver_count is required",
+		},
+		{
+			msg: "all problems are reported",
+			configItems: map[string]string{
+				"apiserver_count":                      "0",
+				"cni_provider":                         "weave",
+				"etcd_client_ca":                       "foo",
+				"launch_template":                      "yes",
+				"node_max_evict_timeout":               "5",
+				"update_max_replaced_capacity_percent": "120",
+			},
+			err: "invalid config items: " +
+				"launch_template: 'yes' is not a bool, " +
+				"node_max_evict_timeout: '5' is not a duration, " +
+				"update_max_replaced_capacity_percent: 120 is greater than the maximum 100, " +
+				"apiserver_count: 0 is less than the minimum 1, " +
+				"cni_provider: 'weave' is not one of flannel, calico, " +
+				"etcd_client_ca: 'foo' doesn't match ^arn:aws:acm:",
+		},
+		{
+			msg: "invalid maintenance windows",
+			configItems: map[string]string{
+				"apiserver_count":      "2",
+				"maintenance_override": "yes",
+				"maintenance_windows":  "0 2 * * mon 4h",
+			},
+			err: "invalid config items: " +
+				"maintenance_override: 'yes' is not a bool, " +
+				"invalid maintenance window '0 2 * * mon 4h': invalid value 'mon'",
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := validateConfigItems(&api.Cluster{ConfigItems: tc.configItems}, channelConfig)
+			if tc.err == "" {
+				require.NoError(t, err)
+				return
+			}
+			require.Error(t, err)
+			assert.Equal(t, tc.err, err.Error())
+		})
+	}
+
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "cluster", configSchemaFile), []byte("config_items:\n  foo:\n    type: list\n"), 0644))
+	assert.Error(t, validateConfigItems(&api.Cluster{}, channelConfig))
+}
@@ -0,0 +1,71 @@
+package provisioner
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"net/url"
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+const (
+	updateIDTag  = "cluster-lifecycle-manager.zalando.org/update-id"
+	initiatorTag = "cluster-lifecycle-manager.zalando.org/initiator"
+)
+
+// newCostAttributionTags returns the tags attributing the costs of the
+// stack operations and S3 uploads of a single provisioning to it in the AWS
+// Cost and Usage Reports.
+func newCostAttributionTags(initiator string) (map[string]string, error) {
+	id := make([]byte, 8)
+	_, err := rand.Read(id)
+	if err != nil {
+		return nil, err
+	}
+
+	tags := map[string]string{
+		updateIDTag: hex.EncodeToString(id),
+	}
+	if initiator != "" {
+		tags[initiatorTag] = initiator
+	}
+	return tags, nil
+}
+
+// cloudformationTags converts tags to CloudFormation stack tags sorted by
+// key.
+func cloudformationTags(tags map[string]string) []*cloudformation.Tag {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	result := make([]*cloudformation.Tag, 0, len(keys))
+	for _, key := range keys {
+		result = append(result, &cloudformation.Tag{
+			Key:   aws.String(key),
+			Value: aws.String(tags[key]),
+		})
+	}
+	return result
+}
+
+// s3Tagging converts tags to the URL encoded tagging of S3 objects.
+func s3Tagging(tags map[string]string) *string {
+	if len(tags) == 0 {
+		return nil
+	}
+
+	values := url.Values{}
+	for key, value := range tags {
+		values.Set(key, value)
+	}
+	return aws.String(values.Encode())
+}
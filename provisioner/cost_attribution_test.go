@@ -0,0 +1,41 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCostAttributionTags(t *testing.T) {
+	tags, err := newCostAttributionTags("controller")
+	require.NoError(t, err)
+	assert.Len(t, tags[updateIDTag], 16)
+	assert.Equal(t, "controller", tags[initiatorTag])
+
+	other, err := newCostAttributionTags("")
+	require.NoError(t, err)
+	assert.NotEqual(t, tags[updateIDTag], other[updateIDTag])
+	assert.NotContains(t, other, initiatorTag)
+
+	stackTags := cloudformationTags(tags)
+	require.Len(t, stackTags, 2)
+	assert.Equal(t, initiatorTag, aws.StringValue(stackTags[0].Key))
+	assert.Equal(t, updateIDTag, aws.StringValue(stackTags[1].Key))
+
+	assert.Equal(t,
+		"cluster-lifecycle-manager.zalando.org%2Finitiator=provision+cluster",
+		aws.StringValue(s3Tagging(map[string]string{initiatorTag: "provision cluster"})))
+
+	assert.Nil(t, cloudformationTags(nil))
+	assert.Nil(t, s3Tagging(nil))
+
+	// the update ID changes with every provisioning, so it's only added to
+	// the S3 objects and not to the stacks.
+	adapter := &awsAdapter{costTags: tags}
+	assert.Equal(t, map[string]string{
+		initiatorTag:    "controller",
+		templateHashTag: "hash",
+	}, adapter.stackTags("hash"))
+}
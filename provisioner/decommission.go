@@ -0,0 +1,305 @@
+package provisioner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// maxDescribeTagsResources is the maximum number of load balancers
+	// or target groups whose tags can be described at once.
+	maxDescribeTagsResources = 20
+	// userDataClusterMetadataKey is the metadata of the userdata objects
+	// with the ID of the cluster they were rendered for.
+	userDataClusterMetadataKey = "cluster"
+)
+
+// clusterOwnedTag returns the key and value of the tag of the resources
+// owned by the cluster, e.g. created by Kubernetes for services of type
+// LoadBalancer or persistent volumes.
+func clusterOwnedTag(cluster *api.Cluster) (string, string) {
+	return tagNameKubernetesClusterPrefix + cluster.ID, resourceLifecycleOwned
+}
+
+// deleteLoadBalancers deletes the classic and application/network load
+// balancers owned by the cluster and then their target groups. They're
+// created outside of the stacks of the cluster and would keep its security
+// groups and subnets in use, failing the deletion of the stacks.
+func (a *awsAdapter) deleteLoadBalancers(cluster *api.Cluster) error {
+	key, value := clusterOwnedTag(cluster)
+
+	elbTags, err := a.classicLoadBalancerTags()
+	if err != nil {
+		return err
+	}
+
+	for _, name := range taggedResources(elbTags, key, value) {
+		if a.skipReadOnly("deleting load balancer %s", name) {
+			continue
+		}
+
+		a.logger.Infof("Deleting load balancer %s", name)
+		_, err := a.elbClient.DeleteLoadBalancer(&elb.DeleteLoadBalancerInput{LoadBalancerName: aws.String(name)})
+		if err != nil {
+			return fmt.Errorf("failed to delete load balancer %s: %v", name, err)
+		}
+	}
+
+	lbTags, err := a.elbv2LoadBalancerTags()
+	if err != nil {
+		return err
+	}
+
+	for _, arn := range taggedResources(lbTags, key, value) {
+		if a.skipReadOnly("deleting load balancer %s", arn) {
+			continue
+		}
+
+		a.logger.Infof("Deleting load balancer %s", arn)
+		_, err := a.elbv2Client.DeleteLoadBalancer(&elbv2.DeleteLoadBalancerInput{LoadBalancerArn: aws.String(arn)})
+		if err != nil {
+			return fmt.Errorf("failed to delete load balancer %s: %v", arn, err)
+		}
+	}
+
+	// target groups can only be deleted once the load balancers
+	// forwarding to them are deleted.
+	var arns []string
+	err = a.elbv2Client.DescribeTargetGroupsPages(&elbv2.DescribeTargetGroupsInput{}, func(resp *elbv2.DescribeTargetGroupsOutput, lastPage bool) bool {
+		for _, group := range resp.TargetGroups {
+			arns = append(arns, aws.StringValue(group.TargetGroupArn))
+		}
+		return true
+	})
+	if err != nil {
+		return err
+	}
+
+	groupTags, err := a.elbv2Tags(arns)
+	if err != nil {
+		return err
+	}
+
+	for _, arn := range taggedResources(groupTags, key, value) {
+		if a.skipReadOnly("deleting target group %s", arn) {
+			continue
+		}
+
+		a.logger.Infof("Deleting target group %s", arn)
+		_, err := a.elbv2Client.DeleteTargetGroup(&elbv2.DeleteTargetGroupInput{TargetGroupArn: aws.String(arn)})
+		if err != nil {
+			return fmt.Errorf("failed to delete target group %s: %v", arn, err)
+		}
+	}
+
+	return nil
+}
+
+// classicLoadBalancerTags returns the tags of all classic load balancers by
+// name.
+func (a *awsAdapter) classicLoadBalancerTags() (map[string]map[string]string, error) {
+	var names []string
+	err := a.elbClient.DescribeLoadBalancersPages(&elb.DescribeLoadBalancersInput{}, func(resp *elb.DescribeLoadBalancersOutput, lastPage bool) bool {
+		for _, lb := range resp.LoadBalancerDescriptions {
+			names = append(names, aws.StringValue(lb.LoadBalancerName))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	result := make(map[string]map[string]string, len(names))
+	for start := 0; start < len(names); start += maxDescribeTagsResources {
+		end := start + maxDescribeTagsResources
+		if end > len(names) {
+			end = len(names)
+		}
+
+		resp, err := a.elbClient.DescribeTags(&elb.DescribeTagsInput{LoadBalancerNames: aws.StringSlice(names[start:end])})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, description := range resp.TagDescriptions {
+			tags := make(map[string]string, len(description.Tags))
+			for _, tag := range description.Tags {
+				tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+			result[aws.StringValue(description.LoadBalancerName)] = tags
+		}
+	}
+	return result, nil
+}
+
+// elbv2LoadBalancerTags returns the tags of all application/network load
+// balancers by ARN.
+func (a *awsAdapter) elbv2LoadBalancerTags() (map[string]map[string]string, error) {
+	var arns []string
+	err := a.elbv2Client.DescribeLoadBalancersPages(&elbv2.DescribeLoadBalancersInput{}, func(resp *elbv2.DescribeLoadBalancersOutput, lastPage bool) bool {
+		for _, lb := range resp.LoadBalancers {
+			arns = append(arns, aws.StringValue(lb.LoadBalancerArn))
+		}
+		return true
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	return a.elbv2Tags(arns)
+}
+
+// elbv2Tags returns the tags of the application/network load balancers or
+// target groups by ARN.
+func (a *awsAdapter) elbv2Tags(arns []string) (map[string]map[string]string, error) {
+	result := make(map[string]map[string]string, len(arns))
+	for start := 0; start < len(arns); start += maxDescribeTagsResources {
+		end := start + maxDescribeTagsResources
+		if end > len(arns) {
+			end = len(arns)
+		}
+
+		resp, err := a.elbv2Client.DescribeTags(&elbv2.DescribeTagsInput{ResourceArns: aws.StringSlice(arns[start:end])})
+		if err != nil {
+			return nil, err
+		}
+
+		for _, description := range resp.TagDescriptions {
+			tags := make(map[string]string, len(description.Tags))
+			for _, tag := range description.Tags {
+				tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+			}
+			result[aws.StringValue(description.ResourceArn)] = tags
+		}
+	}
+	return result, nil
+}
+
+// taggedResources returns the sorted IDs of the resources having the
+// specified tag.
+func taggedResources(resourceTags map[string]map[string]string, key, value string) []string {
+	var result []string
+	for id, tags := range resourceTags {
+		if v, ok := tags[key]; ok && v == value {
+			result = append(result, id)
+		}
+	}
+	sort.Strings(result)
+	return result
+}
+
+// deleteClusterObjects deletes the S3 objects of the cluster: the userdata
+// of its node pools from the userdata bucket, which may be shared with other
+// clusters, and its previous stack template and update summary from the CLM
+// bucket. Userdata is attributed to the cluster by its metadata, userdata
+// uploaded without metadata is kept. The pre-signed URLs stored next to the
+// userdata are deleted with it.
+func (a *awsAdapter) deleteClusterObjects(cluster *api.Cluster) error {
+	bucket, err := newUserDataBucket(cluster)
+	if err != nil {
+		return err
+	}
+
+	// userdata with readable keys is prefixed with the local ID of the
+	// cluster.
+	prefix := ""
+	if cluster.ConfigItems[userDataReadableKeysConfigItemKey] == "true" {
+		prefix = cluster.LocalID + "/"
+	}
+
+	client := a.userDataS3Client(bucket)
+	var keys []string
+	presignedURLs := make(map[string]bool)
+	err = client.ListObjectsV2Pages(&s3.ListObjectsV2Input{Bucket: aws.String(bucket.name), Prefix: aws.String(prefix)}, func(resp *s3.ListObjectsV2Output, lastPage bool) bool {
+		for _, object := range resp.Contents {
+			key := aws.StringValue(object.Key)
+			switch {
+			case strings.HasSuffix(key, ".userdata"):
+				keys = append(keys, key)
+			case strings.HasSuffix(key, ".userdata"+presignedURLSuffix):
+				presignedURLs[key] = true
+			}
+		}
+		return true
+	})
+	if err != nil && !isNoSuchBucketErr(err) {
+		return err
+	}
+
+	for _, key := range keys {
+		resp, err := client.HeadObject(&s3.HeadObjectInput{Bucket: aws.String(bucket.name), Key: aws.String(key)})
+		if err != nil {
+			return err
+		}
+
+		if objectMetadata(resp.Metadata, userDataClusterMetadataKey) != cluster.ID {
+			continue
+		}
+
+		err = a.deleteObject(client, bucket.name, key)
+		if err != nil {
+			return err
+		}
+
+		if presignedURLs[key+presignedURLSuffix] {
+			err = a.deleteObject(client, bucket.name, key+presignedURLSuffix)
+			if err != nil {
+				return err
+			}
+		}
+	}
+
+	clmBucket, err := clmBucketName(cluster)
+	if err != nil {
+		return err
+	}
+	for _, key := range []string{fmt.Sprintf(previousTemplateKeyFmt, cluster.ID), fmt.Sprintf(updateSummaryKeyFmt, cluster.ID)} {
+		err = a.deleteObject(a.s3Client, clmBucket, key)
+		if err != nil && !isNoSuchBucketErr(err) {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteObject deletes an S3 object, deleting objects which don't exist
+// succeeds.
+func (a *awsAdapter) deleteObject(client s3API, bucket, key string) error {
+	if a.skipReadOnly("deleting s3://%s/%s", bucket, key) {
+		return nil
+	}
+
+	a.logger.Infof("Deleting s3://%s/%s", bucket, key)
+	_, err := client.DeleteObject(&s3.DeleteObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	return err
+}
+
+// objectMetadata returns the value of the metadata of an S3 object. The keys
+// of the metadata are case-insensitive.
+func objectMetadata(metadata map[string]*string, key string) string {
+	for k, v := range metadata {
+		if strings.EqualFold(k, key) {
+			return aws.StringValue(v)
+		}
+	}
+	return ""
+}
+
+// isNoSuchBucketErr returns true if the error is caused by a bucket which
+// doesn't exist.
+func isNoSuchBucketErr(err error) bool {
+	if aerr, ok := err.(awserr.Error); ok {
+		return aerr.Code() == s3.ErrCodeNoSuchBucket
+	}
+	return false
+}
@@ -0,0 +1,194 @@
+package provisioner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// decommissionProtectionTag marks the ASG of a node pool with decommission
+// protection. The protection is kept on the ASG rather than read from the
+// registry, since a node pool missing from the registry by mistake, e.g.
+// because of a typo in its name, must still be protected.
+const decommissionProtectionTag = "cluster-lifecycle-manager.zalando.org/decommission-protection"
+
+// orphanedTag marks the ASG of a node pool which was found missing from the
+// cluster. Node pools are only removed from the stack once they're missing
+// in two consecutive updates, such that a registry momentarily returning an
+// incomplete list of node pools doesn't decommission them.
+const orphanedTag = "cluster-lifecycle-manager.zalando.org/orphaned"
+
+// decommissionProtectedError is returned when node pools with decommission
+// protection would be removed from a cluster.
+type decommissionProtectedError struct {
+	cluster   string
+	nodePools []string
+}
+
+func (e *decommissionProtectedError) Error() string {
+	return fmt.Sprintf("refusing to decommission protected node pools %s of cluster %s, disable decommission_protection of the node pools first", strings.Join(e.nodePools, ", "), e.cluster)
+}
+
+// orphanedNodePoolsError is returned when node pools are found missing from a
+// cluster for the first time. The update is retried and removes them if they
+// are still missing.
+type orphanedNodePoolsError struct {
+	cluster   string
+	nodePools []string
+}
+
+func (e *orphanedNodePoolsError) Error() string {
+	return fmt.Sprintf("node pools %s of cluster %s are missing, they are decommissioned by the next update if they're still missing", strings.Join(e.nodePools, ", "), e.cluster)
+}
+
+// definedNodePools returns the names of the node pools of the cluster,
+// including the previous names of renamed node pools, whose ASGs are kept.
+func definedNodePools(cluster *api.Cluster) map[string]bool {
+	defined := make(map[string]bool, len(cluster.NodePools))
+	for _, nodePool := range cluster.NodePools {
+		defined[nodePool.Name] = true
+		if nodePool.PreviousName != "" {
+			defined[nodePool.PreviousName] = true
+		}
+	}
+	return defined
+}
+
+// listStackASGs lists the ASGs created by the stack.
+func (a *awsAdapter) listStackASGs(stackName string) ([]*autoscaling.Group, error) {
+	groups, err := a.listASGs()
+	if err != nil {
+		return nil, err
+	}
+
+	expectedTags := []*autoscaling.TagDescription{
+		{
+			Key:   aws.String("aws:cloudformation:stack-name"),
+			Value: aws.String(stackName),
+		},
+	}
+
+	var stackGroups []*autoscaling.Group
+	for _, group := range groups {
+		if asgHasTags(expectedTags, group.Tags) {
+			stackGroups = append(stackGroups, group)
+		}
+	}
+	return stackGroups, nil
+}
+
+// protectedNodePools returns the sorted names of the node pools whose ASGs
+// have decommission protection but are missing from the cluster.
+func protectedNodePools(cluster *api.Cluster, groups []*autoscaling.Group) []string {
+	defined := definedNodePools(cluster)
+
+	var protected []string
+	for _, group := range groups {
+		var nodePool string
+		enabled := false
+		for _, tag := range group.Tags {
+			switch aws.StringValue(tag.Key) {
+			case "NodePool":
+				nodePool = aws.StringValue(tag.Value)
+			case decommissionProtectionTag:
+				enabled = aws.StringValue(tag.Value) == "true"
+			}
+		}
+
+		if enabled && nodePool != "" && !defined[nodePool] {
+			protected = append(protected, nodePool)
+		}
+	}
+
+	sort.Strings(protected)
+	return protected
+}
+
+// checkDecommissionProtection returns a decommissionProtectedError if the
+// stack of the cluster contains protected node pools which are no longer
+// defined for the cluster and would be removed by the stack update.
+func (a *awsAdapter) checkDecommissionProtection(cluster *api.Cluster) error {
+	groups, err := a.listStackASGs(cluster.LocalID)
+	if err != nil {
+		return err
+	}
+
+	protected := protectedNodePools(cluster, groups)
+	if len(protected) > 0 {
+		return &decommissionProtectedError{cluster: cluster.ID, nodePools: protected}
+	}
+	return nil
+}
+
+// updateDecommissionProtection tags the ASGs of the node pools with
+// decommission protection and removes the tag from the others.
+func (a *awsAdapter) updateDecommissionProtection(cluster *api.Cluster) error {
+	for _, nodePool := range cluster.NodePools {
+		asg, err := a.getNodePoolASG(cluster.LocalID, nodePool.Name)
+		if err != nil {
+			return err
+		}
+		asgName := aws.StringValue(asg.AutoScalingGroupName)
+
+		if nodePool.DecommissionProtection {
+			err = a.tagASG(asgName, map[string]string{decommissionProtectionTag: "true"})
+		} else if asgHasTags([]*autoscaling.TagDescription{{Key: aws.String(decommissionProtectionTag), Value: aws.String("true")}}, asg.Tags) {
+			err = a.deleteASGTag(asgName, decommissionProtectionTag)
+		}
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// confirmOrphanedNodePools marks the ASGs of node pools which are missing
+// from the cluster as orphaned and returns an orphanedNodePoolsError if any
+// of them wasn't marked before. Otherwise the ASGs of the node pools which are
+// still missing are returned. The mark is removed from the ASGs of node pools
+// which are defined again.
+func (a *awsAdapter) confirmOrphanedNodePools(cluster *api.Cluster) ([]*autoscaling.Group, error) {
+	groups, err := a.listStackASGs(cluster.LocalID)
+	if err != nil {
+		return nil, err
+	}
+
+	defined := definedNodePools(cluster)
+
+	var orphaned []string
+	var confirmed []*autoscaling.Group
+	for _, group := range groups {
+		nodePool := asgTagValue(group, "NodePool")
+		if nodePool == "" {
+			continue
+		}
+
+		asgName := aws.StringValue(group.AutoScalingGroupName)
+		marked := asgTagValue(group, orphanedTag) == "true"
+
+		switch {
+		case defined[nodePool] && marked:
+			err = a.deleteASGTag(asgName, orphanedTag)
+		case !defined[nodePool] && !marked:
+			a.logger.Warnf("Node pool %s is missing from the cluster", nodePool)
+			orphaned = append(orphaned, nodePool)
+			err = a.tagASG(asgName, map[string]string{orphanedTag: "true"})
+		case !defined[nodePool]:
+			confirmed = append(confirmed, group)
+		}
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	if len(orphaned) > 0 {
+		sort.Strings(orphaned)
+		return nil, &orphanedNodePoolsError{cluster: cluster.ID, nodePools: orphaned}
+	}
+	return confirmed, nil
+}
@@ -0,0 +1,113 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func nodePoolASG(nodePool string, protected bool) *autoscaling.Group {
+	group := &autoscaling.Group{
+		Tags: []*autoscaling.TagDescription{
+			{Key: aws.String("NodePool"), Value: aws.String(nodePool)},
+		},
+	}
+	if protected {
+		group.Tags = append(group.Tags, &autoscaling.TagDescription{Key: aws.String(decommissionProtectionTag), Value: aws.String("true")})
+	}
+	return group
+}
+
+func TestProtectedNodePools(t *testing.T) {
+	cluster := &api.Cluster{
+		NodePools: []*api.NodePool{
+			{Name: "master-default"},
+			{Name: "default-worker", DecommissionProtection: true},
+		},
+	}
+
+	groups := []*autoscaling.Group{
+		nodePoolASG("master-default", false),
+		nodePoolASG("default-worker", true),
+		nodePoolASG("removed", false),
+		nodePoolASG("stateful", true),
+		nodePoolASG("batch", true),
+	}
+
+	assert.Equal(t, []string{"batch", "stateful"}, protectedNodePools(cluster, groups))
+	assert.Empty(t, protectedNodePools(cluster, groups[:3]))
+}
+
+func TestProtectedNodePoolsRenamed(t *testing.T) {
+	cluster := &api.Cluster{
+		NodePools: []*api.NodePool{
+			{Name: "worker-default", PreviousName: "default-worker", DecommissionProtection: true},
+		},
+	}
+
+	// the ASG of a renamed node pool is tagged with the previous name
+	// until the stack is updated.
+	assert.Empty(t, protectedNodePools(cluster, []*autoscaling.Group{nodePoolASG("default-worker", true)}))
+}
+
+func TestConfirmOrphanedNodePools(t *testing.T) {
+	stackTag := map[string]string{"aws:cloudformation:stack-name": "kube-1"}
+	asg := func(name string, tags map[string]string) *autoscaling.Group {
+		allTags := map[string]string{"NodePool": name}
+		for key, value := range stackTag {
+			allTags[key] = value
+		}
+		for key, value := range tags {
+			allTags[key] = value
+		}
+		return suspendTestASG(name, allTags, 1, 1, 1)
+	}
+
+	cluster := &api.Cluster{
+		ID:      "aws:123456789012:eu-central-1:kube-1",
+		LocalID: "kube-1",
+		NodePools: []*api.NodePool{
+			{Name: "master-default"},
+			{Name: "worker-default"},
+		},
+	}
+
+	asgClient := &suspendAutoscalingAPIStub{
+		groups: []*autoscaling.Group{
+			asg("master-default", nil),
+			asg("worker-default", map[string]string{orphanedTag: "true"}),
+			asg("worker-removed", nil),
+			asg("worker-confirmed", map[string]string{orphanedTag: "true"}),
+			suspendTestASG("etcd", stackTag, 3, 3, 3),
+		},
+	}
+	a := &awsAdapter{autoscalingClient: asgClient, logger: log.WithField("cluster", "kube-1")}
+
+	// node pools missing for the first time are marked and block the
+	// update.
+	_, err := a.confirmOrphanedNodePools(cluster)
+	require.Error(t, err)
+	orphanedErr, ok := err.(*orphanedNodePoolsError)
+	require.True(t, ok)
+	assert.Equal(t, []string{"worker-removed"}, orphanedErr.nodePools)
+	require.Len(t, asgClient.tags, 1)
+	assert.Equal(t, "worker-removed", aws.StringValue(asgClient.tags[0].ResourceId))
+	assert.Equal(t, orphanedTag, aws.StringValue(asgClient.tags[0].Key))
+
+	// node pools which are defined again aren't orphaned anymore.
+	require.Len(t, asgClient.deletedTags, 1)
+	assert.Equal(t, "worker-default", aws.StringValue(asgClient.deletedTags[0].ResourceId))
+
+	// node pools missing for the second time are decommissioned.
+	asgClient.groups = asgClient.groups[3:]
+	confirmed, err := a.confirmOrphanedNodePools(cluster)
+	require.NoError(t, err)
+	require.Len(t, confirmed, 1)
+	assert.Equal(t, "worker-confirmed", aws.StringValue(confirmed[0].AutoScalingGroupName))
+}
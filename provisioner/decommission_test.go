@@ -0,0 +1,250 @@
+package provisioner
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const decommissionedClusterID = "aws:123456789012:eu-central-1:kube-1"
+
+var ownedTags = map[string]string{"kubernetes.io/cluster/" + decommissionedClusterID: "owned"}
+
+type elbAPIStub struct {
+	tags    map[string]map[string]string
+	deleted []string
+}
+
+func (e *elbAPIStub) DescribeLoadBalancersPages(input *elb.DescribeLoadBalancersInput, fn func(*elb.DescribeLoadBalancersOutput, bool) bool) error {
+	var lbs []*elb.LoadBalancerDescription
+	for name := range e.tags {
+		lbs = append(lbs, &elb.LoadBalancerDescription{LoadBalancerName: aws.String(name)})
+	}
+	fn(&elb.DescribeLoadBalancersOutput{LoadBalancerDescriptions: lbs}, true)
+	return nil
+}
+
+func (e *elbAPIStub) DescribeTags(input *elb.DescribeTagsInput) (*elb.DescribeTagsOutput, error) {
+	if len(input.LoadBalancerNames) > maxDescribeTagsResources {
+		return nil, fmt.Errorf("too many load balancers")
+	}
+
+	var descriptions []*elb.TagDescription
+	for _, name := range input.LoadBalancerNames {
+		description := &elb.TagDescription{LoadBalancerName: name}
+		for key, value := range e.tags[aws.StringValue(name)] {
+			description.Tags = append(description.Tags, &elb.Tag{Key: aws.String(key), Value: aws.String(value)})
+		}
+		descriptions = append(descriptions, description)
+	}
+	return &elb.DescribeTagsOutput{TagDescriptions: descriptions}, nil
+}
+
+func (e *elbAPIStub) DeleteLoadBalancer(input *elb.DeleteLoadBalancerInput) (*elb.DeleteLoadBalancerOutput, error) {
+	e.deleted = append(e.deleted, aws.StringValue(input.LoadBalancerName))
+	return nil, nil
+}
+
+type elbv2APIStub struct {
+	loadBalancerTags map[string]map[string]string
+	targetGroupTags  map[string]map[string]string
+	deleted          []string
+}
+
+func (e *elbv2APIStub) DescribeLoadBalancersPages(input *elbv2.DescribeLoadBalancersInput, fn func(*elbv2.DescribeLoadBalancersOutput, bool) bool) error {
+	var lbs []*elbv2.LoadBalancer
+	for arn := range e.loadBalancerTags {
+		lbs = append(lbs, &elbv2.LoadBalancer{LoadBalancerArn: aws.String(arn)})
+	}
+	fn(&elbv2.DescribeLoadBalancersOutput{LoadBalancers: lbs}, true)
+	return nil
+}
+
+func (e *elbv2APIStub) DescribeTargetGroupsPages(input *elbv2.DescribeTargetGroupsInput, fn func(*elbv2.DescribeTargetGroupsOutput, bool) bool) error {
+	var groups []*elbv2.TargetGroup
+	for arn := range e.targetGroupTags {
+		groups = append(groups, &elbv2.TargetGroup{TargetGroupArn: aws.String(arn)})
+	}
+	fn(&elbv2.DescribeTargetGroupsOutput{TargetGroups: groups}, true)
+	return nil
+}
+
+func (e *elbv2APIStub) DescribeTags(input *elbv2.DescribeTagsInput) (*elbv2.DescribeTagsOutput, error) {
+	var descriptions []*elbv2.TagDescription
+	for _, arn := range input.ResourceArns {
+		tags, ok := e.loadBalancerTags[aws.StringValue(arn)]
+		if !ok {
+			tags = e.targetGroupTags[aws.StringValue(arn)]
+		}
+
+		description := &elbv2.TagDescription{ResourceArn: arn}
+		for key, value := range tags {
+			description.Tags = append(description.Tags, &elbv2.Tag{Key: aws.String(key), Value: aws.String(value)})
+		}
+		descriptions = append(descriptions, description)
+	}
+	return &elbv2.DescribeTagsOutput{TagDescriptions: descriptions}, nil
+}
+
+func (e *elbv2APIStub) DeleteLoadBalancer(input *elbv2.DeleteLoadBalancerInput) (*elbv2.DeleteLoadBalancerOutput, error) {
+	e.deleted = append(e.deleted, aws.StringValue(input.LoadBalancerArn))
+	return nil, nil
+}
+
+func (e *elbv2APIStub) DeleteTargetGroup(input *elbv2.DeleteTargetGroupInput) (*elbv2.DeleteTargetGroupOutput, error) {
+	e.deleted = append(e.deleted, aws.StringValue(input.TargetGroupArn))
+	return nil, nil
+}
+
+func TestDeleteLoadBalancers(t *testing.T) {
+	// more load balancers than can be described at once.
+	elbTags := map[string]map[string]string{
+		"owned":  ownedTags,
+		"shared": {"kubernetes.io/cluster/" + decommissionedClusterID: "shared"},
+	}
+	for i := 0; i < 30; i++ {
+		elbTags[fmt.Sprintf("other-%d", i)] = map[string]string{"kubernetes.io/cluster/kube-2": "owned"}
+	}
+
+	elbClient := &elbAPIStub{tags: elbTags}
+	elbv2Client := &elbv2APIStub{
+		loadBalancerTags: map[string]map[string]string{
+			"arn:lb-owned": ownedTags,
+			"arn:lb-other": {},
+		},
+		targetGroupTags: map[string]map[string]string{
+			"arn:tg-owned": ownedTags,
+			"arn:tg-other": {},
+		},
+	}
+	a := &awsAdapter{elbClient: elbClient, elbv2Client: elbv2Client, logger: log.WithField("cluster", "kube-1")}
+
+	require.NoError(t, a.deleteLoadBalancers(&api.Cluster{ID: decommissionedClusterID}))
+	assert.Equal(t, []string{"owned"}, elbClient.deleted)
+	assert.Equal(t, []string{"arn:lb-owned", "arn:tg-owned"}, elbv2Client.deleted)
+
+	// nothing is deleted in read-only mode.
+	elbClient.deleted, elbv2Client.deleted = nil, nil
+	a.readOnly = true
+	require.NoError(t, a.deleteLoadBalancers(&api.Cluster{ID: decommissionedClusterID}))
+	assert.Empty(t, elbClient.deleted)
+	assert.Empty(t, elbv2Client.deleted)
+}
+
+type objectsS3APIStub struct {
+	s3API
+	// objects are the keys of the objects by bucket with the cluster
+	// metadata of the objects.
+	objects map[string]map[string]string
+	prefix  string
+	deleted []string
+}
+
+func (s *objectsS3APIStub) ListObjectsV2Pages(input *s3.ListObjectsV2Input, fn func(*s3.ListObjectsV2Output, bool) bool) error {
+	objects, ok := s.objects[aws.StringValue(input.Bucket)]
+	if !ok {
+		return awserr.New(s3.ErrCodeNoSuchBucket, "bucket doesn't exist", nil)
+	}
+
+	s.prefix = aws.StringValue(input.Prefix)
+	var contents []*s3.Object
+	for key := range objects {
+		contents = append(contents, &s3.Object{Key: aws.String(key)})
+	}
+	fn(&s3.ListObjectsV2Output{Contents: contents}, true)
+	return nil
+}
+
+func (s *objectsS3APIStub) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	metadata := make(map[string]*string)
+	if cluster := s.objects[aws.StringValue(input.Bucket)][aws.StringValue(input.Key)]; cluster != "" {
+		metadata["Cluster"] = aws.String(cluster)
+	}
+	return &s3.HeadObjectOutput{Metadata: metadata}, nil
+}
+
+func (s *objectsS3APIStub) DeleteObject(input *s3.DeleteObjectInput) (*s3.DeleteObjectOutput, error) {
+	if _, ok := s.objects[aws.StringValue(input.Bucket)]; !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchBucket, "bucket doesn't exist", nil)
+	}
+	s.deleted = append(s.deleted, fmt.Sprintf("%s/%s", aws.StringValue(input.Bucket), aws.StringValue(input.Key)))
+	return nil, nil
+}
+
+func TestDeleteClusterObjects(t *testing.T) {
+	bucket := "cluster-lifecycle-manager-123456789012-eu-central-1"
+
+	for _, tc := range []struct {
+		msg            string
+		configItems    map[string]string
+		objects        map[string]map[string]string
+		expectedPrefix string
+		expected       []string
+	}{
+		{
+			msg: "userdata of the cluster in the CLM bucket",
+			objects: map[string]map[string]string{
+				bucket: {
+					"a.userdata":     decommissionedClusterID,
+					"a.userdata.url": "",
+					"b.userdata":     "aws:123456789012:eu-central-1:kube-2",
+					"b.userdata.url": "",
+					"c.userdata":     "",
+					"aws:123456789012:eu-central-1:kube-2.previous.template": "",
+				},
+			},
+			expected: []string{
+				bucket + "/a.userdata",
+				bucket + "/a.userdata.url",
+				bucket + "/" + decommissionedClusterID + ".previous.template",
+				bucket + "/" + decommissionedClusterID + ".update-summary.json",
+			},
+		},
+		{
+			msg:         "readable keys in an external bucket",
+			configItems: map[string]string{userDataBucketConfigItemKey: "userdata", userDataReadableKeysConfigItemKey: "true"},
+			objects: map[string]map[string]string{
+				"userdata": {"kube-1/worker/a.userdata": decommissionedClusterID},
+				bucket:     {},
+			},
+			expectedPrefix: "kube-1/",
+			expected: []string{
+				"userdata/kube-1/worker/a.userdata",
+				bucket + "/" + decommissionedClusterID + ".previous.template",
+				bucket + "/" + decommissionedClusterID + ".update-summary.json",
+			},
+		},
+		{
+			msg:      "buckets which don't exist",
+			objects:  map[string]map[string]string{},
+			expected: nil,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			client := &objectsS3APIStub{objects: tc.objects}
+			a := &awsAdapter{s3Client: client, region: "eu-central-1", logger: log.WithField("cluster", "kube-1")}
+
+			cluster := &api.Cluster{
+				ID:                    decommissionedClusterID,
+				LocalID:               "kube-1",
+				InfrastructureAccount: "aws:123456789012",
+				Region:                "eu-central-1",
+				ConfigItems:           tc.configItems,
+			}
+
+			require.NoError(t, a.deleteClusterObjects(cluster))
+			assert.Equal(t, tc.expectedPrefix, client.prefix)
+			assert.Equal(t, tc.expected, client.deleted)
+		})
+	}
+}
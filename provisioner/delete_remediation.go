@@ -0,0 +1,193 @@
+package provisioner
+
+import (
+	"context"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/pkg/errors"
+)
+
+const (
+	resourceTypeSecurityGroup = "AWS::EC2::SecurityGroup"
+	resourceTypeSubnet        = "AWS::EC2::Subnet"
+
+	networkInterfaceNotFoundErrCode = "InvalidNetworkInterfaceID.NotFound"
+)
+
+// isDeleteFailedErr returns true if the error describes a stack in the
+// DELETE_FAILED status.
+func isDeleteFailedErr(err error) bool {
+	return errors.Cause(err) == errDeleteFailed
+}
+
+// removeDeletionBlockers removes the dependencies which commonly prevent the
+// resources of a stack from being deleted: network interfaces left behind by
+// the CNI in the failed security groups and subnets, and rules of other
+// security groups referencing the failed security groups. It returns the
+// number of removed dependencies.
+func (a *awsAdapter) removeDeletionBlockers(stackName string) (int, error) {
+	resources, err := a.deleteFailedResources(stackName)
+	if err != nil {
+		return 0, err
+	}
+
+	removed := 0
+	for _, resource := range resources {
+		id := aws.StringValue(resource.PhysicalResourceId)
+		switch aws.StringValue(resource.ResourceType) {
+		case resourceTypeSecurityGroup:
+			n, err := a.deleteAvailableNetworkInterfaces("group-id", id)
+			if err != nil {
+				return removed, err
+			}
+			removed += n
+
+			n, err = a.revokeSecurityGroupReferences(id)
+			if err != nil {
+				return removed, err
+			}
+			removed += n
+		case resourceTypeSubnet:
+			n, err := a.deleteAvailableNetworkInterfaces("subnet-id", id)
+			if err != nil {
+				return removed, err
+			}
+			removed += n
+		}
+	}
+
+	return removed, nil
+}
+
+// deleteFailedResources returns the resources of a stack which failed to be
+// deleted.
+func (a *awsAdapter) deleteFailedResources(stackName string) ([]*cloudformation.StackResource, error) {
+	resp, err := a.cloudformationClient.DescribeStackResources(&cloudformation.DescribeStackResourcesInput{
+		StackName: aws.String(stackName),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var failed []*cloudformation.StackResource
+	for _, resource := range resp.StackResources {
+		if aws.StringValue(resource.ResourceStatus) == cloudformation.ResourceStatusDeleteFailed {
+			failed = append(failed, resource)
+		}
+	}
+	return failed, nil
+}
+
+// deleteStackRetainingFailed retries the deletion of a stack in DELETE_FAILED
+// retaining the resources which failed to be deleted. The retained resources
+// are logged, as they have to be cleaned up manually. deleteErr is returned
+// if there are no resources to retain.
+func (a *awsAdapter) deleteStackRetainingFailed(ctx context.Context, stackName string, deleteErr error) error {
+	resources, err := a.deleteFailedResources(stackName)
+	if err != nil {
+		a.logger.Warnf("Failed to get the resources of stack '%s': %v", stackName, err)
+		return deleteErr
+	}
+	if len(resources) == 0 {
+		return deleteErr
+	}
+
+	retain := make([]string, 0, len(resources))
+	for _, resource := range resources {
+		a.logger.Warnf("Retaining %s %s (%s) of stack '%s' which failed to be deleted", aws.StringValue(resource.ResourceType), aws.StringValue(resource.LogicalResourceId), aws.StringValue(resource.PhysicalResourceId), stackName)
+		retain = append(retain, aws.StringValue(resource.LogicalResourceId))
+	}
+
+	return a.deleteStackAndWait(ctx, stackName, retain)
+}
+
+// deleteAvailableNetworkInterfaces deletes the detached network interfaces
+// matching the filter. Network interfaces still attached to an instance are
+// left alone.
+func (a *awsAdapter) deleteAvailableNetworkInterfaces(filter, value string) (int, error) {
+	resp, err := a.ec2Client.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String(filter), Values: aws.StringSlice([]string{value})},
+			{Name: aws.String("status"), Values: aws.StringSlice([]string{ec2.NetworkInterfaceStatusAvailable})},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	for _, eni := range resp.NetworkInterfaces {
+		a.logger.Infof("Deleting network interface %s blocking the deletion of %s", aws.StringValue(eni.NetworkInterfaceId), value)
+		_, err := a.ec2Client.DeleteNetworkInterface(&ec2.DeleteNetworkInterfaceInput{
+			NetworkInterfaceId: eni.NetworkInterfaceId,
+		})
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == networkInterfaceNotFoundErrCode {
+			continue
+		}
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return len(resp.NetworkInterfaces), nil
+}
+
+// revokeSecurityGroupReferences revokes the ingress rules of other security
+// groups which allow traffic from the security group.
+func (a *awsAdapter) revokeSecurityGroupReferences(groupID string) (int, error) {
+	resp, err := a.ec2Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String("ip-permission.group-id"), Values: aws.StringSlice([]string{groupID})},
+		},
+	})
+	if err != nil {
+		return 0, err
+	}
+
+	revoked := 0
+	for _, group := range resp.SecurityGroups {
+		if aws.StringValue(group.GroupId) == groupID {
+			continue
+		}
+
+		permissions := referencingPermissions(group.IpPermissions, groupID)
+		if len(permissions) == 0 {
+			continue
+		}
+
+		a.logger.Infof("Revoking ingress rules of security group %s referencing %s", aws.StringValue(group.GroupId), groupID)
+		_, err := a.ec2Client.RevokeSecurityGroupIngress(&ec2.RevokeSecurityGroupIngressInput{
+			GroupId:       group.GroupId,
+			IpPermissions: permissions,
+		})
+		if err != nil {
+			return revoked, err
+		}
+		revoked += len(permissions)
+	}
+
+	return revoked, nil
+}
+
+// referencingPermissions returns the permissions which allow traffic from the
+// security group, reduced to the references of the group.
+func referencingPermissions(permissions []*ec2.IpPermission, groupID string) []*ec2.IpPermission {
+	var referencing []*ec2.IpPermission
+	for _, permission := range permissions {
+		for _, pair := range permission.UserIdGroupPairs {
+			if aws.StringValue(pair.GroupId) != groupID {
+				continue
+			}
+
+			referencing = append(referencing, &ec2.IpPermission{
+				IpProtocol:       permission.IpProtocol,
+				FromPort:         permission.FromPort,
+				ToPort:           permission.ToPort,
+				UserIdGroupPairs: []*ec2.UserIdGroupPair{pair},
+			})
+		}
+	}
+	return referencing
+}
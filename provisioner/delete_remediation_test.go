@@ -0,0 +1,189 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type deleteFailedCloudFormationAPIStub struct {
+	cloudFormationAPI
+	resources []*cloudformation.StackResource
+}
+
+func (c *deleteFailedCloudFormationAPIStub) DescribeStackResources(input *cloudformation.DescribeStackResourcesInput) (*cloudformation.DescribeStackResourcesOutput, error) {
+	return &cloudformation.DescribeStackResourcesOutput{StackResources: c.resources}, nil
+}
+
+type deletionBlockersEC2APIStub struct {
+	ec2API
+	interfaces map[string][]string
+	groups     []*ec2.SecurityGroup
+	deleted    []string
+	revoked    map[string][]*ec2.IpPermission
+}
+
+func (e *deletionBlockersEC2APIStub) DescribeNetworkInterfaces(input *ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	var interfaces []*ec2.NetworkInterface
+	for _, id := range e.interfaces[aws.StringValue(input.Filters[0].Values[0])] {
+		interfaces = append(interfaces, &ec2.NetworkInterface{NetworkInterfaceId: aws.String(id)})
+	}
+	return &ec2.DescribeNetworkInterfacesOutput{NetworkInterfaces: interfaces}, nil
+}
+
+func (e *deletionBlockersEC2APIStub) DeleteNetworkInterface(input *ec2.DeleteNetworkInterfaceInput) (*ec2.DeleteNetworkInterfaceOutput, error) {
+	e.deleted = append(e.deleted, aws.StringValue(input.NetworkInterfaceId))
+	return nil, nil
+}
+
+func (e *deletionBlockersEC2APIStub) DescribeSecurityGroups(input *ec2.DescribeSecurityGroupsInput) (*ec2.DescribeSecurityGroupsOutput, error) {
+	return &ec2.DescribeSecurityGroupsOutput{SecurityGroups: e.groups}, nil
+}
+
+func (e *deletionBlockersEC2APIStub) RevokeSecurityGroupIngress(input *ec2.RevokeSecurityGroupIngressInput) (*ec2.RevokeSecurityGroupIngressOutput, error) {
+	e.revoked[aws.StringValue(input.GroupId)] = input.IpPermissions
+	return nil, nil
+}
+
+func TestRemoveDeletionBlockers(t *testing.T) {
+	cf := &deleteFailedCloudFormationAPIStub{
+		resources: []*cloudformation.StackResource{
+			{ResourceType: aws.String(resourceTypeSecurityGroup), PhysicalResourceId: aws.String("sg-worker"), ResourceStatus: aws.String(cloudformation.ResourceStatusDeleteFailed)},
+			{ResourceType: aws.String(resourceTypeSubnet), PhysicalResourceId: aws.String("subnet-a"), ResourceStatus: aws.String(cloudformation.ResourceStatusDeleteFailed)},
+			{ResourceType: aws.String(resourceTypeSubnet), PhysicalResourceId: aws.String("subnet-b"), ResourceStatus: aws.String(cloudformation.ResourceStatusDeleteComplete)},
+		},
+	}
+
+	fromWorker := &ec2.UserIdGroupPair{GroupId: aws.String("sg-worker")}
+	ec2Client := &deletionBlockersEC2APIStub{
+		interfaces: map[string][]string{
+			"sg-worker": {"eni-1"},
+			"subnet-a":  {"eni-2"},
+			"subnet-b":  {"eni-3"},
+		},
+		groups: []*ec2.SecurityGroup{
+			{
+				GroupId: aws.String("sg-worker"),
+				IpPermissions: []*ec2.IpPermission{
+					{IpProtocol: aws.String("-1"), UserIdGroupPairs: []*ec2.UserIdGroupPair{fromWorker}},
+				},
+			},
+			{
+				GroupId: aws.String("sg-ingress"),
+				IpPermissions: []*ec2.IpPermission{
+					{
+						IpProtocol:       aws.String("tcp"),
+						FromPort:         aws.Int64(443),
+						ToPort:           aws.Int64(443),
+						UserIdGroupPairs: []*ec2.UserIdGroupPair{{GroupId: aws.String("sg-other")}, fromWorker},
+					},
+				},
+			},
+		},
+		revoked: make(map[string][]*ec2.IpPermission),
+	}
+
+	adapter := &awsAdapter{cloudformationClient: cf, ec2Client: ec2Client, logger: log.WithField("test", true)}
+	removed, err := adapter.removeDeletionBlockers("kube-1-worker")
+	require.NoError(t, err)
+	assert.Equal(t, 3, removed)
+	assert.Equal(t, []string{"eni-1", "eni-2"}, ec2Client.deleted)
+	assert.Equal(t, map[string][]*ec2.IpPermission{
+		"sg-ingress": {{
+			IpProtocol:       aws.String("tcp"),
+			FromPort:         aws.Int64(443),
+			ToPort:           aws.Int64(443),
+			UserIdGroupPairs: []*ec2.UserIdGroupPair{fromWorker},
+		}},
+	}, ec2Client.revoked)
+}
+
+func TestIsDeleteFailedErr(t *testing.T) {
+	assert.True(t, isDeleteFailedErr(errDeleteFailed))
+	assert.True(t, isDeleteFailedErr(&stackFailedError{err: errDeleteFailed}))
+	assert.False(t, isDeleteFailedErr(&stackFailedError{err: errCreateFailed}))
+	assert.False(t, isDeleteFailedErr(errors.New("failed")))
+	assert.False(t, isDeleteFailedErr(nil))
+}
+
+type stackRecoveryCloudFormationAPIStub struct {
+	cloudFormationAPI
+	status    string
+	resources []*cloudformation.StackResource
+	deleted   [][]string
+	created   int
+}
+
+func (c *stackRecoveryCloudFormationAPIStub) DescribeStacks(input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+	if c.status == cloudformation.StackStatusDeleteComplete {
+		return nil, awserr.New("ValidationError", fmt.Sprintf("Stack with id %s does not exist", aws.StringValue(input.StackName)), nil)
+	}
+	return &cloudformation.DescribeStacksOutput{Stacks: []*cloudformation.Stack{{StackName: input.StackName, StackStatus: aws.String(c.status)}}}, nil
+}
+
+func (c *stackRecoveryCloudFormationAPIStub) DescribeStackResources(input *cloudformation.DescribeStackResourcesInput) (*cloudformation.DescribeStackResourcesOutput, error) {
+	return &cloudformation.DescribeStackResourcesOutput{StackResources: c.resources}, nil
+}
+
+func (c *stackRecoveryCloudFormationAPIStub) UpdateTerminationProtection(input *cloudformation.UpdateTerminationProtectionInput) (*cloudformation.UpdateTerminationProtectionOutput, error) {
+	return nil, nil
+}
+
+func (c *stackRecoveryCloudFormationAPIStub) DeleteStack(input *cloudformation.DeleteStackInput) (*cloudformation.DeleteStackOutput, error) {
+	c.deleted = append(c.deleted, aws.StringValueSlice(input.RetainResources))
+	c.status = cloudformation.StackStatusDeleteComplete
+	return nil, nil
+}
+
+func (c *stackRecoveryCloudFormationAPIStub) CreateStackWithContext(ctx aws.Context, input *cloudformation.CreateStackInput, opts ...request.Option) (*cloudformation.CreateStackOutput, error) {
+	if c.status != cloudformation.StackStatusDeleteComplete {
+		return nil, awserr.New(cloudformation.ErrCodeAlreadyExistsException, "stack already exists", nil)
+	}
+	c.created++
+	c.status = cloudformation.StackStatusCreateInProgress
+	return nil, nil
+}
+
+func TestDeleteStackRetainingFailed(t *testing.T) {
+	cf := &stackRecoveryCloudFormationAPIStub{
+		status: cloudformation.StackStatusDeleteFailed,
+		resources: []*cloudformation.StackResource{
+			{LogicalResourceId: aws.String("WorkerSecurityGroup"), ResourceType: aws.String(resourceTypeSecurityGroup), ResourceStatus: aws.String(cloudformation.ResourceStatusDeleteFailed)},
+			{LogicalResourceId: aws.String("WorkerSubnet"), ResourceType: aws.String(resourceTypeSubnet), ResourceStatus: aws.String(cloudformation.ResourceStatusDeleteComplete)},
+		},
+	}
+	adapter := &awsAdapter{cloudformationClient: cf, logger: log.WithField("test", true)}
+
+	err := adapter.deleteStackRetainingFailed(context.Background(), "kube-1-worker", errDeleteFailed)
+	require.NoError(t, err)
+	assert.Equal(t, [][]string{{"WorkerSecurityGroup"}}, cf.deleted)
+
+	// the deletion isn't retried without resources to retain.
+	cf = &stackRecoveryCloudFormationAPIStub{status: cloudformation.StackStatusDeleteFailed}
+	adapter = &awsAdapter{cloudformationClient: cf, logger: log.WithField("test", true)}
+	err = adapter.deleteStackRetainingFailed(context.Background(), "kube-1-worker", errDeleteFailed)
+	assert.Equal(t, errDeleteFailed, err)
+	assert.Empty(t, cf.deleted)
+}
+
+func TestApplyStackRecreatesRolledBackStack(t *testing.T) {
+	cf := &stackRecoveryCloudFormationAPIStub{status: cloudformation.StackStatusRollbackComplete}
+	adapter := &awsAdapter{cloudformationClient: cf, logger: log.WithField("test", true)}
+
+	updated, err := adapter.applyStack(context.Background(), "kube-1", `{"stack": "template"}`, "", "", true)
+	require.NoError(t, err)
+	assert.True(t, updated)
+	assert.Equal(t, [][]string{{}}, cf.deleted)
+	assert.Equal(t, 1, cf.created)
+	assert.Equal(t, cloudformation.StackStatusCreateInProgress, cf.status)
+}
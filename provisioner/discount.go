@@ -0,0 +1,206 @@
+package provisioner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+)
+
+const (
+	discountStrategyNone         = "none"
+	discountStrategySpotMaxPrice = "spot_max_price"
+	// discountStrategyPriceOracle runs the node pool on spot instances
+	// with the max price returned by the price oracle.
+	discountStrategyPriceOracle = "price_oracle"
+
+	// priceOracleTimeout limits the time the price oracle may take to
+	// return a max price.
+	priceOracleTimeout = 10 * time.Second
+)
+
+// discountStrategy defines how the instances of a node pool are bought.
+type discountStrategy interface {
+	// spot returns true if the node pool runs on spot instances, which
+	// may be interrupted.
+	spot() bool
+	// maxPrice returns the maximum hourly price paid for the spot
+	// instances of the node pool in the region of the cluster, or an
+	// empty string for on-demand instances.
+	maxPrice(cluster *api.Cluster, nodePool *api.NodePool, prices *priceLookup) (string, error)
+}
+
+// discountStrategies are the discount strategies by the discount_strategy of
+// the node pools. Node pools without a discount strategy use on-demand
+// instances.
+var discountStrategies = map[string]discountStrategy{
+	"":                           onDemandStrategy{},
+	discountStrategyNone:         onDemandStrategy{},
+	discountStrategySpotMaxPrice: spotMaxPriceStrategy{},
+	discountStrategyPriceOracle:  priceOracleStrategy{},
+}
+
+// nodePoolDiscountStrategy returns the discount strategy of the node pool.
+func nodePoolDiscountStrategy(nodePool *api.NodePool) (discountStrategy, error) {
+	strategy, ok := discountStrategies[nodePool.DiscountStrategy]
+	if !ok {
+		return nil, fmt.Errorf("unsupported discount_strategy %s", nodePool.DiscountStrategy)
+	}
+	return strategy, nil
+}
+
+// isSpotNodePool returns true if the node pool runs on spot instances. Node
+// pools with an unknown discount strategy are rejected by the provisioners.
+func isSpotNodePool(nodePool *api.NodePool) bool {
+	strategy, ok := discountStrategies[nodePool.DiscountStrategy]
+	return ok && strategy.spot()
+}
+
+// priceLookup holds the sources of the prices used by the discount
+// strategies. Both are optional.
+type priceLookup struct {
+	// source is used to look up on-demand prices missing from the
+	// bundled instance info.
+	source awsExt.PriceSource
+	// oracle returns the max prices of the price_oracle strategy.
+	oracle *priceOracle
+}
+
+// onDemandPrice returns the on-demand price of the instance type of the node
+// pool in the region of the cluster.
+func (p *priceLookup) onDemandPrice(cluster *api.Cluster, nodePool *api.NodePool) (string, error) {
+	var source awsExt.PriceSource
+	if p != nil {
+		source = p.source
+	}
+
+	price, err := awsExt.OnDemandPrice(nodePool.InstanceType, cluster.Region, source)
+	spotPriceLookups.WithLabelValues(metricResult(err)).Inc()
+	return price, err
+}
+
+// onDemandStrategy runs the node pool on on-demand instances.
+type onDemandStrategy struct{}
+
+func (onDemandStrategy) spot() bool {
+	return false
+}
+
+func (onDemandStrategy) maxPrice(cluster *api.Cluster, nodePool *api.NodePool, prices *priceLookup) (string, error) {
+	return "", nil
+}
+
+// spotMaxPriceStrategy runs the node pool on spot instances, paying up to the
+// on-demand price.
+type spotMaxPriceStrategy struct{}
+
+func (spotMaxPriceStrategy) spot() bool {
+	return true
+}
+
+func (spotMaxPriceStrategy) maxPrice(cluster *api.Cluster, nodePool *api.NodePool, prices *priceLookup) (string, error) {
+	return prices.onDemandPrice(cluster, nodePool)
+}
+
+// priceOracleStrategy runs the node pool on spot instances, paying up to the
+// max price returned by the price oracle.
+type priceOracleStrategy struct{}
+
+func (priceOracleStrategy) spot() bool {
+	return true
+}
+
+func (priceOracleStrategy) maxPrice(cluster *api.Cluster, nodePool *api.NodePool, prices *priceLookup) (string, error) {
+	if prices == nil || prices.oracle == nil {
+		return "", fmt.Errorf("discount_strategy %s of node pool %s requires a price oracle", discountStrategyPriceOracle, nodePool.Name)
+	}
+
+	onDemandPrice, err := prices.onDemandPrice(cluster, nodePool)
+	if err != nil {
+		return "", err
+	}
+
+	// GPU capacity is priced and interrupted differently, so the oracle
+	// gets the GPUs of the instance type to bid for GPU pools separately.
+	instanceInfo := awsExt.InstanceInfo()[nodePool.InstanceType]
+
+	return prices.oracle.maxPrice(&priceOracleRequest{
+		ClusterID:     cluster.ID,
+		Region:        cluster.Region,
+		NodePool:      nodePool.Name,
+		InstanceType:  nodePool.InstanceType,
+		OnDemandPrice: onDemandPrice,
+		GPU:           instanceInfo.GPU,
+		GPUType:       instanceInfo.GPUType,
+	})
+}
+
+// priceOracleRequest is the JSON body posted to the price oracle. The GPU
+// fields are omitted for instance types without GPUs.
+type priceOracleRequest struct {
+	ClusterID     string `json:"cluster_id"`
+	Region        string `json:"region"`
+	NodePool      string `json:"node_pool"`
+	InstanceType  string `json:"instance_type"`
+	OnDemandPrice string `json:"on_demand_price"`
+	GPU           int64  `json:"gpu,omitempty"`
+	GPUType       string `json:"gpu_type,omitempty"`
+}
+
+// priceOracleResponse is the JSON body returned by the price oracle.
+type priceOracleResponse struct {
+	MaxPrice string `json:"max_price"`
+}
+
+// priceOracle is an HTTP endpoint returning the max price of the spot
+// instances of node pools, such that custom bidding logic can be implemented
+// outside of CLM.
+type priceOracle struct {
+	url    string
+	client *http.Client
+}
+
+// newPriceOracle returns the price oracle at the URL, or nil if the URL is
+// empty.
+func newPriceOracle(url string) *priceOracle {
+	if url == "" {
+		return nil
+	}
+	return &priceOracle{url: url, client: &http.Client{Timeout: priceOracleTimeout}}
+}
+
+// maxPrice posts the request to the price oracle and returns the max price
+// it responded with. The max price must be a positive number.
+func (o *priceOracle) maxPrice(request *priceOracleRequest) (string, error) {
+	data, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := o.client.Post(o.url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return "", fmt.Errorf("failed to query the price oracle: %v", err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return "", fmt.Errorf("unexpected status code %d from the price oracle", resp.StatusCode)
+	}
+
+	var response priceOracleResponse
+	err = json.NewDecoder(resp.Body).Decode(&response)
+	if err != nil {
+		return "", fmt.Errorf("invalid response of the price oracle: %v", err)
+	}
+
+	price, err := strconv.ParseFloat(response.MaxPrice, 64)
+	if err != nil || price <= 0 {
+		return "", fmt.Errorf("invalid max price '%s' of node pool %s returned by the price oracle", response.MaxPrice, request.NodePool)
+	}
+	return response.MaxPrice, nil
+}
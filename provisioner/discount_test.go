@@ -0,0 +1,93 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+)
+
+func TestNodePoolDiscountStrategy(t *testing.T) {
+	for _, tc := range []struct {
+		discountStrategy string
+		spot             bool
+		valid            bool
+	}{
+		{discountStrategy: "", valid: true},
+		{discountStrategy: discountStrategyNone, valid: true},
+		{discountStrategy: discountStrategySpotMaxPrice, spot: true, valid: true},
+		{discountStrategy: discountStrategyPriceOracle, spot: true, valid: true},
+		{discountStrategy: "preemptible"},
+	} {
+		t.Run(tc.discountStrategy, func(t *testing.T) {
+			nodePool := &api.NodePool{Name: "worker", DiscountStrategy: tc.discountStrategy}
+
+			strategy, err := nodePoolDiscountStrategy(nodePool)
+			if !tc.valid {
+				assert.Error(t, err)
+				assert.False(t, isSpotNodePool(nodePool))
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.spot, strategy.spot())
+			assert.Equal(t, tc.spot, isSpotNodePool(nodePool))
+		})
+	}
+}
+
+func TestPriceOracleStrategy(t *testing.T) {
+	var received priceOracleRequest
+	maxPrice := "0.05"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPost, r.Method)
+		assert.NoError(t, json.NewDecoder(r.Body).Decode(&received))
+		json.NewEncoder(w).Encode(&priceOracleResponse{MaxPrice: maxPrice})
+	}))
+	defer server.Close()
+
+	cluster := &api.Cluster{ID: "aws:123456789012:eu-central-1:kube-1", Region: "eu-central-1"}
+	nodePool := &api.NodePool{Name: "worker", InstanceType: "m5.large", DiscountStrategy: discountStrategyPriceOracle}
+	strategy := discountStrategies[discountStrategyPriceOracle]
+
+	price, err := strategy.maxPrice(cluster, nodePool, &priceLookup{oracle: newPriceOracle(server.URL)})
+	require.NoError(t, err)
+	assert.Equal(t, "0.05", price)
+	assert.Equal(t, cluster.ID, received.ClusterID)
+	assert.Equal(t, "worker", received.NodePool)
+	assert.Equal(t, "m5.large", received.InstanceType)
+	assert.NotEmpty(t, received.OnDemandPrice)
+	assert.Zero(t, received.GPU)
+
+	// GPU pools pass their GPUs to the oracle.
+	gpuPool := &api.NodePool{Name: "worker-gpu", InstanceType: "p2.xlarge", DiscountStrategy: discountStrategyPriceOracle}
+	_, err = strategy.maxPrice(cluster, gpuPool, &priceLookup{oracle: newPriceOracle(server.URL)})
+	require.NoError(t, err)
+	assert.Equal(t, "p2.xlarge", received.InstanceType)
+	assert.Equal(t, int64(1), received.GPU)
+	assert.Equal(t, "nvidia-tesla-k80", received.GPUType)
+
+	maxPrice = "-1"
+	_, err = strategy.maxPrice(cluster, nodePool, &priceLookup{oracle: newPriceOracle(server.URL)})
+	assert.Error(t, err)
+
+	// the strategy can't be used without an oracle.
+	_, err = strategy.maxPrice(cluster, nodePool, nil)
+	assert.Error(t, err)
+	assert.Nil(t, newPriceOracle(""))
+}
+
+func TestSpotMaxPriceStrategyGPU(t *testing.T) {
+	cluster := &api.Cluster{Region: "eu-central-1"}
+	nodePool := &api.NodePool{Name: "worker-gpu", InstanceType: "p2.xlarge", DiscountStrategy: discountStrategySpotMaxPrice}
+
+	price, err := discountStrategies[discountStrategySpotMaxPrice].maxPrice(cluster, nodePool, nil)
+	require.NoError(t, err)
+	assert.NotEmpty(t, price)
+	assert.Equal(t, awsExt.InstanceInfo()["p2.xlarge"].Pricing["eu-central-1"], price)
+}
@@ -0,0 +1,185 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+const (
+	resourceTypeAutoScalingGroup    = "AWS::AutoScaling::AutoScalingGroup"
+	propertyMinSize                 = "MinSize"
+	propertyMaxSize                 = "MaxSize"
+	propertyLaunchConfigurationName = "LaunchConfigurationName"
+)
+
+// stackDrift describes a property of a stack resource where the live value
+// differs from the value defined in the stack template.
+type stackDrift struct {
+	LogicalID  string
+	PhysicalID string
+	Property   string
+	Expected   string
+	Actual     string
+}
+
+func (d *stackDrift) String() string {
+	return fmt.Sprintf("%s (%s) %s: expected %s, got %s", d.LogicalID, d.PhysicalID, d.Property, d.Expected, d.Actual)
+}
+
+// stackTemplate is the part of a cloudformation template needed for
+// detecting drift.
+type stackTemplate struct {
+	Resources map[string]struct {
+		Type       string                 `json:"Type"`
+		Properties map[string]interface{} `json:"Properties"`
+	} `json:"Resources"`
+}
+
+// DetectDrift compares the Auto Scaling Groups of a stack with their
+// definition in the stack template and returns the properties which were
+// changed outside of cloudformation e.g. by hand editing an ASG.
+// Only properties with literal values or references to resources of the same
+// stack are compared. The desired capacity isn't compared as it's changed by
+// the autoscaler.
+func (a *awsAdapter) DetectDrift(stackName string) ([]*stackDrift, error) {
+	templateResp, err := a.cloudformationClient.GetTemplate(&cloudformation.GetTemplateInput{
+		StackName:     aws.String(stackName),
+		TemplateStage: aws.String(cloudformation.TemplateStageOriginal),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var template stackTemplate
+	err = json.Unmarshal([]byte(aws.StringValue(templateResp.TemplateBody)), &template)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse template of stack %s: %v", stackName, err)
+	}
+
+	resourcesResp, err := a.cloudformationClient.DescribeStackResources(&cloudformation.DescribeStackResourcesInput{
+		StackName: aws.String(stackName),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	physicalIDs := make(map[string]string, len(resourcesResp.StackResources))
+	for _, resource := range resourcesResp.StackResources {
+		physicalIDs[aws.StringValue(resource.LogicalResourceId)] = aws.StringValue(resource.PhysicalResourceId)
+	}
+
+	var drifts []*stackDrift
+	for _, resource := range resourcesResp.StackResources {
+		if aws.StringValue(resource.ResourceType) != resourceTypeAutoScalingGroup {
+			continue
+		}
+
+		logicalID := aws.StringValue(resource.LogicalResourceId)
+		definition, ok := template.Resources[logicalID]
+		if !ok {
+			continue
+		}
+
+		asg, err := a.describeASG(aws.StringValue(resource.PhysicalResourceId))
+		if err != nil {
+			return nil, err
+		}
+
+		actual := map[string]string{
+			propertyMinSize:                 strconv.FormatInt(aws.Int64Value(asg.MinSize), 10),
+			propertyMaxSize:                 strconv.FormatInt(aws.Int64Value(asg.MaxSize), 10),
+			propertyLaunchConfigurationName: aws.StringValue(asg.LaunchConfigurationName),
+		}
+
+		for _, property := range []string{propertyMinSize, propertyMaxSize, propertyLaunchConfigurationName} {
+			expected, ok := templateValue(definition.Properties[property], physicalIDs)
+			if !ok {
+				continue
+			}
+
+			if expected != actual[property] {
+				drifts = append(drifts, &stackDrift{
+					LogicalID:  logicalID,
+					PhysicalID: aws.StringValue(resource.PhysicalResourceId),
+					Property:   property,
+					Expected:   expected,
+					Actual:     actual[property],
+				})
+			}
+		}
+	}
+
+	return drifts, nil
+}
+
+// RemediateDrift changes the drifted ASG properties back to the values
+// defined in the stack template. The desired capacity is left to the ASG,
+// which keeps it within the restored min and max size.
+func (a *awsAdapter) RemediateDrift(drifts []*stackDrift) error {
+	byASG := make(map[string][]*stackDrift)
+	for _, drift := range drifts {
+		byASG[drift.PhysicalID] = append(byASG[drift.PhysicalID], drift)
+	}
+
+	for asgName, asgDrifts := range byASG {
+		asg, err := a.describeASG(asgName)
+		if err != nil {
+			return err
+		}
+
+		params := &autoscaling.UpdateAutoScalingGroupInput{
+			AutoScalingGroupName: asg.AutoScalingGroupName,
+			MinSize:              asg.MinSize,
+			MaxSize:              asg.MaxSize,
+		}
+
+		for _, drift := range asgDrifts {
+			switch drift.Property {
+			case propertyMinSize, propertyMaxSize:
+				value, err := strconv.ParseInt(drift.Expected, 10, 64)
+				if err != nil {
+					return err
+				}
+				if drift.Property == propertyMinSize {
+					params.MinSize = aws.Int64(value)
+				} else {
+					params.MaxSize = aws.Int64(value)
+				}
+			case propertyLaunchConfigurationName:
+				params.LaunchConfigurationName = aws.String(drift.Expected)
+			}
+		}
+
+		a.logger.Infof("Remediating drift of ASG %s", asgName)
+		_, err = a.autoscalingClient.UpdateAutoScalingGroup(params)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// templateValue returns the value of a template property as a string. Refs
+// to resources are resolved to their physical IDs. The second return value is
+// false if the value can't be determined e.g. because it's an intrinsic
+// function other than Ref.
+func templateValue(value interface{}, physicalIDs map[string]string) (string, bool) {
+	switch v := value.(type) {
+	case string:
+		return v, true
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64), true
+	case map[string]interface{}:
+		if ref, ok := v["Ref"].(string); ok && len(v) == 1 {
+			id, ok := physicalIDs[ref]
+			return id, ok
+		}
+	}
+	return "", false
+}
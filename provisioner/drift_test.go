@@ -0,0 +1,106 @@
+package provisioner
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const driftTemplate = `{
+  "Resources": {
+    "WorkerAutoScalingGroup": {
+      "Type": "AWS::AutoScaling::AutoScalingGroup",
+      "Properties": {
+        "MinSize": "3",
+        "MaxSize": 20,
+        "DesiredCapacity": 3,
+        "LaunchConfigurationName": {"Ref": "WorkerLaunchConfiguration"},
+        "VPCZoneIdentifier": {"Fn::Split": [",", "subnets"]}
+      }
+    },
+    "WorkerLaunchConfiguration": {
+      "Type": "AWS::AutoScaling::LaunchConfiguration"
+    }
+  }
+}`
+
+func newDriftAdapter(asg *autoscaling.Group) (*awsAdapter, *autoscalingAPIStub) {
+	a := newAWSAdapterWithStubs("", "")
+	a.cloudformationClient = &cloudFormationAPIStub{
+		statusMutex:  &sync.Mutex{},
+		templateBody: driftTemplate,
+		stackResources: []*cloudformation.StackResource{
+			{
+				LogicalResourceId:  aws.String("WorkerAutoScalingGroup"),
+				PhysicalResourceId: aws.String("worker-asg"),
+				ResourceType:       aws.String(resourceTypeAutoScalingGroup),
+			},
+			{
+				LogicalResourceId:  aws.String("WorkerLaunchConfiguration"),
+				PhysicalResourceId: aws.String("worker-lc"),
+				ResourceType:       aws.String("AWS::AutoScaling::LaunchConfiguration"),
+			},
+		},
+	}
+	asgClient := &autoscalingAPIStub{group: asg}
+	a.autoscalingClient = asgClient
+	return a, asgClient
+}
+
+func TestDetectDrift(t *testing.T) {
+	// test no drift, the desired capacity is changed by the autoscaler
+	a, _ := newDriftAdapter(&autoscaling.Group{
+		AutoScalingGroupName:    aws.String("worker-asg"),
+		MinSize:                 aws.Int64(3),
+		MaxSize:                 aws.Int64(20),
+		DesiredCapacity:         aws.Int64(12),
+		LaunchConfigurationName: aws.String("worker-lc"),
+	})
+	drifts, err := a.DetectDrift("stack")
+	require.NoError(t, err)
+	assert.Len(t, drifts, 0)
+
+	// test hand edited ASG
+	a, _ = newDriftAdapter(&autoscaling.Group{
+		AutoScalingGroupName:    aws.String("worker-asg"),
+		MinSize:                 aws.Int64(3),
+		MaxSize:                 aws.Int64(23),
+		LaunchConfigurationName: aws.String("hand-made-lc"),
+	})
+	drifts, err = a.DetectDrift("stack")
+	require.NoError(t, err)
+	require.Len(t, drifts, 2)
+	assert.Equal(t, &stackDrift{
+		LogicalID:  "WorkerAutoScalingGroup",
+		PhysicalID: "worker-asg",
+		Property:   propertyMaxSize,
+		Expected:   "20",
+		Actual:     "23",
+	}, drifts[0])
+	assert.Equal(t, "worker-lc", drifts[1].Expected)
+}
+
+func TestRemediateDrift(t *testing.T) {
+	a, asgClient := newDriftAdapter(&autoscaling.Group{
+		AutoScalingGroupName:    aws.String("worker-asg"),
+		MinSize:                 aws.Int64(3),
+		MaxSize:                 aws.Int64(23),
+		DesiredCapacity:         aws.Int64(22),
+		LaunchConfigurationName: aws.String("worker-lc"),
+	})
+
+	drifts, err := a.DetectDrift("stack")
+	require.NoError(t, err)
+
+	err = a.RemediateDrift(drifts)
+	require.NoError(t, err)
+	assert.Equal(t, int64(3), aws.Int64Value(asgClient.updateInput.MinSize))
+	assert.Equal(t, int64(20), aws.Int64Value(asgClient.updateInput.MaxSize))
+	assert.Nil(t, asgClient.updateInput.DesiredCapacity)
+	assert.Nil(t, asgClient.updateInput.LaunchConfigurationName)
+}
@@ -0,0 +1,152 @@
+package provisioner
+
+import (
+	"fmt"
+	"strings"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/pkg/errors"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+// ErrorCategory classifies the cause of a provisioning error.
+type ErrorCategory string
+
+const (
+	// ErrorCategoryTemplate is the category of errors caused by invalid
+	// templates.
+	ErrorCategoryTemplate ErrorCategory = "template"
+	// ErrorCategoryCloudFormation is the category of errors caused by failed
+	// CloudFormation stack operations.
+	ErrorCategoryCloudFormation ErrorCategory = "cfn"
+	// ErrorCategoryQuota is the category of errors caused by exceeded
+	// account limits.
+	ErrorCategoryQuota ErrorCategory = "quota"
+	// ErrorCategoryBootstrap is the category of errors caused by new nodes
+	// repeatedly failing to become ready.
+	ErrorCategoryBootstrap ErrorCategory = "bootstrap"
+	// ErrorCategoryThrottling is the category of errors caused by API rate
+	// limiting.
+	ErrorCategoryThrottling ErrorCategory = "throttling"
+	// ErrorCategoryService is the category of errors caused by internal
+	// errors or the unavailability of the cloud provider APIs.
+	ErrorCategoryService ErrorCategory = "service"
+	// ErrorCategoryPolicy is the category of errors caused by updates
+	// blocked by a policy of the cluster.
+	ErrorCategoryPolicy ErrorCategory = "policy"
+	// ErrorCategoryRollout is the category of node pool updates continuing
+	// in a later iteration, because they were time-sliced or paused.
+	ErrorCategoryRollout ErrorCategory = "rollout"
+	// ErrorCategoryUnknown is the category of all other errors.
+	ErrorCategoryUnknown ErrorCategory = "unknown"
+)
+
+// NodePoolError is an error which occurred while provisioning a single node
+// pool.
+type NodePoolError struct {
+	NodePool  string
+	Category  ErrorCategory
+	Retryable bool
+	Err       error
+}
+
+// newNodePoolError classifies err and returns it as a NodePoolError for the
+// node pool.
+func newNodePoolError(nodePool string, err error) *NodePoolError {
+	category, retryable := classifyError(err)
+	return &NodePoolError{
+		NodePool:  nodePool,
+		Category:  category,
+		Retryable: retryable,
+		Err:       err,
+	}
+}
+
+func (e *NodePoolError) Error() string {
+	return fmt.Sprintf("node pool %s: %s error: %v", e.NodePool, e.Category, e.Err)
+}
+
+// NodePoolErrors is a list of errors of failed node pools.
+type NodePoolErrors []*NodePoolError
+
+func (e NodePoolErrors) Error() string {
+	msgs := make([]string, 0, len(e))
+	for _, err := range e {
+		msgs = append(msgs, err.Error())
+	}
+	return strings.Join(msgs, ", ")
+}
+
+// Retryable returns true if all the node pool errors are retryable.
+func (e NodePoolErrors) Retryable() bool {
+	for _, err := range e {
+		if !err.Retryable {
+			return false
+		}
+	}
+	return true
+}
+
+// serviceErrorCodes are the error codes returned by the AWS APIs for
+// internal errors, which are retryable like server errors in general.
+var serviceErrorCodes = map[string]bool{
+	"InternalError":               true,
+	"InternalFailure":             true,
+	"InternalServiceError":        true,
+	"ServiceUnavailable":          true,
+	"ServiceUnavailableException": true,
+	"Unavailable":                 true,
+}
+
+// classifyError returns the category of an error and whether retrying the
+// operation could succeed. Only the errors known to be temporary are
+// retryable: timeouts of stack operations, rollouts continuing in a later
+// iteration, throttling, including RequestLimitExceeded, and server errors
+// of the AWS APIs. All other errors, including unknown ones, are terminal.
+func classifyError(err error) (ErrorCategory, bool) {
+	err = errors.Cause(err)
+
+	switch err {
+	case errCreateFailed, errRollbackComplete, errUpdateRollbackComplete, errRollbackFailed, errUpdateRollbackFailed, errDeleteFailed:
+		return ErrorCategoryCloudFormation, false
+	case errTimeoutExceeded:
+		return ErrorCategoryCloudFormation, true
+	case updatestrategy.ErrNodePoolFrozen, updatestrategy.ErrCanaryFailed, updatestrategy.ErrUnhealthyNodes:
+		return ErrorCategoryBootstrap, false
+	case updatestrategy.ErrRolloutIncomplete, updatestrategy.ErrUpdatePaused:
+		return ErrorCategoryRollout, true
+	}
+
+	switch err.(type) {
+	case template.ExecError, *template.ExecError:
+		return ErrorCategoryTemplate, false
+	case *blastRadiusExceededError, *costBudgetExceededError, *hookVetoError, *lastNodePoolError, *decommissionProtectedError, *orphanedPodsError:
+		return ErrorCategoryPolicy, false
+	case *orphanedNodePoolsError, *PreflightError:
+		return ErrorCategoryPolicy, true
+	}
+
+	if isThrottlingError(err) {
+		return ErrorCategoryThrottling, true
+	}
+
+	if aerr, ok := err.(awserr.Error); ok {
+		switch aerr.Code() {
+		case "LimitExceeded", "LimitExceededException", "InstanceLimitExceeded", "VcpuLimitExceeded":
+			return ErrorCategoryQuota, false
+		case cloudformationValidationErr:
+			return ErrorCategoryCloudFormation, false
+		}
+
+		if serviceErrorCodes[aerr.Code()] {
+			return ErrorCategoryService, true
+		}
+	}
+
+	if rerr, ok := err.(awserr.RequestFailure); ok && rerr.StatusCode() >= 500 {
+		return ErrorCategoryService, true
+	}
+
+	return ErrorCategoryUnknown, false
+}
@@ -0,0 +1,164 @@
+package provisioner
+
+import (
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/stretchr/testify/assert"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+func TestClassifyError(t *testing.T) {
+	for _, tc := range []struct {
+		msg       string
+		err       error
+		category  ErrorCategory
+		retryable bool
+	}{
+		{
+			msg:       "test stack rollback",
+			err:       errRollbackComplete,
+			category:  ErrorCategoryCloudFormation,
+			retryable: false,
+		},
+		{
+			msg:       "test stack rollback with failed events",
+			err:       &stackFailedError{err: errUpdateRollbackComplete},
+			category:  ErrorCategoryCloudFormation,
+			retryable: false,
+		},
+		{
+			msg:       "test throttling",
+			err:       awserr.New("Throttling", "Rate exceeded", nil),
+			category:  ErrorCategoryThrottling,
+			retryable: true,
+		},
+		{
+			msg:       "test request limit exceeded",
+			err:       awserr.New("RequestLimitExceeded", "Request limit exceeded", nil),
+			category:  ErrorCategoryThrottling,
+			retryable: true,
+		},
+		{
+			msg:       "test internal error",
+			err:       awserr.New("InternalError", "An internal error occurred", nil),
+			category:  ErrorCategoryService,
+			retryable: true,
+		},
+		{
+			msg:       "test server error",
+			err:       awserr.NewRequestFailure(awserr.New("Unknown", "Bad gateway", nil), 502, "request-id"),
+			category:  ErrorCategoryService,
+			retryable: true,
+		},
+		{
+			msg:       "test client error",
+			err:       awserr.NewRequestFailure(awserr.New("AccessDenied", "Access denied", nil), 403, "request-id"),
+			category:  ErrorCategoryUnknown,
+			retryable: false,
+		},
+		{
+			msg:       "test quota",
+			err:       awserr.New("LimitExceeded", "Limit exceeded", nil),
+			category:  ErrorCategoryQuota,
+			retryable: false,
+		},
+		{
+			msg:       "test frozen node pool",
+			err:       updatestrategy.ErrNodePoolFrozen,
+			category:  ErrorCategoryBootstrap,
+			retryable: false,
+		},
+		{
+			msg:       "test failed canary",
+			err:       updatestrategy.ErrCanaryFailed,
+			category:  ErrorCategoryBootstrap,
+			retryable: false,
+		},
+		{
+			msg:       "test unhealthy new nodes",
+			err:       updatestrategy.ErrUnhealthyNodes,
+			category:  ErrorCategoryBootstrap,
+			retryable: false,
+		},
+		{
+			msg:       "test incomplete rollout",
+			err:       updatestrategy.ErrRolloutIncomplete,
+			category:  ErrorCategoryRollout,
+			retryable: true,
+		},
+		{
+			msg:       "test paused update",
+			err:       updatestrategy.ErrUpdatePaused,
+			category:  ErrorCategoryRollout,
+			retryable: true,
+		},
+		{
+			msg:       "test blast radius exceeded",
+			err:       &blastRadiusExceededError{nodePool: "default-worker"},
+			category:  ErrorCategoryPolicy,
+			retryable: false,
+		},
+		{
+			msg:       "test cost budget exceeded",
+			err:       &costBudgetExceededError{cluster: "aws:123456789012:eu-central-1:kube-1", estimate: &costEstimate{}},
+			category:  ErrorCategoryPolicy,
+			retryable: false,
+		},
+		{
+			msg:       "test last node pool removed",
+			err:       &lastNodePoolError{cluster: "aws:123456789012:eu-central-1:kube-1"},
+			category:  ErrorCategoryPolicy,
+			retryable: false,
+		},
+		{
+			msg:       "test protected node pool decommissioned",
+			err:       &decommissionProtectedError{cluster: "aws:123456789012:eu-central-1:kube-1", nodePools: []string{"default-worker"}},
+			category:  ErrorCategoryPolicy,
+			retryable: false,
+		},
+		{
+			msg:       "test orphaned node pools running pods",
+			err:       &orphanedPodsError{cluster: "aws:123456789012:eu-central-1:kube-1", pods: map[string]int{"default-worker": 3}},
+			category:  ErrorCategoryPolicy,
+			retryable: false,
+		},
+		{
+			msg:       "test orphaned node pools",
+			err:       &orphanedNodePoolsError{cluster: "aws:123456789012:eu-central-1:kube-1", nodePools: []string{"default-worker"}},
+			category:  ErrorCategoryPolicy,
+			retryable: true,
+		},
+		{
+			msg:       "test failed preflight checks",
+			err:       &PreflightError{Failed: []*PreflightCheck{{Name: preflightCheckASGQuota, Err: errors.New("limit")}}},
+			category:  ErrorCategoryPolicy,
+			retryable: true,
+		},
+		{
+			msg:       "test unknown error",
+			err:       errors.New("failed"),
+			category:  ErrorCategoryUnknown,
+			retryable: false,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			category, retryable := classifyError(tc.err)
+			assert.Equal(t, tc.category, category)
+			assert.Equal(t, tc.retryable, retryable)
+		})
+	}
+}
+
+func TestNodePoolErrors(t *testing.T) {
+	errs := NodePoolErrors{
+		newNodePoolError("master-default", awserr.New("InternalError", "An internal error occurred", nil)),
+		newNodePoolError("worker-default", awserr.New("Throttling", "Rate exceeded", nil)),
+	}
+	assert.True(t, errs.Retryable())
+	assert.Equal(t, "node pool master-default: service error: InternalError: An internal error occurred, node pool worker-default: throttling error: Throttling: Rate exceeded", errs.Error())
+
+	errs = append(errs, newNodePoolError("worker-spot", errors.New("failed")))
+	assert.False(t, errs.Retryable())
+}
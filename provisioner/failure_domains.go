@@ -0,0 +1,97 @@
+package provisioner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// configKeyWorkloadLabel is the node label whose value identifies the
+	// workload served by a node pool, 'dedicated' by default.
+	configKeyWorkloadLabel = "workload_label"
+	defaultWorkloadLabel   = "dedicated"
+	// configKeyDecommissionTopologyOverride allows decommissioning node
+	// pools serving the same workload or all capacity of an availability
+	// zone at once.
+	configKeyDecommissionTopologyOverride = "decommission_topology_override"
+)
+
+// decommissionTopologyError is returned when several orphaned node pools
+// would be decommissioned at once although they serve the same workload or
+// hold all capacity of an availability zone.
+type decommissionTopologyError struct {
+	cluster  string
+	problems []string
+}
+
+func (e *decommissionTopologyError) Error() string {
+	return fmt.Sprintf("refusing to decommission node pools of cluster %s at once: %s (decommission them one at a time or set %s to \"true\")", e.cluster, strings.Join(e.problems, ", "), configKeyDecommissionTopologyOverride)
+}
+
+// checkDecommissionTopology returns a decommissionTopologyError if the
+// orphaned node pools decommissioned by the same stack update serve the same
+// workload, i.e. their nodes have the same value of the workload label, or
+// if their instances are the only instances of the stack in an availability
+// zone. The labels and availability zones are taken from the autoscaler tags
+// and the instances of the ASGs. A single orphaned node pool is always
+// decommissioned.
+func checkDecommissionTopology(cluster *api.Cluster, stackGroups, orphaned []*autoscaling.Group) error {
+	if len(orphaned) < 2 || cluster.ConfigItems[configKeyDecommissionTopologyOverride] == "true" {
+		return nil
+	}
+
+	workloadLabel := cluster.ConfigItems[configKeyWorkloadLabel]
+	if workloadLabel == "" {
+		workloadLabel = defaultWorkloadLabel
+	}
+
+	orphanedASGs := make(map[string]bool, len(orphaned))
+	workloads := make(map[string][]string)
+	for _, group := range orphaned {
+		orphanedASGs[aws.StringValue(group.AutoScalingGroupName)] = true
+
+		if workload := asgTagValue(group, autoscalerLabelTagPrefix+workloadLabel); workload != "" {
+			workloads[workload] = append(workloads[workload], asgTagValue(group, nodePoolTagKey))
+		}
+	}
+
+	var problems []string
+	for workload, nodePools := range workloads {
+		if len(nodePools) > 1 {
+			sort.Strings(nodePools)
+			problems = append(problems, fmt.Sprintf("%s serve the workload %s=%s", strings.Join(nodePools, " and "), workloadLabel, workload))
+		}
+	}
+
+	// the availability zones where only the orphaned node pools run
+	// instances lose all capacity of the stack.
+	remaining := make(map[string]int)
+	removed := make(map[string]int)
+	for _, group := range stackGroups {
+		for _, instance := range group.Instances {
+			zone := aws.StringValue(instance.AvailabilityZone)
+			if orphanedASGs[aws.StringValue(group.AutoScalingGroupName)] {
+				removed[zone]++
+			} else {
+				remaining[zone]++
+			}
+		}
+	}
+	for zone, instances := range removed {
+		if remaining[zone] == 0 {
+			problems = append(problems, fmt.Sprintf("all %d instances in %s are in the removed node pools", instances, zone))
+		}
+	}
+
+	if len(problems) > 0 {
+		sort.Strings(problems)
+		return &decommissionTopologyError{cluster: cluster.ID, problems: problems}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func topologyASG(nodePool, workload string, zones ...string) *autoscaling.Group {
+	group := &autoscaling.Group{
+		AutoScalingGroupName: aws.String("kube-1-" + nodePool),
+		Tags: []*autoscaling.TagDescription{
+			{Key: aws.String(nodePoolTagKey), Value: aws.String(nodePool)},
+		},
+	}
+	if workload != "" {
+		group.Tags = append(group.Tags, &autoscaling.TagDescription{Key: aws.String(autoscalerLabelTagPrefix + defaultWorkloadLabel), Value: aws.String(workload)})
+	}
+	for _, zone := range zones {
+		group.Instances = append(group.Instances, &autoscaling.Instance{AvailabilityZone: aws.String(zone)})
+	}
+	return group
+}
+
+func TestCheckDecommissionTopology(t *testing.T) {
+	worker := topologyASG("worker-default", "", "eu-central-1a", "eu-central-1b")
+	batchA := topologyASG("batch-a", "batch", "eu-central-1a")
+	batchB := topologyASG("batch-b", "batch", "eu-central-1b")
+	zoneC := topologyASG("zone-c", "", "eu-central-1c")
+	zoneC2 := topologyASG("zone-c-2", "", "eu-central-1c")
+	search := topologyASG("search", "search", "eu-central-1a")
+
+	for _, tc := range []struct {
+		msg         string
+		configItems map[string]string
+		stack       []*autoscaling.Group
+		orphaned    []*autoscaling.Group
+		valid       bool
+	}{
+		{
+			msg:      "single orphaned node pool",
+			stack:    []*autoscaling.Group{worker, zoneC},
+			orphaned: []*autoscaling.Group{zoneC},
+			valid:    true,
+		},
+		{
+			msg:      "different workloads with remaining capacity",
+			stack:    []*autoscaling.Group{worker, batchA, search},
+			orphaned: []*autoscaling.Group{batchA, search},
+			valid:    true,
+		},
+		{
+			msg:      "same workload",
+			stack:    []*autoscaling.Group{worker, batchA, batchB},
+			orphaned: []*autoscaling.Group{batchA, batchB},
+		},
+		{
+			msg:      "all capacity of an availability zone",
+			stack:    []*autoscaling.Group{worker, zoneC, zoneC2},
+			orphaned: []*autoscaling.Group{zoneC, zoneC2},
+		},
+		{
+			msg:         "override",
+			configItems: map[string]string{configKeyDecommissionTopologyOverride: "true"},
+			stack:       []*autoscaling.Group{worker, batchA, batchB},
+			orphaned:    []*autoscaling.Group{batchA, batchB},
+			valid:       true,
+		},
+		{
+			msg:         "custom workload label",
+			configItems: map[string]string{configKeyWorkloadLabel: "team"},
+			stack:       []*autoscaling.Group{worker, batchA, batchB},
+			orphaned:    []*autoscaling.Group{batchA, batchB},
+			valid:       true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			cluster := &api.Cluster{ID: "kube-1", ConfigItems: tc.configItems}
+			err := checkDecommissionTopology(cluster, tc.stack, tc.orphaned)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.IsType(t, &decommissionTopologyError{}, err)
+			}
+		})
+	}
+}
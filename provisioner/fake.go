@@ -0,0 +1,453 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"sync"
+
+	"github.com/aws/aws-sdk-go/aws"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+// FakeProvider selects the fake provisioner instead of the provisioners of
+// the cloud providers.
+const FakeProvider = "fake"
+
+// fakeLogicalIDRegexp matches the characters of node pool names which aren't
+// allowed in the logical IDs of stack resources.
+var fakeLogicalIDRegexp = regexp.MustCompile(`[^a-zA-Z0-9]`)
+
+// fakeProvisioner simulates the provisioning of clusters of any provider
+// without calling any cloud provider or Kubernetes API. The cluster stacks
+// are applied to an in-memory CloudFormation and the node pools are updated
+// by the rolling update strategy replacing in-memory nodes, such that the
+// validation, stack and node pool update code paths can be exercised in CI
+// or with a channel checked out locally. The state is kept for the lifetime
+// of the provisioner.
+type fakeProvisioner struct {
+	mutex          sync.Mutex
+	cloudFormation map[string]*fakeCloudFormation
+	nodePools      *fakeNodePools
+	updateStrategy config.UpdateStrategy
+	dryRun         bool
+	readOnly       bool
+	applyOnly      bool
+	// disasterRecovery only re-applies the stack, like the disaster
+	// recovery of the clusterpy provisioner.
+	disasterRecovery bool
+	clmVersion       string
+}
+
+// NewFakeProvisioner returns a new provisioner simulating the provisioning
+// of clusters in memory.
+func NewFakeProvisioner(options *Options) Provisioner {
+	provisioner := &fakeProvisioner{
+		cloudFormation: make(map[string]*fakeCloudFormation),
+		nodePools:      newFakeNodePools(),
+	}
+
+	if options != nil {
+		provisioner.updateStrategy = options.UpdateStrategy
+		provisioner.dryRun = options.DryRun || options.ReadOnly
+		provisioner.readOnly = options.ReadOnly
+		provisioner.applyOnly = options.ApplyOnly
+		provisioner.disasterRecovery = options.DisasterRecovery
+		provisioner.clmVersion = options.Version
+	}
+
+	return provisioner
+}
+
+// adapter returns an awsAdapter using the fake CloudFormation of the account
+// and region of the cluster. Any other AWS API isn't available.
+func (p *fakeProvisioner) adapter(logger *log.Entry, cluster *api.Cluster) *awsAdapter {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	key := cluster.InfrastructureAccount + "/" + cluster.Region
+	client, ok := p.cloudFormation[key]
+	if !ok {
+		client = newFakeCloudFormation(cluster.Region)
+		p.cloudFormation[key] = client
+	}
+
+	return &awsAdapter{
+		cloudformationClient: client,
+		region:               cluster.Region,
+		dryRun:               p.dryRun,
+		readOnly:             p.readOnly,
+		logger:               logger,
+	}
+}
+
+// Version returns the version derived from a sha1 hash of the cluster struct
+// and the channel config version.
+func (p *fakeProvisioner) Version(cluster *api.Cluster, channelConfig *channel.Config) (string, error) {
+	cluster, err := withValuesFiles(cluster, channelConfig)
+	if err != nil {
+		return "", err
+	}
+
+	return clusterVersion(cluster, channelConfig)
+}
+
+// Preflight checks the node pool profiles of the cluster in the channel, the
+// checks of the cloud provider accounts are skipped.
+func (p *fakeProvisioner) Preflight(cluster *api.Cluster, channelConfig *channel.Config) (*PreflightReport, error) {
+	cluster, err := withValuesFiles(cluster, channelConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &PreflightReport{}
+	report.add(preflightCheckProfiles, checkProfiles(path.Join(channelConfig.Path, "cluster"), cluster))
+	return report, nil
+}
+
+// Provision validates the cluster, applies its simulated stack and updates
+// its node pools.
+func (p *fakeProvisioner) Provision(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) (err error) {
+	cluster, err = withValuesFiles(cluster, channelConfig)
+	if err != nil {
+		return err
+	}
+
+	logger := log.WithFields(log.Fields{"cluster": cluster.Alias, "provider": FakeProvider})
+
+	summary := api.UpdateSummaryFromContext(ctx)
+	defer func() {
+		summary.Finish(err)
+	}()
+
+	err = validateStackName(cluster.LocalID)
+	if err != nil {
+		return err
+	}
+
+	err = validateConfigItems(cluster, channelConfig)
+	if err != nil {
+		return err
+	}
+
+	err = checkProfileCompatibility(path.Join(channelConfig.Path, "cluster"), cluster, p.clmVersion)
+	if err != nil {
+		return err
+	}
+
+	err = checkNodePools(logger, cluster)
+	if err != nil {
+		return err
+	}
+
+	err = checkSchedulableNodePools(cluster)
+	if err != nil {
+		return err
+	}
+
+	err = checkKubeletVersionSkew(cluster)
+	if err != nil {
+		return err
+	}
+
+	updateStrategy, err := updateStrategyConfig(cluster, p.updateStrategy)
+	if err != nil {
+		return err
+	}
+
+	policy, err := newBlastRadiusPolicy(cluster)
+	if err != nil {
+		return err
+	}
+
+	stackTemplate, configHashes, err := fakeStackTemplate(cluster, channelConfig)
+	if err != nil {
+		return err
+	}
+
+	adapter := p.adapter(logger, cluster)
+	err = p.applyStack(ctx, adapter, cluster.LocalID, stackTemplate)
+	if err != nil {
+		return err
+	}
+
+	if p.disasterRecovery {
+		logger.Warn("Disaster recovery, skipping node pool update")
+		skipNodePools(summary, cluster, "disaster recovery")
+		return nil
+	}
+
+	if p.applyOnly {
+		skipNodePools(summary, cluster, "apply only")
+		return nil
+	}
+
+	if p.dryRun {
+		skipNodePools(summary, cluster, "dry run")
+		return nil
+	}
+
+	stack, err := adapter.getStackByName(cluster.LocalID)
+	if err != nil {
+		return err
+	}
+	stackStatus := aws.StringValue(stack.StackStatus)
+
+	p.nodePools.sync(cluster, configHashes)
+
+	// the simulated nodes are ready and healthy right away, so canaries
+	// aren't soaked and the health of the nodes isn't waited for.
+	manager := &fakeNodePoolManager{pools: p.nodePools, clusterID: cluster.ID}
+	updater := updatestrategy.NewRollingUpdateStrategy(logger, manager, nil, nil, nil, 3, 0, updateStrategy.MaxNodesPerIteration, 0, updateStrategy.MaxUnavailable)
+
+	var nodePoolErrs, incomplete NodePoolErrors
+	sort.Sort(api.NodePools(cluster.NodePools))
+	for i, nodePool := range cluster.NodePools {
+		api.ReportProgress(ctx, api.ProgressStepNodePoolUpdate, nodePool.Name, fmt.Sprintf("Updating node pool %s", nodePool.Name))
+		summary.StartNodePool(nodePool.Name)
+
+		err := updateNodePool(ctx, logger, updater, policy, nodePool, false)
+		if err == updatestrategy.ErrRolloutIncomplete || err == updatestrategy.ErrUpdatePaused {
+			logger.Infof("Update of node pool %s continues later: %v", nodePool.Name, err)
+			nodePoolErr := newNodePoolError(nodePool.Name, err)
+			incomplete = append(incomplete, nodePoolErr)
+			summary.FinishNodePool(nodePool.Name, api.UpdateOutcomeIncomplete, err, string(nodePoolErr.Category))
+			continue
+		}
+		if err != nil {
+			logger.Errorf("Failed to update node pool %s: %v", nodePool.Name, err)
+			nodePoolErr := newNodePoolError(nodePool.Name, err)
+			nodePoolErrs = append(nodePoolErrs, nodePoolErr)
+			summary.FinishNodePool(nodePool.Name, api.UpdateOutcomeFailed, err, string(nodePoolErr.Category))
+			if abortNodePoolUpdates(summary, nodePool, cluster.NodePools[i+1:]) {
+				break
+			}
+			continue
+		}
+		summary.FinishNodePool(nodePool.Name, api.UpdateOutcomeSucceeded, nil, "")
+		setNodePoolStatus(cluster, nodePool, configHashes[nodePool.Name], stackStatus)
+	}
+
+	recordNodeGenerations(logger, cluster, manager.GetPool)
+
+	if len(nodePoolErrs) > 0 {
+		return nodePoolErrs
+	}
+	if len(incomplete) > 0 {
+		return incomplete
+	}
+	return nil
+}
+
+// applyStack applies the stack template like applyClusterStack, except that
+// templates aren't uploaded to S3 as the fake CloudFormation doesn't limit
+// their size, and the previous templates aren't saved for rollbacks.
+func (p *fakeProvisioner) applyStack(ctx context.Context, adapter *awsAdapter, stackName string, stackTemplate []byte) error {
+	err := checkStackTemplate(stackTemplate)
+	if err != nil {
+		return err
+	}
+
+	hash := templateHash(string(stackTemplate))
+	stack, err := adapter.getStackByName(stackName)
+	if err != nil && !isDoesNotExistsErr(err) {
+		return err
+	}
+	if stackUpToDate(stack, hash) {
+		adapter.logger.Infof("Stack %s is up to date with template hash %s, skipping update", stackName, hash)
+		return nil
+	}
+
+	if adapter.readOnly {
+		return adapter.reportStackUpdate(stackName, stackTemplate, hash)
+	}
+
+	err = adapter.validateStackTemplate(stackName, string(stackTemplate), "")
+	if err != nil {
+		return err
+	}
+
+	updated, err := adapter.applyStack(ctx, stackName, string(stackTemplate), "", hash, true)
+	if err != nil || !updated {
+		return err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, maxWaitTimeout)
+	defer cancel()
+	_, err = adapter.waitForStack(waitCtx, waitTime, stackName)
+	return err
+}
+
+// Decommission deletes the simulated stack and node pools of the cluster.
+func (p *fakeProvisioner) Decommission(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	logger := log.WithFields(log.Fields{"cluster": cluster.Alias, "provider": FakeProvider})
+
+	err := p.adapter(logger, cluster).DeleteStack(ctx, cluster.LocalID)
+	if err != nil {
+		return err
+	}
+
+	if !p.dryRun {
+		p.nodePools.remove(cluster.ID)
+	}
+	return nil
+}
+
+// Suspend scales the simulated node pools of the cluster to zero.
+func (p *fakeProvisioner) Suspend(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	if !p.dryRun {
+		p.nodePools.suspend(cluster.ID)
+	}
+	return nil
+}
+
+// Resume restores the sizes of the simulated node pools of a suspended
+// cluster.
+func (p *fakeProvisioner) Resume(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	if !p.dryRun {
+		p.nodePools.resume(cluster.ID)
+	}
+	return nil
+}
+
+// Reconcile does nothing, the simulated nodes don't have a startup taint.
+func (p *fakeProvisioner) Reconcile(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	return nil
+}
+
+// fakeStackTemplate returns the template of a stack simulating the cluster
+// stack with an ASG per node pool, along with the config hashes of the node
+// pools. The scaling schedules, warm pools, lifecycle hooks and tags of the
+// node pools are added to the ASGs like to the ones of the real stacks.
+func fakeStackTemplate(cluster *api.Cluster, channelConfig *channel.Config) ([]byte, map[string]string, error) {
+	configHashes := make(map[string]string, len(cluster.NodePools))
+	resources := make(map[string]interface{}, len(cluster.NodePools))
+	for _, nodePool := range cluster.NodePools {
+		err := validateScalingSchedules(nodePool)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = validateWarmPool(nodePool)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = validateLifecycleHooks(nodePool)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = validateImage(nodePool)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = validateStorage(nodePool)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = validateKubeletConfig(nodePool)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = validateMonitoring(nodePool)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		err = validateOS(nodePool)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		configHash, err := fakeConfigHash(cluster, nodePool, channelConfig.Version)
+		if err != nil {
+			return nil, nil, err
+		}
+		configHashes[nodePool.Name] = configHash
+
+		resources["AutoScalingGroup"+fakeLogicalIDRegexp.ReplaceAllString(nodePool.Name, "")] = map[string]interface{}{
+			"Type": resourceTypeAutoScalingGroup,
+			"Metadata": map[string]interface{}{
+				"ConfigHash": configHash,
+			},
+			"Properties": map[string]interface{}{
+				"MinSize":           strconv.FormatInt(nodePool.MinSize, 10),
+				"MaxSize":           strconv.FormatInt(nodePool.MaxSize, 10),
+				"AvailabilityZones": fakeZones(cluster, nodePool),
+				"Tags": []interface{}{
+					map[string]interface{}{"Key": "Name", "Value": fmt.Sprintf("%s (%s)", nodePool.Name, cluster.ID), "PropagateAtLaunch": true},
+					map[string]interface{}{"Key": nodePoolTagKey, "Value": nodePool.Name, "PropagateAtLaunch": true},
+					map[string]interface{}{"Key": "Profile", "Value": nodePool.Profile, "PropagateAtLaunch": true},
+				},
+			},
+		}
+	}
+
+	stackTemplate, err := json.Marshal(map[string]interface{}{
+		"AWSTemplateFormatVersion": "2010-09-09",
+		"Description":              fmt.Sprintf("Simulated stack of cluster %s", cluster.ID),
+		"Resources":                resources,
+	})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	for _, nodePool := range cluster.NodePools {
+		stackTemplate, err = addScheduledActions(stackTemplate, nodePool)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		stackTemplate, err = addWarmPool(stackTemplate, nodePool)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	stackTemplate, err = addLifecycleHooks(stackTemplate, cluster.NodePools...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	stackTemplate, err = addNodePoolTags(stackTemplate, cluster.LocalID, false, cluster.NodePools...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	return stackTemplate, configHashes, nil
+}
+
+// fakeConfigHash returns the hash of the configuration of the nodes of a
+// node pool. Like the userdata of real node pools it changes with the node
+// pool, the config items of the cluster and the channel version, but not
+// with the size of the node pool.
+func fakeConfigHash(cluster *api.Cluster, nodePool *api.NodePool, channelVersion string) (string, error) {
+	pool := *nodePool
+	pool.MinSize = 0
+	pool.MaxSize = 0
+	pool.ScalingSchedules = nil
+	pool.LifecycleHooks = nil
+
+	data, err := json.Marshal(struct {
+		NodePool       *api.NodePool
+		ConfigItems    map[string]string
+		ChannelVersion string
+	}{&pool, cluster.ConfigItems, channelVersion})
+	if err != nil {
+		return "", err
+	}
+	return templateHash(string(data)), nil
+}
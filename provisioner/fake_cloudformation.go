@@ -0,0 +1,433 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// fakeAccountID is the account of the ARNs of the fake stacks.
+const fakeAccountID = "000000000000"
+
+// fakeTemplate is the part of a stack template simulated by the fake
+// CloudFormation.
+type fakeTemplate struct {
+	Parameters map[string]map[string]interface{} `json:"Parameters"`
+	Resources  map[string]map[string]interface{} `json:"Resources"`
+	Outputs    map[string]map[string]interface{} `json:"Outputs"`
+}
+
+// parseFakeTemplate parses a JSON stack template.
+func parseFakeTemplate(body string) (*fakeTemplate, error) {
+	var template fakeTemplate
+	err := json.Unmarshal([]byte(body), &template)
+	if err != nil {
+		return nil, awserr.New("ValidationError", fmt.Sprintf("Template format error: %v", err), nil)
+	}
+	return &template, nil
+}
+
+// fakeStack is a stack of the fake CloudFormation.
+type fakeStack struct {
+	stack    *cloudformation.Stack
+	template *fakeTemplate
+	body     string
+}
+
+// fakeChangeSet is a change set of the fake CloudFormation.
+type fakeChangeSet struct {
+	id        string
+	stackName string
+	template  *fakeTemplate
+	body      string
+	tags      []*cloudformation.Tag
+	changes   []*cloudformation.Change
+}
+
+// fakeCloudFormation is an in-memory implementation of the CloudFormation
+// API. Stack operations complete immediately, the resources of the stacks
+// are only recorded from their templates but never created.
+type fakeCloudFormation struct {
+	mutex      sync.Mutex
+	region     string
+	stacks     map[string]*fakeStack
+	changeSets map[string]*fakeChangeSet
+	nextID     int
+}
+
+// newFakeCloudFormation initializes a new fake CloudFormation without any
+// stacks.
+func newFakeCloudFormation(region string) *fakeCloudFormation {
+	return &fakeCloudFormation{
+		region:     region,
+		stacks:     make(map[string]*fakeStack),
+		changeSets: make(map[string]*fakeChangeSet),
+	}
+}
+
+// stackNotFound returns the error of CloudFormation for a missing stack.
+func stackNotFound(stackName string) error {
+	return awserr.New("ValidationError", fmt.Sprintf("Stack with id %s does not exist", stackName), nil)
+}
+
+// describe returns a copy of the stack, such that the stack can be changed
+// while the copy is in use.
+func (s *fakeStack) describe() *cloudformation.Stack {
+	stack := *s.stack
+	return &stack
+}
+
+func (c *fakeCloudFormation) arn(resource, name string) string {
+	c.nextID++
+	return fmt.Sprintf("arn:aws:cloudformation:%s:%s:%s/%s/%d", c.region, fakeAccountID, resource, name, c.nextID)
+}
+
+func (c *fakeCloudFormation) DescribeStacks(input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	if input.StackName == nil {
+		return &cloudformation.DescribeStacksOutput{Stacks: c.describeAll()}, nil
+	}
+
+	stackName := aws.StringValue(input.StackName)
+	stack, ok := c.stacks[stackName]
+	if !ok {
+		return nil, stackNotFound(stackName)
+	}
+	return &cloudformation.DescribeStacksOutput{Stacks: []*cloudformation.Stack{stack.describe()}}, nil
+}
+
+func (c *fakeCloudFormation) DescribeStacksPages(input *cloudformation.DescribeStacksInput, fn func(resp *cloudformation.DescribeStacksOutput, lastPage bool) bool) error {
+	resp, err := c.DescribeStacks(input)
+	if err != nil {
+		return err
+	}
+	fn(resp, true)
+	return nil
+}
+
+// describeAll returns all stacks sorted by name.
+func (c *fakeCloudFormation) describeAll() []*cloudformation.Stack {
+	names := make([]string, 0, len(c.stacks))
+	for name := range c.stacks {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	stacks := make([]*cloudformation.Stack, 0, len(names))
+	for _, name := range names {
+		stacks = append(stacks, c.stacks[name].describe())
+	}
+	return stacks
+}
+
+func (c *fakeCloudFormation) CreateStackWithContext(ctx aws.Context, input *cloudformation.CreateStackInput, opts ...request.Option) (*cloudformation.CreateStackOutput, error) {
+	if input.TemplateURL != nil {
+		return nil, fmt.Errorf("template URLs are not supported by the %s provider", FakeProvider)
+	}
+
+	template, err := parseFakeTemplate(aws.StringValue(input.TemplateBody))
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stackName := aws.StringValue(input.StackName)
+	if _, ok := c.stacks[stackName]; ok {
+		return nil, awserr.New(cloudformation.ErrCodeAlreadyExistsException, fmt.Sprintf("Stack [%s] already exists", stackName), nil)
+	}
+
+	stack := &cloudformation.Stack{
+		StackId:                     aws.String(c.arn("stack", stackName)),
+		StackName:                   input.StackName,
+		StackStatus:                 aws.String(cloudformation.StackStatusCreateComplete),
+		CreationTime:                aws.Time(time.Now().UTC()),
+		EnableTerminationProtection: aws.Bool(aws.BoolValue(input.EnableTerminationProtection)),
+		Tags:                        input.Tags,
+		Outputs:                     template.outputs(),
+	}
+	c.stacks[stackName] = &fakeStack{
+		stack:    stack,
+		template: template,
+		body:     aws.StringValue(input.TemplateBody),
+	}
+
+	return &cloudformation.CreateStackOutput{StackId: stack.StackId}, nil
+}
+
+func (c *fakeCloudFormation) CreateChangeSetWithContext(ctx aws.Context, input *cloudformation.CreateChangeSetInput, opts ...request.Option) (*cloudformation.CreateChangeSetOutput, error) {
+	if input.TemplateURL != nil {
+		return nil, fmt.Errorf("template URLs are not supported by the %s provider", FakeProvider)
+	}
+
+	template, err := parseFakeTemplate(aws.StringValue(input.TemplateBody))
+	if err != nil {
+		return nil, err
+	}
+
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stackName := aws.StringValue(input.StackName)
+	stack, ok := c.stacks[stackName]
+	if !ok {
+		return nil, stackNotFound(stackName)
+	}
+
+	changeSet := &fakeChangeSet{
+		id:        c.arn("changeSet", aws.StringValue(input.ChangeSetName)),
+		stackName: stackName,
+		template:  template,
+		body:      aws.StringValue(input.TemplateBody),
+		tags:      input.Tags,
+		changes:   resourceChanges(stack.template, template),
+	}
+	c.changeSets[changeSet.id] = changeSet
+
+	return &cloudformation.CreateChangeSetOutput{Id: aws.String(changeSet.id), StackId: stack.stack.StackId}, nil
+}
+
+func (c *fakeCloudFormation) DescribeChangeSetWithContext(ctx aws.Context, input *cloudformation.DescribeChangeSetInput, opts ...request.Option) (*cloudformation.DescribeChangeSetOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	changeSet, ok := c.changeSets[aws.StringValue(input.ChangeSetName)]
+	if !ok {
+		return nil, awserr.New(cloudformation.ErrCodeChangeSetNotFoundException, fmt.Sprintf("ChangeSet [%s] does not exist", aws.StringValue(input.ChangeSetName)), nil)
+	}
+
+	resp := &cloudformation.DescribeChangeSetOutput{
+		ChangeSetId: aws.String(changeSet.id),
+		StackName:   aws.String(changeSet.stackName),
+		Status:      aws.String(cloudformation.ChangeSetStatusCreateComplete),
+		Changes:     changeSet.changes,
+	}
+
+	stack := c.stacks[changeSet.stackName]
+	if len(changeSet.changes) == 0 && stack != nil && reflect.DeepEqual(stack.stack.Tags, changeSet.tags) {
+		resp.Status = aws.String(cloudformation.ChangeSetStatusFailed)
+		resp.StatusReason = aws.String("The submitted information " + cloudformationNoChangesMsg + ". Submit different information to create a change set.")
+	}
+	return resp, nil
+}
+
+func (c *fakeCloudFormation) ExecuteChangeSetWithContext(ctx aws.Context, input *cloudformation.ExecuteChangeSetInput, opts ...request.Option) (*cloudformation.ExecuteChangeSetOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	changeSet, ok := c.changeSets[aws.StringValue(input.ChangeSetName)]
+	if !ok {
+		return nil, awserr.New(cloudformation.ErrCodeChangeSetNotFoundException, fmt.Sprintf("ChangeSet [%s] does not exist", aws.StringValue(input.ChangeSetName)), nil)
+	}
+	delete(c.changeSets, changeSet.id)
+
+	stack, ok := c.stacks[changeSet.stackName]
+	if !ok {
+		return nil, stackNotFound(changeSet.stackName)
+	}
+
+	updated := stack.describe()
+	updated.StackStatus = aws.String(cloudformation.StackStatusUpdateComplete)
+	updated.LastUpdatedTime = aws.Time(time.Now().UTC())
+	updated.Tags = changeSet.tags
+	updated.Outputs = changeSet.template.outputs()
+	c.stacks[changeSet.stackName] = &fakeStack{
+		stack:    updated,
+		template: changeSet.template,
+		body:     changeSet.body,
+	}
+
+	return &cloudformation.ExecuteChangeSetOutput{}, nil
+}
+
+func (c *fakeCloudFormation) DeleteChangeSet(input *cloudformation.DeleteChangeSetInput) (*cloudformation.DeleteChangeSetOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	delete(c.changeSets, aws.StringValue(input.ChangeSetName))
+	return &cloudformation.DeleteChangeSetOutput{}, nil
+}
+
+func (c *fakeCloudFormation) DeleteStack(input *cloudformation.DeleteStackInput) (*cloudformation.DeleteStackOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stackName := aws.StringValue(input.StackName)
+	stack, ok := c.stacks[stackName]
+	if !ok {
+		// like CloudFormation, deleting a missing stack succeeds.
+		return &cloudformation.DeleteStackOutput{}, nil
+	}
+
+	if aws.BoolValue(stack.stack.EnableTerminationProtection) {
+		return nil, awserr.New("ValidationError", fmt.Sprintf("Stack [%s] cannot be deleted while TerminationProtection is enabled", stackName), nil)
+	}
+
+	delete(c.stacks, stackName)
+	return &cloudformation.DeleteStackOutput{}, nil
+}
+
+func (c *fakeCloudFormation) UpdateTerminationProtection(input *cloudformation.UpdateTerminationProtectionInput) (*cloudformation.UpdateTerminationProtectionOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stackName := aws.StringValue(input.StackName)
+	stack, ok := c.stacks[stackName]
+	if !ok {
+		return nil, stackNotFound(stackName)
+	}
+
+	updated := stack.describe()
+	updated.EnableTerminationProtection = aws.Bool(aws.BoolValue(input.EnableTerminationProtection))
+	stack.stack = updated
+
+	return &cloudformation.UpdateTerminationProtectionOutput{StackId: updated.StackId}, nil
+}
+
+func (c *fakeCloudFormation) GetTemplate(input *cloudformation.GetTemplateInput) (*cloudformation.GetTemplateOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stackName := aws.StringValue(input.StackName)
+	stack, ok := c.stacks[stackName]
+	if !ok {
+		return nil, stackNotFound(stackName)
+	}
+	return &cloudformation.GetTemplateOutput{TemplateBody: aws.String(stack.body)}, nil
+}
+
+func (c *fakeCloudFormation) DescribeStackResources(input *cloudformation.DescribeStackResourcesInput) (*cloudformation.DescribeStackResourcesOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stackName := aws.StringValue(input.StackName)
+	stack, ok := c.stacks[stackName]
+	if !ok {
+		return nil, stackNotFound(stackName)
+	}
+
+	status := cloudformation.ResourceStatusCreateComplete
+	if aws.StringValue(stack.stack.StackStatus) == cloudformation.StackStatusUpdateComplete {
+		status = cloudformation.ResourceStatusUpdateComplete
+	}
+
+	var resources []*cloudformation.StackResource
+	for _, logicalID := range sortedResourceIDs(stack.template.Resources) {
+		resourceType, _ := stack.template.Resources[logicalID]["Type"].(string)
+		resources = append(resources, &cloudformation.StackResource{
+			StackName:          aws.String(stackName),
+			StackId:            stack.stack.StackId,
+			LogicalResourceId:  aws.String(logicalID),
+			PhysicalResourceId: aws.String(fmt.Sprintf("%s-%s", stackName, logicalID)),
+			ResourceType:       aws.String(resourceType),
+			ResourceStatus:     aws.String(status),
+		})
+	}
+	return &cloudformation.DescribeStackResourcesOutput{StackResources: resources}, nil
+}
+
+// DescribeStackEvents returns no events, the stack operations of the fake
+// CloudFormation never fail.
+func (c *fakeCloudFormation) DescribeStackEvents(input *cloudformation.DescribeStackEventsInput) (*cloudformation.DescribeStackEventsOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+
+	stackName := aws.StringValue(input.StackName)
+	if _, ok := c.stacks[stackName]; !ok {
+		return nil, stackNotFound(stackName)
+	}
+	return &cloudformation.DescribeStackEventsOutput{}, nil
+}
+
+func (c *fakeCloudFormation) ValidateTemplate(input *cloudformation.ValidateTemplateInput) (*cloudformation.ValidateTemplateOutput, error) {
+	if input.TemplateURL != nil {
+		return nil, fmt.Errorf("template URLs are not supported by the %s provider", FakeProvider)
+	}
+
+	template, err := parseFakeTemplate(aws.StringValue(input.TemplateBody))
+	if err != nil {
+		return nil, err
+	}
+
+	if len(template.Resources) == 0 {
+		return nil, awserr.New("ValidationError", "Template format error: At least one Resources member must be defined.", nil)
+	}
+
+	var parameters []*cloudformation.TemplateParameter
+	for _, key := range sortedResourceIDs(template.Parameters) {
+		parameter := &cloudformation.TemplateParameter{ParameterKey: aws.String(key)}
+		if value, ok := template.Parameters[key]["Default"]; ok {
+			parameter.DefaultValue = aws.String(fmt.Sprint(value))
+		}
+		parameters = append(parameters, parameter)
+	}
+	return &cloudformation.ValidateTemplateOutput{Parameters: parameters}, nil
+}
+
+// outputs returns the outputs of the template with literal values. Outputs
+// referring to resources can't be resolved as no resources are created.
+func (t *fakeTemplate) outputs() []*cloudformation.Output {
+	var outputs []*cloudformation.Output
+	for _, key := range sortedResourceIDs(t.Outputs) {
+		value, ok := t.Outputs[key]["Value"].(string)
+		if !ok {
+			continue
+		}
+		outputs = append(outputs, &cloudformation.Output{OutputKey: aws.String(key), OutputValue: aws.String(value)})
+	}
+	return outputs
+}
+
+// resourceChanges returns the changes of the resources of a stack from the
+// current to the new template.
+func resourceChanges(current, updated *fakeTemplate) []*cloudformation.Change {
+	var changes []*cloudformation.Change
+	add := func(action, logicalID string, resource map[string]interface{}) {
+		resourceType, _ := resource["Type"].(string)
+		changes = append(changes, &cloudformation.Change{
+			Type: aws.String(cloudformation.ChangeTypeResource),
+			ResourceChange: &cloudformation.ResourceChange{
+				Action:            aws.String(action),
+				LogicalResourceId: aws.String(logicalID),
+				ResourceType:      aws.String(resourceType),
+			},
+		})
+	}
+
+	for _, logicalID := range sortedResourceIDs(updated.Resources) {
+		resource, ok := current.Resources[logicalID]
+		if !ok {
+			add(cloudformation.ChangeActionAdd, logicalID, updated.Resources[logicalID])
+		} else if !reflect.DeepEqual(resource, updated.Resources[logicalID]) {
+			add(cloudformation.ChangeActionModify, logicalID, updated.Resources[logicalID])
+		}
+	}
+
+	for _, logicalID := range sortedResourceIDs(current.Resources) {
+		if _, ok := updated.Resources[logicalID]; !ok {
+			add(cloudformation.ChangeActionRemove, logicalID, current.Resources[logicalID])
+		}
+	}
+	return changes
+}
+
+// sortedResourceIDs returns the keys of the template section sorted.
+func sortedResourceIDs(section map[string]map[string]interface{}) []string {
+	keys := make([]string, 0, len(section))
+	for key := range section {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
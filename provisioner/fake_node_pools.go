@@ -0,0 +1,399 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"sync"
+
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+// fakeNodePool is a node pool of the fake node pool backend.
+type fakeNodePool struct {
+	min        int
+	max        int
+	desired    int
+	generation int
+	configHash string
+	zones      []string
+	nodes      []*updatestrategy.Node
+	// suspended is the desired size of the node pool from before its
+	// cluster was suspended, -1 if it isn't suspended.
+	suspended int
+}
+
+// fakeNodePools is an in-memory node pool backend. Like an ASG it launches
+// nodes of the current generation of a node pool balanced across its zones
+// until the desired size is reached and replaces terminated nodes unless the
+// desired size is decremented. The nodes are ready as soon as they're
+// launched.
+type fakeNodePools struct {
+	mutex    sync.Mutex
+	pools    map[string]*fakeNodePool
+	launched int
+}
+
+// newFakeNodePools initializes a new fake node pool backend without any node
+// pools.
+func newFakeNodePools() *fakeNodePools {
+	return &fakeNodePools{pools: make(map[string]*fakeNodePool)}
+}
+
+// fakeNodePoolKey returns the key of a node pool of a cluster.
+func fakeNodePoolKey(clusterID, nodePool string) string {
+	return clusterID + "/" + nodePool
+}
+
+// sync creates the missing node pools of the cluster, removes the ones which
+// aren't part of the cluster anymore and updates the sizes of the others.
+// Node pools with a changed config hash get a new generation, such that
+// their existing nodes are replaced by the update.
+func (f *fakeNodePools) sync(cluster *api.Cluster, configHashes map[string]string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	current := make(map[string]bool, len(cluster.NodePools))
+	for _, nodePool := range cluster.NodePools {
+		key := fakeNodePoolKey(cluster.ID, nodePool.Name)
+		current[key] = true
+
+		pool, ok := f.pools[key]
+		if !ok {
+			pool = &fakeNodePool{
+				desired:   int(nodePool.MinSize),
+				suspended: -1,
+			}
+			f.pools[key] = pool
+		}
+
+		if pool.configHash != configHashes[nodePool.Name] {
+			pool.generation++
+			pool.configHash = configHashes[nodePool.Name]
+		}
+
+		pool.min = int(nodePool.MinSize)
+		pool.max = int(nodePool.MaxSize)
+		pool.zones = fakeZones(cluster, nodePool)
+		if pool.suspended < 0 {
+			pool.desired = clampInt(pool.desired, pool.min, pool.max)
+		}
+		f.scale(pool)
+	}
+
+	for key := range f.pools {
+		if _, ok := current[key]; !ok && hasClusterPrefix(key, cluster.ID) {
+			delete(f.pools, key)
+		}
+	}
+}
+
+// remove removes all node pools of the cluster.
+func (f *fakeNodePools) remove(clusterID string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for key := range f.pools {
+		if hasClusterPrefix(key, clusterID) {
+			delete(f.pools, key)
+		}
+	}
+}
+
+// suspend scales all node pools of the cluster to zero, keeping their
+// desired sizes for resume.
+func (f *fakeNodePools) suspend(clusterID string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for key, pool := range f.pools {
+		if !hasClusterPrefix(key, clusterID) || pool.suspended >= 0 {
+			continue
+		}
+		pool.suspended = pool.desired
+		pool.desired = 0
+		f.scale(pool)
+	}
+}
+
+// resume restores the desired sizes of the node pools of a suspended
+// cluster.
+func (f *fakeNodePools) resume(clusterID string) {
+	f.mutex.Lock()
+	defer f.mutex.Unlock()
+
+	for key, pool := range f.pools {
+		if !hasClusterPrefix(key, clusterID) || pool.suspended < 0 {
+			continue
+		}
+		pool.desired = pool.suspended
+		pool.suspended = -1
+		f.scale(pool)
+	}
+}
+
+// scale launches or terminates nodes until the node pool has its desired
+// size. Nodes of older generations are terminated first.
+func (f *fakeNodePools) scale(pool *fakeNodePool) {
+	for len(pool.nodes) < pool.desired {
+		f.launch(pool)
+	}
+
+	for len(pool.nodes) > pool.desired {
+		oldest := 0
+		for i, node := range pool.nodes {
+			if node.Generation < pool.nodes[oldest].Generation {
+				oldest = i
+			}
+		}
+		pool.nodes = append(pool.nodes[:oldest], pool.nodes[oldest+1:]...)
+	}
+}
+
+// launch adds a ready node of the current generation to the zone of the node
+// pool with the fewest nodes.
+func (f *fakeNodePools) launch(pool *fakeNodePool) {
+	nodesPerZone := make(map[string]int, len(pool.zones))
+	for _, node := range pool.nodes {
+		nodesPerZone[node.FailureDomain]++
+	}
+
+	zone := pool.zones[0]
+	for _, z := range pool.zones[1:] {
+		if nodesPerZone[z] < nodesPerZone[zone] {
+			zone = z
+		}
+	}
+
+	f.launched++
+	pool.nodes = append(pool.nodes, &updatestrategy.Node{
+		Name:          fmt.Sprintf("ip-10-0-%d-%d.%s.compute.internal", f.launched/256, f.launched%256, FakeProvider),
+		ProviderID:    fmt.Sprintf("%s:///%s/i-%017x", FakeProvider, zone, f.launched),
+		FailureDomain: zone,
+		Generation:    pool.generation,
+		Labels:        map[string]string{},
+		Annotations:   map[string]string{},
+		Ready:         true,
+	})
+}
+
+// fakeZones returns the zones of the node pool, by default the zones a to c
+// of the region of the cluster.
+func fakeZones(cluster *api.Cluster, nodePool *api.NodePool) []string {
+	if len(nodePool.AvailabilityZones) > 0 {
+		return nodePool.AvailabilityZones
+	}
+	return []string{cluster.Region + "a", cluster.Region + "b", cluster.Region + "c"}
+}
+
+// hasClusterPrefix returns true if the key is the key of a node pool of the
+// cluster.
+func hasClusterPrefix(key, clusterID string) bool {
+	return strings.HasPrefix(key, fakeNodePoolKey(clusterID, ""))
+}
+
+func clampInt(value, min, max int) int {
+	if value < min {
+		return min
+	}
+	if value > max {
+		return max
+	}
+	return value
+}
+
+// fakeNodePoolManager manages the node pools of a cluster in the fake node
+// pool backend.
+type fakeNodePoolManager struct {
+	pools     *fakeNodePools
+	clusterID string
+}
+
+// pool returns the node pool, the lock of the backend must be held.
+func (m *fakeNodePoolManager) pool(name string) (*fakeNodePool, error) {
+	pool, ok := m.pools.pools[fakeNodePoolKey(m.clusterID, name)]
+	if !ok {
+		return nil, fmt.Errorf("node pool %s of cluster %s not found", name, m.clusterID)
+	}
+	return pool, nil
+}
+
+// node returns the node with the provider ID of the node, the lock of the
+// backend must be held.
+func (m *fakeNodePoolManager) node(node *updatestrategy.Node) (*fakeNodePool, int, error) {
+	for key, pool := range m.pools.pools {
+		if !hasClusterPrefix(key, m.clusterID) {
+			continue
+		}
+		for i, n := range pool.nodes {
+			if n.ProviderID == node.ProviderID {
+				return pool, i, nil
+			}
+		}
+	}
+	return nil, 0, fmt.Errorf("node %s not found", node.Name)
+}
+
+// GetPool returns a copy of the node pool and its nodes.
+func (m *fakeNodePoolManager) GetPool(nodePool *api.NodePool) (*updatestrategy.NodePool, error) {
+	m.pools.mutex.Lock()
+	defer m.pools.mutex.Unlock()
+
+	pool, err := m.pool(nodePool.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*updatestrategy.Node, 0, len(pool.nodes))
+	for _, node := range pool.nodes {
+		n := *node
+		n.Labels = copyStringMap(node.Labels)
+		n.Annotations = copyStringMap(node.Annotations)
+		n.Taints = append([]v1.Taint(nil), node.Taints...)
+		nodes = append(nodes, &n)
+	}
+
+	return &updatestrategy.NodePool{
+		Min:        pool.min,
+		Desired:    pool.desired,
+		Current:    len(pool.nodes),
+		Max:        pool.max,
+		Generation: pool.generation,
+		Nodes:      nodes,
+	}, nil
+}
+
+func (m *fakeNodePoolManager) LabelNode(node *updatestrategy.Node, labelKey, labelValue string) error {
+	m.pools.mutex.Lock()
+	defer m.pools.mutex.Unlock()
+
+	pool, i, err := m.node(node)
+	if err != nil {
+		return err
+	}
+	pool.nodes[i].Labels[labelKey] = labelValue
+	return nil
+}
+
+func (m *fakeNodePoolManager) AnnotateNode(node *updatestrategy.Node, annotationKey, annotationValue string) error {
+	m.pools.mutex.Lock()
+	defer m.pools.mutex.Unlock()
+
+	pool, i, err := m.node(node)
+	if err != nil {
+		return err
+	}
+	pool.nodes[i].Annotations[annotationKey] = annotationValue
+	return nil
+}
+
+func (m *fakeNodePoolManager) TaintNode(node *updatestrategy.Node, taintKey, taintValue string, effect v1.TaintEffect) error {
+	m.pools.mutex.Lock()
+	defer m.pools.mutex.Unlock()
+
+	pool, i, err := m.node(node)
+	if err != nil {
+		return err
+	}
+
+	taint := v1.Taint{Key: taintKey, Value: taintValue, Effect: effect}
+	n := pool.nodes[i]
+	for j, t := range n.Taints {
+		if t.Key == taintKey && t.Effect == effect {
+			n.Taints[j] = taint
+			return nil
+		}
+	}
+	n.Taints = append(n.Taints, taint)
+	return nil
+}
+
+func (m *fakeNodePoolManager) ScalePool(ctx context.Context, nodePool *api.NodePool, replicas int) error {
+	m.pools.mutex.Lock()
+	defer m.pools.mutex.Unlock()
+
+	pool, err := m.pool(nodePool.Name)
+	if err != nil {
+		return err
+	}
+	pool.desired = replicas
+	m.pools.scale(pool)
+	return nil
+}
+
+// TerminateNode terminates the node. Unless the desired size is decremented
+// a replacement is launched immediately.
+func (m *fakeNodePoolManager) TerminateNode(ctx context.Context, node *updatestrategy.Node, decrementDesired bool) error {
+	m.pools.mutex.Lock()
+	defer m.pools.mutex.Unlock()
+
+	pool, i, err := m.node(node)
+	if err != nil {
+		return err
+	}
+
+	pool.nodes = append(pool.nodes[:i], pool.nodes[i+1:]...)
+	if decrementDesired {
+		pool.desired--
+	}
+	m.pools.scale(pool)
+	return nil
+}
+
+func (m *fakeNodePoolManager) CordonNode(node *updatestrategy.Node) error {
+	m.pools.mutex.Lock()
+	defer m.pools.mutex.Unlock()
+
+	pool, i, err := m.node(node)
+	if err != nil {
+		return err
+	}
+	pool.nodes[i].Cordoned = true
+	return nil
+}
+
+// InitializeNode always succeeds, the fake nodes don't run any DaemonSet
+// pods.
+func (m *fakeNodePoolManager) InitializeNode(node *updatestrategy.Node) (bool, error) {
+	return true, nil
+}
+
+// BlastRadius returns the share of the nodes of the cluster being replaced.
+// The fake nodes don't run any pods.
+func (m *fakeNodePoolManager) BlastRadius(nodes []*updatestrategy.Node) (*updatestrategy.BlastRadius, error) {
+	m.pools.mutex.Lock()
+	defer m.pools.mutex.Unlock()
+
+	clusterNodes := 0
+	for key, pool := range m.pools.pools {
+		if hasClusterPrefix(key, m.clusterID) {
+			clusterNodes += len(pool.nodes)
+		}
+	}
+
+	radius := &updatestrategy.BlastRadius{Nodes: len(nodes), ClusterNodes: clusterNodes}
+	if clusterNodes > 0 {
+		radius.CapacityPercent = 100 * float64(len(nodes)) / float64(clusterNodes)
+	}
+	return radius, nil
+}
+
+// MoveStickyVolume is a no-op, the simulated nodes have no volumes.
+func (m *fakeNodePoolManager) MoveStickyVolume(ctx context.Context, from, to *updatestrategy.Node, device string) error {
+	return nil
+}
+
+func (m *fakeNodePoolManager) CheckNodeHealth(node *updatestrategy.Node) ([]string, error) {
+	return node.Problems, nil
+}
+
+func copyStringMap(m map[string]string) map[string]string {
+	copied := make(map[string]string, len(m))
+	for key, value := range m {
+		copied[key] = value
+	}
+	return copied
+}
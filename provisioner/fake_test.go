@@ -0,0 +1,169 @@
+package provisioner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+func fakeTestCluster() *api.Cluster {
+	return &api.Cluster{
+		ID:                    "aws:123456789012:eu-central-1:kube-1",
+		Alias:                 "kube-1",
+		LocalID:               "kube-1",
+		InfrastructureAccount: "aws:123456789012",
+		Region:                "eu-central-1",
+		Provider:              FakeProvider,
+		ConfigItems:           map[string]string{},
+		NodePools: []*api.NodePool{
+			{Name: "master-default", Profile: "master-default", InstanceType: "m5.large", MinSize: 1, MaxSize: 1},
+			{Name: "worker-default", Profile: "worker-default", InstanceType: "m5.large", MinSize: 3, MaxSize: 3},
+		},
+	}
+}
+
+func fakeNodeGenerations(t *testing.T, p *fakeProvisioner, cluster *api.Cluster, nodePool string) []int {
+	manager := &fakeNodePoolManager{pools: p.nodePools, clusterID: cluster.ID}
+	pool, err := manager.GetPool(&api.NodePool{Name: nodePool})
+	require.NoError(t, err)
+
+	generations := make([]int, 0, len(pool.Nodes))
+	for _, node := range pool.Nodes {
+		generations = append(generations, node.Generation)
+	}
+	return generations
+}
+
+func TestFakeProvisioner(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fake-channel")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	channelConfig := &channel.Config{Version: "v1", Path: dir}
+	p := NewFakeProvisioner(&Options{}).(*fakeProvisioner)
+	cluster := fakeTestCluster()
+	ctx := context.Background()
+
+	err = p.Provision(ctx, cluster, channelConfig)
+	require.NoError(t, err)
+
+	client := p.adapter(log.WithField("test", true), cluster).cloudformationClient
+	stack, err := describeStack(client, cluster.LocalID)
+	require.NoError(t, err)
+	assert.Equal(t, cloudformation.StackStatusCreateComplete, aws.StringValue(stack.StackStatus))
+
+	resources, err := client.DescribeStackResources(&cloudformation.DescribeStackResourcesInput{StackName: aws.String(cluster.LocalID)})
+	require.NoError(t, err)
+	require.Len(t, resources.StackResources, 2)
+	assert.Equal(t, resourceTypeAutoScalingGroup, aws.StringValue(resources.StackResources[0].ResourceType))
+
+	assert.Equal(t, []int{1}, fakeNodeGenerations(t, p, cluster, "master-default"))
+	assert.Equal(t, []int{1, 1, 1}, fakeNodeGenerations(t, p, cluster, "worker-default"))
+
+	// provisioning an unchanged cluster doesn't touch the stack or the
+	// nodes.
+	err = p.Provision(ctx, cluster, channelConfig)
+	require.NoError(t, err)
+
+	stack, err = describeStack(client, cluster.LocalID)
+	require.NoError(t, err)
+	assert.Equal(t, cloudformation.StackStatusCreateComplete, aws.StringValue(stack.StackStatus))
+	assert.Equal(t, []int{1, 1, 1}, fakeNodeGenerations(t, p, cluster, "worker-default"))
+
+	// changing a node pool replaces its nodes.
+	cluster.NodePools[1].InstanceType = "m5.xlarge"
+	err = p.Provision(ctx, cluster, channelConfig)
+	require.NoError(t, err)
+
+	stack, err = describeStack(client, cluster.LocalID)
+	require.NoError(t, err)
+	assert.Equal(t, cloudformation.StackStatusUpdateComplete, aws.StringValue(stack.StackStatus))
+	assert.Equal(t, []int{1}, fakeNodeGenerations(t, p, cluster, "master-default"))
+	assert.Equal(t, []int{2, 2, 2}, fakeNodeGenerations(t, p, cluster, "worker-default"))
+
+	err = p.Suspend(ctx, cluster, channelConfig)
+	require.NoError(t, err)
+	assert.Empty(t, fakeNodeGenerations(t, p, cluster, "worker-default"))
+
+	err = p.Resume(ctx, cluster, channelConfig)
+	require.NoError(t, err)
+	assert.Len(t, fakeNodeGenerations(t, p, cluster, "worker-default"), 3)
+
+	err = p.Decommission(ctx, cluster, channelConfig)
+	require.NoError(t, err)
+
+	_, err = describeStack(client, cluster.LocalID)
+	assert.True(t, isDoesNotExistsErr(err))
+
+	manager := &fakeNodePoolManager{pools: p.nodePools, clusterID: cluster.ID}
+	_, err = manager.GetPool(cluster.NodePools[1])
+	assert.Error(t, err)
+}
+
+func TestFakeProvisionerValidatesCluster(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fake-channel")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	channelConfig := &channel.Config{Version: "v1", Path: dir}
+	p := NewFakeProvisioner(&Options{}).(*fakeProvisioner)
+
+	cluster := fakeTestCluster()
+	cluster.NodePools[1].Tags = map[string]string{"aws:reserved": "value"}
+	err = p.Provision(context.Background(), cluster, channelConfig)
+	assert.Error(t, err)
+
+	cluster = fakeTestCluster()
+	cluster.NodePools = cluster.NodePools[:1]
+	err = p.Provision(context.Background(), cluster, channelConfig)
+	assert.IsType(t, &lastNodePoolError{}, err)
+
+	// nothing is applied for invalid clusters.
+	_, err = describeStack(p.adapter(log.WithField("test", true), cluster).cloudformationClient, cluster.LocalID)
+	assert.True(t, isDoesNotExistsErr(err))
+}
+
+func TestFakeCloudFormationChangeSets(t *testing.T) {
+	client := newFakeCloudFormation("eu-central-1")
+	adapter := &awsAdapter{cloudformationClient: client, logger: log.WithField("test", true)}
+
+	template := `{"Resources": {"Queue": {"Type": "AWS::SQS::Queue"}}}`
+	updated, err := adapter.applyStack(context.Background(), "stack", template, "", "hash", true)
+	require.NoError(t, err)
+	assert.True(t, updated)
+
+	// re-applying the same template is a no-op.
+	updated, err = adapter.applyStack(context.Background(), "stack", template, "", "hash", true)
+	require.NoError(t, err)
+	assert.False(t, updated)
+
+	template = `{"Resources": {"Topic": {"Type": "AWS::SNS::Topic"}}}`
+	resp, err := client.CreateChangeSetWithContext(context.Background(), &cloudformation.CreateChangeSetInput{
+		StackName:     aws.String("stack"),
+		ChangeSetName: aws.String("update"),
+		TemplateBody:  aws.String(template),
+	})
+	require.NoError(t, err)
+
+	changeSet, err := client.DescribeChangeSetWithContext(context.Background(), &cloudformation.DescribeChangeSetInput{ChangeSetName: resp.Id})
+	require.NoError(t, err)
+	require.Len(t, changeSet.Changes, 2)
+	assert.Equal(t, cloudformation.ChangeActionAdd, aws.StringValue(changeSet.Changes[0].ResourceChange.Action))
+	assert.Equal(t, "Topic", aws.StringValue(changeSet.Changes[0].ResourceChange.LogicalResourceId))
+	assert.Equal(t, cloudformation.ChangeActionRemove, aws.StringValue(changeSet.Changes[1].ResourceChange.Action))
+	assert.Equal(t, "Queue", aws.StringValue(changeSet.Changes[1].ResourceChange.LogicalResourceId))
+
+	// stacks with termination protection can't be deleted.
+	_, err = client.DeleteStack(&cloudformation.DeleteStackInput{StackName: aws.String("stack")})
+	assert.Error(t, err)
+}
@@ -0,0 +1,227 @@
+package provisioner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+)
+
+// FleetQuery defines the criteria for finding node pools across all
+// clusters. Empty criteria match every node pool, a node pool must match all
+// of the specified criteria.
+type FleetQuery struct {
+	InstanceType     string
+	DiscountStrategy string
+	// AMIOlderThan matches node pools whose nodes are launched from
+	// an AMI created longer ago than the duration.
+	AMIOlderThan time.Duration
+}
+
+// FleetMatch is a node pool matching a fleet query.
+type FleetMatch struct {
+	Cluster  *api.Cluster
+	NodePool *api.NodePool
+	// Image is only looked up if the query has an AMI criteria.
+	Image *NodePoolImage
+}
+
+// NodePoolImage describes the AMI used for launching the nodes of a node
+// pool. The creation date of deregistered AMIs is unknown and left zero.
+type NodePoolImage struct {
+	ID           string
+	CreationDate time.Time
+}
+
+// FleetInventory looks up information about the node pools of a cluster
+// which isn't part of the cluster registry.
+type FleetInventory interface {
+	// NodePoolImages returns the AMIs of the node pools of a cluster
+	// by node pool name.
+	NodePoolImages(cluster *api.Cluster) (map[string]*NodePoolImage, error)
+}
+
+// QueryFleet returns the node pools of the clusters matching the query. The
+// inventory is only used if the query has an AMI criteria. Clusters whose
+// inventory can't be looked up are skipped with a warning.
+func QueryFleet(clusters []*api.Cluster, query *FleetQuery, inventory FleetInventory) []*FleetMatch {
+	var matches []*FleetMatch
+	now := time.Now()
+
+	for _, cluster := range clusters {
+		var images map[string]*NodePoolImage
+		if query.AMIOlderThan > 0 {
+			var err error
+			images, err = inventory.NodePoolImages(cluster)
+			if err != nil {
+				log.Warnf("Skipping cluster %s, failed to look up node pool AMIs: %v", cluster.ID, err)
+				continue
+			}
+		}
+
+		for _, nodePool := range cluster.NodePools {
+			if query.InstanceType != "" && nodePool.InstanceType != query.InstanceType {
+				continue
+			}
+
+			if query.DiscountStrategy != "" && nodePool.DiscountStrategy != query.DiscountStrategy {
+				continue
+			}
+
+			// deregistered AMIs are at least as old as the ones
+			// still available, so they always match.
+			image := images[nodePool.Name]
+			if query.AMIOlderThan > 0 && (image == nil || (!image.CreationDate.IsZero() && now.Sub(image.CreationDate) <= query.AMIOlderThan)) {
+				continue
+			}
+
+			matches = append(matches, &FleetMatch{
+				Cluster:  cluster,
+				NodePool: nodePool,
+				Image:    image,
+			})
+		}
+	}
+
+	return matches
+}
+
+type awsFleetInventory struct {
+	assumedRole string
+	awsConfig   *aws.Config
+	credentials *awsExt.CredentialsCache
+}
+
+// NewFleetInventory returns a FleetInventory looking up the node pools in
+// the AWS accounts of the clusters by assuming the IAM role.
+func NewFleetInventory(assumedRole string, awsConfig *aws.Config) FleetInventory {
+	return &awsFleetInventory{
+		assumedRole: assumedRole,
+		awsConfig:   awsConfig,
+		credentials: awsExt.NewCredentialsCache(),
+	}
+}
+
+// NodePoolImages returns the AMIs of the node pools of a cluster by node pool
+// name.
+func (i *awsFleetInventory) NodePoolImages(cluster *api.Cluster) (map[string]*NodePoolImage, error) {
+	sess, err := clusterSession(i.awsConfig, i.assumedRole, i.credentials, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	adapter, err := newAWSAdapter(log.WithField("cluster", cluster.Alias), cluster.APIServerURL, cluster.Region, sess, nil, true)
+	if err != nil {
+		return nil, err
+	}
+
+	return adapter.nodePoolImages(cluster)
+}
+
+// nodePoolImages returns the AMIs of the node pools of a cluster by node pool
+// name. Node pools without an ASG are omitted. AMIs are looked up by filter,
+// such that deregistered AMIs are returned without a creation date instead of
+// failing the lookup.
+func (a *awsAdapter) nodePoolImages(cluster *api.Cluster) (map[string]*NodePoolImage, error) {
+	imageIDs := make(map[string]string, len(cluster.NodePools))
+	for _, nodePool := range cluster.NodePools {
+		asg, err := a.getNodePoolASG(cluster.LocalID, nodePool.Name)
+		if err != nil {
+			a.logger.Warnf("Failed to find ASG of node pool %s: %v", nodePool.Name, err)
+			continue
+		}
+
+		imageID, err := a.asgImageID(asg)
+		if err != nil {
+			return nil, err
+		}
+		imageIDs[nodePool.Name] = imageID
+	}
+
+	if len(imageIDs) == 0 {
+		return nil, nil
+	}
+
+	ids := make([]*string, 0, len(imageIDs))
+	for _, id := range imageIDs {
+		ids = append(ids, aws.String(id))
+	}
+
+	resp, err := a.ec2Client.DescribeImages(&ec2.DescribeImagesInput{
+		Filters: []*ec2.Filter{{Name: aws.String("image-id"), Values: ids}},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	creationDates := make(map[string]time.Time, len(resp.Images))
+	for _, image := range resp.Images {
+		creationDate, err := time.Parse(time.RFC3339, aws.StringValue(image.CreationDate))
+		if err != nil {
+			return nil, err
+		}
+		creationDates[aws.StringValue(image.ImageId)] = creationDate
+	}
+
+	images := make(map[string]*NodePoolImage, len(imageIDs))
+	for nodePool, id := range imageIDs {
+		creationDate, ok := creationDates[id]
+		if !ok {
+			a.logger.Warnf("AMI %s of node pool %s not found, it was probably deregistered", id, nodePool)
+		}
+		images[nodePool] = &NodePoolImage{ID: id, CreationDate: creationDate}
+	}
+
+	return images, nil
+}
+
+// asgImageID returns the AMI new instances of the ASG are launched from.
+func (a *awsAdapter) asgImageID(asg *autoscaling.Group) (string, error) {
+	if asg.LaunchTemplate != nil {
+		params := &ec2.DescribeLaunchTemplateVersionsInput{
+			LaunchTemplateId: asg.LaunchTemplate.LaunchTemplateId,
+			Versions:         []*string{asg.LaunchTemplate.Version},
+		}
+		resp, err := a.ec2Client.DescribeLaunchTemplateVersions(params)
+		if err != nil {
+			return "", err
+		}
+
+		if len(resp.LaunchTemplateVersions) != 1 || resp.LaunchTemplateVersions[0].LaunchTemplateData == nil {
+			return "", fmt.Errorf("failed to find launch template version of ASG %s", aws.StringValue(asg.AutoScalingGroupName))
+		}
+		return aws.StringValue(resp.LaunchTemplateVersions[0].LaunchTemplateData.ImageId), nil
+	}
+
+	resp, err := a.autoscalingClient.DescribeLaunchConfigurations(&autoscaling.DescribeLaunchConfigurationsInput{
+		LaunchConfigurationNames: []*string{asg.LaunchConfigurationName},
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(resp.LaunchConfigurations) != 1 {
+		return "", fmt.Errorf("failed to find launch configuration of ASG %s", aws.StringValue(asg.AutoScalingGroupName))
+	}
+	return aws.StringValue(resp.LaunchConfigurations[0].ImageId), nil
+}
+
+// String returns a tab separated representation of the match.
+func (m *FleetMatch) String() string {
+	fields := []string{m.Cluster.ID, m.NodePool.Name, m.NodePool.InstanceType, m.NodePool.DiscountStrategy}
+	if m.Image != nil {
+		creationDate := "unknown"
+		if !m.Image.CreationDate.IsZero() {
+			creationDate = m.Image.CreationDate.Format(time.RFC3339)
+		}
+		fields = append(fields, m.Image.ID, creationDate)
+	}
+	return strings.Join(fields, "\t")
+}
@@ -0,0 +1,194 @@
+package provisioner
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type fleetInventoryStub struct {
+	images map[string]map[string]*NodePoolImage
+}
+
+func (i *fleetInventoryStub) NodePoolImages(cluster *api.Cluster) (map[string]*NodePoolImage, error) {
+	images, ok := i.images[cluster.ID]
+	if !ok {
+		return nil, fmt.Errorf("no access to cluster %s", cluster.ID)
+	}
+	return images, nil
+}
+
+func TestQueryFleet(t *testing.T) {
+	now := time.Now()
+	clusters := []*api.Cluster{
+		{
+			ID: "cluster-1",
+			NodePools: []*api.NodePool{
+				{Name: "master-default", InstanceType: "m4.large", DiscountStrategy: discountStrategyNone},
+				{Name: "worker-default", InstanceType: "m5.large", DiscountStrategy: discountStrategySpotMaxPrice},
+			},
+		},
+		{
+			ID: "cluster-2",
+			NodePools: []*api.NodePool{
+				{Name: "worker-default", InstanceType: "m4.large", DiscountStrategy: discountStrategySpotMaxPrice},
+			},
+		},
+		{
+			ID: "cluster-3",
+			NodePools: []*api.NodePool{
+				{Name: "worker-default", InstanceType: "m4.large", DiscountStrategy: discountStrategyNone},
+			},
+		},
+		{
+			ID: "cluster-4",
+			NodePools: []*api.NodePool{
+				{Name: "worker-default", InstanceType: "m5.large", DiscountStrategy: discountStrategyNone},
+			},
+		},
+	}
+
+	inventory := &fleetInventoryStub{
+		images: map[string]map[string]*NodePoolImage{
+			"cluster-1": {
+				"master-default": {ID: "ami-old", CreationDate: now.Add(-100 * 24 * time.Hour)},
+				"worker-default": {ID: "ami-new", CreationDate: now.Add(-time.Hour)},
+			},
+			"cluster-2": {
+				"worker-default": {ID: "ami-old", CreationDate: now.Add(-100 * 24 * time.Hour)},
+			},
+			"cluster-4": {
+				"worker-default": {ID: "ami-deregistered"},
+			},
+		},
+	}
+
+	matchNames := func(matches []*FleetMatch) []string {
+		var names []string
+		for _, match := range matches {
+			names = append(names, match.Cluster.ID+"/"+match.NodePool.Name)
+		}
+		return names
+	}
+
+	for _, tc := range []struct {
+		msg      string
+		query    *FleetQuery
+		expected []string
+	}{
+		{
+			msg:      "instance type",
+			query:    &FleetQuery{InstanceType: "m4.large"},
+			expected: []string{"cluster-1/master-default", "cluster-2/worker-default", "cluster-3/worker-default"},
+		},
+		{
+			msg:      "instance type and discount strategy",
+			query:    &FleetQuery{InstanceType: "m4.large", DiscountStrategy: discountStrategySpotMaxPrice},
+			expected: []string{"cluster-2/worker-default"},
+		},
+		{
+			// cluster-3 is skipped because its inventory can't
+			// be looked up, the deregistered AMI of cluster-4
+			// matches.
+			msg:      "ami age",
+			query:    &FleetQuery{AMIOlderThan: 90 * 24 * time.Hour},
+			expected: []string{"cluster-1/master-default", "cluster-2/worker-default", "cluster-4/worker-default"},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			assert.Equal(t, tc.expected, matchNames(QueryFleet(clusters, tc.query, inventory)))
+		})
+	}
+}
+
+type fleetEC2APIStub struct {
+	ec2API
+	images   []*ec2.Image
+	versions []*ec2.LaunchTemplateVersion
+}
+
+func (e *fleetEC2APIStub) DescribeImages(input *ec2.DescribeImagesInput) (*ec2.DescribeImagesOutput, error) {
+	// unlike filters, IDs of deregistered AMIs fail the request.
+	if len(input.ImageIds) > 0 {
+		return nil, errors.New("InvalidAMIID.NotFound")
+	}
+	return &ec2.DescribeImagesOutput{Images: e.images}, nil
+}
+
+func (e *fleetEC2APIStub) DescribeLaunchTemplateVersions(input *ec2.DescribeLaunchTemplateVersionsInput) (*ec2.DescribeLaunchTemplateVersionsOutput, error) {
+	if input.LaunchTemplateId != nil && input.LaunchTemplateName != nil {
+		return nil, errors.New("either the launch template ID or name must be specified")
+	}
+	return &ec2.DescribeLaunchTemplateVersionsOutput{LaunchTemplateVersions: e.versions}, nil
+}
+
+func TestNodePoolImages(t *testing.T) {
+	adapter := &awsAdapter{
+		autoscalingClient: &gcAutoscalingAPIStub{
+			groups: []*autoscaling.Group{
+				{
+					AutoScalingGroupName:    aws.String("kube-1-WorkerAutoScalingGroup-1"),
+					LaunchConfigurationName: aws.String("kube-1-WorkerLaunchConfiguration-1"),
+					Tags: []*autoscaling.TagDescription{
+						{Key: aws.String("aws:cloudformation:stack-name"), Value: aws.String("kube-1")},
+						{Key: aws.String("NodePool"), Value: aws.String("worker-default")},
+					},
+				},
+				{
+					AutoScalingGroupName: aws.String("kube-1-WorkerAutoScalingGroup-2"),
+					LaunchTemplate: &autoscaling.LaunchTemplateSpecification{
+						LaunchTemplateId:   aws.String("lt-1"),
+						LaunchTemplateName: aws.String("kube-1-worker-old"),
+						Version:            aws.String("1"),
+					},
+					Tags: []*autoscaling.TagDescription{
+						{Key: aws.String("aws:cloudformation:stack-name"), Value: aws.String("kube-1")},
+						{Key: aws.String("NodePool"), Value: aws.String("worker-old")},
+					},
+				},
+			},
+			launchConfigs: []*autoscaling.LaunchConfiguration{
+				{LaunchConfigurationName: aws.String("kube-1-WorkerLaunchConfiguration-1"), ImageId: aws.String("ami-1")},
+			},
+		},
+		ec2Client: &fleetEC2APIStub{
+			images: []*ec2.Image{
+				{ImageId: aws.String("ami-1"), CreationDate: aws.String("2018-05-01T12:00:00.000Z")},
+			},
+			versions: []*ec2.LaunchTemplateVersion{
+				{LaunchTemplateData: &ec2.ResponseLaunchTemplateData{ImageId: aws.String("ami-deregistered")}},
+			},
+		},
+		logger: log.WithField("cluster", "foobar"),
+	}
+
+	cluster := &api.Cluster{
+		LocalID: "kube-1",
+		NodePools: []*api.NodePool{
+			{Name: "master-default"},
+			{Name: "worker-default"},
+			{Name: "worker-old"},
+		},
+	}
+
+	images, err := adapter.nodePoolImages(cluster)
+	require.NoError(t, err)
+	require.Len(t, images, 2)
+	assert.Equal(t, "ami-1", images["worker-default"].ID)
+	assert.Equal(t, time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC), images["worker-default"].CreationDate)
+	assert.Equal(t, "ami-deregistered", images["worker-old"].ID)
+	assert.True(t, images["worker-old"].CreationDate.IsZero())
+
+	match := &FleetMatch{Cluster: cluster, NodePool: cluster.NodePools[2], Image: images["worker-old"]}
+	assert.Equal(t, "\tworker-old\t\t\tami-deregistered\tunknown", match.String())
+}
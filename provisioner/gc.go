@@ -0,0 +1,261 @@
+package provisioner
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+)
+
+const (
+	launchTemplateVersionLatest  = "$Latest"
+	launchTemplateVersionDefault = "$Default"
+	// maxDeleteLaunchTemplateVersions is the maximum number of versions
+	// which can be deleted in a single request.
+	maxDeleteLaunchTemplateVersions = 200
+	autoscalingResourceInUseErr     = "ResourceInUse"
+)
+
+// CollectLaunchGarbage deletes the launch configurations of a stack and the
+// launch template versions of the stack's ASGs which are used neither by an
+// ASG nor by any running instance. These accumulate when stack updates fail
+// to clean up and count against the per region limits.
+func (a *awsAdapter) CollectLaunchGarbage(stackName string) error {
+	groups, err := a.listASGs()
+	if err != nil {
+		return err
+	}
+
+	stack, err := a.getStackByName(stackName)
+	if err != nil {
+		return err
+	}
+
+	resp, err := a.cloudformationClient.DescribeStackResources(&cloudformation.DescribeStackResourcesInput{
+		StackName: aws.String(stackName),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = a.deleteUnusedLaunchConfigurations(stackName, stack, resp.StackResources, groups)
+	if err != nil {
+		return err
+	}
+
+	stackASGs := make(map[string]bool)
+	for _, resource := range resp.StackResources {
+		if aws.StringValue(resource.ResourceType) == resourceTypeAutoScalingGroup {
+			stackASGs[aws.StringValue(resource.PhysicalResourceId)] = true
+		}
+	}
+
+	for _, group := range groups {
+		if !stackASGs[aws.StringValue(group.AutoScalingGroupName)] || group.LaunchTemplate == nil {
+			continue
+		}
+
+		err := a.deleteUnusedLaunchTemplateVersions(group)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// listASGs lists all ASGs of the account.
+func (a *awsAdapter) listASGs() ([]*autoscaling.Group, error) {
+	var groups []*autoscaling.Group
+	params := &autoscaling.DescribeAutoScalingGroupsInput{}
+	for {
+		resp, err := a.autoscalingClient.DescribeAutoScalingGroups(params)
+		if err != nil {
+			return nil, err
+		}
+
+		groups = append(groups, resp.AutoScalingGroups...)
+
+		if aws.StringValue(resp.NextToken) == "" {
+			return groups, nil
+		}
+		params.NextToken = resp.NextToken
+	}
+}
+
+// deleteUnusedLaunchConfigurations deletes the launch configurations created
+// for the launch configuration resources of the stack which are not used by
+// any of the ASGs or their instances. Launch configurations can't be tagged,
+// so they're matched by the name cloudformation gives them. Only launch
+// configurations created before the last completed update of the stack are
+// deleted, such that the ones of an update in progress are kept.
+func (a *awsAdapter) deleteUnusedLaunchConfigurations(stackName string, stack *cloudformation.Stack, resources []*cloudformation.StackResource, groups []*autoscaling.Group) error {
+	switch aws.StringValue(stack.StackStatus) {
+	case cloudformation.StackStatusCreateComplete, cloudformation.StackStatusUpdateComplete:
+	default:
+		a.logger.Infof("Not collecting launch configurations of stack %s in status %s", stackName, aws.StringValue(stack.StackStatus))
+		return nil
+	}
+
+	lastUpdate := aws.TimeValue(stack.CreationTime)
+	if stack.LastUpdatedTime != nil {
+		lastUpdate = aws.TimeValue(stack.LastUpdatedTime)
+	}
+
+	used := make(map[string]bool)
+	for _, group := range groups {
+		used[aws.StringValue(group.LaunchConfigurationName)] = true
+		for _, instance := range group.Instances {
+			used[aws.StringValue(instance.LaunchConfigurationName)] = true
+		}
+	}
+
+	// cloudformation names the launch configurations
+	// <stack>-<logical-id>-<suffix>.
+	var prefixes []string
+	for _, resource := range resources {
+		if aws.StringValue(resource.ResourceType) == resourceTypeLaunchConfiguration {
+			prefixes = append(prefixes, fmt.Sprintf("%s-%s-", stackName, aws.StringValue(resource.LogicalResourceId)))
+		}
+	}
+
+	var unused []string
+	params := &autoscaling.DescribeLaunchConfigurationsInput{}
+	for {
+		resp, err := a.autoscalingClient.DescribeLaunchConfigurations(params)
+		if err != nil {
+			return err
+		}
+
+		for _, lc := range resp.LaunchConfigurations {
+			name := aws.StringValue(lc.LaunchConfigurationName)
+			if used[name] || !aws.TimeValue(lc.CreatedTime).Before(lastUpdate) {
+				continue
+			}
+
+			for _, prefix := range prefixes {
+				if strings.HasPrefix(name, prefix) && !strings.Contains(strings.TrimPrefix(name, prefix), "-") {
+					unused = append(unused, name)
+					break
+				}
+			}
+		}
+
+		if aws.StringValue(resp.NextToken) == "" {
+			break
+		}
+		params.NextToken = resp.NextToken
+	}
+
+	orphanedResources.WithLabelValues(orphanedLaunchConfiguration).Add(float64(len(unused)))
+
+	for _, name := range unused {
+		if a.dryRun {
+			a.logger.Infof("Would delete unused launch configuration %s", name)
+			continue
+		}
+
+		a.logger.Infof("Deleting unused launch configuration %s", name)
+		_, err := a.autoscalingClient.DeleteLaunchConfiguration(&autoscaling.DeleteLaunchConfigurationInput{
+			LaunchConfigurationName: aws.String(name),
+		})
+		if err != nil {
+			// the launch configuration got used in the meantime.
+			if aerr, ok := err.(awserr.Error); ok && aerr.Code() == autoscalingResourceInUseErr {
+				continue
+			}
+			return err
+		}
+	}
+
+	return nil
+}
+
+// deleteUnusedLaunchTemplateVersions deletes the versions of the launch
+// template of an ASG which are neither the version used by the ASG, the
+// default version nor used by any of the instances of the ASG.
+func (a *awsAdapter) deleteUnusedLaunchTemplateVersions(group *autoscaling.Group) error {
+	var versions []*ec2.LaunchTemplateVersion
+	// ASGs always report the ID of their launch template.
+	params := &ec2.DescribeLaunchTemplateVersionsInput{LaunchTemplateId: group.LaunchTemplate.LaunchTemplateId}
+	for {
+		resp, err := a.ec2Client.DescribeLaunchTemplateVersions(params)
+		if err != nil {
+			return err
+		}
+
+		versions = append(versions, resp.LaunchTemplateVersions...)
+
+		if aws.StringValue(resp.NextToken) == "" {
+			break
+		}
+		params.NextToken = resp.NextToken
+	}
+
+	if len(versions) == 0 {
+		return nil
+	}
+
+	var latest int64
+	for _, version := range versions {
+		if aws.Int64Value(version.VersionNumber) > latest {
+			latest = aws.Int64Value(version.VersionNumber)
+		}
+	}
+
+	used := make(map[string]bool)
+	switch version := aws.StringValue(group.LaunchTemplate.Version); version {
+	case launchTemplateVersionLatest:
+		used[strconv.FormatInt(latest, 10)] = true
+	case launchTemplateVersionDefault, "":
+		// the default version is always kept.
+	default:
+		used[version] = true
+	}
+
+	for _, instance := range group.Instances {
+		if instance.LaunchTemplate != nil {
+			used[aws.StringValue(instance.LaunchTemplate.Version)] = true
+		}
+	}
+
+	var unused []*string
+	for _, version := range versions {
+		number := strconv.FormatInt(aws.Int64Value(version.VersionNumber), 10)
+		if aws.BoolValue(version.DefaultVersion) || used[number] {
+			continue
+		}
+		unused = append(unused, aws.String(number))
+	}
+
+	orphanedResources.WithLabelValues(orphanedLaunchTemplateVersion).Add(float64(len(unused)))
+
+	for len(unused) > 0 {
+		batch := unused
+		if len(batch) > maxDeleteLaunchTemplateVersions {
+			batch = batch[:maxDeleteLaunchTemplateVersions]
+		}
+		unused = unused[len(batch):]
+
+		if a.dryRun {
+			a.logger.Infof("Would delete %d unused versions of launch template %s", len(batch), aws.StringValue(versions[0].LaunchTemplateName))
+			continue
+		}
+
+		a.logger.Infof("Deleting %d unused versions of launch template %s", len(batch), aws.StringValue(versions[0].LaunchTemplateName))
+		_, err := a.ec2Client.DeleteLaunchTemplateVersions(&ec2.DeleteLaunchTemplateVersionsInput{
+			LaunchTemplateId: versions[0].LaunchTemplateId,
+			Versions:         batch,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
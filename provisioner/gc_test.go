@@ -0,0 +1,166 @@
+package provisioner
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type gcAutoscalingAPIStub struct {
+	autoscalingAPI
+	groups        []*autoscaling.Group
+	launchConfigs []*autoscaling.LaunchConfiguration
+	deleted       []string
+}
+
+func (a *gcAutoscalingAPIStub) DescribeAutoScalingGroups(input *autoscaling.DescribeAutoScalingGroupsInput) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	return &autoscaling.DescribeAutoScalingGroupsOutput{AutoScalingGroups: a.groups}, nil
+}
+
+func (a *gcAutoscalingAPIStub) DescribeLaunchConfigurations(input *autoscaling.DescribeLaunchConfigurationsInput) (*autoscaling.DescribeLaunchConfigurationsOutput, error) {
+	return &autoscaling.DescribeLaunchConfigurationsOutput{LaunchConfigurations: a.launchConfigs}, nil
+}
+
+func (a *gcAutoscalingAPIStub) DeleteLaunchConfiguration(input *autoscaling.DeleteLaunchConfigurationInput) (*autoscaling.DeleteLaunchConfigurationOutput, error) {
+	a.deleted = append(a.deleted, aws.StringValue(input.LaunchConfigurationName))
+	return nil, nil
+}
+
+type gcEC2APIStub struct {
+	ec2API
+	versions []*ec2.LaunchTemplateVersion
+	deleted  []string
+}
+
+func (e *gcEC2APIStub) DescribeLaunchTemplateVersions(input *ec2.DescribeLaunchTemplateVersionsInput) (*ec2.DescribeLaunchTemplateVersionsOutput, error) {
+	if input.LaunchTemplateId != nil && input.LaunchTemplateName != nil {
+		return nil, errors.New("either the launch template ID or name must be specified")
+	}
+	return &ec2.DescribeLaunchTemplateVersionsOutput{LaunchTemplateVersions: e.versions}, nil
+}
+
+func (e *gcEC2APIStub) DeleteLaunchTemplateVersions(input *ec2.DeleteLaunchTemplateVersionsInput) (*ec2.DeleteLaunchTemplateVersionsOutput, error) {
+	e.deleted = append(e.deleted, aws.StringValueSlice(input.Versions)...)
+	return nil, nil
+}
+
+func launchTemplateVersion(number int64, isDefault bool) *ec2.LaunchTemplateVersion {
+	return &ec2.LaunchTemplateVersion{
+		LaunchTemplateId:   aws.String("lt-1"),
+		LaunchTemplateName: aws.String("kube-1-worker-default"),
+		VersionNumber:      aws.Int64(number),
+		DefaultVersion:     aws.Bool(isDefault),
+	}
+}
+
+func launchConfiguration(name string, created time.Time) *autoscaling.LaunchConfiguration {
+	return &autoscaling.LaunchConfiguration{
+		LaunchConfigurationName: aws.String(name),
+		CreatedTime:             aws.Time(created),
+	}
+}
+
+func TestCollectLaunchGarbage(t *testing.T) {
+	lastUpdate := time.Date(2018, 5, 1, 12, 0, 0, 0, time.UTC)
+
+	asgClient := &gcAutoscalingAPIStub{
+		groups: []*autoscaling.Group{
+			{
+				AutoScalingGroupName:    aws.String("kube-1-MasterAutoScalingGroup-1"),
+				LaunchConfigurationName: aws.String("kube-1-MasterLaunchConfiguration-new"),
+				Instances: []*autoscaling.Instance{
+					{LaunchConfigurationName: aws.String("kube-1-MasterLaunchConfiguration-old")},
+				},
+			},
+			{
+				AutoScalingGroupName: aws.String("kube-1-WorkerAutoScalingGroup-1"),
+				LaunchTemplate: &autoscaling.LaunchTemplateSpecification{
+					LaunchTemplateId:   aws.String("lt-1"),
+					LaunchTemplateName: aws.String("stack-1"),
+					Version:            aws.String(launchTemplateVersionLatest),
+				},
+				Instances: []*autoscaling.Instance{
+					{LaunchTemplate: &autoscaling.LaunchTemplateSpecification{Version: aws.String("3")}},
+				},
+			},
+		},
+		launchConfigs: []*autoscaling.LaunchConfiguration{
+			launchConfiguration("kube-1-MasterLaunchConfiguration-new", lastUpdate.Add(time.Minute)),
+			launchConfiguration("kube-1-MasterLaunchConfiguration-old", lastUpdate.Add(-time.Hour)),
+			launchConfiguration("kube-1-MasterLaunchConfiguration-unused", lastUpdate.Add(-time.Hour)),
+			// created by an update after the last completed one.
+			launchConfiguration("kube-1-MasterLaunchConfiguration-updating", lastUpdate.Add(time.Minute)),
+			// created by other stacks or resources.
+			launchConfiguration("kube-10-MasterLaunchConfiguration-unused", lastUpdate.Add(-time.Hour)),
+			launchConfiguration("kube-1-WorkerLaunchConfiguration-unused", lastUpdate.Add(-time.Hour)),
+			launchConfiguration("kube-1-MasterLaunchConfiguration-kube-2-unused", lastUpdate.Add(-time.Hour)),
+			launchConfiguration("other", lastUpdate.Add(-time.Hour)),
+		},
+	}
+
+	ec2Client := &gcEC2APIStub{
+		versions: []*ec2.LaunchTemplateVersion{
+			launchTemplateVersion(1, true),
+			launchTemplateVersion(2, false),
+			launchTemplateVersion(3, false),
+			launchTemplateVersion(4, false),
+			launchTemplateVersion(5, false),
+		},
+	}
+
+	cfClient := &cloudFormationAPIStub{
+		statusMutex:      &sync.Mutex{},
+		status:           aws.String(cloudformation.StackStatusUpdateComplete),
+		stackLastUpdated: aws.Time(lastUpdate),
+		stackResources: []*cloudformation.StackResource{
+			{
+				LogicalResourceId:  aws.String("MasterLaunchConfiguration"),
+				PhysicalResourceId: aws.String("kube-1-MasterLaunchConfiguration-new"),
+				ResourceType:       aws.String(resourceTypeLaunchConfiguration),
+			},
+			{
+				PhysicalResourceId: aws.String("kube-1-WorkerAutoScalingGroup-1"),
+				ResourceType:       aws.String(resourceTypeAutoScalingGroup),
+			},
+		},
+	}
+
+	adapter := &awsAdapter{
+		cloudformationClient: cfClient,
+		autoscalingClient:    asgClient,
+		ec2Client:            ec2Client,
+		logger:               log.WithField("cluster", "foobar"),
+	}
+
+	err := adapter.CollectLaunchGarbage("kube-1")
+	require.NoError(t, err)
+	assert.Equal(t, []string{"kube-1-MasterLaunchConfiguration-unused"}, asgClient.deleted)
+	assert.Equal(t, []string{"2", "4"}, ec2Client.deleted)
+
+	// launch configurations aren't collected during stack updates
+	asgClient.deleted = nil
+	ec2Client.deleted = nil
+	cfClient.status = aws.String(cloudformation.StackStatusUpdateInProgress)
+	err = adapter.CollectLaunchGarbage("kube-1")
+	require.NoError(t, err)
+	assert.Empty(t, asgClient.deleted)
+	cfClient.status = aws.String(cloudformation.StackStatusUpdateComplete)
+
+	// nothing is deleted in dry run mode
+	asgClient.deleted = nil
+	ec2Client.deleted = nil
+	adapter.dryRun = true
+	err = adapter.CollectLaunchGarbage("kube-1")
+	require.NoError(t, err)
+	assert.Empty(t, asgClient.deleted)
+	assert.Empty(t, ec2Client.deleted)
+}
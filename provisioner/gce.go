@@ -0,0 +1,604 @@
+package provisioner
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/coreos/container-linux-config-transpiler/config/platform"
+	log "github.com/sirupsen/logrus"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/cluster-registry/models"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/gce"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+	"golang.org/x/oauth2"
+)
+
+const (
+	gceProviderID          = "zalando-gcp"
+	gceAccountPrefix       = "gcp:"
+	gceInstanceTemplate    = "instance-template.json"
+	gceUserDataMetadataKey = "user-data"
+	gceMaxLabelLength      = 63
+
+	// gceSuspendedSizeMetadata is the name of the project metadata item
+	// storing the target size of a node pool from before its cluster was
+	// suspended.
+	gceSuspendedSizeMetadata = "suspended-size"
+)
+
+// gceProvisioner provisions the node pools of clusters as regional GCE
+// managed instance groups. Every node pool gets an instance template based on
+// the instance properties of its profile and the same userdata as the node
+// pools on AWS. Outdated instances are replaced by the update strategy.
+type gceProvisioner struct {
+	compute          gce.ComputeAPI
+	kubeconfigs      kubernetes.KubeconfigProvider
+	updateStrategy   config.UpdateStrategy
+	dryRun           bool
+	applyOnly        bool
+	disasterRecovery bool
+}
+
+// NewGCEProvisioner returns a new provisioner of GCP clusters calling the
+// Compute Engine API with the compute token source. Unless a
+// KubeconfigProvider is specified in the options, the API servers of the
+// clusters are reached with the cluster token source.
+func NewGCEProvisioner(computeTokenSource, clusterTokenSource oauth2.TokenSource, options *Options) Provisioner {
+	provisioner := &gceProvisioner{
+		compute:     gce.NewComputeAPI(computeTokenSource),
+		kubeconfigs: kubernetes.NewRegistryKubeconfigProvider(clusterTokenSource),
+	}
+
+	if options != nil {
+		provisioner.dryRun = options.DryRun || options.ReadOnly
+		provisioner.applyOnly = options.ApplyOnly
+		provisioner.disasterRecovery = options.DisasterRecovery
+		provisioner.updateStrategy = options.UpdateStrategy
+
+		if options.KubeconfigProvider != nil {
+			provisioner.kubeconfigs = options.KubeconfigProvider
+		}
+	}
+
+	return provisioner
+}
+
+// Version returns the version derived from a sha1 hash of the cluster struct
+// and the channel config version.
+func (p *gceProvisioner) Version(cluster *api.Cluster, channelConfig *channel.Config) (string, error) {
+	if cluster.Provider != gceProviderID {
+		return "", ErrProviderNotSupported
+	}
+
+	cluster, err := withValuesFiles(cluster, channelConfig)
+	if err != nil {
+		return "", err
+	}
+
+	return clusterVersion(cluster, channelConfig)
+}
+
+// Preflight checks the node pool profiles of the cluster.
+func (p *gceProvisioner) Preflight(cluster *api.Cluster, channelConfig *channel.Config) (*PreflightReport, error) {
+	if cluster.Provider != gceProviderID {
+		return nil, ErrProviderNotSupported
+	}
+
+	report := &PreflightReport{}
+	report.add(preflightCheckProfiles, checkProfiles(path.Join(channelConfig.Path, "cluster"), cluster))
+	return report, nil
+}
+
+// Provision creates or updates the managed instance groups of all node pools
+// of the cluster and replaces their outdated instances. A failing node pool
+// doesn't prevent the remaining node pools from being provisioned.
+func (p *gceProvisioner) Provision(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	if cluster.Provider != gceProviderID {
+		return ErrProviderNotSupported
+	}
+
+	cluster, err := withValuesFiles(cluster, channelConfig)
+	if err != nil {
+		return err
+	}
+
+	err = validateConfigItems(cluster, channelConfig)
+	if err != nil {
+		return err
+	}
+
+	logger := log.WithField("cluster", cluster.Alias)
+
+	project, err := gceProject(cluster)
+	if err != nil {
+		return err
+	}
+
+	kubeletSecret, ok := cluster.ConfigItems[workerSharedSecretConfigItemKey]
+	if !ok {
+		return fmt.Errorf("'%s' config item is missing, must be defined", workerSharedSecretConfigItemKey)
+	}
+
+	_, version, err := splitStackName(cluster.LocalID)
+	if err != nil {
+		return err
+	}
+
+	config, err := userDataConfig(cluster.LocalID, version, kubeletSecret, cluster)
+	if err != nil {
+		return err
+	}
+
+	err = checkSchedulableNodePools(cluster)
+	if err != nil {
+		return err
+	}
+
+	policy, err := newBlastRadiusPolicy(cluster)
+	if err != nil {
+		return err
+	}
+
+	// new clusters don't have outdated instances to replace and a
+	// disaster recovery doesn't depend on the API server.
+	var updater updatestrategy.UpdateStrategy
+	var kubeconfig *kubernetes.Kubeconfig
+	if !p.applyOnly && !p.disasterRecovery && cluster.LifecycleStatus != models.ClusterLifecycleStatusRequested {
+		// there's no AWS session for GCP clusters, so only the
+		// kubeconfig providers not reading from AWS can be used.
+		kubeconfig, err = p.kubeconfigs.Kubeconfig(cluster, nil)
+		if err != nil {
+			return err
+		}
+
+		updater, err = p.updater(logger, cluster, project, kubeconfig)
+		if err != nil {
+			return err
+		}
+	}
+
+	// the Job hooks of new clusters fail, as their API server isn't
+	// available before the node pools are provisioned.
+	nodePoolHooks := newNodePoolHookRunner(logger, channelConfig, cluster, kubeconfig, p.dryRun)
+
+	var nodePoolErrs NodePoolErrors
+	for _, nodePool := range cluster.NodePools {
+		var templateName string
+		err := nodePoolHooks.run(ctx, nodePoolHookPhasePreProvision, nodePool)
+		if err == nil {
+			templateName, err = p.provisionNodePool(ctx, logger, cluster, nodePool, channelConfig, config, project)
+		}
+		if err == nil && updater != nil && !p.dryRun {
+			api.ReportProgress(ctx, api.ProgressStepNodePoolUpdate, nodePool.Name, fmt.Sprintf("Updating node pool %s", nodePool.Name))
+			err = updateNodePool(ctx, logger, updater, policy, nodePool, p.dryRun)
+		}
+		if err == nil {
+			err = nodePoolHooks.run(ctx, nodePoolHookPhasePostProvision, nodePool)
+		}
+		if err == updatestrategy.ErrRolloutIncomplete || err == updatestrategy.ErrUpdatePaused {
+			logger.Infof("Update of node pool %s continues later: %v", nodePool.Name, err)
+			nodePoolErrs = append(nodePoolErrs, newNodePoolError(nodePool.Name, err))
+			continue
+		}
+		if err != nil {
+			logger.Errorf("Failed to provision node pool %s: %v", nodePool.Name, err)
+			nodePoolErrs = append(nodePoolErrs, newNodePoolError(nodePool.Name, err))
+			continue
+		}
+		if !p.dryRun {
+			setNodePoolStatus(cluster, nodePool, templateName, "")
+		}
+	}
+
+	if len(nodePoolErrs) > 0 {
+		return nodePoolErrs
+	}
+
+	if p.dryRun {
+		return nil
+	}
+
+	// the state of removed node pools isn't needed anymore.
+	nodePools := make([]string, 0, len(cluster.NodePools))
+	for _, nodePool := range cluster.NodePools {
+		nodePools = append(nodePools, nodePool.Name)
+	}
+	return gce.PruneNodePoolMetadata(ctx, p.compute, project, cluster.LocalID, nodePools)
+}
+
+// gceProject returns the project of the cluster from its infrastructure
+// account.
+func gceProject(cluster *api.Cluster) (string, error) {
+	project := strings.TrimPrefix(cluster.InfrastructureAccount, gceAccountPrefix)
+	if project == cluster.InfrastructureAccount || project == "" {
+		return "", fmt.Errorf("invalid GCP infrastructure account '%s'", cluster.InfrastructureAccount)
+	}
+	return project, nil
+}
+
+// updater returns the updater of the node pools of the cluster. The node pool
+// backend keeps its drain statistics, bootstrap failures and rollout progress
+// in the project metadata, such that they outlive a single provisioning run.
+func (p *gceProvisioner) updater(logger *log.Entry, cluster *api.Cluster, project string, kubeconfig *kubernetes.Kubeconfig) (updatestrategy.UpdateStrategy, error) {
+	updateStrategy, err := updateStrategyConfig(cluster, p.updateStrategy)
+	if err != nil {
+		return nil, err
+	}
+
+	backend := updatestrategy.NewMIGNodePoolsBackend(p.compute, project, cluster.Region, cluster.LocalID)
+
+	// dry runs never update the nodes, so they don't need to change any
+	// resources in the cluster.
+	return newNodePoolUpdater(logger, updateStrategy, kubeconfig, backend, p.dryRun)
+}
+
+// provisionNodePool creates the instance template of the node pool if it
+// doesn't exist yet and creates or updates its managed instance group to use
+// the template. It returns the name of the instance template.
+func (p *gceProvisioner) provisionNodePool(ctx context.Context, logger *log.Entry, cluster *api.Cluster, nodePool *api.NodePool, channelConfig *channel.Config, config map[string]string, project string) (string, error) {
+	basePath := path.Join(channelConfig.Path, "cluster")
+	name := gce.InstanceGroupManagerName(cluster.LocalID, nodePool.Name)
+
+	api.ReportProgress(ctx, api.ProgressStepRendering, nodePool.Name, fmt.Sprintf("Rendering instance template of node pool %s", nodePool.Name))
+	template, err := gceNodePoolInstanceTemplate(cluster, nodePool, basePath, config)
+	if err != nil {
+		return "", err
+	}
+
+	if p.dryRun {
+		logger.Infof("Dry run: skipping instance template %s and managed instance group %s of node pool %s", template.Name, name, nodePool.Name)
+		return "", nil
+	}
+
+	_, err = p.compute.GetInstanceTemplate(ctx, project, template.Name)
+	if gce.IsNotFound(err) {
+		logger.Infof("Creating instance template %s for node pool %s", template.Name, nodePool.Name)
+		err = p.wait(ctx, func() (*gce.Operation, error) {
+			return p.compute.InsertInstanceTemplate(ctx, project, template)
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+
+	templateURL := gce.InstanceTemplateURL(project, template.Name)
+
+	manager, err := p.compute.GetInstanceGroupManager(ctx, project, cluster.Region, name)
+	if gce.IsNotFound(err) {
+		logger.Infof("Creating managed instance group %s for node pool %s", name, nodePool.Name)
+		return template.Name, p.wait(ctx, func() (*gce.Operation, error) {
+			return p.compute.InsertInstanceGroupManager(ctx, project, cluster.Region, &gce.InstanceGroupManager{
+				Name:             name,
+				BaseInstanceName: name,
+				InstanceTemplate: templateURL,
+				TargetSize:       nodePool.MinSize,
+			})
+		})
+	}
+	if err != nil {
+		return "", err
+	}
+
+	if !gce.SameInstanceTemplate(manager.InstanceTemplate, templateURL) {
+		logger.Infof("Updating managed instance group %s to instance template %s", name, template.Name)
+		err = p.wait(ctx, func() (*gce.Operation, error) {
+			return p.compute.SetInstanceTemplate(ctx, project, cluster.Region, name, templateURL)
+		})
+		if err != nil {
+			return "", err
+		}
+	}
+
+	// keep the target size within the limits of the node pool.
+	size := manager.TargetSize
+	if size < nodePool.MinSize {
+		size = nodePool.MinSize
+	}
+	if size > nodePool.MaxSize {
+		size = nodePool.MaxSize
+	}
+	if size != manager.TargetSize {
+		logger.Infof("Resizing managed instance group %s from %d to %d", name, manager.TargetSize, size)
+		return template.Name, p.wait(ctx, func() (*gce.Operation, error) {
+			return p.compute.Resize(ctx, project, cluster.Region, name, size)
+		})
+	}
+
+	return template.Name, nil
+}
+
+// wait starts an operation and waits for it to finish.
+func (p *gceProvisioner) wait(ctx context.Context, start func() (*gce.Operation, error)) error {
+	operation, err := start()
+	if err != nil {
+		return err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, maxWaitTimeout)
+	defer cancel()
+	return p.compute.WaitOperation(waitCtx, operation)
+}
+
+// gceNodePoolInstanceTemplate returns the instance template of the node pool
+// based on the instance properties of its profile. Instance templates are
+// immutable, so the name includes a hash of the properties.
+func gceNodePoolInstanceTemplate(cluster *api.Cluster, nodePool *api.NodePool, basePath string, config map[string]string) (*gce.InstanceTemplate, error) {
+	role := "worker"
+	if strings.HasPrefix(nodePool.Profile, "master") {
+		role = "master"
+	}
+
+	userData, _, err := renderNodePoolUserData(basePath, role, nodePool, nodePoolUserDataConfig(config, nodePool), cluster.ConfigValues, platform.GCE)
+	if err != nil {
+		return nil, err
+	}
+
+	propertiesPath := path.Join(basePath, "node-pools", nodePool.Profile, gceInstanceTemplate)
+	data, err := readProfileJSON(basePath, nodePool.Profile, gceInstanceTemplate)
+	if err != nil {
+		return nil, err
+	}
+
+	var properties map[string]interface{}
+	err = json.Unmarshal(data, &properties)
+	if err != nil {
+		return nil, fmt.Errorf("invalid instance template %s: %v", propertiesPath, err)
+	}
+
+	properties["machineType"] = nodePool.InstanceType
+
+	labels, _ := properties["labels"].(map[string]interface{})
+	if labels == nil {
+		labels = make(map[string]interface{})
+	}
+	labels["cluster"] = gceLabelValue(cluster.LocalID)
+	labels["node-pool"] = gceLabelValue(nodePool.Name)
+	labels["profile"] = gceLabelValue(nodePool.Profile)
+	properties["labels"] = labels
+
+	metadata, _ := properties["metadata"].(map[string]interface{})
+	if metadata == nil {
+		metadata = make(map[string]interface{})
+	}
+	items, _ := metadata["items"].([]interface{})
+	// Windows instances run a startup script instead of ignition.
+	userDataKey := gceUserDataMetadataKey
+	if nodePoolOS(nodePool) == osWindows {
+		userDataKey = gceWindowsStartupScriptMetadataKey
+	}
+	metadata["items"] = append(items, map[string]interface{}{"key": userDataKey, "value": userData})
+	properties["metadata"] = metadata
+
+	strategy, err := nodePoolDiscountStrategy(nodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	// spot VMs aren't bid for, so the max price of the strategy doesn't
+	// apply.
+	if strategy.spot() {
+		scheduling, _ := properties["scheduling"].(map[string]interface{})
+		if scheduling == nil {
+			scheduling = make(map[string]interface{})
+		}
+		scheduling["provisioningModel"] = "SPOT"
+		scheduling["instanceTerminationAction"] = "DELETE"
+		properties["scheduling"] = scheduling
+	}
+
+	encoded, err := json.Marshal(properties)
+	if err != nil {
+		return nil, err
+	}
+	hash := sha1.Sum(encoded)
+
+	return &gce.InstanceTemplate{
+		Name:       fmt.Sprintf("%s-%s", gce.InstanceGroupManagerName(cluster.LocalID, nodePool.Name), hex.EncodeToString(hash[:])[:10]),
+		Properties: properties,
+	}, nil
+}
+
+// gceLabelValue converts a value to a valid GCE label value, which may only
+// contain lowercase letters, digits, underscores and dashes.
+func gceLabelValue(value string) string {
+	value = strings.Map(func(r rune) rune {
+		switch {
+		case r >= 'a' && r <= 'z', r >= '0' && r <= '9', r == '_', r == '-':
+			return r
+		case r >= 'A' && r <= 'Z':
+			return r - 'A' + 'a'
+		default:
+			return '-'
+		}
+	}, value)
+
+	if len(value) > gceMaxLabelLength {
+		value = value[:gceMaxLabelLength]
+	}
+	return value
+}
+
+// Decommission deletes the managed instance groups and instance templates of
+// all node pools of the cluster and the state of the node pools kept in the
+// project metadata. Resources which don't exist are skipped, such that a
+// failed decommission can be retried.
+func (p *gceProvisioner) Decommission(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	if cluster.Provider != gceProviderID {
+		return ErrProviderNotSupported
+	}
+
+	project, err := gceProject(cluster)
+	if err != nil {
+		return err
+	}
+
+	logger := log.WithField("cluster", cluster.Alias)
+	for _, nodePool := range cluster.NodePools {
+		name := gce.InstanceGroupManagerName(cluster.LocalID, nodePool.Name)
+		if p.dryRun {
+			logger.Infof("Dry run: skipping deletion of managed instance group %s of node pool %s", name, nodePool.Name)
+			continue
+		}
+
+		logger.Infof("Deleting managed instance group %s of node pool %s", name, nodePool.Name)
+		err := p.wait(ctx, func() (*gce.Operation, error) {
+			return p.compute.DeleteInstanceGroupManager(ctx, project, cluster.Region, name)
+		})
+		if err != nil && !gce.IsNotFound(err) {
+			return err
+		}
+
+		templates, err := p.compute.ListInstanceTemplates(ctx, project, name+"-")
+		if err != nil {
+			return err
+		}
+
+		for _, template := range templates {
+			logger.Infof("Deleting instance template %s of node pool %s", template, nodePool.Name)
+			err := p.wait(ctx, func() (*gce.Operation, error) {
+				return p.compute.DeleteInstanceTemplate(ctx, project, template)
+			})
+			if err != nil && !gce.IsNotFound(err) {
+				return err
+			}
+		}
+	}
+
+	if p.dryRun {
+		return nil
+	}
+
+	return gce.PruneNodePoolMetadata(ctx, p.compute, project, cluster.LocalID, nil)
+}
+
+// Suspend resizes the managed instance groups of all node pools of the
+// cluster to zero. The target sizes are stored in the project metadata, such
+// that Resume can restore them. The size of a node pool which is already
+// suspended isn't overwritten when a suspension is retried.
+func (p *gceProvisioner) Suspend(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	if cluster.Provider != gceProviderID {
+		return ErrProviderNotSupported
+	}
+
+	project, err := gceProject(cluster)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := p.compute.GetProjectMetadata(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	logger := log.WithField("cluster", cluster.Alias)
+	for _, nodePool := range cluster.NodePools {
+		name := gce.InstanceGroupManagerName(cluster.LocalID, nodePool.Name)
+		manager, err := p.compute.GetInstanceGroupManager(ctx, project, cluster.Region, name)
+		if gce.IsNotFound(err) {
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		if p.dryRun {
+			logger.Infof("Dry run: skipping suspension of managed instance group %s with size %d", name, manager.TargetSize)
+			continue
+		}
+
+		key := gce.NodePoolMetadataKey(cluster.LocalID, nodePool.Name, gceSuspendedSizeMetadata)
+		if _, ok := metadata.Value(key); !ok {
+			logger.Infof("Suspending managed instance group %s with size %d", name, manager.TargetSize)
+			err := gce.UpdateProjectMetadata(ctx, p.compute, project, func(items map[string]string) {
+				items[key] = strconv.FormatInt(manager.TargetSize, 10)
+			})
+			if err != nil {
+				return err
+			}
+		}
+
+		err = p.wait(ctx, func() (*gce.Operation, error) {
+			return p.compute.Resize(ctx, project, cluster.Region, name, 0)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Resume restores the managed instance groups of all node pools of a
+// suspended cluster to their sizes from before the cluster was suspended.
+// Node pools which aren't suspended are left untouched.
+func (p *gceProvisioner) Resume(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	if cluster.Provider != gceProviderID {
+		return ErrProviderNotSupported
+	}
+
+	project, err := gceProject(cluster)
+	if err != nil {
+		return err
+	}
+
+	metadata, err := p.compute.GetProjectMetadata(ctx, project)
+	if err != nil {
+		return err
+	}
+
+	logger := log.WithField("cluster", cluster.Alias)
+	for _, nodePool := range cluster.NodePools {
+		name := gce.InstanceGroupManagerName(cluster.LocalID, nodePool.Name)
+		key := gce.NodePoolMetadataKey(cluster.LocalID, nodePool.Name, gceSuspendedSizeMetadata)
+		value, ok := metadata.Value(key)
+		if !ok {
+			continue
+		}
+
+		size, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid suspended size %q of managed instance group %s: %v", value, name, err)
+		}
+
+		if p.dryRun {
+			logger.Infof("Dry run: skipping resumption of managed instance group %s with size %d", name, size)
+			continue
+		}
+
+		logger.Infof("Resuming managed instance group %s with size %d", name, size)
+		err = p.wait(ctx, func() (*gce.Operation, error) {
+			return p.compute.Resize(ctx, project, cluster.Region, name, size)
+		})
+		if err != nil && !gce.IsNotFound(err) {
+			return err
+		}
+
+		err = gce.UpdateProjectMetadata(ctx, p.compute, project, func(items map[string]string) {
+			delete(items, key)
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Reconcile does nothing for GCP clusters, the startup taint is only removed
+// from the nodes of AWS clusters.
+func (p *gceProvisioner) Reconcile(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	if cluster.Provider != gceProviderID {
+		return ErrProviderNotSupported
+	}
+
+	return nil
+}
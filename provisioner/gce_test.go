@@ -0,0 +1,278 @@
+package provisioner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/cluster-registry/models"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/gce"
+)
+
+const testGCEInstanceTemplate = `{
+  "labels": {"team": "teapot"},
+  "disks": [{"boot": true, "initializeParams": {"diskSizeGb": "50"}}]
+}`
+
+type computeAPIStub struct {
+	gce.ComputeAPI
+	templates        map[string]*gce.InstanceTemplate
+	managers         map[string]*gce.InstanceGroupManager
+	setTemplates     []string
+	resized          []int64
+	insertedManagers []*gce.InstanceGroupManager
+	metadata         gce.Metadata
+}
+
+func (c *computeAPIStub) GetInstanceTemplate(ctx context.Context, project, name string) (*gce.InstanceTemplate, error) {
+	if template, ok := c.templates[name]; ok {
+		return template, nil
+	}
+	return nil, &gce.Error{Code: 404, Message: "not found"}
+}
+
+func (c *computeAPIStub) InsertInstanceTemplate(ctx context.Context, project string, template *gce.InstanceTemplate) (*gce.Operation, error) {
+	c.templates[template.Name] = template
+	return &gce.Operation{}, nil
+}
+
+func (c *computeAPIStub) GetInstanceGroupManager(ctx context.Context, project, region, name string) (*gce.InstanceGroupManager, error) {
+	if manager, ok := c.managers[name]; ok {
+		return manager, nil
+	}
+	return nil, &gce.Error{Code: 404, Message: "not found"}
+}
+
+func (c *computeAPIStub) InsertInstanceGroupManager(ctx context.Context, project, region string, manager *gce.InstanceGroupManager) (*gce.Operation, error) {
+	c.insertedManagers = append(c.insertedManagers, manager)
+	return &gce.Operation{}, nil
+}
+
+func (c *computeAPIStub) SetInstanceTemplate(ctx context.Context, project, region, name, instanceTemplate string) (*gce.Operation, error) {
+	c.setTemplates = append(c.setTemplates, instanceTemplate)
+	return &gce.Operation{}, nil
+}
+
+func (c *computeAPIStub) Resize(ctx context.Context, project, region, name string, size int64) (*gce.Operation, error) {
+	c.resized = append(c.resized, size)
+	return &gce.Operation{}, nil
+}
+
+func (c *computeAPIStub) ListInstanceTemplates(ctx context.Context, project, prefix string) ([]string, error) {
+	var names []string
+	for name := range c.templates {
+		if strings.HasPrefix(name, prefix) {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+func (c *computeAPIStub) DeleteInstanceTemplate(ctx context.Context, project, name string) (*gce.Operation, error) {
+	delete(c.templates, name)
+	return &gce.Operation{}, nil
+}
+
+func (c *computeAPIStub) DeleteInstanceGroupManager(ctx context.Context, project, region, name string) (*gce.Operation, error) {
+	if _, ok := c.managers[name]; !ok {
+		return nil, &gce.Error{Code: 404, Message: "not found"}
+	}
+	delete(c.managers, name)
+	return &gce.Operation{}, nil
+}
+
+func (c *computeAPIStub) GetProjectMetadata(ctx context.Context, project string) (*gce.Metadata, error) {
+	metadata := c.metadata
+	return &metadata, nil
+}
+
+func (c *computeAPIStub) SetProjectMetadata(ctx context.Context, project string, metadata *gce.Metadata) (*gce.Operation, error) {
+	c.metadata = *metadata
+	return &gce.Operation{}, nil
+}
+
+func (c *computeAPIStub) WaitOperation(ctx context.Context, operation *gce.Operation) error {
+	return nil
+}
+
+func testGCEChannel(t *testing.T) string {
+	dir, err := ioutil.TempDir("", "gce")
+	require.NoError(t, err)
+
+	profileDir := path.Join(dir, "cluster", "node-pools", "worker-default")
+	require.NoError(t, os.MkdirAll(profileDir, 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "cluster", "userdata-worker.yaml"), []byte("#cloud-config\npool: {{NODE_POOL}}\n"), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(profileDir, gceInstanceTemplate), []byte(testGCEInstanceTemplate), 0644))
+	return dir
+}
+
+func testGCECluster() *api.Cluster {
+	return &api.Cluster{
+		ID:                    "gcp:foo:europe-west1:kube-1",
+		LocalID:               "kube-1",
+		InfrastructureAccount: "gcp:foo",
+		APIServerURL:          "https://kube-1.foo.example.org/",
+		Provider:              gceProviderID,
+		Region:                "europe-west1",
+		LifecycleStatus:       models.ClusterLifecycleStatusRequested,
+		ConfigItems: map[string]string{
+			"worker_shared_secret": "secret",
+		},
+		NodePools: []*api.NodePool{
+			{
+				Name:         "default",
+				Profile:      "worker-default",
+				InstanceType: "n2-standard-4",
+				MinSize:      3,
+				MaxSize:      20,
+			},
+		},
+	}
+}
+
+func TestGCENodePoolInstanceTemplate(t *testing.T) {
+	dir := testGCEChannel(t)
+	defer os.RemoveAll(dir)
+
+	cluster := testGCECluster()
+	nodePool := cluster.NodePools[0]
+	basePath := path.Join(dir, "cluster")
+
+	template, err := gceNodePoolInstanceTemplate(cluster, nodePool, basePath, map[string]string{})
+	require.NoError(t, err)
+	assert.Regexp(t, "^kube-1-default-[0-9a-f]{10}$", template.Name)
+	assert.Equal(t, "n2-standard-4", template.Properties["machineType"])
+	assert.Equal(t, map[string]interface{}{"team": "teapot", "cluster": "kube-1", "node-pool": "default", "profile": "worker-default"}, template.Properties["labels"])
+	assert.Equal(t, map[string]interface{}{
+		"items": []interface{}{map[string]interface{}{"key": gceUserDataMetadataKey, "value": "#cloud-config\npool: default\n"}},
+	}, template.Properties["metadata"])
+	assert.NotContains(t, template.Properties, "scheduling")
+
+	// a changed configuration results in a new instance template.
+	nodePool.DiscountStrategy = discountStrategySpotMaxPrice
+	spotTemplate, err := gceNodePoolInstanceTemplate(cluster, nodePool, basePath, map[string]string{})
+	require.NoError(t, err)
+	assert.NotEqual(t, template.Name, spotTemplate.Name)
+	assert.Equal(t, map[string]interface{}{"provisioningModel": "SPOT", "instanceTerminationAction": "DELETE"}, spotTemplate.Properties["scheduling"])
+}
+
+func TestGCEProvision(t *testing.T) {
+	dir := testGCEChannel(t)
+	defer os.RemoveAll(dir)
+
+	compute := &computeAPIStub{
+		templates: make(map[string]*gce.InstanceTemplate),
+		managers:  make(map[string]*gce.InstanceGroupManager),
+	}
+	p := &gceProvisioner{compute: compute}
+
+	cluster := testGCECluster()
+	err := p.Provision(context.Background(), cluster, &channel.Config{Path: dir})
+	require.NoError(t, err)
+	require.Len(t, compute.templates, 1)
+	require.Len(t, cluster.Status.NodePools, 1)
+	assert.Contains(t, compute.templates, cluster.Status.NodePools[0].TemplateHash)
+	require.Len(t, compute.insertedManagers, 1)
+	manager := compute.insertedManagers[0]
+	assert.Equal(t, "kube-1-default", manager.Name)
+	assert.Equal(t, "kube-1-default", manager.BaseInstanceName)
+	assert.Equal(t, int64(3), manager.TargetSize)
+
+	// existing groups are switched to the new template and kept within
+	// the limits of the node pool.
+	compute.managers[manager.Name] = &gce.InstanceGroupManager{
+		Name:             manager.Name,
+		InstanceTemplate: gce.InstanceTemplateURL("foo", "kube-1-default-old"),
+		TargetSize:       1,
+	}
+	err = p.Provision(context.Background(), testGCECluster(), &channel.Config{Path: dir})
+	require.NoError(t, err)
+	assert.Equal(t, []string{manager.InstanceTemplate}, compute.setTemplates)
+	assert.Equal(t, []int64{3}, compute.resized)
+	assert.Len(t, compute.insertedManagers, 1)
+
+	// the state of removed node pools is pruned.
+	removed := gce.NodePoolMetadataKey("kube-1", "removed", "drain-stats")
+	compute.metadata.Items = []*gce.MetadataItem{{Key: removed, Value: "1/1s"}}
+	err = p.Provision(context.Background(), testGCECluster(), &channel.Config{Path: dir})
+	require.NoError(t, err)
+	assert.Empty(t, compute.metadata.Items)
+
+	cluster = testGCECluster()
+	cluster.InfrastructureAccount = "aws:123456789012"
+	assert.Error(t, p.Provision(context.Background(), cluster, &channel.Config{Path: dir}))
+
+	cluster.Provider = providerID
+	assert.Equal(t, ErrProviderNotSupported, p.Provision(context.Background(), cluster, &channel.Config{Path: dir}))
+}
+
+func TestGCELabelValue(t *testing.T) {
+	assert.Equal(t, "master-default", gceLabelValue("Master/Default"))
+}
+
+func TestGCEDecommission(t *testing.T) {
+	compute := &computeAPIStub{
+		templates: map[string]*gce.InstanceTemplate{
+			"kube-1-default-0123456789": {Name: "kube-1-default-0123456789"},
+			"kube-1-default-abcdef0123": {Name: "kube-1-default-abcdef0123"},
+			"kube-2-default-0123456789": {Name: "kube-2-default-0123456789"},
+		},
+		managers: map[string]*gce.InstanceGroupManager{
+			"kube-1-default": {Name: "kube-1-default"},
+		},
+		metadata: gce.Metadata{Items: []*gce.MetadataItem{
+			{Key: gce.NodePoolMetadataKey("kube-1", "default", "drain-stats"), Value: "1/1s"},
+		}},
+	}
+	p := &gceProvisioner{compute: compute}
+
+	require.NoError(t, p.Decommission(context.Background(), testGCECluster(), &channel.Config{}))
+	assert.Empty(t, compute.managers)
+	assert.Len(t, compute.templates, 1)
+	assert.Contains(t, compute.templates, "kube-2-default-0123456789")
+	assert.Empty(t, compute.metadata.Items)
+
+	// retrying skips the deleted resources.
+	require.NoError(t, p.Decommission(context.Background(), testGCECluster(), &channel.Config{}))
+}
+
+func TestGCESuspendResume(t *testing.T) {
+	compute := &computeAPIStub{
+		managers: map[string]*gce.InstanceGroupManager{
+			"kube-1-default": {Name: "kube-1-default", TargetSize: 5},
+		},
+	}
+	p := &gceProvisioner{compute: compute}
+	cluster := testGCECluster()
+
+	require.NoError(t, p.Suspend(context.Background(), cluster, &channel.Config{}))
+	assert.Equal(t, []int64{0}, compute.resized)
+	value, ok := compute.metadata.Value(gce.NodePoolMetadataKey("kube-1", "default", gceSuspendedSizeMetadata))
+	require.True(t, ok)
+	assert.Equal(t, "5", value)
+
+	// a retried suspension keeps the size from before the first one.
+	compute.managers["kube-1-default"].TargetSize = 0
+	require.NoError(t, p.Suspend(context.Background(), cluster, &channel.Config{}))
+	value, _ = compute.metadata.Value(gce.NodePoolMetadataKey("kube-1", "default", gceSuspendedSizeMetadata))
+	assert.Equal(t, "5", value)
+
+	require.NoError(t, p.Resume(context.Background(), cluster, &channel.Config{}))
+	assert.Equal(t, []int64{0, 0, 5}, compute.resized)
+	assert.Empty(t, compute.metadata.Items)
+
+	// node pools which aren't suspended are left untouched.
+	require.NoError(t, p.Resume(context.Background(), cluster, &channel.Config{}))
+	assert.Len(t, compute.resized, 3)
+
+	cluster.Provider = providerID
+	assert.Equal(t, ErrProviderNotSupported, p.Suspend(context.Background(), cluster, &channel.Config{}))
+}
@@ -3,9 +3,17 @@ package provisioner
 import (
 	"fmt"
 	"net/url"
+	"regexp"
 	"strings"
 )
 
+// maxStackNameLength is the max length of CloudFormation stack names.
+const maxStackNameLength = 128
+
+// stackNamePattern is the charset of CloudFormation stack names with a Senza
+// version suffix.
+var stackNamePattern = regexp.MustCompile(`^[a-zA-Z][-a-zA-Z0-9]*-[a-zA-Z0-9]+$`)
+
 // parseWebhookID parses the webhookID from a clusterID.
 // This is a hack for the special case of clusterID with localID
 // 'kube-aws-test'.
@@ -46,6 +54,20 @@ func splitStackName(stackName string) (string, string, error) {
 	return stackName[0:split], stackName[split+1:], nil
 }
 
+// validateStackName checks that a stackName is a valid CloudFormation stack
+// name which can be split into a Senza stack and version.
+func validateStackName(stackName string) error {
+	if len(stackName) > maxStackNameLength {
+		return fmt.Errorf("stack name %s is longer than %d characters", stackName, maxStackNameLength)
+	}
+
+	if !stackNamePattern.MatchString(stackName) {
+		return fmt.Errorf("invalid stack name %s: must match %s", stackName, stackNamePattern)
+	}
+
+	return nil
+}
+
 // getHostedZone gets derrive hosted zone from an APIServerURL.
 func getHostedZone(APIServerURL string) (string, error) {
 	url, err := url.Parse(APIServerURL)
@@ -0,0 +1,33 @@
+package provisioner
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateStackName(t *testing.T) {
+	for _, tc := range []struct {
+		stackName string
+		valid     bool
+	}{
+		{stackName: "kube-1", valid: true},
+		{stackName: "kube-aws-test-1", valid: true},
+		{stackName: "kube-" + strings.Repeat("a", 123), valid: true},
+		{stackName: "kube-" + strings.Repeat("a", 124), valid: false},
+		{stackName: "kube", valid: false},
+		{stackName: "1kube-1", valid: false},
+		{stackName: "kube_test-1", valid: false},
+		{stackName: "kube-", valid: false},
+	} {
+		t.Run(tc.stackName, func(t *testing.T) {
+			err := validateStackName(tc.stackName)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
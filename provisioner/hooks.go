@@ -0,0 +1,132 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"os/exec"
+	"strings"
+	"time"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// hookPhaseVeto asks the hooks whether the cluster may be updated.
+	hookPhaseVeto = "veto"
+	// hookPhaseStackTemplate passes the rendered cluster stack template to
+	// the hooks.
+	hookPhaseStackTemplate = "stack-template"
+	// hookPhaseUserData passes the rendered userdata of a node pool to the
+	// hooks.
+	hookPhaseUserData = "userdata"
+
+	// hookTimeout is the time a hook may run before it's killed.
+	hookTimeout = 1 * time.Minute
+)
+
+// hookRequest is written as JSON to the stdin of a hook.
+type hookRequest struct {
+	Phase    string       `json:"phase"`
+	Cluster  *api.Cluster `json:"cluster"`
+	NodePool string       `json:"node_pool,omitempty"`
+	Content  string       `json:"content,omitempty"`
+}
+
+// hookResponse is read as JSON from the stdout of a hook. Empty output leaves
+// the content unchanged and doesn't veto the update.
+type hookResponse struct {
+	// Content replaces the content of the request if set.
+	Content *string `json:"content,omitempty"`
+	// Veto blocks the update of the cluster.
+	Veto   bool   `json:"veto,omitempty"`
+	Reason string `json:"reason,omitempty"`
+}
+
+type hookVetoError struct {
+	hook   string
+	reason string
+}
+
+func (e *hookVetoError) Error() string {
+	return fmt.Sprintf("update vetoed by hook %s: %s", e.hook, e.reason)
+}
+
+// provisionerHooks are the paths of executables extending the provisioning of
+// the clusters. The hooks are run in order, each one gets the content returned
+// by the previous one.
+type provisionerHooks []string
+
+// veto returns an error if any of the hooks vetoes the update of the cluster.
+func (h provisionerHooks) veto(ctx context.Context, cluster *api.Cluster) error {
+	for _, hook := range h {
+		response, err := runHook(ctx, hook, &hookRequest{Phase: hookPhaseVeto, Cluster: cluster})
+		if err != nil {
+			return err
+		}
+
+		if response.Veto {
+			return &hookVetoError{hook: hook, reason: response.Reason}
+		}
+	}
+	return nil
+}
+
+// mutate passes the content rendered in phase through the hooks and returns
+// the resulting content.
+func (h provisionerHooks) mutate(ctx context.Context, phase string, cluster *api.Cluster, nodePool, content string) (string, error) {
+	for _, hook := range h {
+		response, err := runHook(ctx, hook, &hookRequest{
+			Phase:    phase,
+			Cluster:  cluster,
+			NodePool: nodePool,
+			Content:  content,
+		})
+		if err != nil {
+			return "", err
+		}
+
+		if response.Veto {
+			return "", &hookVetoError{hook: hook, reason: response.Reason}
+		}
+
+		if response.Content != nil {
+			content = *response.Content
+		}
+	}
+	return content, nil
+}
+
+// runHook runs the hook with the request on stdin and parses its response.
+func runHook(ctx context.Context, hook string, request *hookRequest) (*hookResponse, error) {
+	input, err := json.Marshal(request)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, hookTimeout)
+	defer cancel()
+
+	var stdout, stderr bytes.Buffer
+	cmd := exec.CommandContext(ctx, hook, request.Phase)
+	cmd.Stdin = bytes.NewReader(input)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	err = cmd.Run()
+	if err != nil {
+		return nil, fmt.Errorf("hook %s failed in phase %s: %v: %s", hook, request.Phase, err, strings.TrimSpace(stderr.String()))
+	}
+
+	var response hookResponse
+	if len(bytes.TrimSpace(stdout.Bytes())) == 0 {
+		return &response, nil
+	}
+
+	err = json.Unmarshal(stdout.Bytes(), &response)
+	if err != nil {
+		return nil, fmt.Errorf("invalid response of hook %s in phase %s: %v", hook, request.Phase, err)
+	}
+	return &response, nil
+}
@@ -0,0 +1,72 @@
+package provisioner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func writeHook(t *testing.T, dir, name, script string) string {
+	hook := path.Join(dir, name)
+	err := ioutil.WriteFile(hook, []byte("#!/bin/sh\n"+script), 0755)
+	require.NoError(t, err)
+	return hook
+}
+
+func TestProvisionerHooksMutate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hooks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cluster := &api.Cluster{ID: "aws:123456789012:eu-central-1:kube-1"}
+
+	hooks := provisionerHooks{
+		writeHook(t, dir, "noop", "cat > /dev/null\n"),
+		writeHook(t, dir, "replace", `grep -q '"node_pool":"default"' && echo '{"content": "replaced"}'`+"\n"),
+		writeHook(t, dir, "append", `sed -e 's/.*"content":"\([^"]*\)".*/{"content": "\1 appended"}/'`+"\n"),
+	}
+
+	content, err := hooks.mutate(context.Background(), hookPhaseUserData, cluster, "default", "original")
+	require.NoError(t, err)
+	assert.Equal(t, "replaced appended", content)
+
+	content, err = provisionerHooks(nil).mutate(context.Background(), hookPhaseUserData, cluster, "default", "original")
+	require.NoError(t, err)
+	assert.Equal(t, "original", content)
+
+	failing := provisionerHooks{writeHook(t, dir, "failing", "echo broken >&2\nexit 1\n")}
+	_, err = failing.mutate(context.Background(), hookPhaseStackTemplate, cluster, "", "template")
+	assert.Error(t, err)
+	assert.Contains(t, err.Error(), "broken")
+
+	invalid := provisionerHooks{writeHook(t, dir, "invalid", "echo invalid\n")}
+	_, err = invalid.mutate(context.Background(), hookPhaseStackTemplate, cluster, "", "template")
+	assert.Error(t, err)
+}
+
+func TestProvisionerHooksVeto(t *testing.T) {
+	dir, err := ioutil.TempDir("", "hooks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cluster := &api.Cluster{ID: "aws:123456789012:eu-central-1:kube-1"}
+
+	allowing := provisionerHooks{writeHook(t, dir, "allowing", `test "$1" = veto && echo '{"veto": false}'`+"\n")}
+	assert.NoError(t, allowing.veto(context.Background(), cluster))
+
+	vetoing := provisionerHooks{writeHook(t, dir, "vetoing", `echo '{"veto": true, "reason": "change freeze"}'`+"\n")}
+	err = vetoing.veto(context.Background(), cluster)
+	require.Error(t, err)
+	assert.Equal(t, "update vetoed by hook "+vetoing[0]+": change freeze", err.Error())
+
+	category, retryable := classifyError(err)
+	assert.Equal(t, ErrorCategoryPolicy, category)
+	assert.False(t, retryable)
+}
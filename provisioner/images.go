@@ -0,0 +1,186 @@
+package provisioner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ssm"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// nodePoolImageTagPrefix is the prefix of the stack tags recording the AMI
+// resolved for a node pool, followed by the name of the node pool.
+const nodePoolImageTagPrefix = "cluster-lifecycle-manager.zalando.org/image."
+
+// ec2ImageArchitectures maps the architectures of node pools to the ones of
+// AMIs. The vendored SDK predates arm64 AMIs, so it lacks a constant for
+// them.
+var ec2ImageArchitectures = map[string]string{
+	"amd64": ec2.ArchitectureValuesX8664,
+	"arm64": "arm64",
+}
+
+// validateImage validates the image source of a node pool: either an SSM
+// parameter or an image filter with the owner of the images.
+func validateImage(nodePool *api.NodePool) error {
+	image := nodePool.Image
+	if image == nil {
+		return nil
+	}
+
+	switch {
+	case image.SSMParameter != "" && image.Name != "":
+		return fmt.Errorf("image of node pool %s must have either an ssm_parameter or a name filter, not both", nodePool.Name)
+	case image.SSMParameter != "":
+		if !strings.HasPrefix(image.SSMParameter, "/") {
+			return fmt.Errorf("invalid image ssm_parameter %s of node pool %s, must be a path", image.SSMParameter, nodePool.Name)
+		}
+		if image.Owner != "" || image.Architecture != "" {
+			return fmt.Errorf("image of node pool %s can't combine an ssm_parameter with owner or architecture filters", nodePool.Name)
+		}
+	case image.Name != "":
+		// without an owner anyone could publish a matching AMI.
+		if image.Owner == "" {
+			return fmt.Errorf("image name filter of node pool %s requires an owner", nodePool.Name)
+		}
+	default:
+		return fmt.Errorf("image of node pool %s must have an ssm_parameter or a name filter", nodePool.Name)
+	}
+
+	return nil
+}
+
+// imageArchitecture returns the AMI architecture of the image of a node pool,
+// by default the architecture of the node pool.
+func imageArchitecture(nodePool *api.NodePool) (string, error) {
+	if nodePool.Image.Architecture != "" {
+		return nodePool.Image.Architecture, nil
+	}
+
+	arch, ok := ec2ImageArchitectures[nodePoolArchitecture(nodePool)]
+	if !ok {
+		return "", fmt.Errorf("no AMI architecture for architecture %s of node pool %s", nodePoolArchitecture(nodePool), nodePool.Name)
+	}
+	return arch, nil
+}
+
+// resolveImage returns the ID of the AMI selected by the image source of the
+// node pool: the value of its SSM parameter or the most recent available AMI
+// matching its filter.
+func (a *awsAdapter) resolveImage(nodePool *api.NodePool) (string, error) {
+	image := nodePool.Image
+	if image.SSMParameter != "" {
+		resp, err := a.ssmClient.GetParameter(&ssm.GetParameterInput{
+			Name:           aws.String(image.SSMParameter),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to resolve the image of node pool %s from SSM parameter %s: %v", nodePool.Name, image.SSMParameter, err)
+		}
+
+		imageID := aws.StringValue(resp.Parameter.Value)
+		if !strings.HasPrefix(imageID, "ami-") {
+			return "", fmt.Errorf("SSM parameter %s of node pool %s contains no AMI ID: %s", image.SSMParameter, nodePool.Name, imageID)
+		}
+		return imageID, nil
+	}
+
+	arch, err := imageArchitecture(nodePool)
+	if err != nil {
+		return "", err
+	}
+
+	resp, err := a.ec2Client.DescribeImages(&ec2.DescribeImagesInput{
+		Owners: []*string{aws.String(image.Owner)},
+		Filters: []*ec2.Filter{
+			{Name: aws.String("name"), Values: []*string{aws.String(image.Name)}},
+			{Name: aws.String("architecture"), Values: []*string{aws.String(arch)}},
+			{Name: aws.String("state"), Values: []*string{aws.String(ec2.ImageStateAvailable)}},
+		},
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to resolve the image of node pool %s: %v", nodePool.Name, err)
+	}
+
+	if len(resp.Images) == 0 {
+		return "", fmt.Errorf("no %s image of owner %s matching %s found for node pool %s", arch, image.Owner, image.Name, nodePool.Name)
+	}
+
+	// the creation dates are ISO 8601 timestamps in UTC, which sort
+	// chronologically as strings. Ties are broken by the name.
+	images := resp.Images
+	sort.Slice(images, func(i, j int) bool {
+		di, dj := aws.StringValue(images[i].CreationDate), aws.StringValue(images[j].CreationDate)
+		if di != dj {
+			return di > dj
+		}
+		return aws.StringValue(images[i].Name) > aws.StringValue(images[j].Name)
+	})
+	return aws.StringValue(images[0].ImageId), nil
+}
+
+// checkImageArchitecture returns an error if the architecture of the AMI
+// doesn't match the architecture of the node pool, such that a mismatch fails
+// the provisioning instead of the nodes failing to join.
+func (a *awsAdapter) checkImageArchitecture(nodePool *api.NodePool, imageID string) error {
+	arch := nodePoolArchitecture(nodePool)
+	expected, ok := ec2ImageArchitectures[arch]
+	if !ok {
+		return fmt.Errorf("no AMI architecture for architecture %s of node pool %s", arch, nodePool.Name)
+	}
+
+	resp, err := a.ec2Client.DescribeImages(&ec2.DescribeImagesInput{
+		ImageIds: []*string{aws.String(imageID)},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to describe image %s of node pool %s: %v", imageID, nodePool.Name, err)
+	}
+
+	if len(resp.Images) != 1 {
+		return fmt.Errorf("image %s of node pool %s not found", imageID, nodePool.Name)
+	}
+
+	if actual := aws.StringValue(resp.Images[0].Architecture); actual != expected {
+		return fmt.Errorf("image %s of node pool %s has architecture %s, the node pool requires %s", imageID, nodePool.Name, actual, expected)
+	}
+	return nil
+}
+
+// imageArgs resolves the AMI of a node pool with an image source and returns
+// its stack parameter prefixed with the given prefix e.g. 'Master' or
+// 'Worker'. The resolved AMI is recorded as a tag of the stacks applied
+// afterwards. No parameter is returned if the node pool doesn't have an image
+// source, such that the stack template selects the AMI. The architecture of
+// the resolved AMI must match the one of the node pool.
+func (a *awsAdapter) imageArgs(prefix string, nodePool *api.NodePool) ([]string, error) {
+	if nodePool.Image == nil {
+		return nil, nil
+	}
+
+	err := validateImage(nodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	imageID, err := a.resolveImage(nodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	err = a.checkImageArchitecture(nodePool, imageID)
+	if err != nil {
+		return nil, err
+	}
+
+	a.logger.Infof("Resolved image %s for node pool %s", imageID, nodePool.Name)
+	if a.imageTags == nil {
+		a.imageTags = make(map[string]string)
+	}
+	a.imageTags[nodePoolImageTagPrefix+nodePool.Name] = imageID
+
+	return []string{fmt.Sprintf("%sImageId=%s", prefix, imageID)}, nil
+}
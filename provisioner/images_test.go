@@ -0,0 +1,163 @@
+package provisioner
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type imageEC2APIStub struct {
+	ec2API
+	images   []*ec2.Image
+	filtered []*ec2.Image
+	input    *ec2.DescribeImagesInput
+}
+
+func (e *imageEC2APIStub) DescribeImages(input *ec2.DescribeImagesInput) (*ec2.DescribeImagesOutput, error) {
+	if len(input.ImageIds) > 0 {
+		var images []*ec2.Image
+		for _, image := range e.images {
+			for _, id := range input.ImageIds {
+				if aws.StringValue(image.ImageId) == aws.StringValue(id) {
+					images = append(images, image)
+				}
+			}
+		}
+		return &ec2.DescribeImagesOutput{Images: images}, nil
+	}
+
+	e.input = input
+	return &ec2.DescribeImagesOutput{Images: e.filtered}, nil
+}
+
+type imageSSMAPIStub struct {
+	ssmAPI
+	parameters map[string]string
+}
+
+func (s *imageSSMAPIStub) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	value, ok := s.parameters[aws.StringValue(input.Name)]
+	if !ok {
+		return nil, fmt.Errorf("parameter %s not found", aws.StringValue(input.Name))
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Value: aws.String(value)}}, nil
+}
+
+func TestValidateImage(t *testing.T) {
+	for _, tc := range []struct {
+		msg   string
+		image *api.Image
+		valid bool
+	}{
+		{
+			msg:   "no image",
+			valid: true,
+		},
+		{
+			msg:   "ssm parameter",
+			image: &api.Image{SSMParameter: "/aws/service/flatcar/stable/amd64/latest/image_id"},
+			valid: true,
+		},
+		{
+			msg:   "image filter",
+			image: &api.Image{Owner: "075585003325", Name: "Flatcar-stable-*"},
+			valid: true,
+		},
+		{
+			msg:   "empty image",
+			image: &api.Image{},
+		},
+		{
+			msg:   "ssm parameter and filter",
+			image: &api.Image{SSMParameter: "/ami", Owner: "075585003325", Name: "Flatcar-stable-*"},
+		},
+		{
+			msg:   "relative ssm parameter",
+			image: &api.Image{SSMParameter: "ami"},
+		},
+		{
+			msg:   "filter without owner",
+			image: &api.Image{Name: "Flatcar-stable-*"},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := validateImage(&api.NodePool{Name: "worker-default", Image: tc.image})
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestImageArgs(t *testing.T) {
+	filtered := []*ec2.Image{
+		{ImageId: aws.String("ami-old"), Name: aws.String("Flatcar-stable-3374.2.0"), CreationDate: aws.String("2022-12-01T10:00:00.000Z"), Architecture: aws.String("arm64")},
+		{ImageId: aws.String("ami-new"), Name: aws.String("Flatcar-stable-3374.2.3"), CreationDate: aws.String("2023-01-10T10:00:00.000Z"), Architecture: aws.String("arm64")},
+	}
+	ec2Client := &imageEC2APIStub{
+		filtered: filtered,
+		images: append([]*ec2.Image{
+			{ImageId: aws.String("ami-ssm"), Architecture: aws.String(ec2.ArchitectureValuesX8664)},
+			{ImageId: aws.String("ami-arm"), Architecture: aws.String("arm64")},
+		}, filtered...),
+	}
+	adapter := &awsAdapter{
+		ec2Client: ec2Client,
+		ssmClient: &imageSSMAPIStub{parameters: map[string]string{
+			"/flatcar/ami": "ami-ssm",
+			"/flatcar/arm": "ami-arm",
+			"/flatcar/bad": "latest",
+		}},
+		logger: log.WithField("test", true),
+	}
+
+	// node pools without an image source use the AMI of the template.
+	args, err := adapter.imageArgs("Worker", &api.NodePool{Name: "worker-default"})
+	require.NoError(t, err)
+	assert.Empty(t, args)
+	assert.Empty(t, adapter.stackTags(""))
+
+	args, err = adapter.imageArgs("Master", &api.NodePool{Name: "master-default", Image: &api.Image{SSMParameter: "/flatcar/ami"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"MasterImageId=ami-ssm"}, args)
+
+	args, err = adapter.imageArgs("Worker", &api.NodePool{Name: "worker-default", Architecture: "arm64", Image: &api.Image{Owner: "075585003325", Name: "Flatcar-stable-*"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"WorkerImageId=ami-new"}, args)
+	assert.Equal(t, []*string{aws.String("075585003325")}, ec2Client.input.Owners)
+	assert.Equal(t, []*string{aws.String("arm64")}, ec2Client.input.Filters[1].Values)
+
+	// the resolved AMIs are recorded as stack tags.
+	assert.Equal(t, map[string]string{
+		nodePoolImageTagPrefix + "master-default": "ami-ssm",
+		nodePoolImageTagPrefix + "worker-default": "ami-new",
+		templateHashTag: "hash",
+	}, adapter.stackTags("hash"))
+
+	// the architecture of the AMI must match the node pool.
+	_, err = adapter.imageArgs("Worker", &api.NodePool{Name: "worker-default", Image: &api.Image{SSMParameter: "/flatcar/arm"}})
+	assert.Error(t, err)
+
+	_, err = adapter.imageArgs("Worker", &api.NodePool{Name: "worker-default", Image: &api.Image{Owner: "075585003325", Name: "Flatcar-stable-*", Architecture: "arm64"}})
+	assert.Error(t, err)
+
+	_, err = adapter.imageArgs("Worker", &api.NodePool{Name: "worker-default", Image: &api.Image{SSMParameter: "/flatcar/bad"}})
+	assert.Error(t, err)
+
+	_, err = adapter.imageArgs("Worker", &api.NodePool{Name: "worker-default", Image: &api.Image{SSMParameter: "/flatcar/missing"}})
+	assert.Error(t, err)
+
+	ec2Client.filtered = nil
+	_, err = adapter.imageArgs("Worker", &api.NodePool{Name: "worker-default", Image: &api.Image{Owner: "075585003325", Name: "Flatcar-beta-*"}})
+	assert.Error(t, err)
+}
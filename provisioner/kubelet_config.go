@@ -0,0 +1,144 @@
+package provisioner
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// kubeletConfigValue is the userdata config value with the kubelet
+	// config drop-in of the node pool, empty if it has no kubelet config.
+	kubeletConfigValue = "NODE_POOL_KUBELET_CONFIG"
+	// kubeletConfigDropInFile is the kubelet config drop-in with the
+	// kubelet config of the node pool. The kubelet merges it into its
+	// config file if it's started with
+	// --config-dir=/etc/kubernetes/kubelet.conf.d.
+	kubeletConfigDropInFile = "/etc/kubernetes/kubelet.conf.d/50-node-pool.conf"
+)
+
+var (
+	// minKubeletConfigDropInVersion is the first kubelet version merging
+	// the config drop-ins by default.
+	minKubeletConfigDropInVersion = kubernetesVersion{major: 1, minor: 30}
+
+	// kubeletQuantityRegexp matches resource quantities like '100m',
+	// '1.5Gi' or '500M'.
+	kubeletQuantityRegexp = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?(m|k|Ki|M|Mi|G|Gi|T|Ti)?$`)
+	// kubeletPercentageRegexp matches eviction thresholds relative to the
+	// capacity, e.g. '10%'.
+	kubeletPercentageRegexp = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?%$`)
+
+	// evictionSignals are the eviction signals of the kubelet.
+	evictionSignals = map[string]bool{
+		"memory.available":   true,
+		"nodefs.available":   true,
+		"nodefs.inodesFree":  true,
+		"imagefs.available":  true,
+		"imagefs.inodesFree": true,
+		"pid.available":      true,
+	}
+	// reservedResources are the resources which can be reserved for the
+	// Kubernetes and system daemons.
+	reservedResources = map[string]bool{
+		"cpu":               true,
+		"memory":            true,
+		"ephemeral-storage": true,
+	}
+)
+
+// validateKubeletConfig returns an error if the kubelet config of the node
+// pool is invalid: the max pods must be positive, the eviction thresholds
+// quantities or percentages of known signals and the reserved resources
+// quantities. Windows nodes don't read the kubelet config drop-ins.
+func validateKubeletConfig(nodePool *api.NodePool) error {
+	config := nodePool.KubeletConfig
+	if config == nil {
+		return nil
+	}
+
+	if nodePoolOS(nodePool) == osWindows {
+		return fmt.Errorf("kubelet_config isn't supported for %s node pool %s", osWindows, nodePool.Name)
+	}
+
+	if config.MaxPods < 0 {
+		return fmt.Errorf("invalid kubelet_config max_pods %d of node pool %s, must be positive", config.MaxPods, nodePool.Name)
+	}
+
+	for signal, threshold := range config.EvictionHard {
+		if !evictionSignals[signal] {
+			return fmt.Errorf("invalid kubelet_config eviction signal %s of node pool %s", signal, nodePool.Name)
+		}
+		if !kubeletQuantityRegexp.MatchString(threshold) && !kubeletPercentageRegexp.MatchString(threshold) {
+			return fmt.Errorf("invalid kubelet_config eviction threshold '%s' of signal %s of node pool %s, must be a quantity or percentage", threshold, signal, nodePool.Name)
+		}
+	}
+
+	for name, reserved := range map[string]map[string]string{"kube_reserved": config.KubeReserved, "system_reserved": config.SystemReserved} {
+		for resource, quantity := range reserved {
+			if !reservedResources[resource] {
+				return fmt.Errorf("invalid kubelet_config %s resource %s of node pool %s, must be cpu, memory or ephemeral-storage", name, resource, nodePool.Name)
+			}
+			if !kubeletQuantityRegexp.MatchString(quantity) {
+				return fmt.Errorf("invalid kubelet_config %s %s '%s' of node pool %s, must be a quantity", name, resource, quantity, nodePool.Name)
+			}
+		}
+	}
+
+	return nil
+}
+
+// checkKubeletConfigVersion returns an error if the kubelet of a node pool
+// with a kubelet config doesn't merge the config drop-ins by default.
+func checkKubeletConfigVersion(nodePool *api.NodePool, kubelet kubernetesVersion) error {
+	if nodePool.KubeletConfig == nil {
+		return nil
+	}
+
+	if kubelet.major < minKubeletConfigDropInVersion.major || (kubelet.major == minKubeletConfigDropInVersion.major && kubelet.minor < minKubeletConfigDropInVersion.minor) {
+		return fmt.Errorf("kubelet_config of node pool %s requires kubelet version %s or newer, got %s", nodePool.Name, minKubeletConfigDropInVersion, kubelet)
+	}
+	return nil
+}
+
+// kubeletConfigDropIn returns the kubelet config drop-in with the kubelet
+// config of a node pool or an empty string if it has none. The maps are
+// sorted by key, such that the userdata only changes with the config.
+func kubeletConfigDropIn(config *api.KubeletConfig) string {
+	if config == nil {
+		return ""
+	}
+
+	var buf bytes.Buffer
+	buf.WriteString("apiVersion: kubelet.config.k8s.io/v1beta1\nkind: KubeletConfiguration\n")
+	if config.MaxPods > 0 {
+		fmt.Fprintf(&buf, "maxPods: %d\n", config.MaxPods)
+	}
+	for _, field := range []struct {
+		name   string
+		values map[string]string
+	}{
+		{"evictionHard", config.EvictionHard},
+		{"kubeReserved", config.KubeReserved},
+		{"systemReserved", config.SystemReserved},
+	} {
+		if len(field.values) == 0 {
+			continue
+		}
+
+		keys := make([]string, 0, len(field.values))
+		for key := range field.values {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		fmt.Fprintf(&buf, "%s:\n", field.name)
+		for _, key := range keys {
+			fmt.Fprintf(&buf, "  %s: %q\n", key, field.values[key])
+		}
+	}
+	return buf.String()
+}
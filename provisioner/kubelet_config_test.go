@@ -0,0 +1,108 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestValidateKubeletConfig(t *testing.T) {
+	for _, tc := range []struct {
+		msg    string
+		os     string
+		config *api.KubeletConfig
+		valid  bool
+	}{
+		{
+			msg:   "no kubelet config",
+			valid: true,
+		},
+		{
+			msg: "kubelet config",
+			config: &api.KubeletConfig{
+				MaxPods:        58,
+				EvictionHard:   map[string]string{"memory.available": "500Mi", "nodefs.available": "10%"},
+				KubeReserved:   map[string]string{"cpu": "100m", "memory": "1.5Gi"},
+				SystemReserved: map[string]string{"ephemeral-storage": "1Gi"},
+			},
+			valid: true,
+		},
+		{
+			msg:    "negative max pods",
+			config: &api.KubeletConfig{MaxPods: -1},
+		},
+		{
+			msg:    "unknown eviction signal",
+			config: &api.KubeletConfig{EvictionHard: map[string]string{"memory.free": "500Mi"}},
+		},
+		{
+			msg:    "invalid eviction threshold",
+			config: &api.KubeletConfig{EvictionHard: map[string]string{"memory.available": "lots"}},
+		},
+		{
+			msg:    "unknown reserved resource",
+			config: &api.KubeletConfig{KubeReserved: map[string]string{"nvidia.com/gpu": "1"}},
+		},
+		{
+			msg:    "percentage of reserved resource",
+			config: &api.KubeletConfig{SystemReserved: map[string]string{"memory": "10%"}},
+		},
+		{
+			msg:    "windows node pool",
+			os:     osWindows,
+			config: &api.KubeletConfig{MaxPods: 58},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := validateKubeletConfig(&api.NodePool{Name: "worker-default", OS: tc.os, KubeletConfig: tc.config})
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestKubeletConfigVersion(t *testing.T) {
+	cluster := &api.Cluster{
+		ConfigItems: map[string]string{"kubernetes_version": "1.30.2", "node_pool_kubelet_versions": "worker-legacy=1.29.6"},
+	}
+	config := &api.KubeletConfig{MaxPods: 58}
+
+	assert.NoError(t, checkNodePoolKubeletVersion(cluster, &api.NodePool{Name: "worker-default", KubeletConfig: config}))
+	assert.NoError(t, checkNodePoolKubeletVersion(cluster, &api.NodePool{Name: "worker-legacy"}))
+	assert.Error(t, checkNodePoolKubeletVersion(cluster, &api.NodePool{Name: "worker-legacy", KubeletConfig: config}))
+}
+
+func TestKubeletConfigUserData(t *testing.T) {
+	config := nodePoolUserDataConfig(map[string]string{}, &api.NodePool{
+		Name: "worker-default",
+		KubeletConfig: &api.KubeletConfig{
+			MaxPods:      58,
+			EvictionHard: map[string]string{"nodefs.available": "10%", "memory.available": "500Mi"},
+			KubeReserved: map[string]string{"cpu": "100m"},
+		},
+	})
+	assert.Equal(t, `apiVersion: kubelet.config.k8s.io/v1beta1
+kind: KubeletConfiguration
+maxPods: 58
+evictionHard:
+  memory.available: "500Mi"
+  nodefs.available: "10%"
+kubeReserved:
+  cpu: "100m"
+`, config[kubeletConfigValue])
+
+	// the config of the cluster doesn't leak into node pools without
+	// kubelet config.
+	config = nodePoolUserDataConfig(map[string]string{kubeletConfigValue: "maxPods: 1"}, &api.NodePool{Name: "worker-default"})
+	assert.Equal(t, "", config[kubeletConfigValue])
+
+	rendered, err := addGeneratedFiles("storage:\n  files:\n  - path: /etc/base\n", false, []*generatedFile{{Path: kubeletConfigDropInFile, Contents: "maxPods: 58\n"}})
+	assert.NoError(t, err)
+	assert.Contains(t, rendered, kubeletConfigDropInFile)
+	assert.Contains(t, rendered, "filesystem: root")
+}
@@ -0,0 +1,88 @@
+package provisioner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"k8s.io/apimachinery/pkg/util/validation"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// taintEffects are the valid effects of node taints.
+var taintEffects = map[string]bool{
+	"NoSchedule":       true,
+	"PreferNoSchedule": true,
+	"NoExecute":        true,
+}
+
+// validateLabelsAndTaints returns an error if the labels or taints of the
+// node pool aren't valid Kubernetes labels and taints.
+func validateLabelsAndTaints(nodePool *api.NodePool) error {
+	for key, value := range nodePool.Labels {
+		errs := append(validation.IsQualifiedName(key), validation.IsValidLabelValue(value)...)
+		if len(errs) > 0 {
+			return fmt.Errorf("invalid label %s=%s for node pool %s: %s", key, value, nodePool.Name, strings.Join(errs, "; "))
+		}
+	}
+
+	for key, taint := range nodePool.Taints {
+		value, effect := splitTaint(taint)
+		errs := append(validation.IsQualifiedName(key), validation.IsValidLabelValue(value)...)
+		if !taintEffects[effect] {
+			errs = append(errs, fmt.Sprintf("unknown effect '%s'", effect))
+		}
+
+		if len(errs) > 0 {
+			return fmt.Errorf("invalid taint %s=%s for node pool %s: %s", key, taint, nodePool.Name, strings.Join(errs, "; "))
+		}
+	}
+
+	return nil
+}
+
+// nodePoolLabels returns the labels of a node pool in the key=value format
+// of the kubelet --node-labels flag, sorted by key.
+func nodePoolLabels(nodePool *api.NodePool) []string {
+	labels := make([]string, 0, len(nodePool.Labels))
+	for _, key := range sortedKeys(nodePool.Labels) {
+		labels = append(labels, fmt.Sprintf("%s=%s", key, nodePool.Labels[key]))
+	}
+	return labels
+}
+
+// nodePoolTaints returns the taints of a node pool in the key=value:effect
+// format of the kubelet --register-with-taints flag, sorted by key.
+func nodePoolTaints(nodePool *api.NodePool) []string {
+	taints := make([]string, 0, len(nodePool.Taints))
+	for _, key := range sortedKeys(nodePool.Taints) {
+		value, effect := splitTaint(nodePool.Taints[key])
+		if value == "" {
+			taints = append(taints, fmt.Sprintf("%s:%s", key, effect))
+			continue
+		}
+		taints = append(taints, fmt.Sprintf("%s=%s:%s", key, value, effect))
+	}
+	return taints
+}
+
+// splitTaint splits a taint of a node pool, defined as value:effect or just
+// effect, into value and effect.
+func splitTaint(taint string) (string, string) {
+	i := strings.LastIndex(taint, ":")
+	if i == -1 {
+		return "", taint
+	}
+	return taint[:i], taint[i+1:]
+}
+
+// sortedKeys returns the sorted keys of a map.
+func sortedKeys(m map[string]string) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
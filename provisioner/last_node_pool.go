@@ -0,0 +1,64 @@
+package provisioner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const configKeyLastNodePoolOverride = "last_node_pool_override"
+
+// lastNodePoolError is returned when the node pools of a cluster leave no
+// node for the system components, e.g. because the last schedulable node pool
+// was removed or scaled to zero.
+type lastNodePoolError struct {
+	cluster string
+}
+
+func (e *lastNodePoolError) Error() string {
+	return fmt.Sprintf("cluster %s has no schedulable node pool left for the system components (set %s to \"true\" to update anyway)", e.cluster, configKeyLastNodePoolOverride)
+}
+
+// isSchedulableNodePool returns true if the node pool can run the system
+// components: it's not a master or Windows node pool, its nodes aren't tainted
+// to repel pods and it isn't scaled to zero, neither by its max size nor by
+// one of its scaling schedules.
+func isSchedulableNodePool(nodePool *api.NodePool) bool {
+	if strings.HasPrefix(nodePool.Profile, "master") || nodePoolOS(nodePool) == osWindows || nodePool.MaxSize <= 0 {
+		return false
+	}
+
+	for _, taint := range nodePool.Taints {
+		if _, effect := splitTaint(taint); effect != "PreferNoSchedule" {
+			return false
+		}
+	}
+
+	for _, schedule := range nodePool.ScalingSchedules {
+		if schedule.MaxSize <= 0 {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkSchedulableNodePools returns a lastNodePoolError if none of the node
+// pools of the cluster is schedulable. Removing or scaling down the last
+// schedulable node pool evicts the system components like the CNI and DNS,
+// which can leave the cluster unrecoverable by further updates. The check can
+// be overridden with the last_node_pool_override config item.
+func checkSchedulableNodePools(cluster *api.Cluster) error {
+	if cluster.ConfigItems[configKeyLastNodePoolOverride] == "true" {
+		return nil
+	}
+
+	for _, nodePool := range cluster.NodePools {
+		if isSchedulableNodePool(nodePool) {
+			return nil
+		}
+	}
+
+	return &lastNodePoolError{cluster: cluster.ID}
+}
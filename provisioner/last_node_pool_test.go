@@ -0,0 +1,63 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestCheckSchedulableNodePools(t *testing.T) {
+	master := &api.NodePool{Name: "master", Profile: "master-default", MinSize: 1, MaxSize: 2}
+	tainted := &api.NodePool{Name: "gpu", Profile: "worker-default", MaxSize: 3, Taints: map[string]string{"nvidia.com/gpu": "present:NoSchedule"}}
+
+	for _, tc := range []struct {
+		msg         string
+		nodePools   []*api.NodePool
+		configItems map[string]string
+		valid       bool
+	}{
+		{
+			msg:       "test schedulable node pool",
+			nodePools: []*api.NodePool{master, {Name: "default", Profile: "worker-default", MaxSize: 10, Taints: map[string]string{"spot": "PreferNoSchedule"}}},
+			valid:     true,
+		},
+		{
+			msg:       "test last schedulable node pool removed",
+			nodePools: []*api.NodePool{master, tainted},
+		},
+		{
+			msg:       "test last schedulable node pool scaled to zero",
+			nodePools: []*api.NodePool{master, {Name: "default", Profile: "worker-default", MaxSize: 0}},
+		},
+		{
+			msg: "test last schedulable node pool scaled to zero by a schedule",
+			nodePools: []*api.NodePool{master, {
+				Name:             "default",
+				Profile:          "worker-default",
+				MaxSize:          10,
+				ScalingSchedules: []*api.ScalingSchedule{{Name: "night", Recurrence: "0 19 * * *"}},
+			}},
+		},
+		{
+			msg:       "test only windows node pools left",
+			nodePools: []*api.NodePool{master, {Name: "windows", Profile: "worker-windows", OS: "windows", MaxSize: 10}},
+		},
+		{
+			msg:         "test override",
+			nodePools:   []*api.NodePool{master},
+			configItems: map[string]string{configKeyLastNodePoolOverride: "true"},
+			valid:       true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := checkSchedulableNodePools(&api.Cluster{ID: "kube-1", NodePools: tc.nodePools, ConfigItems: tc.configItems})
+			if tc.valid {
+				assert.NoError(t, err)
+				return
+			}
+			assert.IsType(t, &lastNodePoolError{}, err)
+		})
+	}
+}
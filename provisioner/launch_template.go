@@ -0,0 +1,112 @@
+package provisioner
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const resourceTypeLaunchTemplate = "AWS::EC2::LaunchTemplate"
+
+// taggedInstanceResources are the resources created along with the
+// instances which are tagged via the launch template. Instances are tagged
+// by the ASG.
+var taggedInstanceResources = []string{"volume", "network-interface"}
+
+// launchTemplateTags returns the tags of the volumes and network interfaces
+// of the instances of a node pool.
+func launchTemplateTags(cluster *api.Cluster, nodePool *api.NodePool) map[string]string {
+	return map[string]string{
+		tagNameKubernetesClusterPrefix + cluster.ID: resourceLifecycleOwned,
+		nodePoolTagKey: nodePool.Name,
+	}
+}
+
+// addLaunchTemplateTagSpecifications adds tag specifications for the volumes
+// and network interfaces to the launch templates of the node pools in the
+// stack template, such that cost allocation and cleanup of orphaned
+// resources cover them. Tags already specified by the template are kept.
+func addLaunchTemplateTagSpecifications(stackTemplate []byte, stackName string, cluster *api.Cluster, nodePools ...*api.NodePool) ([]byte, error) {
+	return modifyStackResources(stackTemplate, func(resources map[string]interface{}) error {
+		for _, nodePool := range nodePools {
+			data, err := launchTemplateData(resources, launchTemplateName(stackName, nodePool))
+			if err != nil {
+				return err
+			}
+
+			specs, _ := data["TagSpecifications"].([]interface{})
+			for _, resourceType := range taggedInstanceResources {
+				specs = mergeTagSpecification(specs, resourceType, launchTemplateTags(cluster, nodePool))
+			}
+			data["TagSpecifications"] = specs
+		}
+		return nil
+	})
+}
+
+// launchTemplateData returns the launch template data of the launch template
+// with the specified name.
+func launchTemplateData(resources map[string]interface{}, name string) (map[string]interface{}, error) {
+	for _, resource := range resources {
+		r, ok := resource.(map[string]interface{})
+		if !ok || r["Type"] != resourceTypeLaunchTemplate {
+			continue
+		}
+
+		properties, ok := r["Properties"].(map[string]interface{})
+		if !ok || properties["LaunchTemplateName"] != name {
+			continue
+		}
+
+		data, ok := properties["LaunchTemplateData"].(map[string]interface{})
+		if !ok {
+			data = make(map[string]interface{})
+			properties["LaunchTemplateData"] = data
+		}
+		return data, nil
+	}
+
+	return nil, fmt.Errorf("failed to find launch template %s in stack template", name)
+}
+
+// mergeTagSpecification adds the tags to the tag specification of the
+// resource type, creating it if necessary. Existing tags are not
+// overwritten.
+func mergeTagSpecification(specs []interface{}, resourceType string, tags map[string]string) []interface{} {
+	var spec map[string]interface{}
+	for _, s := range specs {
+		if m, ok := s.(map[string]interface{}); ok && m["ResourceType"] == resourceType {
+			spec = m
+			break
+		}
+	}
+
+	if spec == nil {
+		spec = map[string]interface{}{"ResourceType": resourceType}
+		specs = append(specs, spec)
+	}
+
+	existing, _ := spec["Tags"].([]interface{})
+	defined := make(map[interface{}]bool, len(existing))
+	for _, tag := range existing {
+		if m, ok := tag.(map[string]interface{}); ok {
+			defined[m["Key"]] = true
+		}
+	}
+
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		if !defined[key] {
+			existing = append(existing, map[string]interface{}{"Key": key, "Value": tags[key]})
+		}
+	}
+	spec["Tags"] = existing
+
+	return specs
+}
@@ -0,0 +1,78 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const testLaunchTemplateStackTemplate = `{
+  "Resources": {
+    "MasterLaunchTemplate": {
+      "Type": "AWS::EC2::LaunchTemplate",
+      "Properties": {"LaunchTemplateName": "kube-1-master-default"}
+    },
+    "WorkerLaunchTemplate": {
+      "Type": "AWS::EC2::LaunchTemplate",
+      "Properties": {
+        "LaunchTemplateName": "kube-1-worker-default",
+        "LaunchTemplateData": {
+          "TagSpecifications": [
+            {"ResourceType": "volume", "Tags": [{"Key": "NodePool", "Value": "custom"}, {"Key": "team", "Value": "teapot"}]}
+          ]
+        }
+      }
+    }
+  }
+}`
+
+func TestAddLaunchTemplateTagSpecifications(t *testing.T) {
+	cluster := &api.Cluster{ID: "aws:123456789012:eu-central-1:kube-1"}
+	master := &api.NodePool{Name: "master-default"}
+	worker := &api.NodePool{Name: "worker-default"}
+
+	output, err := addLaunchTemplateTagSpecifications([]byte(testLaunchTemplateStackTemplate), "kube-1", cluster, master, worker)
+	require.NoError(t, err)
+
+	var template struct {
+		Resources map[string]struct {
+			Properties struct {
+				LaunchTemplateData struct {
+					TagSpecifications []struct {
+						ResourceType string
+						Tags         []map[string]string
+					}
+				}
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(output, &template))
+
+	clusterTag := map[string]string{"Key": "kubernetes.io/cluster/" + cluster.ID, "Value": "owned"}
+
+	masterSpecs := template.Resources["MasterLaunchTemplate"].Properties.LaunchTemplateData.TagSpecifications
+	require.Len(t, masterSpecs, 2)
+	assert.Equal(t, "volume", masterSpecs[0].ResourceType)
+	assert.Equal(t, "network-interface", masterSpecs[1].ResourceType)
+	assert.Equal(t, []map[string]string{
+		{"Key": "NodePool", "Value": "master-default"},
+		clusterTag,
+	}, masterSpecs[1].Tags)
+
+	// tags defined by the template are kept.
+	workerSpecs := template.Resources["WorkerLaunchTemplate"].Properties.LaunchTemplateData.TagSpecifications
+	require.Len(t, workerSpecs, 2)
+	assert.Equal(t, []map[string]string{
+		{"Key": "NodePool", "Value": "custom"},
+		{"Key": "team", "Value": "teapot"},
+		clusterTag,
+	}, workerSpecs[0].Tags)
+
+	// all node pools must have a launch template.
+	_, err = addLaunchTemplateTagSpecifications([]byte(testLaunchTemplateStackTemplate), "kube-2", cluster, master)
+	assert.Error(t, err)
+}
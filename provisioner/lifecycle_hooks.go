@@ -0,0 +1,122 @@
+package provisioner
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	resourceTypeLifecycleHook   = "AWS::AutoScaling::LifecycleHook"
+	minLifecycleHookHeartbeat   = 30
+	maxLifecycleHookHeartbeat   = 7200
+	lifecycleHookResultContinue = "CONTINUE"
+	lifecycleHookResultAbandon  = "ABANDON"
+)
+
+var (
+	lifecycleHookNameRegexp    = regexp.MustCompile(`^[A-Za-z0-9_-]{1,255}$`)
+	lifecycleHookLogicalRegexp = regexp.MustCompile(`[^A-Za-z0-9]`)
+)
+
+// lifecycleHookTransitions maps the transitions of lifecycle hooks to the ones
+// of the ASG.
+var lifecycleHookTransitions = map[string]string{
+	"launch":    "autoscaling:EC2_INSTANCE_LAUNCHING",
+	"terminate": "autoscaling:EC2_INSTANCE_TERMINATING",
+}
+
+// validateLifecycleHooks validates the lifecycle hooks of a node pool.
+func validateLifecycleHooks(nodePool *api.NodePool) error {
+	logicalIDs := make(map[string]bool, len(nodePool.LifecycleHooks))
+	for _, hook := range nodePool.LifecycleHooks {
+		if !lifecycleHookNameRegexp.MatchString(hook.Name) {
+			return fmt.Errorf("invalid lifecycle hook name '%s' for node pool %s, must be alphanumeric, '-' or '_'", hook.Name, nodePool.Name)
+		}
+
+		// the logical IDs of the hooks in the stack template are derived
+		// from their names.
+		logicalID := lifecycleHookLogicalID(hook)
+		if logicalIDs[logicalID] {
+			return fmt.Errorf("duplicate lifecycle hook %s for node pool %s", hook.Name, nodePool.Name)
+		}
+		logicalIDs[logicalID] = true
+
+		if _, ok := lifecycleHookTransitions[hook.Transition]; !ok {
+			return fmt.Errorf("invalid transition %s of lifecycle hook %s for node pool %s, must be launch or terminate", hook.Transition, hook.Name, nodePool.Name)
+		}
+
+		if hook.HeartbeatTimeout != 0 && (hook.HeartbeatTimeout < minLifecycleHookHeartbeat || hook.HeartbeatTimeout > maxLifecycleHookHeartbeat) {
+			return fmt.Errorf("invalid heartbeat timeout %d of lifecycle hook %s for node pool %s, must be between %d and %d seconds", hook.HeartbeatTimeout, hook.Name, nodePool.Name, minLifecycleHookHeartbeat, maxLifecycleHookHeartbeat)
+		}
+
+		switch hook.DefaultResult {
+		case "", lifecycleHookResultContinue, lifecycleHookResultAbandon:
+		default:
+			return fmt.Errorf("invalid default result %s of lifecycle hook %s for node pool %s, must be CONTINUE or ABANDON", hook.DefaultResult, hook.Name, nodePool.Name)
+		}
+
+		if (hook.NotificationTargetARN == "") != (hook.RoleARN == "") {
+			return fmt.Errorf("lifecycle hook %s for node pool %s must have both a notification target and a role or neither", hook.Name, nodePool.Name)
+		}
+	}
+
+	return nil
+}
+
+// lifecycleHookLogicalID returns the suffix of the logical ID of the resource
+// of a lifecycle hook.
+func lifecycleHookLogicalID(hook *api.LifecycleHook) string {
+	return "LifecycleHook" + lifecycleHookLogicalRegexp.ReplaceAllString(hook.Name, "")
+}
+
+// addLifecycleHooks adds the lifecycle hooks of the node pools to the stack
+// template. Like the scheduled actions they refer to the ASG of the template
+// which is tagged with the name of the node pool.
+func addLifecycleHooks(stackTemplate []byte, nodePools ...*api.NodePool) ([]byte, error) {
+	hooks := 0
+	for _, nodePool := range nodePools {
+		hooks += len(nodePool.LifecycleHooks)
+	}
+	if hooks == 0 {
+		return stackTemplate, nil
+	}
+
+	return modifyStackResources(stackTemplate, func(resources map[string]interface{}) error {
+		for _, nodePool := range nodePools {
+			if len(nodePool.LifecycleHooks) == 0 {
+				continue
+			}
+
+			asgLogicalID, err := nodePoolASGLogicalID(resources, nodePool)
+			if err != nil {
+				return err
+			}
+
+			for _, hook := range nodePool.LifecycleHooks {
+				properties := map[string]interface{}{
+					"AutoScalingGroupName": map[string]interface{}{"Ref": asgLogicalID},
+					"LifecycleHookName":    hook.Name,
+					"LifecycleTransition":  lifecycleHookTransitions[hook.Transition],
+				}
+				if hook.HeartbeatTimeout != 0 {
+					properties["HeartbeatTimeout"] = hook.HeartbeatTimeout
+				}
+				if hook.DefaultResult != "" {
+					properties["DefaultResult"] = hook.DefaultResult
+				}
+				if hook.NotificationTargetARN != "" {
+					properties["NotificationTargetARN"] = hook.NotificationTargetARN
+					properties["RoleARN"] = hook.RoleARN
+				}
+
+				resources[asgLogicalID+lifecycleHookLogicalID(hook)] = map[string]interface{}{
+					"Type":       resourceTypeLifecycleHook,
+					"Properties": properties,
+				}
+			}
+		}
+		return nil
+	})
+}
@@ -0,0 +1,116 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestValidateLifecycleHooks(t *testing.T) {
+	for _, tc := range []struct {
+		msg   string
+		hooks []*api.LifecycleHook
+		valid bool
+	}{
+		{
+			msg:   "no hooks",
+			valid: true,
+		},
+		{
+			msg: "valid hooks",
+			hooks: []*api.LifecycleHook{
+				{Name: "wait-for-bootstrap", Transition: "launch", HeartbeatTimeout: 600, DefaultResult: "ABANDON"},
+				{Name: "flush-logs", Transition: "terminate", HeartbeatTimeout: 300, DefaultResult: "CONTINUE", NotificationTargetARN: "arn:aws:sqs:eu-central-1:123456789012:node-shutdown", RoleARN: "arn:aws:iam::123456789012:role/hooks"},
+			},
+			valid: true,
+		},
+		{
+			msg:   "invalid name",
+			hooks: []*api.LifecycleHook{{Name: "flush logs", Transition: "terminate"}},
+		},
+		{
+			msg: "duplicate logical ID",
+			hooks: []*api.LifecycleHook{
+				{Name: "flush-logs", Transition: "terminate"},
+				{Name: "flush_logs", Transition: "terminate"},
+			},
+		},
+		{
+			msg:   "invalid transition",
+			hooks: []*api.LifecycleHook{{Name: "flush-logs", Transition: "stop"}},
+		},
+		{
+			msg:   "heartbeat timeout too short",
+			hooks: []*api.LifecycleHook{{Name: "flush-logs", Transition: "terminate", HeartbeatTimeout: 10}},
+		},
+		{
+			msg:   "invalid default result",
+			hooks: []*api.LifecycleHook{{Name: "flush-logs", Transition: "terminate", DefaultResult: "RETRY"}},
+		},
+		{
+			msg:   "notification target without role",
+			hooks: []*api.LifecycleHook{{Name: "flush-logs", Transition: "terminate", NotificationTargetARN: "arn:aws:sns:eu-central-1:123456789012:node-shutdown"}},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := validateLifecycleHooks(&api.NodePool{Name: "worker-default", LifecycleHooks: tc.hooks})
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestAddLifecycleHooks(t *testing.T) {
+	master := &api.NodePool{Name: "master-default"}
+	worker := &api.NodePool{Name: "worker-default"}
+
+	// the template is not changed without lifecycle hooks.
+	output, err := addLifecycleHooks([]byte(testScheduleStackTemplate), master, worker)
+	require.NoError(t, err)
+	assert.Equal(t, testScheduleStackTemplate, string(output))
+
+	worker.LifecycleHooks = []*api.LifecycleHook{
+		{Name: "flush-logs", Transition: "terminate", HeartbeatTimeout: 300, NotificationTargetARN: "arn:aws:sqs:eu-central-1:123456789012:node-shutdown", RoleARN: "arn:aws:iam::123456789012:role/hooks"},
+		{Name: "bootstrap", Transition: "launch"},
+	}
+	output, err = addLifecycleHooks([]byte(testScheduleStackTemplate), master, worker)
+	require.NoError(t, err)
+
+	var template struct {
+		Resources map[string]struct {
+			Type       string
+			Properties map[string]interface{}
+		}
+	}
+	require.NoError(t, json.Unmarshal(output, &template))
+	require.Len(t, template.Resources, 4)
+
+	hook := template.Resources["WorkerAutoScalingLifecycleHookflushlogs"]
+	assert.Equal(t, resourceTypeLifecycleHook, hook.Type)
+	assert.Equal(t, map[string]interface{}{
+		"AutoScalingGroupName":  map[string]interface{}{"Ref": "WorkerAutoScaling"},
+		"LifecycleHookName":     "flush-logs",
+		"LifecycleTransition":   "autoscaling:EC2_INSTANCE_TERMINATING",
+		"HeartbeatTimeout":      float64(300),
+		"NotificationTargetARN": "arn:aws:sqs:eu-central-1:123456789012:node-shutdown",
+		"RoleARN":               "arn:aws:iam::123456789012:role/hooks",
+	}, hook.Properties)
+
+	hook = template.Resources["WorkerAutoScalingLifecycleHookbootstrap"]
+	assert.Equal(t, map[string]interface{}{
+		"AutoScalingGroupName": map[string]interface{}{"Ref": "WorkerAutoScaling"},
+		"LifecycleHookName":    "bootstrap",
+		"LifecycleTransition":  "autoscaling:EC2_INSTANCE_LAUNCHING",
+	}, hook.Properties)
+
+	// node pools must have an ASG in the template.
+	_, err = addLifecycleHooks([]byte(testScheduleStackTemplate), &api.NodePool{Name: "missing", LifecycleHooks: worker.LifecycleHooks})
+	assert.Error(t, err)
+}
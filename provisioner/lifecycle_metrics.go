@@ -0,0 +1,232 @@
+package provisioner
+
+import (
+	"regexp"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/prometheus/client_golang/prometheus"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+// maxScalingActivities is the number of the most recent scaling activities
+// looked at per node pool.
+const maxScalingActivities = 100
+
+var (
+	// scalingActivityInstanceRE matches the description of the ASG
+	// activities launching and terminating instances.
+	scalingActivityInstanceRE = regexp.MustCompile(`^(Launching a new|Terminating) EC2 instance: (i-[0-9a-f]+)`)
+	// spotInterruptionCauseRE matches the cause of terminations in reaction
+	// to spot interruptions and rebalance recommendations.
+	spotInterruptionCauseRE = regexp.MustCompile(`(?i)spot|rebalance|interruption`)
+
+	nodePoolInstanceLaunches = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "node_pool_instance_launches_total",
+		Help:      "Number of instances launched by node pool.",
+	}, []string{"cluster", "node_pool"})
+
+	nodePoolInstanceTerminations = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "node_pool_instance_terminations_total",
+		Help:      "Number of instances terminated by node pool.",
+	}, []string{"cluster", "node_pool"})
+
+	nodePoolSpotInterruptions = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "node_pool_spot_interruptions_total",
+		Help:      "Number of instances terminated because of spot interruptions or rebalance recommendations by node pool.",
+	}, []string{"cluster", "node_pool"})
+
+	nodePoolBootstrapFailures = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "node_pool_bootstrap_failures",
+		Help:      "Number of consecutive updates whose new nodes failed to become ready by node pool.",
+	}, []string{"cluster", "node_pool"})
+
+	nodePoolNodeLifetime = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "node_pool_mean_node_lifetime_seconds",
+		Help:      "Mean time between the launch and the termination of the recently terminated instances by node pool.",
+	}, []string{"cluster", "node_pool"})
+
+	nodePoolNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "node_pool_nodes",
+		Help:      "Number of nodes by node pool and generation, 'current' for nodes launched from the current launch configuration and 'outdated' for nodes to be replaced.",
+	}, []string{"cluster", "node_pool", "generation"})
+
+	nodePoolQuarantinedNodes = prometheus.NewGaugeVec(prometheus.GaugeOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "node_pool_quarantined_nodes",
+		Help:      "Number of nodes quarantined because they couldn't be drained by node pool.",
+	}, []string{"cluster", "node_pool"})
+)
+
+// nodePoolActivities keeps the IDs of the completed scaling activities
+// already counted in the lifecycle metrics per ASG.
+type nodePoolActivities struct {
+	sync.Mutex
+	seen map[string]map[string]bool
+}
+
+func newNodePoolActivities() *nodePoolActivities {
+	return &nodePoolActivities{seen: make(map[string]map[string]bool)}
+}
+
+// unseen returns the completed activities of the ASG which weren't returned
+// before. The activities of an ASG seen for the first time are only recorded,
+// such that the counters start at zero like after a restart.
+func (t *nodePoolActivities) unseen(asgName string, activities []*autoscaling.Activity) []*autoscaling.Activity {
+	t.Lock()
+	defer t.Unlock()
+
+	previous, known := t.seen[asgName]
+	current := make(map[string]bool, len(activities))
+
+	var unseen []*autoscaling.Activity
+	for _, activity := range activities {
+		if aws.StringValue(activity.StatusCode) != autoscaling.ScalingActivityStatusCodeSuccessful {
+			continue
+		}
+
+		id := aws.StringValue(activity.ActivityId)
+		current[id] = true
+		if known && !previous[id] {
+			unseen = append(unseen, activity)
+		}
+	}
+
+	t.seen[asgName] = current
+	return unseen
+}
+
+// instanceLifecycle counts the launches, terminations and spot interruptions
+// of the activities.
+type instanceLifecycle struct {
+	launches          int
+	terminations      int
+	spotInterruptions int
+}
+
+func newInstanceLifecycle(activities []*autoscaling.Activity) *instanceLifecycle {
+	lifecycle := &instanceLifecycle{}
+	for _, activity := range activities {
+		match := scalingActivityInstanceRE.FindStringSubmatch(aws.StringValue(activity.Description))
+		if match == nil {
+			continue
+		}
+
+		if match[1] == "Terminating" {
+			lifecycle.terminations++
+			if spotInterruptionCauseRE.MatchString(aws.StringValue(activity.Cause)) {
+				lifecycle.spotInterruptions++
+			}
+			continue
+		}
+		lifecycle.launches++
+	}
+	return lifecycle
+}
+
+// meanInstanceLifetime returns the mean lifetime of the instances whose
+// launch and termination are both part of the activities. It returns false if
+// there are no such instances.
+func meanInstanceLifetime(activities []*autoscaling.Activity) (time.Duration, bool) {
+	launched := make(map[string]time.Time)
+	terminated := make(map[string]time.Time)
+	for _, activity := range activities {
+		if aws.StringValue(activity.StatusCode) != autoscaling.ScalingActivityStatusCodeSuccessful {
+			continue
+		}
+
+		match := scalingActivityInstanceRE.FindStringSubmatch(aws.StringValue(activity.Description))
+		if match == nil {
+			continue
+		}
+
+		if match[1] == "Terminating" {
+			terminated[match[2]] = aws.TimeValue(activity.StartTime)
+		} else {
+			launched[match[2]] = aws.TimeValue(activity.EndTime)
+		}
+	}
+
+	var total time.Duration
+	instances := 0
+	for instance, terminatedAt := range terminated {
+		launchedAt, ok := launched[instance]
+		if !ok || terminatedAt.Before(launchedAt) {
+			continue
+		}
+		total += terminatedAt.Sub(launchedAt)
+		instances++
+	}
+
+	if instances == 0 {
+		return 0, false
+	}
+	return total / time.Duration(instances), true
+}
+
+// scalingActivities returns the most recent scaling activities of the ASG.
+func (a *awsAdapter) scalingActivities(asgName string) ([]*autoscaling.Activity, error) {
+	resp, err := a.autoscalingClient.DescribeScalingActivities(&autoscaling.DescribeScalingActivitiesInput{
+		AutoScalingGroupName: aws.String(asgName),
+		MaxRecords:           aws.Int64(maxScalingActivities),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Activities, nil
+}
+
+// recordLifecycleMetrics updates the instance lifecycle metrics of the node
+// pools of the cluster from the scaling activities of their ASGs. The metrics
+// are best effort, node pools whose activities can't be looked up are
+// skipped with a warning.
+func (a *awsAdapter) recordLifecycleMetrics(seen *nodePoolActivities, cluster *api.Cluster, bootstrapFailures updatestrategy.BootstrapFailureStore) {
+	for _, nodePool := range cluster.NodePools {
+		asg, err := a.getNodePoolASG(cluster.LocalID, nodePool.Name)
+		if err != nil {
+			a.logger.Warnf("Failed to find ASG of node pool %s: %v", nodePool.Name, err)
+			continue
+		}
+
+		activities, err := a.scalingActivities(aws.StringValue(asg.AutoScalingGroupName))
+		if err != nil {
+			a.logger.Warnf("Failed to get scaling activities of node pool %s: %v", nodePool.Name, err)
+			continue
+		}
+
+		lifecycle := newInstanceLifecycle(seen.unseen(aws.StringValue(asg.AutoScalingGroupName), activities))
+		nodePoolInstanceLaunches.WithLabelValues(cluster.ID, nodePool.Name).Add(float64(lifecycle.launches))
+		nodePoolInstanceTerminations.WithLabelValues(cluster.ID, nodePool.Name).Add(float64(lifecycle.terminations))
+		nodePoolSpotInterruptions.WithLabelValues(cluster.ID, nodePool.Name).Add(float64(lifecycle.spotInterruptions))
+
+		if lifetime, ok := meanInstanceLifetime(activities); ok {
+			nodePoolNodeLifetime.WithLabelValues(cluster.ID, nodePool.Name).Set(lifetime.Seconds())
+		}
+
+		if bootstrapFailures != nil {
+			failures, err := bootstrapFailures.GetBootstrapFailures(nodePool)
+			if err != nil {
+				a.logger.Warnf("Failed to get bootstrap failures of node pool %s: %v", nodePool.Name, err)
+				continue
+			}
+			nodePoolBootstrapFailures.WithLabelValues(cluster.ID, nodePool.Name).Set(float64(failures))
+		}
+	}
+}
@@ -0,0 +1,119 @@
+package provisioner
+
+import (
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/prometheus/client_golang/prometheus"
+	dto "github.com/prometheus/client_model/go"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type activitiesAutoscalingAPIStub struct {
+	autoscalingAPI
+	group      *autoscaling.Group
+	activities []*autoscaling.Activity
+}
+
+func (a *activitiesAutoscalingAPIStub) DescribeAutoScalingGroups(input *autoscaling.DescribeAutoScalingGroupsInput) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	return &autoscaling.DescribeAutoScalingGroupsOutput{AutoScalingGroups: []*autoscaling.Group{a.group}}, nil
+}
+
+func (a *activitiesAutoscalingAPIStub) DescribeScalingActivities(input *autoscaling.DescribeScalingActivitiesInput) (*autoscaling.DescribeScalingActivitiesOutput, error) {
+	return &autoscaling.DescribeScalingActivitiesOutput{Activities: a.activities}, nil
+}
+
+type mockBootstrapFailures struct {
+	failures int
+}
+
+func (m *mockBootstrapFailures) GetBootstrapFailures(nodePool *api.NodePool) (int, error) {
+	return m.failures, nil
+}
+
+func (m *mockBootstrapFailures) SetBootstrapFailures(nodePool *api.NodePool, failures int) error {
+	m.failures = failures
+	return nil
+}
+
+func scalingActivity(id, description, cause string, start time.Time) *autoscaling.Activity {
+	return &autoscaling.Activity{
+		ActivityId:  aws.String(id),
+		Description: aws.String(description),
+		Cause:       aws.String(cause),
+		StatusCode:  aws.String(autoscaling.ScalingActivityStatusCodeSuccessful),
+		StartTime:   aws.Time(start),
+		EndTime:     aws.Time(start.Add(time.Minute)),
+	}
+}
+
+func metricValue(t *testing.T, collector prometheus.Collector, labels ...string) float64 {
+	var metric dto.Metric
+	switch c := collector.(type) {
+	case *prometheus.CounterVec:
+		require.NoError(t, c.WithLabelValues(labels...).Write(&metric))
+		return metric.GetCounter().GetValue()
+	case *prometheus.GaugeVec:
+		require.NoError(t, c.WithLabelValues(labels...).Write(&metric))
+		return metric.GetGauge().GetValue()
+	}
+	t.Fatalf("unexpected collector %T", collector)
+	return 0
+}
+
+func TestRecordLifecycleMetrics(t *testing.T) {
+	now := time.Now()
+	cluster := &api.Cluster{
+		ID:        "aws:123456789012:eu-central-1:lifecycle",
+		LocalID:   "lifecycle",
+		NodePools: []*api.NodePool{{Name: "worker"}},
+	}
+
+	stub := &activitiesAutoscalingAPIStub{
+		group: &autoscaling.Group{
+			AutoScalingGroupName: aws.String("lifecycle-worker"),
+			Tags: []*autoscaling.TagDescription{
+				{Key: aws.String("aws:cloudformation:stack-name"), Value: aws.String("lifecycle")},
+				{Key: aws.String("NodePool"), Value: aws.String("worker")},
+			},
+		},
+		activities: []*autoscaling.Activity{
+			scalingActivity("1", "Launching a new EC2 instance: i-1", "", now.Add(-3*time.Hour)),
+		},
+	}
+	adapter := &awsAdapter{autoscalingClient: stub, logger: log.WithField("test", true)}
+	seen := newNodePoolActivities()
+	failures := &mockBootstrapFailures{failures: 2}
+
+	// the activities found first are only recorded.
+	adapter.recordLifecycleMetrics(seen, cluster, failures)
+	assert.Equal(t, float64(0), metricValue(t, nodePoolInstanceLaunches, cluster.ID, "worker"))
+	assert.Equal(t, float64(2), metricValue(t, nodePoolBootstrapFailures, cluster.ID, "worker"))
+
+	inProgress := scalingActivity("5", "Launching a new EC2 instance: i-4", "", now)
+	inProgress.StatusCode = aws.String(autoscaling.ScalingActivityStatusCodeInProgress)
+
+	stub.activities = append([]*autoscaling.Activity{
+		inProgress,
+		scalingActivity("4", "Terminating EC2 instance: i-2", "an instance was taken out of service in response to an EC2 instance rebalance recommendation", now.Add(-time.Minute)),
+		scalingActivity("3", "Terminating EC2 instance: i-1", "an instance was terminated in response to a user request", now.Add(-time.Hour-time.Minute)),
+		scalingActivity("2", "Launching a new EC2 instance: i-2", "", now.Add(-2*time.Hour)),
+	}, stub.activities...)
+	adapter.recordLifecycleMetrics(seen, cluster, failures)
+
+	assert.Equal(t, float64(1), metricValue(t, nodePoolInstanceLaunches, cluster.ID, "worker"))
+	assert.Equal(t, float64(2), metricValue(t, nodePoolInstanceTerminations, cluster.ID, "worker"))
+	assert.Equal(t, float64(1), metricValue(t, nodePoolSpotInterruptions, cluster.ID, "worker"))
+	// both instances lived 1 hour and 58 minutes.
+	assert.Equal(t, (2*time.Hour - 2*time.Minute).Seconds(), metricValue(t, nodePoolNodeLifetime, cluster.ID, "worker"))
+
+	// activities are only counted once.
+	adapter.recordLifecycleMetrics(seen, cluster, failures)
+	assert.Equal(t, float64(2), metricValue(t, nodePoolInstanceTerminations, cluster.ID, "worker"))
+}
@@ -0,0 +1,242 @@
+package provisioner
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+const (
+	lintSeverityWarning = "warning"
+	lintSeverityError   = "error"
+
+	// haMinimumMasters is the minimum number of master nodes keeping the
+	// API server available while a master node is replaced.
+	haMinimumMasters = 2
+
+	// configKeyStrictInstanceTypes makes deprecated and unavailable
+	// instance types fail the update instead of only warning about them.
+	configKeyStrictInstanceTypes = "strict_instance_types"
+)
+
+var (
+	// gpuInstanceTypeRE matches the instance types of the AWS GPU
+	// instance families.
+	gpuInstanceTypeRE = regexp.MustCompile(`^[gp]\d`)
+	// burstableInstanceTypeRE matches the instance types of the AWS
+	// burstable instance families.
+	burstableInstanceTypeRE = regexp.MustCompile(`^t\d`)
+)
+
+// lintFinding is a risky node pool configuration found by lintNodePools.
+type lintFinding struct {
+	NodePool string
+	Severity string
+	Message  string
+}
+
+func (f *lintFinding) String() string {
+	return fmt.Sprintf("%s: %s", f.NodePool, f.Message)
+}
+
+type lintError struct {
+	findings []*lintFinding
+}
+
+func (e *lintError) Error() string {
+	messages := make([]string, 0, len(e.findings))
+	for _, finding := range e.findings {
+		messages = append(messages, finding.String())
+	}
+	return fmt.Sprintf("invalid node pools: %s", strings.Join(messages, ", "))
+}
+
+// lintNodePools returns the risky combinations in the node pool
+// configuration of a cluster which are valid but likely unintended.
+func lintNodePools(cluster *api.Cluster) []*lintFinding {
+	var findings []*lintFinding
+	add := func(nodePool, severity, format string, args ...interface{}) {
+		findings = append(findings, &lintFinding{
+			NodePool: nodePool,
+			Severity: severity,
+			Message:  fmt.Sprintf(format, args...),
+		})
+	}
+
+	names := make(map[string]bool, len(cluster.NodePools))
+	for _, nodePool := range cluster.NodePools {
+		names[nodePool.Name] = true
+	}
+
+	instanceTypeSeverity := lintSeverityWarning
+	if cluster.ConfigItems[configKeyStrictInstanceTypes] == "true" {
+		instanceTypeSeverity = lintSeverityError
+	}
+
+	for _, nodePool := range cluster.NodePools {
+		master := strings.HasPrefix(nodePool.Profile, "master")
+
+		for _, message := range lintInstanceType(nodePool.InstanceType, cluster.Region, awsExt.InstanceInfo()) {
+			add(nodePool.Name, instanceTypeSeverity, "%s", message)
+		}
+
+		if nodePool.PreviousName != "" && names[nodePool.PreviousName] {
+			add(nodePool.Name, lintSeverityError, "previous name %s is the name of a node pool", nodePool.PreviousName)
+		}
+
+		if isSpotNodePool(nodePool) {
+			switch {
+			case master && nodePool.MaxSize <= 1:
+				add(nodePool.Name, lintSeverityError, "the only master node is a spot instance")
+			case master:
+				add(nodePool.Name, lintSeverityWarning, "master nodes are spot instances")
+			case nodePool.MaxSize <= 1:
+				add(nodePool.Name, lintSeverityWarning, "the only node is a spot instance")
+			}
+		}
+
+		err := validateTenancy(nodePool)
+		if err != nil {
+			add(nodePool.Name, lintSeverityError, "%v", err)
+		}
+
+		err = validateNodePoolTags(nodePool)
+		if err != nil {
+			add(nodePool.Name, lintSeverityError, "%v", err)
+		}
+
+		err = validateLifecycleHooks(nodePool)
+		if err != nil {
+			add(nodePool.Name, lintSeverityError, "%v", err)
+		}
+
+		err = checkNodePoolKubeletVersion(cluster, nodePool)
+		if err != nil {
+			add(nodePool.Name, lintSeverityError, "%v", err)
+		}
+
+		err = validateImage(nodePool)
+		if err != nil {
+			add(nodePool.Name, lintSeverityError, "%v", err)
+		}
+
+		err = validateStorage(nodePool)
+		if err != nil {
+			add(nodePool.Name, lintSeverityError, "%v", err)
+		}
+
+		err = validateKubeletConfig(nodePool)
+		if err != nil {
+			add(nodePool.Name, lintSeverityError, "%v", err)
+		}
+
+		err = validateMonitoring(nodePool)
+		if err != nil {
+			add(nodePool.Name, lintSeverityError, "%v", err)
+		}
+
+		err = validateOS(nodePool)
+		if err != nil {
+			add(nodePool.Name, lintSeverityError, "%v", err)
+		}
+
+		if master && nodePool.MaxSize < haMinimumMasters {
+			add(nodePool.Name, lintSeverityWarning, "max size %d is below the HA minimum of %d master nodes", nodePool.MaxSize, haMinimumMasters)
+		}
+
+		if nodePool.UpdateSurge != "" {
+			_, err := updatestrategy.ParseSurge(nodePool.UpdateSurge, int(nodePool.MaxSize))
+			if err != nil {
+				add(nodePool.Name, lintSeverityError, "%v", err)
+			}
+		}
+
+		if nodePool.UpdateCanary != "" {
+			_, err := updatestrategy.ParseCanary(nodePool.UpdateCanary, int(nodePool.MaxSize))
+			if err != nil {
+				add(nodePool.Name, lintSeverityError, "%v", err)
+			}
+		}
+
+		if nodePool.UpdateMaxUnavailable != "" {
+			_, err := updatestrategy.ParseMaxUnavailable(nodePool.UpdateMaxUnavailable, int(nodePool.MaxSize))
+			if err != nil {
+				add(nodePool.Name, lintSeverityError, "%v", err)
+			}
+		}
+
+		err = updatestrategy.ValidateUpdateMode(nodePool.UpdateMode)
+		if err != nil {
+			add(nodePool.Name, lintSeverityError, "%v", err)
+		}
+
+		err = updatestrategy.ValidateUpdateStrategy(nodePool)
+		if err != nil {
+			add(nodePool.Name, lintSeverityError, "%v", err)
+		}
+
+		if nodePool.ScaleDownProtection != "" {
+			_, err := updatestrategy.ParseScaleDownProtection(nodePool.ScaleDownProtection)
+			if err != nil {
+				add(nodePool.Name, lintSeverityError, "%v", err)
+			}
+		}
+
+		if gpuInstanceTypeRE.MatchString(nodePool.InstanceType) {
+			instanceInfo, ok := awsExt.InstanceInfo()[nodePool.InstanceType]
+			if !ok || instanceInfo.GPU == 0 {
+				add(nodePool.Name, lintSeverityWarning, "GPU instance type %s is missing from the instance info, its nodes aren't tainted with %s", nodePool.InstanceType, gpuTaint)
+			}
+		}
+	}
+
+	if instanceType := cluster.ConfigItems[etcdInstanceTypeKey]; burstableInstanceTypeRE.MatchString(instanceType) {
+		add("etcd", lintSeverityWarning, "burstable instance type %s can run out of CPU credits", instanceType)
+	}
+
+	return findings
+}
+
+// lintInstanceType returns the problems of an instance type in the region
+// according to the instance info: previous generation instance types and
+// instance types which aren't available in the region. Instance types missing
+// from the instance info aren't checked.
+func lintInstanceType(instanceType, region string, instanceInfo map[string]awsExt.Instance) []string {
+	instance, ok := instanceInfo[instanceType]
+	if !ok {
+		return nil
+	}
+
+	var messages []string
+	if instance.PreviousGeneration {
+		messages = append(messages, fmt.Sprintf("instance type %s is a previous generation instance type", instanceType))
+	}
+	if region != "" && !instance.AvailableIn(region) {
+		messages = append(messages, fmt.Sprintf("instance type %s isn't available in region %s", instanceType, region))
+	}
+	return messages
+}
+
+// checkNodePools logs the lint findings of the node pools of a cluster and
+// fails if any of them is an error.
+func checkNodePools(logger *log.Entry, cluster *api.Cluster) error {
+	var errs []*lintFinding
+	for _, finding := range lintNodePools(cluster) {
+		if finding.Severity == lintSeverityError {
+			errs = append(errs, finding)
+			continue
+		}
+		logger.Warnf("Risky node pool configuration %s", finding)
+	}
+
+	if len(errs) > 0 {
+		return &lintError{findings: errs}
+	}
+	return nil
+}
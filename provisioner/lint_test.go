@@ -0,0 +1,105 @@
+package provisioner
+
+import (
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+)
+
+func TestLintNodePools(t *testing.T) {
+	cluster := &api.Cluster{
+		ConfigItems: map[string]string{etcdInstanceTypeKey: "t3.medium"},
+		NodePools: []*api.NodePool{
+			{Name: "master", Profile: "master/default", InstanceType: "m5.large", MinSize: 1, MaxSize: 1, DiscountStrategy: discountStrategySpotMaxPrice},
+			{Name: "ha-master", Profile: "master/default", InstanceType: "m5.large", MinSize: 2, MaxSize: 2, DiscountStrategy: discountStrategySpotMaxPrice},
+			{Name: "singleton", Profile: "worker/default", InstanceType: "m5.large", MinSize: 1, MaxSize: 1, DiscountStrategy: discountStrategySpotMaxPrice},
+			{Name: "gpu", Profile: "worker/default", InstanceType: "p3.2xlarge", MinSize: 0, MaxSize: 3},
+			{Name: "unknown-gpu", Profile: "worker/default", InstanceType: "g99.xlarge", MinSize: 0, MaxSize: 3},
+			{Name: "invalid-surge", Profile: "worker/default", InstanceType: "m5.large", MinSize: 1, MaxSize: 10, UpdateSurge: "0"},
+			{Name: "default", Profile: "worker/default", InstanceType: "m5.large", MinSize: 1, MaxSize: 10, UpdateSurge: "25%"},
+		},
+	}
+
+	findings := make(map[string][]string)
+	for _, finding := range lintNodePools(cluster) {
+		findings[finding.NodePool] = append(findings[finding.NodePool], finding.Severity)
+	}
+
+	assert.Equal(t, map[string][]string{
+		"master":        {lintSeverityError, lintSeverityWarning},
+		"ha-master":     {lintSeverityWarning},
+		"singleton":     {lintSeverityWarning},
+		"unknown-gpu":   {lintSeverityWarning},
+		"etcd":          {lintSeverityWarning},
+		"invalid-surge": {lintSeverityError},
+	}, findings)
+
+	err := checkNodePools(log.WithField("test", t.Name()), cluster)
+	require.Error(t, err)
+	assert.Equal(t, "invalid node pools: master: the only master node is a spot instance, invalid-surge: invalid surge 0: expected a positive number of nodes or a percentage", err.Error())
+
+	cluster.NodePools = cluster.NodePools[1:5]
+	assert.NoError(t, checkNodePools(log.WithField("test", t.Name()), cluster))
+}
+
+func TestLintPreviousName(t *testing.T) {
+	cluster := &api.Cluster{
+		NodePools: []*api.NodePool{
+			{Name: "worker-default", Profile: "worker/default", InstanceType: "m5.large", MinSize: 1, MaxSize: 10, PreviousName: "default-worker"},
+			{Name: "worker-batch", Profile: "worker/default", InstanceType: "m5.large", MinSize: 1, MaxSize: 10, PreviousName: "worker-default"},
+		},
+	}
+
+	findings := lintNodePools(cluster)
+	require.Len(t, findings, 1)
+	assert.Equal(t, "worker-batch", findings[0].NodePool)
+	assert.Equal(t, lintSeverityError, findings[0].Severity)
+}
+
+func TestLintInstanceType(t *testing.T) {
+	instanceInfo := map[string]awsExt.Instance{
+		"m1.small":  {PreviousGeneration: true, Pricing: map[string]string{"us-east-1": "0.044"}},
+		"m5.large":  {Pricing: map[string]string{"eu-central-1": "0.115", "us-east-1": "0.096"}},
+		"x9.custom": {},
+	}
+
+	for _, tc := range []struct {
+		instanceType string
+		region       string
+		findings     int
+	}{
+		{instanceType: "m5.large", region: "eu-central-1", findings: 0},
+		{instanceType: "m5.large", region: "ap-east-1", findings: 1},
+		{instanceType: "m1.small", region: "us-east-1", findings: 1},
+		{instanceType: "m1.small", region: "eu-central-1", findings: 2},
+		{instanceType: "x9.custom", region: "eu-central-1", findings: 0},
+		{instanceType: "unknown.large", region: "eu-central-1", findings: 0},
+	} {
+		t.Run(tc.instanceType+"/"+tc.region, func(t *testing.T) {
+			assert.Len(t, lintInstanceType(tc.instanceType, tc.region, instanceInfo), tc.findings)
+		})
+	}
+}
+
+func TestLintStrictInstanceTypes(t *testing.T) {
+	cluster := &api.Cluster{
+		Region: "xx-nowhere-1",
+		NodePools: []*api.NodePool{
+			{Name: "worker-default", Profile: "worker/default", InstanceType: "m5.large", MinSize: 1, MaxSize: 10},
+		},
+	}
+
+	findings := lintNodePools(cluster)
+	require.Len(t, findings, 1)
+	assert.Equal(t, lintSeverityWarning, findings[0].Severity)
+
+	cluster.ConfigItems = map[string]string{configKeyStrictInstanceTypes: "true"}
+	findings = lintNodePools(cluster)
+	require.Len(t, findings, 1)
+	assert.Equal(t, lintSeverityError, findings[0].Severity)
+}
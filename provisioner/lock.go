@@ -0,0 +1,135 @@
+package provisioner
+
+import (
+	"context"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+)
+
+// ClusterLocker leases locks of clusters shared by all instances of the
+// Cluster Lifecycle Manager, e.g. the awsExt.DynamoDBLocker. Lock acquires or
+// renews the lease and fails with an *awsExt.LockHeldError if the lock is
+// held by another instance.
+type ClusterLocker interface {
+	Lock(clusterID string) error
+	Unlock(clusterID string) error
+	ForceUnlock(clusterID string) error
+}
+
+// lockingProvisioner holds the lock of a cluster while it's provisioned or
+// decommissioned by the wrapped provisioner.
+type lockingProvisioner struct {
+	Provisioner
+	locker        ClusterLocker
+	renewInterval time.Duration
+	forceUnlock   bool
+}
+
+// NewLockingProvisioner returns a provisioner which locks the clusters while
+// they're provisioned or decommissioned by the provisioner, such that
+// concurrent instances of the Cluster Lifecycle Manager don't update the same
+// cluster. The lease of the lock is renewed in the renew interval. With
+// forceUnlock the lock is released before it's acquired, taking it over from
+// a holder which died without releasing it.
+func NewLockingProvisioner(provisioner Provisioner, locker ClusterLocker, renewInterval time.Duration, forceUnlock bool) Provisioner {
+	return &lockingProvisioner{
+		Provisioner:   provisioner,
+		locker:        locker,
+		renewInterval: renewInterval,
+		forceUnlock:   forceUnlock,
+	}
+}
+
+// Provision provisions the cluster while holding its lock.
+func (p *lockingProvisioner) Provision(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	return p.withLock(ctx, cluster, func(ctx context.Context) error {
+		return p.Provisioner.Provision(ctx, cluster, channelConfig)
+	})
+}
+
+// Decommission decommissions the cluster while holding its lock.
+func (p *lockingProvisioner) Decommission(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	return p.withLock(ctx, cluster, func(ctx context.Context) error {
+		return p.Provisioner.Decommission(ctx, cluster, channelConfig)
+	})
+}
+
+// Suspend suspends the cluster while holding its lock.
+func (p *lockingProvisioner) Suspend(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	return p.withLock(ctx, cluster, func(ctx context.Context) error {
+		return p.Provisioner.Suspend(ctx, cluster, channelConfig)
+	})
+}
+
+// Resume resumes the cluster while holding its lock.
+func (p *lockingProvisioner) Resume(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	return p.withLock(ctx, cluster, func(ctx context.Context) error {
+		return p.Provisioner.Resume(ctx, cluster, channelConfig)
+	})
+}
+
+// withLock calls fn while holding the lock of the cluster. The context passed
+// to fn is cancelled if the lock is lost to another holder.
+func (p *lockingProvisioner) withLock(ctx context.Context, cluster *api.Cluster, fn func(ctx context.Context) error) error {
+	logger := log.WithField("cluster", cluster.Alias)
+
+	if p.forceUnlock {
+		logger.Warnf("Forcing the release of the lock of cluster %s", cluster.ID)
+		err := p.locker.ForceUnlock(cluster.ID)
+		if err != nil {
+			return err
+		}
+	}
+
+	err := p.locker.Lock(cluster.ID)
+	if err != nil {
+		return err
+	}
+
+	lockCtx, cancel := context.WithCancel(ctx)
+	renewed := make(chan struct{})
+	go func() {
+		defer close(renewed)
+		p.renewLock(lockCtx, cancel, logger, cluster.ID)
+	}()
+
+	err = fn(lockCtx)
+	cancel()
+	<-renewed
+
+	unlockErr := p.locker.Unlock(cluster.ID)
+	if unlockErr != nil {
+		logger.Warnf("Failed to release the lock of cluster %s: %v", cluster.ID, unlockErr)
+	}
+	return err
+}
+
+// renewLock renews the lease of the lock of the cluster until the context is
+// done. If the lock was taken over by another holder the context is
+// cancelled, failed renewals are retried in the next interval.
+func (p *lockingProvisioner) renewLock(ctx context.Context, cancel context.CancelFunc, logger *log.Entry, clusterID string) {
+	ticker := time.NewTicker(p.renewInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			err := p.locker.Lock(clusterID)
+			if _, ok := err.(*awsExt.LockHeldError); ok {
+				logger.Errorf("Lost the lock of cluster %s, aborting: %v", clusterID, err)
+				cancel()
+				return
+			}
+			if err != nil {
+				logger.Warnf("Failed to renew the lock of cluster %s: %v", clusterID, err)
+			}
+		}
+	}
+}
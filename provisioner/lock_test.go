@@ -0,0 +1,147 @@
+package provisioner
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+)
+
+type clusterLockerStub struct {
+	mutex    sync.Mutex
+	holders  map[string]string
+	holder   string
+	renewals int
+}
+
+func (l *clusterLockerStub) Lock(clusterID string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if holder, ok := l.holders[clusterID]; ok && holder != l.holder {
+		return &awsExt.LockHeldError{ClusterID: clusterID, Holder: holder}
+	}
+	if _, ok := l.holders[clusterID]; ok {
+		l.renewals++
+	}
+	l.holders[clusterID] = l.holder
+	return nil
+}
+
+func (l *clusterLockerStub) Unlock(clusterID string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	if l.holders[clusterID] == l.holder {
+		delete(l.holders, clusterID)
+	}
+	return nil
+}
+
+func (l *clusterLockerStub) ForceUnlock(clusterID string) error {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	delete(l.holders, clusterID)
+	return nil
+}
+
+func (l *clusterLockerStub) setHolder(clusterID, holder string) {
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+	l.holders[clusterID] = holder
+}
+
+// provisionerStub runs provision for every provisioned cluster.
+type provisionerStub struct {
+	provision func(ctx context.Context) error
+}
+
+func (p *provisionerStub) Provision(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	return p.provision(ctx)
+}
+
+func (p *provisionerStub) Decommission(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	return p.provision(ctx)
+}
+
+func (p *provisionerStub) Suspend(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	return p.provision(ctx)
+}
+
+func (p *provisionerStub) Resume(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	return p.provision(ctx)
+}
+
+func (p *provisionerStub) Reconcile(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	return p.provision(ctx)
+}
+
+func (p *provisionerStub) Version(cluster *api.Cluster, channelConfig *channel.Config) (string, error) {
+	return "", nil
+}
+
+func (p *provisionerStub) Preflight(cluster *api.Cluster, channelConfig *channel.Config) (*PreflightReport, error) {
+	return &PreflightReport{}, nil
+}
+
+func TestLockingProvisioner(t *testing.T) {
+	cluster := &api.Cluster{ID: "kube-1", Alias: "kube-1"}
+	locker := &clusterLockerStub{holders: map[string]string{}, holder: "a"}
+
+	provisioned := false
+	stub := &provisionerStub{provision: func(ctx context.Context) error {
+		provisioned = true
+		assert.Equal(t, "a", locker.holders["kube-1"])
+		return nil
+	}}
+
+	// the cluster is locked while it's provisioned.
+	p := NewLockingProvisioner(stub, locker, time.Minute, false)
+	require.NoError(t, p.Provision(context.Background(), cluster, nil))
+	assert.True(t, provisioned)
+	assert.Empty(t, locker.holders)
+
+	// clusters locked by other holders aren't provisioned.
+	provisioned = false
+	locker.setHolder("kube-1", "b")
+	err := p.Provision(context.Background(), cluster, nil)
+	assert.IsType(t, &awsExt.LockHeldError{}, err)
+	assert.False(t, provisioned)
+
+	// the lock can be taken over.
+	p = NewLockingProvisioner(stub, locker, time.Minute, true)
+	require.NoError(t, p.Provision(context.Background(), cluster, nil))
+	assert.True(t, provisioned)
+}
+
+func TestLockingProvisionerLostLock(t *testing.T) {
+	cluster := &api.Cluster{ID: "kube-1", Alias: "kube-1"}
+	locker := &clusterLockerStub{holders: map[string]string{}, holder: "a"}
+
+	stub := &provisionerStub{provision: func(ctx context.Context) error {
+		// the lease is renewed until it's taken over.
+		for {
+			locker.mutex.Lock()
+			renewals := locker.renewals
+			locker.mutex.Unlock()
+			if renewals > 0 {
+				break
+			}
+			time.Sleep(time.Millisecond)
+		}
+		locker.setHolder("kube-1", "b")
+
+		<-ctx.Done()
+		return ctx.Err()
+	}}
+
+	p := NewLockingProvisioner(stub, locker, 10*time.Millisecond, false)
+	err := p.Provision(context.Background(), cluster, nil)
+	assert.Equal(t, context.Canceled, err)
+	assert.Equal(t, "b", locker.holders["kube-1"])
+}
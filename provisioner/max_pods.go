@@ -0,0 +1,40 @@
+package provisioner
+
+import (
+	"strings"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+)
+
+const (
+	// maxPodsValue is the userdata config value with the maximum number
+	// of pods of the nodes of the node pool.
+	maxPodsValue = "MAX_PODS"
+	// prefixDelegationConfigItemKey is the config item enabling prefix
+	// delegation of the VPC CNI, which assigns /28 prefixes instead of
+	// single IPs to the ENIs of the nodes.
+	prefixDelegationConfigItemKey = "vpc_cni_prefix_delegation"
+)
+
+// nodePoolMaxPods returns the maximum number of pods of the nodes of a node
+// pool: the max_pods of its kubelet config if set, otherwise the limit of
+// the ENIs of its instance type. It returns 0 if neither is known.
+func nodePoolMaxPods(nodePool *api.NodePool, prefixDelegation bool) int64 {
+	if nodePool.KubeletConfig != nil && nodePool.KubeletConfig.MaxPods > 0 {
+		return nodePool.KubeletConfig.MaxPods
+	}
+
+	instanceInfo, ok := awsExt.InstanceInfo()[nodePool.InstanceType]
+	if !ok {
+		return 0
+	}
+	return instanceInfo.MaxPods(prefixDelegation)
+}
+
+// prefixDelegation returns true if the userdata config enables prefix
+// delegation of the VPC CNI. Config items are part of the userdata config
+// with uppercase keys.
+func prefixDelegation(config map[string]string) bool {
+	return config[strings.ToUpper(prefixDelegationConfigItemKey)] == "true"
+}
@@ -0,0 +1,32 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestNodePoolMaxPods(t *testing.T) {
+	nodePool := &api.NodePool{Name: "worker-default", InstanceType: "m4.large"}
+	assert.EqualValues(t, 20, nodePoolMaxPods(nodePool, false))
+	assert.EqualValues(t, 110, nodePoolMaxPods(nodePool, true))
+
+	nodePool.KubeletConfig = &api.KubeletConfig{MaxPods: 58}
+	assert.EqualValues(t, 58, nodePoolMaxPods(nodePool, true))
+
+	assert.EqualValues(t, 0, nodePoolMaxPods(&api.NodePool{Name: "worker-default", InstanceType: "unknown.large"}, false))
+}
+
+func TestMaxPodsUserData(t *testing.T) {
+	config := nodePoolUserDataConfig(map[string]string{}, &api.NodePool{Name: "worker-default", InstanceType: "m4.large"})
+	assert.Equal(t, "20", config[maxPodsValue])
+
+	config = nodePoolUserDataConfig(map[string]string{"VPC_CNI_PREFIX_DELEGATION": "true"}, &api.NodePool{Name: "worker-default", InstanceType: "m4.large"})
+	assert.Equal(t, "110", config[maxPodsValue])
+
+	// the max pods of the cluster are kept for unknown instance types.
+	config = nodePoolUserDataConfig(map[string]string{maxPodsValue: "30"}, &api.NodePool{Name: "worker-default", InstanceType: "unknown.large"})
+	assert.Equal(t, "30", config[maxPodsValue])
+}
@@ -0,0 +1,102 @@
+package provisioner
+
+import (
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+)
+
+const (
+	metricsNamespace = "clm"
+	metricsSubsystem = "provisioner"
+
+	metricResultSuccess = "success"
+	metricResultError   = "error"
+
+	orphanedLaunchConfiguration   = "launch_configuration"
+	orphanedLaunchTemplateVersion = "launch_template_version"
+	orphanedVolume                = "volume"
+	orphanedNetworkInterface      = "network_interface"
+	orphanedClassicLoadBalancer   = "classic_load_balancer"
+	orphanedLoadBalancer          = "load_balancer"
+
+	templateKindManifest = "manifest"
+	templateKindUserData = "userdata"
+)
+
+var (
+	nodePoolUpdateDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "node_pool_update_duration_seconds",
+		Help:      "Duration of node pool updates by node pool profile and result.",
+		Buckets:   prometheus.ExponentialBuckets(30, 2, 10),
+	}, []string{"profile", "result"})
+
+	stackWaitDuration = prometheus.NewHistogramVec(prometheus.HistogramOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "stack_wait_duration_seconds",
+		Help:      "Time spent waiting for CloudFormation stacks to reach a final state by result.",
+		Buckets:   prometheus.ExponentialBuckets(10, 2, 10),
+	}, []string{"result"})
+
+	orphanedResources = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "orphaned_resources_total",
+		Help:      "Number of unused launch configurations, launch template versions and orphaned cluster resources found by the garbage collection.",
+	}, []string{"resource"})
+
+	templateRenderErrors = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "template_render_errors_total",
+		Help:      "Number of manifest and userdata templates which failed to render.",
+	}, []string{"kind"})
+
+	spotPriceLookups = prometheus.NewCounterVec(prometheus.CounterOpts{
+		Namespace: metricsNamespace,
+		Subsystem: metricsSubsystem,
+		Name:      "spot_price_lookups_total",
+		Help:      "Number of on-demand price lookups for the max price of spot node pools by result.",
+	}, []string{"result"})
+)
+
+// RegisterMetrics registers the metrics of the provisioners.
+func RegisterMetrics(registerer prometheus.Registerer) error {
+	for _, collector := range []prometheus.Collector{
+		nodePoolUpdateDuration,
+		stackWaitDuration,
+		orphanedResources,
+		templateRenderErrors,
+		spotPriceLookups,
+		nodePoolInstanceLaunches,
+		nodePoolInstanceTerminations,
+		nodePoolSpotInterruptions,
+		nodePoolBootstrapFailures,
+		nodePoolNodeLifetime,
+		nodePoolNodes,
+		nodePoolQuarantinedNodes,
+	} {
+		err := registerer.Register(collector)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// metricResult returns the result label value of an operation.
+func metricResult(err error) string {
+	if err != nil {
+		return metricResultError
+	}
+	return metricResultSuccess
+}
+
+// observeDuration observes the duration since start in the histogram with
+// the labels.
+func observeDuration(histogram *prometheus.HistogramVec, start time.Time, labels ...string) {
+	histogram.WithLabelValues(labels...).Observe(time.Since(start).Seconds())
+}
@@ -0,0 +1,37 @@
+package provisioner
+
+import (
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestRegisterMetrics(t *testing.T) {
+	registry := prometheus.NewRegistry()
+	require.NoError(t, RegisterMetrics(registry))
+
+	// metrics can't be registered twice.
+	assert.Error(t, RegisterMetrics(registry))
+
+	spotPriceLookups.WithLabelValues(metricResult(errors.New("failed"))).Inc()
+	observeDuration(stackWaitDuration, time.Now().Add(-time.Minute), metricResult(nil))
+
+	families, err := registry.Gather()
+	require.NoError(t, err)
+
+	names := make(map[string]bool)
+	for _, family := range families {
+		names[family.GetName()] = true
+	}
+	assert.True(t, names["clm_provisioner_spot_price_lookups_total"])
+	assert.True(t, names["clm_provisioner_stack_wait_duration_seconds"])
+}
+
+func TestMetricResult(t *testing.T) {
+	assert.Equal(t, "success", metricResult(nil))
+	assert.Equal(t, "error", metricResult(errors.New("failed")))
+}
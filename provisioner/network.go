@@ -0,0 +1,230 @@
+package provisioner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	networkModeConfigItemKey = "network_mode"
+	networkTagsConfigItemKey = "network_tags"
+
+	// networkModeDefaultVPC provisions the cluster into the subnets of the
+	// default VPC of the account.
+	networkModeDefaultVPC = "default-vpc"
+	// networkModeExisting provisions the cluster into the subnets, route
+	// tables and security groups having the network tags of the cluster,
+	// e.g. of a centrally managed VPC.
+	networkModeExisting = "existing"
+
+	// defaultRouteCIDR is the destination of the route the subnets of an
+	// existing network need to reach the outside of the VPC.
+	defaultRouteCIDR = "0.0.0.0/0"
+)
+
+// clusterNetwork is the existing network of a cluster discovered by its tags.
+type clusterNetwork struct {
+	VPCID          string
+	Subnets        []*ec2.Subnet
+	RouteTables    []*ec2.RouteTable
+	SecurityGroups []string
+}
+
+// newNetworkTags returns the tags identifying the existing network of the
+// cluster, or nil if the cluster uses the default VPC.
+func newNetworkTags(cluster *api.Cluster) (map[string]string, error) {
+	tags := cluster.ConfigItems[networkTagsConfigItemKey]
+
+	switch mode := cluster.ConfigItems[networkModeConfigItemKey]; mode {
+	case "", networkModeDefaultVPC:
+		if tags != "" {
+			return nil, fmt.Errorf("%s requires %s %s", networkTagsConfigItemKey, networkModeConfigItemKey, networkModeExisting)
+		}
+		return nil, nil
+	case networkModeExisting:
+	default:
+		return nil, fmt.Errorf("invalid %s %s, must be %s or %s", networkModeConfigItemKey, mode, networkModeDefaultVPC, networkModeExisting)
+	}
+
+	parsed := make(map[string]string)
+	for _, tag := range strings.Split(tags, ",") {
+		if tag == "" {
+			continue
+		}
+
+		parts := strings.SplitN(tag, "=", 2)
+		if len(parts) != 2 || parts[0] == "" {
+			return nil, fmt.Errorf("invalid %s '%s', must be key=value pairs", networkTagsConfigItemKey, tag)
+		}
+		parsed[parts[0]] = parts[1]
+	}
+
+	if len(parsed) == 0 {
+		return nil, fmt.Errorf("%s %s requires %s", networkModeConfigItemKey, networkModeExisting, networkTagsConfigItemKey)
+	}
+	return parsed, nil
+}
+
+// networkTagFilters returns the EC2 filters matching resources with all
+// network tags.
+func networkTagFilters(tags map[string]string) []*ec2.Filter {
+	keys := make([]string, 0, len(tags))
+	for key := range tags {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	filters := make([]*ec2.Filter, 0, len(keys))
+	for _, key := range keys {
+		filters = append(filters, &ec2.Filter{
+			Name:   aws.String("tag:" + key),
+			Values: []*string{aws.String(tags[key])},
+		})
+	}
+	return filters
+}
+
+// discoverNetwork discovers the subnets, route tables and security groups of
+// the existing network of the cluster by its network tags. The subnets must
+// be in a single VPC.
+func (a *awsAdapter) discoverNetwork() (*clusterNetwork, error) {
+	subnetResp, err := a.ec2Client.DescribeSubnets(&ec2.DescribeSubnetsInput{
+		Filters: networkTagFilters(a.networkTags),
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(subnetResp.Subnets) == 0 {
+		return nil, fmt.Errorf("no subnets found with the %s", networkTagsConfigItemKey)
+	}
+
+	network := &clusterNetwork{
+		VPCID:   aws.StringValue(subnetResp.Subnets[0].VpcId),
+		Subnets: subnetResp.Subnets,
+	}
+	for _, subnet := range network.Subnets {
+		if vpc := aws.StringValue(subnet.VpcId); vpc != network.VPCID {
+			return nil, fmt.Errorf("subnets with the %s found in multiple VPCs: %s and %s", networkTagsConfigItemKey, network.VPCID, vpc)
+		}
+	}
+
+	vpcFilter := &ec2.Filter{Name: aws.String("vpc-id"), Values: []*string{aws.String(network.VPCID)}}
+
+	routeTableResp, err := a.ec2Client.DescribeRouteTables(&ec2.DescribeRouteTablesInput{
+		Filters: append(networkTagFilters(a.networkTags), vpcFilter),
+	})
+	if err != nil {
+		return nil, err
+	}
+	network.RouteTables = routeTableResp.RouteTables
+
+	securityGroupResp, err := a.ec2Client.DescribeSecurityGroups(&ec2.DescribeSecurityGroupsInput{
+		Filters: append(networkTagFilters(a.networkTags), vpcFilter),
+	})
+	if err != nil {
+		return nil, err
+	}
+	for _, group := range securityGroupResp.SecurityGroups {
+		network.SecurityGroups = append(network.SecurityGroups, aws.StringValue(group.GroupId))
+	}
+	sort.Strings(network.SecurityGroups)
+
+	return network, nil
+}
+
+// validate returns an error if the existing network lacks the connectivity
+// required by the nodes: every subnet must be associated with one of the
+// discovered route tables, which must route the traffic leaving the VPC to a
+// gateway, and at least one security group must be discovered.
+func (n *clusterNetwork) validate() error {
+	if len(n.SecurityGroups) == 0 {
+		return fmt.Errorf("no security groups of VPC %s found with the %s", n.VPCID, networkTagsConfigItemKey)
+	}
+
+	for _, subnet := range n.Subnets {
+		id := aws.StringValue(subnet.SubnetId)
+
+		routeTable := n.subnetRouteTable(id)
+		if routeTable == nil {
+			return fmt.Errorf("subnet %s isn't associated with a route table found with the %s", id, networkTagsConfigItemKey)
+		}
+
+		if !hasDefaultRoute(routeTable) {
+			return fmt.Errorf("route table %s of subnet %s has no active %s route", aws.StringValue(routeTable.RouteTableId), id, defaultRouteCIDR)
+		}
+	}
+	return nil
+}
+
+// subnetRouteTable returns the discovered route table explicitly associated
+// with the subnet, otherwise the main route table of the VPC if it was
+// discovered.
+func (n *clusterNetwork) subnetRouteTable(subnetID string) *ec2.RouteTable {
+	var main *ec2.RouteTable
+	for _, routeTable := range n.RouteTables {
+		for _, association := range routeTable.Associations {
+			if aws.StringValue(association.SubnetId) == subnetID {
+				return routeTable
+			}
+			if aws.BoolValue(association.Main) {
+				main = routeTable
+			}
+		}
+	}
+	return main
+}
+
+// hasDefaultRoute returns true if the route table has an active route for the
+// traffic leaving the VPC, e.g. to an internet, NAT or transit gateway.
+func hasDefaultRoute(routeTable *ec2.RouteTable) bool {
+	for _, route := range routeTable.Routes {
+		if aws.StringValue(route.DestinationCidrBlock) == defaultRouteCIDR && aws.StringValue(route.State) == ec2.RouteStateActive {
+			return true
+		}
+	}
+	return false
+}
+
+// args returns the stack parameters passing the IDs of the existing network
+// to the cluster stack.
+func (n *clusterNetwork) args() []string {
+	subnets := make([]string, 0, len(n.Subnets))
+	for _, subnet := range n.Subnets {
+		subnets = append(subnets, aws.StringValue(subnet.SubnetId))
+	}
+	sort.Strings(subnets)
+
+	routeTables := make([]string, 0, len(n.RouteTables))
+	for _, routeTable := range n.RouteTables {
+		routeTables = append(routeTables, aws.StringValue(routeTable.RouteTableId))
+	}
+	sort.Strings(routeTables)
+
+	return []string{
+		fmt.Sprintf("VpcID=%s", n.VPCID),
+		fmt.Sprintf("Subnets=%s", strings.Join(subnets, ",")),
+		fmt.Sprintf("RouteTables=%s", strings.Join(routeTables, ",")),
+		fmt.Sprintf("SecurityGroups=%s", strings.Join(n.SecurityGroups, ",")),
+	}
+}
+
+// checkNetwork verifies the connectivity of the existing network of the
+// cluster, if it uses one.
+func (a *awsAdapter) checkNetwork() error {
+	if a.networkTags == nil {
+		return nil
+	}
+
+	network, err := a.discoverNetwork()
+	if err != nil {
+		return err
+	}
+	return network.validate()
+}
@@ -0,0 +1,168 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type networkEC2APIStub struct {
+	ec2API
+	subnets        []*ec2.Subnet
+	routeTables    []*ec2.RouteTable
+	securityGroups []*ec2.SecurityGroup
+	filters        []*ec2.Filter
+}
+
+func (e *networkEC2APIStub) DescribeSubnets(input *ec2.DescribeSubnetsInput) (*ec2.DescribeSubnetsOutput, error) {
+	e.filters = input.Filters
+	return &ec2.DescribeSubnetsOutput{Subnets: e.subnets}, nil
+}
+
+func (e *networkEC2APIStub) DescribeRouteTables(input *ec2.DescribeRouteTablesInput) (*ec2.DescribeRouteTablesOutput, error) {
+	return &ec2.DescribeRouteTablesOutput{RouteTables: e.routeTables}, nil
+}
+
+func (e *networkEC2APIStub) DescribeSecurityGroups(input *ec2.DescribeSecurityGroupsInput) (*ec2.DescribeSecurityGroupsOutput, error) {
+	return &ec2.DescribeSecurityGroupsOutput{SecurityGroups: e.securityGroups}, nil
+}
+
+func TestNewNetworkTags(t *testing.T) {
+	for _, tc := range []struct {
+		msg         string
+		configItems map[string]string
+		expected    map[string]string
+		valid       bool
+	}{
+		{
+			msg:   "default VPC by default",
+			valid: true,
+		},
+		{
+			msg:         "default VPC",
+			configItems: map[string]string{networkModeConfigItemKey: networkModeDefaultVPC},
+			valid:       true,
+		},
+		{
+			msg: "existing network",
+			configItems: map[string]string{
+				networkModeConfigItemKey: networkModeExisting,
+				networkTagsConfigItemKey: "network=shared,team=platform",
+			},
+			expected: map[string]string{"network": "shared", "team": "platform"},
+			valid:    true,
+		},
+		{
+			msg:         "existing network without tags",
+			configItems: map[string]string{networkModeConfigItemKey: networkModeExisting},
+		},
+		{
+			msg: "invalid tags",
+			configItems: map[string]string{
+				networkModeConfigItemKey: networkModeExisting,
+				networkTagsConfigItemKey: "shared",
+			},
+		},
+		{
+			msg:         "tags without existing network",
+			configItems: map[string]string{networkTagsConfigItemKey: "network=shared"},
+		},
+		{
+			msg:         "unknown mode",
+			configItems: map[string]string{networkModeConfigItemKey: "managed"},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			tags, err := newNetworkTags(&api.Cluster{ConfigItems: tc.configItems})
+			if !tc.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, tags)
+		})
+	}
+}
+
+func networkRouteTable(id string, main bool, subnets []string, state string) *ec2.RouteTable {
+	routeTable := &ec2.RouteTable{
+		RouteTableId: aws.String(id),
+		Routes: []*ec2.Route{
+			{DestinationCidrBlock: aws.String("10.0.0.0/16"), GatewayId: aws.String("local"), State: aws.String(ec2.RouteStateActive)},
+			{DestinationCidrBlock: aws.String(defaultRouteCIDR), NatGatewayId: aws.String("nat-1"), State: aws.String(state)},
+		},
+	}
+	if main {
+		routeTable.Associations = append(routeTable.Associations, &ec2.RouteTableAssociation{Main: aws.Bool(true)})
+	}
+	for _, subnet := range subnets {
+		routeTable.Associations = append(routeTable.Associations, &ec2.RouteTableAssociation{SubnetId: aws.String(subnet)})
+	}
+	return routeTable
+}
+
+func TestDiscoverNetwork(t *testing.T) {
+	subnets := []*ec2.Subnet{
+		{SubnetId: aws.String("subnet-b"), VpcId: aws.String("vpc-1"), AvailabilityZone: aws.String("eu-central-1b")},
+		{SubnetId: aws.String("subnet-a"), VpcId: aws.String("vpc-1"), AvailabilityZone: aws.String("eu-central-1a")},
+	}
+	client := &networkEC2APIStub{
+		subnets:        subnets,
+		routeTables:    []*ec2.RouteTable{networkRouteTable("rtb-1", false, []string{"subnet-a", "subnet-b"}, ec2.RouteStateActive)},
+		securityGroups: []*ec2.SecurityGroup{{GroupId: aws.String("sg-2")}, {GroupId: aws.String("sg-1")}},
+	}
+	a := &awsAdapter{ec2Client: client, networkTags: map[string]string{"network": "shared"}}
+
+	network, err := a.discoverNetwork()
+	require.NoError(t, err)
+	require.NoError(t, network.validate())
+	assert.Equal(t, []*ec2.Filter{{Name: aws.String("tag:network"), Values: []*string{aws.String("shared")}}}, client.filters)
+	assert.Equal(t, []string{
+		"VpcID=vpc-1",
+		"Subnets=subnet-a,subnet-b",
+		"RouteTables=rtb-1",
+		"SecurityGroups=sg-1,sg-2",
+	}, network.args())
+
+	discovered, err := a.GetSubnets()
+	require.NoError(t, err)
+	assert.Equal(t, subnets, discovered)
+
+	// subnets without an explicit association use the main route table.
+	client.routeTables = []*ec2.RouteTable{
+		networkRouteTable("rtb-main", true, nil, ec2.RouteStateActive),
+		networkRouteTable("rtb-1", false, []string{"subnet-a"}, ec2.RouteStateActive),
+	}
+	network, err = a.discoverNetwork()
+	require.NoError(t, err)
+	assert.NoError(t, network.validate())
+
+	// subnets must reach the outside of the VPC.
+	client.routeTables = []*ec2.RouteTable{networkRouteTable("rtb-1", false, []string{"subnet-a", "subnet-b"}, ec2.RouteStateBlackhole)}
+	network, err = a.discoverNetwork()
+	require.NoError(t, err)
+	assert.Error(t, network.validate())
+
+	client.routeTables = []*ec2.RouteTable{networkRouteTable("rtb-1", false, []string{"subnet-a"}, ec2.RouteStateActive)}
+	network, err = a.discoverNetwork()
+	require.NoError(t, err)
+	assert.Error(t, network.validate())
+	assert.Error(t, a.checkNetwork())
+
+	// the subnets must be in a single VPC.
+	client.subnets = append(client.subnets, &ec2.Subnet{SubnetId: aws.String("subnet-c"), VpcId: aws.String("vpc-2")})
+	_, err = a.discoverNetwork()
+	assert.Error(t, err)
+
+	client.subnets = nil
+	_, err = a.discoverNetwork()
+	assert.Error(t, err)
+
+	// clusters in the default VPC aren't checked.
+	assert.NoError(t, (&awsAdapter{}).checkNetwork())
+}
@@ -0,0 +1,364 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"os/exec"
+	"path"
+	"strings"
+	"text/template"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+)
+
+const (
+	// nodePoolHookPhasePreProvision runs the hooks before a node pool is
+	// provisioned.
+	nodePoolHookPhasePreProvision = "pre-provision"
+	// nodePoolHookPhasePostProvision runs the hooks after a node pool was
+	// provisioned successfully.
+	nodePoolHookPhasePostProvision = "post-provision"
+	// nodePoolHookPhasePreDecommission runs the hooks before a node pool
+	// removed from the cluster is decommissioned.
+	nodePoolHookPhasePreDecommission = "pre-decommission"
+
+	// nodePoolHooksFile is the file in the directory of a node pool
+	// profile declaring the hooks of its node pools.
+	nodePoolHooksFile = "hooks.yaml"
+	// nodePoolHooksConfigItemKey is the config item declaring the hooks
+	// of all node pools of a cluster, in the format of the
+	// nodePoolHooksFile.
+	nodePoolHooksConfigItemKey = "node_pool_hooks"
+
+	// defaultNodePoolHookTimeout is the time a hook may run unless it
+	// specifies a timeout.
+	defaultNodePoolHookTimeout = 5 * time.Minute
+)
+
+// nodePoolHook is a hook run in the phases of the provisioning of a node
+// pool. It either posts the nodePoolHookRequest to URL or creates the Job rendered
+// from the template Job in the cluster and waits for it to complete.
+type nodePoolHook struct {
+	Name   string   `yaml:"name"`
+	Phases []string `yaml:"phases"`
+	URL    string   `yaml:"url"`
+	// Job is the path of the Job manifest template relative to the
+	// cluster directory of the channel.
+	Job     string `yaml:"job"`
+	Timeout string `yaml:"timeout"`
+	// IgnoreFailure only logs a failure of the hook instead of failing
+	// the node pool.
+	IgnoreFailure bool `yaml:"ignore_failure"`
+
+	timeout time.Duration
+}
+
+// nodePoolHookRequest is posted as JSON to the URL of a hook. It doesn't
+// contain the config items of the cluster, which may be secrets.
+type nodePoolHookRequest struct {
+	Phase        string        `json:"phase"`
+	ClusterID    string        `json:"cluster_id"`
+	ClusterAlias string        `json:"cluster_alias"`
+	Environment  string        `json:"environment"`
+	Region       string        `json:"region"`
+	NodePool     *api.NodePool `json:"node_pool"`
+}
+
+// nodePoolHookJobData is the data the Job templates of the hooks are
+// rendered with.
+type nodePoolHookJobData struct {
+	Phase    string
+	Cluster  *api.Cluster
+	NodePool *api.NodePool
+}
+
+// runs returns true if the hook is run in phase.
+func (h *nodePoolHook) runs(phase string) bool {
+	for _, p := range h.Phases {
+		if p == phase {
+			return true
+		}
+	}
+	return false
+}
+
+// validate checks the hook and parses its timeout.
+func (h *nodePoolHook) validate() error {
+	if h.Name == "" {
+		return fmt.Errorf("hook without name")
+	}
+
+	if (h.URL == "") == (h.Job == "") {
+		return fmt.Errorf("hook %s must specify either url or job", h.Name)
+	}
+
+	for _, phase := range h.Phases {
+		switch phase {
+		case nodePoolHookPhasePreProvision, nodePoolHookPhasePostProvision, nodePoolHookPhasePreDecommission:
+		default:
+			return fmt.Errorf("hook %s has invalid phase %s", h.Name, phase)
+		}
+	}
+
+	h.timeout = defaultNodePoolHookTimeout
+	if h.Timeout != "" {
+		timeout, err := time.ParseDuration(h.Timeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("hook %s has invalid timeout %s", h.Name, h.Timeout)
+		}
+		h.timeout = timeout
+	}
+	return nil
+}
+
+// parseNodePoolHooks parses and validates the hooks declared in data.
+func parseNodePoolHooks(data []byte) ([]*nodePoolHook, error) {
+	var hooks []*nodePoolHook
+	err := yaml.Unmarshal(data, &hooks)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, hook := range hooks {
+		err = hook.validate()
+		if err != nil {
+			return nil, err
+		}
+	}
+	return hooks, nil
+}
+
+// loadNodePoolHooks returns the hooks of a node pool: the ones of its profile,
+// declared in the hooks.yaml of the profile or its closest base profile,
+// followed by the ones of the cluster.
+func loadNodePoolHooks(basePath string, cluster *api.Cluster, nodePool *api.NodePool) ([]*nodePoolHook, error) {
+	var hooks []*nodePoolHook
+	if nodePool.Profile != "" {
+		file, err := profileFile(basePath, nodePool.Profile, nodePoolHooksFile)
+		if err != nil {
+			return nil, err
+		}
+
+		data, err := ioutil.ReadFile(file)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		hooks, err = parseNodePoolHooks(data)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s of profile %s: %v", nodePoolHooksFile, nodePool.Profile, err)
+		}
+	}
+
+	if value, ok := cluster.ConfigItems[nodePoolHooksConfigItemKey]; ok {
+		clusterHooks, err := parseNodePoolHooks([]byte(value))
+		if err != nil {
+			return nil, fmt.Errorf("invalid config item %s: %v", nodePoolHooksConfigItemKey, err)
+		}
+		hooks = append(hooks, clusterHooks...)
+	}
+	return hooks, nil
+}
+
+// nodePoolHookRunner runs the hooks of the node pools of a cluster.
+type nodePoolHookRunner struct {
+	logger   *log.Entry
+	basePath string
+	cluster  *api.Cluster
+	// kubeconfig is used to create the Jobs of the hooks. Job hooks fail
+	// if it's nil.
+	kubeconfig *kubernetes.Kubeconfig
+	client     *http.Client
+	dryRun     bool
+}
+
+func newNodePoolHookRunner(logger *log.Entry, channelConfig *channel.Config, cluster *api.Cluster, kubeconfig *kubernetes.Kubeconfig, dryRun bool) *nodePoolHookRunner {
+	return &nodePoolHookRunner{
+		logger:     logger,
+		basePath:   path.Join(channelConfig.Path, "cluster"),
+		cluster:    cluster,
+		kubeconfig: kubeconfig,
+		client:     http.DefaultClient,
+		dryRun:     dryRun,
+	}
+}
+
+// run runs the hooks of the node pool for phase in order. The first failing
+// hook fails the phase, unless it ignores failures.
+func (r *nodePoolHookRunner) run(ctx context.Context, phase string, nodePool *api.NodePool) error {
+	hooks, err := loadNodePoolHooks(r.basePath, r.cluster, nodePool)
+	if err != nil {
+		return err
+	}
+
+	for _, hook := range hooks {
+		if !hook.runs(phase) {
+			continue
+		}
+
+		if r.dryRun {
+			r.logger.Infof("Would run hook %s of node pool %s in phase %s", hook.Name, nodePool.Name, phase)
+			continue
+		}
+
+		r.logger.Infof("Running hook %s of node pool %s in phase %s", hook.Name, nodePool.Name, phase)
+		hookCtx, cancel := context.WithTimeout(ctx, hook.timeout)
+		if hook.URL != "" {
+			err = r.callURL(hookCtx, hook, phase, nodePool)
+		} else {
+			err = r.runJob(hookCtx, hook, phase, nodePool)
+		}
+		cancel()
+
+		if err != nil {
+			err = fmt.Errorf("hook %s failed in phase %s: %v", hook.Name, phase, err)
+			if !hook.IgnoreFailure {
+				return err
+			}
+			r.logger.Warnf("Ignoring failed hook of node pool %s: %v", nodePool.Name, err)
+		}
+	}
+	return nil
+}
+
+// callURL posts the hook request to the URL of the hook. Every status other
+// than 2xx fails the hook.
+func (r *nodePoolHookRunner) callURL(ctx context.Context, hook *nodePoolHook, phase string, nodePool *api.NodePool) error {
+	body, err := json.Marshal(&nodePoolHookRequest{
+		Phase:        phase,
+		ClusterID:    r.cluster.ID,
+		ClusterAlias: r.cluster.Alias,
+		Environment:  r.cluster.Environment,
+		Region:       r.cluster.Region,
+		NodePool:     nodePool,
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest(http.MethodPost, hook.URL, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	resp, err := r.client.Do(req.WithContext(ctx))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	return nil
+}
+
+// renderJob renders the Job manifest of the hook.
+func (r *nodePoolHookRunner) renderJob(hook *nodePoolHook, phase string, nodePool *api.NodePool) (string, error) {
+	return renderJobTemplate(r.basePath, nodePoolHooksFile, hook.Job, r.cluster, &nodePoolHookJobData{Phase: phase, Cluster: r.cluster, NodePool: nodePool})
+}
+
+// runJob creates the Job of the hook in the cluster and waits until it's
+// complete or the hook timed out.
+func (r *nodePoolHookRunner) runJob(ctx context.Context, hook *nodePoolHook, phase string, nodePool *api.NodePool) error {
+	if r.kubeconfig == nil {
+		return fmt.Errorf("job hooks require the API server of the cluster")
+	}
+
+	manifest, err := r.renderJob(hook, phase, nodePool)
+	if err != nil {
+		return err
+	}
+
+	return runJobManifest(ctx, r.logger, r.kubeconfig, manifest, hook.Job, hook.timeout)
+}
+
+// renderJobTemplate renders the Job manifest template job, whose path is
+// relative to the file referencing it in basePath, with data.
+func renderJobTemplate(basePath, referrer, job string, cluster *api.Cluster, data interface{}) (string, error) {
+	templateContext := newApplyContext(basePath)
+	file, err := resolveTemplatePath(templateContext, path.Join(basePath, referrer), job)
+	if err != nil {
+		return "", err
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		return "", err
+	}
+
+	t, err := template.New(file).Option("missingkey=error").Funcs(templateFuncs(templateContext, file, cluster)).Parse(string(content))
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	err = t.Execute(&out, data)
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// runJobManifest creates the Job of the manifest rendered from job in the
+// cluster and waits until it's complete or the timeout passed.
+func runJobManifest(ctx context.Context, logger *log.Entry, kubeconfig *kubernetes.Kubeconfig, manifest, job string, timeout time.Duration) error {
+	token, err := kubeconfig.TokenSource.Token()
+	if err != nil {
+		return err
+	}
+
+	kubectl := func(stdin string, args ...string) (string, error) {
+		args = append([]string{
+			fmt.Sprintf("--server=%s", kubeconfig.Server),
+			fmt.Sprintf("--token=%s", token.AccessToken),
+		}, args...)
+
+		var stdout, stderr bytes.Buffer
+		cmd := exec.CommandContext(ctx, "kubectl", args...)
+		// prevent kubectl to find the in-cluster config
+		cmd.Env = []string{}
+		cmd.Stdin = strings.NewReader(stdin)
+		cmd.Stdout = &stdout
+		cmd.Stderr = &stderr
+
+		err := cmd.Run()
+		if err != nil {
+			return "", fmt.Errorf("%v: %s", err, strings.TrimSpace(stderr.String()))
+		}
+		return strings.TrimSpace(stdout.String()), nil
+	}
+
+	// the Job may use generateName, so its name is only known once it's
+	// created.
+	created, err := kubectl(manifest, "create", "-f", "-", "-o", "jsonpath={.kind}/{.metadata.namespace}/{.metadata.name}")
+	if err != nil {
+		return err
+	}
+
+	parts := strings.Split(created, "/")
+	if len(parts) != 3 || parts[0] != "Job" {
+		return fmt.Errorf("manifest %s doesn't contain a single Job", job)
+	}
+
+	namespace := parts[1]
+	if namespace == "" {
+		namespace = defaultNamespace
+	}
+
+	logger.Infof("Waiting for job %s/%s of %s", namespace, parts[2], job)
+	_, err = kubectl("", "wait", "--namespace", namespace, "--for=condition=complete", fmt.Sprintf("--timeout=%s", timeout), "job/"+parts[2])
+	return err
+}
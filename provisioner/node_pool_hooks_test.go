@@ -0,0 +1,175 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+func TestLoadNodePoolHooks(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node-pool-hooks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	basePath := path.Join(dir, "cluster")
+	require.NoError(t, os.MkdirAll(path.Join(basePath, "node-pools", "worker-default"), 0755))
+	require.NoError(t, os.MkdirAll(path.Join(basePath, "node-pools", "worker-gpu"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(basePath, "node-pools", "worker-default", nodePoolHooksFile), []byte(`
+- name: warm-cache
+  phases: [post-provision]
+  job: hooks/warm-cache.yaml
+  timeout: 10m
+`), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(basePath, "node-pools", "worker-gpu", profileConfigFile), []byte("base: worker-default\n"), 0644))
+
+	cluster := &api.Cluster{ConfigItems: map[string]string{
+		nodePoolHooksConfigItemKey: `[{"name": "inventory", "phases": ["pre-provision", "pre-decommission"], "url": "https://inventory.example.org"}]`,
+	}}
+
+	hooks, err := loadNodePoolHooks(basePath, cluster, &api.NodePool{Name: "gpu", Profile: "worker-gpu"})
+	require.NoError(t, err)
+	require.Len(t, hooks, 2)
+	assert.Equal(t, "warm-cache", hooks[0].Name)
+	assert.Equal(t, "10m0s", hooks[0].timeout.String())
+	assert.Equal(t, "inventory", hooks[1].Name)
+	assert.Equal(t, defaultNodePoolHookTimeout, hooks[1].timeout)
+
+	// removed node pools only run the hooks of the cluster.
+	hooks, err = loadNodePoolHooks(basePath, cluster, &api.NodePool{Name: "removed"})
+	require.NoError(t, err)
+	require.Len(t, hooks, 1)
+	assert.Equal(t, "inventory", hooks[0].Name)
+}
+
+func TestParseNodePoolHooks(t *testing.T) {
+	for _, tc := range []struct {
+		msg   string
+		hooks string
+	}{
+		{
+			msg:   "missing name",
+			hooks: `[{"phases": ["pre-provision"], "url": "https://example.org"}]`,
+		},
+		{
+			msg:   "url and job",
+			hooks: `[{"name": "foo", "phases": ["pre-provision"], "url": "https://example.org", "job": "hooks/foo.yaml"}]`,
+		},
+		{
+			msg:   "neither url nor job",
+			hooks: `[{"name": "foo", "phases": ["pre-provision"]}]`,
+		},
+		{
+			msg:   "invalid phase",
+			hooks: `[{"name": "foo", "phases": ["post-decommission"], "url": "https://example.org"}]`,
+		},
+		{
+			msg:   "invalid timeout",
+			hooks: `[{"name": "foo", "phases": ["pre-provision"], "url": "https://example.org", "timeout": "-1m"}]`,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			_, err := parseNodePoolHooks([]byte(tc.hooks))
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRunNodePoolHooks(t *testing.T) {
+	var requests []*nodePoolHookRequest
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request nodePoolHookRequest
+		require.NoError(t, json.NewDecoder(r.Body).Decode(&request))
+		requests = append(requests, &request)
+		if r.URL.Path == "/fail" {
+			w.WriteHeader(http.StatusInternalServerError)
+		}
+	}))
+	defer server.Close()
+
+	cluster := &api.Cluster{
+		ID:    "aws:123456789012:eu-central-1:kube-1",
+		Alias: "kube-1",
+		ConfigItems: map[string]string{
+			nodePoolHooksConfigItemKey: `
+- name: inventory
+  phases: [pre-provision, post-provision]
+  url: ` + server.URL + `/inventory
+- name: cmdb
+  phases: [post-provision]
+  url: ` + server.URL + `/fail
+  ignore_failure: true
+- name: drain-check
+  phases: [pre-decommission]
+  url: ` + server.URL + `/fail
+`,
+			"secret": "hunter2",
+		},
+	}
+	nodePool := &api.NodePool{Name: "default-worker"}
+
+	runner := newNodePoolHookRunner(log.WithField("test", true), &channel.Config{Path: "/does/not/exist"}, cluster, nil, false)
+	require.NoError(t, runner.run(context.Background(), nodePoolHookPhasePreProvision, nodePool))
+	require.NoError(t, runner.run(context.Background(), nodePoolHookPhasePostProvision, nodePool))
+	require.Len(t, requests, 3)
+	assert.Equal(t, nodePoolHookPhasePreProvision, requests[0].Phase)
+	assert.Equal(t, "kube-1", requests[0].ClusterAlias)
+	assert.Equal(t, "default-worker", requests[0].NodePool.Name)
+
+	err := runner.run(context.Background(), nodePoolHookPhasePreDecommission, nodePool)
+	assert.Error(t, err)
+
+	// dry runs only log the hooks.
+	requests = nil
+	runner = newNodePoolHookRunner(log.WithField("test", true), &channel.Config{Path: "/does/not/exist"}, cluster, nil, true)
+	require.NoError(t, runner.run(context.Background(), nodePoolHookPhasePreDecommission, nodePool))
+	assert.Empty(t, requests)
+}
+
+func TestRenderNodePoolHookJob(t *testing.T) {
+	dir, err := ioutil.TempDir("", "node-pool-hooks")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.MkdirAll(path.Join(dir, "cluster", "hooks"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "cluster", "hooks", "warm-cache.yaml"), []byte(`apiVersion: batch/v1
+kind: Job
+metadata:
+  generateName: warm-cache-{{ .NodePool.Name }}-
+  namespace: kube-system
+spec:
+  template:
+    spec:
+      containers:
+      - name: warm-cache
+        image: {{ configItem "warm_cache_image" "warm-cache:latest" }}
+        args: [{{ .Phase }}, {{ .Cluster.Alias }}]
+`), 0644))
+
+	cluster := &api.Cluster{Alias: "kube-1", ConfigItems: map[string]string{}}
+	runner := newNodePoolHookRunner(log.WithField("test", true), &channel.Config{Path: dir}, cluster, nil, false)
+
+	manifest, err := runner.renderJob(&nodePoolHook{Name: "warm-cache", Job: "hooks/warm-cache.yaml"}, nodePoolHookPhasePostProvision, &api.NodePool{Name: "default-worker"})
+	require.NoError(t, err)
+	assert.Contains(t, manifest, "generateName: warm-cache-default-worker-")
+	assert.Contains(t, manifest, "image: warm-cache:latest")
+	assert.Contains(t, manifest, "args: [post-provision, kube-1]")
+
+	_, err = runner.renderJob(&nodePoolHook{Name: "escape", Job: "../../etc/passwd"}, nodePoolHookPhasePostProvision, &api.NodePool{Name: "default-worker"})
+	assert.Error(t, err)
+
+	// Job hooks need the API server of the cluster.
+	err = runner.runJob(context.Background(), &nodePoolHook{Name: "warm-cache", Job: "hooks/warm-cache.yaml"}, nodePoolHookPhasePostProvision, &api.NodePool{Name: "default-worker"})
+	assert.Error(t, err)
+}
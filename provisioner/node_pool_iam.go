@@ -0,0 +1,217 @@
+package provisioner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"text/template"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// nodePoolIAMPolicyFile is the policy template in the directory of a
+	// node pool profile. Node pools whose profile has one get their own
+	// IAM role instead of the role of the stack.
+	nodePoolIAMPolicyFile = "iam-policy.json"
+
+	resourceTypeIAMRole            = "AWS::IAM::Role"
+	resourceTypeIAMInstanceProfile = "AWS::IAM::InstanceProfile"
+)
+
+// nodePoolIAMPolicyData is the data the policy templates are rendered with.
+type nodePoolIAMPolicyData struct {
+	Cluster   *api.Cluster
+	NodePool  *api.NodePool
+	AccountID string
+	Region    string
+}
+
+// renderNodePoolIAMPolicy renders the policy template of the profile of the
+// node pool. It returns nil if the profile doesn't have a policy template.
+func renderNodePoolIAMPolicy(basePath string, cluster *api.Cluster, nodePool *api.NodePool) (interface{}, error) {
+	file, err := profileFile(basePath, nodePool.Profile, nodePoolIAMPolicyFile)
+	if err != nil {
+		return nil, err
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	t, err := template.New(file).Option("missingkey=error").Funcs(template.FuncMap{"json": jsonString}).Parse(string(content))
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	err = t.Execute(&out, &nodePoolIAMPolicyData{
+		Cluster:   cluster,
+		NodePool:  nodePool,
+		AccountID: getAWSAccountID(cluster.InfrastructureAccount),
+		Region:    cluster.Region,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var policy interface{}
+	err = json.Unmarshal(out.Bytes(), &policy)
+	if err != nil {
+		return nil, fmt.Errorf("invalid policy %s of node pool %s: %v", file, nodePool.Name, err)
+	}
+	return policy, nil
+}
+
+// addNodePoolIAMRole adds an IAM role with the policy and an instance profile
+// for the node pool to the stack template and makes the launch template or
+// launch configuration of the node pool use it. The resources are prefixed
+// with the given prefix e.g. 'Master' or 'Worker', such that they're deleted
+// with the stack or when the node pool is removed from it.
+func addNodePoolIAMRole(stackTemplate []byte, prefix string, nodePool *api.NodePool, policy interface{}) ([]byte, error) {
+	return modifyStackResources(stackTemplate, func(resources map[string]interface{}) error {
+		roleLogicalID := prefix + "NodePoolIAMRole"
+		profileLogicalID := prefix + "NodePoolInstanceProfile"
+
+		resources[roleLogicalID] = map[string]interface{}{
+			"Type": resourceTypeIAMRole,
+			"Properties": map[string]interface{}{
+				"AssumeRolePolicyDocument": map[string]interface{}{
+					"Version": "2012-10-17",
+					"Statement": []interface{}{
+						map[string]interface{}{
+							"Effect":    "Allow",
+							"Principal": map[string]interface{}{"Service": []string{"ec2.amazonaws.com"}},
+							"Action":    []string{"sts:AssumeRole"},
+						},
+					},
+				},
+				"Path": "/",
+				"Policies": []interface{}{
+					map[string]interface{}{
+						"PolicyName":     nodePool.Name,
+						"PolicyDocument": policy,
+					},
+				},
+			},
+		}
+
+		resources[profileLogicalID] = map[string]interface{}{
+			"Type": resourceTypeIAMInstanceProfile,
+			"Properties": map[string]interface{}{
+				"Path":  "/",
+				"Roles": []interface{}{map[string]interface{}{"Ref": roleLogicalID}},
+			},
+		}
+
+		asgLogicalID, err := nodePoolASGLogicalID(resources, nodePool)
+		if err != nil {
+			return err
+		}
+		asgProperties, _ := resources[asgLogicalID].(map[string]interface{})["Properties"].(map[string]interface{})
+
+		if launchTemplate, ok := asgProperties["LaunchTemplate"].(map[string]interface{}); ok {
+			properties, err := referencedResourceProperties(resources, launchTemplate["LaunchTemplateId"])
+			if err != nil {
+				return fmt.Errorf("launch template of node pool %s: %v", nodePool.Name, err)
+			}
+
+			data, ok := properties["LaunchTemplateData"].(map[string]interface{})
+			if !ok {
+				data = make(map[string]interface{})
+				properties["LaunchTemplateData"] = data
+			}
+			data["IamInstanceProfile"] = map[string]interface{}{
+				"Arn": map[string]interface{}{"Fn::GetAtt": []string{profileLogicalID, "Arn"}},
+			}
+			return nil
+		}
+
+		properties, err := referencedResourceProperties(resources, asgProperties[propertyLaunchConfigurationName])
+		if err != nil {
+			return fmt.Errorf("launch configuration of node pool %s: %v", nodePool.Name, err)
+		}
+		properties["IamInstanceProfile"] = map[string]interface{}{"Ref": profileLogicalID}
+		return nil
+	})
+}
+
+// referencedResourceProperties returns the properties of the resource
+// referenced by ref, e.g. {"Ref": "WorkerLaunchConfiguration"}.
+func referencedResourceProperties(resources map[string]interface{}, ref interface{}) (map[string]interface{}, error) {
+	r, ok := ref.(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("not referenced in the stack template")
+	}
+
+	logicalID, ok := r["Ref"].(string)
+	if !ok {
+		return nil, fmt.Errorf("not referenced in the stack template")
+	}
+
+	resource, ok := resources[logicalID].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("resource %s not found in the stack template", logicalID)
+	}
+
+	properties, ok := resource["Properties"].(map[string]interface{})
+	if !ok {
+		properties = make(map[string]interface{})
+		resource["Properties"] = properties
+	}
+	return properties, nil
+}
+
+// nodePoolIAMRoleLogicalID returns the logical ID of the IAM role of the
+// node pool, as referenced by the instance profile of its launch template or
+// launch configuration.
+func nodePoolIAMRoleLogicalID(resources map[string]interface{}, nodePool *api.NodePool) (string, error) {
+	asgLogicalID, err := nodePoolASGLogicalID(resources, nodePool)
+	if err != nil {
+		return "", err
+	}
+	asgProperties, _ := resources[asgLogicalID].(map[string]interface{})["Properties"].(map[string]interface{})
+
+	var profileRef interface{}
+	if launchTemplate, ok := asgProperties["LaunchTemplate"].(map[string]interface{}); ok {
+		properties, err := referencedResourceProperties(resources, launchTemplate["LaunchTemplateId"])
+		if err != nil {
+			return "", fmt.Errorf("launch template of node pool %s: %v", nodePool.Name, err)
+		}
+		data, _ := properties["LaunchTemplateData"].(map[string]interface{})
+		profile, _ := data["IamInstanceProfile"].(map[string]interface{})
+		profileRef = profile["Name"]
+		if arn, ok := profile["Arn"].(map[string]interface{}); ok {
+			if getAtt, ok := arn["Fn::GetAtt"].([]interface{}); ok && len(getAtt) == 2 {
+				profileRef = map[string]interface{}{"Ref": getAtt[0]}
+			}
+		}
+	} else {
+		properties, err := referencedResourceProperties(resources, asgProperties[propertyLaunchConfigurationName])
+		if err != nil {
+			return "", fmt.Errorf("launch configuration of node pool %s: %v", nodePool.Name, err)
+		}
+		profileRef = properties["IamInstanceProfile"]
+	}
+
+	profile, err := referencedResourceProperties(resources, profileRef)
+	if err != nil {
+		return "", fmt.Errorf("instance profile of node pool %s: %v", nodePool.Name, err)
+	}
+	roles, _ := profile["Roles"].([]interface{})
+	if len(roles) != 1 {
+		return "", fmt.Errorf("instance profile of node pool %s: expected one role, got %d", nodePool.Name, len(roles))
+	}
+	role, _ := roles[0].(map[string]interface{})
+	logicalID, ok := role["Ref"].(string)
+	if !ok {
+		return "", fmt.Errorf("role of node pool %s: not referenced in the stack template", nodePool.Name)
+	}
+	return logicalID, nil
+}
@@ -0,0 +1,143 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const testIAMStackTemplate = `{
+  "Resources": {
+    "MasterAutoScaling": {
+      "Type": "AWS::AutoScaling::AutoScalingGroup",
+      "Properties": {
+        "LaunchConfigurationName": {"Ref": "MasterLaunchConfiguration"},
+        "Tags": [{"Key": "NodePool", "Value": "master-default"}]
+      }
+    },
+    "MasterLaunchConfiguration": {
+      "Type": "AWS::AutoScaling::LaunchConfiguration",
+      "Properties": {"IamInstanceProfile": {"Ref": "MasterInstanceProfile"}}
+    },
+    "WorkerAutoScaling": {
+      "Type": "AWS::AutoScaling::AutoScalingGroup",
+      "Properties": {
+        "LaunchTemplate": {"LaunchTemplateId": {"Ref": "WorkerLaunchTemplate"}},
+        "Tags": [{"Key": "NodePool", "Value": "worker-default"}]
+      }
+    },
+    "WorkerLaunchTemplate": {
+      "Type": "AWS::EC2::LaunchTemplate",
+      "Properties": {"LaunchTemplateData": {"IamInstanceProfile": {"Name": {"Ref": "WorkerInstanceProfile"}}}}
+    }
+  }
+}`
+
+func TestRenderNodePoolIAMPolicy(t *testing.T) {
+	basePath, err := ioutil.TempDir("", "profiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(basePath)
+
+	writeProfileFiles(t, basePath, map[string]string{
+		"node-pools/worker-default/profile.yaml": "",
+		"node-pools/worker-batch/profile.yaml":   "base: worker-default",
+		"node-pools/worker-batch/iam-policy.json": `{
+  "Version": "2012-10-17",
+  "Statement": [{"Effect": "Allow", "Action": "s3:GetObject", "Resource": {{json (printf "arn:aws:s3:::batch-%s-%s/*" .AccountID .Region)}}}]
+}`,
+		"node-pools/worker-invalid/iam-policy.json": `{"Version": {{.Missing}}}`,
+	})
+
+	cluster := &api.Cluster{InfrastructureAccount: "aws:123456789012", Region: "eu-central-1"}
+
+	policy, err := renderNodePoolIAMPolicy(basePath, cluster, &api.NodePool{Name: "batch", Profile: "worker-batch"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"Version": "2012-10-17",
+		"Statement": []interface{}{
+			map[string]interface{}{"Effect": "Allow", "Action": "s3:GetObject", "Resource": "arn:aws:s3:::batch-123456789012-eu-central-1/*"},
+		},
+	}, policy)
+
+	// profiles without a policy template share the role of the stack.
+	policy, err = renderNodePoolIAMPolicy(basePath, cluster, &api.NodePool{Name: "default", Profile: "worker-default"})
+	require.NoError(t, err)
+	assert.Nil(t, policy)
+
+	_, err = renderNodePoolIAMPolicy(basePath, cluster, &api.NodePool{Name: "invalid", Profile: "worker-invalid"})
+	assert.Error(t, err)
+}
+
+func TestAddNodePoolIAMRole(t *testing.T) {
+	policy := map[string]interface{}{"Version": "2012-10-17"}
+
+	output, err := addNodePoolIAMRole([]byte(testIAMStackTemplate), "Master", &api.NodePool{Name: "master-default"}, policy)
+	require.NoError(t, err)
+	output, err = addNodePoolIAMRole(output, "Worker", &api.NodePool{Name: "worker-default"}, policy)
+	require.NoError(t, err)
+
+	var template struct {
+		Resources map[string]struct {
+			Type       string
+			Properties map[string]interface{}
+		}
+	}
+	require.NoError(t, json.Unmarshal(output, &template))
+	require.Len(t, template.Resources, 8)
+
+	role := template.Resources["WorkerNodePoolIAMRole"]
+	assert.Equal(t, resourceTypeIAMRole, role.Type)
+	assert.Equal(t, []interface{}{map[string]interface{}{"PolicyName": "worker-default", "PolicyDocument": policy}}, role.Properties["Policies"])
+
+	profile := template.Resources["WorkerNodePoolInstanceProfile"]
+	assert.Equal(t, resourceTypeIAMInstanceProfile, profile.Type)
+	assert.Equal(t, []interface{}{map[string]interface{}{"Ref": "WorkerNodePoolIAMRole"}}, profile.Properties["Roles"])
+
+	assert.Equal(t, map[string]interface{}{"Ref": "MasterNodePoolInstanceProfile"}, template.Resources["MasterLaunchConfiguration"].Properties["IamInstanceProfile"])
+	assert.Equal(t, map[string]interface{}{
+		"IamInstanceProfile": map[string]interface{}{
+			"Arn": map[string]interface{}{"Fn::GetAtt": []interface{}{"WorkerNodePoolInstanceProfile", "Arn"}},
+		},
+	}, template.Resources["WorkerLaunchTemplate"].Properties["LaunchTemplateData"])
+
+	_, err = addNodePoolIAMRole([]byte(testScheduleStackTemplate), "Worker", &api.NodePool{Name: "worker-default"}, policy)
+	assert.Error(t, err)
+}
+
+func TestNodePoolIAMRoleLogicalID(t *testing.T) {
+	policy := map[string]interface{}{"Version": "2012-10-17"}
+
+	output, err := addNodePoolIAMRole([]byte(testIAMStackTemplate), "Master", &api.NodePool{Name: "master-default"}, policy)
+	require.NoError(t, err)
+	output, err = addNodePoolIAMRole(output, "Worker", &api.NodePool{Name: "worker-default"}, policy)
+	require.NoError(t, err)
+
+	var template struct {
+		Resources map[string]interface{}
+	}
+	require.NoError(t, json.Unmarshal(output, &template))
+
+	// launch configuration
+	logicalID, err := nodePoolIAMRoleLogicalID(template.Resources, &api.NodePool{Name: "master-default"})
+	require.NoError(t, err)
+	assert.Equal(t, "MasterNodePoolIAMRole", logicalID)
+
+	// launch template
+	logicalID, err = nodePoolIAMRoleLogicalID(template.Resources, &api.NodePool{Name: "worker-default"})
+	require.NoError(t, err)
+	assert.Equal(t, "WorkerNodePoolIAMRole", logicalID)
+
+	// the instance profile of the stack isn't part of the template.
+	var resources struct {
+		Resources map[string]interface{}
+	}
+	require.NoError(t, json.Unmarshal([]byte(testIAMStackTemplate), &resources))
+	_, err = nodePoolIAMRoleLogicalID(resources.Resources, &api.NodePool{Name: "worker-default"})
+	assert.Error(t, err)
+}
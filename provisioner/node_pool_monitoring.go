@@ -0,0 +1,113 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"fmt"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// cloudWatchAgentConfigValue is the userdata config value with the
+	// CloudWatch agent config of the node pool, empty if it has none.
+	cloudWatchAgentConfigValue = "NODE_POOL_CLOUDWATCH_AGENT_CONFIG"
+	// cloudWatchAgentConfigFile is the default config file of the
+	// CloudWatch agent.
+	cloudWatchAgentConfigFile = "/opt/aws/amazon-cloudwatch-agent/etc/amazon-cloudwatch-agent.json"
+	// asgMetricsGranularity is the only granularity of the ASG group
+	// metrics supported by AWS.
+	asgMetricsGranularity = "1Minute"
+)
+
+// validateMonitoring returns an error if the CloudWatch agent config of the
+// node pool isn't a JSON object. Windows nodes don't get the generated files
+// of the userdata.
+func validateMonitoring(nodePool *api.NodePool) error {
+	monitoring := nodePool.Monitoring
+	if monitoring == nil || monitoring.CloudWatchAgentConfig == "" {
+		return nil
+	}
+
+	if nodePoolOS(nodePool) == osWindows {
+		return fmt.Errorf("monitoring cloudwatch_agent_config isn't supported for %s node pool %s", osWindows, nodePool.Name)
+	}
+
+	var config map[string]interface{}
+	err := json.Unmarshal([]byte(monitoring.CloudWatchAgentConfig), &config)
+	if err != nil {
+		return fmt.Errorf("invalid monitoring cloudwatch_agent_config of node pool %s, must be a JSON object: %v", nodePool.Name, err)
+	}
+	return nil
+}
+
+// cloudWatchAgentConfig returns the CloudWatch agent config of a node pool or
+// an empty string if it has none.
+func cloudWatchAgentConfig(nodePool *api.NodePool) string {
+	if nodePool.Monitoring == nil {
+		return ""
+	}
+	return nodePool.Monitoring.CloudWatchAgentConfig
+}
+
+// addNodePoolMonitoring enables the ASG group metrics and the detailed EC2
+// monitoring of the node pools in the stack template. The detailed
+// monitoring is enabled in the launch template or launch configuration of
+// the ASG, such that it applies to the instances launched after the update.
+func addNodePoolMonitoring(stackTemplate []byte, nodePools ...*api.NodePool) ([]byte, error) {
+	enabled := false
+	for _, nodePool := range nodePools {
+		if monitoring := nodePool.Monitoring; monitoring != nil && (monitoring.ASGMetrics || monitoring.DetailedMonitoring) {
+			enabled = true
+		}
+	}
+	if !enabled {
+		return stackTemplate, nil
+	}
+
+	return modifyStackResources(stackTemplate, func(resources map[string]interface{}) error {
+		for _, nodePool := range nodePools {
+			monitoring := nodePool.Monitoring
+			if monitoring == nil || (!monitoring.ASGMetrics && !monitoring.DetailedMonitoring) {
+				continue
+			}
+
+			asgLogicalID, err := nodePoolASGLogicalID(resources, nodePool)
+			if err != nil {
+				return err
+			}
+			asgProperties, _ := resources[asgLogicalID].(map[string]interface{})["Properties"].(map[string]interface{})
+
+			if monitoring.ASGMetrics {
+				asgProperties["MetricsCollection"] = []interface{}{
+					map[string]interface{}{"Granularity": asgMetricsGranularity},
+				}
+			}
+
+			if !monitoring.DetailedMonitoring {
+				continue
+			}
+
+			if launchTemplate, ok := asgProperties["LaunchTemplate"].(map[string]interface{}); ok {
+				properties, err := referencedResourceProperties(resources, launchTemplate["LaunchTemplateId"])
+				if err != nil {
+					return fmt.Errorf("launch template of node pool %s: %v", nodePool.Name, err)
+				}
+
+				data, ok := properties["LaunchTemplateData"].(map[string]interface{})
+				if !ok {
+					data = make(map[string]interface{})
+					properties["LaunchTemplateData"] = data
+				}
+				data["Monitoring"] = map[string]interface{}{"Enabled": true}
+				continue
+			}
+
+			properties, err := referencedResourceProperties(resources, asgProperties[propertyLaunchConfigurationName])
+			if err != nil {
+				return fmt.Errorf("launch configuration of node pool %s: %v", nodePool.Name, err)
+			}
+			properties["InstanceMonitoring"] = true
+		}
+		return nil
+	})
+}
@@ -0,0 +1,96 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestValidateMonitoring(t *testing.T) {
+	for _, tc := range []struct {
+		msg        string
+		os         string
+		monitoring *api.NodePoolMonitoring
+		valid      bool
+	}{
+		{
+			msg:   "no monitoring",
+			valid: true,
+		},
+		{
+			msg:        "metrics without agent config",
+			monitoring: &api.NodePoolMonitoring{ASGMetrics: true, DetailedMonitoring: true},
+			valid:      true,
+		},
+		{
+			msg:        "agent config",
+			monitoring: &api.NodePoolMonitoring{CloudWatchAgentConfig: `{"metrics": {"metrics_collected": {"mem": {}}}}`},
+			valid:      true,
+		},
+		{
+			msg:        "invalid agent config",
+			monitoring: &api.NodePoolMonitoring{CloudWatchAgentConfig: `metrics: {}`},
+		},
+		{
+			msg:        "agent config of windows node pool",
+			os:         osWindows,
+			monitoring: &api.NodePoolMonitoring{CloudWatchAgentConfig: `{}`},
+		},
+		{
+			msg:        "detailed monitoring of windows node pool",
+			os:         osWindows,
+			monitoring: &api.NodePoolMonitoring{DetailedMonitoring: true},
+			valid:      true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := validateMonitoring(&api.NodePool{Name: "worker-default", OS: tc.os, Monitoring: tc.monitoring})
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestAddNodePoolMonitoring(t *testing.T) {
+	master := &api.NodePool{Name: "master-default", Monitoring: &api.NodePoolMonitoring{DetailedMonitoring: true}}
+	worker := &api.NodePool{Name: "worker-default", Monitoring: &api.NodePoolMonitoring{ASGMetrics: true, DetailedMonitoring: true}}
+
+	output, err := addNodePoolMonitoring([]byte(testIAMStackTemplate), master, worker)
+	require.NoError(t, err)
+
+	var template struct {
+		Resources map[string]struct {
+			Properties map[string]interface{}
+		}
+	}
+	require.NoError(t, json.Unmarshal(output, &template))
+
+	assert.NotContains(t, template.Resources["MasterAutoScaling"].Properties, "MetricsCollection")
+	assert.Equal(t, true, template.Resources["MasterLaunchConfiguration"].Properties["InstanceMonitoring"])
+	assert.Equal(t, []interface{}{map[string]interface{}{"Granularity": "1Minute"}}, template.Resources["WorkerAutoScaling"].Properties["MetricsCollection"])
+	data := template.Resources["WorkerLaunchTemplate"].Properties["LaunchTemplateData"].(map[string]interface{})
+	assert.Equal(t, map[string]interface{}{"Enabled": true}, data["Monitoring"])
+
+	// the template is returned as it is without monitoring.
+	output, err = addNodePoolMonitoring([]byte(testIAMStackTemplate), &api.NodePool{Name: "worker-default"})
+	require.NoError(t, err)
+	assert.Equal(t, testIAMStackTemplate, string(output))
+}
+
+func TestCloudWatchAgentConfigUserData(t *testing.T) {
+	config := nodePoolUserDataConfig(map[string]string{}, &api.NodePool{
+		Name:       "worker-default",
+		Monitoring: &api.NodePoolMonitoring{CloudWatchAgentConfig: `{"agent": {}}`},
+	})
+	assert.Equal(t, `{"agent": {}}`, config[cloudWatchAgentConfigValue])
+
+	config = nodePoolUserDataConfig(map[string]string{}, &api.NodePool{Name: "worker-default", Monitoring: &api.NodePoolMonitoring{ASGMetrics: true}})
+	assert.Equal(t, "", config[cloudWatchAgentConfigValue])
+}
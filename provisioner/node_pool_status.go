@@ -0,0 +1,74 @@
+package provisioner
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+// setNodePoolStatus records the successful provisioning of a node pool in
+// the status of the cluster. It's reported to the registry with the rest of
+// the cluster status.
+func setNodePoolStatus(cluster *api.Cluster, nodePool *api.NodePool, templateHash, stackStatus string) {
+	if cluster.Status == nil {
+		cluster.Status = &api.ClusterStatus{}
+	}
+
+	cluster.Status.SetNodePoolStatus(&api.NodePoolStatus{
+		Name:          nodePool.Name,
+		TemplateHash:  templateHash,
+		StackStatus:   stackStatus,
+		ProvisionedAt: time.Now().UTC(),
+	}, cluster.NodePools)
+}
+
+// recordNodeGenerations records how many nodes of each node pool of the
+// cluster are up to date, i.e. launched from the current launch configuration
+// of the node pool, in the node pool metrics and in the status of the node
+// pools provisioned before. The quarantined nodes are counted in the metrics
+// as well. It's best effort, node pools which can't be looked up are skipped
+// with a warning.
+func recordNodeGenerations(logger *log.Entry, cluster *api.Cluster, getPool func(nodePool *api.NodePool) (*updatestrategy.NodePool, error)) {
+	for _, nodePool := range cluster.NodePools {
+		pool, err := getPool(nodePool)
+		if err != nil {
+			logger.Warnf("Failed to get the nodes of node pool %s: %v", nodePool.Name, err)
+			continue
+		}
+
+		nodes := len(pool.Nodes)
+		upToDate := len(pool.UpToDateNodes())
+		nodePoolNodes.WithLabelValues(cluster.ID, nodePool.Name, updatestrategy.NodeGenerationCurrent).Set(float64(upToDate))
+		nodePoolNodes.WithLabelValues(cluster.ID, nodePool.Name, updatestrategy.NodeGenerationOutdated).Set(float64(nodes - upToDate))
+
+		quarantined := 0
+		for _, node := range pool.Nodes {
+			if node.Quarantined() {
+				quarantined++
+			}
+		}
+		nodePoolQuarantinedNodes.WithLabelValues(cluster.ID, nodePool.Name).Set(float64(quarantined))
+
+		if cluster.Status == nil {
+			continue
+		}
+		for _, status := range cluster.Status.NodePools {
+			if status.Name == nodePool.Name {
+				status.Nodes = nodes
+				status.UpToDateNodes = upToDate
+			}
+		}
+	}
+}
+
+// templateHash returns the hash identifying the userdata a node pool is
+// provisioned with or the template a stack is applied with.
+func templateHash(userData string) string {
+	hash := sha1.Sum([]byte(userData))
+	return hex.EncodeToString(hash[:])
+}
@@ -0,0 +1,41 @@
+package provisioner
+
+import (
+	"fmt"
+	"testing"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+func TestRecordNodeGenerations(t *testing.T) {
+	cluster := &api.Cluster{
+		ID: "aws:123456789012:eu-central-1:kube-1",
+		NodePools: []*api.NodePool{
+			{Name: "master-default"},
+			{Name: "worker-default"},
+		},
+	}
+	setNodePoolStatus(cluster, cluster.NodePools[1], "hash", "UPDATE_COMPLETE")
+
+	recordNodeGenerations(log.WithField("test", true), cluster, func(nodePool *api.NodePool) (*updatestrategy.NodePool, error) {
+		if nodePool.Name == "master-default" {
+			return nil, fmt.Errorf("no ASG")
+		}
+		return &updatestrategy.NodePool{
+			Generation: 1,
+			Nodes: []*updatestrategy.Node{
+				{Name: "new-1", Generation: 1},
+				{Name: "new-2", Generation: 1},
+				{Name: "old", Generation: 0},
+			},
+		}, nil
+	})
+
+	assert.Len(t, cluster.Status.NodePools, 1)
+	assert.Equal(t, 3, cluster.Status.NodePools[0].Nodes)
+	assert.Equal(t, 2, cluster.Status.NodePools[0].UpToDateNodes)
+}
@@ -0,0 +1,169 @@
+package provisioner
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+const (
+	maxTagKeyLength   = 128
+	maxTagValueLength = 256
+
+	// nodePoolProfileTagKey is the ASG tag recording the profile of the
+	// node pool the ASG was last updated for.
+	nodePoolProfileTagKey = "cluster-lifecycle-manager.zalando.org/profile"
+)
+
+// reservedTagPrefixes are the prefixes of the tag keys used by AWS,
+// Kubernetes and CLM, which can't be set by the tags of a node pool.
+var reservedTagPrefixes = []string{
+	"aws:",
+	"kubernetes.io/",
+	"k8s.io/",
+	"cluster-lifecycle-manager.zalando.org/",
+}
+
+// reservedTagKeys are the tag keys of the node pool resources set by the
+// stack definitions and relied on by CLM.
+var reservedTagKeys = []string{"Name", nodePoolTagKey, "Profile"}
+
+// validateNodePoolTags returns an error if a tag of the node pool uses a
+// reserved key or exceeds the length limits of AWS tags.
+func validateNodePoolTags(nodePool *api.NodePool) error {
+	for _, key := range sortedKeys(nodePool.Tags) {
+		if key == "" || len(key) > maxTagKeyLength {
+			return fmt.Errorf("invalid tag key '%s', must be 1 to %d characters", key, maxTagKeyLength)
+		}
+		if len(nodePool.Tags[key]) > maxTagValueLength {
+			return fmt.Errorf("invalid value of tag %s, must be at most %d characters", key, maxTagValueLength)
+		}
+
+		for _, reserved := range reservedTagKeys {
+			if key == reserved {
+				return fmt.Errorf("tag %s is reserved", key)
+			}
+		}
+		for _, prefix := range reservedTagPrefixes {
+			if strings.HasPrefix(key, prefix) {
+				return fmt.Errorf("tag %s is reserved, keys must not start with %s", key, prefix)
+			}
+		}
+	}
+	return nil
+}
+
+// addNodePoolTags adds the tags of the node pools to their ASGs in the
+// stack template, propagated to the instances at launch. With launch
+// templates the volumes and network interfaces of the instances are tagged
+// as well. Tags already defined by the stack template aren't overwritten.
+func addNodePoolTags(stackTemplate []byte, stackName string, launchTemplate bool, nodePools ...*api.NodePool) ([]byte, error) {
+	for _, nodePool := range nodePools {
+		err := validateNodePoolTags(nodePool)
+		if err != nil {
+			return nil, fmt.Errorf("node pool %s: %v", nodePool.Name, err)
+		}
+	}
+
+	return modifyStackResources(stackTemplate, func(resources map[string]interface{}) error {
+		for _, nodePool := range nodePools {
+			if len(nodePool.Tags) == 0 {
+				continue
+			}
+
+			asgLogicalID, err := nodePoolASGLogicalID(resources, nodePool)
+			if err != nil {
+				return err
+			}
+
+			properties := resources[asgLogicalID].(map[string]interface{})["Properties"].(map[string]interface{})
+			properties["Tags"] = mergeASGTags(properties["Tags"], nodePool.Tags, true)
+
+			if !launchTemplate {
+				continue
+			}
+
+			data, err := launchTemplateData(resources, launchTemplateName(stackName, nodePool))
+			if err != nil {
+				return err
+			}
+
+			specs, _ := data["TagSpecifications"].([]interface{})
+			for _, resourceType := range taggedInstanceResources {
+				specs = mergeTagSpecification(specs, resourceType, nodePool.Tags)
+			}
+			data["TagSpecifications"] = specs
+		}
+		return nil
+	})
+}
+
+// addNodePoolProfileTags records the profiles of the node pools in a tag of
+// their ASGs in the stack template. The tag isn't propagated to the
+// instances.
+func addNodePoolProfileTags(stackTemplate []byte, nodePools ...*api.NodePool) ([]byte, error) {
+	return modifyStackResources(stackTemplate, func(resources map[string]interface{}) error {
+		for _, nodePool := range nodePools {
+			if nodePool.Profile == "" {
+				continue
+			}
+
+			asgLogicalID, err := nodePoolASGLogicalID(resources, nodePool)
+			if err != nil {
+				return err
+			}
+
+			properties := resources[asgLogicalID].(map[string]interface{})["Properties"].(map[string]interface{})
+			properties["Tags"] = mergeASGTags(properties["Tags"], map[string]string{nodePoolProfileTagKey: nodePool.Profile}, false)
+		}
+		return nil
+	})
+}
+
+// markProfileChange marks the ASG of a node pool whose profile differs from
+// the one recorded in its profile tag, such that the update strategy replaces
+// the instances launched before the change, even if the launch configuration
+// or launch template stays the same. The mark has to be set before the stack
+// update, which records the new profile.
+func (a *awsAdapter) markProfileChange(asg *autoscaling.Group, nodePool *api.NodePool, now time.Time) error {
+	if nodePool.Profile == "" {
+		return nil
+	}
+
+	for _, tag := range asg.Tags {
+		if aws.StringValue(tag.Key) != nodePoolProfileTagKey || aws.StringValue(tag.Value) == nodePool.Profile {
+			continue
+		}
+
+		a.logger.Infof("Profile of node pool %s changed from %s to %s, replacing its nodes", nodePool.Name, aws.StringValue(tag.Value), nodePool.Profile)
+		return a.tagASG(aws.StringValue(asg.AutoScalingGroupName), map[string]string{
+			updatestrategy.ProfileChangedTag: now.UTC().Format(time.RFC3339),
+		})
+	}
+	return nil
+}
+
+// mergeASGTags adds tags to the tags of an ASG in a stack template. Existing
+// tags are not overwritten.
+func mergeASGTags(asgTags interface{}, tags map[string]string, propagateAtLaunch bool) []interface{} {
+	existing, _ := asgTags.([]interface{})
+	defined := make(map[interface{}]bool, len(existing))
+	for _, tag := range existing {
+		if m, ok := tag.(map[string]interface{}); ok {
+			defined[m["Key"]] = true
+		}
+	}
+
+	for _, key := range sortedKeys(tags) {
+		if !defined[key] {
+			existing = append(existing, map[string]interface{}{"Key": key, "Value": tags[key], "PropagateAtLaunch": propagateAtLaunch})
+		}
+	}
+	return existing
+}
@@ -0,0 +1,152 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+const testNodePoolTagsStackTemplate = `{
+  "Resources": {
+    "WorkerAutoScalingGroup": {
+      "Type": "AWS::AutoScaling::AutoScalingGroup",
+      "Properties": {
+        "Tags": [
+          {"Key": "NodePool", "Value": "worker-default", "PropagateAtLaunch": true},
+          {"Key": "team", "Value": "teapot", "PropagateAtLaunch": true}
+        ]
+      }
+    },
+    "WorkerLaunchTemplate": {
+      "Type": "AWS::EC2::LaunchTemplate",
+      "Properties": {"LaunchTemplateName": "kube-1-worker-default"}
+    }
+  }
+}`
+
+func TestValidateNodePoolTags(t *testing.T) {
+	for _, tc := range []struct {
+		msg   string
+		tags  map[string]string
+		valid bool
+	}{
+		{msg: "no tags", valid: true},
+		{msg: "custom tags", tags: map[string]string{"cost-center": "4711", "compliance-class": "pci"}, valid: true},
+		{msg: "reserved key", tags: map[string]string{"NodePool": "other"}},
+		{msg: "aws prefix", tags: map[string]string{"aws:cloudformation:stack-name": "other"}},
+		{msg: "kubernetes prefix", tags: map[string]string{"kubernetes.io/cluster/kube-1": "owned"}},
+		{msg: "autoscaler prefix", tags: map[string]string{"k8s.io/cluster-autoscaler/enabled": "true"}},
+		{msg: "clm prefix", tags: map[string]string{orphanedTag: "true"}},
+		{msg: "empty key", tags: map[string]string{"": "value"}},
+		{msg: "long key", tags: map[string]string{strings.Repeat("k", maxTagKeyLength+1): "value"}},
+		{msg: "long value", tags: map[string]string{"team": strings.Repeat("v", maxTagValueLength+1)}},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := validateNodePoolTags(&api.NodePool{Name: "worker-default", Tags: tc.tags})
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestAddNodePoolTags(t *testing.T) {
+	master := &api.NodePool{Name: "master-default"}
+	worker := &api.NodePool{Name: "worker-default", Tags: map[string]string{"team": "other", "cost-center": "4711"}}
+
+	output, err := addNodePoolTags([]byte(testNodePoolTagsStackTemplate), "kube-1", true, master, worker)
+	require.NoError(t, err)
+
+	var template struct {
+		Resources map[string]struct {
+			Properties struct {
+				Tags               []map[string]interface{}
+				LaunchTemplateData struct {
+					TagSpecifications []struct {
+						ResourceType string
+						Tags         []map[string]string
+					}
+				}
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal(output, &template))
+
+	// tags defined by the template are kept.
+	assert.Equal(t, []map[string]interface{}{
+		{"Key": "NodePool", "Value": "worker-default", "PropagateAtLaunch": true},
+		{"Key": "team", "Value": "teapot", "PropagateAtLaunch": true},
+		{"Key": "cost-center", "Value": "4711", "PropagateAtLaunch": true},
+	}, template.Resources["WorkerAutoScalingGroup"].Properties.Tags)
+
+	specs := template.Resources["WorkerLaunchTemplate"].Properties.LaunchTemplateData.TagSpecifications
+	require.Len(t, specs, 2)
+	assert.Equal(t, "volume", specs[0].ResourceType)
+	assert.Equal(t, []map[string]string{
+		{"Key": "cost-center", "Value": "4711"},
+		{"Key": "team", "Value": "other"},
+	}, specs[0].Tags)
+
+	// launch configurations only get the tags of the ASG.
+	output, err = addNodePoolTags([]byte(testNodePoolTagsStackTemplate), "kube-1", false, worker)
+	require.NoError(t, err)
+	assert.NotContains(t, string(output), "TagSpecifications")
+
+	// reserved tags are refused.
+	worker.Tags["NodePool"] = "other"
+	_, err = addNodePoolTags([]byte(testNodePoolTagsStackTemplate), "kube-1", true, worker)
+	assert.Error(t, err)
+}
+
+func TestAddNodePoolProfileTags(t *testing.T) {
+	worker := &api.NodePool{Name: "worker-default", Profile: "worker-splitaz"}
+
+	output, err := addNodePoolProfileTags([]byte(testNodePoolTagsStackTemplate), &api.NodePool{Name: "master-default"}, worker)
+	require.NoError(t, err)
+	assert.Contains(t, string(output), `{"Key":"cluster-lifecycle-manager.zalando.org/profile","PropagateAtLaunch":false,"Value":"worker-splitaz"}`)
+
+	worker.Name = "worker-other"
+	_, err = addNodePoolProfileTags([]byte(testNodePoolTagsStackTemplate), worker)
+	assert.Error(t, err)
+}
+
+func TestMarkProfileChange(t *testing.T) {
+	now := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+	nodePool := &api.NodePool{Name: "worker-default", Profile: "worker-splitaz"}
+	asg := &autoscaling.Group{
+		AutoScalingGroupName: aws.String("asg"),
+		Tags: []*autoscaling.TagDescription{
+			{Key: aws.String(nodePoolProfileTagKey), Value: aws.String("worker-splitaz")},
+		},
+	}
+
+	a := newAWSAdapterWithStubs("", "asg")
+	asgClient := a.autoscalingClient.(*autoscalingAPIStub)
+
+	// an unchanged profile isn't marked
+	require.NoError(t, a.markProfileChange(asg, nodePool, now))
+	assert.Nil(t, asgClient.tagsInput)
+
+	// neither are ASGs without a recorded profile
+	require.NoError(t, a.markProfileChange(&autoscaling.Group{AutoScalingGroupName: aws.String("asg")}, nodePool, now))
+	assert.Nil(t, asgClient.tagsInput)
+
+	nodePool.Profile = "worker-default"
+	require.NoError(t, a.markProfileChange(asg, nodePool, now))
+	require.NotNil(t, asgClient.tagsInput)
+	require.Len(t, asgClient.tagsInput.Tags, 1)
+	assert.Equal(t, updatestrategy.ProfileChangedTag, aws.StringValue(asgClient.tagsInput.Tags[0].Key))
+	assert.Equal(t, "2018-06-01T12:00:00Z", aws.StringValue(asgClient.tagsInput.Tags[0].Value))
+	assert.Equal(t, "asg", aws.StringValue(asgClient.tagsInput.Tags[0].ResourceId))
+}
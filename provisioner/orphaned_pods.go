@@ -0,0 +1,114 @@
+package provisioner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	configKeyOrphanedPodsOverride = "decommission_running_pods_override"
+	mirrorPodAnnotation           = "kubernetes.io/config.mirror"
+)
+
+// orphanedPodsError is returned when node pools missing from a cluster would
+// be decommissioned while their nodes still run workloads, e.g. because the
+// node pool was renamed by mistake.
+type orphanedPodsError struct {
+	cluster string
+	pods    map[string]int
+}
+
+func (e *orphanedPodsError) Error() string {
+	nodePools := make([]string, 0, len(e.pods))
+	for nodePool := range e.pods {
+		nodePools = append(nodePools, nodePool)
+	}
+	sort.Strings(nodePools)
+
+	running := make([]string, 0, len(nodePools))
+	for _, nodePool := range nodePools {
+		running = append(running, fmt.Sprintf("%s (%d pods)", nodePool, e.pods[nodePool]))
+	}
+
+	return fmt.Sprintf("refusing to decommission node pools %s of cluster %s still running pods (set %s to \"true\" to decommission them anyway)", strings.Join(running, ", "), e.cluster, configKeyOrphanedPodsOverride)
+}
+
+// isWorkloadPod returns true if the pod is a workload disrupted by removing
+// its node. Pods of DaemonSets, mirror pods and completed pods are ignored.
+func isWorkloadPod(pod *v1.Pod) bool {
+	if pod.Status.Phase == v1.PodSucceeded || pod.Status.Phase == v1.PodFailed {
+		return false
+	}
+
+	if _, ok := pod.Annotations[mirrorPodAnnotation]; ok {
+		return false
+	}
+
+	for _, owner := range pod.OwnerReferences {
+		if owner.Kind == "DaemonSet" {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkOrphanedPods returns an orphanedPodsError if the nodes of the ASGs of
+// orphaned node pools run any workload pods. The check can be overridden with
+// the decommission_running_pods_override config item.
+func checkOrphanedPods(client kubernetes.Interface, cluster *api.Cluster, groups []*autoscaling.Group) error {
+	if len(groups) == 0 || cluster.ConfigItems[configKeyOrphanedPodsOverride] == "true" {
+		return nil
+	}
+
+	instanceNodePools := make(map[string]string)
+	for _, group := range groups {
+		for _, instance := range group.Instances {
+			providerID := fmt.Sprintf("aws:///%s/%s", aws.StringValue(instance.AvailabilityZone), aws.StringValue(instance.InstanceId))
+			instanceNodePools[providerID] = asgTagValue(group, "NodePool")
+		}
+	}
+
+	nodes, err := client.CoreV1().Nodes().List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	nodeNodePools := make(map[string]string)
+	for _, node := range nodes.Items {
+		if nodePool, ok := instanceNodePools[node.Spec.ProviderID]; ok {
+			nodeNodePools[node.Name] = nodePool
+		}
+	}
+
+	if len(nodeNodePools) == 0 {
+		return nil
+	}
+
+	pods, err := client.CoreV1().Pods(metav1.NamespaceAll).List(metav1.ListOptions{})
+	if err != nil {
+		return err
+	}
+
+	running := make(map[string]int)
+	for _, pod := range pods.Items {
+		nodePool, ok := nodeNodePools[pod.Spec.NodeName]
+		if ok && isWorkloadPod(&pod) {
+			running[nodePool]++
+		}
+	}
+
+	if len(running) > 0 {
+		return &orphanedPodsError{cluster: cluster.ID, pods: running}
+	}
+	return nil
+}
@@ -0,0 +1,102 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/fake"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func orphanedPodsTestPod(name, nodeName string, phase v1.PodPhase, ownerKind string) *v1.Pod {
+	pod := &v1.Pod{
+		ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "default"},
+		Spec:       v1.PodSpec{NodeName: nodeName},
+		Status:     v1.PodStatus{Phase: phase},
+	}
+	if ownerKind != "" {
+		pod.OwnerReferences = []metav1.OwnerReference{{Kind: ownerKind, Name: name}}
+	}
+	return pod
+}
+
+func TestCheckOrphanedPods(t *testing.T) {
+	groups := []*autoscaling.Group{
+		{
+			AutoScalingGroupName: aws.String("worker-renamed"),
+			Tags: []*autoscaling.TagDescription{
+				{Key: aws.String("NodePool"), Value: aws.String("worker-renamed")},
+			},
+			Instances: []*autoscaling.Instance{
+				{InstanceId: aws.String("i-1"), AvailabilityZone: aws.String("eu-central-1a")},
+			},
+		},
+	}
+
+	for _, tc := range []struct {
+		msg         string
+		pods        []*v1.Pod
+		configItems map[string]string
+		success     bool
+	}{
+		{
+			msg: "only DaemonSet, mirror and completed pods",
+			pods: []*v1.Pod{
+				orphanedPodsTestPod("kube-proxy", "node-1", v1.PodRunning, "DaemonSet"),
+				func() *v1.Pod {
+					pod := orphanedPodsTestPod("static", "node-1", v1.PodRunning, "")
+					pod.Annotations = map[string]string{mirrorPodAnnotation: "true"}
+					return pod
+				}(),
+				orphanedPodsTestPod("job", "node-1", v1.PodSucceeded, "Job"),
+				orphanedPodsTestPod("app", "node-2", v1.PodRunning, "ReplicaSet"),
+			},
+			success: true,
+		},
+		{
+			msg: "workload pods",
+			pods: []*v1.Pod{
+				orphanedPodsTestPod("app", "node-1", v1.PodRunning, "ReplicaSet"),
+			},
+			success: false,
+		},
+		{
+			msg: "workload pods with override",
+			pods: []*v1.Pod{
+				orphanedPodsTestPod("app", "node-1", v1.PodRunning, "ReplicaSet"),
+			},
+			configItems: map[string]string{configKeyOrphanedPodsOverride: "true"},
+			success:     true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			client := fake.NewSimpleClientset()
+			for name, providerID := range map[string]string{"node-1": "aws:///eu-central-1a/i-1", "node-2": "aws:///eu-central-1a/i-2"} {
+				_, err := client.CoreV1().Nodes().Create(&v1.Node{
+					ObjectMeta: metav1.ObjectMeta{Name: name},
+					Spec:       v1.NodeSpec{ProviderID: providerID},
+				})
+				require.NoError(t, err)
+			}
+			for _, pod := range tc.pods {
+				_, err := client.CoreV1().Pods(pod.Namespace).Create(pod)
+				require.NoError(t, err)
+			}
+
+			cluster := &api.Cluster{ID: "kube-1", ConfigItems: tc.configItems}
+			err := checkOrphanedPods(client, cluster, groups)
+			if tc.success {
+				assert.NoError(t, err)
+			} else {
+				require.Error(t, err)
+				assert.Equal(t, map[string]int{"worker-renamed": 1}, err.(*orphanedPodsError).pods)
+			}
+		})
+	}
+}
@@ -0,0 +1,250 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/elb"
+	"github.com/aws/aws-sdk-go/service/elbv2"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+const (
+	// configKeyOrphanCleanup enables the deletion of the orphaned
+	// resources of a cluster, which are only reported by default.
+	configKeyOrphanCleanup = "orphaned_resources_cleanup"
+	// serviceNameTagKey is the tag of the load balancers created by
+	// Kubernetes with the namespace and name of their service.
+	serviceNameTagKey = "kubernetes.io/service-name"
+	// cloudFormationStackIDTagKey is the tag of the resources created by
+	// CloudFormation, which are deleted along with their stack.
+	cloudFormationStackIDTagKey = "aws:cloudformation:stack-id"
+)
+
+// orphanedResource is an AWS resource owned by a cluster which isn't used by
+// the cluster anymore, e.g. left behind by deleted services or by failed
+// detaches.
+type orphanedResource struct {
+	// kind is the kind of the resource, one of the orphaned* metric
+	// labels.
+	kind   string
+	id     string
+	reason string
+	// confirmed is set for resources which can be deleted. Volumes are
+	// only confirmed once a previous cleanup found them orphaned and
+	// tagged them with the orphanedTag, such that a volume whose
+	// persistent volume is momentarily missing isn't deleted.
+	confirmed bool
+}
+
+func (r *orphanedResource) String() string {
+	return fmt.Sprintf("%s %s (%s)", strings.Replace(r.kind, "_", " ", -1), r.id, r.reason)
+}
+
+// findOrphanedResources returns the resources tagged as owned by the cluster
+// which aren't used anymore: detached volumes which no persistent volume
+// refers to, detached network interfaces and load balancers whose service
+// doesn't exist or isn't of type LoadBalancer anymore. Resources created by
+// CloudFormation are left to their stacks and sticky volumes, which are
+// detached while their node is replaced, to their node pools. Volumes used
+// again lose the orphanedTag of a previous cleanup.
+func (a *awsAdapter) findOrphanedResources(client kubernetes.Interface, cluster *api.Cluster) ([]*orphanedResource, error) {
+	key, value := clusterOwnedTag(cluster)
+
+	var result []*orphanedResource
+
+	volumes, err := a.GetVolumes(map[string]string{key: value})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(volumes) > 0 {
+		used, err := persistentVolumeIDs(client)
+		if err != nil {
+			return nil, err
+		}
+
+		for _, volume := range volumes {
+			id := aws.StringValue(volume.VolumeId)
+			marked := hasTagKey(volume.Tags, orphanedTag)
+			if aws.StringValue(volume.State) != ec2.VolumeStateAvailable || used[id] || hasTagKey(volume.Tags, cloudFormationStackIDTagKey) || hasTagKey(volume.Tags, updatestrategy.StickyVolumeTag) {
+				if marked && !a.dryRun {
+					err := a.DeleteTags(id, []*ec2.Tag{{Key: aws.String(orphanedTag)}})
+					if err != nil {
+						return nil, err
+					}
+				}
+				continue
+			}
+			result = append(result, &orphanedResource{kind: orphanedVolume, id: id, reason: "detached and not used by any persistent volume", confirmed: marked})
+		}
+	}
+
+	resp, err := a.ec2Client.DescribeNetworkInterfaces(&ec2.DescribeNetworkInterfacesInput{
+		Filters: []*ec2.Filter{
+			{Name: aws.String(fmt.Sprintf("tag:%s", key)), Values: aws.StringSlice([]string{value})},
+			{Name: aws.String("status"), Values: aws.StringSlice([]string{ec2.NetworkInterfaceStatusAvailable})},
+		},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	for _, eni := range resp.NetworkInterfaces {
+		if hasTagKey(eni.TagSet, cloudFormationStackIDTagKey) {
+			continue
+		}
+		result = append(result, &orphanedResource{kind: orphanedNetworkInterface, id: aws.StringValue(eni.NetworkInterfaceId), reason: "detached", confirmed: true})
+	}
+
+	elbTags, err := a.classicLoadBalancerTags()
+	if err != nil {
+		return nil, err
+	}
+
+	lbTags, err := a.elbv2LoadBalancerTags()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, lbs := range []struct {
+		kind string
+		tags map[string]map[string]string
+	}{
+		{kind: orphanedClassicLoadBalancer, tags: elbTags},
+		{kind: orphanedLoadBalancer, tags: lbTags},
+	} {
+		for _, id := range taggedResources(lbs.tags, key, value) {
+			reason, err := unusedLoadBalancerReason(client, lbs.tags[id])
+			if err != nil {
+				return nil, err
+			}
+			if reason != "" {
+				result = append(result, &orphanedResource{kind: lbs.kind, id: id, reason: reason, confirmed: true})
+			}
+		}
+	}
+
+	return result, nil
+}
+
+// persistentVolumeIDs returns the IDs of the EBS volumes referred to by the
+// persistent volumes of the cluster, either in-tree or by the volume handle
+// of a CSI driver. The persistent volumes are decoded from the raw response,
+// since the client's API types predate CSI.
+func persistentVolumeIDs(client kubernetes.Interface) (map[string]bool, error) {
+	data, err := client.CoreV1().RESTClient().Get().Resource("persistentvolumes").DoRaw()
+	if err != nil {
+		return nil, err
+	}
+
+	var persistentVolumes struct {
+		Items []struct {
+			Spec struct {
+				AWSElasticBlockStore *struct {
+					VolumeID string `json:"volumeID"`
+				} `json:"awsElasticBlockStore"`
+				CSI *struct {
+					VolumeHandle string `json:"volumeHandle"`
+				} `json:"csi"`
+			} `json:"spec"`
+		} `json:"items"`
+	}
+	err = json.Unmarshal(data, &persistentVolumes)
+	if err != nil {
+		return nil, fmt.Errorf("invalid persistent volumes: %v", err)
+	}
+
+	used := make(map[string]bool, len(persistentVolumes.Items))
+	for _, pv := range persistentVolumes.Items {
+		if source := pv.Spec.AWSElasticBlockStore; source != nil {
+			// the volume ID may be prefixed by the availability
+			// zone e.g. aws://eu-central-1a/vol-123.
+			parts := strings.Split(source.VolumeID, "/")
+			used[parts[len(parts)-1]] = true
+		}
+		if source := pv.Spec.CSI; source != nil {
+			used[source.VolumeHandle] = true
+		}
+	}
+	return used, nil
+}
+
+// unusedLoadBalancerReason returns why the load balancer with the specified
+// tags isn't used by its service anymore, or an empty string if it's used.
+// Load balancers without service tag are considered used.
+func unusedLoadBalancerReason(client kubernetes.Interface, tags map[string]string) (string, error) {
+	serviceName, ok := tags[serviceNameTagKey]
+	if !ok || tags[cloudFormationStackIDTagKey] != "" {
+		return "", nil
+	}
+
+	parts := strings.SplitN(serviceName, "/", 2)
+	if len(parts) != 2 {
+		return "", nil
+	}
+
+	service, err := client.CoreV1().Services(parts[0]).Get(parts[1], metav1.GetOptions{})
+	if err != nil {
+		if apierrors.IsNotFound(err) {
+			return fmt.Sprintf("service %s doesn't exist", serviceName), nil
+		}
+		return "", err
+	}
+
+	if service.Spec.Type != v1.ServiceTypeLoadBalancer {
+		return fmt.Sprintf("service %s isn't of type %s", serviceName, v1.ServiceTypeLoadBalancer), nil
+	}
+	return "", nil
+}
+
+// deleteOrphanedResource deletes an orphaned resource. Resources which
+// aren't confirmed yet are tagged with the orphanedTag instead, such that the
+// next cleanup deletes them if they're still orphaned.
+func (a *awsAdapter) deleteOrphanedResource(resource *orphanedResource) error {
+	if !resource.confirmed {
+		a.logger.Infof("Marking orphaned %s, it's deleted by the next cleanup if it's still orphaned", resource)
+		return a.CreateTags(resource.id, []*ec2.Tag{{Key: aws.String(orphanedTag), Value: aws.String(time.Now().UTC().Format(time.RFC3339))}})
+	}
+
+	if a.skipReadOnly("deleting orphaned %s", resource) {
+		return nil
+	}
+
+	a.logger.Infof("Deleting orphaned %s", resource)
+
+	var err error
+	switch resource.kind {
+	case orphanedVolume:
+		err = a.DeleteVolume(resource.id)
+	case orphanedNetworkInterface:
+		_, err = a.ec2Client.DeleteNetworkInterface(&ec2.DeleteNetworkInterfaceInput{NetworkInterfaceId: aws.String(resource.id)})
+	case orphanedClassicLoadBalancer:
+		_, err = a.elbClient.DeleteLoadBalancer(&elb.DeleteLoadBalancerInput{LoadBalancerName: aws.String(resource.id)})
+	case orphanedLoadBalancer:
+		_, err = a.elbv2Client.DeleteLoadBalancer(&elbv2.DeleteLoadBalancerInput{LoadBalancerArn: aws.String(resource.id)})
+	default:
+		err = fmt.Errorf("unknown resource kind %s", resource.kind)
+	}
+	return err
+}
+
+// hasTagKey returns true if the tags contain the key.
+func hasTagKey(tags []*ec2.Tag, key string) bool {
+	for _, tag := range tags {
+		if aws.StringValue(tag.Key) == key {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,171 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes"
+	"k8s.io/client-go/pkg/api/v1"
+	"k8s.io/client-go/rest"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+type orphanedResourcesEC2APIStub struct {
+	ec2API
+	volumes    []*ec2.Volume
+	interfaces []*ec2.NetworkInterface
+	deleted    []string
+	tagged     []string
+	untagged   []string
+}
+
+func (e *orphanedResourcesEC2APIStub) DescribeVolumes(input *ec2.DescribeVolumesInput) (*ec2.DescribeVolumesOutput, error) {
+	return &ec2.DescribeVolumesOutput{Volumes: e.volumes}, nil
+}
+
+func (e *orphanedResourcesEC2APIStub) DescribeNetworkInterfaces(input *ec2.DescribeNetworkInterfacesInput) (*ec2.DescribeNetworkInterfacesOutput, error) {
+	return &ec2.DescribeNetworkInterfacesOutput{NetworkInterfaces: e.interfaces}, nil
+}
+
+func (e *orphanedResourcesEC2APIStub) DeleteVolume(input *ec2.DeleteVolumeInput) (*ec2.DeleteVolumeOutput, error) {
+	e.deleted = append(e.deleted, aws.StringValue(input.VolumeId))
+	return nil, nil
+}
+
+func (e *orphanedResourcesEC2APIStub) CreateTags(input *ec2.CreateTagsInput) (*ec2.CreateTagsOutput, error) {
+	e.tagged = append(e.tagged, aws.StringValueSlice(input.Resources)...)
+	return nil, nil
+}
+
+func (e *orphanedResourcesEC2APIStub) DeleteTags(input *ec2.DeleteTagsInput) (*ec2.DeleteTagsOutput, error) {
+	e.untagged = append(e.untagged, aws.StringValueSlice(input.Resources)...)
+	return nil, nil
+}
+
+func (e *orphanedResourcesEC2APIStub) DeleteNetworkInterface(input *ec2.DeleteNetworkInterfaceInput) (*ec2.DeleteNetworkInterfaceOutput, error) {
+	e.deleted = append(e.deleted, aws.StringValue(input.NetworkInterfaceId))
+	return nil, nil
+}
+
+// newOrphanedResourcesKubeClient returns a client of an API server serving
+// the persistent volumes and services. The persistent volumes are served as
+// is, since the client's API types can't express CSI volumes.
+func newOrphanedResourcesKubeClient(t *testing.T, persistentVolumes []map[string]interface{}, services []*v1.Service) (kubernetes.Interface, func()) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		if r.URL.Path == "/api/v1/persistentvolumes" {
+			json.NewEncoder(w).Encode(map[string]interface{}{"kind": "PersistentVolumeList", "apiVersion": "v1", "items": persistentVolumes})
+			return
+		}
+
+		for _, service := range services {
+			if r.URL.Path == fmt.Sprintf("/api/v1/namespaces/%s/services/%s", service.Namespace, service.Name) {
+				service.Kind = "Service"
+				service.APIVersion = "v1"
+				json.NewEncoder(w).Encode(service)
+				return
+			}
+		}
+
+		w.WriteHeader(http.StatusNotFound)
+		json.NewEncoder(w).Encode(map[string]interface{}{"kind": "Status", "apiVersion": "v1", "status": "Failure", "reason": "NotFound", "code": http.StatusNotFound})
+	}))
+
+	client, err := kubernetes.NewForConfig(&rest.Config{Host: server.URL})
+	require.NoError(t, err)
+	return client, server.Close
+}
+
+func withServiceName(tags map[string]string, serviceName string) map[string]string {
+	result := map[string]string{serviceNameTagKey: serviceName}
+	for key, value := range tags {
+		result[key] = value
+	}
+	return result
+}
+
+func TestFindOrphanedResources(t *testing.T) {
+	stackTag := &ec2.Tag{Key: aws.String(cloudFormationStackIDTagKey), Value: aws.String("arn:stack")}
+	orphanedVolumeTag := &ec2.Tag{Key: aws.String(orphanedTag), Value: aws.String("2026-01-02T03:04:05Z")}
+	ec2Client := &orphanedResourcesEC2APIStub{
+		volumes: []*ec2.Volume{
+			{VolumeId: aws.String("vol-attached"), State: aws.String(ec2.VolumeStateInUse)},
+			{VolumeId: aws.String("vol-pv"), State: aws.String(ec2.VolumeStateAvailable)},
+			{VolumeId: aws.String("vol-stack"), State: aws.String(ec2.VolumeStateAvailable), Tags: []*ec2.Tag{stackTag}},
+			{VolumeId: aws.String("vol-sticky"), State: aws.String(ec2.VolumeStateAvailable), Tags: []*ec2.Tag{{Key: aws.String(updatestrategy.StickyVolumeTag), Value: aws.String("worker-default")}}},
+			{VolumeId: aws.String("vol-csi"), State: aws.String(ec2.VolumeStateAvailable)},
+			{VolumeId: aws.String("vol-marked-used"), State: aws.String(ec2.VolumeStateAvailable), Tags: []*ec2.Tag{orphanedVolumeTag}},
+			{VolumeId: aws.String("vol-orphaned"), State: aws.String(ec2.VolumeStateAvailable)},
+			{VolumeId: aws.String("vol-marked"), State: aws.String(ec2.VolumeStateAvailable), Tags: []*ec2.Tag{orphanedVolumeTag}},
+		},
+		interfaces: []*ec2.NetworkInterface{
+			{NetworkInterfaceId: aws.String("eni-orphaned")},
+			{NetworkInterfaceId: aws.String("eni-stack"), TagSet: []*ec2.Tag{stackTag}},
+		},
+	}
+	elbClient := &elbAPIStub{
+		tags: map[string]map[string]string{
+			"elb-used":     withServiceName(ownedTags, "default/used"),
+			"elb-deleted":  withServiceName(ownedTags, "default/deleted"),
+			"elb-unnamed":  ownedTags,
+			"elb-other":    withServiceName(nil, "default/deleted"),
+			"elb-nodeport": withServiceName(ownedTags, "default/nodeport"),
+		},
+	}
+	elbv2Client := &elbv2APIStub{
+		loadBalancerTags: map[string]map[string]string{
+			"arn:lb-used":    withServiceName(ownedTags, "kube-system/ingress"),
+			"arn:lb-deleted": withServiceName(ownedTags, "kube-system/deleted"),
+		},
+	}
+
+	client, closeServer := newOrphanedResourcesKubeClient(t,
+		[]map[string]interface{}{
+			{"metadata": map[string]string{"name": "pv"}, "spec": map[string]interface{}{"awsElasticBlockStore": map[string]string{"volumeID": "aws://eu-central-1a/vol-pv"}}},
+			{"metadata": map[string]string{"name": "pv-csi"}, "spec": map[string]interface{}{"csi": map[string]string{"driver": "ebs.csi.aws.com", "volumeHandle": "vol-csi"}}},
+			{"metadata": map[string]string{"name": "pv-marked"}, "spec": map[string]interface{}{"csi": map[string]string{"driver": "ebs.csi.aws.com", "volumeHandle": "vol-marked-used"}}},
+		},
+		[]*v1.Service{
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "used"}, Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer}},
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "default", Name: "nodeport"}, Spec: v1.ServiceSpec{Type: v1.ServiceTypeNodePort}},
+			{ObjectMeta: metav1.ObjectMeta{Namespace: "kube-system", Name: "ingress"}, Spec: v1.ServiceSpec{Type: v1.ServiceTypeLoadBalancer}},
+		},
+	)
+	defer closeServer()
+
+	a := &awsAdapter{ec2Client: ec2Client, elbClient: elbClient, elbv2Client: elbv2Client, logger: log.WithField("cluster", "kube-1")}
+	resources, err := a.findOrphanedResources(client, &api.Cluster{ID: decommissionedClusterID})
+	require.NoError(t, err)
+
+	assert.Equal(t, []*orphanedResource{
+		{kind: orphanedVolume, id: "vol-orphaned", reason: "detached and not used by any persistent volume"},
+		{kind: orphanedVolume, id: "vol-marked", reason: "detached and not used by any persistent volume", confirmed: true},
+		{kind: orphanedNetworkInterface, id: "eni-orphaned", reason: "detached", confirmed: true},
+		{kind: orphanedClassicLoadBalancer, id: "elb-deleted", reason: "service default/deleted doesn't exist", confirmed: true},
+		{kind: orphanedClassicLoadBalancer, id: "elb-nodeport", reason: "service default/nodeport isn't of type LoadBalancer", confirmed: true},
+		{kind: orphanedLoadBalancer, id: "arn:lb-deleted", reason: "service kube-system/deleted doesn't exist", confirmed: true},
+	}, resources)
+
+	// volumes used again lose the mark of a previous cleanup.
+	assert.Equal(t, []string{"vol-marked-used"}, ec2Client.untagged)
+
+	// volumes are only deleted if a previous cleanup marked them.
+	for _, resource := range resources {
+		require.NoError(t, a.deleteOrphanedResource(resource))
+	}
+	assert.Equal(t, []string{"vol-orphaned"}, ec2Client.tagged)
+	assert.Equal(t, []string{"vol-marked", "eni-orphaned"}, ec2Client.deleted)
+	assert.Equal(t, []string{"elb-deleted", "elb-nodeport"}, elbClient.deleted)
+	assert.Equal(t, []string{"arn:lb-deleted"}, elbv2Client.deleted)
+}
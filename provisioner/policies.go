@@ -0,0 +1,228 @@
+package provisioner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// hookPhaseEtcdStackTemplate passes the rendered etcd stack template to
+	// the policies. It isn't passed to the executable hooks.
+	hookPhaseEtcdStackTemplate = "etcd-stack-template"
+
+	// PolicyEncryptedVolumes encrypts all EBS volumes of the stack
+	// templates.
+	PolicyEncryptedVolumes = "encrypted-volumes"
+	// PolicyNoPublicIPs rejects stack templates assigning public IPs.
+	PolicyNoPublicIPs = "no-public-ips"
+
+	resourceTypeVolume              = "AWS::EC2::Volume"
+	resourceTypeLaunchConfiguration = "AWS::AutoScaling::LaunchConfiguration"
+	resourceTypeEIP                 = "AWS::EC2::EIP"
+)
+
+// Policy checks the stack templates and userdata rendered for a cluster
+// before they're applied, e.g. to enforce the security requirements of an
+// organization. Check returns the content, possibly changed, or a
+// PolicyViolation rejecting it. The phase is 'stack-template',
+// 'etcd-stack-template' or 'userdata', the node pool is only set for the
+// userdata.
+type Policy interface {
+	Name() string
+	Check(phase string, cluster *api.Cluster, nodePool, content string) (string, error)
+}
+
+// PolicyViolation is returned by a policy rejecting the rendered content.
+type PolicyViolation struct {
+	Policy string
+	Reason string
+}
+
+func (e *PolicyViolation) Error() string {
+	return fmt.Sprintf("rejected by policy %s: %s", e.Policy, e.Reason)
+}
+
+// NewPolicy returns the built-in policy with the given name.
+func NewPolicy(name string) (Policy, error) {
+	switch name {
+	case PolicyEncryptedVolumes:
+		return encryptedVolumesPolicy{}, nil
+	case PolicyNoPublicIPs:
+		return noPublicIPsPolicy{}, nil
+	default:
+		return nil, fmt.Errorf("unknown policy %s, must be %s or %s", name, PolicyEncryptedVolumes, PolicyNoPublicIPs)
+	}
+}
+
+// provisionerPolicies are checked in order, each one gets the content
+// returned by the previous one.
+type provisionerPolicies []Policy
+
+// check passes the content rendered in phase through the policies and
+// returns the resulting content.
+func (p provisionerPolicies) check(phase string, cluster *api.Cluster, nodePool, content string) (string, error) {
+	for _, policy := range p {
+		var err error
+		content, err = policy.Check(phase, cluster, nodePool, content)
+		if err != nil {
+			return "", err
+		}
+	}
+	return content, nil
+}
+
+// isStackTemplatePhase returns true if the content of the phase is a stack
+// template.
+func isStackTemplatePhase(phase string) bool {
+	return phase == hookPhaseStackTemplate || phase == hookPhaseEtcdStackTemplate
+}
+
+// encryptedVolumesPolicy encrypts the EBS volumes and the block device
+// mappings of the launch templates and launch configurations which aren't
+// encrypted, with the default EBS key unless they specify a KMS key.
+type encryptedVolumesPolicy struct{}
+
+func (encryptedVolumesPolicy) Name() string {
+	return PolicyEncryptedVolumes
+}
+
+func (encryptedVolumesPolicy) Check(phase string, cluster *api.Cluster, nodePool, content string) (string, error) {
+	if !isStackTemplatePhase(phase) {
+		return content, nil
+	}
+
+	changed := false
+	template, err := modifyStackResources([]byte(content), func(resources map[string]interface{}) error {
+		for _, resource := range resources {
+			r, ok := resource.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			properties, ok := r["Properties"].(map[string]interface{})
+			if !ok {
+				continue
+			}
+
+			switch r["Type"] {
+			case resourceTypeVolume:
+				changed = encrypt(properties) || changed
+			case resourceTypeLaunchConfiguration:
+				changed = encryptBlockDevices(properties["BlockDeviceMappings"]) || changed
+			case resourceTypeLaunchTemplate:
+				if data, ok := properties["LaunchTemplateData"].(map[string]interface{}); ok {
+					changed = encryptBlockDevices(data["BlockDeviceMappings"]) || changed
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	// the template is kept as it is, formatting included, if all
+	// volumes are encrypted already.
+	if !changed {
+		return content, nil
+	}
+	return string(template), nil
+}
+
+// encryptBlockDevices encrypts the EBS volumes of block device mappings.
+func encryptBlockDevices(mappings interface{}) bool {
+	list, _ := mappings.([]interface{})
+	changed := false
+	for _, mapping := range list {
+		m, ok := mapping.(map[string]interface{})
+		if !ok {
+			continue
+		}
+		if ebs, ok := m["Ebs"].(map[string]interface{}); ok {
+			changed = encrypt(ebs) || changed
+		}
+	}
+	return changed
+}
+
+// encrypt sets Encrypted of the volume properties and returns true if they
+// weren't encrypted before.
+func encrypt(properties map[string]interface{}) bool {
+	if isTrue(properties["Encrypted"]) {
+		return false
+	}
+	properties["Encrypted"] = true
+	return true
+}
+
+// noPublicIPsPolicy rejects stack templates with Elastic IPs, subnets
+// assigning public IPs at launch or launch templates and launch
+// configurations associating public IPs with the instances.
+type noPublicIPsPolicy struct{}
+
+func (noPublicIPsPolicy) Name() string {
+	return PolicyNoPublicIPs
+}
+
+func (p noPublicIPsPolicy) Check(phase string, cluster *api.Cluster, nodePool, content string) (string, error) {
+	if !isStackTemplatePhase(phase) {
+		return content, nil
+	}
+
+	var violations []string
+	_, err := modifyStackResources([]byte(content), func(resources map[string]interface{}) error {
+		for logicalID, resource := range resources {
+			r, ok := resource.(map[string]interface{})
+			if !ok {
+				continue
+			}
+			properties, _ := r["Properties"].(map[string]interface{})
+
+			switch r["Type"] {
+			case resourceTypeEIP:
+				violations = append(violations, fmt.Sprintf("%s is an Elastic IP", logicalID))
+			case resourceTypeSubnet:
+				if isTrue(properties["MapPublicIpOnLaunch"]) {
+					violations = append(violations, fmt.Sprintf("subnet %s maps public IPs on launch", logicalID))
+				}
+			case resourceTypeLaunchConfiguration:
+				if isTrue(properties["AssociatePublicIpAddress"]) {
+					violations = append(violations, fmt.Sprintf("launch configuration %s associates public IPs", logicalID))
+				}
+			case resourceTypeLaunchTemplate:
+				data, _ := properties["LaunchTemplateData"].(map[string]interface{})
+				interfaces, _ := data["NetworkInterfaces"].([]interface{})
+				for _, networkInterface := range interfaces {
+					if i, ok := networkInterface.(map[string]interface{}); ok && isTrue(i["AssociatePublicIpAddress"]) {
+						violations = append(violations, fmt.Sprintf("launch template %s associates public IPs", logicalID))
+						break
+					}
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return "", err
+	}
+
+	if len(violations) > 0 {
+		sort.Strings(violations)
+		return "", &PolicyViolation{Policy: p.Name(), Reason: strings.Join(violations, ", ")}
+	}
+	return content, nil
+}
+
+// isTrue returns true if a template value is the boolean true or the string
+// 'true'.
+func isTrue(value interface{}) bool {
+	switch v := value.(type) {
+	case bool:
+		return v
+	case string:
+		return strings.EqualFold(v, "true")
+	}
+	return false
+}
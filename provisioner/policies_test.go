@@ -0,0 +1,143 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const testPolicyStackTemplate = `{
+  "Resources": {
+    "Volume": {"Type": "AWS::EC2::Volume", "Properties": {"Size": 10}},
+    "EncryptedVolume": {"Type": "AWS::EC2::Volume", "Properties": {"Size": 10, "Encrypted": true}},
+    "LaunchTemplate": {
+      "Type": "AWS::EC2::LaunchTemplate",
+      "Properties": {
+        "LaunchTemplateData": {
+          "BlockDeviceMappings": [{"DeviceName": "/dev/xvda", "Ebs": {"VolumeSize": 50}}]
+        }
+      }
+    },
+    "LaunchConfiguration": {
+      "Type": "AWS::AutoScaling::LaunchConfiguration",
+      "Properties": {
+        "BlockDeviceMappings": [{"DeviceName": "/dev/xvda", "Ebs": {"VolumeSize": 50, "Encrypted": "false"}}]
+      }
+    }
+  }
+}`
+
+func TestNewPolicy(t *testing.T) {
+	for _, name := range []string{PolicyEncryptedVolumes, PolicyNoPublicIPs} {
+		policy, err := NewPolicy(name)
+		require.NoError(t, err)
+		assert.Equal(t, name, policy.Name())
+	}
+
+	_, err := NewPolicy("unknown")
+	assert.Error(t, err)
+}
+
+func TestEncryptedVolumesPolicy(t *testing.T) {
+	cluster := &api.Cluster{ID: "kube-1"}
+	policy := encryptedVolumesPolicy{}
+
+	content, err := policy.Check(hookPhaseStackTemplate, cluster, "", testPolicyStackTemplate)
+	require.NoError(t, err)
+
+	var template struct {
+		Resources map[string]struct {
+			Properties struct {
+				Encrypted          interface{}
+				LaunchTemplateData struct {
+					BlockDeviceMappings []struct{ Ebs map[string]interface{} }
+				}
+				BlockDeviceMappings []struct{ Ebs map[string]interface{} }
+			}
+		}
+	}
+	require.NoError(t, json.Unmarshal([]byte(content), &template))
+	assert.Equal(t, true, template.Resources["Volume"].Properties.Encrypted)
+	assert.Equal(t, true, template.Resources["EncryptedVolume"].Properties.Encrypted)
+	assert.Equal(t, true, template.Resources["LaunchTemplate"].Properties.LaunchTemplateData.BlockDeviceMappings[0].Ebs["Encrypted"])
+	assert.Equal(t, true, template.Resources["LaunchConfiguration"].Properties.BlockDeviceMappings[0].Ebs["Encrypted"])
+
+	// encrypted templates and the userdata are kept as they are
+	unchanged, err := policy.Check(hookPhaseEtcdStackTemplate, cluster, "", content)
+	require.NoError(t, err)
+	assert.Equal(t, content, unchanged)
+
+	userData, err := policy.Check(hookPhaseUserData, cluster, "default", "#cloud-config")
+	require.NoError(t, err)
+	assert.Equal(t, "#cloud-config", userData)
+
+	_, err = policy.Check(hookPhaseStackTemplate, cluster, "", "invalid")
+	assert.Error(t, err)
+}
+
+func TestNoPublicIPsPolicy(t *testing.T) {
+	cluster := &api.Cluster{ID: "kube-1"}
+	policy := noPublicIPsPolicy{}
+
+	for _, tc := range []struct {
+		msg      string
+		template string
+		valid    bool
+	}{
+		{
+			msg:      "private resources",
+			template: testPolicyStackTemplate,
+			valid:    true,
+		},
+		{
+			msg:      "private subnet",
+			template: `{"Resources": {"Subnet": {"Type": "AWS::EC2::Subnet", "Properties": {"MapPublicIpOnLaunch": false}}}}`,
+			valid:    true,
+		},
+		{
+			msg:      "public subnet",
+			template: `{"Resources": {"Subnet": {"Type": "AWS::EC2::Subnet", "Properties": {"MapPublicIpOnLaunch": "true"}}}}`,
+		},
+		{
+			msg:      "elastic IP",
+			template: `{"Resources": {"IP": {"Type": "AWS::EC2::EIP"}}}`,
+		},
+		{
+			msg:      "launch configuration",
+			template: `{"Resources": {"LC": {"Type": "AWS::AutoScaling::LaunchConfiguration", "Properties": {"AssociatePublicIpAddress": true}}}}`,
+		},
+		{
+			msg:      "launch template",
+			template: `{"Resources": {"LT": {"Type": "AWS::EC2::LaunchTemplate", "Properties": {"LaunchTemplateData": {"NetworkInterfaces": [{"DeviceIndex": 0, "AssociatePublicIpAddress": true}]}}}}}`,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			content, err := policy.Check(hookPhaseStackTemplate, cluster, "", tc.template)
+			if tc.valid {
+				require.NoError(t, err)
+				assert.Equal(t, tc.template, content)
+			} else {
+				assert.IsType(t, &PolicyViolation{}, err)
+			}
+		})
+	}
+}
+
+func TestProvisionerPoliciesCheck(t *testing.T) {
+	cluster := &api.Cluster{ID: "kube-1"}
+
+	content, err := provisionerPolicies(nil).check(hookPhaseStackTemplate, cluster, "", "template")
+	require.NoError(t, err)
+	assert.Equal(t, "template", content)
+
+	policies := provisionerPolicies{encryptedVolumesPolicy{}, noPublicIPsPolicy{}}
+	_, err = policies.check(hookPhaseStackTemplate, cluster, "", testPolicyStackTemplate)
+	require.NoError(t, err)
+
+	_, err = policies.check(hookPhaseStackTemplate, cluster, "", `{"Resources": {"IP": {"Type": "AWS::EC2::EIP"}}}`)
+	assert.EqualError(t, err, "rejected by policy no-public-ips: IP is an Elastic IP")
+}
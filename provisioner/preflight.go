@@ -0,0 +1,226 @@
+package provisioner
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+)
+
+const (
+	preflightCheckCredentials         = "credentials"
+	preflightCheckASGQuota            = "asg-quota"
+	preflightCheckInstanceQuota       = "instance-quota"
+	preflightCheckLaunchTemplateQuota = "launch-template-quota"
+	preflightCheckVCPUQuota           = "vcpu-quota"
+	preflightCheckS3Bucket            = "s3-bucket"
+	preflightCheckProfiles            = "profiles"
+	preflightCheckPricing             = "pricing"
+	preflightCheckNetwork             = "network"
+
+	maxInstancesAttribute = "max-instances"
+)
+
+// PreflightCheck is the result of a single preflight check. Err is nil if the
+// check passed.
+type PreflightCheck struct {
+	Name string
+	Err  error
+}
+
+// PreflightReport is the result of all preflight checks of a cluster.
+type PreflightReport struct {
+	Checks []*PreflightCheck
+}
+
+// add records the result of the check with the given name.
+func (r *PreflightReport) add(name string, err error) {
+	r.Checks = append(r.Checks, &PreflightCheck{Name: name, Err: err})
+}
+
+// Failed returns the checks which didn't pass.
+func (r *PreflightReport) Failed() []*PreflightCheck {
+	var failed []*PreflightCheck
+	for _, check := range r.Checks {
+		if check.Err != nil {
+			failed = append(failed, check)
+		}
+	}
+	return failed
+}
+
+// Err returns a PreflightError if any of the checks failed, otherwise nil.
+func (r *PreflightReport) Err() error {
+	failed := r.Failed()
+	if len(failed) == 0 {
+		return nil
+	}
+	return &PreflightError{Failed: failed}
+}
+
+// PreflightError is returned if a cluster isn't provisioned because some of
+// its preflight checks failed.
+type PreflightError struct {
+	Failed []*PreflightCheck
+}
+
+func (e *PreflightError) Error() string {
+	msgs := make([]string, 0, len(e.Failed))
+	for _, check := range e.Failed {
+		msgs = append(msgs, fmt.Sprintf("%s: %v", check.Name, check.Err))
+	}
+	return fmt.Sprintf("preflight checks failed: %s", strings.Join(msgs, ", "))
+}
+
+// checkProfiles verifies that the profiles of all node pools and their base
+// profiles exist in basePath.
+func checkProfiles(basePath string, cluster *api.Cluster) error {
+	for _, nodePool := range cluster.NodePools {
+		dirs, err := profileDirs(basePath, nodePool.Profile)
+		if err != nil {
+			return fmt.Errorf("node pool %s: %v", nodePool.Name, err)
+		}
+
+		for _, dir := range dirs {
+			info, err := os.Stat(dir)
+			if err != nil {
+				return fmt.Errorf("node pool %s: %v", nodePool.Name, err)
+			}
+			if !info.IsDir() {
+				return fmt.Errorf("node pool %s: profile %s is not a directory", nodePool.Name, dir)
+			}
+		}
+	}
+	return nil
+}
+
+// preflight runs the read-only checks of an AWS cluster before anything is
+// changed. Both the legacy instance limit and the vCPU quotas of the account
+// are checked.
+func (a *awsAdapter) preflight(cluster *api.Cluster, basePath string) *PreflightReport {
+	report := &PreflightReport{}
+
+	_, err := a.iamClient.ListAccountAliases(&iam.ListAccountAliasesInput{})
+	report.add(preflightCheckCredentials, err)
+	if err != nil {
+		// all other AWS checks would fail the same way.
+		report.add(preflightCheckProfiles, checkProfiles(basePath, cluster))
+		return report
+	}
+
+	report.add(preflightCheckASGQuota, a.checkASGQuota(cluster))
+	report.add(preflightCheckLaunchTemplateQuota, a.checkLaunchTemplateQuota(cluster))
+	report.add(preflightCheckInstanceQuota, a.checkInstanceQuota(cluster))
+	report.add(preflightCheckVCPUQuota, a.checkVCPUQuota(cluster))
+
+	bucket, err := clmBucketName(cluster)
+	if err != nil {
+		report.add(preflightCheckS3Bucket, err)
+	} else {
+		report.add(preflightCheckS3Bucket, a.checkS3Bucket(bucket))
+	}
+
+	report.add(preflightCheckProfiles, checkProfiles(basePath, cluster))
+	report.add(preflightCheckPricing, a.checkPricing(cluster))
+	report.add(preflightCheckNetwork, a.checkNetwork())
+
+	return report
+}
+
+// checkASGQuota verifies that the ASGs of node pools not created yet fit into
+// the ASG limit of the account.
+func (a *awsAdapter) checkASGQuota(cluster *api.Cluster) error {
+	limits, err := a.autoscalingClient.DescribeAccountLimits(&autoscaling.DescribeAccountLimitsInput{})
+	if err != nil {
+		return err
+	}
+
+	groups, err := a.listStackASGs(cluster.LocalID)
+	if err != nil {
+		return err
+	}
+
+	required := int64(len(cluster.NodePools) - len(groups))
+	available := aws.Int64Value(limits.MaxNumberOfAutoScalingGroups) - aws.Int64Value(limits.NumberOfAutoScalingGroups)
+	if required > available {
+		return fmt.Errorf("%d ASGs required, but only %d of %d available", required, available, aws.Int64Value(limits.MaxNumberOfAutoScalingGroups))
+	}
+	return nil
+}
+
+// checkInstanceQuota verifies that the node pools scaled to their max size
+// don't exceed the instance limit of the account.
+func (a *awsAdapter) checkInstanceQuota(cluster *api.Cluster) error {
+	resp, err := a.ec2Client.DescribeAccountAttributes(&ec2.DescribeAccountAttributesInput{
+		AttributeNames: []*string{aws.String(maxInstancesAttribute)},
+	})
+	if err != nil {
+		return err
+	}
+
+	var maxInstances int64
+	for _, attribute := range resp.AccountAttributes {
+		if aws.StringValue(attribute.AttributeName) != maxInstancesAttribute || len(attribute.AttributeValues) == 0 {
+			continue
+		}
+		maxInstances, err = strconv.ParseInt(aws.StringValue(attribute.AttributeValues[0].AttributeValue), 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid %s attribute: %v", maxInstancesAttribute, err)
+		}
+	}
+
+	if maxInstances == 0 {
+		return nil
+	}
+
+	var required int64
+	for _, nodePool := range cluster.NodePools {
+		required += nodePool.MaxSize
+	}
+
+	if required > maxInstances {
+		return fmt.Errorf("node pools scale to %d instances, but the instance limit is %d", required, maxInstances)
+	}
+	return nil
+}
+
+// checkS3Bucket verifies that the bucket is accessible. Missing buckets are
+// created when the cluster is provisioned.
+func (a *awsAdapter) checkS3Bucket(bucket string) error {
+	_, err := a.s3Client.HeadBucket(&s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	if aerr, ok := err.(awserr.Error); ok && aerr.Code() == "NotFound" {
+		return nil
+	}
+	return err
+}
+
+// checkPricing verifies that the on-demand price of the instance types of
+// node pools using spot instances is known and that a price oracle is
+// configured for the node pools relying on it.
+func (a *awsAdapter) checkPricing(cluster *api.Cluster) error {
+	for _, nodePool := range cluster.NodePools {
+		if !isSpotNodePool(nodePool) {
+			continue
+		}
+
+		if nodePool.DiscountStrategy == discountStrategyPriceOracle && a.priceOracle == nil {
+			return fmt.Errorf("node pool %s: discount_strategy %s requires --price-oracle-url", nodePool.Name, discountStrategyPriceOracle)
+		}
+
+		_, err := awsExt.OnDemandPrice(nodePool.InstanceType, cluster.Region, a.priceSource)
+		if err != nil {
+			return fmt.Errorf("node pool %s: %v", nodePool.Name, err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,196 @@
+package provisioner
+
+import (
+	"errors"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/aws/aws-sdk-go/service/iam"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type preflightIAMAPIStub struct {
+	iamAPI
+	err error
+}
+
+func (i *preflightIAMAPIStub) ListAccountAliases(input *iam.ListAccountAliasesInput) (*iam.ListAccountAliasesOutput, error) {
+	return &iam.ListAccountAliasesOutput{}, i.err
+}
+
+type preflightAutoscalingAPIStub struct {
+	autoscalingAPI
+	groups    []*autoscaling.Group
+	maxGroups int64
+}
+
+func (a *preflightAutoscalingAPIStub) DescribeAutoScalingGroups(input *autoscaling.DescribeAutoScalingGroupsInput) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	return &autoscaling.DescribeAutoScalingGroupsOutput{AutoScalingGroups: a.groups}, nil
+}
+
+func (a *preflightAutoscalingAPIStub) DescribeAccountLimits(input *autoscaling.DescribeAccountLimitsInput) (*autoscaling.DescribeAccountLimitsOutput, error) {
+	return &autoscaling.DescribeAccountLimitsOutput{
+		MaxNumberOfAutoScalingGroups: aws.Int64(a.maxGroups),
+		NumberOfAutoScalingGroups:    aws.Int64(int64(len(a.groups))),
+	}, nil
+}
+
+type preflightEC2APIStub struct {
+	ec2API
+	maxInstances string
+}
+
+func (e *preflightEC2APIStub) DescribeAccountAttributes(input *ec2.DescribeAccountAttributesInput) (*ec2.DescribeAccountAttributesOutput, error) {
+	return &ec2.DescribeAccountAttributesOutput{
+		AccountAttributes: []*ec2.AccountAttribute{
+			{
+				AttributeName: aws.String(maxInstancesAttribute),
+				AttributeValues: []*ec2.AccountAttributeValue{
+					{AttributeValue: aws.String(e.maxInstances)},
+				},
+			},
+		},
+	}, nil
+}
+
+func (e *preflightEC2APIStub) DescribeLaunchTemplates(input *ec2.DescribeLaunchTemplatesInput) (*ec2.DescribeLaunchTemplatesOutput, error) {
+	return &ec2.DescribeLaunchTemplatesOutput{}, nil
+}
+
+type preflightS3APIStub struct {
+	s3API
+	err error
+}
+
+func (s *preflightS3APIStub) HeadBucket(input *s3.HeadBucketInput) (*s3.HeadBucketOutput, error) {
+	return &s3.HeadBucketOutput{}, s.err
+}
+
+func TestPreflight(t *testing.T) {
+	basePath, err := ioutil.TempDir("", "profiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(basePath)
+
+	writeProfileFiles(t, basePath, map[string]string{
+		"node-pools/master-default/.keep":    "",
+		"node-pools/worker-default/.keep":    "",
+		"node-pools/worker-gpu/profile.yaml": "base: worker-missing",
+	})
+
+	stackASG := &autoscaling.Group{
+		AutoScalingGroupName: aws.String("kube-1-worker"),
+		Tags: []*autoscaling.TagDescription{
+			{Key: aws.String("aws:cloudformation:stack-name"), Value: aws.String("kube-1")},
+		},
+	}
+
+	for _, tc := range []struct {
+		msg          string
+		iamErr       error
+		groups       []*autoscaling.Group
+		maxGroups    int64
+		maxInstances string
+		s3Err        error
+		nodePools    []*api.NodePool
+		failed       []string
+	}{
+		{
+			msg:          "all checks pass",
+			groups:       []*autoscaling.Group{stackASG},
+			maxGroups:    2,
+			maxInstances: "20",
+			s3Err:        awserr.New("NotFound", "not found", nil),
+		},
+		{
+			msg:          "invalid credentials skip the AWS checks",
+			iamErr:       errors.New("expired"),
+			maxGroups:    2,
+			maxInstances: "20",
+			failed:       []string{preflightCheckCredentials},
+		},
+		{
+			msg:          "ASG and instance limits exceeded",
+			maxGroups:    1,
+			maxInstances: "5",
+			failed:       []string{preflightCheckASGQuota, preflightCheckInstanceQuota},
+		},
+		{
+			msg:          "vCPU quota exceeded",
+			maxGroups:    2,
+			maxInstances: "20",
+			nodePools: []*api.NodePool{
+				{Name: "master-default", Profile: "master-default", InstanceType: "m5.large", MaxSize: 2},
+				{Name: "worker-default", Profile: "worker-default", InstanceType: "m5.4xlarge", MaxSize: 10},
+			},
+			failed: []string{preflightCheckVCPUQuota},
+		},
+		{
+			msg:          "inaccessible bucket",
+			maxGroups:    2,
+			maxInstances: "20",
+			s3Err:        awserr.New("Forbidden", "forbidden", nil),
+			failed:       []string{preflightCheckS3Bucket},
+		},
+		{
+			msg:          "broken profiles and missing prices",
+			maxGroups:    2,
+			maxInstances: "20",
+			nodePools: []*api.NodePool{
+				{Name: "worker-gpu", Profile: "worker-gpu", InstanceType: "x9.unknown", DiscountStrategy: discountStrategySpotMaxPrice},
+			},
+			failed: []string{preflightCheckProfiles, preflightCheckPricing},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			a := &awsAdapter{
+				iamClient:           &preflightIAMAPIStub{err: tc.iamErr},
+				autoscalingClient:   &preflightAutoscalingAPIStub{groups: tc.groups, maxGroups: tc.maxGroups},
+				ec2Client:           &preflightEC2APIStub{maxInstances: tc.maxInstances},
+				s3Client:            &preflightS3APIStub{err: tc.s3Err},
+				region:              "eu-central-1",
+				logger:              log.WithField("test", true),
+				serviceQuotasClient: &serviceQuotasAPIStub{quotas: map[string]float64{"L-1216C47A": 64}},
+			}
+
+			nodePools := tc.nodePools
+			if nodePools == nil {
+				nodePools = []*api.NodePool{
+					{Name: "master-default", Profile: "master-default", MaxSize: 2},
+					{Name: "worker-default", Profile: "worker-default", MaxSize: 10},
+				}
+			}
+
+			cluster := &api.Cluster{
+				ID:                    "kube-1",
+				LocalID:               "kube-1",
+				InfrastructureAccount: "aws:123456789012",
+				Region:                "eu-central-1",
+				NodePools:             nodePools,
+			}
+
+			report := a.preflight(cluster, basePath)
+
+			var failed []string
+			for _, check := range report.Failed() {
+				failed = append(failed, check.Name)
+			}
+			assert.Equal(t, tc.failed, failed)
+
+			if len(tc.failed) == 0 {
+				assert.NoError(t, report.Err())
+			} else {
+				require.IsType(t, &PreflightError{}, report.Err())
+			}
+		})
+	}
+}
@@ -0,0 +1,251 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+const (
+	// profileConfigFile is the file in the directory of a node pool
+	// profile declaring the profile it's based on.
+	profileConfigFile = "profile.yaml"
+	// profileSchemaVersion is the newest schema version of the profiles
+	// supported by this CLM. It's increased whenever the templates get new
+	// functions or NodePool fields, such that profiles using them can't be
+	// rendered by older CLM versions.
+	profileSchemaVersion = 1
+	// maxProfileDepth limits how many base profiles a profile can have.
+	maxProfileDepth = 10
+)
+
+// profileConfig is the content of the profileConfigFile.
+type profileConfig struct {
+	// Base is the profile whose files are used unless the profile
+	// overrides them.
+	Base string `yaml:"base"`
+	// MinCLMVersion is the oldest CLM version able to render the
+	// profile.
+	MinCLMVersion string `yaml:"min_clm_version"`
+	// SchemaVersion is the schema version of the templates of the
+	// profile, see profileSchemaVersion.
+	SchemaVersion int `yaml:"schema_version"`
+}
+
+// profileDirs returns the directories of a node pool profile and its base
+// profiles in basePath, starting with the profile itself. No directories are
+// returned for an empty profile. Profiles must be inside the node-pools
+// directory and must not inherit from themselves.
+func profileDirs(basePath, profile string) ([]string, error) {
+	nodePoolsDir, err := filepath.Abs(path.Join(basePath, "node-pools"))
+	if err != nil {
+		return nil, err
+	}
+
+	var dirs []string
+	seen := make(map[string]bool)
+	for profile != "" {
+		if seen[profile] {
+			return nil, fmt.Errorf("profile %s inherits from itself", profile)
+		}
+		seen[profile] = true
+
+		if len(dirs) >= maxProfileDepth {
+			return nil, fmt.Errorf("max profile depth of %d exceeded by profile %s", maxProfileDepth, profile)
+		}
+
+		dir, err := filepath.Abs(path.Join(nodePoolsDir, profile))
+		if err != nil {
+			return nil, err
+		}
+
+		if !strings.HasPrefix(dir, nodePoolsDir+string(filepath.Separator)) {
+			return nil, fmt.Errorf("invalid profile path: %s", profile)
+		}
+		dirs = append(dirs, dir)
+
+		data, err := ioutil.ReadFile(path.Join(dir, profileConfigFile))
+		if err != nil {
+			if os.IsNotExist(err) {
+				break
+			}
+			return nil, err
+		}
+
+		var config profileConfig
+		err = yaml.Unmarshal(data, &config)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s of profile %s: %v", profileConfigFile, profile, err)
+		}
+		profile = config.Base
+	}
+
+	return dirs, nil
+}
+
+// checkProfileCompatibility verifies that the running CLM version is able to
+// render the profiles of all node pools of the cluster and their base
+// profiles. The minimum CLM version isn't checked if clmVersion is empty.
+func checkProfileCompatibility(basePath string, cluster *api.Cluster, clmVersion string) error {
+	checked := make(map[string]bool)
+	for _, nodePool := range cluster.NodePools {
+		dirs, err := profileDirs(basePath, nodePool.Profile)
+		if err != nil {
+			return fmt.Errorf("node pool %s: %v", nodePool.Name, err)
+		}
+
+		for _, dir := range dirs {
+			if checked[dir] {
+				continue
+			}
+			checked[dir] = true
+
+			data, err := ioutil.ReadFile(path.Join(dir, profileConfigFile))
+			if err != nil {
+				if os.IsNotExist(err) {
+					continue
+				}
+				return err
+			}
+
+			var config profileConfig
+			err = yaml.Unmarshal(data, &config)
+			if err != nil {
+				return fmt.Errorf("invalid %s of profile %s: %v", profileConfigFile, path.Base(dir), err)
+			}
+
+			if config.SchemaVersion > profileSchemaVersion {
+				return fmt.Errorf("node pool %s: profile %s uses schema version %d, CLM %s only supports up to %d: upgrade CLM", nodePool.Name, path.Base(dir), config.SchemaVersion, clmVersion, profileSchemaVersion)
+			}
+
+			if config.MinCLMVersion == "" || clmVersion == "" {
+				continue
+			}
+
+			older, err := channel.OlderThan(clmVersion, config.MinCLMVersion)
+			if err != nil {
+				return fmt.Errorf("invalid min_clm_version of profile %s: %v", path.Base(dir), err)
+			}
+			if older {
+				return fmt.Errorf("node pool %s: profile %s requires CLM version >= %s, running %s: upgrade CLM", nodePool.Name, path.Base(dir), config.MinCLMVersion, clmVersion)
+			}
+		}
+	}
+	return nil
+}
+
+// profileFile returns the path of the file of a node pool profile. If the
+// profile doesn't have the file, the file of the closest base profile having
+// it is returned. If none of them has the file, the path in the directory of
+// the profile is returned.
+func profileFile(basePath, profile, name string) (string, error) {
+	dirs, err := profileDirs(basePath, profile)
+	if err != nil {
+		return "", err
+	}
+
+	for _, dir := range dirs {
+		file := path.Join(dir, name)
+		_, err := os.Stat(file)
+		if err == nil {
+			return file, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	return path.Join(basePath, "node-pools", profile, name), nil
+}
+
+// readProfileJSON reads a JSON file of a node pool profile. The JSON objects
+// of the files of its base profiles are merged with the ones of the profile,
+// such that a profile only has to define the fields it overrides. Nested
+// objects are merged, all other values including lists are replaced.
+func readProfileJSON(basePath, profile, name string) ([]byte, error) {
+	dirs, err := profileDirs(basePath, profile)
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, dir := range dirs {
+		file := path.Join(dir, name)
+		_, err := os.Stat(file)
+		if err == nil {
+			files = append(files, file)
+			continue
+		}
+		if !os.IsNotExist(err) {
+			return nil, err
+		}
+	}
+
+	// files which aren't overridden are returned as they are.
+	switch len(files) {
+	case 0:
+		return ioutil.ReadFile(path.Join(basePath, "node-pools", profile, name))
+	case 1:
+		return ioutil.ReadFile(files[0])
+	}
+
+	merged := make(map[string]interface{})
+	for i := len(files) - 1; i >= 0; i-- {
+		data, err := ioutil.ReadFile(files[i])
+		if err != nil {
+			return nil, err
+		}
+
+		var overlay map[string]interface{}
+		err = json.Unmarshal(data, &overlay)
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", files[i], err)
+		}
+		mergeJSON(merged, overlay)
+	}
+
+	return json.Marshal(merged)
+}
+
+// mergeJSON merges the JSON object overlay into base.
+func mergeJSON(base, overlay map[string]interface{}) {
+	for key, value := range overlay {
+		baseObject, baseIsObject := base[key].(map[string]interface{})
+		object, isObject := value.(map[string]interface{})
+		if baseIsObject && isObject {
+			mergeJSON(baseObject, object)
+			continue
+		}
+		base[key] = value
+	}
+}
+
+// profilePartialProvider provides mustache partials from the directories of
+// a node pool profile and its base profiles, falling back to the directory
+// of the userdata template. The first directory having the partial is used,
+// such that profiles can override parts of the userdata.
+type profilePartialProvider struct {
+	dirs    []string
+	baseDir string
+}
+
+// Get returns the content of the partial name.
+func (p *profilePartialProvider) Get(name string) (string, error) {
+	for _, dir := range p.dirs {
+		_, err := os.Stat(path.Join(dir, name))
+		if os.IsNotExist(err) {
+			continue
+		}
+		return (&sandboxedPartialProvider{baseDir: dir}).Get(name)
+	}
+	return (&sandboxedPartialProvider{baseDir: p.baseDir}).Get(name)
+}
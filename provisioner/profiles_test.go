@@ -0,0 +1,208 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func writeProfileFiles(t *testing.T, basePath string, files map[string]string) {
+	for name, content := range files {
+		file := path.Join(basePath, name)
+		require.NoError(t, os.MkdirAll(path.Dir(file), 0755))
+		require.NoError(t, ioutil.WriteFile(file, []byte(content), 0644))
+	}
+}
+
+func TestProfileDirs(t *testing.T) {
+	basePath, err := ioutil.TempDir("", "profiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(basePath)
+
+	writeProfileFiles(t, basePath, map[string]string{
+		"node-pools/worker-default/profile.yaml": "",
+		"node-pools/worker-gpu/profile.yaml":     "base: worker-default",
+		"node-pools/worker-a/profile.yaml":       "base: worker-b",
+		"node-pools/worker-b/profile.yaml":       "base: worker-a",
+		"node-pools/worker-escape/profile.yaml":  "base: ../../etc",
+		"node-pools/worker-invalid/profile.yaml": "base: [",
+	})
+
+	dirs, err := profileDirs(basePath, "")
+	require.NoError(t, err)
+	assert.Empty(t, dirs)
+
+	dirs, err = profileDirs(basePath, "worker-gpu")
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		path.Join(basePath, "node-pools", "worker-gpu"),
+		path.Join(basePath, "node-pools", "worker-default"),
+	}, dirs)
+
+	// profiles without a directory don't have a base.
+	dirs, err = profileDirs(basePath, "worker-missing")
+	require.NoError(t, err)
+	assert.Equal(t, []string{path.Join(basePath, "node-pools", "worker-missing")}, dirs)
+
+	for _, profile := range []string{"worker-a", "worker-escape", "worker-invalid", "../worker-default"} {
+		_, err := profileDirs(basePath, profile)
+		assert.Error(t, err, profile)
+	}
+}
+
+func TestProfileFile(t *testing.T) {
+	basePath, err := ioutil.TempDir("", "profiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(basePath)
+
+	writeProfileFiles(t, basePath, map[string]string{
+		"node-pools/worker-default/ignition-pointer.yaml": "",
+		"node-pools/worker-gpu/profile.yaml":              "base: worker-default",
+		"node-pools/worker-other/profile.yaml":            "base: worker-gpu",
+		"node-pools/worker-other/ignition-pointer.yaml":   "",
+	})
+
+	for _, tc := range []struct {
+		profile  string
+		expected string
+	}{
+		{profile: "worker-default", expected: "node-pools/worker-default/ignition-pointer.yaml"},
+		{profile: "worker-gpu", expected: "node-pools/worker-default/ignition-pointer.yaml"},
+		{profile: "worker-other", expected: "node-pools/worker-other/ignition-pointer.yaml"},
+		{profile: "worker-missing", expected: "node-pools/worker-missing/ignition-pointer.yaml"},
+	} {
+		t.Run(tc.profile, func(t *testing.T) {
+			file, err := profileFile(basePath, tc.profile, ignitionPointerFile)
+			require.NoError(t, err)
+			assert.Equal(t, path.Join(basePath, tc.expected), file)
+		})
+	}
+}
+
+func TestReadProfileJSON(t *testing.T) {
+	basePath, err := ioutil.TempDir("", "profiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(basePath)
+
+	writeProfileFiles(t, basePath, map[string]string{
+		"node-pools/worker-default/vmss.json": `{"sku": {"name": "Standard_D2s_v3", "tier": "Standard"}, "zones": ["1", "2"]}`,
+		"node-pools/worker-gpu/profile.yaml":  "base: worker-default",
+		"node-pools/worker-gpu/vmss.json":     `{"sku": {"name": "Standard_NC6"}, "zones": ["1"]}`,
+		"node-pools/worker-spot/profile.yaml": "base: worker-default",
+	})
+
+	data, err := readProfileJSON(basePath, "worker-default", azureTemplateFile)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"sku": {"name": "Standard_D2s_v3", "tier": "Standard"}, "zones": ["1", "2"]}`, string(data))
+
+	data, err = readProfileJSON(basePath, "worker-spot", azureTemplateFile)
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"sku": {"name": "Standard_D2s_v3", "tier": "Standard"}, "zones": ["1", "2"]}`, string(data))
+
+	// objects are merged, lists are replaced.
+	data, err = readProfileJSON(basePath, "worker-gpu", azureTemplateFile)
+	require.NoError(t, err)
+	var merged map[string]interface{}
+	require.NoError(t, json.Unmarshal(data, &merged))
+	assert.Equal(t, map[string]interface{}{
+		"sku":   map[string]interface{}{"name": "Standard_NC6", "tier": "Standard"},
+		"zones": []interface{}{"1"},
+	}, merged)
+
+	_, err = readProfileJSON(basePath, "worker-missing", azureTemplateFile)
+	assert.Error(t, err)
+}
+
+func TestRenderProfileUserData(t *testing.T) {
+	basePath, err := ioutil.TempDir("", "profiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(basePath)
+
+	writeProfileFiles(t, basePath, map[string]string{
+		"worker.clc.yaml":                    "{{> kubelet.yaml}}\n{{> sysctl.yaml}}",
+		"kubelet.yaml":                       "kubelet: default",
+		"sysctl.yaml":                        "sysctl: default",
+		"node-pools/worker-default/.keep":    "",
+		"node-pools/worker-gpu/profile.yaml": "base: worker-default",
+		"node-pools/worker-gpu/kubelet.yaml": "kubelet: {{NODE_POOL}}",
+	})
+
+	config := map[string]string{"NODE_POOL": "gpu"}
+	file := path.Join(basePath, "worker.clc.yaml")
+
+	rendered, err := renderProfileUserData(file, "worker-default", config, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "kubelet: default\nsysctl: default", rendered)
+
+	rendered, err = renderProfileUserData(file, "worker-gpu", config, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "kubelet: gpu\nsysctl: default", rendered)
+
+	rendered, err = renderUserData(file, config, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "kubelet: default\nsysctl: default", rendered)
+}
+
+func TestCheckProfileCompatibility(t *testing.T) {
+	basePath, err := ioutil.TempDir("", "profiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(basePath)
+
+	writeProfileFiles(t, basePath, map[string]string{
+		"node-pools/worker-default/profile.yaml": "min_clm_version: v0.5.0\nschema_version: 1",
+		"node-pools/worker-gpu/profile.yaml":     "base: worker-default",
+		"node-pools/worker-next/profile.yaml":    "base: worker-default\nschema_version: 2",
+		"node-pools/worker-invalid/profile.yaml": "min_clm_version: latest",
+		"node-pools/worker-legacy/.keep":         "",
+	})
+
+	cluster := func(profile string) *api.Cluster {
+		return &api.Cluster{NodePools: []*api.NodePool{{Name: "pool", Profile: profile}}}
+	}
+
+	for _, tc := range []struct {
+		msg        string
+		profile    string
+		clmVersion string
+		expected   string
+	}{
+		{msg: "profile without metadata", profile: "worker-legacy", clmVersion: "v0.1.0"},
+		{msg: "supported version", profile: "worker-gpu", clmVersion: "v0.5.0"},
+		{msg: "development build", profile: "worker-gpu", clmVersion: "unknown"},
+		{msg: "unknown version", profile: "worker-gpu"},
+		{
+			msg:        "version required by the base profile",
+			profile:    "worker-gpu",
+			clmVersion: "v0.4.9-3-g1a2b3c4",
+			expected:   "node pool pool: profile worker-default requires CLM version >= v0.5.0, running v0.4.9-3-g1a2b3c4: upgrade CLM",
+		},
+		{
+			msg:        "newer schema",
+			profile:    "worker-next",
+			clmVersion: "v0.5.0",
+			expected:   "node pool pool: profile worker-next uses schema version 2, CLM v0.5.0 only supports up to 1: upgrade CLM",
+		},
+		{
+			msg:        "invalid version",
+			profile:    "worker-invalid",
+			clmVersion: "v0.5.0",
+			expected:   "invalid min_clm_version of profile worker-invalid: invalid version 'latest'",
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := checkProfileCompatibility(basePath, cluster(tc.profile), tc.clmVersion)
+			if tc.expected == "" {
+				assert.NoError(t, err)
+				return
+			}
+			assert.EqualError(t, err, tc.expected)
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package provisioner
+
+import (
+	"context"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+// providerProvisioner dispatches to the provisioner supporting the provider
+// of a cluster.
+type providerProvisioner []Provisioner
+
+// NewProviderProvisioner returns a provisioner which passes each cluster to
+// the first of the provisioners supporting its provider. Clusters of other
+// providers fail with ErrProviderNotSupported.
+func NewProviderProvisioner(provisioners ...Provisioner) Provisioner {
+	return providerProvisioner(provisioners)
+}
+
+// Provision provisions the cluster with the provisioner of its provider.
+func (p providerProvisioner) Provision(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	for _, provisioner := range p {
+		err := provisioner.Provision(ctx, cluster, channelConfig)
+		if err != ErrProviderNotSupported {
+			return err
+		}
+	}
+	return ErrProviderNotSupported
+}
+
+// Decommission decommissions the cluster with the provisioner of its
+// provider.
+func (p providerProvisioner) Decommission(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	for _, provisioner := range p {
+		err := provisioner.Decommission(ctx, cluster, channelConfig)
+		if err != ErrProviderNotSupported {
+			return err
+		}
+	}
+	return ErrProviderNotSupported
+}
+
+// Suspend suspends the cluster with the provisioner of its provider.
+func (p providerProvisioner) Suspend(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	for _, provisioner := range p {
+		err := provisioner.Suspend(ctx, cluster, channelConfig)
+		if err != ErrProviderNotSupported {
+			return err
+		}
+	}
+	return ErrProviderNotSupported
+}
+
+// Resume resumes the cluster with the provisioner of its provider.
+func (p providerProvisioner) Resume(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	for _, provisioner := range p {
+		err := provisioner.Resume(ctx, cluster, channelConfig)
+		if err != ErrProviderNotSupported {
+			return err
+		}
+	}
+	return ErrProviderNotSupported
+}
+
+// Reconcile reconciles the cluster with the provisioner of its provider.
+func (p providerProvisioner) Reconcile(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	for _, provisioner := range p {
+		err := provisioner.Reconcile(ctx, cluster, channelConfig)
+		if err != ErrProviderNotSupported {
+			return err
+		}
+	}
+	return ErrProviderNotSupported
+}
+
+// Version returns the version of the cluster computed by the provisioner of
+// its provider.
+func (p providerProvisioner) Version(cluster *api.Cluster, channelConfig *channel.Config) (string, error) {
+	for _, provisioner := range p {
+		version, err := provisioner.Version(cluster, channelConfig)
+		if err != ErrProviderNotSupported {
+			return version, err
+		}
+	}
+	return "", ErrProviderNotSupported
+}
+
+// Preflight runs the preflight checks of the provisioner of the provider of
+// the cluster.
+func (p providerProvisioner) Preflight(cluster *api.Cluster, channelConfig *channel.Config) (*PreflightReport, error) {
+	for _, provisioner := range p {
+		report, err := provisioner.Preflight(cluster, channelConfig)
+		if err != ErrProviderNotSupported {
+			return report, err
+		}
+	}
+	return nil, ErrProviderNotSupported
+}
@@ -1,11 +1,15 @@
 package provisioner
 
 import (
+	"context"
 	"errors"
 
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
 )
 
 var (
@@ -20,12 +24,59 @@ type Options struct {
 	ApplyOnly      bool
 	UpdateStrategy config.UpdateStrategy
 	RemoveVolumes  bool
+	// KubeconfigProvider defines how to reach the API server of the
+	// clusters.
+	KubeconfigProvider kubernetes.KubeconfigProvider
+	// PriceSource is used to look up on-demand prices of instance types
+	// missing from the bundled instance info.
+	PriceSource awsExt.PriceSource
+	// PriceOracleURL is the URL of the price oracle returning the max
+	// price of spot node pools with the price_oracle discount strategy.
+	PriceOracleURL string
+	// DisasterRecovery re-applies the stacks and manifests without
+	// updating the node pools and continues if the API server isn't
+	// reachable, such that a cluster with a degraded control plane can be
+	// rebuilt.
+	DisasterRecovery bool
+	// Initiator identifies who started the provisioning in the cost
+	// attribution tags of the stacks and S3 objects.
+	Initiator string
+	// Hooks are executables run with the rendered stack templates and
+	// userdata of the clusters, which can change them or veto the update.
+	Hooks []string
+	// Policies check the rendered stack templates and userdata of the
+	// clusters after the hooks, they can change them or reject the update.
+	Policies []Policy
+	// ReadOnly renders, validates and diffs the clusters without calling
+	// any API which could change resources. It implies DryRun.
+	ReadOnly bool
+	// ThrottleRetry defines how CloudFormation and S3 calls failing
+	// because of API rate limits are retried.
+	ThrottleRetry config.ThrottleRetry
+	// Auditor records the API calls changing the resources of the
+	// clusters. Nothing is recorded if it's nil.
+	Auditor *audit.Auditor
+	// RateLimiter limits the rate of the AWS API requests of the clusters
+	// per account, region and service. Nothing is limited if it's nil.
+	RateLimiter *awsExt.APIRateLimiter
+	// Version is the version of the running CLM, which is checked against
+	// the minimum CLM versions of the node pool profiles.
+	Version string
 }
 
-// Provisioner is an interface describing how to provision or decommission
-// clusters.
+// Provisioner is an interface describing how to provision, decommission,
+// suspend or resume clusters. Provisioning and decommissioning stop waiting
+// for stack operations and node pool updates when the context is cancelled.
+// Preflight runs read-only checks of a cluster which are expected to pass
+// before it's provisioned. Reconcile is called for clusters which are up to
+// date and maintains the state which doesn't depend on the version of the
+// cluster, e.g. the startup taint of new nodes.
 type Provisioner interface {
-	Provision(cluster *api.Cluster, channelConfig *channel.Config) error
-	Decommission(cluster *api.Cluster, channelConfig *channel.Config) error
+	Provision(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error
+	Decommission(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error
+	Suspend(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error
+	Resume(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error
 	Version(cluster *api.Cluster, channelConfig *channel.Config) (string, error)
+	Preflight(cluster *api.Cluster, channelConfig *channel.Config) (*PreflightReport, error)
+	Reconcile(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error
 }
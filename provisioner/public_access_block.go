@@ -0,0 +1,81 @@
+package provisioner
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"io"
+
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/private/protocol"
+	"github.com/aws/aws-sdk-go/private/protocol/restxml"
+	"github.com/aws/aws-sdk-go/service/s3"
+)
+
+// The PutPublicAccessBlock operation is missing from the vendored AWS SDK, so
+// it's defined here and sent with the REST XML protocol client of S3.
+
+type publicAccessBlockConfiguration struct {
+	_                     struct{} `type:"structure"`
+	BlockPublicAcls       *bool    `locationName:"BlockPublicAcls" type:"boolean"`
+	BlockPublicPolicy     *bool    `locationName:"BlockPublicPolicy" type:"boolean"`
+	IgnorePublicAcls      *bool    `locationName:"IgnorePublicAcls" type:"boolean"`
+	RestrictPublicBuckets *bool    `locationName:"RestrictPublicBuckets" type:"boolean"`
+}
+
+type putPublicAccessBlockInput struct {
+	_                              struct{}                        `type:"structure" payload:"PublicAccessBlockConfiguration"`
+	Bucket                         *string                         `location:"uri" locationName:"Bucket" type:"string"`
+	PublicAccessBlockConfiguration *publicAccessBlockConfiguration `locationName:"PublicAccessBlockConfiguration" type:"structure" xmlURI:"http://s3.amazonaws.com/doc/2006-03-01/"`
+}
+
+type putPublicAccessBlockOutput struct {
+	_ struct{} `type:"structure"`
+}
+
+// publicAccessBlockAPI is the minimal interface containing the public access
+// block operations of the S3 API.
+type publicAccessBlockAPI interface {
+	PutPublicAccessBlock(input *putPublicAccessBlockInput) (*putPublicAccessBlockOutput, error)
+}
+
+// s3RestClient sends the operations of the S3 API missing from the vendored
+// AWS SDK with the REST XML protocol client of the service.
+type s3RestClient struct {
+	client *s3.S3
+}
+
+func (c *s3RestClient) PutPublicAccessBlock(input *putPublicAccessBlockInput) (*putPublicAccessBlockOutput, error) {
+	op := &request.Operation{
+		Name:       "PutPublicAccessBlock",
+		HTTPMethod: "PUT",
+		HTTPPath:   "/{Bucket}?publicAccessBlock",
+	}
+	output := &putPublicAccessBlockOutput{}
+
+	req := c.client.NewRequest(op, input, output)
+	req.Handlers.Build.PushBackNamed(request.NamedHandler{Name: "clm.ContentMD5Handler", Fn: contentMD5})
+	req.Handlers.Unmarshal.Remove(restxml.UnmarshalHandler)
+	req.Handlers.Unmarshal.PushBackNamed(protocol.UnmarshalDiscardBodyHandler)
+	return output, req.Send()
+}
+
+// contentMD5 sets the Content-MD5 header S3 requires for the public access
+// block operations to the MD5 checksum of the request body.
+func contentMD5(r *request.Request) {
+	if r.Body == nil {
+		return
+	}
+
+	h := md5.New()
+	_, err := io.Copy(h, r.Body)
+	if err != nil {
+		r.Error = err
+		return
+	}
+	_, err = r.Body.Seek(0, io.SeekStart)
+	if err != nil {
+		r.Error = err
+		return
+	}
+	r.HTTPRequest.Header.Set("Content-MD5", base64.StdEncoding.EncodeToString(h.Sum(nil)))
+}
@@ -0,0 +1,74 @@
+package provisioner
+
+import (
+	"crypto/md5"
+	"encoding/base64"
+	"encoding/xml"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type publicAccessBlockAPIStub struct {
+	input *putPublicAccessBlockInput
+}
+
+func (s *publicAccessBlockAPIStub) PutPublicAccessBlock(input *putPublicAccessBlockInput) (*putPublicAccessBlockOutput, error) {
+	s.input = input
+	return &putPublicAccessBlockOutput{}, nil
+}
+
+func TestS3RestClientPutPublicAccessBlock(t *testing.T) {
+	var configuration struct {
+		BlockPublicAcls       bool
+		BlockPublicPolicy     bool
+		IgnorePublicAcls      bool
+		RestrictPublicBuckets bool
+	}
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		assert.Equal(t, http.MethodPut, r.Method)
+		assert.Equal(t, "/bucket", r.URL.Path)
+		_, ok := r.URL.Query()["publicAccessBlock"]
+		assert.True(t, ok)
+
+		body, err := ioutil.ReadAll(r.Body)
+		require.NoError(t, err)
+		checksum := md5.Sum(body)
+		assert.Equal(t, base64.StdEncoding.EncodeToString(checksum[:]), r.Header.Get("Content-MD5"))
+		require.NoError(t, xml.Unmarshal(body, &configuration))
+	}))
+	defer server.Close()
+
+	sess, err := session.NewSession(&aws.Config{
+		Region:           aws.String("eu-central-1"),
+		Credentials:      credentials.NewStaticCredentials("id", "secret", ""),
+		Endpoint:         aws.String(server.URL),
+		S3ForcePathStyle: aws.Bool(true),
+	})
+	require.NoError(t, err)
+
+	client := &s3RestClient{client: s3.New(sess)}
+	_, err = client.PutPublicAccessBlock(&putPublicAccessBlockInput{
+		Bucket: aws.String("bucket"),
+		PublicAccessBlockConfiguration: &publicAccessBlockConfiguration{
+			BlockPublicAcls:       aws.Bool(true),
+			BlockPublicPolicy:     aws.Bool(true),
+			IgnorePublicAcls:      aws.Bool(true),
+			RestrictPublicBuckets: aws.Bool(true),
+		},
+	})
+	require.NoError(t, err)
+
+	assert.True(t, configuration.BlockPublicAcls)
+	assert.True(t, configuration.BlockPublicPolicy)
+	assert.True(t, configuration.IgnorePublicAcls)
+	assert.True(t, configuration.RestrictPublicBuckets)
+}
@@ -0,0 +1,44 @@
+package provisioner
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+)
+
+// errDecommissionReadOnly is returned when a cluster would be decommissioned
+// in read-only mode.
+var errDecommissionReadOnly = errors.New("decommissioning is not supported in read-only mode")
+
+// skipReadOnly returns true and logs the skipped change if the adapter is
+// read-only. The change is described by format and args, e.g. "tagging ASG
+// %s".
+func (a *awsAdapter) skipReadOnly(format string, args ...interface{}) bool {
+	if !a.readOnly {
+		return false
+	}
+	a.logger.Infof("Read-only mode, not "+format, args...)
+	return true
+}
+
+// reportStackUpdate validates the template of an outdated stack and reports
+// the update instead of applying it. Templates exceeding the maximum size of
+// inline templates can only be validated by CloudFormation once uploaded to
+// S3, so they're just checked locally.
+func (a *awsAdapter) reportStackUpdate(stackName string, stackTemplate []byte, hash string) error {
+	var stackBuffer bytes.Buffer
+	err := json.Compact(&stackBuffer, stackTemplate)
+	if err != nil {
+		return err
+	}
+
+	if stackBuffer.Len() <= stackMaxSize {
+		err = a.validateStackTemplate(stackName, stackBuffer.String(), "")
+		if err != nil {
+			return err
+		}
+	}
+
+	a.skipReadOnly("updating stack %s to template hash %s", stackName, hash)
+	return nil
+}
@@ -0,0 +1,43 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestReadOnlyAdapter(t *testing.T) {
+	cluster := &api.Cluster{ID: "aws:123456789012:eu-central-1:kube-1", ConfigItems: map[string]string{}}
+
+	a := newAWSAdapterWithStubs(cloudformation.StackStatusUpdateComplete, "asg")
+	a.readOnly = true
+	uploader := &s3UploaderAPIStub{}
+	a.s3Uploader = uploader
+	cfStub := a.cloudformationClient.(*cloudFormationAPIStub)
+	cfStub.createErr = errors.New("stack applied in read-only mode")
+
+	// outdated stacks are validated, but not applied.
+	err := a.applyClusterStack(context.Background(), "foobar", []byte(`{"Resources": {}}`), cluster, "bucket")
+	require.NoError(t, err)
+
+	cfStub.validateErr = errors.New("invalid template")
+	err = a.applyClusterStack(context.Background(), "foobar", []byte(`{"Resources": {}}`), cluster, "bucket")
+	assert.Error(t, err)
+
+	// the userdata is referenced at its S3 location without uploading it.
+	uri, err := a.uploadUserDataToS3(context.Background(), []byte("userdata"), &userDataBucket{name: "bucket"}, "", nil)
+	require.NoError(t, err)
+	assert.Contains(t, uri, "s3://bucket/")
+	assert.Nil(t, uploader.input)
+	assert.Nil(t, a.s3Client.(*s3APIStub).encryptionInput)
+
+	err = a.tagASG("asg", map[string]string{decommissionProtectionTag: "true"})
+	require.NoError(t, err)
+	assert.Nil(t, a.autoscalingClient.(*autoscalingAPIStub).tagsInput)
+}
@@ -0,0 +1,50 @@
+package provisioner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// RecoveryChannelVersion returns the channel version the cluster was last
+// successfully provisioned with. It's the known-good checkpoint a disaster
+// recovery re-applies the stacks and manifests from.
+func RecoveryChannelVersion(cluster *api.Cluster) (string, error) {
+	if cluster.Status == nil || cluster.Status.CurrentVersion == "" {
+		return "", fmt.Errorf("cluster %s has no successfully provisioned version to recover", cluster.ID)
+	}
+
+	channelVersion := strings.SplitN(cluster.Status.CurrentVersion, "#", 2)[0]
+	if channelVersion == "" {
+		return "", fmt.Errorf("invalid version '%s' of cluster %s", cluster.Status.CurrentVersion, cluster.ID)
+	}
+
+	return channelVersion, nil
+}
+
+// RollbackChannelVersion returns the channel version of the version the
+// cluster was successfully provisioned with before its current version. It
+// fails if the cluster has no previous version or if the previous version
+// only differs in the cluster configuration.
+func RollbackChannelVersion(cluster *api.Cluster) (string, error) {
+	current, err := RecoveryChannelVersion(cluster)
+	if err != nil {
+		return "", err
+	}
+
+	if cluster.Status.LastVersion == "" {
+		return "", fmt.Errorf("cluster %s has no previous version to roll back to", cluster.ID)
+	}
+
+	previous := strings.SplitN(cluster.Status.LastVersion, "#", 2)[0]
+	if previous == "" {
+		return "", fmt.Errorf("invalid version '%s' of cluster %s", cluster.Status.LastVersion, cluster.ID)
+	}
+
+	if previous == current {
+		return "", fmt.Errorf("previous version '%s' of cluster %s has the current channel version", cluster.Status.LastVersion, cluster.ID)
+	}
+
+	return previous, nil
+}
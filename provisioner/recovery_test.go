@@ -0,0 +1,93 @@
+package provisioner
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+func TestRecoveryChannelVersion(t *testing.T) {
+	version, err := RecoveryChannelVersion(&api.Cluster{
+		Status: &api.ClusterStatus{CurrentVersion: "abc123#c2hh", NextVersion: "def456#c2hh"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "abc123", version)
+
+	for _, status := range []*api.ClusterStatus{nil, {}, {CurrentVersion: "#c2hh"}} {
+		_, err := RecoveryChannelVersion(&api.Cluster{ID: "kube-1", Status: status})
+		assert.Error(t, err)
+	}
+}
+
+func TestRollbackChannelVersion(t *testing.T) {
+	version, err := RollbackChannelVersion(&api.Cluster{
+		Status: &api.ClusterStatus{CurrentVersion: "abc123#c2hh", LastVersion: "def456#c2hh"},
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "def456", version)
+
+	for _, status := range []*api.ClusterStatus{
+		nil,
+		{CurrentVersion: "abc123#c2hh"},
+		{CurrentVersion: "abc123#c2hh", LastVersion: "#c2hh"},
+		{CurrentVersion: "abc123#c2hh", LastVersion: "abc123#b3ii"},
+	} {
+		_, err := RollbackChannelVersion(&api.Cluster{ID: "kube-1", Status: status})
+		assert.Error(t, err)
+	}
+}
+
+func TestDisasterRecoveryProvision(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fake-channel")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	p := NewFakeProvisioner(&Options{}).(*fakeProvisioner)
+	cluster := fakeTestCluster()
+	require.NoError(t, p.Provision(context.Background(), cluster, &channel.Config{Version: "abc123", Path: dir}))
+	cluster.Status = &api.ClusterStatus{CurrentVersion: "abc123#c2hh"}
+
+	channelVersion, err := RecoveryChannelVersion(cluster)
+	require.NoError(t, err)
+
+	// the rebuild re-applies the stack of the changed cluster, but leaves
+	// the nodes alone.
+	p.disasterRecovery = true
+	cluster.NodePools[1].InstanceType = "m5.xlarge"
+
+	var steps []string
+	summary := api.NewUpdateSummary(nil)
+	ctx := api.WithUpdateSummary(context.Background(), summary)
+	ctx = api.WithProgress(ctx, func(progress *api.Progress) {
+		steps = append(steps, progress.Step)
+	})
+
+	err = p.Provision(ctx, cluster, &channel.Config{Version: channelVersion, Path: dir})
+	require.NoError(t, err)
+
+	assert.Equal(t, []string{api.ProgressStepStackUpdate}, steps)
+
+	client := p.adapter(log.WithField("test", true), cluster).cloudformationClient
+	stack, err := describeStack(client, cluster.LocalID)
+	require.NoError(t, err)
+	assert.Equal(t, cloudformation.StackStatusUpdateComplete, aws.StringValue(stack.StackStatus))
+
+	assert.Equal(t, []int{1}, fakeNodeGenerations(t, p, cluster, "master-default"))
+	assert.Equal(t, []int{1, 1, 1}, fakeNodeGenerations(t, p, cluster, "worker-default"))
+
+	require.Len(t, summary.NodePools, 2)
+	for _, nodePool := range summary.NodePools {
+		assert.Equal(t, api.UpdateOutcomeSkipped, nodePool.Outcome)
+		assert.Equal(t, "disaster recovery", nodePool.Reason)
+	}
+}
@@ -0,0 +1,120 @@
+package provisioner
+
+import (
+	"bytes"
+	"fmt"
+	"net/url"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+const (
+	registryMirrorsConfigItemKey = "registry_mirrors"
+	// registryMirrorsValue is the userdata config value of the registry
+	// mirrors of the cluster.
+	registryMirrorsValue = "REGISTRY_MIRRORS"
+	// containerdHostsDir is the directory of the containerd registry host
+	// configs, which must be the config_path of the CRI registry config of
+	// containerd.
+	containerdHostsDir = "/etc/containerd/certs.d"
+	// dockerHubRegistry is the name of Docker Hub in image references,
+	// whose API is served by dockerHubServer.
+	dockerHubRegistry = "docker.io"
+	dockerHubServer   = "https://registry-1.docker.io"
+)
+
+// registryHostRE matches the host names of container registries with an
+// optional port, e.g. 'registry.example.org:5000'.
+var registryHostRE = regexp.MustCompile(`^[a-zA-Z0-9]([a-zA-Z0-9.-]*[a-zA-Z0-9])?(:[0-9]+)?$`)
+
+// registryMirror are the mirrors of a container registry, tried in order
+// before the registry itself.
+type registryMirror struct {
+	Registry  string
+	Endpoints []string
+}
+
+// parseRegistryMirrors parses the registry mirrors of a cluster in the format
+// 'registry=endpoint,...', e.g.
+// 'docker.io=https://mirror.example.org,ghcr.io=https://ghcr.example.org'.
+// A registry may be listed multiple times to add more mirrors. The mirrors
+// are sorted by registry.
+func parseRegistryMirrors(value string) ([]*registryMirror, error) {
+	mirrors := make(map[string]*registryMirror)
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid %s '%s', must be registry=endpoint pairs", registryMirrorsConfigItemKey, pair)
+		}
+
+		registry, endpoint := parts[0], parts[1]
+		if !registryHostRE.MatchString(registry) {
+			return nil, fmt.Errorf("invalid registry '%s' in %s, must be a host name", registry, registryMirrorsConfigItemKey)
+		}
+
+		endpointURL, err := url.Parse(endpoint)
+		if err != nil || (endpointURL.Scheme != "https" && endpointURL.Scheme != "http") || endpointURL.Host == "" {
+			return nil, fmt.Errorf("invalid mirror '%s' of registry %s in %s, must be a http(s) URL", endpoint, registry, registryMirrorsConfigItemKey)
+		}
+
+		mirror, ok := mirrors[registry]
+		if !ok {
+			mirror = &registryMirror{Registry: registry}
+			mirrors[registry] = mirror
+		}
+		mirror.Endpoints = append(mirror.Endpoints, endpoint)
+	}
+
+	result := make([]*registryMirror, 0, len(mirrors))
+	for _, mirror := range mirrors {
+		result = append(result, mirror)
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Registry < result[j].Registry
+	})
+	return result, nil
+}
+
+// hostsFile returns the path of the containerd registry host config of the
+// mirrored registry.
+func (m *registryMirror) hostsFile() string {
+	return path.Join(containerdHostsDir, m.Registry, "hosts.toml")
+}
+
+// hostsConfig returns the containerd registry host config pulling the images
+// of the registry from its mirrors, falling back to the registry itself.
+func (m *registryMirror) hostsConfig() string {
+	server := "https://" + m.Registry
+	if m.Registry == dockerHubRegistry {
+		server = dockerHubServer
+	}
+
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "server = %q\n", server)
+	for _, endpoint := range m.Endpoints {
+		fmt.Fprintf(&buf, "\n[host.%q]\n  capabilities = [\"pull\", \"resolve\"]\n", endpoint)
+	}
+	return buf.String()
+}
+
+// registryMirrorFiles returns the containerd registry host configs of the
+// registry mirrors of a cluster, added to the userdata of every node pool.
+func registryMirrorFiles(value string) ([]*generatedFile, error) {
+	mirrors, err := parseRegistryMirrors(value)
+	if err != nil {
+		return nil, err
+	}
+
+	files := make([]*generatedFile, 0, len(mirrors))
+	for _, mirror := range mirrors {
+		files = append(files, &generatedFile{Path: mirror.hostsFile(), Contents: mirror.hostsConfig()})
+	}
+	return files, nil
+}
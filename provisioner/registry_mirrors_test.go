@@ -0,0 +1,118 @@
+package provisioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/coreos/container-linux-config-transpiler/config/platform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestParseRegistryMirrors(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		value    string
+		expected []*registryMirror
+		valid    bool
+	}{
+		{
+			msg:      "no mirrors",
+			expected: []*registryMirror{},
+			valid:    true,
+		},
+		{
+			msg:   "mirrors sorted by registry",
+			value: "ghcr.io=https://ghcr.example.org, docker.io=https://a.example.org,docker.io=http://b.example.org:5000",
+			expected: []*registryMirror{
+				{Registry: "docker.io", Endpoints: []string{"https://a.example.org", "http://b.example.org:5000"}},
+				{Registry: "ghcr.io", Endpoints: []string{"https://ghcr.example.org"}},
+			},
+			valid: true,
+		},
+		{
+			msg:      "registry with port",
+			value:    "registry.example.org:5000=https://mirror.example.org",
+			expected: []*registryMirror{{Registry: "registry.example.org:5000", Endpoints: []string{"https://mirror.example.org"}}},
+			valid:    true,
+		},
+		{
+			msg:   "missing mirror",
+			value: "docker.io",
+		},
+		{
+			msg:   "registry with scheme",
+			value: "https://docker.io=https://mirror.example.org",
+		},
+		{
+			msg:   "mirror without scheme",
+			value: "docker.io=mirror.example.org",
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			mirrors, err := parseRegistryMirrors(tc.value)
+			if !tc.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, mirrors)
+		})
+	}
+}
+
+func TestRegistryMirrorsUserData(t *testing.T) {
+	basePath, err := ioutil.TempDir("", "profiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(basePath)
+
+	writeProfileFiles(t, basePath, map[string]string{
+		"worker.clc.yaml": "storage:\n  files:\n  - path: /etc/base\n",
+		"node-pools/worker-butane/userdata.bu.yaml": "variant: flatcar\nversion: 1.0.0\n",
+	})
+
+	// the userdata doesn't change without mirrors.
+	rendered, err := renderProfileUserData(path.Join(basePath, "worker.clc.yaml"), "", map[string]string{registryMirrorsValue: ""}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "storage:\n  files:\n  - path: /etc/base\n", rendered)
+
+	config := map[string]string{registryMirrorsValue: "docker.io=https://a.example.org,docker.io=https://b.example.org"}
+	rendered, err = renderProfileUserData(path.Join(basePath, "worker.clc.yaml"), "", config, nil)
+	require.NoError(t, err)
+
+	var userData map[string]interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(rendered), &userData))
+	assert.Equal(t, map[string]interface{}{
+		"storage": map[interface{}]interface{}{
+			"files": []interface{}{
+				map[interface{}]interface{}{"path": "/etc/base"},
+				map[interface{}]interface{}{
+					"path":       "/etc/containerd/certs.d/docker.io/hosts.toml",
+					"filesystem": "root",
+					"mode":       420,
+					"contents": map[interface{}]interface{}{
+						"inline": "server = \"https://registry-1.docker.io\"\n\n[host.\"https://a.example.org\"]\n  capabilities = [\"pull\", \"resolve\"]\n\n[host.\"https://b.example.org\"]\n  capabilities = [\"pull\", \"resolve\"]\n",
+					},
+				},
+			},
+		},
+	}, userData)
+
+	_, err = convertUserData(path.Join(basePath, "worker.clc.yaml"), []byte(rendered), platform.EC2)
+	assert.NoError(t, err)
+
+	butaneFile := path.Join(basePath, "node-pools", "worker-butane", "userdata.bu.yaml")
+	rendered, err = renderProfileUserData(butaneFile, "worker-butane", map[string]string{registryMirrorsValue: "ghcr.io=https://ghcr.example.org"}, nil)
+	require.NoError(t, err)
+	assert.Contains(t, rendered, "/etc/containerd/certs.d/ghcr.io/hosts.toml")
+	assert.Contains(t, rendered, "overwrite: true")
+
+	_, err = convertUserData(butaneFile, []byte(rendered), platform.EC2)
+	assert.NoError(t, err)
+
+	_, err = renderProfileUserData(path.Join(basePath, "worker.clc.yaml"), "", map[string]string{registryMirrorsValue: "docker.io"}, nil)
+	assert.Error(t, err)
+}
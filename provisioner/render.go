@@ -0,0 +1,149 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/coreos/container-linux-config-transpiler/config/platform"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+// RenderedNodePool is the stack and userdata of a node pool rendered without
+// calling any cloud provider API.
+type RenderedNodePool struct {
+	NodePool string
+	// Stack is the instance template of GCP node pools and the deployment
+	// of Azure node pools. The stacks of AWS node pools are rendered by
+	// senza, so only the parameters derived from the node pool are
+	// returned.
+	Stack          string
+	UserData       string
+	UserDataFormat string
+}
+
+// RenderNodePool renders the stack and userdata of a node pool of the cluster
+// from the channel like the provisioner of the cluster's provider would, but
+// without access to the provider. The userdata is never uploaded to S3.
+func RenderNodePool(cluster *api.Cluster, nodePool *api.NodePool, channelConfig *channel.Config) (*RenderedNodePool, error) {
+	cluster, err := withValuesFiles(cluster, channelConfig)
+	if err != nil {
+		return nil, err
+	}
+
+	kubeletSecret, ok := cluster.ConfigItems[workerSharedSecretConfigItemKey]
+	if !ok {
+		return nil, fmt.Errorf("'%s' config item is missing, must be defined", workerSharedSecretConfigItemKey)
+	}
+
+	_, version, err := splitStackName(cluster.LocalID)
+	if err != nil {
+		return nil, err
+	}
+
+	config, err := userDataConfig(cluster.LocalID, version, kubeletSecret, cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	basePath := path.Join(channelConfig.Path, "cluster")
+
+	// the CLM version isn't known here, only the schema versions of the
+	// profiles are checked.
+	err = checkProfileCompatibility(basePath, &api.Cluster{NodePools: []*api.NodePool{nodePool}}, "")
+	if err != nil {
+		return nil, err
+	}
+
+	role := "worker"
+	if strings.HasPrefix(nodePool.Profile, "master") {
+		role = "master"
+	}
+
+	var platformID string
+	var stack interface{}
+	switch cluster.Provider {
+	case providerID:
+		platformID = platform.EC2
+		stack, err = awsNodePoolStackParameters(strings.Title(role), nodePool)
+	case gceProviderID:
+		platformID = platform.GCE
+		stack, err = gceNodePoolInstanceTemplate(cluster, nodePool, basePath, config)
+	case azureProviderID:
+		platformID = platform.Azure
+		stack, err = azureNodePoolDeployment(cluster, nodePool, basePath, config, nodePool.MinSize)
+	default:
+		return nil, ErrProviderNotSupported
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	renderedStack, err := json.MarshalIndent(stack, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+
+	userData, format, err := renderNodePoolUserData(basePath, role, nodePool, nodePoolUserDataConfig(config, nodePool), cluster.ConfigValues, platformID)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RenderedNodePool{
+		NodePool:       nodePool.Name,
+		Stack:          string(renderedStack),
+		UserData:       userData,
+		UserDataFormat: format,
+	}, nil
+}
+
+// awsNodePoolStackParameters returns the parameters of the cluster stack
+// derived from a node pool, prefixed with the given prefix e.g. 'Master' or
+// 'Worker'. The node pool is validated like before updating the stack, the
+// subnets of pinned node pools can't be resolved without AWS though.
+func awsNodePoolStackParameters(prefix string, nodePool *api.NodePool) (map[string]string, error) {
+	for _, validate := range []func(*api.NodePool) error{validateArchitecture, validateLabelsAndTaints, validateWarmPool, validateLifecycleHooks, validateImage, validateStorage, validateKubeletConfig, validateMonitoring, validateOS} {
+		err := validate(nodePool)
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	// the instance type of the worker pool isn't prefixed.
+	instanceTypePrefix := prefix
+	if prefix == "Worker" {
+		instanceTypePrefix = ""
+	}
+
+	args := []string{
+		fmt.Sprintf("%sNodePoolName=%s", prefix, nodePool.Name),
+		fmt.Sprintf("%sInstanceType=%s", instanceTypePrefix, nodePool.InstanceType),
+	}
+	if nodePool.Architecture != "" {
+		args = append(args, fmt.Sprintf("%sArchitecture=%s", prefix, nodePool.Architecture))
+	}
+	if nodePool.OS != "" {
+		args = append(args, fmt.Sprintf("%sOS=%s", prefix, nodePool.OS))
+	}
+
+	imds, err := imdsArgs(prefix, nodePool)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, imds...)
+
+	volume, err := rootVolumeArgs(prefix, nodePool)
+	if err != nil {
+		return nil, err
+	}
+	args = append(args, volume...)
+
+	parameters := make(map[string]string, len(args))
+	for _, arg := range args {
+		parts := strings.SplitN(arg, "=", 2)
+		parameters[parts[0]] = parts[1]
+	}
+	return parameters, nil
+}
@@ -0,0 +1,72 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+func TestRenderNodePool(t *testing.T) {
+	dir, err := ioutil.TempDir("", "render")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	clusterDir := path.Join(dir, "cluster")
+	require.NoError(t, os.Mkdir(clusterDir, 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(clusterDir, "userdata-worker.yaml"), []byte("#cloud-config\nid: {{LOCAL_ID}}\npool: {{NODE_POOL}}\n"), 0644))
+
+	cluster := &api.Cluster{
+		ID:           "aws:123456789012:eu-central-1:kube-1",
+		LocalID:      "kube-1",
+		APIServerURL: "https://kube-1.foo.example.org/",
+		Provider:     providerID,
+		Region:       "eu-central-1",
+		ConfigItems:  map[string]string{"worker_shared_secret": "secret"},
+	}
+	nodePool := &api.NodePool{
+		Name:           "worker-default",
+		Profile:        "worker-default",
+		InstanceType:   "m5.large",
+		RootVolumeType: "gp3",
+		RootVolumeSize: 100,
+	}
+
+	rendered, err := RenderNodePool(cluster, nodePool, &channel.Config{Path: dir})
+	require.NoError(t, err)
+	assert.Equal(t, "worker-default", rendered.NodePool)
+	assert.Equal(t, userDataFormatCloudConfig, rendered.UserDataFormat)
+	assert.Equal(t, "#cloud-config\nid: kube-1\npool: worker-default\n", rendered.UserData)
+
+	var parameters map[string]string
+	require.NoError(t, json.Unmarshal([]byte(rendered.Stack), &parameters))
+	assert.Equal(t, map[string]string{
+		"WorkerNodePoolName":   "worker-default",
+		"InstanceType":         "m5.large",
+		"WorkerRootVolumeType": "gp3",
+		"WorkerRootVolumeSize": "100",
+	}, parameters)
+
+	// invalid node pools fail like before updating the stack.
+	nodePool.RootVolumeSize = 0
+	nodePool.RootVolumeType = "sc1"
+	_, err = RenderNodePool(cluster, nodePool, &channel.Config{Path: dir})
+	assert.Error(t, err)
+
+	// the userdata can't be rendered without the shared secret.
+	delete(cluster.ConfigItems, "worker_shared_secret")
+	_, err = RenderNodePool(cluster, &api.NodePool{Name: "worker-default", Profile: "worker-default"}, &channel.Config{Path: dir})
+	assert.Error(t, err)
+
+	cluster.Provider = "unknown"
+	cluster.ConfigItems["worker_shared_secret"] = "secret"
+	_, err = RenderNodePool(cluster, &api.NodePool{Name: "worker-default", Profile: "worker-default"}, &channel.Config{Path: dir})
+	assert.Equal(t, ErrProviderNotSupported, err)
+}
@@ -0,0 +1,150 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	stackRollbackConfigItemKey = "stack_rollback"
+	// previousTemplateKeyFmt is the S3 key of the template a stack had
+	// before it was updated.
+	previousTemplateKeyFmt = "%s.previous.template"
+)
+
+// stackRolledBackError is returned for node pools which failed after the
+// stack was updated, once the stack was rolled back to its previous
+// template.
+type stackRolledBackError struct {
+	stackName string
+	err       error
+}
+
+func (e *stackRolledBackError) Error() string {
+	return fmt.Sprintf("%v (stack %s rolled back to its previous template)", e.err, e.stackName)
+}
+
+// Cause returns the error which caused the rollback, such that the error is
+// classified like the original one.
+func (e *stackRolledBackError) Cause() error {
+	return e.err
+}
+
+// stackRollbackEnabled returns true if the stack of the cluster should be
+// rolled back when the new nodes fail to become ready after an update.
+func stackRollbackEnabled(cluster *api.Cluster) bool {
+	return cluster.ConfigItems[stackRollbackConfigItemKey] == "true"
+}
+
+// savePreviousTemplate uploads the current template of the stack to S3
+// before the stack is updated, such that it can be restored by rollbackStack.
+// Only the templates of stacks in a stable state are saved.
+func (a *awsAdapter) savePreviousTemplate(ctx context.Context, stack *cloudformation.Stack, cluster *api.Cluster, s3BucketName string) error {
+	switch aws.StringValue(stack.StackStatus) {
+	case cloudformation.StackStatusCreateComplete, cloudformation.StackStatusUpdateComplete, cloudformation.StackStatusUpdateRollbackComplete:
+	default:
+		return nil
+	}
+
+	stackName := aws.StringValue(stack.StackName)
+	resp, err := a.cloudformationClient.GetTemplate(&cloudformation.GetTemplateInput{
+		StackName:     aws.String(stackName),
+		TemplateStage: aws.String(cloudformation.TemplateStageOriginal),
+	})
+	if err != nil {
+		return err
+	}
+
+	err = a.createS3Bucket(s3BucketName)
+	if err != nil {
+		return err
+	}
+
+	result, err := a.s3Uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:               aws.String(s3BucketName),
+		Key:                  aws.String(fmt.Sprintf(previousTemplateKeyFmt, cluster.ID)),
+		Body:                 strings.NewReader(aws.StringValue(resp.TemplateBody)),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+		Tagging:              s3Tagging(a.costTags),
+	})
+	if err != nil {
+		return err
+	}
+
+	if a.previousTemplateURLs == nil {
+		a.previousTemplateURLs = make(map[string]string)
+	}
+	a.previousTemplateURLs[stackName] = result.Location
+	return nil
+}
+
+// rollbackStack re-applies the template the stack had before it was updated
+// and waits for the update. The stack isn't tagged with a template hash,
+// such that the next provisioning applies the new template again.
+func (a *awsAdapter) rollbackStack(ctx context.Context, stackName string) error {
+	templateURL, ok := a.previousTemplateURLs[stackName]
+	if !ok {
+		return fmt.Errorf("no previous template of stack %s saved", stackName)
+	}
+
+	updated, err := a.applyStack(ctx, stackName, "", templateURL, "", true)
+	if err != nil || !updated {
+		return err
+	}
+
+	waitCtx, cancel := context.WithTimeout(ctx, maxWaitTimeout)
+	defer cancel()
+	_, err = a.waitForStack(waitCtx, waitTime, stackName)
+	return err
+}
+
+// rollbackNodePools rolls the stack back to its previous template if the new
+// nodes of any of the failed node pools didn't become ready and the cluster
+// enables stack rollbacks. The rollback is reported in the errors of the
+// failed node pools.
+func rollbackNodePools(ctx context.Context, logger *log.Entry, adapter *awsAdapter, cluster *api.Cluster, nodePoolErrs NodePoolErrors) {
+	if !stackRollbackEnabled(cluster) {
+		return
+	}
+
+	bootstrapFailed := false
+	for _, nodePoolErr := range nodePoolErrs {
+		if nodePoolErr.Category == ErrorCategoryBootstrap {
+			bootstrapFailed = true
+		}
+	}
+	if !bootstrapFailed {
+		return
+	}
+
+	// the stack still has the template the node pools were last updated
+	// with, there's nothing to roll back to.
+	if !adapter.updatedStacks[cluster.LocalID] {
+		logger.Warnf("Stack %s wasn't changed by the update, not rolling it back", cluster.LocalID)
+		return
+	}
+
+	logger.Warnf("Rolling back stack %s to its previous template", cluster.LocalID)
+	err := adapter.rollbackStack(ctx, cluster.LocalID)
+	if err != nil {
+		logger.Errorf("Failed to roll back stack %s: %v", cluster.LocalID, err)
+		return
+	}
+
+	failed := make([]string, 0, len(nodePoolErrs))
+	for _, nodePoolErr := range nodePoolErrs {
+		nodePoolErr.Err = &stackRolledBackError{stackName: cluster.LocalID, err: nodePoolErr.Err}
+		failed = append(failed, nodePoolErr.NodePool)
+	}
+
+	api.ReportEvent(ctx, api.EventStackRolledBack, "", fmt.Sprintf("Stack %s rolled back to its previous template after the update of node pools %s failed", cluster.LocalID, strings.Join(failed, ", ")))
+}
@@ -0,0 +1,109 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+func TestSavePreviousTemplate(t *testing.T) {
+	cluster := &api.Cluster{ID: "aws:123456789012:eu-central-1:kube-1"}
+
+	a := newAWSAdapterWithStubs(cloudformation.StackStatusUpdateComplete, "asg")
+	a.cloudformationClient.(*cloudFormationAPIStub).templateBody = `{"Resources": {}}`
+	uploader := &s3UploaderAPIStub{}
+	a.s3Uploader = uploader
+
+	// stacks which are still being updated don't have a stable template.
+	stack := &cloudformation.Stack{StackName: aws.String("foobar"), StackStatus: aws.String(cloudformation.StackStatusUpdateInProgress)}
+	err := a.savePreviousTemplate(context.Background(), stack, cluster, "bucket")
+	require.NoError(t, err)
+	assert.Nil(t, uploader.input)
+
+	stack.StackStatus = aws.String(cloudformation.StackStatusUpdateComplete)
+	err = a.savePreviousTemplate(context.Background(), stack, cluster, "bucket")
+	require.NoError(t, err)
+	assert.Equal(t, "aws:123456789012:eu-central-1:kube-1.previous.template", aws.StringValue(uploader.input.Key))
+	body, err := ioutil.ReadAll(uploader.input.Body)
+	require.NoError(t, err)
+	assert.Equal(t, `{"Resources": {}}`, string(body))
+	assert.Equal(t, "url", a.previousTemplateURLs["foobar"])
+}
+
+func TestRollbackNodePools(t *testing.T) {
+	logger := log.WithField("test", true)
+
+	for _, tc := range []struct {
+		msg        string
+		enabled    bool
+		unchanged  bool
+		err        error
+		rolledBack bool
+	}{
+		{
+			msg:        "test unhealthy nodes",
+			enabled:    true,
+			err:        updatestrategy.ErrUnhealthyNodes,
+			rolledBack: true,
+		},
+		{
+			msg:     "test rollback disabled",
+			enabled: false,
+			err:     updatestrategy.ErrUnhealthyNodes,
+		},
+		{
+			msg:     "test other error",
+			enabled: true,
+			err:     errors.New("failed"),
+		},
+		{
+			msg:       "test stack not changed by the update",
+			enabled:   true,
+			unchanged: true,
+			err:       updatestrategy.ErrUnhealthyNodes,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			cluster := &api.Cluster{LocalID: "foobar", ConfigItems: map[string]string{}}
+			if tc.enabled {
+				cluster.ConfigItems[stackRollbackConfigItemKey] = "true"
+			}
+
+			a := newAWSAdapterWithStubs(cloudformation.StackStatusUpdateComplete, "asg")
+			a.previousTemplateURLs = map[string]string{"foobar": "url"}
+			a.updatedStacks = map[string]bool{"foobar": !tc.unchanged}
+
+			var events []*api.Event
+			ctx := api.WithEvents(context.Background(), func(event *api.Event) {
+				events = append(events, event)
+			})
+
+			nodePoolErrs := NodePoolErrors{newNodePoolError("default-worker", tc.err)}
+			rollbackNodePools(ctx, logger, a, cluster, nodePoolErrs)
+
+			_, rolledBack := nodePoolErrs[0].Err.(*stackRolledBackError)
+			assert.Equal(t, tc.rolledBack, rolledBack)
+
+			// rollbacks are reported as events.
+			if tc.rolledBack {
+				require.Len(t, events, 1)
+				assert.Equal(t, api.EventStackRolledBack, events[0].Type)
+			} else {
+				assert.Empty(t, events)
+			}
+
+			category, _ := classifyError(nodePoolErrs[0].Err)
+			assert.Equal(t, nodePoolErrs[0].Category, category)
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/audit"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/tracing"
+)
+
+// NodePoolScaler changes the size of a node pool without provisioning its
+// cluster.
+type NodePoolScaler interface {
+	// ScaleNodePool sets the min and max size of the ASG of a node pool
+	// and records the change in the status of the cluster. The templates
+	// aren't rendered and no nodes are replaced, the next provisioning of
+	// the cluster restores the size of the node pool from the registry.
+	ScaleNodePool(ctx context.Context, cluster *api.Cluster, nodePool string, minSize, maxSize int64, actor string) (*api.NodePoolScaling, error)
+}
+
+type awsNodePoolScaler struct {
+	assumedRole string
+	awsConfig   *aws.Config
+	credentials *awsExt.CredentialsCache
+	dryRun      bool
+	readOnly    bool
+	auditor     *audit.Auditor
+	rateLimiter *awsExt.APIRateLimiter
+}
+
+// NewNodePoolScaler returns a NodePoolScaler resizing the ASGs of the node
+// pools in the AWS accounts of the clusters by assuming the IAM role.
+func NewNodePoolScaler(assumedRole string, awsConfig *aws.Config, options *Options) NodePoolScaler {
+	scaler := &awsNodePoolScaler{
+		assumedRole: assumedRole,
+		awsConfig:   awsConfig,
+		credentials: awsExt.NewCredentialsCache(),
+	}
+
+	if options != nil {
+		scaler.dryRun = options.DryRun || options.ReadOnly
+		scaler.readOnly = options.ReadOnly
+		scaler.auditor = options.Auditor
+		scaler.rateLimiter = options.RateLimiter
+	}
+
+	return scaler
+}
+
+// ScaleNodePool sets the min and max size of the ASG of a node pool and
+// records the change in the status of the cluster.
+func (s *awsNodePoolScaler) ScaleNodePool(ctx context.Context, cluster *api.Cluster, nodePool string, minSize, maxSize int64, actor string) (scaling *api.NodePoolScaling, err error) {
+	_, span := tracing.Start(ctx, "node_pool.scale", tracing.String("cluster.id", cluster.ID), tracing.String("node_pool.name", nodePool))
+	defer func() { tracing.End(span, err) }()
+
+	if cluster.Provider != providerID {
+		return nil, ErrProviderNotSupported
+	}
+
+	if !hasNodePool(cluster, nodePool) {
+		return nil, fmt.Errorf("node pool %s not found in cluster %s", nodePool, cluster.ID)
+	}
+
+	if minSize < 0 || maxSize < minSize {
+		return nil, fmt.Errorf("invalid size %d/%d of node pool %s, expected 0 <= min size <= max size", minSize, maxSize, nodePool)
+	}
+
+	sess, err := clusterSession(s.awsConfig, s.assumedRole, s.credentials, cluster)
+	if err != nil {
+		return nil, err
+	}
+	if s.readOnly {
+		awsExt.ReadOnly(sess)
+	}
+	s.rateLimiter.Limit(sess, cluster.InfrastructureAccount)
+	s.auditor.Instrument(sess, cluster.ID)
+
+	logger := log.WithField("cluster", cluster.Alias)
+	adapter, err := newAWSAdapter(logger, cluster.APIServerURL, cluster.Region, sess, nil, s.dryRun)
+	if err != nil {
+		return nil, err
+	}
+	adapter.readOnly = s.readOnly
+
+	asg, err := adapter.getNodePoolASG(cluster.LocalID, nodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	err = adapter.scaleNodePoolASG(asg, minSize, maxSize, s.dryRun)
+	if err != nil {
+		return nil, err
+	}
+
+	scaling = &api.NodePoolScaling{
+		MinSize:  minSize,
+		MaxSize:  maxSize,
+		ScaledAt: time.Now().UTC(),
+		Actor:    actor,
+	}
+	if cluster.Status == nil {
+		cluster.Status = &api.ClusterStatus{}
+	}
+	cluster.Status.SetNodePoolScaling(nodePool, scaling)
+	return scaling, nil
+}
+
+// hasNodePool returns true if the cluster has a node pool with the name.
+func hasNodePool(cluster *api.Cluster, name string) bool {
+	for _, nodePool := range cluster.NodePools {
+		if nodePool.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// scaleNodePoolASG sets the min and max size of an ASG. The desired capacity
+// is kept within the new bounds. ASGs of suspended clusters are refused, as
+// resuming the cluster would overwrite the size.
+func (a *awsAdapter) scaleNodePoolASG(asg *autoscaling.Group, minSize, maxSize int64, dryRun bool) error {
+	asgName := aws.StringValue(asg.AutoScalingGroupName)
+
+	if asgTagValue(asg, suspendedCapacityTag) != "" {
+		return fmt.Errorf("ASG %s is suspended, resume the cluster before scaling it", asgName)
+	}
+
+	desired := desiredCapacity(asg)
+	if desired < minSize {
+		desired = minSize
+	}
+	if desired > maxSize {
+		desired = maxSize
+	}
+
+	if dryRun {
+		a.logger.Infof("Dry run, not scaling ASG %s to %d/%d/%d", asgName, minSize, maxSize, desired)
+		return nil
+	}
+
+	a.logger.Infof("Scaling ASG %s to %d/%d/%d", asgName, minSize, maxSize, desired)
+	return a.resizeASG(asgName, minSize, maxSize, desired)
+}
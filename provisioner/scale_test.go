@@ -0,0 +1,88 @@
+package provisioner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestScaleNodePoolASG(t *testing.T) {
+	for _, tc := range []struct {
+		msg             string
+		minSize         int64
+		maxSize         int64
+		expectedDesired int64
+	}{
+		{
+			msg:             "desired capacity within bounds",
+			minSize:         2,
+			maxSize:         20,
+			expectedDesired: 3,
+		},
+		{
+			msg:             "desired capacity raised to min size",
+			minSize:         5,
+			maxSize:         20,
+			expectedDesired: 5,
+		},
+		{
+			msg:             "desired capacity lowered to max size",
+			minSize:         0,
+			maxSize:         2,
+			expectedDesired: 2,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			asgClient := &suspendAutoscalingAPIStub{}
+			a := &awsAdapter{autoscalingClient: asgClient, logger: log.WithField("cluster", "kube-1")}
+
+			asg := suspendTestASG("worker", map[string]string{"NodePool": "worker-default"}, 1, 10, 3)
+			require.NoError(t, a.scaleNodePoolASG(asg, tc.minSize, tc.maxSize, false))
+			require.Len(t, asgClient.updates, 1)
+			assert.Equal(t, tc.minSize, aws.Int64Value(asgClient.updates[0].MinSize))
+			assert.Equal(t, tc.maxSize, aws.Int64Value(asgClient.updates[0].MaxSize))
+			assert.Equal(t, tc.expectedDesired, aws.Int64Value(asgClient.updates[0].DesiredCapacity))
+		})
+	}
+}
+
+func TestScaleNodePoolASGSkipped(t *testing.T) {
+	asgClient := &suspendAutoscalingAPIStub{}
+	a := &awsAdapter{autoscalingClient: asgClient, logger: log.WithField("cluster", "kube-1")}
+
+	asg := suspendTestASG("worker", map[string]string{"NodePool": "worker-default"}, 1, 10, 3)
+	require.NoError(t, a.scaleNodePoolASG(asg, 2, 20, true))
+	assert.Empty(t, asgClient.updates)
+
+	suspended := suspendTestASG("worker", map[string]string{"NodePool": "worker-default", suspendedCapacityTag: "1/10/3"}, 0, 0, 0)
+	assert.Error(t, a.scaleNodePoolASG(suspended, 2, 20, false))
+	assert.Empty(t, asgClient.updates)
+}
+
+func TestScaleNodePoolInvalid(t *testing.T) {
+	scaler := NewNodePoolScaler("", nil, nil)
+	cluster := &api.Cluster{
+		ID:        "kube-1",
+		Provider:  providerID,
+		NodePools: []*api.NodePool{{Name: "worker-default"}},
+	}
+
+	_, err := scaler.ScaleNodePool(context.Background(), cluster, "worker-other", 1, 10, "jdoe")
+	assert.Error(t, err)
+
+	_, err = scaler.ScaleNodePool(context.Background(), cluster, "worker-default", 10, 1, "jdoe")
+	assert.Error(t, err)
+
+	_, err = scaler.ScaleNodePool(context.Background(), cluster, "worker-default", -1, 1, "jdoe")
+	assert.Error(t, err)
+
+	cluster.Provider = "zalando-gce"
+	_, err = scaler.ScaleNodePool(context.Background(), cluster, "worker-default", 1, 10, "jdoe")
+	assert.Equal(t, ErrProviderNotSupported, err)
+}
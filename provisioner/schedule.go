@@ -0,0 +1,239 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	resourceTypeScheduledAction = "AWS::AutoScaling::ScheduledAction"
+	nodePoolTagKey              = "NodePool"
+)
+
+var scheduleNameRegexp = regexp.MustCompile(`^[a-zA-Z0-9]+$`)
+
+// cronField describes a field of a cron expression: the range of its values
+// and the names which can be used instead of the values, starting at the
+// minimum.
+type cronField struct {
+	name     string
+	min, max int
+	names    []string
+}
+
+// cronFields are the fields of the cron expressions of scaling schedules. A
+// day of week of 7 is Sunday, like 0.
+var cronFields = []cronField{
+	{name: "minute", min: 0, max: 59},
+	{name: "hour", min: 0, max: 23},
+	{name: "day of month", min: 1, max: 31},
+	{name: "month", min: 1, max: 12, names: []string{"JAN", "FEB", "MAR", "APR", "MAY", "JUN", "JUL", "AUG", "SEP", "OCT", "NOV", "DEC"}},
+	{name: "day of week", min: 0, max: 7, names: []string{"SUN", "MON", "TUE", "WED", "THU", "FRI", "SAT"}},
+}
+
+// validateCronExpression returns an error if the expression isn't a cron
+// expression of the fields minute, hour, day of month, month and day of week.
+// Every field is a list of values, ranges or '*', ranges and '*' can have a
+// step.
+func validateCronExpression(expression string) error {
+	fields := strings.Fields(expression)
+	if len(fields) != len(cronFields) {
+		return fmt.Errorf("expected %d fields, got %d", len(cronFields), len(fields))
+	}
+
+	for i, field := range fields {
+		for _, part := range strings.Split(field, ",") {
+			err := cronFields[i].validate(part)
+			if err != nil {
+				return fmt.Errorf("invalid %s '%s': %v", cronFields[i].name, field, err)
+			}
+		}
+	}
+	return nil
+}
+
+// validate returns an error if part isn't a valid element of the list of
+// the field.
+func (f cronField) validate(part string) error {
+	values := part
+	if sep := strings.Index(part, "/"); sep != -1 {
+		values = part[:sep]
+		step, err := strconv.Atoi(part[sep+1:])
+		if err != nil || step <= 0 {
+			return fmt.Errorf("invalid step '%s'", part[sep+1:])
+		}
+		if values != "*" && !strings.Contains(values, "-") {
+			return fmt.Errorf("step of '%s' without a range", values)
+		}
+	}
+
+	if values == "*" {
+		return nil
+	}
+
+	bounds := strings.SplitN(values, "-", 2)
+	low, err := f.value(bounds[0])
+	if err != nil {
+		return err
+	}
+
+	if len(bounds) == 2 {
+		high, err := f.value(bounds[1])
+		if err != nil {
+			return err
+		}
+		if low > high {
+			return fmt.Errorf("empty range '%s'", values)
+		}
+	}
+	return nil
+}
+
+// value parses a value or a name of the field.
+func (f cronField) value(value string) (int, error) {
+	for i, name := range f.names {
+		if strings.EqualFold(value, name) {
+			return f.min + i, nil
+		}
+	}
+
+	v, err := strconv.Atoi(value)
+	if err != nil || v < f.min || v > f.max {
+		return 0, fmt.Errorf("value '%s' out of range %d-%d", value, f.min, f.max)
+	}
+	return v, nil
+}
+
+// validateScalingSchedules validates the scaling schedules of a node pool.
+// The min and max size of the node pool in the registry limit the sizes of
+// the schedules, as they're restored on every update of the node pool.
+func validateScalingSchedules(nodePool *api.NodePool) error {
+	names := make(map[string]bool, len(nodePool.ScalingSchedules))
+	for _, schedule := range nodePool.ScalingSchedules {
+		if !scheduleNameRegexp.MatchString(schedule.Name) {
+			return fmt.Errorf("invalid scaling schedule name '%s' for node pool %s, must be alphanumeric", schedule.Name, nodePool.Name)
+		}
+
+		if names[schedule.Name] {
+			return fmt.Errorf("duplicate scaling schedule %s for node pool %s", schedule.Name, nodePool.Name)
+		}
+		names[schedule.Name] = true
+
+		err := validateCronExpression(schedule.Recurrence)
+		if err != nil {
+			return fmt.Errorf("invalid recurrence '%s' of scaling schedule %s for node pool %s: %v", schedule.Recurrence, schedule.Name, nodePool.Name, err)
+		}
+
+		if schedule.MinSize < 0 || schedule.MinSize > schedule.DesiredCapacity || schedule.DesiredCapacity > schedule.MaxSize {
+			return fmt.Errorf("scaling schedule %s for node pool %s must satisfy 0 <= min_size <= desired_capacity <= max_size", schedule.Name, nodePool.Name)
+		}
+
+		if schedule.MinSize < nodePool.MinSize || schedule.MaxSize > nodePool.MaxSize {
+			return fmt.Errorf("scaling schedule %s for node pool %s must be within the min_size %d and max_size %d of the node pool", schedule.Name, nodePool.Name, nodePool.MinSize, nodePool.MaxSize)
+		}
+	}
+
+	return nil
+}
+
+// addScheduledActions adds a scheduled action per scaling schedule of the
+// node pools to the stack template. The actions refer to the ASG of the
+// template which is tagged with the name of the node pool, such that the
+// stack definition doesn't have to know about the schedules.
+func addScheduledActions(stackTemplate []byte, nodePools ...*api.NodePool) ([]byte, error) {
+	var scheduled []*api.NodePool
+	for _, nodePool := range nodePools {
+		if len(nodePool.ScalingSchedules) > 0 {
+			scheduled = append(scheduled, nodePool)
+		}
+	}
+
+	if len(scheduled) == 0 {
+		return stackTemplate, nil
+	}
+
+	return modifyStackResources(stackTemplate, func(resources map[string]interface{}) error {
+		for _, nodePool := range scheduled {
+			asgLogicalID, err := nodePoolASGLogicalID(resources, nodePool)
+			if err != nil {
+				return err
+			}
+
+			for _, schedule := range nodePool.ScalingSchedules {
+				resources[asgLogicalID+schedule.Name] = map[string]interface{}{
+					"Type": resourceTypeScheduledAction,
+					"Properties": map[string]interface{}{
+						"AutoScalingGroupName": map[string]interface{}{"Ref": asgLogicalID},
+						"Recurrence":           schedule.Recurrence,
+						"MinSize":              schedule.MinSize,
+						"MaxSize":              schedule.MaxSize,
+						"DesiredCapacity":      schedule.DesiredCapacity,
+					},
+				}
+			}
+		}
+		return nil
+	})
+}
+
+// modifyStackResources parses a JSON stack template, lets modify change its
+// resources and returns the modified template.
+func modifyStackResources(stackTemplate []byte, modify func(resources map[string]interface{}) error) ([]byte, error) {
+	var template map[string]interface{}
+	err := json.Unmarshal(stackTemplate, &template)
+	if err != nil {
+		return nil, err
+	}
+
+	resources, ok := template["Resources"].(map[string]interface{})
+	if !ok {
+		return nil, fmt.Errorf("stack template has no resources")
+	}
+
+	err = modify(resources)
+	if err != nil {
+		return nil, err
+	}
+
+	return json.Marshal(template)
+}
+
+// nodePoolASGLogicalID returns the logical ID of the ASG of the node pool in
+// the resources of a stack template.
+func nodePoolASGLogicalID(resources map[string]interface{}, nodePool *api.NodePool) (string, error) {
+	for logicalID, resource := range resources {
+		if isNodePoolASGResource(resource, nodePool.Name) {
+			return logicalID, nil
+		}
+	}
+	return "", fmt.Errorf("failed to find ASG for node pool '%s' in stack template", nodePool.Name)
+}
+
+// isNodePoolASGResource returns true if the template resource is an ASG
+// tagged with the node pool name.
+func isNodePoolASGResource(resource interface{}, nodePool string) bool {
+	r, ok := resource.(map[string]interface{})
+	if !ok || r["Type"] != resourceTypeAutoScalingGroup {
+		return false
+	}
+
+	properties, ok := r["Properties"].(map[string]interface{})
+	if !ok {
+		return false
+	}
+
+	tags, _ := properties["Tags"].([]interface{})
+	for _, tag := range tags {
+		t, ok := tag.(map[string]interface{})
+		if ok && t["Key"] == nodePoolTagKey && t["Value"] == nodePool {
+			return true
+		}
+	}
+
+	return false
+}
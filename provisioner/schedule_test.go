@@ -0,0 +1,163 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const testScheduleStackTemplate = `{
+  "Resources": {
+    "MasterAutoScaling": {
+      "Type": "AWS::AutoScaling::AutoScalingGroup",
+      "Properties": {"Tags": [{"Key": "NodePool", "Value": "master-default"}]}
+    },
+    "WorkerAutoScaling": {
+      "Type": "AWS::AutoScaling::AutoScalingGroup",
+      "Properties": {"Tags": [{"Key": "NodePool", "Value": "worker-default"}]}
+    }
+  }
+}`
+
+func TestValidateScalingSchedules(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		schedule *api.ScalingSchedule
+		valid    bool
+	}{
+		{
+			msg:      "valid schedule",
+			schedule: &api.ScalingSchedule{Name: "NightlyScaleDown", Recurrence: "0 19 * * 1-5"},
+			valid:    true,
+		},
+		{
+			msg:      "invalid name",
+			schedule: &api.ScalingSchedule{Name: "nightly-scale-down", Recurrence: "0 19 * * 1-5"},
+		},
+		{
+			msg:      "invalid recurrence",
+			schedule: &api.ScalingSchedule{Name: "NightlyScaleDown", Recurrence: "19:00"},
+		},
+		{
+			msg:      "cron steps, lists and names",
+			schedule: &api.ScalingSchedule{Name: "NightlyScaleDown", Recurrence: "*/15 0-6/2,22 1,15 jan-MAR SAT,SUN"},
+			valid:    true,
+		},
+		{
+			msg:      "minute out of range",
+			schedule: &api.ScalingSchedule{Name: "NightlyScaleDown", Recurrence: "60 19 * * 1-5"},
+		},
+		{
+			msg:      "hour out of range",
+			schedule: &api.ScalingSchedule{Name: "NightlyScaleDown", Recurrence: "0 24 * * 1-5"},
+		},
+		{
+			msg:      "empty range",
+			schedule: &api.ScalingSchedule{Name: "NightlyScaleDown", Recurrence: "0 19 * * 5-1"},
+		},
+		{
+			msg:      "unknown name",
+			schedule: &api.ScalingSchedule{Name: "NightlyScaleDown", Recurrence: "0 19 * * MON-FRY"},
+		},
+		{
+			msg:      "invalid step",
+			schedule: &api.ScalingSchedule{Name: "NightlyScaleDown", Recurrence: "*/0 19 * * *"},
+		},
+		{
+			msg:      "desired capacity above max size",
+			schedule: &api.ScalingSchedule{Name: "NightlyScaleDown", Recurrence: "0 19 * * 1-5", MaxSize: 1, DesiredCapacity: 2},
+		},
+		{
+			msg:      "max size above the node pool",
+			schedule: &api.ScalingSchedule{Name: "MorningScaleUp", Recurrence: "0 7 * * 1-5", MinSize: 3, MaxSize: 30, DesiredCapacity: 3},
+		},
+		{
+			msg:      "within the node pool",
+			schedule: &api.ScalingSchedule{Name: "MorningScaleUp", Recurrence: "0 7 * * 1-5", MinSize: 3, MaxSize: 20, DesiredCapacity: 3},
+			valid:    true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := validateScalingSchedules(&api.NodePool{
+				Name:             "worker-default",
+				MaxSize:          20,
+				ScalingSchedules: []*api.ScalingSchedule{tc.schedule},
+			})
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+
+	schedule := &api.ScalingSchedule{Name: "NightlyScaleDown", Recurrence: "0 19 * * 1-5"}
+	err := validateScalingSchedules(&api.NodePool{
+		Name:             "worker-default",
+		ScalingSchedules: []*api.ScalingSchedule{schedule, schedule},
+	})
+	assert.Error(t, err)
+
+	// the min size of the node pool is restored on updates, so schedules
+	// can't scale below it.
+	err = validateScalingSchedules(&api.NodePool{
+		Name:             "worker-default",
+		MinSize:          1,
+		MaxSize:          20,
+		ScalingSchedules: []*api.ScalingSchedule{schedule},
+	})
+	assert.Error(t, err)
+}
+
+func TestAddScheduledActions(t *testing.T) {
+	pool := &api.NodePool{Name: "worker-default"}
+
+	// the template is not changed without schedules.
+	output, err := addScheduledActions([]byte(testScheduleStackTemplate), pool)
+	require.NoError(t, err)
+	assert.Equal(t, testScheduleStackTemplate, string(output))
+
+	pool.ScalingSchedules = []*api.ScalingSchedule{
+		{Name: "ScaleDown", Recurrence: "0 19 * * 1-5", MinSize: 0, MaxSize: 0, DesiredCapacity: 0},
+		{Name: "ScaleUp", Recurrence: "0 7 * * 1-5", MinSize: 3, MaxSize: 20, DesiredCapacity: 3},
+	}
+	output, err = addScheduledActions([]byte(testScheduleStackTemplate), pool)
+	require.NoError(t, err)
+
+	var template struct {
+		Resources map[string]struct {
+			Type       string
+			Properties map[string]interface{}
+		}
+	}
+	require.NoError(t, json.Unmarshal(output, &template))
+	require.Len(t, template.Resources, 4)
+
+	scaleUp := template.Resources["WorkerAutoScalingScaleUp"]
+	assert.Equal(t, resourceTypeScheduledAction, scaleUp.Type)
+	assert.Equal(t, map[string]interface{}{"Ref": "WorkerAutoScaling"}, scaleUp.Properties["AutoScalingGroupName"])
+	assert.Equal(t, "0 7 * * 1-5", scaleUp.Properties["Recurrence"])
+	assert.EqualValues(t, 3, scaleUp.Properties["MinSize"])
+	assert.EqualValues(t, 20, scaleUp.Properties["MaxSize"])
+	assert.EqualValues(t, 3, scaleUp.Properties["DesiredCapacity"])
+
+	// the schedules of every node pool are added.
+	master := &api.NodePool{Name: "master-default", ScalingSchedules: []*api.ScalingSchedule{
+		{Name: "Weekend", Recurrence: "0 0 * * SAT", MinSize: 1, MaxSize: 1, DesiredCapacity: 1},
+	}}
+	output, err = addScheduledActions([]byte(testScheduleStackTemplate), master, pool)
+	require.NoError(t, err)
+	require.NoError(t, json.Unmarshal(output, &template))
+	assert.Len(t, template.Resources, 5)
+	assert.Contains(t, template.Resources, "MasterAutoScalingWeekend")
+	assert.Contains(t, template.Resources, "WorkerAutoScalingScaleUp")
+
+	// node pools without an ASG in the template are rejected.
+	pool.Name = "worker-unknown"
+	_, err = addScheduledActions([]byte(testScheduleStackTemplate), pool)
+	assert.Error(t, err)
+}
@@ -0,0 +1,110 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// secretsManagerReferencePrefix is the prefix of config items
+	// referencing a secret in AWS Secrets Manager, e.g.
+	// aws-sm://kubernetes/registry or aws-sm://kubernetes/registry#password
+	// for a key of a JSON secret.
+	secretsManagerReferencePrefix = "aws-sm://"
+	// ssmParameterReferencePrefix is the prefix of config items
+	// referencing an SSM parameter, e.g. ssm://kubernetes/kube-1/token for
+	// the parameter /kubernetes/kube-1/token.
+	ssmParameterReferencePrefix = "ssm://"
+)
+
+// isSecretReference returns true if the config item value references a
+// secret.
+func isSecretReference(value string) bool {
+	return strings.HasPrefix(value, secretsManagerReferencePrefix) || strings.HasPrefix(value, ssmParameterReferencePrefix)
+}
+
+// resolveSecretReferences returns a copy of the cluster whose config items
+// referencing secrets in Secrets Manager or SSM parameters of the cluster's
+// account are replaced by the secrets. Every secret is read once, even if
+// it's referenced by several config items.
+func (a *awsAdapter) resolveSecretReferences(cluster *api.Cluster) (*api.Cluster, error) {
+	secrets := make(map[string]string)
+	configItems := make(map[string]string, len(cluster.ConfigItems))
+	for key, value := range cluster.ConfigItems {
+		if !isSecretReference(value) {
+			configItems[key] = value
+			continue
+		}
+
+		secret, ok := secrets[value]
+		if !ok {
+			var err error
+			secret, err = a.resolveSecretReference(value)
+			if err != nil {
+				return nil, fmt.Errorf("failed to resolve config item %s: %v", key, err)
+			}
+			secrets[value] = secret
+		}
+		configItems[key] = secret
+	}
+
+	resolved := *cluster
+	resolved.ConfigItems = configItems
+	return &resolved, nil
+}
+
+// resolveSecretReference reads the secret referenced by a config item value.
+func (a *awsAdapter) resolveSecretReference(reference string) (string, error) {
+	if strings.HasPrefix(reference, ssmParameterReferencePrefix) {
+		name := "/" + strings.TrimPrefix(strings.TrimPrefix(reference, ssmParameterReferencePrefix), "/")
+		resp, err := a.ssmClient.GetParameter(&ssm.GetParameterInput{
+			Name:           aws.String(name),
+			WithDecryption: aws.Bool(true),
+		})
+		if err != nil {
+			return "", fmt.Errorf("failed to get SSM parameter %s: %v", name, err)
+		}
+		return aws.StringValue(resp.Parameter.Value), nil
+	}
+
+	name := strings.TrimPrefix(reference, secretsManagerReferencePrefix)
+	var jsonKey string
+	if i := strings.LastIndex(name, "#"); i >= 0 {
+		name, jsonKey = name[:i], name[i+1:]
+	}
+
+	resp, err := a.secretsManagerClient.GetSecretValue(&secretsmanager.GetSecretValueInput{SecretId: aws.String(name)})
+	if err != nil {
+		return "", fmt.Errorf("failed to get secret %s: %v", name, err)
+	}
+
+	secret := aws.StringValue(resp.SecretString)
+	if resp.SecretString == nil {
+		secret = string(resp.SecretBinary)
+	}
+
+	if jsonKey == "" {
+		return secret, nil
+	}
+
+	// the secret itself is never part of the error, it would end up in
+	// the problems of the cluster in the registry.
+	var fields map[string]interface{}
+	err = json.Unmarshal([]byte(secret), &fields)
+	if err != nil {
+		return "", fmt.Errorf("secret %s isn't a JSON object", name)
+	}
+
+	value, ok := fields[jsonKey].(string)
+	if !ok {
+		return "", fmt.Errorf("secret %s has no string key %s", name, jsonKey)
+	}
+	return value, nil
+}
@@ -0,0 +1,145 @@
+package provisioner
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/secretsmanager"
+	"github.com/aws/aws-sdk-go/service/ssm"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type secretsManagerAPIStub struct {
+	secrets map[string]string
+	calls   int
+}
+
+func (s *secretsManagerAPIStub) GetSecretValue(input *secretsmanager.GetSecretValueInput) (*secretsmanager.GetSecretValueOutput, error) {
+	s.calls++
+	secret, ok := s.secrets[aws.StringValue(input.SecretId)]
+	if !ok {
+		return nil, fmt.Errorf("secret not found")
+	}
+	return &secretsmanager.GetSecretValueOutput{SecretString: aws.String(secret)}, nil
+}
+
+type ssmAPIStub struct {
+	ssmAPI
+	parameters map[string]string
+}
+
+func (s *ssmAPIStub) GetParameter(input *ssm.GetParameterInput) (*ssm.GetParameterOutput, error) {
+	if !aws.BoolValue(input.WithDecryption) {
+		return nil, fmt.Errorf("parameter not decrypted")
+	}
+	value, ok := s.parameters[aws.StringValue(input.Name)]
+	if !ok {
+		return nil, fmt.Errorf("parameter not found")
+	}
+	return &ssm.GetParameterOutput{Parameter: &ssm.Parameter{Value: aws.String(value)}}, nil
+}
+
+func TestResolveSecretReferences(t *testing.T) {
+	for _, tc := range []struct {
+		msg         string
+		configItems map[string]string
+		expected    map[string]string
+		success     bool
+	}{
+		{
+			msg: "config items without references",
+			configItems: map[string]string{
+				"foo": "bar",
+				"url": "https://example.org",
+			},
+			expected: map[string]string{
+				"foo": "bar",
+				"url": "https://example.org",
+			},
+			success: true,
+		},
+		{
+			msg: "secrets manager and SSM references",
+			configItems: map[string]string{
+				"worker_shared_secret": "ssm://kubernetes/kube-1/worker-secret",
+				"bootstrap_token":      "ssm:///kubernetes/kube-1/token",
+				"registry_password":    "aws-sm://kubernetes/registry#password",
+				"registry_config":      "aws-sm://kubernetes/registry",
+				"foo":                  "bar",
+			},
+			expected: map[string]string{
+				"worker_shared_secret": "secret",
+				"bootstrap_token":      "token",
+				"registry_password":    "hunter2",
+				"registry_config":      `{"username": "clm", "password": "hunter2"}`,
+				"foo":                  "bar",
+			},
+			success: true,
+		},
+		{
+			msg:         "missing secret",
+			configItems: map[string]string{"foo": "aws-sm://missing"},
+			success:     false,
+		},
+		{
+			msg:         "missing key",
+			configItems: map[string]string{"foo": "aws-sm://kubernetes/registry#token"},
+			success:     false,
+		},
+		{
+			msg:         "key of a secret which isn't JSON",
+			configItems: map[string]string{"foo": "aws-sm://kubernetes/plain#password"},
+			success:     false,
+		},
+		{
+			msg:         "missing parameter",
+			configItems: map[string]string{"foo": "ssm://missing"},
+			success:     false,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			a := &awsAdapter{
+				secretsManagerClient: &secretsManagerAPIStub{secrets: map[string]string{
+					"kubernetes/registry": `{"username": "clm", "password": "hunter2"}`,
+					"kubernetes/plain":    "hunter2",
+				}},
+				ssmClient: &ssmAPIStub{parameters: map[string]string{
+					"/kubernetes/kube-1/worker-secret": "secret",
+					"/kubernetes/kube-1/token":         "token",
+				}},
+			}
+
+			cluster := &api.Cluster{ConfigItems: tc.configItems}
+			resolved, err := a.resolveSecretReferences(cluster)
+			if !tc.success {
+				require.Error(t, err)
+				assert.NotContains(t, err.Error(), "hunter2")
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, resolved.ConfigItems)
+		})
+	}
+}
+
+func TestResolveSecretReferencesOnce(t *testing.T) {
+	client := &secretsManagerAPIStub{secrets: map[string]string{"kubernetes/registry": `{"username": "clm", "password": "hunter2"}`}}
+	a := &awsAdapter{secretsManagerClient: client}
+
+	cluster := &api.Cluster{ConfigItems: map[string]string{
+		"registry_username": "aws-sm://kubernetes/registry#username",
+		"registry_password": "aws-sm://kubernetes/registry#password",
+		"password":          "aws-sm://kubernetes/registry#password",
+	}}
+	resolved, err := a.resolveSecretReferences(cluster)
+	require.NoError(t, err)
+	assert.Equal(t, "hunter2", resolved.ConfigItems["password"])
+	assert.Equal(t, 2, client.calls)
+
+	// the config items of the cluster keep the references.
+	assert.Equal(t, "aws-sm://kubernetes/registry#password", cluster.ConfigItems["password"])
+}
@@ -0,0 +1,258 @@
+package provisioner
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+	"unicode"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/client/metadata"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/aws/signer/v4"
+	"github.com/aws/aws-sdk-go/private/protocol/jsonrpc"
+	"github.com/aws/aws-sdk-go/service/ec2"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+)
+
+const (
+	serviceQuotasSigningName = "servicequotas"
+	serviceQuotasEC2         = "ec2"
+
+	// maxLaunchTemplates is the number of launch templates per region. The
+	// limit isn't adjustable and not exposed by the Service Quotas API.
+	maxLaunchTemplates = 5000
+)
+
+// vCPUQuota is a quota of the vCPUs of the running instances of a group of
+// instance families.
+type vCPUQuota struct {
+	code string
+	name string
+}
+
+var (
+	// onDemandVCPUQuotas are the vCPU quotas of on-demand instances by
+	// instance class.
+	onDemandVCPUQuotas = map[string]vCPUQuota{
+		"standard": {code: "L-1216C47A", name: "Running On-Demand Standard (A, C, D, H, I, M, R, T, Z) instances"},
+		"g":        {code: "L-DB2E81BA", name: "Running On-Demand G and VT instances"},
+		"p":        {code: "L-417A185B", name: "Running On-Demand P instances"},
+		"x":        {code: "L-7295265B", name: "Running On-Demand X instances"},
+		"f":        {code: "L-74FC7D96", name: "Running On-Demand F instances"},
+		"inf":      {code: "L-1945791B", name: "Running On-Demand Inf instances"},
+	}
+	// spotVCPUQuotas are the vCPU quotas of spot instances by instance
+	// class.
+	spotVCPUQuotas = map[string]vCPUQuota{
+		"standard": {code: "L-34B43A08", name: "All Standard (A, C, D, H, I, M, R, T, Z) Spot Instance Requests"},
+		"g":        {code: "L-3819A6DF", name: "All G and VT Spot Instance Requests"},
+		"p":        {code: "L-7212CCBC", name: "All P Spot Instance Requests"},
+		"x":        {code: "L-E3A00192", name: "All X Spot Instance Requests"},
+		"f":        {code: "L-88CF9481", name: "All F Spot Instance Requests"},
+		"inf":      {code: "L-B5D1601B", name: "All Inf Spot Instance Requests"},
+	}
+)
+
+// The Service Quotas API is missing from the vendored AWS SDK, so the
+// GetServiceQuota operation is defined here and sent with the
+// serviceQuotasClient. The shapes only contain the fields used.
+
+type getServiceQuotaInput struct {
+	_           struct{} `type:"structure"`
+	ServiceCode *string  `min:"1" type:"string" required:"true"`
+	QuotaCode   *string  `min:"1" type:"string" required:"true"`
+}
+
+type serviceQuota struct {
+	_         struct{} `type:"structure"`
+	QuotaName *string  `type:"string"`
+	Value     *float64 `type:"double"`
+}
+
+type getServiceQuotaOutput struct {
+	_     struct{}      `type:"structure"`
+	Quota *serviceQuota `type:"structure"`
+}
+
+// serviceQuotasAPI is the minimal interface containing the operations of the
+// Service Quotas API.
+type serviceQuotasAPI interface {
+	GetServiceQuota(input *getServiceQuotaInput) (*getServiceQuotaOutput, error)
+}
+
+// serviceQuotasClient sends the operations of the Service Quotas API with the
+// JSON protocol.
+type serviceQuotasClient struct {
+	client *client.Client
+}
+
+func newServiceQuotasClient(sess *session.Session) *serviceQuotasClient {
+	cfg := sess.ClientConfig(serviceQuotasSigningName)
+	c := client.New(*cfg.Config, metadata.ClientInfo{
+		ServiceName:   "Service Quotas",
+		SigningName:   serviceQuotasSigningName,
+		SigningRegion: cfg.SigningRegion,
+		Endpoint:      cfg.Endpoint,
+		APIVersion:    "2019-06-24",
+		JSONVersion:   "1.1",
+		TargetPrefix:  "ServiceQuotasV20190624",
+	}, cfg.Handlers)
+
+	c.Handlers.Sign.PushBackNamed(v4.SignRequestHandler)
+	c.Handlers.Build.PushBackNamed(jsonrpc.BuildHandler)
+	c.Handlers.Unmarshal.PushBackNamed(jsonrpc.UnmarshalHandler)
+	c.Handlers.UnmarshalMeta.PushBackNamed(jsonrpc.UnmarshalMetaHandler)
+	c.Handlers.UnmarshalError.PushBackNamed(jsonrpc.UnmarshalErrorHandler)
+
+	return &serviceQuotasClient{client: c}
+}
+
+func (c *serviceQuotasClient) GetServiceQuota(input *getServiceQuotaInput) (*getServiceQuotaOutput, error) {
+	op := &request.Operation{
+		Name:       "GetServiceQuota",
+		HTTPMethod: "POST",
+		HTTPPath:   "/",
+	}
+	output := &getServiceQuotaOutput{}
+	return output, c.client.NewRequest(op, input, output).Send()
+}
+
+// instanceClass returns the class of an instance type determining its vCPU
+// quota, e.g. 'standard' for 'm5.xlarge' or 'inf' for 'inf1.xlarge'. An empty
+// string is returned for instance types without a known vCPU quota.
+func instanceClass(instanceType string) string {
+	family := instanceType
+	if i := strings.IndexFunc(instanceType, unicode.IsDigit); i >= 0 {
+		family = instanceType[:i]
+	}
+
+	switch family {
+	case "":
+		return ""
+	case "inf":
+		return "inf"
+	case "vt":
+		return "g"
+	case "dl", "trn", "hpc", "mac", "u-":
+		return ""
+	}
+
+	switch family[:1] {
+	case "a", "c", "d", "h", "i", "m", "r", "t", "z":
+		return "standard"
+	case "g", "p", "x", "f":
+		return family[:1]
+	}
+	return ""
+}
+
+// nodePoolVCPUQuota returns the vCPU quota limiting the instances of a node
+// pool. It returns false if the instance type has no known vCPU quota.
+func nodePoolVCPUQuota(nodePool *api.NodePool) (vCPUQuota, bool) {
+	quotas := onDemandVCPUQuotas
+	if isSpotNodePool(nodePool) {
+		quotas = spotVCPUQuotas
+	}
+	quota, ok := quotas[instanceClass(nodePool.InstanceType)]
+	return quota, ok
+}
+
+// checkVCPUQuota verifies that the node pools scaled to their max size don't
+// exceed the vCPU quotas of the account in the region of the cluster. Quotas
+// which can't be looked up are skipped with a warning, so a missing
+// permission for the Service Quotas API doesn't block the provisioning.
+func (a *awsAdapter) checkVCPUQuota(cluster *api.Cluster) error {
+	required := make(map[vCPUQuota]int64)
+	for _, nodePool := range cluster.NodePools {
+		quota, ok := nodePoolVCPUQuota(nodePool)
+		if !ok {
+			continue
+		}
+
+		instanceInfo, ok := awsExt.InstanceInfo()[nodePool.InstanceType]
+		if !ok {
+			continue
+		}
+		required[quota] += nodePool.MaxSize * instanceInfo.VCPU
+	}
+
+	quotas := make([]vCPUQuota, 0, len(required))
+	for quota := range required {
+		quotas = append(quotas, quota)
+	}
+	sort.Slice(quotas, func(i, j int) bool {
+		return quotas[i].code < quotas[j].code
+	})
+
+	for _, quota := range quotas {
+		resp, err := a.serviceQuotasClient.GetServiceQuota(&getServiceQuotaInput{
+			ServiceCode: aws.String(serviceQuotasEC2),
+			QuotaCode:   aws.String(quota.code),
+		})
+		if err != nil || resp.Quota == nil {
+			a.logger.Warnf("Failed to get the quota of %s, skipping the vCPU check: %v", quota.name, err)
+			continue
+		}
+
+		limit := int64(math.Floor(aws.Float64Value(resp.Quota.Value)))
+		if required[quota] > limit {
+			return fmt.Errorf("node pools need %d more vCPUs of %s in %s: %d required, but the quota is %d", required[quota]-limit, quota.name, cluster.Region, required[quota], limit)
+		}
+	}
+	return nil
+}
+
+// checkLaunchTemplateQuota verifies that the launch templates of node pools
+// not created yet fit into the launch template limit of the region.
+func (a *awsAdapter) checkLaunchTemplateQuota(cluster *api.Cluster) error {
+	var templates int64
+	input := &ec2.DescribeLaunchTemplatesInput{}
+	for {
+		resp, err := a.ec2Client.DescribeLaunchTemplates(input)
+		if err != nil {
+			return err
+		}
+		templates += int64(len(resp.LaunchTemplates))
+
+		if aws.StringValue(resp.NextToken) == "" {
+			break
+		}
+		input.NextToken = resp.NextToken
+	}
+
+	groups, err := a.listStackASGs(cluster.LocalID)
+	if err != nil {
+		return err
+	}
+
+	required := int64(len(cluster.NodePools) - len(groups))
+	available := maxLaunchTemplates - templates
+	if required > available {
+		return fmt.Errorf("node pools need %d more launch templates in %s: %d required, but only %d of %d available", required-available, cluster.Region, required, available, maxLaunchTemplates)
+	}
+	return nil
+}
+
+// checkQuotas verifies that the node pools of the cluster fit into the ASG,
+// launch template and vCPU quotas of the account, so updates exceeding them
+// fail before CloudFormation creates some of the node pools and rolls them
+// back.
+func (a *awsAdapter) checkQuotas(cluster *api.Cluster) error {
+	for _, check := range []func(*api.Cluster) error{
+		a.checkASGQuota,
+		a.checkLaunchTemplateQuota,
+		a.checkVCPUQuota,
+	} {
+		err := check(cluster)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,125 @@
+package provisioner
+
+import (
+	"fmt"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type serviceQuotasAPIStub struct {
+	quotas map[string]float64
+}
+
+func (s *serviceQuotasAPIStub) GetServiceQuota(input *getServiceQuotaInput) (*getServiceQuotaOutput, error) {
+	value, ok := s.quotas[aws.StringValue(input.QuotaCode)]
+	if !ok {
+		return nil, fmt.Errorf("quota %s not found", aws.StringValue(input.QuotaCode))
+	}
+	return &getServiceQuotaOutput{Quota: &serviceQuota{Value: aws.Float64(value)}}, nil
+}
+
+type launchTemplatesEC2APIStub struct {
+	ec2API
+	pages [][]*ec2.LaunchTemplate
+}
+
+func (e *launchTemplatesEC2APIStub) DescribeLaunchTemplates(input *ec2.DescribeLaunchTemplatesInput) (*ec2.DescribeLaunchTemplatesOutput, error) {
+	page := 0
+	if input.NextToken != nil {
+		fmt.Sscanf(aws.StringValue(input.NextToken), "%d", &page)
+	}
+
+	output := &ec2.DescribeLaunchTemplatesOutput{LaunchTemplates: e.pages[page]}
+	if page+1 < len(e.pages) {
+		output.NextToken = aws.String(fmt.Sprintf("%d", page+1))
+	}
+	return output, nil
+}
+
+func TestInstanceClass(t *testing.T) {
+	for instanceType, class := range map[string]string{
+		"m5.xlarge":    "standard",
+		"c6gn.large":   "standard",
+		"im4gn.large":  "standard",
+		"g4dn.xlarge":  "g",
+		"vt1.3xlarge":  "g",
+		"p3.2xlarge":   "p",
+		"x2gd.large":   "x",
+		"inf1.xlarge":  "inf",
+		"u-6tb1.metal": "",
+		"mac1.metal":   "",
+		"":             "",
+	} {
+		assert.Equal(t, class, instanceClass(instanceType), instanceType)
+	}
+}
+
+func TestCheckVCPUQuota(t *testing.T) {
+	adapter := &awsAdapter{
+		serviceQuotasClient: &serviceQuotasAPIStub{quotas: map[string]float64{
+			"L-1216C47A": 64,
+			"L-34B43A08": 32,
+		}},
+		logger: log.WithField("test", true),
+	}
+
+	cluster := &api.Cluster{
+		Region: "eu-central-1",
+		NodePools: []*api.NodePool{
+			{Name: "master-default", InstanceType: "m5.large", MaxSize: 2},
+			{Name: "worker-default", InstanceType: "m5.xlarge", MaxSize: 15},
+			// quotas which can't be looked up are skipped.
+			{Name: "worker-gpu", InstanceType: "p3.2xlarge", MaxSize: 100},
+		},
+	}
+	require.NoError(t, adapter.checkVCPUQuota(cluster))
+
+	cluster.NodePools[1].MaxSize = 30
+	err := adapter.checkVCPUQuota(cluster)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "node pools need 60 more vCPUs")
+	assert.Contains(t, err.Error(), "in eu-central-1")
+
+	// spot node pools are limited by the spot quotas.
+	cluster.NodePools[1].DiscountStrategy = discountStrategySpotMaxPrice
+	cluster.NodePools[1].MaxSize = 8
+	require.NoError(t, adapter.checkVCPUQuota(cluster))
+
+	cluster.NodePools[1].MaxSize = 9
+	assert.Error(t, adapter.checkVCPUQuota(cluster))
+}
+
+func TestCheckLaunchTemplateQuota(t *testing.T) {
+	templates := make([]*ec2.LaunchTemplate, maxLaunchTemplates/2)
+	adapter := &awsAdapter{
+		ec2Client: &launchTemplatesEC2APIStub{pages: [][]*ec2.LaunchTemplate{templates, templates[:len(templates)-1]}},
+		autoscalingClient: &preflightAutoscalingAPIStub{groups: []*autoscaling.Group{
+			{
+				AutoScalingGroupName: aws.String("kube-1-worker"),
+				Tags: []*autoscaling.TagDescription{
+					{Key: aws.String("aws:cloudformation:stack-name"), Value: aws.String("kube-1")},
+				},
+			},
+		}},
+	}
+
+	cluster := &api.Cluster{
+		LocalID:   "kube-1",
+		Region:    "eu-central-1",
+		NodePools: []*api.NodePool{{Name: "worker-default"}, {Name: "worker-new"}},
+	}
+	require.NoError(t, adapter.checkLaunchTemplateQuota(cluster))
+
+	cluster.NodePools = append(cluster.NodePools, &api.NodePool{Name: "worker-other"})
+	err := adapter.checkLaunchTemplateQuota(cluster)
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "node pools need 1 more launch templates")
+}
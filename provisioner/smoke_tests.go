@@ -0,0 +1,182 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v2"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/kubernetes"
+)
+
+const (
+	// smokeTestsFile is the file in the cluster directory of the channel
+	// declaring the smoke tests run after a cluster was updated.
+	smokeTestsFile = "smoke-tests.yaml"
+	// configKeySmokeTests enables the smoke tests of the channel for a
+	// cluster if it's 'true'.
+	configKeySmokeTests = "smoke_tests"
+
+	// defaultSmokeTestTimeout is the time a smoke test may run unless it
+	// specifies a timeout.
+	defaultSmokeTestTimeout = 5 * time.Minute
+)
+
+// smokeTest is a test of a cluster run after it was updated, e.g. checking
+// the DNS resolution or the networking between the nodes. It creates the Job
+// rendered from the template Job in the cluster and passes if the Job
+// completes within the timeout.
+type smokeTest struct {
+	Name string `yaml:"name"`
+	// Job is the path of the Job manifest template relative to the
+	// cluster directory of the channel.
+	Job     string `yaml:"job"`
+	Timeout string `yaml:"timeout"`
+
+	timeout time.Duration
+}
+
+// smokeTestJobData is the data the Job templates of the smoke tests are
+// rendered with.
+type smokeTestJobData struct {
+	Cluster *api.Cluster
+}
+
+// smokeTestsFailedError is returned if some of the smoke tests of a cluster
+// failed after it was updated.
+type smokeTestsFailedError struct {
+	failed []string
+}
+
+func (e *smokeTestsFailedError) Error() string {
+	return fmt.Sprintf("smoke tests failed: %s", strings.Join(e.failed, ", "))
+}
+
+// validate checks the smoke test and parses its timeout.
+func (t *smokeTest) validate() error {
+	if t.Name == "" {
+		return fmt.Errorf("smoke test without name")
+	}
+
+	if t.Job == "" {
+		return fmt.Errorf("smoke test %s must specify a job", t.Name)
+	}
+
+	t.timeout = defaultSmokeTestTimeout
+	if t.Timeout != "" {
+		timeout, err := time.ParseDuration(t.Timeout)
+		if err != nil || timeout <= 0 {
+			return fmt.Errorf("smoke test %s has invalid timeout %s", t.Name, t.Timeout)
+		}
+		t.timeout = timeout
+	}
+	return nil
+}
+
+// loadSmokeTests returns the smoke tests declared in the smokeTestsFile of
+// basePath.
+func loadSmokeTests(basePath string) ([]*smokeTest, error) {
+	data, err := ioutil.ReadFile(path.Join(basePath, smokeTestsFile))
+	if err != nil {
+		return nil, err
+	}
+
+	var tests []*smokeTest
+	err = yaml.Unmarshal(data, &tests)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", smokeTestsFile, err)
+	}
+
+	for _, test := range tests {
+		err = test.validate()
+		if err != nil {
+			return nil, fmt.Errorf("invalid %s: %v", smokeTestsFile, err)
+		}
+	}
+	return tests, nil
+}
+
+// smokeTestRunner runs the smoke tests of a cluster.
+type smokeTestRunner struct {
+	logger   *log.Entry
+	basePath string
+	cluster  *api.Cluster
+	dryRun   bool
+	// runJob creates the Job of the manifest in the cluster and waits for
+	// it to complete.
+	runJob func(ctx context.Context, manifest, job string, timeout time.Duration) error
+}
+
+func newSmokeTestRunner(logger *log.Entry, channelConfig *channel.Config, cluster *api.Cluster, kubeconfig *kubernetes.Kubeconfig, dryRun bool) *smokeTestRunner {
+	return &smokeTestRunner{
+		logger:   logger,
+		basePath: path.Join(channelConfig.Path, "cluster"),
+		cluster:  cluster,
+		dryRun:   dryRun,
+		runJob: func(ctx context.Context, manifest, job string, timeout time.Duration) error {
+			return runJobManifest(ctx, logger, kubeconfig, manifest, job, timeout)
+		},
+	}
+}
+
+// run runs all smoke tests of the cluster if they're enabled and records
+// their outcomes in the update summary. All tests are run even if some of
+// them fail, a smokeTestsFailedError lists the failed ones.
+func (r *smokeTestRunner) run(ctx context.Context) error {
+	if r.cluster.ConfigItems[configKeySmokeTests] != "true" {
+		return nil
+	}
+
+	tests, err := loadSmokeTests(r.basePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Errorf("smoke tests are enabled, but the channel has no %s", smokeTestsFile)
+		}
+		return err
+	}
+
+	api.ReportProgress(ctx, api.ProgressStepSmokeTests, "", "Running smoke tests")
+	summary := api.UpdateSummaryFromContext(ctx)
+
+	var failed []string
+	for _, test := range tests {
+		if r.dryRun {
+			r.logger.Infof("Would run smoke test %s", test.Name)
+			continue
+		}
+
+		r.logger.Infof("Running smoke test %s", test.Name)
+		start := time.Now()
+		err := r.runTest(ctx, test)
+		summary.AddSmokeTest(test.Name, time.Since(start), err)
+		if err != nil {
+			r.logger.Errorf("Smoke test %s failed: %v", test.Name, err)
+			failed = append(failed, test.Name)
+		}
+	}
+
+	if len(failed) > 0 {
+		return &smokeTestsFailedError{failed: failed}
+	}
+	return nil
+}
+
+// runTest renders the Job of the smoke test and runs it in the cluster.
+func (r *smokeTestRunner) runTest(ctx context.Context, test *smokeTest) error {
+	manifest, err := renderJobTemplate(r.basePath, smokeTestsFile, test.Job, r.cluster, &smokeTestJobData{Cluster: r.cluster})
+	if err != nil {
+		return err
+	}
+
+	testCtx, cancel := context.WithTimeout(ctx, test.timeout)
+	defer cancel()
+	return r.runJob(testCtx, manifest, test.Job, test.timeout)
+}
@@ -0,0 +1,113 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+func TestLoadSmokeTests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "smoke-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	for _, tc := range []struct {
+		msg   string
+		tests string
+		valid bool
+	}{
+		{
+			msg:   "valid tests",
+			tests: "- {name: dns, job: smoke-tests/dns.yaml, timeout: 2m}\n- {name: networking, job: smoke-tests/networking.yaml}",
+			valid: true,
+		},
+		{
+			msg:   "missing name",
+			tests: "- {job: smoke-tests/dns.yaml}",
+		},
+		{
+			msg:   "missing job",
+			tests: "- {name: dns}",
+		},
+		{
+			msg:   "invalid timeout",
+			tests: "- {name: dns, job: smoke-tests/dns.yaml, timeout: soon}",
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			require.NoError(t, ioutil.WriteFile(path.Join(dir, smokeTestsFile), []byte(tc.tests), 0644))
+
+			tests, err := loadSmokeTests(dir)
+			if !tc.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			require.Len(t, tests, 2)
+			assert.Equal(t, 2*time.Minute, tests[0].timeout)
+			assert.Equal(t, defaultSmokeTestTimeout, tests[1].timeout)
+		})
+	}
+}
+
+func TestRunSmokeTests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "smoke-tests")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	basePath := path.Join(dir, "cluster")
+	require.NoError(t, os.MkdirAll(path.Join(basePath, "smoke-tests"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(basePath, smokeTestsFile), []byte(`
+- name: dns
+  job: smoke-tests/dns.yaml
+- name: networking
+  job: smoke-tests/networking.yaml
+`), 0644))
+	for _, name := range []string{"dns", "networking"} {
+		require.NoError(t, ioutil.WriteFile(path.Join(basePath, "smoke-tests", name+".yaml"), []byte("kind: Job\nmetadata:\n  name: "+name+"-{{ .Cluster.Alias }}\n"), 0644))
+	}
+
+	cluster := &api.Cluster{Alias: "kube-1", ConfigItems: map[string]string{}}
+	runner := newSmokeTestRunner(log.WithField("test", true), &channel.Config{Path: dir}, cluster, nil, false)
+
+	var manifests []string
+	runner.runJob = func(ctx context.Context, manifest, job string, timeout time.Duration) error {
+		manifests = append(manifests, manifest)
+		if strings.Contains(manifest, "networking") {
+			return errors.New("job timed out")
+		}
+		return nil
+	}
+
+	// smoke tests are only run if they're enabled.
+	require.NoError(t, runner.run(context.Background()))
+	assert.Empty(t, manifests)
+
+	cluster.ConfigItems[configKeySmokeTests] = "true"
+	summary := api.NewUpdateSummary(nil)
+	err = runner.run(api.WithUpdateSummary(context.Background(), summary))
+	require.Error(t, err)
+	assert.Equal(t, "smoke tests failed: networking", err.Error())
+	assert.Equal(t, []string{"kind: Job\nmetadata:\n  name: dns-kube-1\n", "kind: Job\nmetadata:\n  name: networking-kube-1\n"}, manifests)
+
+	require.Len(t, summary.SmokeTests, 2)
+	assert.Equal(t, api.UpdateOutcomeSucceeded, summary.SmokeTests[0].Outcome)
+	assert.Equal(t, api.UpdateOutcomeFailed, summary.SmokeTests[1].Outcome)
+	assert.Equal(t, "job timed out", summary.SmokeTests[1].Error)
+
+	// enabled smoke tests require the tests of the channel.
+	require.NoError(t, os.Remove(path.Join(basePath, smokeTestsFile)))
+	assert.Error(t, runner.run(context.Background()))
+}
@@ -0,0 +1,133 @@
+package provisioner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	spotInterruptionQueueLogicalID       = "SpotInterruptionQueue"
+	spotInterruptionQueuePolicyLogicalID = "SpotInterruptionQueuePolicy"
+	spotInterruptionRuleLogicalID        = "SpotInterruptionRule"
+	spotInterruptionPolicyLogicalID      = "SpotInterruptionQueueConsumerPolicy"
+	// spotInterruptionMessageRetention is the retention of the queue
+	// messages in seconds. Interruption warnings are issued two minutes
+	// before the interruption, so older messages are useless.
+	spotInterruptionMessageRetention = 300
+)
+
+// spotInterruptionEvents are the EventBridge detail types the node
+// termination handler reacts to.
+var spotInterruptionEvents = []string{
+	"EC2 Spot Instance Interruption Warning",
+	"EC2 Instance Rebalance Recommendation",
+}
+
+// spotInterruptionQueue describes the SQS queue receiving the spot
+// interruption events of a node pool.
+type spotInterruptionQueue struct {
+	Name string
+	ARN  string
+	URL  string
+}
+
+// newSpotInterruptionQueue returns the spot interruption queue of a node
+// pool. The name is derived from the stack and node pool names, such that the
+// ARN and URL are known before the stack is created.
+func newSpotInterruptionQueue(stackName string, cluster *api.Cluster, nodePool *api.NodePool) *spotInterruptionQueue {
+	name := fmt.Sprintf("%s-%s-spot-interruptions", stackName, nodePool.Name)
+	account := strings.TrimPrefix(cluster.InfrastructureAccount, "aws:")
+	return &spotInterruptionQueue{
+		Name: name,
+		ARN:  fmt.Sprintf("arn:aws:sqs:%s:%s:%s", cluster.Region, account, name),
+		URL:  fmt.Sprintf("https://sqs.%s.amazonaws.com/%s/%s", cluster.Region, account, name),
+	}
+}
+
+// addSpotInterruptionResources adds the SQS queue and the EventBridge rule
+// forwarding the spot interruption events of the region to the queue to the
+// stack template. The node termination handler consumes the queue to drain
+// nodes before they are interrupted. EventBridge can't filter the events by
+// cluster, so the queue only accepts messages from the rule of the stack and
+// only the IAM role of the node pool is allowed to consume them. The handler
+// ignores events of instances which aren't part of the cluster.
+func addSpotInterruptionResources(stackTemplate []byte, queue *spotInterruptionQueue, nodePool *api.NodePool) ([]byte, error) {
+	return modifyStackResources(stackTemplate, func(resources map[string]interface{}) error {
+		roleLogicalID, err := nodePoolIAMRoleLogicalID(resources, nodePool)
+		if err != nil {
+			return err
+		}
+
+		queueRef := map[string]interface{}{"Ref": spotInterruptionQueueLogicalID}
+		queueARN := map[string]interface{}{"Fn::GetAtt": []string{spotInterruptionQueueLogicalID, "Arn"}}
+		ruleARN := map[string]interface{}{"Fn::GetAtt": []string{spotInterruptionRuleLogicalID, "Arn"}}
+
+		resources[spotInterruptionQueueLogicalID] = map[string]interface{}{
+			"Type": "AWS::SQS::Queue",
+			"Properties": map[string]interface{}{
+				"QueueName":              queue.Name,
+				"MessageRetentionPeriod": spotInterruptionMessageRetention,
+			},
+		}
+
+		resources[spotInterruptionQueuePolicyLogicalID] = map[string]interface{}{
+			"Type": "AWS::SQS::QueuePolicy",
+			"Properties": map[string]interface{}{
+				"Queues": []interface{}{queueRef},
+				"PolicyDocument": map[string]interface{}{
+					"Version": "2012-10-17",
+					"Statement": []interface{}{
+						map[string]interface{}{
+							"Effect":    "Allow",
+							"Principal": map[string]interface{}{"Service": []string{"events.amazonaws.com"}},
+							"Action":    "sqs:SendMessage",
+							"Resource":  queueARN,
+							"Condition": map[string]interface{}{
+								"ArnEquals": map[string]interface{}{"aws:SourceArn": ruleARN},
+							},
+						},
+					},
+				},
+			},
+		}
+
+		resources[spotInterruptionPolicyLogicalID] = map[string]interface{}{
+			"Type": "AWS::IAM::Policy",
+			"Properties": map[string]interface{}{
+				"PolicyName": queue.Name,
+				"Roles":      []interface{}{map[string]interface{}{"Ref": roleLogicalID}},
+				"PolicyDocument": map[string]interface{}{
+					"Version": "2012-10-17",
+					"Statement": []interface{}{
+						map[string]interface{}{
+							"Effect":   "Allow",
+							"Action":   []string{"sqs:ReceiveMessage", "sqs:DeleteMessage", "sqs:GetQueueAttributes"},
+							"Resource": queueARN,
+						},
+					},
+				},
+			},
+		}
+
+		resources[spotInterruptionRuleLogicalID] = map[string]interface{}{
+			"Type": "AWS::Events::Rule",
+			"Properties": map[string]interface{}{
+				"Description": fmt.Sprintf("Forward spot interruption events to %s", queue.Name),
+				"EventPattern": map[string]interface{}{
+					"source":      []string{"aws.ec2"},
+					"detail-type": spotInterruptionEvents,
+				},
+				"Targets": []interface{}{
+					map[string]interface{}{
+						"Id":  spotInterruptionQueueLogicalID,
+						"Arn": queueARN,
+					},
+				},
+			},
+		}
+
+		return nil
+	})
+}
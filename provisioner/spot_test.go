@@ -0,0 +1,91 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const testSpotStackTemplate = `{
+  "Resources": {
+    "WorkerAutoScaling": {
+      "Type": "AWS::AutoScaling::AutoScalingGroup",
+      "Properties": {
+        "LaunchConfigurationName": {"Ref": "WorkerLaunchConfiguration"},
+        "Tags": [{"Key": "NodePool", "Value": "worker-default"}]
+      }
+    },
+    "WorkerLaunchConfiguration": {
+      "Type": "AWS::AutoScaling::LaunchConfiguration",
+      "Properties": {"IamInstanceProfile": {"Ref": "WorkerInstanceProfile"}}
+    },
+    "WorkerInstanceProfile": {
+      "Type": "AWS::IAM::InstanceProfile",
+      "Properties": {"Roles": [{"Ref": "WorkerIAMRole"}]}
+    },
+    "WorkerIAMRole": {
+      "Type": "AWS::IAM::Role"
+    }
+  }
+}`
+
+func TestNewSpotInterruptionQueue(t *testing.T) {
+	cluster := &api.Cluster{
+		InfrastructureAccount: "aws:123456789012",
+		Region:                "eu-central-1",
+	}
+
+	queue := newSpotInterruptionQueue("kube-1", cluster, &api.NodePool{Name: "worker-default"})
+	assert.Equal(t, "kube-1-worker-default-spot-interruptions", queue.Name)
+	assert.Equal(t, "arn:aws:sqs:eu-central-1:123456789012:kube-1-worker-default-spot-interruptions", queue.ARN)
+	assert.Equal(t, "https://sqs.eu-central-1.amazonaws.com/123456789012/kube-1-worker-default-spot-interruptions", queue.URL)
+}
+
+func TestAddSpotInterruptionResources(t *testing.T) {
+	queue := &spotInterruptionQueue{Name: "kube-1-worker-default-spot-interruptions"}
+
+	output, err := addSpotInterruptionResources([]byte(testSpotStackTemplate), queue, &api.NodePool{Name: "worker-default"})
+	require.NoError(t, err)
+
+	var template struct {
+		Resources map[string]struct {
+			Type       string
+			Properties map[string]interface{}
+		}
+	}
+	require.NoError(t, json.Unmarshal(output, &template))
+	require.Len(t, template.Resources, 8)
+
+	assert.Equal(t, "AWS::SQS::Queue", template.Resources[spotInterruptionQueueLogicalID].Type)
+	assert.Equal(t, queue.Name, template.Resources[spotInterruptionQueueLogicalID].Properties["QueueName"])
+	assert.Equal(t, "AWS::SQS::QueuePolicy", template.Resources[spotInterruptionQueuePolicyLogicalID].Type)
+	queuePolicy, err := json.Marshal(template.Resources[spotInterruptionQueuePolicyLogicalID].Properties["PolicyDocument"])
+	require.NoError(t, err)
+	assert.Contains(t, string(queuePolicy), `"Condition":{"ArnEquals":{"aws:SourceArn":{"Fn::GetAtt":["SpotInterruptionRule","Arn"]}}}`)
+	assert.NotContains(t, string(queuePolicy), "sqs.amazonaws.com")
+
+	consumerPolicy := template.Resources[spotInterruptionPolicyLogicalID]
+	assert.Equal(t, "AWS::IAM::Policy", consumerPolicy.Type)
+	assert.Equal(t, []interface{}{map[string]interface{}{"Ref": "WorkerIAMRole"}}, consumerPolicy.Properties["Roles"])
+	consumerPolicyDocument, err := json.Marshal(consumerPolicy.Properties["PolicyDocument"])
+	require.NoError(t, err)
+	assert.Contains(t, string(consumerPolicyDocument), `"Action":["sqs:ReceiveMessage","sqs:DeleteMessage","sqs:GetQueueAttributes"]`)
+
+	rule := template.Resources[spotInterruptionRuleLogicalID]
+	assert.Equal(t, "AWS::Events::Rule", rule.Type)
+	assert.Equal(t, map[string]interface{}{
+		"source":      []interface{}{"aws.ec2"},
+		"detail-type": []interface{}{"EC2 Spot Instance Interruption Warning", "EC2 Instance Rebalance Recommendation"},
+	}, rule.Properties["EventPattern"])
+
+	_, err = addSpotInterruptionResources([]byte(`{}`), queue, &api.NodePool{Name: "worker-default"})
+	assert.Error(t, err)
+
+	// the role of the node pool has to be known.
+	_, err = addSpotInterruptionResources([]byte(testScheduleStackTemplate), queue, &api.NodePool{Name: "worker-default"})
+	assert.Error(t, err)
+}
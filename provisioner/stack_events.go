@@ -0,0 +1,128 @@
+package provisioner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+const (
+	resourceTypeStack = "AWS::CloudFormation::Stack"
+	maxFailedEvents   = 10
+)
+
+// stackFailedError is returned when waiting for a stack fails. It describes
+// the failed resources of the last stack operation, such that the cause of
+// the failure is visible without looking up the stack events.
+type stackFailedError struct {
+	err    error
+	events []*cloudformation.StackEvent
+}
+
+func (e *stackFailedError) Error() string {
+	if len(e.events) == 0 {
+		return e.err.Error()
+	}
+
+	failures := make([]string, 0, len(e.events))
+	for _, event := range e.events {
+		failures = append(failures, formatStackEvent(event))
+	}
+	return fmt.Sprintf("%v: %s", e.err, strings.Join(failures, "; "))
+}
+
+// Cause returns the error describing the status of the stack.
+func (e *stackFailedError) Cause() error {
+	return e.err
+}
+
+// formatStackEvent returns the logical ID, status and status reason of a
+// stack event.
+func formatStackEvent(event *cloudformation.StackEvent) string {
+	return fmt.Sprintf("%s %s: %s", aws.StringValue(event.LogicalResourceId), aws.StringValue(event.ResourceStatus), aws.StringValue(event.ResourceStatusReason))
+}
+
+// stackFailed returns a stackFailedError for the stack including its failed
+// events. Errors fetching the events are logged and the original error is
+// returned.
+func (a *awsAdapter) stackFailed(stackName string, err error) error {
+	events, eventsErr := a.failedStackEvents(stackName)
+	if eventsErr != nil {
+		a.logger.Warnf("Failed to get events of stack %s: %v", stackName, eventsErr)
+		return err
+	}
+
+	for _, event := range events {
+		a.logger.Errorf("Stack %s: %s", stackName, formatStackEvent(event))
+	}
+
+	return &stackFailedError{
+		err:    err,
+		events: events,
+	}
+}
+
+// failedStackEvents returns the failed events of the last operation of the
+// stack, oldest first. The events are paged through until the start of the
+// operation, such that the causing failures of operations with many events
+// aren't missed. At most maxFailedEvents are returned.
+func (a *awsAdapter) failedStackEvents(stackName string) ([]*cloudformation.StackEvent, error) {
+	params := &cloudformation.DescribeStackEventsInput{
+		StackName: aws.String(stackName),
+	}
+
+	// events are ordered newest first.
+	var failed []*cloudformation.StackEvent
+	for {
+		resp, err := a.cloudformationClient.DescribeStackEvents(params)
+		if err != nil {
+			return nil, err
+		}
+
+		started := false
+		for _, event := range resp.StackEvents {
+			if isStackOperationStart(stackName, event) {
+				started = true
+				break
+			}
+
+			if strings.HasSuffix(aws.StringValue(event.ResourceStatus), "_FAILED") && aws.StringValue(event.ResourceStatusReason) != "" {
+				failed = append(failed, event)
+			}
+		}
+
+		if started || aws.StringValue(resp.NextToken) == "" {
+			break
+		}
+		params.NextToken = resp.NextToken
+	}
+
+	// the oldest failures are usually the cause of the later ones.
+	for i, j := 0, len(failed)-1; i < j; i, j = i+1, j-1 {
+		failed[i], failed[j] = failed[j], failed[i]
+	}
+
+	if len(failed) > maxFailedEvents {
+		failed = failed[:maxFailedEvents]
+	}
+
+	return failed, nil
+}
+
+// isStackOperationStart returns true if the event marks the start of a
+// create, update or delete of the stack.
+func isStackOperationStart(stackName string, event *cloudformation.StackEvent) bool {
+	if aws.StringValue(event.ResourceType) != resourceTypeStack || aws.StringValue(event.LogicalResourceId) != stackName {
+		return false
+	}
+
+	switch aws.StringValue(event.ResourceStatus) {
+	case cloudformation.ResourceStatusCreateInProgress, cloudformation.ResourceStatusUpdateInProgress, cloudformation.ResourceStatusDeleteInProgress:
+		// stack events of automatic cleanups, e.g. deleting a stack
+		// which failed to create, have the failure as reason instead.
+		return aws.StringValue(event.ResourceStatusReason) == "User Initiated"
+	}
+	return false
+}
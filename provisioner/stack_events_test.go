@@ -0,0 +1,54 @@
+package provisioner
+
+import (
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStackFailed(t *testing.T) {
+	event := func(logicalID, resourceType, status, reason string) *cloudformation.StackEvent {
+		return &cloudformation.StackEvent{
+			LogicalResourceId:    aws.String(logicalID),
+			ResourceType:         aws.String(resourceType),
+			ResourceStatus:       aws.String(status),
+			ResourceStatusReason: aws.String(reason),
+		}
+	}
+
+	stub := &cloudFormationAPIStub{
+		statusMutex: &sync.Mutex{},
+		// events are returned newest first.
+		stackEvents: []*cloudformation.StackEvent{
+			event("kube-1", resourceTypeStack, cloudformation.StackStatusUpdateRollbackComplete, ""),
+			event("WorkerLaunchTemplate", resourceTypeLaunchTemplate, cloudformation.ResourceStatusUpdateFailed, "Resource update cancelled"),
+			event("WorkerASG", "AWS::AutoScaling::AutoScalingGroup", cloudformation.ResourceStatusUpdateFailed, "Invalid instance type m5.huge"),
+			event("WorkerASG", "AWS::AutoScaling::AutoScalingGroup", cloudformation.ResourceStatusUpdateInProgress, ""),
+			event("kube-1", resourceTypeStack, cloudformation.ResourceStatusUpdateInProgress, "User Initiated"),
+			event("MasterASG", "AWS::AutoScaling::AutoScalingGroup", cloudformation.ResourceStatusUpdateFailed, "failure of a previous update"),
+		},
+	}
+	a := &awsAdapter{cloudformationClient: stub, logger: log.WithField("test", true)}
+
+	err := a.stackFailed("kube-1", errUpdateRollbackComplete)
+	assert.Equal(t, "wait for stack failed with UPDATE_ROLLBACK_COMPLETE: WorkerASG UPDATE_FAILED: Invalid instance type m5.huge; WorkerLaunchTemplate UPDATE_FAILED: Resource update cancelled", err.Error())
+	assert.Equal(t, errUpdateRollbackComplete, err.(*stackFailedError).Cause())
+
+	// the events are paged through until the start of the operation.
+	stub.stackEventsPageSize = 2
+	err = a.stackFailed("kube-1", errUpdateRollbackComplete)
+	assert.Equal(t, "wait for stack failed with UPDATE_ROLLBACK_COMPLETE: WorkerASG UPDATE_FAILED: Invalid instance type m5.huge; WorkerLaunchTemplate UPDATE_FAILED: Resource update cancelled", err.Error())
+
+	stub.stackEventsPageSize = 1
+	err = a.stackFailed("kube-1", errUpdateRollbackComplete)
+	assert.Equal(t, "wait for stack failed with UPDATE_ROLLBACK_COMPLETE: WorkerASG UPDATE_FAILED: Invalid instance type m5.huge; WorkerLaunchTemplate UPDATE_FAILED: Resource update cancelled", err.Error())
+
+	// without failed events the status is reported.
+	stub.stackEvents = nil
+	err = a.stackFailed("kube-1", errRollbackComplete)
+	assert.Equal(t, errRollbackComplete.Error(), err.Error())
+}
@@ -0,0 +1,165 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+// stackPollResult is the result of a poll for a single stack.
+type stackPollResult struct {
+	stack *cloudformation.Stack
+	err   error
+}
+
+// stackPoller polls the status of all stacks waited for concurrently with
+// shared DescribeStacks calls. A single stack is described by name while
+// several stacks are batched into one listing of the stacks, such that
+// waiting for many stacks in parallel doesn't multiply the API calls and all
+// waiters observe status changes at the same interval.
+type stackPoller struct {
+	client   cloudFormationAPI
+	interval time.Duration
+	mutex    sync.Mutex
+	waiters  map[string][]chan stackPollResult
+	polling  bool
+}
+
+// newStackPoller initializes a new stackPoller polling at the interval.
+func newStackPoller(client cloudFormationAPI, interval time.Duration) *stackPoller {
+	return &stackPoller{
+		client:   client,
+		interval: interval,
+		waiters:  make(map[string][]chan stackPollResult),
+	}
+}
+
+// describe returns the stack as of the next poll. The first poll happens
+// immediately if no other stack is being polled.
+func (p *stackPoller) describe(ctx context.Context, stackName string) (*cloudformation.Stack, error) {
+	if ctx.Err() != nil {
+		return nil, errTimeoutExceeded
+	}
+
+	result := make(chan stackPollResult, 1)
+
+	p.mutex.Lock()
+	p.waiters[stackName] = append(p.waiters[stackName], result)
+	if !p.polling {
+		p.polling = true
+		go p.poll()
+	}
+	p.mutex.Unlock()
+
+	select {
+	case <-ctx.Done():
+		p.removeWaiter(stackName, result)
+		return nil, errTimeoutExceeded
+	case r := <-result:
+		return r.stack, r.err
+	}
+}
+
+// removeWaiter removes a waiter which stopped waiting before the next poll.
+func (p *stackPoller) removeWaiter(stackName string, result chan stackPollResult) {
+	p.mutex.Lock()
+	defer p.mutex.Unlock()
+
+	channels := p.waiters[stackName]
+	for i, c := range channels {
+		if c == result {
+			channels = append(channels[:i], channels[i+1:]...)
+			break
+		}
+	}
+
+	if len(channels) == 0 {
+		delete(p.waiters, stackName)
+	} else {
+		p.waiters[stackName] = channels
+	}
+}
+
+// poll polls the stacks of all waiters until there are no waiters left.
+func (p *stackPoller) poll() {
+	for {
+		p.mutex.Lock()
+		waiters := p.waiters
+		if len(waiters) == 0 {
+			p.polling = false
+			p.mutex.Unlock()
+			return
+		}
+		p.waiters = make(map[string][]chan stackPollResult)
+		p.mutex.Unlock()
+
+		results := p.describeStacks(waiters)
+		for stackName, channels := range waiters {
+			for _, result := range channels {
+				result <- results[stackName]
+			}
+		}
+
+		time.Sleep(p.interval)
+	}
+}
+
+// describeStacks describes the stacks of the waiters. Stacks missing from
+// the listing get the same error as when describing them by name.
+func (p *stackPoller) describeStacks(waiters map[string][]chan stackPollResult) map[string]stackPollResult {
+	results := make(map[string]stackPollResult, len(waiters))
+
+	if len(waiters) == 1 {
+		for stackName := range waiters {
+			stack, err := describeStack(p.client, stackName)
+			results[stackName] = stackPollResult{stack: stack, err: err}
+		}
+		return results
+	}
+
+	err := p.client.DescribeStacksPages(&cloudformation.DescribeStacksInput{}, func(resp *cloudformation.DescribeStacksOutput, lastPage bool) bool {
+		for _, stack := range resp.Stacks {
+			stackName := aws.StringValue(stack.StackName)
+			if _, ok := waiters[stackName]; ok {
+				results[stackName] = stackPollResult{stack: stack}
+			}
+		}
+		return true
+	})
+
+	for stackName := range waiters {
+		if err != nil {
+			results[stackName] = stackPollResult{err: err}
+			continue
+		}
+
+		if _, ok := results[stackName]; !ok {
+			results[stackName] = stackPollResult{
+				err: awserr.New("ValidationError", fmt.Sprintf("Stack with id %s does not exist", stackName), nil),
+			}
+		}
+	}
+
+	return results
+}
+
+// describeStack describes a single stack by name.
+func describeStack(client cloudFormationAPI, stackName string) (*cloudformation.Stack, error) {
+	params := &cloudformation.DescribeStacksInput{
+		StackName: aws.String(stackName),
+	}
+	resp, err := client.DescribeStacks(params)
+	if err != nil {
+		return nil, err
+	}
+	//we expect only one stack
+	if len(resp.Stacks) != 1 {
+		return nil, fmt.Errorf("unexpected response, got %d, expected 1 stack", len(resp.Stacks))
+	}
+	return resp.Stacks[0], nil
+}
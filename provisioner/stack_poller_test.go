@@ -0,0 +1,103 @@
+package provisioner
+
+import (
+	"context"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type stackListingStub struct {
+	cloudFormationAPI
+	mutex     sync.Mutex
+	stacks    []*cloudformation.Stack
+	listings  int
+	describes int
+}
+
+func (c *stackListingStub) DescribeStacks(input *cloudformation.DescribeStacksInput) (*cloudformation.DescribeStacksOutput, error) {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.describes++
+	for _, stack := range c.stacks {
+		if aws.StringValue(stack.StackName) == aws.StringValue(input.StackName) {
+			return &cloudformation.DescribeStacksOutput{Stacks: []*cloudformation.Stack{stack}}, nil
+		}
+	}
+	return &cloudformation.DescribeStacksOutput{}, nil
+}
+
+func (c *stackListingStub) DescribeStacksPages(input *cloudformation.DescribeStacksInput, fn func(resp *cloudformation.DescribeStacksOutput, lastPage bool) bool) error {
+	c.mutex.Lock()
+	defer c.mutex.Unlock()
+	c.listings++
+	fn(&cloudformation.DescribeStacksOutput{Stacks: c.stacks[:1]}, false)
+	fn(&cloudformation.DescribeStacksOutput{Stacks: c.stacks[1:]}, true)
+	return nil
+}
+
+func TestStackPollerBatchesStacks(t *testing.T) {
+	stub := &stackListingStub{
+		stacks: []*cloudformation.Stack{
+			{StackName: aws.String("a"), StackStatus: aws.String(cloudformation.StackStatusCreateComplete)},
+			{StackName: aws.String("b"), StackStatus: aws.String(cloudformation.StackStatusUpdateComplete)},
+			{StackName: aws.String("unrelated"), StackStatus: aws.String(cloudformation.StackStatusUpdateComplete)},
+		},
+	}
+	poller := newStackPoller(stub, 10*time.Millisecond)
+
+	// don't poll until all waiters are registered.
+	poller.polling = true
+
+	results := make(map[string]stackPollResult)
+	var resultsMutex sync.Mutex
+	var wg sync.WaitGroup
+	for _, name := range []string{"a", "b", "missing"} {
+		wg.Add(1)
+		go func(name string) {
+			defer wg.Done()
+			stack, err := poller.describe(context.Background(), name)
+			resultsMutex.Lock()
+			results[name] = stackPollResult{stack: stack, err: err}
+			resultsMutex.Unlock()
+		}(name)
+	}
+
+	for registered := 0; registered < 3; time.Sleep(time.Millisecond) {
+		poller.mutex.Lock()
+		registered = len(poller.waiters)
+		poller.mutex.Unlock()
+	}
+	go poller.poll()
+	wg.Wait()
+
+	assert.Equal(t, 1, stub.listings)
+	assert.Equal(t, 0, stub.describes)
+	require.NoError(t, results["a"].err)
+	assert.Equal(t, cloudformation.StackStatusCreateComplete, aws.StringValue(results["a"].stack.StackStatus))
+	require.NoError(t, results["b"].err)
+	assert.Equal(t, cloudformation.StackStatusUpdateComplete, aws.StringValue(results["b"].stack.StackStatus))
+	assert.True(t, isDoesNotExistsErr(results["missing"].err))
+
+	// a single stack is described by name.
+	stack, err := poller.describe(context.Background(), "b")
+	require.NoError(t, err)
+	assert.Equal(t, "b", aws.StringValue(stack.StackName))
+	assert.Equal(t, 1, stub.describes)
+}
+
+func TestStackPollerCancelled(t *testing.T) {
+	poller := newStackPoller(&stackListingStub{}, time.Hour)
+	poller.polling = true
+
+	ctx, cancel := context.WithCancel(context.Background())
+	go cancel()
+	_, err := poller.describe(ctx, "a")
+	assert.Equal(t, errTimeoutExceeded, err)
+	assert.Empty(t, poller.waiters)
+}
@@ -0,0 +1,179 @@
+package provisioner
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"sort"
+	"text/template"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// stackTemplateSuffix is the suffix of the stack definition template
+	// rendered into the stack definition passed to senza.
+	stackTemplateSuffix = ".tmpl"
+
+	// the stack definition templates use their own delimiters, such that
+	// the senza arguments, e.g. {{Arguments.StackName}}, are kept as is.
+	stackTemplateLeftDelim  = "[["
+	stackTemplateRightDelim = "]]"
+)
+
+// templateSubnet is a subnet of the cluster as available to the stack
+// definition templates.
+type templateSubnet struct {
+	ID               string
+	AvailabilityZone string
+	CIDR             string
+	Tags             map[string]string
+}
+
+// stackTemplateData is the data the stack definition templates are rendered
+// with. The subnets are sorted by availability zone and ID, the subnets of
+// the node pools are the ones they're pinned to, or all subnets. Values are
+// the typed config items of the cluster, e.g. [[ range .Values.zones ]].
+type stackTemplateData struct {
+	Cluster           *api.Cluster
+	Values            Values
+	Subnets           []*templateSubnet
+	AvailabilityZones []string
+	MasterSubnets     []*templateSubnet
+	WorkerSubnets     []*templateSubnet
+}
+
+// newStackTemplateData returns the data of the stack definition templates of
+// the cluster with the subnets of its VPC.
+func newStackTemplateData(cluster *api.Cluster, subnets []*ec2.Subnet, masterPool, workerPool *api.NodePool) (*stackTemplateData, error) {
+	data := &stackTemplateData{Cluster: cluster, Values: configValues(cluster.ConfigItems, cluster.ConfigValues)}
+
+	zones := make(map[string]bool)
+	for _, subnet := range subnets {
+		tags := make(map[string]string, len(subnet.Tags))
+		for _, tag := range subnet.Tags {
+			tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+
+		zone := aws.StringValue(subnet.AvailabilityZone)
+		data.Subnets = append(data.Subnets, &templateSubnet{
+			ID:               aws.StringValue(subnet.SubnetId),
+			AvailabilityZone: zone,
+			CIDR:             aws.StringValue(subnet.CidrBlock),
+			Tags:             tags,
+		})
+
+		if !zones[zone] {
+			zones[zone] = true
+			data.AvailabilityZones = append(data.AvailabilityZones, zone)
+		}
+	}
+
+	sort.Slice(data.Subnets, func(i, j int) bool {
+		if data.Subnets[i].AvailabilityZone != data.Subnets[j].AvailabilityZone {
+			return data.Subnets[i].AvailabilityZone < data.Subnets[j].AvailabilityZone
+		}
+		return data.Subnets[i].ID < data.Subnets[j].ID
+	})
+	sort.Strings(data.AvailabilityZones)
+
+	var err error
+	data.MasterSubnets, err = templateNodePoolSubnets(data.Subnets, subnets, masterPool)
+	if err != nil {
+		return nil, err
+	}
+
+	data.WorkerSubnets, err = templateNodePoolSubnets(data.Subnets, subnets, workerPool)
+	if err != nil {
+		return nil, err
+	}
+
+	return data, nil
+}
+
+// templateNodePoolSubnets returns the subnets the node pool is pinned to,
+// or all subnets if it isn't pinned.
+func templateNodePoolSubnets(all []*templateSubnet, subnets []*ec2.Subnet, nodePool *api.NodePool) ([]*templateSubnet, error) {
+	if !hasSubnetSelector(nodePool) {
+		return all, nil
+	}
+
+	ids, err := nodePoolSubnets(subnets, nodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	pinned := make(map[string]bool, len(ids))
+	for _, id := range ids {
+		pinned[id] = true
+	}
+
+	var result []*templateSubnet
+	for _, subnet := range all {
+		if pinned[subnet.ID] {
+			result = append(result, subnet)
+		}
+	}
+	return result, nil
+}
+
+// renderStackTemplate renders a stack definition template with the data.
+func renderStackTemplate(name, content string, data *stackTemplateData) (string, error) {
+	t, err := template.New(name).Delims(stackTemplateLeftDelim, stackTemplateRightDelim).Option("missingkey=error").Parse(content)
+	if err != nil {
+		return "", err
+	}
+
+	var out bytes.Buffer
+	err = t.Execute(&out, data)
+	if err != nil {
+		return "", err
+	}
+	return out.String(), nil
+}
+
+// renderStackDefinition renders the template of the stack definition, if the
+// channel has one next to it, into a temporary file and returns its path.
+// The path of the stack definition is returned as is otherwise. The caller
+// must remove the temporary file.
+func (a *awsAdapter) renderStackDefinition(stackDefinitionPath string, cluster *api.Cluster, masterPool, workerPool *api.NodePool) (string, error) {
+	templatePath := stackDefinitionPath + stackTemplateSuffix
+	content, err := ioutil.ReadFile(templatePath)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return stackDefinitionPath, nil
+		}
+		return "", err
+	}
+
+	subnets, err := a.GetSubnets()
+	if err != nil {
+		return "", err
+	}
+
+	data, err := newStackTemplateData(cluster, subnets, masterPool, workerPool)
+	if err != nil {
+		return "", err
+	}
+
+	rendered, err := renderStackTemplate(templatePath, string(content), data)
+	if err != nil {
+		return "", fmt.Errorf("failed to render %s: %v", templatePath, err)
+	}
+
+	f, err := ioutil.TempFile("", "senza-definition")
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	_, err = f.WriteString(rendered)
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
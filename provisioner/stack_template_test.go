@@ -0,0 +1,62 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestRenderStackTemplate(t *testing.T) {
+	subnets := []*ec2.Subnet{
+		testSubnet("subnet-b", "eu-central-1b", map[string]string{"storage": "ebs-heavy"}),
+		testSubnet("subnet-a2", "eu-central-1a", nil),
+		testSubnet("subnet-a1", "eu-central-1a", map[string]string{"storage": "ebs-heavy"}),
+	}
+	for i, subnet := range subnets {
+		subnet.CidrBlock = aws.String([]string{"172.31.0.0/20", "172.31.16.0/20", "172.31.32.0/20"}[i])
+	}
+
+	cluster := &api.Cluster{Alias: "kube-1", ConfigItems: map[string]string{"spot_zones": "[eu-central-1a]", "ha": "true"}}
+	masterPool := &api.NodePool{Name: "master"}
+	workerPool := &api.NodePool{Name: "worker", SubnetTags: map[string]string{"storage": "ebs-heavy"}}
+
+	data, err := newStackTemplateData(cluster, subnets, masterPool, workerPool)
+	require.NoError(t, err)
+	assert.Equal(t, []string{"eu-central-1a", "eu-central-1b"}, data.AvailabilityZones)
+	assert.Len(t, data.MasterSubnets, 3)
+
+	rendered, err := renderStackTemplate("senza-definition.yaml.tmpl", `StackName: "{{Arguments.StackName}}"
+Cluster: [[.Cluster.Alias]]
+[[- if .Values.ha]]
+HA: [[range .Values.spot_zones]][[.]][[end]]
+[[- end]]
+[[- range .WorkerSubnets]]
+Worker[[.AvailabilityZone]]: [[.ID]] [[.CIDR]] [[index .Tags "storage"]]
+[[- end]]
+[[- range .Subnets]]
+Subnet: [[.ID]]
+[[- end]]
+`, data)
+	require.NoError(t, err)
+	assert.Equal(t, `StackName: "{{Arguments.StackName}}"
+Cluster: kube-1
+HA: eu-central-1a
+Workereu-central-1a: subnet-a1 172.31.32.0/20 ebs-heavy
+Workereu-central-1b: subnet-b 172.31.0.0/20 ebs-heavy
+Subnet: subnet-a1
+Subnet: subnet-a2
+Subnet: subnet-b
+`, rendered)
+
+	_, err = renderStackTemplate("senza-definition.yaml.tmpl", "[[.Missing]]", data)
+	assert.Error(t, err)
+
+	workerPool.AvailabilityZones = []string{"eu-central-1c"}
+	_, err = newStackTemplateData(cluster, subnets, masterPool, workerPool)
+	assert.Error(t, err)
+}
@@ -1,6 +1,8 @@
 package provisioner
 
 import (
+	"context"
+
 	log "github.com/sirupsen/logrus"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
@@ -15,20 +17,46 @@ func NewStdoutProvisioner() Provisioner {
 }
 
 // Provision mocks provisioning a cluster.
-func (p *stdoutProvisioner) Provision(cluster *api.Cluster, channelConfig *channel.Config) error {
+func (p *stdoutProvisioner) Provision(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
 	log.Infof("stdout: Provisioning cluster %s.", cluster.ID)
 
 	return nil
 }
 
 // Decommission mocks decommissioning a cluster.
-func (p *stdoutProvisioner) Decommission(cluster *api.Cluster, channelConfig *channel.Config) error {
+func (p *stdoutProvisioner) Decommission(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
 	log.Infof("stdout: Decommissioning cluster %s.", cluster.ID)
 
 	return nil
 }
 
+// Suspend mocks suspending a cluster.
+func (p *stdoutProvisioner) Suspend(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	log.Infof("stdout: Suspending cluster %s.", cluster.ID)
+
+	return nil
+}
+
+// Resume mocks resuming a cluster.
+func (p *stdoutProvisioner) Resume(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	log.Infof("stdout: Resuming cluster %s.", cluster.ID)
+
+	return nil
+}
+
+// Reconcile mocks reconciling an up to date cluster.
+func (p *stdoutProvisioner) Reconcile(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	log.Infof("stdout: Reconciling cluster %s.", cluster.ID)
+
+	return nil
+}
+
 // Version mocks geting the version based on cluster resource and channel config.
 func (p *stdoutProvisioner) Version(cluster *api.Cluster, channelConfig *channel.Config) (string, error) {
 	return "", nil
 }
+
+// Preflight mocks the preflight checks of a cluster.
+func (p *stdoutProvisioner) Preflight(cluster *api.Cluster, channelConfig *channel.Config) (*PreflightReport, error) {
+	return &PreflightReport{}, nil
+}
@@ -0,0 +1,83 @@
+package provisioner
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+const defaultStorageFilesystem = "ext4"
+
+// stickyVolumeDeviceRegexp matches the device names EBS volumes can be
+// attached as without conflicting with the root volume.
+var stickyVolumeDeviceRegexp = regexp.MustCompile(`^/dev/(sd|xvd)[f-p]$`)
+
+// storageFilesystems are the filesystems the storage of nodes can be
+// formatted with.
+var storageFilesystems = map[string]bool{
+	"ext4": true,
+	"xfs":  true,
+}
+
+// validateStorage validates the storage of the nodes of a node pool: either
+// sticky EBS volumes or a RAID of the instance store volumes mounted at an
+// absolute path.
+func validateStorage(nodePool *api.NodePool) error {
+	storage := nodePool.Storage
+	if storage == nil {
+		return nil
+	}
+
+	if storage.StickyVolumes == storage.InstanceStoreRAID {
+		return fmt.Errorf("storage of node pool %s must use either sticky_volumes or instance_store_raid", nodePool.Name)
+	}
+
+	if !path.IsAbs(storage.MountPath) || path.Clean(storage.MountPath) == "/" {
+		return fmt.Errorf("invalid storage mount_path '%s' of node pool %s, must be an absolute path", storage.MountPath, nodePool.Name)
+	}
+
+	if storage.Filesystem != "" && !storageFilesystems[storage.Filesystem] {
+		return fmt.Errorf("invalid storage filesystem %s of node pool %s, must be ext4 or xfs", storage.Filesystem, nodePool.Name)
+	}
+
+	if storage.Device != "" {
+		if !storage.StickyVolumes {
+			return fmt.Errorf("storage device of node pool %s requires sticky_volumes", nodePool.Name)
+		}
+		if !stickyVolumeDeviceRegexp.MatchString(storage.Device) {
+			return fmt.Errorf("invalid storage device %s of node pool %s, must be /dev/sd[f-p] or /dev/xvd[f-p]", storage.Device, nodePool.Name)
+		}
+	}
+
+	return nil
+}
+
+// storageUserDataConfig adds the storage of the nodes of a node pool to its
+// userData config, used to attach and mount the volumes while booting.
+func storageUserDataConfig(config map[string]string, nodePool *api.NodePool) {
+	storage := nodePool.Storage
+	if storage == nil {
+		return
+	}
+
+	config["STORAGE_MOUNT_PATH"] = storage.MountPath
+	config["STORAGE_FILESYSTEM"] = storage.Filesystem
+	if storage.Filesystem == "" {
+		config["STORAGE_FILESYSTEM"] = defaultStorageFilesystem
+	}
+
+	if storage.StickyVolumes {
+		config["STICKY_VOLUME_TAG"] = updatestrategy.StickyVolumeTag
+		config["STICKY_VOLUME_DEVICE"] = storage.Device
+		if storage.Device == "" {
+			config["STICKY_VOLUME_DEVICE"] = updatestrategy.DefaultStickyVolumeDevice
+		}
+	}
+
+	if storage.InstanceStoreRAID {
+		config["INSTANCE_STORE_RAID"] = "true"
+	}
+}
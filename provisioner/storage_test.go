@@ -0,0 +1,97 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/updatestrategy"
+)
+
+func TestValidateStorage(t *testing.T) {
+	for _, tc := range []struct {
+		msg     string
+		storage *api.NodeStorage
+		valid   bool
+	}{
+		{
+			msg:   "no storage",
+			valid: true,
+		},
+		{
+			msg:     "sticky volumes",
+			storage: &api.NodeStorage{StickyVolumes: true, Device: "/dev/xvdg", Filesystem: "xfs", MountPath: "/data"},
+			valid:   true,
+		},
+		{
+			msg:     "instance store raid",
+			storage: &api.NodeStorage{InstanceStoreRAID: true, MountPath: "/var/lib/data"},
+			valid:   true,
+		},
+		{
+			msg:     "neither sticky volumes nor raid",
+			storage: &api.NodeStorage{MountPath: "/data"},
+		},
+		{
+			msg:     "sticky volumes and raid",
+			storage: &api.NodeStorage{StickyVolumes: true, InstanceStoreRAID: true, MountPath: "/data"},
+		},
+		{
+			msg:     "no mount path",
+			storage: &api.NodeStorage{StickyVolumes: true},
+		},
+		{
+			msg:     "relative mount path",
+			storage: &api.NodeStorage{StickyVolumes: true, MountPath: "data"},
+		},
+		{
+			msg:     "root mount path",
+			storage: &api.NodeStorage{StickyVolumes: true, MountPath: "/"},
+		},
+		{
+			msg:     "invalid filesystem",
+			storage: &api.NodeStorage{StickyVolumes: true, Filesystem: "btrfs", MountPath: "/data"},
+		},
+		{
+			msg:     "root device",
+			storage: &api.NodeStorage{StickyVolumes: true, Device: "/dev/xvda", MountPath: "/data"},
+		},
+		{
+			msg:     "device without sticky volumes",
+			storage: &api.NodeStorage{InstanceStoreRAID: true, Device: "/dev/xvdf", MountPath: "/data"},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := validateStorage(&api.NodePool{Name: "worker-stateful", Storage: tc.storage})
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestStorageUserDataConfig(t *testing.T) {
+	config := nodePoolUserDataConfig(map[string]string{}, &api.NodePool{
+		Name:    "worker-stateful",
+		Storage: &api.NodeStorage{StickyVolumes: true, MountPath: "/data"},
+	})
+	assert.Equal(t, "/data", config["STORAGE_MOUNT_PATH"])
+	assert.Equal(t, "ext4", config["STORAGE_FILESYSTEM"])
+	assert.Equal(t, updatestrategy.StickyVolumeTag, config["STICKY_VOLUME_TAG"])
+	assert.Equal(t, "/dev/xvdf", config["STICKY_VOLUME_DEVICE"])
+	assert.NotContains(t, config, "INSTANCE_STORE_RAID")
+
+	config = nodePoolUserDataConfig(map[string]string{}, &api.NodePool{
+		Name:    "worker-local",
+		Storage: &api.NodeStorage{InstanceStoreRAID: true, Filesystem: "xfs", MountPath: "/data"},
+	})
+	assert.Equal(t, "xfs", config["STORAGE_FILESYSTEM"])
+	assert.Equal(t, "true", config["INSTANCE_STORE_RAID"])
+	assert.NotContains(t, config, "STICKY_VOLUME_TAG")
+
+	config = nodePoolUserDataConfig(map[string]string{}, &api.NodePool{Name: "worker-default"})
+	assert.NotContains(t, config, "STORAGE_MOUNT_PATH")
+}
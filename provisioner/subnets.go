@@ -0,0 +1,93 @@
+package provisioner
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// hasSubnetSelector returns true if the node pool is pinned to a subset of
+// the subnets of the cluster.
+func hasSubnetSelector(nodePool *api.NodePool) bool {
+	return len(nodePool.AvailabilityZones) > 0 || len(nodePool.SubnetTags) > 0
+}
+
+// validateAvailabilityZones returns an error if an availability zone of the
+// node pool isn't in the region of the cluster.
+func validateAvailabilityZones(cluster *api.Cluster, nodePool *api.NodePool) error {
+	for _, zone := range nodePool.AvailabilityZones {
+		if !strings.HasPrefix(zone, cluster.Region) {
+			return fmt.Errorf("availability zone %s of node pool %s isn't in region %s", zone, nodePool.Name, cluster.Region)
+		}
+	}
+	return nil
+}
+
+// nodePoolSubnets returns the IDs of the subnets matching the availability
+// zones and subnet tags of the node pool, sorted to keep the stack
+// parameters stable. Every availability zone of the node pool must have at
+// least one matching subnet.
+func nodePoolSubnets(subnets []*ec2.Subnet, nodePool *api.NodePool) ([]string, error) {
+	zones := make(map[string]bool, len(nodePool.AvailabilityZones))
+	for _, zone := range nodePool.AvailabilityZones {
+		zones[zone] = false
+	}
+
+	var ids []string
+	for _, subnet := range subnets {
+		zone := aws.StringValue(subnet.AvailabilityZone)
+		if _, ok := zones[zone]; len(zones) > 0 && !ok {
+			continue
+		}
+
+		if !hasSubnetTags(subnet, nodePool.SubnetTags) {
+			continue
+		}
+
+		zones[zone] = true
+		ids = append(ids, aws.StringValue(subnet.SubnetId))
+	}
+
+	for _, zone := range nodePool.AvailabilityZones {
+		if !zones[zone] {
+			return nil, fmt.Errorf("no subnet of node pool %s found in availability zone %s", nodePool.Name, zone)
+		}
+	}
+
+	if len(ids) == 0 {
+		return nil, fmt.Errorf("no subnet of node pool %s found", nodePool.Name)
+	}
+
+	sort.Strings(ids)
+	return ids, nil
+}
+
+// hasSubnetTags returns true if the subnet has all tags.
+func hasSubnetTags(subnet *ec2.Subnet, tags map[string]string) bool {
+	for key, value := range tags {
+		if !hasTag(subnet.Tags, &ec2.Tag{Key: aws.String(key), Value: aws.String(value)}) {
+			return false
+		}
+	}
+	return true
+}
+
+// subnetArgs returns the stack parameter pinning a node pool to its subnets.
+// The parameter is prefixed with the given prefix e.g. 'Master' or 'Worker'.
+// No parameter is returned if the node pool spans all subnets.
+func subnetArgs(prefix string, subnets []*ec2.Subnet, nodePool *api.NodePool) ([]string, error) {
+	if !hasSubnetSelector(nodePool) {
+		return nil, nil
+	}
+
+	ids, err := nodePoolSubnets(subnets, nodePool)
+	if err != nil {
+		return nil, err
+	}
+
+	return []string{fmt.Sprintf("%sSubnets=%s", prefix, strings.Join(ids, ","))}, nil
+}
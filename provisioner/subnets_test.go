@@ -0,0 +1,92 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/ec2"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func testSubnet(id, zone string, tags map[string]string) *ec2.Subnet {
+	subnet := &ec2.Subnet{
+		SubnetId:         aws.String(id),
+		AvailabilityZone: aws.String(zone),
+	}
+	for key, value := range tags {
+		subnet.Tags = append(subnet.Tags, &ec2.Tag{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return subnet
+}
+
+func TestNodePoolSubnets(t *testing.T) {
+	subnets := []*ec2.Subnet{
+		testSubnet("subnet-c", "eu-central-1c", nil),
+		testSubnet("subnet-b", "eu-central-1b", map[string]string{"storage": "ebs-heavy"}),
+		testSubnet("subnet-a", "eu-central-1a", map[string]string{"storage": "ebs-heavy"}),
+	}
+
+	for _, tc := range []struct {
+		msg      string
+		nodePool *api.NodePool
+		expected []string
+	}{
+		{
+			msg:      "availability zones",
+			nodePool: &api.NodePool{Name: "default", AvailabilityZones: []string{"eu-central-1c", "eu-central-1a"}},
+			expected: []string{"subnet-a", "subnet-c"},
+		},
+		{
+			msg:      "subnet tags",
+			nodePool: &api.NodePool{Name: "default", SubnetTags: map[string]string{"storage": "ebs-heavy"}},
+			expected: []string{"subnet-a", "subnet-b"},
+		},
+		{
+			msg:      "availability zones and subnet tags",
+			nodePool: &api.NodePool{Name: "default", AvailabilityZones: []string{"eu-central-1b"}, SubnetTags: map[string]string{"storage": "ebs-heavy"}},
+			expected: []string{"subnet-b"},
+		},
+		{
+			msg:      "availability zone without matching subnet",
+			nodePool: &api.NodePool{Name: "default", AvailabilityZones: []string{"eu-central-1c"}, SubnetTags: map[string]string{"storage": "ebs-heavy"}},
+		},
+		{
+			msg:      "no matching subnet",
+			nodePool: &api.NodePool{Name: "default", SubnetTags: map[string]string{"storage": "local"}},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			ids, err := nodePoolSubnets(subnets, tc.nodePool)
+			if tc.expected == nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, ids)
+		})
+	}
+}
+
+func TestSubnetArgs(t *testing.T) {
+	subnets := []*ec2.Subnet{
+		testSubnet("subnet-b", "eu-central-1b", nil),
+		testSubnet("subnet-a", "eu-central-1a", nil),
+	}
+
+	args, err := subnetArgs("Worker", subnets, &api.NodePool{Name: "worker-default"})
+	require.NoError(t, err)
+	assert.Empty(t, args)
+
+	args, err = subnetArgs("Worker", subnets, &api.NodePool{Name: "worker-default", AvailabilityZones: []string{"eu-central-1a"}})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"WorkerSubnets=subnet-a"}, args)
+}
+
+func TestValidateAvailabilityZones(t *testing.T) {
+	cluster := &api.Cluster{Region: "eu-central-1"}
+	assert.NoError(t, validateAvailabilityZones(cluster, &api.NodePool{Name: "default", AvailabilityZones: []string{"eu-central-1a"}}))
+	assert.Error(t, validateAvailabilityZones(cluster, &api.NodePool{Name: "default", AvailabilityZones: []string{"eu-west-1a"}}))
+}
@@ -0,0 +1,170 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+// suspendedCapacityTag is the ASG tag storing the size of a node pool from
+// before its cluster was suspended as min_size/max_size/desired_capacity.
+const suspendedCapacityTag = "cluster-lifecycle-manager.zalando.org/suspended-capacity"
+
+// Suspend scales all node pools of a cluster provisioned in AWS to zero. The
+// stacks and volumes of the cluster are kept and the sizes of the node pools
+// are stored as tags of their ASGs, such that Resume can restore them.
+func (p *clusterpyProvisioner) Suspend(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	logger := log.WithField("cluster", cluster.Alias)
+	awsAdapter, _, _, err := p.prepareProvision(logger, cluster, channelConfig)
+	if err != nil {
+		return err
+	}
+
+	asgs, err := awsAdapter.getClusterNodePoolASGs(cluster.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, asg := range asgs {
+		err := awsAdapter.suspendASG(asg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// Resume restores the node pools of a suspended cluster provisioned in AWS to
+// their sizes from before the cluster was suspended.
+func (p *clusterpyProvisioner) Resume(ctx context.Context, cluster *api.Cluster, channelConfig *channel.Config) error {
+	logger := log.WithField("cluster", cluster.Alias)
+	awsAdapter, _, _, err := p.prepareProvision(logger, cluster, channelConfig)
+	if err != nil {
+		return err
+	}
+
+	asgs, err := awsAdapter.getClusterNodePoolASGs(cluster.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, asg := range asgs {
+		err := awsAdapter.resumeASG(asg)
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// getClusterNodePoolASGs returns the ASGs of all node pools of the cluster.
+func (a *awsAdapter) getClusterNodePoolASGs(clusterID string) ([]*autoscaling.Group, error) {
+	groups, err := a.listASGs()
+	if err != nil {
+		return nil, err
+	}
+
+	expectedTags := []*autoscaling.TagDescription{
+		{
+			Key:   aws.String(fmt.Sprintf("kubernetes.io/cluster/%s", clusterID)),
+			Value: aws.String("owned"),
+		},
+	}
+
+	var asgs []*autoscaling.Group
+	for _, group := range groups {
+		if asgHasTags(expectedTags, group.Tags) && asgTagValue(group, "NodePool") != "" {
+			asgs = append(asgs, group)
+		}
+	}
+	return asgs, nil
+}
+
+// asgTagValue returns the value of a tag of an ASG or an empty string if
+// the ASG doesn't have the tag.
+func asgTagValue(asg *autoscaling.Group, key string) string {
+	for _, tag := range asg.Tags {
+		if aws.StringValue(tag.Key) == key {
+			return aws.StringValue(tag.Value)
+		}
+	}
+	return ""
+}
+
+// suspendASG stores the size of an ASG in the suspendedCapacityTag and scales
+// it to zero. The scaling processes are suspended to not let scheduled
+// actions scale it up again. The size of an ASG which is already suspended
+// isn't overwritten when a suspension is retried.
+func (a *awsAdapter) suspendASG(asg *autoscaling.Group) error {
+	asgName := aws.StringValue(asg.AutoScalingGroupName)
+
+	if asgTagValue(asg, suspendedCapacityTag) == "" {
+		capacity := fmt.Sprintf("%d/%d/%d", aws.Int64Value(asg.MinSize), aws.Int64Value(asg.MaxSize), desiredCapacity(asg))
+		a.logger.Infof("Suspending ASG %s with capacity %s", asgName, capacity)
+
+		err := a.tagASG(asgName, map[string]string{suspendedCapacityTag: capacity})
+		if err != nil {
+			return err
+		}
+	}
+
+	err := a.suspendScaling(asgName)
+	if err != nil {
+		return err
+	}
+
+	return a.resizeASG(asgName, 0, 0, 0)
+}
+
+// resumeASG restores the size of an ASG stored by suspendASG and resumes its
+// scaling processes. ASGs which aren't suspended are left untouched.
+func (a *awsAdapter) resumeASG(asg *autoscaling.Group) error {
+	asgName := aws.StringValue(asg.AutoScalingGroupName)
+
+	capacity := asgTagValue(asg, suspendedCapacityTag)
+	if capacity == "" {
+		return nil
+	}
+
+	var minSize, maxSize, desired int64
+	_, err := fmt.Sscanf(capacity, "%d/%d/%d", &minSize, &maxSize, &desired)
+	if err != nil {
+		return fmt.Errorf("invalid %s tag %q of ASG %s: %v", suspendedCapacityTag, capacity, asgName, err)
+	}
+
+	a.logger.Infof("Resuming ASG %s with capacity %s", asgName, capacity)
+	err = a.resizeASG(asgName, minSize, maxSize, desired)
+	if err != nil {
+		return err
+	}
+
+	err = a.resumeScaling(asgName)
+	if err != nil {
+		return err
+	}
+
+	return a.deleteASGTag(asgName, suspendedCapacityTag)
+}
+
+// resizeASG sets the min size, max size and desired capacity of an ASG.
+func (a *awsAdapter) resizeASG(asgName string, minSize, maxSize, desired int64) error {
+	if a.skipReadOnly("resizing ASG %s to %d/%d/%d", asgName, minSize, maxSize, desired) {
+		return nil
+	}
+
+	_, err := a.autoscalingClient.UpdateAutoScalingGroup(&autoscaling.UpdateAutoScalingGroupInput{
+		AutoScalingGroupName: aws.String(asgName),
+		MinSize:              aws.Int64(minSize),
+		MaxSize:              aws.Int64(maxSize),
+		DesiredCapacity:      aws.Int64(desired),
+	})
+	return err
+}
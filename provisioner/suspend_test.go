@@ -0,0 +1,120 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/autoscaling"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+type suspendAutoscalingAPIStub struct {
+	autoscalingAPI
+	groups      []*autoscaling.Group
+	updates     []*autoscaling.UpdateAutoScalingGroupInput
+	tags        []*autoscaling.Tag
+	deletedTags []*autoscaling.Tag
+	suspended   int
+	resumed     int
+}
+
+func (a *suspendAutoscalingAPIStub) DescribeAutoScalingGroups(input *autoscaling.DescribeAutoScalingGroupsInput) (*autoscaling.DescribeAutoScalingGroupsOutput, error) {
+	return &autoscaling.DescribeAutoScalingGroupsOutput{AutoScalingGroups: a.groups}, nil
+}
+
+func (a *suspendAutoscalingAPIStub) UpdateAutoScalingGroup(input *autoscaling.UpdateAutoScalingGroupInput) (*autoscaling.UpdateAutoScalingGroupOutput, error) {
+	a.updates = append(a.updates, input)
+	return nil, nil
+}
+
+func (a *suspendAutoscalingAPIStub) CreateOrUpdateTags(input *autoscaling.CreateOrUpdateTagsInput) (*autoscaling.CreateOrUpdateTagsOutput, error) {
+	a.tags = append(a.tags, input.Tags...)
+	return nil, nil
+}
+
+func (a *suspendAutoscalingAPIStub) DeleteTags(input *autoscaling.DeleteTagsInput) (*autoscaling.DeleteTagsOutput, error) {
+	a.deletedTags = append(a.deletedTags, input.Tags...)
+	return nil, nil
+}
+
+func (a *suspendAutoscalingAPIStub) SuspendProcesses(input *autoscaling.ScalingProcessQuery) (*autoscaling.SuspendProcessesOutput, error) {
+	a.suspended++
+	return nil, nil
+}
+
+func (a *suspendAutoscalingAPIStub) ResumeProcesses(input *autoscaling.ScalingProcessQuery) (*autoscaling.ResumeProcessesOutput, error) {
+	a.resumed++
+	return nil, nil
+}
+
+func suspendTestASG(name string, tags map[string]string, minSize, maxSize, desired int64) *autoscaling.Group {
+	asg := &autoscaling.Group{
+		AutoScalingGroupName: aws.String(name),
+		MinSize:              aws.Int64(minSize),
+		MaxSize:              aws.Int64(maxSize),
+		DesiredCapacity:      aws.Int64(desired),
+	}
+	for key, value := range tags {
+		asg.Tags = append(asg.Tags, &autoscaling.TagDescription{Key: aws.String(key), Value: aws.String(value)})
+	}
+	return asg
+}
+
+func TestGetClusterNodePoolASGs(t *testing.T) {
+	clusterTag := "kubernetes.io/cluster/kube-1"
+	asgClient := &suspendAutoscalingAPIStub{
+		groups: []*autoscaling.Group{
+			suspendTestASG("master", map[string]string{clusterTag: "owned", "NodePool": "master-default"}, 1, 1, 1),
+			suspendTestASG("worker", map[string]string{clusterTag: "owned", "NodePool": "worker-default"}, 1, 10, 3),
+			suspendTestASG("etcd", map[string]string{clusterTag: "owned"}, 3, 3, 3),
+			suspendTestASG("other", map[string]string{"kubernetes.io/cluster/kube-2": "owned", "NodePool": "worker-default"}, 1, 10, 3),
+		},
+	}
+	a := &awsAdapter{autoscalingClient: asgClient, logger: log.WithField("cluster", "kube-1")}
+
+	asgs, err := a.getClusterNodePoolASGs("kube-1")
+	require.NoError(t, err)
+	require.Len(t, asgs, 2)
+	assert.Equal(t, "master", aws.StringValue(asgs[0].AutoScalingGroupName))
+	assert.Equal(t, "worker", aws.StringValue(asgs[1].AutoScalingGroupName))
+}
+
+func TestSuspendResumeASG(t *testing.T) {
+	asgClient := &suspendAutoscalingAPIStub{}
+	a := &awsAdapter{autoscalingClient: asgClient, logger: log.WithField("cluster", "kube-1")}
+
+	asg := suspendTestASG("worker", map[string]string{"NodePool": "worker-default"}, 1, 10, 3)
+	require.NoError(t, a.suspendASG(asg))
+	require.Len(t, asgClient.tags, 1)
+	assert.Equal(t, suspendedCapacityTag, aws.StringValue(asgClient.tags[0].Key))
+	assert.Equal(t, "1/10/3", aws.StringValue(asgClient.tags[0].Value))
+	require.Len(t, asgClient.updates, 1)
+	assert.EqualValues(t, 0, aws.Int64Value(asgClient.updates[0].MaxSize))
+	assert.EqualValues(t, 0, aws.Int64Value(asgClient.updates[0].DesiredCapacity))
+	assert.Equal(t, 1, asgClient.suspended)
+
+	// the stored capacity isn't overwritten when the suspension is
+	// retried.
+	suspended := suspendTestASG("worker", map[string]string{"NodePool": "worker-default", suspendedCapacityTag: "1/10/3"}, 0, 0, 0)
+	require.NoError(t, a.suspendASG(suspended))
+	assert.Len(t, asgClient.tags, 1)
+
+	require.NoError(t, a.resumeASG(suspended))
+	update := asgClient.updates[len(asgClient.updates)-1]
+	assert.EqualValues(t, 1, aws.Int64Value(update.MinSize))
+	assert.EqualValues(t, 10, aws.Int64Value(update.MaxSize))
+	assert.EqualValues(t, 3, aws.Int64Value(update.DesiredCapacity))
+	assert.Equal(t, 1, asgClient.resumed)
+	require.Len(t, asgClient.deletedTags, 1)
+	assert.Equal(t, suspendedCapacityTag, aws.StringValue(asgClient.deletedTags[0].Key))
+
+	// ASGs which aren't suspended aren't resized.
+	updates := len(asgClient.updates)
+	require.NoError(t, a.resumeASG(asg))
+	assert.Len(t, asgClient.updates, updates)
+
+	invalid := suspendTestASG("worker", map[string]string{suspendedCapacityTag: "3"}, 0, 0, 0)
+	assert.Error(t, a.resumeASG(invalid))
+}
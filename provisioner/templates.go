@@ -0,0 +1,185 @@
+package provisioner
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"strings"
+	"text/template"
+
+	"github.com/coreos/go-semver/semver"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// maxIncludeDepth limits how deep templates can include other templates.
+const maxIncludeDepth = 10
+
+var semverConstraintRe = regexp.MustCompile(`^\s*(>=|<=|!=|>|<|=)?\s*(\S+)\s*$`)
+
+// templateFuncs returns the functions available to manifest templates.
+func templateFuncs(context *applyContext, file string, cluster *api.Cluster) template.FuncMap {
+	return template.FuncMap{
+		"getAWSAccountID": getAWSAccountID,
+		"base64":          base64Encode,
+		"indent":          indent,
+		"sha256":          sha256Sum,
+		"semverCompare":   semverCompare,
+		"configItem":      func(key, defaultValue string) string { return configItem(cluster, key, defaultValue) },
+		"configValue":     func(key string) interface{} { return configValues(cluster.ConfigItems, cluster.ConfigValues)[key] },
+		"manifestHash":    func(template string) (string, error) { return manifestHash(context, file, template, cluster) },
+		"include":         func(template string) (string, error) { return include(context, file, template, cluster) },
+	}
+}
+
+// resolveTemplatePath resolves the path of a template relative to the file
+// referencing it. It returns an error if the resulting path is outside of
+// the base directory of the context.
+func resolveTemplatePath(context *applyContext, file, template string) (string, error) {
+	templateFile, err := filepath.Abs(path.Clean(path.Join(path.Dir(file), template)))
+	if err != nil {
+		return "", err
+	}
+
+	baseDir, err := filepath.Abs(context.baseDir)
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasPrefix(templateFile, baseDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid template path: %s", templateFile)
+	}
+
+	return templateFile, nil
+}
+
+// include is a function for the templates that renders a sibling template
+// file and returns the result. The included file must be inside the
+// manifests folder.
+func include(context *applyContext, file string, template string, cluster *api.Cluster) (string, error) {
+	if context.includeDepth >= maxIncludeDepth {
+		return "", fmt.Errorf("max include depth of %d exceeded in %s", maxIncludeDepth, file)
+	}
+	context.includeDepth++
+	defer func() { context.includeDepth-- }()
+
+	templateFile, err := resolveTemplatePath(context, file, template)
+	if err != nil {
+		return "", err
+	}
+
+	return applyTemplate(context, templateFile, cluster)
+}
+
+// indent indents every non-empty line of value by the specified number of
+// spaces.
+func indent(spaces int, value string) string {
+	padding := strings.Repeat(" ", spaces)
+	lines := strings.Split(value, "\n")
+	for i, line := range lines {
+		if line != "" {
+			lines[i] = padding + line
+		}
+	}
+	return strings.Join(lines, "\n")
+}
+
+// sha256Sum returns the hex encoded sha256 hash of value.
+func sha256Sum(value string) string {
+	return fmt.Sprintf("%x", sha256.Sum256([]byte(value)))
+}
+
+// configItem returns the value of the config item key or defaultValue if the
+// cluster doesn't define the config item.
+func configItem(cluster *api.Cluster, key, defaultValue string) string {
+	if value, ok := cluster.ConfigItems[key]; ok {
+		return value
+	}
+	return defaultValue
+}
+
+// parseVersion parses a semantic version. A leading 'v' and missing minor or
+// patch versions are allowed e.g. 'v1.10' is parsed as '1.10.0'.
+func parseVersion(version string) (*semver.Version, error) {
+	version = strings.TrimPrefix(version, "v")
+	main := strings.SplitN(version, "-", 2)
+	parts := strings.Split(main[0], ".")
+	for len(parts) < 3 {
+		parts = append(parts, "0")
+	}
+	main[0] = strings.Join(parts, ".")
+	return semver.NewVersion(strings.Join(main, "-"))
+}
+
+// semverCompare returns true if version matches the constraint. A
+// constraint is a version prefixed by one of the operators =, !=, >, >=, <
+// or <= e.g. '>=1.10'. If no operator is specified = is assumed.
+func semverCompare(constraint, version string) (bool, error) {
+	match := semverConstraintRe.FindStringSubmatch(constraint)
+	if match == nil {
+		return false, fmt.Errorf("invalid version constraint: %s", constraint)
+	}
+
+	expected, err := parseVersion(match[2])
+	if err != nil {
+		return false, err
+	}
+
+	actual, err := parseVersion(version)
+	if err != nil {
+		return false, err
+	}
+
+	cmp := actual.Compare(*expected)
+
+	switch match[1] {
+	case ">=":
+		return cmp >= 0, nil
+	case "<=":
+		return cmp <= 0, nil
+	case ">":
+		return cmp > 0, nil
+	case "<":
+		return cmp < 0, nil
+	case "!=":
+		return cmp != 0, nil
+	default:
+		return cmp == 0, nil
+	}
+}
+
+// sandboxedPartialProvider provides mustache partials from files relative to
+// a base directory. Partials outside of the base directory are rejected.
+type sandboxedPartialProvider struct {
+	baseDir string
+}
+
+// Get returns the content of the partial name.
+func (p *sandboxedPartialProvider) Get(name string) (string, error) {
+	baseDir, err := filepath.Abs(p.baseDir)
+	if err != nil {
+		return "", err
+	}
+
+	file, err := filepath.Abs(path.Join(baseDir, name))
+	if err != nil {
+		return "", err
+	}
+
+	if !strings.HasPrefix(file, baseDir+string(filepath.Separator)) {
+		return "", fmt.Errorf("invalid partial path: %s", name)
+	}
+
+	content, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return "", fmt.Errorf("partial %s not found", name)
+		}
+		return "", err
+	}
+
+	return string(content), nil
+}
@@ -0,0 +1,137 @@
+package provisioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestIndent(t *testing.T) {
+	assert.Equal(t, "  foo\n\n  bar", indent(2, "foo\n\nbar"))
+}
+
+func TestConfigItem(t *testing.T) {
+	cluster := &api.Cluster{ConfigItems: map[string]string{"foo": "bar"}}
+	assert.Equal(t, "bar", configItem(cluster, "foo", "default"))
+	assert.Equal(t, "default", configItem(cluster, "missing", "default"))
+}
+
+func TestSemverCompare(t *testing.T) {
+	for _, tc := range []struct {
+		msg        string
+		constraint string
+		version    string
+		expected   bool
+		success    bool
+	}{
+		{
+			msg:        "test greater or equal",
+			constraint: ">=1.10",
+			version:    "v1.10.3",
+			expected:   true,
+			success:    true,
+		},
+		{
+			msg:        "test less than",
+			constraint: "< 1.10.0",
+			version:    "1.9.7",
+			expected:   true,
+			success:    true,
+		},
+		{
+			msg:        "test equal without operator",
+			constraint: "1.9",
+			version:    "1.10",
+			expected:   false,
+			success:    true,
+		},
+		{
+			msg:        "test not equal",
+			constraint: "!=1.9.0",
+			version:    "1.10.0",
+			expected:   true,
+			success:    true,
+		},
+		{
+			msg:        "test invalid version",
+			constraint: ">=1.10",
+			version:    "latest",
+			success:    false,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			result, err := semverCompare(tc.constraint, tc.version)
+			if !tc.success {
+				assert.Error(t, err)
+				return
+			}
+			assert.NoError(t, err)
+			assert.Equal(t, tc.expected, result)
+		})
+	}
+}
+
+func TestApplyTemplateInclude(t *testing.T) {
+	dir, err := ioutil.TempDir("", "manifests")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"component/deployment.yaml": `env: {{ include "_env.yaml" | indent 2 }}`,
+		"component/_env.yaml":       `{{ configItem "env" "test" }}`,
+		"component/outside.yaml":    `{{ include "../../outside.yaml" }}`,
+		"component/loop.yaml":       `{{ include "loop.yaml" }}`,
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(path.Dir(path.Join(dir, name)), 0755))
+		require.NoError(t, ioutil.WriteFile(path.Join(dir, name), []byte(content), 0644))
+	}
+
+	cluster := &api.Cluster{ConfigItems: map[string]string{"env": "production"}}
+
+	result, err := applyTemplate(newApplyContext(dir), path.Join(dir, "component/deployment.yaml"), cluster)
+	assert.NoError(t, err)
+	assert.Equal(t, "env:   production", result)
+
+	// includes outside of the manifests folder are rejected
+	_, err = applyTemplate(newApplyContext(dir), path.Join(dir, "component/outside.yaml"), cluster)
+	assert.Error(t, err)
+
+	// recursive includes are limited
+	_, err = applyTemplate(newApplyContext(dir), path.Join(dir, "component/loop.yaml"), cluster)
+	assert.Error(t, err)
+}
+
+func TestRenderUserDataPartials(t *testing.T) {
+	dir, err := ioutil.TempDir("", "userdata")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"worker.clc.yaml":     "storage:\n  {{> snippets/files.yaml}}",
+		"snippets/files.yaml": "files: {{LOCAL_ID}}",
+		"outside.clc.yaml":    "{{> ../secret}}",
+		"missing.clc.yaml":    "{{> missing.yaml}}",
+	}
+	for name, content := range files {
+		require.NoError(t, os.MkdirAll(path.Dir(path.Join(dir, name)), 0755))
+		require.NoError(t, ioutil.WriteFile(path.Join(dir, name), []byte(content), 0644))
+	}
+
+	config := map[string]string{"LOCAL_ID": "kube-1"}
+
+	result, err := renderUserData(path.Join(dir, "worker.clc.yaml"), config, nil)
+	assert.NoError(t, err)
+	assert.Equal(t, "storage:\n  files: kube-1", result)
+
+	_, err = renderUserData(path.Join(dir, "outside.clc.yaml"), config, nil)
+	assert.Error(t, err)
+
+	_, err = renderUserData(path.Join(dir, "missing.clc.yaml"), config, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,68 @@
+package provisioner
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	tenancyDefault   = "default"
+	tenancyDedicated = "dedicated"
+	tenancyHost      = "host"
+
+	hostResourceGroupPrefix = "arn:aws:resource-groups:"
+)
+
+// validateTenancy returns an error if the tenancy of the node pool is
+// invalid. Host resource groups can only be used with the host tenancy, which
+// can't be used by spot instances.
+func validateTenancy(nodePool *api.NodePool) error {
+	switch nodePool.Tenancy {
+	case "", tenancyDefault, tenancyDedicated, tenancyHost:
+	default:
+		return fmt.Errorf("invalid tenancy %s, must be one of %s, %s or %s", nodePool.Tenancy, tenancyDefault, tenancyDedicated, tenancyHost)
+	}
+
+	if nodePool.HostResourceGroupARN != "" {
+		if nodePool.Tenancy != tenancyHost {
+			return fmt.Errorf("host_resource_group_arn requires the %s tenancy", tenancyHost)
+		}
+
+		if !strings.HasPrefix(nodePool.HostResourceGroupARN, hostResourceGroupPrefix) {
+			return fmt.Errorf("invalid host_resource_group_arn %s, must be the ARN of a resource group", nodePool.HostResourceGroupARN)
+		}
+	}
+
+	if nodePool.Tenancy == tenancyHost && isSpotNodePool(nodePool) {
+		return fmt.Errorf("spot instances can't run on dedicated hosts")
+	}
+
+	return nil
+}
+
+// tenancyArgs validates the tenancy of a node pool and returns its stack
+// parameters prefixed with the given prefix e.g. 'Master' or 'Worker'. No
+// parameters are returned for the default tenancy, dedicated instances and
+// hosts require launch templates.
+func tenancyArgs(prefix string, nodePool *api.NodePool, launchTemplate bool) ([]string, error) {
+	err := validateTenancy(nodePool)
+	if err != nil {
+		return nil, fmt.Errorf("node pool %s: %v", nodePool.Name, err)
+	}
+
+	if nodePool.Tenancy == "" || nodePool.Tenancy == tenancyDefault {
+		return nil, nil
+	}
+
+	if !launchTemplate {
+		return nil, fmt.Errorf("the %s tenancy of node pool %s requires the %s config item", nodePool.Tenancy, nodePool.Name, launchTemplateConfigItemKey)
+	}
+
+	args := []string{fmt.Sprintf("%sTenancy=%s", prefix, nodePool.Tenancy)}
+	if nodePool.HostResourceGroupARN != "" {
+		args = append(args, fmt.Sprintf("%sHostResourceGroupArn=%s", prefix, nodePool.HostResourceGroupARN))
+	}
+	return args, nil
+}
@@ -0,0 +1,78 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestTenancyArgs(t *testing.T) {
+	hostResourceGroup := "arn:aws:resource-groups:eu-central-1:123456789012:group/compliance-hosts"
+
+	for _, tc := range []struct {
+		msg            string
+		nodePool       *api.NodePool
+		launchTemplate bool
+		expected       []string
+		err            bool
+	}{
+		{
+			msg:      "default tenancy",
+			nodePool: &api.NodePool{Name: "worker", Tenancy: tenancyDefault},
+		},
+		{
+			msg:            "dedicated instances",
+			nodePool:       &api.NodePool{Name: "worker", Tenancy: tenancyDedicated},
+			launchTemplate: true,
+			expected:       []string{"WorkerTenancy=dedicated"},
+		},
+		{
+			msg:            "host resource group",
+			nodePool:       &api.NodePool{Name: "worker", Tenancy: tenancyHost, HostResourceGroupARN: hostResourceGroup},
+			launchTemplate: true,
+			expected:       []string{"WorkerTenancy=host", "WorkerHostResourceGroupArn=" + hostResourceGroup},
+		},
+		{
+			msg:      "without launch template",
+			nodePool: &api.NodePool{Name: "worker", Tenancy: tenancyDedicated},
+			err:      true,
+		},
+		{
+			msg:            "invalid tenancy",
+			nodePool:       &api.NodePool{Name: "worker", Tenancy: "shared"},
+			launchTemplate: true,
+			err:            true,
+		},
+		{
+			msg:            "host resource group without host tenancy",
+			nodePool:       &api.NodePool{Name: "worker", Tenancy: tenancyDedicated, HostResourceGroupARN: hostResourceGroup},
+			launchTemplate: true,
+			err:            true,
+		},
+		{
+			msg:            "invalid host resource group",
+			nodePool:       &api.NodePool{Name: "worker", Tenancy: tenancyHost, HostResourceGroupARN: "compliance-hosts"},
+			launchTemplate: true,
+			err:            true,
+		},
+		{
+			msg:            "spot instances on hosts",
+			nodePool:       &api.NodePool{Name: "worker", Tenancy: tenancyHost, DiscountStrategy: discountStrategySpotMaxPrice},
+			launchTemplate: true,
+			err:            true,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			args, err := tenancyArgs("Worker", tc.nodePool, tc.launchTemplate)
+			if tc.err {
+				require.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, args)
+		})
+	}
+}
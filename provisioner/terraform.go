@@ -0,0 +1,372 @@
+package provisioner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+)
+
+const (
+	terraformMainFile         = "main.tf"
+	terraformInstructionsFile = "IMPORT.md"
+	// terraformTemplateBucketVariable is the variable of the S3 bucket the
+	// templates too large to be passed as template_body are uploaded to.
+	terraformTemplateBucketVariable = "template_bucket"
+	// noEchoParameterValue is returned by CloudFormation instead of the
+	// values of parameters with NoEcho set.
+	noEchoParameterValue = "****"
+)
+
+var terraformInvalidNameChars = regexp.MustCompile(`[^a-zA-Z0-9_-]`)
+
+// TerraformExporter exports the stacks of a cluster as Terraform
+// configuration, such that the cluster can be managed with Terraform instead
+// of the Cluster Lifecycle Manager without rebuilding it.
+type TerraformExporter interface {
+	// ExportTerraform writes the Terraform configuration and the
+	// instructions for importing the stacks of the cluster into the
+	// Terraform state to the directory.
+	ExportTerraform(cluster *api.Cluster, dir string) error
+}
+
+// terraformStack is a stack owned by a cluster exported as an
+// aws_cloudformation_stack resource.
+type terraformStack struct {
+	Resource     string
+	Name         string
+	TemplateFile string
+	Template     string
+	Capabilities []string
+	Parameters   map[string]string
+	Tags         map[string]string
+	// NoEchoParameters are the parameters whose values aren't returned
+	// by CloudFormation and must be filled in by hand.
+	NoEchoParameters []string
+}
+
+// uploaded returns true if the template of the stack is too large to be
+// passed to CloudFormation directly and must be uploaded to S3, like the
+// Cluster Lifecycle Manager does when it applies the stack.
+func (s *terraformStack) uploaded() bool {
+	return len(s.Template) > stackMaxSize
+}
+
+// hasUploadedTemplates returns true if any of the stacks has a template
+// which must be uploaded to S3.
+func hasUploadedTemplates(stacks []*terraformStack) bool {
+	for _, stack := range stacks {
+		if stack.uploaded() {
+			return true
+		}
+	}
+	return false
+}
+
+type awsTerraformExporter struct {
+	assumedRole string
+	awsConfig   *aws.Config
+	credentials *awsExt.CredentialsCache
+}
+
+// NewTerraformExporter returns a TerraformExporter reading the stacks from
+// the AWS accounts of the clusters by assuming the IAM role.
+func NewTerraformExporter(assumedRole string, awsConfig *aws.Config) TerraformExporter {
+	return &awsTerraformExporter{
+		assumedRole: assumedRole,
+		awsConfig:   awsConfig,
+		credentials: awsExt.NewCredentialsCache(),
+	}
+}
+
+// ExportTerraform writes the stacks owned by the cluster as
+// aws_cloudformation_stack resources to the directory. The deployed templates
+// and parameters are exported, so the stacks are imported without changes.
+func (e *awsTerraformExporter) ExportTerraform(cluster *api.Cluster, dir string) error {
+	if cluster.Provider != providerID {
+		return ErrProviderNotSupported
+	}
+
+	sess, err := clusterSession(e.awsConfig, e.assumedRole, e.credentials, cluster)
+	if err != nil {
+		return err
+	}
+
+	adapter, err := newAWSAdapter(log.WithField("cluster", cluster.Alias), cluster.APIServerURL, cluster.Region, sess, nil, true)
+	if err != nil {
+		return err
+	}
+
+	stacks, err := adapter.terraformStacks(cluster)
+	if err != nil {
+		return err
+	}
+
+	return writeTerraform(dir, cluster, stacks)
+}
+
+// terraformStacks returns the stacks owned by the cluster with their deployed
+// templates, sorted by name.
+func (a *awsAdapter) terraformStacks(cluster *api.Cluster) ([]*terraformStack, error) {
+	stacks, err := a.ListStacks(map[string]string{
+		"kubernetes.io/cluster/" + cluster.ID: "owned",
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if len(stacks) == 0 {
+		return nil, fmt.Errorf("no stacks found for cluster %s", cluster.ID)
+	}
+
+	result := make([]*terraformStack, 0, len(stacks))
+	for _, stack := range stacks {
+		name := aws.StringValue(stack.StackName)
+
+		resp, err := a.cloudformationClient.GetTemplate(&cloudformation.GetTemplateInput{
+			StackName:     aws.String(name),
+			TemplateStage: aws.String(cloudformation.TemplateStageOriginal),
+		})
+		if err != nil {
+			return nil, fmt.Errorf("failed to get template of stack %s: %v", name, err)
+		}
+
+		resource := terraformResourceName(name)
+		exported := &terraformStack{
+			Resource:     resource,
+			Name:         name,
+			TemplateFile: resource + ".template.json",
+			Template:     aws.StringValue(resp.TemplateBody),
+			Capabilities: aws.StringValueSlice(stack.Capabilities),
+			Parameters:   make(map[string]string, len(stack.Parameters)),
+			Tags:         make(map[string]string, len(stack.Tags)),
+		}
+
+		for _, parameter := range stack.Parameters {
+			key := aws.StringValue(parameter.ParameterKey)
+			value := aws.StringValue(parameter.ParameterValue)
+			if value == noEchoParameterValue {
+				exported.NoEchoParameters = append(exported.NoEchoParameters, key)
+			}
+			exported.Parameters[key] = value
+		}
+		for _, tag := range stack.Tags {
+			// the update ID changes with every provisioning, so
+			// exporting it would make Terraform revert it.
+			if aws.StringValue(tag.Key) == updateIDTag {
+				continue
+			}
+			exported.Tags[aws.StringValue(tag.Key)] = aws.StringValue(tag.Value)
+		}
+
+		result = append(result, exported)
+	}
+
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+// terraformResourceName converts a stack name to a valid Terraform resource
+// name.
+func terraformResourceName(stackName string) string {
+	name := terraformInvalidNameChars.ReplaceAllString(stackName, "_")
+	if name == "" || !(name[0] == '_' || (name[0] >= 'a' && name[0] <= 'z') || (name[0] >= 'A' && name[0] <= 'Z')) {
+		name = "stack_" + name
+	}
+	return name
+}
+
+// writeTerraform writes the templates of the stacks, the Terraform
+// configuration importing them and the instructions to the directory.
+func writeTerraform(dir string, cluster *api.Cluster, stacks []*terraformStack) error {
+	err := os.MkdirAll(dir, 0755)
+	if err != nil {
+		return err
+	}
+
+	for _, stack := range stacks {
+		err := ioutil.WriteFile(path.Join(dir, stack.TemplateFile), []byte(stack.Template), 0644)
+		if err != nil {
+			return err
+		}
+	}
+
+	err = ioutil.WriteFile(path.Join(dir, terraformMainFile), []byte(terraformConfig(cluster, stacks)), 0644)
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path.Join(dir, terraformInstructionsFile), []byte(terraformInstructions(cluster, stacks)), 0644)
+}
+
+// terraformConfig returns the Terraform configuration of the stacks. Every
+// stack is an aws_cloudformation_stack resource with an import block, such
+// that the existing stacks are adopted instead of created. Templates larger
+// than CloudFormation accepts directly are referenced by their URL in the
+// bucket of the template_bucket variable.
+func terraformConfig(cluster *api.Cluster, stacks []*terraformStack) string {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "# Stacks of cluster %s exported from the Cluster Lifecycle Manager.\n\n", cluster.ID)
+	b.WriteString("terraform {\n")
+	b.WriteString("  required_version = \">= 1.5.0\"\n\n")
+	b.WriteString("  required_providers {\n")
+	b.WriteString("    aws = {\n")
+	b.WriteString("      source = \"hashicorp/aws\"\n")
+	b.WriteString("    }\n")
+	b.WriteString("  }\n")
+	b.WriteString("}\n\n")
+	b.WriteString("provider \"aws\" {\n")
+	fmt.Fprintf(&b, "  region = %s\n", hclString(cluster.Region))
+	b.WriteString("}\n")
+
+	if hasUploadedTemplates(stacks) {
+		fmt.Fprintf(&b, "\nvariable %s {\n", hclString(terraformTemplateBucketVariable))
+		fmt.Fprintf(&b, "  description = \"S3 bucket in %s the templates larger than %d bytes are uploaded to.\"\n", cluster.Region, stackMaxSize)
+		b.WriteString("  type        = string\n")
+		b.WriteString("}\n")
+	}
+
+	for _, stack := range stacks {
+		b.WriteString("\nimport {\n")
+		fmt.Fprintf(&b, "  to = aws_cloudformation_stack.%s\n", stack.Resource)
+		fmt.Fprintf(&b, "  id = %s\n", hclString(stack.Name))
+		b.WriteString("}\n\n")
+
+		fmt.Fprintf(&b, "resource \"aws_cloudformation_stack\" %s {\n", hclString(stack.Resource))
+		fmt.Fprintf(&b, "  name          = %s\n", hclString(stack.Name))
+		if stack.uploaded() {
+			fmt.Fprintf(&b, "  template_url  = \"https://${var.%s}.s3.%s.amazonaws.com/%s\"\n", terraformTemplateBucketVariable, cluster.Region, stack.TemplateFile)
+		} else {
+			fmt.Fprintf(&b, "  template_body = file(\"${path.module}/%s\")\n", stack.TemplateFile)
+		}
+		if len(stack.Capabilities) > 0 {
+			capabilities := make([]string, 0, len(stack.Capabilities))
+			for _, capability := range stack.Capabilities {
+				capabilities = append(capabilities, hclString(capability))
+			}
+			fmt.Fprintf(&b, "  capabilities  = [%s]\n", strings.Join(capabilities, ", "))
+		}
+		writeHCLMap(&b, "parameters", stack.Parameters)
+		writeHCLMap(&b, "tags", stack.Tags)
+		b.WriteString("\n  lifecycle {\n")
+		b.WriteString("    prevent_destroy = true\n")
+		b.WriteString("  }\n")
+		b.WriteString("}\n")
+	}
+
+	return b.String()
+}
+
+// writeHCLMap writes a map attribute with the keys in sorted order. Empty
+// maps are omitted.
+func writeHCLMap(b *bytes.Buffer, name string, values map[string]string) {
+	if len(values) == 0 {
+		return
+	}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	fmt.Fprintf(b, "\n  %s = {\n", name)
+	for _, key := range keys {
+		fmt.Fprintf(b, "    %s = %s\n", hclString(key), hclString(values[key]))
+	}
+	b.WriteString("  }\n")
+}
+
+// hclString quotes a string as HCL string literal. Template sequences are
+// escaped, so the value is used literally.
+func hclString(value string) string {
+	var b bytes.Buffer
+	encoder := json.NewEncoder(&b)
+	encoder.SetEscapeHTML(false)
+	// encoding a string can't fail.
+	_ = encoder.Encode(value)
+
+	quoted := strings.TrimSuffix(b.String(), "\n")
+	quoted = strings.Replace(quoted, "${", "$${", -1)
+	return strings.Replace(quoted, "%{", "%%{", -1)
+}
+
+// terraformInstructions returns the instructions for moving the stacks of
+// the cluster from the Cluster Lifecycle Manager to Terraform.
+func terraformInstructions(cluster *api.Cluster, stacks []*terraformStack) string {
+	var b bytes.Buffer
+
+	fmt.Fprintf(&b, "# Importing cluster %s into Terraform\n\n", cluster.ID)
+	b.WriteString("The configuration in this directory manages the following stacks of the\n")
+	b.WriteString("cluster as `aws_cloudformation_stack` resources, using their deployed\n")
+	b.WriteString("templates and parameters:\n\n")
+	for _, stack := range stacks {
+		fmt.Fprintf(&b, "- `%s` (`aws_cloudformation_stack.%s`)\n", stack.Name, stack.Resource)
+	}
+
+	b.WriteString("\n1. Stop the Cluster Lifecycle Manager from managing the cluster by removing\n")
+	b.WriteString("   it from the cluster registry or excluding its account with `--exclude`.\n")
+	b.WriteString("   Don't decommission it, that deletes the stacks.\n")
+
+	step := 2
+	var noEcho []string
+	for _, stack := range stacks {
+		for _, parameter := range stack.NoEchoParameters {
+			noEcho = append(noEcho, fmt.Sprintf("`%s` of `%s`", parameter, stack.Name))
+		}
+	}
+	if len(noEcho) > 0 {
+		fmt.Fprintf(&b, "%d. Replace the values of the NoEcho parameters %s in `%s`,\n", step, strings.Join(noEcho, ", "), terraformMainFile)
+		b.WriteString("   CloudFormation doesn't return them.\n")
+		step++
+	}
+
+	var variables string
+	if hasUploadedTemplates(stacks) {
+		fmt.Fprintf(&b, "%d. Upload the templates larger than %d bytes, which CloudFormation only\n", step, stackMaxSize)
+		fmt.Fprintf(&b, "   accepts from S3, to a bucket in %s:\n\n", cluster.Region)
+		b.WriteString("   ```sh\n")
+		for _, stack := range stacks {
+			if stack.uploaded() {
+				fmt.Fprintf(&b, "   aws s3 cp %s s3://<bucket>/%s\n", stack.TemplateFile, stack.TemplateFile)
+			}
+		}
+		b.WriteString("   ```\n\n")
+		fmt.Fprintf(&b, "   Pass the bucket as the `%s` variable to Terraform.\n", terraformTemplateBucketVariable)
+		variables = fmt.Sprintf(" -var %s=<bucket>", terraformTemplateBucketVariable)
+		step++
+	}
+
+	fmt.Fprintf(&b, "%d. Run `terraform init` and `terraform plan%s`. The plan must only import the\n", step, variables)
+	b.WriteString("   stacks without changing them.\n")
+	step++
+	fmt.Fprintf(&b, "%d. Run `terraform apply%s` to record the stacks in the Terraform state.\n\n", step, variables)
+
+	b.WriteString("With Terraform older than 1.5, remove the `import` blocks and import the\n")
+	b.WriteString("stacks with:\n\n")
+	b.WriteString("```sh\n")
+	for _, stack := range stacks {
+		fmt.Fprintf(&b, "terraform import%s aws_cloudformation_stack.%s %s\n", variables, stack.Resource, stack.Name)
+	}
+	b.WriteString("```\n\n")
+
+	b.WriteString("The stacks are protected by `prevent_destroy`. The userdata uploaded to S3\n")
+	b.WriteString("and stacks shared with other clusters, like the etcd stack, aren't exported.\n")
+
+	return b.String()
+}
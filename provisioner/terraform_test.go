@@ -0,0 +1,176 @@
+package provisioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type terraformCloudFormationAPIStub struct {
+	cloudFormationAPI
+	stacks    []*cloudformation.Stack
+	templates map[string]string
+}
+
+func (c *terraformCloudFormationAPIStub) DescribeStacksPages(input *cloudformation.DescribeStacksInput, fn func(resp *cloudformation.DescribeStacksOutput, lastPage bool) bool) error {
+	fn(&cloudformation.DescribeStacksOutput{Stacks: c.stacks}, true)
+	return nil
+}
+
+func (c *terraformCloudFormationAPIStub) GetTemplate(input *cloudformation.GetTemplateInput) (*cloudformation.GetTemplateOutput, error) {
+	return &cloudformation.GetTemplateOutput{TemplateBody: aws.String(c.templates[aws.StringValue(input.StackName)])}, nil
+}
+
+func TestTerraformStacks(t *testing.T) {
+	cluster := &api.Cluster{ID: "aws:123456789012:eu-central-1:kube-1", LocalID: "kube-1", Region: "eu-central-1"}
+	owned := &cloudformation.Tag{Key: aws.String("kubernetes.io/cluster/" + cluster.ID), Value: aws.String("owned")}
+
+	client := &terraformCloudFormationAPIStub{
+		stacks: []*cloudformation.Stack{
+			{
+				StackName:    aws.String("kube-1"),
+				Capabilities: aws.StringSlice([]string{cloudformation.CapabilityCapabilityNamedIam}),
+				Parameters: []*cloudformation.Parameter{
+					{ParameterKey: aws.String("WorkerSpotPrice"), ParameterValue: aws.String("0.1")},
+					{ParameterKey: aws.String("Secret"), ParameterValue: aws.String(noEchoParameterValue)},
+				},
+				Tags: []*cloudformation.Tag{owned, {Key: aws.String(updateIDTag), Value: aws.String("0123456789abcdef")}},
+			},
+			{
+				StackName: aws.String("etcd-cluster-etcd"),
+			},
+			{
+				StackName: aws.String("1-nodepool"),
+				Tags:      []*cloudformation.Tag{owned},
+			},
+		},
+		templates: map[string]string{
+			"kube-1":     `{"Resources": {}}`,
+			"1-nodepool": `{"Resources": {"ASG": {}}}`,
+		},
+	}
+	a := &awsAdapter{cloudformationClient: client, logger: log.WithField("cluster", "kube-1")}
+
+	stacks, err := a.terraformStacks(cluster)
+	require.NoError(t, err)
+	require.Len(t, stacks, 2)
+
+	assert.Equal(t, "1-nodepool", stacks[0].Name)
+	assert.Equal(t, "stack_1-nodepool", stacks[0].Resource)
+	assert.Equal(t, `{"Resources": {"ASG": {}}}`, stacks[0].Template)
+
+	assert.Equal(t, "kube-1", stacks[1].Name)
+	assert.Equal(t, "kube-1.template.json", stacks[1].TemplateFile)
+	assert.Equal(t, []string{cloudformation.CapabilityCapabilityNamedIam}, stacks[1].Capabilities)
+	assert.Equal(t, "0.1", stacks[1].Parameters["WorkerSpotPrice"])
+	assert.Equal(t, []string{"Secret"}, stacks[1].NoEchoParameters)
+	assert.Equal(t, map[string]string{"kubernetes.io/cluster/" + cluster.ID: "owned"}, stacks[1].Tags)
+
+	_, err = a.terraformStacks(&api.Cluster{ID: "aws:123456789012:eu-central-1:kube-2"})
+	assert.Error(t, err)
+}
+
+func TestWriteTerraform(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraform")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cluster := &api.Cluster{ID: "aws:123456789012:eu-central-1:kube-1", Region: "eu-central-1"}
+	stacks := []*terraformStack{
+		{
+			Resource:         "kube-1",
+			Name:             "kube-1",
+			TemplateFile:     "kube-1.template.json",
+			Template:         `{"Resources": {}}`,
+			Capabilities:     []string{cloudformation.CapabilityCapabilityNamedIam},
+			Parameters:       map[string]string{"UserData": "echo ${HOME}", "Secret": noEchoParameterValue},
+			Tags:             map[string]string{"team": "teapot"},
+			NoEchoParameters: []string{"Secret"},
+		},
+	}
+
+	exportDir := path.Join(dir, "export")
+	require.NoError(t, writeTerraform(exportDir, cluster, stacks))
+
+	template, err := ioutil.ReadFile(path.Join(exportDir, "kube-1.template.json"))
+	require.NoError(t, err)
+	assert.Equal(t, `{"Resources": {}}`, string(template))
+
+	config, err := ioutil.ReadFile(path.Join(exportDir, terraformMainFile))
+	require.NoError(t, err)
+	assert.Contains(t, string(config), `region = "eu-central-1"`)
+	assert.Contains(t, string(config), "import {\n  to = aws_cloudformation_stack.kube-1\n  id = \"kube-1\"\n}")
+	assert.Contains(t, string(config), `template_body = file("${path.module}/kube-1.template.json")`)
+	assert.Contains(t, string(config), `capabilities  = ["CAPABILITY_NAMED_IAM"]`)
+	assert.Contains(t, string(config), `"UserData" = "echo $${HOME}"`)
+	assert.Contains(t, string(config), `"team" = "teapot"`)
+	assert.Contains(t, string(config), "prevent_destroy = true")
+
+	instructions, err := ioutil.ReadFile(path.Join(exportDir, terraformInstructionsFile))
+	require.NoError(t, err)
+	assert.Contains(t, string(instructions), "NoEcho parameters `Secret` of `kube-1`")
+	assert.Contains(t, string(instructions), "terraform import aws_cloudformation_stack.kube-1 kube-1")
+	assert.NotContains(t, string(config), "template_url")
+	assert.NotContains(t, string(instructions), "aws s3 cp")
+}
+
+func TestWriteTerraformLargeTemplate(t *testing.T) {
+	dir, err := ioutil.TempDir("", "terraform")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	cluster := &api.Cluster{ID: "aws:123456789012:eu-central-1:kube-1", Region: "eu-central-1"}
+	stacks := []*terraformStack{
+		{
+			Resource:     "kube-1",
+			Name:         "kube-1",
+			TemplateFile: "kube-1.template.json",
+			Template:     `{"Description": "` + strings.Repeat("x", stackMaxSize) + `"}`,
+		},
+		{
+			Resource:     "stack_1-nodepool",
+			Name:         "1-nodepool",
+			TemplateFile: "stack_1-nodepool.template.json",
+			Template:     `{"Resources": {}}`,
+		},
+	}
+	require.NoError(t, writeTerraform(dir, cluster, stacks))
+
+	config, err := ioutil.ReadFile(path.Join(dir, terraformMainFile))
+	require.NoError(t, err)
+	assert.Contains(t, string(config), "variable \"template_bucket\" {")
+	assert.Contains(t, string(config), `template_url  = "https://${var.template_bucket}.s3.eu-central-1.amazonaws.com/kube-1.template.json"`)
+	assert.Contains(t, string(config), `template_body = file("${path.module}/stack_1-nodepool.template.json")`)
+
+	instructions, err := ioutil.ReadFile(path.Join(dir, terraformInstructionsFile))
+	require.NoError(t, err)
+	assert.Contains(t, string(instructions), "aws s3 cp kube-1.template.json s3://<bucket>/kube-1.template.json")
+	assert.NotContains(t, string(instructions), "aws s3 cp stack_1-nodepool.template.json")
+	assert.Contains(t, string(instructions), "`terraform plan -var template_bucket=<bucket>`")
+	assert.Contains(t, string(instructions), "terraform import -var template_bucket=<bucket> aws_cloudformation_stack.kube-1 kube-1")
+}
+
+func TestHCLString(t *testing.T) {
+	for _, tc := range []struct {
+		value    string
+		expected string
+	}{
+		{value: "kube-1", expected: `"kube-1"`},
+		{value: `say "hi"`, expected: `"say \"hi\""`},
+		{value: "a\nb", expected: `"a\nb"`},
+		{value: "${var} %{if}", expected: `"$${var} %%{if}"`},
+		{value: "<&>", expected: `"<&>"`},
+	} {
+		assert.Equal(t, tc.expected, hclString(tc.value))
+	}
+}
@@ -0,0 +1,273 @@
+package provisioner
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/cenkalti/backoff"
+	"github.com/pkg/errors"
+	log "github.com/sirupsen/logrus"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
+)
+
+// throttlingErrorCodes are the error codes returned by the AWS APIs when
+// requests are rate limited.
+var throttlingErrorCodes = map[string]bool{
+	"Throttling":                             true,
+	"ThrottlingException":                    true,
+	"ThrottledException":                     true,
+	"RequestLimitExceeded":                   true,
+	"RequestThrottled":                       true,
+	"RequestThrottledException":              true,
+	"TooManyRequestsException":               true,
+	"ProvisionedThroughputExceededException": true,
+	"SlowDown":                               true,
+}
+
+// isThrottlingError returns true if the request failed because it was rate
+// limited by AWS.
+func isThrottlingError(err error) bool {
+	if aerr, ok := errors.Cause(err).(awserr.Error); ok {
+		return throttlingErrorCodes[aerr.Code()]
+	}
+	return false
+}
+
+// throttleRetrier retries AWS API calls failing because they were rate
+// limited, with exponential backoff and jitter. Unlike the retries of the
+// AWS SDK, whose intervals are kept short, it keeps retrying for minutes such
+// that many clusters can be provisioned concurrently within the limits of the
+// account.
+type throttleRetrier struct {
+	config config.ThrottleRetry
+	logger *log.Entry
+	// onRetry is called before every retry.
+	onRetry func()
+}
+
+// retry calls fn until it succeeds, fails with an error other than a
+// throttling error or the maximum elapsed time of the retries passed.
+func (r *throttleRetrier) retry(ctx aws.Context, operation string, fn func() error) error {
+	if r.config.MaxElapsedTime <= 0 {
+		return fn()
+	}
+
+	backoffCfg := backoff.NewExponentialBackOff()
+	backoffCfg.InitialInterval = r.config.InitialInterval
+	backoffCfg.MaxInterval = r.config.MaxInterval
+	backoffCfg.MaxElapsedTime = r.config.MaxElapsedTime
+	backoffCfg.RandomizationFactor = r.config.Jitter
+	backoffCfg.Reset()
+
+	return backoff.RetryNotify(func() error {
+		err := fn()
+		if err != nil && !isThrottlingError(err) {
+			return backoff.Permanent(err)
+		}
+		return err
+	}, backoff.WithContext(backoffCfg, ctx), func(err error, wait time.Duration) {
+		r.logger.Warnf("%s was throttled, retrying in %s: %v", operation, wait, err)
+		if r.onRetry != nil {
+			r.onRetry()
+		}
+	})
+}
+
+// throttledCloudFormation retries the calls of the wrapped client which fail
+// because of rate limits. DescribeStacksPages isn't retried as the pages
+// already seen would be passed to the callback again.
+type throttledCloudFormation struct {
+	cloudFormationAPI
+	retrier *throttleRetrier
+}
+
+func (c *throttledCloudFormation) DescribeStacks(input *cloudformation.DescribeStacksInput) (output *cloudformation.DescribeStacksOutput, err error) {
+	err = c.retrier.retry(context.Background(), "DescribeStacks", func() error {
+		output, err = c.cloudFormationAPI.DescribeStacks(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *throttledCloudFormation) CreateStackWithContext(ctx aws.Context, input *cloudformation.CreateStackInput, opts ...request.Option) (output *cloudformation.CreateStackOutput, err error) {
+	err = c.retrier.retry(ctx, "CreateStack", func() error {
+		output, err = c.cloudFormationAPI.CreateStackWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+func (c *throttledCloudFormation) CreateChangeSetWithContext(ctx aws.Context, input *cloudformation.CreateChangeSetInput, opts ...request.Option) (output *cloudformation.CreateChangeSetOutput, err error) {
+	err = c.retrier.retry(ctx, "CreateChangeSet", func() error {
+		output, err = c.cloudFormationAPI.CreateChangeSetWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+func (c *throttledCloudFormation) DescribeChangeSetWithContext(ctx aws.Context, input *cloudformation.DescribeChangeSetInput, opts ...request.Option) (output *cloudformation.DescribeChangeSetOutput, err error) {
+	err = c.retrier.retry(ctx, "DescribeChangeSet", func() error {
+		output, err = c.cloudFormationAPI.DescribeChangeSetWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+func (c *throttledCloudFormation) ExecuteChangeSetWithContext(ctx aws.Context, input *cloudformation.ExecuteChangeSetInput, opts ...request.Option) (output *cloudformation.ExecuteChangeSetOutput, err error) {
+	err = c.retrier.retry(ctx, "ExecuteChangeSet", func() error {
+		output, err = c.cloudFormationAPI.ExecuteChangeSetWithContext(ctx, input, opts...)
+		return err
+	})
+	return output, err
+}
+
+func (c *throttledCloudFormation) DeleteChangeSet(input *cloudformation.DeleteChangeSetInput) (output *cloudformation.DeleteChangeSetOutput, err error) {
+	err = c.retrier.retry(context.Background(), "DeleteChangeSet", func() error {
+		output, err = c.cloudFormationAPI.DeleteChangeSet(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *throttledCloudFormation) DeleteStack(input *cloudformation.DeleteStackInput) (output *cloudformation.DeleteStackOutput, err error) {
+	err = c.retrier.retry(context.Background(), "DeleteStack", func() error {
+		output, err = c.cloudFormationAPI.DeleteStack(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *throttledCloudFormation) UpdateTerminationProtection(input *cloudformation.UpdateTerminationProtectionInput) (output *cloudformation.UpdateTerminationProtectionOutput, err error) {
+	err = c.retrier.retry(context.Background(), "UpdateTerminationProtection", func() error {
+		output, err = c.cloudFormationAPI.UpdateTerminationProtection(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *throttledCloudFormation) GetTemplate(input *cloudformation.GetTemplateInput) (output *cloudformation.GetTemplateOutput, err error) {
+	err = c.retrier.retry(context.Background(), "GetTemplate", func() error {
+		output, err = c.cloudFormationAPI.GetTemplate(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *throttledCloudFormation) DescribeStackResources(input *cloudformation.DescribeStackResourcesInput) (output *cloudformation.DescribeStackResourcesOutput, err error) {
+	err = c.retrier.retry(context.Background(), "DescribeStackResources", func() error {
+		output, err = c.cloudFormationAPI.DescribeStackResources(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *throttledCloudFormation) DescribeStackEvents(input *cloudformation.DescribeStackEventsInput) (output *cloudformation.DescribeStackEventsOutput, err error) {
+	err = c.retrier.retry(context.Background(), "DescribeStackEvents", func() error {
+		output, err = c.cloudFormationAPI.DescribeStackEvents(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *throttledCloudFormation) ValidateTemplate(input *cloudformation.ValidateTemplateInput) (output *cloudformation.ValidateTemplateOutput, err error) {
+	err = c.retrier.retry(context.Background(), "ValidateTemplate", func() error {
+		output, err = c.cloudFormationAPI.ValidateTemplate(input)
+		return err
+	})
+	return output, err
+}
+
+// throttledS3 retries the calls of the wrapped client which fail because of
+// rate limits.
+type throttledS3 struct {
+	s3API
+	retrier *throttleRetrier
+}
+
+func (c *throttledS3) CreateBucket(input *s3.CreateBucketInput) (output *s3.CreateBucketOutput, err error) {
+	err = c.retrier.retry(context.Background(), "CreateBucket", func() error {
+		output, err = c.s3API.CreateBucket(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *throttledS3) PutBucketEncryption(input *s3.PutBucketEncryptionInput) (output *s3.PutBucketEncryptionOutput, err error) {
+	err = c.retrier.retry(context.Background(), "PutBucketEncryption", func() error {
+		output, err = c.s3API.PutBucketEncryption(input)
+		return err
+	})
+	return output, err
+}
+
+func (c *throttledS3) HeadBucket(input *s3.HeadBucketInput) (output *s3.HeadBucketOutput, err error) {
+	err = c.retrier.retry(context.Background(), "HeadBucket", func() error {
+		output, err = c.s3API.HeadBucket(input)
+		return err
+	})
+	return output, err
+}
+
+// throttledPublicAccessBlock retries the calls of the wrapped client which
+// fail because of rate limits.
+type throttledPublicAccessBlock struct {
+	publicAccessBlockAPI
+	retrier *throttleRetrier
+}
+
+func (c *throttledPublicAccessBlock) PutPublicAccessBlock(input *putPublicAccessBlockInput) (output *putPublicAccessBlockOutput, err error) {
+	err = c.retrier.retry(context.Background(), "PutPublicAccessBlock", func() error {
+		output, err = c.publicAccessBlockAPI.PutPublicAccessBlock(input)
+		return err
+	})
+	return output, err
+}
+
+// throttledS3Uploader retries uploads which fail because of rate limits. Only
+// uploads of seekable bodies are retried, which are rewound before every
+// attempt.
+type throttledS3Uploader struct {
+	s3UploaderAPI
+	retrier *throttleRetrier
+}
+
+func (u *throttledS3Uploader) UploadWithContext(ctx aws.Context, input *s3manager.UploadInput, options ...func(*s3manager.Uploader)) (output *s3manager.UploadOutput, err error) {
+	body, ok := input.Body.(io.Seeker)
+	if !ok {
+		return u.s3UploaderAPI.UploadWithContext(ctx, input, options...)
+	}
+
+	err = u.retrier.retry(ctx, "Upload", func() error {
+		_, err := body.Seek(0, io.SeekStart)
+		if err != nil {
+			return err
+		}
+		output, err = u.s3UploaderAPI.UploadWithContext(ctx, input, options...)
+		return err
+	})
+	return output, err
+}
+
+// retryThrottled wraps the CloudFormation and S3 clients of the adapter such
+// that their calls are retried when they fail because of rate limits.
+func (a *awsAdapter) retryThrottled(cfg config.ThrottleRetry) {
+	retrier := &throttleRetrier{
+		config: cfg,
+		logger: a.logger,
+		onRetry: func() {
+			a.summary.AddAWSRetry()
+		},
+	}
+	a.cloudformationClient = &throttledCloudFormation{cloudFormationAPI: a.cloudformationClient, retrier: retrier}
+	a.s3Client = &throttledS3{s3API: a.s3Client, retrier: retrier}
+	a.publicAccessBlockClient = &throttledPublicAccessBlock{publicAccessBlockAPI: a.publicAccessBlockClient, retrier: retrier}
+	a.s3Uploader = &throttledS3Uploader{s3UploaderAPI: a.s3Uploader, retrier: retrier}
+}
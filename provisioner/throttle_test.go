@@ -0,0 +1,130 @@
+package provisioner
+
+import (
+	"context"
+	"errors"
+	"io/ioutil"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/config"
+)
+
+var testThrottleRetry = config.ThrottleRetry{
+	InitialInterval: time.Millisecond,
+	MaxInterval:     5 * time.Millisecond,
+	MaxElapsedTime:  time.Second,
+	Jitter:          0.5,
+}
+
+// throttlingCloudFormationStub fails the first calls of ValidateTemplate with
+// the configured errors.
+type throttlingCloudFormationStub struct {
+	cloudFormationAPI
+	errs  []error
+	calls int
+}
+
+func (s *throttlingCloudFormationStub) ValidateTemplate(input *cloudformation.ValidateTemplateInput) (*cloudformation.ValidateTemplateOutput, error) {
+	s.calls++
+	if len(s.errs) > 0 {
+		err := s.errs[0]
+		s.errs = s.errs[1:]
+		return nil, err
+	}
+	return &cloudformation.ValidateTemplateOutput{}, nil
+}
+
+// throttlingS3UploaderStub fails the first uploads with a throttling error
+// after consuming the body.
+type throttlingS3UploaderStub struct {
+	failures int
+	bodies   []string
+}
+
+func (s *throttlingS3UploaderStub) UploadWithContext(ctx aws.Context, input *s3manager.UploadInput, options ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+	body, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	s.bodies = append(s.bodies, string(body))
+	if len(s.bodies) <= s.failures {
+		return nil, awserr.New("SlowDown", "Please reduce your request rate.", nil)
+	}
+	return &s3manager.UploadOutput{Location: "url"}, nil
+}
+
+func TestIsThrottlingError(t *testing.T) {
+	assert.True(t, isThrottlingError(awserr.New("Throttling", "Rate exceeded", nil)))
+	assert.True(t, isThrottlingError(awserr.New("RequestLimitExceeded", "Request limit exceeded.", nil)))
+	assert.False(t, isThrottlingError(awserr.New("ValidationError", "Template format error", nil)))
+	assert.False(t, isThrottlingError(errors.New("Throttling")))
+}
+
+func TestRetryThrottledCloudFormation(t *testing.T) {
+	throttled := awserr.New("Throttling", "Rate exceeded", nil)
+
+	// throttled calls are retried until they succeed.
+	stub := &throttlingCloudFormationStub{errs: []error{throttled, throttled}}
+	adapter := newAWSAdapterWithStubs("", "")
+	adapter.cloudformationClient = stub
+	adapter.retryThrottled(testThrottleRetry)
+
+	_, err := adapter.cloudformationClient.ValidateTemplate(&cloudformation.ValidateTemplateInput{})
+	require.NoError(t, err)
+	assert.Equal(t, 3, stub.calls)
+
+	// other errors aren't retried.
+	invalid := awserr.New("ValidationError", "Template format error", nil)
+	stub.calls = 0
+	stub.errs = []error{invalid, throttled}
+	_, err = adapter.cloudformationClient.ValidateTemplate(&cloudformation.ValidateTemplateInput{})
+	assert.Equal(t, invalid, err)
+	assert.Equal(t, 1, stub.calls)
+
+	// the retries stop after the max elapsed time.
+	stub.calls = 0
+	stub.errs = make([]error, 1000)
+	for i := range stub.errs {
+		stub.errs[i] = throttled
+	}
+	cfg := testThrottleRetry
+	cfg.MaxElapsedTime = 20 * time.Millisecond
+	adapter.cloudformationClient = stub
+	adapter.retryThrottled(cfg)
+	_, err = adapter.cloudformationClient.ValidateTemplate(&cloudformation.ValidateTemplateInput{})
+	assert.Equal(t, throttled, err)
+	assert.True(t, stub.calls > 1)
+	assert.True(t, stub.calls < 1000)
+
+	// the retries are disabled without max elapsed time.
+	stub.calls = 0
+	stub.errs = []error{throttled}
+	adapter.cloudformationClient = stub
+	adapter.retryThrottled(config.ThrottleRetry{})
+	_, err = adapter.cloudformationClient.ValidateTemplate(&cloudformation.ValidateTemplateInput{})
+	assert.Equal(t, throttled, err)
+	assert.Equal(t, 1, stub.calls)
+}
+
+func TestRetryThrottledUpload(t *testing.T) {
+	stub := &throttlingS3UploaderStub{failures: 2}
+	adapter := newAWSAdapterWithStubs("", "")
+	adapter.s3Uploader = stub
+	adapter.retryThrottled(testThrottleRetry)
+
+	// the body is rewound before every attempt.
+	_, err := adapter.s3Uploader.UploadWithContext(context.Background(), &s3manager.UploadInput{
+		Body: strings.NewReader("userdata"),
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{"userdata", "userdata", "userdata"}, stub.bodies)
+}
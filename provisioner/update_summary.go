@@ -0,0 +1,79 @@
+package provisioner
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+// updateSummaryKeyFmt is the S3 key of the summary of the last provisioning
+// of a cluster.
+const updateSummaryKeyFmt = "%s.update-summary.json"
+
+// skipNodePools records in the summary that none of the node pools of the
+// cluster were updated.
+func skipNodePools(summary *api.UpdateSummary, cluster *api.Cluster, reason string) {
+	for _, nodePool := range cluster.NodePools {
+		summary.SkipNodePool(nodePool.Name, reason)
+	}
+}
+
+// abortNodePoolUpdates returns true if the failure of a node pool aborts the
+// update of the remaining node pools, which is the case for master node
+// pools: the workers aren't rolled with a broken master configuration. The
+// remaining node pools are recorded as skipped in the summary.
+func abortNodePoolUpdates(summary *api.UpdateSummary, failed *api.NodePool, remaining []*api.NodePool) bool {
+	if !strings.HasPrefix(failed.Profile, "master") {
+		return false
+	}
+
+	for _, nodePool := range remaining {
+		summary.SkipNodePool(nodePool.Name, fmt.Sprintf("master node pool %s failed", failed.Name))
+	}
+	return true
+}
+
+// saveUpdateSummary uploads the summary of the provisioning next to the
+// stack template of the cluster, such that it's kept even if the registry
+// can't be updated. Failing to save the summary doesn't fail the
+// provisioning.
+func (a *awsAdapter) saveUpdateSummary(ctx context.Context, cluster *api.Cluster, summary *api.UpdateSummary) {
+	if summary == nil || a.dryRun {
+		return
+	}
+
+	data, err := summary.JSON()
+	if err != nil {
+		a.logger.Warnf("Failed to encode the update summary: %v", err)
+		return
+	}
+
+	bucketName, err := clmBucketName(cluster)
+	if err != nil {
+		a.logger.Warnf("Failed to save the update summary: %v", err)
+		return
+	}
+
+	err = a.createS3Bucket(bucketName)
+	if err != nil {
+		a.logger.Warnf("Failed to save the update summary: %v", err)
+		return
+	}
+
+	_, err = a.s3Uploader.UploadWithContext(ctx, &s3manager.UploadInput{
+		Bucket:      aws.String(bucketName),
+		Key:         aws.String(fmt.Sprintf(updateSummaryKeyFmt, cluster.ID)),
+		Body:        bytes.NewReader(data),
+		ContentType: aws.String("application/json"),
+		Tagging:     s3Tagging(a.costTags),
+	})
+	if err != nil {
+		a.logger.Warnf("Failed to save the update summary: %v", err)
+	}
+}
@@ -0,0 +1,25 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestAbortNodePoolUpdates(t *testing.T) {
+	master := &api.NodePool{Name: "default-master", Profile: "master-default"}
+	worker := &api.NodePool{Name: "default-worker", Profile: "worker-default"}
+	other := &api.NodePool{Name: "other-worker", Profile: "worker-default"}
+
+	summary := api.NewUpdateSummary(nil)
+	assert.False(t, abortNodePoolUpdates(summary, worker, []*api.NodePool{other}))
+	assert.Len(t, summary.NodePools, 0)
+
+	assert.True(t, abortNodePoolUpdates(summary, master, []*api.NodePool{worker, other}))
+	assert.Len(t, summary.NodePools, 2)
+	for _, nodePool := range summary.NodePools {
+		assert.Equal(t, api.UpdateOutcomeSkipped, nodePool.Outcome)
+		assert.Equal(t, "master node pool default-master failed", nodePool.Reason)
+	}
+}
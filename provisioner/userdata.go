@@ -0,0 +1,185 @@
+package provisioner
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/ghodss/yaml"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	userDataCompressionConfigItemKey  = "userdata_compression"
+	userDataReadableKeysConfigItemKey = "userdata_readable_keys"
+	userDataCompressionNone           = "none"
+	userDataCompressionGzip           = "gzip"
+	// maxUserDataSize is the maximum size of the EC2 user data before it's
+	// base64 encoded.
+	maxUserDataSize = 16384
+	// ignitionPointerFile is the file in the directory of a node pool
+	// profile with additional settings of the ignition pointer config.
+	ignitionPointerFile    = "ignition-pointer.yaml"
+	ignitionPointerVersion = "2.1.0"
+)
+
+// userDataCompressions are the supported compressions of the Container Linux
+// Config user data.
+var userDataCompressions = map[string]func(data []byte) ([]byte, error){
+	userDataCompressionNone: func(data []byte) ([]byte, error) { return data, nil },
+	userDataCompressionGzip: gzipData,
+}
+
+// userDataCompression returns the compression of the user data configured for
+// the cluster. The user data isn't compressed by default.
+func userDataCompression(cluster *api.Cluster) (func(data []byte) ([]byte, error), error) {
+	name, ok := cluster.ConfigItems[userDataCompressionConfigItemKey]
+	if !ok {
+		name = userDataCompressionNone
+	}
+
+	compress, ok := userDataCompressions[name]
+	if !ok {
+		return nil, fmt.Errorf("unsupported %s '%s'", userDataCompressionConfigItemKey, name)
+	}
+	return compress, nil
+}
+
+// gzipData gzip compresses data.
+func gzipData(data []byte) ([]byte, error) {
+	var buf bytes.Buffer
+	gz := gzip.NewWriter(&buf)
+	_, err := gz.Write(data)
+	if err != nil {
+		return nil, err
+	}
+	err = gz.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// checkUserDataSize returns an error if the base64 encoded user data of the
+// node pool exceeds the EC2 user data limit, which would otherwise only fail
+// when the instances are launched.
+func checkUserDataSize(nodePool *api.NodePool, encodedUserData string) error {
+	userData, err := base64.StdEncoding.DecodeString(encodedUserData)
+	if err != nil {
+		return err
+	}
+
+	if len(userData) > maxUserDataSize {
+		return fmt.Errorf("userdata of node pool %s (profile %s) is %d bytes, exceeding the EC2 limit of %d bytes", nodePool.Name, nodePool.Profile, len(userData), maxUserDataSize)
+	}
+
+	return nil
+}
+
+// userDataObject describes the S3 object the userdata of a node pool is
+// uploaded to, such that the object a node booted from can be traced back to
+// the cluster, node pool and channel version it was rendered for.
+type userDataObject struct {
+	keyPrefix string
+	metadata  map[string]*string
+}
+
+// newUserDataObject returns the S3 object description of the userdata of a
+// node pool rendered at the specified time. If the cluster enables readable
+// keys or restricts the reads of its userdata, the objects are prefixed with
+// the local ID of the cluster and the name of the node pool.
+func newUserDataObject(cluster *api.Cluster, nodePool *api.NodePool, renderedAt time.Time) *userDataObject {
+	metadata := map[string]*string{
+		"cluster":     aws.String(cluster.ID),
+		"node-pool":   aws.String(nodePool.Name),
+		"profile":     aws.String(nodePool.Profile),
+		"rendered-at": aws.String(renderedAt.UTC().Format(time.RFC3339)),
+	}
+
+	// the channel version is the first part of the version the cluster is
+	// being updated to.
+	if cluster.Status != nil && cluster.Status.NextVersion != "" {
+		metadata["channel-version"] = aws.String(strings.SplitN(cluster.Status.NextVersion, "#", 2)[0])
+	}
+
+	object := &userDataObject{metadata: metadata}
+	if cluster.ConfigItems[userDataReadableKeysConfigItemKey] == "true" || clmBucketRestrictReads(cluster) {
+		object.keyPrefix = fmt.Sprintf("%s/%s/", cluster.LocalID, nodePool.Name)
+	}
+	return object
+}
+
+// key returns the key of the object storing userdata with the specified
+// hash.
+func (o *userDataObject) key(hash string) string {
+	if o == nil {
+		return fmt.Sprintf("%s.userdata", hash)
+	}
+	return fmt.Sprintf("%s%s.userdata", o.keyPrefix, hash)
+}
+
+// ignitionPointerConfig returns the ignition config replacing itself with the
+// config at source. The ignition settings of the node pool profile, e.g.
+// timeouts, TLS certificate authorities or a proxy needed to fetch the config,
+// are rendered with the config like the userdata and added to the pointer
+// config. The profile can't override the config source. Ignition v3 can only
+// replace a config with one of the same major spec version, so the pointer
+// config of userdata with spec version userDataVersion defaults to that
+// version unless it's ignition v2.
+func ignitionPointerConfig(extensionPath string, config map[string]string, typed Values, source, userDataVersion string) ([]byte, error) {
+	version := ignitionPointerVersion
+	if ignitionMajorVersion(userDataVersion) != ignitionMajorVersion(ignitionPointerVersion) {
+		version = userDataVersion
+	}
+
+	ignition := map[string]interface{}{
+		"version": version,
+	}
+
+	if extensionPath != "" {
+		_, err := os.Stat(extensionPath)
+		if err != nil && !os.IsNotExist(err) {
+			return nil, err
+		}
+
+		if err == nil {
+			rendered, err := renderUserData(extensionPath, config, typed)
+			if err != nil {
+				return nil, err
+			}
+
+			var extension map[string]interface{}
+			err = yaml.Unmarshal([]byte(rendered), &extension)
+			if err != nil {
+				return nil, fmt.Errorf("failed to parse %s: %v", extensionPath, err)
+			}
+
+			for key, value := range extension {
+				if key == "config" {
+					return nil, fmt.Errorf("invalid %s: the config of the ignition pointer config can't be set", extensionPath)
+				}
+				ignition[key] = value
+			}
+		}
+	}
+
+	if version, ok := ignition["version"].(string); !ok || ignitionMajorVersion(version) != ignitionMajorVersion(userDataVersion) {
+		return nil, fmt.Errorf("invalid %s: ignition pointer config version %v doesn't match the userdata spec version %s", extensionPath, ignition["version"], userDataVersion)
+	}
+
+	ignition["config"] = map[string]interface{}{
+		"replace": map[string]interface{}{
+			"source": source,
+		},
+	}
+
+	return json.MarshalIndent(map[string]interface{}{"ignition": ignition}, "", "  ")
+}
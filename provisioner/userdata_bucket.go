@@ -0,0 +1,213 @@
+package provisioner
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	userDataBucketConfigItemKey           = "userdata_bucket"
+	userDataBucketRegionConfigItemKey     = "userdata_bucket_region"
+	userDataReplicaBucketConfigItemKey    = "userdata_replica_bucket"
+	userDataReplicationRoleConfigItemKey  = "userdata_replication_role"
+	userDataReplicaKMSKeyConfigItemKey    = "userdata_replica_kms_key"
+	userDataReplicationRuleID             = "cluster-lifecycle-manager-userdata"
+	userDataReplicationTimeout            = 15 * time.Minute
+	userDataReplicationStatusPollInterval = 10 * time.Second
+)
+
+// userDataBucket is the S3 bucket the userdata of the node pools is uploaded
+// to. By default it's the bucket of CLM in the account and region of the
+// cluster, which is created if it doesn't exist. External buckets, e.g. in
+// another account or region, must exist and the uploaded objects are owned
+// by the bucket owner.
+type userDataBucket struct {
+	name     string
+	region   string
+	external bool
+	// replica is the bucket the userdata is replicated to, such that
+	// nodes can boot from it if S3 is degraded in the region of the
+	// bucket. It's nil if the userdata isn't replicated.
+	replica *userDataReplica
+	// source is how the nodes pull the userdata from the bucket. It's
+	// nil if they pull it from S3.
+	source *userDataSource
+}
+
+// userDataReplica is the destination of the replication of the userdata
+// bucket. The replicated objects are encrypted with kmsKey and replicated
+// by role.
+type userDataReplica struct {
+	bucket string
+	role   string
+	kmsKey string
+}
+
+// newUserDataBucket returns the userdata bucket configured for the cluster.
+func newUserDataBucket(cluster *api.Cluster) (*userDataBucket, error) {
+	name, err := clmBucketName(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	bucket := &userDataBucket{
+		name:   name,
+		region: cluster.Region,
+	}
+
+	if name, ok := cluster.ConfigItems[userDataBucketConfigItemKey]; ok {
+		bucket.name = name
+		bucket.external = true
+	}
+
+	if region, ok := cluster.ConfigItems[userDataBucketRegionConfigItemKey]; ok {
+		if !bucket.external {
+			return nil, fmt.Errorf("%s requires %s", userDataBucketRegionConfigItemKey, userDataBucketConfigItemKey)
+		}
+		bucket.region = region
+	}
+
+	source, err := newUserDataSource(cluster)
+	if err != nil {
+		return nil, err
+	}
+	bucket.source = source
+
+	replica := &userDataReplica{
+		bucket: cluster.ConfigItems[userDataReplicaBucketConfigItemKey],
+		role:   cluster.ConfigItems[userDataReplicationRoleConfigItemKey],
+		kmsKey: cluster.ConfigItems[userDataReplicaKMSKeyConfigItemKey],
+	}
+
+	switch {
+	case replica.bucket == "" && replica.role == "" && replica.kmsKey == "":
+		return bucket, nil
+	case replica.bucket == "" || replica.role == "" || replica.kmsKey == "":
+		return nil, fmt.Errorf("%s, %s and %s must be set together", userDataReplicaBucketConfigItemKey, userDataReplicationRoleConfigItemKey, userDataReplicaKMSKeyConfigItemKey)
+	case replica.bucket == bucket.name:
+		return nil, fmt.Errorf("%s must be different from the userdata bucket %s", userDataReplicaBucketConfigItemKey, bucket.name)
+	}
+
+	bucket.replica = replica
+	return bucket, nil
+}
+
+// userDataS3Client returns the S3 client for the region of the bucket.
+func (a *awsAdapter) userDataS3Client(bucket *userDataBucket) s3API {
+	if bucket.region == "" || bucket.region == a.region {
+		return a.s3Client
+	}
+	return s3.New(a.session, aws.NewConfig().WithRegion(bucket.region))
+}
+
+// userDataUploadOptions returns the options of the uploader uploading to the
+// bucket, which sends the requests to the region of the bucket.
+func (a *awsAdapter) userDataUploadOptions(bucket *userDataBucket) []func(*s3manager.Uploader) {
+	if bucket.region == "" || bucket.region == a.region {
+		return nil
+	}
+	return []func(*s3manager.Uploader){
+		func(u *s3manager.Uploader) {
+			u.S3 = s3.New(a.session, aws.NewConfig().WithRegion(bucket.region))
+		},
+	}
+}
+
+// ensureUserDataReplication enables versioning of the userdata bucket and
+// replicates all its objects, including the SSE-KMS encrypted ones, to the
+// replica bucket. The replica bucket must exist with versioning enabled and
+// allow the replication role to replicate into it.
+func (a *awsAdapter) ensureUserDataReplication(bucket *userDataBucket) error {
+	if bucket.replica == nil {
+		return nil
+	}
+
+	if a.skipReadOnly("replicating userdata bucket %s to %s", bucket.name, bucket.replica.bucket) {
+		return nil
+	}
+
+	client := a.userDataS3Client(bucket)
+
+	_, err := client.PutBucketVersioning(&s3.PutBucketVersioningInput{
+		Bucket: aws.String(bucket.name),
+		VersioningConfiguration: &s3.VersioningConfiguration{
+			Status: aws.String(s3.BucketVersioningStatusEnabled),
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to enable versioning of userdata bucket %s: %v", bucket.name, err)
+	}
+
+	_, err = client.PutBucketReplication(&s3.PutBucketReplicationInput{
+		Bucket: aws.String(bucket.name),
+		ReplicationConfiguration: &s3.ReplicationConfiguration{
+			Role: aws.String(bucket.replica.role),
+			Rules: []*s3.ReplicationRule{
+				{
+					ID:     aws.String(userDataReplicationRuleID),
+					Prefix: aws.String(""),
+					Status: aws.String(s3.ReplicationRuleStatusEnabled),
+					SourceSelectionCriteria: &s3.SourceSelectionCriteria{
+						SseKmsEncryptedObjects: &s3.SseKmsEncryptedObjects{
+							Status: aws.String(s3.SseKmsEncryptedObjectsStatusEnabled),
+						},
+					},
+					Destination: &s3.Destination{
+						Bucket: aws.String(fmt.Sprintf("arn:aws:s3:::%s", bucket.replica.bucket)),
+						EncryptionConfiguration: &s3.EncryptionConfiguration{
+							ReplicaKmsKeyID: aws.String(bucket.replica.kmsKey),
+						},
+					},
+				},
+			},
+		},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to configure the replication of userdata bucket %s: %v", bucket.name, err)
+	}
+	return nil
+}
+
+// waitForUserDataReplication waits until the version of the object was
+// replicated to the replica bucket, such that the nodes can boot from the
+// replica as soon as they're launched.
+func (a *awsAdapter) waitForUserDataReplication(ctx context.Context, bucket *userDataBucket, key, versionID string) error {
+	if bucket.replica == nil {
+		return nil
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, userDataReplicationTimeout)
+	defer cancel()
+
+	client := a.userDataS3Client(bucket)
+	for {
+		resp, err := client.HeadObject(&s3.HeadObjectInput{
+			Bucket:    aws.String(bucket.name),
+			Key:       aws.String(key),
+			VersionId: aws.String(versionID),
+		})
+		if err != nil {
+			return err
+		}
+
+		switch aws.StringValue(resp.ReplicationStatus) {
+		case s3.ReplicationStatusComplete:
+			return nil
+		case s3.ReplicationStatusFailed:
+			return fmt.Errorf("failed to replicate userdata s3://%s/%s to bucket %s", bucket.name, key, bucket.replica.bucket)
+		}
+
+		select {
+		case <-ctx.Done():
+			return fmt.Errorf("userdata s3://%s/%s wasn't replicated to bucket %s: %v", bucket.name, key, bucket.replica.bucket, ctx.Err())
+		case <-time.After(userDataReplicationStatusPollInterval):
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package provisioner
+
+import (
+	"context"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type replicationS3APIStub struct {
+	s3API
+	versioning        *s3.PutBucketVersioningInput
+	replication       *s3.PutBucketReplicationInput
+	replicationStatus string
+	headObjectInput   *s3.HeadObjectInput
+	created           []string
+}
+
+func (s *replicationS3APIStub) CreateBucket(input *s3.CreateBucketInput) (*s3.CreateBucketOutput, error) {
+	s.created = append(s.created, aws.StringValue(input.Bucket))
+	return nil, nil
+}
+
+func (s *replicationS3APIStub) PutBucketEncryption(input *s3.PutBucketEncryptionInput) (*s3.PutBucketEncryptionOutput, error) {
+	return nil, nil
+}
+
+func (s *replicationS3APIStub) PutBucketVersioning(input *s3.PutBucketVersioningInput) (*s3.PutBucketVersioningOutput, error) {
+	s.versioning = input
+	return nil, nil
+}
+
+func (s *replicationS3APIStub) PutBucketReplication(input *s3.PutBucketReplicationInput) (*s3.PutBucketReplicationOutput, error) {
+	s.replication = input
+	return nil, nil
+}
+
+func (s *replicationS3APIStub) HeadObject(input *s3.HeadObjectInput) (*s3.HeadObjectOutput, error) {
+	s.headObjectInput = input
+	return &s3.HeadObjectOutput{ReplicationStatus: aws.String(s.replicationStatus)}, nil
+}
+
+type versionedS3UploaderAPIStub struct {
+	input *s3manager.UploadInput
+}
+
+func (s *versionedS3UploaderAPIStub) UploadWithContext(ctx aws.Context, input *s3manager.UploadInput, options ...func(*s3manager.Uploader)) (*s3manager.UploadOutput, error) {
+	s.input = input
+	return &s3manager.UploadOutput{Location: "url", VersionID: aws.String("v1")}, nil
+}
+
+func TestNewUserDataBucket(t *testing.T) {
+	replicaItems := map[string]string{
+		userDataReplicaBucketConfigItemKey:   "userdata-replica",
+		userDataReplicationRoleConfigItemKey: "arn:aws:iam::123456789012:role/replication",
+		userDataReplicaKMSKeyConfigItemKey:   "arn:aws:kms:eu-west-1:123456789012:key/replica",
+	}
+
+	for _, tc := range []struct {
+		msg         string
+		configItems map[string]string
+		expected    *userDataBucket
+	}{
+		{
+			msg:      "CLM bucket by default",
+			expected: &userDataBucket{name: "cluster-lifecycle-manager-123456789012-eu-central-1", region: "eu-central-1"},
+		},
+		{
+			msg: "external bucket in another region",
+			configItems: map[string]string{
+				userDataBucketConfigItemKey:       "userdata",
+				userDataBucketRegionConfigItemKey: "eu-west-1",
+			},
+			expected: &userDataBucket{name: "userdata", region: "eu-west-1", external: true},
+		},
+		{
+			msg:         "replicated CLM bucket",
+			configItems: replicaItems,
+			expected: &userDataBucket{
+				name:   "cluster-lifecycle-manager-123456789012-eu-central-1",
+				region: "eu-central-1",
+				replica: &userDataReplica{
+					bucket: "userdata-replica",
+					role:   "arn:aws:iam::123456789012:role/replication",
+					kmsKey: "arn:aws:kms:eu-west-1:123456789012:key/replica",
+				},
+			},
+		},
+		{
+			msg:         "region of the CLM bucket",
+			configItems: map[string]string{userDataBucketRegionConfigItemKey: "eu-west-1"},
+		},
+		{
+			msg:         "replica bucket without replication role",
+			configItems: map[string]string{userDataReplicaBucketConfigItemKey: "userdata-replica"},
+		},
+		{
+			msg: "replica bucket is the userdata bucket",
+			configItems: map[string]string{
+				userDataBucketConfigItemKey:          "userdata-replica",
+				userDataReplicaBucketConfigItemKey:   replicaItems[userDataReplicaBucketConfigItemKey],
+				userDataReplicationRoleConfigItemKey: replicaItems[userDataReplicationRoleConfigItemKey],
+				userDataReplicaKMSKeyConfigItemKey:   replicaItems[userDataReplicaKMSKeyConfigItemKey],
+			},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			cluster := &api.Cluster{
+				InfrastructureAccount: "aws:123456789012",
+				Region:                "eu-central-1",
+				ConfigItems:           tc.configItems,
+			}
+
+			bucket, err := newUserDataBucket(cluster)
+			if tc.expected == nil {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, bucket)
+		})
+	}
+}
+
+func TestEnsureUserDataReplication(t *testing.T) {
+	client := &replicationS3APIStub{}
+	a := &awsAdapter{s3Client: client, publicAccessBlockClient: &publicAccessBlockAPIStub{}, region: "eu-central-1", logger: log.WithField("cluster", "kube-1")}
+
+	bucket := &userDataBucket{
+		name:   "userdata",
+		region: "eu-central-1",
+		replica: &userDataReplica{
+			bucket: "userdata-replica",
+			role:   "arn:aws:iam::123456789012:role/replication",
+			kmsKey: "arn:aws:kms:eu-west-1:123456789012:key/replica",
+		},
+	}
+
+	require.NoError(t, a.ensureUserDataReplication(bucket))
+	require.NotNil(t, client.versioning)
+	assert.Equal(t, s3.BucketVersioningStatusEnabled, aws.StringValue(client.versioning.VersioningConfiguration.Status))
+
+	require.NotNil(t, client.replication)
+	config := client.replication.ReplicationConfiguration
+	assert.Equal(t, "arn:aws:iam::123456789012:role/replication", aws.StringValue(config.Role))
+	require.Len(t, config.Rules, 1)
+	assert.Equal(t, "arn:aws:s3:::userdata-replica", aws.StringValue(config.Rules[0].Destination.Bucket))
+	assert.Equal(t, "arn:aws:kms:eu-west-1:123456789012:key/replica", aws.StringValue(config.Rules[0].Destination.EncryptionConfiguration.ReplicaKmsKeyID))
+
+	// buckets without replica aren't changed.
+	client = &replicationS3APIStub{}
+	a.s3Client = client
+	require.NoError(t, a.ensureUserDataReplication(&userDataBucket{name: "userdata"}))
+	assert.Nil(t, client.versioning)
+	assert.Nil(t, client.replication)
+}
+
+func TestUploadUserDataToExternalBucket(t *testing.T) {
+	for _, tc := range []struct {
+		msg               string
+		replicationStatus string
+		success           bool
+	}{
+		{
+			msg:               "replicated userdata",
+			replicationStatus: s3.ReplicationStatusComplete,
+			success:           true,
+		},
+		{
+			msg:               "failed replication",
+			replicationStatus: s3.ReplicationStatusFailed,
+			success:           false,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			client := &replicationS3APIStub{replicationStatus: tc.replicationStatus}
+			uploader := &versionedS3UploaderAPIStub{}
+			a := &awsAdapter{s3Client: client, publicAccessBlockClient: &publicAccessBlockAPIStub{}, s3Uploader: uploader, region: "eu-central-1", logger: log.WithField("cluster", "kube-1")}
+
+			bucket := &userDataBucket{
+				name:     "userdata",
+				region:   "eu-central-1",
+				external: true,
+				replica:  &userDataReplica{bucket: "userdata-replica"},
+			}
+
+			uri, err := a.uploadUserDataToS3(context.Background(), []byte("userdata"), bucket, "", nil)
+			if !tc.success {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Contains(t, uri, "s3://userdata/")
+
+			// external buckets aren't created and the objects are owned
+			// by the bucket owner.
+			assert.Empty(t, client.created)
+			assert.Equal(t, s3.ObjectCannedACLBucketOwnerFullControl, aws.StringValue(uploader.input.ACL))
+
+			require.NotNil(t, client.headObjectInput)
+			assert.Equal(t, "v1", aws.StringValue(client.headObjectInput.VersionId))
+		})
+	}
+}
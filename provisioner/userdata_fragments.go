@@ -0,0 +1,176 @@
+package provisioner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/cbroglie/mustache"
+	"gopkg.in/yaml.v2"
+)
+
+const (
+	// clcFileSuffix is the suffix of Container Linux Config files.
+	clcFileSuffix = ".clc.yaml"
+	// userDataFragmentsDir is the directory in the directory of a node
+	// pool profile with Container Linux Config fragments which are
+	// merged into the userdata of the node pool.
+	userDataFragmentsDir = "userdata.d"
+	// generatedFileMode is the mode of the files generated by CLM, 0644.
+	generatedFileMode = 420
+)
+
+// generatedFile is a file generated by CLM from the cluster or node pool
+// config and added to the userdata of a node pool, such that profiles don't
+// need to template it.
+type generatedFile struct {
+	Path     string
+	Contents string
+}
+
+// userDataFragments returns the Container Linux Config fragments of a node
+// pool profile and its base profiles, sorted by their file names. A fragment
+// of a profile overrides the fragment with the same name of its base
+// profiles.
+func userDataFragments(dirs []string) ([]string, error) {
+	fragments := make(map[string]string)
+	for i := len(dirs) - 1; i >= 0; i-- {
+		files, err := ioutil.ReadDir(path.Join(dirs[i], userDataFragmentsDir))
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			return nil, err
+		}
+
+		for _, file := range files {
+			if file.IsDir() || !strings.HasSuffix(file.Name(), clcFileSuffix) {
+				continue
+			}
+			fragments[file.Name()] = path.Join(dirs[i], userDataFragmentsDir, file.Name())
+		}
+	}
+
+	names := make([]string, 0, len(fragments))
+	for name := range fragments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	files := make([]string, 0, len(names))
+	for _, name := range names {
+		files = append(files, fragments[name])
+	}
+	return files, nil
+}
+
+// mergeUserDataFragments renders the Container Linux Config fragments of the
+// profile directories and merges them in order into the rendered userdata.
+// The userdata is returned as it is if the profile doesn't have any
+// fragments.
+func mergeUserDataFragments(rendered string, dirs []string, partials mustache.PartialProvider, values map[string]interface{}) (string, error) {
+	fragments, err := userDataFragments(dirs)
+	if err != nil {
+		return "", err
+	}
+
+	if len(fragments) == 0 {
+		return rendered, nil
+	}
+
+	merged := make(map[interface{}]interface{})
+	err = yaml.Unmarshal([]byte(rendered), &merged)
+	if err != nil {
+		return "", fmt.Errorf("invalid userdata: %v", err)
+	}
+
+	for _, file := range fragments {
+		tmpl, err := mustache.ParseFilePartials(file, partials)
+		if err != nil {
+			return "", err
+		}
+
+		fragment, err := tmpl.Render(values)
+		if err != nil {
+			return "", err
+		}
+
+		var overlay map[interface{}]interface{}
+		err = yaml.Unmarshal([]byte(fragment), &overlay)
+		if err != nil {
+			return "", fmt.Errorf("invalid userdata fragment %s: %v", file, err)
+		}
+		mergeUserDataFragment(merged, overlay)
+	}
+
+	data, err := yaml.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
+
+// mergeUserDataFragment merges a Container Linux Config fragment into base.
+// Nested maps are merged and lists are appended, such that fragments can add
+// files, units and users. All other values are replaced.
+func mergeUserDataFragment(base, overlay map[interface{}]interface{}) {
+	for key, value := range overlay {
+		switch v := value.(type) {
+		case map[interface{}]interface{}:
+			if baseMap, ok := base[key].(map[interface{}]interface{}); ok {
+				mergeUserDataFragment(baseMap, v)
+				continue
+			}
+		case []interface{}:
+			if baseList, ok := base[key].([]interface{}); ok {
+				base[key] = append(baseList, v...)
+				continue
+			}
+		}
+		base[key] = value
+	}
+}
+
+// addGeneratedFiles adds the generated files to a rendered Container Linux
+// Config or Butane config. The files of a Butane config overwrite existing
+// files. The userdata is returned as it is if there are no files, such that
+// it doesn't change for node pools without generated files.
+func addGeneratedFiles(rendered string, butane bool, files []*generatedFile) (string, error) {
+	if len(files) == 0 {
+		return rendered, nil
+	}
+
+	entries := make([]interface{}, 0, len(files))
+	for _, file := range files {
+		entry := map[interface{}]interface{}{
+			"path":     file.Path,
+			"mode":     generatedFileMode,
+			"contents": map[interface{}]interface{}{"inline": file.Contents},
+		}
+		if butane {
+			entry["overwrite"] = true
+		} else {
+			entry["filesystem"] = "root"
+		}
+		entries = append(entries, entry)
+	}
+
+	merged := make(map[interface{}]interface{})
+	err := yaml.Unmarshal([]byte(rendered), &merged)
+	if err != nil {
+		return "", fmt.Errorf("invalid userdata: %v", err)
+	}
+
+	mergeUserDataFragment(merged, map[interface{}]interface{}{
+		"storage": map[interface{}]interface{}{"files": entries},
+	})
+
+	data, err := yaml.Marshal(merged)
+	if err != nil {
+		return "", err
+	}
+	return string(data), nil
+}
@@ -0,0 +1,86 @@
+package provisioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+	"gopkg.in/yaml.v2"
+)
+
+func TestUserDataFragments(t *testing.T) {
+	basePath, err := ioutil.TempDir("", "profiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(basePath)
+
+	writeProfileFiles(t, basePath, map[string]string{
+		"worker.clc.yaml":      "storage:\n  files:\n  - path: /etc/base\nlocksmith:\n  reboot_strategy: reboot",
+		"userdata-worker.yaml": "#cloud-config",
+		"kubelet.yaml":         "  - name: kubelet.service",
+		"node-pools/worker-default/userdata.d/10-os.clc.yaml":      "storage:\n  files:\n  - path: /etc/os\n",
+		"node-pools/worker-default/userdata.d/20-kubelet.clc.yaml": "systemd:\n  units:\n{{> kubelet.yaml}}",
+		"node-pools/worker-default/userdata.d/README.md":           "not a fragment",
+		"node-pools/worker-team/profile.yaml":                      "base: worker-default",
+		"node-pools/worker-team/userdata.d/10-os.clc.yaml":         "storage:\n  files:\n  - path: /etc/{{TEAM}}\n",
+		"node-pools/worker-team/userdata.d/30-extras.clc.yaml":     "locksmith:\n  reboot_strategy: etcd-lock",
+		"node-pools/worker-invalid/userdata.d/10-os.clc.yaml":      "storage: [",
+	})
+
+	config := map[string]string{"TEAM": "team"}
+	file := path.Join(basePath, "worker.clc.yaml")
+
+	rendered, err := renderProfileUserData(file, "worker-default", config, nil)
+	require.NoError(t, err)
+
+	var userData map[string]interface{}
+	require.NoError(t, yaml.Unmarshal([]byte(rendered), &userData))
+	assert.Equal(t, map[string]interface{}{
+		"storage": map[interface{}]interface{}{
+			"files": []interface{}{
+				map[interface{}]interface{}{"path": "/etc/base"},
+				map[interface{}]interface{}{"path": "/etc/os"},
+			},
+		},
+		"systemd": map[interface{}]interface{}{
+			"units": []interface{}{
+				map[interface{}]interface{}{"name": "kubelet.service"},
+			},
+		},
+		"locksmith": map[interface{}]interface{}{"reboot_strategy": "reboot"},
+	}, userData)
+
+	// fragments of a profile override the ones of its base profile with
+	// the same name and are merged in the order of their names.
+	rendered, err = renderProfileUserData(file, "worker-team", config, nil)
+	require.NoError(t, err)
+
+	userData = nil
+	require.NoError(t, yaml.Unmarshal([]byte(rendered), &userData))
+	assert.Equal(t, []interface{}{
+		map[interface{}]interface{}{"path": "/etc/base"},
+		map[interface{}]interface{}{"path": "/etc/team"},
+	}, userData["storage"].(map[interface{}]interface{})["files"])
+	assert.Equal(t, map[interface{}]interface{}{"reboot_strategy": "etcd-lock"}, userData["locksmith"])
+	assert.Contains(t, userData, "systemd")
+
+	// the merged userdata is deterministic.
+	again, err := renderProfileUserData(file, "worker-team", config, nil)
+	require.NoError(t, err)
+	assert.Equal(t, rendered, again)
+
+	// profiles without fragments and other userdata formats are kept as
+	// they are.
+	rendered, err = renderProfileUserData(file, "worker-missing", config, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "storage:\n  files:\n  - path: /etc/base\nlocksmith:\n  reboot_strategy: reboot", rendered)
+
+	rendered, err = renderProfileUserData(path.Join(basePath, "userdata-worker.yaml"), "worker-default", config, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "#cloud-config", rendered)
+
+	_, err = renderProfileUserData(file, "worker-invalid", config, nil)
+	assert.Error(t, err)
+}
@@ -0,0 +1,212 @@
+package provisioner
+
+import (
+	"bytes"
+	"fmt"
+	"io/ioutil"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	userDataSourceConfigItemKey           = "userdata_source"
+	userDataConfigServiceURLConfigItemKey = "userdata_config_service_url"
+	userDataPresignedURLTTLConfigItemKey  = "userdata_presigned_url_ttl"
+
+	// userDataSourceS3 makes the nodes pull their userdata from S3.
+	userDataSourceS3 = "s3"
+	// userDataSourcePresignedURL makes the nodes pull their userdata
+	// from S3 via a pre-signed HTTPS URL, which doesn't require an S3
+	// gateway endpoint in their subnets.
+	userDataSourcePresignedURL = "presigned-url"
+	// userDataSourceConfigService makes the nodes pull their userdata
+	// from a config service serving the objects of the userdata bucket.
+	userDataSourceConfigService = "config-service"
+
+	// defaultUserDataPresignedURLTTL is the maximum lifetime of URLs
+	// pre-signed with signature version 4.
+	defaultUserDataPresignedURLTTL = 7 * 24 * time.Hour
+
+	// ignitionPointerHTTPSFile is the file in the directory of a node
+	// pool profile with the settings of the ignition pointer config used
+	// instead of ignitionPointerFile if the userdata is pulled via HTTPS,
+	// e.g. the certificate authorities of the config service.
+	ignitionPointerHTTPSFile = "ignition-pointer-https.yaml"
+
+	// presignedURLSuffix is the suffix of the objects next to the
+	// userdata objects holding their pre-signed URLs.
+	presignedURLSuffix = ".url"
+)
+
+// userDataSource defines how the nodes pull the userdata uploaded to the
+// userdata bucket if it's too large to be embedded.
+type userDataSource struct {
+	kind             string
+	configServiceURL string
+	presignedURLTTL  time.Duration
+}
+
+// newUserDataSource returns the userdata source configured for the cluster,
+// or nil if the nodes pull the userdata from S3.
+func newUserDataSource(cluster *api.Cluster) (*userDataSource, error) {
+	source := &userDataSource{
+		kind:            cluster.ConfigItems[userDataSourceConfigItemKey],
+		presignedURLTTL: defaultUserDataPresignedURLTTL,
+	}
+
+	serviceURL, hasServiceURL := cluster.ConfigItems[userDataConfigServiceURLConfigItemKey]
+	ttl, hasTTL := cluster.ConfigItems[userDataPresignedURLTTLConfigItemKey]
+
+	switch source.kind {
+	case "", userDataSourceS3:
+		if hasServiceURL || hasTTL {
+			return nil, fmt.Errorf("%s and %s require %s", userDataConfigServiceURLConfigItemKey, userDataPresignedURLTTLConfigItemKey, userDataSourceConfigItemKey)
+		}
+		return nil, nil
+	case userDataSourcePresignedURL:
+		if hasServiceURL {
+			return nil, fmt.Errorf("%s requires %s %s", userDataConfigServiceURLConfigItemKey, userDataSourceConfigItemKey, userDataSourceConfigService)
+		}
+		if hasTTL {
+			duration, err := time.ParseDuration(ttl)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s %s: %v", userDataPresignedURLTTLConfigItemKey, ttl, err)
+			}
+			if duration <= 0 || duration > defaultUserDataPresignedURLTTL {
+				return nil, fmt.Errorf("invalid %s %s, must be positive and at most %s", userDataPresignedURLTTLConfigItemKey, ttl, defaultUserDataPresignedURLTTL)
+			}
+			source.presignedURLTTL = duration
+		}
+	case userDataSourceConfigService:
+		if hasTTL {
+			return nil, fmt.Errorf("%s requires %s %s", userDataPresignedURLTTLConfigItemKey, userDataSourceConfigItemKey, userDataSourcePresignedURL)
+		}
+		u, err := url.Parse(serviceURL)
+		if err != nil || u.Scheme != "https" || u.Host == "" {
+			return nil, fmt.Errorf("invalid %s '%s', must be an https:// URL", userDataConfigServiceURLConfigItemKey, serviceURL)
+		}
+		source.configServiceURL = strings.TrimSuffix(serviceURL, "/")
+	default:
+		return nil, fmt.Errorf("invalid %s %s, must be %s, %s or %s", userDataSourceConfigItemKey, source.kind, userDataSourceS3, userDataSourcePresignedURL, userDataSourceConfigService)
+	}
+
+	return source, nil
+}
+
+// ignitionPointerPath returns the path of the settings of the ignition
+// pointer config of the node pool profile. Userdata pulled via HTTPS uses
+// the HTTPS specific settings if the profile has them.
+func ignitionPointerPath(basePath, profile string, source *userDataSource) (string, error) {
+	if source != nil {
+		httpsPath, err := profileFile(basePath, profile, ignitionPointerHTTPSFile)
+		if err != nil {
+			return "", err
+		}
+
+		_, err = os.Stat(httpsPath)
+		if err == nil {
+			return httpsPath, nil
+		}
+		if !os.IsNotExist(err) {
+			return "", err
+		}
+	}
+
+	return profileFile(basePath, profile, ignitionPointerFile)
+}
+
+// userDataSourceURL returns the URL the nodes pull the userdata object with
+// the key from, by default its s3:// URI.
+func (a *awsAdapter) userDataSourceURL(bucket *userDataBucket, key string) (string, error) {
+	switch {
+	case bucket.source == nil:
+		return fmt.Sprintf("s3://%s/%s", bucket.name, key), nil
+	case bucket.source.kind == userDataSourceConfigService:
+		return fmt.Sprintf("%s/%s", bucket.source.configServiceURL, key), nil
+	default:
+		return a.presignUserData(bucket, key)
+	}
+}
+
+// presignUserData returns a pre-signed URL of the userdata object with the
+// key. The URL is stored next to the object and reused as long as it's valid
+// for more than half of the TTL, because a new URL changes the launch
+// template and so replaces the nodes.
+func (a *awsAdapter) presignUserData(bucket *userDataBucket, key string) (string, error) {
+	client := a.userDataS3Client(bucket)
+	urlKey := key + presignedURLSuffix
+
+	resp, err := client.GetObject(&s3.GetObjectInput{Bucket: aws.String(bucket.name), Key: aws.String(urlKey)})
+	if err == nil {
+		data, err := ioutil.ReadAll(resp.Body)
+		resp.Body.Close()
+		if err != nil {
+			return "", err
+		}
+
+		presignedURL := strings.TrimSpace(string(data))
+		expiry, err := presignedURLExpiry(presignedURL)
+		if err == nil && time.Until(expiry) > bucket.source.presignedURLTTL/2 {
+			return presignedURL, nil
+		}
+	} else if aerr, ok := err.(awserr.Error); !ok || aerr.Code() != s3.ErrCodeNoSuchKey {
+		return "", err
+	}
+
+	req, _ := client.GetObjectRequest(&s3.GetObjectInput{Bucket: aws.String(bucket.name), Key: aws.String(key)})
+	presignedURL, err := req.Presign(bucket.source.presignedURLTTL)
+	if err != nil {
+		return "", fmt.Errorf("failed to pre-sign the URL of userdata s3://%s/%s: %v", bucket.name, key, err)
+	}
+
+	if a.skipReadOnly("storing the pre-signed URL of userdata s3://%s/%s", bucket.name, key) {
+		return presignedURL, nil
+	}
+
+	input := &s3.PutObjectInput{
+		Bucket:               aws.String(bucket.name),
+		Key:                  aws.String(urlKey),
+		Body:                 bytes.NewReader([]byte(presignedURL)),
+		ServerSideEncryption: aws.String(s3.ServerSideEncryptionAwsKms),
+	}
+	if bucket.external {
+		input.ACL = aws.String(s3.ObjectCannedACLBucketOwnerFullControl)
+	}
+
+	_, err = client.PutObject(input)
+	if err != nil {
+		return "", err
+	}
+	return presignedURL, nil
+}
+
+// presignedURLExpiry returns the time a URL pre-signed with signature version
+// 4 expires at.
+func presignedURLExpiry(presignedURL string) (time.Time, error) {
+	u, err := url.Parse(presignedURL)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	query := u.Query()
+	signedAt, err := time.Parse("20060102T150405Z", query.Get("X-Amz-Date"))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	expires, err := strconv.Atoi(query.Get("X-Amz-Expires"))
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	return signedAt.Add(time.Duration(expires) * time.Second), nil
+}
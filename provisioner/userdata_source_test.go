@@ -0,0 +1,207 @@
+package provisioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/aws/session"
+	"github.com/aws/aws-sdk-go/service/s3"
+	log "github.com/sirupsen/logrus"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+type presignS3APIStub struct {
+	s3API
+	client *s3.S3
+	// objects are the contents of the objects by key.
+	objects map[string]string
+}
+
+func (s *presignS3APIStub) GetObject(input *s3.GetObjectInput) (*s3.GetObjectOutput, error) {
+	content, ok := s.objects[aws.StringValue(input.Key)]
+	if !ok {
+		return nil, awserr.New(s3.ErrCodeNoSuchKey, "key doesn't exist", nil)
+	}
+	return &s3.GetObjectOutput{Body: ioutil.NopCloser(strings.NewReader(content))}, nil
+}
+
+func (s *presignS3APIStub) GetObjectRequest(input *s3.GetObjectInput) (*request.Request, *s3.GetObjectOutput) {
+	return s.client.GetObjectRequest(input)
+}
+
+func (s *presignS3APIStub) PutObject(input *s3.PutObjectInput) (*s3.PutObjectOutput, error) {
+	content, err := ioutil.ReadAll(input.Body)
+	if err != nil {
+		return nil, err
+	}
+	s.objects[aws.StringValue(input.Key)] = string(content)
+	return &s3.PutObjectOutput{}, nil
+}
+
+func TestNewUserDataSource(t *testing.T) {
+	for _, tc := range []struct {
+		msg         string
+		configItems map[string]string
+		expected    *userDataSource
+		valid       bool
+	}{
+		{
+			msg:   "s3 by default",
+			valid: true,
+		},
+		{
+			msg:         "s3",
+			configItems: map[string]string{userDataSourceConfigItemKey: userDataSourceS3},
+			valid:       true,
+		},
+		{
+			msg:         "pre-signed URL",
+			configItems: map[string]string{userDataSourceConfigItemKey: userDataSourcePresignedURL},
+			expected:    &userDataSource{kind: userDataSourcePresignedURL, presignedURLTTL: defaultUserDataPresignedURLTTL},
+			valid:       true,
+		},
+		{
+			msg: "pre-signed URL with TTL",
+			configItems: map[string]string{
+				userDataSourceConfigItemKey:          userDataSourcePresignedURL,
+				userDataPresignedURLTTLConfigItemKey: "72h",
+			},
+			expected: &userDataSource{kind: userDataSourcePresignedURL, presignedURLTTL: 72 * time.Hour},
+			valid:    true,
+		},
+		{
+			msg: "config service",
+			configItems: map[string]string{
+				userDataSourceConfigItemKey:           userDataSourceConfigService,
+				userDataConfigServiceURLConfigItemKey: "https://config.example.org/userdata/",
+			},
+			expected: &userDataSource{kind: userDataSourceConfigService, configServiceURL: "https://config.example.org/userdata", presignedURLTTL: defaultUserDataPresignedURLTTL},
+			valid:    true,
+		},
+		{
+			msg:         "unknown source",
+			configItems: map[string]string{userDataSourceConfigItemKey: "ftp"},
+		},
+		{
+			msg: "TTL above the maximum",
+			configItems: map[string]string{
+				userDataSourceConfigItemKey:          userDataSourcePresignedURL,
+				userDataPresignedURLTTLConfigItemKey: "169h",
+			},
+		},
+		{
+			msg:         "TTL without pre-signed URLs",
+			configItems: map[string]string{userDataPresignedURLTTLConfigItemKey: "1h"},
+		},
+		{
+			msg:         "config service without URL",
+			configItems: map[string]string{userDataSourceConfigItemKey: userDataSourceConfigService},
+		},
+		{
+			msg: "config service with plain HTTP",
+			configItems: map[string]string{
+				userDataSourceConfigItemKey:           userDataSourceConfigService,
+				userDataConfigServiceURLConfigItemKey: "http://config.example.org",
+			},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			source, err := newUserDataSource(&api.Cluster{ConfigItems: tc.configItems})
+			if !tc.valid {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, source)
+		})
+	}
+}
+
+func TestIgnitionPointerPath(t *testing.T) {
+	basePath, err := ioutil.TempDir("", "profiles")
+	require.NoError(t, err)
+	defer os.RemoveAll(basePath)
+
+	for _, profile := range []string{"worker-default", "worker-private"} {
+		require.NoError(t, os.MkdirAll(path.Join(basePath, "node-pools", profile), 0755))
+		require.NoError(t, ioutil.WriteFile(path.Join(basePath, "node-pools", profile, ignitionPointerFile), []byte("{}"), 0644))
+	}
+	require.NoError(t, ioutil.WriteFile(path.Join(basePath, "node-pools", "worker-private", ignitionPointerHTTPSFile), []byte("{}"), 0644))
+
+	source := &userDataSource{kind: userDataSourceConfigService}
+
+	pointerPath, err := ignitionPointerPath(basePath, "worker-private", nil)
+	require.NoError(t, err)
+	assert.Equal(t, ignitionPointerFile, path.Base(pointerPath))
+
+	pointerPath, err = ignitionPointerPath(basePath, "worker-private", source)
+	require.NoError(t, err)
+	assert.Equal(t, ignitionPointerHTTPSFile, path.Base(pointerPath))
+
+	// profiles without HTTPS specific settings use the default ones.
+	pointerPath, err = ignitionPointerPath(basePath, "worker-default", source)
+	require.NoError(t, err)
+	assert.Equal(t, ignitionPointerFile, path.Base(pointerPath))
+}
+
+func TestUserDataSourceURL(t *testing.T) {
+	sess, err := session.NewSession(&aws.Config{
+		Region:      aws.String("eu-central-1"),
+		Credentials: credentials.NewStaticCredentials("id", "secret", ""),
+	})
+	require.NoError(t, err)
+
+	client := &presignS3APIStub{client: s3.New(sess), objects: make(map[string]string)}
+	a := &awsAdapter{s3Client: client, region: "eu-central-1", logger: log.WithField("cluster", "kube-1")}
+
+	uri, err := a.userDataSourceURL(&userDataBucket{name: "bucket"}, "abc.userdata")
+	require.NoError(t, err)
+	assert.Equal(t, "s3://bucket/abc.userdata", uri)
+
+	configService := &userDataBucket{name: "bucket", source: &userDataSource{kind: userDataSourceConfigService, configServiceURL: "https://config.example.org/userdata"}}
+	uri, err = a.userDataSourceURL(configService, "abc.userdata")
+	require.NoError(t, err)
+	assert.Equal(t, "https://config.example.org/userdata/abc.userdata", uri)
+
+	// the pre-signed URL is stored next to the userdata and reused.
+	presigned := &userDataBucket{name: "bucket", source: &userDataSource{kind: userDataSourcePresignedURL, presignedURLTTL: 24 * time.Hour}}
+	uri, err = a.userDataSourceURL(presigned, "abc.userdata")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(uri, "https://"), uri)
+	assert.Contains(t, uri, "X-Amz-Expires=86400")
+	assert.Equal(t, uri, client.objects["abc.userdata.url"])
+
+	expiry, err := presignedURLExpiry(uri)
+	require.NoError(t, err)
+	assert.WithinDuration(t, time.Now().Add(24*time.Hour), expiry, time.Minute)
+
+	reused, err := a.userDataSourceURL(presigned, "abc.userdata")
+	require.NoError(t, err)
+	assert.Equal(t, uri, reused)
+
+	// URLs valid for less than half of the TTL are replaced.
+	expiring := "https://bucket.s3.eu-central-1.amazonaws.com/abc.userdata?X-Amz-Date=" + time.Now().UTC().Add(-20*time.Hour).Format("20060102T150405Z") + "&X-Amz-Expires=86400"
+	client.objects["abc.userdata.url"] = expiring
+	uri, err = a.userDataSourceURL(presigned, "abc.userdata")
+	require.NoError(t, err)
+	assert.NotEqual(t, expiring, uri)
+	assert.Equal(t, uri, client.objects["abc.userdata.url"])
+
+	// the pre-signed URLs aren't stored in read-only mode.
+	a.readOnly = true
+	uri, err = a.userDataSourceURL(presigned, "def.userdata")
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(uri, "https://"), uri)
+	assert.NotContains(t, client.objects, "def.userdata.url")
+}
@@ -0,0 +1,143 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"os"
+	"path"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestUserDataCompression(t *testing.T) {
+	compress, err := userDataCompression(&api.Cluster{})
+	require.NoError(t, err)
+	data, err := compress([]byte("foobar"))
+	require.NoError(t, err)
+	assert.Equal(t, "foobar", string(data))
+
+	compress, err = userDataCompression(&api.Cluster{ConfigItems: map[string]string{"userdata_compression": "gzip"}})
+	require.NoError(t, err)
+	data, err = compress([]byte("foobar"))
+	require.NoError(t, err)
+	decoded, err := decodeUserData(base64.StdEncoding.EncodeToString(data))
+	require.NoError(t, err)
+	assert.Equal(t, "foobar", decoded)
+
+	_, err = userDataCompression(&api.Cluster{ConfigItems: map[string]string{"userdata_compression": "bzip2"}})
+	assert.Error(t, err)
+}
+
+func TestCheckUserDataSize(t *testing.T) {
+	nodePool := &api.NodePool{Name: "worker-default", Profile: "worker-default"}
+
+	assert.NoError(t, checkUserDataSize(nodePool, base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", maxUserDataSize)))))
+
+	err := checkUserDataSize(nodePool, base64.StdEncoding.EncodeToString([]byte(strings.Repeat("x", maxUserDataSize+1))))
+	require.Error(t, err)
+	assert.Equal(t, "userdata of node pool worker-default (profile worker-default) is 16385 bytes, exceeding the EC2 limit of 16384 bytes", err.Error())
+}
+
+func TestNewUserDataObject(t *testing.T) {
+	cluster := &api.Cluster{
+		ID:      "aws:123456789012:eu-central-1:kube-1",
+		LocalID: "kube-1",
+		Status:  &api.ClusterStatus{NextVersion: "abc123#hash"},
+	}
+	nodePool := &api.NodePool{Name: "worker-default", Profile: "worker-default"}
+	renderedAt := time.Date(2018, 6, 1, 12, 0, 0, 0, time.UTC)
+
+	object := newUserDataObject(cluster, nodePool, renderedAt)
+	assert.Equal(t, "sha.userdata", object.key("sha"))
+	assert.Equal(t, map[string]*string{
+		"cluster":         aws.String(cluster.ID),
+		"node-pool":       aws.String("worker-default"),
+		"profile":         aws.String("worker-default"),
+		"rendered-at":     aws.String("2018-06-01T12:00:00Z"),
+		"channel-version": aws.String("abc123"),
+	}, object.metadata)
+
+	cluster.ConfigItems = map[string]string{"clm_bucket_restrict_reads": "true"}
+	object = newUserDataObject(cluster, nodePool, renderedAt)
+	assert.Equal(t, "kube-1/worker-default/sha.userdata", object.key("sha"))
+
+	cluster.ConfigItems = map[string]string{"userdata_readable_keys": "true"}
+	object = newUserDataObject(cluster, nodePool, renderedAt)
+	assert.Equal(t, "kube-1/worker-default/sha.userdata", object.key("sha"))
+
+	a := newAWSAdapterWithStubs("", "GroupName")
+	uploader := &s3UploaderAPIStub{}
+	a.s3Uploader = uploader
+
+	uri, err := a.uploadUserDataToS3(context.Background(), []byte("userdata"), &userDataBucket{name: "bucket"}, "", object)
+	require.NoError(t, err)
+	assert.True(t, strings.HasPrefix(uri, "s3://bucket/kube-1/worker-default/"))
+	assert.Equal(t, object.metadata, uploader.input.Metadata)
+}
+
+func TestIgnitionPointerConfig(t *testing.T) {
+	dir, err := ioutil.TempDir("", "pointer")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// without extensions only the config source is set.
+	pointerConfig, err := ignitionPointerConfig(path.Join(dir, ignitionPointerFile), nil, nil, "s3://bucket/foo.userdata", "2.2.0")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"ignition": {"version": "2.1.0", "config": {"replace": {"source": "s3://bucket/foo.userdata"}}}}`, string(pointerConfig))
+
+	extensionPath := path.Join(dir, ignitionPointerFile)
+	extension := `
+version: 2.3.0
+timeouts:
+  httpResponseHeaders: 30
+security:
+  tls:
+    certificateAuthorities:
+    - source: "{{CA_SOURCE}}"
+`
+	require.NoError(t, ioutil.WriteFile(extensionPath, []byte(extension), 0644))
+	pointerConfig, err = ignitionPointerConfig(extensionPath, map[string]string{"CA_SOURCE": "s3://bucket/ca.pem"}, nil, "s3://bucket/foo.userdata", "2.2.0")
+	require.NoError(t, err)
+
+	var decoded map[string]map[string]interface{}
+	require.NoError(t, json.Unmarshal(pointerConfig, &decoded))
+	assert.Equal(t, "2.3.0", decoded["ignition"]["version"])
+	assert.Equal(t, map[string]interface{}{"httpResponseHeaders": float64(30)}, decoded["ignition"]["timeouts"])
+	assert.Equal(t, map[string]interface{}{
+		"tls": map[string]interface{}{
+			"certificateAuthorities": []interface{}{map[string]interface{}{"source": "s3://bucket/ca.pem"}},
+		},
+	}, decoded["ignition"]["security"])
+	assert.Equal(t, map[string]interface{}{"replace": map[string]interface{}{"source": "s3://bucket/foo.userdata"}}, decoded["ignition"]["config"])
+
+	// the config source can't be overridden.
+	require.NoError(t, ioutil.WriteFile(extensionPath, []byte("config:\n  replace:\n    source: s3://other\n"), 0644))
+	_, err = ignitionPointerConfig(extensionPath, nil, nil, "s3://bucket/foo.userdata", "2.2.0")
+	assert.Error(t, err)
+
+	// ignition v3 userdata is pulled by a pointer config of the same
+	// spec version.
+	pointerConfig, err = ignitionPointerConfig(path.Join(dir, "missing.yaml"), nil, nil, "s3://bucket/foo.userdata", "3.3.0")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"ignition": {"version": "3.3.0", "config": {"replace": {"source": "s3://bucket/foo.userdata"}}}}`, string(pointerConfig))
+
+	// the major spec version of the pointer config must match the one of
+	// the userdata.
+	require.NoError(t, ioutil.WriteFile(extensionPath, []byte("version: 2.3.0\n"), 0644))
+	_, err = ignitionPointerConfig(extensionPath, nil, nil, "s3://bucket/foo.userdata", "3.3.0")
+	assert.Error(t, err)
+
+	require.NoError(t, ioutil.WriteFile(extensionPath, []byte("version: 3.1.0\n"), 0644))
+	pointerConfig, err = ignitionPointerConfig(extensionPath, nil, nil, "s3://bucket/foo.userdata", "3.3.0")
+	require.NoError(t, err)
+	assert.JSONEq(t, `{"ignition": {"version": "3.1.0", "config": {"replace": {"source": "s3://bucket/foo.userdata"}}}}`, string(pointerConfig))
+}
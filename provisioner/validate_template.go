@@ -0,0 +1,200 @@
+package provisioner
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+)
+
+const pseudoParameterPrefix = "AWS::"
+
+// checkStackTemplate runs structural checks on a rendered stack template,
+// such that mistakes in the stack definition of a profile are reported with
+// the location in the template instead of failing during stack creation.
+// It checks that the template is valid JSON, that every resource has a type
+// and that Ref, Fn::GetAtt and DependsOn only refer to defined parameters
+// and resources.
+func checkStackTemplate(stackTemplate []byte) error {
+	var template struct {
+		Parameters map[string]interface{} `json:"Parameters"`
+		Resources  map[string]interface{} `json:"Resources"`
+	}
+
+	err := json.Unmarshal(stackTemplate, &template)
+	if err != nil {
+		if serr, ok := err.(*json.SyntaxError); ok {
+			line, column := templatePosition(stackTemplate, serr.Offset)
+			return fmt.Errorf("invalid stack template at line %d, column %d: %v", line, column, err)
+		}
+		return fmt.Errorf("invalid stack template: %v", err)
+	}
+
+	var problems []string
+	for _, name := range sortedResourceNames(template.Resources) {
+		path := "Resources." + name
+
+		resource, ok := template.Resources[name].(map[string]interface{})
+		if !ok {
+			problems = append(problems, fmt.Sprintf("%s: resource must be an object", path))
+			continue
+		}
+
+		resourceType, _ := resource["Type"].(string)
+		if !strings.HasPrefix(resourceType, "AWS::") && !strings.HasPrefix(resourceType, "Custom::") {
+			problems = append(problems, fmt.Sprintf("%s.Type: invalid resource type '%v'", path, resource["Type"]))
+		}
+
+		for _, dependency := range dependsOn(resource["DependsOn"]) {
+			if _, ok := template.Resources[dependency]; !ok {
+				problems = append(problems, fmt.Sprintf("%s.DependsOn: undefined resource '%s'", path, dependency))
+			}
+		}
+
+		for _, key := range []string{"Properties", "Metadata", "Condition"} {
+			if value, ok := resource[key]; ok {
+				problems = append(problems, checkReferences(path+"."+key, value, template.Parameters, template.Resources)...)
+			}
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid stack template: %s", strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+// checkReferences returns the Ref and Fn::GetAtt intrinsic functions in
+// value which refer to undefined parameters or resources.
+func checkReferences(path string, value interface{}, parameters, resources map[string]interface{}) []string {
+	var problems []string
+
+	switch v := value.(type) {
+	case map[string]interface{}:
+		if ref, ok := v["Ref"].(string); ok && len(v) == 1 {
+			_, isParameter := parameters[ref]
+			_, isResource := resources[ref]
+			if !isParameter && !isResource && !strings.HasPrefix(ref, pseudoParameterPrefix) {
+				problems = append(problems, fmt.Sprintf("%s: Ref to undefined parameter or resource '%s'", path, ref))
+			}
+			return problems
+		}
+
+		if getAtt, ok := v["Fn::GetAtt"]; ok && len(v) == 1 {
+			if name := getAttResource(getAtt); name != "" {
+				if _, ok := resources[name]; !ok {
+					problems = append(problems, fmt.Sprintf("%s: Fn::GetAtt of undefined resource '%s'", path, name))
+				}
+			}
+			return problems
+		}
+
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+
+		for _, key := range keys {
+			problems = append(problems, checkReferences(path+"."+key, v[key], parameters, resources)...)
+		}
+	case []interface{}:
+		for i, item := range v {
+			problems = append(problems, checkReferences(fmt.Sprintf("%s[%d]", path, i), item, parameters, resources)...)
+		}
+	}
+
+	return problems
+}
+
+// getAttResource returns the logical ID of the resource referenced by
+// Fn::GetAtt, specified either as [name, attribute] or as name.attribute.
+func getAttResource(getAtt interface{}) string {
+	switch v := getAtt.(type) {
+	case []interface{}:
+		if len(v) > 0 {
+			name, _ := v[0].(string)
+			return name
+		}
+	case string:
+		return strings.SplitN(v, ".", 2)[0]
+	}
+	return ""
+}
+
+// dependsOn returns the resources of a DependsOn attribute, specified either
+// as a single resource or a list of resources.
+func dependsOn(value interface{}) []string {
+	switch v := value.(type) {
+	case string:
+		return []string{v}
+	case []interface{}:
+		dependencies := make([]string, 0, len(v))
+		for _, item := range v {
+			if name, ok := item.(string); ok {
+				dependencies = append(dependencies, name)
+			}
+		}
+		return dependencies
+	}
+	return nil
+}
+
+// templatePosition returns the line and column of an offset in the
+// template.
+func templatePosition(template []byte, offset int64) (int, int) {
+	if offset > int64(len(template)) {
+		offset = int64(len(template))
+	}
+
+	before := template[:offset]
+	line := bytes.Count(before, []byte("\n")) + 1
+	column := len(before) - bytes.LastIndex(before, []byte("\n"))
+	return line, column
+}
+
+// sortedResourceNames returns the sorted logical IDs of the resources.
+func sortedResourceNames(resources map[string]interface{}) []string {
+	names := make([]string, 0, len(resources))
+	for name := range resources {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// validateStackTemplate validates a stack template with the CloudFormation
+// API. The template is specified either by its body or by the URL it was
+// uploaded to. Since stacks are applied without parameters, the template
+// must not have parameters without a default value.
+func (a *awsAdapter) validateStackTemplate(stackName, stackTemplate, stackTemplateURL string) error {
+	params := &cloudformation.ValidateTemplateInput{}
+	if stackTemplateURL != "" {
+		params.TemplateURL = aws.String(stackTemplateURL)
+	} else {
+		params.TemplateBody = aws.String(stackTemplate)
+	}
+
+	resp, err := a.cloudformationClient.ValidateTemplate(params)
+	if err != nil {
+		return fmt.Errorf("invalid stack template for stack %s: %v", stackName, err)
+	}
+
+	var problems []string
+	for _, parameter := range resp.Parameters {
+		if parameter.DefaultValue == nil {
+			problems = append(problems, fmt.Sprintf("Parameters.%s: no default value", aws.StringValue(parameter.ParameterKey)))
+		}
+	}
+
+	if len(problems) > 0 {
+		return fmt.Errorf("invalid stack template for stack %s: %s", stackName, strings.Join(problems, "; "))
+	}
+
+	return nil
+}
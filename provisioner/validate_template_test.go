@@ -0,0 +1,85 @@
+package provisioner
+
+import (
+	"errors"
+	"sync"
+	"testing"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/cloudformation"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestCheckStackTemplate(t *testing.T) {
+	require.NoError(t, checkStackTemplate([]byte(testScheduleStackTemplate)))
+
+	for _, tc := range []struct {
+		msg      string
+		template string
+		err      string
+	}{
+		{
+			msg:      "syntax error",
+			template: "{\n  \"Resources\": {\n    \"Queue\": {\"Type\": \"AWS::SQS::Queue\",}\n  }\n}",
+			err:      "invalid stack template at line 3, column 42",
+		},
+		{
+			msg:      "invalid resource type",
+			template: `{"Resources": {"Queue": {"Type": "SQS::Queue"}}}`,
+			err:      "Resources.Queue.Type: invalid resource type 'SQS::Queue'",
+		},
+		{
+			msg:      "undefined dependency",
+			template: `{"Resources": {"Queue": {"Type": "AWS::SQS::Queue", "DependsOn": ["Topic"]}}}`,
+			err:      "Resources.Queue.DependsOn: undefined resource 'Topic'",
+		},
+		{
+			msg:      "undefined ref",
+			template: `{"Resources": {"Queue": {"Type": "AWS::SQS::Queue", "Properties": {"Tags": [{"Key": "Name", "Value": {"Ref": "QueueName"}}]}}}}`,
+			err:      "Resources.Queue.Properties.Tags[0].Value: Ref to undefined parameter or resource 'QueueName'",
+		},
+		{
+			msg:      "undefined GetAtt",
+			template: `{"Resources": {"Policy": {"Type": "AWS::SQS::QueuePolicy", "Properties": {"Queues": [{"Fn::GetAtt": "Queue.Arn"}]}}}}`,
+			err:      "Resources.Policy.Properties.Queues[0]: Fn::GetAtt of undefined resource 'Queue'",
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := checkStackTemplate([]byte(tc.template))
+			require.Error(t, err)
+			assert.Contains(t, err.Error(), tc.err)
+		})
+	}
+
+	// refs to parameters, resources and pseudo parameters are valid.
+	err := checkStackTemplate([]byte(`{
+  "Parameters": {"QueueName": {"Type": "String", "Default": "queue"}},
+  "Resources": {
+    "Queue": {"Type": "AWS::SQS::Queue", "Properties": {"QueueName": {"Ref": "QueueName"}, "Tags": [{"Key": "Region", "Value": {"Ref": "AWS::Region"}}]}},
+    "Policy": {"Type": "AWS::SQS::QueuePolicy", "DependsOn": "Queue", "Properties": {"Queues": [{"Ref": "Queue"}, {"Fn::GetAtt": ["Queue", "Arn"]}]}}
+  }
+}`))
+	assert.NoError(t, err)
+}
+
+func TestValidateStackTemplate(t *testing.T) {
+	stub := &cloudFormationAPIStub{statusMutex: &sync.Mutex{}}
+	a := &awsAdapter{cloudformationClient: stub}
+
+	stub.templateParameters = []*cloudformation.TemplateParameter{
+		{ParameterKey: aws.String("WorkerSpotPrice"), DefaultValue: aws.String("0.1")},
+	}
+	assert.NoError(t, a.validateStackTemplate("kube-1", "{}", ""))
+
+	stub.templateParameters = append(stub.templateParameters, &cloudformation.TemplateParameter{ParameterKey: aws.String("KmsKey")})
+	err := a.validateStackTemplate("kube-1", "{}", "")
+	require.Error(t, err)
+	assert.Equal(t, "invalid stack template for stack kube-1: Parameters.KmsKey: no default value", err.Error())
+
+	stub.validateErr = errors.New("Template format error: Unresolved resource dependencies [Queue] in the Resources block of the template")
+	err = a.validateStackTemplate("kube-1", "", "https://s3.amazonaws.com/bucket/cluster.template")
+	require.Error(t, err)
+	assert.Contains(t, err.Error(), "kube-1")
+	assert.Contains(t, err.Error(), "Unresolved resource dependencies [Queue]")
+}
@@ -0,0 +1,115 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"fmt"
+)
+
+// maxEscapeIndent is the deepest indentation of the indented config values
+// available to the userdata templates.
+const maxEscapeIndent = 16
+
+// Values are the typed values available to the templates. Besides strings
+// they may contain booleans, numbers, lists and nested maps, such that
+// templates can use sections for conditions and loops instead of comparing
+// strings. The types are the ones of the values files the config items are
+// loaded from, config items only set in the registry are strings.
+type Values map[string]interface{}
+
+// String returns the value of key as a string, or "" if it's not a string.
+func (v Values) String(key string) string {
+	s, _ := v[key].(string)
+	return s
+}
+
+// Bool returns the value of key as a bool, or false if it's not a bool.
+func (v Values) Bool(key string) bool {
+	b, _ := v[key].(bool)
+	return b
+}
+
+// Int returns the value of key as an int, or 0 if it's not an integer.
+func (v Values) Int(key string) int {
+	i, _ := v[key].(int)
+	return i
+}
+
+// List returns the value of key as a list, or nil if it's not a list.
+func (v Values) List(key string) []interface{} {
+	l, _ := v[key].([]interface{})
+	return l
+}
+
+// Map returns the value of key as a map, or nil if it's not a map.
+func (v Values) Map(key string) map[string]interface{} {
+	m, _ := v[key].(map[string]interface{})
+	return m
+}
+
+// configValues returns the config items as Values. Config items with a typed
+// value are replaced by it as long as the typed value is still what the
+// config item is set to, such that config items overridden later on, e.g. by
+// the node pool, stay the strings they are.
+func configValues(config map[string]string, typed Values) Values {
+	values := make(Values, len(config))
+	for key, value := range config {
+		values[key] = value
+		if typedValue, ok := typed[key]; ok {
+			if s, err := configItemString(typedValue); err == nil && s == value {
+				values[key] = typedValue
+			}
+		}
+	}
+	return values
+}
+
+// userDataValues returns the values the userdata templates are rendered
+// with. The config items are available with their typed values, and their
+// escaped values as <escaper>.<KEY>. Escapers clashing with a config item
+// are skipped.
+func userDataValues(config map[string]string, typed Values) Values {
+	values := configValues(config, typed)
+	addEscapedValues(values, config)
+	return values
+}
+
+// userDataEscapers escape a config value for embedding it into the userdata.
+// The escaped values are available to the templates as <escaper>.<KEY>, e.g.
+// {{{json.CA_CERT}}}, besides indent<N>.<KEY> with every line of the value
+// indented by N spaces for YAML block scalars.
+var userDataEscapers = map[string]func(value string) string{
+	"json":   jsonString,
+	"base64": base64Encode,
+}
+
+// addEscapedValues adds the escaped config values to values. Escapers
+// clashing with a config item are skipped.
+func addEscapedValues(values Values, config map[string]string) {
+	escapers := make(map[string]func(value string) string, len(userDataEscapers)+maxEscapeIndent/2)
+	for name, escape := range userDataEscapers {
+		escapers[name] = escape
+	}
+	for spaces := 2; spaces <= maxEscapeIndent; spaces += 2 {
+		spaces := spaces
+		escapers[fmt.Sprintf("indent%d", spaces)] = func(value string) string { return indent(spaces, value) }
+	}
+
+	for name, escape := range escapers {
+		if _, ok := values[name]; ok {
+			continue
+		}
+
+		escaped := make(map[string]interface{}, len(config))
+		for key, value := range config {
+			escaped[key] = escape(value)
+		}
+		values[name] = escaped
+	}
+}
+
+// jsonString returns value as a quoted JSON string, which is a valid double
+// quoted YAML scalar as well.
+func jsonString(value string) string {
+	encoded, _ := json.Marshal(value)
+	return string(encoded)
+}
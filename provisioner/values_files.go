@@ -0,0 +1,189 @@
+package provisioner
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"gopkg.in/yaml.v2"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+const (
+	// valuesFile is the file in the cluster directory of a channel with
+	// the default values of the config items of all clusters.
+	valuesFile = "values.yaml"
+	// environmentValuesDir is the directory in the cluster directory of a
+	// channel with the values files overriding the defaults for the
+	// clusters of an environment, e.g. values/production.yaml.
+	environmentValuesDir = "values"
+)
+
+// withValuesFiles returns a copy of the cluster whose config items are
+// layered over the values files of the channel. The precedence from lowest
+// to highest is:
+//
+//  1. cluster/values.yaml, the defaults of the channel.
+//  2. cluster/values/<environment>.yaml, the overrides of the environment
+//     of the cluster.
+//  3. the config items of the cluster.
+//
+// Missing values files are skipped. The merged config items are used by the
+// stack, manifest and userdata templates alike.
+func withValuesFiles(cluster *api.Cluster, channelConfig *channel.Config) (*api.Cluster, error) {
+	files := []string{path.Join(channelConfig.Path, "cluster", valuesFile)}
+	if cluster.Environment != "" {
+		if strings.ContainsAny(cluster.Environment, "/\\") || strings.HasPrefix(cluster.Environment, ".") {
+			return nil, fmt.Errorf("invalid environment %q", cluster.Environment)
+		}
+		files = append(files, path.Join(channelConfig.Path, "cluster", environmentValuesDir, cluster.Environment+".yaml"))
+	}
+
+	configItems := make(map[string]string, len(cluster.ConfigItems))
+	typed := make(Values, len(cluster.ConfigItems))
+	for _, file := range files {
+		values, err := loadValuesFile(file)
+		if err != nil {
+			return nil, err
+		}
+		for key, value := range values {
+			configItem, err := configItemString(value)
+			if err != nil {
+				return nil, fmt.Errorf("invalid %s: %s: %v", file, key, err)
+			}
+			configItems[key] = configItem
+			typed[key] = value
+		}
+	}
+
+	for key, value := range cluster.ConfigItems {
+		configItems[key] = value
+		if defaultValue, ok := typed[key]; ok {
+			typedValue, err := typedConfigItem(value, defaultValue)
+			if err != nil {
+				return nil, fmt.Errorf("invalid config item %s: %v", key, err)
+			}
+			typed[key] = typedValue
+		}
+	}
+
+	// the status is shared with the copy, such that the status set while
+	// provisioning is reported to the registry.
+	if cluster.Status == nil {
+		cluster.Status = &api.ClusterStatus{}
+	}
+
+	layered := *cluster
+	layered.ConfigItems = configItems
+	layered.ConfigValues = typed
+	return &layered, nil
+}
+
+// loadValuesFile loads the typed values of a values file. Its maps are
+// normalized, such that they can be traversed by key.
+func loadValuesFile(file string) (Values, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil
+		}
+		return nil, err
+	}
+
+	var values map[string]interface{}
+	err = yaml.Unmarshal(data, &values)
+	if err != nil {
+		return nil, fmt.Errorf("invalid %s: %v", file, err)
+	}
+
+	result := make(Values, len(values))
+	for key, value := range values {
+		result[key] = normalizeValue(value)
+	}
+	return result, nil
+}
+
+// configItemString returns the config item of a typed value. Values which
+// aren't strings are converted to their YAML representation.
+func configItemString(value interface{}) (string, error) {
+	switch v := value.(type) {
+	case nil:
+		return "", nil
+	case string:
+		return v, nil
+	case bool, int, float64:
+		return fmt.Sprint(v), nil
+	default:
+		encoded, err := yaml.Marshal(v)
+		if err != nil {
+			return "", err
+		}
+		return strings.TrimSuffix(string(encoded), "\n"), nil
+	}
+}
+
+// typedConfigItem converts a config item of the cluster overriding a value
+// of the values files to the type of that value, e.g. "true" overriding
+// false to a bool. Config items overriding strings are kept as they are.
+func typedConfigItem(configItem string, defaultValue interface{}) (interface{}, error) {
+	switch defaultValue.(type) {
+	case bool:
+		value, err := strconv.ParseBool(configItem)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a bool", configItem)
+		}
+		return value, nil
+	case int:
+		value, err := strconv.Atoi(configItem)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not an integer", configItem)
+		}
+		return value, nil
+	case float64:
+		value, err := strconv.ParseFloat(configItem, 64)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a number", configItem)
+		}
+		return value, nil
+	case []interface{}:
+		var value []interface{}
+		err := yaml.Unmarshal([]byte(configItem), &value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a list", configItem)
+		}
+		return normalizeValue(value), nil
+	case map[string]interface{}:
+		var value map[interface{}]interface{}
+		err := yaml.Unmarshal([]byte(configItem), &value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a map", configItem)
+		}
+		return normalizeValue(value), nil
+	}
+	return configItem, nil
+}
+
+// normalizeValue converts the maps of a parsed YAML value to
+// map[string]interface{} such that they can be traversed by key.
+func normalizeValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case []interface{}:
+		list := make([]interface{}, 0, len(v))
+		for _, item := range v {
+			list = append(list, normalizeValue(item))
+		}
+		return list
+	case map[interface{}]interface{}:
+		m := make(map[string]interface{}, len(v))
+		for key, item := range v {
+			m[fmt.Sprint(key)] = normalizeValue(item)
+		}
+		return m
+	}
+	return value
+}
@@ -0,0 +1,153 @@
+package provisioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/channel"
+)
+
+func TestWithValuesFiles(t *testing.T) {
+	dir, err := ioutil.TempDir("", "values-files")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.MkdirAll(path.Join(dir, "cluster", environmentValuesDir), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "cluster", valuesFile), []byte(`
+log_level: info
+replicas: 2
+dns_cache: false
+zones: [a, b]
+etcd_instance_type: t2.medium
+empty:
+`), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "cluster", environmentValuesDir, "production.yaml"), []byte(`
+replicas: 3
+etcd_instance_type: m5.large
+`), 0644))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "cluster", environmentValuesDir, "invalid.yaml"), []byte(`[a`), 0644))
+	channelConfig := &channel.Config{Path: dir}
+
+	for _, tc := range []struct {
+		msg         string
+		environment string
+		configItems map[string]string
+		expected    map[string]string
+		success     bool
+	}{
+		{
+			msg:         "channel defaults",
+			environment: "test",
+			expected: map[string]string{
+				"log_level":          "info",
+				"replicas":           "2",
+				"dns_cache":          "false",
+				"zones":              "- a\n- b",
+				"etcd_instance_type": "t2.medium",
+				"empty":              "",
+			},
+			success: true,
+		},
+		{
+			msg:         "environment overrides the channel defaults",
+			environment: "production",
+			expected: map[string]string{
+				"log_level":          "info",
+				"replicas":           "3",
+				"dns_cache":          "false",
+				"zones":              "- a\n- b",
+				"etcd_instance_type": "m5.large",
+				"empty":              "",
+			},
+			success: true,
+		},
+		{
+			msg:         "config items override the environment",
+			environment: "production",
+			configItems: map[string]string{"replicas": "5", "custom": "foo"},
+			expected: map[string]string{
+				"log_level":          "info",
+				"replicas":           "5",
+				"dns_cache":          "false",
+				"zones":              "- a\n- b",
+				"etcd_instance_type": "m5.large",
+				"empty":              "",
+				"custom":             "foo",
+			},
+			success: true,
+		},
+		{
+			msg:         "invalid values file",
+			environment: "invalid",
+			success:     false,
+		},
+		{
+			msg:         "invalid environment",
+			environment: "../production",
+			success:     false,
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			cluster := &api.Cluster{Environment: tc.environment, ConfigItems: tc.configItems}
+			layered, err := withValuesFiles(cluster, channelConfig)
+			if !tc.success {
+				assert.Error(t, err)
+				return
+			}
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, layered.ConfigItems)
+			assert.Equal(t, tc.configItems, cluster.ConfigItems)
+			assert.True(t, layered.Status == cluster.Status)
+		})
+	}
+}
+
+func TestWithValuesFilesMissing(t *testing.T) {
+	cluster := &api.Cluster{Environment: "production", ConfigItems: map[string]string{"foo": "bar"}}
+	layered, err := withValuesFiles(cluster, &channel.Config{Path: "/does/not/exist"})
+	require.NoError(t, err)
+	assert.Equal(t, map[string]string{"foo": "bar"}, layered.ConfigItems)
+}
+
+func TestWithValuesFilesTyped(t *testing.T) {
+	dir, err := ioutil.TempDir("", "values-files")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	require.NoError(t, os.MkdirAll(path.Join(dir, "cluster"), 0755))
+	require.NoError(t, ioutil.WriteFile(path.Join(dir, "cluster", valuesFile), []byte(`
+log_level: info
+replicas: 2
+dns_cache: false
+zones: [a, b]
+labels: {team: {name: foo}}
+`), 0644))
+	channelConfig := &channel.Config{Path: dir}
+
+	cluster := &api.Cluster{ConfigItems: map[string]string{"replicas": "5", "dns_cache": "true", "zones": "[c]", "custom": "true"}}
+	layered, err := withValuesFiles(cluster, channelConfig)
+	require.NoError(t, err)
+	assert.Equal(t, map[string]interface{}{
+		"log_level": "info",
+		"replicas":  5,
+		"dns_cache": true,
+		"zones":     []interface{}{"c"},
+		"labels":    map[string]interface{}{"team": map[string]interface{}{"name": "foo"}},
+	}, layered.ConfigValues)
+
+	for _, configItems := range []map[string]string{
+		{"replicas": "five"},
+		{"dns_cache": "maybe"},
+		{"zones": "{a: b}"},
+		{"labels": "[a]"},
+	} {
+		_, err := withValuesFiles(&api.Cluster{ConfigItems: configItems}, channelConfig)
+		assert.Error(t, err, "%v", configItems)
+	}
+}
@@ -0,0 +1,98 @@
+package provisioner
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestConfigValues(t *testing.T) {
+	config := map[string]string{
+		"ENABLED":  "true",
+		"ZONES":    "- a\n- b",
+		"COUNT":    "5",
+		"VERSION":  "1.10",
+		"REGISTRY": "true",
+	}
+	typed := Values{
+		"ENABLED": true,
+		"ZONES":   []interface{}{"a", "b"},
+		"COUNT":   3,
+	}
+
+	values := configValues(config, typed)
+	assert.Equal(t, true, values.Bool("ENABLED"))
+	assert.Equal(t, []interface{}{"a", "b"}, values.List("ZONES"))
+	// overridden config items and config items without a typed value are
+	// the strings they are.
+	assert.Equal(t, "5", values.String("COUNT"))
+	assert.Equal(t, 0, values.Int("COUNT"))
+	assert.Equal(t, "1.10", values.String("VERSION"))
+	assert.Equal(t, false, values.Bool("REGISTRY"))
+	assert.Nil(t, values.Map("ENABLED"))
+}
+
+func TestRenderUserDataTypedValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "values")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	template := "{{#ENABLED}}enabled {{/ENABLED}}{{#DISABLED}}disabled {{/DISABLED}}{{#ZONES}}{{.}} {{/ZONES}}{{COUNT}} {{VERSION}}"
+	file := path.Join(dir, "worker.clc.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(template), 0644))
+
+	result, err := renderUserData(file, map[string]string{
+		"ENABLED":  "true",
+		"DISABLED": "false",
+		"ZONES":    "- a\n- b",
+		"COUNT":    "3",
+		"VERSION":  "1.10",
+	}, Values{
+		"ENABLED":  true,
+		"DISABLED": false,
+		"ZONES":    []interface{}{"a", "b"},
+		"COUNT":    3,
+	})
+	require.NoError(t, err)
+	assert.Equal(t, "enabled a b 3 1.10", result)
+}
+
+func TestRenderUserDataStringValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "values")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	// config items without a typed value render as the strings they are,
+	// e.g. "false" is a non-empty string.
+	template := "{{#DISABLED}}disabled {{/DISABLED}}{{ZONES}} {{COUNT}}"
+	file := path.Join(dir, "worker.clc.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(template), 0644))
+
+	result, err := renderUserData(file, map[string]string{
+		"DISABLED": "false",
+		"ZONES":    "[a, b]",
+		"COUNT":    "3",
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "disabled [a, b] 3", result)
+}
+
+func TestRenderUserDataEscapedValues(t *testing.T) {
+	dir, err := ioutil.TempDir("", "values")
+	require.NoError(t, err)
+	defer os.RemoveAll(dir)
+
+	template := "json: {{{json.CA_CERT}}}\nbase64: {{{base64.CA_CERT}}}\nblock: |\n{{{indent4.CA_CERT}}}"
+	file := path.Join(dir, "worker.clc.yaml")
+	require.NoError(t, ioutil.WriteFile(file, []byte(template), 0644))
+
+	result, err := renderUserData(file, map[string]string{
+		"CA_CERT": "-----BEGIN \"CERT\"-----\nabc\n",
+	}, nil)
+	require.NoError(t, err)
+	assert.Equal(t, "json: \"-----BEGIN \\\"CERT\\\"-----\\nabc\\n\"\nbase64: LS0tLS1CRUdJTiAiQ0VSVCItLS0tLQphYmMK\nblock: |\n    -----BEGIN \"CERT\"-----\n    abc\n", result)
+}
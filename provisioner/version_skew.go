@@ -0,0 +1,142 @@
+package provisioner
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	// configKeyKubernetesVersion is the config item with the Kubernetes
+	// version of the control plane, e.g. '1.24.3'.
+	configKeyKubernetesVersion = "kubernetes_version"
+	// configKeyKubeletVersion is the config item with the kubelet version
+	// of the node pools. It defaults to the control plane version.
+	configKeyKubeletVersion = "kubelet_version"
+	// configKeyNodePoolKubeletVersions is the config item with the kubelet
+	// versions of node pools deviating from the kubelet version of the
+	// cluster, e.g. 'worker-legacy=1.23.5,worker-gpu=1.24.0'.
+	configKeyNodePoolKubeletVersions = "node_pool_kubelet_versions"
+)
+
+var kubernetesVersionRegexp = regexp.MustCompile(`^v?(\d+)\.(\d+)(\.\d+)?([-+].*)?$`)
+
+// kubernetesVersion is the major and minor version of a Kubernetes component.
+type kubernetesVersion struct {
+	major int
+	minor int
+}
+
+func (v kubernetesVersion) String() string {
+	return fmt.Sprintf("%d.%d", v.major, v.minor)
+}
+
+// parseKubernetesVersion parses a Kubernetes version like '1.24', '1.24.3' or
+// 'v1.24.3'.
+func parseKubernetesVersion(version string) (kubernetesVersion, error) {
+	match := kubernetesVersionRegexp.FindStringSubmatch(strings.TrimSpace(version))
+	if match == nil {
+		return kubernetesVersion{}, fmt.Errorf("invalid Kubernetes version '%s'", version)
+	}
+
+	major, err := strconv.Atoi(match[1])
+	if err != nil {
+		return kubernetesVersion{}, err
+	}
+	minor, err := strconv.Atoi(match[2])
+	if err != nil {
+		return kubernetesVersion{}, err
+	}
+	return kubernetesVersion{major: major, minor: minor}, nil
+}
+
+// maxKubeletSkew returns the number of minor versions the kubelet may be
+// older than the control plane. It was raised from two to three minor
+// versions with Kubernetes 1.28.
+func maxKubeletSkew(controlPlane kubernetesVersion) int {
+	if controlPlane.major == 1 && controlPlane.minor < 28 {
+		return 2
+	}
+	return 3
+}
+
+// nodePoolKubeletVersions returns the kubelet versions of the node pools of a
+// cluster, parsed from the node_pool_kubelet_versions config item.
+func nodePoolKubeletVersions(cluster *api.Cluster) (map[string]string, error) {
+	versions := make(map[string]string)
+	value := strings.TrimSpace(cluster.ConfigItems[configKeyNodePoolKubeletVersions])
+	if value == "" {
+		return versions, nil
+	}
+
+	for _, entry := range strings.Split(value, ",") {
+		parts := strings.SplitN(strings.TrimSpace(entry), "=", 2)
+		if len(parts) != 2 || parts[0] == "" || parts[1] == "" {
+			return nil, fmt.Errorf("invalid %s entry '%s', must be <node pool>=<version>", configKeyNodePoolKubeletVersions, entry)
+		}
+		versions[parts[0]] = parts[1]
+	}
+	return versions, nil
+}
+
+// checkKubeletVersionSkew returns an error if the kubelet version of one of
+// the node pools isn't supported by the control plane of the cluster.
+func checkKubeletVersionSkew(cluster *api.Cluster) error {
+	for _, nodePool := range cluster.NodePools {
+		err := checkNodePoolKubeletVersion(cluster, nodePool)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// checkNodePoolKubeletVersion returns an error if the kubelet version of the
+// node pool isn't supported by the control plane of the cluster: the kubelet
+// must not be newer than the control plane and may only be older by the
+// supported skew. The kubelet config of the node pool must be supported by
+// the kubelet version. Clusters without a kubernetes_version config item
+// aren't checked.
+func checkNodePoolKubeletVersion(cluster *api.Cluster, nodePool *api.NodePool) error {
+	controlPlaneVersion := cluster.ConfigItems[configKeyKubernetesVersion]
+	if controlPlaneVersion == "" {
+		return nil
+	}
+
+	controlPlane, err := parseKubernetesVersion(controlPlaneVersion)
+	if err != nil {
+		return fmt.Errorf("invalid %s: %v", configKeyKubernetesVersion, err)
+	}
+
+	kubeletVersions, err := nodePoolKubeletVersions(cluster)
+	if err != nil {
+		return err
+	}
+
+	version, ok := kubeletVersions[nodePool.Name]
+	if !ok {
+		version = cluster.ConfigItems[configKeyKubeletVersion]
+	}
+	if version == "" {
+		version = controlPlaneVersion
+	}
+
+	kubelet, err := parseKubernetesVersion(version)
+	if err != nil {
+		return fmt.Errorf("invalid kubelet version of node pool %s: %v", nodePool.Name, err)
+	}
+
+	if kubelet.major > controlPlane.major || (kubelet.major == controlPlane.major && kubelet.minor > controlPlane.minor) {
+		return fmt.Errorf("kubelet version %s of node pool %s is newer than the control plane version %s", kubelet, nodePool.Name, controlPlane)
+	}
+
+	maxSkew := maxKubeletSkew(controlPlane)
+	if kubelet.major < controlPlane.major || controlPlane.minor-kubelet.minor > maxSkew {
+		return fmt.Errorf("kubelet version %s of node pool %s is more than %d minor versions older than the control plane version %s", kubelet, nodePool.Name, maxSkew, controlPlane)
+	}
+
+	return checkKubeletConfigVersion(nodePool, kubelet)
+}
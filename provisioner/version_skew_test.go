@@ -0,0 +1,90 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestParseKubernetesVersion(t *testing.T) {
+	for _, version := range []string{"1.24", "1.24.3", "v1.24.3", "1.24.3-zalando.1"} {
+		parsed, err := parseKubernetesVersion(version)
+		require.NoError(t, err, version)
+		assert.Equal(t, kubernetesVersion{major: 1, minor: 24}, parsed, version)
+	}
+
+	for _, version := range []string{"", "1", "latest", "1.x"} {
+		_, err := parseKubernetesVersion(version)
+		assert.Error(t, err, version)
+	}
+}
+
+func TestCheckKubeletVersionSkew(t *testing.T) {
+	nodePools := []*api.NodePool{
+		{Name: "master-default", Profile: "master-default"},
+		{Name: "worker-default", Profile: "worker-default"},
+	}
+
+	for _, tc := range []struct {
+		msg         string
+		configItems map[string]string
+		valid       bool
+	}{
+		{
+			msg:   "no control plane version",
+			valid: true,
+		},
+		{
+			msg:         "kubelet version defaults to the control plane version",
+			configItems: map[string]string{"kubernetes_version": "1.24.3"},
+			valid:       true,
+		},
+		{
+			msg:         "kubelet within the skew",
+			configItems: map[string]string{"kubernetes_version": "1.24.3", "kubelet_version": "1.22.10"},
+			valid:       true,
+		},
+		{
+			msg:         "kubelet too old",
+			configItems: map[string]string{"kubernetes_version": "1.24.3", "kubelet_version": "1.21.14"},
+		},
+		{
+			msg:         "kubelet within the skew of newer control planes",
+			configItems: map[string]string{"kubernetes_version": "1.28.2", "kubelet_version": "1.25.8"},
+			valid:       true,
+		},
+		{
+			msg:         "kubelet newer than the control plane",
+			configItems: map[string]string{"kubernetes_version": "1.24.3", "kubelet_version": "1.25.0"},
+		},
+		{
+			msg:         "node pool kubelet too old",
+			configItems: map[string]string{"kubernetes_version": "1.24.3", "node_pool_kubelet_versions": "worker-default=v1.21.14"},
+		},
+		{
+			msg:         "node pool kubelet overrides the cluster kubelet",
+			configItems: map[string]string{"kubernetes_version": "1.24.3", "kubelet_version": "1.21.14", "node_pool_kubelet_versions": "master-default=1.24.3, worker-default=1.23.5"},
+			valid:       true,
+		},
+		{
+			msg:         "invalid node pool kubelet versions",
+			configItems: map[string]string{"kubernetes_version": "1.24.3", "node_pool_kubelet_versions": "worker-default"},
+		},
+		{
+			msg:         "invalid control plane version",
+			configItems: map[string]string{"kubernetes_version": "latest"},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := checkKubeletVersionSkew(&api.Cluster{NodePools: nodePools, ConfigItems: tc.configItems})
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
@@ -0,0 +1,128 @@
+package provisioner
+
+import (
+	"fmt"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	awsExt "github.com/zalando-incubator/cluster-lifecycle-manager/pkg/aws"
+)
+
+// defaultRootVolumeType is the volume type of the root volumes of the
+// profiles, used to validate the size of node pools which only override it.
+const defaultRootVolumeType = "gp2"
+
+// rootVolumeLimits are the size and IOPS limits of an EBS volume type.
+type rootVolumeLimits struct {
+	minSize int64
+	maxSize int64
+	// minIOPS and maxIOPS are 0 for volume types without provisioned
+	// IOPS.
+	minIOPS int64
+	maxIOPS int64
+	// maxIOPSPerGiB limits the IOPS relative to the size of the volume.
+	maxIOPSPerGiB int64
+	// requiresIOPS is true for volume types which must be provisioned
+	// with IOPS.
+	requiresIOPS bool
+}
+
+// rootVolumeTypes are the EBS volume types which can be used as root
+// volumes, the throughput optimized HDD types can't boot instances.
+var rootVolumeTypes = map[string]rootVolumeLimits{
+	"standard": {minSize: 1, maxSize: 1024},
+	"gp2":      {minSize: 1, maxSize: 16384},
+	"gp3":      {minSize: 1, maxSize: 16384, minIOPS: 3000, maxIOPS: 16000, maxIOPSPerGiB: 500},
+	"io1":      {minSize: 4, maxSize: 16384, minIOPS: 100, maxIOPS: 64000, maxIOPSPerGiB: 50, requiresIOPS: true},
+	"io2":      {minSize: 4, maxSize: 16384, minIOPS: 100, maxIOPS: 64000, maxIOPSPerGiB: 500, requiresIOPS: true},
+}
+
+// validateRootVolume returns an error if the root volume of the node pool
+// isn't valid for its volume type or the volume type isn't supported by its
+// instance type. Instance types without instance info are not validated.
+func validateRootVolume(nodePool *api.NodePool) error {
+	volumeType := nodePool.RootVolumeType
+	if volumeType == "" {
+		if nodePool.RootVolumeIOPS > 0 {
+			return fmt.Errorf("root_volume_iops of node pool %s requires root_volume_type", nodePool.Name)
+		}
+		volumeType = defaultRootVolumeType
+	}
+
+	limits, ok := rootVolumeTypes[volumeType]
+	if !ok {
+		return fmt.Errorf("invalid root_volume_type %s for node pool %s, must be one of standard, gp2, gp3, io1 or io2", volumeType, nodePool.Name)
+	}
+
+	if nodePool.RootVolumeSize != 0 && (nodePool.RootVolumeSize < limits.minSize || nodePool.RootVolumeSize > limits.maxSize) {
+		return fmt.Errorf("invalid root_volume_size %d for node pool %s, must be between %d and %d GiB for %s volumes", nodePool.RootVolumeSize, nodePool.Name, limits.minSize, limits.maxSize, volumeType)
+	}
+
+	if nodePool.RootVolumeIOPS == 0 {
+		if limits.requiresIOPS {
+			return fmt.Errorf("root_volume_iops of node pool %s must be set for %s volumes", nodePool.Name, volumeType)
+		}
+		return nil
+	}
+
+	if limits.maxIOPS == 0 {
+		return fmt.Errorf("root_volume_iops of node pool %s isn't supported for %s volumes", nodePool.Name, volumeType)
+	}
+
+	if nodePool.RootVolumeIOPS < limits.minIOPS || nodePool.RootVolumeIOPS > limits.maxIOPS {
+		return fmt.Errorf("invalid root_volume_iops %d for node pool %s, must be between %d and %d for %s volumes", nodePool.RootVolumeIOPS, nodePool.Name, limits.minIOPS, limits.maxIOPS, volumeType)
+	}
+
+	// the IOPS of a volume whose size is defined by the profile can't
+	// be checked against the size.
+	if nodePool.RootVolumeSize != 0 && nodePool.RootVolumeIOPS > nodePool.RootVolumeSize*limits.maxIOPSPerGiB {
+		return fmt.Errorf("root_volume_iops %d of node pool %s exceed %d IOPS per GiB of the %d GiB %s volume", nodePool.RootVolumeIOPS, nodePool.Name, limits.maxIOPSPerGiB, nodePool.RootVolumeSize, volumeType)
+	}
+
+	instanceInfo, ok := awsExt.InstanceInfo()[nodePool.InstanceType]
+	if !ok {
+		return nil
+	}
+
+	if !instanceInfo.EBSOptimized {
+		return fmt.Errorf("instance type %s of node pool %s isn't EBS-optimized, which provisioned IOPS root volumes require", nodePool.InstanceType, nodePool.Name)
+	}
+
+	if instanceInfo.EBSMaxIOPS > 0 && nodePool.RootVolumeIOPS > instanceInfo.EBSMaxIOPS {
+		return fmt.Errorf("root_volume_iops %d of node pool %s exceed the maximum of %d EBS IOPS of instance type %s", nodePool.RootVolumeIOPS, nodePool.Name, instanceInfo.EBSMaxIOPS, nodePool.InstanceType)
+	}
+
+	return nil
+}
+
+// rootVolumeArgs validates the root volume of a node pool and returns its
+// stack parameters prefixed with the given prefix e.g. 'Master' or 'Worker'.
+func rootVolumeArgs(prefix string, nodePool *api.NodePool) ([]string, error) {
+	err := validateRootVolume(nodePool)
+	if err != nil {
+		return nil, err
+	}
+	return rootVolumeParameters(prefix, nodePool), nil
+}
+
+// rootVolumeParameters returns the stack parameters of the root volume of a
+// node pool. Only the parameters set for the node pool are returned, such
+// that the stack template uses the defaults of the profile for the others.
+func rootVolumeParameters(prefix string, nodePool *api.NodePool) []string {
+	var args []string
+	if nodePool.RootVolumeType != "" {
+		args = append(args, fmt.Sprintf("%sRootVolumeType=%s", prefix, nodePool.RootVolumeType))
+	}
+	if nodePool.RootVolumeSize != 0 {
+		args = append(args, fmt.Sprintf("%sRootVolumeSize=%d", prefix, nodePool.RootVolumeSize))
+	}
+	if nodePool.RootVolumeIOPS != 0 {
+		args = append(args, fmt.Sprintf("%sRootVolumeIOPS=%d", prefix, nodePool.RootVolumeIOPS))
+	}
+	if nodePool.RootVolumeEncrypted || nodePool.RootVolumeKMSKey != "" {
+		args = append(args, fmt.Sprintf("%sRootVolumeEncrypted=true", prefix))
+	}
+	if nodePool.RootVolumeKMSKey != "" {
+		args = append(args, fmt.Sprintf("%sRootVolumeKMSKey=%s", prefix, nodePool.RootVolumeKMSKey))
+	}
+	return args
+}
@@ -0,0 +1,101 @@
+package provisioner
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestValidateRootVolume(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		nodePool *api.NodePool
+		valid    bool
+	}{
+		{
+			msg:      "profile defaults",
+			nodePool: &api.NodePool{Name: "default", InstanceType: "m5.large"},
+			valid:    true,
+		},
+		{
+			msg:      "size of the default volume type",
+			nodePool: &api.NodePool{Name: "default", InstanceType: "m5.large", RootVolumeSize: 100},
+			valid:    true,
+		},
+		{
+			msg:      "gp3 with IOPS",
+			nodePool: &api.NodePool{Name: "default", InstanceType: "m5.large", RootVolumeType: "gp3", RootVolumeSize: 100, RootVolumeIOPS: 6000},
+			valid:    true,
+		},
+		{
+			msg:      "IOPS without volume type",
+			nodePool: &api.NodePool{Name: "default", InstanceType: "m5.large", RootVolumeIOPS: 6000},
+		},
+		{
+			msg:      "unsupported volume type",
+			nodePool: &api.NodePool{Name: "default", InstanceType: "m5.large", RootVolumeType: "st1"},
+		},
+		{
+			msg:      "size out of range",
+			nodePool: &api.NodePool{Name: "default", InstanceType: "m5.large", RootVolumeType: "standard", RootVolumeSize: 2048},
+		},
+		{
+			msg:      "IOPS of a gp2 volume",
+			nodePool: &api.NodePool{Name: "default", InstanceType: "m5.large", RootVolumeType: "gp2", RootVolumeIOPS: 3000},
+		},
+		{
+			msg:      "io1 without IOPS",
+			nodePool: &api.NodePool{Name: "default", InstanceType: "m5.large", RootVolumeType: "io1", RootVolumeSize: 100},
+		},
+		{
+			msg:      "io1 IOPS exceeding the size ratio",
+			nodePool: &api.NodePool{Name: "default", InstanceType: "m5.large", RootVolumeType: "io1", RootVolumeSize: 50, RootVolumeIOPS: 5000},
+		},
+		{
+			msg:      "IOPS exceeding the instance type",
+			nodePool: &api.NodePool{Name: "default", InstanceType: "m4.large", RootVolumeType: "io2", RootVolumeSize: 100, RootVolumeIOPS: 10000},
+		},
+		{
+			msg:      "provisioned IOPS on an instance type which isn't EBS-optimized",
+			nodePool: &api.NodePool{Name: "default", InstanceType: "t2.medium", RootVolumeType: "io1", RootVolumeSize: 100, RootVolumeIOPS: 1000},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := validateRootVolume(tc.nodePool)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestRootVolumeArgs(t *testing.T) {
+	args, err := rootVolumeArgs("Worker", &api.NodePool{Name: "worker-default", InstanceType: "m5.large"})
+	require.NoError(t, err)
+	assert.Empty(t, args)
+
+	args, err = rootVolumeArgs("Worker", &api.NodePool{
+		Name:             "worker-default",
+		InstanceType:     "m5.large",
+		RootVolumeType:   "gp3",
+		RootVolumeSize:   100,
+		RootVolumeIOPS:   6000,
+		RootVolumeKMSKey: "alias/ebs",
+	})
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		"WorkerRootVolumeType=gp3",
+		"WorkerRootVolumeSize=100",
+		"WorkerRootVolumeIOPS=6000",
+		"WorkerRootVolumeEncrypted=true",
+		"WorkerRootVolumeKMSKey=alias/ebs",
+	}, args)
+
+	_, err = rootVolumeArgs("Worker", &api.NodePool{Name: "worker-default", RootVolumeType: "sc1"})
+	assert.Error(t, err)
+}
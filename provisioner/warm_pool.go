@@ -0,0 +1,86 @@
+package provisioner
+
+import (
+	"fmt"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	resourceTypeWarmPool = "AWS::AutoScaling::WarmPool"
+	warmPoolStateStopped = "Stopped"
+)
+
+// warmPoolStates are the states warm instances can be kept in.
+var warmPoolStates = map[string]bool{
+	warmPoolStateStopped: true,
+	"Running":            true,
+	"Hibernated":         true,
+}
+
+// validateWarmPool validates the warm pool of a node pool.
+func validateWarmPool(nodePool *api.NodePool) error {
+	warmPool := nodePool.WarmPool
+	if warmPool == nil {
+		return nil
+	}
+
+	// spot instances can't be stopped and started again by the ASG.
+	if isSpotNodePool(nodePool) {
+		return fmt.Errorf("warm pools are not supported for spot node pool %s", nodePool.Name)
+	}
+
+	if warmPool.State != "" && !warmPoolStates[warmPool.State] {
+		return fmt.Errorf("invalid warm pool state %s for node pool %s, must be one of Stopped, Running or Hibernated", warmPool.State, nodePool.Name)
+	}
+
+	if warmPool.MinSize < 0 {
+		return fmt.Errorf("invalid warm pool min_size %d for node pool %s, must not be negative", warmPool.MinSize, nodePool.Name)
+	}
+
+	if warmPool.MaxPreparedCapacity != 0 && warmPool.MaxPreparedCapacity < warmPool.MinSize {
+		return fmt.Errorf("warm pool of node pool %s must satisfy min_size <= max_prepared_capacity", nodePool.Name)
+	}
+
+	return nil
+}
+
+// addWarmPool adds the warm pool of the node pool to the stack template. Like
+// the scheduled actions it refers to the ASG of the template which is tagged
+// with the name of the node pool.
+func addWarmPool(stackTemplate []byte, nodePool *api.NodePool) ([]byte, error) {
+	warmPool := nodePool.WarmPool
+	if warmPool == nil {
+		return stackTemplate, nil
+	}
+
+	return modifyStackResources(stackTemplate, func(resources map[string]interface{}) error {
+		asgLogicalID, err := nodePoolASGLogicalID(resources, nodePool)
+		if err != nil {
+			return err
+		}
+
+		state := warmPool.State
+		if state == "" {
+			state = warmPoolStateStopped
+		}
+
+		properties := map[string]interface{}{
+			"AutoScalingGroupName": map[string]interface{}{"Ref": asgLogicalID},
+			"MinSize":              warmPool.MinSize,
+			"PoolState":            state,
+			"InstanceReusePolicy": map[string]interface{}{
+				"ReuseOnScaleIn": warmPool.ReuseOnScaleIn,
+			},
+		}
+		if warmPool.MaxPreparedCapacity != 0 {
+			properties["MaxGroupPreparedCapacity"] = warmPool.MaxPreparedCapacity
+		}
+
+		resources[asgLogicalID+"WarmPool"] = map[string]interface{}{
+			"Type":       resourceTypeWarmPool,
+			"Properties": properties,
+		}
+		return nil
+	})
+}
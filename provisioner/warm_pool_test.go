@@ -0,0 +1,90 @@
+package provisioner
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestValidateWarmPool(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		nodePool *api.NodePool
+		valid    bool
+	}{
+		{
+			msg:      "no warm pool",
+			nodePool: &api.NodePool{Name: "worker-default"},
+			valid:    true,
+		},
+		{
+			msg:      "valid warm pool",
+			nodePool: &api.NodePool{Name: "worker-default", WarmPool: &api.WarmPool{MinSize: 2, MaxPreparedCapacity: 5, State: "Hibernated"}},
+			valid:    true,
+		},
+		{
+			msg:      "spot node pool",
+			nodePool: &api.NodePool{Name: "worker-default", DiscountStrategy: discountStrategySpotMaxPrice, WarmPool: &api.WarmPool{}},
+		},
+		{
+			msg:      "invalid state",
+			nodePool: &api.NodePool{Name: "worker-default", WarmPool: &api.WarmPool{State: "Terminated"}},
+		},
+		{
+			msg:      "negative min size",
+			nodePool: &api.NodePool{Name: "worker-default", WarmPool: &api.WarmPool{MinSize: -1}},
+		},
+		{
+			msg:      "max prepared capacity below min size",
+			nodePool: &api.NodePool{Name: "worker-default", WarmPool: &api.WarmPool{MinSize: 3, MaxPreparedCapacity: 2}},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := validateWarmPool(tc.nodePool)
+			if tc.valid {
+				assert.NoError(t, err)
+			} else {
+				assert.Error(t, err)
+			}
+		})
+	}
+}
+
+func TestAddWarmPool(t *testing.T) {
+	pool := &api.NodePool{Name: "worker-default"}
+
+	// the template is not changed without a warm pool.
+	output, err := addWarmPool([]byte(testScheduleStackTemplate), pool)
+	require.NoError(t, err)
+	assert.Equal(t, testScheduleStackTemplate, string(output))
+
+	pool.WarmPool = &api.WarmPool{MinSize: 2, ReuseOnScaleIn: true}
+	output, err = addWarmPool([]byte(testScheduleStackTemplate), pool)
+	require.NoError(t, err)
+
+	var template struct {
+		Resources map[string]struct {
+			Type       string
+			Properties map[string]interface{}
+		}
+	}
+	require.NoError(t, json.Unmarshal(output, &template))
+	require.Len(t, template.Resources, 3)
+
+	warmPool := template.Resources["WorkerAutoScalingWarmPool"]
+	assert.Equal(t, resourceTypeWarmPool, warmPool.Type)
+	assert.Equal(t, map[string]interface{}{"Ref": "WorkerAutoScaling"}, warmPool.Properties["AutoScalingGroupName"])
+	assert.EqualValues(t, 2, warmPool.Properties["MinSize"])
+	assert.Equal(t, warmPoolStateStopped, warmPool.Properties["PoolState"])
+	assert.Equal(t, map[string]interface{}{"ReuseOnScaleIn": true}, warmPool.Properties["InstanceReusePolicy"])
+	assert.NotContains(t, warmPool.Properties, "MaxGroupPreparedCapacity")
+
+	// node pools without an ASG in the template are rejected.
+	pool.Name = "worker-unknown"
+	_, err = addWarmPool([]byte(testScheduleStackTemplate), pool)
+	assert.Error(t, err)
+}
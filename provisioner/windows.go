@@ -0,0 +1,98 @@
+package provisioner
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+const (
+	osLinux   = "linux"
+	osWindows = "windows"
+
+	// windowsUserDataFile is the file in the directory of a Windows node
+	// pool profile with the PowerShell script configuring its nodes. The
+	// script of the closest base profile having one is used, otherwise
+	// the one in the cluster directory.
+	windowsUserDataFile = "userdata.ps1"
+
+	// userDataFormatPowerShell is the format of the userdata of Windows
+	// node pools.
+	userDataFormatPowerShell = "powershell"
+
+	// gceWindowsStartupScriptMetadataKey is the metadata key of the
+	// PowerShell script run by the GCE Windows agent when an instance
+	// boots.
+	gceWindowsStartupScriptMetadataKey = "windows-startup-script-ps1"
+)
+
+// nodePoolOS returns the operating system of a node pool.
+func nodePoolOS(nodePool *api.NodePool) string {
+	if nodePool.OS == "" {
+		return osLinux
+	}
+	return nodePool.OS
+}
+
+// validateOS returns an error if the operating system of the node pool is
+// unknown, or if a Windows node pool uses a feature which requires Linux
+// nodes: master profiles, arm64 nodes and stateful storage.
+func validateOS(nodePool *api.NodePool) error {
+	switch nodePoolOS(nodePool) {
+	case osLinux:
+		return nil
+	case osWindows:
+	default:
+		return fmt.Errorf("invalid os %s of node pool %s, must be %s or %s", nodePool.OS, nodePool.Name, osLinux, osWindows)
+	}
+
+	if strings.HasPrefix(nodePool.Profile, "master") {
+		return fmt.Errorf("master node pool %s can't run %s", nodePool.Name, osWindows)
+	}
+	if arch := nodePoolArchitecture(nodePool); arch != defaultArchitecture {
+		return fmt.Errorf("%s node pool %s doesn't support architecture %s", osWindows, nodePool.Name, arch)
+	}
+	if nodePool.Storage != nil {
+		return fmt.Errorf("storage isn't supported for %s node pool %s", osWindows, nodePool.Name)
+	}
+	return nil
+}
+
+// nodePoolUserDataFile returns the userdata template of a node pool: the
+// PowerShell script of Windows node pools, otherwise the template of the
+// node pool role returned by userDataFile.
+func nodePoolUserDataFile(basePath, role string, nodePool *api.NodePool) (string, error) {
+	if nodePoolOS(nodePool) != osWindows {
+		return userDataFile(basePath, role, nodePool.Profile)
+	}
+
+	file, err := profileFile(basePath, nodePool.Profile, windowsUserDataFile)
+	if err != nil {
+		return "", err
+	}
+
+	_, err = os.Stat(file)
+	if err == nil {
+		return file, nil
+	}
+	if !os.IsNotExist(err) {
+		return "", err
+	}
+
+	return path.Join(basePath, windowsUserDataFile), nil
+}
+
+// isPowerShellUserData returns true if the userdata template file is the
+// PowerShell script of a Windows node pool.
+func isPowerShellUserData(file string) bool {
+	return path.Base(file) == windowsUserDataFile
+}
+
+// ec2LaunchUserData wraps a rendered PowerShell script in the tags run by
+// EC2Launch when a Windows instance boots for the first time.
+func ec2LaunchUserData(script string) string {
+	return fmt.Sprintf("<powershell>\n%s\n</powershell>\n", strings.TrimSpace(script))
+}
@@ -0,0 +1,103 @@
+package provisioner
+
+import (
+	"context"
+	"encoding/base64"
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/coreos/container-linux-config-transpiler/config/platform"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func TestValidateOS(t *testing.T) {
+	for _, tc := range []struct {
+		msg      string
+		nodePool *api.NodePool
+		valid    bool
+	}{
+		{
+			msg:      "linux by default",
+			nodePool: &api.NodePool{Name: "worker-default", Profile: "worker-default"},
+			valid:    true,
+		},
+		{
+			msg:      "windows worker",
+			nodePool: &api.NodePool{Name: "worker-windows", Profile: "worker-windows", OS: osWindows},
+			valid:    true,
+		},
+		{
+			msg:      "unknown os",
+			nodePool: &api.NodePool{Name: "worker-default", Profile: "worker-default", OS: "darwin"},
+		},
+		{
+			msg:      "windows master",
+			nodePool: &api.NodePool{Name: "master-default", Profile: "master-default", OS: osWindows},
+		},
+		{
+			msg:      "windows on arm64",
+			nodePool: &api.NodePool{Name: "worker-windows", Profile: "worker-windows", OS: osWindows, Architecture: "arm64"},
+		},
+		{
+			msg:      "windows with storage",
+			nodePool: &api.NodePool{Name: "worker-windows", Profile: "worker-windows", OS: osWindows, Storage: &api.NodeStorage{InstanceStoreRAID: true, MountPath: "/mnt/data"}},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			err := validateOS(tc.nodePool)
+			if tc.valid {
+				assert.NoError(t, err)
+				return
+			}
+			assert.Error(t, err)
+		})
+	}
+}
+
+func TestRenderWindowsUserData(t *testing.T) {
+	basePath, err := ioutil.TempDir("", "windows")
+	require.NoError(t, err)
+	defer os.RemoveAll(basePath)
+
+	writeProfileFiles(t, basePath, map[string]string{
+		"worker.clc.yaml":                                      "storage: {}",
+		windowsUserDataFile:                                    "Write-Output {{NODE_POOL}} {{OS}}",
+		"node-pools/worker-windows/.keep":                      "",
+		"node-pools/worker-windows-gpu/" + windowsUserDataFile: "Write-Output gpu",
+	})
+
+	nodePool := &api.NodePool{Name: "windows", Profile: "worker-windows", OS: osWindows}
+	config := nodePoolUserDataConfig(map[string]string{}, nodePool)
+
+	file, err := nodePoolUserDataFile(basePath, "worker", nodePool)
+	require.NoError(t, err)
+	assert.Equal(t, path.Join(basePath, windowsUserDataFile), file)
+
+	userData, format, err := renderNodePoolUserData(basePath, "worker", nodePool, config, nil, platform.EC2)
+	require.NoError(t, err)
+	assert.Equal(t, userDataFormatPowerShell, format)
+	assert.Equal(t, "Write-Output windows windows", userData)
+
+	// profiles can override the script.
+	file, err = nodePoolUserDataFile(basePath, "worker", &api.NodePool{Profile: "worker-windows-gpu", OS: osWindows})
+	require.NoError(t, err)
+	assert.Equal(t, path.Join(basePath, "node-pools", "worker-windows-gpu", windowsUserDataFile), file)
+
+	// linux node pools keep their Container Linux Config.
+	file, err = nodePoolUserDataFile(basePath, "worker", &api.NodePool{Profile: "worker-windows"})
+	require.NoError(t, err)
+	assert.Equal(t, path.Join(basePath, "worker.clc.yaml"), file)
+
+	// the script is embedded into the EC2 userdata without compression.
+	a := &awsAdapter{}
+	encoded, err := a.prepareUserData(context.Background(), &api.Cluster{}, nodePool, path.Join(basePath, windowsUserDataFile), "", config, nil, "", nil, nil)
+	require.NoError(t, err)
+	decoded, err := base64.StdEncoding.DecodeString(encoded)
+	require.NoError(t, err)
+	assert.Equal(t, "<powershell>\nWrite-Output windows windows\n</powershell>\n", string(decoded))
+}
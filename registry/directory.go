@@ -0,0 +1,230 @@
+package registry
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	log "github.com/sirupsen/logrus"
+	yaml "gopkg.in/yaml.v2"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+	"github.com/zalando-incubator/cluster-lifecycle-manager/pkg/util/command"
+)
+
+// directoryRegistry reads the clusters from a directory of YAML files, one
+// cluster per file. If a Git repository is set, the directory is in a
+// checkout of the repository, which is updated before the clusters are
+// listed.
+//
+// The files are never written. The lifecycle status and status reported for
+// a cluster are kept in memory and returned with the cluster until its
+// lifecycle status is changed in its file, so they're lost when the CLM
+// restarts.
+type directoryRegistry struct {
+	dir               string
+	repositoryURL     string
+	checkoutDir       string
+	sshPrivateKeyFile string
+	// listMutex prevents the checkout from being updated while the
+	// clusters are read.
+	listMutex sync.Mutex
+
+	mutex sync.Mutex
+	// defined are the lifecycle statuses of the clusters in their files
+	// when they were listed last.
+	defined map[string]string
+	updates map[string]*clusterUpdate
+}
+
+// clusterUpdate is the last update of a cluster in a directoryRegistry.
+type clusterUpdate struct {
+	// definedLifecycleStatus is the lifecycle status in the file of the
+	// cluster when it was updated.
+	definedLifecycleStatus string
+	lifecycleStatus        string
+	status                 *api.ClusterStatus
+}
+
+// NewDirectoryRegistry returns a registry reading the clusters from the YAML
+// files in dir.
+func NewDirectoryRegistry(dir string) Registry {
+	return &directoryRegistry{
+		dir:     dir,
+		defined: make(map[string]string),
+		updates: make(map[string]*clusterUpdate),
+	}
+}
+
+// NewGitRegistry returns a registry reading the clusters from the YAML files
+// in the directory dir of the Git repository. The repository is checked out
+// in workdir and pulled every time the clusters are listed.
+func NewGitRegistry(repositoryURL, dir, workdir, sshPrivateKeyFile string) Registry {
+	checkoutDir := path.Join(workdir, "cluster-registry")
+	return &directoryRegistry{
+		dir:               path.Join(checkoutDir, path.Clean("/"+dir)),
+		repositoryURL:     repositoryURL,
+		checkoutDir:       checkoutDir,
+		sshPrivateKeyFile: sshPrivateKeyFile,
+		defined:           make(map[string]string),
+		updates:           make(map[string]*clusterUpdate),
+	}
+}
+
+// ListClusters lists the filtered clusters of the directory.
+func (r *directoryRegistry) ListClusters(filter Filter) ([]*api.Cluster, error) {
+	r.listMutex.Lock()
+	defer r.listMutex.Unlock()
+
+	if r.repositoryURL != "" {
+		err := r.pull()
+		if err != nil {
+			return nil, err
+		}
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	files, err := ioutil.ReadDir(r.dir)
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].Name() < files[j].Name() })
+
+	defined := make(map[string]string)
+	clusters := []*api.Cluster{}
+	for _, f := range files {
+		ext := filepath.Ext(f.Name())
+		if f.IsDir() || strings.HasPrefix(f.Name(), ".") || (ext != ".yaml" && ext != ".yml") {
+			continue
+		}
+
+		cluster, err := readClusterFile(path.Join(r.dir, f.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		if _, ok := defined[cluster.ID]; ok {
+			return nil, fmt.Errorf("cluster %s is defined more than once", cluster.ID)
+		}
+		defined[cluster.ID] = cluster.LifecycleStatus
+
+		if update, ok := r.updates[cluster.ID]; ok {
+			if update.definedLifecycleStatus != cluster.LifecycleStatus {
+				// the lifecycle status was changed in the file,
+				// e.g. to decommission the cluster.
+				delete(r.updates, cluster.ID)
+			} else {
+				cluster.LifecycleStatus = update.lifecycleStatus
+				status := *update.status
+				cluster.Status = &status
+			}
+		}
+
+		if filter.LifecycleStatus == nil || cluster.LifecycleStatus == *filter.LifecycleStatus {
+			clusters = append(clusters, cluster)
+		}
+	}
+	r.defined = defined
+
+	return clusters, nil
+}
+
+// GetCluster gets a cluster of the directory. The cluster files aren't named
+// after the clusters they define, so all of them are read.
+func (r *directoryRegistry) GetCluster(id string) (*api.Cluster, error) {
+	clusters, err := r.ListClusters(Filter{})
+	if err != nil {
+		return nil, err
+	}
+	return findCluster(clusters, id)
+}
+
+// UpdateCluster keeps the lifecycle status and status of the cluster, such
+// that they're returned when the clusters are listed again.
+func (r *directoryRegistry) UpdateCluster(cluster *api.Cluster) error {
+	if cluster == nil {
+		return fmt.Errorf("failed to update the cluster. Empty cluster is passed")
+	}
+
+	r.mutex.Lock()
+	defer r.mutex.Unlock()
+
+	definedLifecycleStatus, ok := r.defined[cluster.ID]
+	if !ok {
+		return fmt.Errorf("failed to update the cluster: cluster %s not found", cluster.ID)
+	}
+
+	var status api.ClusterStatus
+	if cluster.Status != nil {
+		status = *cluster.Status
+	}
+
+	r.updates[cluster.ID] = &clusterUpdate{
+		definedLifecycleStatus: definedLifecycleStatus,
+		lifecycleStatus:        cluster.LifecycleStatus,
+		status:                 &status,
+	}
+	log.Debugf("[Cluster %s updated] Lifecycle status: %s", cluster.ID, cluster.LifecycleStatus)
+	return nil
+}
+
+// readClusterFile reads a cluster from a YAML file.
+func readClusterFile(file string) (*api.Cluster, error) {
+	data, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var cluster api.Cluster
+	err = yaml.Unmarshal(data, &cluster)
+	if err != nil {
+		return nil, fmt.Errorf("invalid cluster %s: %v", file, err)
+	}
+
+	if cluster.ID == "" {
+		return nil, fmt.Errorf("invalid cluster %s: missing id", file)
+	}
+
+	if cluster.Status == nil {
+		cluster.Status = &api.ClusterStatus{}
+	}
+	return &cluster, nil
+}
+
+// pull clones the Git repository or updates the checkout to the latest
+// revision of its default branch.
+func (r *directoryRegistry) pull() error {
+	_, err := os.Stat(r.checkoutDir)
+	if err != nil {
+		if !os.IsNotExist(err) {
+			return err
+		}
+		return r.git("clone", r.repositoryURL, r.checkoutDir)
+	}
+
+	err = r.git("-C", r.checkoutDir, "fetch", "origin")
+	if err != nil {
+		return err
+	}
+
+	return r.git("-C", r.checkoutDir, "reset", "--hard", "origin/HEAD")
+}
+
+// git executes a git command with the correct environment set.
+func (r *directoryRegistry) git(args ...string) error {
+	cmd := exec.Command("git", args...)
+	// set GIT_SSH_COMMAND with private-key file when pulling over ssh.
+	if r.sshPrivateKeyFile != "" {
+		cmd.Env = []string{fmt.Sprintf("GIT_SSH_COMMAND=ssh -i %s -o 'StrictHostKeyChecking no'", r.sshPrivateKeyFile)}
+	}
+
+	return command.Run(log.StandardLogger(), cmd)
+}
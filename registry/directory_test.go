@@ -0,0 +1,150 @@
+package registry
+
+import (
+	"io/ioutil"
+	"os"
+	"path"
+	"testing"
+
+	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
+)
+
+func writeClusterFile(t *testing.T, dir, name, content string) {
+	err := ioutil.WriteFile(path.Join(dir, name), []byte(content), 0644)
+	if err != nil {
+		t.Fatalf("failed to write %s: %v", name, err)
+	}
+}
+
+func TestDirectoryRegistry(t *testing.T) {
+	dir, err := ioutil.TempDir("", "directory-registry")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	writeClusterFile(t, dir, "kube-1.yaml", `
+id: aws:123456789012:eu-central-1:kube-1
+alias: kube-1
+channel: stable
+lifecycle_status: requested
+config_items:
+  foo: bar
+node_pools:
+- name: default-worker
+  profile: worker-default
+`)
+	writeClusterFile(t, dir, "kube-2.yml", `
+id: aws:123456789012:eu-central-1:kube-2
+alias: kube-2
+lifecycle_status: ready
+`)
+	writeClusterFile(t, dir, "README.md", "not a cluster")
+
+	registry := NewDirectoryRegistry(dir)
+	clusters, err := registry.ListClusters(Filter{})
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+
+	if len(clusters) != 2 || clusters[0].Alias != "kube-1" || clusters[1].Alias != "kube-2" {
+		t.Fatalf("expected kube-1 and kube-2, got %v", clusters)
+	}
+
+	if clusters[0].ConfigItems["foo"] != "bar" || len(clusters[0].NodePools) != 1 || clusters[0].Status == nil {
+		t.Errorf("unexpected cluster %v", clusters[0])
+	}
+
+	// the updates are returned with the clusters.
+	cluster := clusters[0]
+	cluster.LifecycleStatus = "ready"
+	cluster.Status.CurrentVersion = "abc"
+	err = registry.UpdateCluster(cluster)
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+
+	ready := "ready"
+	clusters, err = registry.ListClusters(Filter{LifecycleStatus: &ready})
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+
+	if len(clusters) != 2 || clusters[0].Status.CurrentVersion != "abc" {
+		t.Errorf("expected the update of kube-1, got %v", clusters)
+	}
+
+	cluster, err = registry.GetCluster("aws:123456789012:eu-central-1:kube-1")
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+
+	if cluster.Alias != "kube-1" || cluster.Status.CurrentVersion != "abc" {
+		t.Errorf("expected the update of kube-1, got %v", cluster)
+	}
+
+	_, err = registry.GetCluster("unknown")
+	if err != ErrClusterNotFound {
+		t.Errorf("expected getting an unknown cluster to fail with %v, got %v", ErrClusterNotFound, err)
+	}
+
+	// changing the lifecycle status in the file discards the update.
+	writeClusterFile(t, dir, "kube-1.yaml", `
+id: aws:123456789012:eu-central-1:kube-1
+alias: kube-1
+lifecycle_status: decommission-requested
+`)
+	clusters, err = registry.ListClusters(Filter{})
+	if err != nil {
+		t.Fatalf("should not fail: %v", err)
+	}
+
+	if clusters[0].LifecycleStatus != "decommission-requested" || clusters[0].Status.CurrentVersion != "" {
+		t.Errorf("expected the update to be discarded, got %v", clusters[0])
+	}
+
+	err = registry.UpdateCluster(&api.Cluster{ID: "unknown"})
+	if err == nil {
+		t.Errorf("expected updating an unknown cluster to fail")
+	}
+}
+
+func TestDirectoryRegistryInvalid(t *testing.T) {
+	for _, tc := range []struct {
+		msg   string
+		files map[string]string
+	}{
+		{
+			msg:   "missing id",
+			files: map[string]string{"kube-1.yaml": "alias: kube-1\n"},
+		},
+		{
+			msg:   "invalid yaml",
+			files: map[string]string{"kube-1.yaml": "[kube-1"},
+		},
+		{
+			msg: "duplicate id",
+			files: map[string]string{
+				"kube-1.yaml": "id: kube-1\n",
+				"kube-2.yaml": "id: kube-1\n",
+			},
+		},
+	} {
+		t.Run(tc.msg, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "directory-registry")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			for name, content := range tc.files {
+				writeClusterFile(t, dir, name, content)
+			}
+
+			_, err = NewDirectoryRegistry(dir).ListClusters(Filter{})
+			if err == nil {
+				t.Errorf("expected an error")
+			}
+		})
+	}
+}
@@ -42,6 +42,14 @@ func (r *fileRegistry) ListClusters(filter Filter) ([]*api.Cluster, error) {
 	return fileClusters.Clusters, nil
 }
 
+func (r *fileRegistry) GetCluster(id string) (*api.Cluster, error) {
+	clusters, err := r.ListClusters(Filter{})
+	if err != nil {
+		return nil, err
+	}
+	return findCluster(clusters, id)
+}
+
 func (r *fileRegistry) UpdateCluster(cluster *api.Cluster) error {
 	if cluster == nil {
 		return fmt.Errorf("failed to update the cluster. Empty cluster is passed")
@@ -2,6 +2,7 @@ package registry
 
 import (
 	"net/url"
+	"time"
 
 	"golang.org/x/oauth2"
 
@@ -26,6 +27,12 @@ type httpRegistry struct {
 // is initialized.
 type Options struct {
 	Debug bool
+	// Workdir is the directory the repository of a Git registry is
+	// checked out in.
+	Workdir string
+	// SSHPrivateKeyFile is the key used to pull the repository of a Git
+	// registry over SSH.
+	SSHPrivateKeyFile string
 }
 
 // NewHTTPRegistry initializes a new http based registry source.
@@ -74,6 +81,42 @@ func (r *httpRegistry) ListClusters(filter Filter) ([]*api.Cluster, error) {
 	return clusters, nil
 }
 
+// GetCluster gets a single cluster from the registry.
+func (r *httpRegistry) GetCluster(id string) (*api.Cluster, error) {
+	authInfo, err := newAuthInfo(r.tokenSource)
+	if err != nil {
+		return nil, err
+	}
+
+	resp, err := r.apiClient.Clusters.GetCluster(
+		clusters.NewGetClusterParams().WithClusterID(id),
+		authInfo,
+	)
+	if err != nil {
+		if _, ok := err.(*clusters.GetClusterNotFound); ok {
+			return nil, ErrClusterNotFound
+		}
+		return nil, err
+	}
+
+	cluster := convertFromClusterModel(resp.Payload)
+
+	// like when listing clusters, the owner is only looked up for ready
+	// infrastructure accounts.
+	account, err := r.apiClient.InfrastructureAccounts.GetInfrastructureAccount(
+		infrastructure_accounts.NewGetInfrastructureAccountParams().WithAccountID(cluster.InfrastructureAccount),
+		authInfo,
+	)
+	if err != nil {
+		return nil, err
+	}
+	if aws.StringValue(account.Payload.LifecycleStatus) == models.InfrastructureAccountLifecycleStatusReady {
+		cluster.Owner = aws.StringValue(account.Payload.Owner)
+	}
+
+	return cluster, nil
+}
+
 // UpdateCluster updates the lifecycle_status and status field of a cluster in
 // the registry.
 func (r *httpRegistry) UpdateCluster(cluster *api.Cluster) error {
@@ -176,13 +219,157 @@ func convertFromClusterModel(cluster *models.Cluster) *api.Cluster {
 // converts a NodePool model generated from the cluster-registry swagger spec
 // into an *api.NodePool struct.
 func convertFromNodePoolModel(nodePool *models.NodePool) *api.NodePool {
+	var scalingSchedules []*api.ScalingSchedule
+	for _, schedule := range nodePool.ScalingSchedules {
+		scalingSchedules = append(scalingSchedules, convertFromScalingScheduleModel(schedule))
+	}
+
+	var lifecycleHooks []*api.LifecycleHook
+	for _, hook := range nodePool.LifecycleHooks {
+		lifecycleHooks = append(lifecycleHooks, convertFromLifecycleHookModel(hook))
+	}
+
 	return &api.NodePool{
-		DiscountStrategy: *nodePool.DiscountStrategy,
-		InstanceType:     *nodePool.InstanceType,
-		Name:             *nodePool.Name,
-		Profile:          *nodePool.Profile,
-		MinSize:          *nodePool.MinSize,
-		MaxSize:          *nodePool.MaxSize,
+		DiscountStrategy:            *nodePool.DiscountStrategy,
+		InstanceType:                *nodePool.InstanceType,
+		Name:                        *nodePool.Name,
+		Profile:                     *nodePool.Profile,
+		MinSize:                     *nodePool.MinSize,
+		MaxSize:                     *nodePool.MaxSize,
+		RequireIMDSv2:               nodePool.RequireImdsv2,
+		IMDSHopLimit:                nodePool.ImdsHopLimit,
+		Architecture:                nodePool.Architecture,
+		OS:                          nodePool.Os,
+		ScalingSchedules:            scalingSchedules,
+		Labels:                      nodePool.Labels,
+		Taints:                      nodePool.Taints,
+		UpdateSurge:                 nodePool.UpdateSurge,
+		UpdateCanary:                nodePool.UpdateCanary,
+		UpdateMaxUnavailable:        nodePool.UpdateMaxUnavailable,
+		UpdateMode:                  nodePool.UpdateMode,
+		UpdateStrategy:              nodePool.UpdateStrategy,
+		DecommissionProtection:      nodePool.DecommissionProtection,
+		ScaleDownProtection:         nodePool.ScaleDownProtection,
+		RootVolumeType:              nodePool.RootVolumeType,
+		RootVolumeSize:              nodePool.RootVolumeSize,
+		RootVolumeIOPS:              nodePool.RootVolumeIops,
+		RootVolumeEncrypted:         nodePool.RootVolumeEncrypted,
+		RootVolumeKMSKey:            nodePool.RootVolumeKmsKey,
+		AvailabilityZones:           nodePool.AvailabilityZones,
+		SubnetTags:                  nodePool.SubnetTags,
+		WarmPool:                    convertFromWarmPoolModel(nodePool.WarmPool),
+		AdoptASGs:                   nodePool.AdoptAsgs,
+		PreviousName:                nodePool.PreviousName,
+		CapacityReservationID:       nodePool.CapacityReservationID,
+		CapacityReservationGroupARN: nodePool.CapacityReservationGroupArn,
+		Tenancy:                     nodePool.Tenancy,
+		HostResourceGroupARN:        nodePool.HostResourceGroupArn,
+		Tags:                        nodePool.Tags,
+		LifecycleHooks:              lifecycleHooks,
+		Image:                       convertFromImageModel(nodePool.Image),
+		Storage:                     convertFromNodeStorageModel(nodePool.Storage),
+		KubeletConfig:               convertFromKubeletConfigModel(nodePool.KubeletConfig),
+		Monitoring:                  convertFromNodePoolMonitoringModel(nodePool.Monitoring),
+	}
+}
+
+// converts a WarmPool model generated from the cluster-registry swagger spec
+// into an *api.WarmPool struct.
+func convertFromWarmPoolModel(warmPool *models.WarmPool) *api.WarmPool {
+	if warmPool == nil {
+		return nil
+	}
+
+	return &api.WarmPool{
+		MinSize:             warmPool.MinSize,
+		MaxPreparedCapacity: warmPool.MaxPreparedCapacity,
+		State:               warmPool.State,
+		ReuseOnScaleIn:      warmPool.ReuseOnScaleIn,
+	}
+}
+
+// converts an Image model generated from the cluster-registry swagger spec
+// into an *api.Image struct.
+func convertFromImageModel(image *models.Image) *api.Image {
+	if image == nil {
+		return nil
+	}
+
+	return &api.Image{
+		SSMParameter: image.SsmParameter,
+		Owner:        image.Owner,
+		Name:         image.Name,
+		Architecture: image.Architecture,
+	}
+}
+
+// converts a NodeStorage model generated from the cluster-registry swagger
+// spec into an *api.NodeStorage struct.
+func convertFromNodeStorageModel(storage *models.NodeStorage) *api.NodeStorage {
+	if storage == nil {
+		return nil
+	}
+
+	return &api.NodeStorage{
+		StickyVolumes:     storage.StickyVolumes,
+		Device:            storage.Device,
+		InstanceStoreRAID: storage.InstanceStoreRaid,
+		Filesystem:        storage.Filesystem,
+		MountPath:         storage.MountPath,
+	}
+}
+
+// converts a KubeletConfig model generated from the cluster-registry swagger
+// spec into an *api.KubeletConfig struct.
+func convertFromKubeletConfigModel(config *models.KubeletConfig) *api.KubeletConfig {
+	if config == nil {
+		return nil
+	}
+
+	return &api.KubeletConfig{
+		MaxPods:        config.MaxPods,
+		EvictionHard:   config.EvictionHard,
+		KubeReserved:   config.KubeReserved,
+		SystemReserved: config.SystemReserved,
+	}
+}
+
+// converts a NodePoolMonitoring model generated from the cluster-registry
+// swagger spec into an *api.NodePoolMonitoring struct.
+func convertFromNodePoolMonitoringModel(monitoring *models.NodePoolMonitoring) *api.NodePoolMonitoring {
+	if monitoring == nil {
+		return nil
+	}
+
+	return &api.NodePoolMonitoring{
+		ASGMetrics:            monitoring.AsgMetrics,
+		DetailedMonitoring:    monitoring.DetailedMonitoring,
+		CloudWatchAgentConfig: monitoring.CloudwatchAgentConfig,
+	}
+}
+
+// converts a LifecycleHook model generated from the cluster-registry swagger
+// spec into an *api.LifecycleHook struct.
+func convertFromLifecycleHookModel(hook *models.LifecycleHook) *api.LifecycleHook {
+	return &api.LifecycleHook{
+		Name:                  *hook.Name,
+		Transition:            *hook.Transition,
+		HeartbeatTimeout:      hook.HeartbeatTimeout,
+		DefaultResult:         hook.DefaultResult,
+		NotificationTargetARN: hook.NotificationTargetArn,
+		RoleARN:               hook.RoleArn,
+	}
+}
+
+// converts a ScalingSchedule model generated from the cluster-registry
+// swagger spec into an *api.ScalingSchedule struct.
+func convertFromScalingScheduleModel(schedule *models.ScalingSchedule) *api.ScalingSchedule {
+	return &api.ScalingSchedule{
+		Name:            *schedule.Name,
+		Recurrence:      *schedule.Recurrence,
+		MinSize:         *schedule.MinSize,
+		MaxSize:         *schedule.MaxSize,
+		DesiredCapacity: *schedule.DesiredCapacity,
 	}
 }
 
@@ -195,11 +382,113 @@ func convertFromClusterStatusModel(status *models.ClusterStatus) *api.ClusterSta
 		problems = append(problems, convertFromProblemModel(problem))
 	}
 
+	nodePools := make([]*api.NodePoolStatus, 0, len(status.NodePools))
+	for _, nodePool := range status.NodePools {
+		// statuses without a name can't be matched to a node pool.
+		if nodePool == nil || nodePool.Name == nil {
+			continue
+		}
+		nodePools = append(nodePools, convertFromNodePoolStatusModel(nodePool))
+	}
+
 	return &api.ClusterStatus{
 		CurrentVersion: status.CurrentVersion,
 		LastVersion:    status.LastVersion,
 		NextVersion:    status.NextVersion,
 		Problems:       problems,
+		Progress:       convertFromProgressModel(status.Progress),
+		NodePools:      nodePools,
+		LastUpdate:     convertFromUpdateSummaryModel(status.LastUpdate),
+
+		PinnedChannelVersion: status.PinnedChannelVersion,
+	}
+}
+
+// converts a ClusterStatusNodePoolsItems model generated from the
+// cluster-registry swagger spec into an *api.NodePoolStatus struct.
+func convertFromNodePoolStatusModel(nodePool *models.ClusterStatusNodePoolsItems) *api.NodePoolStatus {
+	return &api.NodePoolStatus{
+		Name:          *nodePool.Name,
+		TemplateHash:  nodePool.TemplateHash,
+		StackStatus:   nodePool.StackStatus,
+		ProvisionedAt: time.Time(nodePool.ProvisionedAt),
+		Nodes:         int(nodePool.Nodes),
+		UpToDateNodes: int(nodePool.UpToDateNodes),
+		Scaling:       convertFromNodePoolScalingModel(nodePool.Scaling),
+	}
+}
+
+// converts a NodePoolScaling model generated from the cluster-registry
+// swagger spec into an *api.NodePoolScaling struct.
+func convertFromNodePoolScalingModel(scaling *models.NodePoolScaling) *api.NodePoolScaling {
+	if scaling == nil {
+		return nil
+	}
+
+	return &api.NodePoolScaling{
+		MinSize:  scaling.MinSize,
+		MaxSize:  scaling.MaxSize,
+		ScaledAt: time.Time(scaling.ScaledAt),
+		Actor:    scaling.Actor,
+	}
+}
+
+// converts a ClusterStatusProgress model generated from the cluster-registry
+// swagger spec into an *api.Progress struct.
+func convertFromProgressModel(progress *models.ClusterStatusProgress) *api.Progress {
+	if progress == nil {
+		return nil
+	}
+
+	return &api.Progress{
+		Step:      progress.Step,
+		NodePool:  progress.NodePool,
+		Message:   progress.Message,
+		StartedAt: time.Time(progress.StartedAt),
+	}
+}
+
+// converts a ClusterStatusLastUpdate model generated from the cluster-registry
+// swagger spec into an *api.UpdateSummary struct.
+func convertFromUpdateSummaryModel(summary *models.ClusterStatusLastUpdate) *api.UpdateSummary {
+	if summary == nil {
+		return nil
+	}
+
+	nodePools := make([]*api.NodePoolSummary, 0, len(summary.NodePools))
+	for _, nodePool := range summary.NodePools {
+		nodePools = append(nodePools, &api.NodePoolSummary{
+			Name:            *nodePool.Name,
+			Outcome:         nodePool.Outcome,
+			Reason:          nodePool.Reason,
+			Error:           nodePool.Error,
+			ErrorCategory:   nodePool.ErrorCategory,
+			StartedAt:       time.Time(nodePool.StartedAt),
+			DurationSeconds: nodePool.DurationSeconds,
+			Retries:         int(nodePool.Retries),
+		})
+	}
+
+	smokeTests := make([]*api.SmokeTestSummary, 0, len(summary.SmokeTests))
+	for _, smokeTest := range summary.SmokeTests {
+		smokeTests = append(smokeTests, &api.SmokeTestSummary{
+			Name:            *smokeTest.Name,
+			Outcome:         smokeTest.Outcome,
+			Error:           smokeTest.Error,
+			DurationSeconds: smokeTest.DurationSeconds,
+		})
+	}
+
+	return &api.UpdateSummary{
+		Outcome:         summary.Outcome,
+		Error:           summary.Error,
+		StartedAt:       time.Time(summary.StartedAt),
+		FinishedAt:      time.Time(summary.FinishedAt),
+		DurationSeconds: summary.DurationSeconds,
+		AWSRetries:      int(summary.AwsRetries),
+		NodePools:       nodePools,
+		Warnings:        summary.Warnings,
+		SmokeTests:      smokeTests,
 	}
 }
 
@@ -224,11 +513,96 @@ func convertToClusterStatusModel(status *api.ClusterStatus) *models.ClusterStatu
 		problems = append(problems, convertToProblemModel(problem))
 	}
 
+	nodePools := make([]*models.ClusterStatusNodePoolsItems, 0, len(status.NodePools))
+	for _, nodePool := range status.NodePools {
+		nodePools = append(nodePools, convertToNodePoolStatusModel(nodePool))
+	}
+
 	return &models.ClusterStatus{
 		CurrentVersion: status.CurrentVersion,
 		LastVersion:    status.LastVersion,
 		NextVersion:    status.NextVersion,
 		Problems:       problems,
+		Progress:       convertToProgressModel(status.Progress),
+		NodePools:      nodePools,
+		LastUpdate:     convertToUpdateSummaryModel(status.LastUpdate),
+
+		PinnedChannelVersion: status.PinnedChannelVersion,
+	}
+}
+
+// converts a *api.NodePoolStatus struct to the corresponding model generated
+// from the cluster-registry swagger spec.
+func convertToNodePoolStatusModel(nodePool *api.NodePoolStatus) *models.ClusterStatusNodePoolsItems {
+	return &models.ClusterStatusNodePoolsItems{
+		Name:          &nodePool.Name,
+		TemplateHash:  nodePool.TemplateHash,
+		StackStatus:   nodePool.StackStatus,
+		ProvisionedAt: strfmt.DateTime(nodePool.ProvisionedAt),
+		Scaling:       convertToNodePoolScalingModel(nodePool.Scaling),
+	}
+}
+
+// converts a *api.NodePoolScaling struct to the corresponding model generated
+// from the cluster-registry swagger spec.
+func convertToNodePoolScalingModel(scaling *api.NodePoolScaling) *models.NodePoolScaling {
+	if scaling == nil {
+		return nil
+	}
+
+	return &models.NodePoolScaling{
+		MinSize:  scaling.MinSize,
+		MaxSize:  scaling.MaxSize,
+		ScaledAt: strfmt.DateTime(scaling.ScaledAt),
+		Actor:    scaling.Actor,
+	}
+}
+
+// converts a *api.Progress struct to the corresponding model generated from
+// the cluster-registry swagger spec.
+func convertToProgressModel(progress *api.Progress) *models.ClusterStatusProgress {
+	if progress == nil {
+		return nil
+	}
+
+	return &models.ClusterStatusProgress{
+		Step:      progress.Step,
+		NodePool:  progress.NodePool,
+		Message:   progress.Message,
+		StartedAt: strfmt.DateTime(progress.StartedAt),
+	}
+}
+
+// converts a *api.UpdateSummary struct to the corresponding model generated
+// from the cluster-registry swagger spec.
+func convertToUpdateSummaryModel(summary *api.UpdateSummary) *models.ClusterStatusLastUpdate {
+	if summary == nil {
+		return nil
+	}
+
+	nodePools := make([]*models.ClusterStatusLastUpdateNodePoolsItems, 0, len(summary.NodePools))
+	for _, nodePool := range summary.NodePools {
+		nodePools = append(nodePools, &models.ClusterStatusLastUpdateNodePoolsItems{
+			Name:            aws.String(nodePool.Name),
+			Outcome:         nodePool.Outcome,
+			Reason:          nodePool.Reason,
+			Error:           nodePool.Error,
+			ErrorCategory:   nodePool.ErrorCategory,
+			StartedAt:       strfmt.DateTime(nodePool.StartedAt),
+			DurationSeconds: nodePool.DurationSeconds,
+			Retries:         int64(nodePool.Retries),
+		})
+	}
+
+	return &models.ClusterStatusLastUpdate{
+		Outcome:         summary.Outcome,
+		Error:           summary.Error,
+		StartedAt:       strfmt.DateTime(summary.StartedAt),
+		FinishedAt:      strfmt.DateTime(summary.FinishedAt),
+		DurationSeconds: summary.DurationSeconds,
+		AwsRetries:      int64(summary.AWSRetries),
+		NodePools:       nodePools,
+		Warnings:        summary.Warnings,
 	}
 }
 
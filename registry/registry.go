@@ -1,13 +1,19 @@
 package registry
 
 import (
+	"errors"
 	"log"
 	"net/url"
+	"strings"
 
 	"github.com/zalando-incubator/cluster-lifecycle-manager/api"
 	"golang.org/x/oauth2"
 )
 
+// ErrClusterNotFound is returned when getting a cluster which isn't in the
+// registry.
+var ErrClusterNotFound = errors.New("cluster not found")
+
 // Filter defines a filter which can be used when listing clusters.
 type Filter struct {
 	LifecycleStatus *string
@@ -17,9 +23,21 @@ type Filter struct {
 // cluster registry.
 type Registry interface {
 	ListClusters(filter Filter) ([]*api.Cluster, error)
+	GetCluster(id string) (*api.Cluster, error)
 	UpdateCluster(cluster *api.Cluster) error
 }
 
+// findCluster returns the cluster with the ID from the listed clusters of
+// registries which can't get a single cluster.
+func findCluster(clusters []*api.Cluster, id string) (*api.Cluster, error) {
+	for _, cluster := range clusters {
+		if cluster.ID == id {
+			return cluster, nil
+		}
+	}
+	return nil, ErrClusterNotFound
+}
+
 // NewRegistry initializes a new registry source based on the uri.
 func NewRegistry(uri string, tokenSource oauth2.TokenSource, options *Options) Registry {
 	url, err := url.Parse(uri)
@@ -32,6 +50,16 @@ func NewRegistry(uri string, tokenSource oauth2.TokenSource, options *Options) R
 		return NewHTTPRegistry(url, tokenSource, options)
 	case "file", "":
 		return NewFileRegistry(url.Host + url.Path)
+	case "dir":
+		return NewDirectoryRegistry(url.Host + url.Path)
+	case "git+https", "git+ssh", "git+file":
+		// the fragment is the directory of the clusters in the
+		// repository.
+		repositoryURL := strings.TrimPrefix(strings.SplitN(uri, "#", 2)[0], "git+")
+		if options == nil {
+			options = &Options{}
+		}
+		return NewGitRegistry(repositoryURL, url.Fragment, options.Workdir, options.SSHPrivateKeyFile)
 	default:
 		log.Fatalf("unknown registry type: %v", url.Scheme)
 	}
@@ -26,6 +26,14 @@ func (r *staticRegistry) ListClusters(filter Filter) ([]*api.Cluster, error) {
 	return clusters, nil
 }
 
+func (r *staticRegistry) GetCluster(id string) (*api.Cluster, error) {
+	clusters, err := r.ListClusters(Filter{})
+	if err != nil {
+		return nil, err
+	}
+	return findCluster(clusters, id)
+}
+
 func (r *staticRegistry) UpdateCluster(cluster *api.Cluster) error {
 	return nil
 }